@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/adapters/remote"
+	"github.com/hailam/genfile/internal/application"
+)
+
+// Flag values for generating several files in one run.
+var fileCount int
+var nameTemplate string
+var pathProfile string
+
+// Flag values for sizing a batch as a whole.
+var totalStr string
+var mixSpec string
+var sizeDistribution string
+
+// batchMode reports whether the command creates a batch of named files.
+func batchMode(cmd *cobra.Command) bool {
+	return cmd.Flags().Changed("count") || nameTemplate != "" || totalStr != "" || pathProfile != ""
+}
+
+// runBatch creates --count files named by --name in the --output
+// directory, or named by the last element of --output without --name.
+// With --total the files share that size between them.
+func runBatch(cmd *cobra.Command, fileService *application.FileService, request application.FileRequest, warnings func() []string) {
+	for _, name := range []string{"checksum", "split"} {
+		if cmd.Flags().Changed(name) {
+			fmt.Fprintf(os.Stderr, "Error: --%s cannot be used with --count or --name\n", name)
+			os.Exit(1)
+		}
+	}
+
+	if outputPath == "-" || remote.IsRemote(outputPath) {
+		fmt.Fprintln(os.Stderr, "Error: --count and --name need a local --output directory")
+		os.Exit(1)
+	}
+	dir, pattern := outputPath, nameTemplate
+	if pattern == "" {
+		dir, pattern = filepath.Split(outputPath)
+	}
+	if dir == "" {
+		dir = "."
+	}
+	name, err := application.ParseNameTemplate(pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if pathProfile != "" {
+		profile, err := application.ParsePathProfile(pathProfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		name = name.WithProfile(profile)
+	}
+	count := fileCount
+	if !cmd.Flags().Changed("count") {
+		count = 1
+	}
+	budget := application.Budget{Total: totalStr, Distribution: sizeDistribution}
+	if mixSpec != "" {
+		if budget.Mix, err = application.ParseMix(mixSpec); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	spinner := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+	spinner.Prefix = fmt.Sprintf("Generating %d files in %s... ", count, dir)
+	if !jsonOutput {
+		spinner.Start()
+	}
+	start := time.Now()
+	var batch application.BatchResult
+	if totalStr != "" {
+		batch, err = fileService.CreateBudgetBatch(request, dir, count, name, budget)
+	} else {
+		batch, err = fileService.CreateBatch(request, dir, count, name)
+	}
+	spinner.Stop()
+	elapsed := time.Since(start)
+
+	if jsonOutput {
+		report := newBatchReport(batch, count, elapsed, warnings())
+		if err != nil {
+			report.Error = err.Error()
+		}
+		report.print()
+	} else {
+		if len(batch.Files) > 0 {
+			fmt.Printf("Generated %d of %d files in %s: %d bytes total in %s\n", len(batch.Files), count, dir, batch.TotalSize, elapsed.Round(time.Millisecond))
+		}
+		if len(batch.Skipped) > 0 {
+			fmt.Printf("Skipped %d paths %s cannot create:\n", len(batch.Skipped), runtime.GOOS)
+			for _, s := range batch.Skipped {
+				fmt.Printf("  %q: %s\n", s.Path, s.Reason)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating file: %v\n", err)
+		}
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
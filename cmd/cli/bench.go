@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/application"
+)
+
+// jsonBench is one entry of bench --json.
+type jsonBench struct {
+	Type       string  `json:"type"`
+	Size       int64   `json:"size"`
+	Runs       int     `json:"runs"`
+	WallMS     int64   `json:"wall_ms"`
+	MBPerSec   float64 `json:"mb_per_sec"`
+	Allocs     uint64  `json:"allocs"`
+	AllocBytes uint64  `json:"alloc_bytes"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// newBenchCmd builds the bench subcommand, which times each generator.
+func newBenchCmd(fileService *application.FileService) *cobra.Command {
+	var types, size, cpuProfile, memProfile string
+	var runs int
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measure generator throughput.",
+		Long: `bench generates files of --size with each generator in --type (all by
+default) in a temporary directory and reports wall time, MB/s and heap
+allocations, to compare adapters and catch performance regressions.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			var list []string
+			if types == "" {
+				list = typeNames()
+			} else {
+				for _, t := range strings.Split(types, ",") {
+					if t = strings.TrimSpace(t); t != "" {
+						list = append(list, t)
+					}
+				}
+			}
+
+			if cpuProfile != "" {
+				f, err := os.Create(cpuProfile)
+				if err != nil {
+					return fmt.Errorf("failed to create CPU profile: %w", err)
+				}
+				defer f.Close()
+				if err := pprof.StartCPUProfile(f); err != nil {
+					return fmt.Errorf("failed to start CPU profile: %w", err)
+				}
+				defer pprof.StopCPUProfile()
+			}
+
+			if !asJSON {
+				fmt.Printf("%-8s %12s %5s %12s %10s %12s %14s\n", "TYPE", "SIZE", "RUNS", "WALL", "MB/S", "ALLOCS", "ALLOC BYTES")
+			}
+			var results []jsonBench
+			failed := 0
+			for _, t := range list {
+				r, err := fileService.Bench(t, size, runs)
+				entry := jsonBench{
+					Type: r.Type, Size: r.Size, Runs: r.Runs, WallMS: r.Wall.Milliseconds(),
+					MBPerSec: r.MBPerSec(), Allocs: r.Allocs, AllocBytes: r.AllocBytes,
+				}
+				if err != nil {
+					failed++
+					entry.Error = err.Error()
+					if !asJSON {
+						fmt.Printf("%-8s error: %v\n", t, err)
+					}
+				} else if !asJSON {
+					fmt.Printf("%-8s %12d %5d %12s %10.1f %12d %14d\n", r.Type, r.Size, r.Runs, r.Wall.Round(100*time.Microsecond), r.MBPerSec(), r.Allocs, r.AllocBytes)
+				}
+				results = append(results, entry)
+			}
+
+			if memProfile != "" {
+				f, err := os.Create(memProfile)
+				if err != nil {
+					return fmt.Errorf("failed to create memory profile: %w", err)
+				}
+				defer f.Close()
+				if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+					return fmt.Errorf("failed to write memory profile: %w", err)
+				}
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				enc.Encode(results) // nothing useful can be done if stdout is gone
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d generators failed", failed, len(list))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&types, "type", "t", "", "Comma-separated file types to benchmark (e.g., png,zip,pdf); all if empty")
+	_ = cmd.RegisterFlagCompletionFunc("type", completeTypeList) // fails only for an undefined flag
+	cmd.Flags().StringVarP(&size, "size", "s", "10MB", "Size of each generated file")
+	cmd.Flags().IntVar(&runs, "runs", 1, "Files to generate per type")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the results as a JSON array")
+	cmd.Flags().StringVar(&cpuProfile, "cpuprofile", "", "Write a pprof CPU profile of the whole run to this file")
+	cmd.Flags().StringVar(&memProfile, "memprofile", "", "Write a pprof allocation profile to this file")
+	return cmd
+}
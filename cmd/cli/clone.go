@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/application"
+)
+
+// newCloneCmd builds the clone subcommand, which generates a file shaped
+// like an existing one.
+func newCloneCmd(fileService *application.FileService) *cobra.Command {
+	var from, output, size string
+	cmd := &cobra.Command{
+		Use:   "clone",
+		Short: "Generate a file with the structure of an existing one.",
+		Long: `clone inspects --from and generates a file of the same format with its
+structure but random content: the sheet count of an XLSX, the dimensions of
+a PNG, JPEG or GIF, the page count of a PDF and the column count of a CSV.
+The new file has --size (default: the size of --from) and goes to --output
+(default: the name of --from with "-clone" added, in the current
+directory).`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			if output == "" {
+				base := filepath.Base(from)
+				ext := filepath.Ext(base)
+				output = strings.TrimSuffix(base, ext) + "-clone" + ext
+			}
+			result, st, err := fileService.Clone(from, application.FileRequest{Path: output, SizeSpec: size})
+			if err != nil {
+				return err
+			}
+			var shape []string
+			for _, k := range slices.Sorted(maps.Keys(st.Options)) {
+				shape = append(shape, k+"="+st.Options[k])
+			}
+			fmt.Printf("Cloned %s (%s", from, st.Type)
+			if len(shape) > 0 {
+				fmt.Printf(", %s", strings.Join(shape, " "))
+			}
+			fmt.Printf(") into %s (%d bytes)\n", result.Path, result.Size)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "Existing file whose format and structure to copy (required)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Path of the new file (default: <from>-clone.<ext>)")
+	cmd.Flags().StringVarP(&size, "size", "s", "", "Size of the new file (e.g., 20MB); default the size of --from")
+	cmd.MarkFlagRequired("from")
+	return cmd
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+)
+
+// typeNames returns the registered file types, sorted.
+func typeNames() []string {
+	var list []string
+	for _, t := range factory.RegisteredTypes() {
+		list = append(list, string(t))
+	}
+	slices.Sort(list)
+	return list
+}
+
+// completeType completes a --type flag taking one file type.
+func completeType(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return typeNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTypeList completes a --type flag taking comma-separated file
+// types: the one being typed, after those already given.
+func completeTypeList(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	done := toComplete[:strings.LastIndex(toComplete, ",")+1]
+	var list []string
+	for _, t := range typeNames() {
+		if !slices.Contains(strings.Split(done, ","), t) {
+			list = append(list, done+t)
+		}
+	}
+	return list, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/application"
+)
+
+// envMarks prefixes the changes of an environment in listings, as
+// infrastructure tools print their plans.
+var envMarks = map[string]string{
+	application.EnvCreate:  "+",
+	application.EnvReplace: "~",
+	application.EnvDestroy: "-",
+	application.EnvKeep:    " ",
+}
+
+// envStatePath returns the state file of the environment spec at spec,
+// or state if set.
+func envStatePath(spec, state string) string {
+	if state != "" {
+		return state
+	}
+	return spec + ".genfile-state"
+}
+
+// newApplyCmd builds the apply subcommand, which stands up the fixture
+// environment a spec declares.
+func newApplyCmd(fileService *application.FileService) *cobra.Command {
+	var state string
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "apply SPEC",
+		Short: "Create or update the fixture environment a spec declares.",
+		Long: `apply reads SPEC, a JSON file declaring files, trees of files, shared
+pools and remote servers, and brings the environment recorded in its
+state file (SPEC.genfile-state, or --state) in line with it: resources
+no longer declared are destroyed, new ones created, those whose
+declaration changed or whose files are missing replaced, and the rest
+kept. The state is saved even when a resource fails, so running apply
+again carries on and destroy removes what was made.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			spec, err := application.LoadEnvSpec(args[0])
+			if err != nil {
+				return err
+			}
+			statePath := envStatePath(args[0], state)
+			current, err := application.LoadEnvState(statePath)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				changes, err := application.PlanEnv(spec, current)
+				if err != nil {
+					return err
+				}
+				printEnvChanges(changes, true)
+				return nil
+			}
+			next, changes, applyErr := fileService.ApplyEnv(spec, current, openRemote)
+			printEnvChanges(changes, false)
+			if err := application.SaveEnvState(statePath, next); err != nil {
+				return err
+			}
+			return applyErr
+		},
+	}
+	cmd.Flags().StringVar(&state, "state", "", "State file (default SPEC.genfile-state)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the changes without making them")
+	addRemoteFlags(cmd)
+	return cmd
+}
+
+// newDestroyCmd builds the destroy subcommand, which removes every file
+// an environment's state records.
+func newDestroyCmd() *cobra.Command {
+	var state string
+	cmd := &cobra.Command{
+		Use:   "destroy SPEC",
+		Short: "Remove the fixture environment apply created.",
+		Long: `destroy removes every file and tree recorded in the state file of SPEC
+(SPEC.genfile-state, or --state), locally or on their remote servers,
+and the directories they leave empty, then the state file. Files the
+state does not record are left alone.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			spec, err := application.LoadEnvSpec(args[0])
+			if err != nil {
+				return err
+			}
+			statePath := envStatePath(args[0], state)
+			current, err := application.LoadEnvState(statePath)
+			if err != nil {
+				return err
+			}
+			next, changes, destroyErr := application.DestroyEnv(current, spec.Dir, openRemote)
+			printEnvChanges(changes, false)
+			if err := application.SaveEnvState(statePath, next); err != nil {
+				return err
+			}
+			return destroyErr
+		},
+	}
+	cmd.Flags().StringVar(&state, "state", "", "State file (default SPEC.genfile-state)")
+	addRemoteFlags(cmd)
+	return cmd
+}
+
+// printEnvChanges lists changes, then counts them by action: as a plan
+// if planned, and as done otherwise.
+func printEnvChanges(changes []application.EnvChange, planned bool) {
+	counts := map[string]int{}
+	for _, c := range changes {
+		fmt.Printf("%s %s\n", envMarks[c.Action], c.Address)
+		counts[c.Action]++
+	}
+	format := "%d created, %d replaced, %d destroyed, %d unchanged\n"
+	if planned {
+		format = "Plan: %d to create, %d to replace, %d to destroy, %d unchanged\n"
+	}
+	fmt.Printf(format, counts[application.EnvCreate], counts[application.EnvReplace], counts[application.EnvDestroy], counts[application.EnvKeep])
+}
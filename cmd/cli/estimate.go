@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/application"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// jsonPlan is the object printed by estimate --json.
+type jsonPlan struct {
+	Path         string           `json:"path"`
+	TargetSize   int64            `json:"target_size"`
+	MinSize      int64            `json:"min_size"`
+	Feasible     bool             `json:"feasible"`
+	ContentBytes int64            `json:"content_bytes"`
+	PaddingBytes int64            `json:"padding_bytes"`
+	Structure    map[string]int64 `json:"structure,omitempty"`
+}
+
+// newEstimateCmd builds the estimate subcommand, which plans a file
+// without writing it.
+func newEstimateCmd(fileService *application.FileService) *cobra.Command {
+	var path, size string
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "estimate",
+		Short: "Report the planned structure of a file without writing it.",
+		Long: `estimate reports what genfile would write for --output and --size: the
+element counts (cells, paragraphs, entries), how many bytes are content and
+how many padding, and the smallest size the format allows. Nothing is written.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			plan, err := fileService.Plan(path, size)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				printPlanJSON(path, plan)
+			} else {
+				printPlan(path, size, plan)
+			}
+			if !plan.Feasible() {
+				return fmt.Errorf("%s is below the minimum size of %d bytes for %s", size, plan.MinSize, path)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&path, "output", "o", "", "Path of the file to plan; its extension selects the format (required)")
+	cmd.Flags().StringVarP(&size, "size", "s", "", "Target size (e.g., 500KB, 2MB, 1G) (required)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the plan as a JSON object")
+	cmd.MarkFlagRequired("output")
+	cmd.MarkFlagRequired("size")
+	return cmd
+}
+
+func printPlan(path, size string, plan ports.GenerationPlan) {
+	fmt.Printf("Estimate for %s (%s):\n", path, size)
+	fmt.Printf("  %-14s %d bytes\n", "target size:", plan.TargetSize)
+	fmt.Printf("  %-14s %d bytes\n", "minimum size:", plan.MinSize)
+	if !plan.Feasible() {
+		return
+	}
+	fmt.Printf("  %-14s %d bytes\n", "content:", plan.ContentBytes)
+	fmt.Printf("  %-14s %d bytes\n", "padding:", plan.PaddingBytes)
+	for _, item := range plan.Structure {
+		fmt.Printf("  %-14s %d\n", item.Name+":", item.Count)
+	}
+}
+
+func printPlanJSON(path string, plan ports.GenerationPlan) {
+	r := jsonPlan{
+		Path:         path,
+		TargetSize:   plan.TargetSize,
+		MinSize:      plan.MinSize,
+		Feasible:     plan.Feasible(),
+		ContentBytes: plan.ContentBytes,
+		PaddingBytes: plan.PaddingBytes,
+	}
+	if len(plan.Structure) > 0 {
+		r.Structure = make(map[string]int64, len(plan.Structure))
+		for _, item := range plan.Structure {
+			r.Structure[item.Name] = item.Count
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(r) // nothing useful can be done if stdout is gone
+}
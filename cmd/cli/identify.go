@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/application"
+)
+
+// jsonIdentification is one entry of identify --json.
+type jsonIdentification struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	Type        string `json:"type,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Regenerable bool   `json:"regenerable"`
+	MinSize     int64  `json:"min_size,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// newIdentifyCmd builds the identify subcommand, which recognises the
+// format of existing files.
+func newIdentifyCmd(fileService *application.FileService) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "identify FILE...",
+		Short: "Identify the format of existing files.",
+		Long: `identify recognises the format of each FILE by its magic numbers, whatever
+its extension, and reports whether genfile can generate a placeholder of
+the same format and size, with the command that would. Text files whose
+content names no format are identified by their extension, or as plain
+text by their content when it names no text format.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			var entries []jsonIdentification
+			failed := 0
+			for _, path := range args {
+				id, err := fileService.Identify(path)
+				if err != nil || !id.Regenerable {
+					failed++
+				}
+				if asJSON {
+					entries = append(entries, identificationJSON(id, err))
+					continue
+				}
+				printIdentification(id, err)
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				enc.Encode(entries) // nothing useful can be done if stdout is gone
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d files cannot be regenerated", failed, len(args))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the results as a JSON array")
+	return cmd
+}
+
+func printIdentification(id application.Identification, err error) {
+	switch {
+	case err != nil:
+		fmt.Printf("%s: error: %v\n", id.Path, err)
+	case id.Type == "":
+		fmt.Printf("%s: %d bytes, %s\n", id.Path, id.Size, id.Reason)
+	case !id.Regenerable:
+		fmt.Printf("%s: %s (%s), %d bytes, cannot regenerate: %s\n", id.Path, id.Type, id.Source, id.Size, id.Reason)
+	default:
+		fmt.Printf("%s: %s (%s), %d bytes, regenerate with: genfile -o out.%s -s %d\n", id.Path, id.Type, id.Source, id.Size, id.Type, id.Size)
+	}
+}
+
+func identificationJSON(id application.Identification, err error) jsonIdentification {
+	r := jsonIdentification{
+		Path:        id.Path,
+		Size:        id.Size,
+		Type:        string(id.Type),
+		Source:      id.Source,
+		Regenerable: id.Regenerable,
+		MinSize:     id.MinSize,
+		Reason:      id.Reason,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
@@ -2,44 +2,239 @@ package main
 
 import (
 	"fmt"
+	"maps"
+	"math"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/spf13/cobra"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/logging"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/adapters/remote"
 	adapterutils "github.com/hailam/genfile/internal/adapters/utils"
 	"github.com/hailam/genfile/internal/application"
+	"github.com/hailam/genfile/internal/ports"
 
-	// --- Add blank imports for ALL generator packages ---
-	// This ensures their init() functions run and register the generators.
-	_ "github.com/hailam/genfile/internal/adapters/csv"
-	_ "github.com/hailam/genfile/internal/adapters/docx"
-	_ "github.com/hailam/genfile/internal/adapters/dwg"
-	_ "github.com/hailam/genfile/internal/adapters/dxf"
-	_ "github.com/hailam/genfile/internal/adapters/gif"
-	_ "github.com/hailam/genfile/internal/adapters/html"
-	_ "github.com/hailam/genfile/internal/adapters/jpeg"
-	_ "github.com/hailam/genfile/internal/adapters/json"
-	_ "github.com/hailam/genfile/internal/adapters/mp4"
-	_ "github.com/hailam/genfile/internal/adapters/pdf"
-	_ "github.com/hailam/genfile/internal/adapters/png"
-	_ "github.com/hailam/genfile/internal/adapters/txt"
-	_ "github.com/hailam/genfile/internal/adapters/wav"
-	_ "github.com/hailam/genfile/internal/adapters/xlsx"
-	_ "github.com/hailam/genfile/internal/adapters/xml"
-	_ "github.com/hailam/genfile/internal/adapters/zip"
+	// Registers every generator through its init function.
+	_ "github.com/hailam/genfile/internal/adapters/all"
 )
 
 // Variables to hold flag values
 var outputPath string
 var sizeStr string
+var sizeOfPath string
+var durationStr string
+var pagesStr, rowsStr, slidesStr string
+var resolutionStr string
+var maxSizeStr string
+var splitStr string
+var lineCount int64
+var strict bool
+var toleranceStr string
+var throttleStr string
+var resume bool
+var faultSpecs []string
+var sparse bool
+var preallocate bool
+var metaPairs []string
+var mtimeStr string
+var atomicWrite bool
+var fileMode, fileOwner, fileGroup string
+var jsonOutput bool
+var checksumAlgo string
+var sidecar bool
+var targetChecksum string
+var verbose bool
+var fileType string
+var mimeType string
+var quiet bool
+
+// generatorOptionFlags lists the flags forwarded to generators as
+// ports.Options when set on the command line.
+var generatorOptionFlags = []string{
+	"zip-encryption",
+	"zip-password",
+	"zip-compression",
+	"zip-entries",
+	"zip-entry-type",
+	"zip-entry-distribution",
+	"zip-nest-depth",
+	"zip-nest-branching",
+	"zip-sfx",
+	"zip-ratio",
+	"zip-name-length",
+	"zip-unicode-names",
+	"zip-descriptor",
+	"zip-local-order",
+	"pdf-pages",
+	"pdf-page-size",
+	"pdf-content",
+	"pdf-paragraphs",
+	"pdf-shapes",
+	"pdf-version",
+	"pdf-xref",
+	"pdf-attachments",
+	"docx-images",
+	"docx-image-size",
+	"docx-spreadsheet",
+	"tiff-pages",
+	"tiff-page-size",
+	"xlsx-sheets",
+	"xlsx-padding",
+	"csv-columns",
+	"scan-dpi",
+	"width",
+	"height",
+	"png-color",
+	"png-interlace",
+	"png-padding",
+	"jpeg-quality",
+	"jpeg-progressive",
+	"jpeg-exif",
+	"dpi",
+	"icc",
+	"icc-pad",
+	"frames",
+	"gif-delay",
+	"wav-sample-rate",
+	"wav-bits",
+	"wav-channels",
+	"wav-content",
+	"wav-frequency",
+	"mp4-fps",
+	"mp4-duration",
+	"mp4-audio",
+	"mp4-poster",
+	"mp4-thumbnails",
+	"mp4-thumbnail-interval",
+	"segment-duration",
+	"segment-format",
+	"html-content",
+	"xml-schema",
+	"xml-root",
+	"xml-record",
+	"xml-fields",
+	"txt-content",
+	"txt-line-length",
+	"bin-fill",
+	"bin-seed",
+	"bin-repeat",
+	"entropy",
+	"shared-blocks",
+	"shared-pool",
+	"threads",
+	"seed",
+	"eicar",
+	"signature-placeholder",
+	"embed-string",
+	"embed-count",
+	"lang",
+	"corpus",
+	"content",
+	"pii-density",
+	"shp-geometry",
+	"dxf-version",
+	"dxf-format",
+	"dxf-entities",
+	"fw-record-length",
+	"fw-layout",
+	"fw-newline",
+	"edi-standard",
+	"edi-newline",
+	"hl7-newline",
+	"ndjson-content",
+	"fhir-resource",
+	"oci-layers",
+	"oci-ref",
+	"pkg-name",
+	"pkg-version",
+	"pkg-arch",
+	"cert-key",
+	"cert-cn",
+	"cert-self-signed",
+	"reg-encoding",
+	"ini-newline",
+	"ps-pages",
+	"ps-page-size",
+	"xps-pages",
+	"xps-page-size",
+	"access-version",
+	"cfb-version",
+}
+
+// collectOptions gathers the generator option flags the user set.
+// The ZIP password may also be supplied via GENFILE_ZIP_PASSWORD to keep it
+// out of the process list.
+func collectOptions(cmd *cobra.Command) ports.Options {
+	opts := ports.Options{}
+	for _, name := range generatorOptionFlags {
+		if cmd.Flags().Changed(name) {
+			opts[name] = cmd.Flags().Lookup(name).Value.String()
+		}
+	}
+	if _, ok := opts["zip-password"]; !ok && opts.Has("zip-encryption") {
+		if pw := os.Getenv("GENFILE_ZIP_PASSWORD"); pw != "" {
+			opts["zip-password"] = pw
+		}
+	}
+	return opts
+}
+
+// withExtension returns path with ext appended, unless it has an extension.
+func withExtension(path, ext string) string {
+	if filepath.Ext(path) != "" {
+		return path
+	}
+	return path + "." + ext
+}
+
+// parseCount returns the document count --pages, --rows or --slides asks
+// for, if any. Counts may be written as 1e6; they must be whole numbers.
+func parseCount() (ports.Count, error) {
+	for _, c := range []struct {
+		unit ports.CountUnit
+		s    string
+	}{{ports.CountPages, pagesStr}, {ports.CountRows, rowsStr}, {ports.CountSlides, slidesStr}} {
+		if c.s == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(c.s), 64)
+		if err != nil || n != math.Trunc(n) || n < 1 || n > math.MaxInt64/2 {
+			return ports.Count{}, fmt.Errorf("invalid --%s '%s': want a whole number of at least 1", c.unit, c.s)
+		}
+		return ports.Count{Unit: c.unit, N: int64(n)}, nil
+	}
+	return ports.Count{}, nil
+}
+
+// logLevel maps --verbose and --quiet to the lowest level printed on
+// stderr. With --json, warnings are only reported in the JSON output unless
+// --verbose is set.
+func logLevel() ports.LogLevel {
+	switch {
+	case verbose:
+		return ports.LevelDebug
+	case quiet, jsonOutput:
+		return ports.LevelSilent
+	default:
+		return ports.LevelWarn
+	}
+}
 
 func main() {
 	// --- Composition Root: Initialize Adapters and Core Logic ---
 	// This remains the same as before
-	generatorFactory := factory.NewGeneratorFactory()
+	// Generator diagnostics go to stderr and are kept for the JSON report.
+	stderrLog := logging.New(os.Stderr, ports.LevelWarn)
+	logger := logging.NewRecorder(stderrLog)
+	generatorFactory := factory.NewLoggingGeneratorFactory(logger)
 	sizeParser := adapterutils.NewUtilSizeParser()
 	fileService := application.NewFileService(generatorFactory, sizeParser)
 	// --- End Composition Root ---
@@ -54,38 +249,422 @@ The content generated is typically random or minimal structure.`,
 		Args: cobra.NoArgs, // We use flags instead of positional arguments now
 		Run: func(cmd *cobra.Command, args []string) {
 			// Validate flags
-			if outputPath == "" {
+			if outputPath == "" && nameTemplate == "" {
 				fmt.Fprintln(os.Stderr, "Error: output path flag --output is required")
 				cmd.Usage()
 				os.Exit(1)
 			}
-			if sizeStr == "" {
-				fmt.Fprintln(os.Stderr, "Error: size flag --size is required")
+			if sizeOfPath != "" {
+				sizeStr = "@" + sizeOfPath
+			}
+			for _, name := range []string{"mix", "size-distribution"} {
+				if cmd.Flags().Changed(name) && totalStr == "" {
+					fmt.Fprintf(os.Stderr, "Error: --%s needs --total\n", name)
+					os.Exit(1)
+				}
+			}
+			count, err := parseCount()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if checksumAlgo != "" {
+				if err := application.CheckChecksumAlgorithm(checksumAlgo); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if sizeStr == "" && lineCount == 0 && totalStr == "" && durationStr == "" && count.N == 0 && resolutionStr == "" {
+				fmt.Fprintln(os.Stderr, "Error: size flag --size, --size-of, --total, --duration, --pages, --rows, --slides, --resolution or line count flag --lines is required")
 				cmd.Usage()
 				os.Exit(1)
 			}
 
-			// start spinner
+			if mimeType != "" {
+				ext, err := application.ExtensionForMIME(mimeType)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				// Name the output after the type if it has no extension.
+				if nameTemplate != "" {
+					nameTemplate = withExtension(nameTemplate, ext)
+				} else if outputPath != "-" {
+					outputPath = withExtension(outputPath, ext)
+				}
+			}
+
+			stderrLog.SetLevel(logLevel())
+			if len(faultSpecs) > 0 {
+				chaos := &outputfs.Chaos{}
+				for _, spec := range faultSpecs {
+					fault, err := outputfs.ParseFault(spec)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						os.Exit(1)
+					}
+					chaos.Faults = append(chaos.Faults, fault)
+				}
+				generatorFactory = factory.NewRegistryFactory(factory.DefaultRegistry(), logger, chaos)
+				fileService = application.NewFileService(generatorFactory, sizeParser).WithOutputFS(chaos)
+			}
+
+			request := application.FileRequest{
+				Path:       outputPath,
+				Type:       fileType,
+				MIME:       mimeType,
+				SizeSpec:   sizeStr,
+				Lines:      lineCount,
+				Duration:   durationStr,
+				Count:      count,
+				Resolution: resolutionStr,
+				MaxSize:    maxSizeStr,
+				Options:    collectOptions(cmd),
+				Strict:     strict,
+				Tolerance:  toleranceStr,
+				Throttle:   throttleStr,
+				MTime:      mtimeStr,
+				InPlace:    !atomicWrite,
+				Mode:       fileMode,
+				Owner:      fileOwner,
+				Group:      fileGroup,
+				Resume:     resume,
+				Sidecar:    sidecar,
+
+				TargetChecksum: targetChecksum,
+			}
+			if sparse {
+				request.Allocation = ports.AllocateSparse
+			} else if preallocate {
+				request.Allocation = ports.AllocatePreallocate
+			}
+			if meta, err := application.ParseMetadata(metaPairs); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			} else {
+				request.Metadata = meta
+			}
+
+			if batchMode(cmd) {
+				if resume {
+					fmt.Fprintln(os.Stderr, "Error: --resume cannot be used with a batch")
+					os.Exit(1)
+				}
+				runBatch(cmd, fileService, request, logger.Warnings)
+				return
+			}
+
+			// Remote files are uploaded once generated; nothing is left
+			// locally to checksum or split.
+			if remote.IsRemote(outputPath) {
+				for _, name := range []string{"checksum", "split", "mode", "owner", "group", "resume", "sidecar"} {
+					if cmd.Flags().Changed(name) {
+						fmt.Fprintf(os.Stderr, "Error: --%s cannot be used with a remote output\n", name)
+						os.Exit(1)
+					}
+				}
+			}
+
+			// "-o -" writes the file itself to stdout, so nothing else may.
+			if outputPath == "-" {
+				if fileType == "" && mimeType == "" {
+					fmt.Fprintln(os.Stderr, "Error: --type or --mime is required when writing to stdout")
+					os.Exit(1)
+				}
+				for _, name := range []string{"json", "checksum", "split", "mode", "owner", "group", "resume", "sidecar"} {
+					if cmd.Flags().Changed(name) {
+						fmt.Fprintf(os.Stderr, "Error: --%s cannot be used when writing to stdout\n", name)
+						os.Exit(1)
+					}
+				}
+				if _, err := fileService.Stream(os.Stdout, request); err != nil {
+					fmt.Fprintf(os.Stderr, "Error generating file: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			target := sizeStr
+			if sizeOfPath != "" {
+				target = "size of " + sizeOfPath
+			}
+			switch {
+			case lineCount > 0 && sizeStr != "":
+				target = fmt.Sprintf("%s, %d lines", target, lineCount)
+			case lineCount > 0:
+				target = fmt.Sprintf("%d lines", lineCount)
+			case durationStr != "":
+				target = durationStr + " of playback"
+			case count.N > 0:
+				target = fmt.Sprintf("%d %s", count.N, count.Unit)
+			case resolutionStr != "":
+				target = resolutionStr + " pixels"
+			}
+			if targetChecksum != "" {
+				target += ", " + strings.ToLower(targetChecksum)
+			}
 			spinner := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
-			spinner.Prefix = fmt.Sprintf("Generating %s (%s)... ", outputPath, sizeStr)
-			spinner.Start()
+			spinner.Prefix = fmt.Sprintf("Generating %s (%s)... ", outputPath, target)
+			if !jsonOutput {
+				spinner.Start()
+			}
 
 			// --- Execute Core Logic ---
-			err := fileService.CreateFile(outputPath, sizeStr)
+			start := time.Now()
+			var result application.FileResult
+			if remote.IsRemote(outputPath) {
+				result, err = deliverRemote(fileService, request)
+			} else {
+				result, err = fileService.Create(request)
+			}
 			spinner.Stop()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error generating file: %v\n", err)
+			report := newJSONReport(result, time.Since(start), logger.Warnings())
+			fail := func(what string, err error) {
+				if jsonOutput {
+					report.Error = err.Error()
+					report.print()
+				} else {
+					fmt.Fprintf(os.Stderr, "Error %s: %v\n", what, err)
+				}
 				os.Exit(1)
 			}
+			if err != nil {
+				fail("generating file", err)
+			}
 			// --- End Execute Core Logic ---
 
-			fmt.Printf("Successfully generated %s with size spec '%s'\n", outputPath, sizeStr)
+			if checksumAlgo != "" {
+				sum, err := application.Checksum(outputPath, checksumAlgo)
+				if err != nil {
+					fail("computing checksum", err)
+				}
+				report.Checksum = strings.ToLower(checksumAlgo) + ":" + sum
+			}
+
+			if durationStr != "" || count.N > 0 || resolutionStr != "" {
+				// The size follows from the duration, count or resolution;
+				// report what it came to.
+				target = fmt.Sprintf("%s, %d bytes", target, result.Size)
+			}
+			if !jsonOutput {
+				fmt.Printf("Successfully generated %s (%s)\n", outputPath, target)
+				for _, c := range result.Companions {
+					fmt.Printf("  with %s (%d bytes)\n", c.Path, c.Size)
+				}
+				if result.Sidecar != "" {
+					fmt.Printf("  described in %s\n", result.Sidecar)
+				}
+				if strict || toleranceStr != "" {
+					fmt.Printf("size=%d target=%d deviation=%+d\n", result.Size, result.TargetSize, result.Deviation())
+				}
+				for _, k := range slices.Sorted(maps.Keys(result.Stats)) {
+					fmt.Printf("%s=%d\n", k, result.Stats[k])
+				}
+				if report.Checksum != "" {
+					fmt.Println(report.Checksum)
+				}
+			}
+
+			if splitStr != "" {
+				parts, err := fileService.SplitFile(outputPath, splitStr)
+				if err != nil {
+					fail("splitting file", err)
+				}
+				report.Parts = parts
+				if !jsonOutput {
+					fmt.Printf("Split into %d parts of at most %s:\n", len(parts), splitStr)
+					for _, p := range parts {
+						fmt.Printf("  %s\n", p)
+					}
+				}
+			}
+
+			if jsonOutput {
+				report.print()
+			}
 		},
 	}
 
 	// Define flags
-	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Path to the output file (required)")
-	rootCmd.Flags().StringVarP(&sizeStr, "size", "s", "", "Target size (e.g., 500KB, 2MB, 1G) (required)")
+	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Path to the output file, - for stdout, or an sftp://, ftp:// or ftps:// URI to upload to (required)")
+	rootCmd.Flags().StringVarP(&fileType, "type", "t", "", "File type as an extension (e.g., csv); overrides the output extension, required with -o -")
+	rootCmd.Flags().StringVar(&mimeType, "mime", "", "File type as a MIME type (e.g., image/png), instead of --type; an output without an extension gets the type's")
+	rootCmd.MarkFlagsMutuallyExclusive("type", "mime")
+	rootCmd.Flags().StringVarP(&sizeStr, "size", "s", "", "Target size (e.g., 500KB, 2MiB, 1.5G, 1GB+512B; KB is 1000 bytes, KiB and K 1024) (required unless --lines, --total, --duration, --pages, --rows, --slides or --resolution is set)")
+	rootCmd.Flags().StringVar(&sizeOfPath, "size-of", "", "Match the size of an existing file byte for byte, instead of --size")
+	rootCmd.Flags().Int64Var(&lineCount, "lines", 0, "Exact number of lines (TXT, LOG, MD, CSV, NDJSON, FWF); combine with --size to fix both")
+	rootCmd.Flags().StringVar(&durationStr, "duration", "", "Playback length of a WAV or MP4 file (e.g., 30s, 1m30s), instead of --size; the size follows from the sample rate or frame rate and resolution")
+	rootCmd.Flags().StringVar(&pagesStr, "pages", "", "Number of pages of a PDF or DOCX document (e.g., 100), instead of --size; the size follows from the content")
+	rootCmd.Flags().StringVar(&rowsStr, "rows", "", "Number of rows of an XLSX workbook (e.g., 1e6), instead of --size; the size follows from the content")
+	rootCmd.Flags().StringVar(&slidesStr, "slides", "", "Number of slides of a presentation, instead of --size (no generator in this build writes one)")
+	rootCmd.Flags().StringVar(&resolutionStr, "resolution", "", "Pixel dimensions of a PNG, JPEG or TIFF image as WIDTHxHEIGHT (e.g., 4000x3000), instead of --size; the size follows from the encoding")
+	// A file is sized by its bytes (--size or --size-of, with --lines or
+	// not) or by one measure of its content, never both.
+	for _, measure := range []string{"pages", "rows", "slides", "resolution", "duration"} {
+		for _, sized := range []string{"size", "size-of", "lines"} {
+			rootCmd.MarkFlagsMutuallyExclusive(measure, sized)
+		}
+	}
+	rootCmd.MarkFlagsMutuallyExclusive("pages", "rows", "slides", "resolution", "duration")
+	rootCmd.MarkFlagsMutuallyExclusive("size", "size-of")
+	rootCmd.Flags().StringVar(&maxSizeStr, "max-size", "", "Fail if a file sized by --duration, --pages, --rows, --slides or --resolution would be larger than this (e.g., 20MB)")
+	rootCmd.Flags().BoolVar(&strict, "strict", false, "Fail unless the file is exactly --size bytes")
+	rootCmd.Flags().StringVar(&toleranceStr, "tolerance", "", "Accept files within this many bytes of --size (e.g., 16B), trying nearby sizes if the exact one fails")
+	rootCmd.Flags().StringVar(&throttleStr, "throttle", "", "Limit the write rate to simulate a slow producer (e.g., 10MB/s); also paces stdout and uploads")
+	rootCmd.Flags().BoolVar(&resume, "resume", false, "Write the file as <output>.genfile-partial, saving progress to <output>.genfile-resume, and carry on from there if a run was interrupted (see genfile types)")
+	rootCmd.Flags().StringArrayVar(&faultSpecs, "inject-fault", nil, "Fail the generator's writes to test error handling, as KIND@OFFSET (repeatable): enospc or eacces fail every write past OFFSET bytes of each file (eacces at 0 fails creating it), short cuts one write short there (e.g., enospc@10MB)")
+	rootCmd.Flags().BoolVar(&sparse, "sparse", false, "Leave the payload as a sparse hole so huge files take almost no disk space (see genfile types)")
+	rootCmd.Flags().BoolVar(&preallocate, "preallocate", false, "Reserve disk blocks for the payload without writing it, so huge files are created quickly (see genfile types)")
+	rootCmd.MarkFlagsMutuallyExclusive("sparse", "preallocate")
+	rootCmd.Flags().StringVar(&mtimeStr, "mtime", "", "Set the modification time (e.g., 2020-01-01T00:00:00Z) of the file and of the timestamps inside it (ZIP entries, DOCX, PDF, JPEG EXIF)")
+	rootCmd.Flags().Int64("seed", 0, "Seed the random content, so that the same seed, size, options and --mtime give the same bytes again; a batch counts up from it")
+	rootCmd.Flags().BoolVar(&atomicWrite, "atomic", true, "Write to a temporary file renamed into place once complete; false writes straight to the output")
+	rootCmd.Flags().StringVar(&fileMode, "mode", "", "Set the permissions of the file in octal (e.g., 0600); default as the umask allows")
+	rootCmd.Flags().StringVar(&fileOwner, "owner", "", "Set the owner of the file, by name or UID (Unix, needs root)")
+	rootCmd.Flags().StringVar(&fileGroup, "group", "", "Set the group of the file, by name or GID (Unix, needs root unless you belong to it)")
+	rootCmd.Flags().StringArrayVar(&metaPairs, "meta", nil, "Write a metadata property as key=value (repeatable); title, author, subject, keywords, comment and creator map to native fields (see genfile types)")
+	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result as a JSON object (path, type, sizes, duration, checksum, warnings) instead of text")
+	rootCmd.Flags().StringVar(&checksumAlgo, "checksum", "", "Report a checksum of the generated file: md5, sha1 or sha256")
+	rootCmd.Flags().BoolVar(&sidecar, "sidecar", false, "Write a JSON descriptor next to each file, as <output>.json: type, sizes, seed, options, checksums and the strings planted in it")
+	rootCmd.Flags().StringVar(&targetChecksum, "target-checksum", "", "Rewrite the free bytes the file ends in so its CRC is this value, as crc32, crc32c or crc32k, a colon and 8 hex digits (e.g., crc32:deadbeef) (see genfile types)")
+	rootCmd.MarkFlagsMutuallyExclusive("target-checksum", "lines")
+	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Also print generator debug messages to stderr")
+	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Print no generator warnings to stderr")
+	rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+	addRemoteFlags(rootCmd)
+	rootCmd.Flags().IntVar(&fileCount, "count", 1, "Number of files to generate, named by --name or by the last element of --output")
+	rootCmd.Flags().StringVar(&nameTemplate, "name", "", "File name template for --count, e.g. invoice_{seq:04}_{rand:6}.pdf; --output is then the directory")
+	rootCmd.Flags().StringVar(&pathProfile, "path-profile", "", "Turn batch file names into edge cases: unicode, long, spaces or reserved; paths this system cannot create are skipped and reported")
+	rootCmd.Flags().StringVar(&totalStr, "total", "", "Total size of a batch (e.g., 10GB), split over the --count files instead of --size per file")
+	rootCmd.Flags().StringVar(&mixSpec, "mix", "", "File types of a --total batch with percentage weights, e.g. pdf:60,png:30,txt:10; name the files with {ext}")
+	rootCmd.Flags().StringVar(&sizeDistribution, "size-distribution", application.DistUniform, "How file sizes vary in a --total batch: uniform, lognormal or zipf")
+	rootCmd.MarkFlagsMutuallyExclusive("total", "size")
+	rootCmd.MarkFlagsMutuallyExclusive("total", "size-of")
+	rootCmd.MarkFlagsMutuallyExclusive("total", "lines")
+	rootCmd.MarkFlagsMutuallyExclusive("total", "duration")
+	rootCmd.MarkFlagsMutuallyExclusive("total", "pages", "rows", "slides", "resolution")
+	rootCmd.Flags().StringVar(&splitStr, "split", "", "Split the output into parts of at most this size (e.g., 100MB), named <output>.001, .002, ...")
+	rootCmd.Flags().String("zip-encryption", "none", "ZIP entry encryption: none, zipcrypto or aes256")
+	rootCmd.Flags().String("zip-password", "", "Password for encrypted ZIP entries (or set GENFILE_ZIP_PASSWORD)")
+	rootCmd.Flags().String("zip-compression", "store", "ZIP entry compression: store or deflate")
+	rootCmd.Flags().Int("zip-entries", 1, "Number of entries in a generated ZIP")
+	rootCmd.Flags().String("zip-entry-type", "", "Comma-separated file types for ZIP entries (e.g., png,csv); random data if empty")
+	rootCmd.Flags().String("zip-entry-distribution", "equal", "How ZIP entry sizes are split: equal or random")
+	rootCmd.Flags().Int("zip-nest-depth", 0, "Nest ZIPs this many levels deep (zip inside zip...), the innermost holding the entries")
+	rootCmd.Flags().Int("zip-nest-branching", 1, "Number of ZIPs each nesting level holds (with --zip-nest-depth)")
+	rootCmd.Flags().Int("zip-ratio", 0, "Fill ZIP entries with deflated zeros that expand about this many times (up to 1032), to test decompression-ratio limits")
+	rootCmd.Flags().Bool("zip-sfx", false, "Make a self-extracting ZIP: a shell stub ahead of the archive that unzips it")
+	rootCmd.Flags().Int("zip-name-length", 0, "Pad every ZIP entry name to this many bytes (up to 65535), to stress extraction libraries")
+	rootCmd.Flags().Bool("zip-unicode-names", false, "Give ZIP entries non-ASCII names in several scripts, flagged as UTF-8")
+	rootCmd.Flags().String("zip-descriptor", "signed", "ZIP data descriptors after each entry: signed or unsigned (without the optional signature)")
+	rootCmd.Flags().String("zip-local-order", "same", "Order of the ZIP local headers against the central directory: same, reverse or shuffle")
+	rootCmd.Flags().Int("pdf-pages", 1, "Number of pages in a generated PDF")
+	rootCmd.Flags().String("pdf-page-size", "a4", "PDF page size: a3, a4, a5, letter or legal")
+	rootCmd.Flags().String("pdf-content", "none", "PDF page content: none, text, drawing or scan")
+	rootCmd.Flags().Int("pdf-paragraphs", 5, "Paragraphs of text per PDF page (with --pdf-content text)")
+	rootCmd.Flags().Int("pdf-shapes", 20, "Shapes drawn per PDF page (with --pdf-content drawing)")
+	rootCmd.Flags().String("pdf-version", "1.7", "PDF header version (1.3 to 2.0)")
+	rootCmd.Flags().String("pdf-xref", "table", "PDF cross-references: table, or stream for a cross-reference stream and object stream (PDF 1.5+)")
+	rootCmd.Flags().String("pdf-attachments", "", "Files to attach to a PDF, as comma-separated type:size pairs (e.g. png:50KB,csv:20KB)")
+	rootCmd.Flags().Int("docx-images", 0, "Number of PNG images embedded in a DOCX")
+	rootCmd.Flags().String("docx-image-size", "20KB", "Size of each image embedded in a DOCX (with --docx-images)")
+	rootCmd.Flags().String("docx-spreadsheet", "", "Size of an XLSX spreadsheet embedded in a DOCX as an OLE object (e.g. 30KB)")
+	rootCmd.Flags().Int("tiff-pages", 1, "Number of scanned pages in a generated TIFF")
+	rootCmd.Flags().String("tiff-page-size", "a4", "TIFF page size: a3, a4, a5, letter or legal")
+	rootCmd.Flags().Int("xlsx-sheets", 1, "Number of worksheets in a generated XLSX, the cells spread over them")
+	rootCmd.Flags().String("xlsx-padding", "entry", "Where an XLSX is padded: entry (a pad.bin part), comment (the zip comment) or extra (extra fields of the parts)")
+	rootCmd.Flags().Int("csv-columns", 0, "Number of columns in every CSV row (0 = 3 to 10, varying by row)")
+	rootCmd.Flags().Int("width", 0, "Image width in pixels (PNG, JPEG, GIF, MP4, PSD, JP2, DjVu); PNG, JPEG and PSD derive it from --size if unset")
+	rootCmd.Flags().Int("height", 0, "Image height in pixels (PNG, JPEG, GIF, MP4, PSD, JP2, DjVu); PNG, JPEG and PSD derive it from --size if unset")
+	rootCmd.MarkFlagsMutuallyExclusive("resolution", "width")
+	rootCmd.MarkFlagsMutuallyExclusive("resolution", "height")
+	rootCmd.Flags().String("png-color", "rgba", "PNG color type: gray, gray-alpha, rgb, rgba or palette")
+	rootCmd.Flags().Bool("png-interlace", false, "Write PNGs with Adam7 interlacing")
+	rootCmd.Flags().String("png-padding", "text", "PNG padding: text (one tEXt chunk), or ztxt or itxt (compressed chunks of up to 1 MiB before the image data)")
+	rootCmd.Flags().Int("jpeg-quality", 90, "JPEG quality (1-100)")
+	rootCmd.Flags().Bool("jpeg-progressive", false, "Write progressive JPEGs")
+	rootCmd.Flags().Bool("jpeg-exif", false, "Add a camera EXIF block (make, model, GPS, timestamps) to JPEGs")
+	rootCmd.Flags().Int("dpi", 0, "Resolution recorded in PNGs (pHYs) and JPEGs (JFIF), in dots per inch")
+	rootCmd.Flags().String("icc", "", "ICC profile embedded in PNGs and JPEGs: srgb, gray or a profile file")
+	rootCmd.Flags().Bool("icc-pad", false, "Pad PNGs and JPEGs inside the ICC profile (with --icc)")
+	rootCmd.Flags().Int("frames", 1, "Number of animation frames in a generated GIF")
+	rootCmd.Flags().Int("gif-delay", 10, "Delay between GIF animation frames in hundredths of a second")
+	rootCmd.Flags().Int("wav-sample-rate", 44100, "WAV sample rate in Hz")
+	rootCmd.Flags().Int("wav-bits", 8, "WAV bits per sample: 8, 16 or 24")
+	rootCmd.Flags().Int("wav-channels", 1, "Number of WAV audio channels (1-8)")
+	rootCmd.Flags().String("wav-content", "noise", "WAV audio content: noise, sine or silence")
+	rootCmd.Flags().Int("wav-frequency", 440, "Tone frequency in Hz (with --wav-content sine)")
+	rootCmd.Flags().Int("mp4-fps", 25, "MP4 frame rate")
+	rootCmd.Flags().Duration("mp4-duration", 0, "MP4 duration (e.g. 30s); derived from --size if unset")
+	rootCmd.Flags().Bool("mp4-audio", false, "Add a silent AAC audio track to MP4s")
+	rootCmd.Flags().Bool("mp4-poster", false, "Write a JPEG poster frame next to MP4s")
+	rootCmd.Flags().Bool("mp4-thumbnails", false, "Write a WebVTT thumbnail track and sprite next to MP4s")
+	rootCmd.Flags().Duration("mp4-thumbnail-interval", 10*time.Second, "Time each MP4 thumbnail covers")
+	rootCmd.Flags().Duration("segment-duration", 6*time.Second, "Length of each HLS or DASH media segment")
+	rootCmd.Flags().String("segment-format", "", "HLS segment container: ts (default) or fmp4; DASH always uses fmp4")
+	rootCmd.Flags().String("html-content", "padding", "HTML body content: padding (random text) or dom (realistic nested markup)")
+	rootCmd.Flags().String("xml-schema", "", "XSD to generate XML records from (its first repeating element is repeated to the target size)")
+	rootCmd.Flags().String("xml-root", "", "XML root element name (template mode, or a global element of --xml-schema)")
+	rootCmd.Flags().String("xml-record", "", "XML element repeated to fill the target size")
+	rootCmd.Flags().String("xml-fields", "", "Comma-separated child elements of each XML record, as name or name:type (e.g., id,name,price:decimal)")
+	rootCmd.Flags().String("txt-content", "random", "Text content (TXT, LOG, MD): random, lorem, words or utf8")
+	rootCmd.Flags().Int("txt-line-length", 0, "Break text into lines of exactly this many characters (0 = content default)")
+	rootCmd.Flags().String("bin-fill", "random", "Binary fill (BIN, DAT, IMG): random, seeded, zero, ff, repeat or counter")
+	rootCmd.Flags().Int("bin-seed", 1, "Seed for --bin-fill seeded; the same seed gives the same bytes")
+	rootCmd.Flags().String("bin-repeat", "", "Pattern for --bin-fill repeat: a string, or hex bytes after 0x (e.g., 0xDEADBEEF)")
+	rootCmd.Flags().Float64("entropy", 1, "Share of the filler data that is random, 0.0 to 1.0; the rest repeats, so the file compresses to about this share (BIN, ZIP, DEB, RPM, NPM, WHL, CFB, AI)")
+	rootCmd.Flags().Float64("shared-blocks", 0, "Share of the filler data, 0.0 to 1.0, drawn in 64KB chunks from a pool common to the files of a batch, so deduplicating storage finds it repeated across them (BIN, ZIP, DEB, RPM, NPM, WHL, CFB, AI)")
+	rootCmd.Flags().Uint64("shared-pool", 0, "Seed of the --shared-blocks pool; runs with the same seed share chunks (default: one random pool per run)")
+	rootCmd.Flags().Int("threads", 1, "Goroutines filling the random payload of BIN, TXT, LOG, MD, WAV, ZIP and PDF files, written to disk at their offsets; 0 for one per CPU")
+	rootCmd.Flags().Bool("eicar", false, "Embed the harmless EICAR anti-virus test string (TXT, LOG, MD, ZIP, PDF, DOCX)")
+	rootCmd.Flags().Bool("signature-placeholder", false, "Prepare the file for signing: an empty signature field with a /ByteRange placeholder (PDF), or an empty _xmlsignatures origin part (DOCX, XLSX)")
+	rootCmd.Flags().String("embed-string", "", "Plant this search string in the file's text, for indexing tests (TXT, LOG, MD, CSV, PDF, DOCX)")
+	rootCmd.Flags().Int("embed-count", 1, "Number of times --embed-string appears")
+	rootCmd.Flags().String("corpus", "", "Draw text from the sentences and rows of the text files in this directory, or this file, instead of placeholder words (TXT, LOG, MD, CSV, JSON, DOCX, XLSX, HTML, XML, SRT, VTT)")
+	rootCmd.Flags().String("lang", "", "Write text content in ar, zh, ru, emoji or mixed scripts (TXT, LOG, MD, CSV, JSON, DOCX, XLSX, HTML, XML, SRT, VTT)")
+	rootCmd.Flags().String("content", "", "Content profile: csv-injection seeds cells with formula-injection payloads, quotes and line breaks (CSV, XLSX); csv-quoting starts with a BOM and quotes cells holding separators, escaped quotes and line breaks (CSV); pii seeds synthetic SSNs, card numbers and emails and writes a <name>.pii.json manifest (TXT, LOG, MD, CSV)")
+	rootCmd.Flags().String("pii-density", "0.05", "Share of words or cells that are personal data (with --content pii)")
+	rootCmd.Flags().String("shp-geometry", "", "Shapefile geometry: point, polyline or polygon (SHP; default polygon)")
+	rootCmd.Flags().String("dxf-version", "", "DXF release: r12, 2000 or 2018 (DXF; default 2000)")
+	rootCmd.Flags().String("dxf-format", "", "DXF encoding: ascii or binary (DXF; default ascii)")
+	rootCmd.Flags().String("dxf-entities", "", "Comma-separated entity kinds drawn in turn: line, circle, polyline, text (DXF; default all)")
+	rootCmd.Flags().Int("fw-record-length", 0, "Fixed-width record length in bytes, without the newline (FWF; default 80, or the --fw-layout width)")
+	rootCmd.Flags().String("fw-layout", "", "Fixed-width fields as name:kind:width, kind A (text), N (zero-padded number) or D (CCYYMMDD) (e.g., id:N:10,name:A:30)")
+	rootCmd.Flags().String("fw-newline", "lf", "Fixed-width record separator: lf, crlf or none (FWF)")
+	rootCmd.Flags().String("edi-standard", "", "EDI standard: x12 (850 purchase order) or edifact (ORDERS); default from the extension, else x12")
+	rootCmd.Flags().Bool("edi-newline", false, "Put a line break after every EDI segment")
+	rootCmd.Flags().Bool("hl7-newline", false, "End HL7 segments with CR LF instead of CR")
+	rootCmd.Flags().String("ndjson-content", "log", "NDJSON records: log or fhir (FHIR bulk export resources)")
+	rootCmd.Flags().String("fhir-resource", "", "FHIR resource type with --ndjson-content fhir: Patient or Observation; default from the file name, else Patient")
+	rootCmd.Flags().Int("oci-layers", 1, "Number of layers of a container image, 1 to 127 (OCI)")
+	rootCmd.Flags().String("oci-ref", "genfile:latest", "Name and tag of a container image (OCI)")
+	rootCmd.Flags().String("pkg-name", "genfile-fixture", "Package name (DEB, RPM, JAR, WAR, npm, wheel); for APK an application ID such as com.example.genfile")
+	rootCmd.Flags().String("pkg-version", "1.0.0-1", "Package version and release, as version-release (DEB, RPM); for JAR, WAR, APK, npm and wheel the version, 1.0.0 unless set")
+	rootCmd.Flags().String("pkg-arch", "", "Package architecture: amd64/x86_64 (default), arm64/aarch64 or all/noarch (DEB, RPM)")
+	rootCmd.Flags().String("cert-key", "ecdsa", "Key algorithm: ecdsa (P-256), rsa (2048-bit) or ed25519 (PEM, CRT, KEY, DER)")
+	rootCmd.Flags().String("cert-cn", "genfile.test", "Common name of a certificate, also its DNS name or IP address (PEM, CRT, DER)")
+	rootCmd.Flags().Bool("cert-self-signed", true, "Sign a certificate with its own key; false signs it with a throwaway CA (PEM, CRT, DER)")
+	rootCmd.Flags().String("reg-encoding", "utf16", "Registry export encoding: utf16 (UTF-16LE with a BOM, as regedit writes) or utf8 (REG)")
+	rootCmd.Flags().String("ini-newline", "crlf", "INI line ending: crlf or lf (INI)")
+	rootCmd.Flags().Int("ps-pages", 1, "Number of pages in a generated PostScript document")
+	rootCmd.Flags().String("ps-page-size", "a4", "PostScript page size: a3, a4, a5, letter or legal")
+	rootCmd.Flags().Int("xps-pages", 1, "Number of pages in a generated XPS document")
+	rootCmd.Flags().String("xps-page-size", "a4", "XPS page size: a3, a4, a5, letter or legal")
+	rootCmd.Flags().String("access-version", "", "Access engine version: jet3 or jet4 (MDB, default jet4); 2007, 2010, 2013, 2016 or 2019 (ACCDB, default 2016)")
+	rootCmd.Flags().Int("cfb-version", 3, "Compound file major version: 3 (512-byte sectors) or 4 (4096-byte sectors) (CFB)")
+	rootCmd.Flags().Int("scan-dpi", 150, "Starting resolution of scanned pages (PDF scan content, TIFF); lowered if the size budget demands it")
+
+	rootCmd.AddCommand(newEstimateCmd(fileService))
+	rootCmd.AddCommand(newBenchCmd(fileService))
+	rootCmd.AddCommand(newSamplesCmd(fileService))
+	rootCmd.AddCommand(newTypesCmd(fileService))
+	rootCmd.AddCommand(newIdentifyCmd(fileService))
+	rootCmd.AddCommand(newCloneCmd(fileService))
+	rootCmd.AddCommand(newResizeCmd(fileService))
+	rootCmd.AddCommand(newWizardCmd(rootCmd, generatorFactory, sizeParser))
+	rootCmd.AddCommand(newApplyCmd(fileService), newDestroyCmd())
+	// This fails only for an undefined flag, and --type is defined above.
+	_ = rootCmd.RegisterFlagCompletionFunc("type", completeType)
 
 	// Execute the root command
 	if err := rootCmd.Execute(); err != nil {
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs genfile itself, rather than the tests, when the test
+// binary is started by runGenfile.
+func TestMain(m *testing.M) {
+	if os.Getenv("GENFILE_RUN_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runGenfile runs genfile with args in a new process, returning what it
+// printed and how it exited.
+func runGenfile(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "GENFILE_RUN_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestLinesWithSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if out, err := runGenfile(t, "-o", path, "--lines", "50", "-s", "10KB"); err != nil {
+		t.Fatalf("genfile --lines 50 -s 10KB: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 10000 {
+		t.Errorf("size = %d, want 10000", len(data))
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 50 {
+		t.Errorf("lines = %d, want 50", n)
+	}
+}
+
+func TestSizeFlagsExclusive(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"PagesSize", []string{"-o", "a.pdf", "--pages", "2", "-s", "10KB"}},
+		{"RowsLines", []string{"-o", "a.xlsx", "--rows", "10", "--lines", "10"}},
+		{"ResolutionSizeOf", []string{"-o", "a.png", "--resolution", "10x10", "--size-of", "go.mod"}},
+		{"DurationSize", []string{"-o", "a.wav", "--duration", "1s", "-s", "10KB"}},
+		{"PagesRows", []string{"-o", "a.pdf", "--pages", "2", "--rows", "10"}},
+		{"SizeSizeOf", []string{"-o", "a.bin", "-s", "10KB", "--size-of", "go.mod"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tc.args[1] = filepath.Join(dir, tc.args[1])
+			out, err := runGenfile(t, tc.args...)
+			if err == nil {
+				t.Fatalf("genfile %s succeeded, want an error", strings.Join(tc.args, " "))
+			}
+			if !strings.Contains(out, "if any flags in the group") {
+				t.Errorf("genfile %s: %s, want the flags refused together", strings.Join(tc.args, " "), out)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("genfile %s wrote %d files", strings.Join(tc.args, " "), len(entries))
+			}
+		})
+	}
+}
+
+func TestUnknownChecksum(t *testing.T) {
+	dir := t.TempDir()
+	out, err := runGenfile(t, "-o", filepath.Join(dir, "a.bin"), "-s", "10KB", "--checksum", "crc32")
+	if err == nil {
+		t.Fatalf("genfile --checksum crc32 succeeded, want an error")
+	}
+	if !strings.Contains(out, `unknown checksum algorithm "crc32"`) {
+		t.Errorf("genfile --checksum crc32: %s, want the algorithm refused", out)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("genfile --checksum crc32 wrote %d files", len(entries))
+	}
+}
+
+func TestSeed(t *testing.T) {
+	// Each run writes a file of the same name, in a directory of its own,
+	// since some formats record the name.
+	generate := func(name, seed string, args ...string) []byte {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), name)
+		args = append([]string{"-o", path, "-s", "20KB", "--seed", seed, "--mtime", "2020-01-01"}, args...)
+		if out, err := runGenfile(t, args...); err != nil {
+			t.Fatalf("genfile -o %s --seed %s: %v\n%s", name, seed, err, out)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	for _, ext := range []string{"txt", "png", "pdf", "zip"} {
+		a := generate("f."+ext, "42")
+		if b := generate("f."+ext, "42"); !bytes.Equal(a, b) {
+			t.Errorf("%s: two files of --seed 42 differ", ext)
+		}
+		if c := generate("f."+ext, "43"); bytes.Equal(a, c) {
+			t.Errorf("%s: --seed 42 and 43 gave the same file", ext)
+		}
+	}
+	// The bytes are the seed's alone, however many goroutines make them.
+	for _, ext := range []string{"bin", "txt", "wav", "zip", "pdf"} {
+		a := generate("f."+ext, "42", "-s", "3MB", "--threads", "1")
+		if b := generate("f."+ext, "42", "-s", "3MB", "--threads", "4"); !bytes.Equal(a, b) {
+			t.Errorf("%s: --seed 42 gave different files on --threads 1 and 4", ext)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/hailam/genfile/internal/application"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// jsonReport is the object printed by --json, one per run.
+type jsonReport struct {
+	Path       string      `json:"path"`
+	Type       string      `json:"type,omitempty"`
+	TargetSize *int64      `json:"target_size,omitempty"`
+	ActualSize *int64      `json:"actual_size,omitempty"`
+	Lines      int64       `json:"lines,omitempty"`
+	DurationMS int64       `json:"duration_ms"`
+	Checksum   string      `json:"checksum,omitempty"`
+	Parts      []string    `json:"parts,omitempty"`
+	Companions []string    `json:"companions,omitempty"`
+	Sidecar    string      `json:"sidecar,omitempty"`
+	Stats      ports.Stats `json:"stats,omitempty"`
+	Warnings   []string    `json:"warnings"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// newJSONReport fills a report from a (possibly partial) generation result.
+func newJSONReport(result application.FileResult, elapsed time.Duration, warnings []string) jsonReport {
+	r := jsonReport{
+		Path:       result.Path,
+		Type:       string(result.Type),
+		Lines:      result.Lines,
+		Sidecar:    result.Sidecar,
+		DurationMS: elapsed.Milliseconds(),
+		Warnings:   append([]string{}, warnings...),
+	}
+	if len(result.Stats) > 0 {
+		r.Stats = result.Stats
+	}
+	if paths := result.Paths(); len(paths) > 1 {
+		r.Companions = paths[1:]
+	}
+	if result.TargetSize != ports.AnySize {
+		r.TargetSize = &result.TargetSize
+	}
+	if result.Size != ports.AnySize {
+		r.ActualSize = &result.Size
+	}
+	return r
+}
+
+// print writes the report to stdout as indented JSON.
+func (r jsonReport) print() {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(r) // nothing useful can be done if stdout is gone
+}
+
+// batchReport is the object printed by --json with --count or --name.
+type batchReport struct {
+	Count      int         `json:"count"`
+	Created    int         `json:"created"`
+	TotalSize  int64       `json:"total_size"`
+	DurationMS int64       `json:"duration_ms"`
+	Files      []batchFile `json:"files"`
+	Skipped    []skipped   `json:"skipped,omitempty"`
+	Warnings   []string    `json:"warnings"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// batchFile describes one file of a batch.
+type batchFile struct {
+	Path       string      `json:"path"`
+	Type       string      `json:"type"`
+	ActualSize int64       `json:"actual_size"`
+	Lines      int64       `json:"lines,omitempty"`
+	Companions []string    `json:"companions,omitempty"`
+	Sidecar    string      `json:"sidecar,omitempty"`
+	Stats      ports.Stats `json:"stats,omitempty"`
+}
+
+// skipped describes a file of a batch left out because of its path.
+type skipped struct {
+	Path   string `json:"path"`
+	OS     string `json:"os"`
+	Reason string `json:"reason"`
+}
+
+// newBatchReport fills a report from the files a batch created.
+func newBatchReport(batch application.BatchResult, count int, elapsed time.Duration, warnings []string) batchReport {
+	r := batchReport{
+		Count:      count,
+		Created:    len(batch.Files),
+		TotalSize:  batch.TotalSize,
+		DurationMS: elapsed.Milliseconds(),
+		Files:      []batchFile{},
+		Warnings:   append([]string{}, warnings...),
+	}
+	for _, f := range batch.Files {
+		r.Files = append(r.Files, batchFile{Path: f.Path, Type: string(f.Type), ActualSize: f.Size, Lines: f.Lines, Companions: f.Paths()[1:], Sidecar: f.Sidecar, Stats: f.Stats})
+	}
+	for _, s := range batch.Skipped {
+		r.Skipped = append(r.Skipped, skipped{Path: s.Path, OS: runtime.GOOS, Reason: s.Reason})
+	}
+	return r
+}
+
+// print writes the report to stdout as indented JSON.
+func (r batchReport) print() {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(r) // nothing useful can be done if stdout is gone
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/adapters/remote"
+	"github.com/hailam/genfile/internal/application"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// Flag values for remote (sftp://, ftp://, ftps://) outputs.
+var remoteUser string
+var remotePassword string
+var remoteKey string
+var remoteKnownHosts string
+var remoteInsecure bool
+
+// addRemoteFlags registers the remote output settings on cmd.
+func addRemoteFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&remoteUser, "remote-user", "", "User for remote outputs when the URI has none (or set GENFILE_REMOTE_USER; FTP defaults to anonymous)")
+	flags.StringVar(&remotePassword, "remote-password", "", "Password for remote outputs when the URI has none (or set GENFILE_REMOTE_PASSWORD)")
+	flags.StringVar(&remoteKey, "remote-key", "", "SSH private key file for SFTP outputs (or set GENFILE_REMOTE_KEY)")
+	flags.StringVar(&remoteKnownHosts, "remote-known-hosts", "", "known_hosts file for checking SFTP host keys (default ~/.ssh/known_hosts)")
+	flags.BoolVar(&remoteInsecure, "remote-insecure", false, "Skip SFTP host key and FTPS certificate checks")
+}
+
+// remoteConfig builds the remote sink settings from the flags, falling back
+// to GENFILE_REMOTE_USER, GENFILE_REMOTE_PASSWORD and GENFILE_REMOTE_KEY so
+// credentials can stay out of the process list.
+func remoteConfig() remote.Config {
+	cfg := remote.Config{
+		User:       remoteUser,
+		Password:   remotePassword,
+		KeyFile:    remoteKey,
+		KnownHosts: remoteKnownHosts,
+		Insecure:   remoteInsecure,
+	}
+	if cfg.User == "" {
+		cfg.User = os.Getenv("GENFILE_REMOTE_USER")
+	}
+	if cfg.Password == "" {
+		cfg.Password = os.Getenv("GENFILE_REMOTE_PASSWORD")
+	}
+	if cfg.KeyFile == "" {
+		cfg.KeyFile = os.Getenv("GENFILE_REMOTE_KEY")
+	}
+	return cfg
+}
+
+// openRemote connects to the remote output uri with the flags' settings.
+func openRemote(uri string) (ports.Sink, string, error) {
+	return remote.Open(uri, remoteConfig())
+}
+
+// deliverRemote generates request and uploads it to the URI in its Path.
+func deliverRemote(fileService *application.FileService, request application.FileRequest) (application.FileResult, error) {
+	sink, remotePath, err := openRemote(request.Path)
+	if err != nil {
+		return application.FileResult{Path: request.Path, Size: ports.AnySize, TargetSize: ports.AnySize}, err
+	}
+	defer sink.Close()
+	return fileService.Deliver(sink, remotePath, request)
+}
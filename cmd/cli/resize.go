@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/application"
+)
+
+// newResizeCmd builds the resize subcommand, which re-emits an existing
+// file at another size.
+func newResizeCmd(fileService *application.FileService) *cobra.Command {
+	var from, output, size string
+	cmd := &cobra.Command{
+		Use:   "resize",
+		Short: "Re-emit an existing file at a different size.",
+		Long: `resize writes --from to --output at exactly --size, keeping its content and
+a valid format: PNG gets a padding chunk, ZIP, DOCX and XLSX a padding
+entry, PDF an incremental update with a padding stream, and BIN is cut
+or extended. Padding genfile added before is replaced, so PNG, ZIP, DOCX
+and XLSX files can also shrink back; PDF files can only grow. The format
+is identified by content. --output defaults to the name of --from with
+"-resized" added, in the current directory.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			if output == "" {
+				base := filepath.Base(from)
+				ext := filepath.Ext(base)
+				output = strings.TrimSuffix(base, ext) + "-resized" + ext
+			}
+			result, err := fileService.Resize(from, output, size)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Resized %s into %s (%d bytes)\n", from, result.Path, result.Size)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "Existing file to resize (required)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Path of the resized file (default: <from>-resized.<ext>)")
+	cmd.Flags().StringVarP(&size, "size", "s", "", "New size (e.g., 20MB) (required)")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("size")
+	return cmd
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/application"
+)
+
+// jsonSample is one entry of samples --json.
+type jsonSample struct {
+	Type  string   `json:"type"`
+	Path  string   `json:"path,omitempty"`
+	Size  int64    `json:"size,omitempty"`
+	Files []string `json:"files,omitempty"` // the path and its companions, for multi-file formats
+	Error string   `json:"error,omitempty"`
+}
+
+// newSamplesCmd builds the samples subcommand, which writes one small file
+// of every format.
+func newSamplesCmd(fileService *application.FileService) *cobra.Command {
+	var types, out string
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "samples",
+		Short: "Generate one small valid file of every supported type.",
+		Long: `samples writes sample.<type> for each type in --type (all registered types
+by default) into the --out directory, for smoke-testing an ingestion
+pipeline against the whole format matrix. Each file is the smallest its
+generator can plan, or 64KiB for generators that cannot plan. A type that
+fails is reported and the others are still written.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			var list []string
+			if types == "" {
+				list = typeNames()
+			} else {
+				for _, t := range strings.Split(types, ",") {
+					if t = strings.TrimSpace(t); t != "" {
+						list = append(list, t)
+					}
+				}
+			}
+
+			var results []jsonSample
+			failed := 0
+			var total int64
+			for _, t := range list {
+				r, err := fileService.CreateSample(t, out)
+				entry := jsonSample{Type: t}
+				if err != nil {
+					failed++
+					entry.Error = err.Error()
+					if !asJSON {
+						fmt.Printf("%-8s error: %v\n", t, err)
+					}
+				} else {
+					entry.Path, entry.Size = r.Path, r.Size
+					if len(r.Companions) > 0 {
+						entry.Files = r.Paths()
+					}
+					total += r.Size
+					for _, c := range r.Companions {
+						total += c.Size
+					}
+					if !asJSON {
+						fmt.Printf("%-8s %10d  %s\n", t, r.Size, r.Path)
+					}
+				}
+				results = append(results, entry)
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				enc.Encode(results) // nothing useful can be done if stdout is gone
+			} else {
+				fmt.Printf("Generated %d of %d types in %s: %d bytes total\n", len(list)-failed, len(list), out, total)
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d types failed", failed, len(list))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&out, "out", ".", "Directory to write the samples to, created if missing")
+	cmd.Flags().StringVarP(&types, "type", "t", "", "Comma-separated file types to write samples of (e.g., png,zip,pdf); all if empty")
+	_ = cmd.RegisterFlagCompletionFunc("type", completeTypeList) // fails only for an undefined flag
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the results as a JSON array")
+	return cmd
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/application"
+)
+
+// jsonType is one entry of types --json.
+type jsonType struct {
+	Type       string       `json:"type"`
+	Extensions []string     `json:"extensions"`
+	MIMETypes  []string     `json:"mime_types,omitempty"`
+	MinSize    int64        `json:"min_size,omitempty"` // omitted for formats that do not plan their output
+	Exact      bool         `json:"exact"`              // every size from min_size can be written
+	SizeStep   int64        `json:"size_step"`
+	Features   jsonFeatures `json:"features"`
+	Options    []jsonOption `json:"options"`
+}
+
+// jsonFeatures is the features of a type, named after the columns of the
+// types table.
+type jsonFeatures struct {
+	Options    bool `json:"options"`
+	Lines      bool `json:"lines"`
+	Stream     bool `json:"stream"`
+	Estimate   bool `json:"estimate"`
+	Sparse     bool `json:"sparse"`
+	Meta       bool `json:"meta"`
+	Resize     bool `json:"resize"`
+	Duration   bool `json:"duration"`
+	Count      bool `json:"count"`
+	Resolution bool `json:"resolution"`
+	Checksum   bool `json:"checksum"`
+	Resume     bool `json:"resume"`
+}
+
+// jsonOption is a format option flag that applies to a type.
+type jsonOption struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // the flag's value type, such as "string", "int" or "bool"
+	Default     string `json:"default"`
+	Description string `json:"description"`
+}
+
+// newTypesCmd builds the types subcommand, which lists the registered
+// generators and the optional features each supports.
+func newTypesCmd(fileService *application.FileService) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "types",
+		Short: "List supported file types and their features.",
+		Long: `types lists every file type genfile can generate and whether it accepts
+format options, --lines, -o - (streaming without a temporary file),
+estimate, --sparse/--preallocate, --meta, resize, --duration,
+--pages/--rows/--slides, --resolution, --target-checksum and --resume.
+
+With --json it prints, for front ends that build forms from it, every
+type's extensions, MIME types, minimum size, whether it is written at
+any size or in steps, its features and the format option flags that
+apply to it, with their value types, defaults and descriptions.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			list := typeNames()
+			if asJSON {
+				return printTypesJSON(cmd.Root(), fileService, list)
+			}
+
+			mark := func(ok bool) string {
+				if ok {
+					return "yes"
+				}
+				return "-"
+			}
+			fmt.Printf("%-8s %-8s %-6s %-7s %-9s %-7s %-5s %-7s %-9s %-6s %-11s %-9s %s\n", "TYPE", "OPTIONS", "LINES", "STREAM", "ESTIMATE", "SPARSE", "META", "RESIZE", "DURATION", "COUNT", "RESOLUTION", "CHECKSUM", "RESUME")
+			for _, t := range list {
+				c, err := fileService.Capabilities(t)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%-8s %-8s %-6s %-7s %-9s %-7s %-5s %-7s %-9s %-6s %-11s %-9s %s\n", t, mark(c.Options), mark(c.Lines), mark(c.Stream), mark(c.Plan), mark(c.Allocate), mark(c.Metadata), mark(c.Resize), mark(c.Duration), mark(c.Count), mark(c.Resolution), mark(c.Checksum), mark(c.Resume))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print every type's extensions, sizes, features and options as a JSON array")
+	return cmd
+}
+
+// printTypesJSON prints the types in list as a JSON array of jsonType,
+// with the option flags of root that apply to each.
+func printTypesJSON(root *cobra.Command, fileService *application.FileService, list []string) error {
+	results := []jsonType{}
+	for _, t := range list {
+		info, err := fileService.Describe(t)
+		if err != nil {
+			return err
+		}
+		c := info.Capabilities
+		entry := jsonType{
+			Type:       t,
+			Extensions: info.Extensions,
+			MIMETypes:  info.MIMETypes,
+			MinSize:    info.MinSize,
+			Exact:      info.SizeStep == 1,
+			SizeStep:   info.SizeStep,
+			Features: jsonFeatures{
+				Options: c.Options, Lines: c.Lines, Stream: c.Stream, Estimate: c.Plan,
+				Sparse: c.Allocate, Meta: c.Metadata, Resize: c.Resize, Duration: c.Duration,
+				Count: c.Count, Resolution: c.Resolution, Checksum: c.Checksum, Resume: c.Resume,
+			},
+			Options: []jsonOption{},
+		}
+		for _, name := range optionFlagsFor(root, t) {
+			f := root.Flags().Lookup(name)
+			entry.Options = append(entry.Options, jsonOption{Name: f.Name, Type: f.Value.Type(), Default: f.DefValue, Description: f.Usage})
+		}
+		results = append(results, entry)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
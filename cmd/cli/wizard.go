@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// newWizardCmd builds the wizard subcommand, which asks for a file's type,
+// size and options and prints the command that generates it.
+func newWizardCmd(root *cobra.Command, generators ports.GeneratorFactory, sizes ports.SizeParser) *cobra.Command {
+	return &cobra.Command{
+		Use:   "wizard",
+		Short: "Build a genfile command step by step.",
+		Long: `wizard asks for the type, size and output path of a file, then for each
+format option of that type, checking every answer, and prints the
+equivalent genfile command. An empty answer takes the default in
+brackets. Nothing is generated.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			w := &wizard{in: bufio.NewScanner(cmd.InOrStdin()), out: cmd.OutOrStdout()}
+			types := typeNames()
+			fmt.Fprintf(w.out, "File types: %s\n", strings.Join(types, ", "))
+			fileType, err := w.ask("File type", "txt", func(s string) error {
+				if !slices.Contains(types, s) {
+					return fmt.Errorf("unknown file type %q", s)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			size, err := w.ask("Size (e.g. 500KB, 2MiB)", "1MB", func(s string) error {
+				n, err := sizes.Parse(s)
+				if err == nil && n <= 0 {
+					err = fmt.Errorf("size must be positive")
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			output, err := w.ask("Output file", "output."+fileType, func(s string) error {
+				if strings.HasPrefix(s, "-") {
+					return fmt.Errorf("the output must be a file path")
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			names := optionFlagsFor(root, fileType)
+			var set []string
+			var values map[string]string
+			for {
+				if len(names) > 0 {
+					fmt.Fprintf(w.out, "Options for %s (Enter keeps the default):\n", fileType)
+				}
+				set, values = nil, map[string]string{}
+				for _, name := range names {
+					f := root.Flags().Lookup(name)
+					fmt.Fprintf(w.out, "  %s\n", f.Usage)
+					v, err := w.ask("  --"+name, f.DefValue, func(s string) error { return checkFlagValue(name, f.Value.Type(), s) })
+					if err != nil {
+						return err
+					}
+					if v != f.DefValue {
+						set = append(set, name)
+						values[name] = v
+					}
+				}
+				// The generator has the last word on its options.
+				_, err := generators.ForOptions(ports.FileType(fileType), ports.Options(values))
+				if err == nil {
+					break
+				}
+				fmt.Fprintf(w.out, "Invalid options: %v\n", err)
+			}
+
+			command := []string{root.Name(), "-o", output, "-s", size}
+			if strings.TrimPrefix(filepath.Ext(output), ".") != fileType {
+				command = append(command, "-t", fileType)
+			}
+			for _, name := range set {
+				if root.Flags().Lookup(name).Value.Type() == "bool" {
+					command = append(command, "--"+name+"="+values[name])
+				} else {
+					command = append(command, "--"+name, values[name])
+				}
+			}
+			for i, arg := range command {
+				command[i] = shellQuote(arg)
+			}
+			fmt.Fprintf(w.out, "\n%s\n", strings.Join(command, " "))
+			return nil
+		},
+	}
+}
+
+// wizard asks questions on out and reads the answers, a line each, from
+// in.
+type wizard struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// ask asks question until the answer, or def for an empty one, passes
+// check, if there is one.
+func (w *wizard) ask(question, def string, check func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(w.out, "%s: ", question)
+		}
+		if !w.in.Scan() {
+			if err := w.in.Err(); err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("input ended before the wizard was done")
+		}
+		answer := strings.TrimSpace(w.in.Text())
+		if answer == "" {
+			answer = def
+		}
+		if check == nil {
+			return answer, nil
+		}
+		err := check(answer)
+		if err == nil {
+			return answer, nil
+		}
+		fmt.Fprintf(w.out, "  %v\n", err)
+	}
+}
+
+// typeAliases lists the other names a file type goes by in option flag
+// names and help.
+var typeAliases = map[string][]string{
+	"log":    {"txt"},
+	"md":     {"txt"},
+	"m4v":    {"mp4"},
+	"m3u8":   {"hls", "segment"},
+	"mpd":    {"dash", "segment"},
+	"pdf":    {"scan"},
+	"tiff":   {"scan"},
+	"fwf":    {"fw"},
+	"ndjson": {"fhir"},
+	"deb":    {"pkg"},
+	"rpm":    {"pkg"},
+	"jar":    {"pkg"},
+	"war":    {"pkg"},
+	"apk":    {"pkg"},
+	"npm":    {"pkg"},
+	"whl":    {"pkg", "wheel"},
+	"pem":    {"cert"},
+	"crt":    {"cert"},
+	"key":    {"cert"},
+	"der":    {"cert"},
+	"mdb":    {"access"},
+	"accdb":  {"access"},
+	"ps":     {"postscript"},
+}
+
+// optionFlagsFor returns the names of the generator option flags of root
+// that apply to fileType: those named after it, such as --png-color, and
+// those not named after another type whose help mentions it, such as
+// --width ("PNG") or --dpi ("PNGs").
+func optionFlagsFor(root *cobra.Command, fileType string) []string {
+	names := append([]string{fileType}, typeAliases[fileType]...)
+	types := typeNames()
+	var flags []string
+	for _, name := range generatorOptionFlags {
+		f := root.Flags().Lookup(name)
+		if f == nil {
+			continue
+		}
+		prefix, _, _ := strings.Cut(name, "-")
+		switch {
+		case slices.Contains(names, prefix):
+		case slices.Contains(types, prefix):
+			continue
+		default:
+			words := strings.FieldsFunc(strings.ToLower(f.Usage), func(r rune) bool {
+				return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+			})
+			if !slices.ContainsFunc(names, func(n string) bool {
+				return slices.Contains(words, n) || slices.Contains(words, n+"s")
+			}) {
+				continue
+			}
+		}
+		flags = append(flags, name)
+	}
+	return flags
+}
+
+// checkFlagValue reports whether s is a valid value of the flag name,
+// whose values are of type typ, such as "int".
+func checkFlagValue(name, typ, s string) error {
+	var err error
+	switch typ {
+	case "int", "int64":
+		_, err = strconv.ParseInt(s, 10, 64)
+	case "uint64":
+		_, err = strconv.ParseUint(s, 10, 64)
+	case "float64":
+		_, err = strconv.ParseFloat(s, 64)
+	case "bool":
+		_, err = strconv.ParseBool(s)
+	case "duration":
+		_, err = time.ParseDuration(s)
+	}
+	if err != nil {
+		return fmt.Errorf("--%s takes a value of type %s, not %q", name, typ, s)
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell, unless it needs no quotes.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=.,:/@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,118 @@
+// Command genfiled serves genfile over gRPC, so that other services in a
+// test environment can request fixtures programmatically.
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/logging"
+	"github.com/hailam/genfile/internal/adapters/metrics"
+	"github.com/hailam/genfile/internal/adapters/rpc"
+	adapterutils "github.com/hailam/genfile/internal/adapters/utils"
+	"github.com/hailam/genfile/internal/application"
+	"github.com/hailam/genfile/internal/ports"
+
+	// Registers every generator through its init function.
+	_ "github.com/hailam/genfile/internal/adapters/all"
+)
+
+func main() {
+	var listen, metricsListen, dir, maxSizeStr string
+	var verbose bool
+
+	rootCmd := &cobra.Command{
+		Use:   "genfiled",
+		Short: "Serves file generation over gRPC.",
+		Long: `genfiled serves the genfile.v1.Genfile gRPC service: GenerateFile writes a
+file under --dir, GenerateStream sends one back in chunks and ListTypes
+lists the supported types. The service is described in
+internal/adapters/rpc/genfilepb/genfile.proto, and server reflection is
+enabled for tools such as grpcurl.
+
+With --metrics-listen, Prometheus metrics are served on /metrics at that
+address: files generated, bytes written, errors and generation time, per
+file type.
+
+With --max-size, every request must ask for a size of at most that much.
+Options naming files on the server (corpus, xml-schema, and icc other
+than srgb or gray) are always refused.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			level := ports.LevelWarn
+			if verbose {
+				level = ports.LevelDebug
+			}
+			logger := logging.New(os.Stderr, level)
+			generatorFactory := factory.NewLoggingGeneratorFactory(logger)
+			if metricsListen != "" {
+				reg := prometheus.NewRegistry()
+				reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+				m, err := metrics.New(reg)
+				if err != nil {
+					return err
+				}
+				generatorFactory = metrics.NewFactory(generatorFactory, m)
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+				metricsLis, err := net.Listen("tcp", metricsListen)
+				if err != nil {
+					return fmt.Errorf("failed to listen on %s: %w", metricsListen, err)
+				}
+				go http.Serve(metricsLis, mux)
+				fmt.Fprintf(os.Stderr, "genfiled serving metrics on http://%s/metrics\n", metricsLis.Addr())
+			}
+			sizeParser := adapterutils.NewUtilSizeParser()
+			fileService := application.NewFileService(generatorFactory, sizeParser)
+			var maxSize int64
+			if maxSizeStr != "" {
+				var err error
+				if maxSize, err = sizeParser.Parse(maxSizeStr); err != nil {
+					return fmt.Errorf("invalid maximum size '%s': %w", maxSizeStr, err)
+				}
+			}
+
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+			lis, err := net.Listen("tcp", listen)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %w", listen, err)
+			}
+			s := grpc.NewServer()
+			rpc.NewServer(fileService, dir, factory.RegisteredTypes(), maxSize).Register(s)
+			reflection.Register(s)
+
+			stop := make(chan os.Signal, 1)
+			signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-stop
+				s.GracefulStop()
+			}()
+			fmt.Fprintf(os.Stderr, "genfiled listening on %s, writing to %s\n", lis.Addr(), dir)
+			return s.Serve(lis)
+		},
+	}
+	rootCmd.Flags().StringVar(&listen, "listen", "localhost:50051", "Address to serve gRPC on")
+	rootCmd.Flags().StringVar(&metricsListen, "metrics-listen", "", "Address to serve Prometheus metrics on at /metrics (e.g., :9090); off by default")
+	rootCmd.Flags().StringVar(&dir, "dir", ".", "Directory GenerateFile writes under")
+	rootCmd.Flags().StringVar(&maxSizeStr, "max-size", "", "Refuse requests without a size or larger than this (e.g., 100MB); no limit by default")
+	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Log generator diagnostics")
+
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
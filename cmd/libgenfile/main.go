@@ -0,0 +1,122 @@
+// Command libgenfile builds genfile as a C shared library, so that test
+// frameworks in other languages (pytest through ctypes or cffi, Java
+// through JNA or the foreign function API) can generate files in-process
+// rather than running the genfile binary:
+//
+//	go build -buildmode=c-shared -o libgenfile.so ./cmd/libgenfile
+//
+// which also writes libgenfile.h declaring:
+//
+//	char* genfile_generate(char* path, char* fileType, long long int size, char* optionsJSON);
+//	void genfile_free(char* s);
+//
+// genfile_generate writes a file at path exactly size bytes long. fileType
+// is a file type or extension such as "png", or NULL or "" for the
+// extension of path, and optionsJSON a JSON object of the format
+// options the CLI takes as flags, without the dashes (e.g.
+// {"png-color": "gray", "width": 640}), or NULL. It returns NULL on
+// success and otherwise the error message, which the caller releases
+// with genfile_free. Calls may be made from several threads at once.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"unsafe"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/logging"
+	adapterutils "github.com/hailam/genfile/internal/adapters/utils"
+	"github.com/hailam/genfile/internal/application"
+	"github.com/hailam/genfile/internal/ports"
+
+	// Registers every generator through its init function.
+	_ "github.com/hailam/genfile/internal/adapters/all"
+)
+
+// fileService is made on the first call, and shared by all of them.
+var fileService = sync.OnceValue(func() *application.FileService {
+	logger := logging.New(os.Stderr, ports.LevelWarn)
+	return application.NewFileService(factory.NewLoggingGeneratorFactory(logger), adapterutils.NewUtilSizeParser())
+})
+
+//export genfile_generate
+func genfile_generate(path, fileType *C.char, size C.longlong, optionsJSON *C.char) *C.char {
+	if path == nil {
+		return C.CString("a path is required")
+	}
+	var typ, opts string
+	if fileType != nil {
+		typ = C.GoString(fileType)
+	}
+	if optionsJSON != nil {
+		opts = C.GoString(optionsJSON)
+	}
+	if err := generate(C.GoString(path), typ, int64(size), opts); err != nil {
+		return C.CString(err.Error())
+	}
+	return nil
+}
+
+//export genfile_free
+func genfile_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// generate writes the file genfile_generate asks for, exactly size bytes.
+func generate(path, fileType string, size int64, optionsJSON string) error {
+	if size < 0 {
+		return fmt.Errorf("size must not be negative, got %d", size)
+	}
+	opts, err := parseOptions(optionsJSON)
+	if err != nil {
+		return err
+	}
+	_, err = fileService().Create(application.FileRequest{
+		Path:     path,
+		Type:     fileType,
+		SizeSpec: strconv.FormatInt(size, 10),
+		Options:  opts,
+		Strict:   true,
+	})
+	return err
+}
+
+// parseOptions parses a JSON object of options. Values may be strings,
+// numbers or booleans, and are passed on as the CLI would pass them.
+func parseOptions(s string) (ports.Options, error) {
+	if s == "" {
+		return nil, nil
+	}
+	d := json.NewDecoder(bytes.NewReader([]byte(s)))
+	d.UseNumber()
+	var values map[string]any
+	if err := d.Decode(&values); err != nil {
+		return nil, fmt.Errorf("invalid options JSON: %w", err)
+	}
+	opts := ports.Options{}
+	for k, v := range values {
+		switch v := v.(type) {
+		case string:
+			opts[k] = v
+		case json.Number:
+			opts[k] = v.String()
+		case bool:
+			opts[k] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("option %q must be a string, number or boolean", k)
+		}
+	}
+	return opts, nil
+}
+
+func main() {}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		json   string
+		want   ports.Options
+		errSub string
+	}{
+		{"Empty", "", nil, ""},
+		{"EmptyObject", "{}", ports.Options{}, ""},
+		{"String", `{"png-color": "gray"}`, ports.Options{"png-color": "gray"}, ""},
+		{"Numbers", `{"width": 640, "entropy": 0.5, "big": 12345678901234567890}`, ports.Options{"width": "640", "entropy": "0.5", "big": "12345678901234567890"}, ""},
+		{"Bool", `{"eicar": true, "zip-sfx": false}`, ports.Options{"eicar": "true", "zip-sfx": "false"}, ""},
+		{"Invalid", `{"width": `, nil, "invalid options JSON"},
+		{"NotObject", `["width"]`, nil, "invalid options JSON"},
+		{"Null", `{"width": null}`, nil, `option "width" must be a string, number or boolean`},
+		{"Nested", `{"width": {"px": 640}}`, nil, `option "width" must be a string, number or boolean`},
+		{"Array", `{"width": [640]}`, nil, `option "width" must be a string, number or boolean`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseOptions(tc.json)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("parseOptions(%s) error = %v, want error containing %q", tc.json, err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOptions(%s) unexpected error = %v", tc.json, err)
+			}
+			if (got == nil) != (tc.want == nil) || !maps.Equal(got, tc.want) {
+				t.Errorf("parseOptions(%s) = %v, want %v", tc.json, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		fileType string
+		size     int64
+		opts     string
+		magic    string // the file's first bytes, if checked
+		errSub   string
+	}{
+		{name: "ByExtension", file: "a.png", size: 4096, magic: "\x89PNG"},
+		{name: "TypeOverridesExtension", file: "a.dat", fileType: "png", size: 4096, magic: "\x89PNG"},
+		{name: "Options", file: "a.png", size: 4096, opts: `{"png-color": "gray", "width": 64}`, magic: "\x89PNG"},
+		{name: "Zero", file: "a.txt", size: 0},
+		{name: "Negative", file: "a.txt", size: -1, errSub: "size must not be negative"},
+		{name: "BelowMinimum", file: "a.png", size: 10, errSub: "failed to generate"},
+		{name: "UnknownExtension", file: "a.nope", size: 100, errSub: "unsupported file extension: nope"},
+		{name: "UnknownType", file: "a.dat", fileType: "nope", size: 100, errSub: "unsupported file extension: nope"},
+		{name: "BadOptionsJSON", file: "a.png", size: 4096, opts: `{`, errSub: "invalid options JSON"},
+		{name: "BadOptionValue", file: "a.png", size: 4096, opts: `{"width": "x"}`, errSub: "invalid integer"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			err := generate(path, tc.fileType, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("generate(%s, %q, %d) error = %v, want error containing %q", tc.file, tc.fileType, tc.size, err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("generate(%s, %q, %d) unexpected error = %v", tc.file, tc.fileType, tc.size, err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			if !bytes.HasPrefix(data, []byte(tc.magic)) {
+				t.Errorf("file starts % x, want % x", data[:min(len(data), len(tc.magic))], tc.magic)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package access
+
+import (
+	"bufio"
+	"crypto/rc4"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func init() {
+	for _, t := range []ports.FileType{ports.FileTypeMDB, ports.FileTypeACCDB} {
+		factory.RegisterGenerator(t, &AccessGenerator{fileType: t})
+	}
+}
+
+// AccessGenerator writes placeholder Microsoft Access databases: the
+// database definition page that Jet and ACE files start with, followed by
+// empty data pages. Tools that recognise Access files by their first page
+// take them for databases, while the catalog a real database keeps on
+// page 2 is absent, so they hold no tables.
+type AccessGenerator struct {
+	opts     ports.Options // set by Configure
+	fileType ports.FileType
+	fs       ports.OutputFS // set by WithOutputFS
+}
+
+// New returns a generator of Jet 4 .mdb databases.
+func New() ports.FileGenerator {
+	return &AccessGenerator{fileType: ports.FileTypeMDB}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *AccessGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts, g.fileType); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *AccessGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// SizeStep returns the page size of the configured engine version.
+func (g *AccessGenerator) SizeStep() int64 {
+	o, err := parseOptions(g.opts, g.fileType)
+	if err != nil {
+		return 1
+	}
+	return int64(o.pageSize)
+}
+
+// version is a database engine version as the definition page records it.
+type version struct {
+	code     uint32
+	pageSize int
+	ace      bool // an .accdb format
+}
+
+// versions maps the "access-version" values to engine versions.
+var versions = map[string]version{
+	"jet3": {0, 2048, false},
+	"jet4": {1, 4096, false},
+	"2007": {2, 4096, true},
+	"2010": {0x0103, 4096, true},
+	"2013": {0x0104, 4096, true},
+	"2016": {0x0105, 4096, true},
+	"2019": {0x0106, 4096, true},
+}
+
+const (
+	// headerKey is the RC4 key that scrambles the definition page's header
+	// fields, in every database.
+	headerKey = 0x6b39dac7
+	// codePage and langID are Windows-1252 and US English.
+	codePage = 1252
+	langID   = 0x0409
+	// tdefPage is the page of the system catalog's table definition, which
+	// data pages name as their table.
+	tdefPage = 2
+)
+
+// accessOptions holds the settings the Access generator reads from
+// ports.Options.
+type accessOptions struct {
+	version
+}
+
+func parseOptions(opts ports.Options, fileType ports.FileType) (accessOptions, error) {
+	var o accessOptions
+	def, want := "jet4", "jet3 or jet4"
+	if fileType == ports.FileTypeACCDB {
+		def, want = "2016", "2007, 2010, 2013, 2016 or 2019"
+	}
+	name := strings.ToLower(opts.String("access-version", def))
+	v, ok := versions[name]
+	if !ok || v.ace != (fileType == ports.FileTypeACCDB) {
+		return o, fmt.Errorf("unknown %s access-version %q (want %s)", fileType, name, want)
+	}
+	o.version = v
+	return o, nil
+}
+
+func (g *AccessGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+func (g *AccessGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts, g.fileType); err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := g.GenerateTo(f, size, opts); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// GenerateTo writes a database of exactly size bytes to w, a whole number
+// of pages: 2 KB for Jet 3 and 4 KB for the rest. An .mdb is Jet 4 (2000
+// to 2003) unless "access-version" says jet3 (97); an .accdb is ACE for
+// Access 2016 unless it names 2007, 2010, 2013 or 2019.
+func (g *AccessGenerator) GenerateTo(w io.Writer, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts, g.fileType)
+	if err != nil {
+		return err
+	}
+	pageSize := int64(o.pageSize)
+	if size%pageSize != 0 {
+		return fmt.Errorf("%s size must be a multiple of the %d-byte page size, got %d", strings.ToUpper(string(g.fileType)), pageSize, size)
+	}
+	if size < 2*pageSize {
+		return fmt.Errorf("target %d too small for an Access database; need at least %d bytes", size, 2*pageSize)
+	}
+
+	bw := bufio.NewWriterSize(w, 1<<20)
+	if _, err := bw.Write(o.definitionPage()); err != nil {
+		return fmt.Errorf("failed to write database: %w", err)
+	}
+	data := o.dataPage()
+	for n := size/pageSize - 1; n > 0; n-- {
+		if _, err := bw.Write(data); err != nil {
+			return fmt.Errorf("failed to write database: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write database: %w", err)
+	}
+	return nil
+}
+
+// definitionPage returns page 0: the engine's signature and version, and
+// the header fields scrambled with RC4 under headerKey: the code page, a
+// database key of zero, which marks the database unencrypted, and the
+// sort order's language.
+func (o accessOptions) definitionPage() []byte {
+	page := make([]byte, o.pageSize)
+	page[1] = 0x01
+	signature := "Standard Jet DB"
+	if o.ace {
+		signature = "Standard ACE DB"
+	}
+	copy(page[4:], signature)
+	binary.LittleEndian.PutUint32(page[0x14:], o.code)
+
+	n, lang := 128, 0x6e
+	if o.pageSize == 2048 {
+		n, lang = 126, 0x3a
+	}
+	header := page[0x18 : 0x18+n]
+	binary.LittleEndian.PutUint16(page[0x3c:], codePage)
+	binary.LittleEndian.PutUint16(page[lang:], langID)
+	var key [4]byte
+	binary.LittleEndian.PutUint32(key[:], headerKey)
+	c, _ := rc4.NewCipher(key[:]) // fails only for keys of the wrong length
+	c.XORKeyStream(header, header)
+	return page
+}
+
+// dataPage returns an empty data page of the system catalog: no rows, and
+// all but its header free.
+func (o accessOptions) dataPage() []byte {
+	page := make([]byte, o.pageSize)
+	page[0], page[1] = 0x01, 0x01
+	headerLen := 14 // page type, free space, table, row count
+	if o.pageSize == 2048 {
+		headerLen = 10 // Jet 3 has no field after the table's page
+	}
+	binary.LittleEndian.PutUint16(page[2:], uint16(o.pageSize-headerLen))
+	binary.LittleEndian.PutUint32(page[4:], tdefPage)
+	return page
+}
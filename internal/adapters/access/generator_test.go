@@ -0,0 +1,92 @@
+package access
+
+import (
+	"crypto/rc4"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestAccessGenerator_Generate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		fileType  ports.FileType
+		size      int64
+		opts      ports.Options
+		signature string // want
+		version   uint32
+		pageSize  int
+		errSub    string
+	}{
+		{name: "MDB", fileType: ports.FileTypeMDB, size: 1 << 20, signature: "Standard Jet DB", version: 1, pageSize: 4096},
+		{name: "Jet3", fileType: ports.FileTypeMDB, size: 2048 * 3, opts: ports.Options{"access-version": "jet3"}, signature: "Standard Jet DB", version: 0, pageSize: 2048},
+		{name: "ACCDB", fileType: ports.FileTypeACCDB, size: 8192, signature: "Standard ACE DB", version: 0x0105, pageSize: 4096},
+		{name: "ACCDB2007", fileType: ports.FileTypeACCDB, size: 40960, opts: ports.Options{"access-version": "2007"}, signature: "Standard ACE DB", version: 2, pageSize: 4096},
+		{name: "NotPages", fileType: ports.FileTypeMDB, size: 10000, errSub: "multiple of the 4096-byte page size"},
+		{name: "TooSmall", fileType: ports.FileTypeACCDB, size: 4096, errSub: "too small"},
+		{name: "AceInMDB", fileType: ports.FileTypeMDB, size: 8192, opts: ports.Options{"access-version": "2016"}, errSub: "access-version"},
+		{name: "JetInACCDB", fileType: ports.FileTypeACCDB, size: 8192, opts: ports.Options{"access-version": "jet4"}, errSub: "access-version"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			generator := &AccessGenerator{fileType: tc.fileType}
+			path := filepath.Join(t.TempDir(), "fixture."+string(tc.fileType))
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			configured, err := generator.Configure(tc.opts)
+			if err != nil {
+				t.Fatalf("Configure() error = %v", err)
+			}
+			if step := configured.(*AccessGenerator).SizeStep(); step != int64(tc.pageSize) {
+				t.Errorf("SizeStep() = %d, want %d", step, tc.pageSize)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+
+			if got := string(data[4:19]); got != tc.signature {
+				t.Errorf("signature = %q, want %q", got, tc.signature)
+			}
+			if got := binary.LittleEndian.Uint32(data[0x14:]); got != tc.version {
+				t.Errorf("version = %#x, want %#x", got, tc.version)
+			}
+			// Unscramble the header as readers do.
+			n := 128
+			if tc.pageSize == 2048 {
+				n = 126
+			}
+			header := append([]byte(nil), data[:0x18+n]...)
+			c, _ := rc4.NewCipher([]byte{0xc7, 0xda, 0x39, 0x6b})
+			c.XORKeyStream(header[0x18:], header[0x18:])
+			if cp := binary.LittleEndian.Uint16(header[0x3c:]); cp != codePage {
+				t.Errorf("code page = %d, want %d", cp, codePage)
+			}
+			if key := binary.LittleEndian.Uint32(header[0x3e:]); key != 0 {
+				t.Errorf("database key = %#x, want 0 for an unencrypted database", key)
+			}
+
+			for off := tc.pageSize; off < len(data); off += tc.pageSize {
+				page := data[off : off+tc.pageSize]
+				if page[0] != 0x01 || binary.LittleEndian.Uint32(page[4:]) != tdefPage {
+					t.Fatalf("page %d is not a data page: % x", off/tc.pageSize, page[:8])
+				}
+			}
+		})
+	}
+}
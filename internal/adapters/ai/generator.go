@@ -0,0 +1,244 @@
+package ai
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeAI, New())
+}
+
+// AiGenerator writes Illustrator documents in the PDF-compatible form
+// Illustrator saves: a one-page PDF with vector artwork whose page carries
+// the Illustrator private data, padded to size.
+type AiGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &AiGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *AiGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := opts.Time("mtime", time.Time{}); err != nil {
+		return nil, err
+	}
+	r, err := utils.NewRand(opts.String("seed", ""))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := utils.ParseFiller(r, opts.String("entropy", ""), opts.String("shared-blocks", ""), opts.String("shared-pool", "")); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *AiGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	// artboard is the page size, US Letter as in Illustrator's default
+	// print document profile.
+	artboard = "letter"
+	// shapes is the number of filled paths drawn on the artboard.
+	shapes = 12
+	// header is the PDF header with the binary comment line.
+	header = "%PDF-1.6\n%âãÏÓ\n"
+)
+
+func (g *AiGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes an .ai of exactly size bytes. The page holds
+// random filled shapes, and its /PieceInfo points at the Illustrator
+// private data: the AIMetaData PostScript comments and an AIPrivateData
+// stream of random bytes, standing in for Illustrator's compressed native
+// data, that pads the file. PDF readers show the page; the "mtime" option
+// dates the document, and "entropy" sets the share of the private data
+// that is random, the rest repeating a pattern; "shared-blocks" draws a
+// share of it from the chunk pool seeded by "shared-pool".
+func (g *AiGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	modified, err := opts.Time("mtime", time.Time{})
+	if err != nil {
+		return err
+	}
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	r, err := utils.NewRand(opts.String("seed", ""))
+	if err != nil {
+		return err
+	}
+	filler, err := utils.ParseFiller(r, opts.String("entropy", ""), opts.String("shared-blocks", ""), opts.String("shared-pool", ""))
+	if err != nil {
+		return err
+	}
+	title := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	objs := buildObjects(r, title, modified)
+	padObj := len(objs) + 1
+
+	var body strings.Builder
+	offsets := make([]int, 0, padObj)
+	body.WriteString(header)
+	for _, obj := range objs {
+		offsets = append(offsets, body.Len())
+		body.WriteString(obj)
+	}
+	offsets = append(offsets, body.Len())
+
+	// The xref entries have a fixed width, so only the digits of the
+	// padding length and of the xref offset move the size; iterate until
+	// they settle.
+	const streamEnd = "\nendstream\nendobj\n"
+	var streamDict, trailer string
+	var padLen int64
+	for i := 0; ; i++ {
+		streamDict = fmt.Sprintf("%d 0 obj\n<< /Length %d >>\nstream\n", padObj, padLen)
+		xref := int64(body.Len()+len(streamDict)+len(streamEnd)) + padLen
+		trailer = xrefTable(offsets, padObj, xref)
+		fixed := int64(body.Len() + len(streamDict) + len(streamEnd) + len(trailer))
+		if size < fixed {
+			return fmt.Errorf("target %d too small for an Illustrator file; need at least %d bytes", size, fixed)
+		}
+		next := size - fixed
+		if next == padLen {
+			break
+		}
+		if i == 4 {
+			return fmt.Errorf("failed to converge on the padding length for target size %d", size)
+		}
+		padLen = next
+	}
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	bw.WriteString(body.String())
+	bw.WriteString(streamDict)
+	if err := filler.Write(r, bw, padLen); err != nil {
+		return fmt.Errorf("failed to write Illustrator private data: %w", err)
+	}
+	bw.WriteString(streamEnd)
+	bw.WriteString(trailer)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write Illustrator file: %w", err)
+	}
+	return f.Sync()
+}
+
+// buildObjects returns the document objects, numbered from 1, ahead of
+// the private data stream that pads the file.
+func buildObjects(r *utils.Rand, title string, modified time.Time) []string {
+	dims := utils.PageSizes[artboard]
+	w, h := dims[0], dims[1]
+	date := modified.UTC().Format("D:20060102150405Z")
+	art := artwork(r, w, h)
+	meta := aiMetaData(title, modified, w, h)
+	bodies := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /ArtBox [0 0 %d %d] /TrimBox [0 0 %d %d] /Contents 4 0 R /LastModified (%s) /PieceInfo << /Illustrator 5 0 R >> >>", w, h, w, h, w, h, date),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(art), art),
+		fmt.Sprintf("<< /LastModified (%s) /Private 6 0 R >>", date),
+		"<< /AIMetaData 7 0 R /AIPrivateData1 9 0 R /ContainerVersion 12 /CreatorVersion 24 /NumBlock 1 /RoundtripVersion 24 >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(meta), meta),
+		fmt.Sprintf("<< /Title (%s) /Creator (genfile) /CreationDate (%s) /ModDate (%s) >>", pdfEscape(title), date, date),
+	}
+	objs := make([]string, len(bodies))
+	for i, b := range bodies {
+		objs[i] = fmt.Sprintf("%d 0 obj\n%s\nendobj\n", i+1, b)
+	}
+	return objs
+}
+
+// xrefTable returns the cross-reference table for objects at offsets, the
+// trailer and the startxref pointer to xref.
+func xrefTable(offsets []int, size int, xref int64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", size+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 8 0 R >>\nstartxref\n%d\n%%%%EOF\n", size+1, xref)
+	return b.String()
+}
+
+// artwork returns a content stream of random filled rectangles and curved
+// blobs in CMYK, as print artwork is drawn.
+func artwork(r *utils.Rand, w, h int) string {
+	var b strings.Builder
+	for i := 0; i < shapes; i++ {
+		fmt.Fprintf(&b, "%.3f %.3f %.3f %.3f k\n", r.Float64(), r.Float64(), r.Float64(), r.Float64()*0.3)
+		x, y := r.Float64()*float64(w), r.Float64()*float64(h)
+		rad := 20 + r.Float64()*100
+		if i%2 == 0 {
+			fmt.Fprintf(&b, "%.2f %.2f %.2f %.2f re f\n", x-rad, y-rad, 2*rad, rad)
+			continue
+		}
+		fmt.Fprintf(&b, "%.2f %.2f m\n", x-rad, y)
+		fmt.Fprintf(&b, "%.2f %.2f %.2f %.2f %.2f %.2f c\n", x-rad, y+rad, x+rad, y+rad, x+rad, y)
+		fmt.Fprintf(&b, "%.2f %.2f %.2f %.2f %.2f %.2f c\n", x+rad, y-rad, x-rad, y-rad, x-rad, y)
+		b.WriteString("h f\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// aiMetaData returns the PostScript header comments Illustrator keeps in
+// its private data, with the carriage return line endings it writes.
+func aiMetaData(title string, modified time.Time, w, h int) string {
+	lines := []string{
+		"%!PS-Adobe-3.0 ",
+		"%%Creator: genfile",
+		"%%AI8_CreatorVersion: 24.0.0",
+		"%%For: (genfile) ()",
+		"%%Title: (" + pdfEscape(title) + ".ai)",
+		"%%CreationDate: " + modified.Format("1/2/2006 3:04 PM"),
+		"%%Canvassize: 16383",
+		fmt.Sprintf("%%%%BoundingBox: 0 0 %d %d", w, h),
+		fmt.Sprintf("%%%%HiResBoundingBox: 0 0 %d %d", w, h),
+		"%%DocumentProcessColors: Cyan Magenta Yellow Black",
+		"%AI5_FileFormat 14.0",
+		"%AI3_ColorUsage: Color",
+		fmt.Sprintf("%%AI3_Cropmarks: 0 0 %d %d", w, h),
+		"%AI3_DocumentPreview: None",
+		"%%PageOrigin:0 0",
+		"%%EndComments",
+		"",
+		"%%BeginProlog",
+		"%%EndProlog",
+		"",
+		"%%BeginSetup",
+		"%%EndSetup",
+	}
+	return strings.Join(lines, "\r")
+}
+
+// pdfEscape escapes the characters a PDF literal string cannot hold as
+// they are.
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestAiGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name   string
+		size   int64
+		opts   ports.Options
+		errSub string
+	}{
+		{name: "Small", size: 4000},
+		{name: "Medium", size: 64 * 1024},
+		{name: "Large", size: 5*1024*1024 + 3},
+		{name: "Dated", size: 10 * 1024, opts: ports.Options{"mtime": "2020-01-01T00:00:00Z"}},
+		{name: "TooSmall", size: 500, errSub: "too small"},
+		{name: "BadMTime", size: 10 * 1024, opts: ports.Options{"mtime": "yesterday"}, errSub: "mtime"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "poster.ai")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			checkAI(t, data)
+			if tc.opts.Has("mtime") && !bytes.Contains(data, []byte("/CreationDate (D:20200101000000Z)")) {
+				t.Error("document is not dated by mtime")
+			}
+		})
+	}
+}
+
+// checkAI checks the PDF cross-reference table points at every object and
+// the page carries the Illustrator private data.
+func checkAI(t *testing.T, data []byte) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.6\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n0 10\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	entries := data[xref+len("xref\n0 10\n"):]
+	for i := 1; i < 10; i++ {
+		off, _ := strconv.Atoi(string(entries[20*i : 20*i+10]))
+		if want := fmt.Sprintf("%d 0 obj\n", i); !bytes.HasPrefix(data[off:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %q", i, data[off:off+10])
+		}
+	}
+	for _, want := range []string{"/PieceInfo << /Illustrator 5 0 R >>", "/AIPrivateData1 9 0 R", "%!PS-Adobe-3.0 \r%%Creator: genfile", "%AI5_FileFormat"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
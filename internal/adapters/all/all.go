@@ -0,0 +1,50 @@
+// Package all registers every generator with the factory. Binaries import
+// it for its side effects:
+//
+//	import _ "github.com/hailam/genfile/internal/adapters/all"
+package all
+
+import (
+	_ "github.com/hailam/genfile/internal/adapters/access"
+	_ "github.com/hailam/genfile/internal/adapters/ai"
+	_ "github.com/hailam/genfile/internal/adapters/apk"
+	_ "github.com/hailam/genfile/internal/adapters/bin"
+	_ "github.com/hailam/genfile/internal/adapters/cert"
+	_ "github.com/hailam/genfile/internal/adapters/cfb"
+	_ "github.com/hailam/genfile/internal/adapters/csv"
+	_ "github.com/hailam/genfile/internal/adapters/deb"
+	_ "github.com/hailam/genfile/internal/adapters/djvu"
+	_ "github.com/hailam/genfile/internal/adapters/docx"
+	_ "github.com/hailam/genfile/internal/adapters/dwg"
+	_ "github.com/hailam/genfile/internal/adapters/dxf"
+	_ "github.com/hailam/genfile/internal/adapters/edi"
+	_ "github.com/hailam/genfile/internal/adapters/fixedwidth"
+	_ "github.com/hailam/genfile/internal/adapters/gif"
+	_ "github.com/hailam/genfile/internal/adapters/hl7"
+	_ "github.com/hailam/genfile/internal/adapters/html"
+	_ "github.com/hailam/genfile/internal/adapters/ini"
+	_ "github.com/hailam/genfile/internal/adapters/jar"
+	_ "github.com/hailam/genfile/internal/adapters/jp2"
+	_ "github.com/hailam/genfile/internal/adapters/jpeg"
+	_ "github.com/hailam/genfile/internal/adapters/json"
+	_ "github.com/hailam/genfile/internal/adapters/mp4"
+	_ "github.com/hailam/genfile/internal/adapters/ndjson"
+	_ "github.com/hailam/genfile/internal/adapters/npm"
+	_ "github.com/hailam/genfile/internal/adapters/oci"
+	_ "github.com/hailam/genfile/internal/adapters/pdf"
+	_ "github.com/hailam/genfile/internal/adapters/png"
+	_ "github.com/hailam/genfile/internal/adapters/ps"
+	_ "github.com/hailam/genfile/internal/adapters/psd"
+	_ "github.com/hailam/genfile/internal/adapters/reg"
+	_ "github.com/hailam/genfile/internal/adapters/rpm"
+	_ "github.com/hailam/genfile/internal/adapters/shp"
+	_ "github.com/hailam/genfile/internal/adapters/subtitle"
+	_ "github.com/hailam/genfile/internal/adapters/tiff"
+	_ "github.com/hailam/genfile/internal/adapters/txt"
+	_ "github.com/hailam/genfile/internal/adapters/wav"
+	_ "github.com/hailam/genfile/internal/adapters/wheel"
+	_ "github.com/hailam/genfile/internal/adapters/xlsx"
+	_ "github.com/hailam/genfile/internal/adapters/xml"
+	_ "github.com/hailam/genfile/internal/adapters/xps"
+	_ "github.com/hailam/genfile/internal/adapters/zip"
+)
@@ -0,0 +1,98 @@
+package all
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// TestGenerators_WriteFailures checks every generator reports the write
+// failures of a Chaos file system rather than leaving a broken file
+// behind without an error.
+func TestGenerators_WriteFailures(t *testing.T) {
+	dir := t.TempDir()
+	faults := map[outputfs.FaultKind]error{
+		outputfs.FaultNoSpace: syscall.ENOSPC,
+		outputfs.FaultAccess:  syscall.EACCES,
+		outputfs.FaultShort:   io.ErrShortWrite,
+	}
+	for _, ft := range factory.RegisteredTypes() {
+		gen, err := factory.NewGeneratorFactory().For(ft)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "f."+string(ft))
+		// The smallest of these sizes the generator can write without
+		// faults.
+		var size int64
+		for _, s := range []int64{16 << 10, 64 << 10} {
+			if gen.Generate(path, s) == nil {
+				size = s
+				break
+			}
+		}
+		if size == 0 {
+			t.Errorf("%s: cannot generate 16KiB or 64KiB", ft)
+			continue
+		}
+		for kind, want := range faults {
+			chaos := &outputfs.Chaos{Faults: []outputfs.Fault{{Kind: kind, Offset: 4096}}}
+			gen, err := factory.NewRegistryFactory(factory.DefaultRegistry(), nil, chaos).For(ft)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := gen.Generate(path, size); !errors.Is(err, want) {
+				t.Errorf("%s with %s at 4096: error = %v, want %v", ft, kind, err, want)
+			}
+		}
+	}
+}
+
+// TestGenerators_WithSeed checks every generator makes the same bytes
+// again from the same seed and modification time.
+func TestGenerators_WithSeed(t *testing.T) {
+	dir := t.TempDir()
+	for _, run := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(dir, run), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mtime := ports.WithOption("mtime", "2020-01-01T00:00:00Z")
+	for _, ft := range factory.RegisteredTypes() {
+		gen, err := factory.NewGeneratorFactory().For(ft)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The runs write to directories of their own, as a generator may
+		// put the file's name into it.
+		generate := func(run string) []byte {
+			t.Helper()
+			path := filepath.Join(dir, run, "f."+string(ft))
+			var err error
+			for _, size := range []int64{16 << 10, 64 << 10} {
+				if err = ports.Generate(gen, path, size, ports.WithSeed(42), mtime); err == nil {
+					break
+				}
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", ft, err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		}
+		if !bytes.Equal(generate("a"), generate("b")) {
+			t.Errorf("%s: two files of seed 42 differ", ft)
+		}
+	}
+}
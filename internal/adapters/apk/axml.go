@@ -0,0 +1,188 @@
+package apk
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Chunk types of Android's binary XML.
+const (
+	chunkStringPool   = 0x0001
+	chunkXML          = 0x0003
+	chunkStartNS      = 0x0100
+	chunkEndNS        = 0x0101
+	chunkStartElement = 0x0102
+	chunkEndElement   = 0x0103
+	chunkResourceMap  = 0x0180
+
+	// utf8Flag marks a string pool whose strings are UTF-8.
+	utf8Flag = 1 << 8
+	noIndex  = 0xffffffff
+
+	typeString = 0x03
+	typeIntDec = 0x10
+
+	androidNS = "http://schemas.android.com/apk/res/android"
+)
+
+// attrIDs are the resource IDs of the android: attributes a manifest uses.
+// They lead the string pool, in this order, so the resource map lines up
+// with it.
+var attrIDs = []struct {
+	name string
+	id   uint32
+}{
+	{"label", 0x01010001},
+	{"minSdkVersion", 0x0101020c},
+	{"versionCode", 0x0101021b},
+	{"versionName", 0x0101021c},
+	{"targetSdkVersion", 0x01010270},
+}
+
+// attr is an attribute of an element; attributes in the android namespace
+// must be among attrIDs.
+type attr struct {
+	android bool
+	name    string
+	str     string // value of a string attribute
+	num     uint32 // value of an integer attribute, if str is empty
+}
+
+// axmlWriter encodes a document as Android's binary XML, the form aapt
+// compiles AndroidManifest.xml to.
+type axmlWriter struct {
+	strings []string
+	index   map[string]uint32
+	body    bytes.Buffer // the chunks after the string pool and resource map
+	line    uint32
+}
+
+func newAXMLWriter() *axmlWriter {
+	w := &axmlWriter{index: map[string]uint32{}}
+	for _, a := range attrIDs {
+		w.str(a.name)
+	}
+	return w
+}
+
+// str returns the index of s in the string pool, adding it if needed.
+func (w *axmlWriter) str(s string) uint32 {
+	if i, ok := w.index[s]; ok {
+		return i
+	}
+	w.index[s] = uint32(len(w.strings))
+	w.strings = append(w.strings, s)
+	return w.index[s]
+}
+
+// node writes the header of a node chunk of size bytes: the chunk header,
+// then its line number and an empty comment. Each node is on its own line.
+func (w *axmlWriter) node(typ uint16, size uint32) {
+	w.line++
+	binary.Write(&w.body, binary.LittleEndian, struct {
+		Type, HeaderSize uint16
+		Size, Line, Com  uint32
+	}{typ, 16, size, w.line, noIndex})
+}
+
+func (w *axmlWriter) put(vs ...uint32) {
+	binary.Write(&w.body, binary.LittleEndian, vs)
+}
+
+func (w *axmlWriter) startNS() {
+	w.node(chunkStartNS, 24)
+	w.put(w.str("android"), w.str(androidNS))
+}
+
+func (w *axmlWriter) endNS() {
+	w.node(chunkEndNS, 24)
+	w.put(w.str("android"), w.str(androidNS))
+}
+
+// start writes the start of an element. Attributes in the android
+// namespace come first, in resource ID order, as aapt sorts them.
+func (w *axmlWriter) start(name string, attrs ...attr) {
+	w.node(chunkStartElement, 36+20*uint32(len(attrs)))
+	w.put(noIndex, w.str(name))
+	binary.Write(&w.body, binary.LittleEndian, [6]uint16{20, 20, uint16(len(attrs)), 0, 0, 0})
+	for _, a := range attrs {
+		ns, raw, typ, data := uint32(noIndex), uint32(noIndex), uint32(typeIntDec), a.num
+		if a.android {
+			ns = w.str(androidNS)
+		}
+		if a.str != "" {
+			raw, typ = w.str(a.str), typeString
+			data = raw
+		}
+		// Res_value: its size, a reserved byte and the data type, then
+		// the data.
+		w.put(ns, w.str(a.name), raw, 8|typ<<24, data)
+	}
+}
+
+func (w *axmlWriter) end(name string) {
+	w.node(chunkEndElement, 24)
+	w.put(noIndex, w.str(name))
+}
+
+// bytes returns the document: the XML chunk holding the string pool, the
+// resource map and the nodes.
+func (w *axmlWriter) bytes() []byte {
+	var pool bytes.Buffer
+	offsets := make([]uint32, len(w.strings))
+	for i, s := range w.strings {
+		// UTF-8 strings give their length in characters, then in bytes;
+		// the strings here are ASCII and shorter than 128 bytes.
+		offsets[i] = uint32(pool.Len())
+		pool.WriteByte(byte(len(s)))
+		pool.WriteByte(byte(len(s)))
+		pool.WriteString(s)
+		pool.WriteByte(0)
+	}
+	for pool.Len()%4 != 0 {
+		pool.WriteByte(0)
+	}
+	start := 28 + 4*uint32(len(offsets))
+
+	var out bytes.Buffer
+	le := func(v any) { binary.Write(&out, binary.LittleEndian, v) }
+	resMapSize := 8 + 4*uint32(len(attrIDs))
+	poolSize := start + uint32(pool.Len())
+	le([2]uint16{chunkXML, 8})
+	le(8 + poolSize + resMapSize + uint32(w.body.Len()))
+
+	le([2]uint16{chunkStringPool, 28})
+	le([6]uint32{poolSize, uint32(len(w.strings)), 0, utf8Flag, start, 0})
+	le(offsets)
+	out.Write(pool.Bytes())
+
+	le([2]uint16{chunkResourceMap, 8})
+	le(resMapSize)
+	for _, a := range attrIDs {
+		le(a.id)
+	}
+	out.Write(w.body.Bytes())
+	return out.Bytes()
+}
+
+// androidManifest returns the compiled AndroidManifest.xml of a package
+// with no components.
+func androidManifest(o apkOptions) []byte {
+	w := newAXMLWriter()
+	w.startNS()
+	w.start("manifest",
+		attr{android: true, name: "versionCode", num: 1},
+		attr{android: true, name: "versionName", str: o.version},
+		attr{name: "package", str: o.name},
+	)
+	w.start("uses-sdk",
+		attr{android: true, name: "minSdkVersion", num: minSDK},
+		attr{android: true, name: "targetSdkVersion", num: targetSDK},
+	)
+	w.end("uses-sdk")
+	w.start("application", attr{android: true, name: "label", str: o.label})
+	w.end("application")
+	w.end("manifest")
+	w.endNS()
+	return w.bytes()
+}
@@ -0,0 +1,105 @@
+package apk
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash/adler32"
+	"sort"
+)
+
+const (
+	dexHeaderSize = 0x70
+	dexEndianTag  = 0x12345678
+	dexNoIndex    = 0xffffffff
+	accPublic     = 0x1
+)
+
+// Map item types of the sections classesDex writes.
+const (
+	mapHeader     = 0x0000
+	mapStringID   = 0x0001
+	mapTypeID     = 0x0002
+	mapClassDef   = 0x0006
+	mapMapList    = 0x1000
+	mapStringData = 0x2002
+)
+
+var dexMagic = []byte("dex\n035\x00")
+
+// classesDex returns a DEX file defining the public class descriptor,
+// which extends java.lang.Object and has no members.
+func classesDex(descriptor string) []byte {
+	// String and type IDs are sorted by the strings.
+	strs := []string{descriptor, "Ljava/lang/Object;"}
+	sort.Strings(strs)
+	classIdx, superIdx := uint32(0), uint32(1)
+	if strs[0] != descriptor {
+		classIdx, superIdx = 1, 0
+	}
+
+	stringIDsOff := uint32(dexHeaderSize)
+	typeIDsOff := stringIDsOff + 4*uint32(len(strs))
+	classDefsOff := typeIDsOff + 4*uint32(len(strs))
+	dataOff := classDefsOff + 32
+
+	var data bytes.Buffer
+	stringOffs := make([]uint32, len(strs))
+	for i, s := range strs {
+		// string_data_item: the length in UTF-16 code units, then the
+		// MUTF-8 bytes, which are ASCII here, and a NUL.
+		stringOffs[i] = dataOff + uint32(data.Len())
+		data.WriteByte(byte(len(s)))
+		data.WriteString(s)
+		data.WriteByte(0)
+	}
+	for data.Len()%4 != 0 {
+		data.WriteByte(0)
+	}
+	mapOff := dataOff + uint32(data.Len())
+	items := [][3]uint32{ // type, size, offset
+		{mapHeader, 1, 0},
+		{mapStringID, uint32(len(strs)), stringIDsOff},
+		{mapTypeID, uint32(len(strs)), typeIDsOff},
+		{mapClassDef, 1, classDefsOff},
+		{mapStringData, uint32(len(strs)), stringOffs[0]},
+		{mapMapList, 1, mapOff},
+	}
+	le := func(v any) { binary.Write(&data, binary.LittleEndian, v) }
+	le(uint32(len(items)))
+	for _, it := range items {
+		le(uint16(it[0]))
+		le(uint16(0))
+		le([2]uint32{it[1], it[2]})
+	}
+	fileSize := mapOff + 4 + 12*uint32(len(items))
+
+	var out bytes.Buffer
+	w := func(v any) { binary.Write(&out, binary.LittleEndian, v) }
+	out.Write(dexMagic)
+	out.Write(make([]byte, 4+sha1.Size)) // checksum and signature, set last
+	w([20]uint32{
+		fileSize, dexHeaderSize, dexEndianTag,
+		0, 0, // link
+		mapOff,
+		uint32(len(strs)), stringIDsOff,
+		uint32(len(strs)), typeIDsOff,
+		0, 0, // proto IDs
+		0, 0, // field IDs
+		0, 0, // method IDs
+		1, classDefsOff,
+		fileSize - dataOff, dataOff,
+	})
+	w(stringOffs)
+	for i := range strs {
+		w(uint32(i)) // type i is described by string i
+	}
+	w([8]uint32{classIdx, accPublic, superIdx, 0, dexNoIndex, 0, 0, 0})
+	out.Write(data.Bytes())
+
+	dex := out.Bytes()
+	sig := sha1.Sum(dex[32:])
+	copy(dex[12:], sig[:])
+	binary.LittleEndian.PutUint32(dex[8:], adler32.Checksum(dex[12:]))
+	return dex
+}
@@ -0,0 +1,140 @@
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/ooxml"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeAPK, New())
+}
+
+// ApkGenerator writes unsigned Android packages: a compiled manifest and
+// a DEX file defining one class, with a padding entry bringing the package
+// to its size.
+type ApkGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &ApkGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *ApkGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *ApkGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	defaultName    = "com.example.genfile"
+	defaultVersion = "1.0.0"
+	// maxValueLen keeps the manifest's strings short enough for one-byte
+	// lengths in the string pool.
+	maxValueLen = 100
+	minSDK      = 21
+	targetSDK   = 34
+)
+
+var (
+	// nameRe matches Java package names of at least two segments, which
+	// Android requires of application IDs.
+	nameRe    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z][A-Za-z0-9_]*)+$`)
+	versionRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+~-]*$`)
+)
+
+// apkOptions holds the settings the APK generator reads from ports.Options.
+type apkOptions struct {
+	name, version string
+	label         string
+	modTime       time.Time // zero for the time of generation
+}
+
+func parseOptions(opts ports.Options) (apkOptions, error) {
+	o := apkOptions{
+		name:    opts.String("pkg-name", defaultName),
+		version: opts.String("pkg-version", defaultVersion),
+	}
+	if len(o.name) > maxValueLen || !nameRe.MatchString(o.name) {
+		return o, fmt.Errorf("invalid package name %q: use a Java package name such as %s", o.name, defaultName)
+	}
+	if len(o.version) > maxValueLen || !versionRe.MatchString(o.version) {
+		return o, fmt.Errorf("invalid package version %q: use up to %d letters, digits and '.', '_', '+', '~' or '-'", o.version, maxValueLen)
+	}
+	o.label = o.name[strings.LastIndexByte(o.name, '.')+1:]
+	var err error
+	if o.modTime, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *ApkGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes an APK of exactly size bytes for the
+// application ID "pkg-name" (com.example.genfile) at version name
+// "pkg-version" (1.0.0) and version code 1. The package is not signed. The
+// "mtime" option dates the entries.
+func (g *ApkGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.modTime.IsZero() {
+		o.modTime = time.Now()
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	descriptor := "L" + strings.ReplaceAll(o.name, ".", "/") + "/Fixture;"
+	for _, e := range []struct {
+		name string
+		body []byte
+	}{
+		{"AndroidManifest.xml", androidManifest(o)},
+		{"classes.dex", classesDex(descriptor)},
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: o.modTime})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", e.name, err)
+		}
+		if _, err := w.Write(e.body); err != nil {
+			return fmt.Errorf("failed to write %s: %w", e.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	return ooxml.WritePadded(g.fs, path, buf.Bytes(), size, o.modTime)
+}
+
+// Resize writes the package at srcPath to outPath with its entries as they
+// are and its padding entry sized to bring it to exactly targetSize.
+func (g *ApkGenerator) Resize(srcPath, outPath string, targetSize int64) error {
+	return ooxml.Resize(g.fs, srcPath, outPath, targetSize)
+}
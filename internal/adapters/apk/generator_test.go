@@ -0,0 +1,133 @@
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash/adler32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestApkGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name             string
+		size             int64
+		opts             ports.Options
+		pkgName, version string // want
+		errSub           string
+	}{
+		{name: "Default", size: 1 << 20, pkgName: "com.example.genfile", version: "1.0.0"},
+		{name: "Small", size: 1000, pkgName: "com.example.genfile", version: "1.0.0"},
+		{name: "Options", size: 50000, opts: ports.Options{"pkg-name": "org.acme.shop_app", "pkg-version": "2.3.1-beta"}, pkgName: "org.acme.shop_app", version: "2.3.1-beta"},
+		{name: "TooSmall", size: 500, errSub: "does not fit"},
+		{name: "OneSegment", size: 10000, opts: ports.Options{"pkg-name": "genfile"}, errSub: "invalid package name"},
+		{name: "BadVersion", size: 10000, opts: ports.Options{"pkg-version": "1 0"}, errSub: "invalid package version"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixture.apk")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("zip.NewReader() error = %v", err)
+			}
+			files := map[string][]byte{}
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("opening %s: %v", f.Name, err)
+				}
+				if files[f.Name], err = io.ReadAll(rc); err != nil {
+					t.Fatalf("reading %s: %v", f.Name, err)
+				}
+				rc.Close()
+			}
+
+			attrs := readManifestAttrs(t, files["AndroidManifest.xml"])
+			if got := attrs["package"]; got != tc.pkgName {
+				t.Errorf("package = %q, want %q", got, tc.pkgName)
+			}
+			if got := attrs["versionName"]; got != tc.version {
+				t.Errorf("versionName = %q, want %q", got, tc.version)
+			}
+
+			dex := files["classes.dex"]
+			if !bytes.HasPrefix(dex, dexMagic) {
+				t.Fatalf("missing DEX magic: %q", dex[:8])
+			}
+			if got := binary.LittleEndian.Uint32(dex[32:]); int(got) != len(dex) {
+				t.Errorf("DEX file_size = %d, want %d", got, len(dex))
+			}
+			if sig := sha1.Sum(dex[32:]); !bytes.Equal(dex[12:32], sig[:]) {
+				t.Errorf("DEX signature = %x, want %x", dex[12:32], sig)
+			}
+			if got, want := binary.LittleEndian.Uint32(dex[8:]), adler32.Checksum(dex[12:]); got != want {
+				t.Errorf("DEX checksum = %08x, want %08x", got, want)
+			}
+		})
+	}
+}
+
+// readManifestAttrs returns the attributes of the root element of a
+// binary XML document by name, for string values only.
+func readManifestAttrs(t *testing.T, doc []byte) map[string]string {
+	t.Helper()
+	u16 := func(off int) int { return int(binary.LittleEndian.Uint16(doc[off:])) }
+	u32 := func(off int) int { return int(binary.LittleEndian.Uint32(doc[off:])) }
+	if u16(0) != chunkXML || u32(4) != len(doc) {
+		t.Fatalf("bad XML chunk header: %x", doc[:8])
+	}
+
+	var strs []string
+	for off := 8; off < len(doc); off += u32(off + 4) {
+		switch u16(off) {
+		case chunkStringPool:
+			if u32(off+16)&utf8Flag == 0 {
+				t.Fatalf("string pool is not UTF-8")
+			}
+			count, start := u32(off+8), off+u32(off+20)
+			for i := 0; i < count; i++ {
+				s := start + u32(off+28+4*i)
+				n := int(doc[s+1])
+				strs = append(strs, string(doc[s+2:s+2+n]))
+			}
+		case chunkStartElement:
+			attrs := map[string]string{}
+			count := u16(off + 28)
+			for i := 0; i < count; i++ {
+				a := off + 36 + 20*i
+				if doc[a+15] == typeString {
+					attrs[strs[u32(a+4)]] = strs[u32(a+16)]
+				}
+			}
+			return attrs
+		}
+	}
+	t.Fatal("no element in document")
+	return nil
+}
@@ -0,0 +1,359 @@
+package bin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeBIN, New())
+}
+
+// BinGenerator writes raw binary files (.bin, .dat, .img) with a
+// selectable fill pattern.
+type BinGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &BinGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *BinGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *BinGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// Fill patterns.
+const (
+	FillRandom  = "random"  // pseudo-random bytes, reproducible from seed
+	FillSeeded  = "seeded"  // reproducible pseudo-random bytes from bin-seed
+	FillZero    = "zero"    // 0x00
+	FillFF      = "ff"      // 0xFF
+	FillRepeat  = "repeat"  // bin-repeat over and over
+	FillCounter = "counter" // consecutive 64-bit big-endian integers
+)
+
+// chunkSize is roughly how much is filled and written at a time.
+const chunkSize = 64 * 1024
+
+// binOptions holds the settings the BIN generator reads from ports.Options.
+type binOptions struct {
+	fill    string
+	seed    int
+	pattern []byte
+	filler  utils.Filler // what the random and seeded fills turn into
+	threads int          // goroutines filling the data, but for the seeded fill
+	rand    *utils.Rand  // of the random fill
+}
+
+func parseOptions(opts ports.Options) (binOptions, error) {
+	o := binOptions{fill: strings.ToLower(opts.String("bin-fill", FillRandom))}
+	switch o.fill {
+	case FillRandom, FillSeeded, FillZero, FillFF, FillCounter:
+	case FillRepeat:
+		p := opts.String("bin-repeat", "")
+		if p == "" {
+			return o, fmt.Errorf("bin-fill repeat needs a bin-repeat pattern")
+		}
+		o.pattern = []byte(p)
+		if h, ok := strings.CutPrefix(p, "0x"); ok {
+			var err error
+			if o.pattern, err = hex.DecodeString(h); err != nil || len(o.pattern) == 0 {
+				return o, fmt.Errorf("invalid hex bin-repeat pattern %q", p)
+			}
+		}
+	default:
+		return o, fmt.Errorf("unknown bin fill %q (want random, seeded, zero, ff, repeat or counter)", o.fill)
+	}
+	var err error
+	if o.seed, err = opts.Int("bin-seed", 1); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	if o.filler, err = utils.ParseFiller(o.rand, opts.String("entropy", ""), opts.String("shared-blocks", ""), opts.String("shared-pool", "")); err != nil {
+		return o, err
+	}
+	if o.filler != utils.RandomFiller && o.fill != FillRandom && o.fill != FillSeeded {
+		return o, fmt.Errorf("entropy and shared-blocks apply to the random and seeded fills, not bin-fill %s", o.fill)
+	}
+	if o.threads, err = utils.ParseThreads(opts.String("threads", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *BinGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes size bytes of the fill pattern selected by the
+// "bin-fill" option: random bytes (the default), pseudo-random bytes
+// reproducible from "bin-seed", 0x00, 0xFF, the "bin-repeat" string (or
+// hex bytes after 0x) over and over, or a counter. "entropy" below 1
+// turns that share of the random or seeded bytes into a repeated pattern,
+// in blocks spread evenly, so the file compresses to about that share.
+// "shared-blocks" draws that share of them, in 64KB chunks, from the pool
+// seeded by "shared-pool", the same chunk at the same offset of every file
+// drawing on it. "threads" fills and writes the data on that many
+// goroutines, but for the seeded fill, whose bytes follow one another.
+func (g *BinGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := g.GenerateTo(f, size, opts); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// GenerateTo writes the bytes GenerateWithOptions would to w.
+func (g *BinGenerator) GenerateTo(out io.Writer, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.fill != FillSeeded {
+		return utils.WriteParallel(out, size, o.threads, fillAt(o, 0))
+	}
+	buf, _, fill := newFiller(o, 0)
+	return writeFill(out, buf, fill, 0, size)
+}
+
+// GenerateFrom writes the file GenerateWithOptions would, keeping the
+// whole buffers of fill a run that stopped at from wrote and carrying the
+// pattern on from there.
+func (g *BinGenerator) GenerateFrom(path string, size int64, opts ports.Options, from ports.ResumeState, checkpoint func(ports.ResumeState) error) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	buf, start, fill := newFiller(o, min(from.Offset, size))
+	f, err := outputfs.Resume(g.fs, path, start)
+	if err != nil {
+		return fmt.Errorf("failed to resume file %s: %w", path, err)
+	}
+	defer f.Close()
+	cw := outputfs.NewCheckpointer(f, start, checkpoint)
+	cw.Phase = "data"
+	if o.fill != FillSeeded {
+		err = utils.WriteParallel(cw, size-start, o.threads, fillAt(o, start))
+	} else {
+		err = writeFill(cw, buf, fill, start, size)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeFill writes the bytes from start to size of the pattern fill puts
+// in buf to out.
+func writeFill(out io.Writer, buf []byte, fill func([]byte) error, start, size int64) error {
+	w := bufio.NewWriterSize(out, len(buf))
+	for written := start; written < size; {
+		if err := fill(buf); err != nil {
+			return fmt.Errorf("failed to generate data: %w", err)
+		}
+		n := min(int64(len(buf)), size-written)
+		if _, err := w.Write(buf[:n]); err != nil {
+			return fmt.Errorf("failed to write data: %w", err)
+		}
+		written += n
+	}
+	return w.Flush()
+}
+
+// FreeTail reports every byte of the file as free: whatever the fill, it
+// is only data.
+func (g *BinGenerator) FreeTail(size int64, opts ports.Options) (int64, []byte) {
+	return size, nil
+}
+
+// Resize writes the first size bytes of the file at srcPath to outPath,
+// extended if it is shorter with the bytes GenerateTo would write.
+func (g *BinGenerator) Resize(srcPath, outPath string, size int64) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", srcPath, err)
+	}
+	defer src.Close()
+	f, err := outputfs.Create(g.fs, outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", outPath, err)
+	}
+	defer f.Close()
+	copied, err := io.CopyN(f, src, size)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to copy %s: %w", srcPath, err)
+	}
+	if err := g.GenerateTo(f, size-copied, nil); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// GenerateAllocated creates a file of size zero bytes with mode, without
+// writing them. Only the zero fill (the default here) can be allocated.
+func (g *BinGenerator) GenerateAllocated(path string, size int64, mode ports.Allocation, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if fill := opts.String("bin-fill", FillZero); !strings.EqualFold(fill, FillZero) {
+		return fmt.Errorf("%s files are all zeros; bin-fill %s is not supported", mode, fill)
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := utils.Extend(f, size, mode == ports.AllocatePreallocate); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// newFiller returns a buffer and a function that fills it with the next
+// bytes of the pattern, starting at the last whole buffer at or before
+// from, and that buffer's offset. The buffer length keeps the pattern in
+// phase from one call to the next.
+func newFiller(o binOptions, from int64) ([]byte, int64, func([]byte) error) {
+	buf, fill := newPatternFiller(o, from/int64(chunkLen(o)))
+	start := from / int64(len(buf)) * int64(len(buf))
+	if o.filler == utils.RandomFiller {
+		return buf, start, fill
+	}
+	offset := start
+	return buf, start, func(b []byte) error {
+		if err := fill(b); err != nil {
+			return err
+		}
+		o.filler.Mix(b, offset)
+		offset += int64(len(b))
+		return nil
+	}
+}
+
+// fillAt returns a function filling a buffer with the bytes of the
+// pattern at its offset from base, in any order, for every fill but the
+// seeded one. Offsets are multiples of chunkSize.
+func fillAt(o binOptions, base int64) func([]byte, int64) error {
+	switch o.fill {
+	case FillCounter:
+		return func(b []byte, offset int64) error {
+			var word [8]byte
+			for i := 0; i < len(b); i += 8 {
+				binary.BigEndian.PutUint64(word[:], uint64((base+offset+int64(i))/8))
+				copy(b[i:], word[:])
+			}
+			return nil
+		}
+	case FillZero, FillFF, FillRepeat:
+		// The pattern buffer starts with the pattern and is a whole number
+		// of them long, so copying it on after the first part keeps the
+		// pattern in phase.
+		rep, _ := newPatternFiller(o, 0)
+		return func(b []byte, offset int64) error {
+			n := copy(b, rep[(base+offset)%int64(len(rep)):])
+			for n < len(b) {
+				n += copy(b[n:], rep)
+			}
+			return nil
+		}
+	default:
+		return func(b []byte, offset int64) error {
+			o.rand.FillAt(b, base+offset)
+			if o.filler != utils.RandomFiller {
+				o.filler.Mix(b, base+offset)
+			}
+			return nil
+		}
+	}
+}
+
+// chunkLen returns the length of the buffer newPatternFiller fills for o:
+// chunkSize, or a whole number of repeats of a pattern at least as long.
+func chunkLen(o binOptions) int {
+	if o.fill == FillRepeat {
+		return (chunkSize + len(o.pattern) - 1) / len(o.pattern) * len(o.pattern)
+	}
+	return chunkSize
+}
+
+// newPatternFiller returns the buffer and fill function of newFiller for
+// o's fill pattern alone, skip buffers in.
+func newPatternFiller(o binOptions, skip int64) ([]byte, func([]byte) error) {
+	switch o.fill {
+	case FillSeeded:
+		src := rand.NewPCG(uint64(o.seed), 0)
+		for i := skip * chunkSize / 8; i > 0; i-- {
+			src.Uint64()
+		}
+		return make([]byte, chunkSize), func(b []byte) error {
+			for i := 0; i < len(b); i += 8 {
+				binary.LittleEndian.PutUint64(b[i:], src.Uint64())
+			}
+			return nil
+		}
+	case FillCounter:
+		next := uint64(skip * chunkSize / 8)
+		return make([]byte, chunkSize), func(b []byte) error {
+			for i := 0; i < len(b); i += 8 {
+				binary.BigEndian.PutUint64(b[i:], next)
+				next++
+			}
+			return nil
+		}
+	case FillZero, FillFF, FillRepeat:
+		pattern := o.pattern
+		switch o.fill {
+		case FillZero:
+			pattern = []byte{0x00}
+		case FillFF:
+			pattern = []byte{0xFF}
+		}
+		buf := []byte(strings.Repeat(string(pattern), chunkLen(o)/len(pattern)))
+		return buf, func([]byte) error { return nil }
+	default:
+		offset := skip * chunkSize
+		return make([]byte, chunkSize), func(b []byte) error {
+			o.rand.FillAt(b, offset)
+			offset += int64(len(b))
+			return nil
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package bin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestBinGenerator_GenerateWithOptions(t *testing.T) {
+	generator := &BinGenerator{}
+	var _ ports.StreamGenerator = generator
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name   string
+		size   int64
+		opts   ports.Options
+		check  func(t *testing.T, data []byte)
+		errSub string
+	}{
+		{name: "DefaultRandom", size: 100*1024 + 3, check: func(t *testing.T, data []byte) {
+			if bytes.Count(data, []byte{0}) > len(data)/64 {
+				t.Error("random data has too many zero bytes")
+			}
+		}},
+		{name: "Empty", size: 0},
+		{name: "Zero", size: 70000, opts: ports.Options{"bin-fill": "zero"}, check: func(t *testing.T, data []byte) {
+			if !bytes.Equal(data, make([]byte, len(data))) {
+				t.Error("data is not all 0x00")
+			}
+		}},
+		{name: "FF", size: 1000, opts: ports.Options{"bin-fill": "FF"}, check: func(t *testing.T, data []byte) {
+			if !bytes.Equal(data, bytes.Repeat([]byte{0xFF}, len(data))) {
+				t.Error("data is not all 0xFF")
+			}
+		}},
+		{name: "RepeatString", size: 200000, opts: ports.Options{"bin-fill": "repeat", "bin-repeat": "abc"}, check: func(t *testing.T, data []byte) {
+			if want := strings.Repeat("abc", 200000/3+1)[:200000]; string(data) != want {
+				t.Error("data is not the repeated pattern")
+			}
+		}},
+		{name: "RepeatHex", size: 10, opts: ports.Options{"bin-fill": "repeat", "bin-repeat": "0xDEADBEEF"}, check: func(t *testing.T, data []byte) {
+			if want := []byte{0xDE, 0xAD, 0xBE, 0xEF, 0xDE, 0xAD, 0xBE, 0xEF, 0xDE, 0xAD}; !bytes.Equal(data, want) {
+				t.Errorf("data = % x, want % x", data, want)
+			}
+		}},
+		{name: "Counter", size: 3*chunkSize + 5, opts: ports.Options{"bin-fill": "counter"}, check: func(t *testing.T, data []byte) {
+			for i := 0; i+8 <= len(data); i += 8 {
+				if n := binary.BigEndian.Uint64(data[i:]); n != uint64(i/8) {
+					t.Fatalf("word %d = %d", i/8, n)
+				}
+			}
+		}},
+		{name: "RepeatWithoutPattern", size: 10, opts: ports.Options{"bin-fill": "repeat"}, errSub: "needs a bin-repeat pattern"},
+		{name: "BadHex", size: 10, opts: ports.Options{"bin-fill": "repeat", "bin-repeat": "0xZZ"}, errSub: "invalid hex"},
+		{name: "UnknownFill", size: 10, opts: ports.Options{"bin-fill": "ones"}, errSub: "unknown bin fill"},
+		{name: "BadSeed", size: 10, opts: ports.Options{"bin-fill": "seeded", "bin-seed": "x"}, errSub: "bin-seed"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, tc.name+".bin")
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSub, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			if tc.check != nil {
+				tc.check(t, data)
+			}
+		})
+	}
+}
+
+func TestBinGenerator_Seeded(t *testing.T) {
+	generator := &BinGenerator{}
+	gen := func(seed string) []byte {
+		var buf bytes.Buffer
+		if err := generator.GenerateTo(&buf, 100000, ports.Options{"bin-fill": "seeded", "bin-seed": seed}); err != nil {
+			t.Fatalf("GenerateTo returned unexpected error: %v", err)
+		}
+		return buf.Bytes()
+	}
+	a, b, c := gen("42"), gen("42"), gen("43")
+	if !bytes.Equal(a, b) {
+		t.Error("the same seed gave different data")
+	}
+	if bytes.Equal(a, c) {
+		t.Error("different seeds gave the same data")
+	}
+}
+
+func TestBinGenerator_Entropy(t *testing.T) {
+	generator := &BinGenerator{}
+	for _, opts := range []ports.Options{
+		{"entropy": "0.25"},
+		{"entropy": "0.25", "bin-fill": "seeded"},
+	} {
+		var buf, gz bytes.Buffer
+		if err := generator.GenerateTo(&buf, 1<<20+5, opts); err != nil {
+			t.Fatalf("%v: GenerateTo returned unexpected error: %v", opts, err)
+		}
+		if buf.Len() != 1<<20+5 {
+			t.Fatalf("%v: wrote %d bytes", opts, buf.Len())
+		}
+		zw := gzip.NewWriter(&gz)
+		zw.Write(buf.Bytes())
+		zw.Close()
+		if ratio := float64(gz.Len()) / float64(buf.Len()); ratio < 0.23 || ratio > 0.28 {
+			t.Errorf("%v: compresses to %.3f of its size, want about 0.25", opts, ratio)
+		}
+	}
+
+	_, err := parseOptions(ports.Options{"entropy": "0.5", "bin-fill": "zero"})
+	if err == nil || !strings.Contains(err.Error(), "entropy") {
+		t.Errorf("expected an entropy error for the zero fill, got %v", err)
+	}
+}
+
+func TestBinGenerator_WithSeed(t *testing.T) {
+	dir := t.TempDir()
+	gen := func(name string, opts ...ports.Option) []byte {
+		path := filepath.Join(dir, name)
+		if err := ports.Generate(New(), path, 50000, opts...); err != nil {
+			t.Fatalf("Generate returned unexpected error: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	a, b, c := gen("a.bin", ports.WithSeed(7)), gen("b.bin", ports.WithSeed(7)), gen("c.bin")
+	if !bytes.Equal(a, b) {
+		t.Error("the same seed gave different data")
+	}
+	if bytes.Equal(a, c) {
+		t.Error("unseeded data matched the seeded data")
+	}
+}
+
+func TestBinGenerator_GenerateAllocated(t *testing.T) {
+	generator := &BinGenerator{}
+	var _ ports.AllocatingGenerator = generator
+	outPath := filepath.Join(t.TempDir(), "disk.img")
+
+	if err := generator.GenerateAllocated(outPath, 1<<20, ports.AllocateSparse, nil); err != nil {
+		t.Fatalf("GenerateAllocated returned unexpected error: %v", err)
+	}
+	data, _ := os.ReadFile(outPath)
+	if !bytes.Equal(data, make([]byte, 1<<20)) {
+		t.Errorf("sparse file is %d bytes or not all zeros", len(data))
+	}
+
+	err := generator.GenerateAllocated(outPath, 1<<20, ports.AllocateSparse, ports.Options{"bin-fill": "counter"})
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("expected an error for a counter fill, got %v", err)
+	}
+}
+
+func TestBinGenerator_Resize(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := New().(ports.ConfigurableGenerator).Configure(ports.Options{"bin-fill": "ff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int64{0, 10, 1000, 5000} {
+		outPath := filepath.Join(dir, "out.bin")
+		if err := g.(ports.Resizer).Resize(src, outPath, size); err != nil {
+			t.Fatalf("Resize(%d): %v", size, err)
+		}
+		got, _ := os.ReadFile(outPath)
+		kept := min(size, int64(len(data)))
+		if int64(len(got)) != size || !bytes.Equal(got[:kept], data[:kept]) ||
+			!bytes.Equal(got[kept:], bytes.Repeat([]byte{0xFF}, int(size-kept))) {
+			t.Errorf("Resize(%d) wrote %d bytes, want the source cut or extended with 0xFF", size, len(got))
+		}
+	}
+}
+
+func TestBinGenerator_GenerateFrom(t *testing.T) {
+	generator := &BinGenerator{}
+	var _ ports.ResumableGenerator = generator
+	const size, stop = 300000, 3*chunkSize + 100
+	for _, opts := range []ports.Options{
+		{"bin-fill": "seeded", "bin-seed": "7"},
+		{"bin-fill": "counter"},
+		{"bin-fill": "repeat", "bin-repeat": "abcdefg"},
+	} {
+		var want bytes.Buffer
+		if err := generator.GenerateTo(&want, size, opts); err != nil {
+			t.Fatalf("GenerateTo(%v) returned unexpected error: %v", opts, err)
+		}
+		// The run resumed wrote past its last checkpoint before it stopped.
+		path := filepath.Join(t.TempDir(), "resumed.bin")
+		if err := os.WriteFile(path, append(want.Bytes()[:stop:stop], "torn"...), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := generator.GenerateFrom(path, size, opts, ports.ResumeState{Offset: stop}, nil); err != nil {
+			t.Fatalf("GenerateFrom(%v) returned unexpected error: %v", opts, err)
+		}
+		if got, _ := os.ReadFile(path); !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("%v: resumed file differs from one written in one go", opts)
+		}
+	}
+}
+
+func TestBinGenerator_Threads(t *testing.T) {
+	generator := &BinGenerator{}
+	const size = 5<<20 + 333
+	for _, opts := range []ports.Options{
+		{"bin-fill": "counter"},
+		{"bin-fill": "ff"},
+		{"bin-fill": "repeat", "bin-repeat": "abcdefg"},
+	} {
+		var want bytes.Buffer
+		if err := generator.GenerateTo(&want, size, opts); err != nil {
+			t.Fatalf("GenerateTo(%v) returned unexpected error: %v", opts, err)
+		}
+		threaded := ports.Options{"threads": "4"}.With(opts)
+		var got bytes.Buffer
+		if err := generator.GenerateTo(&got, size, threaded); err != nil {
+			t.Fatalf("GenerateTo(%v) returned unexpected error: %v", threaded, err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%v: streamed on 4 threads differs from one thread", opts)
+		}
+		path := filepath.Join(t.TempDir(), "threads.bin")
+		if err := generator.GenerateWithOptions(path, size, threaded); err != nil {
+			t.Fatalf("GenerateWithOptions(%v) returned unexpected error: %v", threaded, err)
+		}
+		if data, _ := os.ReadFile(path); !bytes.Equal(data, want.Bytes()) {
+			t.Errorf("%v: file written on 4 threads differs from one thread", opts)
+		}
+	}
+
+	var data bytes.Buffer
+	if err := generator.GenerateTo(&data, size, ports.Options{"threads": "4", "entropy": "0.5"}); err != nil {
+		t.Fatalf("GenerateTo returned unexpected error: %v", err)
+	}
+	if data.Len() != size {
+		t.Errorf("random fill on 4 threads wrote %d bytes, want %d", data.Len(), size)
+	}
+	if err := generator.GenerateTo(&data, size, ports.Options{"threads": "-2"}); err == nil {
+		t.Error("negative threads accepted")
+	}
+}
@@ -0,0 +1,448 @@
+package cert
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	for _, t := range []ports.FileType{ports.FileTypePEM, ports.FileTypeCRT, ports.FileTypeKEY, ports.FileTypeDER} {
+		factory.RegisterGenerator(t, &CertGenerator{fileType: t})
+	}
+}
+
+// CertGenerator writes X.509 certificates and their private keys, freshly
+// generated for each file: as a PEM bundle of both, a PEM certificate or
+// key alone, or a DER certificate.
+type CertGenerator struct {
+	opts     ports.Options // set by Configure
+	fileType ports.FileType
+	fs       ports.OutputFS // set by WithOutputFS
+}
+
+// New returns a generator of PEM bundles holding a certificate and its
+// key.
+func New() ports.FileGenerator {
+	return &CertGenerator{fileType: ports.FileTypePEM}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *CertGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *CertGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// Key algorithms accepted by the "cert-key" option.
+const (
+	KeyECDSA   = "ecdsa"
+	KeyRSA     = "rsa"
+	KeyEd25519 = "ed25519"
+)
+
+const (
+	defaultCN = "genfile.test"
+	caName    = "genfile Test CA"
+	// maxDER bounds DER certificates, which are padded inside and built in
+	// memory.
+	maxDER = 64 << 20
+	// serialLen is the length of serial numbers unless a DER certificate
+	// needs another to come out at its size; serials are 1 to 20 bytes.
+	serialLen = 16
+	// lineLen is the length of the comment lines padding PEM files.
+	lineLen = 64
+	// commentText, repeated, fills the comment extension.
+	commentText = "Test certificate generated by genfile. "
+)
+
+// oidNetscapeComment identifies the Netscape certificate comment
+// extension, an IA5String that pads DER certificates.
+var oidNetscapeComment = asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 13}
+
+// certOptions holds the settings the certificate generator reads from
+// ports.Options.
+type certOptions struct {
+	key        string
+	cn         string
+	selfSigned bool
+	notBefore  time.Time // zero for the time of generation
+	rand       *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (certOptions, error) {
+	o := certOptions{
+		key: opts.String("cert-key", KeyECDSA),
+		cn:  opts.String("cert-cn", defaultCN),
+	}
+	switch o.key {
+	case KeyECDSA, KeyRSA, KeyEd25519:
+	default:
+		return o, fmt.Errorf("invalid certificate key %q: use %s, %s or %s", o.key, KeyECDSA, KeyRSA, KeyEd25519)
+	}
+	if o.cn == "" || len(o.cn) > 64 {
+		return o, fmt.Errorf("invalid certificate common name %q: use 1 to 64 characters", o.cn)
+	}
+	var err error
+	if o.selfSigned, err = opts.Bool("cert-self-signed", true); err != nil {
+		return o, err
+	}
+	if o.notBefore, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *CertGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes a file of exactly size bytes holding a new
+// certificate for "cert-cn" (genfile.test), valid for a year from "mtime"
+// or now, and its "cert-key" key: ECDSA P-256 (the default), RSA 2048 or
+// Ed25519. The certificate signs itself unless "cert-self-signed" is
+// false, when a throwaway CA that is not written signs it. PEM files end
+// in comment lines that PEM readers skip, padding them to their size; DER
+// certificates carry the padding in a comment extension.
+func (g *CertGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.notBefore.IsZero() {
+		o.notBefore = time.Now()
+	}
+	o.notBefore = o.notBefore.UTC().Truncate(time.Second)
+	if g.fileType == ports.FileTypeDER && size > maxDER {
+		return fmt.Errorf("target %d too large for a DER certificate; the limit is %d bytes", size, maxDER)
+	}
+
+	key, err := newKey(o.rand, o.key)
+	if err != nil {
+		return err
+	}
+	issuer, issuerKey := (*x509.Certificate)(nil), key
+	if !o.selfSigned {
+		if issuerKey, err = newKey(o.rand, o.key); err != nil {
+			return err
+		}
+		issuer = caTemplate(o, issuerKey)
+	}
+	c := certificate{o: o, key: key, issuer: issuer, issuerKey: issuerKey}
+
+	var content []byte
+	switch g.fileType {
+	case ports.FileTypeDER:
+		if content, err = c.fit(size); err != nil {
+			return err
+		}
+	case ports.FileTypeKEY:
+		if content, err = keyPEM(key); err != nil {
+			return err
+		}
+	default:
+		der, err := c.create(serialLen, 0)
+		if err != nil {
+			return err
+		}
+		content = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		if g.fileType == ports.FileTypePEM {
+			k, err := keyPEM(key)
+			if err != nil {
+				return err
+			}
+			content = append(content, k...)
+		}
+	}
+	if int64(len(content)) > size {
+		return fmt.Errorf("target %d too small; the %s content takes %d bytes", size, g.fileType, len(content))
+	}
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriterSize(f, 1<<20)
+	if _, err := bw.Write(content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", g.fileType, err)
+	}
+	if err := writeComments(bw, size-int64(len(content))); err != nil {
+		return fmt.Errorf("failed to write padding: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", g.fileType, err)
+	}
+	return f.Sync()
+}
+
+// newKey generates a private key of the algorithm alg from r. The key
+// generators of crypto read a varying number of random bytes, so the keys
+// are made from r's bytes here, to come out the same for the same seed.
+func newKey(r *utils.Rand, alg string) (crypto.Signer, error) {
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case KeyRSA:
+		key, err = rsaKey(r, 2048)
+	case KeyEd25519:
+		seed := make([]byte, ed25519.SeedSize)
+		r.Read(seed)
+		key = ed25519.NewKeyFromSeed(seed)
+	default:
+		key, err = ecdsaKey(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", alg, err)
+	}
+	return key, nil
+}
+
+// rsaKey returns an RSA key of bits bits, with primes drawn from r.
+func rsaKey(r *utils.Rand, bits int) (*rsa.PrivateKey, error) {
+	e := big.NewInt(65537)
+	one := big.NewInt(1)
+	for {
+		p, q := prime(r, bits/2), prime(r, bits/2)
+		if p.Cmp(q) == 0 {
+			continue
+		}
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(e, phi)
+		if d == nil {
+			continue
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: new(big.Int).Mul(p, q), E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		key.Precompute()
+		return key, key.Validate()
+	}
+}
+
+// prime returns a prime of bits bits, with its top two bits set so that
+// the product of two has twice as many, drawn from r.
+func prime(r *utils.Rand, bits int) *big.Int {
+	b := make([]byte, bits/8)
+	for {
+		r.Read(b)
+		b[0] |= 0xc0
+		b[len(b)-1] |= 1
+		if p := new(big.Int).SetBytes(b); p.ProbablyPrime(20) {
+			return p
+		}
+	}
+}
+
+// ecdsaKey returns a P-256 key with its scalar drawn from r.
+func ecdsaKey(r *utils.Rand) (*ecdsa.PrivateKey, error) {
+	d := make([]byte, 32)
+	for {
+		r.Read(d)
+		k, err := ecdh.P256().NewPrivateKey(d)
+		if err != nil {
+			continue // zero or past the order of the curve
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, err
+		}
+		return key.(*ecdsa.PrivateKey), nil
+	}
+}
+
+// keyPEM returns key as a PKCS #8 PEM block.
+func keyPEM(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// caTemplate returns the certificate of the CA that issues certificates
+// that do not sign themselves.
+func caTemplate(o certOptions, key crypto.Signer) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: caName, Organization: []string{"genfile"}},
+		NotBefore:             o.notBefore,
+		NotAfter:              o.notBefore.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		PublicKey:             key.Public(),
+	}
+}
+
+// certificate is a certificate to create, with the key it certifies and
+// the issuer that signs it: itself if issuer is nil.
+type certificate struct {
+	o         certOptions
+	key       crypto.Signer
+	issuer    *x509.Certificate
+	issuerKey crypto.Signer
+}
+
+// create returns a DER certificate with a serial number of serialBytes
+// bytes and, if comment is positive, a comment extension of that many
+// characters.
+func (c certificate) create(serialBytes, comment int) ([]byte, error) {
+	serial := make([]byte, serialBytes)
+	c.o.rand.Read(serial)
+	// Keep the serial positive and its length as asked.
+	serial[0] = serial[0]&0x7f | 0x40
+	tmpl := &x509.Certificate{
+		SerialNumber:          new(big.Int).SetBytes(serial),
+		Subject:               pkix.Name{CommonName: c.o.cn, Organization: []string{"genfile"}},
+		NotBefore:             c.o.notBefore,
+		NotAfter:              c.o.notBefore.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	if _, ok := c.key.(*rsa.PrivateKey); ok {
+		tmpl.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	if ip := net.ParseIP(c.o.cn); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else if isHostname(c.o.cn) {
+		tmpl.DNSNames = []string{c.o.cn}
+	}
+	if comment > 0 {
+		text := strings.Repeat(commentText, comment/len(commentText)+1)[:comment]
+		value, err := asn1.MarshalWithParams(text, "ia5")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode comment: %w", err)
+		}
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: oidNetscapeComment, Value: value}}
+	}
+	parent := c.issuer
+	if parent == nil {
+		parent = tmpl
+	}
+	// With no random source, ECDSA signs deterministically (RFC 6979), as
+	// Ed25519 and RSA PKCS #1 v1.5 always do.
+	der, err := x509.CreateCertificate(nil, tmpl, parent, c.key.Public(), c.issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	return der, nil
+}
+
+// fit returns a DER certificate of exactly size bytes. The comment
+// extension makes up most of the size; as DER lengths grow a byte at a
+// time and ECDSA signatures vary in length, the serial number's length
+// and the signatures that change with it settle the rest.
+func (c certificate) fit(size int64) ([]byte, error) {
+	base, err := c.create(serialLen, 0)
+	if err != nil {
+		return nil, err
+	}
+	// The extension takes 17 bytes besides its comment, and the serial
+	// number can give back 8 of them.
+	ext := len(base) + 18
+	serial, comment := serialLen, max(1, int(size)-ext+1)
+	if int(size) < ext-(serialLen-8) {
+		// Short of the extension, only the serial number's length is
+		// left to adjust.
+		serial, comment = serialLen+int(size)-len(base), 0
+	}
+	for range 64 {
+		if serial < 8 || serial > 20 {
+			break
+		}
+		der, err := c.create(serial, comment)
+		if err != nil {
+			return nil, err
+		}
+		diff := int(size) - len(der)
+		if diff == 0 {
+			return der, nil
+		}
+		// Large steps go to the comment; a byte or two, where a length
+		// field may have just grown, to the serial number, as do all of
+		// them once the comment is down to its shortest.
+		if d := serial + diff; d >= 8 && d <= 20 && (comment <= 1 || diff > -3 && diff < 3) {
+			serial = d
+		} else if comment > 0 && comment+diff >= 1 {
+			comment += diff
+		} else {
+			break
+		}
+	}
+	return nil, fmt.Errorf("target %d does not fit a DER certificate; use at least about %d bytes", size, ext-(serialLen-8))
+}
+
+// isHostname reports whether s can be a DNS name in a certificate.
+func isHostname(s string) bool {
+	for _, label := range strings.Split(strings.TrimPrefix(s, "*."), ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// writeComments writes n bytes of comment lines, which PEM readers skip
+// as text outside the encapsulation boundaries.
+func writeComments(w io.Writer, n int64) error {
+	line := []byte("# " + strings.Repeat("=", lineLen-3) + "\n")
+	for ; n >= lineLen; n -= lineLen {
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	// The last line is shorter; a single byte makes a blank line.
+	last := append(line[:n-1:n-1], '\n')
+	_, err := w.Write(last)
+	return err
+}
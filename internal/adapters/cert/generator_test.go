@@ -0,0 +1,124 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestCertGenerator_Generate(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		fileType   ports.FileType
+		size       int64
+		opts       ports.Options
+		blocks     []string // PEM block types, in order; nil for DER
+		selfSigned bool
+		errSub     string
+	}{
+		{name: "Bundle", fileType: ports.FileTypePEM, size: 4096, blocks: []string{"CERTIFICATE", "PRIVATE KEY"}, selfSigned: true},
+		{name: "Certificate", fileType: ports.FileTypeCRT, size: 1 << 20, opts: ports.Options{"cert-key": "ed25519", "mtime": mtime.Format(time.RFC3339)}, blocks: []string{"CERTIFICATE"}, selfSigned: true},
+		{name: "Key", fileType: ports.FileTypeKEY, size: 2000, opts: ports.Options{"cert-key": "rsa"}, blocks: []string{"PRIVATE KEY"}},
+		// A P-256 key takes 241 bytes, leaving no room for comments.
+		{name: "ExactKey", fileType: ports.FileTypeKEY, size: 241, blocks: []string{"PRIVATE KEY"}},
+		{name: "DER", fileType: ports.FileTypeDER, size: 5000, selfSigned: true},
+		{name: "DERIssued", fileType: ports.FileTypeDER, size: 700, opts: ports.Options{"cert-self-signed": "false", "cert-cn": "10.0.0.1"}},
+		{name: "TooSmall", fileType: ports.FileTypeCRT, size: 100, errSub: "too small"},
+		{name: "DERTooSmall", fileType: ports.FileTypeDER, size: 100, errSub: "does not fit"},
+		{name: "DERTooLarge", fileType: ports.FileTypeDER, size: maxDER + 1, errSub: "too large"},
+		{name: "BadKey", fileType: ports.FileTypePEM, size: 4096, opts: ports.Options{"cert-key": "dsa"}, errSub: "invalid certificate key"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			generator := &CertGenerator{fileType: tc.fileType}
+			path := filepath.Join(t.TempDir(), "fixture."+string(tc.fileType))
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+
+			certDER := data
+			if tc.blocks != nil {
+				certDER = nil
+				var types []string
+				for rest := data; ; {
+					var block *pem.Block
+					if block, rest = pem.Decode(rest); block == nil {
+						break
+					}
+					types = append(types, block.Type)
+					switch block.Type {
+					case "CERTIFICATE":
+						certDER = block.Bytes
+					case "PRIVATE KEY":
+						if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+							t.Errorf("ParsePKCS8PrivateKey() error = %v", err)
+						}
+					}
+				}
+				if strings.Join(types, ",") != strings.Join(tc.blocks, ",") {
+					t.Errorf("PEM blocks = %v, want %v", types, tc.blocks)
+				}
+				if certDER == nil {
+					return
+				}
+			}
+			cert, err := x509.ParseCertificate(certDER)
+			if err != nil {
+				t.Fatalf("ParseCertificate() error = %v", err)
+			}
+			// A self-signed certificate's signature checks with its own key.
+			if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); (err == nil) != tc.selfSigned {
+				t.Errorf("CheckSignature() error = %v, want self-signed %v", err, tc.selfSigned)
+			}
+			if tc.opts["mtime"] != "" && !cert.NotBefore.Equal(mtime) {
+				t.Errorf("NotBefore = %v, want %v", cert.NotBefore, mtime)
+			}
+			if tc.fileType == ports.FileTypeDER && !bytes.Contains(certDER, []byte(commentText)) {
+				t.Errorf("DER certificate has no comment extension")
+			}
+		})
+	}
+}
+
+func TestWriteComments(t *testing.T) {
+	for _, n := range []int64{0, 1, 2, lineLen - 1, lineLen, lineLen + 1, 1000} {
+		var buf bytes.Buffer
+		if err := writeComments(&buf, n); err != nil {
+			t.Fatal(err)
+		}
+		if int64(buf.Len()) != n {
+			t.Errorf("writeComments(%d) wrote %d bytes", n, buf.Len())
+		}
+		for _, line := range strings.SplitAfter(buf.String(), "\n") {
+			if line != "" && line != "\n" && !strings.HasPrefix(line, "#") {
+				t.Errorf("writeComments(%d) wrote a line that is not a comment: %q", n, line)
+			}
+		}
+		if n > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			t.Errorf("writeComments(%d) does not end in a newline", n)
+		}
+	}
+}
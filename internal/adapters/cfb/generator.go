@@ -0,0 +1,194 @@
+package cfb
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeCFB, New())
+}
+
+// CfbGenerator writes generic compound files: a Genfile storage holding a
+// short Readme stream, which lives in the mini stream, and Payload streams
+// of random data that make up the size.
+type CfbGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &CfbGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *CfbGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *CfbGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// SizeStep returns the sector size of the configured version: 512 bytes
+// for version 3 and 4096 for version 4.
+func (g *CfbGenerator) SizeStep() int64 {
+	if o, err := parseOptions(g.opts); err == nil && o.version == 4 {
+		return 4096
+	}
+	return 512
+}
+
+const (
+	readmeLen = 1000
+	// payloadChunk is the most each Payload stream holds, well within the
+	// 2 GiB a version 3 file allows a stream.
+	payloadChunk = 1 << 30
+)
+
+// cfbOptions holds the settings the CFB generator reads from
+// ports.Options.
+type cfbOptions struct {
+	version int
+	modTime time.Time
+	filler  utils.Filler // of the Payload streams
+	rand    *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (cfbOptions, error) {
+	var o cfbOptions
+	var err error
+	if o.version, err = opts.Int("cfb-version", 3); err != nil {
+		return o, err
+	}
+	if o.version != 3 && o.version != 4 {
+		return o, fmt.Errorf("cfb-version must be 3 or 4, got %d", o.version)
+	}
+	if o.modTime, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.modTime.IsZero() {
+		o.modTime = time.Now()
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	if o.filler, err = utils.ParseFiller(o.rand, opts.String("entropy", ""), opts.String("shared-blocks", ""), opts.String("shared-pool", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *CfbGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+func (g *CfbGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := g.GenerateTo(f, size, opts); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// GenerateTo writes a compound file of exactly size bytes to w, a
+// multiple of the sector size: 512 bytes for "cfb-version" 3 (the
+// default) and 4096 for 4. The Payload streams take every sector the rest
+// leave, up to 1 GiB each; sectors too few for a regular stream are left
+// free. The "mtime" option dates the storages; "entropy" sets the share of
+// the streams that is random, the rest repeating a pattern.
+// "shared-blocks" draws a share of them from the chunks of the pool seeded
+// by "shared-pool", which other files of the pool share.
+func (g *CfbGenerator) GenerateTo(w io.Writer, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	readme := []byte(fmt.Sprintf("%-*s", readmeLen, "Test fixture generated by genfile. "+utils.Lorem.Paragraph(o.rand, 6, 8))[:readmeLen])
+
+	// Each Payload stream costs a directory entry, so the number of them
+	// is settled before their sizes.
+	var cw *Writer
+	var free int64
+	for n := 1; ; n++ {
+		if cw, err = newFile(o, readme, make([]int64, n)); err != nil {
+			return err
+		}
+		if size > cw.MaxSize() {
+			return fmt.Errorf("target %d too large for a compound file; the limit is %d bytes", size, cw.MaxSize())
+		}
+		if free = cw.FreeSectors(size); free < 0 {
+			return fmt.Errorf("target %d too small for a compound file; need at least %d bytes", size, cw.MinSize())
+		}
+		chunk := payloadChunk / cw.SectorSize()
+		if (free+chunk-1)/chunk <= int64(n) {
+			break
+		}
+	}
+	var sizes []int64
+	for rest := free * cw.SectorSize(); rest > 0; rest -= payloadChunk {
+		sizes = append(sizes, min(rest, payloadChunk))
+	}
+	// A remainder too small for a regular stream would move to the mini
+	// stream and outgrow its sectors there; it is left free instead.
+	if len(sizes) > 0 && sizes[len(sizes)-1] < miniStreamCutoff {
+		sizes[len(sizes)-1] = 0
+	}
+	if len(sizes) == 0 {
+		sizes = []int64{0}
+	}
+	if cw, err = newFile(o, readme, sizes); err != nil {
+		return err
+	}
+	return cw.Encode(w, size)
+}
+
+// newFile returns a compound file holding the Genfile storage with its
+// Readme, and a Payload stream of filler of each of payloads' sizes.
+func newFile(o cfbOptions, readme []byte, payloads []int64) (*Writer, error) {
+	w, err := NewWriter(o.version, o.modTime)
+	if err != nil {
+		return nil, err
+	}
+	st, err := w.Root().AddStorage("Genfile")
+	if err != nil {
+		return nil, err
+	}
+	if err := st.AddStream("Readme", readme); err != nil {
+		return nil, err
+	}
+	for i, n := range payloads {
+		write := func(w io.Writer) error {
+			return o.filler.Write(o.rand, w, n)
+		}
+		if err := w.Root().AddStreamFunc(fmt.Sprintf("Payload%d", i+1), n, write); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,95 @@
+package cfb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/richardlehane/mscfb"
+)
+
+func TestCfbGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name     string
+		size     int64
+		opts     ports.Options
+		payloads int64 // bytes in the Payload streams
+		errSub   string
+	}{
+		{name: "Smallest", size: 3072, payloads: 0},
+		{name: "MiB", size: 1 << 20, payloads: 1<<20 - 21*512}, // 16 FAT sectors
+		{name: "Remainder", size: 6144, payloads: 0},           // 3 KB free
+		{name: "Version4", size: 1 << 20, opts: ports.Options{"cfb-version": "4"}, payloads: 1<<20 - 5*4096},
+		{name: "MTime", size: 8192, opts: ports.Options{"mtime": "2020-03-04T05:06:07Z"}, payloads: 8192 - 3072},
+		{name: "TooSmall", size: 2560, errSub: "too small"},
+		{name: "TooLarge", size: 1 << 42, errSub: "too large"},
+		{name: "NotSectors", size: 5000, errSub: "multiple of the 512-byte sector size"},
+		{name: "BadVersion", size: 4096, opts: ports.Options{"cfb-version": "2"}, errSub: "cfb-version must be 3 or 4"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "container.cfb")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			entries := readFile(t, data)
+			if len(entries["Genfile/Readme"]) != readmeLen {
+				t.Errorf("Readme holds %d bytes, want %d", len(entries["Genfile/Readme"]), readmeLen)
+			}
+			var payloads int64
+			for path, content := range entries {
+				if strings.HasPrefix(path, "Payload") {
+					payloads += int64(len(content))
+				}
+			}
+			if payloads != tc.payloads {
+				t.Errorf("payload streams hold %d bytes, want %d", payloads, tc.payloads)
+			}
+
+			if tc.opts.Has("mtime") {
+				r, _ := mscfb.New(bytes.NewReader(data))
+				for f, err := r.Next(); err == nil; f, err = r.Next() {
+					if f.Name == "Genfile" && !f.Modified().Equal(time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)) {
+						t.Errorf("Genfile storage modified %v", f.Modified())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCfbGenerator_Sizes(t *testing.T) {
+	// Every whole number of sectors from the smallest file up reaches its
+	// target, the FAT growing with it.
+	generator := New().(ports.StreamGenerator)
+	for size := int64(3072); size <= 200*512; size += 512 {
+		var buf bytes.Buffer
+		if err := generator.GenerateTo(&buf, size, nil); err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if int64(buf.Len()) != size {
+			t.Fatalf("%d bytes came out as %d", size, buf.Len())
+		}
+		readFile(t, buf.Bytes())
+	}
+}
@@ -0,0 +1,555 @@
+// Package cfb writes Compound File Binary files, the OLE2 container of
+// legacy Office documents, Outlook messages and Windows installers: a
+// small FAT file system of storages and streams within one file, as
+// [MS-CFB] describes it.
+package cfb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+const (
+	dirEntrySize     = 128
+	miniSectorSize   = 64
+	miniStreamCutoff = 4096
+	// headerDIFAT is the number of FAT sector locations the header holds;
+	// DIFAT sectors hold the rest.
+	headerDIFAT = 109
+	// maxNameLen is the longest entry name, in UTF-16 code units.
+	maxNameLen = 31
+	// maxStreamV3 is the largest stream a version 3 file may hold.
+	maxStreamV3 = 0x80000000
+
+	// maxRegSect is the highest number of a sector; the ones above it
+	// are special.
+	maxRegSect = 0xfffffffa
+
+	// Special sector numbers.
+	difSect    = 0xfffffffc
+	fatSect    = 0xfffffffd
+	endOfChain = 0xfffffffe
+	freeSect   = 0xffffffff
+	noStream   = 0xffffffff
+
+	// Directory entry object types.
+	typeStorage = 1
+	typeStream  = 2
+	typeRoot    = 5
+	colorBlack  = 1
+)
+
+var signature = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+// Writer lays out and writes a compound file. Storages and streams are
+// added under the root storage; Encode then writes the file at a given
+// size, leaving the sectors its entries do not need free.
+type Writer struct {
+	version    int
+	sectorSize int64
+	modified   time.Time
+	root       *entry
+}
+
+// NewWriter returns a Writer of a version 3 file, with 512-byte sectors,
+// or a version 4 file, with 4096-byte sectors and streams past 2 GiB.
+// Storages are dated modified, unless it is zero.
+func NewWriter(version int, modified time.Time) (*Writer, error) {
+	w := &Writer{version: version, modified: modified, root: &entry{name: "Root Entry", kind: typeRoot}}
+	switch version {
+	case 3:
+		w.sectorSize = 512
+	case 4:
+		w.sectorSize = 4096
+	default:
+		return nil, fmt.Errorf("unsupported compound file version %d (want 3 or 4)", version)
+	}
+	return w, nil
+}
+
+// SectorSize returns the size of the file's sectors, of which its size is
+// a multiple.
+func (w *Writer) SectorSize() int64 {
+	return w.sectorSize
+}
+
+// Root returns the root storage.
+func (w *Writer) Root() *Storage {
+	return &Storage{w: w, e: w.root}
+}
+
+// entry is a storage or stream and, once laid out, its directory entry.
+type entry struct {
+	name     string
+	kind     byte
+	clsid    [16]byte
+	size     int64
+	write    func(io.Writer) error
+	children []*entry
+
+	// Set by layout.
+	id                 uint32
+	start              uint32
+	left, right, child uint32
+}
+
+// Storage is a storage of a compound file, holding streams and other
+// storages.
+type Storage struct {
+	w *Writer
+	e *entry
+}
+
+// SetCLSID sets the class ID of the storage, which names the application
+// its contents belong to.
+func (s *Storage) SetCLSID(clsid [16]byte) {
+	s.e.clsid = clsid
+}
+
+// AddStorage adds a storage named name to s and returns it.
+func (s *Storage) AddStorage(name string) (*Storage, error) {
+	e := &entry{name: name, kind: typeStorage}
+	if err := s.add(e); err != nil {
+		return nil, err
+	}
+	return &Storage{w: s.w, e: e}, nil
+}
+
+// AddStream adds a stream named name holding data to s.
+func (s *Storage) AddStream(name string, data []byte) error {
+	return s.AddStreamFunc(name, int64(len(data)), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// AddStreamFunc adds a stream named name of size bytes to s, which write
+// writes when the file is written. write must write exactly size bytes.
+func (s *Storage) AddStreamFunc(name string, size int64, write func(io.Writer) error) error {
+	if size < 0 || (s.w.version == 3 && size > maxStreamV3) {
+		return fmt.Errorf("stream %s of %d bytes does not fit in a version %d compound file", name, size, s.w.version)
+	}
+	return s.add(&entry{name: name, kind: typeStream, size: size, write: write})
+}
+
+func (s *Storage) add(e *entry) error {
+	n := len(utf16.Encode([]rune(e.name)))
+	if n == 0 || n > maxNameLen || strings.ContainsAny(e.name, `/\:!`) {
+		return fmt.Errorf("invalid compound file entry name %q: use 1 to %d characters other than / \\ : and !", e.name, maxNameLen)
+	}
+	for _, c := range s.e.children {
+		if strings.EqualFold(c.name, e.name) {
+			return fmt.Errorf("storage %s already holds an entry named %q", s.e.name, c.name)
+		}
+	}
+	s.e.children = append(s.e.children, e)
+	return nil
+}
+
+// MinSize returns the size of the smallest file that holds the entries
+// added so far.
+func (w *Writer) MinSize() int64 {
+	l := w.layout(0)
+	sectors := l.base
+	for {
+		fat, difat := w.fatSectors(sectors)
+		need := l.base + fat + difat
+		if need <= sectors {
+			return (sectors + 1) * w.sectorSize
+		}
+		sectors = need
+	}
+}
+
+// MaxSize returns the size of the largest file: the header and a sector
+// for each sector number.
+func (w *Writer) MaxSize() int64 {
+	return (maxRegSect + 2) * w.sectorSize
+}
+
+// FreeSectors returns the number of sectors the entries added so far
+// leave free in a file of size bytes, or a negative number if they do not
+// fit in it.
+func (w *Writer) FreeSectors(size int64) int64 {
+	sectors := size/w.sectorSize - 1
+	l := w.layout(sectors)
+	return sectors - (l.difatStart + l.difatLen)
+}
+
+// layout places a file's entries in its sectors: the regular streams,
+// each in a run of its own, then the mini stream holding the streams
+// smaller than the cutoff, the directory, the mini FAT, the FAT and the
+// DIFAT. The sectors after those are free.
+type layout struct {
+	entries []*entry // in directory order
+	// base is the number of sectors before the FAT.
+	base                                   int64
+	miniSectors                            int64 // in the mini stream
+	miniStart, dirStart, miniFATStart      int64
+	miniStreamLen, dirLen, miniFATLen      int64 // in sectors
+	fatStart, fatLen, difatStart, difatLen int64
+	sectors                                int64 // in the file, after the header
+}
+
+// fatSectors returns the number of FAT and DIFAT sectors that map a file
+// of n sectors after its header.
+func (w *Writer) fatSectors(n int64) (fat, difat int64) {
+	perSector := w.sectorSize / 4
+	fat = (n + perSector - 1) / perSector
+	if fat > headerDIFAT {
+		difat = (fat - headerDIFAT + perSector - 2) / (perSector - 1)
+	}
+	return fat, difat
+}
+
+// layout lays out a file of sectors sectors after its header, numbering
+// the directory entries and building the red-black trees of each
+// storage's children. Every node is black, as [MS-CFB] allows, in a
+// balanced tree.
+func (w *Writer) layout(sectors int64) *layout {
+	l := &layout{sectors: sectors}
+	var walk func(e *entry)
+	walk = func(e *entry) {
+		e.id = uint32(len(l.entries))
+		l.entries = append(l.entries, e)
+		for _, c := range e.children {
+			walk(c)
+		}
+	}
+	walk(w.root)
+	for _, e := range l.entries {
+		e.left, e.right, e.child = noStream, noStream, noStream
+	}
+
+	var next int64 // the next free sector
+	for _, e := range l.entries {
+		switch {
+		case e.kind != typeStream:
+			children := slices.Clone(e.children)
+			slices.SortFunc(children, compareNames)
+			e.child = tree(children)
+		case e.size == 0:
+			e.start = endOfChain
+		case e.size < miniStreamCutoff:
+			e.start = uint32(l.miniSectors)
+			l.miniSectors += (e.size + miniSectorSize - 1) / miniSectorSize
+		default:
+			e.start = uint32(next)
+			next += (e.size + w.sectorSize - 1) / w.sectorSize
+		}
+	}
+
+	l.miniStart = next
+	l.miniStreamLen = (l.miniSectors*miniSectorSize + w.sectorSize - 1) / w.sectorSize
+	w.root.start, w.root.size = endOfChain, l.miniSectors*miniSectorSize
+	if l.miniStreamLen > 0 {
+		w.root.start = uint32(l.miniStart)
+	}
+	l.dirStart = l.miniStart + l.miniStreamLen
+	l.dirLen = (int64(len(l.entries))*dirEntrySize + w.sectorSize - 1) / w.sectorSize
+	l.miniFATStart = l.dirStart + l.dirLen
+	l.miniFATLen = (l.miniSectors*4 + w.sectorSize - 1) / w.sectorSize
+	l.base = l.miniFATStart + l.miniFATLen
+	l.fatStart = l.base
+	l.fatLen, l.difatLen = w.fatSectors(sectors)
+	l.difatStart = l.fatStart + l.fatLen
+	return l
+}
+
+// compareNames orders entries as [MS-CFB] orders siblings: shorter names
+// first, then by their upper case.
+func compareNames(a, b *entry) int {
+	na, nb := utf16.Encode([]rune(strings.ToUpper(a.name))), utf16.Encode([]rune(strings.ToUpper(b.name)))
+	if len(na) != len(nb) {
+		return len(na) - len(nb)
+	}
+	return slices.Compare(na, nb)
+}
+
+// tree links sorted into a balanced binary search tree and returns the ID
+// of its root, or noStream if it is empty.
+func tree(sorted []*entry) uint32 {
+	if len(sorted) == 0 {
+		return noStream
+	}
+	mid := len(sorted) / 2
+	root := sorted[mid]
+	root.left = tree(sorted[:mid])
+	root.right = tree(sorted[mid+1:])
+	return root.id
+}
+
+// Encode writes the file to out at exactly size bytes, a multiple of the
+// sector size at least MinSize.
+func (w *Writer) Encode(out io.Writer, size int64) error {
+	if size%w.sectorSize != 0 {
+		return fmt.Errorf("compound file size must be a multiple of the %d-byte sector size, got %d", w.sectorSize, size)
+	}
+	if minSize := w.MinSize(); size < minSize {
+		return fmt.Errorf("target %d too small for the compound file; need at least %d bytes", size, minSize)
+	}
+	l := w.layout(size/w.sectorSize - 1)
+
+	bw := bufio.NewWriterSize(out, 1<<20)
+	if _, err := bw.Write(w.header(l)); err != nil {
+		return fmt.Errorf("failed to write compound file header: %w", err)
+	}
+	// Regular streams, then the mini stream.
+	for _, e := range l.entries {
+		if e.kind == typeStream && e.size >= miniStreamCutoff {
+			if err := writeStream(bw, e, w.sectorSize); err != nil {
+				return err
+			}
+		}
+	}
+	var mini int64
+	for _, e := range l.entries {
+		if e.kind == typeStream && e.size > 0 && e.size < miniStreamCutoff {
+			if err := writeStream(bw, e, miniSectorSize); err != nil {
+				return err
+			}
+			mini += (e.size + miniSectorSize - 1) / miniSectorSize * miniSectorSize
+		}
+	}
+	if err := writeZeros(bw, l.miniStreamLen*w.sectorSize-mini); err != nil {
+		return err
+	}
+
+	// The directory, padded with unused entries.
+	for i := int64(0); i < l.dirLen*w.sectorSize/dirEntrySize; i++ {
+		var e *entry
+		if i < int64(len(l.entries)) {
+			e = l.entries[i]
+		}
+		if _, err := bw.Write(w.dirEntry(e)); err != nil {
+			return fmt.Errorf("failed to write compound file directory: %w", err)
+		}
+	}
+
+	// The mini FAT chains the mini sectors of each small stream.
+	var chains []run
+	for _, e := range l.entries {
+		if e.kind == typeStream && e.size > 0 && e.size < miniStreamCutoff {
+			chains = append(chains, run{int64(e.start), (e.size + miniSectorSize - 1) / miniSectorSize, 0})
+		}
+	}
+	if err := writeTable(bw, chains, l.miniFATLen*w.sectorSize/4); err != nil {
+		return err
+	}
+
+	// The FAT chains the regular streams and the file's own structures.
+	chains = chains[:0]
+	for _, e := range l.entries {
+		if e.kind == typeStream && e.size >= miniStreamCutoff {
+			chains = append(chains, run{int64(e.start), (e.size + w.sectorSize - 1) / w.sectorSize, 0})
+		}
+	}
+	chains = append(chains,
+		run{l.miniStart, l.miniStreamLen, 0},
+		run{l.dirStart, l.dirLen, 0},
+		run{l.miniFATStart, l.miniFATLen, 0},
+		run{l.fatStart, l.fatLen, fatSect},
+		run{l.difatStart, l.difatLen, difSect},
+	)
+	if err := writeTable(bw, chains, l.fatLen*w.sectorSize/4); err != nil {
+		return err
+	}
+
+	// DIFAT sectors list the FAT sectors the header has no room for, each
+	// ending with the location of the next.
+	perSector := w.sectorSize/4 - 1
+	for i := int64(0); i < l.difatLen; i++ {
+		sector := make([]byte, w.sectorSize)
+		for j := int64(0); j < perSector; j++ {
+			loc := uint32(freeSect)
+			if k := headerDIFAT + i*perSector + j; k < l.fatLen {
+				loc = uint32(l.fatStart + k)
+			}
+			binary.LittleEndian.PutUint32(sector[4*j:], loc)
+		}
+		next := uint32(endOfChain)
+		if i+1 < l.difatLen {
+			next = uint32(l.difatStart + i + 1)
+		}
+		binary.LittleEndian.PutUint32(sector[4*perSector:], next)
+		if _, err := bw.Write(sector); err != nil {
+			return fmt.Errorf("failed to write compound file DIFAT: %w", err)
+		}
+	}
+
+	// Free sectors make up the size.
+	free := l.sectors - (l.difatStart + l.difatLen)
+	if err := writeZeros(bw, free*w.sectorSize); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write compound file: %w", err)
+	}
+	return nil
+}
+
+// header returns the file header, padded to a sector.
+func (w *Writer) header(l *layout) []byte {
+	h := make([]byte, w.sectorSize)
+	copy(h, signature)
+	le := binary.LittleEndian
+	le.PutUint16(h[24:], 0x003e) // minor version
+	le.PutUint16(h[26:], uint16(w.version))
+	le.PutUint16(h[28:], 0xfffe) // little-endian byte order mark
+	shift := uint16(9)
+	if w.version == 4 {
+		shift = 12
+		// Version 3 files leave the directory sector count zero.
+		le.PutUint32(h[40:], uint32(l.dirLen))
+	}
+	le.PutUint16(h[30:], shift)
+	le.PutUint16(h[32:], 6) // 64-byte mini sectors
+	le.PutUint32(h[44:], uint32(l.fatLen))
+	le.PutUint32(h[48:], uint32(l.dirStart))
+	le.PutUint32(h[56:], miniStreamCutoff)
+	miniFAT := uint32(endOfChain)
+	if l.miniFATLen > 0 {
+		miniFAT = uint32(l.miniFATStart)
+	}
+	le.PutUint32(h[60:], miniFAT)
+	le.PutUint32(h[64:], uint32(l.miniFATLen))
+	difat := uint32(endOfChain)
+	if l.difatLen > 0 {
+		difat = uint32(l.difatStart)
+	}
+	le.PutUint32(h[68:], difat)
+	le.PutUint32(h[72:], uint32(l.difatLen))
+	for i := int64(0); i < headerDIFAT; i++ {
+		loc := uint32(freeSect)
+		if i < l.fatLen {
+			loc = uint32(l.fatStart + i)
+		}
+		le.PutUint32(h[76+4*i:], loc)
+	}
+	return h
+}
+
+// dirEntry returns the directory entry of e, or an unused entry if e is
+// nil.
+func (w *Writer) dirEntry(e *entry) []byte {
+	d := make([]byte, dirEntrySize)
+	le := binary.LittleEndian
+	if e == nil {
+		le.PutUint32(d[68:], noStream)
+		le.PutUint32(d[72:], noStream)
+		le.PutUint32(d[76:], noStream)
+		return d
+	}
+	name := utf16.Encode([]rune(e.name))
+	for i, u := range name {
+		le.PutUint16(d[2*i:], u)
+	}
+	le.PutUint16(d[64:], uint16(2*len(name)+2)) // with the terminating NUL
+	d[66], d[67] = e.kind, colorBlack
+	le.PutUint32(d[68:], e.left)
+	le.PutUint32(d[72:], e.right)
+	le.PutUint32(d[76:], e.child)
+	copy(d[80:96], e.clsid[:])
+	// Storages are dated; the root has no creation time, and streams none
+	// at all.
+	if e.kind != typeStream && !w.modified.IsZero() {
+		ft := filetime(w.modified)
+		if e.kind == typeStorage {
+			le.PutUint64(d[100:], ft)
+		}
+		le.PutUint64(d[108:], ft)
+	}
+	le.PutUint32(d[116:], e.start)
+	le.PutUint64(d[120:], uint64(e.size))
+	return d
+}
+
+// filetime returns t as a Windows FILETIME: 100-nanosecond intervals since
+// 1601.
+func filetime(t time.Time) uint64 {
+	const epochDiff = 116444736000000000 // 1601 to 1970
+	return uint64(t.UnixNano()/100 + epochDiff)
+}
+
+// run is a run of consecutive sectors: a chain, each sector pointing to
+// the next, or sectors all marked mark.
+type run struct {
+	start, n int64
+	mark     uint32 // zero for a chain
+}
+
+// writeTable writes a FAT or mini FAT of entries entries mapping runs,
+// which are in order, with the rest free.
+func writeTable(w *bufio.Writer, runs []run, entries int64) error {
+	var buf [4]byte
+	put := func(v uint32) error {
+		binary.LittleEndian.PutUint32(buf[:], v)
+		_, err := w.Write(buf[:])
+		return err
+	}
+	var i int64
+	for _, r := range runs {
+		for ; i < r.start; i++ {
+			if err := put(freeSect); err != nil {
+				return fmt.Errorf("failed to write compound file FAT: %w", err)
+			}
+		}
+		for j := int64(0); j < r.n; j, i = j+1, i+1 {
+			v := r.mark
+			if v == 0 {
+				v = uint32(i + 1)
+				if j == r.n-1 {
+					v = endOfChain
+				}
+			}
+			if err := put(v); err != nil {
+				return fmt.Errorf("failed to write compound file FAT: %w", err)
+			}
+		}
+	}
+	for ; i < entries; i++ {
+		if err := put(freeSect); err != nil {
+			return fmt.Errorf("failed to write compound file FAT: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeStream writes the data of stream e, padded to a multiple of unit.
+func writeStream(w io.Writer, e *entry, unit int64) error {
+	cw := &countingWriter{w: w}
+	if err := e.write(cw); err != nil {
+		return fmt.Errorf("failed to write stream %s: %w", e.name, err)
+	}
+	if cw.n != e.size {
+		return fmt.Errorf("stream %s wrote %d bytes, want %d", e.name, cw.n, e.size)
+	}
+	return writeZeros(w, (unit-e.size%unit)%unit)
+}
+
+func writeZeros(w io.Writer, n int64) error {
+	if err := utils.WriteZeros(w, n); err != nil {
+		return fmt.Errorf("failed to write compound file: %w", err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,149 @@
+package cfb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/richardlehane/mscfb"
+)
+
+func TestWriter_Encode(t *testing.T) {
+	testCases := []struct {
+		name    string
+		version int
+		size    int64
+		streams []int64 // sizes of the streams in the Data storage
+	}{
+		{name: "NoData", version: 3, size: 8192},
+		{name: "MiniStreams", version: 3, size: 64 * 1024, streams: []int64{0, 1, 63, 64, 65, 1000, 4095}},
+		{name: "RegularStreams", version: 3, size: 1 << 20, streams: []int64{4096, 4097, 100000, 12}},
+		// Past 109 FAT sectors, the rest are listed in DIFAT sectors.
+		{name: "DIFAT", version: 3, size: 16 << 20, streams: []int64{9 << 20, 300}},
+		{name: "Version4", version: 4, size: 1 << 20, streams: []int64{10, 5000, 200000}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			modified := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+			w, err := NewWriter(tc.version, modified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := w.Root().AddStorage("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string][]byte{}
+			for i, n := range tc.streams {
+				name := fmt.Sprintf("Stream%d", i)
+				content := bytes.Repeat([]byte{byte('a' + i)}, int(n))
+				if err := data.AddStream(name, content); err != nil {
+					t.Fatal(err)
+				}
+				want["Data/"+name] = content
+			}
+			// Enough siblings for a tree several levels deep.
+			for i := 0; i < 20; i++ {
+				name := strings.Repeat("x", i%5+1) + fmt.Sprint(i)
+				if err := w.Root().AddStream(name, []byte(name)); err != nil {
+					t.Fatal(err)
+				}
+				want[name] = []byte(name)
+			}
+
+			var buf bytes.Buffer
+			if err := w.Encode(&buf, tc.size); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if int64(buf.Len()) != tc.size {
+				t.Fatalf("size = %d, want %d", buf.Len(), tc.size)
+			}
+			got := readFile(t, buf.Bytes())
+			for path, content := range want {
+				if !bytes.Equal(got[path], content) {
+					t.Errorf("stream %s holds %d bytes, want %d", path, len(got[path]), len(content))
+				}
+				delete(got, path)
+			}
+			for path := range got {
+				if path != "Data" {
+					t.Errorf("unexpected entry %s", path)
+				}
+			}
+		})
+	}
+}
+
+// readFile reads the compound file data with mscfb and returns the
+// contents of its streams by path, and its storages as nil.
+func readFile(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	r, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("mscfb.New() error = %v", err)
+	}
+	entries := map[string][]byte{}
+	for f, err := r.Next(); err != io.EOF; f, err = r.Next() {
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		path := strings.Join(append(f.Path, f.Name), "/")
+		if f.FileInfo().IsDir() {
+			entries[path] = nil
+			continue
+		}
+		content, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatalf("reading %s: %v", path, err)
+		}
+		if int64(len(content)) != f.Size {
+			t.Fatalf("stream %s read %d bytes of %d", path, len(content), f.Size)
+		}
+		entries[path] = content
+	}
+	return entries
+}
+
+func TestWriter_Errors(t *testing.T) {
+	if _, err := NewWriter(5, time.Time{}); err == nil || !strings.Contains(err.Error(), "version 5") {
+		t.Errorf("NewWriter(5) error = %v", err)
+	}
+
+	w, _ := NewWriter(3, time.Time{})
+	for _, name := range []string{"", "a/b", "bang!", strings.Repeat("n", 32)} {
+		if err := w.Root().AddStream(name, nil); err == nil {
+			t.Errorf("AddStream(%q) succeeded", name)
+		}
+	}
+	if err := w.Root().AddStream("Same", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Root().AddStorage("SAME"); err == nil || !strings.Contains(err.Error(), "already holds") {
+		t.Errorf("AddStorage() of a duplicate name error = %v", err)
+	}
+	if err := w.Root().AddStreamFunc("Huge", 1<<32, nil); err == nil {
+		t.Error("version 3 file took a 4 GiB stream")
+	}
+
+	if err := w.Encode(io.Discard, 1000); err == nil || !strings.Contains(err.Error(), "multiple of the 512-byte sector size") {
+		t.Errorf("Encode(1000) error = %v", err)
+	}
+	if err := w.Encode(io.Discard, 512); err == nil || !strings.Contains(err.Error(), "too small") {
+		t.Errorf("Encode(512) error = %v", err)
+	}
+	if err := w.Encode(io.Discard, w.MinSize()); err != nil {
+		t.Errorf("Encode(MinSize()) error = %v", err)
+	}
+
+	short, _ := NewWriter(3, time.Time{})
+	short.Root().AddStreamFunc("Short", 10, func(w io.Writer) error {
+		_, err := w.Write([]byte("abc"))
+		return err
+	})
+	if err := short.Encode(io.Discard, 4096); err == nil || !strings.Contains(err.Error(), "wrote 3 bytes, want 10") {
+		t.Errorf("Encode() of a short stream error = %v", err)
+	}
+}
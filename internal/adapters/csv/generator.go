@@ -3,12 +3,13 @@ package csv
 import (
 	"bufio" // Import bufio
 	"fmt"
-	"math/rand/v2"
-	"os"
+	"io"
 	"strings"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
 )
 
 // init registers the CSV generator with the factory.
@@ -26,45 +27,295 @@ const (
 	lineEnding    = "\n" // Use LF line endings for consistency
 )
 
-type CsvGenerator struct{}
+type CsvGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &CsvGenerator{}
 }
 
-// Generate creates a CSV file at the specified path with the exact target size using bufio.Writer.
-func (g *CsvGenerator) Generate(path string, targetSize int64) (err error) { // Use named return for deferred flush error handling
-	if targetSize < 0 { // Treat negative as zero
-		targetSize = 0
+// Configure returns a copy of the generator that applies opts to every
+// file it writes. If opts select the pii content profile, the copy writes
+// the ground-truth manifest of each file next to it.
+func (g *CsvGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	if o.pii > 0 {
+		return &piiGenerator{&c}, nil
 	}
+	return &c, nil
+}
 
-	f, err := os.Create(path)
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *CsvGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// Generate creates a CSV file at the specified path with the exact target size using bufio.Writer.
+func (g *CsvGenerator) Generate(path string, targetSize int64) error {
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions creates a CSV file whose cells are written in the
+// language of the "lang" option, or drawn from the "corpus" files, if
+// set. With "content" csv-injection
+// about half the cells hold formula-injection payloads, quoted where
+// RFC 4180 requires it; with "content" pii "pii-density" of the cells, 5%
+// if unset, hold synthetic personal data; with "content" csv-quoting the
+// file starts with a byte order mark and about half the cells are quoted
+// fields holding separators, escaped quotes or line breaks. "csv-columns" fixes the number
+// of columns, which otherwise varies from row to row. "embed-string" is
+// planted "embed-count" times, once if unset, as the first cell of rows
+// spread evenly through the file.
+func (g *CsvGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
 	if err != nil {
 		return fmt.Errorf("failed to create file %s: %w", path, err)
 	}
 	defer f.Close() // Ensure file is closed eventually
+	return g.GenerateTo(f, targetSize, opts)
+}
+
+// csvOptions holds the settings the CSV generator reads from ports.Options.
+type csvOptions struct {
+	text      func(r *utils.Rand, n int) string // plain cell content of n bytes
+	injection bool                              // mix formula-injection payloads into the cells
+	quoting   bool                              // mix quoted fields into the cells, after a byte order mark
+	columns   int                               // columns per row; 0 varies them row by row
+	needle    utils.Needle                      // planted as the first cell of rows of their own
+	pii       float64                           // share of cells that are personal data; 0 for none
+	rand      *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (csvOptions, error) {
+	o := csvOptions{text: generateRandomCsvSafeString}
+	var err error
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	if opts.Has("lang") || opts.Has("corpus") {
+		lang, err := utils.TextLanguage(opts.String("lang", ""), opts.String("corpus", ""))
+		if err != nil {
+			return o, err
+		}
+		o.text = lang.Text
+	}
+	switch content := strings.ToLower(opts.String("content", "")); content {
+	case "":
+	case utils.ContentCSVInjection:
+		o.injection = true
+	case ContentQuoting:
+		o.quoting = true
+	case utils.ContentPII:
+		if o.pii, err = utils.ParsePIIDensity(opts.String("pii-density", "")); err != nil {
+			return o, err
+		}
+	default:
+		return o, fmt.Errorf("unknown content profile %q (want %s, %s or %s)", content, utils.ContentCSVInjection, ContentQuoting, utils.ContentPII)
+	}
+	if o.columns, err = opts.Int("csv-columns", 0); err != nil {
+		return o, err
+	}
+	if o.columns < 0 {
+		return o, fmt.Errorf("csv-columns must be positive, got %d", o.columns)
+	}
+	if o.needle, err = utils.ParseNeedle(opts.String("embed-string", ""), opts.String("embed-count", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// needleRow returns the row o.needle is planted in: the string, quoted if
+// it must be, and empty cells up to a fixed column count.
+func (o csvOptions) needleRow() string {
+	return quoteField(o.needle.Text) + strings.Repeat(separator, max(o.columns-1, 0)) + lineEnding
+}
+
+// numColumns returns the number of columns of the next row.
+func (o csvOptions) numColumns() int {
+	if o.columns > 0 {
+		return o.columns
+	}
+	return o.rand.IntN(maxColumns-minColumns+1) + minColumns
+}
+
+// cell returns a field of about n bytes; payloads keep their own length.
+func (o csvOptions) cell(n int) string {
+	if o.injection && o.rand.IntN(2) == 0 {
+		return injectionFields[o.rand.IntN(len(injectionFields))]
+	}
+	if o.quoting && n >= 2 && o.rand.IntN(2) == 0 {
+		return quotedField(o.rand, o.text, n)
+	}
+	return o.text(o.rand, n)
+}
+
+// exactCell returns a field of exactly n bytes. A payload is used only if
+// it fits, padded with spaces inside its quotes.
+func (o csvOptions) exactCell(n int) string {
+	if o.injection && o.rand.IntN(2) == 0 {
+		var fits []string
+		for _, f := range injectionFields {
+			if len(f) <= n {
+				fits = append(fits, f)
+			}
+		}
+		if len(fits) > 0 {
+			f := fits[o.rand.IntN(len(fits))]
+			pad := strings.Repeat(" ", n-len(f))
+			if strings.HasPrefix(f, `"`) {
+				return f[:len(f)-1] + pad + `"`
+			}
+			return f + pad
+		}
+	}
+	if o.quoting && n >= 2 && o.rand.IntN(2) == 0 {
+		return quotedField(o.rand, o.text, n)
+	}
+	return o.text(o.rand, n)
+}
+
+// exactRow returns a row of o.columns fields and its line ending, n bytes
+// long in all; n must be at least o.columns.
+func (o csvOptions) exactRow(n int) string {
+	var b strings.Builder
+	content := n - o.columns
+	for i := 0; i < o.columns; i++ {
+		cellLen := content / o.columns
+		if i < content%o.columns {
+			cellLen++
+		}
+		b.WriteString(o.exactCell(cellLen))
+		if i < o.columns-1 {
+			b.WriteString(separator)
+		}
+	}
+	b.WriteString(lineEnding)
+	return b.String()
+}
+
+// injectionFields holds the injection payloads as CSV fields.
+var injectionFields = func() []string {
+	var fields []string
+	for _, p := range utils.InjectionPayloads() {
+		fields = append(fields, quoteField(p))
+	}
+	return fields
+}()
+
+// quoteField encloses s in double quotes, doubling the quotes inside it,
+// if it holds a separator, quote or line break.
+func quoteField(s string) string {
+	if !strings.ContainsAny(s, separator+"\"\r\n") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// GenerateTo writes targetSize bytes of CSV rows to w.
+func (g *CsvGenerator) GenerateTo(w io.Writer, targetSize int64, opts ports.Options) error {
+	_, err := g.generateTo(w, targetSize, opts)
+	return err
+}
+
+// generateTo writes the rows GenerateTo would to w, and returns the
+// personal data planted in them, with where.
+func (g *CsvGenerator) generateTo(w io.Writer, targetSize int64, opts ports.Options) (items []utils.PIIItem, err error) { // Use named return for deferred flush error handling
+	if targetSize < 0 { // Treat negative as zero
+		targetSize = 0
+	}
+	o, err := parseOptions(g.opts.With(opts))
+	if err != nil {
+		return nil, err
+	}
 
 	// Use bufio.Writer for efficient writing
-	bw := bufio.NewWriter(f)
+	bw := bufio.NewWriter(w)
 	defer func() { // Ensure final flush happens even on errors elsewhere
 		flushErr := bw.Flush()
-		// Report flush error only if no other error occurred during Generate
+		// Report flush error only if no other error occurred during GenerateTo
 		// and assign it to the named return variable 'err'.
 		if err == nil && flushErr != nil {
 			err = fmt.Errorf("failed to flush writer: %w", flushErr)
 		}
 	}()
 
-	var bytesWritten int64 = 0
-	var builder strings.Builder // Still use builder for efficient line construction
+	var bytesWritten, rows int64 = 0, 0
+	var builder strings.Builder  // Still use builder for efficient line construction
+	var rowItems []utils.PIIItem // personal data in the line being built, offsets from its start
+	// keep records the personal data of the line written at bytesWritten
+	// that lies within its first n bytes.
+	keep := func(n int64) {
+		for _, item := range rowItems {
+			if item.Offset+int64(len(item.Value)) <= n {
+				item.Offset += bytesWritten
+				item.Row = rows + 1
+				items = append(items, item)
+			}
+		}
+	}
+
+	// Rows holding the planted string are written once the file passes
+	// their share of it; their bytes are kept back from the other rows.
+	needleRow := o.needleRow()
+	planted := 0
+	reserved := int64(o.needle.Count * len(needleRow))
+	if reserved > targetSize {
+		return nil, fmt.Errorf("size %d too small to embed %q %d times (%d bytes)", targetSize, o.needle.Text, o.needle.Count, reserved)
+	}
+	// The byte order mark goes first, if there is room for it.
+	if prefix := o.prefix(); int64(len(prefix)) <= targetSize-reserved {
+		n, writeErr := bw.WriteString(prefix)
+		if writeErr != nil {
+			return nil, fmt.Errorf("failed to write byte order mark: %w", writeErr)
+		}
+		bytesWritten += int64(n)
+	}
+	plant := func() error {
+		n, writeErr := bw.WriteString(needleRow)
+		if writeErr != nil {
+			return fmt.Errorf("failed to write row: %w", writeErr)
+		}
+		bytesWritten += int64(n)
+		rows++
+		planted++
+		return nil
+	}
 
 	for bytesWritten < targetSize {
+		end := targetSize - int64((o.needle.Count-planted)*len(needleRow)) // where the other rows must stop
+		if planted < o.needle.Count && (bytesWritten >= o.needle.At(planted, targetSize) || bytesWritten == end) {
+			if err := plant(); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		builder.Reset()
+		rowItems = rowItems[:0]
 		// --- Generate one line ---
-		numCols := rand.IntN(maxColumns-minColumns+1) + minColumns
+		numCols := o.numColumns()
 		for i := 0; i < numCols; i++ {
-			cellLen := rand.IntN(maxCellLength-minCellLength+1) + minCellLength
-			cellContent := generateRandomCsvSafeString(cellLen)
+			cellLen := o.rand.IntN(maxCellLength-minCellLength+1) + minCellLength
+			cellContent := o.cell(cellLen)
+			if o.pii > 0 && o.rand.Float64() < o.pii {
+				item := utils.RandPII(o.rand)
+				item.Offset, item.Column = int64(builder.Len()), i+1
+				rowItems = append(rowItems, item)
+				cellContent = item.Value
+			}
 			builder.WriteString(cellContent)
 			if i < numCols-1 {
 				builder.WriteString(separator)
@@ -77,21 +328,51 @@ func (g *CsvGenerator) Generate(path string, targetSize int64) (err error) { //
 		lineBytes := []byte(line)
 		lineLen := int64(len(lineBytes))
 
+		// With a fixed column count, a rest too short for a row of its
+		// own goes into this one.
+		if rest := end - bytesWritten - lineLen; o.columns > 0 && rest > 0 && rest < int64(o.columns) {
+			line = o.exactRow(int(end - bytesWritten))
+			lineBytes = []byte(line)
+			lineLen = int64(len(lineBytes))
+			rowItems = rowItems[:0]
+		}
+
 		// --- Check if this line fits ---
-		if bytesWritten+lineLen <= targetSize {
+		if bytesWritten+lineLen <= end {
 			// Fits completely
+			keep(lineLen)
 			n, writeErr := bw.Write(lineBytes) // Write full line to buffer
 			if writeErr != nil {
-				return fmt.Errorf("failed to write full line: %w", writeErr)
+				return nil, fmt.Errorf("failed to write full line: %w", writeErr)
 			}
 			bytesWritten += int64(n)
+			rows++
 		} else {
-			// Does not fit completely, write partial line and stop
+			// Does not fit completely, write partial line and stop. The
+			// cut falls on a character boundary, padded with spaces.
+			// Cutting could leave a quoted field open, so with payloads
+			// or quoted fields the rest is a single field instead. With a fixed column
+			// count the rest is a full row of shorter cells, if it fits.
+			// Rows with the planted string still due go ahead of it.
+			for planted < o.needle.Count {
+				if err := plant(); err != nil {
+					return nil, err
+				}
+			}
 			bytesToWrite := targetSize - bytesWritten
 			if bytesToWrite > 0 {
-				n, writeErr := bw.Write(lineBytes[:bytesToWrite]) // Write partial line to buffer
+				partial := utils.FitUTF8(line, int(bytesToWrite))
+				switch {
+				case o.columns > 0 && bytesToWrite >= int64(o.columns):
+					partial = o.exactRow(int(bytesToWrite))
+				case o.injection || o.quoting:
+					partial = o.exactCell(int(bytesToWrite))
+				default:
+					keep(bytesToWrite)
+				}
+				n, writeErr := bw.WriteString(partial) // Write partial line to buffer
 				if writeErr != nil {
-					return fmt.Errorf("failed to write partial line: %w", writeErr)
+					return nil, fmt.Errorf("failed to write partial line: %w", writeErr)
 				}
 				bytesWritten += int64(n)
 			}
@@ -100,18 +381,96 @@ func (g *CsvGenerator) Generate(path string, targetSize int64) (err error) { //
 	} // End loop
 
 	// Final flush is handled by defer.
-	// The named return 'err' will be returned, potentially updated by the deferred flush.
-	return err
+	// The named returns will be returned, 'err' potentially updated by the deferred flush.
+	return items, err
 }
 
 // generateRandomCsvSafeString generates a random string suitable for a CSV cell.
 // Avoids commas, quotes, and newlines for simplicity.
-func generateRandomCsvSafeString(n int) string {
+func generateRandomCsvSafeString(r *utils.Rand, n int) string {
 	// Use a character set that excludes comma, double quote, CR, LF
 	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 "
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = letters[rand.IntN(len(letters))]
+		b[i] = letters[r.IntN(len(letters))]
 	}
 	return string(b)
 }
+
+// GenerateLines writes exactly lines rows, all with the same number of
+// columns. With a byte size as well, the size is spread evenly over the
+// rows and each row's cells share its length.
+func (g *CsvGenerator) GenerateLines(path string, targetSize, lines int64, opts ports.Options) (err error) {
+	o, err := parseOptions(g.opts.With(opts))
+	if err != nil {
+		return err
+	}
+	if o.needle.Count > 0 {
+		return fmt.Errorf("embed-string cannot be combined with a line count")
+	}
+	if o.pii > 0 {
+		return fmt.Errorf("content pii cannot be combined with a line count")
+	}
+	numCols := o.numColumns()
+	prefix := o.prefix()
+	if targetSize != ports.AnySize {
+		// The smallest row is a single empty cell and its line ending.
+		if need := lines + int64(len(prefix)); targetSize < need {
+			return fmt.Errorf("target %d too small for %d rows; need at least %d", targetSize, lines, need)
+		}
+		targetSize -= int64(len(prefix))
+		numCols = int(min(int64(numCols), targetSize/lines))
+	}
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	defer func() {
+		flushErr := bw.Flush()
+		if err == nil && flushErr != nil {
+			err = fmt.Errorf("failed to flush writer: %w", flushErr)
+		}
+	}()
+
+	if _, err := bw.WriteString(prefix); err != nil {
+		return fmt.Errorf("failed to write byte order mark: %w", err)
+	}
+	var builder strings.Builder
+	for row := int64(0); row < lines; row++ {
+		builder.Reset()
+		// Bytes left for cell content once separators and line ending are counted.
+		content := -1
+		if targetSize != ports.AnySize {
+			rowLen := targetSize / lines
+			if row < targetSize%lines {
+				rowLen++
+			}
+			content = int(rowLen) - numCols
+		}
+		for i := 0; i < numCols; i++ {
+			cellLen := o.rand.IntN(maxCellLength-minCellLength+1) + minCellLength
+			if content >= 0 {
+				cellLen = content / numCols
+				if i < content%numCols {
+					cellLen++
+				}
+			}
+			if content >= 0 {
+				builder.WriteString(o.exactCell(cellLen))
+			} else {
+				builder.WriteString(o.cell(cellLen))
+			}
+			if i < numCols-1 {
+				builder.WriteString(separator)
+			}
+		}
+		builder.WriteString(lineEnding)
+		if _, err := bw.WriteString(builder.String()); err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+	}
+	return nil
+}
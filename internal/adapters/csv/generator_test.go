@@ -2,13 +2,18 @@ package csv
 
 import (
 	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/hailam/genfile/internal/ports" //
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func TestCsvGenerator_Generate(t *testing.T) {
@@ -160,3 +165,385 @@ func checkFileSize(t *testing.T, path string, expectedSize int64) {
 		t.Errorf("Generated file %q size = %d, want %d", path, info.Size(), expectedSize)
 	}
 }
+
+func TestCsvGenerator_GenerateLines(t *testing.T) {
+	generator := &CsvGenerator{}
+	var _ ports.LineGenerator = generator
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name   string
+		size   int64
+		lines  int64
+		errSub string
+	}{
+		{"LinesOnly", ports.AnySize, 5000, ""},
+		{"OneRow", ports.AnySize, 1, ""},
+		{"LinesAndSize", 100000, 777, ""},
+		{"OneByteRows", 50, 50, ""},
+		{"NarrowRows", 130, 50, ""},
+		{"TooSmall", 49, 50, "too small"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, tc.name+".csv")
+			err := generator.GenerateLines(outPath, tc.size, tc.lines, nil)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("expected error containing %q, got %v", tc.errSub, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateLines returned unexpected error: %v", err)
+			}
+			if tc.size != ports.AnySize {
+				checkFileSize(t, outPath, tc.size)
+			}
+			content, _ := os.ReadFile(outPath)
+			rows := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+			if int64(len(rows)) != tc.lines || !bytes.HasSuffix(content, []byte("\n")) {
+				t.Fatalf("got %d rows, want %d", len(rows), tc.lines)
+			}
+			cols := strings.Count(rows[0], ",")
+			for i, row := range rows {
+				if strings.Count(row, ",") != cols {
+					t.Fatalf("row %d has %d separators, want %d", i, strings.Count(row, ","), cols)
+				}
+			}
+		})
+	}
+}
+
+func TestCsvGenerator_GenerateWithOptions(t *testing.T) {
+	generator := &CsvGenerator{}
+	tempDir := t.TempDir()
+
+	for _, lang := range []string{"ar", "zh", "ru", "emoji", "mixed"} {
+		for _, size := range []int64{1, 2, 3, 4097, 100000} {
+			t.Run(fmt.Sprintf("%s_%d", lang, size), func(t *testing.T) {
+				outPath := filepath.Join(tempDir, fmt.Sprintf("%s_%d.csv", lang, size))
+				if err := generator.GenerateWithOptions(outPath, size, ports.Options{"lang": lang}); err != nil {
+					t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+				}
+				checkFileSize(t, outPath, size)
+				content, _ := os.ReadFile(outPath)
+				if !utf8.Valid(content) || bytes.ContainsRune(content, '"') {
+					t.Errorf("content is not valid unquoted UTF-8")
+				}
+			})
+		}
+	}
+
+	t.Run("Lines", func(t *testing.T) {
+		outPath := filepath.Join(tempDir, "lines.csv")
+		if err := generator.GenerateLines(outPath, 20000, 100, ports.Options{"lang": "zh"}); err != nil {
+			t.Fatalf("GenerateLines returned unexpected error: %v", err)
+		}
+		checkFileSize(t, outPath, 20000)
+		content, _ := os.ReadFile(outPath)
+		if !utf8.Valid(content) || bytes.Count(content, []byte("\n")) != 100 {
+			t.Errorf("content is not 100 rows of valid UTF-8")
+		}
+	})
+
+	t.Run("UnknownLang", func(t *testing.T) {
+		outPath := filepath.Join(tempDir, "bad.csv")
+		err := generator.GenerateWithOptions(outPath, 100, ports.Options{"lang": "xx"})
+		if err == nil || !strings.Contains(err.Error(), "unknown lang") {
+			t.Errorf("expected unknown lang error, got %v", err)
+		}
+		if _, statErr := os.Stat(outPath); !os.IsNotExist(statErr) {
+			t.Errorf("file should not be created on error")
+		}
+	})
+}
+
+func TestCsvGenerator_CSVInjection(t *testing.T) {
+	generator := &CsvGenerator{}
+	tempDir := t.TempDir()
+	opts := ports.Options{"content": "csv-injection"}
+
+	// Every record parses, so payloads are quoted correctly, and the
+	// partial final record is a single field.
+	check := func(t *testing.T, path string) [][]string {
+		t.Helper()
+		content, _ := os.ReadFile(path)
+		r := csv.NewReader(bytes.NewReader(content))
+		r.FieldsPerRecord = -1
+		records, err := r.ReadAll()
+		if err != nil {
+			t.Fatalf("invalid CSV: %v", err)
+		}
+		return records
+	}
+
+	for _, size := range []int64{1, 10, 100, 4096, 200000} {
+		t.Run(fmt.Sprintf("Size%d", size), func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("inj_%d.csv", size))
+			if err := generator.GenerateWithOptions(outPath, size, opts); err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, size)
+			records := check(t, outPath)
+			if size == 200000 {
+				var formulas, multiline int
+				for _, rec := range records {
+					for _, f := range rec {
+						if strings.HasPrefix(f, "=") || strings.HasPrefix(f, "@") {
+							formulas++
+						}
+						if strings.Contains(f, "\n") {
+							multiline++
+						}
+					}
+				}
+				if formulas == 0 || multiline == 0 {
+					t.Errorf("got %d formula and %d multi-line fields, want some of each", formulas, multiline)
+				}
+			}
+		})
+	}
+
+	t.Run("Lines", func(t *testing.T) {
+		outPath := filepath.Join(tempDir, "inj_lines.csv")
+		if err := generator.GenerateLines(outPath, 50000, 200, opts); err != nil {
+			t.Fatalf("GenerateLines returned unexpected error: %v", err)
+		}
+		checkFileSize(t, outPath, 50000)
+		if records := check(t, outPath); len(records) != 200 {
+			t.Errorf("got %d records, want 200", len(records))
+		}
+	})
+
+	t.Run("UnknownProfile", func(t *testing.T) {
+		err := generator.GenerateWithOptions(filepath.Join(tempDir, "bad.csv"), 100, ports.Options{"content": "sqli"})
+		if err == nil || !strings.Contains(err.Error(), "unknown content profile") {
+			t.Errorf("expected unknown content profile error, got %v", err)
+		}
+	})
+}
+
+func TestCsvGenerator_CSVQuoting(t *testing.T) {
+	generator := &CsvGenerator{}
+	tempDir := t.TempDir()
+	opts := ports.Options{"content": "csv-quoting"}
+
+	// Past the byte order mark every record parses strictly, so quotes
+	// are escaped and fields closed, even in the partial final record.
+	check := func(t *testing.T, path string) [][]string {
+		t.Helper()
+		content, _ := os.ReadFile(path)
+		if len(content) >= len(bom) && !bytes.HasPrefix(content, []byte(bom)) {
+			t.Fatalf("file starts with %q, want a byte order mark", content[:len(bom)])
+		}
+		r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte(bom))))
+		r.FieldsPerRecord = -1
+		records, err := r.ReadAll()
+		if err != nil {
+			t.Fatalf("invalid CSV: %v", err)
+		}
+		return records
+	}
+
+	for _, size := range []int64{2, 3, 4, 10, 100, 4096, 200000} {
+		t.Run(fmt.Sprintf("Size%d", size), func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("quoting_%d.csv", size))
+			if err := generator.GenerateWithOptions(outPath, size, opts); err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, size)
+			records := check(t, outPath)
+			if size == 200000 {
+				found := map[string]int{}
+				for _, rec := range records {
+					for _, f := range rec {
+						for _, s := range []string{",", `"`, "\n"} {
+							if strings.Contains(f, s) {
+								found[s]++
+							}
+						}
+					}
+				}
+				if len(found) != 3 {
+					t.Errorf("fields with separators, quotes and line breaks: %v, want some of each", found)
+				}
+				content, _ := os.ReadFile(outPath)
+				if !bytes.Contains(content, []byte("\r\n")) {
+					t.Errorf("no CRLF line break in a quoted field")
+				}
+			}
+		})
+	}
+
+	t.Run("Lines", func(t *testing.T) {
+		outPath := filepath.Join(tempDir, "quoting_lines.csv")
+		if err := generator.GenerateLines(outPath, 50000, 200, ports.Options{"content": "csv-quoting", "csv-columns": "5"}); err != nil {
+			t.Fatalf("GenerateLines returned unexpected error: %v", err)
+		}
+		checkFileSize(t, outPath, 50000)
+		records := check(t, outPath)
+		if len(records) != 200 {
+			t.Errorf("got %d records, want 200", len(records))
+		}
+		for i, rec := range records {
+			if len(rec) != 5 {
+				t.Fatalf("record %d has %d fields, want 5", i, len(rec))
+			}
+		}
+	})
+
+	t.Run("EmbedString", func(t *testing.T) {
+		outPath := filepath.Join(tempDir, "quoting_needle.csv")
+		if err := generator.GenerateWithOptions(outPath, 10000, ports.Options{"content": "csv-quoting", "embed-string": "NEEDLE-12345", "embed-count": "4"}); err != nil {
+			t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+		}
+		checkFileSize(t, outPath, 10000)
+		needles := 0
+		for _, rec := range check(t, outPath) {
+			if rec[0] == "NEEDLE-12345" {
+				needles++
+			}
+		}
+		if needles != 4 {
+			t.Errorf("got %d rows with the string, want 4", needles)
+		}
+	})
+}
+
+func TestCsvGenerator_Columns(t *testing.T) {
+	tempDir := t.TempDir()
+	g, err := New().(ports.ConfigurableGenerator).Configure(ports.Options{"csv-columns": "7"})
+	if err != nil {
+		t.Fatalf("Configure returned unexpected error: %v", err)
+	}
+
+	for _, size := range []int64{7, 100, 4097, 100000} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("cols_%d.csv", size))
+			if err := g.Generate(outPath, size); err != nil {
+				t.Fatalf("Generate returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, size)
+			content, _ := os.ReadFile(outPath)
+			records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+			if err != nil {
+				t.Fatalf("output is not valid CSV: %v", err)
+			}
+			for i, rec := range records {
+				if len(rec) != 7 {
+					t.Fatalf("row %d has %d columns, want 7", i, len(rec))
+				}
+			}
+		})
+	}
+
+	if _, err := New().(ports.ConfigurableGenerator).Configure(ports.Options{"csv-columns": "-1"}); err == nil {
+		t.Error("expected an error for a negative column count")
+	}
+}
+
+func TestCsvGenerator_EmbedString(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, opts := range []ports.Options{
+		{"embed-string": "NEEDLE-12345", "embed-count": "10"},
+		{"embed-string": "needle, \"quoted\"", "embed-count": "3", "csv-columns": "4"},
+		{"embed-string": "NEEDLE-12345", "content": "csv-injection"},
+	} {
+		for _, size := range []int64{200, 4097, 100000} {
+			outPath := filepath.Join(tempDir, "needle.csv")
+			if err := New().(ports.OptionsGenerator).GenerateWithOptions(outPath, size, opts); err != nil {
+				t.Fatalf("%v, %d bytes: %v", opts, size, err)
+			}
+			checkFileSize(t, outPath, size)
+			content, _ := os.ReadFile(outPath)
+			r := csv.NewReader(bytes.NewReader(content))
+			r.FieldsPerRecord = -1
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatalf("%v: output is not valid CSV: %v", opts, err)
+			}
+			var needles, cells int
+			for _, rec := range records {
+				if rec[0] == opts["embed-string"] {
+					needles++
+				}
+				for _, cell := range rec {
+					cells += strings.Count(cell, opts["embed-string"])
+				}
+			}
+			want, _ := opts.Int("embed-count", 1)
+			if needles != want || cells != want {
+				t.Errorf("%v, %d bytes: %d rows start with the string, %d cells hold it; want %d", opts, size, needles, cells, want)
+			}
+		}
+	}
+
+	err := New().(ports.OptionsGenerator).GenerateWithOptions(filepath.Join(tempDir, "bad.csv"), 50, ports.Options{"embed-string": "NEEDLE-12345", "embed-count": "10"})
+	if err == nil || !strings.Contains(err.Error(), "too small to embed") {
+		t.Errorf("expected a too small error, got %v", err)
+	}
+}
+
+func TestCsvGenerator_PII(t *testing.T) {
+	tempDir := t.TempDir()
+	pattern := regexp.MustCompile(`^(\d{3}-\d{2}-\d{4}|\d{4} \d{4} \d{4} \d{4}|3[47]\d{13}|[a-z]+\.[a-z]+\d*@example\.(com|org|net))$`)
+	for _, opts := range []ports.Options{
+		{"content": "pii"},
+		{"content": "pii", "pii-density": "0.5", "csv-columns": "4"},
+		{"content": "pii", "pii-density": "1", "embed-string": "NEEDLE-12345", "embed-count": "3"},
+	} {
+		for _, size := range []int64{200, 4097, 100000} {
+			g, err := New().(*CsvGenerator).Configure(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outPath := filepath.Join(tempDir, "pii.csv")
+			paths, err := g.(ports.SetGenerator).GenerateSet(outPath, size)
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", opts, size, err)
+			}
+			if len(paths) != 2 {
+				t.Fatalf("GenerateSet() = %v, want the CSV file and its manifest", paths)
+			}
+			checkFileSize(t, outPath, size)
+			content, _ := os.ReadFile(outPath)
+			r := csv.NewReader(bytes.NewReader(content))
+			r.FieldsPerRecord = -1
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatalf("%v: output is not valid CSV: %v", opts, err)
+			}
+			data, _ := os.ReadFile(paths[1])
+			var manifest struct{ Items []utils.PIIItem }
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatalf("manifest does not parse: %v", err)
+			}
+			for _, item := range manifest.Items {
+				if got := string(content[item.Offset:min(item.Offset+int64(len(item.Value)), size)]); got != item.Value {
+					t.Fatalf("%v: %s at %d is %q, manifest says %q", opts, item.Type, item.Offset, got, item.Value)
+				}
+				if item.Row > int64(len(records)) || item.Column > len(records[item.Row-1]) || records[item.Row-1][item.Column-1] != item.Value {
+					t.Fatalf("%v: %q is not at row %d, column %d", opts, item.Value, item.Row, item.Column)
+				}
+			}
+			var cells int
+			for _, rec := range records {
+				for _, cell := range rec {
+					if pattern.MatchString(cell) {
+						cells++
+					}
+				}
+			}
+			if cells != len(manifest.Items) {
+				t.Errorf("%v, %d bytes: %d cells hold personal data, %d in the manifest", opts, size, cells, len(manifest.Items))
+			}
+		}
+	}
+
+	err := (&CsvGenerator{}).GenerateLines(filepath.Join(tempDir, "lines.csv"), ports.AnySize, 10, ports.Options{"content": "pii"})
+	if err == nil || !strings.Contains(err.Error(), "line count") {
+		t.Errorf("expected a line count error, got %v", err)
+	}
+}
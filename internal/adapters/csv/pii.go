@@ -0,0 +1,63 @@
+package csv
+
+import (
+	"fmt"
+
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// piiGenerator is the generator Configure returns for the pii content
+// profile. It writes each file with the ground-truth manifest of the
+// personal data planted in its cells, as <base>.pii.json.
+type piiGenerator struct {
+	*CsvGenerator
+}
+
+// WithOutputFS returns a copy of the generator that writes the file and
+// its manifest on fsys.
+func (g *piiGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g.CsvGenerator
+	c.fs = fsys
+	return &piiGenerator{&c}
+}
+
+func (g *piiGenerator) Generate(path string, targetSize int64) error {
+	_, err := g.GenerateSetWithOptions(path, targetSize, nil)
+	return err
+}
+
+func (g *piiGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	_, err := g.GenerateSetWithOptions(path, targetSize, opts)
+	return err
+}
+
+func (g *piiGenerator) GenerateSet(path string, targetSize int64) ([]string, error) {
+	return g.GenerateSetWithOptions(path, targetSize, nil)
+}
+
+// GenerateSetWithOptions writes a CSV file of exactly targetSize bytes, as
+// GenerateWithOptions does, then its manifest, and returns the paths of
+// both. The manifest does not count towards targetSize.
+func (g *piiGenerator) GenerateSetWithOptions(path string, targetSize int64, opts ports.Options) ([]string, error) {
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	items, err := g.generateTo(f, targetSize, opts)
+	if err != nil {
+		return []string{path}, err
+	}
+	if err := f.Close(); err != nil {
+		return []string{path}, err
+	}
+	manifest, err := utils.WritePIIManifest(path, items, g.writeFile)
+	return []string{path, manifest}, err
+}
+
+// writeFile writes data to the file at path on the generator's file system.
+func (g *piiGenerator) writeFile(path string, data []byte) error {
+	return outputfs.WriteFile(g.fs, path, data)
+}
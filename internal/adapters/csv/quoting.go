@@ -0,0 +1,48 @@
+package csv
+
+import "github.com/hailam/genfile/internal/utils"
+
+// ContentQuoting is the content profile that exercises the quoting rules
+// of RFC 4180: the file starts with a UTF-8 byte order mark, and about
+// half the cells are quoted fields holding a separator, an escaped quote
+// or a line break.
+const ContentQuoting = "csv-quoting"
+
+// bom is the UTF-8 byte order mark a csv-quoting file starts with, as
+// spreadsheet applications write it on export.
+const bom = "\uFEFF"
+
+// quotingSnippets are what a quoted field holds, escaped as RFC 4180
+// has it: a separator, a doubled quote, line breaks in LF and CRLF, and
+// an escaped quote beside a separator.
+var quotingSnippets = []string{separator + " ", `""`, "\n", "\r\n", `"",`}
+
+// quotedField returns a field of exactly n bytes, n at least 2, enclosed
+// in quotes around text and one of quotingSnippets, if it fits. The
+// snippet goes anywhere in the field, first and last included, so that
+// quotes also come next to the enclosing ones.
+func quotedField(r *utils.Rand, text func(r *utils.Rand, n int) string, n int) string {
+	inner := n - 2
+	var fits []string
+	for _, s := range quotingSnippets {
+		if len(s) <= inner {
+			fits = append(fits, s)
+		}
+	}
+	if len(fits) == 0 {
+		return `"` + text(r, inner) + `"`
+	}
+	s := fits[r.IntN(len(fits))]
+	before := r.IntN(inner - len(s) + 1)
+	return `"` + text(r, before) + s + text(r, inner-len(s)-before) + `"`
+
+}
+
+// prefix returns what the file starts with: the byte order mark with the
+// csv-quoting profile, nothing otherwise.
+func (o csvOptions) prefix() string {
+	if o.quoting {
+		return bom
+	}
+	return ""
+}
@@ -0,0 +1,329 @@
+package deb
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeDEB, New())
+}
+
+// DebGenerator writes Debian binary packages: an ar archive of the format
+// version, a control tarball and a data tarball installing one file of
+// random data that pads the package.
+type DebGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &DebGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *DebGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *DebGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// SizeStep returns 2: the members of an ar archive start on even offsets.
+func (g *DebGenerator) SizeStep() int64 {
+	return 2
+}
+
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+	// maxMember is the largest member the ar header's ten-digit size
+	// field holds.
+	maxMember = 9_999_999_999
+	// formatVersion is the content of the debian-binary member.
+	formatVersion = "2.0\n"
+	blockSize     = 512
+
+	defaultName    = "genfile-fixture"
+	defaultVersion = "1.0.0-1"
+	defaultArch    = "amd64"
+)
+
+var (
+	nameRe    = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+	versionRe = regexp.MustCompile(`^(?:[0-9]+:)?[0-9][A-Za-z0-9.+~-]*$`)
+	// archAliases maps the RPM names of architectures to Debian's.
+	archAliases = map[string]string{"x86_64": "amd64", "aarch64": "arm64", "noarch": "all"}
+)
+
+// debOptions holds the settings the DEB generator reads from ports.Options.
+type debOptions struct {
+	name, version, arch string
+	modTime             time.Time    // zero for the time of generation
+	filler              utils.Filler // of the payload
+	rand                *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (debOptions, error) {
+	o := debOptions{
+		name:    opts.String("pkg-name", defaultName),
+		version: opts.String("pkg-version", defaultVersion),
+		arch:    opts.String("pkg-arch", defaultArch),
+	}
+	if !nameRe.MatchString(o.name) {
+		return o, fmt.Errorf("invalid package name %q: use lowercase letters, digits, '+', '-' and '.'", o.name)
+	}
+	if !versionRe.MatchString(o.version) {
+		return o, fmt.Errorf("invalid package version %q: it must start with a digit, e.g. %s", o.version, defaultVersion)
+	}
+	if alias, ok := archAliases[o.arch]; ok {
+		o.arch = alias
+	}
+	if !nameRe.MatchString(o.arch) {
+		return o, fmt.Errorf("invalid package architecture %q", o.arch)
+	}
+	var err error
+	if o.modTime, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	if o.filler, err = utils.ParseFiller(o.rand, opts.String("entropy", ""), opts.String("shared-blocks", ""), opts.String("shared-pool", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *DebGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes a Debian package of exactly size bytes,
+// which must be even as ar archives are made of even-length members. The
+// package is named "pkg-name" (genfile-fixture), at version "pkg-version"
+// (1.0.0-1) for architecture "pkg-arch" (amd64), and installs
+// /usr/share/<name>/payload.bin, whose checksum md5sums lists. The "mtime"
+// option dates the archive members and the files; "entropy" sets the
+// share of the payload that is random, the rest repeating a pattern, and
+// "shared-blocks" the share drawn from the "shared-pool" chunk pool.
+func (g *DebGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.modTime.IsZero() {
+		o.modTime = time.Now()
+	}
+	o.modTime = o.modTime.UTC().Truncate(time.Second)
+	p, err := layout(o, size)
+	if err != nil {
+		return err
+	}
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	// md5sums, in the control tarball, lists the checksum of the payload:
+	// the data member is written first, at its offset, and the members
+	// before it once the checksum is known.
+	dataOffset := size - p.dataSize
+	if _, err := f.Seek(dataOffset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	bw := bufio.NewWriterSize(f, 1<<20)
+	sum := md5.New()
+	if err := p.writeData(bw, sum); err != nil {
+		return fmt.Errorf("failed to write data.tar.gz: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	p.md5 = hex.EncodeToString(sum.Sum(nil))
+
+	control := p.control()
+	if int64(len(control)) != p.controlSize {
+		return fmt.Errorf("control.tar.gz came out at %d bytes, want %d", len(control), p.controlSize)
+	}
+	var head bytes.Buffer
+	head.WriteString(arMagic)
+	writeMember(&head, "debian-binary", []byte(formatVersion), o.modTime)
+	writeMember(&head, "control.tar.gz", control, o.modTime)
+	head.Write(arHeader("data.tar.gz", p.dataSize, o.modTime))
+	if int64(head.Len()) != dataOffset {
+		return fmt.Errorf("package header came out at %d bytes, want %d", head.Len(), dataOffset)
+	}
+	if _, err := f.WriteAt(head.Bytes(), 0); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	return f.Sync()
+}
+
+// pkg is the layout of a package.
+type pkg struct {
+	o           debOptions
+	payload     int64 // size of payload.bin
+	extra       int   // empty deflate blocks padding data.tar.gz
+	dataSize    int64 // of data.tar.gz
+	controlSize int64 // of control.tar.gz
+	md5         string
+}
+
+// dataDirs are the directories data.tar.gz holds, ending with the one
+// payload.bin is in.
+func (p pkg) dataDirs() []string {
+	return []string{"./", "./usr/", "./usr/share/", "./usr/share/" + p.o.name + "/"}
+}
+
+// dataBase is the size of data.tar.gz's tarball without the payload.
+func (p pkg) dataBase() int64 {
+	return int64(len(p.dataDirs())+1)*blockSize + 2*blockSize
+}
+
+// layout sizes the data member of a package of exactly size bytes around
+// the control member, which lists the payload's size.
+func layout(o debOptions, size int64) (pkg, error) {
+	p := pkg{o: o}
+	if size%2 != 0 {
+		return p, fmt.Errorf("DEB size must be even, got %d", size)
+	}
+	// The control file's Installed-Size can change the control tarball's
+	// size as the payload grows; a few rounds settle it.
+	for i := 0; i < 4; i++ {
+		p.controlSize = int64(len(p.control()))
+		fixed := int64(len(arMagic)) + arHeaderSize + int64(len(formatVersion)) +
+			arHeaderSize + p.controlSize + p.controlSize%2 + arHeaderSize
+		p.dataSize = size - fixed
+		n, extra, ok := utils.FitStoredGzip(p.dataSize, p.dataBase(), blockSize)
+		if !ok {
+			minimum := fixed + utils.StoredGzipSize(p.dataBase()+4*blockSize, 0)
+			return p, fmt.Errorf("target %d too small for a DEB package; any even size from %d bytes fits", size, minimum+minimum%2)
+		}
+		if p.dataSize > maxMember {
+			return p, fmt.Errorf("target %d too large for a DEB package; data.tar.gz is limited to %d bytes", size, int64(maxMember))
+		}
+		p.payload, p.extra = n-p.dataBase(), extra
+		if int64(len(p.control())) == p.controlSize {
+			return p, nil
+		}
+	}
+	return p, fmt.Errorf("failed to converge on the layout for target size %d", size)
+}
+
+// writeData writes data.tar.gz to w, and the payload to sum.
+func (p pkg) writeData(w io.Writer, sum io.Writer) error {
+	gz := utils.NewStoredGzip(w, p.extra)
+	tw := tar.NewWriter(gz)
+	dirs := p.dataDirs()
+	for _, dir := range dirs {
+		if err := tw.WriteHeader(p.header(tar.TypeDir, dir, 0)); err != nil {
+			return err
+		}
+	}
+	if err := tw.WriteHeader(p.header(tar.TypeReg, dirs[len(dirs)-1]+"payload.bin", p.payload)); err != nil {
+		return err
+	}
+	if err := p.o.filler.Write(p.o.rand, io.MultiWriter(tw, sum), p.payload); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// control returns control.tar.gz, with a checksum of zeros in md5sums
+// until the payload's is known.
+func (p pkg) control() []byte {
+	sum := p.md5
+	if sum == "" {
+		sum = strings.Repeat("0", 2*md5.Size)
+	}
+	control := fmt.Sprintf(`Package: %s
+Version: %s
+Architecture: %s
+Maintainer: genfile <genfile@example.com>
+Installed-Size: %d
+Section: misc
+Priority: optional
+Description: Test fixture generated by genfile
+ This package installs /usr/share/%[1]s/payload.bin,
+ a file of random data sized for load testing package repositories
+ and tools.
+`, p.o.name, p.o.version, p.o.arch, (p.payload+1023)/1024)
+	md5sums := fmt.Sprintf("%s  usr/share/%s/payload.bin\n", sum, p.o.name)
+
+	var buf bytes.Buffer
+	gz := utils.NewStoredGzip(&buf, 0)
+	tw := tar.NewWriter(gz)
+	// Writing to memory cannot fail.
+	tw.WriteHeader(p.header(tar.TypeDir, "./", 0))
+	for _, file := range []struct{ name, content string }{{"./control", control}, {"./md5sums", md5sums}} {
+		tw.WriteHeader(p.header(tar.TypeReg, file.name, int64(len(file.content))))
+		tw.Write([]byte(file.content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// header returns the tar header of an entry owned by root. GNU headers
+// take one block whatever the size.
+func (p pkg) header(typ byte, name string, size int64) *tar.Header {
+	mode := int64(0o644)
+	if typ == tar.TypeDir {
+		mode = 0o755
+	}
+	return &tar.Header{
+		Typeflag: typ,
+		Name:     name,
+		Size:     size,
+		Mode:     mode,
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  p.o.modTime,
+		Format:   tar.FormatGNU,
+	}
+}
+
+// arHeader returns the header of an ar member.
+func arHeader(name string, size int64, modTime time.Time) []byte {
+	return []byte(fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, modTime.Unix(), 0, 0, 0o100644, size))
+}
+
+// writeMember writes an ar member, padded to an even length.
+func writeMember(buf *bytes.Buffer, name string, data []byte, modTime time.Time) {
+	buf.Write(arHeader(name, int64(len(data)), modTime))
+	buf.Write(data)
+	if len(data)%2 != 0 {
+		buf.WriteByte('\n')
+	}
+}
@@ -0,0 +1,134 @@
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestDebGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name    string
+		size    int64
+		opts    ports.Options
+		control []string // lines the control file holds
+		errSub  string
+	}{
+		{name: "Default", size: 1 << 20, control: []string{"Package: genfile-fixture", "Version: 1.0.0-1", "Architecture: amd64", "Installed-Size: 1016"}},
+		{name: "Small", size: 10000, control: []string{"Package: genfile-fixture"}},
+		{name: "Options", size: 500002, opts: ports.Options{"pkg-name": "demo", "pkg-version": "2:3.1-4", "pkg-arch": "noarch"}, control: []string{"Package: demo", "Version: 2:3.1-4", "Architecture: all"}},
+		{name: "Odd", size: 10001, errSub: "even"},
+		{name: "TooSmall", size: 5000, errSub: "too small"},
+		{name: "BadName", size: 10000, opts: ports.Options{"pkg-name": "Demo_Pkg"}, errSub: "invalid package name"},
+		{name: "BadVersion", size: 10000, opts: ports.Options{"pkg-version": "v1"}, errSub: "invalid package version"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixture.deb")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+
+			members := readAr(t, data)
+			if got := string(members["debian-binary"]); got != formatVersion {
+				t.Errorf("debian-binary = %q, want %q", got, formatVersion)
+			}
+			control := readTarGz(t, members["control.tar.gz"])
+			for _, line := range tc.control {
+				if !strings.Contains(string(control["./control"]), line+"\n") {
+					t.Errorf("control does not hold %q:\n%s", line, control["./control"])
+				}
+			}
+			files := readTarGz(t, members["data.tar.gz"])
+			var payload []byte
+			for name, content := range files {
+				if strings.HasSuffix(name, "/payload.bin") {
+					payload = content
+				}
+			}
+			sum := md5.Sum(payload)
+			if want := hex.EncodeToString(sum[:]) + "  usr/share/"; !strings.HasPrefix(string(control["./md5sums"]), want) {
+				t.Errorf("md5sums = %q, want the payload's checksum %s", control["./md5sums"], want)
+			}
+		})
+	}
+}
+
+// readAr returns the members of the ar archive in data by name.
+func readAr(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte(arMagic)) {
+		t.Fatalf("missing ar magic: %q", data[:8])
+	}
+	members := map[string][]byte{}
+	for off := len(arMagic); off < len(data); {
+		h := data[off : off+arHeaderSize]
+		if string(h[58:60]) != "`\n" {
+			t.Fatalf("bad ar header at %d: %q", off, h)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(string(h[48:58])))
+		if err != nil {
+			t.Fatalf("bad ar member size at %d: %v", off, err)
+		}
+		off += arHeaderSize
+		members[strings.TrimSpace(string(h[:16]))] = data[off : off+size]
+		off += size + size%2
+	}
+	return members
+}
+
+// readTarGz returns the regular files of a gzipped tarball by name.
+func readTarGz(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	files := map[string][]byte{}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tarball: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if files[hdr.Name], err = io.ReadAll(tr); err != nil {
+				t.Fatalf("reading %s: %v", hdr.Name, err)
+			}
+		}
+	}
+	// The gzip stream must end where the member does.
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		t.Fatalf("reading gzip stream: %v", err)
+	}
+	return files
+}
@@ -0,0 +1,215 @@
+package djvu
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeDJVU, New())
+}
+
+// DjvuGenerator writes single-page DjVu documents: a blank scanned page
+// whose hidden text layer, as OCR leaves it, pads the file.
+type DjvuGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &DjvuGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *DjvuGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, _, err := dimensions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *DjvuGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// SizeStep returns 2: DjVu chunks are padded to even lengths.
+func (g *DjvuGenerator) SizeStep() int64 {
+	return 2
+}
+
+const (
+	// Default dimensions: an A4 page scanned at 300 dpi.
+	defaultWidth  = 2480
+	defaultHeight = 3508
+	dpi           = 300
+	// maxDimension is the largest width or height the text zone, with its
+	// coordinates biased by 0x8000, can hold.
+	maxDimension = 0x7FFF
+
+	// fileHeaderSize is the AT&T magic, the FORM chunk header and its
+	// DJVU type.
+	fileHeaderSize  = 4 + 8 + 4
+	chunkHeaderSize = 8
+	infoSize        = 10
+	// zoneSize is the text layer's version byte and its page zone.
+	zoneSize = 1 + 17
+	// maxText is the most text a text layer's 24-bit length allows.
+	maxText = 1<<24 - 1
+	// Annotations carrying text past maxText.
+	metadataOpen  = `(metadata (notes "`
+	metadataClose = `"))`
+)
+
+// Text zone types.
+const zonePage = 1
+
+func (g *DjvuGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes a DjVu page of exactly size bytes, which must
+// be even as DjVu chunks are. The page is "width" by "height" pixels at 300
+// dpi (an A4 page by default) and has no image layers, so it shows blank.
+// Its hidden text layer holds lorem text sized to the file; past the 16 MiB
+// a text layer can hold, the rest goes into a metadata annotation.
+func (g *DjvuGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	w, h, err := dimensions(opts)
+	if err != nil {
+		return err
+	}
+	r, err := utils.NewRand(opts.String("seed", ""))
+	if err != nil {
+		return err
+	}
+	textChunk := int64(chunkHeaderSize + 3 + zoneSize)
+	fixed := int64(fileHeaderSize+chunkHeaderSize+infoSize) + textChunk
+	if size < fixed {
+		return fmt.Errorf("target %d too small for a DjVu page; need at least %d bytes", size, fixed)
+	}
+	if size%2 != 0 {
+		return fmt.Errorf("target %d is odd; DjVu files are made of even-length chunks", size)
+	}
+	if size-4-chunkHeaderSize > math.MaxUint32 {
+		return fmt.Errorf("target %d exceeds the 4 GiB a DjVu file can hold", size)
+	}
+
+	// The text comes out of odd length, so the text chunk is even and
+	// needs no padding byte; so does the annotation text.
+	text, notes := size-fixed, int64(0)
+	if text > maxText {
+		annotation := int64(chunkHeaderSize + len(metadataOpen) + len(metadataClose))
+		rest := text - maxText
+		text = maxText
+		if rest <= annotation {
+			// Too little for an annotation chunk; move some text over.
+			text -= annotation + 1
+			rest += annotation + 1
+		}
+		notes = rest - annotation
+	}
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	bw.WriteString("AT&T")
+	// FORM counts from its DJVU type to the end of the file.
+	writeChunkHeader(bw, "FORM", size-4-chunkHeaderSize)
+	bw.WriteString("DJVU")
+
+	// Page info: size, version 0.24, resolution (little-endian), gamma 2.2
+	// and upright rotation.
+	writeChunkHeader(bw, "INFO", infoSize)
+	writeBE(bw, uint16(w), uint16(h), uint8(24), uint8(0))
+	binary.Write(bw, binary.LittleEndian, uint16(dpi))
+	writeBE(bw, uint8(22), uint8(1))
+
+	writeChunkHeader(bw, "TXTa", 3+text+zoneSize)
+	writeBE(bw, uint8(text>>16), uint16(text))
+	if err := writeLorem(r, bw, text, true); err != nil {
+		return fmt.Errorf("failed to write DjVu text layer: %w", err)
+	}
+	// One page zone covering the page and all the text, coordinates and
+	// start offset biased by 0x8000, and no child zones.
+	writeBE(bw, uint8(1), uint8(zonePage), uint16(0x8000), uint16(0x8000),
+		uint16(0x8000+w), uint16(0x8000+h), uint16(0x8000), uint8(text>>16), uint16(text), uint8(0), uint16(0))
+
+	if notes > 0 {
+		writeChunkHeader(bw, "ANTa", int64(len(metadataOpen)+len(metadataClose))+notes)
+		bw.WriteString(metadataOpen)
+		if err := writeLorem(r, bw, notes, false); err != nil {
+			return fmt.Errorf("failed to write DjVu annotations: %w", err)
+		}
+		bw.WriteString(metadataClose)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write DjVu file: %w", err)
+	}
+	return f.Sync()
+}
+
+// dimensions returns the "width" and "height" options, by default an A4
+// page at 300 dpi.
+func dimensions(opts ports.Options) (w, h int, err error) {
+	if w, err = opts.Int("width", defaultWidth); err != nil {
+		return 0, 0, err
+	}
+	if h, err = opts.Int("height", defaultHeight); err != nil {
+		return 0, 0, err
+	}
+	if w < 1 || h < 1 || w > maxDimension || h > maxDimension {
+		return 0, 0, fmt.Errorf("DjVu dimensions must be between 1 and %d, got %dx%d", maxDimension, w, h)
+	}
+	return w, h, nil
+}
+
+func writeChunkHeader(bw *bufio.Writer, id string, length int64) {
+	bw.WriteString(id)
+	writeBE(bw, uint32(length))
+}
+
+// writeLorem writes n bytes of lorem sentences, on lines of their own if
+// lines is set.
+func writeLorem(r *utils.Rand, bw *bufio.Writer, n int64, lines bool) error {
+	sep := " "
+	if lines {
+		sep = "\n"
+	}
+	for n > 0 {
+		s := utils.Lorem.Sentence(r, 8, 16) + sep
+		if int64(len(s)) > n {
+			s = strings.TrimSpace(utils.Lorem.Text(r, int(n)))
+			s += strings.Repeat(".", int(n)-len(s))
+		}
+		if _, err := bw.WriteString(s); err != nil {
+			return err
+		}
+		n -= int64(len(s))
+	}
+	return nil
+}
+
+// writeBE writes each value big-endian.
+func writeBE(bw *bufio.Writer, values ...any) {
+	for _, v := range values {
+		binary.Write(bw, binary.BigEndian, v) // errors surface on Flush
+	}
+}
@@ -0,0 +1,121 @@
+package djvu
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestDjvuGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name          string
+		size          int64
+		opts          ports.Options
+		width, height int // want
+		errSub        string
+	}{
+		{name: "Smallest", size: 64, width: defaultWidth, height: defaultHeight},
+		{name: "Default", size: 1024 * 1024, width: defaultWidth, height: defaultHeight},
+		{name: "Dimensions", size: 5000, opts: ports.Options{"width": "1700", "height": "2200"}, width: 1700, height: 2200},
+		{name: "Odd", size: 5001, errSub: "odd"},
+		{name: "TooSmall", size: 50, errSub: "too small"},
+		{name: "TooLarge", size: 5000, opts: ports.Options{"height": "40000"}, errSub: "dimensions"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scan.djvu")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			chunks := checkDjVu(t, data, tc.width, tc.height)
+			if got := strings.Join(chunks, ","); got != "INFO,TXTa" {
+				t.Errorf("chunks = %s, want INFO,TXTa", got)
+			}
+		})
+	}
+}
+
+func TestDjvuGenerator_Annotations(t *testing.T) {
+	// Past what a text layer holds, an annotation takes the rest, however
+	// little.
+	generator := New()
+	fixed := int64(fileHeaderSize + chunkHeaderSize + infoSize + chunkHeaderSize + 3 + zoneSize)
+	for _, extra := range []int64{2, 4, 28, 30, 32, 1000} {
+		size := fixed + maxText + extra
+		path := filepath.Join(t.TempDir(), "scan.djvu")
+		if err := generator.Generate(path, size); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(path)
+		if int64(len(data)) != size {
+			t.Fatalf("size = %d, want %d", len(data), size)
+		}
+		chunks := checkDjVu(t, data, defaultWidth, defaultHeight)
+		if got := strings.Join(chunks, ","); got != "INFO,TXTa,ANTa" {
+			t.Errorf("%d bytes: chunks = %s, want INFO,TXTa,ANTa", size, got)
+		}
+	}
+}
+
+// checkDjVu walks the chunks of a single-page DjVu, checking their lengths,
+// the page size and the text layer, and returns the chunk IDs.
+func checkDjVu(t *testing.T, data []byte, width, height int) []string {
+	t.Helper()
+	if string(data[:4]) != "AT&T" || string(data[4:8]) != "FORM" || string(data[12:16]) != "DJVU" {
+		t.Fatalf("header = %q", data[:16])
+	}
+	if n := int(binary.BigEndian.Uint32(data[8:])); n != len(data)-12 {
+		t.Fatalf("FORM length = %d, want %d", n, len(data)-12)
+	}
+	var ids []string
+	for off := fileHeaderSize; off < len(data); {
+		id := string(data[off : off+4])
+		n := int(binary.BigEndian.Uint32(data[off+4:]))
+		body := data[off+chunkHeaderSize : off+chunkHeaderSize+n]
+		switch id {
+		case "INFO":
+			w, h := binary.BigEndian.Uint16(body), binary.BigEndian.Uint16(body[2:])
+			if int(w) != width || int(h) != height || binary.LittleEndian.Uint16(body[6:]) != dpi {
+				t.Errorf("INFO = %dx%d at %d dpi", w, h, binary.LittleEndian.Uint16(body[6:]))
+			}
+		case "TXTa":
+			text := int(body[0])<<16 | int(binary.BigEndian.Uint16(body[1:]))
+			zone := body[3+text:]
+			if len(zone) != zoneSize || zone[0] != 1 || zone[1] != zonePage {
+				t.Fatalf("text layer of %d bytes has zone %v", text, zone)
+			}
+			if zl := int(zone[12])<<16 | int(binary.BigEndian.Uint16(zone[13:])); zl != text {
+				t.Errorf("page zone covers %d bytes of %d", zl, text)
+			}
+		case "ANTa":
+			if !strings.HasPrefix(string(body), metadataOpen) || !strings.HasSuffix(string(body), metadataClose) {
+				t.Errorf("annotation %.40q... is not a metadata expression", body)
+			}
+		default:
+			t.Fatalf("unexpected chunk %q", id)
+		}
+		ids = append(ids, id)
+		off += chunkHeaderSize + n + n%2
+	}
+	return ids
+}
@@ -0,0 +1,184 @@
+package docx
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"github.com/hailam/genfile/internal/adapters/embed"
+	"github.com/hailam/genfile/internal/adapters/ooxml"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// embeddedNamespaces declares the namespaces of inline pictures and OLE
+// objects on the document element.
+const embeddedNamespaces = ` xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"` +
+	` xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"` +
+	` xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"` +
+	` xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture"` +
+	` xmlns:v="urn:schemas-microsoft-com:vml"` +
+	` xmlns:o="urn:schemas-microsoft-com:office:office"`
+
+const (
+	imageRelType   = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+	packageRelType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/package"
+	xlsxType       = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	// emuPerPixel converts pixels at 96 DPI to English Metric Units.
+	emuPerPixel = 9525
+	// maxPictureWidth is the widest a picture is shown, six inches in EMU.
+	maxPictureWidth = 6 * 914400
+	// previewWidth and previewHeight are the pixel dimensions of the picture
+	// standing in for the spreadsheet.
+	previewWidth, previewHeight = 192, 96
+)
+
+// picture is an embedded PNG image and its pixel dimensions.
+type picture struct {
+	embed.File
+	width, height int
+}
+
+// embedded holds the files a document embeds: images shown inline, and a
+// spreadsheet shown as an OLE object by its preview picture. Relationships
+// number the images rId1 on, then the preview and the spreadsheet.
+type embedded struct {
+	images  []picture
+	sheet   *embed.File
+	preview []byte
+}
+
+// renderEmbedded renders the images and the spreadsheet o asks for with
+// the generators of f, applying opts to them, in temporary files on fsys.
+func renderEmbedded(f ports.GeneratorFactory, fsys ports.OutputFS, o docxOptions, opts ports.Options) (embedded, error) {
+	var e embedded
+	items := make([]embed.Item, o.images)
+	for i := range items {
+		items[i] = embed.Item{Type: ports.FileTypePNG, Size: o.imageSize}
+	}
+	files, err := embed.Render(f, fsys, items, "image", opts)
+	if err != nil {
+		return e, err
+	}
+	for _, f := range files {
+		cfg, err := png.DecodeConfig(bytes.NewReader(f.Data))
+		if err != nil {
+			return e, fmt.Errorf("failed to read embedded image %s: %w", f.Name, err)
+		}
+		e.images = append(e.images, picture{File: f, width: cfg.Width, height: cfg.Height})
+	}
+
+	if o.sheetSize == 0 {
+		return e, nil
+	}
+	files, err = embed.Render(f, fsys, []embed.Item{{Type: ports.FileTypeXLSX, Size: o.sheetSize}}, "Microsoft_Excel_Worksheet", opts)
+	if err != nil {
+		return e, err
+	}
+	e.sheet = &files[0]
+	if e.preview, err = sheetPreview(); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// empty reports whether there is nothing to embed.
+func (e embedded) empty() bool {
+	return len(e.images) == 0 && e.sheet == nil
+}
+
+// parts returns the media and embedding parts.
+func (e embedded) parts() []ooxml.Part {
+	var parts []ooxml.Part
+	for _, img := range e.images {
+		parts = append(parts, ooxml.Part{Name: "word/media/" + img.Name, ContentType: "image/png", Body: string(img.Data)})
+	}
+	if e.sheet != nil {
+		parts = append(parts,
+			ooxml.Part{Name: "word/media/preview.png", ContentType: "image/png", Body: string(e.preview)},
+			ooxml.Part{Name: "word/embeddings/" + e.sheet.Name, ContentType: xlsxType, Body: string(e.sheet.Data)})
+	}
+	return parts
+}
+
+// relationships returns word/_rels/document.xml.rels, relating the main
+// document to the embedded parts.
+func (e embedded) relationships() string {
+	if e.empty() {
+		return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"/>`
+	}
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+`)
+	rel := func(id int, typ, target string) {
+		fmt.Fprintf(&b, "  <Relationship Id=\"rId%d\" Type=\"%s\" Target=\"%s\"/>\n", id, typ, target)
+	}
+	for i, img := range e.images {
+		rel(i+1, imageRelType, "media/"+img.Name)
+	}
+	if e.sheet != nil {
+		rel(len(e.images)+1, imageRelType, "media/preview.png")
+		rel(len(e.images)+2, packageRelType, "embeddings/"+e.sheet.Name)
+	}
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// writeBody writes a paragraph showing each image, scaled down to fit the
+// page width, then one holding the spreadsheet object.
+func (e embedded) writeBody(buf *bytes.Buffer) {
+	for i, img := range e.images {
+		id := i + 1
+		cx, cy := int64(img.width)*emuPerPixel, int64(img.height)*emuPerPixel
+		if cx > maxPictureWidth {
+			cx, cy = maxPictureWidth, cy*maxPictureWidth/cx
+		}
+		fmt.Fprintf(buf, `    <w:p><w:r><w:drawing><wp:inline distT="0" distB="0" distL="0" distR="0">`+
+			`<wp:extent cx="%d" cy="%d"/><wp:docPr id="%d" name="Picture %d"/>`+
+			`<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture">`+
+			`<pic:pic><pic:nvPicPr><pic:cNvPr id="%d" name="%s"/><pic:cNvPicPr/></pic:nvPicPr>`+
+			`<pic:blipFill><a:blip r:embed="rId%d"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>`+
+			`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%d" cy="%d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr>`+
+			"</pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r></w:p>\n",
+			cx, cy, id, id, id, img.Name, id, cx, cy)
+	}
+	if e.sheet == nil {
+		return
+	}
+	// Sizes in points for VML and in twentieths of a point for Word.
+	w, h := previewWidth*3/4, previewHeight*3/4
+	fmt.Fprintf(buf, `    <w:p><w:r><w:object w:dxaOrig="%d" w:dyaOrig="%d">`+
+		`<v:shapetype id="_x0000_t75" coordsize="21600,21600" o:spt="75" o:preferrelative="t" filled="f" stroked="f"/>`+
+		`<v:shape id="_x0000_i1025" type="#_x0000_t75" style="width:%dpt;height:%dpt" o:ole=""><v:imagedata r:id="rId%d" o:title=""/></v:shape>`+
+		`<o:OLEObject Type="Embed" ProgID="Excel.Sheet.12" ShapeID="_x0000_i1025" DrawAspect="Content" ObjectID="_1000000001" r:id="rId%d"/>`+
+		"</w:object></w:r></w:p>\n",
+		w*20, h*20, w, h, len(e.images)+1, len(e.images)+2)
+}
+
+// sheetPreview draws the picture Word shows for the spreadsheet until it
+// is opened: an empty grid with a shaded header row.
+func sheetPreview() ([]byte, error) {
+	const cellWidth, cellHeight = 48, 16
+	img := image.NewGray(image.Rect(0, 0, previewWidth, previewHeight))
+	for y := 0; y < previewHeight; y++ {
+		for x := 0; x < previewWidth; x++ {
+			c := color.Gray{Y: 0xFF}
+			switch {
+			case x%cellWidth == 0 || y%cellHeight == 0 || x == previewWidth-1 || y == previewHeight-1:
+				c.Y = 0xA0
+			case y < cellHeight:
+				c.Y = 0xE0
+			}
+			img.SetGray(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to draw the spreadsheet preview: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -1,14 +1,16 @@
 package docx
 
 import (
-	"archive/zip"
 	"bytes"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"time"
 
+	"github.com/hailam/genfile/internal/adapters/embed"
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/ooxml"
 	"github.com/hailam/genfile/internal/ports"
 	"github.com/hailam/genfile/internal/utils"
 )
@@ -18,27 +20,238 @@ func init() {
 	factory.RegisterGenerator(ports.FileTypeDOCX, New()) //
 }
 
-type DocxGenerator struct{}
+type DocxGenerator struct {
+	opts ports.Options // set by Configure
+	meta ports.Metadata
+	fs   ports.OutputFS // set by WithOutputFS
+	// factory makes the embedded images and spreadsheet; set by
+	// WithFactory.
+	factory ports.GeneratorFactory
+}
 
 func New() ports.FileGenerator {
 	return &DocxGenerator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *DocxGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *DocxGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// WithFactory returns a copy of the generator that makes the embedded
+// files with the generators of f.
+func (g *DocxGenerator) WithFactory(f ports.GeneratorFactory) ports.FileGenerator {
+	c := *g
+	c.factory = f
+	return &c
+}
+
+// docxOptions holds the settings the DOCX generator reads from ports.Options.
+type docxOptions struct {
+	eicar    bool            // first paragraph is the EICAR test string
+	modified time.Time       // part timestamps and core dates; zero for none
+	lang     *utils.Language // paragraph language; nil for random characters
+	needle   utils.Needle    // planted in paragraphs of its own
+	meta     ports.Metadata  // set from the generator, not from options
+
+	images    int      // PNG images shown after the paragraphs
+	imageSize int64    // size of each image
+	sheetSize int64    // size of the embedded spreadsheet; zero for none
+	embedded  embedded // rendered from the above by the generator
+
+	paged bool // paragraphs are laid out paragraphsPerPage to a page; set by ForCount
+
+	signature bool // an empty signature origin part, prepared for signing
+
+	rand *utils.Rand
+}
+
+const (
+	// paragraphsPerPage is how many paragraphs a page holds when a document
+	// is sized by its pages; one-line paragraphs leave room to spare.
+	paragraphsPerPage = 30
+	// maxPages bounds the pages of a document built in memory.
+	maxPages = 100000
+	// maxParagraphs bounds the paragraphs of a document sized by Generate,
+	// some 3 MB of them; a larger target is made up by the padding entry
+	// rather than built in memory.
+	maxParagraphs = 1 << 16
+)
+
+func parseOptions(opts ports.Options) (docxOptions, error) {
+	var o docxOptions
+	var err error
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	if o.eicar, err = opts.Bool("eicar", false); err != nil {
+		return o, err
+	}
+	if o.modified, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.signature, err = opts.Bool("signature-placeholder", false); err != nil {
+		return o, err
+	}
+	if opts.Has("lang") || opts.Has("corpus") {
+		if o.lang, err = utils.TextLanguage(opts.String("lang", ""), opts.String("corpus", "")); err != nil {
+			return o, err
+		}
+	}
+	if o.needle, err = utils.ParseNeedle(opts.String("embed-string", ""), opts.String("embed-count", "")); err != nil {
+		return o, err
+	}
+	if o.images, err = opts.Int("docx-images", 0); err != nil {
+		return o, err
+	}
+	if o.images < 0 {
+		return o, fmt.Errorf("docx-images must not be negative, got %d", o.images)
+	}
+	if o.imageSize, err = utils.ParseSize(opts.String("docx-image-size", "20KB")); err != nil {
+		return o, fmt.Errorf("docx-image-size: %w", err)
+	}
+	if o.imageSize < 1 {
+		return o, fmt.Errorf("docx-image-size must be positive")
+	}
+	if opts.Has("docx-spreadsheet") {
+		if o.sheetSize, err = utils.ParseSize(opts.String("docx-spreadsheet", "")); err != nil {
+			return o, fmt.Errorf("docx-spreadsheet: %w", err)
+		}
+	}
+	return o, nil
+}
+
+// WithMetadata returns a copy of the generator that writes m as document
+// properties.
+func (g *DocxGenerator) WithMetadata(m ports.Metadata) ports.FileGenerator {
+	c := *g
+	c.meta = m
+	return &c
+}
+
 // Generate creates a DOCX file at the given path with the specified size.
 func (g *DocxGenerator) Generate(path string, targetSize int64) error {
-	padOH := utils.ZipEntryOverhead()
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions is like Generate; with the "eicar" option the first
+// paragraph holds the EICAR anti-virus test string, and "mtime" dates the
+// zip entries and the core properties. "lang" writes the paragraphs as
+// sentences in that language, marked right to left for Arabic, and
+// "corpus" as sentences from its files.
+// "embed-string" gets a paragraph of its own "embed-count" times, once if
+// unset, spread evenly among the others. Metadata
+// set with WithMetadata is written to the docProps parts. "docx-images"
+// PNG images of "docx-image-size" bytes follow the paragraphs, then, with
+// "docx-spreadsheet", an embedded XLSX of that size shown as an OLE
+// object; options not starting with "docx-" apply to them.
+// "signature-placeholder" adds the empty signature origin part that
+// prepares the document for signing.
+func (g *DocxGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	o.meta = g.meta
+	if o.embedded, err = renderEmbedded(g.factory, g.fs, o, embed.Options(opts, "docx-")); err != nil {
+		return err
+	}
+	padOH := ooxml.PadOverhead()
 
 	// minimal DOCX (1 para)
-	buf := &bytes.Buffer{}
-	zipWriterMinimal(buf, 1)
-	minimal := int64(buf.Len())
+	minimal := minimalSize(o)
 	if minimal+padOH > targetSize {
 		return fmt.Errorf("target %d too small (min %d + padOH %d)", targetSize, minimal, padOH)
 	}
 
+	_, doc, err := fitParagraphs(targetSize, minimal, padOH, o)
+	if err != nil {
+		return err
+	}
+	return ooxml.WritePadded(g.fs, path, doc.Bytes(), targetSize, o.modified)
+}
+
+// Plan reports the document Generate would write for targetSize: the number
+// of paragraphs and the padding entry that brings it to the target.
+func (g *DocxGenerator) Plan(targetSize int64) (ports.GenerationPlan, error) {
+	padOH := ooxml.PadOverhead()
+	o := docxOptions{rand: utils.SeededRand(0)}
+	plan := ports.GenerationPlan{TargetSize: targetSize, MinSize: minimalSize(o) + padOH}
+	if !plan.Feasible() {
+		return plan, nil
+	}
+	count, doc, err := fitParagraphs(targetSize, plan.MinSize-padOH, padOH, o)
+	if err != nil {
+		return plan, err
+	}
+	plan.ContentBytes = int64(doc.Len())
+	plan.PaddingBytes = targetSize - plan.ContentBytes
+	plan.Structure = []ports.PlanItem{{Name: "paragraphs", Count: int64(count)}}
+	return plan, nil
+}
+
+// ForCount returns a generator of a document of c.N pages, each starting
+// with a page break, and its size. The document is built in memory with
+// the options the generator was configured with, and written without a
+// padding entry at that size.
+func (g *DocxGenerator) ForCount(c ports.Count) (ports.FileGenerator, int64, error) {
+	if c.Unit != ports.CountPages {
+		return nil, 0, fmt.Errorf("DOCX documents are counted in pages, not %s", c.Unit)
+	}
+	if c.N < 1 || c.N > maxPages {
+		return nil, 0, fmt.Errorf("pages must be between 1 and %d, got %d", maxPages, c.N)
+	}
+	o, err := parseOptions(g.opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	o.meta = g.meta
+	if o.embedded, err = renderEmbedded(g.factory, g.fs, o, embed.Options(g.opts, "docx-")); err != nil {
+		return nil, 0, err
+	}
+	o.paged = true
+	var buf bytes.Buffer
+	zipWriterMinimal(&buf, int(c.N)*paragraphsPerPage, o)
+	return ooxml.Built{Package: buf.Bytes(), FS: g.fs}, int64(buf.Len()), nil
+}
+
+// Resize writes the document at srcPath to outPath with its parts as they
+// are and its padding entry sized to bring it to exactly targetSize.
+func (g *DocxGenerator) Resize(srcPath, outPath string, targetSize int64) error {
+	return ooxml.Resize(g.fs, srcPath, outPath, targetSize)
+}
+
+// minimalSize returns the size of a DOCX with one paragraph.
+func minimalSize(o docxOptions) int64 {
+	buf := &bytes.Buffer{}
+	zipWriterMinimal(buf, 1, o)
+	return int64(buf.Len())
+}
+
+// fitParagraphs builds, in memory, the DOCX with the most paragraphs that
+// still fits targetSize once the padding entry is added, up to
+// maxParagraphs. The count is tried at an estimate from the size of 5
+// paragraphs, then searched for by halves below it; the text is random,
+// so it is the most found to fit, not a bound.
+func fitParagraphs(targetSize, minimal, padOH int64, o docxOptions) (int, *bytes.Buffer, error) {
 	// avg per para (5 paras)
 	buf2 := &bytes.Buffer{}
-	zipWriterMinimal(buf2, 5)
+	zipWriterMinimal(buf2, 5, o)
 	avgPara := (int64(buf2.Len()) - minimal) / 5
 	if avgPara < 1 {
 		avgPara = 1
@@ -46,99 +259,111 @@ func (g *DocxGenerator) Generate(path string, targetSize int64) error {
 
 	// initial guess
 	maxUsable := targetSize - padOH
-	estCount := (maxUsable - minimal) / avgPara
+	estCount := min((maxUsable-minimal)/avgPara, maxParagraphs)
 	if estCount < 1 {
 		estCount = 1
 	}
 
-	var finalCount int
-	for cnt := estCount; cnt >= 1; cnt-- {
-		// write cnt paras
-		outF, _ := os.Create(path)
-		zw := zip.NewWriter(outF)
-		writeContentTypes(zw)
-		writeRels(zw)
-		writeDocRels(zw)
-		writeDocumentXML(zw, int(cnt))
-		zw.Close()
-		outF.Close()
-
-		info, _ := os.Stat(path)
-		if info.Size()+padOH <= targetSize {
-			finalCount = int(cnt)
-			break
+	var best *bytes.Buffer
+	count := int64(0)
+	for lo, hi := int64(1), estCount; lo <= hi; {
+		cnt := lo + (hi-lo)/2
+		if hi == estCount {
+			cnt = hi
+		}
+		buf := &bytes.Buffer{}
+		zipWriterMinimal(buf, int(cnt), o)
+		if int64(buf.Len())+padOH <= targetSize {
+			best, count = buf, cnt
+			lo = cnt + 1
+		} else {
+			hi = cnt - 1
 		}
 	}
-	if finalCount == 0 {
-		return errors.New("could not fit even one paragraph")
+	if best == nil {
+		return 0, nil, errors.New("could not fit even one paragraph")
 	}
-
-	// rewrite finalCount
-	outF, _ := os.Create(path)
-	zw := zip.NewWriter(outF)
-	writeContentTypes(zw)
-	writeRels(zw)
-	writeDocRels(zw)
-	writeDocumentXML(zw, finalCount)
-	zw.Close()
-	outF.Close()
-
-	return utils.PadZipExtend(path, targetSize)
-}
-
-// zipWriterMinimal builds a minimal DOCX zip with 'n' paragraphs into w.
-func zipWriterMinimal(w io.Writer, n int) {
-	zw := zip.NewWriter(w)
-	writeContentTypes(zw)
-	writeRels(zw)
-	writeDocRels(zw)
-	writeDocumentXML(zw, n)
-	zw.Close()
-}
-
-// Helpers to write the four minimal parts:
-
-func writeContentTypes(zw *zip.Writer) {
-	mustCreate(zw, "[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
-<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
-  <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
-  <Default Extension="xml" ContentType="application/xml"/>
-  <Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
-</Types>`)
+	return int(count), best, nil
 }
 
-func writeRels(zw *zip.Writer) {
-	mustCreate(zw, "_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
-<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
-  <Relationship Id="rId1"
-    Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument"
-    Target="word/document.xml"/>
-</Relationships>`)
+// documentPart is the main document part, without its body.
+var documentPart = ooxml.Part{
+	Name:        "word/document.xml",
+	ContentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml",
+	RelType:     "http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument",
 }
 
-func writeDocRels(zw *zip.Writer) {
-	mustCreate(zw, "word/_rels/document.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
-<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"/>`)
+// zipWriterMinimal builds a minimal DOCX zip with 'n' paragraphs into w:
+// the main document, its relationships, any embedded parts, any
+// properties parts and, prepared for signing, the signature origin.
+func zipWriterMinimal(w io.Writer, n int, o docxOptions) {
+	pkg := ooxml.NewPackage(w, o.modified)
+	doc := documentPart
+	doc.Body = documentXML(n, o)
+	parts := append([]ooxml.Part{doc}, o.embedded.parts()...)
+	parts = append(parts, ooxml.PropertiesParts(o.meta, o.modified)...)
+	if o.signature {
+		parts = append(parts, ooxml.SignatureOrigin)
+	}
+	pkg.AddContentTypes(parts)
+	pkg.AddRelationships(parts)
+	pkg.Add("word/_rels/document.xml.rels", o.embedded.relationships())
+	pkg.AddParts(parts)
+	pkg.Close()
 }
 
-// writeDocumentXML writes a word/document.xml with n paragraphs of random text.
-func writeDocumentXML(zw *zip.Writer, n int) {
+// documentXML returns a word/document.xml with n paragraphs of random
+// text or sentences in o.lang, the first of which is the EICAR test string
+// if o asks for it, and after them, spread evenly, the paragraphs holding
+// o.needle. With o.paged every paragraphsPerPage-th of the n paragraphs
+// after the first starts a new page.
+func documentXML(n int, o docxOptions) string {
 	buf := &bytes.Buffer{}
 	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
-<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`)
+	if !o.embedded.empty() {
+		buf.WriteString(embeddedNamespaces)
+	}
+	buf.WriteString(`>
   <w:body>
 `)
+	planted := 0
 	for i := 0; i < n; i++ {
-		buf.WriteString("    <w:p><w:r><w:t>")
-		buf.WriteString(utils.RandString(50))
+		eicar := i == 0 && o.eicar
+		rtl := !eicar && o.lang != nil && o.lang.RTL
+		newPage := o.paged && i > 0 && i%paragraphsPerPage == 0
+		buf.WriteString("    <w:p>")
+		if newPage || rtl {
+			buf.WriteString("<w:pPr>")
+			if newPage {
+				buf.WriteString("<w:pageBreakBefore/>")
+			}
+			if rtl {
+				buf.WriteString("<w:bidi/>")
+			}
+			buf.WriteString("</w:pPr>")
+		}
+		buf.WriteString("<w:r>")
+		if rtl {
+			buf.WriteString("<w:rPr><w:rtl/></w:rPr>")
+		}
+		buf.WriteString("<w:t>")
+		switch {
+		case eicar:
+			buf.Write(utils.EICAR()) // no characters that need escaping
+		case o.lang == nil:
+			buf.WriteString(o.rand.String(50))
+		default:
+			buf.WriteString(o.lang.Sentence(o.rand, 4, 10))
+		}
 		buf.WriteString("</w:t></w:r></w:p>\n")
+		for ; planted < o.needle.Count && o.needle.At(planted, int64(n)) <= int64(i); planted++ {
+			buf.WriteString(`    <w:p><w:r><w:t xml:space="preserve">`)
+			xml.EscapeText(buf, []byte(o.needle.Text))
+			buf.WriteString("</w:t></w:r></w:p>\n")
+		}
 	}
+	o.embedded.writeBody(buf)
 	buf.WriteString("    <w:sectPr/>\n  </w:body>\n</w:document>")
-	mustCreate(zw, "word/document.xml", buf.String())
-}
-
-// mustCreate is as before
-func mustCreate(zw *zip.Writer, name, content string) {
-	w, _ := zw.Create(name)
-	w.Write([]byte(content))
+	return buf.String()
 }
@@ -0,0 +1,265 @@
+package dwg
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"unicode/utf16"
+)
+
+// bitWriter writes the bit-coded data of DWG objects and of the header
+// variables and classes sections. Bits fill each byte from the most
+// significant down; multi-byte raw values are little-endian.
+type bitWriter struct {
+	buf []byte
+	n   int64 // bits written, counting those drained
+	off int64 // bits drained
+}
+
+func (w *bitWriter) bits(v uint64, n int) {
+	if n < 64 {
+		v &= 1<<n - 1
+	}
+	used := int((w.n - w.off) % 8)
+	w.n += int64(n)
+	if used != 0 {
+		k := min(8-used, n)
+		w.buf[len(w.buf)-1] |= byte(v>>(n-k)) << (8 - used - k)
+		n -= k
+	}
+	for ; n >= 8; n -= 8 {
+		w.buf = append(w.buf, byte(v>>(n-8)))
+	}
+	if n > 0 {
+		w.buf = append(w.buf, byte(v<<(8-n)))
+	}
+}
+
+// append writes the bits of o after w's.
+func (w *bitWriter) append(o *bitWriter) {
+	n := o.n - o.off
+	if (w.n-w.off)%8 == 0 {
+		w.buf = append(w.buf, o.buf[:(n+7)/8]...)
+		w.n += n
+		return
+	}
+	i := int64(0)
+	for ; i+8 <= n/8; i += 8 {
+		v := binary.BigEndian.Uint64(o.buf[i:])
+		w.bits(v>>32, 32)
+		w.bits(v, 32)
+	}
+	for ; i < n/8; i++ {
+		w.bits(uint64(o.buf[i]), 8)
+	}
+	if r := n % 8; r != 0 {
+		w.bits(uint64(o.buf[n/8]>>(8-r)), int(r))
+	}
+}
+
+// align pads w with zero bits to a whole byte.
+func (w *bitWriter) align() {
+	if r := (w.n - w.off) % 8; r != 0 {
+		w.bits(0, int(8-r))
+	}
+}
+
+// drain returns the whole bytes written since the last drain and keeps
+// any partial byte.
+func (w *bitWriter) drain() []byte {
+	whole := (w.n - w.off) / 8
+	out := append([]byte(nil), w.buf[:whole]...)
+	w.buf = append(w.buf[:0], w.buf[whole:]...)
+	w.off += whole * 8
+	return out
+}
+
+func (w *bitWriter) b(v bool) {
+	if v {
+		w.bits(1, 1)
+	} else {
+		w.bits(0, 1)
+	}
+}
+
+func (w *bitWriter) bb(v byte) { w.bits(uint64(v), 2) }
+func (w *bitWriter) rc(v byte) { w.bits(uint64(v), 8) }
+
+func (w *bitWriter) rs(v uint16) { w.bits(uint64(bits.ReverseBytes16(v)), 16) }
+func (w *bitWriter) rl(v uint32) { w.bits(uint64(bits.ReverseBytes32(v)), 32) }
+func (w *bitWriter) rd(v float64) {
+	w.bits(bits.ReverseBytes64(math.Float64bits(v)), 64)
+}
+
+// bs writes a bit short: 0 and 256 take two bits, a byte ten.
+func (w *bitWriter) bs(v uint16) {
+	switch {
+	case v == 0:
+		w.bb(2)
+	case v == 256:
+		w.bb(3)
+	case v < 256:
+		w.bb(1)
+		w.rc(byte(v))
+	default:
+		w.bb(0)
+		w.rs(v)
+	}
+}
+
+// bl writes a bit long: 0 takes two bits, a byte ten.
+func (w *bitWriter) bl(v uint32) {
+	switch {
+	case v == 0:
+		w.bb(2)
+	case v < 256:
+		w.bb(1)
+		w.rc(byte(v))
+	default:
+		w.bb(0)
+		w.rl(v)
+	}
+}
+
+// bll writes a bit long long: three bits of length, then as many bytes.
+func (w *bitWriter) bll(v uint64) {
+	n := (bits.Len64(v) + 7) / 8
+	w.bits(uint64(n), 3)
+	for range n {
+		w.rc(byte(v))
+		v >>= 8
+	}
+}
+
+// bd writes a bit double: 0 and 1 take two bits.
+func (w *bitWriter) bd(v float64) {
+	switch v {
+	case 0:
+		w.bb(2)
+	case 1:
+		w.bb(1)
+	default:
+		w.bb(0)
+		w.rd(v)
+	}
+}
+
+// dd writes a double with a default, always in full, so that entities
+// take the same room whatever their coordinates.
+func (w *bitWriter) dd(v float64) {
+	w.bb(3)
+	w.rd(v)
+}
+
+// bt writes a thickness, be an extrusion direction: each takes a bit at
+// its default, 0 and the z axis.
+func (w *bitWriter) bt(v float64) {
+	w.b(v == 0)
+	if v != 0 {
+		w.bd(v)
+	}
+}
+
+func (w *bitWriter) be(x, y, z float64) {
+	w.b(x == 0 && y == 0 && z == 1)
+	if x != 0 || y != 0 || z != 1 {
+		w.bd(x)
+		w.bd(y)
+		w.bd(z)
+	}
+}
+
+// ot writes an object type as R2010 and later do.
+func (w *bitWriter) ot(t uint16) {
+	switch {
+	case t < 256:
+		w.bb(0)
+		w.rc(byte(t))
+	case t >= 0x1F0 && t < 0x1F0+256:
+		w.bb(1)
+		w.rc(byte(t - 0x1F0))
+	default:
+		w.bb(2)
+		w.rs(t)
+	}
+}
+
+// handle writes a handle reference: the code and the length of the
+// handle in a byte, then the handle, most significant byte first.
+func (w *bitWriter) handle(code byte, h uint32) {
+	n := handleLen(h)
+	w.rc(code<<4 | byte(n))
+	for i := n - 1; i >= 0; i-- {
+		w.rc(byte(h >> (8 * i)))
+	}
+}
+
+// tu writes a string as R2007 and later do: its length in UTF-16 code
+// units, the terminating zero included, then the units.
+func (w *bitWriter) tu(s string) {
+	u := append(utf16.Encode([]rune(s)), 0)
+	w.bs(uint16(len(u)))
+	for _, c := range u {
+		w.rs(c)
+	}
+}
+
+// handleLen returns how many bytes handle h takes in a reference.
+func handleLen(h uint32) int {
+	return (bits.Len64(uint64(h)) + 7) / 8
+}
+
+// appendMS appends a modular short: 15 bits to each little-endian short,
+// the top bit set on all but the last.
+func appendMS(b []byte, v int64) []byte {
+	for v >= 0x8000 {
+		b = binary.LittleEndian.AppendUint16(b, uint16(v&0x7FFF|0x8000))
+		v >>= 15
+	}
+	return binary.LittleEndian.AppendUint16(b, uint16(v))
+}
+
+// appendUMC appends an unsigned modular char: 7 bits to each byte, the
+// top bit set on all but the last.
+func appendUMC(b []byte, v int64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v&0x7F|0x80))
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendMC appends a signed modular char: as appendUMC, but the last byte
+// keeps 0x40 for the sign.
+func appendMC(b []byte, v int64) []byte {
+	neg := v < 0
+	if neg {
+		v = -v
+	}
+	for v >= 0x40 {
+		b = append(b, byte(v&0x7F|0x80))
+		v >>= 7
+	}
+	if neg {
+		v |= 0x40
+	}
+	return append(b, byte(v))
+}
+
+// umcLen and mcLen return how many bytes appendUMC and appendMC take for
+// v.
+func umcLen(v int64) int64 {
+	n := int64(1)
+	for ; v >= 0x80; v >>= 7 {
+		n++
+	}
+	return n
+}
+
+func mcLen(v int64) int64 {
+	n := int64(1)
+	for v = max(v, -v); v >= 0x40; v >>= 7 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,47 @@
+package dwg
+
+// crc8Table is the table of the 16-bit CRC the DWG specification calls
+// CRC8: CRC-16/ARC, the reflected polynomial 0xA001.
+var crc8Table = func() (t [256]uint16) {
+	for i := range t {
+		c := uint16(i)
+		for range 8 {
+			if c&1 != 0 {
+				c = c>>1 ^ 0xA001
+			} else {
+				c >>= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+// crc8Seed is the seed of the CRCs closing objects, the header variables,
+// the classes and each run of the object map.
+const crc8Seed = 0xC0C1
+
+// crc8 continues the CRC8 seed over data.
+func crc8(seed uint16, data []byte) uint16 {
+	for _, b := range data {
+		seed = seed>>8 ^ crc8Table[byte(seed)^b]
+	}
+	return seed
+}
+
+// pageChecksum continues the checksum of section pages, an Adler-32 with
+// the sums kept apart in the seed, over data.
+func pageChecksum(seed uint32, data []byte) uint32 {
+	sum1, sum2 := seed&0xFFFF, seed>>16
+	for len(data) > 0 {
+		n := min(len(data), 0x15B0)
+		for _, b := range data[:n] {
+			sum1 += uint32(b)
+			sum2 += sum1
+		}
+		sum1 %= 0xFFF1
+		sum2 %= 0xFFF1
+		data = data[n:]
+	}
+	return sum2<<16 | sum1
+}
@@ -0,0 +1,414 @@
+package dwg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The sizes of the parts of an R2004 and later file: a file header, then
+// pages, each a header and data padded to pageAlign, the data of a
+// section's page at most maxPageData before compression; a copy of the
+// encrypted part of the file header ends the file.
+const (
+	fileHeaderSize   = 0x100
+	dataHeaderSize   = 0x20
+	systemHeaderSize = 0x14
+	maxPageData      = 0x7400
+	pageAlign        = 0x20
+	secondHeaderSize = 0x80
+	encryptedSize    = 0x6C
+)
+
+// Page types: the pages of sections, and the two system pages that map
+// the pages and the sections.
+const (
+	dataPage       = 0x4163043B
+	pageMapPage    = 0x41630E3B
+	sectionMapPage = 0x4163003B
+)
+
+// codepageANSI1252 is the number the file header gives the Windows-1252
+// code page.
+const codepageANSI1252 = 30
+
+// section is a section of the file and the pages it is written to.
+type section struct {
+	name       string
+	size       int64 // of its data, before compression
+	compressed bool
+	pages      []page
+}
+
+// page is a page of the file.
+type page struct {
+	number  int32
+	address int64 // of its header in the file
+	size    int64 // in the file: header, data and padding
+	offset  int64 // of its data in the section
+	length  int64 // of its data, before compression
+}
+
+// splitPages returns how a section of size bytes splits into pages: full
+// ones of maxPageData, then the lengths of the rest. The last page of a
+// compressed section holds at least 4 bytes, the shortest run of literal
+// bytes that can start its data.
+func splitPages(size int64, compressed bool) (full int64, rest []int64) {
+	full, last := size/maxPageData, size%maxPageData
+	switch {
+	case last == 0 && full > 0:
+		return full, nil
+	case compressed && last < 4 && full > 0:
+		return full - 1, []int64{maxPageData - 4, last + 4}
+	default:
+		return full, []int64{last}
+	}
+}
+
+// sectionSize returns how many pages a section of size bytes takes, and
+// how many bytes they come to.
+func sectionSize(size int64, compressed bool) (pages, bytes int64) {
+	full, rest := splitPages(size, compressed)
+	pages, bytes = full, full*pageSize(dataHeaderSize, maxPageData, compressed)
+	for _, n := range rest {
+		pages++
+		bytes += pageSize(dataHeaderSize, n, compressed)
+	}
+	return pages, bytes
+}
+
+// pageSize returns how many bytes a page takes whose header takes header
+// bytes and whose data n before compression.
+func pageSize(header, n int64, compressed bool) int64 {
+	return align(header + storedLen(n, compressed))
+}
+
+func align(n int64) int64 {
+	return (n + pageAlign - 1) / pageAlign * pageAlign
+}
+
+// storedLen returns how many bytes n bytes of data take in a page.
+func storedLen(n int64, compressed bool) int64 {
+	if !compressed {
+		return n
+	}
+	return literalRunLen(n) + n + 1
+}
+
+// literalRunLen returns how many bytes literalRun(n) takes.
+func literalRunLen(n int64) int64 {
+	switch {
+	case n == 0:
+		return 0
+	case n <= 0x12:
+		return 1
+	}
+	return 2 + (n-0x13)/0xFF
+}
+
+// literalRun returns the bytes that start a run of n literal bytes in
+// compressed data, n either 0 or at least 4.
+func literalRun(n int64) []byte {
+	switch {
+	case n == 0:
+		return nil
+	case n <= 0x12:
+		return []byte{byte(n - 3)}
+	}
+	b := []byte{0}
+	for n -= 0x12; n > 0xFF; n -= 0xFF {
+		b = append(b, 0)
+	}
+	return append(b, byte(n))
+}
+
+// compress returns data as compressed data: all of it a run of literal
+// bytes, then the opcode that ends the data.
+func compress(data []byte) []byte {
+	out := append(literalRun(int64(len(data))), data...)
+	return append(out, 0x11)
+}
+
+// mapSizes returns how many bytes the data of the section map and the
+// page map take for sections and pages in all.
+func mapSizes(sections []*section, pages int64) (sectionMap, pageMap int64) {
+	sectionMap = 20
+	for _, s := range sections {
+		n, _ := sectionSize(s.size, s.compressed)
+		sectionMap += 0x60 + 16*n
+	}
+	return sectionMap, 8 * pages
+}
+
+// layout places the pages of sections, the section map and the page
+// map, padding the last page of the last section by padding bytes.
+type layout struct {
+	sections            []*section
+	sectionMap, pageMap page
+	end                 int64 // where the second header goes
+}
+
+func newLayout(sections []*section, padding int64) *layout {
+	l := &layout{sections: sections}
+	number, address := int32(1), int64(fileHeaderSize)
+	add := func(offset, length, size int64) page {
+		p := page{number: number, address: address, size: size, offset: offset, length: length}
+		number++
+		address += size
+		return p
+	}
+	for _, s := range sections {
+		s.pages = s.pages[:0]
+		full, rest := splitPages(s.size, s.compressed)
+		offset := int64(0)
+		for n := range full + int64(len(rest)) {
+			length := int64(maxPageData)
+			if n >= full {
+				length = rest[n-full]
+			}
+			s.pages = append(s.pages, add(offset, length, pageSize(dataHeaderSize, length, s.compressed)))
+			offset += length
+		}
+	}
+	last := &sections[len(sections)-1].pages[len(sections[len(sections)-1].pages)-1]
+	last.size += padding
+	address += padding
+	sectionMap, pageMap := mapSizes(sections, int64(number)+1)
+	l.sectionMap = add(0, sectionMap, pageSize(systemHeaderSize, sectionMap, true))
+	l.pageMap = add(0, pageMap, pageSize(systemHeaderSize, pageMap, true))
+	l.end = address
+	return l
+}
+
+// fileSize returns how long a file of sections is, unpadded.
+func fileSize(sections []*section) int64 {
+	size, pages := int64(fileHeaderSize), int64(2)
+	for _, s := range sections {
+		n, bytes := sectionSize(s.size, s.compressed)
+		pages += n
+		size += bytes
+	}
+	sectionMap, pageMap := mapSizes(sections, pages)
+	return size + pageSize(systemHeaderSize, sectionMap, true) + pageSize(systemHeaderSize, pageMap, true) + secondHeaderSize
+}
+
+// find returns the section named name.
+func (l *layout) find(name string) *section {
+	for _, s := range l.sections {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// magic returns the first n bytes of the sequence the file header is
+// encrypted with, from a linear congruential generator seeded with 1.
+func magic(n int) []byte {
+	b := make([]byte, n)
+	seed := uint32(1)
+	for i := range b {
+		seed = seed*0x343FD + 0x269EC3
+		b[i] = byte(seed >> 16)
+	}
+	return b
+}
+
+// fileHeader returns the file header: the version and the addresses of
+// the preview and summary, then the encrypted part, which locates the
+// maps.
+func (l *layout) fileHeader() []byte {
+	h := make([]byte, fileHeaderSize)
+	le := binary.LittleEndian
+	copy(h, "AC1032")
+	h[0x0C] = 3
+	if s := l.find("AcDb:Preview"); s != nil {
+		le.PutUint32(h[0x0D:], uint32(s.pages[0].address+dataHeaderSize))
+	}
+	h[0x11] = 0x21 // written by the R2018 release
+	le.PutUint16(h[0x13:], codepageANSI1252)
+	if s := l.find("AcDb:SummaryInfo"); s != nil {
+		le.PutUint32(h[0x20:], uint32(s.pages[0].address+dataHeaderSize))
+	}
+	le.PutUint32(h[0x28:], 0x80)
+	copy(h[0x80:], l.encryptedHeader())
+	return h
+}
+
+// encryptedHeader returns the encrypted part of the file header, and its
+// copy at the end: where the page map and the last page are, and how many
+// pages there are, with a CRC-32.
+func (l *layout) encryptedHeader() []byte {
+	h := make([]byte, encryptedSize)
+	le := binary.LittleEndian
+	copy(h, "AcFssFcAJMB\x00")
+	le.PutUint32(h[0x10:], encryptedSize)
+	le.PutUint32(h[0x14:], 4)
+	le.PutUint32(h[0x24:], 1)
+	le.PutUint32(h[0x28:], uint32(l.pageMap.number))
+	le.PutUint64(h[0x2C:], uint64(l.end))
+	le.PutUint64(h[0x34:], uint64(l.end))
+	le.PutUint32(h[0x40:], uint32(l.pageMap.number))
+	le.PutUint32(h[0x44:], 0x20)
+	le.PutUint32(h[0x48:], 0x80)
+	le.PutUint32(h[0x4C:], 0x40)
+	le.PutUint32(h[0x50:], uint32(l.pageMap.number))
+	le.PutUint64(h[0x54:], uint64(l.pageMap.address-fileHeaderSize))
+	le.PutUint32(h[0x5C:], uint32(l.sectionMap.number))
+	le.PutUint32(h[0x60:], uint32(l.pageMap.number))
+	le.PutUint32(h[0x68:], crc32.ChecksumIEEE(h))
+	key := magic(secondHeaderSize)
+	out := make([]byte, secondHeaderSize)
+	for i := range h {
+		out[i] = h[i] ^ key[i]
+	}
+	copy(out[encryptedSize:], key[encryptedSize:])
+	return out
+}
+
+// writePage writes the page p of section id, whose data is data, to w:
+// its header, encrypted with its address, and its data, padded.
+func writePage(w io.Writer, id int, compressed bool, p page, data []byte) error {
+	stored := data
+	if compressed {
+		stored = compress(data)
+	}
+	h := make([]byte, dataHeaderSize)
+	le := binary.LittleEndian
+	le.PutUint32(h[0x00:], dataPage)
+	le.PutUint32(h[0x04:], uint32(id))
+	le.PutUint32(h[0x08:], uint32(len(stored)))
+	le.PutUint32(h[0x0C:], uint32(len(data)))
+	le.PutUint32(h[0x10:], uint32(p.offset))
+	le.PutUint32(h[0x18:], pageChecksum(0, stored))
+	le.PutUint32(h[0x14:], pageChecksum(le.Uint32(h[0x18:]), h))
+	mask := 0x4164536B ^ uint32(p.address)
+	for i := 0; i < dataHeaderSize; i += 4 {
+		le.PutUint32(h[i:], le.Uint32(h[i:])^mask)
+	}
+	return writePadded(w, p.size, h, stored)
+}
+
+// writeSystemPage writes the system page p of type typ holding data to
+// w.
+func writeSystemPage(w io.Writer, typ uint32, p page, data []byte) error {
+	stored := compress(data)
+	h := make([]byte, systemHeaderSize)
+	le := binary.LittleEndian
+	le.PutUint32(h[0x00:], typ)
+	le.PutUint32(h[0x04:], uint32(len(data)))
+	le.PutUint32(h[0x08:], uint32(len(stored)))
+	le.PutUint32(h[0x0C:], 2) // compressed
+	le.PutUint32(h[0x10:], pageChecksum(pageChecksum(0, h), stored))
+	return writePadded(w, p.size, h, stored)
+}
+
+// writePadded writes header and data to w, then zeros to size bytes.
+func writePadded(w io.Writer, size int64, header, data []byte) error {
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	pad := size - int64(len(header)+len(data))
+	if pad < 0 {
+		return fmt.Errorf("page of %d bytes overflows its %d", len(header)+len(data), size)
+	}
+	_, err := w.Write(make([]byte, pad))
+	return err
+}
+
+// sectionMapData returns the data of the section map: for each section its
+// size, its page size, whether it is compressed and its name, and for
+// each of its pages its number, its length in the file and where its data
+// goes in the section.
+func (l *layout) sectionMapData() []byte {
+	le := binary.LittleEndian
+	var b []byte
+	b = le.AppendUint32(b, uint32(len(l.sections)))
+	b = le.AppendUint32(b, 2)
+	b = le.AppendUint32(b, maxPageData)
+	b = le.AppendUint32(b, 0)
+	b = le.AppendUint32(b, uint32(len(l.sections)))
+	for id, s := range l.sections {
+		b = le.AppendUint64(b, uint64(s.size))
+		b = le.AppendUint32(b, uint32(len(s.pages)))
+		b = le.AppendUint32(b, maxPageData)
+		b = le.AppendUint32(b, 1)
+		if s.compressed {
+			b = le.AppendUint32(b, 2)
+		} else {
+			b = le.AppendUint32(b, 1)
+		}
+		b = le.AppendUint32(b, uint32(id+1))
+		b = le.AppendUint32(b, 0) // not encrypted
+		var name [64]byte
+		copy(name[:], s.name)
+		b = append(b, name[:]...)
+		for _, p := range s.pages {
+			b = le.AppendUint32(b, uint32(p.number))
+			b = le.AppendUint32(b, uint32(storedLen(p.length, s.compressed)))
+			b = le.AppendUint64(b, uint64(p.offset))
+		}
+	}
+	return b
+}
+
+// pageMapData returns the data of the page map: the number and size of
+// every page in the file, in order.
+func (l *layout) pageMapData() []byte {
+	le := binary.LittleEndian
+	var b []byte
+	add := func(p page) {
+		b = le.AppendUint32(b, uint32(p.number))
+		b = le.AppendUint32(b, uint32(p.size))
+	}
+	for _, s := range l.sections {
+		for _, p := range s.pages {
+			add(p)
+		}
+	}
+	add(l.sectionMap)
+	add(l.pageMap)
+	return b
+}
+
+// sectionWriter writes the data of a section to its pages as it comes.
+type sectionWriter struct {
+	w    io.Writer
+	id   int
+	s    *section
+	next int // index of the page being filled
+	buf  []byte
+}
+
+func (sw *sectionWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		if sw.next >= len(sw.s.pages) {
+			return 0, fmt.Errorf("section %s runs past its %d bytes", sw.s.name, sw.s.size)
+		}
+		p := sw.s.pages[sw.next]
+		k := min(int64(len(b)), p.length-int64(len(sw.buf)))
+		sw.buf = append(sw.buf, b[:k]...)
+		b = b[k:]
+		if int64(len(sw.buf)) == p.length {
+			if err := writePage(sw.w, sw.id, sw.s.compressed, p, sw.buf); err != nil {
+				return 0, err
+			}
+			sw.buf = sw.buf[:0]
+			sw.next++
+		}
+	}
+	return n, nil
+}
+
+// Close checks the section was written in full.
+func (sw *sectionWriter) Close() error {
+	if sw.next < len(sw.s.pages) {
+		return fmt.Errorf("section %s stops short of its %d bytes", sw.s.name, sw.s.size)
+	}
+	return nil
+}
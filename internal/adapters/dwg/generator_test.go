@@ -0,0 +1,467 @@
+package dwg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func TestDWGGenerator_Generate(t *testing.T) {
+	generator := New()
+	smallest := minSize()
+	testCases := []struct {
+		name   string
+		size   int64
+		errSub string
+	}{
+		{name: "Smallest", size: smallest},
+		{name: "OneMore", size: smallest + 1},
+		{name: "Small", size: 5000},
+		{name: "ManyPages", size: 300 * 1024},
+		{name: "Large", size: 3 * 1024 * 1024},
+		{name: "TooSmall", size: smallest - 1, errSub: "too small"},
+		{name: "Zero", size: 0, errSub: "too small"},
+		{name: "TooLarge", size: 1 << 32, errSub: "too large"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "drawing.dwg")
+			err := generator.Generate(path, tc.size)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("Generate() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() unexpected error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			sections := readDWG(t, data)
+			entities := checkObjects(t, sections[sectionObjects], sections[sectionHandles])
+			checkBitSection(t, sectionHeader, specHeaderSentinel, sections[sectionHeader])
+			checkBitSection(t, sectionClasses, specClassesSentinel, sections[sectionClasses])
+			if tc.size >= 5000 && entities == 0 {
+				t.Errorf("no entities in %d bytes", tc.size)
+			}
+		})
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	if got := crc8(0, []byte("123456789")); got != 0xBB3D {
+		t.Errorf("crc8 = %#04x, want 0xbb3d", got)
+	}
+	if got := pageChecksum(0, []byte("123456789")); got != 0x091501DD {
+		t.Errorf("pageChecksum = %#08x, want 0x091501dd", got)
+	}
+	if got := magic(len(specMagic)); !bytes.Equal(got, specMagic) {
+		t.Errorf("magic = % x, want % x", got, specMagic)
+	}
+}
+
+// TestDWGGenerator_FixedBytes checks the parts of the smallest drawing
+// that are the same in every file against the bytes expected of them: the
+// file header with its encrypted part, the section map, the page map and
+// the second header.
+func TestDWGGenerator_FixedBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drawing.dwg")
+	if err := New().Generate(path, minSize()); err != nil {
+		t.Fatalf("Generate() unexpected error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0x800 {
+		t.Fatalf("smallest drawing is %d bytes, want 2048", len(data))
+	}
+	for _, tc := range []struct {
+		name   string
+		offset int
+		want   string
+	}{
+		{"FileHeader", 0, smallestFileHeader},
+		{"SectionMap", 0x440, smallestSectionMap},
+		{"PageMap", 0x720, smallestPageMap},
+		{"SecondHeader", 0x780, smallestFileHeader[2*0x80:]},
+	} {
+		want, err := hex.DecodeString(tc.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := data[tc.offset : tc.offset+len(want)]; !bytes.Equal(got, want) {
+			t.Errorf("%s = % x\nwant % x", tc.name, got, want)
+		}
+	}
+}
+
+func TestJulian(t *testing.T) {
+	day, ms := julian(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	if day != 2451545 || ms != 12*3600*1000 {
+		t.Errorf("julian = %d, %d; want 2451545, 43200000", day, ms)
+	}
+}
+
+// minSize returns the size of a drawing without entities.
+func minSize() int64 {
+	d, err := newDrawing(1<<20, time.Now(), utils.SeededRand(0))
+	if err != nil {
+		panic(err)
+	}
+	return fileSize(d.sections(0, 0, 0))
+}
+
+// readDWG checks the file header, the page map, the section map and the
+// headers and checksums of every page, and returns the data of each
+// section by name.
+func readDWG(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	le := binary.LittleEndian
+	if string(data[:6]) != "AC1032" {
+		t.Fatalf("version = %q, want AC1032", data[:6])
+	}
+	h := make([]byte, specEncryptedSize)
+	key := specMagic
+	for i := range h {
+		h[i] = data[0x80+i] ^ key[i]
+	}
+	if string(h[:11]) != "AcFssFcAJMB" {
+		t.Fatalf("file ID = %q", h[:11])
+	}
+	crc := le.Uint32(h[0x68:])
+	le.PutUint32(h[0x68:], 0)
+	if got := crc32.ChecksumIEEE(h); got != crc {
+		t.Fatalf("file header CRC = %#x, want %#x", got, crc)
+	}
+	if !bytes.Equal(data[len(data)-specSecondHeaderSize:], data[0x80:specFileHeaderSize]) {
+		t.Error("second header differs from the file header")
+	}
+
+	pageMap := readSystemPage(t, data, int64(le.Uint64(h[0x54:]))+specFileHeaderSize, specPageMapPage)
+	addresses := make(map[uint32]int64)
+	address := int64(specFileHeaderSize)
+	for b := pageMap; len(b) > 0; b = b[8:] {
+		addresses[le.Uint32(b)] = address
+		address += int64(le.Uint32(b[4:]))
+	}
+	if address != int64(len(data))-specSecondHeaderSize {
+		t.Fatalf("pages end at %d, want %d", address, len(data)-specSecondHeaderSize)
+	}
+	if got := int64(le.Uint64(h[0x2C:])); got != address {
+		t.Errorf("last page at %d, want %d", got, address)
+	}
+	sectionMap := readSystemPage(t, data, addresses[le.Uint32(h[0x5C:])], specSectionMapPage)
+
+	sections := make(map[string][]byte)
+	count := le.Uint32(sectionMap)
+	b := sectionMap[20:]
+	for range count {
+		size := int64(le.Uint64(b))
+		pages := le.Uint32(b[8:])
+		compressed := le.Uint32(b[20:]) == 2
+		id := le.Uint32(b[24:])
+		name := string(bytes.TrimRight(b[32:96], "\x00"))
+		b = b[96:]
+		var section []byte
+		for range pages {
+			number, stored, offset := le.Uint32(b), le.Uint32(b[4:]), int64(le.Uint64(b[8:]))
+			b = b[16:]
+			if offset != int64(len(section)) {
+				t.Fatalf("%s: page at offset %d, want %d", name, offset, len(section))
+			}
+			section = append(section, readDataPage(t, data, addresses[number], id, stored, compressed)...)
+		}
+		if int64(len(section)) != size {
+			t.Fatalf("%s: %d bytes, want %d", name, len(section), size)
+		}
+		sections[name] = section
+	}
+	for _, name := range []string{sectionSummary, sectionPreview, sectionHeader, sectionClasses, sectionObjects, sectionHandles} {
+		if _, ok := sections[name]; !ok {
+			t.Fatalf("no section %s", name)
+		}
+	}
+	return sections
+}
+
+// readSystemPage checks the header of the page map or section map at
+// address and returns its data.
+func readSystemPage(t *testing.T, data []byte, address int64, typ uint32) []byte {
+	t.Helper()
+	le := binary.LittleEndian
+	h := append([]byte(nil), data[address:address+specSystemHeaderSize]...)
+	if got := le.Uint32(h); got != typ {
+		t.Fatalf("page at %d has type %#x, want %#x", address, got, typ)
+	}
+	size, stored := le.Uint32(h[4:]), le.Uint32(h[8:])
+	payload := data[address+specSystemHeaderSize : address+specSystemHeaderSize+int64(stored)]
+	sum := le.Uint32(h[0x10:])
+	le.PutUint32(h[0x10:], 0)
+	if got := pageChecksum(pageChecksum(0, h), payload); got != sum {
+		t.Fatalf("page at %d: checksum %#x, want %#x", address, got, sum)
+	}
+	out := decompress(t, payload)
+	if uint32(len(out)) != size {
+		t.Fatalf("page at %d: %d bytes, want %d", address, len(out), size)
+	}
+	return out
+}
+
+// readDataPage checks the header of the page of section id at address
+// and returns its data.
+func readDataPage(t *testing.T, data []byte, address int64, id, stored uint32, compressed bool) []byte {
+	t.Helper()
+	le := binary.LittleEndian
+	h := append([]byte(nil), data[address:address+specDataHeaderSize]...)
+	mask := 0x4164536B ^ uint32(address)
+	for i := 0; i < specDataHeaderSize; i += 4 {
+		le.PutUint32(h[i:], le.Uint32(h[i:])^mask)
+	}
+	if le.Uint32(h) != specDataPage || le.Uint32(h[4:]) != id || le.Uint32(h[8:]) != stored {
+		t.Fatalf("page at %d: header % x, want section %d, %d bytes", address, h, id, stored)
+	}
+	payload := data[address+specDataHeaderSize : address+specDataHeaderSize+int64(stored)]
+	dataSum := le.Uint32(h[0x18:])
+	if got := pageChecksum(0, payload); got != dataSum {
+		t.Fatalf("page at %d: data checksum %#x, want %#x", address, got, dataSum)
+	}
+	headerSum := le.Uint32(h[0x14:])
+	le.PutUint32(h[0x14:], 0)
+	if got := pageChecksum(dataSum, h); got != headerSum {
+		t.Fatalf("page at %d: header checksum %#x, want %#x", address, got, headerSum)
+	}
+	if !compressed {
+		return payload
+	}
+	out := decompress(t, payload)
+	if uint32(len(out)) != le.Uint32(h[0x0C:]) {
+		t.Fatalf("page at %d: %d bytes, want %d", address, len(out), le.Uint32(h[0x0C:]))
+	}
+	return out
+}
+
+// decompress decompresses data holding only a run of literal bytes.
+func decompress(t *testing.T, b []byte) []byte {
+	t.Helper()
+	n := 0
+	switch {
+	case b[0] == 0:
+		n = 0x12
+		for b = b[1:]; b[0] == 0; b = b[1:] {
+			n += 0xFF
+		}
+		n += int(b[0])
+		b = b[1:]
+	case b[0] < 0x10:
+		n = int(b[0]) + 3
+		b = b[1:]
+	}
+	if len(b) != n+1 || b[n] != 0x11 {
+		t.Fatalf("compressed data of %d bytes does not end after %d literal bytes", len(b), n)
+	}
+	return b[:n]
+}
+
+// checkObjects walks the object map, checking each run and the CRC of
+// every object it locates, and returns how many entities there are.
+func checkObjects(t *testing.T, objects, handles []byte) int {
+	t.Helper()
+	if got := binary.LittleEndian.Uint32(objects); got != specObjectsMagic {
+		t.Fatalf("objects start with %#x, want %#x", got, specObjectsMagic)
+	}
+	entities, seen := 0, make(map[int64]bool)
+	for {
+		size := int(binary.BigEndian.Uint16(handles))
+		if size > maxMapRun {
+			t.Fatalf("map run of %d bytes", size)
+		}
+		run := handles[:size]
+		if got, want := crc8(specCRCSeed, run), binary.BigEndian.Uint16(handles[size:]); got != want {
+			t.Fatalf("map run CRC %#x, want %#x", got, want)
+		}
+		handles = handles[size+2:]
+		if size == 2 {
+			break
+		}
+		var h, off int64
+		for run = run[2:]; len(run) > 0; {
+			var dh, doff int64
+			dh, run = readUMC(run)
+			doff, run = readMC(run)
+			h, off = h+dh, off+doff
+			if seen[h] {
+				t.Fatalf("handle %#x mapped twice", h)
+			}
+			seen[h] = true
+			if h >= firstEntity {
+				entities++
+			}
+			checkObject(t, h, objects[off:])
+		}
+	}
+	if len(handles) != 0 {
+		t.Fatalf("%d bytes after the object map", len(handles))
+	}
+	for h := int64(handleBlockControl); h <= handleContinuous; h++ {
+		if !seen[h] {
+			t.Errorf("table object %#x not mapped", h)
+		}
+	}
+	return entities
+}
+
+// checkObject checks the CRC of the object of handle h that b starts with.
+func checkObject(t *testing.T, h int64, b []byte) {
+	t.Helper()
+	var size int64
+	for i, shift := 0, 0; ; i, shift = i+2, shift+15 {
+		v := binary.LittleEndian.Uint16(b[i:])
+		size |= int64(v&0x7FFF) << shift
+		if v&0x8000 == 0 {
+			size += int64(i) + 2
+			break
+		}
+	}
+	if got, want := crc8(specCRCSeed, b[:size]), binary.LittleEndian.Uint16(b[size:]); got != want {
+		t.Fatalf("object %#x: CRC %#x, want %#x", h, got, want)
+	}
+}
+
+func readUMC(b []byte) (int64, []byte) {
+	var v int64
+	for i := 0; ; i++ {
+		v |= int64(b[i]&0x7F) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return v, b[i+1:]
+		}
+	}
+}
+
+func readMC(b []byte) (int64, []byte) {
+	var v int64
+	for i := 0; ; i++ {
+		if b[i]&0x80 == 0 {
+			v |= int64(b[i]&0x3F) << (7 * i)
+			if b[i]&0x40 != 0 {
+				v = -v
+			}
+			return v, b[i+1:]
+		}
+		v |= int64(b[i]&0x7F) << (7 * i)
+	}
+}
+
+// checkBitSection checks the sentinels, size and CRC of the header
+// variables or classes section.
+func checkBitSection(t *testing.T, name string, sentinel [16]byte, b []byte) {
+	t.Helper()
+	if !bytes.Equal(b[:16], sentinel[:]) {
+		t.Fatalf("%s: start sentinel % x", name, b[:16])
+	}
+	for i, c := range b[len(b)-16:] {
+		if c != ^sentinel[i] {
+			t.Fatalf("%s: end sentinel % x", name, b[len(b)-16:])
+		}
+	}
+	body := b[16 : len(b)-16]
+	size := int(binary.LittleEndian.Uint32(body))
+	if 8+size+2 != len(body) {
+		t.Fatalf("%s: size %d for %d bytes", name, size, len(body))
+	}
+	if got, want := crc8(specCRCSeed, body[:8+size]), binary.LittleEndian.Uint16(body[8+size:]); got != want {
+		t.Fatalf("%s: CRC %#x, want %#x", name, got, want)
+	}
+}
+
+// The values of the Open Design Specification for .dwg files the reader
+// checks against, spelled out rather than taken from the writer, so that
+// a wrong constant there fails the tests.
+const (
+	specFileHeaderSize   = 0x100
+	specSecondHeaderSize = 0x80
+	specEncryptedSize    = 0x6C
+	specSystemHeaderSize = 0x14
+	specDataHeaderSize   = 0x20
+	specDataPage         = 0x4163043B
+	specPageMapPage      = 0x41630E3B
+	specSectionMapPage   = 0x4163003B
+	specObjectsMagic     = 0x0DCA
+	specCRCSeed          = 0xC0C1
+)
+
+// specMagic is the sequence the encrypted part of the file header is
+// XORed with.
+var specMagic = []byte{
+	0x29, 0x23, 0xBE, 0x84, 0xE1, 0x6C, 0xD6, 0xAE, 0x52, 0x90, 0x49, 0xF1,
+	0xF1, 0xBB, 0xE9, 0xEB, 0xB3, 0xA6, 0xDB, 0x3C, 0x87, 0x0C, 0x3E, 0x99,
+	0x24, 0x5E, 0x0D, 0x1C, 0x06, 0xB7, 0x47, 0xDE, 0xB3, 0x12, 0x4D, 0xC8,
+	0x43, 0xBB, 0x8B, 0xA6, 0x1F, 0x03, 0x5A, 0x7D, 0x09, 0x38, 0x25, 0x1F,
+	0x5D, 0xD4, 0xCB, 0xFC, 0x96, 0xF5, 0x45, 0x3B, 0x13, 0x0D, 0x89, 0x0A,
+	0x1C, 0xDB, 0xAE, 0x32, 0x20, 0x9A, 0x50, 0xEE, 0x40, 0x78, 0x36, 0xFD,
+	0x12, 0x49, 0x32, 0xF6, 0x9E, 0x7D, 0x49, 0xDC, 0xAD, 0x4F, 0x14, 0xF2,
+	0x44, 0x40, 0x66, 0xD0, 0x6B, 0xC4, 0x30, 0xB7, 0x32, 0x3B, 0xA1, 0x22,
+	0xF6, 0x22, 0x91, 0x9D, 0xE1, 0x8B, 0x1F, 0xDA, 0xB0, 0xCA, 0x99, 0x02,
+}
+
+// The sentinels framing the header variables and the classes.
+var (
+	specHeaderSentinel  = [16]byte{0xCF, 0x7B, 0x1F, 0x23, 0xFD, 0xDE, 0x38, 0xA9, 0x5F, 0x7C, 0x68, 0xB8, 0x4E, 0x6D, 0x33, 0x5F}
+	specClassesSentinel = [16]byte{0x8D, 0xA1, 0xC4, 0xB8, 0xC4, 0xA9, 0xF8, 0xC5, 0xC0, 0xDC, 0xF4, 0x5F, 0xE7, 0xCF, 0xB6, 0x8A}
+)
+
+// The fixed parts of the smallest drawing, in hex: its file header, which
+// ends in the second header, its section map page and its page map page.
+const (
+	smallestFileHeader = "" +
+		"41433130333200000000000003e001000021001e000000000000000000000000" +
+		"2001000000000000800000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"6840f8f7922ab5ef18dd0bf1f1bbe9ebdfa6db3c830c3e99245e0d1c06b747de" +
+		"b3124dc842bb8ba617035a7d893f251f5dd4cbfc16f2453b130d890a1cdbae32" +
+		"289a50ee607836fd924932f6de7d49dca54f14f2644666d06bc430b7353ba122" +
+		"fe22919de18b1fda13722807b9729d492c807ec599d5e980b2eac9cc53bf67d6"
+	smallestSectionMap = "" +
+		"3b006341b4020000b9020000020000004127435c000000a40600000002000000" +
+		"007400000000000006000000a000000000000000010000000074000001000000" +
+		"010000000100000000000000416344623a53756d6d617279496e666f00000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"00000000000000000000000001000000a0000000000000000000000025000000" +
+		"0000000001000000007400000100000001000000020000000000000041634462" +
+		"3a50726576696577000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000002000000" +
+		"2500000000000000000000005400000000000000010000000074000001000000" +
+		"020000000300000000000000416344623a486561646572000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000300000057000000000000000000000033000000" +
+		"0000000001000000007400000100000002000000040000000000000041634462" +
+		"3a436c6173736573000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000004000000" +
+		"360000000000000000000000c900000000000000010000000074000001000000" +
+		"020000000500000000000000416344623a416344624f626a6563747300000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"00000000000000000000000005000000cc000000000000000000000016000000" +
+		"0000000001000000007400000100000002000000060000000000000041634462" +
+		"3a48616e646c6573000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000006000000" +
+		"19000000000000000000000011"
+	smallestPageMap = "" +
+		"3b0e634140000000430000000200000058058b01002e01000000c00000000200" +
+		"0000600000000300000080000000040000006000000005000000000100000600" +
+		"00004000000007000000e0020000080000006000000011"
+)
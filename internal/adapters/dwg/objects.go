@@ -0,0 +1,338 @@
+package dwg
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// Object types.
+const (
+	typeCircle       = 0x12
+	typeLine         = 0x13
+	typeBlockControl = 0x30
+	typeBlockHeader  = 0x31
+	typeLayerControl = 0x32
+	typeLayer        = 0x33
+	typeLtypeControl = 0x38
+	typeLtype        = 0x39
+)
+
+// Handles of the table objects. Entities are numbered from firstEntity
+// on, lines on even handles and circles on odd ones.
+const (
+	handleBlockControl = 1
+	handleModelSpace   = 2
+	handleLayerControl = 3
+	handleLayer0       = 4
+	handleLtypeControl = 5
+	handleContinuous   = 6
+	firstEntity        = 0x100
+)
+
+// Handle reference codes.
+const (
+	softOwner   = 2
+	hardOwner   = 3
+	softPointer = 4
+	hardPointer = 5
+)
+
+// objectsMagic starts the AcDb:AcDbObjects section.
+const objectsMagic = 0x0DCA
+
+// object is an object being encoded: its data stream, the strings that
+// R2007 and later keep apart from it, and its handle stream.
+type object struct {
+	data, strs, handles bitWriter
+}
+
+// newObject starts an object of type typ: the type, the handle and empty
+// extended data; for a non-entity, also no reactors and no extension
+// dictionary, and for entity only the owner reference in the handles.
+func newObject(typ uint16, handle, owner uint32) *object {
+	o := &object{}
+	o.data.ot(typ)
+	o.data.handle(0, handle)
+	o.data.bs(0)    // no extended data
+	o.data.bl(0)    // no reactors
+	o.data.b(true)  // no extension dictionary
+	o.data.b(false) // no binary data
+	o.handles.handle(softPointer, owner)
+	return o
+}
+
+// newEntity starts an entity of type typ in model space, on layer 0, with
+// every property by layer.
+func newEntity(typ uint16, handle uint32) *object {
+	o := &object{data: bitWriter{buf: make([]byte, 0, 64)}}
+	o.data.ot(typ)
+	o.data.handle(0, handle)
+	o.data.append(entityCommon())
+	o.handles.handle(hardPointer, handleLayer0)
+	return o
+}
+
+// entityCommon holds what follows the handle of every entity.
+var entityCommon = sync.OnceValue(func() *bitWriter {
+	w := &bitWriter{}
+	w.bs(0)    // no extended data
+	w.b(false) // no proxy graphics
+	w.bb(2)    // in model space, so no owner reference
+	w.bl(0)    // no reactors
+	w.b(true)  // no extension dictionary
+	w.b(false) // no binary data
+	w.bs(256)  // color by layer
+	w.bd(1)    // linetype scale
+	w.bb(0)    // linetype by layer
+	w.bb(0)    // plot style by layer
+	w.bb(0)    // material by layer
+	w.rc(0)    // shadows
+	w.b(false) // no full visual style
+	w.b(false) // no face visual style
+	w.b(false) // no edge visual style
+	w.bs(0)    // visible
+	w.rc(0x1D) // line weight by layer
+	return w
+})
+
+// tableEntry writes the name and the xref fields every table entry
+// starts with.
+func (o *object) tableEntry(name string) {
+	o.strs.tu(name)
+	o.data.b(false) // not referenced
+	o.data.bs(0)    // no xref index
+	o.data.b(false) // not xref dependent
+}
+
+// bytes returns the object as it goes into the objects section: its size,
+// the size of its handle stream, its data, strings and handles, then its
+// CRC.
+func (o *object) bytes() []byte {
+	body, dataBits := o.body()
+	body.align()
+	out := make([]byte, 0, len(body.buf)+16)
+	out = append(append(out, prefix(int64(len(body.buf)), body.n-dataBits)...), body.buf...)
+	return binary.LittleEndian.AppendUint16(out, crc8(crc8Seed, out))
+}
+
+// body joins the streams of o, marking where the strings end, and returns
+// them with the number of bits before the handles.
+func (o *object) body() (bitWriter, int64) {
+	body := bitWriter{buf: make([]byte, 0, (o.data.n+o.strs.n+o.handles.n)/8+8)}
+	body.append(&o.data)
+	if n := o.strs.n; n > 0 {
+		body.append(&o.strs)
+		if n >= 0x8000 {
+			body.rs(uint16(n >> 15))
+			body.rs(uint16(n&0x7FFF | 0x8000))
+		} else {
+			body.rs(uint16(n))
+		}
+		body.b(true)
+	} else {
+		body.b(false)
+	}
+	dataBits := body.n
+	body.append(&o.handles)
+	return body, dataBits
+}
+
+// prefix returns what an object of bodyLen bytes starts with: its size,
+// then how many bits of them, padding included, its handles take.
+func prefix(bodyLen, handleBits int64) []byte {
+	mc := appendUMC(nil, handleBits)
+	return append(appendMS(nil, int64(len(mc))+bodyLen), mc...)
+}
+
+// tables returns the table objects every drawing holds: the block,
+// layer and linetype tables, layer 0 and the Continuous linetype, with
+// the offset of each from the start of the objects section, which they
+// start after its magic number. The model space block record, which
+// lists every entity, goes after them.
+func tables() ([]byte, map[uint32]int64) {
+	var out []byte
+	offsets := make(map[uint32]int64)
+	add := func(h uint32, o *object) {
+		offsets[h] = 4 + int64(len(out))
+		out = append(out, o.bytes()...)
+	}
+
+	o := newObject(typeBlockControl, handleBlockControl, 0)
+	o.data.bl(0) // model and paper space do not count
+	o.handles.handle(hardOwner, handleModelSpace)
+	o.handles.handle(hardOwner, 0) // no paper space
+	add(handleBlockControl, o)
+
+	o = newObject(typeLayerControl, handleLayerControl, 0)
+	o.data.bl(1)
+	o.handles.handle(softOwner, handleLayer0)
+	add(handleLayerControl, o)
+
+	o = newObject(typeLayer, handleLayer0, handleLayerControl)
+	o.tableEntry("0")
+	o.data.bs(0x10 | 0x1F<<5) // plotted, default line weight
+	o.data.bs(7)              // white
+	o.data.bl(0xC3000007)
+	o.data.rc(0)
+	o.handles.handle(hardPointer, 0) // no xref block
+	o.handles.handle(hardPointer, 0) // default plot style
+	o.handles.handle(hardPointer, 0) // no material
+	o.handles.handle(hardPointer, handleContinuous)
+	o.handles.handle(hardPointer, 0)
+	add(handleLayer0, o)
+
+	o = newObject(typeLtypeControl, handleLtypeControl, 0)
+	o.data.bl(1)
+	o.handles.handle(softOwner, handleContinuous)
+	o.handles.handle(hardOwner, 0) // no ByLayer linetype
+	o.handles.handle(hardOwner, 0) // no ByBlock linetype
+	add(handleLtypeControl, o)
+
+	o = newObject(typeLtype, handleContinuous, handleLtypeControl)
+	o.tableEntry("Continuous")
+	o.strs.tu("Solid line")
+	o.data.bd(0)                     // pattern length
+	o.data.rc('A')                   // alignment
+	o.data.rc(0)                     // no dashes
+	o.handles.handle(hardPointer, 0) // no xref block
+	add(handleContinuous, o)
+
+	return out, offsets
+}
+
+// entity returns the entity of handle h: a line between two random points
+// of the square 2000 units wide around the origin for an even handle, a
+// circle of random centre and radius for an odd one. Coordinates are
+// never whole, so every line takes the same room, as does every circle
+// of handles as long.
+func entity(r *utils.Rand, h uint32) []byte {
+	coord := func() float64 { return float64(r.IntN(2000)-1000) + 0.5 }
+	if h%2 == 0 {
+		o := newEntity(typeLine, h)
+		o.data.b(true) // z coordinates are 0
+		x1, x2, y1, y2 := coord(), coord(), coord(), coord()
+		o.data.rd(x1)
+		o.data.dd(x2)
+		o.data.rd(y1)
+		o.data.dd(y2)
+		o.data.bt(0)
+		o.data.be(0, 0, 1)
+		return o.bytes()
+	}
+	o := newEntity(typeCircle, h)
+	o.data.bd(coord())
+	o.data.bd(coord())
+	o.data.bd(0)
+	o.data.bd(float64(r.IntN(500)) + 1.5)
+	o.data.bt(0)
+	o.data.be(0, 0, 1)
+	return o.bytes()
+}
+
+// entitySizes holds entitySize by the parity and length of the handle,
+// which the random coordinates do not change.
+var entitySizes = sync.OnceValue(func() (sizes [2][5]int64) {
+	r := utils.SeededRand(0)
+	for n := 1; n <= 4; n++ {
+		h := uint32(1) << (8*n - 1)
+		sizes[0][n] = int64(len(entity(r, h)))
+		sizes[1][n] = int64(len(entity(r, h+1)))
+	}
+	return sizes
+})
+
+// entitySize returns how many bytes the entity of handle h takes.
+func entitySize(h uint32) int64 {
+	return entitySizes()[h%2][handleLen(h)]
+}
+
+// modelSpace is the block record of model space, which lists its n
+// entities in its handle stream. It is the last object of the section and
+// is streamed, since its list runs to as many bytes as the entities take
+// to number.
+type modelSpace struct {
+	head      bitWriter // the data, strings and the handles before the list
+	dataBits  int64
+	tail      bitWriter // the handles after the list
+	listBytes int64     // bytes of the list
+}
+
+func newModelSpace(n int64) *modelSpace {
+	o := newObject(typeBlockHeader, handleModelSpace, handleBlockControl)
+	o.tableEntry("*Model_Space")
+	o.data.b(false) // not anonymous
+	o.data.b(false) // no attributes
+	o.data.b(false) // not an xref
+	o.data.b(false) // not overlaid
+	o.data.b(false) // not loaded
+	o.data.bl(uint32(n))
+	o.data.bd(0) // base point
+	o.data.bd(0)
+	o.data.bd(0)
+	o.strs.tu("") // no xref path
+	o.data.rc(0)  // no inserts
+	o.strs.tu("") // no description
+	o.data.bl(0)  // no preview
+	o.data.bs(0)  // unitless
+	o.data.b(true)
+	o.data.rc(0)
+	o.handles.handle(hardOwner, 0) // no BLOCK entity
+	m := &modelSpace{}
+	m.head, m.dataBits = o.body()
+	m.tail.handle(hardOwner, 0)   // no ENDBLK entity
+	m.tail.handle(hardPointer, 0) // no layout
+	m.listBytes = listBytes(n)
+	return m
+}
+
+// listBytes returns how many bytes references to n entities take.
+func listBytes(n int64) int64 {
+	total := int64(0)
+	for from := int64(firstEntity); n > 0; from *= 0x100 {
+		k := min(n, from*0x100-from)
+		total += k * int64(1+handleLen(uint32(from)))
+		n -= k
+	}
+	return total
+}
+
+// modelSpaceSize returns how many bytes a model space block record takes
+// whose handle stream holds headBits-dataBits bits, a list of listBytes,
+// then tailBits.
+func modelSpaceSize(headBits, dataBits, tailBits, listBytes int64) int64 {
+	bodyLen := (headBits + 8*listBytes + tailBits + 7) / 8
+	return int64(len(prefix(bodyLen, bodyLen*8-dataBits))) + bodyLen + 2
+}
+
+// write streams the block record of n entities to w.
+func (m *modelSpace) write(w func([]byte) error, n int64) error {
+	bodyLen := (m.head.n + 8*m.listBytes + m.tail.n + 7) / 8
+	start := prefix(bodyLen, bodyLen*8-m.dataBits)
+	crc := crc8(crc8Seed, start)
+	if err := w(start); err != nil {
+		return err
+	}
+	var body bitWriter
+	body.append(&m.head)
+	flush := func() error {
+		b := body.drain()
+		crc = crc8(crc, b)
+		return w(b)
+	}
+	for h := uint32(firstEntity); h < firstEntity+uint32(n); h++ {
+		body.handle(hardOwner, h)
+		if len(body.buf) >= 1<<16 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	body.append(&m.tail)
+	body.align()
+	if err := flush(); err != nil {
+		return err
+	}
+	return w(binary.LittleEndian.AppendUint16(nil, crc))
+}
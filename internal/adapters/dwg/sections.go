@@ -0,0 +1,183 @@
+package dwg
+
+import (
+	"encoding/binary"
+	"time"
+	"unicode/utf16"
+)
+
+// Sentinels that open the header variables, classes and preview
+// sections; each closes with the complement of its own.
+var (
+	headerSentinel  = [16]byte{0xCF, 0x7B, 0x1F, 0x23, 0xFD, 0xDE, 0x38, 0xA9, 0x5F, 0x7C, 0x68, 0xB8, 0x4E, 0x6D, 0x33, 0x5F}
+	classesSentinel = [16]byte{0x8D, 0xA1, 0xC4, 0xB8, 0xC4, 0xA9, 0xF8, 0xC5, 0xC0, 0xDC, 0xF4, 0x5F, 0xE7, 0xCF, 0xB6, 0x8A}
+	previewSentinel = [16]byte{0x1F, 0x25, 0x6D, 0x07, 0xD4, 0x36, 0x28, 0x28, 0x9D, 0x57, 0xCA, 0x3F, 0x9D, 0x44, 0x10, 0x2B}
+)
+
+// sentinelled returns data between sentinel and its complement.
+func sentinelled(sentinel [16]byte, data []byte) []byte {
+	out := append(sentinel[:], data...)
+	for _, b := range sentinel {
+		out = append(out, ^b)
+	}
+	return out
+}
+
+// bitSection returns a section of bit-coded data, the header variables
+// or the classes: the size of the data, then the data, its length in bits
+// first, then a CRC.
+func bitSection(sentinel [16]byte, o *object) []byte {
+	body, bits := o.body()
+	body.align()
+	le := binary.LittleEndian
+	data := le.AppendUint32(nil, uint32(4+len(body.buf)))
+	data = le.AppendUint32(data, 0) // the high half of the size
+	data = le.AppendUint32(data, uint32(bits))
+	data = append(data, body.buf...)
+	return sentinelled(sentinel, le.AppendUint16(data, crc8(crc8Seed, data)))
+}
+
+// headerVars returns the AcDb:Header section. Only the leading header
+// variables are written: units, modes and flags at their defaults.
+func headerVars() []byte {
+	o := &object{}
+	o.data.bll(0) // required versions
+	o.data.bd(412148564080.0)
+	o.data.bd(1)
+	o.data.bd(1)
+	o.data.bd(1)
+	o.strs.tu("m")
+	o.strs.tu("")
+	o.strs.tu("")
+	o.strs.tu("")
+	o.data.bl(24)
+	o.data.bl(0)
+	// DIMASO to PELLIPSE
+	for _, v := range []bool{true, true, false, false, true, true, false, true, false, false, true, false, false, false, false, true, true, false, true, false, false} {
+		o.data.b(v)
+	}
+	o.data.bs(1)    // PROXYGRAPHICS
+	o.data.bs(3020) // TREEDEPTH
+	o.data.bs(2)    // LUNITS
+	o.data.bs(4)    // LUPREC
+	o.data.bs(0)    // AUNITS
+	o.data.bs(0)    // AUPREC
+	return bitSection(headerSentinel, o)
+}
+
+// classes returns the AcDb:Classes section, declaring no classes.
+func classes() []byte {
+	o := &object{}
+	o.data.bs(499) // the highest class number, below the first
+	o.data.rc(0)
+	o.data.rc(0)
+	o.data.b(true)
+	return bitSection(classesSentinel, o)
+}
+
+// preview returns the AcDb:Preview section, holding no image.
+func preview() []byte {
+	return sentinelled(previewSentinel, []byte{1, 0, 0, 0, 0})
+}
+
+// summaryInfo returns the AcDb:SummaryInfo section: title, subject,
+// author, keywords, comments, last saved by, revision and hyperlink base,
+// then the editing time, the creation and modification dates, and no
+// custom properties.
+func summaryInfo(now time.Time) []byte {
+	le := binary.LittleEndian
+	var b []byte
+	for _, s := range []string{"", "", "genfile", "", "Test fixture generated by genfile", "genfile", "", ""} {
+		u := append(utf16.Encode([]rune(s)), 0)
+		b = le.AppendUint16(b, uint16(len(u)))
+		for _, c := range u {
+			b = le.AppendUint16(b, c)
+		}
+	}
+	b = le.AppendUint64(b, 0) // editing time
+	day, ms := julian(now)
+	for range 2 {
+		b = le.AppendUint32(b, day)
+		b = le.AppendUint32(b, ms)
+	}
+	b = le.AppendUint16(b, 0) // custom properties
+	b = le.AppendUint32(b, 0)
+	return le.AppendUint32(b, 0)
+}
+
+// julian returns t as DWG dates are: a Julian day and the milliseconds
+// into it.
+func julian(t time.Time) (day, ms uint32) {
+	const unixEpoch = 2440588 // Julian day of 1970-01-01
+	msec := t.UnixMilli()
+	return uint32(unixEpoch + msec/86400000), uint32(msec % 86400000)
+}
+
+// maxMapRun is the most bytes a run of the object map takes, its size
+// included but not its CRC.
+const maxMapRun = 2032
+
+// objectMap writes the AcDb:Handles section: runs of handles and the
+// offsets of their objects in the AcDbObjects section, each pair the
+// differences from the one before in its run, and each run closed by a
+// CRC; an empty run ends the map. Without out, it only counts the bytes.
+type objectMap struct {
+	out            func([]byte) error
+	run            []byte // pairs of the run being added to, with out
+	runLen         int64  // bytes of them
+	prevH, prevOff int64
+	size           int64 // bytes of the runs closed
+}
+
+// add adds object h at offset off.
+func (m *objectMap) add(h, off int64) error {
+	n := umcLen(h-m.prevH) + mcLen(off-m.prevOff)
+	if 2+m.runLen+n > maxMapRun {
+		if err := m.closeRun(); err != nil {
+			return err
+		}
+		n = umcLen(h) + mcLen(off)
+	}
+	if m.out != nil {
+		m.run = appendMC(appendUMC(m.run, h-m.prevH), off-m.prevOff)
+	}
+	m.runLen += n
+	m.prevH, m.prevOff = h, off
+	return nil
+}
+
+// closeRun closes the run being added to, which may be empty.
+func (m *objectMap) closeRun() error {
+	m.size += 2 + m.runLen + 2
+	if m.out != nil {
+		b := binary.BigEndian.AppendUint16(nil, uint16(2+m.runLen))
+		b = append(b, m.run...)
+		if err := m.out(binary.BigEndian.AppendUint16(b, crc8(crc8Seed, b))); err != nil {
+			return err
+		}
+		m.run = m.run[:0]
+	}
+	m.runLen = 0
+	m.prevH, m.prevOff = 0, 0
+	return nil
+}
+
+// pending returns how many bytes closing the run being added to and
+// ending the map would add.
+func (m *objectMap) pending() int64 {
+	n := int64(4)
+	if m.runLen > 0 {
+		n += 4 + m.runLen
+	}
+	return n
+}
+
+// close closes the run being added to, if any, and ends the map.
+func (m *objectMap) close() error {
+	if m.runLen > 0 {
+		if err := m.closeRun(); err != nil {
+			return err
+		}
+	}
+	return m.closeRun()
+}
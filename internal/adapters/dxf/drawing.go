@@ -0,0 +1,346 @@
+package dxf
+
+import (
+	"io"
+	"strings"
+)
+
+// $ACADVER of the releases written.
+const (
+	acR12  = "AC1009"
+	ac2000 = "AC1015"
+	ac2018 = "AC1032"
+)
+
+// Handles of the tables, blocks and objects of R13 and later. Entities
+// take theirs from firstEntity on.
+const (
+	handleVportTable = iota + 1
+	handleLtypeTable
+	handleByBlock
+	handleByLayer
+	handleContinuous
+	handleLayerTable
+	handleLayer0
+	handleStyleTable
+	handleStandard
+	handleViewTable
+	handleUCSTable
+	handleAppIDTable
+	handleACAD
+	handleGenfile
+	handleDimStyleTable
+	handleBlockRecordTable
+	handleModelSpace
+	handlePaperSpace
+	handleModelBlock
+	handleModelEnd
+	handlePaperBlock
+	handlePaperEnd
+	handleDictionary
+	handleGroupDictionary
+	handlePadding
+
+	firstEntity = 0x100
+)
+
+// The drawing lies in the square of coordinates from minCoord to
+// maxCoord, which all take as many digits, and circles have radii from
+// minRadius to maxRadius.
+const (
+	minCoord   = 1000
+	maxCoord   = 10000
+	minRadius  = 10
+	maxRadius  = 100
+	textHeight = 2.5
+	textLen    = 12 // letters of a text
+	polyPoints = 4  // vertices of a polyline
+	padApp     = "GENFILE"
+)
+
+// r12 reports whether the drawing is written as R12, which has neither
+// handles nor subclass markers, classes or objects.
+func (o dxfOptions) r12() bool { return o.version == acR12 }
+
+// newGroups returns a writer of group codes to w, in the format and for
+// the release of o; with w nil, it only counts.
+func (o dxfOptions) newGroups(w io.Writer) *groups {
+	return &groups{w: w, binary: o.binary, wide: !o.r12()}
+}
+
+// prologue writes everything before the entities: the header, with seed
+// for the next free handle, the classes, tables and blocks.
+func (o dxfOptions) prologue(g *groups, seed int64) {
+	if o.binary {
+		g.buf = append(g.buf, binarySentinel...)
+		g.flush()
+	}
+	g.str(0, "SECTION")
+	g.str(2, "HEADER")
+	g.str(9, "$ACADVER")
+	g.str(1, o.version)
+	if !o.r12() {
+		g.str(9, "$DWGCODEPAGE")
+		g.str(3, "ANSI_1252")
+	}
+	g.str(9, "$INSBASE")
+	g.point(10, 0, 0, 0)
+	g.str(9, "$EXTMIN")
+	g.point(10, minCoord-maxRadius, minCoord-maxRadius, 0)
+	g.str(9, "$EXTMAX")
+	g.point(10, maxCoord+maxRadius, maxCoord+maxRadius, 0)
+	if !o.r12() {
+		g.str(9, "$HANDSEED")
+		g.handle(5, seed)
+	}
+	g.str(0, "ENDSEC")
+
+	if !o.r12() {
+		g.str(0, "SECTION")
+		g.str(2, "CLASSES")
+		g.str(0, "ENDSEC")
+	}
+
+	g.str(0, "SECTION")
+	g.str(2, "TABLES")
+	o.table(g, "VPORT", handleVportTable, 0, nil)
+	ltypes := []struct {
+		name, desc string
+		h          int64
+	}{{"ByBlock", "", handleByBlock}, {"ByLayer", "", handleByLayer}, {"Continuous", "Solid line", handleContinuous}}
+	if o.r12() {
+		ltypes = ltypes[2:]
+	}
+	o.table(g, "LTYPE", handleLtypeTable, len(ltypes), func() {
+		for _, lt := range ltypes {
+			o.record(g, "LTYPE", lt.h, handleLtypeTable, "AcDbLinetypeTableRecord", o.name(lt.name))
+			g.str(3, lt.desc)
+			g.i16(72, 'A')
+			g.i16(73, 0)
+			g.f64(40, 0)
+		}
+	})
+	o.table(g, "LAYER", handleLayerTable, 1, func() {
+		o.record(g, "LAYER", handleLayer0, handleLayerTable, "AcDbLayerTableRecord", "0")
+		g.i16(62, 7)
+		g.str(6, o.name("Continuous"))
+	})
+	o.table(g, "STYLE", handleStyleTable, 1, func() {
+		o.record(g, "STYLE", handleStandard, handleStyleTable, "AcDbTextStyleTableRecord", o.name("Standard"))
+		g.f64(40, 0)
+		g.f64(41, 1)
+		g.f64(50, 0)
+		g.i16(71, 0)
+		g.f64(42, textHeight)
+		g.str(3, "txt")
+		g.str(4, "")
+	})
+	o.table(g, "VIEW", handleViewTable, 0, nil)
+	o.table(g, "UCS", handleUCSTable, 0, nil)
+	o.table(g, "APPID", handleAppIDTable, 2, func() {
+		o.record(g, "APPID", handleACAD, handleAppIDTable, "AcDbRegAppTableRecord", "ACAD")
+		o.record(g, "APPID", handleGenfile, handleAppIDTable, "AcDbRegAppTableRecord", padApp)
+	})
+	o.table(g, "DIMSTYLE", handleDimStyleTable, 0, nil)
+	if !o.r12() {
+		o.table(g, "BLOCK_RECORD", handleBlockRecordTable, 2, func() {
+			o.record(g, "BLOCK_RECORD", handleModelSpace, handleBlockRecordTable, "AcDbBlockTableRecord", "*Model_Space")
+			o.record(g, "BLOCK_RECORD", handlePaperSpace, handleBlockRecordTable, "AcDbBlockTableRecord", "*Paper_Space")
+		})
+	}
+	g.str(0, "ENDSEC")
+
+	g.str(0, "SECTION")
+	g.str(2, "BLOCKS")
+	if !o.r12() {
+		o.block(g, "*Model_Space", handleModelBlock, handleModelEnd, handleModelSpace)
+		o.block(g, "*Paper_Space", handlePaperBlock, handlePaperEnd, handlePaperSpace)
+	}
+	g.str(0, "ENDSEC")
+
+	g.str(0, "SECTION")
+	g.str(2, "ENTITIES")
+}
+
+// name returns a name of a standard table record as the release spells
+// it: in capitals for R12.
+func (o dxfOptions) name(s string) string {
+	if o.r12() {
+		return strings.ToUpper(s)
+	}
+	return s
+}
+
+// table writes table name of n records, which records writes.
+func (o dxfOptions) table(g *groups, name string, h int64, n int, records func()) {
+	g.str(0, "TABLE")
+	g.str(2, name)
+	if !o.r12() {
+		g.handle(5, h)
+		g.handle(330, 0)
+		g.str(100, "AcDbSymbolTable")
+	}
+	g.i16(70, int16(n))
+	if name == "DIMSTYLE" && !o.r12() {
+		g.str(100, "AcDbDimStyleTable")
+		g.i16(71, 0)
+	}
+	if records != nil {
+		records()
+	}
+	g.str(0, "ENDTAB")
+}
+
+// record starts the record name of a table, of type typ.
+func (o dxfOptions) record(g *groups, typ string, h, owner int64, subclass, name string) {
+	g.str(0, typ)
+	if !o.r12() {
+		g.handle(5, h)
+		g.handle(330, owner)
+		g.str(100, "AcDbSymbolTableRecord")
+		g.str(100, subclass)
+	}
+	g.str(2, name)
+	g.i16(70, 0)
+}
+
+// block writes the empty block name, of block record owner.
+func (o dxfOptions) block(g *groups, name string, begin, end, owner int64) {
+	g.str(0, "BLOCK")
+	g.handle(5, begin)
+	g.handle(330, owner)
+	g.str(100, "AcDbEntity")
+	g.str(8, "0")
+	g.str(100, "AcDbBlockBegin")
+	g.str(2, name)
+	g.i16(70, 0)
+	g.point(10, 0, 0, 0)
+	g.str(3, name)
+	g.str(1, "")
+	g.str(0, "ENDBLK")
+	g.handle(5, end)
+	g.handle(330, owner)
+	g.str(100, "AcDbEntity")
+	g.str(8, "0")
+	g.str(100, "AcDbBlockEnd")
+}
+
+// start starts entity typ of handle h on layer 0 in model space.
+func (o dxfOptions) start(g *groups, typ string, h int64, subclass string) {
+	g.str(0, typ)
+	if !o.r12() {
+		g.handle(5, h)
+		g.handle(330, handleModelSpace)
+		g.str(100, "AcDbEntity")
+	}
+	g.str(8, "0")
+	if !o.r12() {
+		g.str(100, subclass)
+	}
+}
+
+// coord returns a random coordinate in the drawing, whole to the
+// millionth so that it prints as it is.
+func (o dxfOptions) coord() float64 {
+	return float64(minCoord*1e6+o.rand.Int64N((maxCoord-minCoord)*1e6)) / 1e6
+}
+
+func (o dxfOptions) radius() float64 {
+	return float64(minRadius*1e6+o.rand.Int64N((maxRadius-minRadius)*1e6)) / 1e6
+}
+
+// entity writes a random entity of kind and handle h.
+func (o dxfOptions) entity(g *groups, kind string, h int64) {
+	switch kind {
+	case EntityLine:
+		o.start(g, "LINE", h, "AcDbLine")
+		g.point(10, o.coord(), o.coord(), 0)
+		g.point(11, o.coord(), o.coord(), 0)
+	case EntityCircle:
+		o.start(g, "CIRCLE", h, "AcDbCircle")
+		g.point(10, o.coord(), o.coord(), 0)
+		g.f64(40, o.radius())
+	case EntityPolyline:
+		// R12 has only the heavy polyline, a vertex entity to a point.
+		if o.r12() {
+			o.start(g, "POLYLINE", h, "")
+			g.i16(66, 1)
+			g.point(10, 0, 0, 0)
+			g.i16(70, 1)
+			for range polyPoints {
+				o.start(g, "VERTEX", 0, "")
+				g.point(10, o.coord(), o.coord(), 0)
+			}
+			o.start(g, "SEQEND", 0, "")
+			return
+		}
+		o.start(g, "LWPOLYLINE", h, "AcDbPolyline")
+		g.i32(90, polyPoints)
+		g.i16(70, 1)
+		for range polyPoints {
+			g.point(10, o.coord(), o.coord())
+		}
+	case EntityText:
+		o.start(g, "TEXT", h, "AcDbText")
+		g.point(10, o.coord(), o.coord(), 0)
+		g.f64(40, textHeight)
+		text := make([]byte, textLen)
+		for i := range text {
+			text[i] = 'A' + byte(o.rand.IntN(26))
+		}
+		g.str(1, string(text))
+		if !o.r12() {
+			g.str(100, "AcDbText")
+		}
+	}
+}
+
+// padding writes a point at the origin whose extended data pads the
+// drawing by extra bytes: 0, or at least padStringSize.
+func (o dxfOptions) padding(g *groups, extra int64) {
+	o.start(g, "POINT", handlePadding, "AcDbPoint")
+	g.point(10, 0, 0, 0)
+	g.str(1001, padApp)
+	over := o.padStringSize()
+	for extra > 0 {
+		k := min(extra-over, maxPadString)
+		if rest := extra - over - k; rest > 0 && rest < over {
+			k -= over
+		}
+		g.str(1000, strings.Repeat("X", int(k)))
+		extra -= over + k
+	}
+}
+
+// maxPadString is the longest string extended data holds.
+const maxPadString = 255
+
+// padStringSize returns how many bytes an empty string of extended data
+// takes.
+func (o dxfOptions) padStringSize() int64 {
+	g := o.newGroups(nil)
+	g.str(1000, "")
+	return g.n
+}
+
+// epilogue writes everything after the entities: the objects, and the
+// end of the file.
+func (o dxfOptions) epilogue(g *groups) {
+	g.str(0, "ENDSEC")
+	if !o.r12() {
+		g.str(0, "SECTION")
+		g.str(2, "OBJECTS")
+		g.str(0, "DICTIONARY")
+		g.handle(5, handleDictionary)
+		g.handle(330, 0)
+		g.str(100, "AcDbDictionary")
+		g.str(3, "ACAD_GROUP")
+		g.handle(350, handleGroupDictionary)
+		g.str(0, "DICTIONARY")
+		g.handle(5, handleGroupDictionary)
+		g.handle(330, handleDictionary)
+		g.str(100, "AcDbDictionary")
+		g.str(0, "ENDSEC")
+	}
+	g.str(0, "EOF")
+}
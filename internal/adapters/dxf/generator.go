@@ -1,102 +1,231 @@
 package dxf
 
 import (
+	"bufio"
 	"fmt"
-	"os"
-	"path/filepath"
+	"math/bits"
 	"strings"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
-	"github.com/yofu/dxf"
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func init() {
 	factory.RegisterGenerator(ports.FileTypeDXF, New()) //
 }
 
-type DxfGenerator struct{}
+// DxfGenerator writes DXF drawings of random lines, circles, polylines
+// and texts, as R12, R2000 or R2018 and in ASCII or binary, padded to the
+// exact size by the extended data of a point.
+type DxfGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &DxfGenerator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *DxfGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *DxfGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// Releases, as "dxf-version" takes them.
+const (
+	VersionR12  = "r12"
+	Version2000 = "2000"
+	Version2018 = "2018"
+)
+
+// Entity kinds, as "dxf-entities" lists them.
+const (
+	EntityLine     = "line"
+	EntityCircle   = "circle"
+	EntityPolyline = "polyline"
+	EntityText     = "text"
+)
+
+// dxfOptions holds the settings the DXF generator reads from
+// ports.Options.
+type dxfOptions struct {
+	version  string // $ACADVER
+	binary   bool
+	entities []string // kinds, drawn in turn
+	rand     *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (dxfOptions, error) {
+	var o dxfOptions
+	var err error
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	switch v := strings.ToLower(opts.String("dxf-version", Version2000)); v {
+	case VersionR12, "12":
+		o.version = acR12
+	case Version2000:
+		o.version = ac2000
+	case Version2018:
+		o.version = ac2018
+	default:
+		return o, fmt.Errorf("unknown dxf version %q (want r12, 2000 or 2018)", v)
+	}
+	switch f := strings.ToLower(opts.String("dxf-format", "ascii")); f {
+	case "ascii":
+	case "binary":
+		o.binary = true
+	default:
+		return o, fmt.Errorf("unknown dxf format %q (want ascii or binary)", f)
+	}
+	for _, e := range strings.Split(opts.String("dxf-entities", "line,circle,polyline,text"), ",") {
+		switch e = strings.ToLower(strings.TrimSpace(e)); e {
+		case "":
+		case EntityLine, EntityCircle, EntityPolyline, EntityText:
+			o.entities = append(o.entities, e)
+		default:
+			return o, fmt.Errorf("unknown dxf entity %q (want line, circle, polyline or text)", e)
+		}
+	}
+	if len(o.entities) == 0 {
+		return o, fmt.Errorf("dxf-entities names no entities")
+	}
+	return o, nil
+}
+
 // Generate creates a DXF file at the specified path with the given size.
 func (g *DxfGenerator) Generate(path string, size int64) error {
-	// Create a simple DXF drawing
-	dwg := dxf.NewDrawing()
-	// Add a line (for example) so the drawing isn't empty
-	dwg.Line(0.0, 0.0, 0.0, 100.0, 100.0, 0.0)
-	// Save to a DXF file (ASCII DXF format)
-	tempPath := path
-	if strings.ToLower(filepath.Ext(path)) == ".dwg" {
-		// Ensure it has .dxf extension for output, we'll rename later
-		tempPath = strings.TrimSuffix(path, filepath.Ext(path)) + ".dxf"
-	}
-	if err := dwg.SaveAs(tempPath); err != nil {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes a drawing of exactly size bytes to path: as
+// many entities as fit, of the kinds "dxf-entities" lists in turn, then a
+// point whose extended data takes the bytes left over.
+func (g *DxfGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	o, err := parseOptions(g.opts.With(opts))
+	if err != nil {
 		return err
 	}
-	// Now tempPath is a DXF file. Let's get its size.
-	info, err := os.Stat(tempPath)
+	n, extra, err := o.fit(size)
 	if err != nil {
 		return err
 	}
-	baseSize := info.Size()
-	if baseSize > size {
-		return fmt.Errorf("cannot generate drawing of %d bytes, minimum DXF is %d bytes", size, baseSize)
-	}
-	if baseSize == size {
-		// If extension was originally .dwg, rename the .dxf to .dwg
-		if tempPath != path {
-			return os.Rename(tempPath, path)
-		}
-		return nil
-	}
-	// Open the file for append (text mode)
-	f, err := os.OpenFile(tempPath, os.O_APPEND|os.O_WRONLY, 0)
+	f, err := outputfs.Create(g.fs, path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	// Pad with DXF comment lines (999 code).
-	// Each comment line in DXF takes the form:
-	// 999\nYour comment text\n
-	// That's 4 bytes for "999\n" + N bytes of text + 1 byte for newline. Max text length ~255.
-	padNeeded := size - baseSize
-	// We'll add as many full-length (255 char) comments as needed.
-	commentLine := strings.Repeat("X", 255) // 255 'X' characters as comment text
-	lineBytes := []byte("999\n" + commentLine + "\n")
-	bytesPerComment := int64(len(lineBytes)) // which should be 4 + 255 + 1 = 260 bytes
-	fullLines := padNeeded / bytesPerComment
-	remainder := padNeeded % bytesPerComment
-	// Write full-length comment lines
-	for i := int64(0); i < fullLines; i++ {
-		if _, err := f.Write(lineBytes); err != nil {
-			return err
+	w := bufio.NewWriterSize(f, 1<<16)
+	d := o.newGroups(w)
+	o.prologue(d, firstEntity+n)
+	for i := int64(0); i < n && d.err == nil; i++ {
+		o.entity(d, o.entities[i%int64(len(o.entities))], firstEntity+i)
+	}
+	o.padding(d, extra)
+	o.epilogue(d)
+	if d.err != nil {
+		return d.err
+	}
+	if d.n != size {
+		return fmt.Errorf("wrote %d bytes of DXF, want %d", d.n, size)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// fit returns how many entities a drawing of size bytes holds, and how
+// many bytes its padding adds past the smallest.
+func (o dxfOptions) fit(size int64) (n, extra int64, err error) {
+	measure := func(write func(g *groups)) int64 {
+		g := o.newGroups(nil)
+		write(g)
+		return g.n
+	}
+	// Entities take as many bytes whatever their coordinates, but more
+	// with longer handles, as does the handle seed in the header.
+	digits := func(h int64) int { return (bits.Len64(uint64(h)) + 3) / 4 }
+	prologue := make(map[int]int64)
+	sizes := make(map[[2]int]int64)
+	prologueSize := func(seed int64) int64 {
+		d := digits(seed)
+		if _, ok := prologue[d]; !ok {
+			prologue[d] = measure(func(g *groups) { o.prologue(g, seed) })
 		}
+		return prologue[d]
 	}
-	if remainder > 0 {
-		// If remainder is less than 5, we cannot create a smaller-than-minimum comment (which is "999\n\n" = 5 bytes).
-		// We'll just create one more comment line slightly longer than needed (overshoot a bit) if necessary.
-		if remainder < 5 {
-			remainder = 5
+	entitySize := func(i int64) int64 {
+		h := firstEntity + i
+		key := [2]int{int(i % int64(len(o.entities))), digits(h)}
+		if _, ok := sizes[key]; !ok {
+			sizes[key] = measure(func(g *groups) { o.entity(g, o.entities[key[0]], h) })
 		}
-		// remainder includes both code+newline and text+newline.
-		// If remainder = 5, that implies 0-length text comment.
-		textLen := remainder - 5 // subtract "999\n" (4) and trailing newline (1)
-		if textLen < 0 {
-			textLen = 0
+		return sizes[key]
+	}
+	fixed := measure(func(g *groups) {
+		o.padding(g, 0)
+		o.epilogue(g)
+	})
+	over := o.padStringSize()
+
+	smallest := prologueSize(firstEntity) + fixed
+	if size < smallest {
+		return 0, 0, fmt.Errorf("cannot generate drawing of %d bytes, minimum DXF is %d bytes", size, smallest)
+	}
+	var entities, last int64
+	turn := int64(len(o.entities))
+	for {
+		if n%turn == 0 {
+			// Whole turns of the kinds take as many bytes each while
+			// the handles keep their digits, so as many of them as fit
+			// are added at once.
+			h := firstEntity + n
+			band := int64(1)<<(4*digits(h)) - 1 - h // handles past h with as many digits
+			var bytes int64
+			for i := range turn {
+				bytes += entitySize(n + i)
+			}
+			k := min(band/turn, (size-prologueSize(h)-entities-fixed)/bytes)
+			if k > 0 {
+				entities += k * bytes
+				n += k * turn
+				last = entitySize(n - 1)
+				continue
+			}
 		}
-		comment := strings.Repeat("X", int(textLen))
-		lastLine := "999\n" + comment + "\n"
-		if _, err := f.Write([]byte(lastLine)); err != nil {
-			return err
+		next := entities + entitySize(n)
+		if next > size-prologueSize(firstEntity+n+1)-fixed {
+			break
 		}
+		entities, last = next, entitySize(n)
+		n++
 	}
-	f.Close()
-	// If original request was .dwg extension, rename .dxf to .dwg.
-	if tempPath != path {
-		return os.Rename(tempPath, path)
+	extra = size - (prologueSize(firstEntity+n) + entities + fixed)
+	if extra > 0 && extra < over {
+		// Too few bytes for a string of padding: one entity fewer
+		// leaves enough.
+		if n == 0 {
+			return 0, 0, fmt.Errorf("cannot generate drawing of %d bytes, minimum DXF is %d bytes, or %d with padding", size, smallest, smallest+over)
+		}
+		n--
+		extra = size - (prologueSize(firstEntity+n) + entities - last + fixed)
 	}
-	return nil
+	return n, extra, nil
 }
@@ -1,31 +1,31 @@
 package dxf
 
 import (
+	"bytes"
+	"encoding/binary"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
-	"github.com/hailam/genfile/internal/ports" //
-	"github.com/yofu/dxf"                      // Import dxf lib used by generator
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/yofu/dxf"
 )
 
-// Helper to estimate minimum size by generating a base DXF in the test
-func estimateMinDxfSize(t *testing.T, tempDir string) int64 {
+// minDxfSize returns the size of the smallest drawing written with opts.
+func minDxfSize(t *testing.T, opts ports.Options) int64 {
 	t.Helper()
-	tempPath := filepath.Join(tempDir, "min_dxf_calc.dxf")
-	dwg := dxf.NewDrawing()
-	dwg.Line(0.0, 0.0, 0.0, 100.0, 100.0, 0.0) // Match generator's minimal content
-	err := dwg.SaveAs(tempPath)
+	o, err := parseOptions(opts)
 	if err != nil {
-		t.Fatalf("Failed to save minimal DXF for size calculation: %v", err)
+		t.Fatal(err)
 	}
-	info, err := os.Stat(tempPath)
-	if err != nil {
-		t.Fatalf("Failed to stat minimal DXF for size calculation: %v", err)
-	}
-	os.Remove(tempPath) // Clean up temp file
-	return info.Size()
+	g := o.newGroups(nil)
+	o.prologue(g, firstEntity)
+	o.padding(g, 0)
+	o.epilogue(g)
+	return g.n
 }
 
 func TestDxfGenerator_Generate(t *testing.T) {
@@ -36,13 +36,7 @@ func TestDxfGenerator_Generate(t *testing.T) {
 
 	tempDir := t.TempDir() // Create a temporary directory for test files
 
-	// Estimate minimum size
-	minSize := estimateMinDxfSize(t, tempDir)
-	t.Logf("Estimated minimum DXF size: %d bytes", minSize)
-	if minSize <= 0 {
-		t.Fatalf("Estimated minimum DXF size (%d) is invalid", minSize)
-	}
-
+	minSize := minDxfSize(t, nil)
 	testCases := []struct {
 		name            string
 		filename        string // Filename including extension (.dxf or .dwg)
@@ -66,6 +60,13 @@ func TestDxfGenerator_Generate(t *testing.T) {
 			expectErr:    true,
 			errSubstring: "minimum DXF is",
 		},
+		{
+			name:         "DXF_TooSmallForPadding",
+			filename:     "test_toosmallpadding.dxf",
+			targetSize:   minSize + 1,
+			expectErr:    true,
+			errSubstring: "with padding",
+		},
 		{
 			name:       "DXF_ExactMinSize",
 			filename:   "test_exactmin.dxf",
@@ -82,11 +83,8 @@ func TestDxfGenerator_Generate(t *testing.T) {
 			targetSize: minSize + 100,
 			expectErr:  false,
 			checkProperties: func(t *testing.T, path string, size int64) {
-				// Padding with "999\n...\n" might slightly overshoot if remainder < 5 bytes.
-				// Allow tolerance up to 4 bytes over.
-				checkFileSize(t, path, size, 4)
+				checkFileSize(t, path, size, 0)
 				checkDxfStructure(t, path)
-				// Optionally check for "999" comments
 			},
 		},
 		{
@@ -95,7 +93,7 @@ func TestDxfGenerator_Generate(t *testing.T) {
 			targetSize: minSize + 5000,
 			expectErr:  false,
 			checkProperties: func(t *testing.T, path string, size int64) {
-				checkFileSize(t, path, size, 4) // Allow tolerance
+				checkFileSize(t, path, size, 0)
 				checkDxfStructure(t, path)
 			},
 		},
@@ -123,15 +121,15 @@ func TestDxfGenerator_Generate(t *testing.T) {
 			targetSize: minSize + 6000,
 			expectErr:  false,
 			checkProperties: func(t *testing.T, path string, size int64) {
-				checkFileSize(t, path, size, 4) // Allow tolerance
-				checkDxfStructure(t, path)      // Content is still DXF
+				checkFileSize(t, path, size, 0)
+				checkDxfStructure(t, path) // Content is still DXF
 			},
 		},
 		{
 			name:         "DXF_NegativeSize", // Should error as too small
 			filename:     "test_negative.dxf",
 			targetSize:   -100,
-			expectErr:    true,             // Generator doesn't handle negative, SaveAs fails likely
+			expectErr:    true,
 			errSubstring: "minimum DXF is", // Error comes from size check relative to minSize
 		},
 	}
@@ -150,11 +148,6 @@ func TestDxfGenerator_Generate(t *testing.T) {
 				} else if tc.errSubstring != "" && !strings.Contains(strings.ToLower(err.Error()), strings.ToLower(tc.errSubstring)) {
 					t.Errorf("Generate(%q, %d) error = %q, expected error containing %q", outPath, tc.targetSize, err.Error(), tc.errSubstring)
 				}
-				// Clean up potentially created temp .dxf file if the final rename failed (for .dwg tests)
-				if strings.HasSuffix(tc.filename, ".dwg") && err != nil {
-					tempDxfPath := strings.TrimSuffix(outPath, ".dwg") + ".dxf"
-					os.Remove(tempDxfPath)
-				}
 				return
 			}
 			if err != nil {
@@ -175,11 +168,166 @@ func TestDxfGenerator_Generate(t *testing.T) {
 		if err == nil {
 			t.Errorf("Generate(%q, ...) expected an error for invalid path, but got nil", tempDir)
 		}
-		// Clean up potentially created temp file from SaveAs if it failed during append/rename
-		os.Remove(tempDir + ".dxf") // Assuming SaveAs creates .dxf if path has no extension
 	})
 }
 
+func TestDxfGenerator_Versions(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+	testCases := []struct {
+		name    string
+		opts    ports.Options
+		version string
+		kinds   string // entity types, in turn
+	}{
+		{name: "R12", opts: ports.Options{"dxf-version": "r12"}, version: acR12, kinds: "LINE,CIRCLE,POLYLINE,TEXT"},
+		{name: "R12Binary", opts: ports.Options{"dxf-version": "r12", "dxf-format": "binary"}, version: acR12, kinds: "LINE,CIRCLE,POLYLINE,TEXT"},
+		{name: "2000", opts: nil, version: ac2000, kinds: "LINE,CIRCLE,LWPOLYLINE,TEXT"},
+		{name: "2000Binary", opts: ports.Options{"dxf-format": "binary"}, version: ac2000, kinds: "LINE,CIRCLE,LWPOLYLINE,TEXT"},
+		{name: "2018", opts: ports.Options{"dxf-version": "2018"}, version: ac2018, kinds: "LINE,CIRCLE,LWPOLYLINE,TEXT"},
+		{name: "2018Binary", opts: ports.Options{"dxf-version": "2018", "dxf-format": "binary"}, version: ac2018, kinds: "LINE,CIRCLE,LWPOLYLINE,TEXT"},
+		{name: "Mix", opts: ports.Options{"dxf-entities": "text, circle"}, version: ac2000, kinds: "TEXT,CIRCLE"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			smallest := minDxfSize(t, tc.opts)
+			for _, size := range []int64{smallest, smallest + 50, 20_000, 20_001, 300_000} {
+				path := filepath.Join(t.TempDir(), "drawing.dxf")
+				if err := generator.GenerateWithOptions(path, size, tc.opts); err != nil {
+					t.Fatalf("GenerateWithOptions(%d) error = %v", size, err)
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if int64(len(data)) != size {
+					t.Fatalf("size = %d, want %d", len(data), size)
+				}
+				version, entities := readGroups(t, data)
+				if version != tc.version {
+					t.Errorf("$ACADVER = %s, want %s", version, tc.version)
+				}
+				kinds := strings.Split(tc.kinds, ",")
+				if size >= 20_000 && len(entities) < len(kinds) {
+					t.Fatalf("%d bytes hold only %d entities", size, len(entities))
+				}
+				for i, e := range entities {
+					if e != kinds[i%len(kinds)] {
+						t.Fatalf("entity %d is a %s, want a %s", i, e, kinds[i%len(kinds)])
+					}
+				}
+				if tc.version != acR12 && !bytes.HasPrefix(data, []byte(binarySentinel)) {
+					// The library reads back R2000 and later in ASCII.
+					d, err := dxf.FromReader(bytes.NewReader(data))
+					if err != nil {
+						t.Fatalf("reading back: %v", err)
+					}
+					if got := len(d.Entities()); got != len(entities)+1 {
+						t.Errorf("read back %d entities, want %d and a point", got, len(entities))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDxfGenerator_Options(t *testing.T) {
+	for _, opts := range []ports.Options{
+		{"dxf-version": "14"},
+		{"dxf-format": "dxb"},
+		{"dxf-entities": "line,spline"},
+		{"dxf-entities": " , "},
+	} {
+		if _, err := New().(ports.ConfigurableGenerator).Configure(opts); err == nil {
+			t.Errorf("Configure(%v) succeeded, want an error", opts)
+		}
+	}
+}
+
+// readGroups reads the groups of an ASCII or binary DXF, checking it runs
+// from a section to EOF, and returns its $ACADVER and the types of the
+// entities of its ENTITIES section, but for the padding point.
+func readGroups(t *testing.T, data []byte) (version string, entities []string) {
+	t.Helper()
+	type group struct {
+		code  int
+		value string
+	}
+	var groups []group
+	if rest, ok := bytes.CutPrefix(data, []byte(binarySentinel)); ok {
+		wide := !bytes.Contains(rest, []byte("AC1009\x00"))
+		for len(rest) > 0 {
+			var code int
+			switch {
+			case wide:
+				code, rest = int(binary.LittleEndian.Uint16(rest)), rest[2:]
+			case rest[0] == 255:
+				code, rest = int(binary.LittleEndian.Uint16(rest[1:])), rest[3:]
+			default:
+				code, rest = int(rest[0]), rest[1:]
+			}
+			var value string
+			switch {
+			case code >= 10 && code < 60 || code >= 210 && code < 240:
+				value = strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(rest)), 'f', 6, 64)
+				rest = rest[8:]
+			case code >= 60 && code < 80:
+				value = strconv.Itoa(int(int16(binary.LittleEndian.Uint16(rest))))
+				rest = rest[2:]
+			case code >= 90 && code < 100:
+				value = strconv.Itoa(int(int32(binary.LittleEndian.Uint32(rest))))
+				rest = rest[4:]
+			default:
+				end := bytes.IndexByte(rest, 0)
+				if end < 0 {
+					t.Fatalf("unterminated string of group %d", code)
+				}
+				value, rest = string(rest[:end]), rest[end+1:]
+			}
+			groups = append(groups, group{code, value})
+		}
+	} else {
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		if len(lines)%2 != 0 {
+			t.Fatalf("odd number of lines: %d", len(lines))
+		}
+		for i := 0; i < len(lines); i += 2 {
+			code, err := strconv.Atoi(strings.TrimSpace(lines[i]))
+			if err != nil {
+				t.Fatalf("line %d: group code %q", i+1, lines[i])
+			}
+			groups = append(groups, group{code, lines[i+1]})
+		}
+	}
+
+	if groups[0] != (group{0, "SECTION"}) || groups[len(groups)-1] != (group{0, "EOF"}) {
+		t.Fatalf("groups run from %v to %v", groups[0], groups[len(groups)-1])
+	}
+	section := ""
+	handles := make(map[string]bool)
+	for i, g := range groups {
+		switch {
+		case g.code == 2 && groups[i-1] == (group{0, "SECTION"}):
+			section = g.value
+		case g.code == 1 && groups[i-1] == (group{9, "$ACADVER"}):
+			version = g.value
+		case g.code == 5:
+			if handles[g.value] {
+				t.Fatalf("handle %s used twice", g.value)
+			}
+			handles[g.value] = true
+		case g.code == 0 && section == "ENTITIES":
+			switch g.value {
+			case "ENDSEC":
+				section = ""
+			case "VERTEX", "SEQEND", "POINT":
+			default:
+				entities = append(entities, g.value)
+			}
+		}
+	}
+	return version, entities
+}
+
 // Helper to check file existence and size, allowing for minor oversize due to padding
 func checkFileSize(t *testing.T, path string, expectedSize int64, tolerance int64) {
 	t.Helper()
@@ -214,7 +362,7 @@ func checkDxfStructure(t *testing.T, path string) {
 	// Check for common DXF start sequence (e.g., "0\nSECTION") and end marker ("0\nEOF")
 	// Use case-insensitive compare for section name if needed, although spec is usually uppercase.
 	hasStart := strings.Contains(sContent, "0\nSECTION") || strings.Contains(sContent, "  0\nSECTION") // Allow for potential leading spaces
-	hasEnd := strings.Contains(sContent, "\n0\nEOF")                                                   // Check includes preceding newline
+	hasEnd := strings.Contains(sContent, "\n  0\nEOF")                                                 // Check includes preceding newline
 
 	if !hasStart || !hasEnd {
 		t.Errorf("DXF structure check failed for %q: StartSequence=%t, EndSequence=%t", path, hasStart, hasEnd)
@@ -0,0 +1,108 @@
+package dxf
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// binarySentinel starts a binary DXF file.
+const binarySentinel = "AutoCAD Binary DXF\r\n\x1a\x00"
+
+// groups writes DXF group codes and their values: as lines of text, or
+// in binary, where R12 takes a byte for most codes and later releases
+// two. Values are typed by their group code. The first write error is
+// kept and later writes do nothing; with no writer, groups only counts.
+type groups struct {
+	w      io.Writer
+	binary bool
+	wide   bool // two-byte codes, in binary
+	n      int64
+	err    error
+	buf    []byte
+}
+
+func (g *groups) flush() {
+	g.n += int64(len(g.buf))
+	if g.w != nil && g.err == nil {
+		_, g.err = g.w.Write(g.buf)
+	}
+	g.buf = g.buf[:0]
+}
+
+func (g *groups) code(c int) {
+	switch {
+	case !g.binary:
+		// Right-aligned in three columns, as AutoCAD writes them.
+		for w := 100; c < w && w > 1; w /= 10 {
+			g.buf = append(g.buf, ' ')
+		}
+		g.buf = append(strconv.AppendInt(g.buf, int64(c), 10), '\n')
+	case g.wide:
+		g.buf = binary.LittleEndian.AppendUint16(g.buf, uint16(c))
+	case c < 255:
+		g.buf = append(g.buf, byte(c))
+	default:
+		g.buf = binary.LittleEndian.AppendUint16(append(g.buf, 255), uint16(c))
+	}
+}
+
+// str writes a string, a name or a handle.
+func (g *groups) str(c int, s string) {
+	g.code(c)
+	g.buf = append(g.buf, s...)
+	if g.binary {
+		g.buf = append(g.buf, 0)
+	} else {
+		g.buf = append(g.buf, '\n')
+	}
+	g.flush()
+}
+
+// handle writes handle h, in hexadecimal.
+func (g *groups) handle(c int, h int64) {
+	g.str(c, strings.ToUpper(strconv.FormatInt(h, 16)))
+}
+
+// i16 writes a 16-bit integer, as codes 60 to 79 take.
+func (g *groups) i16(c int, v int16) {
+	g.code(c)
+	if g.binary {
+		g.buf = binary.LittleEndian.AppendUint16(g.buf, uint16(v))
+	} else {
+		g.buf = append(strconv.AppendInt(g.buf, int64(v), 10), '\n')
+	}
+	g.flush()
+}
+
+// i32 writes a 32-bit integer, as codes 90 to 99 take.
+func (g *groups) i32(c int, v int32) {
+	g.code(c)
+	if g.binary {
+		g.buf = binary.LittleEndian.AppendUint32(g.buf, uint32(v))
+	} else {
+		g.buf = append(strconv.AppendInt(g.buf, int64(v), 10), '\n')
+	}
+	g.flush()
+}
+
+// f64 writes a real, as codes 10 to 59 take, with six decimals in text.
+func (g *groups) f64(c int, v float64) {
+	g.code(c)
+	if g.binary {
+		g.buf = binary.LittleEndian.AppendUint64(g.buf, math.Float64bits(v))
+	} else {
+		g.buf = append(strconv.AppendFloat(g.buf, v, 'f', 6, 64), '\n')
+	}
+	g.flush()
+}
+
+// point writes the coordinates of a point from code c on: c, c+10 and,
+// for three, c+20.
+func (g *groups) point(c int, coords ...float64) {
+	for i, v := range coords {
+		g.f64(c+10*i, v)
+	}
+}
@@ -0,0 +1,289 @@
+package edi
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeEDI, New())
+}
+
+// EdiGenerator writes EDI interchanges holding one purchase order: an X12
+// 850 or an EDIFACT ORDERS message.
+type EdiGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &EdiGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *EdiGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions("", opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *EdiGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// Standards accepted by the "edi-standard" option.
+const (
+	StandardX12     = "x12"
+	StandardEDIFACT = "edifact"
+)
+
+// syntax describes how a standard writes an order.
+type syntax struct {
+	term string // segment terminator
+	// header returns the segments ahead of the order lines.
+	header func(control string, at time.Time) []string
+	// line returns the segments of order line n, its numbers drawn from r.
+	line func(r *utils.Rand, n int) []string
+	// textPrefix starts a free-text segment; the text follows it.
+	textPrefix string
+	// trailer returns the segments after the order lines, given how many
+	// lines and message segments came before.
+	trailer func(control string, lines, segments int) []string
+	// envelope is how many header segments lie outside the message.
+	envelope int
+}
+
+// maxTextLen is the longest free text a segment carries: X12 MSG01 holds
+// 264 characters (EDIFACT FTX components 512).
+const maxTextLen = 264
+
+var x12 = syntax{
+	term: "~",
+	header: func(control string, at time.Time) []string {
+		return []string{
+			// ISA has fixed-width elements, 106 bytes with its terminator.
+			"ISA*00*          *00*          *ZZ*GENFILE        *ZZ*RECEIVER       *" +
+				at.Format("060102") + "*" + at.Format("1504") + "*U*00401*" + control + "*0*T*>",
+			"GS*PO*GENFILE*RECEIVER*" + at.Format("20060102") + "*" + at.Format("1504") + "*1*X*004010",
+			"ST*850*0001",
+			"BEG*00*SA*PO" + control + "**" + at.Format("20060102"),
+		}
+	},
+	line: func(r *utils.Rand, n int) []string {
+		return []string{fmt.Sprintf("PO1*%d*%d*EA*%d.%02d**VP*ITEM%06d", n, 1+r.IntN(500), r.IntN(1000), r.IntN(100), r.IntN(1_000_000))}
+	},
+	textPrefix: "MSG*",
+	trailer: func(control string, lines, segments int) []string {
+		// SE counts the segments from ST to SE.
+		return []string{
+			fmt.Sprintf("CTT*%d", lines),
+			fmt.Sprintf("SE*%d*0001", segments+2),
+			"GE*1*1",
+			"IEA*1*" + control,
+		}
+	},
+	envelope: 2,
+}
+
+var edifact = syntax{
+	term: "'",
+	header: func(control string, at time.Time) []string {
+		return []string{
+			"UNA:+.? ",
+			"UNB+UNOC:3+GENFILE:ZZ+RECEIVER:ZZ+" + at.Format("060102") + ":" + at.Format("1504") + "+" + control,
+			"UNH+1+ORDERS:D:96A:UN",
+			"BGM+220+PO" + control + "+9",
+			"DTM+137:" + at.Format("20060102") + ":102",
+		}
+	},
+	line: func(r *utils.Rand, n int) []string {
+		return []string{
+			fmt.Sprintf("LIN+%d++ITEM%06d:VP", n, r.IntN(1_000_000)),
+			fmt.Sprintf("QTY+21:%d", 1+r.IntN(500)),
+			fmt.Sprintf("PRI+AAA:%d.%02d", r.IntN(1000), r.IntN(100)),
+		}
+	},
+	textPrefix: "FTX+AAI+++",
+	trailer: func(control string, lines, segments int) []string {
+		// UNT counts the segments from UNH to UNT.
+		return []string{
+			"UNS+S",
+			fmt.Sprintf("CNT+2:%d", lines),
+			fmt.Sprintf("UNT+%d+1", segments+3),
+			"UNZ+1+" + control,
+		}
+	},
+	envelope: 2,
+}
+
+// ediOptions holds the settings the EDI generator reads from ports.Options.
+type ediOptions struct {
+	syntax  syntax
+	newline string // after each segment terminator
+	at      time.Time
+	rand    *utils.Rand
+}
+
+func parseOptions(path string, opts ports.Options) (ediOptions, error) {
+	o := ediOptions{syntax: x12}
+	def := StandardX12
+	if strings.EqualFold(filepath.Ext(path), ".edifact") {
+		def = StandardEDIFACT
+	}
+	switch s := strings.ToLower(opts.String("edi-standard", def)); s {
+	case StandardX12:
+	case StandardEDIFACT:
+		o.syntax = edifact
+	default:
+		return o, fmt.Errorf("unknown edi standard %q (want x12 or edifact)", s)
+	}
+	newline, err := opts.Bool("edi-newline", false)
+	if err != nil {
+		return o, err
+	}
+	if newline {
+		o.newline = "\n"
+	}
+	if o.at, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.at.IsZero() {
+		o.at = time.Now()
+	}
+	o.at = o.at.UTC()
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *EdiGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes an interchange of exactly size bytes: an X12
+// ISA/GS/ST envelope, or EDIFACT UNA/UNB/UNH with "edi-standard" edifact
+// or a .edifact path, around a purchase order whose lines repeat to fill
+// the size. Free-text segments (X12 MSG, EDIFACT FTX) after the last line
+// make up the rest, and the trailer counts agree with the segments.
+// "edi-newline" puts a line break after every segment.
+func (g *EdiGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(path, opts)
+	if err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	if err := writeInterchange(bw, o, size); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write EDI segments: %w", err)
+	}
+	return f.Sync()
+}
+
+// writeInterchange writes an interchange of exactly size bytes to w.
+func writeInterchange(w *bufio.Writer, o ediOptions, size int64) error {
+	s := o.syntax
+	control := fmt.Sprintf("%09d", 1+o.rand.IntN(999_999_999))
+	seg := func(body string) string { return body + s.term + o.newline }
+	segs := func(bodies []string) ([]string, int64) {
+		n := int64(0)
+		for i := range bodies {
+			bodies[i] = seg(bodies[i])
+			n += int64(len(bodies[i]))
+		}
+		return bodies, n
+	}
+	trailerLen := func(lines, segments int) int64 {
+		_, n := segs(s.trailer(control, lines, segments))
+		return n
+	}
+
+	head, used := segs(s.header(control, o.at))
+	if strings.HasPrefix(head[0], "UNA") {
+		// UNA has no terminator.
+		head[0] = strings.TrimSuffix(head[0], s.term+o.newline) + o.newline
+		used -= int64(len(s.term))
+	}
+	message := len(head) - s.envelope // segments counted by the trailer
+
+	// An order needs a line; free text is optional.
+	first, n := segs(s.line(o.rand, 1))
+	if need := used + n + trailerLen(1, message+len(first)); size < need {
+		return fmt.Errorf("target %d too small for an EDI interchange; need at least %d bytes", size, need)
+	}
+	for _, h := range head {
+		if _, err := w.WriteString(h); err != nil {
+			return fmt.Errorf("failed to write EDI segment: %w", err)
+		}
+	}
+
+	// Order lines, while room for two text segments stays free.
+	minText := int64(len(seg(s.textPrefix)) + 1)
+	maxText := minText - 1 + maxTextLen
+	lines := 0
+	for next := first; ; {
+		for _, l := range next {
+			if _, err := w.WriteString(l); err != nil {
+				return fmt.Errorf("failed to write EDI segment: %w", err)
+			}
+		}
+		lines, message, used = lines+1, message+len(next), used+n
+		next, n = segs(s.line(o.rand, lines+1))
+		if used+n+trailerLen(lines+1, message+len(next))+2*maxText > size {
+			break
+		}
+	}
+
+	// Free text makes up the rest, in k segments. Each raises the segment
+	// count, which may lengthen the trailer by a digit.
+	for k := 0; ; k++ {
+		rest := size - used - trailerLen(lines, message+k)
+		if rest < int64(k)*minText {
+			return fmt.Errorf("target %d cannot be reached with whole EDI segments; try a few bytes more", size)
+		}
+		if rest > int64(k)*maxText {
+			continue
+		}
+		for i := 0; i < k; i++ {
+			share := rest / int64(k)
+			if int64(i) < rest%int64(k) {
+				share++
+			}
+			room := int(share - minText + 1)
+			// Some translators trim trailing spaces, so the text ends in a
+			// letter.
+			text := strings.TrimRight(strings.ToUpper(utils.Lorem.Text(o.rand, room)), " ")
+			text += strings.Repeat("X", room-len(text))
+			w.WriteString(seg(s.textPrefix + text))
+		}
+		trailer, _ := segs(s.trailer(control, lines, message+k))
+		for _, t := range trailer {
+			w.WriteString(t)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+package edi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestEdiGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name     string
+		file     string
+		size     int64
+		opts     ports.Options
+		standard string // want
+		errSub   string
+	}{
+		{name: "X12", file: "po.edi", size: 10 * 1024, standard: StandardX12},
+		{name: "X12Large", file: "po.x12", size: 2*1024*1024 + 7, standard: StandardX12},
+		{name: "X12Newlines", file: "po.edi", size: 4096, opts: ports.Options{"edi-newline": "true"}, standard: StandardX12},
+		{name: "X12Small", file: "po.edi", size: 300, standard: StandardX12},
+		{name: "EDIFACTByExtension", file: "po.edifact", size: 10 * 1024, standard: StandardEDIFACT},
+		{name: "EDIFACTByOption", file: "po.edi", size: 1024*1024 + 1, opts: ports.Options{"edi-standard": "EDIFACT", "edi-newline": "true"}, standard: StandardEDIFACT},
+		{name: "TooSmall", file: "po.edi", size: 100, errSub: "too small"},
+		{name: "UnknownStandard", file: "po.edi", size: 4096, opts: ports.Options{"edi-standard": "tradacoms"}, errSub: "unknown edi standard"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			if tc.standard == StandardX12 {
+				checkX12(t, string(data))
+			} else {
+				checkEDIFACT(t, string(data))
+			}
+		})
+	}
+}
+
+func TestEdiGenerator_Sizes(t *testing.T) {
+	// Every size from the smallest interchange up reaches its target.
+	generator := New()
+	dir := t.TempDir()
+	for _, std := range []string{"edi", "edifact"} {
+		for size := int64(500); size < 1500; size++ {
+			path := filepath.Join(dir, "po."+std)
+			if err := generator.Generate(path, size); err != nil {
+				t.Fatalf("%s of %d bytes: %v", std, size, err)
+			}
+			if info, _ := os.Stat(path); info.Size() != size {
+				t.Fatalf("%s of %d bytes is %d bytes", std, size, info.Size())
+			}
+		}
+	}
+}
+
+// segments splits an interchange at term, dropping line breaks.
+func segments(data, term string) []string {
+	segs := strings.Split(strings.TrimSuffix(strings.TrimSpace(data), term), term)
+	for i := range segs {
+		segs[i] = strings.TrimPrefix(segs[i], "\n")
+	}
+	return segs
+}
+
+func checkX12(t *testing.T, data string) {
+	t.Helper()
+	if len(data) < 106 || !strings.HasPrefix(data, "ISA*") || data[105] != '~' {
+		t.Fatalf("ISA is not 106 bytes: %.110q", data)
+	}
+	segs := segments(data, "~")
+	control := strings.Split(segs[0], "*")[13]
+	want := []string{"ISA", "GS", "ST", "BEG"}
+	for i, id := range want {
+		if !strings.HasPrefix(segs[i], id+"*") {
+			t.Fatalf("segment %d = %q, want %s", i, segs[i], id)
+		}
+	}
+	n := len(segs)
+	if segs[n-1] != "IEA*1*"+control || segs[n-2] != "GE*1*1" {
+		t.Fatalf("trailer = %q, want GE and IEA with control %s", segs[n-4:], control)
+	}
+	lines := 0
+	for _, s := range segs {
+		if strings.HasPrefix(s, "PO1*") {
+			lines++
+			if s != "PO1*"+strconv.Itoa(lines)+s[len(fmt.Sprint(lines))+4:] {
+				t.Errorf("line %d is numbered %q", lines, s)
+			}
+		}
+	}
+	if segs[n-4] != fmt.Sprintf("CTT*%d", lines) {
+		t.Errorf("CTT = %q, want %d lines", segs[n-4], lines)
+	}
+	// SE counts ST through SE.
+	if want := fmt.Sprintf("SE*%d*0001", n-4); segs[n-3] != want {
+		t.Errorf("SE = %q, want %q", segs[n-3], want)
+	}
+}
+
+func checkEDIFACT(t *testing.T, data string) {
+	t.Helper()
+	if !strings.HasPrefix(data, "UNA:+.? ") {
+		t.Fatalf("no UNA service string advice: %.20q", data)
+	}
+	segs := segments(strings.TrimPrefix(data[len("UNA:+.? "):], "\n"), "'")
+	control := strings.Split(segs[0], "+")[5]
+	want := []string{"UNB", "UNH", "BGM", "DTM"}
+	for i, id := range want {
+		if !strings.HasPrefix(segs[i], id+"+") {
+			t.Fatalf("segment %d = %q, want %s", i, segs[i], id)
+		}
+	}
+	n := len(segs)
+	if segs[n-1] != "UNZ+1+"+control {
+		t.Fatalf("UNZ = %q, want control %s", segs[n-1], control)
+	}
+	lines := 0
+	for _, s := range segs {
+		if strings.HasPrefix(s, "LIN+") {
+			lines++
+		}
+	}
+	if segs[n-3] != fmt.Sprintf("CNT+2:%d", lines) {
+		t.Errorf("CNT = %q, want %d lines", segs[n-3], lines)
+	}
+	// UNT counts UNH through UNT.
+	if want := fmt.Sprintf("UNT+%d+1", n-2); segs[n-2] != want {
+		t.Errorf("UNT = %q, want %q", segs[n-2], want)
+	}
+}
@@ -0,0 +1,118 @@
+// Package embed renders files of any registered type for generators that
+// embed them in their own output: attachments in a PDF, media and objects
+// in a DOCX.
+package embed
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// Item is a file to embed: its type and size.
+type Item struct {
+	Type ports.FileType
+	Size int64
+}
+
+// File is a rendered Item and the name it is embedded under.
+type File struct {
+	Name string
+	Type ports.FileType
+	Data []byte
+}
+
+// ParseItems parses a comma-separated list of items written type:size,
+// such as "png:50KB,csv:20KB". option names the option the list came
+// from, for errors.
+func ParseItems(option, spec string) ([]Item, error) {
+	var items []Item
+	for _, s := range strings.Split(spec, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		t, size, ok := strings.Cut(s, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s entry %q is not type:size (e.g. png:50KB)", option, s)
+		}
+		n, err := utils.ParseSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("%s entry %q: %w", option, s, err)
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("%s entry %q: size must be positive", option, s)
+		}
+		items = append(items, Item{Type: ports.FileType(strings.ToLower(strings.TrimSpace(t))), Size: n})
+	}
+	return items, nil
+}
+
+// Options returns the options in opts meant for embedded files: all but
+// those starting with prefix, which belong to the embedding generator, and
+// those it handles itself, listed in OwnOptions.
+func Options(opts ports.Options, prefix string) ports.Options {
+	var inner ports.Options
+	for k, v := range opts {
+		if strings.HasPrefix(k, prefix) || OwnOptions[k] {
+			continue
+		}
+		if inner == nil {
+			inner = ports.Options{}
+		}
+		inner[k] = v
+	}
+	return inner
+}
+
+// OwnOptions are the options a generator embedding files applies to the
+// file as a whole: the EICAR test string and a planted search string,
+// which would turn up again in every embedded file, and the signature
+// placeholders, which prepare the file itself for signing.
+var OwnOptions = map[string]bool{"eicar": true, "embed-string": true, "embed-count": true, "signature-placeholder": true}
+
+// Render generates each of items with the generators of f, the default
+// registry's if nil, applying opts to those that take options, and names
+// them after base, numbered from 1 and with their type as extension:
+// base_001.png and so on. They are generated in a temporary directory on
+// fsys and held in memory.
+func Render(f ports.GeneratorFactory, fsys ports.OutputFS, items []Item, base string, opts ports.Options) ([]File, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	if f == nil {
+		f = factory.NewGeneratorFactory()
+	}
+	tmpDir, err := outputfs.MkdirTemp(fsys, "genfile-embed-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir for embedded files: %w", err)
+	}
+	defer outputfs.RemoveAll(fsys, tmpDir)
+
+	files := make([]File, len(items))
+	for i, item := range items {
+		gen, err := f.For(item.Type)
+		if _, ok := ports.As[ports.ConfigurableGenerator](gen); ok && len(opts) > 0 {
+			gen, err = f.ForOptions(item.Type, opts)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("embedded file type: %w", err)
+		}
+		name := fmt.Sprintf("%s_%03d.%s", base, i+1, item.Type)
+		// Generators go by the extension of the path they write to.
+		path := filepath.Join(tmpDir, name)
+		if err := gen.Generate(path, item.Size); err != nil {
+			return nil, fmt.Errorf("failed to generate embedded file %s: %w", name, err)
+		}
+		data, err := outputfs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedded file %s: %w", name, err)
+		}
+		files[i] = File{Name: name, Type: item.Type, Data: data}
+	}
+	return files, nil
+}
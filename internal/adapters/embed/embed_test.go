@@ -0,0 +1,89 @@
+package embed
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	_ "github.com/hailam/genfile/internal/adapters/csv"
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestParseItems(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []Item
+		wantErr string
+	}{
+		{spec: "", want: nil},
+		{spec: "png:50KB", want: []Item{{Type: "png", Size: 50_000}}},
+		{spec: " PNG:1KiB , csv:20 ,", want: []Item{{Type: "png", Size: 1024}, {Type: "csv", Size: 20}}},
+		{spec: "png", wantErr: "not type:size"},
+		{spec: "png:lots", wantErr: `"png:lots"`},
+		{spec: "png:0", wantErr: "must be positive"},
+	}
+	for _, tc := range tests {
+		got, err := ParseItems("test-option", tc.spec)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ParseItems(%q) error = %v, want %q", tc.spec, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || len(got) != len(tc.want) {
+			t.Errorf("ParseItems(%q) = %v, %v; want %v", tc.spec, got, err, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("ParseItems(%q)[%d] = %v, want %v", tc.spec, i, got[i], tc.want[i])
+			}
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	files, err := Render(nil, nil, []Item{{Type: ports.FileTypeCSV, Size: 2048}, {Type: ports.FileTypeCSV, Size: 4096}}, "part", ports.Options{"csv-columns": "3"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "part_001.csv" || files[1].Name != "part_002.csv" {
+		t.Fatalf("Render() = %v, want part_001.csv and part_002.csv", files)
+	}
+	if len(files[0].Data) != 2048 || len(files[1].Data) != 4096 {
+		t.Errorf("sizes = %d, %d; want 2048, 4096", len(files[0].Data), len(files[1].Data))
+	}
+	if header, _, _ := strings.Cut(string(files[0].Data), "\n"); strings.Count(header, ",") != 2 {
+		t.Errorf("header %q does not have 3 columns", header)
+	}
+
+	if _, err := Render(nil, nil, []Item{{Type: "nope", Size: 10}}, "part", nil); err == nil {
+		t.Error("Render() of an unregistered type succeeded")
+	}
+
+	// The files come from the factory given and are written on its file
+	// system, not the default registry's.
+	csv := []Item{{Type: ports.FileTypeCSV, Size: 2048}}
+	empty := factory.NewRegistryFactory(factory.NewRegistry(), nil, nil)
+	if _, err := Render(empty, nil, csv, "part", nil); err == nil {
+		t.Error("Render() with a factory lacking CSV succeeded")
+	}
+	chaos := &outputfs.Chaos{Faults: []outputfs.Fault{{Kind: outputfs.FaultNoSpace, Offset: 1024}}}
+	full := factory.NewRegistryFactory(factory.DefaultRegistry(), nil, chaos)
+	if _, err := Render(full, chaos, csv, "part", nil); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("Render() on a full file system error = %v, want ENOSPC", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	got := Options(ports.Options{"pdf-pages": "2", "eicar": "true", "png-color": "gray", "mtime": "2020-01-01"}, "pdf-")
+	if len(got) != 2 || got["png-color"] != "gray" || got["mtime"] != "2020-01-01" {
+		t.Errorf("Options() = %v, want png-color and mtime", got)
+	}
+	if got := Options(ports.Options{"pdf-pages": "2"}, "pdf-"); got != nil {
+		t.Errorf("Options() = %v, want nil", got)
+	}
+}
@@ -3,55 +3,86 @@ package factory
 
 import (
 	"fmt"
-	"log"
-	"sync"
 
 	"github.com/hailam/genfile/internal/ports"
 )
 
-// registry stores the registered generators.
-var (
-	generatorRegistry = make(map[ports.FileType]ports.FileGenerator)
-	registryMutex     sync.RWMutex
-)
-
 // RegisterGenerator is called by generator packages during their init() phase.
+// It registers with the default registry (see DefaultRegistry).
 func RegisterGenerator(fileType ports.FileType, generator ports.FileGenerator) {
-	registryMutex.Lock()
-	defer registryMutex.Unlock()
-	if _, exists := generatorRegistry[fileType]; exists {
-		log.Printf("Warning: Duplicate generator registration for %s. Overwriting existing one.", fileType)
-	}
-	generatorRegistry[fileType] = generator
-	// fmt.Printf("factory: Registered generator for %s\n", fileType)
+	defaultRegistry.Register(fileType, generator)
 }
 
-// DynamicGeneratorFactory uses the registry populated by RegisterGenerator.
-type DynamicGeneratorFactory struct{}
+// DynamicGeneratorFactory looks generators up in a Registry, by default
+// the one populated by RegisterGenerator. It holds no state of its own
+// beyond the registry, so it is as safe for concurrent use as the
+// generators it hands out.
+type DynamicGeneratorFactory struct {
+	registry *Registry
+	logger   ports.Logger
+	fs       ports.OutputFS
+}
 
-// NewGeneratorFactory creates a new factory that uses the global registry.
+// NewGeneratorFactory creates a new factory that uses the default registry.
 func NewGeneratorFactory() ports.GeneratorFactory {
-	return &DynamicGeneratorFactory{}
+	return &DynamicGeneratorFactory{registry: defaultRegistry}
 }
 
-// For returns the appropriate FileGenerator for the given FileType from the registry.
-func (f *DynamicGeneratorFactory) For(t ports.FileType) (ports.FileGenerator, error) {
-	registryMutex.RLock()
-	defer registryMutex.RUnlock()
+// NewLoggingGeneratorFactory is like NewGeneratorFactory, but generators
+// that report diagnostics (ports.LoggingGenerator) are handed out with l.
+func NewLoggingGeneratorFactory(l ports.Logger) ports.GeneratorFactory {
+	return &DynamicGeneratorFactory{registry: defaultRegistry, logger: l}
+}
+
+// NewRegistryFactory creates a factory that uses r instead of the default
+// registry, handing out logging generators with l unless l is nil, and
+// generators writing on fsys (ports.OutputFSGenerator) unless fsys is nil.
+// Each FileService given such a factory sees only the generators in its
+// registry.
+func NewRegistryFactory(r *Registry, l ports.Logger, fsys ports.OutputFS) ports.GeneratorFactory {
+	return &DynamicGeneratorFactory{registry: r, logger: l, fs: fsys}
+}
 
-	gen, ok := generatorRegistry[t]
+// For returns the appropriate FileGenerator for the given FileType from the
+// registry. Generators nesting files of other types in theirs
+// (ports.NestingGenerator) get those generators from f too.
+func (f *DynamicGeneratorFactory) For(t ports.FileType) (ports.FileGenerator, error) {
+	gen, ok := f.registry.Lookup(t)
 	if !ok {
 		return nil, fmt.Errorf("unsupported file type: '%s' (no generator registered or check file extension)", t)
 	}
+	if lg, ok := ports.As[ports.LoggingGenerator](gen); ok && f.logger != nil {
+		gen = lg.WithLogger(f.logger)
+	}
+	if og, ok := ports.As[ports.OutputFSGenerator](gen); ok && f.fs != nil {
+		gen = og.WithOutputFS(f.fs)
+	}
+	if ng, ok := ports.As[ports.NestingGenerator](gen); ok {
+		gen = ng.WithFactory(f)
+	}
 	return gen, nil
 }
 
-func RegisteredTypes() []ports.FileType {
-	registryMutex.RLock()
-	defer registryMutex.RUnlock()
-	types := make([]ports.FileType, 0, len(generatorRegistry))
-	for t := range generatorRegistry {
-		types = append(types, t)
+// ForOptions returns the generator for t, as For does, configured with
+// opts. Without options it is the same as For.
+func (f *DynamicGeneratorFactory) ForOptions(t ports.FileType, opts ports.Options) (ports.FileGenerator, error) {
+	gen, err := f.For(t)
+	if err != nil || len(opts) == 0 {
+		return gen, err
+	}
+	cg, ok := ports.As[ports.ConfigurableGenerator](gen)
+	if !ok {
+		return nil, fmt.Errorf("generator for type '%s' does not accept options", t)
 	}
-	return types
+	configured, err := cg.Configure(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options for type '%s': %w", t, err)
+	}
+	return configured, nil
+}
+
+// RegisteredTypes returns the types in the default registry, in no
+// particular order.
+func RegisteredTypes() []ports.FileType {
+	return defaultRegistry.Types()
 }
@@ -5,7 +5,6 @@ import (
 	"reflect"
 	"sort"
 	"strings"
-	"sync"
 	"testing"
 
 	"github.com/hailam/genfile/internal/ports" //
@@ -20,16 +19,15 @@ func (m *MockGenerator) Generate(outPath string, sizeBytes int64) error {
 	return fmt.Errorf("mock generate called for %s", m.id)
 }
 
-// --- Test Helper to Reset Registry ---
-// WARNING: This modifies global state and should be used carefully, ideally
-// by running tests sequentially or ensuring no parallel tests modify the registry.
-var testRegistryMutex sync.Mutex // Use a separate mutex for test manipulation
+// --- Test Helper to Scope the Default Registry ---
 
-func resetRegistry() {
-	testRegistryMutex.Lock()
-	defer testRegistryMutex.Unlock()
-	// Create a new map to effectively clear the old one
-	generatorRegistry = make(map[ports.FileType]ports.FileGenerator)
+// useRegistry makes an empty registry the default for the rest of the
+// test, so that tests of the package-level functions leave the registry
+// the generator packages populate alone.
+func useRegistry(t *testing.T) {
+	saved := defaultRegistry
+	defaultRegistry = NewRegistry()
+	t.Cleanup(func() { defaultRegistry = saved })
 }
 
 // --- Test Cases ---
@@ -48,7 +46,7 @@ func TestNewGeneratorFactory(t *testing.T) {
 }
 
 func TestDynamicGeneratorFactory_For(t *testing.T) {
-	resetRegistry() // Start with a clean registry for this test
+	useRegistry(t) // Start with a clean registry for this test
 
 	// Setup: Register some mock generators
 	mockGenTxt := &MockGenerator{id: "txt-gen"}
@@ -121,7 +119,7 @@ func TestDynamicGeneratorFactory_For(t *testing.T) {
 }
 
 func TestRegisterGenerator_Overwrite(t *testing.T) {
-	resetRegistry() // Clean slate
+	useRegistry(t) // Clean slate
 
 	mockGen1 := &MockGenerator{id: "gen1"}
 	mockGen2 := &MockGenerator{id: "gen2"}
@@ -154,7 +152,7 @@ func TestRegisterGenerator_Overwrite(t *testing.T) {
 }
 
 func TestRegisteredTypes(t *testing.T) {
-	resetRegistry() // Clean slate
+	useRegistry(t) // Clean slate
 
 	// Register some types
 	RegisterGenerator(ports.FileTypeZIP, &MockGenerator{id: "zip"}) //
@@ -185,9 +183,218 @@ func TestRegisteredTypes(t *testing.T) {
 	}
 
 	// Test with empty registry
-	resetRegistry()
+	defaultRegistry = NewRegistry()
 	gotTypes = RegisteredTypes()
 	if len(gotTypes) != 0 {
 		t.Errorf("RegisteredTypes() on empty registry = %v, want empty slice", gotTypes)
 	}
 }
+
+// MockLoggingGenerator records the logger it was handed.
+type MockLoggingGenerator struct {
+	MockGenerator
+	log ports.Logger
+}
+
+func (m *MockLoggingGenerator) WithLogger(l ports.Logger) ports.FileGenerator {
+	c := *m
+	c.log = l
+	return &c
+}
+
+type mockLogger struct{}
+
+func (mockLogger) Debugf(string, ...any) {}
+func (mockLogger) Infof(string, ...any)  {}
+func (mockLogger) Warnf(string, ...any)  {}
+
+func TestLoggingGeneratorFactory_For(t *testing.T) {
+	useRegistry(t)
+
+	registered := &MockLoggingGenerator{MockGenerator: MockGenerator{id: "xml"}}
+	RegisterGenerator(ports.FileTypeXML, registered)
+	RegisterGenerator(ports.FileTypeTXT, &MockGenerator{id: "txt"})
+
+	logger := mockLogger{}
+	factory := NewLoggingGeneratorFactory(logger)
+
+	gen, err := factory.For(ports.FileTypeXML)
+	if err != nil {
+		t.Fatalf("For(XML) failed: %v", err)
+	}
+	got, ok := gen.(*MockLoggingGenerator)
+	if !ok {
+		t.Fatalf("For(XML) returned type %T, want *MockLoggingGenerator", gen)
+	}
+	if got.log != logger {
+		t.Errorf("For(XML) returned a generator with logger %v, want %v", got.log, logger)
+	}
+	if registered.log != nil {
+		t.Error("For(XML) modified the registered generator")
+	}
+
+	// Generators that do not log are returned as registered.
+	gen, err = factory.For(ports.FileTypeTXT)
+	if err != nil {
+		t.Fatalf("For(TXT) failed: %v", err)
+	}
+	if mock, ok := gen.(*MockGenerator); !ok || mock.id != "txt" {
+		t.Errorf("For(TXT) returned %v, want the registered txt generator", gen)
+	}
+}
+
+// MockOutputFSGenerator records the logger and file system it was handed.
+type MockOutputFSGenerator struct {
+	MockLoggingGenerator
+	fs ports.OutputFS
+}
+
+func (m *MockOutputFSGenerator) WithLogger(l ports.Logger) ports.FileGenerator {
+	c := *m
+	c.log = l
+	return &c
+}
+
+func (m *MockOutputFSGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *m
+	c.fs = fsys
+	return &c
+}
+
+type mockFS struct{}
+
+func (mockFS) Create(string) (ports.OutputFile, error) { return nil, nil }
+func (mockFS) Open(string) (ports.OutputFile, error)   { return nil, nil }
+
+func TestRegistryFactory_OutputFS(t *testing.T) {
+	r := NewRegistry()
+	registered := &MockOutputFSGenerator{MockLoggingGenerator: MockLoggingGenerator{MockGenerator: MockGenerator{id: "png"}}}
+	r.Register(ports.FileTypePNG, registered)
+	r.Register(ports.FileTypeTXT, &MockGenerator{id: "txt"})
+	logger, fsys := mockLogger{}, mockFS{}
+
+	gen, err := NewRegistryFactory(r, logger, fsys).For(ports.FileTypePNG)
+	if err != nil {
+		t.Fatalf("For(PNG) failed: %v", err)
+	}
+	got, ok := gen.(*MockOutputFSGenerator)
+	if !ok || got.fs != fsys || got.log != logger {
+		t.Errorf("For(PNG) = %+v, want a generator with the factory's logger and file system", gen)
+	}
+	if registered.fs != nil {
+		t.Error("For(PNG) modified the registered generator")
+	}
+
+	// Without a file system generators write on the operating system's.
+	if gen, err := NewRegistryFactory(r, nil, nil).For(ports.FileTypePNG); err != nil || gen.(*MockOutputFSGenerator).fs != nil {
+		t.Errorf("For(PNG) without a file system = %v, %v", gen, err)
+	}
+	if gen, err := NewRegistryFactory(r, nil, fsys).For(ports.FileTypeTXT); err != nil || gen.(*MockGenerator).id != "txt" {
+		t.Errorf("For(TXT) = %v, %v; want the registered txt generator", gen, err)
+	}
+}
+
+// MockNestingGenerator records the factory it was handed.
+type MockNestingGenerator struct {
+	MockGenerator
+	factory ports.GeneratorFactory
+}
+
+func (m *MockNestingGenerator) WithFactory(f ports.GeneratorFactory) ports.FileGenerator {
+	c := *m
+	c.factory = f
+	return &c
+}
+
+func TestRegistryFactory_Nesting(t *testing.T) {
+	r := NewRegistry()
+	registered := &MockNestingGenerator{MockGenerator: MockGenerator{id: "zip"}}
+	r.Register(ports.FileTypeZIP, registered)
+	f := NewRegistryFactory(r, nil, mockFS{})
+
+	gen, err := f.For(ports.FileTypeZIP)
+	if err != nil {
+		t.Fatalf("For(ZIP) failed: %v", err)
+	}
+	if got, ok := gen.(*MockNestingGenerator); !ok || got.factory != f {
+		t.Errorf("For(ZIP) = %+v, want a generator with the factory itself", gen)
+	}
+	if registered.factory != nil {
+		t.Error("For(ZIP) modified the registered generator")
+	}
+}
+
+// MockConfigurableGenerator records the options it was configured with.
+type MockConfigurableGenerator struct {
+	MockGenerator
+	opts ports.Options
+}
+
+func (m *MockConfigurableGenerator) GenerateWithOptions(string, int64, ports.Options) error {
+	return nil
+}
+
+func (m *MockConfigurableGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	if opts.Has("bad") {
+		return nil, fmt.Errorf("bad option")
+	}
+	c := *m
+	c.opts = m.opts.With(opts)
+	return &c, nil
+}
+
+func TestDynamicGeneratorFactory_ForOptions(t *testing.T) {
+	useRegistry(t)
+
+	registered := &MockConfigurableGenerator{MockGenerator: MockGenerator{id: "png"}}
+	RegisterGenerator(ports.FileTypePNG, registered)
+	RegisterGenerator(ports.FileTypeTXT, &MockGenerator{id: "txt"})
+	factory := NewGeneratorFactory()
+
+	gen, err := factory.ForOptions(ports.FileTypePNG, ports.Options{"width": "10"})
+	if err != nil {
+		t.Fatalf("ForOptions(PNG) failed: %v", err)
+	}
+	got, ok := gen.(*MockConfigurableGenerator)
+	if !ok || got.opts["width"] != "10" {
+		t.Errorf("ForOptions(PNG) returned %v, want a generator configured with width 10", gen)
+	}
+	if registered.opts != nil {
+		t.Error("ForOptions(PNG) modified the registered generator")
+	}
+
+	if _, err := factory.ForOptions(ports.FileTypePNG, ports.Options{"bad": "1"}); err == nil || !strings.Contains(err.Error(), "invalid options for type 'png'") {
+		t.Errorf("ForOptions(PNG) with a bad option: error = %v, want invalid options", err)
+	}
+	if _, err := factory.ForOptions(ports.FileTypeTXT, ports.Options{"width": "10"}); err == nil || !strings.Contains(err.Error(), "does not accept options") {
+		t.Errorf("ForOptions(TXT) with options: error = %v, want does not accept options", err)
+	}
+	// Without options ForOptions is For.
+	if gen, err := factory.ForOptions(ports.FileTypeTXT, nil); err != nil || gen.(*MockGenerator).id != "txt" {
+		t.Errorf("ForOptions(TXT, nil) = %v, %v; want the registered txt generator", gen, err)
+	}
+
+	// A decorator supports the ports of the generator it wraps, whatever
+	// methods it has itself.
+	RegisterGenerator(ports.FileTypeCSV, &MockDecorator{inner: &MockGenerator{id: "csv"}})
+	if _, err := factory.ForOptions(ports.FileTypeCSV, ports.Options{"width": "10"}); err == nil || !strings.Contains(err.Error(), "does not accept options") {
+		t.Errorf("ForOptions(CSV) of a decorated generator: error = %v, want does not accept options", err)
+	}
+}
+
+// MockDecorator wraps a generator and has every method of a configurable
+// one, as decorators do.
+type MockDecorator struct {
+	inner ports.FileGenerator
+}
+
+func (m *MockDecorator) Generate(path string, size int64) error { return m.inner.Generate(path, size) }
+func (m *MockDecorator) Unwrap() ports.FileGenerator            { return m.inner }
+
+func (m *MockDecorator) GenerateWithOptions(string, int64, ports.Options) error {
+	return fmt.Errorf("not supported")
+}
+
+func (m *MockDecorator) Configure(ports.Options) (ports.FileGenerator, error) {
+	return nil, fmt.Errorf("not supported")
+}
@@ -0,0 +1,74 @@
+package factory
+
+import (
+	"log"
+	"maps"
+	"sync"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// Registry maps file types to the generators that write them. The
+// generator packages register with the default registry from their init
+// functions; a program embedding genfile can make registries of its own,
+// starting empty or from a copy of the default, so that two differently
+// configured instances can run side by side.
+//
+// A Registry is safe for concurrent use: generators can be registered
+// while others are looked up.
+type Registry struct {
+	mu         sync.RWMutex
+	generators map[ports.FileType]ports.FileGenerator
+}
+
+// defaultRegistry is the registry RegisterGenerator adds to.
+var defaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{generators: make(map[ports.FileType]ports.FileGenerator)}
+}
+
+// DefaultRegistry returns the registry the generator packages register
+// with, which NewGeneratorFactory uses.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register makes generator the one for fileType, replacing any registered
+// before it.
+func (r *Registry) Register(fileType ports.FileType, generator ports.FileGenerator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.generators[fileType]; exists {
+		log.Printf("Warning: Duplicate generator registration for %s. Overwriting existing one.", fileType)
+	}
+	r.generators[fileType] = generator
+}
+
+// Lookup returns the generator registered for fileType, if any.
+func (r *Registry) Lookup(fileType ports.FileType) (ports.FileGenerator, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	g, ok := r.generators[fileType]
+	return g, ok
+}
+
+// Types returns the registered types, in no particular order.
+func (r *Registry) Types() []ports.FileType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]ports.FileType, 0, len(r.generators))
+	for t := range r.generators {
+		types = append(types, t)
+	}
+	return types
+}
+
+// Clone returns a registry holding the same generators as r, which can
+// then be changed without affecting r.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &Registry{generators: maps.Clone(r.generators)}
+}
@@ -0,0 +1,81 @@
+package factory
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestRegistry_Scoped(t *testing.T) {
+	a, b := NewRegistry(), NewRegistry()
+	a.Register(ports.FileTypeTXT, &MockGenerator{id: "a"})
+	b.Register(ports.FileTypeTXT, &MockGenerator{id: "b"})
+	b.Register(ports.FileTypePNG, &MockGenerator{id: "b-png"})
+
+	for _, tc := range []struct {
+		registry *Registry
+		wantID   string
+	}{{a, "a"}, {b, "b"}} {
+		gen, err := NewRegistryFactory(tc.registry, nil, nil).For(ports.FileTypeTXT)
+		if err != nil {
+			t.Fatalf("For(TXT) failed: %v", err)
+		}
+		if got := gen.(*MockGenerator).id; got != tc.wantID {
+			t.Errorf("For(TXT) = %q, want %q", got, tc.wantID)
+		}
+	}
+	if _, err := NewRegistryFactory(a, nil, nil).For(ports.FileTypePNG); err == nil {
+		t.Error("For(PNG) found a generator registered with another registry")
+	}
+
+	// A clone starts with the same generators and then goes its own way.
+	c := b.Clone()
+	c.Register(ports.FileTypeTXT, &MockGenerator{id: "c"})
+	c.Register(ports.FileTypeCSV, &MockGenerator{id: "c-csv"})
+	if g, _ := b.Lookup(ports.FileTypeTXT); g.(*MockGenerator).id != "b" {
+		t.Errorf("registering with a clone replaced the original's generator with %v", g)
+	}
+	if _, ok := b.Lookup(ports.FileTypeCSV); ok {
+		t.Error("registering with a clone added to the original")
+	}
+	if g, ok := c.Lookup(ports.FileTypePNG); !ok || g.(*MockGenerator).id != "b-png" {
+		t.Errorf("clone Lookup(PNG) = %v, %v; want the original's generator", g, ok)
+	}
+	if n := len(c.Types()); n != 3 {
+		t.Errorf("clone holds %d types, want 3", n)
+	}
+}
+
+func TestRegistry_Concurrent(t *testing.T) {
+	// Run with -race: registering, looking up and listing at once must not
+	// race.
+	r := NewRegistry()
+	f := NewRegistryFactory(r, mockLogger{}, nil)
+	types := make([]ports.FileType, 50)
+	for i := range types {
+		types[i] = ports.FileType(fmt.Sprintf("t%d", i))
+	}
+	var wg sync.WaitGroup
+	for _, ft := range types {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r.Register(ft, &MockGenerator{id: string(ft)})
+		}()
+		go func() {
+			defer wg.Done()
+			f.For(ft)
+			r.Types()
+			r.Clone()
+		}()
+	}
+	wg.Wait()
+	for _, ft := range types {
+		gen, err := f.For(ft)
+		if err != nil || gen.(*MockGenerator).id != string(ft) {
+			t.Errorf("For(%s) = %v, %v", ft, gen, err)
+		}
+	}
+}
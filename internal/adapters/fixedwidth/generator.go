@@ -0,0 +1,331 @@
+package fixedwidth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/logging"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeFWF, New())
+}
+
+// FixedWidthGenerator writes mainframe-style flat files: records of one
+// fixed length, each field at a fixed offset.
+type FixedWidthGenerator struct {
+	opts ports.Options // set by Configure
+	log  ports.Logger
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &FixedWidthGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *FixedWidthGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *FixedWidthGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// WithLogger returns a copy of the generator that reports to l.
+func (g *FixedWidthGenerator) WithLogger(l ports.Logger) ports.FileGenerator {
+	c := *g
+	c.log = l
+	return &c
+}
+
+// SizeStep returns the length of a record with its newline: a size that
+// is not a multiple of it ends with a short record.
+func (g *FixedWidthGenerator) SizeStep() int64 {
+	o, err := parseOptions(g.opts)
+	if err != nil {
+		return 1
+	}
+	return int64(o.length + len(o.newline))
+}
+
+func (g *FixedWidthGenerator) logger() ports.Logger {
+	if g.log == nil {
+		return logging.Nop
+	}
+	return g.log
+}
+
+// Field kinds of a layout.
+const (
+	KindAlpha   = 'A' // text, left-justified and padded with spaces
+	KindNumeric = 'N' // digits, right-justified and padded with zeros
+	KindDate    = 'D' // CCYYMMDD
+)
+
+// defaultRecordLength is the record length without "fw-record-length" or
+// "fw-layout", that of a punched card.
+const defaultRecordLength = 80
+
+// field is one column of a record layout.
+type field struct {
+	name  string
+	kind  byte
+	width int
+}
+
+// defaultLayout is cut or filled to the record length.
+var defaultLayout = []field{
+	{"ID", KindNumeric, 9},
+	{"NAME", KindAlpha, 20},
+	{"CITY", KindAlpha, 15},
+	{"DATE", KindDate, 8},
+	{"AMOUNT", KindNumeric, 11},
+	{"STATUS", KindAlpha, 1},
+}
+
+// newlines maps the "fw-newline" values to record separators.
+var newlines = map[string]string{"lf": "\n", "crlf": "\r\n", "none": ""}
+
+// fwOptions holds the settings the fixed-width generator reads from
+// ports.Options.
+type fwOptions struct {
+	layout  []field
+	length  int  // record length without the newline
+	pinned  bool // length was set, directly or by a layout
+	newline string
+	rand    *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (fwOptions, error) {
+	o := fwOptions{length: defaultRecordLength, layout: defaultLayout}
+	nl := strings.ToLower(opts.String("fw-newline", "lf"))
+	var ok bool
+	if o.newline, ok = newlines[nl]; !ok {
+		return o, fmt.Errorf("unknown fw-newline %q (want lf, crlf or none)", nl)
+	}
+	var err error
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+
+	if spec := opts.String("fw-layout", ""); spec != "" {
+		layout, err := parseLayout(spec)
+		if err != nil {
+			return o, err
+		}
+		o.layout, o.length, o.pinned = layout, 0, true
+		for _, f := range layout {
+			o.length += f.width
+		}
+	}
+	if opts.Has("fw-record-length") {
+		n, err := opts.Int("fw-record-length", 0)
+		if err != nil {
+			return o, err
+		}
+		if n < 1 {
+			return o, fmt.Errorf("fw-record-length must be at least 1, got %d", n)
+		}
+		if o.pinned && n < o.length {
+			return o, fmt.Errorf("fw-layout needs %d bytes, more than fw-record-length %d", o.length, n)
+		}
+		o.length, o.pinned = n, true
+	}
+	return o, nil
+}
+
+// parseLayout parses a comma-separated list of name:kind:width fields,
+// such as "id:N:10,name:A:30,born:D:8".
+func parseLayout(spec string) ([]field, error) {
+	var layout []field
+	for _, part := range strings.Split(spec, ",") {
+		bits := strings.Split(strings.TrimSpace(part), ":")
+		if len(bits) != 3 || bits[0] == "" || len(bits[1]) != 1 {
+			return nil, fmt.Errorf("invalid fw-layout field %q (want name:kind:width)", part)
+		}
+		f := field{name: strings.ToUpper(bits[0]), kind: strings.ToUpper(bits[1])[0]}
+		switch f.kind {
+		case KindAlpha, KindNumeric, KindDate:
+		default:
+			return nil, fmt.Errorf("unknown fw-layout kind %q in %q (want A, N or D)", bits[1], part)
+		}
+		width, err := strconv.Atoi(bits[2])
+		if err != nil || width < 1 {
+			return nil, fmt.Errorf("invalid fw-layout width in %q", part)
+		}
+		if f.kind == KindDate && width != 8 {
+			return nil, fmt.Errorf("fw-layout date field %q must be 8 wide, got %d", f.name, width)
+		}
+		f.width = width
+		layout = append(layout, f)
+	}
+	return layout, nil
+}
+
+// fit returns o's layout cut or filled with a FILLER field to length.
+func (o fwOptions) fit(length int) []field {
+	var out []field
+	used := 0
+	for _, f := range o.layout {
+		if used+f.width > length {
+			// A cut date would not parse, so it becomes text.
+			out = append(out, field{f.name, KindAlpha, length - used})
+			used = length
+			break
+		}
+		out = append(out, f)
+		used += f.width
+	}
+	if used < length {
+		out = append(out, field{"FILLER", KindAlpha, length - used})
+	}
+	return out
+}
+
+func (g *FixedWidthGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+func (g *FixedWidthGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return err
+	}
+	return g.writeFile(path, func(w io.Writer) error { return g.GenerateTo(w, size, opts) })
+}
+
+// GenerateTo writes size bytes of records to w: "fw-record-length" bytes
+// each (80 by default) plus the "fw-newline" separator, laid out by
+// "fw-layout" or a default of ID, NAME, CITY, DATE, AMOUNT and STATUS
+// columns. A size that is not a whole number of records ends with a short
+// record.
+func (g *FixedWidthGenerator) GenerateTo(w io.Writer, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	layout := o.fit(o.length)
+	recLen := int64(o.length + len(o.newline))
+	if rest := max(size, 0) % recLen; rest != 0 {
+		g.logger().Warnf("%d bytes is not a whole number of %d-byte records; the last record is %d bytes", size, recLen, rest)
+	}
+	bw := bufio.NewWriter(w)
+	for n := int64(1); size > 0; n++ {
+		rec := record(o.rand, layout, n) + o.newline
+		if int64(len(rec)) > size {
+			rec = rec[:size]
+			if size > int64(len(o.newline)) {
+				rec = rec[:size-int64(len(o.newline))] + o.newline
+			}
+		}
+		if _, err := bw.WriteString(rec); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+		size -= int64(len(rec))
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write records: %w", err)
+	}
+	return nil
+}
+
+// GenerateLines writes exactly lines records. With a byte size as well and
+// no record length or layout, the record length is the size divided by
+// lines; otherwise the size must match the records exactly.
+func (g *FixedWidthGenerator) GenerateLines(path string, size, lines int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	recLen := int64(o.length + len(o.newline))
+	if size != ports.AnySize {
+		switch {
+		case !o.pinned && size%lines == 0 && size/lines > int64(len(o.newline)):
+			recLen = size / lines
+			o.length = int(recLen) - len(o.newline)
+		case size != lines*recLen:
+			return fmt.Errorf("%d records of %d bytes make %d bytes, not %d", lines, recLen, lines*recLen, size)
+		}
+	}
+	layout := o.fit(o.length)
+	return g.writeFile(path, func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		for n := int64(1); n <= lines; n++ {
+			if _, err := bw.WriteString(record(o.rand, layout, n) + o.newline); err != nil {
+				return fmt.Errorf("failed to write record: %w", err)
+			}
+		}
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("failed to write records: %w", err)
+		}
+		return nil
+	})
+}
+
+func (g *FixedWidthGenerator) writeFile(path string, fill func(w io.Writer) error) error {
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := fill(f); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// record returns record number n laid out by layout, without a newline.
+// Fields named ID hold n; the others are drawn from r.
+func record(r *utils.Rand, layout []field, n int64) string {
+	var b strings.Builder
+	for _, f := range layout {
+		var v string
+		switch {
+		case f.name == "FILLER":
+			v = ""
+		case f.name == "ID" && f.kind == KindNumeric:
+			v = strconv.FormatInt(n, 10)
+		case f.kind == KindNumeric:
+			v = strconv.FormatInt(r.Int64N(1_000_000_000_000), 10)
+		case f.kind == KindDate:
+			v = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, r.IntN(27*365)).Format("20060102")
+		case f.name == "STATUS" && f.width == 1:
+			v = string("AIPC"[r.IntN(4)])
+		default:
+			v = strings.ToUpper(utils.Lorem.Phrase(r, 1, 3))
+		}
+		if f.kind == KindNumeric {
+			if len(v) > f.width {
+				v = v[len(v)-f.width:]
+			}
+			b.WriteString(strings.Repeat("0", f.width-len(v)) + v)
+			continue
+		}
+		if len(v) > f.width {
+			v = v[:f.width]
+		}
+		b.WriteString(v + strings.Repeat(" ", f.width-len(v)))
+	}
+	return b.String()
+}
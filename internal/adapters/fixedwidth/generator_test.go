@@ -0,0 +1,159 @@
+package fixedwidth
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestFixedWidthGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name    string
+		size    int64
+		opts    ports.Options
+		wantLen int // record length with the newline
+		short   int // length of a short last record, 0 for none
+		errSub  string
+	}{
+		{name: "Default", size: 81 * 100, wantLen: 81},
+		{name: "ShortLast", size: 81*10 + 20, wantLen: 81, short: 20},
+		{name: "RecordLength", size: 201 * 50, opts: ports.Options{"fw-record-length": "200"}, wantLen: 201},
+		{name: "NarrowRecord", size: 31 * 10, opts: ports.Options{"fw-record-length": "30"}, wantLen: 31},
+		{name: "CRLF", size: 82 * 10, opts: ports.Options{"fw-newline": "crlf"}, wantLen: 82},
+		{name: "NoNewline", size: 80*1000 + 1, opts: ports.Options{"fw-newline": "none"}, wantLen: 80, short: 1},
+		{name: "Layout", size: 49 * 20, opts: ports.Options{"fw-layout": "id:N:10,name:A:30,born:D:8"}, wantLen: 49},
+		{name: "LayoutWithFiller", size: 101 * 20, opts: ports.Options{"fw-layout": "id:N:10,name:A:30", "fw-record-length": "100"}, wantLen: 101},
+		{name: "Zero", size: 0, wantLen: 81},
+		{name: "LayoutTooWide", size: 1000, opts: ports.Options{"fw-layout": "id:N:10,name:A:30", "fw-record-length": "20"}, errSub: "more than fw-record-length"},
+		{name: "BadKind", size: 1000, opts: ports.Options{"fw-layout": "id:X:10"}, errSub: "unknown fw-layout kind"},
+		{name: "BadField", size: 1000, opts: ports.Options{"fw-layout": "id:N"}, errSub: "want name:kind:width"},
+		{name: "BadDate", size: 1000, opts: ports.Options{"fw-layout": "born:D:6"}, errSub: "must be 8 wide"},
+		{name: "BadNewline", size: 1000, opts: ports.Options{"fw-newline": "cr"}, errSub: "unknown fw-newline"},
+		{name: "BadLength", size: 1000, opts: ports.Options{"fw-record-length": "0"}, errSub: "at least 1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.fwf")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			configured, err := New().(*FixedWidthGenerator).Configure(tc.opts)
+			if err != nil {
+				t.Fatalf("Configure() error = %v", err)
+			}
+			if step := configured.(ports.SizeStepper).SizeStep(); step != int64(tc.wantLen) {
+				t.Errorf("SizeStep() = %d, want %d", step, tc.wantLen)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			checkRecords(t, data, tc.wantLen, tc.short, tc.opts)
+		})
+	}
+}
+
+func TestFixedWidthGenerator_GenerateLines(t *testing.T) {
+	generator := New().(ports.LineGenerator)
+
+	testCases := []struct {
+		name    string
+		size    int64
+		lines   int64
+		opts    ports.Options
+		wantLen int
+		errSub  string
+	}{
+		{name: "LinesOnly", size: ports.AnySize, lines: 25, wantLen: 81},
+		{name: "LengthFromSize", size: 121 * 30, lines: 30, wantLen: 121},
+		{name: "Matching", size: 41 * 7, lines: 7, opts: ports.Options{"fw-record-length": "40"}, wantLen: 41},
+		{name: "Mismatch", size: 1000, lines: 7, opts: ports.Options{"fw-record-length": "40"}, errSub: "make 287 bytes, not 1000"},
+		{name: "Uneven", size: 1000, lines: 7, errSub: "not 1000"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.fwf")
+			err := generator.GenerateLines(path, tc.size, tc.lines, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateLines() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateLines() unexpected error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.lines*int64(tc.wantLen) {
+				t.Fatalf("size = %d, want %d records of %d", len(data), tc.lines, tc.wantLen)
+			}
+			checkRecords(t, data, tc.wantLen, 0, tc.opts)
+		})
+	}
+}
+
+func TestFixedWidthGenerator_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New().(ports.StreamGenerator).GenerateTo(&buf, 81*3, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkRecords(t, buf.Bytes(), 81, 0, nil)
+}
+
+// checkRecords checks data is records of recLen bytes, newline included,
+// with numbered IDs and parseable dates at the layout's offsets.
+func checkRecords(t *testing.T, data []byte, recLen, short int, opts ports.Options) {
+	t.Helper()
+	o, err := parseOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := o.fit(recLen - len(o.newline))
+	full := len(data) - short
+	for i := 0; i*recLen < full; i++ {
+		rec := string(data[i*recLen : (i+1)*recLen])
+		if !strings.HasSuffix(rec, o.newline) {
+			t.Fatalf("record %d does not end in %q: %q", i+1, o.newline, rec)
+		}
+		off := 0
+		for _, f := range layout {
+			v := rec[off : off+f.width]
+			switch {
+			case f.name == "ID" && f.kind == KindNumeric:
+				if id, err := strconv.Atoi(v); err != nil || id != i+1 {
+					t.Errorf("record %d ID = %q", i+1, v)
+				}
+			case f.kind == KindNumeric:
+				if strings.Trim(v, "0123456789") != "" {
+					t.Errorf("record %d %s = %q, not digits", i+1, f.name, v)
+				}
+			case f.kind == KindDate:
+				if _, err := time.Parse("20060102", v); err != nil {
+					t.Errorf("record %d %s = %q: %v", i+1, f.name, v, err)
+				}
+			}
+			off += f.width
+		}
+	}
+}
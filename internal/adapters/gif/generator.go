@@ -4,11 +4,13 @@ package gif
 import (
 	"bufio"
 	"bytes"
+	"compress/lzw"
 	"encoding/binary"
 	"fmt"
-	"os"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/logging"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
 	"github.com/hailam/genfile/internal/utils"
 )
@@ -17,108 +19,286 @@ func init() {
 	factory.RegisterGenerator(ports.FileTypeGIF, New())
 }
 
-type GifGenerator struct{}
+type GifGenerator struct {
+	opts ports.Options // set by Configure
+	log  ports.Logger
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &GifGenerator{}
 }
 
-// Generate creates a minimal, single-color GIF file. Padding to exact size is tricky
-// and might rely on comment extensions or adjusting image dimensions slightly.
-// This version focuses on creating a *valid* minimal GIF and pads simply.
-func (g *GifGenerator) Generate(path string, targetSize int64) error {
-	if targetSize < 0 {
-		targetSize = 0
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *GifGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
 	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
 
-	// --- Minimal GIF Structure ---
-	var buf bytes.Buffer
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *GifGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
 
-	// 1. Header ("GIF89a") - 6 bytes
-	buf.WriteString("GIF89a")
+// WithLogger returns a copy of the generator that reports to l.
+func (g *GifGenerator) WithLogger(l ports.Logger) ports.FileGenerator {
+	c := *g
+	c.log = l
+	return &c
+}
 
-	// 2. Logical Screen Descriptor - 7 bytes
-	width := uint16(1) // Minimal 1x1 pixel image
-	height := uint16(1)
-	packedFields := byte(0x80) // Use global color table (1), 1 bit color depth (000) -> 10000000
-	bgColorIndex := byte(0)
-	pixelAspectRatio := byte(0) // Standard
-	binary.Write(&buf, binary.LittleEndian, width)
-	binary.Write(&buf, binary.LittleEndian, height)
-	buf.WriteByte(packedFields)
-	buf.WriteByte(bgColorIndex)
-	buf.WriteByte(pixelAspectRatio)
+func (g *GifGenerator) logger() ports.Logger {
+	if g.log == nil {
+		return logging.Nop
+	}
+	return g.log
+}
 
-	// 3. Global Color Table (2 colors: black and white) - 6 bytes
-	buf.Write([]byte{0x00, 0x00, 0x00}) // Color 0: Black
-	buf.Write([]byte{0xFF, 0xFF, 0xFF}) // Color 1: White
-
-	// 4. Image Descriptor - 10 bytes
-	imageSeparator := byte(0x2C) // ','
-	left := uint16(0)
-	top := uint16(0)
-	imgWidth := uint16(1)
-	imgHeight := uint16(1)
-	imgPackedFields := byte(0x00) // No local color table, not interlaced
-	buf.WriteByte(imageSeparator)
-	binary.Write(&buf, binary.LittleEndian, left)
-	binary.Write(&buf, binary.LittleEndian, top)
-	binary.Write(&buf, binary.LittleEndian, imgWidth)
-	binary.Write(&buf, binary.LittleEndian, imgHeight)
-	buf.WriteByte(imgPackedFields)
-
-	// 5. Image Data (LZW minimum code size 2, standard minimal stream) - 7 bytes
-	lzwMinCodeSize := byte(2)
-	buf.WriteByte(lzwMinCodeSize) // LZW Minimum Code Size = 2
-
-	// Data sub-block 1: Clear Code, Data Code
-	buf.WriteByte(2)    // Block Size = 2 bytes follow
-	buf.WriteByte(0x04) // Clear Code (for code size 2)
-	buf.WriteByte(0x01) // Data: Use color index 1
-
-	// Data sub-block 2: End Of Information Code
-	buf.WriteByte(1)    // Block Size = 1 byte follows
-	buf.WriteByte(0x05) // EOI Code (for code size 2)
-
-	// Data sub-block 3: Terminator
-	buf.WriteByte(0) // Block Size = 0 (Terminator)
-
-	// 6. GIF Trailer - 1 byte
-	trailer := byte(0x3B) // ';'
-	buf.WriteByte(trailer)
-	// --- End Minimal Structure ---
-
-	minimalData := buf.Bytes()
-	minimalSize := int64(len(minimalData))
+const (
+	// maxSubBlock is the largest data sub-block GIF allows.
+	maxSubBlock = 255
+	// lzwMinCodeSize is the LZW minimum code size for a 2-colour image.
+	lzwMinCodeSize = 2
+	// emptyCommentLen is a Comment Extension with no data sub-blocks.
+	emptyCommentLen = 3
+)
+
+// gifOptions holds the settings the GIF generator reads from ports.Options.
+type gifOptions struct {
+	width, height int
+	frames        int
+	delay         int // centiseconds between frames
+	rand          *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (gifOptions, error) {
+	var o gifOptions
+	var err error
+	if o.width, err = opts.Int("width", 1); err != nil {
+		return o, err
+	}
+	if o.height, err = opts.Int("height", 1); err != nil {
+		return o, err
+	}
+	if o.width < 1 || o.height < 1 || o.width > 0xFFFF || o.height > 0xFFFF {
+		return o, fmt.Errorf("gif dimensions must be between 1 and 65535, got %dx%d", o.width, o.height)
+	}
+	if o.frames, err = opts.Int("frames", 1); err != nil {
+		return o, err
+	}
+	if o.frames < 1 {
+		return o, fmt.Errorf("frames must be at least 1, got %d", o.frames)
+	}
+	if o.delay, err = opts.Int("gif-delay", 10); err != nil {
+		return o, err
+	}
+	if o.delay < 0 || o.delay > 0xFFFF {
+		return o, fmt.Errorf("gif-delay must be between 0 and 65535, got %d", o.delay)
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
 
+func (g *GifGenerator) Generate(path string, targetSize int64) error {
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions creates a two-colour GIF of random pixels, by default
+// a single 1x1 image. opts can set the dimensions and request an animation
+// of several frames, each with a Graphics Control Extension. The file is
+// padded to the exact size with Comment Extension blocks before the trailer;
+// targets below the unpadded size get the unpadded file.
+func (g *GifGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	frames, err := encodeFrames(o)
+	if err != nil {
+		return err
+	}
+	last := frames[len(frames)-1]
+
+	minimalSize := gifSize(o, frames)
 	if targetSize < minimalSize {
-		fmt.Printf("Warning: Target GIF size %d smaller than minimal %d. Writing minimal.\n", targetSize, minimalSize)
-		return os.WriteFile(path, minimalData, 0666)
+		g.logger().Warnf("Target GIF size %d smaller than minimal %d. Writing minimal.", targetSize, minimalSize)
+		targetSize = minimalSize
 	}
 
 	// --- Padding ---
-	// Simple padding by appending random bytes. NOTE: This makes the GIF invalid
-	// after the trailer. A better approach uses Comment Extension blocks, but is more complex.
-	f, err := os.Create(path)
+	// Comment blocks cover any padding except 1, 2 or 4 bytes; splitting
+	// the last frame's image data into more sub-blocks covers the rest.
+	padding := targetSize - minimalSize
+	maxSplits := int64(len(last) - subBlockCount(len(last)))
+	var splits int64
+	for padding-splits > 0 && padding-splits < emptyCommentLen+2 && padding-splits != emptyCommentLen {
+		splits++
+	}
+	if splits > maxSplits {
+		return fmt.Errorf("cannot pad a %d-byte GIF by exactly %d bytes; choose a slightly different size", minimalSize, padding)
+	}
+	commentLen := padding - splits
+
+	f, err := outputfs.Create(g.fs, path)
 	if err != nil {
 		return fmt.Errorf("failed to create file %s: %w", path, err)
 	}
 	defer f.Close()
 
 	bw := bufio.NewWriter(f)
-	_, err = bw.Write(minimalData)
-	if err != nil {
-		return fmt.Errorf("failed to write minimal GIF data: %w", err)
+	writeHeader(bw, o)
+	for i, frame := range frames {
+		extra := 0
+		if i == len(frames)-1 {
+			extra = int(splits)
+		}
+		writeFrame(bw, o, frame, extra)
 	}
+	if err := writeComment(o.rand, bw, commentLen); err != nil {
+		return fmt.Errorf("failed to write padding comment: %w", err)
+	}
+	bw.WriteByte(0x3B) // GIF Trailer ';'
 
-	paddingNeeded := targetSize - minimalSize
-	if paddingNeeded > 0 {
-		fmt.Printf("GIF Generator: Padding with %d raw bytes (Note: may invalidate strict GIF readers)\n", paddingNeeded)
-		err = utils.WriteRandomBytes(bw, paddingNeeded) // Use existing util
-		if err != nil {
-			return fmt.Errorf("failed to write padding bytes: %w", err)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write GIF data: %w", err)
+	}
+	return f.Close()
+}
+
+// encodeFrames returns the LZW-compressed pixel data of every frame.
+func encodeFrames(o gifOptions) ([][]byte, error) {
+	frames := make([][]byte, o.frames)
+	pixels := make([]byte, o.width*o.height)
+	for i := range frames {
+		for p := range pixels {
+			pixels[p] = byte(o.rand.IntN(2))
+		}
+		var buf bytes.Buffer
+		lw := lzw.NewWriter(&buf, lzw.LSB, lzwMinCodeSize)
+		if _, err := lw.Write(pixels); err != nil {
+			return nil, err
 		}
+		if err := lw.Close(); err != nil {
+			return nil, err
+		}
+		frames[i] = buf.Bytes()
 	}
+	return frames, nil
+}
 
-	return bw.Flush()
+// animated reports whether the file needs looping and per-frame timing.
+func (o gifOptions) animated() bool {
+	return o.frames > 1
+}
+
+// subBlockCount returns the fewest sub-blocks that hold n bytes.
+func subBlockCount(n int) int {
+	return (n + maxSubBlock - 1) / maxSubBlock
+}
+
+// gifSize returns the unpadded file size for o and frames.
+func gifSize(o gifOptions, frames [][]byte) int64 {
+	size := int64(6 + 7 + 6) // header, logical screen descriptor, colour table
+	if o.animated() {
+		size += 19 // NETSCAPE2.0 looping extension
+	}
+	for _, frame := range frames {
+		if o.animated() {
+			size += 8 // Graphics Control Extension
+		}
+		size += 10 + 1                                          // image descriptor, LZW minimum code size
+		size += int64(len(frame)+subBlockCount(len(frame))) + 1 // sub-blocks + terminator
+	}
+	return size + 1 // trailer
+}
+
+func writeHeader(bw *bufio.Writer, o gifOptions) {
+	// 1. Header ("GIF89a") - 6 bytes
+	bw.WriteString("GIF89a")
+
+	// 2. Logical Screen Descriptor - 7 bytes
+	packedFields := byte(0x80) // Use global color table (1), 1 bit color depth (000) -> 10000000
+	binary.Write(bw, binary.LittleEndian, uint16(o.width))
+	binary.Write(bw, binary.LittleEndian, uint16(o.height))
+	bw.WriteByte(packedFields)
+	bw.WriteByte(0) // background color index
+	bw.WriteByte(0) // pixel aspect ratio
+
+	// 3. Global Color Table (2 colors: black and white) - 6 bytes
+	bw.Write([]byte{0x00, 0x00, 0x00}) // Color 0: Black
+	bw.Write([]byte{0xFF, 0xFF, 0xFF}) // Color 1: White
+
+	if o.animated() {
+		// NETSCAPE2.0 Application Extension: loop forever - 19 bytes
+		bw.Write([]byte{0x21, 0xFF, 0x0B})
+		bw.WriteString("NETSCAPE2.0")
+		bw.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+	}
+}
+
+// writeFrame writes one image, split into extra more sub-blocks than it
+// needs.
+func writeFrame(bw *bufio.Writer, o gifOptions, data []byte, extra int) {
+	if o.animated() {
+		// Graphics Control Extension - 8 bytes: disposal "do not dispose", delay
+		bw.Write([]byte{0x21, 0xF9, 0x04, 0x04})
+		binary.Write(bw, binary.LittleEndian, uint16(o.delay))
+		bw.Write([]byte{0x00, 0x00})
+	}
+
+	// Image Descriptor - 10 bytes, no local color table, not interlaced
+	bw.WriteByte(0x2C)
+	binary.Write(bw, binary.LittleEndian, [4]uint16{0, 0, uint16(o.width), uint16(o.height)})
+	bw.WriteByte(0x00)
+
+	// Image Data
+	bw.WriteByte(lzwMinCodeSize)
+	blocks := subBlockCount(len(data)) + extra
+	for i := 0; i < blocks; i++ {
+		n := len(data) / (blocks - i)
+		bw.WriteByte(byte(n))
+		bw.Write(data[:n])
+		data = data[n:]
+	}
+	bw.WriteByte(0) // Block Terminator
+}
+
+// writeComment writes Comment Extensions totalling exactly n bytes of
+// random printable text. n must be 0, 3 or at least 5.
+func writeComment(r *utils.Rand, bw *bufio.Writer, n int64) error {
+	if n == 0 {
+		return nil
+	}
+	if n == emptyCommentLen+1 || n < emptyCommentLen {
+		return fmt.Errorf("no comment extension is %d bytes long", n)
+	}
+	bw.Write([]byte{0x21, 0xFE})
+	// The body holds `blocks` length bytes plus text: body = n - 3.
+	body := n - emptyCommentLen
+	blocks := body / (maxSubBlock + 1)
+	if body%(maxSubBlock+1) != 0 { // rounded up, without overflowing
+		blocks++
+	}
+	text := body - blocks
+	for i := int64(0); i < blocks; i++ {
+		size := text / (blocks - i)
+		bw.WriteByte(byte(size))
+		if _, err := bw.WriteString(r.String(int(size))); err != nil {
+			return err
+		}
+		text -= size
+	}
+	return bw.WriteByte(0) // Block Terminator
 }
@@ -15,7 +15,8 @@ import (
 )
 
 // Helper to calculate the exact size of the minimal GIF generated by the code.
-// Uses the 7-byte LZW stream from the previous attempt.
+// The 1x1 image's LZW stream (clear code, pixel, end code at 3 bits each)
+// packs into 2 bytes.
 func calculateMinimalGifSize() int64 {
 	var buf bytes.Buffer
 	// 1. Header ("GIF89a") - 6 bytes
@@ -46,14 +47,12 @@ func calculateMinimalGifSize() int64 {
 	binary.Write(&buf, binary.LittleEndian, imgWidth)
 	binary.Write(&buf, binary.LittleEndian, imgHeight)
 	buf.WriteByte(imgPackedFields)
-	// 5. Image Data (LZW minimum code size 2, standard minimal stream) - 7 bytes
+	// 5. Image Data (LZW minimum code size 2, one 2-byte sub-block) - 5 bytes
 	lzwMinCodeSize := byte(2)
 	buf.WriteByte(lzwMinCodeSize)
 	buf.WriteByte(2)
-	buf.WriteByte(0x04)
+	buf.WriteByte(0x4C)
 	buf.WriteByte(0x01)
-	buf.WriteByte(1)
-	buf.WriteByte(0x05)
 	buf.WriteByte(0)
 	// 6. GIF Trailer - 1 byte
 	trailer := byte(0x3B)
@@ -231,3 +230,70 @@ func checkGifHeaderAndLogDecode(t *testing.T, path string) {
 		t.Logf("Note: File %q decoded successfully as GIF.", path)
 	}
 }
+
+func TestGifGenerator_GenerateWithOptions(t *testing.T) {
+	generator := &GifGenerator{}
+	tempDir := t.TempDir()
+	minGifSize := calculateMinimalGifSize()
+
+	testCases := []struct {
+		name          string
+		size          int64
+		opts          ports.Options
+		frames        int
+		width, height int
+		errSubstring  string
+	}{
+		// Every padding amount from 0 to 10 must come out exact and decodable,
+		// except 2 bytes, which a 1x1 image has no way to absorb.
+		{name: "Pad0", size: minGifSize, frames: 1, width: 1, height: 1},
+		{name: "Pad1", size: minGifSize + 1, frames: 1, width: 1, height: 1},
+		{name: "Pad2", size: minGifSize + 2, errSubstring: "cannot pad"},
+		{name: "Pad3", size: minGifSize + 3, frames: 1, width: 1, height: 1},
+		{name: "Pad4", size: minGifSize + 4, frames: 1, width: 1, height: 1},
+		{name: "Pad5", size: minGifSize + 5, frames: 1, width: 1, height: 1},
+		{name: "Pad10", size: minGifSize + 10, frames: 1, width: 1, height: 1},
+		{name: "Pad2Larger", size: 2 * 1024, opts: ports.Options{"width": "32", "height": "32"}, frames: 1, width: 32, height: 32},
+		{name: "LargePadding", size: 1024 * 1024, frames: 1, width: 1, height: 1},
+		{name: "Animated", size: 64 * 1024, opts: ports.Options{"frames": "12", "width": "40", "height": "30", "gif-delay": "5"}, frames: 12, width: 40, height: 30},
+		{name: "ZeroFrames", size: 1024, opts: ports.Options{"frames": "0"}, errSubstring: "frames must be at least 1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("opts_%s.gif", tc.name))
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.errSubstring != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSubstring) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSubstring, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, tc.size)
+
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data[len(data)-1] != 0x3B {
+				t.Errorf("last byte = %#x, want the GIF trailer", data[len(data)-1])
+			}
+			g, err := gif.DecodeAll(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("GIF decoding failed: %v", err)
+			}
+			if len(g.Image) != tc.frames {
+				t.Errorf("frames = %d, want %d", len(g.Image), tc.frames)
+			}
+			if g.Config.Width != tc.width || g.Config.Height != tc.height {
+				t.Errorf("dimensions = %dx%d, want %dx%d", g.Config.Width, g.Config.Height, tc.width, tc.height)
+			}
+			if tc.frames > 1 && (g.LoopCount != 0 || g.Delay[0] != 5) {
+				t.Errorf("loop count = %d, delay = %d; want 0 and 5", g.LoopCount, g.Delay[0])
+			}
+		})
+	}
+}
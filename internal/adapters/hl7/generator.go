@@ -0,0 +1,223 @@
+package hl7
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeHL7, New())
+}
+
+// Hl7Generator writes HL7 v2 files: ORU^R01 lab result messages, one after
+// another, each with MSH, PID and OBR segments and a run of OBX results.
+type Hl7Generator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &Hl7Generator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *Hl7Generator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *Hl7Generator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	// resultsPerMessage is the number of numeric OBX segments in a message
+	// before the next message starts.
+	resultsPerMessage = 10
+	// commentOBX starts the free-text OBX that ends the file, before its
+	// set ID; the text and the result status follow.
+	commentOBX = "OBX|%d|TX|48767-8^Annotation comment^LN||"
+	commentEnd = "||||||F"
+)
+
+// hl7Options holds the settings the HL7 generator reads from ports.Options.
+type hl7Options struct {
+	term string // segment terminator
+	at   time.Time
+	rand *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (hl7Options, error) {
+	o := hl7Options{term: "\r"}
+	newline, err := opts.Bool("hl7-newline", false)
+	if err != nil {
+		return o, err
+	}
+	if newline {
+		o.term = "\r\n"
+	}
+	if o.at, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.at.IsZero() {
+		o.at = time.Now()
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *Hl7Generator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+func (g *Hl7Generator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := g.GenerateTo(f, size, opts); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// GenerateTo writes exactly size bytes of HL7 messages to w. Segments end
+// in a carriage return, or CR LF with "hl7-newline", and the last segment
+// is a free-text OBX whose text makes up the size.
+func (g *Hl7Generator) GenerateTo(w io.Writer, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	head := o.header(1)
+	if need := int64(len(head)) + o.minComment(1); size < need {
+		return fmt.Errorf("target %d too small for an HL7 message; need at least %d bytes", size, need)
+	}
+
+	bw := bufio.NewWriter(w)
+	write := func(s string) error {
+		if _, err := bw.WriteString(s); err != nil {
+			return fmt.Errorf("failed to write HL7 segments: %w", err)
+		}
+		return nil
+	}
+	remaining := size
+	for msg := 1; ; msg++ {
+		if err := write(head); err != nil {
+			return err
+		}
+		remaining -= int64(len(head))
+		// Results follow while the next message would still fit after
+		// them; otherwise a comment ends the file.
+		head = o.header(msg + 1)
+		reserve := int64(len(head)) + o.minComment(1)
+		set := 1
+		for ; set <= resultsPerMessage; set++ {
+			seg := o.result(set)
+			if remaining-int64(len(seg)) < reserve {
+				break
+			}
+			if err := write(seg); err != nil {
+				return err
+			}
+			remaining -= int64(len(seg))
+		}
+		if set <= resultsPerMessage {
+			if err := write(o.comment(set, remaining)); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write HL7 segments: %w", err)
+	}
+	return nil
+}
+
+// header returns the MSH, PID and OBR segments of message n.
+func (o hl7Options) header(n int) string {
+	ts := o.at.Format("20060102150405")
+	r := o.rand
+	observed := o.at.Add(-time.Duration(r.IntN(72*60)) * time.Minute).Format("20060102150405")
+	born := time.Date(1930+r.IntN(90), time.Month(1+r.IntN(12)), 1+r.IntN(28), 0, 0, 0, 0, time.UTC)
+
+	obr := make([]string, 26)
+	obr[0], obr[1] = "OBR", "1"
+	obr[2], obr[3] = fmt.Sprintf("ORD%08d", n), fmt.Sprintf("FIL%08d", n)
+	obr[4] = "24323-8^Comprehensive metabolic panel^LN"
+	obr[7], obr[22], obr[25] = observed, ts, "F"
+
+	return strings.Join([]string{
+		"MSH|^~\\&|GENFILE|GENFILE_LAB|RECEIVER|RECEIVER_FAC|" + ts + "||ORU^R01^ORU_R01|" + fmt.Sprintf("GF%08d", n) + "|P|2.5.1",
+		fmt.Sprintf("PID|1||%08d^^^GENFILE^MR||%s^%s||%s|%s|||%d %s ST^^%s^^%05d",
+			r.IntN(100_000_000), name(r), name(r), born.Format("20060102"), sexes[r.IntN(len(sexes))],
+			1+r.IntN(9999), name(r), name(r), r.IntN(100_000)),
+		strings.Join(obr, "|"),
+	}, o.term) + o.term
+}
+
+// result returns OBX set: a numeric lab result with its units, reference
+// range and abnormal flag.
+func (o hl7Options) result(set int) string {
+	t := utils.RandLabTest(o.rand)
+	v := t.Value(o.rand)
+	return fmt.Sprintf("OBX|%d|NM|%s^%s^LN||%s|%s|%s-%s|%s|||F|||%s",
+		set, t.Code, t.Name, number(v, t.Decimals), t.Unit,
+		number(t.Low, t.Decimals), number(t.High, t.Decimals), t.Flag(v),
+		o.at.Format("20060102150405")) + o.term
+}
+
+// comment returns OBX set as a free-text comment of exactly n bytes, at
+// least minComment(set).
+func (o hl7Options) comment(set int, n int64) string {
+	prefix := fmt.Sprintf(commentOBX, set)
+	room := int(n - int64(len(prefix)+len(commentEnd)+len(o.term)))
+	// Some interfaces trim trailing spaces, so the text ends in a letter.
+	text := strings.TrimRight(strings.ToUpper(utils.Lorem.Text(o.rand, room)), " ")
+	text += strings.Repeat("X", room-len(text))
+	return prefix + text + commentEnd + o.term
+}
+
+// minComment is the length of the shortest comment OBX set, with one
+// character of text.
+func (o hl7Options) minComment(set int) int64 {
+	return int64(len(fmt.Sprintf(commentOBX, set))+len(commentEnd)+len(o.term)) + 1
+}
+
+// sexes are the administrative sex codes PID-8 draws from.
+var sexes = []string{"F", "M"}
+
+func name(r *utils.Rand) string {
+	return strings.ToUpper(utils.Lorem.Word(r))
+}
+
+func number(v float64, decimals int) string {
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
@@ -0,0 +1,136 @@
+package hl7
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestHl7Generator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name   string
+		size   int64
+		opts   ports.Options
+		errSub string
+	}{
+		{name: "OneMessage", size: 1024},
+		{name: "Messages", size: 64 * 1024},
+		{name: "Large", size: 2*1024*1024 + 3},
+		{name: "Newlines", size: 32 * 1024, opts: ports.Options{"hl7-newline": "true"}},
+		{name: "MTime", size: 4096, opts: ports.Options{"mtime": "2020-03-04T05:06:07Z"}},
+		{name: "TooSmall", size: 200, errSub: "too small"},
+		{name: "BadNewline", size: 4096, opts: ports.Options{"hl7-newline": "sometimes"}, errSub: "hl7-newline"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "results.hl7")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			term := "\r"
+			if tc.opts["hl7-newline"] == "true" {
+				term = "\r\n"
+			}
+			checkMessages(t, string(data), term)
+			if tc.opts.Has("mtime") && !strings.Contains(string(data), "|20200304") {
+				t.Error("messages are not dated by mtime")
+			}
+		})
+	}
+}
+
+func TestHl7Generator_Sizes(t *testing.T) {
+	// Every size from the smallest message up reaches its target.
+	generator := New()
+	dir := t.TempDir()
+	for size := int64(400); size < 2000; size++ {
+		path := filepath.Join(dir, "results.hl7")
+		if err := generator.Generate(path, size); err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if info, _ := os.Stat(path); info.Size() != size {
+			t.Fatalf("%d bytes came out as %d", size, info.Size())
+		}
+	}
+}
+
+func TestHl7Generator_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New().(ports.StreamGenerator).GenerateTo(&buf, 10000, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 10000 {
+		t.Fatalf("streamed %d bytes, want 10000", buf.Len())
+	}
+	checkMessages(t, buf.String(), "\r")
+}
+
+// checkMessages checks data is a run of ORU^R01 messages: MSH, PID and OBR
+// followed by OBX segments numbered from 1, each message with its own
+// control ID.
+func checkMessages(t *testing.T, data, term string) {
+	t.Helper()
+	if !strings.HasSuffix(data, term) {
+		t.Fatal("last segment is not terminated")
+	}
+	segments := strings.Split(strings.TrimSuffix(data, term), term)
+	messages, set := 0, 0
+	for i, seg := range segments {
+		fields := strings.Split(seg, "|")
+		switch fields[0] {
+		case "MSH":
+			messages++
+			if fields[1] != `^~\&` || fields[8] != "ORU^R01^ORU_R01" || fields[11] != "2.5.1" {
+				t.Fatalf("segment %d: bad MSH %q", i, seg)
+			}
+			if want := fmt.Sprintf("GF%08d", messages); fields[9] != want {
+				t.Fatalf("message %d has control ID %q, want %q", messages, fields[9], want)
+			}
+			set = 0
+		case "PID", "OBR":
+			if i == 0 || (fields[0] == "PID") != strings.HasPrefix(segments[i-1], "MSH|") {
+				t.Fatalf("segment %d: %s out of place", i, fields[0])
+			}
+		case "OBX":
+			set++
+			if fields[1] != fmt.Sprint(set) || (fields[2] != "NM" && fields[2] != "TX") {
+				t.Fatalf("segment %d: OBX %q, want set ID %d", i, seg, set)
+			}
+			if fields[2] == "TX" && i != len(segments)-1 {
+				t.Fatalf("segment %d: comment before the last segment", i)
+			}
+			if fields[11] != "F" {
+				t.Fatalf("segment %d: result status %q", i, fields[11])
+			}
+		default:
+			t.Fatalf("segment %d: unexpected %q", i, seg)
+		}
+		if strings.ContainsAny(seg, "\r\n") {
+			t.Fatalf("segment %d holds a line break", i)
+		}
+	}
+	if !strings.HasPrefix(segments[len(segments)-1], "OBX|") {
+		t.Fatal("the file does not end with an OBX")
+	}
+}
@@ -0,0 +1,197 @@
+package html
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+const (
+	// hiddenOpen and hiddenClose wrap the filler text that trims the DOM
+	// content to the exact size.
+	hiddenOpen  = `<div hidden>`
+	hiddenClose = "</div>\n"
+	// hiddenMin is the size of an empty hidden element.
+	hiddenMin = len(hiddenOpen) + len(hiddenClose)
+	// maxBlockMisses is how many oversized blocks are drawn before the
+	// hidden element takes the remaining budget.
+	maxBlockMisses = 8
+)
+
+// cssColors is the palette used for inline styles.
+var cssColors = []string{"#1f2937", "#374151", "#b91c1c", "#047857", "#1d4ed8", "#6d28d9", "#be185d", "#92400e"}
+
+// writeDOM writes n bytes of realistic body markup: nested sections with
+// headings, paragraphs with inline formatting, tables, lists, styled boxes
+// and figures with data-URI images. Random blocks are added while they
+// fit; a final hidden element makes up the rest. Budgets below hiddenMin
+// become whitespace. Text is written in o's language.
+func writeDOM(w io.Writer, n int64, o htmlOptions) error {
+	for misses := 0; misses < maxBlockMisses && n >= int64(hiddenMin); {
+		block := randomBlock(o.rand, o.lang, 0)
+		if int64(len(block)) > n-int64(hiddenMin) {
+			misses++
+			continue
+		}
+		if _, err := io.WriteString(w, block); err != nil {
+			return err
+		}
+		n -= int64(len(block))
+	}
+	if n < int64(hiddenMin) {
+		_, err := io.WriteString(w, strings.Repeat("\n", int(n)))
+		return err
+	}
+
+	if _, err := io.WriteString(w, hiddenOpen); err != nil {
+		return err
+	}
+	for text := n - int64(hiddenMin); text > 0; {
+		chunk := min(text, 4096)
+		if _, err := io.WriteString(w, o.text(int(chunk))); err != nil {
+			return err
+		}
+		text -= chunk
+	}
+	_, err := io.WriteString(w, hiddenClose)
+	return err
+}
+
+// randomBlock returns one top-level element, nesting further sections up
+// to a few levels deep.
+func randomBlock(r *utils.Rand, l *utils.Language, depth int) string {
+	switch k := r.IntN(10); {
+	case k < 3 && depth < 3:
+		return section(r, l, depth)
+	case k < 5:
+		return paragraph(r, l)
+	case k < 6:
+		return table(r, l)
+	case k < 8:
+		return list(r, l, depth)
+	case k < 9:
+		return styledBox(r, l)
+	default:
+		return figure(r, l)
+	}
+}
+
+func section(r *utils.Rand, l *utils.Language, depth int) string {
+	var b strings.Builder
+	tag := []string{"section", "article", "div"}[r.IntN(3)]
+	fmt.Fprintf(&b, "<%s class=\"%s\">\n<h%d>%s</h%d>\n", tag, randWord(r), depth+2, l.Phrase(r, 2, 6), depth+2)
+	for i := 1 + r.IntN(4); i > 0; i-- {
+		b.WriteString(randomBlock(r, l, depth+1))
+	}
+	fmt.Fprintf(&b, "</%s>\n", tag)
+	return b.String()
+}
+
+// paragraph returns a <p> whose sentences are sprinkled with inline markup.
+func paragraph(r *utils.Rand, l *utils.Language) string {
+	var b strings.Builder
+	b.WriteString("<p>")
+	for i := 2 + r.IntN(5); i > 0; i-- {
+		s := l.Sentence(r, 5, 14)
+		switch r.IntN(6) {
+		case 0:
+			s = "<strong>" + s + "</strong>"
+		case 1:
+			s = "<em>" + s + "</em>"
+		case 2:
+			s = fmt.Sprintf(`<a href="https://example.com/%s">%s</a>`, randWord(r), s)
+		case 3:
+			s = strings.Replace(s, " ", " <code>"+randWord(r)+"()</code> ", 1)
+		}
+		b.WriteString(s)
+		if i > 1 {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString("</p>\n")
+	return b.String()
+}
+
+func table(r *utils.Rand, l *utils.Language) string {
+	var b strings.Builder
+	cols, rows := 2+r.IntN(4), 2+r.IntN(8)
+	b.WriteString("<table>\n<thead><tr>")
+	for c := 0; c < cols; c++ {
+		fmt.Fprintf(&b, "<th>%s</th>", capitalise(l.Word(r)))
+	}
+	b.WriteString("</tr></thead>\n<tbody>\n")
+	for row := 0; row < rows; row++ {
+		b.WriteString("<tr>")
+		for c := 0; c < cols; c++ {
+			if c == 0 {
+				fmt.Fprintf(&b, "<td>%s</td>", l.Word(r))
+			} else {
+				fmt.Fprintf(&b, "<td>%d</td>", r.IntN(10000))
+			}
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return b.String()
+}
+
+// list returns a <ul> or <ol>, sometimes with a nested sub-list.
+func list(r *utils.Rand, l *utils.Language, depth int) string {
+	var b strings.Builder
+	tag := []string{"ul", "ol"}[r.IntN(2)]
+	fmt.Fprintf(&b, "<%s>\n", tag)
+	for i := 2 + r.IntN(5); i > 0; i-- {
+		b.WriteString("<li>" + l.Sentence(r, 3, 9))
+		if depth < 3 && r.IntN(5) == 0 {
+			b.WriteString("\n" + list(r, l, depth+1))
+		}
+		b.WriteString("</li>\n")
+	}
+	fmt.Fprintf(&b, "</%s>\n", tag)
+	return b.String()
+}
+
+func styledBox(r *utils.Rand, l *utils.Language) string {
+	return fmt.Sprintf("<div style=\"color: %s; border: 1px solid %s; padding: %dpx; margin: %dpx 0;\">%s</div>\n",
+		cssColors[r.IntN(len(cssColors))], cssColors[r.IntN(len(cssColors))],
+		4+r.IntN(20), r.IntN(16), l.Paragraph(r, 1, 3))
+}
+
+// figure returns a <figure> with a small random PNG inlined as a data URI.
+func figure(r *utils.Rand, l *utils.Language) string {
+	w, h := 8+r.IntN(25), 8+r.IntN(25)
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	fill := color.NRGBA{uint8(r.IntN(256)), uint8(r.IntN(256)), uint8(r.IntN(256)), 255}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := fill
+			if r.IntN(4) == 0 {
+				c.R, c.G, c.B = uint8(r.IntN(256)), uint8(r.IntN(256)), uint8(r.IntN(256))
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img) // encoding to memory cannot fail
+	caption := l.Phrase(r, 3, 8)
+	return fmt.Sprintf("<figure>\n<img src=\"data:image/png;base64,%s\" width=\"%d\" height=\"%d\" alt=\"%s\">\n<figcaption>%s</figcaption>\n</figure>\n",
+		base64.StdEncoding.EncodeToString(buf.Bytes()), w*4, h*4, caption, caption)
+}
+
+func randWord(r *utils.Rand) string {
+	return utils.LoremWords[r.IntN(len(utils.LoremWords))]
+}
+
+func capitalise(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
@@ -1,13 +1,16 @@
 package html
 
 import (
+	"bufio"
 	"fmt"
-	"math/rand/v2"
-	"os"
+	"io"
 	"strings"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/logging"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func init() {
@@ -36,45 +39,182 @@ const (
 	commentOverhead = 7
 )
 
-type HtmlGenerator struct{}
+type HtmlGenerator struct {
+	opts ports.Options // set by Configure
+	log  ports.Logger
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &HtmlGenerator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *HtmlGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *HtmlGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// WithLogger returns a copy of the generator that reports to l.
+func (g *HtmlGenerator) WithLogger(l ports.Logger) ports.FileGenerator {
+	c := *g
+	c.log = l
+	return &c
+}
+
+func (g *HtmlGenerator) logger() ports.Logger {
+	if g.log == nil {
+		return logging.Nop
+	}
+	return g.log
+}
+
+// Padding content modes.
+const (
+	ContentPadding = "padding"
+	ContentDOM     = "dom"
+)
+
+// htmlOptions holds the settings the HTML generator reads from ports.Options.
+type htmlOptions struct {
+	content string
+	lang    *utils.Language
+	rand    *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (htmlOptions, error) {
+	o := htmlOptions{content: strings.ToLower(opts.String("html-content", ContentPadding))}
+	if o.content != ContentPadding && o.content != ContentDOM {
+		return o, fmt.Errorf("unknown html content %q (want padding or dom)", o.content)
+	}
+	var err error
+	if o.lang, err = utils.TextLanguage(opts.String("lang", ""), opts.String("corpus", "")); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// templateStart returns htmlTemplateStart with the lang attribute, and
+// dir for right-to-left scripts, of o's language.
+func (o htmlOptions) templateStart() string {
+	attrs := fmt.Sprintf("lang=%q", o.lang.Code)
+	if o.lang.RTL {
+		attrs += ` dir="rtl"`
+	}
+	return strings.Replace(htmlTemplateStart, `lang="en"`, attrs, 1)
+}
+
+// text returns n bytes of filler: random safe characters, or words in
+// o's language if one was chosen.
+func (o htmlOptions) text(n int) string {
+	if o.lang == utils.Lorem {
+		return generateHtmlSafePaddingString(o.rand, n)
+	}
+	return o.lang.Text(o.rand, n)
+}
+
 // Generate creates an HTML file at the specified path with the exact target size.
 func (g *HtmlGenerator) Generate(path string, targetSize int64) error {
-	baseSize := int64(len(htmlTemplateStart) + len(htmlTemplateEnd))
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions creates an HTML file of exactly targetSize bytes. The
+// body is filled with random safe text by default; the "html-content" option
+// "dom" fills it with realistic nested markup instead (see writeDOM). The
+// "lang" option writes the text in another language and sets the
+// document's lang and dir attributes to match; "corpus" draws it from its
+// files.
+func (g *HtmlGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	start := o.templateStart()
+	baseSize := int64(len(start) + len(htmlTemplateEnd))
 
 	if targetSize < baseSize {
 		// Handle edge case: target is smaller than the minimal template.
-		// Write a truncated start of the template.
-		fmt.Printf("Warning: Target size %d is smaller than minimal HTML template %d. Truncating.\n", targetSize, baseSize)
+		// Write the template truncated, which may cut into its end.
+		g.logger().Warnf("Target size %d is smaller than minimal HTML template %d. Truncating.", targetSize, baseSize)
 		if targetSize < 0 {
 			targetSize = 0
 		} // Ensure non-negative size
-		return os.WriteFile(path, []byte(htmlTemplateStart[:targetSize]), 0666)
+		return outputfs.WriteFile(g.fs, path, []byte((start + htmlTemplateEnd)[:targetSize]))
 	}
 
-	f, err := os.Create(path)
+	f, err := outputfs.Create(g.fs, path)
 	if err != nil {
 		return fmt.Errorf("failed to create file %s: %w", path, err)
 	}
 	defer f.Close()
 
 	// Write the start of the template
-	_, err = f.WriteString(htmlTemplateStart)
+	_, err = f.WriteString(start)
 	if err != nil {
 		return fmt.Errorf("failed to write HTML start: %w", err)
 	}
-	bytesWritten := int64(len(htmlTemplateStart))
 
-	// Calculate bytes needed for padding (within comments)
+	// Calculate bytes needed for padding
 	paddingBytesNeeded := targetSize - baseSize
 	if paddingBytesNeeded < 0 {
 		paddingBytesNeeded = 0
 	} // Should be caught above, but safety check
 
+	if o.content == ContentDOM {
+		bw := bufio.NewWriter(f)
+		if err := writeDOM(bw, paddingBytesNeeded, o); err != nil {
+			return fmt.Errorf("failed to write HTML content: %w", err)
+		}
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("failed to write HTML content: %w", err)
+		}
+	} else if err := writeTextPadding(f, paddingBytesNeeded, o.text, g.logger()); err != nil {
+		return err
+	}
+
+	// Write the end of the template
+	_, err = f.WriteString(htmlTemplateEnd)
+	if err != nil {
+		return fmt.Errorf("failed to write HTML end: %w", err)
+	}
+
+	// --- Final Size Verification ---
+	// Sync before statting
+	if syncErr := f.Sync(); syncErr != nil {
+		g.logger().Warnf("Failed to sync file %s: %v", path, syncErr)
+	}
+	info, statErr := outputfs.Stat(g.fs, path)
+	if statErr == nil {
+		finalSize := info.Size()
+		if finalSize != targetSize {
+			g.logger().Warnf("Final HTML size %d does not match target %d. Difference: %d", finalSize, targetSize, targetSize-finalSize)
+		}
+	} else {
+		g.logger().Warnf("Could not stat final file %s: %v", path, statErr)
+	}
+
+	return nil
+}
+
+// writeTextPadding writes paddingBytesNeeded bytes of safe text from text.
+func writeTextPadding(f io.StringWriter, paddingBytesNeeded int64, text func(n int) string, log ports.Logger) error {
 	// --- Padding Logic using HTML Comments ---
 	var bytesPadded int64 = 0
 	var builder strings.Builder
@@ -91,14 +231,13 @@ func (g *HtmlGenerator) Generate(path string, targetSize int64) error {
 			// Not enough space for a full comment, pad with raw bytes if possible
 			// This raw padding will go *outside* any comment tags
 			if remainingTotalPadding > 0 {
-				paddingChars := generateHtmlSafePaddingString(int(remainingTotalPadding))
+				paddingChars := text(int(remainingTotalPadding))
 				// Write directly, not into builder as it's not part of a comment
 				n, writeErr := f.WriteString(paddingChars)
 				if writeErr != nil {
 					return fmt.Errorf("failed to write final raw HTML padding: %w", writeErr)
 				}
 				bytesPadded += int64(n)
-				bytesWritten += int64(n)
 			}
 			break // Exit padding loop
 		}
@@ -110,7 +249,7 @@ func (g *HtmlGenerator) Generate(path string, targetSize int64) error {
 		}
 
 		// Generate random content for the comment
-		commentContent := generateHtmlSafePaddingString(int(contentSize)) // Generate content
+		commentContent := text(int(contentSize)) // Generate content
 
 		// Build the comment string
 		builder.WriteString(commentContent)
@@ -122,57 +261,27 @@ func (g *HtmlGenerator) Generate(path string, targetSize int64) error {
 			return fmt.Errorf("failed to write HTML comment padding: %w", writeErr)
 		}
 		bytesPadded += int64(n) // Add actual bytes written
-		bytesWritten += int64(n)
 
 		// If somehow WriteString wrote less than expected (unlikely for strings)
 		if int64(n) < int64(len(commentString)) {
-			fmt.Printf("Warning: Partial write during comment padding (%d < %d)\n", n, len(commentString))
+			log.Warnf("Partial write during comment padding (%d < %d)", n, len(commentString))
 			break // Avoid potential infinite loops
 		}
 	}
-
-	// Write the end of the template
-	_, err = f.WriteString(htmlTemplateEnd)
-	if err != nil {
-		return fmt.Errorf("failed to write HTML end: %w", err)
-	}
-	bytesWritten += int64(len(htmlTemplateEnd))
-
-	// --- Final Size Verification ---
-	// Sync before statting
-	if syncErr := f.Sync(); syncErr != nil {
-		fmt.Printf("Warning: Failed to sync file %s: %v\n", path, syncErr)
-	}
-	info, statErr := os.Stat(path)
-	if statErr == nil {
-		finalSize := info.Size()
-		if finalSize != targetSize {
-			fmt.Printf("Warning: Final HTML size %d does not match target %d. Difference: %d\n", finalSize, targetSize, targetSize-finalSize)
-			// If size is over, truncation might be needed, but risky for HTML structure
-			// if finalSize > targetSize {
-			// 	if err := f.Truncate(targetSize); err != nil {
-			// 		return fmt.Errorf("failed to truncate file: %w", err)
-			// 	}
-			// }
-		}
-	} else {
-		fmt.Printf("Warning: Could not stat final file %s: %v\n", path, statErr)
-	}
-
-	return nil // Return nil from Sync() if successful
+	return nil
 }
 
 // generateHtmlSafePaddingString generates a random string suitable for HTML content or comments.
 // Avoids characters that could break HTML structure easily ('<', '>', '&').
 // Also avoids comment end sequence '-->'.
-func generateHtmlSafePaddingString(n int) string {
+func generateHtmlSafePaddingString(r *utils.Rand, n int) string {
 	const safeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 \n\t.,;:!?()[]{}#@*+-=/\\|~`^%$" // Excludes < > &
 	var builder strings.Builder
 	builder.Grow(n)
 	lastTwo := "--" // Track last two chars to avoid generating "-->"
 
 	for i := 0; i < n; i++ {
-		char := safeChars[rand.IntN(len(safeChars))]
+		char := safeChars[r.IntN(len(safeChars))]
 		// Check if adding this char would create "-->"
 		if lastTwo == "--" && char == '>' {
 			// Replace '>' with a safe alternative, like space
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/hailam/genfile/internal/ports" //
 )
@@ -229,3 +231,104 @@ func limitString(s string, maxLen int) string {
 	}
 	return s[:maxLen] + "..."
 }
+
+func TestHtmlGenerator_GenerateDOM(t *testing.T) {
+	generator := &HtmlGenerator{}
+	tempDir := t.TempDir()
+	opts := ports.Options{"html-content": "dom"}
+
+	for _, extra := range []int64{0, 1, 17, 18, 19, 500, 5000, 200 * 1024} {
+		t.Run(fmt.Sprintf("Extra%d", extra), func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("dom_%d.html", extra))
+			size := testMinimalSize + extra
+			if err := generator.GenerateWithOptions(outPath, size, opts); err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, size)
+			checkHtmlStructure(t, outPath, true)
+			content, _ := os.ReadFile(outPath)
+			checkTagsBalanced(t, string(content))
+
+			body := strings.TrimSuffix(strings.TrimPrefix(string(content), testHtmlTemplateStart), testHtmlTemplateEnd)
+			if extra >= int64(hiddenMin) && !strings.Contains(body, "<div hidden>") {
+				t.Errorf("no hidden trimming element in %d bytes of content", extra)
+			}
+			if extra >= 200*1024 {
+				for _, tag := range []string{"<p>", "<table>", "<li>", "style=", "data:image/png;base64,"} {
+					if !strings.Contains(body, tag) {
+						t.Errorf("content lacks %q", tag)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("UnknownContent", func(t *testing.T) {
+		err := generator.GenerateWithOptions(filepath.Join(tempDir, "bad.html"), 1024, ports.Options{"html-content": "xml"})
+		if err == nil || !strings.Contains(err.Error(), "unknown html content") {
+			t.Errorf("expected unknown content error, got %v", err)
+		}
+	})
+}
+
+// checkTagsBalanced verifies every non-void element is closed in order.
+func checkTagsBalanced(t *testing.T, content string) {
+	t.Helper()
+	void := map[string]bool{"meta": true, "img": true, "br": true, "!doctype": true}
+	var stack []string
+	for _, m := range regexp.MustCompile(`<(/?)([!a-zA-Z][a-zA-Z0-9]*)[^>]*>`).FindAllStringSubmatch(content, -1) {
+		name := strings.ToLower(m[2])
+		switch {
+		case void[name]:
+		case m[1] == "":
+			stack = append(stack, name)
+		case len(stack) == 0 || stack[len(stack)-1] != name:
+			t.Fatalf("unexpected </%s>, open elements %v", name, stack)
+		default:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) != 0 {
+		t.Errorf("unclosed elements %v", stack)
+	}
+}
+
+func TestHtmlGenerator_GenerateLang(t *testing.T) {
+	generator := &HtmlGenerator{}
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		lang, content, attrs string
+	}{
+		{"ar", "padding", `<html lang="ar" dir="rtl">`},
+		{"zh", "dom", `<html lang="zh">`},
+		{"ru", "dom", `<html lang="ru">`},
+		{"emoji", "padding", `<html lang="und">`},
+		{"mixed", "dom", `<html lang="mul">`},
+	}
+	for _, tc := range tests {
+		for _, size := range []int64{400, 4001, 100 * 1024} {
+			t.Run(fmt.Sprintf("%s_%s_%d", tc.lang, tc.content, size), func(t *testing.T) {
+				outPath := filepath.Join(tempDir, fmt.Sprintf("%s_%s_%d.html", tc.lang, tc.content, size))
+				opts := ports.Options{"lang": tc.lang, "html-content": tc.content}
+				if err := generator.GenerateWithOptions(outPath, size, opts); err != nil {
+					t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+				}
+				checkFileSize(t, outPath, size)
+				checkHtmlStructure(t, outPath, true)
+				content, _ := os.ReadFile(outPath)
+				if !utf8.Valid(content) || !strings.Contains(string(content), tc.attrs) {
+					t.Errorf("content is not valid UTF-8 with %s", tc.attrs)
+				}
+				checkTagsBalanced(t, string(content))
+			})
+		}
+	}
+
+	t.Run("UnknownLang", func(t *testing.T) {
+		err := generator.GenerateWithOptions(filepath.Join(tempDir, "bad.html"), 1024, ports.Options{"lang": "xx"})
+		if err == nil || !strings.Contains(err.Error(), "unknown lang") {
+			t.Errorf("expected unknown lang error, got %v", err)
+		}
+	})
+}
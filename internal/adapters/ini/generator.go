@@ -0,0 +1,241 @@
+package ini
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeINI, New())
+}
+
+// IniGenerator writes INI configuration files: sections of key=value
+// settings, strings, numbers, booleans, paths and URLs, ended by comment
+// lines.
+type IniGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &IniGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *IniGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *IniGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	// firstSection opens every file.
+	firstSection = "[General]"
+	// lineLen is the longest comment line written.
+	lineLen        = 80
+	keysPerSection = 12
+)
+
+// newlines maps the "ini-newline" values to line endings.
+var newlines = map[string]string{"crlf": "\r\n", "lf": "\n"}
+
+// iniOptions holds the settings the INI generator reads from
+// ports.Options.
+type iniOptions struct {
+	nl   string
+	rand *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (iniOptions, error) {
+	var o iniOptions
+	name := strings.ToLower(opts.String("ini-newline", "crlf"))
+	nl, ok := newlines[name]
+	if !ok {
+		return o, fmt.Errorf("unknown ini-newline %q (want crlf or lf)", name)
+	}
+	o.nl = nl
+	var err error
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *IniGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+func (g *IniGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := g.GenerateTo(f, size, opts); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// GenerateTo writes exactly size bytes of INI to w: a [General] section
+// and more with random settings, then semicolon comment lines that make up
+// the size. Lines end in CR LF, or LF with "ini-newline" lf.
+func (g *IniGenerator) GenerateTo(w io.Writer, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	head := firstSection + o.nl
+	if need := int64(len(head) + len(o.nl)); size < need {
+		return fmt.Errorf("target %d too small for an INI file; need at least %d bytes", size, need)
+	}
+
+	bw := bufio.NewWriter(w)
+	write := func(s string) error {
+		if _, err := bw.WriteString(s); err != nil {
+			return fmt.Errorf("failed to write INI: %w", err)
+		}
+		return nil
+	}
+	if err := write(head); err != nil {
+		return err
+	}
+	remaining := size - int64(len(head))
+	// Sections and settings follow while a blank line still fits after
+	// them; comments take what they leave.
+	fits := func(s string) bool {
+		return remaining-int64(len(s)) >= int64(len(o.nl))
+	}
+	sections := map[string]bool{"General": true}
+	for first := true; ; first = false {
+		if !first {
+			name := ""
+			for name == "" || sections[name] {
+				name = o.title()
+				if o.rand.IntN(2) == 0 {
+					name += "." + o.title()
+				}
+			}
+			sections[name] = true
+			line := o.nl + "[" + name + "]" + o.nl
+			if !fits(line) {
+				break
+			}
+			if err := write(line); err != nil {
+				return err
+			}
+			remaining -= int64(len(line))
+		}
+		keys := map[string]bool{}
+		full := true
+		for range keysPerSection {
+			s := o.setting(keys)
+			if !fits(s) {
+				full = false
+				break
+			}
+			if err := write(s); err != nil {
+				return err
+			}
+			remaining -= int64(len(s))
+		}
+		if !full {
+			break
+		}
+	}
+	if err := write(o.comments(int(remaining))); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write INI: %w", err)
+	}
+	return nil
+}
+
+// setting returns a random key=value line of the current section, keyed
+// apart from the keys already taken, which it adds to.
+func (o iniOptions) setting(keys map[string]bool) string {
+	key := ""
+	for key == "" || keys[key] {
+		key = o.title() + o.title()
+	}
+	keys[key] = true
+
+	var value string
+	switch o.rand.IntN(6) {
+	case 0:
+		value = utils.Lorem.Sentence(o.rand, 2, 8)
+	case 1:
+		value = strconv.Itoa(o.rand.IntN(65536))
+	case 2:
+		value = strconv.FormatBool(o.rand.IntN(2) == 0)
+	case 3:
+		value = `C:\Program Files\Genfile\` + utils.Lorem.Word(o.rand) + ".exe"
+	case 4:
+		value = "https://example.com/" + utils.Lorem.Word(o.rand)
+	default:
+		value = strconv.FormatFloat(o.rand.Float64()*100, 'f', 2, 64)
+	}
+	return key + "=" + value + o.nl
+}
+
+// comments returns exactly n bytes of comment lines, at least a blank
+// line's worth, each at most lineLen bytes.
+func (o iniOptions) comments(n int) string {
+	var b strings.Builder
+	for n > 0 {
+		l := min(n, lineLen)
+		// The last line holds at least a semicolon.
+		if rest := n - l; rest > 0 && rest <= len(o.nl) {
+			l = n - len(o.nl) - 1
+		}
+		b.WriteString(o.comment(l))
+		n -= l
+	}
+	return b.String()
+}
+
+// comment returns a comment line of exactly n bytes, or a blank line when
+// n leaves no room for the semicolon.
+func (o iniOptions) comment(n int) string {
+	room := n - len(o.nl) - 1
+	if room < 0 {
+		return o.nl
+	}
+	text := ""
+	if room > 0 {
+		// The text ends in a letter, as editors may trim trailing spaces.
+		text = strings.TrimRight(utils.Lorem.Text(o.rand, room-1), " ")
+	}
+	return ";" + strings.Repeat(" ", room-len(text)) + text + o.nl
+}
+
+func (o iniOptions) title() string {
+	w := utils.Lorem.Word(o.rand)
+	return strings.ToUpper(w[:1]) + w[1:]
+}
@@ -0,0 +1,125 @@
+package ini
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestIniGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name   string
+		size   int64
+		opts   ports.Options
+		errSub string
+	}{
+		{name: "Smallest", size: 13},
+		{name: "Settings", size: 64 * 1024},
+		{name: "LF", size: 64*1024 + 1, opts: ports.Options{"ini-newline": "lf"}},
+		{name: "SmallestLF", size: 11, opts: ports.Options{"ini-newline": "LF"}},
+		{name: "TooSmall", size: 12, errSub: "too small"},
+		{name: "BadNewline", size: 4096, opts: ports.Options{"ini-newline": "cr"}, errSub: "ini-newline"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "settings.ini")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			nl := "\r\n"
+			if tc.opts["ini-newline"] != "" {
+				nl = "\n"
+			}
+			checkINI(t, string(data), nl)
+		})
+	}
+}
+
+func TestIniGenerator_Sizes(t *testing.T) {
+	// Every size from the smallest file up reaches its target.
+	generator := New().(ports.OptionsGenerator)
+	dir := t.TempDir()
+	for nlName, nl := range newlines {
+		for size := int64(13); size < 2000; size++ {
+			path := filepath.Join(dir, "settings.ini")
+			if err := generator.GenerateWithOptions(path, size, ports.Options{"ini-newline": nlName}); err != nil {
+				t.Fatalf("%s, %d bytes: %v", nlName, size, err)
+			}
+			data, _ := os.ReadFile(path)
+			if int64(len(data)) != size {
+				t.Fatalf("%s, %d bytes came out as %d", nlName, size, len(data))
+			}
+			checkINI(t, string(data), nl)
+		}
+	}
+}
+
+func TestIniGenerator_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New().(ports.StreamGenerator).GenerateTo(&buf, 10000, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 10000 {
+		t.Fatalf("streamed %d bytes, want 10000", buf.Len())
+	}
+	checkINI(t, buf.String(), "\r\n")
+}
+
+// checkINI checks data is an INI file opening with [General]: section
+// headers, each named once, key=value settings with keys unique in their
+// section, blank lines and comments.
+func checkINI(t *testing.T, data, nl string) {
+	t.Helper()
+	if !strings.HasSuffix(data, nl) {
+		t.Fatal("last line is not terminated")
+	}
+	lines := strings.Split(strings.TrimSuffix(data, nl), nl)
+	if lines[0] != firstSection {
+		t.Fatalf("first line is %q, want %s", lines[0], firstSection)
+	}
+	sections := map[string]bool{}
+	var keys map[string]bool
+	for i, line := range lines {
+		if strings.ContainsAny(line, "\r\n") {
+			t.Fatalf("line %d holds a stray line break", i)
+		}
+		switch {
+		case line == "", strings.HasPrefix(line, ";"):
+			if len(line) > lineLen {
+				t.Fatalf("line %d: comment of %d bytes", i, len(line))
+			}
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") || sections[line] {
+				t.Fatalf("line %d: bad or repeated section %q", i, line)
+			}
+			sections[line] = true
+			keys = map[string]bool{}
+		default:
+			key, _, ok := strings.Cut(line, "=")
+			if !ok || key == "" || keys[key] {
+				t.Fatalf("line %d: bad or repeated setting %q", i, line)
+			}
+			keys[key] = true
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/ooxml"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeJAR, New())
+	factory.RegisterGenerator(ports.FileTypeWAR, NewWAR())
+}
+
+// JarGenerator writes Java archives: a JAR holding a manifest and one
+// class, or a WAR that lays them out as a web application. A padding
+// entry brings either to its size.
+type JarGenerator struct {
+	opts ports.Options // set by Configure
+	war  bool
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &JarGenerator{}
+}
+
+// NewWAR returns a generator of web application archives.
+func NewWAR() ports.FileGenerator {
+	return &JarGenerator{war: true}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *JarGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *JarGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	defaultName    = "genfile-fixture"
+	defaultVersion = "1.0.0"
+	// className is the internal name of the class the archive holds.
+	className = "genfile/Fixture"
+	// maxValueLen keeps manifest lines within the 72 bytes the JAR
+	// specification allows without continuation lines.
+	maxValueLen = 48
+)
+
+var (
+	nameRe    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+	versionRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+~:-]*$`)
+	// jarMagic is the extra field the jar tool puts on an archive's first
+	// entry, by which file(1) tells JARs from other ZIP archives.
+	jarMagic = []byte{0xfe, 0xca, 0, 0}
+)
+
+// jarOptions holds the settings the JAR generator reads from ports.Options.
+type jarOptions struct {
+	name, version string
+	modTime       time.Time // zero for the time of generation
+}
+
+func parseOptions(opts ports.Options) (jarOptions, error) {
+	o := jarOptions{
+		name:    opts.String("pkg-name", defaultName),
+		version: opts.String("pkg-version", defaultVersion),
+	}
+	if len(o.name) > maxValueLen || !nameRe.MatchString(o.name) {
+		return o, fmt.Errorf("invalid package name %q: use up to %d letters, digits, '.', '_', '+' and '-'", o.name, maxValueLen)
+	}
+	if len(o.version) > maxValueLen || !versionRe.MatchString(o.version) {
+		return o, fmt.Errorf("invalid package version %q: use up to %d letters, digits and '.', '_', '+', '~', ':' or '-'", o.version, maxValueLen)
+	}
+	var err error
+	if o.modTime, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *JarGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes a JAR or WAR of exactly size bytes. Its
+// manifest gives "pkg-name" (genfile-fixture) and "pkg-version" (1.0.0) as
+// the implementation title and version; a WAR's web.xml gives the name as
+// its display name. The "mtime" option dates the entries.
+func (g *JarGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.modTime.IsZero() {
+		o.modTime = time.Now()
+	}
+	archive, err := g.archive(o)
+	if err != nil {
+		return err
+	}
+	return ooxml.WritePadded(g.fs, path, archive, size, o.modTime)
+}
+
+// Resize writes the archive at srcPath to outPath with its entries as they
+// are and its padding entry sized to bring it to exactly targetSize.
+func (g *JarGenerator) Resize(srcPath, outPath string, targetSize int64) error {
+	return ooxml.Resize(g.fs, srcPath, outPath, targetSize)
+}
+
+// entry is an archive entry; directories end in a slash and have no body.
+type entry struct {
+	name string
+	body []byte
+}
+
+// archive returns the archive without padding. Classes of a WAR go under
+// WEB-INF/classes, next to its deployment descriptor.
+func (g *JarGenerator) archive(o jarOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, body []byte, extra []byte) error {
+		method := zip.Deflate
+		if len(body) == 0 {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: o.modTime, Extra: extra})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", name, err)
+		}
+		if _, err := w.Write(body); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		return nil
+	}
+
+	entries := []entry{
+		{"META-INF/", nil},
+		{"META-INF/MANIFEST.MF", manifest(o)},
+	}
+	classDir := ""
+	if g.war {
+		classDir = "WEB-INF/classes/"
+		entries = append(entries,
+			entry{"WEB-INF/", nil},
+			entry{"WEB-INF/web.xml", webXML(o)},
+			entry{"WEB-INF/classes/", nil},
+		)
+	}
+	entries = append(entries,
+		entry{classDir + "genfile/", nil},
+		entry{classDir + className + ".class", classFile(className)},
+	)
+	if g.war {
+		entries = append(entries, entry{"index.html", indexHTML(o)})
+	}
+
+	for i, e := range entries {
+		var extra []byte
+		if i == 0 {
+			extra = jarMagic
+		}
+		if err := add(e.name, e.body, extra); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// manifest returns META-INF/MANIFEST.MF, with the CRLF line endings the
+// jar tool writes.
+func manifest(o jarOptions) []byte {
+	return []byte("Manifest-Version: 1.0\r\n" +
+		"Created-By: genfile\r\n" +
+		"Implementation-Title: " + o.name + "\r\n" +
+		"Implementation-Version: " + o.version + "\r\n" +
+		"\r\n")
+}
+
+// webXML returns a Jakarta EE 10 deployment descriptor welcoming visitors
+// with index.html.
+func webXML(o jarOptions) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<web-app xmlns="https://jakarta.ee/xml/ns/jakartaee"
+         xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+         xsi:schemaLocation="https://jakarta.ee/xml/ns/jakartaee https://jakarta.ee/xml/ns/jakartaee/web-app_6_0.xsd"
+         version="6.0">
+  <display-name>` + o.name + `</display-name>
+  <welcome-file-list>
+    <welcome-file>index.html</welcome-file>
+  </welcome-file-list>
+</web-app>
+`)
+}
+
+func indexHTML(o jarOptions) []byte {
+	return []byte(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>` + o.name + `</title></head>
+<body><p>` + o.name + ` ` + o.version + `, generated by genfile.</p></body>
+</html>
+`)
+}
+
+// classFile returns a Java 8 class file declaring the public class name,
+// which extends java.lang.Object and has no members.
+func classFile(name string) []byte {
+	var b bytes.Buffer
+	u16 := func(v int) { binary.Write(&b, binary.BigEndian, uint16(v)) }
+	utf8 := func(s string) {
+		b.WriteByte(1) // CONSTANT_Utf8
+		u16(len(s))
+		io.WriteString(&b, s)
+	}
+	b.Write([]byte{0xca, 0xfe, 0xba, 0xbe})
+	u16(0)         // minor version
+	u16(52)        // major version: Java 8
+	u16(5)         // constant pool count, one more than its entries
+	b.WriteByte(7) // #1 CONSTANT_Class #2
+	u16(2)
+	utf8(name)     // #2
+	b.WriteByte(7) // #3 CONSTANT_Class #4
+	u16(4)
+	utf8("java/lang/Object") // #4
+	u16(0x0021)              // ACC_PUBLIC | ACC_SUPER
+	u16(1)                   // this class
+	u16(3)                   // super class
+	u16(0)                   // interfaces
+	u16(0)                   // fields
+	u16(0)                   // methods
+	u16(0)                   // attributes
+	return b.Bytes()
+}
@@ -0,0 +1,116 @@
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestJarGenerator_Generate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		gen      ports.FileGenerator
+		size     int64
+		opts     ports.Options
+		manifest string // a line the manifest holds
+		class    string // path of the class
+		errSub   string
+	}{
+		{name: "JAR", gen: New(), size: 1 << 20, manifest: "Implementation-Title: genfile-fixture\r\n", class: "genfile/Fixture.class"},
+		{name: "Small", gen: New(), size: 2000, manifest: "Implementation-Version: 1.0.0\r\n", class: "genfile/Fixture.class"},
+		{name: "WAR", gen: NewWAR(), size: 100000, opts: ports.Options{"pkg-name": "shop", "pkg-version": "2.1.0-SNAPSHOT"}, manifest: "Implementation-Version: 2.1.0-SNAPSHOT\r\n", class: "WEB-INF/classes/genfile/Fixture.class"},
+		{name: "TooSmall", gen: New(), size: 500, errSub: "does not fit"},
+		{name: "BadName", gen: New(), size: 10000, opts: ports.Options{"pkg-name": "my app"}, errSub: "invalid package name"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixture.jar")
+			err := tc.gen.(ports.OptionsGenerator).GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("zip.NewReader() error = %v", err)
+			}
+			if zr.File[0].Name != "META-INF/" || !bytes.HasPrefix(zr.File[0].Extra, jarMagic) {
+				t.Errorf("first entry = %q with extra %x, want META-INF/ with the JAR magic", zr.File[0].Name, zr.File[0].Extra)
+			}
+			files := map[string][]byte{}
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("opening %s: %v", f.Name, err)
+				}
+				if files[f.Name], err = io.ReadAll(rc); err != nil {
+					t.Fatalf("reading %s: %v", f.Name, err)
+				}
+				rc.Close()
+			}
+			if mf := string(files["META-INF/MANIFEST.MF"]); !strings.HasPrefix(mf, "Manifest-Version: 1.0\r\n") || !strings.Contains(mf, tc.manifest) {
+				t.Errorf("manifest = %q, want it to hold %q", mf, tc.manifest)
+			}
+			class, ok := files[tc.class]
+			if !ok {
+				t.Fatalf("missing %s", tc.class)
+			}
+			if got := readClassName(t, class); got != className {
+				t.Errorf("class name = %q, want %q", got, className)
+			}
+			if _, ok := files["WEB-INF/web.xml"]; ok != strings.HasPrefix(tc.class, "WEB-INF/") {
+				t.Errorf("web.xml present = %v for %s", ok, tc.name)
+			}
+		})
+	}
+}
+
+// readClassName returns the name of the class a class file defines.
+func readClassName(t *testing.T, class []byte) string {
+	t.Helper()
+	if !bytes.HasPrefix(class, []byte{0xca, 0xfe, 0xba, 0xbe}) {
+		t.Fatalf("missing class file magic: %x", class[:4])
+	}
+	u16 := func(off int) int { return int(binary.BigEndian.Uint16(class[off:])) }
+	// Read the constant pool, which holds only classes and UTF-8 strings.
+	count := u16(8)
+	pool := make([]string, count)
+	classes := map[int]int{}
+	off := 10
+	for i := 1; i < count; i++ {
+		switch class[off] {
+		case 1:
+			n := u16(off + 1)
+			pool[i] = string(class[off+3 : off+3+n])
+			off += 3 + n
+		case 7:
+			classes[i] = u16(off + 1)
+			off += 3
+		default:
+			t.Fatalf("unexpected constant pool tag %d", class[off])
+		}
+	}
+	if end := off + 14; end != len(class) {
+		t.Errorf("class file is %d bytes, want %d", len(class), end)
+	}
+	return pool[classes[u16(off+2)]]
+}
@@ -0,0 +1,231 @@
+package jp2
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeJP2, New())
+}
+
+// Jp2Generator writes JPEG 2000 files: a grayscale codestream in the JP2
+// box container, followed by a free box that pads the file.
+type Jp2Generator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &Jp2Generator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *Jp2Generator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, _, err := dimensions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *Jp2Generator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	// Default dimensions: an A4 page scanned at 300 dpi.
+	defaultWidth  = 2480
+	defaultHeight = 3508
+	// maxDimension keeps the image within one precinct of the default
+	// 2^15 size, so the tile has a single packet.
+	maxDimension = 1 << 15
+	// pixelsPerMetre is the 300 dpi capture resolution.
+	pixelsPerMetre = 11811
+
+	comment = "Created by genfile"
+	// boxHeaderSize is the length and type of a box; a box over 4 GiB
+	// has an extended length as well.
+	boxHeaderSize         = 8
+	extendedBoxHeaderSize = 16
+)
+
+// Codestream markers.
+const (
+	markerSOC = 0xFF4F
+	markerSIZ = 0xFF51
+	markerCOD = 0xFF52
+	markerQCD = 0xFF5C
+	markerCOM = 0xFF64
+	markerSOT = 0xFF90
+	markerSOD = 0xFF93
+	markerEOC = 0xFFD9
+)
+
+func (g *Jp2Generator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes a JP2 of exactly size bytes. The codestream
+// is a valid single-tile, lossless 8-bit grayscale image of "width" by
+// "height" pixels (an A4 page at 300 dpi by default) whose one packet is
+// empty, so decoders show it as flat mid-gray. A free box after the
+// codestream makes up the size, or for a few bytes its comment does.
+func (g *Jp2Generator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	w, h, err := dimensions(opts)
+	if err != nil {
+		return err
+	}
+
+	text := comment
+	fixed := int64(len(header(w, h)) + boxHeaderSize + len(codestream(w, h, text)))
+	if size < fixed {
+		return fmt.Errorf("target %d too small for a JPEG 2000 file; need at least %d bytes", size, fixed)
+	}
+	padding := size - fixed
+	if padding < boxHeaderSize {
+		// Too little for a box; the comment takes it.
+		text += strings.Repeat(" ", int(padding))
+		padding = 0
+	}
+	cs := codestream(w, h, text)
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	bw.Write(header(w, h))
+	writeBoxHeader(bw, "jp2c", int64(boxHeaderSize+len(cs)))
+	bw.Write(cs)
+	if padding > 0 {
+		if err := writeFreeBox(bw, padding); err != nil {
+			return fmt.Errorf("failed to write JPEG 2000 padding: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write JPEG 2000 file: %w", err)
+	}
+	return f.Sync()
+}
+
+// dimensions returns the "width" and "height" options, by default an A4
+// page at 300 dpi.
+func dimensions(opts ports.Options) (w, h int, err error) {
+	if w, err = opts.Int("width", defaultWidth); err != nil {
+		return 0, 0, err
+	}
+	if h, err = opts.Int("height", defaultHeight); err != nil {
+		return 0, 0, err
+	}
+	if w < 1 || h < 1 || w > maxDimension || h > maxDimension {
+		return 0, 0, fmt.Errorf("JPEG 2000 dimensions must be between 1 and %d, got %dx%d", maxDimension, w, h)
+	}
+	return w, h, nil
+}
+
+// header returns the boxes ahead of the codestream: the signature, the
+// file type and the JP2 header with the image header, the grayscale
+// colour specification and the capture resolution.
+func header(w, h int) []byte {
+	var b []byte
+	box := func(kind string, payload ...any) []byte {
+		body := be(payload...)
+		return append(be(uint32(boxHeaderSize+len(body)), []byte(kind)), body...)
+	}
+	b = append(b, box("jP  ", uint32(0x0D0A870A))...)
+	b = append(b, box("ftyp", []byte("jp2 "), uint32(0), []byte("jp2 "))...)
+	// BPC 7 is 8-bit unsigned; C 7 is JPEG 2000 compression.
+	ihdr := box("ihdr", uint32(h), uint32(w), uint16(1), uint8(7), uint8(7), uint8(0), uint8(0))
+	// Enumerated colour space 17 is greyscale.
+	colr := box("colr", uint8(1), uint8(0), uint8(0), uint32(17))
+	resc := box("resc", uint16(pixelsPerMetre), uint16(1), uint16(pixelsPerMetre), uint16(1), int8(0), int8(0))
+	res := box("res ", resc)
+	b = append(b, box("jp2h", ihdr, colr, res)...)
+	return b
+}
+
+// codestream returns a JPEG 2000 codestream of one tile and one component
+// with no wavelet decomposition and a single, empty packet, with text in
+// a comment marker.
+func codestream(w, h int, text string) []byte {
+	marker := func(m uint16, payload ...any) []byte {
+		body := be(payload...)
+		return append(be(m, uint16(2+len(body))), body...)
+	}
+	var b []byte
+	b = append(b, be(uint16(markerSOC))...)
+	// Image and tile size: one tile covering the image, one 8-bit
+	// unsigned component sampled at every pixel.
+	b = append(b, marker(markerSIZ, uint16(0), uint32(w), uint32(h), uint32(0), uint32(0),
+		uint32(w), uint32(h), uint32(0), uint32(0), uint16(1), uint8(7), uint8(1), uint8(1))...)
+	// Coding style: default precincts, LRCP progression, one layer, no
+	// colour transform, no decomposition, 64x64 code-blocks and the
+	// reversible 5/3 wavelet.
+	b = append(b, marker(markerCOD, uint8(0), uint8(0), uint16(1), uint8(0),
+		uint8(0), uint8(4), uint8(4), uint8(0), uint8(1))...)
+	// Quantization: none, two guard bits, and an exponent of 8 for the
+	// one LL subband.
+	b = append(b, marker(markerQCD, uint8(2<<5), uint8(8<<3))...)
+	// Comment, registration value 1 for Latin-1 text.
+	b = append(b, marker(markerCOM, uint16(1), []byte(text))...)
+	// The tile-part: SOT, SOD and the one-byte empty packet header.
+	const tilePart = 12 + 2 + 1
+	b = append(b, marker(markerSOT, uint16(0), uint32(tilePart), uint8(0), uint8(1))...)
+	b = append(b, be(uint16(markerSOD), uint8(0), uint16(markerEOC))...)
+	return b
+}
+
+// writeBoxHeader writes the header of a box of n bytes in all, with the
+// extended length if n does not fit 32 bits. It returns the header size.
+func writeBoxHeader(bw *bufio.Writer, kind string, n int64) int64 {
+	if n > math.MaxUint32 {
+		bw.Write(be(uint32(1), []byte(kind), uint64(n)))
+		return extendedBoxHeaderSize
+	}
+	bw.Write(be(uint32(n), []byte(kind)))
+	return boxHeaderSize
+}
+
+// writeFreeBox writes a free box of exactly n bytes, at least
+// boxHeaderSize, filled with zeros.
+func writeFreeBox(bw *bufio.Writer, n int64) error {
+	payload := n - writeBoxHeader(bw, "free", n)
+	zeros := make([]byte, 64*1024)
+	for payload > 0 {
+		k := min(payload, int64(len(zeros)))
+		if _, err := bw.Write(zeros[:k]); err != nil {
+			return err
+		}
+		payload -= k
+	}
+	return nil
+}
+
+// be returns values encoded big-endian, byte slices as they are.
+func be(values ...any) []byte {
+	var b []byte
+	for _, v := range values {
+		if raw, ok := v.([]byte); ok {
+			b = append(b, raw...)
+			continue
+		}
+		b, _ = binary.Append(b, binary.BigEndian, v)
+	}
+	return b
+}
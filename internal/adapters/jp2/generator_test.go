@@ -0,0 +1,142 @@
+package jp2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestJp2Generator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name          string
+		size          int64
+		opts          ports.Options
+		width, height int // want
+		errSub        string
+	}{
+		{name: "Default", size: 1024 * 1024, width: defaultWidth, height: defaultHeight},
+		{name: "Small", size: 1000, width: defaultWidth, height: defaultHeight},
+		{name: "Dimensions", size: 5000, opts: ports.Options{"width": "640", "height": "480"}, width: 640, height: 480},
+		{name: "TooSmall", size: 100, errSub: "too small"},
+		{name: "TooWide", size: 5000, opts: ports.Options{"width": "40000"}, errSub: "dimensions"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scan.jp2")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			checkJP2(t, data, tc.width, tc.height)
+		})
+	}
+}
+
+func TestJp2Generator_Sizes(t *testing.T) {
+	// Every size from the smallest file up reaches its target, whether a
+	// free box fits or not.
+	generator := New()
+	dir := t.TempDir()
+	for size := int64(240); size < 300; size++ {
+		path := filepath.Join(dir, "scan.jp2")
+		err := generator.Generate(path, size)
+		if err != nil {
+			if strings.Contains(err.Error(), "too small") {
+				continue
+			}
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		data, _ := os.ReadFile(path)
+		if int64(len(data)) != size {
+			t.Fatalf("%d bytes came out as %d", size, len(data))
+		}
+		checkJP2(t, data, defaultWidth, defaultHeight)
+	}
+}
+
+// checkJP2 walks the top-level boxes, checking their order and lengths,
+// the image header and the codestream markers.
+func checkJP2(t *testing.T, data []byte, width, height int) {
+	t.Helper()
+	var kinds []string
+	var codestream []byte
+	for off := 0; off < len(data); {
+		if off+boxHeaderSize > len(data) {
+			t.Fatalf("box header at %d is truncated", off)
+		}
+		length := int(binary.BigEndian.Uint32(data[off:]))
+		kind := string(data[off+4 : off+8])
+		head := boxHeaderSize
+		if length == 1 {
+			length, head = int(binary.BigEndian.Uint64(data[off+8:])), extendedBoxHeaderSize
+		}
+		if length < head || off+length > len(data) {
+			t.Fatalf("box %q at %d has length %d in %d bytes", kind, off, length, len(data))
+		}
+		body := data[off+head : off+length]
+		switch kind {
+		case "jp2h":
+			if !bytes.HasPrefix(body[4:], []byte("ihdr")) {
+				t.Fatal("jp2h does not start with ihdr")
+			}
+			h, w := binary.BigEndian.Uint32(body[8:]), binary.BigEndian.Uint32(body[12:])
+			if int(w) != width || int(h) != height {
+				t.Errorf("ihdr = %dx%d, want %dx%d", w, h, width, height)
+			}
+		case "jp2c":
+			codestream = body
+		}
+		kinds = append(kinds, kind)
+		off += length
+	}
+	if got := strings.Join(kinds, ","); got != "jP  ,ftyp,jp2h,jp2c" && got != "jP  ,ftyp,jp2h,jp2c,free" {
+		t.Fatalf("boxes = %s", got)
+	}
+
+	// The main header markers have lengths that chain to the tile-part.
+	want := []uint16{markerSIZ, markerCOD, markerQCD, markerCOM, markerSOT}
+	if binary.BigEndian.Uint16(codestream) != markerSOC {
+		t.Fatal("codestream does not start with SOC")
+	}
+	off := 2
+	for _, m := range want {
+		if got := binary.BigEndian.Uint16(codestream[off:]); got != m {
+			t.Fatalf("marker at %d = %#x, want %#x", off, got, m)
+		}
+		if m == markerSIZ {
+			w, h := binary.BigEndian.Uint32(codestream[off+6:]), binary.BigEndian.Uint32(codestream[off+10:])
+			if int(w) != width || int(h) != height {
+				t.Errorf("SIZ = %dx%d, want %dx%d", w, h, width, height)
+			}
+		}
+		if m == markerSOT {
+			if psot := int(binary.BigEndian.Uint32(codestream[off+6:])); off+psot != len(codestream)-2 {
+				t.Fatalf("tile-part of %d bytes at %d does not reach EOC in %d", psot, off, len(codestream))
+			}
+		}
+		off += 2 + int(binary.BigEndian.Uint16(codestream[off+2:]))
+	}
+	if got := binary.BigEndian.Uint16(codestream[len(codestream)-2:]); got != markerEOC {
+		t.Fatalf("codestream ends with %#x, want EOC", got)
+	}
+}
@@ -0,0 +1,109 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+const (
+	// iccMarker starts the payload of each APP2 segment of an ICC profile,
+	// ahead of the segment's sequence number and the segment count.
+	iccMarker = "ICC_PROFILE\x00"
+	// iccSegmentOverhead is what each APP2 segment adds to its share of
+	// the profile: marker, length, identifier, sequence number and count.
+	iccSegmentOverhead = 4 + len(iccMarker) + 2
+	// maxICCChunk is the most of the profile an APP2 segment holds.
+	maxICCChunk = 0xFFFF - 2 - len(iccMarker) - 2
+	// maxICCSegments is the most segments a profile can be split across.
+	maxICCSegments = 255
+)
+
+// jfifSegment returns a JFIF APP0 segment giving the resolution in dots
+// per inch, without a thumbnail.
+func jfifSegment(dpi int) []byte {
+	seg := []byte{0xFF, 0xE0, 0, 16}
+	seg = append(seg, "JFIF\x00\x01\x02\x01"...) // version 1.02, units: dots per inch
+	seg = binary.BigEndian.AppendUint16(seg, uint16(dpi))
+	seg = binary.BigEndian.AppendUint16(seg, uint16(dpi))
+	return append(seg, 0, 0)
+}
+
+// iccSegments splits profile evenly across count APP2 segments.
+func iccSegments(profile []byte, count int) []byte {
+	out := make([]byte, 0, len(profile)+count*iccSegmentOverhead)
+	rest := profile
+	for i := 0; i < count; i++ {
+		n := len(rest) / (count - i)
+		out = append(out, 0xFF, 0xE2)
+		out = binary.BigEndian.AppendUint16(out, uint16(2+len(iccMarker)+2+n))
+		out = append(out, iccMarker...)
+		out = append(out, byte(i+1), byte(count))
+		out = append(out, rest[:n]...)
+		rest = rest[n:]
+	}
+	return out
+}
+
+// iccSegmentCount returns the fewest segments n bytes of profile fit in.
+func iccSegmentCount(n int) int {
+	return max((n+maxICCChunk-1)/maxICCChunk, 1)
+}
+
+// iccSize returns the size of the APP2 segments of profile as it is, or
+// zero for none.
+func iccSize(profile []byte) int64 {
+	if profile == nil {
+		return 0
+	}
+	return int64(len(profile) + iccSegmentCount(len(profile))*iccSegmentOverhead)
+}
+
+// fitICC returns the APP2 segments of o's profile. With o.iccPad the
+// profile is padded to take as much of room bytes as the segments can
+// hold, leaving what is over either nothing or enough for a COM segment;
+// otherwise, or if there is too little room to pad the profile, it is
+// left as it is.
+func fitICC(o jpegOptions, room int64) ([]byte, error) {
+	count := iccSegmentCount(len(o.icc))
+	if base := iccSize(o.icc); room < base {
+		return nil, fmt.Errorf("no room for a %d-byte ICC profile", base)
+	}
+	if !o.iccPad {
+		return iccSegments(o.icc, count), nil
+	}
+	take := min(room, int64(maxICCSegments*(maxICCChunk+iccSegmentOverhead)))
+	if rest := room - take; rest > 0 && rest < comHeaderLen {
+		take -= comHeaderLen - rest
+	}
+	padCount := int((take + int64(maxICCChunk+iccSegmentOverhead) - 1) / int64(maxICCChunk+iccSegmentOverhead))
+	pad := take - int64(padCount*iccSegmentOverhead) - int64(len(o.icc))
+	if pad < int64(utils.ICCPadMin(o.icc)) {
+		return iccSegments(o.icc, count), nil
+	}
+	profile, err := utils.PadICCProfile(o.rand, o.icc, int(pad))
+	if err != nil {
+		return nil, err
+	}
+	return iccSegments(profile, padCount), nil
+}
+
+// insertAfterAPPn places segment after the application segments that
+// follow the SOI marker, where ICC profiles conventionally go.
+func insertAfterAPPn(jpegData, segment []byte) ([]byte, error) {
+	if len(jpegData) < 2 || jpegData[0] != 0xFF || jpegData[1] != 0xD8 {
+		return nil, fmt.Errorf("invalid JPEG: SOI marker not found")
+	}
+	off := 2
+	for off+4 <= len(jpegData) && jpegData[off] == 0xFF && jpegData[off+1] >= 0xE0 && jpegData[off+1] <= 0xEF {
+		off += 2 + int(binary.BigEndian.Uint16(jpegData[off+2:]))
+	}
+	var out bytes.Buffer
+	out.Grow(len(jpegData) + len(segment))
+	out.Write(jpegData[:off])
+	out.Write(segment)
+	out.Write(jpegData[off:])
+	return out.Bytes(), nil
+}
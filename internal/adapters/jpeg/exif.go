@@ -0,0 +1,262 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// EXIF field types.
+const (
+	exifByte      = 1
+	exifASCII     = 2
+	exifShort     = 3
+	exifLong      = 4
+	exifRational  = 5
+	exifUndefined = 7
+)
+
+// maxAPP1Payload is the largest payload a JPEG marker segment can carry.
+const maxAPP1Payload = 0xFFFF - 2
+
+// userCommentPrefix is the 8-byte character code that starts a UserComment.
+const userCommentPrefix = "ASCII\x00\x00\x00"
+
+// cameras lists the make/model pairs written into EXIF blocks.
+var cameras = [][2]string{
+	{"Canon", "Canon EOS 5D Mark IV"},
+	{"Canon", "Canon EOS R6"},
+	{"NIKON CORPORATION", "NIKON D850"},
+	{"NIKON CORPORATION", "NIKON Z 6_2"},
+	{"SONY", "ILCE-7M3"},
+	{"FUJIFILM", "X-T4"},
+	{"Apple", "iPhone 14 Pro"},
+	{"samsung", "SM-S918B"},
+	{"Google", "Pixel 8"},
+}
+
+// exifTag is one IFD entry; data holds its value big-endian encoded.
+type exifTag struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// exifBlock holds the IFDs of a camera-style EXIF block. Its UserComment
+// is the padding vehicle: segment can grow it byte by byte.
+type exifBlock struct {
+	ifd0, exif, gps []exifTag
+}
+
+// newExifBlock returns EXIF metadata for a w×h photo with a camera and GPS
+// position drawn from r, taken at taken or, if that is zero, at a random time
+// within the last three years. The resolution is dpi, or 72 if it is zero.
+func newExifBlock(r *utils.Rand, w, h, dpi int, taken time.Time) *exifBlock {
+	be := binary.BigEndian
+	ascii := func(tag uint16, s string) exifTag {
+		return exifTag{tag, exifASCII, uint32(len(s) + 1), append([]byte(s), 0)}
+	}
+	short := func(tag uint16, v uint16) exifTag {
+		return exifTag{tag, exifShort, 1, be.AppendUint16(nil, v)}
+	}
+	long := func(tag uint16, v uint32) exifTag {
+		return exifTag{tag, exifLong, 1, be.AppendUint32(nil, v)}
+	}
+	rational := func(tag uint16, pairs ...uint32) exifTag {
+		var b []byte
+		for _, p := range pairs {
+			b = be.AppendUint32(b, p)
+		}
+		return exifTag{tag, exifRational, uint32(len(pairs) / 2), b}
+	}
+	// dms splits a coordinate into degree, minute and second rationals.
+	dms := func(v float64) []uint32 {
+		v = math.Abs(v)
+		d := math.Floor(v)
+		m := math.Floor((v - d) * 60)
+		s := (v - d - m/60) * 3600
+		return []uint32{uint32(d), 1, uint32(m), 1, uint32(s * 100), 100}
+	}
+
+	if dpi == 0 {
+		dpi = 72
+	}
+	cam := cameras[r.IntN(len(cameras))]
+	if taken.IsZero() {
+		taken = time.Now().Add(-time.Duration(r.Int64N(int64(3 * 365 * 24 * time.Hour))))
+	}
+	taken = taken.UTC()
+	stamp := taken.Format("2006:01:02 15:04:05")
+	lat, lon := r.Float64()*140-70, r.Float64()*360-180
+	latRef, lonRef := "N", "E"
+	if lat < 0 {
+		latRef = "S"
+	}
+	if lon < 0 {
+		lonRef = "W"
+	}
+	exposures := []uint32{30, 60, 125, 250, 500, 1000}
+	apertures := []uint32{18, 28, 40, 56, 80, 110}
+
+	return &exifBlock{
+		ifd0: []exifTag{
+			ascii(0x010F, cam[0]), // Make
+			ascii(0x0110, cam[1]), // Model
+			short(0x0112, 1),      // Orientation
+			rational(0x011A, uint32(dpi), 1),
+			rational(0x011B, uint32(dpi), 1),
+			short(0x0128, 2), // ResolutionUnit: inch
+			ascii(0x0131, "genfile"),
+			ascii(0x0132, stamp),
+			long(0x8769, 0), // ExifIFDPointer, set by segment
+			long(0x8825, 0), // GPSInfoIFDPointer, set by segment
+		},
+		gps: []exifTag{
+			{0x0000, exifByte, 4, []byte{2, 3, 0, 0}}, // GPSVersionID
+			ascii(0x0001, latRef),
+			rational(0x0002, dms(lat)...),
+			ascii(0x0003, lonRef),
+			rational(0x0004, dms(lon)...),
+			{0x0005, exifByte, 1, []byte{0}}, // above sea level
+			rational(0x0006, uint32(r.IntN(3000)), 1),
+			rational(0x0007, uint32(taken.Hour()), 1, uint32(taken.Minute()), 1, uint32(taken.Second()), 1),
+			ascii(0x001D, taken.Format("2006:01:02")),
+		},
+		exif: []exifTag{
+			rational(0x829A, 1, exposures[r.IntN(len(exposures))]),  // ExposureTime
+			rational(0x829D, apertures[r.IntN(len(apertures))], 10), // FNumber
+			short(0x8827, uint16(100<<r.IntN(6))),                   // ISOSpeedRatings
+			{0x9000, exifUndefined, 4, []byte("0232")},              // ExifVersion
+			ascii(0x9003, stamp),                                    // DateTimeOriginal
+			ascii(0x9004, stamp),                                    // DateTimeDigitized
+			rational(0x920A, uint32(24+r.IntN(176)), 1),             // FocalLength
+			{0x9286, exifUndefined, 0, nil},                         // UserComment, set by segment
+			long(0xA002, uint32(w)),                                 // PixelXDimension
+			long(0xA003, uint32(h)),                                 // PixelYDimension
+		},
+	}
+}
+
+// ifdSize returns the bytes an IFD and its out-of-line values occupy.
+// Values are word-aligned except the final one.
+func ifdSize(tags []exifTag) int {
+	n := 2 + 12*len(tags) + 4
+	last := lastOutOfLine(tags)
+	for i, t := range tags {
+		if len(t.data) > 4 {
+			n += len(t.data)
+			if i != last {
+				n += len(t.data) & 1
+			}
+		}
+	}
+	return n
+}
+
+// writeIFD serialises tags as an IFD starting at offset off of the TIFF
+// structure, followed by its out-of-line values.
+func writeIFD(buf *bytes.Buffer, tags []exifTag, off int) {
+	be := binary.BigEndian
+	valueOff := off + 2 + 12*len(tags) + 4
+	var values []byte
+	last := lastOutOfLine(tags)
+	binary.Write(buf, be, uint16(len(tags)))
+	for i, t := range tags {
+		var entry [12]byte
+		be.PutUint16(entry[0:], t.tag)
+		be.PutUint16(entry[2:], t.typ)
+		be.PutUint32(entry[4:], t.count)
+		if len(t.data) <= 4 {
+			copy(entry[8:], t.data)
+		} else {
+			be.PutUint32(entry[8:], uint32(valueOff+len(values)))
+			values = append(values, t.data...)
+			if len(t.data)&1 == 1 && i != last {
+				values = append(values, 0)
+			}
+		}
+		buf.Write(entry[:])
+	}
+	binary.Write(buf, be, uint32(0)) // no next IFD
+	buf.Write(values)
+}
+
+// lastOutOfLine returns the index of the last tag whose value does not fit
+// in its entry, or -1.
+func lastOutOfLine(tags []exifTag) int {
+	last := -1
+	for i, t := range tags {
+		if len(t.data) > 4 {
+			last = i
+		}
+	}
+	return last
+}
+
+// segment returns the complete APP1 marker segment with pad bytes of
+// UserComment text after the character code.
+func (e *exifBlock) segment(pad int) []byte {
+	comment := make([]byte, len(userCommentPrefix)+pad)
+	copy(comment, userCommentPrefix)
+	for i := len(userCommentPrefix); i < len(comment); i++ {
+		comment[i] = ' '
+	}
+	for i := range e.exif {
+		if e.exif[i].tag == 0x9286 {
+			e.exif[i].count, e.exif[i].data = uint32(len(comment)), comment
+		}
+	}
+
+	// Layout: header, IFD0, GPS IFD, Exif IFD (which ends with UserComment).
+	gpsOff := 8 + ifdSize(e.ifd0)
+	exifOff := gpsOff + ifdSize(e.gps)
+	for i := range e.ifd0 {
+		switch e.ifd0[i].tag {
+		case 0x8769:
+			binary.BigEndian.PutUint32(e.ifd0[i].data, uint32(exifOff))
+		case 0x8825:
+			binary.BigEndian.PutUint32(e.ifd0[i].data, uint32(gpsOff))
+		}
+	}
+
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2A")
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	writeIFD(&tiff, e.ifd0, 8)
+	writeIFD(&tiff, e.gps, gpsOff)
+	writeIFD(&tiff, e.exif, exifOff)
+
+	payload := 6 + tiff.Len()
+	out := make([]byte, 0, 4+payload)
+	out = append(out, 0xFF, 0xE1, byte((payload+2)>>8), byte(payload+2))
+	out = append(out, "Exif\x00\x00"...)
+	return append(out, tiff.Bytes()...)
+}
+
+// maxPad returns the most UserComment padding the segment can hold.
+func (e *exifBlock) maxPad() int {
+	return maxAPP1Payload - (len(e.segment(0)) - 4)
+}
+
+// insertAPP1 places an APP1 segment directly after the SOI marker, or the
+// JFIF segment that must follow it, where EXIF and XMP readers expect it.
+// Inserting EXIF last keeps it the first APP1 segment, as the EXIF
+// specification requires.
+func insertAPP1(jpegData, segment []byte) ([]byte, error) {
+	if len(jpegData) < 2 || jpegData[0] != 0xFF || jpegData[1] != 0xD8 {
+		return nil, fmt.Errorf("invalid JPEG: SOI marker not found")
+	}
+	at := 2
+	if len(jpegData) >= 11 && jpegData[2] == 0xFF && jpegData[3] == 0xE0 && string(jpegData[6:11]) == "JFIF\x00" {
+		at += 2 + int(binary.BigEndian.Uint16(jpegData[4:]))
+	}
+	out := make([]byte, 0, len(jpegData)+len(segment))
+	out = append(out, jpegData[:at]...)
+	out = append(out, segment...)
+	return append(out, jpegData[at:]...), nil
+}
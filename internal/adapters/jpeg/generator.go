@@ -1,160 +1,426 @@
 package jpeg
 
 import (
+	"bufio"
 	"bytes"
-	cryptRand "crypto/rand"
 	"fmt"
 	"image"
 	"image/jpeg"
-	"log"
 	"math"
-	"math/rand/v2"
-	"os"
+	"time"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func init() {
 	factory.RegisterGenerator(ports.FileTypeJPEG, New()) //
 }
 
-type JPEGGenerator struct{}
+type JPEGGenerator struct {
+	opts ports.Options // set by Configure
+	meta ports.Metadata
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &JPEGGenerator{}
 }
 
-func (g *JPEGGenerator) Generate(path string, targetSize int64) error {
-	// 1) Estimate pixels for random-noise JPEG. Empirically, noise JPEG ≈ 1.1 bytes/pixel at Q90
-	estBPP := 1.1
-	pixels := float64(targetSize) / estBPP
-	side := int(math.Sqrt(pixels))
-	if side < 1 {
-		side = 1
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *JPEGGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
 	}
-	return generateJPEGWithSide(path, targetSize, side)
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *JPEGGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	// comHeaderLen is the marker and length prefix of a COM segment.
+	comHeaderLen = 4
+	// maxCOMData is the largest payload a COM segment can carry.
+	maxCOMData = 0xFFFD
+	// maxSizeAttempts bounds how often the image is shrunk to fit.
+	maxSizeAttempts = 8
+	// maxPixels bounds the image Generate sizes to the target, some 4.5 MB
+	// of it; a larger target is made up by the COM segments rather than
+	// encoded in memory.
+	maxPixels = 1 << 22
+)
+
+// jpegOptions holds the settings the JPEG generator reads from ports.Options.
+// A zero width or height is derived from the target size.
+type jpegOptions struct {
+	quality       int
+	width, height int
+	progressive   bool
+	exif          bool
+	taken         time.Time // EXIF capture time; zero for a random one
+	dpi           int       // resolution for a JFIF segment and EXIF; zero for none
+	icc           []byte    // ICC profile for APP2 segments; nil for none
+	iccPad        bool      // pad the profile rather than add COM segments
+	rand          *utils.Rand
 }
 
-func generateJPEGWithSide(path string, targetSize int64, side int) error {
-	// Create noisy image
-	img := image.NewRGBA(image.Rect(0, 0, side, side))
-	for i := range img.Pix {
-		img.Pix[i] = byte(rand.IntN(256))
+func parseOptions(opts ports.Options) (jpegOptions, error) {
+	var o jpegOptions
+	var err error
+	if o.quality, err = opts.Int("jpeg-quality", 90); err != nil {
+		return o, err
 	}
-	// Encode to JPEG
-	buf := &bytes.Buffer{}
-	opt := jpeg.Options{Quality: 90}
-	if err := jpeg.Encode(buf, img, &opt); err != nil {
-		log.Printf("JPEG encode error: %v", err)
+	if o.quality < 1 || o.quality > 100 {
+		return o, fmt.Errorf("jpeg-quality must be between 1 and 100, got %d", o.quality)
+	}
+	if o.width, err = opts.Int("width", 0); err != nil {
+		return o, err
+	}
+	if o.height, err = opts.Int("height", 0); err != nil {
+		return o, err
+	}
+	if o.width < 0 || o.height < 0 {
+		return o, fmt.Errorf("image dimensions must be positive, got %dx%d", o.width, o.height)
+	}
+	if o.progressive, err = opts.Bool("jpeg-progressive", false); err != nil {
+		return o, err
+	}
+	if o.exif, err = opts.Bool("jpeg-exif", false); err != nil {
+		return o, err
+	}
+	if o.taken, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.dpi, err = opts.Int("dpi", 0); err != nil {
+		return o, err
+	}
+	if o.dpi < 0 || o.dpi > 0xFFFF {
+		return o, fmt.Errorf("dpi must be between 0 and 65535, got %d", o.dpi)
+	}
+	if opts.Has("icc") {
+		if o.icc, err = utils.ICCProfile(opts.String("icc", "")); err != nil {
+			return o, err
+		}
+		if space := utils.ICCColorSpace(o.icc); space != "RGB" {
+			return o, fmt.Errorf("a %s ICC profile does not suit a colour JPEG; it needs an RGB one", space)
+		}
+	}
+	if o.iccPad, err = opts.Bool("icc-pad", false); err != nil {
+		return o, err
+	}
+	if o.iccPad && o.icc == nil {
+		return o, fmt.Errorf("icc-pad needs an icc profile")
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// WithMetadata returns a copy of the generator that writes m as an XMP
+// packet.
+func (g *JPEGGenerator) WithMetadata(m ports.Metadata) ports.FileGenerator {
+	c := *g
+	c.meta = m
+	return &c
+}
+
+func (g *JPEGGenerator) Generate(path string, targetSize int64) error {
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions writes a noise JPEG of exactly targetSize bytes. opts
+// may set the quality, pin the width and/or height, request progressive
+// encoding and add a camera-style EXIF block, dated by the "mtime" option
+// if set. COM segments before the first scan make up the size; with EXIF
+// enabled its UserComment absorbs the fine remainder. With both dimensions
+// pinned the image is never resized, so a target it cannot be padded to is
+// an error. Metadata set with WithMetadata is written as an XMP packet.
+// "dpi" adds a JFIF segment with the resolution, which EXIF then states
+// too, and "icc" embeds a colour profile in APP2 segments; with "icc-pad"
+// the profile takes the padding in place of the COM segments, up to the
+// 16 MB or so that 255 segments hold.
+func (g *JPEGGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
 		return err
 	}
-	data := buf.Bytes()
-	if int64(len(data)) > targetSize {
-		// Overshot → scale by √(target/actual)
-		factor := math.Sqrt(float64(targetSize) / float64(len(data)))
-		newSide := int(float64(side) * factor)
-		if newSide < 1 {
+
+	if o.width > 0 && o.height > 0 {
+		data, err := g.encode(o.width, o.height, o)
+		if err != nil {
+			return err
+		}
+		out, com, err := padJPEG(data, o, exifFor(o, o.width, o.height), targetSize)
+		if err != nil {
+			return fmt.Errorf("a %dx%d JPEG encodes to %d bytes: %w", o.width, o.height, len(data), err)
+		}
+		return writeJPEG(g.fs, path, out, com, o.rand)
+	}
+
+	// 1) Estimate pixels for random-noise JPEG. Empirically, noise JPEG ≈ 1.1 bytes/pixel at Q90;
+	//    the 4:4:4 progressive encoder keeps full-resolution chroma, roughly doubling that.
+	estBPP := 1.1
+	if o.progressive {
+		estBPP *= 2
+	}
+	pixels := min(float64(targetSize)/estBPP, maxPixels)
+	w, h := dimensionsFor(pixels, o)
+
+	for attempt := 0; ; attempt++ {
+		// Create noisy image
+		data, err := g.encode(w, h, o)
+		if err != nil {
+			return err
+		}
+		out, com, padErr := padJPEG(data, o, exifFor(o, w, h), targetSize)
+		if padErr == nil {
+			return writeJPEG(g.fs, path, out, com, o.rand)
+		}
+		// Overshot (or left too little room to pad) → scale by √(target/actual)
+		factor := math.Sqrt(max(float64(targetSize), 0) / float64(len(data)) * 0.95)
+		if o.width > 0 || o.height > 0 {
+			factor *= factor
+		}
+		newW, newH := w, h
+		if o.width == 0 {
+			newW = min(int(float64(w)*factor), w-1)
+		}
+		if o.height == 0 {
+			newH = min(int(float64(h)*factor), h-1)
+		}
+		if newW < 1 || newH < 1 {
 			return fmt.Errorf("target %d too small for any JPEG", targetSize)
 		}
-		return generateJPEGWithSide(path, targetSize, newSide)
+		if attempt == maxSizeAttempts {
+			return fmt.Errorf("even %dx%d JPEG cannot be fitted to target %d: %w", w, h, targetSize, padErr)
+		}
+		w, h = newW, newH
+	}
+}
+
+// dimensionsFor picks image dimensions covering roughly pixels pixels,
+// keeping whichever of o's dimensions are pinned.
+func dimensionsFor(pixels float64, o jpegOptions) (w, h int) {
+	switch {
+	case o.width > 0:
+		return o.width, max(int(pixels/float64(o.width)), 1)
+	case o.height > 0:
+		return max(int(pixels/float64(o.height)), 1), o.height
+	default:
+		side := max(int(math.Sqrt(pixels)), 1)
+		return side, side
 	}
-	// Pad via COM segments
-	return padJPEGToSize(path, data, targetSize)
 }
 
-func padJPEGToSize(path string, jpegData []byte, targetSize int64) error {
-	currentSize := int64(len(jpegData))
-	needed := targetSize - currentSize
-	if needed < 0 {
-		// Should be caught by generateAndPadJPEG, but defensive check
-		return fmt.Errorf("internal error: data size %d > target %d before padding", currentSize, targetSize)
+// ForResolution returns a generator of a width×height noise image and its
+// size, with an empty EXIF UserComment and no COM segments. The image is
+// encoded once, with the options and metadata the generator was
+// configured with; larger sizes pad it as Generate does.
+func (g *JPEGGenerator) ForResolution(width, height int) (ports.FileGenerator, int64, error) {
+	o, err := parseOptions(g.opts)
+	if err != nil {
+		return nil, 0, err
 	}
-	if needed == 0 {
-		// Already correct size, just write it
-		return os.WriteFile(path, jpegData, 0666)
+	data, err := g.encode(width, height, o)
+	if err != nil {
+		return nil, 0, err
 	}
+	exif := exifFor(o, width, height)
+	size := int64(len(data)) + iccSize(o.icc)
+	if exif != nil {
+		size += int64(len(exif.segment(0)))
+	}
+	return &encodedJPEG{data, width, height, o, exif, g.fs}, size, nil
+}
 
-	// Split at SOS (0xFFDA)
-	idx := bytes.Index(jpegData, []byte{0xFF, 0xDA})
-	if idx < 0 {
-		// If no SOS marker found, we can't reliably inject COM segments before it.
-		// This might happen for extremely small/corrupt initial JPEGs.
-		// Fallback: Write the data as is, size will be less than target.
-		log.Printf("Warning: SOS marker not found in JPEG for padding. Final size may be less than target.")
-		return os.WriteFile(path, jpegData, 0666)
-
-	}
-	pre := jpegData[:idx]
-	post := jpegData[idx:]
-
-	// Build COM segments
-	var segments [][]byte
-	rem := needed // Remaining bytes to pad
-
-	for rem > 0 {
-		// Calculate max data payload for this segment. Need 4 bytes for header (0xFFFE + length).
-		maxDataPayload := rem - 4
-		if maxDataPayload <= 0 {
-			// Cannot fit even the 4-byte header. Break the loop.
-			// This might leave 1, 2, or 3 bytes unpadded.
-			if rem > 0 {
-				log.Printf("Warning: Remaining %d bytes too small for JPEG COM segment header. Final size will be slightly less than target.", rem)
-			}
-			break
-		}
+// encodedJPEG is the generator ForResolution returns: it writes the image
+// it holds, padded to the size asked for.
+type encodedJPEG struct {
+	data          []byte
+	width, height int
+	o             jpegOptions
+	exif          *exifBlock // nil for none
+	fs            ports.OutputFS
+}
 
-		// Determine actual data payload size for this segment
-		chunk := maxDataPayload
-		if chunk > 0xFFFD { // Respect max COM data size (65533)
-			chunk = 0xFFFD
-		}
+func (e *encodedJPEG) Generate(path string, targetSize int64) error {
+	out, com, err := padJPEG(e.data, e.o, e.exif, targetSize)
+	if err != nil {
+		return fmt.Errorf("a %dx%d JPEG encodes to %d bytes: %w", e.width, e.height, len(e.data), err)
+	}
+	return writeJPEG(e.fs, path, out, com, e.o.rand)
+}
 
-		// length field = data payload size + 2 bytes for length field itself
-		length := uint16(chunk + 2)
-		hdr := []byte{0xFF, 0xFE, byte(length >> 8), byte(length & 0xFF)} // 4 bytes: Marker + Length
+// GenerateWithOptions ignores opts, which cannot change an image already
+// encoded.
+func (e *encodedJPEG) GenerateWithOptions(path string, targetSize int64, _ ports.Options) error {
+	return e.Generate(path, targetSize)
+}
+
+// encode encodes a w×h noise image carrying the generator's metadata, and
+// a JFIF segment if o sets the resolution.
+func (g *JPEGGenerator) encode(w, h int, o jpegOptions) ([]byte, error) {
+	data, err := encodeNoise(w, h, o)
+	if err != nil {
+		return nil, err
+	}
+	if o.dpi > 0 {
+		data = append(data[:2:2], append(jfifSegment(o.dpi), data[2:]...)...)
+	}
+	if len(g.meta) == 0 {
+		return data, nil
+	}
+	segment, err := xmpSegment(g.meta)
+	if err != nil {
+		return nil, err
+	}
+	return insertAPP1(data, segment)
+}
+
+// encodeNoise encodes a w×h image of random pixels as o describes.
+func encodeNoise(w, h int, o jpegOptions) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	o.rand.Read(img.Pix)
+	if o.progressive {
+		return encodeProgressive(img, o.quality)
+	}
+	// Encode to JPEG
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: o.quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// exifFor returns the EXIF block of a w×h image if o asks for one, and nil
+// otherwise.
+func exifFor(o jpegOptions, w, h int) *exifBlock {
+	if !o.exif {
+		return nil
+	}
+	return newExifBlock(o.rand, w, h, o.dpi, o.taken)
+}
+
+// padJPEG grows jpegData towards exactly targetSize bytes. With an EXIF
+// block the APP1 block goes first and its UserComment takes as much of
+// the slack as it can hold, unless the ICC profile that follows is to take
+// it. It returns the image and the bytes of COM segments, written before
+// its first SOS by writeJPEG, that carry the rest.
+func padJPEG(jpegData []byte, o jpegOptions, exif *exifBlock, targetSize int64) ([]byte, int64, error) {
+	if targetSize < int64(len(jpegData)) {
+		return nil, 0, fmt.Errorf("image is %d bytes, larger than target %d", len(jpegData), targetSize)
+	}
+	needed := targetSize - int64(len(jpegData))
 
-		// Create random data payload
-		data := make([]byte, int(chunk))
-		_, err := cryptRand.Read(data)
+	if exif != nil {
+		base := int64(len(exif.segment(0)))
+		if needed < base {
+			return nil, 0, fmt.Errorf("no room for a %d-byte EXIF block within target %d", base, targetSize)
+		}
+		extra := needed - base
+		// A padded ICC profile takes the slack instead.
+		var fill int64
+		if !o.iccPad {
+			// Leave room for the ICC profile that follows, and COM segments
+			// either nothing or enough for a header.
+			rest := extra - iccSize(o.icc)
+			fill = min(max(rest, 0), int64(exif.maxPad()))
+			if com := rest - fill; com > 0 && com < comHeaderLen {
+				fill -= comHeaderLen - com
+			}
+		}
+		data, err := insertAPP1(jpegData, exif.segment(int(fill)))
 		if err != nil {
-			return fmt.Errorf("failed to read random bytes for padding: %w", err)
+			return nil, 0, err
 		}
+		jpegData, needed = data, extra-fill
+	}
 
-		// Note: JPEG spec says 0xFF within COM data should be followed by 0x00.
-		// This implementation doesn't currently escape 0xFF bytes in the random data.
-		// While many decoders might ignore this, it's technically non-compliant.
-		// For simplicity in this generator, we omit the escaping for now.
+	if o.icc != nil {
+		segments, err := fitICC(o, needed)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w within target %d", err, targetSize)
+		}
+		data, err := insertAfterAPPn(jpegData, segments)
+		if err != nil {
+			return nil, 0, err
+		}
+		jpegData, needed = data, needed-int64(len(segments))
+	}
 
-		// Append the constructed segment (header + data)
-		segments = append(segments, append(hdr, data...))
+	if needed > 0 && needed < comHeaderLen {
+		return nil, 0, fmt.Errorf("%d bytes short of target %d, too small for a COM segment", needed, targetSize)
+	}
+	return jpegData, needed, nil
+}
 
-		// Decrease remaining bytes needed by the *total size* of the segment added
-		segmentSize := int64(len(hdr) + len(data)) // 4 + chunk
-		rem -= segmentSize
-	} // End padding loop
+// writeJPEG writes jpegData to path on fsys with com bytes of COM
+// segments, of random data from r, before its first SOS. Each segment is
+// made as it is written, so the padding is never held whole.
+func writeJPEG(fsys ports.OutputFS, path string, jpegData []byte, com int64, r *utils.Rand) error {
+	if com == 0 {
+		return outputfs.WriteFile(fsys, path, jpegData)
+	}
+	// Split at SOS (0xFFDA)
+	idx := bytes.Index(jpegData, []byte{0xFF, 0xDA})
+	if idx < 0 {
+		return fmt.Errorf("invalid JPEG: SOS marker not found")
+	}
 
-	// Assemble final file
-	out := &bytes.Buffer{}
-	out.Write(pre)
-	for _, seg := range segments {
-		out.Write(seg)
+	f, err := outputfs.Create(fsys, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	out := bufio.NewWriterSize(f, 1<<16)
+	out.Write(jpegData[:idx])
+	if err := writeCOMSegments(r, out, com); err != nil {
+		return err
+	}
+	out.Write(jpegData[idx:])
+	if err := out.Flush(); err != nil {
+		return err
 	}
-	out.Write(post)
+	return f.Close()
+}
+
+// writeCOMSegments writes COM segments of random data totalling exactly n
+// bytes (n >= comHeaderLen). The segments share n evenly, so each one is
+// well above the header size whenever more than one is needed.
+func writeCOMSegments(r *utils.Rand, out *bufio.Writer, n int64) error {
+	maxSeg := int64(comHeaderLen + maxCOMData)
+	count := (n + maxSeg - 1) / maxSeg
+	data := make([]byte, maxCOMData)
+	for i := int64(0); i < count; i++ {
+		seg := n / count
+		if i < n%count {
+			seg++
+		}
+		chunk := seg - comHeaderLen
 
-	finalBytes := out.Bytes()
-	finalSize := int64(len(finalBytes))
+		// length field = data payload size + 2 bytes for length field itself
+		length := uint16(chunk + 2)
+		out.Write([]byte{0xFF, 0xFE, byte(length >> 8), byte(length & 0xFF)}) // 4 bytes: Marker + Length
 
-	// Final size check and warning (optional but helpful)
-	if finalSize != targetSize {
-		// Only log warning if the difference is small (due to leftover 'rem' < 4)
-		if targetSize-finalSize > 0 && targetSize-finalSize < 4 {
-			log.Printf("Warning: Final JPEG size %d is %d bytes less than target %d due to padding constraints.", finalSize, targetSize-finalSize, targetSize)
-		} else {
-			// Log a more prominent warning for unexpected differences
-			log.Printf("Warning: Final JPEG size %d differs unexpectedly from target %d.", finalSize, targetSize)
+		// Random data payload. COM payloads are length-delimited, so 0xFF
+		// bytes need no escaping.
+		r.Read(data[:chunk])
+		if _, err := out.Write(data[:chunk]); err != nil {
+			return err
 		}
 	}
-
-	return os.WriteFile(path, finalBytes, 0666)
+	return nil
 }
@@ -1,7 +1,11 @@
 package jpeg
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"image"
+	"image/color"
 	"image/jpeg" // Import image/jpeg for decoding check
 	"os"
 	"path/filepath"
@@ -168,3 +172,263 @@ func limitBytes(b []byte, maxLen int) []byte {
 	}
 	return b[:maxLen]
 }
+
+func TestJpegGenerator_GenerateWithOptions(t *testing.T) {
+	generator := &JPEGGenerator{}
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name          string
+		size          int64
+		opts          ports.Options
+		width, height int // expected; 0 means unchecked
+		progressive   bool
+		exif          bool
+		errSubstring  string
+	}{
+		{name: "FixedDimensions", size: 50 * 1024, opts: ports.Options{"width": "100", "height": "80"}, width: 100, height: 80},
+		{name: "LowQuality", size: 30 * 1024, opts: ports.Options{"jpeg-quality": "20"}},
+		{name: "Progressive", size: 80 * 1024, opts: ports.Options{"jpeg-progressive": "true"}, progressive: true},
+		{name: "ProgressiveFixed", size: 64 * 1024, opts: ports.Options{"jpeg-progressive": "true", "width": "37", "height": "21"}, width: 37, height: 21, progressive: true},
+		{name: "ExifSmallSlack", size: 40 * 1024, opts: ports.Options{"jpeg-exif": "true"}, exif: true},
+		{name: "ExifLargePadding", size: 300 * 1024, opts: ports.Options{"jpeg-exif": "true", "width": "64", "height": "64"}, width: 64, height: 64, exif: true},
+		{name: "FixedDimensionsTooLarge", size: 2048, opts: ports.Options{"width": "640", "height": "480"}, errSubstring: "larger than target"},
+		{name: "BadQuality", size: 2048, opts: ports.Options{"jpeg-quality": "101"}, errSubstring: "jpeg-quality"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("opts_%s.jpg", tc.name))
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.errSubstring != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSubstring) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSubstring, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want exactly %d", len(data), tc.size)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			if tc.width != 0 && (img.Bounds().Dx() != tc.width || img.Bounds().Dy() != tc.height) {
+				t.Errorf("dimensions = %v, want %dx%d", img.Bounds().Size(), tc.width, tc.height)
+			}
+			if got := frameMarker(data) == 0xC2; got != tc.progressive {
+				t.Errorf("progressive = %v (SOF marker %#x), want %v", got, frameMarker(data), tc.progressive)
+			}
+			if tc.exif {
+				if !bytes.Equal(data[2:4], []byte{0xFF, 0xE1}) || !bytes.Equal(data[6:12], []byte("Exif\x00\x00")) {
+					t.Errorf("expected EXIF APP1 right after SOI, got % x", data[2:12])
+				}
+			}
+		})
+	}
+}
+
+func TestJpegGenerator_WithMetadata(t *testing.T) {
+	generator := New().(ports.MetadataCapable).WithMetadata(ports.Metadata{
+		ports.MetaTitle:    "Noise & more",
+		ports.MetaKeywords: "test, noise",
+		"2nd":              "x",
+	})
+	outPath := filepath.Join(t.TempDir(), "meta.jpg")
+	const size = 40 * 1024
+	if err := generator.(*JPEGGenerator).GenerateWithOptions(outPath, size, ports.Options{"jpeg-exif": "true"}); err != nil {
+		t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != size {
+		t.Fatalf("size = %d, want exactly %d", len(data), size)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(data[6:12], []byte("Exif\x00\x00")) {
+		t.Errorf("expected EXIF as the first APP1 segment, got % x", data[2:12])
+	}
+	for _, want := range []string{
+		xmpNamespace,
+		`<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Noise &amp; more</rdf:li></rdf:Alt></dc:title>`,
+		`<dc:subject><rdf:Bag><rdf:li>test</rdf:li><rdf:li>noise</rdf:li></rdf:Bag></dc:subject>`,
+		`<genfile:_2nd>x</genfile:_2nd>`,
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("XMP packet lacks %q", want)
+		}
+	}
+}
+
+// TestEncodeProgressiveMatchesSource checks the progressive encoder's
+// output decodes to roughly the image it was given.
+func TestEncodeProgressiveMatchesSource(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 19, 13))
+	for y := 0; y < 13; y++ {
+		for x := 0; x < 19; x++ {
+			src.Set(x, y, color.RGBA{uint8(x * 13), uint8(y * 19), 128, 255})
+		}
+	}
+	data, err := encodeProgressive(src, 95)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	for _, p := range []image.Point{{0, 0}, {9, 6}, {18, 12}} {
+		r1, g1, b1, _ := src.At(p.X, p.Y).RGBA()
+		r2, g2, b2, _ := img.At(p.X, p.Y).RGBA()
+		for _, d := range []int{int(r1>>8) - int(r2>>8), int(g1>>8) - int(g2>>8), int(b1>>8) - int(b2>>8)} {
+			if d < -12 || d > 12 {
+				t.Fatalf("pixel %v: got %d,%d,%d want ~%d,%d,%d", p, r2>>8, g2>>8, b2>>8, r1>>8, g1>>8, b1>>8)
+			}
+		}
+	}
+}
+
+// frameMarker walks the marker segments after SOI and returns the first
+// SOFn marker, or 0.
+func frameMarker(data []byte) byte {
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		m := data[i+1]
+		if m >= 0xC0 && m <= 0xCF && m != 0xC4 && m != 0xC8 && m != 0xCC {
+			return m
+		}
+		i += 2 + int(data[i+2])<<8 + int(data[i+3])
+	}
+	return 0
+}
+
+func TestJpegGenerator_ColorSegments(t *testing.T) {
+	generator := New().(ports.MetadataCapable).WithMetadata(ports.Metadata{ports.MetaTitle: "Print"}).(*JPEGGenerator)
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name         string
+		size         int64
+		opts         ports.Options
+		wantCOM      bool
+		errSubstring string
+	}{
+		{name: "DPI", size: 40 * 1024, opts: ports.Options{"dpi": "300"}, wantCOM: true},
+		{name: "SRGBWithExif", size: 40 * 1024, opts: ports.Options{"icc": "srgb", "dpi": "600", "jpeg-exif": "true"}},
+		{name: "SRGB", size: 40 * 1024, opts: ports.Options{"icc": "srgb"}, wantCOM: true},
+		{name: "Padded", size: 40 * 1024, opts: ports.Options{"icc": "srgb", "icc-pad": "true", "dpi": "150"}},
+		{name: "PaddedAcrossSegments", size: 400 * 1024, opts: ports.Options{"icc": "srgb", "icc-pad": "true", "jpeg-exif": "true", "width": "32", "height": "32"}},
+		{name: "GrayProfile", size: 2048, opts: ports.Options{"icc": "gray"}, errSubstring: "needs an RGB one"},
+		{name: "PadWithoutProfile", size: 2048, opts: ports.Options{"icc-pad": "true"}, errSubstring: "needs an icc profile"},
+		{name: "DPITooHigh", size: 2048, opts: ports.Options{"dpi": "70000"}, errSubstring: "dpi must be between"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, tc.name+".jpg")
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.errSubstring != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSubstring) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSubstring, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			data, _ := os.ReadFile(outPath)
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want exactly %d", len(data), tc.size)
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+
+			// Walk the segments up to the first scan, in order.
+			var markers []byte
+			var profile []byte
+			seq := 0
+			for off := 2; data[off+1] != 0xDA; {
+				marker, n := data[off+1], int(binary.BigEndian.Uint16(data[off+2:]))
+				body := data[off+4 : off+2+n]
+				markers = append(markers, marker)
+				switch {
+				case marker == 0xE0:
+					if dpi := binary.BigEndian.Uint16(body[8:]); fmt.Sprint(dpi) != tc.opts["dpi"] || body[7] != 1 {
+						t.Errorf("JFIF density %d (units %d), want %s DPI", dpi, body[7], tc.opts["dpi"])
+					}
+				case marker == 0xE2 && bytes.HasPrefix(body, []byte(iccMarker)):
+					seq++
+					if int(body[len(iccMarker)]) != seq {
+						t.Errorf("ICC segment %d numbered %d", seq, body[len(iccMarker)])
+					}
+					profile = append(profile, body[len(iccMarker)+2:]...)
+				}
+				off += 2 + n
+			}
+			if tc.opts["dpi"] != "" && markers[0] != 0xE0 {
+				t.Errorf("first segment %#x, want JFIF APP0", markers[0])
+			}
+			if tc.opts["jpeg-exif"] != "" && !bytes.Contains(data, []byte("\x01\x1a\x00\x05\x00\x00\x00\x01")) {
+				t.Errorf("EXIF lacks XResolution")
+			}
+			if tc.opts["icc"] != "" && (len(profile) < 132 || int(binary.BigEndian.Uint32(profile)) != len(profile)) {
+				t.Errorf("APP2 segments hold no valid profile (%d bytes)", len(profile))
+			}
+			if got := bytes.IndexByte(markers, 0xFE) >= 0; got != tc.wantCOM {
+				t.Errorf("COM padding present = %v, want %v (markers % x)", got, tc.wantCOM, markers)
+			}
+		})
+	}
+}
+
+func TestJpegGenerator_ForResolution(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ports.Options
+	}{
+		{"Baseline", nil},
+		{"Progressive", ports.Options{"jpeg-progressive": "true", "jpeg-quality": "60"}},
+		{"EXIFAndICC", ports.Options{"jpeg-exif": "true", "icc": "srgb", "dpi": "300", "mtime": "2020-01-01T00:00:00Z"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			configured, err := New().(*JPEGGenerator).Configure(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, size, err := configured.(*JPEGGenerator).ForResolution(320, 200)
+			if err != nil {
+				t.Fatalf("ForResolution() error = %v", err)
+			}
+			for _, target := range []int64{size, size + 5000} {
+				path := filepath.Join(t.TempDir(), "a.jpg")
+				if err := g.Generate(path, target); err != nil {
+					t.Fatalf("Generate(%d) error = %v", target, err)
+				}
+				if info, _ := os.Stat(path); info.Size() != target {
+					t.Fatalf("size = %d, want %d", info.Size(), target)
+				}
+				data, _ := os.ReadFile(path)
+				cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+				if err != nil || cfg.Width != 320 || cfg.Height != 200 {
+					t.Fatalf("DecodeConfig() = %dx%d, %v; want 320x200", cfg.Width, cfg.Height, err)
+				}
+				checkJpegValidity(t, path)
+			}
+			if err := g.Generate(filepath.Join(t.TempDir(), "a.jpg"), size-1); err == nil {
+				t.Error("Generate() a byte short of the image succeeded")
+			}
+		})
+	}
+}
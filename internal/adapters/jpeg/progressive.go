@@ -0,0 +1,367 @@
+package jpeg
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+)
+
+// image/jpeg only writes baseline files, so progressive output comes from
+// this small encoder. It uses 4:4:4 YCbCr, the Annex K tables and spectral
+// selection only: one interleaved DC scan followed by one AC scan per
+// component. Without successive approximation each AC scan codes its blocks
+// exactly as a baseline scan would.
+
+// unzig maps a zig-zag index to its natural-order position in a block.
+var unzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// baseQuant holds the Annex K luminance and chrominance quantisation tables
+// in natural order.
+var baseQuant = [2][64]int{
+	{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	},
+	{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// huffSpec is a Huffman table as stored in a DHT segment.
+type huffSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+// Annex K.3 tables: luminance DC, luminance AC, chrominance DC, chrominance AC.
+var huffSpecs = [4]huffSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// huffCode is a code word and its length in bits.
+type huffCode struct {
+	code uint32
+	size uint
+}
+
+// buildCodes derives the canonical code for every symbol of s.
+func buildCodes(s huffSpec) [256]huffCode {
+	var codes [256]huffCode
+	code, k := uint32(0), 0
+	for size := uint(1); size <= 16; size++ {
+		for i := 0; i < int(s.counts[size-1]); i++ {
+			codes[s.values[k]] = huffCode{code, size}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+// bitWriter emits entropy-coded data, stuffing a zero after every 0xFF.
+type bitWriter struct {
+	w     *bufio.Writer
+	bits  uint32
+	nBits uint
+}
+
+func (b *bitWriter) emit(bits uint32, n uint) {
+	b.bits = b.bits<<n | bits&(1<<n-1)
+	b.nBits += n
+	for b.nBits >= 8 {
+		c := byte(b.bits >> (b.nBits - 8))
+		b.w.WriteByte(c)
+		if c == 0xFF {
+			b.w.WriteByte(0)
+		}
+		b.nBits -= 8
+	}
+}
+
+// flush pads the final byte with one bits, as scans require.
+func (b *bitWriter) flush() {
+	if b.nBits > 0 {
+		b.emit(0x7F, 8-b.nBits)
+	}
+	b.bits, b.nBits = 0, 0
+}
+
+// emitValue writes v as a Huffman-coded category followed by its magnitude
+// bits, the way both DC differences and AC coefficients are coded.
+func (b *bitWriter) emitValue(codes *[256]huffCode, run int, v int32) {
+	a, bits := v, v
+	if a < 0 {
+		a, bits = -v, v-1
+	}
+	size := uint(0)
+	for a > 0 {
+		size++
+		a >>= 1
+	}
+	c := codes[byte(run<<4)|byte(size)]
+	b.emit(c.code, c.size)
+	if size > 0 {
+		b.emit(uint32(bits), size)
+	}
+}
+
+// quantTables scales the base tables for quality the same way image/jpeg
+// does and returns them in natural order.
+func quantTables(quality int) [2][64]int32 {
+	quality = min(max(quality, 1), 100)
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var q [2][64]int32
+	for t := range q {
+		for i, v := range baseQuant[t] {
+			q[t][i] = int32(min(max((v*scale+50)/100, 1), 255))
+		}
+	}
+	return q
+}
+
+// fdct returns the quantised DCT of a level-shifted 8×8 block in zig-zag
+// order.
+func fdct(block *[64]float64, quant *[64]int32) [64]int32 {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < 8; x++ {
+				s += block[y*8+x] * dctCos[x][u]
+			}
+			tmp[y*8+u] = s
+		}
+	}
+	var out [64]int32
+	for zz, pos := range unzig {
+		u, v := pos%8, pos/8
+		var s float64
+		for y := 0; y < 8; y++ {
+			s += tmp[y*8+u] * dctCos[y][v]
+		}
+		s *= dctScale[u] * dctScale[v] / 4
+		out[zz] = int32(math.Round(s / float64(quant[pos])))
+	}
+	return out
+}
+
+var dctCos, dctScale = func() ([8][8]float64, [8]float64) {
+	var c [8][8]float64
+	var s [8]float64
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			c[x][u] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / 16)
+		}
+	}
+	for u := range s {
+		s[u] = 1
+	}
+	s[0] = 1 / math.Sqrt2
+	return c, s
+}()
+
+// encodeProgressive writes img as a progressive JPEG at quality.
+func encodeProgressive(img image.Image, quality int) ([]byte, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	bw, bh := (w+7)/8, (h+7)/8
+	quant := quantTables(quality)
+
+	// Transform every block of the three components up front; the scans
+	// then walk the coefficients in different orders.
+	coeffs := [3][][64]int32{}
+	for c := range coeffs {
+		coeffs[c] = make([][64]int32, bw*bh)
+	}
+	var blocks [3][64]float64
+	for by := 0; by < bh; by++ {
+		for bx := 0; bx < bw; bx++ {
+			for y := 0; y < 8; y++ {
+				for x := 0; x < 8; x++ {
+					px := bounds.Min.X + min(bx*8+x, w-1)
+					py := bounds.Min.Y + min(by*8+y, h-1)
+					r, g, b, _ := img.At(px, py).RGBA()
+					yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+					blocks[0][y*8+x] = float64(yy) - 128
+					blocks[1][y*8+x] = float64(cb) - 128
+					blocks[2][y*8+x] = float64(cr) - 128
+				}
+			}
+			for c := range blocks {
+				coeffs[c][by*bw+bx] = fdct(&blocks[c], &quant[min(c, 1)])
+			}
+		}
+	}
+
+	var codes [4][256]huffCode
+	for i, s := range huffSpecs {
+		codes[i] = buildCodes(s)
+	}
+
+	var out bytes.Buffer
+	bw2 := bufio.NewWriter(&out)
+	segment := func(marker byte, payload []byte) {
+		bw2.Write([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)})
+		bw2.Write(payload)
+	}
+
+	bw2.Write([]byte{0xFF, 0xD8}) // SOI
+
+	var dqt []byte
+	for t := range quant {
+		dqt = append(dqt, byte(t))
+		for _, pos := range unzig {
+			dqt = append(dqt, byte(quant[t][pos]))
+		}
+	}
+	segment(0xDB, dqt)
+
+	sof := []byte{8, byte(h >> 8), byte(h), byte(w >> 8), byte(w), 3}
+	for c := 0; c < 3; c++ {
+		sof = append(sof, byte(c+1), 0x11, byte(min(c, 1)))
+	}
+	segment(0xC2, sof) // SOF2: progressive DCT
+
+	var dht []byte
+	for i, s := range huffSpecs {
+		class, id := byte(i%2), byte(i/2)
+		dht = append(dht, class<<4|id)
+		dht = append(dht, s.counts[:]...)
+		dht = append(dht, s.values...)
+	}
+	segment(0xC4, dht)
+
+	bits := &bitWriter{w: bw2}
+
+	// DC scan, all components interleaved.
+	segment(0xDA, []byte{3, 1, 0x00, 2, 0x11, 3, 0x11, 0, 0, 0})
+	var pred [3]int32
+	for i := 0; i < bw*bh; i++ {
+		for c := 0; c < 3; c++ {
+			dc := coeffs[c][i][0]
+			bits.emitValue(&codes[2*min(c, 1)], 0, dc-pred[c])
+			pred[c] = dc
+		}
+	}
+	bits.flush()
+
+	// One AC scan per component.
+	for c := 0; c < 3; c++ {
+		table := byte(min(c, 1))
+		segment(0xDA, []byte{1, byte(c + 1), table, 1, 63, 0})
+		ac := &codes[2*min(c, 1)+1]
+		for i := range coeffs[c] {
+			run := 0
+			for k := 1; k < 64; k++ {
+				v := coeffs[c][i][k]
+				if v == 0 {
+					run++
+					continue
+				}
+				for run > 15 {
+					bits.emitValue(ac, 15, 0) // ZRL
+					run -= 16
+				}
+				bits.emitValue(ac, run, v)
+				run = 0
+			}
+			if run > 0 {
+				bits.emitValue(ac, 0, 0) // EOB
+			}
+		}
+		bits.flush()
+	}
+
+	bw2.Write([]byte{0xFF, 0xD9}) // EOI
+	if err := bw2.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,95 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// xmpNamespace identifies an XMP packet in an APP1 segment.
+const xmpNamespace = "http://ns.adobe.com/xap/1.0/\x00"
+
+// xmpCustomNamespace holds metadata keys XMP has no property for.
+const xmpCustomNamespace = "https://github.com/hailam/genfile/ns/1.0/"
+
+// xmpSegment returns an APP1 segment holding m as an XMP packet. Title,
+// author, subject and keywords become Dublin Core properties and creator
+// the xmp:CreatorTool; other keys go in the genfile namespace.
+func xmpSegment(m ports.Metadata) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xmpNamespace)
+	b.WriteString("<?xpacket begin=\"\xEF\xBB\xBF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`)
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:genfile="` + xmpCustomNamespace + `">`)
+	for _, k := range m.Keys() {
+		v := m[k]
+		switch k {
+		case ports.MetaTitle:
+			writeXMPList(&b, "dc:title", "rdf:Alt", []string{v})
+		case ports.MetaAuthor:
+			writeXMPList(&b, "dc:creator", "rdf:Seq", []string{v})
+		case ports.MetaSubject:
+			writeXMPList(&b, "dc:description", "rdf:Alt", []string{v})
+		case ports.MetaKeywords:
+			writeXMPList(&b, "dc:subject", "rdf:Bag", splitKeywords(v))
+		case ports.MetaCreator:
+			writeXMPProperty(&b, "xmp:CreatorTool", v)
+		default:
+			writeXMPProperty(&b, "genfile:"+xmlName(k), v)
+		}
+	}
+	b.WriteString("</rdf:Description></rdf:RDF></x:xmpmeta>\n<?xpacket end=\"w\"?>")
+
+	if b.Len() > maxAPP1Payload {
+		return nil, fmt.Errorf("metadata needs %d bytes, more than an XMP segment holds (%d)", b.Len(), maxAPP1Payload)
+	}
+	out := make([]byte, 0, 4+b.Len())
+	out = append(out, 0xFF, 0xE1, byte((b.Len()+2)>>8), byte(b.Len()+2))
+	return append(out, b.Bytes()...), nil
+}
+
+// writeXMPProperty writes a simple property.
+func writeXMPProperty(b *bytes.Buffer, name, value string) {
+	fmt.Fprintf(b, "<%s>", name)
+	xml.EscapeText(b, []byte(value))
+	fmt.Fprintf(b, "</%s>", name)
+}
+
+// writeXMPList writes an array property of kind rdf:Alt, rdf:Seq or
+// rdf:Bag. Language alternatives get the x-default language.
+func writeXMPList(b *bytes.Buffer, name, kind string, values []string) {
+	fmt.Fprintf(b, "<%s><%s>", name, kind)
+	for _, v := range values {
+		if kind == "rdf:Alt" {
+			b.WriteString(`<rdf:li xml:lang="x-default">`)
+		} else {
+			b.WriteString("<rdf:li>")
+		}
+		xml.EscapeText(b, []byte(v))
+		b.WriteString("</rdf:li>")
+	}
+	fmt.Fprintf(b, "</%s></%s>", kind, name)
+}
+
+// splitKeywords splits a comma-separated keyword list.
+func splitKeywords(s string) []string {
+	var out []string
+	for _, kw := range strings.Split(s, ",") {
+		if kw = strings.TrimSpace(kw); kw != "" {
+			out = append(out, kw)
+		}
+	}
+	return out
+}
+
+// xmlName makes key a valid XML element name: names cannot start with a
+// digit or '-'.
+func xmlName(key string) string {
+	if c := key[0]; c == '-' || c >= '0' && c <= '9' {
+		return "_" + key
+	}
+	return key
+}
@@ -2,12 +2,13 @@ package json
 
 import (
 	"fmt"
-	"math/rand/v2"
-	"os"
 	"strings"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/logging"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func init() {
@@ -22,25 +23,83 @@ const (
 	valLengthMax = 100
 )
 
-type JsonGenerator struct{}
+type JsonGenerator struct {
+	opts ports.Options // set by Configure
+	log  ports.Logger
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &JsonGenerator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *JsonGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	r, err := utils.NewRand(opts.String("seed", ""))
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := textFuncs(r, opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *JsonGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// WithLogger returns a copy of the generator that reports to l.
+func (g *JsonGenerator) WithLogger(l ports.Logger) ports.FileGenerator {
+	c := *g
+	c.log = l
+	return &c
+}
+
+func (g *JsonGenerator) logger() ports.Logger {
+	if g.log == nil {
+		return logging.Nop
+	}
+	return g.log
+}
+
 // Generate creates a JSON file at the specified path with the exact target size.
 // It starts with an empty object {} and adds key-value pairs with random strings
 // until the size is met, precisely padding the final value if needed.
 func (g *JsonGenerator) Generate(path string, targetSize int64) error {
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions is Generate with string values written in the
+// language of the "lang" option, or drawn from the "corpus" files, if set.
+// Keys stay ASCII.
+func (g *JsonGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	r, err := utils.NewRand(opts.String("seed", ""))
+	if err != nil {
+		return err
+	}
+	value, fill, err := textFuncs(r, opts)
+	if err != nil {
+		return err
+	}
+
 	if targetSize < 2 { // Minimum size for "{}"
 		content := ""
 		if targetSize == 1 {
 			content = "{"
 		}
-		return os.WriteFile(path, []byte(content), 0666)
+		return outputfs.WriteFile(g.fs, path, []byte(content))
 	}
 
-	f, err := os.Create(path)
+	f, err := outputfs.Create(g.fs, path)
 	if err != nil {
 		return fmt.Errorf("failed to create file %s: %w", path, err)
 	}
@@ -80,8 +139,9 @@ func (g *JsonGenerator) Generate(path string, targetSize int64) error {
 		}
 
 		// If the largest possible next pair *definitely* overflows, break to final padding
-		// This check helps avoid generating a pair we know won't fit.
-		if bytesWritten+maxPairLen > targetSize-1 {
+		// This check helps avoid generating a pair we know won't fit. It also
+		// leaves room after the pair for the smallest final pair: comma + 5 + keyMin.
+		if bytesWritten+maxPairLen+int64(1+5+keyLengthMin) > targetSize-1 {
 			// It's likely the next pair won't fit, move to final padding phase
 			break
 		}
@@ -93,14 +153,14 @@ func (g *JsonGenerator) Generate(path string, targetSize int64) error {
 			firstKey = false
 		}
 
-		keyLen := rand.IntN(keyLengthMax-keyLengthMin+1) + keyLengthMin
-		key := generateJsonKeySafeString(keyLen)
+		keyLen := r.IntN(keyLengthMax-keyLengthMin+1) + keyLengthMin
+		key := generateJsonKeySafeString(r, keyLen)
 		loopBuilder.WriteString(`"`)
 		loopBuilder.WriteString(key)
 		loopBuilder.WriteString(`":`)
 
-		valLen := rand.IntN(valLengthMax-valLengthMin+1) + valLengthMin
-		val := generateJsonStringSafeString(valLen)
+		valLen := r.IntN(valLengthMax-valLengthMin+1) + valLengthMin
+		val := value(valLen)
 		loopBuilder.WriteString(`"`)
 		loopBuilder.WriteString(val)
 		loopBuilder.WriteString(`"`)
@@ -156,7 +216,7 @@ func (g *JsonGenerator) Generate(path string, targetSize int64) error {
 		maxFinalKeyLen := spaceForFinalPair - int64(commaOverhead+5) // Max length for key to allow empty value ""
 		if maxFinalKeyLen < int64(keyLengthMin) {
 			// Cannot even fit the smallest key + structure, proceed to closing brace
-			fmt.Printf("Warning: Remaining space (%d bytes) too small for final key structure. Final size will be less than target.\n", spaceForFinalPair)
+			g.logger().Warnf("Remaining space (%d bytes) too small for final key structure. Final size will be less than target.", spaceForFinalPair)
 			// If we added a comma to the builder, clear it
 			if commaOverhead > 0 {
 				finalBuilder.Reset()
@@ -168,8 +228,8 @@ func (g *JsonGenerator) Generate(path string, targetSize int64) error {
 				maxFinalKeyLen = int64(keyLengthMax)
 			}
 
-			finalKeyLen := rand.IntN(int(maxFinalKeyLen)-keyLengthMin+1) + keyLengthMin
-			finalKey := generateJsonKeySafeString(finalKeyLen)
+			finalKeyLen := r.IntN(int(maxFinalKeyLen)-keyLengthMin+1) + keyLengthMin
+			finalKey := generateJsonKeySafeString(r, finalKeyLen)
 			finalBuilder.WriteString(`"`)
 			finalBuilder.WriteString(finalKey)
 			finalBuilder.WriteString(`":`)
@@ -183,8 +243,8 @@ func (g *JsonGenerator) Generate(path string, targetSize int64) error {
 
 			finalValue := ""
 			if finalValueBytesNeeded >= 0 {
-				// Generate a value string exactly that long using spaces
-				finalValue = strings.Repeat(" ", int(finalValueBytesNeeded))
+				// Generate a value string exactly that long
+				finalValue = fill(int(finalValueBytesNeeded))
 				finalBuilder.WriteString(`"`)
 				finalBuilder.WriteString(finalValue)
 				finalBuilder.WriteString(`"`)
@@ -198,7 +258,7 @@ func (g *JsonGenerator) Generate(path string, targetSize int64) error {
 
 			} else {
 				// This case should be caught by the maxFinalKeyLen check above, but handle defensively
-				fmt.Printf("Warning: Negative bytes needed for final value (%d). Logic error likely. Final size will be less than target.\n", finalValueBytesNeeded)
+				g.logger().Warnf("Negative bytes needed for final value (%d). Logic error likely. Final size will be less than target.", finalValueBytesNeeded)
 				// If we added content to the builder (comma, key), clear it
 				finalBuilder.Reset()
 			}
@@ -219,37 +279,54 @@ func (g *JsonGenerator) Generate(path string, targetSize int64) error {
 	}
 
 	// --- Final Size Verification  ---
-	info, statErr := os.Stat(path)
+	info, statErr := outputfs.Stat(g.fs, path)
 	if statErr == nil {
 		finalSize := info.Size()
 		if finalSize != targetSize {
-			fmt.Printf("Warning: Final size %d does not match target %d. Difference: %d\n", finalSize, targetSize, targetSize-finalSize)
+			g.logger().Warnf("Final size %d does not match target %d. Difference: %d", finalSize, targetSize, targetSize-finalSize)
 		}
 	} else {
-		fmt.Printf("Warning: Could not stat final file %s: %v\n", path, statErr)
+		g.logger().Warnf("Could not stat final file %s: %v", path, statErr)
 	}
 
 	return f.Sync()
 }
 
+// textFuncs returns the functions that make string values: value returns
+// one of n bytes, and fill pads the final one. They write characters drawn
+// from r, or text in the language of the "lang" option or from the
+// "corpus" files.
+func textFuncs(r *utils.Rand, opts ports.Options) (value, fill func(n int) string, err error) {
+	if opts.Has("lang") || opts.Has("corpus") {
+		lang, err := utils.TextLanguage(opts.String("lang", ""), opts.String("corpus", ""))
+		if err != nil {
+			return nil, nil, err
+		}
+		text := func(n int) string { return lang.Text(r, n) }
+		return text, text, nil
+	}
+	value = func(n int) string { return generateJsonStringSafeString(r, n) }
+	return value, func(n int) string { return strings.Repeat(" ", n) }, nil
+}
+
 // generateJsonKeySafeString generates a random alphanumeric string suitable for a JSON key.
-func generateJsonKeySafeString(n int) string {
+func generateJsonKeySafeString(r *utils.Rand, n int) string {
 	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_"
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = letters[rand.IntN(len(letters))]
+		b[i] = letters[r.IntN(len(letters))]
 	}
 	return string(b)
 }
 
 // generateJsonStringSafeString generates a random string, escaping necessary characters for JSON.
-func generateJsonStringSafeString(n int) string {
+func generateJsonStringSafeString(r *utils.Rand, n int) string {
 	const letters = `abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 !#$%&'()*+,-./:;<=>?@[\]^_{|}~`
 	var builder strings.Builder
 	builder.Grow(n + n/10) // Preallocate slightly more for potential escapes
 
 	for i := 0; i < n; i++ {
-		char := letters[rand.IntN(len(letters))]
+		char := letters[r.IntN(len(letters))]
 		switch char {
 		case '"':
 			builder.WriteString(`\"`)
@@ -212,3 +212,28 @@ func limitString(s string, maxLen int) string {
 	}
 	return s[:maxLen] + "..."
 }
+
+func TestJsonGenerator_GenerateWithOptions(t *testing.T) {
+	generator := &JsonGenerator{}
+	tempDir := t.TempDir()
+
+	for _, lang := range []string{"ar", "zh", "ru", "emoji", "mixed"} {
+		for _, size := range []int64{64, 1000, 100000} {
+			t.Run(fmt.Sprintf("%s_%d", lang, size), func(t *testing.T) {
+				path := filepath.Join(tempDir, fmt.Sprintf("%s_%d.json", lang, size))
+				if err := generator.GenerateWithOptions(path, size, ports.Options{"lang": lang}); err != nil {
+					t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+				}
+				checkFileSize(t, path, size)
+				checkJsonValidity(t, path, true)
+			})
+		}
+	}
+
+	t.Run("UnknownLang", func(t *testing.T) {
+		err := generator.GenerateWithOptions(filepath.Join(tempDir, "bad.json"), 100, ports.Options{"lang": "xx"})
+		if err == nil || !strings.Contains(err.Error(), "unknown lang") {
+			t.Errorf("expected unknown lang error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+// Package logging provides ports.Logger implementations.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// levelPrefixes label each message level in the output.
+var levelPrefixes = map[ports.LogLevel]string{
+	ports.LevelDebug: "Debug",
+	ports.LevelInfo:  "Info",
+	ports.LevelWarn:  "Warning",
+}
+
+// WriterLogger writes messages at or above a minimum level to an io.Writer,
+// one line each, prefixed with their level.
+type WriterLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min ports.LogLevel
+}
+
+// New returns a logger writing messages of level min and above to w.
+func New(w io.Writer, min ports.LogLevel) *WriterLogger {
+	return &WriterLogger{w: w, min: min}
+}
+
+// SetLevel changes the minimum level written.
+func (l *WriterLogger) SetLevel(min ports.LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.min = min
+}
+
+func (l *WriterLogger) Debugf(format string, args ...any) { l.logf(ports.LevelDebug, format, args...) }
+func (l *WriterLogger) Infof(format string, args ...any)  { l.logf(ports.LevelInfo, format, args...) }
+func (l *WriterLogger) Warnf(format string, args ...any)  { l.logf(ports.LevelWarn, format, args...) }
+
+func (l *WriterLogger) logf(level ports.LogLevel, format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level < l.min {
+		return
+	}
+	fmt.Fprintf(l.w, "%s: %s\n", levelPrefixes[level], fmt.Sprintf(format, args...))
+}
+
+// Nop discards every message. Generators log to it until given a logger.
+var Nop ports.Logger = nop{}
+
+type nop struct{}
+
+func (nop) Debugf(string, ...any) {}
+func (nop) Infof(string, ...any)  {}
+func (nop) Warnf(string, ...any)  {}
+
+// Recorder keeps the warnings it receives and passes every message on to
+// another logger.
+type Recorder struct {
+	ports.Logger
+	mu       sync.Mutex
+	warnings []string
+}
+
+// NewRecorder returns a Recorder forwarding to next.
+func NewRecorder(next ports.Logger) *Recorder {
+	return &Recorder{Logger: next}
+}
+
+func (r *Recorder) Warnf(format string, args ...any) {
+	r.mu.Lock()
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+	r.mu.Unlock()
+	r.Logger.Warnf(format, args...)
+}
+
+// Warnings returns the warnings recorded so far.
+func (r *Recorder) Warnings() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.warnings...)
+}
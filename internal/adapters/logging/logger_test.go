@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestWriterLogger(t *testing.T) {
+	tests := []struct {
+		name string
+		min  ports.LogLevel
+		want string
+	}{
+		{"debug", ports.LevelDebug, "Debug: d 1\nInfo: i 2\nWarning: w 3\n"},
+		{"info", ports.LevelInfo, "Info: i 2\nWarning: w 3\n"},
+		{"warn", ports.LevelWarn, "Warning: w 3\n"},
+		{"silent", ports.LevelSilent, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := New(&buf, tc.min)
+			l.Debugf("d %d", 1)
+			l.Infof("i %d", 2)
+			l.Warnf("w %d", 3)
+			if got := buf.String(); got != tc.want {
+				t.Errorf("output = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	next := New(&buf, ports.LevelWarn)
+	r := NewRecorder(next)
+	r.Debugf("not recorded")
+	r.Warnf("size %d does not match %d", 10, 12)
+	next.SetLevel(ports.LevelSilent)
+	r.Warnf("recorded while silent")
+
+	want := []string{"size 10 does not match 12", "recorded while silent"}
+	got := r.Warnings()
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Warnings() = %q, want %q", got, want)
+	}
+	if out := buf.String(); out != "Warning: size 10 does not match 12\n" {
+		t.Errorf("forwarded output = %q", out)
+	}
+}
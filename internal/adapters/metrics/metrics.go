@@ -0,0 +1,329 @@
+// Package metrics records Prometheus metrics about file generation by
+// decorating generators.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// Metrics holds the collectors instrumented generators update, each
+// labelled with the file type.
+type Metrics struct {
+	files    *prometheus.CounterVec
+	bytes    *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// New creates the genfile metrics and registers them with reg.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		files: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "genfile_files_generated_total",
+			Help: "Files generated successfully.",
+		}, []string{"type"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "genfile_bytes_written_total",
+			Help: "Bytes of the files generated successfully.",
+		}, []string{"type"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "genfile_generation_errors_total",
+			Help: "Generations that failed.",
+		}, []string{"type"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "genfile_generation_duration_seconds",
+			Help:    "Time taken to generate a file, successfully or not.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10), // 1ms to about 4min
+		}, []string{"type"}),
+	}
+	for _, c := range []prometheus.Collector{m.files, m.bytes, m.errors, m.duration} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("failed to register metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// observe records a generation of type t that started at start, wrote
+// size bytes and returned err.
+func (m *Metrics) observe(t ports.FileType, start time.Time, size int64, err error) {
+	label := string(t)
+	m.duration.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(label).Inc()
+		return
+	}
+	m.files.WithLabelValues(label).Inc()
+	m.bytes.WithLabelValues(label).Add(float64(size))
+}
+
+// Instrument returns g decorated to record every file it generates in m
+// as of type t. The decorator is a ports.Decorator: it implements every
+// optional port, and ports.As reports those g supports.
+func (m *Metrics) Instrument(t ports.FileType, g ports.FileGenerator) ports.FileGenerator {
+	return &generator{inner: g, fileType: t, m: m}
+}
+
+// generator is the decorator Instrument returns.
+type generator struct {
+	inner    ports.FileGenerator
+	fileType ports.FileType
+	m        *Metrics
+}
+
+func (g *generator) Unwrap() ports.FileGenerator { return g.inner }
+
+// wrap decorates a generator derived from the inner one, such as a
+// configured copy.
+func (g *generator) wrap(inner ports.FileGenerator) ports.FileGenerator {
+	return g.m.Instrument(g.fileType, inner)
+}
+
+// record runs generate, which writes outPath, and records it.
+func (g *generator) record(outPath string, generate func() error) error {
+	_, err := g.recordSet(func() ([]string, error) { return []string{outPath}, generate() })
+	return err
+}
+
+// recordSet runs generate and records it with the size of the files it
+// reports writing.
+func (g *generator) recordSet(generate func() ([]string, error)) ([]string, error) {
+	start := time.Now()
+	paths, err := generate()
+	g.m.observe(g.fileType, start, sizeOf(paths...), err)
+	return paths, err
+}
+
+// derive returns the generator with derives from the inner one, if that
+// supports the port T, decorated in turn; g itself otherwise, as the port
+// has nothing to apply to.
+func derive[T ports.FileGenerator](g *generator, with func(T) ports.FileGenerator) ports.FileGenerator {
+	if p, ok := ports.As[T](g.inner); ok {
+		return g.wrap(with(p))
+	}
+	return g
+}
+
+// sized returns the generator, and its size, that size derives from the
+// inner one if that supports the port T, decorated in turn. A generator
+// without the port cannot be sized by what.
+func sized[T ports.FileGenerator](g *generator, what string, size func(T) (ports.FileGenerator, int64, error)) (ports.FileGenerator, int64, error) {
+	p, ok := ports.As[T](g.inner)
+	if !ok {
+		return nil, 0, fmt.Errorf("generator for type '%s' cannot be sized by %s", g.fileType, what)
+	}
+	inner, n, err := size(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	return g.wrap(inner), n, nil
+}
+
+func (g *generator) Generate(outPath string, sizeBytes int64) error {
+	return g.record(outPath, func() error { return g.inner.Generate(outPath, sizeBytes) })
+}
+
+func (g *generator) GenerateWithOptions(outPath string, sizeBytes int64, opts ports.Options) error {
+	og, ok := ports.As[ports.OptionsGenerator](g.inner)
+	if !ok {
+		return fmt.Errorf("generator for type '%s' does not accept options", g.fileType)
+	}
+	return g.record(outPath, func() error { return og.GenerateWithOptions(outPath, sizeBytes, opts) })
+}
+
+func (g *generator) GenerateLines(outPath string, sizeBytes, lines int64, opts ports.Options) error {
+	lg, ok := ports.As[ports.LineGenerator](g.inner)
+	if !ok {
+		return fmt.Errorf("generator for type '%s' does not support line counts", g.fileType)
+	}
+	return g.record(outPath, func() error { return lg.GenerateLines(outPath, sizeBytes, lines, opts) })
+}
+
+func (g *generator) GenerateAllocated(outPath string, sizeBytes int64, mode ports.Allocation, opts ports.Options) error {
+	ag, ok := ports.As[ports.AllocatingGenerator](g.inner)
+	if !ok {
+		return fmt.Errorf("generator for type '%s' does not support %s files", g.fileType, mode)
+	}
+	return g.record(outPath, func() error { return ag.GenerateAllocated(outPath, sizeBytes, mode, opts) })
+}
+
+func (g *generator) GenerateTo(w io.Writer, sizeBytes int64, opts ports.Options) error {
+	sg, ok := ports.As[ports.StreamGenerator](g.inner)
+	if !ok {
+		return fmt.Errorf("generator for type '%s' cannot stream", g.fileType)
+	}
+	cw := &countingWriter{w: w}
+	start := time.Now()
+	err := sg.GenerateTo(cw, sizeBytes, opts)
+	g.m.observe(g.fileType, start, cw.n, err)
+	return err
+}
+
+func (g *generator) GenerateSet(basePath string, sizeBytes int64) ([]string, error) {
+	sg, ok := ports.As[ports.SetGenerator](g.inner)
+	if !ok {
+		return nil, fmt.Errorf("generator for type '%s' does not generate file sets", g.fileType)
+	}
+	return g.recordSet(func() ([]string, error) { return sg.GenerateSet(basePath, sizeBytes) })
+}
+
+func (g *generator) SizesWholeSet() bool {
+	ws, ok := ports.As[ports.WholeSetGenerator](g.inner)
+	return ok && ws.SizesWholeSet()
+}
+
+func (g *generator) GenerateSetWithOptions(basePath string, sizeBytes int64, opts ports.Options) ([]string, error) {
+	sg, ok := ports.As[ports.SetOptionsGenerator](g.inner)
+	if !ok {
+		return nil, fmt.Errorf("generator for type '%s' does not accept options", g.fileType)
+	}
+	return g.recordSet(func() ([]string, error) { return sg.GenerateSetWithOptions(basePath, sizeBytes, opts) })
+}
+
+func (g *generator) GenerateFrom(path string, size int64, opts ports.Options, from ports.ResumeState, checkpoint func(ports.ResumeState) error) error {
+	rg, ok := ports.As[ports.ResumableGenerator](g.inner)
+	if !ok {
+		return fmt.Errorf("generator for type '%s' cannot resume", g.fileType)
+	}
+	return g.record(path, func() error { return rg.GenerateFrom(path, size, opts, from, checkpoint) })
+}
+
+func (g *generator) Resize(srcPath, outPath string, sizeBytes int64) error {
+	r, ok := ports.As[ports.Resizer](g.inner)
+	if !ok {
+		return fmt.Errorf("generator for type '%s' cannot resize files", g.fileType)
+	}
+	return g.record(outPath, func() error { return r.Resize(srcPath, outPath, sizeBytes) })
+}
+
+func (g *generator) ForDuration(d time.Duration) (ports.FileGenerator, int64, error) {
+	return sized(g, "duration", func(dg ports.DurationGenerator) (ports.FileGenerator, int64, error) {
+		return dg.ForDuration(d)
+	})
+}
+
+func (g *generator) ForCount(c ports.Count) (ports.FileGenerator, int64, error) {
+	return sized(g, string(c.Unit), func(cg ports.CountGenerator) (ports.FileGenerator, int64, error) {
+		return cg.ForCount(c)
+	})
+}
+
+func (g *generator) ForResolution(width, height int) (ports.FileGenerator, int64, error) {
+	return sized(g, "resolution", func(rg ports.ResolutionGenerator) (ports.FileGenerator, int64, error) {
+		return rg.ForResolution(width, height)
+	})
+}
+
+func (g *generator) FreeTail(size int64, opts ports.Options) (int64, []byte) {
+	ft, ok := ports.As[ports.FreeTailGenerator](g.inner)
+	if !ok {
+		return 0, nil
+	}
+	return ft.FreeTail(size, opts)
+}
+
+func (g *generator) Plan(sizeBytes int64) (ports.GenerationPlan, error) {
+	p, ok := ports.As[ports.Planner](g.inner)
+	if !ok {
+		return ports.GenerationPlan{}, fmt.Errorf("generator for type '%s' cannot estimate its output", g.fileType)
+	}
+	return p.Plan(sizeBytes)
+}
+
+func (g *generator) SizeStep() int64 {
+	if ss, ok := ports.As[ports.SizeStepper](g.inner); ok {
+		return ss.SizeStep()
+	}
+	return 1
+}
+
+func (g *generator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	cg, ok := ports.As[ports.ConfigurableGenerator](g.inner)
+	if !ok {
+		return nil, fmt.Errorf("generator for type '%s' does not accept options", g.fileType)
+	}
+	configured, err := cg.Configure(opts)
+	if err != nil {
+		return nil, err
+	}
+	return g.wrap(configured), nil
+}
+
+func (g *generator) WithMetadata(meta ports.Metadata) ports.FileGenerator {
+	return derive(g, func(mc ports.MetadataCapable) ports.FileGenerator { return mc.WithMetadata(meta) })
+}
+
+func (g *generator) WithStats(s ports.Stats) ports.FileGenerator {
+	return derive(g, func(sg ports.StatsGenerator) ports.FileGenerator { return sg.WithStats(s) })
+}
+
+func (g *generator) WithLogger(l ports.Logger) ports.FileGenerator {
+	return derive(g, func(lg ports.LoggingGenerator) ports.FileGenerator { return lg.WithLogger(l) })
+}
+
+func (g *generator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	return derive(g, func(og ports.OutputFSGenerator) ports.FileGenerator { return og.WithOutputFS(fsys) })
+}
+
+func (g *generator) WithFactory(f ports.GeneratorFactory) ports.FileGenerator {
+	return derive(g, func(ng ports.NestingGenerator) ports.FileGenerator { return ng.WithFactory(f) })
+}
+
+// sizeOf returns the total size of the files at paths, skipping any that
+// cannot be read.
+func sizeOf(paths ...string) int64 {
+	var n int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			n += info.Size()
+		}
+	}
+	return n
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// factory decorates the generators of another factory.
+type factory struct {
+	inner ports.GeneratorFactory
+	m     *Metrics
+}
+
+// NewFactory returns a factory handing out the generators of inner
+// instrumented with m.
+func NewFactory(inner ports.GeneratorFactory, m *Metrics) ports.GeneratorFactory {
+	return &factory{inner: inner, m: m}
+}
+
+func (f *factory) For(t ports.FileType) (ports.FileGenerator, error) {
+	g, err := f.inner.For(t)
+	if err != nil {
+		return nil, err
+	}
+	return f.m.Instrument(t, g), nil
+}
+
+func (f *factory) ForOptions(t ports.FileType, opts ports.Options) (ports.FileGenerator, error) {
+	g, err := f.inner.ForOptions(t, opts)
+	if err != nil {
+		return nil, err
+	}
+	return f.m.Instrument(t, g), nil
+}
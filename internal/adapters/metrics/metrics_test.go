@@ -0,0 +1,270 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// streamGenerator writes sizeBytes zeros, to a file or a writer.
+type streamGenerator struct{}
+
+func (streamGenerator) Generate(outPath string, sizeBytes int64) error {
+	if sizeBytes < 0 {
+		return errors.New("negative size")
+	}
+	return os.WriteFile(outPath, make([]byte, sizeBytes), 0o644)
+}
+
+func (streamGenerator) GenerateTo(w io.Writer, sizeBytes int64, opts ports.Options) error {
+	_, err := w.Write(make([]byte, sizeBytes))
+	return err
+}
+
+// plainGenerator supports no optional port.
+type plainGenerator struct{}
+
+func (plainGenerator) Generate(string, int64) error { return nil }
+
+// setGenerator writes a set whose size applies to all its files.
+type setGenerator struct{ plainGenerator }
+
+func (setGenerator) GenerateSet(basePath string, sizeBytes int64) ([]string, error) {
+	return []string{basePath}, os.WriteFile(basePath, make([]byte, sizeBytes), 0o644)
+}
+
+func (setGenerator) SizesWholeSet() bool { return true }
+
+// sizedGenerator is a stream generator sized by other means than bytes,
+// always writing sizedSize bytes.
+type sizedGenerator struct{ streamGenerator }
+
+const sizedSize = 1000
+
+func (g sizedGenerator) ForDuration(time.Duration) (ports.FileGenerator, int64, error) {
+	return g, sizedSize, nil
+}
+
+func (g sizedGenerator) ForCount(ports.Count) (ports.FileGenerator, int64, error) {
+	return g, sizedSize, nil
+}
+
+func (g sizedGenerator) ForResolution(int, int) (ports.FileGenerator, int64, error) {
+	return g, sizedSize, nil
+}
+
+func (sizedGenerator) FreeTail(size int64, opts ports.Options) (int64, []byte) {
+	return size, []byte("01")
+}
+
+func (g sizedGenerator) GenerateFrom(path string, size int64, opts ports.Options, from ports.ResumeState, checkpoint func(ports.ResumeState) error) error {
+	return g.Generate(path, size)
+}
+
+func (sizedGenerator) SizeStep() int64 { return 2 }
+
+func TestInstrument(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	g := m.Instrument(ports.FileTypeTXT, streamGenerator{})
+	dir := t.TempDir()
+
+	if err := g.Generate(filepath.Join(dir, "a.txt"), 1000); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	sg, ok := ports.As[ports.StreamGenerator](g)
+	if !ok {
+		t.Fatal("instrumented stream generator does not stream")
+	}
+	var buf bytes.Buffer
+	if err := sg.GenerateTo(&buf, 500, nil); err != nil {
+		t.Fatalf("GenerateTo() error = %v", err)
+	}
+	if err := g.Generate(filepath.Join(dir, "b.txt"), -1); err == nil {
+		t.Fatal("Generate() with a negative size: expected an error")
+	}
+
+	want := `
+# HELP genfile_bytes_written_total Bytes of the files generated successfully.
+# TYPE genfile_bytes_written_total counter
+genfile_bytes_written_total{type="txt"} 1500
+# HELP genfile_files_generated_total Files generated successfully.
+# TYPE genfile_files_generated_total counter
+genfile_files_generated_total{type="txt"} 2
+# HELP genfile_generation_errors_total Generations that failed.
+# TYPE genfile_generation_errors_total counter
+genfile_generation_errors_total{type="txt"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want),
+		"genfile_bytes_written_total", "genfile_files_generated_total", "genfile_generation_errors_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(m.duration, "genfile_generation_duration_seconds"); n != 1 {
+		t.Errorf("duration series = %d, want 1", n)
+	}
+}
+
+func TestInstrument_Capabilities(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		g    ports.FileGenerator
+	}{
+		{"Stream generator", streamGenerator{}},
+		{"Plain generator", plainGenerator{}},
+		{"Set generator", setGenerator{}},
+		{"Sized generator", sizedGenerator{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Decorating, even twice, keeps the capabilities of the generator.
+			g := m.Instrument(ports.FileTypeTXT, m.Instrument(ports.FileTypeTXT, tc.g))
+			if got, want := ports.CapabilitiesOf(g), ports.CapabilitiesOf(tc.g); got != want {
+				t.Errorf("CapabilitiesOf(instrumented) = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// optionalPorts are the optional ports of package ports, which the
+// decorator must implement and forward.
+var optionalPorts = map[string]reflect.Type{
+	"OptionsGenerator":      reflect.TypeFor[ports.OptionsGenerator](),
+	"ConfigurableGenerator": reflect.TypeFor[ports.ConfigurableGenerator](),
+	"DurationGenerator":     reflect.TypeFor[ports.DurationGenerator](),
+	"LineGenerator":         reflect.TypeFor[ports.LineGenerator](),
+	"StreamGenerator":       reflect.TypeFor[ports.StreamGenerator](),
+	"AllocatingGenerator":   reflect.TypeFor[ports.AllocatingGenerator](),
+	"SetGenerator":          reflect.TypeFor[ports.SetGenerator](),
+	"WholeSetGenerator":     reflect.TypeFor[ports.WholeSetGenerator](),
+	"SetOptionsGenerator":   reflect.TypeFor[ports.SetOptionsGenerator](),
+	"Resizer":               reflect.TypeFor[ports.Resizer](),
+	"Planner":               reflect.TypeFor[ports.Planner](),
+	"MetadataCapable":       reflect.TypeFor[ports.MetadataCapable](),
+	"StatsGenerator":        reflect.TypeFor[ports.StatsGenerator](),
+	"LoggingGenerator":      reflect.TypeFor[ports.LoggingGenerator](),
+	"OutputFSGenerator":     reflect.TypeFor[ports.OutputFSGenerator](),
+	"NestingGenerator":      reflect.TypeFor[ports.NestingGenerator](),
+	"SizeStepper":           reflect.TypeFor[ports.SizeStepper](),
+	"ResumableGenerator":    reflect.TypeFor[ports.ResumableGenerator](),
+	"FreeTailGenerator":     reflect.TypeFor[ports.FreeTailGenerator](),
+	"ResolutionGenerator":   reflect.TypeFor[ports.ResolutionGenerator](),
+	"CountGenerator":        reflect.TypeFor[ports.CountGenerator](),
+}
+
+// TestOptionalPorts checks that optionalPorts lists every interface of
+// package ports that extends FileGenerator, so that a new port cannot be
+// left out of the decorator.
+func TestOptionalPorts(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, filepath.Join("..", "..", "ports"), func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embeds := map[string][]string{}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				spec, ok := n.(*ast.TypeSpec)
+				if !ok {
+					return true
+				}
+				if it, ok := spec.Type.(*ast.InterfaceType); ok {
+					for _, m := range it.Methods.List {
+						if id, ok := m.Type.(*ast.Ident); ok && len(m.Names) == 0 {
+							embeds[spec.Name.Name] = append(embeds[spec.Name.Name], id.Name)
+						}
+					}
+				}
+				return false
+			})
+		}
+	}
+	var extends func(name string) bool
+	extends = func(name string) bool {
+		for _, e := range embeds[name] {
+			if e == "FileGenerator" || extends(e) {
+				return true
+			}
+		}
+		return false
+	}
+	for name := range embeds {
+		if _, ok := optionalPorts[name]; !ok && name != "Decorator" && extends(name) {
+			t.Errorf("optionalPorts is missing ports.%s", name)
+		}
+	}
+}
+
+func TestInstrument_Ports(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	g := m.Instrument(ports.FileTypeTXT, plainGenerator{})
+	for name, port := range optionalPorts {
+		if !reflect.TypeOf(g).Implements(port) {
+			t.Errorf("the decorator does not implement %s", name)
+		}
+	}
+
+	ws, ok := ports.As[ports.WholeSetGenerator](m.Instrument(ports.FileTypeTXT, setGenerator{}))
+	if !ok || !ws.SizesWholeSet() {
+		t.Errorf("SizesWholeSet() of an instrumented whole-set generator = %v, %v; want true", ok, ok && ws.SizesWholeSet())
+	}
+
+	// Generators derived from a sized one are instrumented too.
+	sized := m.Instrument(ports.FileTypeTXT, sizedGenerator{})
+	derived := map[string]func() (ports.FileGenerator, int64, error){
+		"ForDuration": func() (ports.FileGenerator, int64, error) {
+			return sized.(ports.DurationGenerator).ForDuration(time.Second)
+		},
+		"ForCount": func() (ports.FileGenerator, int64, error) {
+			return sized.(ports.CountGenerator).ForCount(ports.Count{Unit: ports.CountPages, N: 2})
+		},
+		"ForResolution": func() (ports.FileGenerator, int64, error) {
+			return sized.(ports.ResolutionGenerator).ForResolution(4, 3)
+		},
+	}
+	for name, derive := range derived {
+		d, size, err := derive()
+		if _, ok := d.(ports.Decorator); err != nil || !ok || size != sizedSize {
+			t.Errorf("%s() = %T, %d, %v; want an instrumented generator of %d bytes", name, d, size, err, sizedSize)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "a.bin")
+	if err := sized.(ports.ResumableGenerator).GenerateFrom(path, 10, nil, ports.ResumeState{}, nil); err != nil {
+		t.Errorf("GenerateFrom() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 10 {
+		t.Errorf("GenerateFrom() wrote %v, %v; want 10 bytes", info, err)
+	}
+	if step := sized.(ports.SizeStepper).SizeStep(); step != 2 {
+		t.Errorf("SizeStep() = %d, want 2", step)
+	}
+	if n, alphabet := sized.(ports.FreeTailGenerator).FreeTail(10, nil); n != 10 || string(alphabet) != "01" {
+		t.Errorf("FreeTail() = %d, %q; want 10, \"01\"", n, alphabet)
+	}
+}
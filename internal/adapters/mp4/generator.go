@@ -2,155 +2,539 @@ package mp4
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"fmt"
-	"os"
+	"math"
+	"strings"
+	"time"
 
+	"github.com/Eyevinn/mp4ff/aac"
 	"github.com/Eyevinn/mp4ff/mp4"
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func init() {
 	factory.RegisterGenerator(ports.FileTypeM4V, New()) //
 	factory.RegisterGenerator(ports.FileTypeMP4, New()) //
+	for _, t := range []ports.FileType{ports.FileTypeM3U8, ports.FileTypeMPD} {
+		factory.RegisterGenerator(t, &SegmentedGenerator{fileType: t})
+	}
 }
 
-type Mp4Generator struct{}
+type Mp4Generator struct {
+	opts ports.Options // set by Configure
+	meta ports.Metadata
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
-// NAL units from “World’s Smallest H.264 Encoder”
-var sps = []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0x00, 0x0a, 0xf8, 0x41, 0xa2}
-var pps = []byte{0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x38, 0x80}
-var sliceHeader = []byte{0x00, 0x00, 0x00, 0x01, 0x05, 0x88, 0x84, 0x21, 0xa0}
+// NAL units from “World’s Smallest H.264 Encoder”. The SPS is built per
+// resolution by buildSPS.
+var pps = []byte{0x68, 0xce, 0x38, 0x80}
+var sliceHeader = []byte{0x05, 0x88, 0x84, 0x21, 0xa0}
 var macroblockHeader = []byte{0x0d, 0x00}
 
-// SQCIF: 128×96 → 8×6 macroblocks
+// silentAACFrame is a mono AAC-LC raw data block whose single channel
+// element has no scale factor bands, i.e. 1024 samples of silence.
+var silentAACFrame = []byte{0x01, 0x40, 0x20, 0x07}
+
 const (
-	widthMB  = 128 / 16
-	heightMB = 96 / 16
+	// movieTimescale is the mvhd/tkhd time unit: milliseconds.
+	movieTimescale = 1000
+	// audioSampleRate is the sample rate of the silent AAC track.
+	audioSampleRate = 48000
+	// aacFrameSamples is the number of samples one AAC frame decodes to.
+	aacFrameSamples = 1024
+	// nalLengthSize is the length prefix of each NAL unit in a sample.
+	nalLengthSize = 4
+	// maxPlanAttempts bounds how often the layout is recomputed when the
+	// moov box size shifts with the sample counts.
+	maxPlanAttempts = 6
+	// freeHeaderLen is the size of an empty free box.
+	freeHeaderLen = 8
 )
 
+// mp4Options holds the settings the MP4 generator reads from ports.Options.
+// A zero duration is derived from the target size.
+type mp4Options struct {
+	width, height int
+	fps           int
+	duration      time.Duration
+	audio         bool
+	poster        bool           // write a JPEG poster frame next to the video
+	thumbnails    bool           // write a WebVTT thumbnail track and its sprite
+	thumbInterval time.Duration  // time each thumbnail covers
+	meta          ports.Metadata // set from the generator, not from options
+	rand          *utils.Rand    // of the comments padding playlists
+}
+
+func parseOptions(opts ports.Options) (mp4Options, error) {
+	var o mp4Options
+	var err error
+	if o.width, err = opts.Int("width", 128); err != nil {
+		return o, err
+	}
+	if o.height, err = opts.Int("height", 96); err != nil {
+		return o, err
+	}
+	if o.width < 2 || o.height < 2 || o.width > 8192 || o.height > 8192 || o.width%2 != 0 || o.height%2 != 0 {
+		return o, fmt.Errorf("mp4 dimensions must be even and between 2 and 8192, got %dx%d", o.width, o.height)
+	}
+	if o.fps, err = opts.Int("mp4-fps", 25); err != nil {
+		return o, err
+	}
+	if o.fps < 1 || o.fps > 240 {
+		return o, fmt.Errorf("mp4-fps must be between 1 and 240, got %d", o.fps)
+	}
+	if o.duration, err = opts.Duration("mp4-duration", 0); err != nil {
+		return o, err
+	}
+	if o.duration < 0 {
+		return o, fmt.Errorf("mp4-duration must not be negative, got %s", o.duration)
+	}
+	if o.audio, err = opts.Bool("mp4-audio", false); err != nil {
+		return o, err
+	}
+	if o.poster, err = opts.Bool("mp4-poster", false); err != nil {
+		return o, err
+	}
+	if o.thumbnails, err = opts.Bool("mp4-thumbnails", false); err != nil {
+		return o, err
+	}
+	if o.thumbInterval, err = opts.Duration("mp4-thumbnail-interval", 10*time.Second); err != nil {
+		return o, err
+	}
+	if o.thumbInterval < time.Millisecond {
+		return o, fmt.Errorf("mp4-thumbnail-interval must be at least 1ms, got %s", o.thumbInterval)
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// sidecars reports whether o asks for files besides the video.
+func (o mp4Options) sidecars() bool {
+	return o.poster || o.thumbnails
+}
+
+// videoTimescale returns the video track's time unit: the usual 90 kHz
+// clock when a frame lasts a whole number of its ticks.
+func (o mp4Options) videoTimescale() (timescale, frameTicks uint32) {
+	if 90000%o.fps == 0 {
+		return 90000, uint32(90000 / o.fps)
+	}
+	return uint32(o.fps) * 1000, 1000
+}
+
+// frames returns the number of video frames o.duration takes, at least
+// one; 0 without a duration.
+func (o mp4Options) frames() int64 {
+	if o.duration == 0 {
+		return 0
+	}
+	return max(int64(math.Round(o.duration.Seconds()*float64(o.fps))), 1)
+}
+
+// audioFrames returns the AAC frames needed to cover videoFrames frames.
+func (o mp4Options) audioFrames(videoFrames int64) int64 {
+	if !o.audio {
+		return 0
+	}
+	return (videoFrames*audioSampleRate + int64(o.fps)*aacFrameSamples - 1) / (int64(o.fps) * aacFrameSamples)
+}
+
+// layout is the planned content of one output file.
+type layout struct {
+	videoFrames, audioFrames int64
+	moov                     *mp4.MoovBox
+	mdatHeaderLen            int64
+	padding                  int64 // size of the trailing free box, 0 or >= freeHeaderLen
+}
+
 func New() ports.FileGenerator {
 	return &Mp4Generator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes. If opts ask for a poster or thumbnails, the copy is a
+// ports.SetGenerator that writes them next to each video.
+func (g *Mp4Generator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	if o.sidecars() {
+		return &sidecarGenerator{&c}, nil
+	}
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *Mp4Generator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// WithMetadata returns a copy of the generator that writes m as iTunes-style
+// metadata items.
+func (g *Mp4Generator) WithMetadata(m ports.Metadata) ports.FileGenerator {
+	c := *g
+	c.meta = m
+	return &c
+}
+
 func (g *Mp4Generator) Generate(path string, targetSize int64) error {
-	// 1) H.264 ES
-	h264 := generateH264Elementary()
-	hlen := int64(len(h264))
-
-	// 2) Build init (ftyp+moov)
-	init := mp4.CreateEmptyInit()
-	tid := init.Moov.Mvhd.NextTrackID
-	init.Moov.Mvhd.NextTrackID++
-	trak := mp4.CreateEmptyTrak(tid, 90000, "video", "und")
-	init.Moov.AddChild(trak)
-	init.Moov.Mvex.AddChild(mp4.CreateTrex(tid))
-	// give it our SPS/PPS in avcC
-	trak.SetAVCDescriptor("avc1", [][]byte{sps[4:]}, [][]byte{pps[4:]}, true)
-
-	// 3) Write init to file
-	f, err := os.Create(path)
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions writes an MP4 of exactly targetSize bytes holding
+// black H.264 frames and, optionally, a silent AAC track. opts may set the
+// resolution, frame rate and duration; without a duration the frame count
+// is the most that fits the target. The moov box carries complete sample
+// tables, track durations and bitrates for what is written; whatever the
+// samples leave of the target becomes a free box after mdat. Metadata set
+// with WithMetadata goes in a udta box in moov.
+func (g *Mp4Generator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
 	if err != nil {
 		return err
 	}
+	o.meta = g.meta
+	_, err = generate(g.fs, path, targetSize, o)
+	return err
+}
+
+// ForDuration returns a copy of the generator set to write d of video, and
+// the size of the file holding it with nothing left over for a free box.
+func (g *Mp4Generator) ForDuration(d time.Duration) (ports.FileGenerator, int64, error) {
+	if d <= 0 {
+		return nil, 0, fmt.Errorf("duration must be positive, got %s", d)
+	}
+	opts := ports.Options{"mp4-duration": d.String()}
+	configured, err := g.Configure(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	o, err := parseOptions(g.opts.With(opts))
+	if err != nil {
+		return nil, 0, err
+	}
+	o.meta = g.meta
+	size, err := durationSize(o)
+	if err != nil {
+		return nil, 0, err
+	}
+	return configured, size, nil
+}
+
+// durationSize returns the size of the MP4 holding o.duration of samples
+// and no free box.
+func durationSize(o mp4Options) (int64, error) {
+	sps, sample := frameSample(o)
+	sampleLen, ftypSize := int64(len(sample)), int64(newFtyp().Size())
+	frames := o.frames()
+	audioFrames := o.audioFrames(frames)
+	data := frames*sampleLen + audioFrames*int64(len(silentAACFrame))
+	moov, err := buildMoov(o, sps, sampleLen, frames, audioFrames, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	mdatHeaderLen := int64(8)
+	if 8+data > math.MaxUint32 {
+		mdatHeaderLen = 16
+	}
+	size := ftypSize + int64(moov.Size()) + mdatHeaderLen + data
+	for attempt := 0; attempt < maxPlanAttempts; attempt++ {
+		plan, err := planLayout(o, sps, sampleLen, ftypSize, size)
+		if err != nil {
+			return 0, err
+		}
+		if plan.padding == 0 {
+			return size, nil
+		}
+		size -= plan.padding
+	}
+	return 0, fmt.Errorf("could not settle the MP4 layout for %s", o.duration)
+}
+
+// frameSample returns the SPS for o's resolution and frame rate and one
+// black frame as a length-prefixed IDR slice.
+func frameSample(o mp4Options) (sps, sample []byte) {
+	sps = buildSPS(o.width, o.height, o.fps)
+	slice := buildSlice(((o.width + 15) / 16) * ((o.height + 15) / 16))
+	sample = make([]byte, nalLengthSize, nalLengthSize+len(slice))
+	binary.BigEndian.PutUint32(sample, uint32(len(slice)))
+	return sps, append(sample, slice...)
+}
+
+// newFtyp returns the file type box every MP4 starts with.
+func newFtyp() *mp4.FtypBox {
+	return mp4.NewFtyp("isom", 0x200, []string{"isom", "iso2", "avc1", "mp41"})
+}
+
+// generate writes the MP4 to path on fsys and returns its layout.
+func generate(fsys ports.OutputFS, path string, targetSize int64, o mp4Options) (*layout, error) {
+	// 1) One black frame as a length-prefixed IDR slice
+	sps, sample := frameSample(o)
+
+	// 2) Plan sample counts and build moov to match
+	ftyp := newFtyp()
+	plan, err := planLayout(o, sps, int64(len(sample)), int64(ftyp.Size()), targetSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3) Write ftyp, moov, mdat header, video chunk, audio chunk, free box
+	f, err := outputfs.Create(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
 	w := bufio.NewWriter(f)
-	// ftyp
-	mp4.NewFtyp("isom", 0x200, []string{"isom", "iso2", "avc1", "mp41"}).Encode(w)
-	// moov
-	if err := init.Moov.Encode(w); err != nil {
-		return err
+	if err := ftyp.Encode(w); err != nil {
+		return nil, err
+	}
+	if err := plan.moov.Encode(w); err != nil {
+		return nil, err
+	}
+	mdatSize := plan.mdatHeaderLen + plan.videoFrames*int64(len(sample)) + plan.audioFrames*int64(len(silentAACFrame))
+	if err := writeBoxHeader(w, "mdat", mdatSize, plan.mdatHeaderLen); err != nil {
+		return nil, err
+	}
+	for i := int64(0); i < plan.videoFrames; i++ {
+		if _, err := w.Write(sample); err != nil {
+			return nil, err
+		}
+	}
+	for i := int64(0); i < plan.audioFrames; i++ {
+		if _, err := w.Write(silentAACFrame); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFree(w, plan.padding); err != nil {
+		return nil, err
 	}
 	if err := w.Flush(); err != nil {
-		return err
+		return nil, err
 	}
+	return plan, f.Close()
+}
+
+// planLayout picks the frame counts for targetSize and builds the matching
+// moov. The moov size depends slightly on the counts (64-bit durations and
+// offsets), so the plan is recomputed until it is stable. A gap too small
+// for a free box is taken up by lengthening the video handler name.
+func planLayout(o mp4Options, sps []byte, sampleLen, ftypSize, targetSize int64) (*layout, error) {
+	audioLen := int64(len(silentAACFrame))
+	frames := o.frames()
+	perFrame := float64(sampleLen)
+	if o.audio {
+		perFrame += float64(audioLen*audioSampleRate) / float64(o.fps*aacFrameSamples)
+	}
+
+	namePad := 0
+	guess, err := buildMoov(o, sps, sampleLen, max(frames, 1), o.audioFrames(max(frames, 1)), 0, namePad)
+	if err != nil {
+		return nil, err
+	}
+	moovSize := int64(guess.Size())
+	// The smallest video: one frame in an mdat with a short header.
+	if need := ftypSize + moovSize + 8 + sampleLen + o.audioFrames(1)*audioLen; targetSize < need {
+		return nil, fmt.Errorf("target %d too small; need at least %d", targetSize, need)
+	}
+	for attempt := 0; attempt < maxPlanAttempts; attempt++ {
+		mdatHeaderLen := int64(8)
+		if targetSize-ftypSize-moovSize > math.MaxUint32 {
+			mdatHeaderLen = 16
+		}
+		avail := targetSize - ftypSize - moovSize - mdatHeaderLen
+		n := frames
+		if o.duration == 0 {
+			// Largest frame count whose video and audio samples fit
+			n = int64(float64(avail) / perFrame)
+			for n > 1 && n*sampleLen+o.audioFrames(n)*audioLen > avail {
+				n--
+			}
+		}
+		m := o.audioFrames(n)
+		if n < 1 || n*sampleLen+m*audioLen > avail {
+			n = max(n, 1)
+			need := ftypSize + moovSize + mdatHeaderLen + n*sampleLen + o.audioFrames(n)*audioLen
+			return nil, fmt.Errorf("target %d too small; need at least %d", targetSize, need)
+		}
 
-	// 4) Compute how many bytes for mdat
-	fi, _ := f.Stat()
-	initSize := fi.Size()
-	mdatTotal := targetSize - initSize
-	if mdatTotal < hlen+8 {
-		return fmt.Errorf("target %d too small; need at least %d", targetSize, initSize+hlen+8)
-	}
-	payload := mdatTotal - 8
-
-	// 5) Estimate repeats and leftover
-	repeats := payload / hlen
-	if repeats < 1 {
-		repeats = 1
-	}
-	// Choose 25 fps → 90000/25 = 3600 time‐units/frame
-	const fps = 25
-	sampleDur := uint32(90000 / fps)
-	totalDur := uint64(sampleDur) * uint64(repeats)
-
-	// 6) Patch durations & STTS
-	init.Moov.Mvhd.Duration = totalDur
-	for _, tr := range init.Moov.Traks {
-		tr.Tkhd.Duration = totalDur
-		tr.Mdia.Mdhd.Duration = totalDur
-		tr.Mdia.Minf.Stbl.Stts = &mp4.SttsBox{
-			Version: 0, Flags: 0,
-			SampleCount:     []uint32{uint32(repeats)},
-			SampleTimeDelta: []uint32{sampleDur},
+		dataStart := uint64(ftypSize + moovSize + mdatHeaderLen)
+		padding := avail - n*sampleLen - m*audioLen
+		if padding > 0 && padding < freeHeaderLen {
+			namePad += int(padding)
+			moovSize += padding
+			continue
+		}
+		moov, err := buildMoov(o, sps, sampleLen, n, m, dataStart, namePad)
+		if err != nil {
+			return nil, err
 		}
+		if int64(moov.Size()) == moovSize {
+			return &layout{
+				videoFrames:   n,
+				audioFrames:   m,
+				moov:          moov,
+				mdatHeaderLen: mdatHeaderLen,
+				padding:       padding,
+			}, nil
+		}
+		moovSize = int64(moov.Size())
 	}
+	return nil, fmt.Errorf("could not settle the MP4 layout for target %d", targetSize)
+}
 
-	// 7) Rewrite moov with new durations
-	// Seek back and overwrite moov (simple approach: reopen file after ftyp, or
-	// if streaming isn’t needed, rebuild init and re-encode both ftyp+moov).
-	// For brevity, assume we re-encode both:
-	f.Truncate(0)
-	f.Seek(0, 0)
-	w.Reset(f)
-	mp4.NewFtyp("isom", 0x200, []string{"isom", "iso2", "avc1", "mp41"}).Encode(w)
-	init.Moov.Encode(w)
-	w.Flush()
-
-	// 8) Write mdat header
-	hdr := make([]byte, 8)
-	binary.BigEndian.PutUint32(hdr[0:4], uint32(mdatTotal))
-	copy(hdr[4:8], []byte("mdat"))
-	if _, err := f.Write(hdr); err != nil {
-		return err
+// buildMoov returns a moov box describing videoFrames frames stored as one
+// chunk at dataStart, followed by audioFrames AAC frames as a second chunk.
+// The video handler name is lengthened by namePad bytes.
+func buildMoov(o mp4Options, sps []byte, sampleLen, videoFrames, audioFrames int64, dataStart uint64, namePad int) (*mp4.MoovBox, error) {
+	moov := mp4.NewMoovBox()
+	mvhd := mp4.CreateMvhd()
+	mvhd.Timescale = movieTimescale
+	moov.AddChild(mvhd)
+
+	// Video track
+	timescale, frameTicks := o.videoTimescale()
+	video := mp4.CreateEmptyTrak(1, timescale, "video", "und")
+	video.Mdia.Hdlr.Name += strings.Repeat(" ", namePad)
+	if err := video.SetAVCDescriptor("avc1", [][]byte{sps}, [][]byte{pps}, true); err != nil {
+		return nil, err
 	}
+	bitrate := uint32(min(sampleLen*8*int64(o.fps), math.MaxUint32))
+	video.Mdia.Minf.Stbl.Stsd.AvcX.AddChild(&mp4.BtrtBox{
+		BufferSizeDB: uint32(sampleLen),
+		MaxBitrate:   bitrate,
+		AvgBitrate:   bitrate,
+	})
+	videoTicks := uint64(videoFrames) * uint64(frameTicks)
+	setSamples(video, videoTicks, movieDuration(videoTicks, timescale), videoFrames, frameTicks, sampleLen, dataStart)
+	moov.AddChild(video)
+	duration := video.Tkhd.Duration
+	nextTrackID := uint32(2)
 
-	// 9) Write frames
-	for i := int64(0); i < repeats; i++ {
-		if _, err := f.Write(h264); err != nil {
-			return err
+	// Silent audio track
+	if o.audio {
+		audio := mp4.CreateEmptyTrak(2, audioSampleRate, "audio", "und")
+		var asc bytes.Buffer
+		cfg := &aac.AudioSpecificConfig{ObjectType: aac.AAClc, ChannelConfiguration: 1, SamplingFrequency: audioSampleRate}
+		if err := cfg.Encode(&asc); err != nil {
+			return nil, err
 		}
+		esds := mp4.CreateEsdsBox(asc.Bytes())
+		dcd := esds.ESDescriptor.DecConfigDescriptor
+		dcd.BufferSizeDB = uint32(len(silentAACFrame))
+		dcd.AvgBitrate = uint32(len(silentAACFrame) * 8 * audioSampleRate / aacFrameSamples)
+		dcd.MaxBitrate = dcd.AvgBitrate
+		audio.Mdia.Minf.Stbl.Stsd.AddChild(mp4.CreateAudioSampleEntryBox("mp4a", 1, 16, audioSampleRate, esds))
+		audioTicks := uint64(audioFrames) * aacFrameSamples
+		audioOffset := dataStart + uint64(videoFrames*sampleLen)
+		setSamples(audio, audioTicks, movieDuration(audioTicks, audioSampleRate), audioFrames, aacFrameSamples, int64(len(silentAACFrame)), audioOffset)
+		moov.AddChild(audio)
+		duration = max(duration, audio.Tkhd.Duration)
+		nextTrackID++
 	}
 
-	// 10) Pad remainder
-	rem := payload - (repeats * hlen)
-	zero := make([]byte, 4096)
-	for rem > 0 {
-		n := int64(len(zero))
-		if n > rem {
-			n = rem
+	mvhd.Duration = duration
+	mvhd.NextTrackID = nextTrackID
+	if duration > math.MaxUint32 {
+		mvhd.Version = 1
+	}
+	if len(o.meta) > 0 {
+		udta, err := buildUdta(o.meta)
+		if err != nil {
+			return nil, err
 		}
-		if _, err := f.Write(zero[:n]); err != nil {
-			return err
+		moov.AddChild(udta)
+	}
+	return moov, nil
+}
+
+// movieDuration converts ticks of a track timescale to movie time units.
+func movieDuration(ticks uint64, timescale uint32) uint64 {
+	return ticks * movieTimescale / uint64(timescale)
+}
+
+// setSamples fills trak's durations and sample tables for count samples of
+// size bytes and delta ticks each, stored as a single chunk at offset.
+func setSamples(trak *mp4.TrakBox, ticks, movieTicks uint64, count int64, delta uint32, size int64, offset uint64) {
+	trak.Tkhd.Duration = movieTicks
+	trak.Mdia.Mdhd.Duration = ticks
+	if movieTicks > math.MaxUint32 {
+		trak.Tkhd.Version = 1
+	}
+	if ticks > math.MaxUint32 {
+		trak.Mdia.Mdhd.Version = 1
+	}
+
+	stbl := trak.Mdia.Minf.Stbl
+	stbl.Stts.SampleCount = []uint32{uint32(count)}
+	stbl.Stts.SampleTimeDelta = []uint32{delta}
+	stbl.Stsc.Entries = []mp4.StscEntry{{FirstChunk: 1, SamplesPerChunk: uint32(count), FirstSampleNr: 1}}
+	stbl.Stsc.SampleDescriptionID = []uint32{1}
+	stbl.Stsz.SampleUniformSize = uint32(size)
+	stbl.Stsz.SampleNumber = uint32(count)
+	if offset <= math.MaxUint32 {
+		stbl.Stco.ChunkOffset = []uint32{uint32(offset)}
+		return
+	}
+	// Offsets past 4 GiB need a co64 box in place of stco
+	co64 := &mp4.Co64Box{ChunkOffset: []uint64{offset}}
+	for i, c := range stbl.Children {
+		if c == mp4.Box(stbl.Stco) {
+			stbl.Children[i] = co64
 		}
-		rem -= n
 	}
-	return f.Close()
+	stbl.Stco, stbl.Co64 = nil, co64
+}
+
+// writeBoxHeader writes the header of a box of size bytes, using the
+// 64-bit largesize form when headerLen is 16.
+func writeBoxHeader(w *bufio.Writer, name string, size, headerLen int64) error {
+	hdr := make([]byte, headerLen)
+	if headerLen == 16 {
+		binary.BigEndian.PutUint32(hdr[0:4], 1)
+		binary.BigEndian.PutUint64(hdr[8:16], uint64(size))
+	} else {
+		binary.BigEndian.PutUint32(hdr[0:4], uint32(size))
+	}
+	copy(hdr[4:8], name)
+	_, err := w.Write(hdr)
+	return err
 }
 
-// generateH264Elementary builds one blank I‐frame
-func generateH264Elementary() []byte {
-	buf := make([]byte, 0, 1024*10)
-	buf = append(buf, sps...)
-	buf = append(buf, pps...)
-	buf = append(buf, sliceHeader...)
-	// zeroed macroblocks
-	for y := 0; y < heightMB; y++ {
-		for x := 0; x < widthMB; x++ {
-			buf = append(buf, macroblockHeader...)
-			buf = append(buf, make([]byte, 16*16+8*8+8*8)...)
+// writeFree writes a zero-filled free box of exactly size bytes; size must
+// be 0 (no box) or at least freeHeaderLen.
+func writeFree(w *bufio.Writer, size int64) error {
+	if size == 0 {
+		return nil
+	}
+	headerLen := int64(freeHeaderLen)
+	if size > math.MaxUint32 {
+		headerLen = 16
+	}
+	if err := writeBoxHeader(w, "free", size, headerLen); err != nil {
+		return err
+	}
+	zero := make([]byte, 4096)
+	for rem := size - headerLen; rem > 0; {
+		n := min(int64(len(zero)), rem)
+		if _, err := w.Write(zero[:n]); err != nil {
+			return err
 		}
+		rem -= n
 	}
-	buf = append(buf, 0x80) // slice stop
-	return buf
+	return nil
 }
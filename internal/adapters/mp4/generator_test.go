@@ -4,48 +4,38 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"image/jpeg"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Eyevinn/mp4ff/mp4" // Import mp4ff for potential validation
 	"github.com/hailam/genfile/internal/ports"
 )
 
-// Helper to estimate minimum size - this might need adjustment based on actual output
+// Helper to estimate minimum size: ftyp + moov + mdat holding one frame
 func estimateMinMp4Size() (int64, error) {
-	// Generate the minimal H.264 elementary stream frame
-	h264 := generateH264Elementary()
-	hlen := int64(len(h264))
-
-	// Create a basic init structure (ftyp + moov)
-	init := mp4.CreateEmptyInit()
-	tid := init.Moov.Mvhd.NextTrackID
-	init.Moov.Mvhd.NextTrackID++
-	trak := mp4.CreateEmptyTrak(tid, 90000, "video", "und")
-	init.Moov.AddChild(trak)
-	init.Moov.Mvex.AddChild(mp4.CreateTrex(tid))
-	trak.SetAVCDescriptor("avc1", [][]byte{sps[4:]}, [][]byte{pps[4:]}, true)
-
-	// Encode ftyp + moov to a buffer to get their size
-	var initBuf bytes.Buffer
-	ftyp := mp4.NewFtyp("isom", 0x200, []string{"isom", "iso2", "avc1", "mp41"})
-	err := ftyp.Encode(&initBuf)
+	o, err := parseOptions(nil)
 	if err != nil {
-		return -1, fmt.Errorf("failed to encode ftyp for min size calc: %w", err)
+		return -1, err
 	}
-	err = init.Moov.Encode(&initBuf)
+	slice := buildSlice((o.width / 16) * (o.height / 16))
+	sampleLen := int64(nalLengthSize + len(slice))
+
+	// Build the moov for a single frame to get its size
+	moov, err := buildMoov(o, buildSPS(o.width, o.height, o.fps), sampleLen, 1, 0, 0, 0)
 	if err != nil {
-		return -1, fmt.Errorf("failed to encode moov for min size calc: %w", err)
+		return -1, fmt.Errorf("failed to build moov for min size calc: %w", err)
 	}
-	initSize := int64(initBuf.Len())
+	ftyp := mp4.NewFtyp("isom", 0x200, []string{"isom", "iso2", "avc1", "mp41"})
 
 	// Minimum mdat requires header (8 bytes) + one frame
-	minMdatSize := int64(8) + hlen
+	minMdatSize := int64(8) + sampleLen
 
-	return initSize + minMdatSize, nil
+	return int64(ftyp.Size()+moov.Size()) + minMdatSize, nil
 }
 
 func TestMp4Generator_Generate(t *testing.T) {
@@ -240,26 +230,346 @@ func checkMp4Structure(t *testing.T, path string, totalSize int64) {
 		t.Errorf("Expected 'mdat' box after 'moov', got %q", mdatType)
 	}
 
+	// Anything after mdat must be a single free box
+	freeSize := int64(0)
+	if end := ftypSize + moovSize + mdatSize; end < totalSize {
+		if _, err := f.Seek(end, io.SeekStart); err != nil {
+			t.Fatalf("Failed to seek past mdat box in %s: %v", path, err)
+		}
+		if _, err := io.ReadFull(f, header); err != nil {
+			t.Fatalf("Failed to read box header after mdat of %s: %v", path, err)
+		}
+		freeSize = int64(binary.BigEndian.Uint32(header[0:4]))
+		if freeType := string(header[4:8]); freeType != "free" {
+			t.Errorf("Expected 'free' box after 'mdat', got %q", freeType)
+		}
+	}
+
 	// Check if total size matches sum of box sizes found
-	calculatedSize := ftypSize + moovSize + mdatSize
+	calculatedSize := ftypSize + moovSize + mdatSize + freeSize
 	if calculatedSize != totalSize {
-		t.Errorf("Sum of box sizes (%d + %d + %d = %d) does not match total file size %d",
-			ftypSize, moovSize, mdatSize, calculatedSize, totalSize)
+		t.Errorf("Sum of box sizes (%d + %d + %d + %d = %d) does not match total file size %d",
+			ftypSize, moovSize, mdatSize, freeSize, calculatedSize, totalSize)
 	}
 }
 
-// generateH264Elementary needs to be copied here if not exported,
-// or tests need access to the original package's internal functions.
-// For simplicity, copy the implementation (ensure it's identical).
-// --- Copied from mp4/generator.go ---
-var sps_test = []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0x00, 0x0a, 0xf8, 0x41, 0xa2}
-var pps_test = []byte{0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x38, 0x80}
-var sliceHeader_test = []byte{0x00, 0x00, 0x00, 0x01, 0x05, 0x88, 0x84, 0x21, 0xa0}
-var macroblockHeader_test = []byte{0x0d, 0x00}
-
-const (
-	widthMB_test  = 128 / 16
-	heightMB_test = 96 / 16
-)
+func TestMp4Generator_PadsEveryGap(t *testing.T) {
+	generator := &Mp4Generator{}
+	tempDir := t.TempDir()
+	minSize, err := estimateMinMp4Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One frame is pinned, so every extra byte is padding: gaps below the
+	// free box header size go into moov, larger ones into a free box.
+	opts := ports.Options{"mp4-duration": "40ms"}
+	for extra := int64(0); extra <= 12; extra++ {
+		outPath := filepath.Join(tempDir, fmt.Sprintf("gap_%d.mp4", extra))
+		if err := generator.GenerateWithOptions(outPath, minSize+extra, opts); err != nil {
+			t.Fatalf("extra %d: %v", extra, err)
+		}
+		checkFileSize(t, outPath, minSize+extra)
+		checkMp4Structure(t, outPath, minSize+extra)
+
+		file, err := mp4.ReadMP4File(outPath)
+		if err != nil {
+			t.Fatalf("extra %d: mp4ff failed to parse output: %v", extra, err)
+		}
+		video := file.Moov.Traks[0]
+		if n := video.GetNrSamples(); n != 1 {
+			t.Errorf("extra %d: frames = %d, want 1", extra, n)
+		}
+		if _, err := video.GetSampleData(1, 1); err != nil {
+			t.Errorf("extra %d: %v", extra, err)
+		}
+	}
+}
+
+func TestMp4Generator_GenerateWithOptions(t *testing.T) {
+	generator := &Mp4Generator{}
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name         string
+		size         int64
+		opts         ports.Options
+		width        int
+		height       int
+		timescale    uint32
+		frames       uint32 // 0: derived from size
+		audio        bool
+		errSubstring string
+	}{
+		{name: "Defaults", size: 200 * 1024, width: 128, height: 96, timescale: 90000},
+		{name: "CroppedResolution", size: 2 * 1024 * 1024, opts: ports.Options{"width": "330", "height": "250"}, width: 330, height: 250, timescale: 90000},
+		{name: "DurationAndFPS", size: 4 * 1024 * 1024, opts: ports.Options{"mp4-fps": "30", "mp4-duration": "2s"}, width: 128, height: 96, timescale: 90000, frames: 60},
+		{name: "OddFPS", size: 300 * 1024, opts: ports.Options{"mp4-fps": "7"}, width: 128, height: 96, timescale: 7000},
+		{name: "SilentAudio", size: 1024 * 1024, opts: ports.Options{"mp4-audio": "true", "mp4-duration": "1500ms"}, width: 128, height: 96, timescale: 90000, frames: 38, audio: true},
+		{name: "DurationTooLong", size: 100 * 1024, opts: ports.Options{"mp4-duration": "1m"}, errSubstring: "too small"},
+		{name: "OddWidth", size: 100 * 1024, opts: ports.Options{"width": "101"}, errSubstring: "must be even"},
+		{name: "BadFPS", size: 100 * 1024, opts: ports.Options{"mp4-fps": "0"}, errSubstring: "mp4-fps"},
+		{name: "BadDuration", size: 100 * 1024, opts: ports.Options{"mp4-duration": "soon"}, errSubstring: "invalid duration"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("opts_%s.mp4", tc.name))
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.errSubstring != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSubstring) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSubstring, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, tc.size)
+			checkMp4Structure(t, outPath, tc.size)
 
-// --- End Copied Section ---
+			file, err := mp4.ReadMP4File(outPath)
+			if err != nil {
+				t.Fatalf("mp4ff failed to parse output: %v", err)
+			}
+			traks := file.Moov.Traks
+			if want := map[bool]int{false: 1, true: 2}[tc.audio]; len(traks) != want {
+				t.Fatalf("tracks = %d, want %d", len(traks), want)
+			}
+
+			video := traks[0]
+			avc1 := video.Mdia.Minf.Stbl.Stsd.AvcX
+			if int(avc1.Width) != tc.width || int(avc1.Height) != tc.height {
+				t.Errorf("avc1 dimensions = %dx%d, want %dx%d", avc1.Width, avc1.Height, tc.width, tc.height)
+			}
+			if avc1.Btrt == nil || avc1.Btrt.AvgBitrate == 0 {
+				t.Errorf("avc1 has no bitrate box")
+			}
+			if got := video.Mdia.Mdhd.Timescale; got != tc.timescale {
+				t.Errorf("video timescale = %d, want %d", got, tc.timescale)
+			}
+			frames := video.GetNrSamples()
+			if tc.frames != 0 && frames != tc.frames {
+				t.Errorf("video frames = %d, want %d", frames, tc.frames)
+			}
+			if frames < 1 {
+				t.Fatalf("no video frames")
+			}
+			wantMs := uint64(frames) * 1000 / uint64(mp4FPS(tc.opts))
+			if got := file.Moov.Mvhd.Duration; got < wantMs {
+				t.Errorf("movie duration = %dms, want at least %dms", got, wantMs)
+			}
+
+			// Every sample must be a single length-prefixed IDR slice
+			samples, err := video.GetSampleData(1, frames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range []int{0, len(samples) - 1} {
+				offset, err := video.Mdia.Minf.Stbl.Stco.GetOffset(1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				start := int(offset) + i*int(samples[i].Size)
+				nal := data[start : start+int(samples[i].Size)]
+				if n := binary.BigEndian.Uint32(nal); int(n) != len(nal)-nalLengthSize || nal[nalLengthSize]&0x1F != 5 {
+					t.Errorf("sample %d is not a length-prefixed IDR slice", i)
+				}
+				if bytes.Contains(nal[nalLengthSize:], []byte{0, 0, 1}) {
+					t.Errorf("sample %d contains a start code prefix", i)
+				}
+			}
+
+			if tc.audio {
+				audio := traks[1]
+				if got := audio.Mdia.Minf.Stbl.Stsd.Mp4a.ChannelCount; got != 1 {
+					t.Errorf("audio channels = %d, want 1", got)
+				}
+				if audio.Tkhd.Duration < video.Tkhd.Duration {
+					t.Errorf("audio track (%dms) shorter than video (%dms)", audio.Tkhd.Duration, video.Tkhd.Duration)
+				}
+				offset, _ := audio.Mdia.Minf.Stbl.Stco.GetOffset(1)
+				first := data[offset : int(offset)+len(silentAACFrame)]
+				if !bytes.Equal(first, silentAACFrame) {
+					t.Errorf("first audio sample = % x, want % x", first, silentAACFrame)
+				}
+			}
+		})
+	}
+}
+
+func TestMp4Generator_ForDuration(t *testing.T) {
+	testCases := []struct {
+		name         string
+		duration     time.Duration
+		opts         ports.Options
+		frames       uint32
+		errSubstring string
+	}{
+		{name: "Defaults", duration: 2 * time.Second, frames: 50},
+		{name: "FPSAndAudio", duration: 1500 * time.Millisecond, opts: ports.Options{"mp4-fps": "30", "mp4-audio": "true"}, frames: 45},
+		{name: "ShorterThanAFrame", duration: time.Millisecond, frames: 1},
+		{name: "Resolution", duration: 10 * time.Second, opts: ports.Options{"width": "640", "height": "360", "mp4-fps": "24"}, frames: 240},
+		{name: "Zero", duration: 0, errSubstring: "must be positive"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := (&Mp4Generator{}).Configure(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sized, size, err := g.(ports.DurationGenerator).ForDuration(tc.duration)
+			if tc.errSubstring != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSubstring) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSubstring, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ForDuration returned unexpected error: %v", err)
+			}
+			outPath := filepath.Join(t.TempDir(), "duration.mp4")
+			if err := sized.Generate(outPath, size); err != nil {
+				t.Fatal(err)
+			}
+			checkFileSize(t, outPath, size)
+			file, err := mp4.ReadMP4File(outPath)
+			if err != nil {
+				t.Fatalf("mp4ff failed to parse output: %v", err)
+			}
+			if got := file.Moov.Traks[0].GetNrSamples(); got != tc.frames {
+				t.Errorf("video frames = %d, want %d", got, tc.frames)
+			}
+			if n := len(file.Children); n != 3 {
+				t.Errorf("file has %d top-level boxes, want ftyp, moov and mdat alone", n)
+			}
+		})
+	}
+}
+
+func mp4FPS(opts ports.Options) int {
+	fps, _ := opts.Int("mp4-fps", 25)
+	return fps
+}
+
+func TestBuildSPS(t *testing.T) {
+	// The 128x96 SPS of the original fixed-size encoder.
+	want := []byte{0x67, 0x42, 0x00, 0x0a, 0xf8, 0x41, 0xa2}
+	if got := buildSPS(128, 96, 25); !bytes.Equal(got, want) {
+		t.Errorf("buildSPS(128, 96) = % x, want % x", got, want)
+	}
+}
+
+func TestMp4Generator_WithMetadata(t *testing.T) {
+	generator := New().(ports.MetadataCapable).WithMetadata(ports.Metadata{
+		ports.MetaTitle: "Black frames",
+		"Scene":         "7",
+	})
+	outPath := filepath.Join(t.TempDir(), "meta.mp4")
+	const size = 200 * 1024
+	if err := generator.Generate(outPath, size); err != nil {
+		t.Fatalf("Generate returned unexpected error: %v", err)
+	}
+	checkFileSize(t, outPath, size)
+	checkMp4Structure(t, outPath, size)
+
+	file, err := mp4.ReadMP4File(outPath)
+	if err != nil {
+		t.Fatalf("mp4ff failed to parse output: %v", err)
+	}
+	if udta, _ := file.Moov.GetChildren()[len(file.Moov.GetChildren())-1].(*mp4.UdtaBox); udta == nil {
+		t.Fatal("moov does not end with a udta box")
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"hdlr", "mdir", "\xa9nam\x00\x00\x00\x1cdata\x00\x00\x00\x01\x00\x00\x00\x00Black frames", "com.apple.iTunes", "name\x00\x00\x00\x00Scene"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("udta lacks %q", want)
+		}
+	}
+}
+
+func TestMp4Generator_Sidecars(t *testing.T) {
+	plain, err := New().(ports.ConfigurableGenerator).Configure(ports.Options{"mp4-fps": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := plain.(ports.SetGenerator); ok {
+		t.Error("generator without sidecars is a set generator")
+	}
+
+	gen, err := New().(ports.ConfigurableGenerator).Configure(ports.Options{
+		"mp4-duration": "2600ms", "mp4-poster": "true", "mp4-thumbnails": "true", "mp4-thumbnail-interval": "1s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen = gen.(ports.MetadataCapable).WithMetadata(ports.Metadata{ports.MetaTitle: "Sidecars"})
+	sg, ok := gen.(ports.SetGenerator)
+	if !ok {
+		t.Fatal("generator with sidecars is not a set generator")
+	}
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "clip.mp4")
+	const size = 2 * 1024 * 1024
+	paths, err := sg.GenerateSet(outPath, size)
+	if err != nil {
+		t.Fatalf("GenerateSet error = %v", err)
+	}
+	want := []string{"clip.mp4", "clip.jpg", "clip.vtt", "clip.thumbs.jpg"}
+	for i, p := range paths {
+		if i >= len(want) || p != filepath.Join(dir, want[i]) {
+			t.Fatalf("GenerateSet paths = %v, want %v in %s", paths, want, dir)
+		}
+	}
+	checkFileSize(t, outPath, size)
+
+	vtt, _ := os.ReadFile(paths[2])
+	wantVTT := "WEBVTT\n" +
+		"\n00:00:00.000 --> 00:00:01.000\nclip.thumbs.jpg#xywh=0,0,128,96\n" +
+		"\n00:00:01.000 --> 00:00:02.000\nclip.thumbs.jpg#xywh=128,0,128,96\n" +
+		"\n00:00:02.000 --> 00:00:02.600\nclip.thumbs.jpg#xywh=256,0,128,96\n"
+	if string(vtt) != wantVTT {
+		t.Errorf("thumbnail track =\n%s\nwant\n%s", vtt, wantVTT)
+	}
+	for _, tc := range []struct {
+		path          string
+		width, height int
+	}{{paths[1], 128, 96}, {paths[3], 3 * 128, 96}} {
+		f, err := os.Open(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := jpeg.DecodeConfig(f)
+		f.Close()
+		if err != nil || cfg.Width != tc.width || cfg.Height != tc.height {
+			t.Errorf("%s is %dx%d (%v), want %dx%d", filepath.Base(tc.path), cfg.Width, cfg.Height, err, tc.width, tc.height)
+		}
+	}
+
+	many, _ := New().(ports.ConfigurableGenerator).Configure(ports.Options{
+		"mp4-duration": "20s", "mp4-fps": "1", "mp4-thumbnails": "true", "mp4-thumbnail-interval": "10ms",
+	})
+	if _, err := many.(ports.SetGenerator).GenerateSet(filepath.Join(dir, "many.mp4"), 1024*1024); err == nil || !strings.Contains(err.Error(), "mp4-thumbnail-interval") {
+		t.Errorf("GenerateSet with too many thumbnails error = %v", err)
+	}
+}
+
+func TestThumbnailSize(t *testing.T) {
+	for _, tc := range []struct{ w, h, tw, th int }{
+		{128, 96, 128, 96},
+		{1920, 1080, 160, 90},
+		{1080, 1920, 90, 160},
+		{8192, 2, 160, 1},
+	} {
+		if tw, th := thumbnailSize(tc.w, tc.h); tw != tc.tw || th != tc.th {
+			t.Errorf("thumbnailSize(%d, %d) = %dx%d, want %dx%d", tc.w, tc.h, tw, th, tc.tw, tc.th)
+		}
+	}
+}
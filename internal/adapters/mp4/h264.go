@@ -0,0 +1,153 @@
+package mp4
+
+// Blank H.264 frames in the style of the “World’s Smallest H.264 Encoder”:
+// a Baseline SPS/PPS pair and one I slice per frame whose macroblocks are
+// all I_PCM, i.e. raw uncompressed samples.
+
+// PCM sample values of a black frame (video range).
+const (
+	blackLuma   = 0x10
+	blackChroma = 0x80
+)
+
+// pcmMacroblockLen is the 4:2:0 sample data of one I_PCM macroblock.
+const pcmMacroblockLen = 16*16 + 8*8 + 8*8
+
+// h264Levels lists Baseline levels with their frame size and macroblock
+// rate limits, in increasing order.
+var h264Levels = []struct {
+	idc            byte
+	maxFrameMBs    int
+	maxMBPerSecond int
+}{
+	{10, 99, 1485}, {11, 396, 3000}, {12, 396, 6000}, {13, 396, 11880},
+	{20, 396, 11880}, {21, 792, 19800}, {22, 1620, 20250},
+	{30, 1620, 40500}, {31, 3600, 108000}, {32, 5120, 216000},
+	{40, 8192, 245760}, {42, 8704, 522240},
+	{50, 22080, 589824}, {51, 36864, 983040}, {52, 36864, 2073600},
+}
+
+// bitWriter packs big-endian bit fields and Exp-Golomb codes.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) bits(v uint64, n uint) {
+	for i := n; i > 0; i-- {
+		w.acc = w.acc<<1 | (v>>(i-1))&1
+		w.nbits++
+		if w.nbits == 8 {
+			w.buf = append(w.buf, byte(w.acc))
+			w.acc, w.nbits = 0, 0
+		}
+	}
+}
+
+// ue writes v as an unsigned Exp-Golomb code.
+func (w *bitWriter) ue(v uint64) {
+	v++
+	n := uint(0)
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+// trailing writes the RBSP stop bit and aligns to a byte.
+func (w *bitWriter) trailing() []byte {
+	w.bits(1, 1)
+	for w.nbits != 0 {
+		w.bits(0, 1)
+	}
+	return w.buf
+}
+
+// levelFor returns the lowest level whose limits cover a frame of mbs
+// macroblocks at fps frames per second.
+func levelFor(mbs, fps int) byte {
+	for _, l := range h264Levels {
+		if mbs <= l.maxFrameMBs && mbs*fps <= l.maxMBPerSecond {
+			return l.idc
+		}
+	}
+	return h264Levels[len(h264Levels)-1].idc
+}
+
+// buildSPS returns the SPS NAL unit (without start code) for a width×height
+// Baseline stream. Dimensions that are not multiples of 16 are cropped.
+func buildSPS(width, height, fps int) []byte {
+	mbW, mbH := (width+15)/16, (height+15)/16
+	w := &bitWriter{}
+	w.bits(0x67, 8)                           // NAL header: nal_ref_idc 3, SPS
+	w.bits(66, 8)                             // profile_idc: Baseline
+	w.bits(0, 8)                              // constraint flags
+	w.bits(uint64(levelFor(mbW*mbH, fps)), 8) // level_idc
+	w.ue(0)                                   // seq_parameter_set_id
+	w.ue(0)                                   // log2_max_frame_num_minus4
+	w.ue(0)                                   // pic_order_cnt_type
+	w.ue(0)                                   // log2_max_pic_order_cnt_lsb_minus4
+	w.ue(0)                                   // max_num_ref_frames
+	w.bits(0, 1)                              // gaps_in_frame_num_value_allowed_flag
+	w.ue(uint64(mbW - 1))                     // pic_width_in_mbs_minus1
+	w.ue(uint64(mbH - 1))                     // pic_height_in_map_units_minus1
+	w.bits(1, 1)                              // frame_mbs_only_flag
+	w.bits(0, 1)                              // direct_8x8_inference_flag
+	cropRight, cropBottom := (mbW*16-width)/2, (mbH*16-height)/2
+	if cropRight == 0 && cropBottom == 0 {
+		w.bits(0, 1) // frame_cropping_flag
+	} else {
+		w.bits(1, 1)
+		w.ue(0) // left
+		w.ue(uint64(cropRight))
+		w.ue(0) // top
+		w.ue(uint64(cropBottom))
+	}
+	w.bits(0, 1) // vui_parameters_present_flag
+	return escapeRBSP(w.trailing())
+}
+
+// buildSlice returns the IDR slice NAL unit (without start code) of a black
+// frame covering mbs macroblocks.
+func buildSlice(mbs int) []byte {
+	buf := make([]byte, 0, len(sliceHeader)+mbs*(len(macroblockHeader)+pcmMacroblockLen)+1)
+	// The slice header already ends with the first macroblock's I_PCM type.
+	buf = append(buf, sliceHeader...)
+	pcm := make([]byte, pcmMacroblockLen)
+	for i := range pcm {
+		pcm[i] = blackChroma
+		if i < 16*16 {
+			pcm[i] = blackLuma
+		}
+	}
+	for i := 0; i < mbs; i++ {
+		if i > 0 {
+			buf = append(buf, macroblockHeader...)
+		}
+		buf = append(buf, pcm...)
+	}
+	buf = append(buf, 0x80) // slice stop
+	return escapeRBSP(buf)
+}
+
+// escapeRBSP inserts emulation prevention bytes so the payload never
+// contains a start code prefix.
+func escapeRBSP(rbsp []byte) []byte {
+	out := make([]byte, 0, len(rbsp))
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package mp4
+
+import (
+	"encoding/binary"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// itemTypes maps well-known metadata keys to iTunes item list atoms; other
+// keys become "----" items in the com.apple.iTunes namespace.
+var itemTypes = map[string]string{
+	ports.MetaTitle:    "\xa9nam",
+	ports.MetaAuthor:   "\xa9ART",
+	ports.MetaSubject:  "desc",
+	ports.MetaKeywords: "keyw",
+	ports.MetaComment:  "\xa9cmt",
+	ports.MetaCreator:  "\xa9too",
+}
+
+// freeformMean is the namespace of freeform ("----") items.
+const freeformMean = "com.apple.iTunes"
+
+// buildUdta returns a udta box holding m as a meta box with an mdir
+// handler and an item list, the layout iTunes and ffmpeg read.
+func buildUdta(m ports.Metadata) (*mp4.UdtaBox, error) {
+	hdlr, err := mp4.CreateHdlr("mdir")
+	if err != nil {
+		return nil, err
+	}
+	hdlr.Name = ""
+	ilst := &mp4.IlstBox{}
+	for _, k := range m.Keys() {
+		if typ, ok := itemTypes[k]; ok {
+			ilst.AddChild(box(typ, fullBox("data", 1, []byte(m[k]))))
+			continue
+		}
+		var item []byte
+		item = append(item, fullBox("mean", 0, []byte(freeformMean))...)
+		item = append(item, fullBox("name", 0, []byte(k))...)
+		item = append(item, fullBox("data", 1, []byte(m[k]))...)
+		ilst.AddChild(box("----", item))
+	}
+	meta := mp4.CreateMetaBox(0, hdlr)
+	meta.AddChild(ilst)
+	udta := &mp4.UdtaBox{}
+	udta.AddChild(meta)
+	return udta, nil
+}
+
+// box returns a box of type typ around payload.
+func box(typ string, payload []byte) *mp4.UnknownBox {
+	return mp4.CreateUnknownBox(typ, uint64(8+len(payload)), payload)
+}
+
+// fullBox encodes a box of type typ whose payload starts with a version
+// byte and 24-bit flags. mean and name boxes carry zero; data boxes carry
+// their value type (1 for UTF-8) in the flags, followed by a zero locale.
+func fullBox(typ string, flags uint32, payload []byte) []byte {
+	n := 12 + len(payload)
+	if typ == "data" {
+		n += 4
+	}
+	out := binary.BigEndian.AppendUint32(make([]byte, 0, n), uint32(n))
+	out = append(out, typ...)
+	out = binary.BigEndian.AppendUint32(out, flags)
+	if typ == "data" {
+		out = binary.BigEndian.AppendUint32(out, 0)
+	}
+	return append(out, payload...)
+}
@@ -0,0 +1,467 @@
+package mp4
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// SegmentedGenerator writes streaming presentations of the blank H.264
+// video: an HLS media playlist (.m3u8) or a DASH manifest (.mpd) with the
+// media segments it lists next to it, as a set whose size is that of all
+// its files together.
+type SegmentedGenerator struct {
+	opts     ports.Options // set by Configure
+	fileType ports.FileType
+	fs       ports.OutputFS // set by WithOutputFS
+}
+
+// Segment formats accepted by the "segment-format" option.
+const (
+	segmentTS   = "ts"
+	segmentFMP4 = "fmp4"
+)
+
+// maxSegments bounds the segments of a stream, whose names are all listed
+// in memory.
+const maxSegments = 1 << 20
+
+// segmentOptions holds the settings the segmented generator reads from
+// ports.Options.
+type segmentOptions struct {
+	video    mp4Options
+	duration time.Duration // target duration of each segment
+	format   string        // segmentTS or segmentFMP4
+}
+
+func parseSegmentOptions(opts ports.Options, fileType ports.FileType) (segmentOptions, error) {
+	var o segmentOptions
+	var err error
+	if o.video, err = parseOptions(opts); err != nil {
+		return o, err
+	}
+	if o.video.audio || o.video.duration > 0 || o.video.sidecars() {
+		return o, fmt.Errorf("mp4-audio, mp4-duration, mp4-poster and mp4-thumbnails apply to MP4 files, not to %s streams", fileType)
+	}
+	if o.duration, err = opts.Duration("segment-duration", 6*time.Second); err != nil {
+		return o, err
+	}
+	if o.duration <= 0 || o.duration > time.Hour {
+		return o, fmt.Errorf("segment-duration must be positive and at most 1h, got %s", o.duration)
+	}
+	def := segmentTS
+	if fileType == ports.FileTypeMPD {
+		def = segmentFMP4
+	}
+	switch o.format = strings.ToLower(opts.String("segment-format", def)); {
+	case o.format != segmentTS && o.format != segmentFMP4:
+		return o, fmt.Errorf("unknown segment-format %q (want ts or fmp4)", o.format)
+	case o.format == segmentTS && fileType == ports.FileTypeMPD:
+		return o, fmt.Errorf("DASH manifests take fmp4 segments, not ts")
+	}
+	return o, nil
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// set it writes.
+func (g *SegmentedGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseSegmentOptions(opts, g.fileType); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *SegmentedGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// SizesWholeSet reports that the size is that of the playlist and its
+// segments together.
+func (g *SegmentedGenerator) SizesWholeSet() bool {
+	return true
+}
+
+func (g *SegmentedGenerator) Generate(path string, size int64) error {
+	_, err := g.GenerateSetWithOptions(path, size, nil)
+	return err
+}
+
+func (g *SegmentedGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	_, err := g.GenerateSetWithOptions(path, size, opts)
+	return err
+}
+
+func (g *SegmentedGenerator) GenerateSet(path string, size int64) ([]string, error) {
+	return g.GenerateSetWithOptions(path, size, nil)
+}
+
+// GenerateSetWithOptions writes a playlist at path and its segments next
+// to it, named after it: <base>_00001.ts and so on, or with fMP4 segments
+// <base>_init.mp4 followed by <base>_00001.m4s and so on. The segments
+// hold as many black frames as fit in size, split into segments of
+// "segment-duration" (6s by default) with a shorter last one; the playlist
+// is padded with comments to make up size exactly. It returns the paths of
+// all the files, the playlist first.
+func (g *SegmentedGenerator) GenerateSetWithOptions(path string, size int64, opts ports.Options) ([]string, error) {
+	opts = g.opts.With(opts)
+	o, err := parseSegmentOptions(opts, g.fileType)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPresentation(g.fileType, path, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.plan(size); err != nil {
+		return nil, err
+	}
+
+	paths := []string{path}
+	dir := filepath.Dir(path)
+	for _, name := range p.files() {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	playlist := p.playlist()
+	playlist = p.pad(playlist, int(size-p.mediaSize()-int64(len(playlist))))
+	if err := outputfs.WriteFile(g.fs, path, []byte(playlist)); err != nil {
+		return paths[:1], fmt.Errorf("failed to write playlist: %w", err)
+	}
+	if err := p.writeSegments(g.fs, paths[1:]); err != nil {
+		return paths, err
+	}
+	return paths, nil
+}
+
+// presentation is a stream being planned and written.
+type presentation struct {
+	fileType ports.FileType
+	base     string // file name of the playlist without its extension
+	o        segmentOptions
+	sps      []byte
+	sample   []byte // one frame: length-prefixed for fMP4, Annex B for TS
+	// timescale and frameTicks are the time unit of the segments and the
+	// duration of a frame in it.
+	timescale, frameTicks uint32
+	perSegment            int64 // frames in each full segment
+	frames                int64 // frames in all, set by plan
+	initSize              int64
+	// segmentSizes caches fMP4 segment sizes by frame count and tfdt
+	// version.
+	segmentSizes map[[2]int64]int64
+}
+
+func newPresentation(fileType ports.FileType, path string, o segmentOptions) (*presentation, error) {
+	p := &presentation{
+		fileType:     fileType,
+		base:         strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		o:            o,
+		sps:          buildSPS(o.video.width, o.video.height, o.video.fps),
+		segmentSizes: map[[2]int64]int64{},
+	}
+	slice := buildSlice(((o.video.width + 15) / 16) * ((o.video.height + 15) / 16))
+	if o.format == segmentTS {
+		p.sample = annexBFrame(p.sps, slice)
+		p.timescale, p.frameTicks = 90000, uint32(90000/o.video.fps)
+	} else {
+		p.sample = binary.BigEndian.AppendUint32(nil, uint32(len(slice)))
+		p.sample = append(p.sample, slice...)
+		p.timescale, p.frameTicks = o.video.videoTimescale()
+		initSeg, err := p.initSegment()
+		if err != nil {
+			return nil, err
+		}
+		p.initSize = int64(initSeg.Size())
+	}
+	p.perSegment = max(int64(math.Round(o.duration.Seconds()*float64(o.video.fps))), 1)
+	return p, nil
+}
+
+// segments returns the number of segments.
+func (p *presentation) segments() int64 {
+	return (p.frames + p.perSegment - 1) / p.perSegment
+}
+
+// segmentFrames returns the number of frames in segment i, counted from 0.
+func (p *presentation) segmentFrames(i int64) int64 {
+	return min(p.perSegment, p.frames-i*p.perSegment)
+}
+
+// segmentName returns the file name of segment i, counted from 0.
+func (p *presentation) segmentName(i int64) string {
+	ext := ".m4s"
+	if p.o.format == segmentTS {
+		ext = ".ts"
+	}
+	return fmt.Sprintf("%s_%05d%s", p.base, i+1, ext)
+}
+
+// initName returns the file name of the fMP4 initialization segment.
+func (p *presentation) initName() string {
+	return p.base + "_init.mp4"
+}
+
+// files returns the names of the files the playlist refers to, in order.
+func (p *presentation) files() []string {
+	var names []string
+	if p.o.format == segmentFMP4 {
+		names = append(names, p.initName())
+	}
+	for i := int64(0); i < p.segments(); i++ {
+		names = append(names, p.segmentName(i))
+	}
+	return names
+}
+
+// plan picks the most frames whose segments and playlist fit in size, in
+// at most maxSegments segments.
+func (p *presentation) plan(size int64) error {
+	total := func(frames int64) int64 {
+		p.frames = frames
+		return p.mediaSize() + int64(len(p.playlist()))
+	}
+	if need := total(1); size < need {
+		return fmt.Errorf("target %d too small for a %s stream; need at least %d bytes", size, p.fileType, need)
+	}
+	// Every frame takes at least its sample, so only a size past that
+	// many samples can need more segments than maxSegments.
+	limit := size/int64(len(p.sample)) + 1
+	if most := maxSegments * p.perSegment; limit > most {
+		if total(most+1) <= size {
+			return fmt.Errorf("target %d needs more than %d segments; lengthen segment-duration", size, maxSegments)
+		}
+		limit = most
+	}
+	p.frames = int64(sort.Search(int(limit), func(n int) bool { return total(int64(n)+1) > size }))
+	return nil
+}
+
+// mediaSize returns the size of the initialization and media segments.
+func (p *presentation) mediaSize() int64 {
+	size := p.initSize
+	full := p.frames / p.perSegment
+	if p.o.format == segmentTS {
+		size += full * tsSegmentSize(p.perSegment, len(p.sample))
+		if rest := p.frames % p.perSegment; rest > 0 {
+			size += tsSegmentSize(rest, len(p.sample))
+		}
+		return size
+	}
+	// Every segment but the last is full, and takes as many bytes as the
+	// others until its base time no longer fits in 32 bits.
+	n := p.segments()
+	if n == 0 {
+		return size
+	}
+	short := min(n-1, int64(math.MaxUint32/(uint64(p.perSegment)*uint64(p.frameTicks)))+1)
+	size += short * p.fmp4SegmentSize(0)
+	if long := n - 1 - short; long > 0 {
+		size += long * p.fmp4SegmentSize(short)
+	}
+	return size + p.fmp4SegmentSize(n-1)
+}
+
+// fmp4SegmentSize returns the size of fMP4 segment i.
+func (p *presentation) fmp4SegmentSize(i int64) int64 {
+	frames := p.segmentFrames(i)
+	base := uint64(i*p.perSegment) * uint64(p.frameTicks)
+	key := [2]int64{frames, 0}
+	if base > math.MaxUint32 {
+		key[1] = 1
+	}
+	if size, ok := p.segmentSizes[key]; ok {
+		return size
+	}
+	size := int64(p.fmp4Segment(i).Size())
+	p.segmentSizes[key] = size
+	return size
+}
+
+// initSegment returns the fMP4 initialization segment: ftyp and a moov
+// describing the video track, with its samples left to the fragments.
+func (p *presentation) initSegment() (*mp4.InitSegment, error) {
+	initSeg := mp4.CreateEmptyInit()
+	initSeg.AddEmptyTrack(p.timescale, "video", "und")
+	if err := initSeg.Moov.Trak.SetAVCDescriptor("avc1", [][]byte{p.sps}, [][]byte{pps}, true); err != nil {
+		return nil, err
+	}
+	return initSeg, nil
+}
+
+// fmp4Segment returns the boxes of fMP4 segment i, whose mdat holds its
+// frames' data without it, to be written after.
+func (p *presentation) fmp4Segment(i int64) *mp4.MediaSegment {
+	seg := mp4.NewMediaSegment()
+	frag, _ := mp4.CreateFragment(uint32(i+1), 1)
+	base := uint64(i*p.perSegment) * uint64(p.frameTicks)
+	for n := p.segmentFrames(i); n > 0; n-- {
+		frag.AddSample(mp4.NewSample(mp4.SyncSampleFlags, p.frameTicks, uint32(len(p.sample)), 0), base)
+	}
+	frag.Moof.Traf.OptimizeTfhdTrun()
+	seg.AddFragment(frag)
+	return seg
+}
+
+// playlist returns the playlist, unpadded, for the planned frames.
+func (p *presentation) playlist() string {
+	if p.fileType == ports.FileTypeMPD {
+		return p.manifest()
+	}
+	var b strings.Builder
+	version := 3
+	if p.o.format == segmentFMP4 {
+		version = 7
+	}
+	fps := float64(p.o.video.fps)
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(float64(min(p.perSegment, p.frames))/fps)))
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	if p.o.format == segmentFMP4 {
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=%q\n", p.initName())
+	}
+	for i := int64(0); i < p.segments(); i++ {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", float64(p.segmentFrames(i))/fps, p.segmentName(i))
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+// manifestTail closes a DASH manifest; padding goes before it.
+const manifestTail = "</MPD>\n"
+
+// manifest returns a static DASH manifest of one video representation
+// whose segments are addressed by number.
+func (p *presentation) manifest() string {
+	var b strings.Builder
+	seconds := float64(p.frames) / float64(p.o.video.fps)
+	bandwidth := int64(len(p.sample)) * 8 * int64(p.o.video.fps)
+	b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&b, "<MPD xmlns=\"urn:mpeg:dash:schema:mpd:2011\" profiles=\"urn:mpeg:dash:profile:isoff-live:2011\" type=\"static\" mediaPresentationDuration=\"PT%.3fS\" minBufferTime=\"PT%dS\">\n",
+		seconds, int(math.Ceil(p.o.duration.Seconds())))
+	b.WriteString("  <Period id=\"1\" start=\"PT0S\">\n")
+	b.WriteString("    <AdaptationSet id=\"1\" contentType=\"video\" mimeType=\"video/mp4\" segmentAlignment=\"true\" startWithSAP=\"1\">\n")
+	fmt.Fprintf(&b, "      <Representation id=\"video\" codecs=\"avc1.%02x%02x%02x\" bandwidth=\"%d\" width=\"%d\" height=\"%d\" frameRate=\"%d\">\n",
+		p.sps[1], p.sps[2], p.sps[3], bandwidth, p.o.video.width, p.o.video.height, p.o.video.fps)
+	fmt.Fprintf(&b, "        <SegmentTemplate timescale=\"%d\" duration=\"%d\" startNumber=\"1\" initialization=\"%s\" media=\"%s_$Number%%05d$.m4s\"/>\n",
+		p.timescale, int64(p.frameTicks)*p.perSegment, p.initName(), p.base)
+	b.WriteString("      </Representation>\n    </AdaptationSet>\n  </Period>\n")
+	b.WriteString(manifestTail)
+	return b.String()
+}
+
+// padLineLen is the longest padding line.
+const padLineLen = 80
+
+// pad returns playlist grown by n bytes of comment lines: # lines at the
+// end of an HLS playlist, <!-- --> lines before the end of a DASH
+// manifest. Too few bytes for a comment are blank space.
+func (p *presentation) pad(playlist string, n int) string {
+	var b strings.Builder
+	open, close := "#", "\n"
+	if p.fileType == ports.FileTypeMPD {
+		open, close = "<!--", "-->\n"
+	}
+	minLine := len(open) + len(close)
+	if n < minLine {
+		b.WriteString(strings.Repeat("\n", n))
+	}
+	for n >= minLine {
+		l := min(n, padLineLen)
+		if rest := n - l; rest > 0 && rest < minLine {
+			l = n - minLine
+		}
+		text := ""
+		if room := l - minLine; room > 0 {
+			text = strings.TrimRight(utils.Lorem.Text(p.o.video.rand, room), " ")
+			text = strings.Repeat(" ", room-len(text)) + text
+		}
+		b.WriteString(open + text + close)
+		n -= l
+	}
+	if p.fileType == ports.FileTypeMPD {
+		return strings.TrimSuffix(playlist, manifestTail) + b.String() + manifestTail
+	}
+	return playlist + b.String()
+}
+
+// writeSegments writes the initialization segment, for fMP4, and the media
+// segments at paths on fsys.
+func (p *presentation) writeSegments(fsys ports.OutputFS, paths []string) error {
+	var ts *tsMuxer
+	if p.o.format == segmentFMP4 {
+		initSeg, err := p.initSegment()
+		if err != nil {
+			return err
+		}
+		if err := writeFile(fsys, paths[0], func(w *bufio.Writer) error { return initSeg.Encode(w) }); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+	for i, path := range paths {
+		seg := int64(i)
+		err := writeFile(fsys, path, func(w *bufio.Writer) error {
+			frames := p.segmentFrames(seg)
+			if p.o.format == segmentTS {
+				if ts == nil {
+					ts = newTSMuxer(w)
+				}
+				ts.w = w
+				if err := ts.tables(); err != nil {
+					return err
+				}
+				for f := seg * p.perSegment; f < seg*p.perSegment+frames; f++ {
+					if err := ts.frame(p.sample, tsDelay+uint64(f)*uint64(p.frameTicks)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			if err := p.fmp4Segment(seg).Encode(w); err != nil {
+				return err
+			}
+			for ; frames > 0; frames-- {
+				if _, err := w.Write(p.sample); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile creates path on fsys and writes it through write.
+func writeFile(fsys ports.OutputFS, path string, write func(w *bufio.Writer) error) error {
+	f, err := outputfs.Create(fsys, path)
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,248 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestSegmentedGenerator_Generate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fileType ports.FileType
+		size     int64
+		opts     ports.Options
+		segments int // segment files expected, besides any init segment
+		errSub   string
+	}{
+		{name: "HLS", fileType: ports.FileTypeM3U8, size: 2 * 1024 * 1024, opts: ports.Options{"segment-duration": "1s"}, segments: 5},
+		{name: "HLSfMP4", fileType: ports.FileTypeM3U8, size: 2*1024*1024 + 1, opts: ports.Options{"segment-format": "fmp4", "segment-duration": "1s"}, segments: 5},
+		{name: "DASH", fileType: ports.FileTypeMPD, size: 1024*1024 + 7, opts: ports.Options{"segment-duration": "2s"}, segments: 2},
+		{name: "Small", fileType: ports.FileTypeM3U8, size: 100 * 1024, opts: ports.Options{"width": "16", "height": "16", "segment-duration": "1s"}},
+		{name: "TooSmall", fileType: ports.FileTypeM3U8, size: 1000, errSub: "too small"},
+		{name: "TooLarge", fileType: ports.FileTypeMPD, size: math.MaxInt64, errSub: "segments"},
+		{name: "DASHWithTS", fileType: ports.FileTypeMPD, size: 1024 * 1024, opts: ports.Options{"segment-format": "ts"}, errSub: "fmp4"},
+		{name: "BadFormat", fileType: ports.FileTypeM3U8, size: 1024 * 1024, opts: ports.Options{"segment-format": "webm"}, errSub: "segment-format"},
+		{name: "BadDuration", fileType: ports.FileTypeM3U8, size: 1024 * 1024, opts: ports.Options{"segment-duration": "0s"}, errSub: "segment-duration"},
+		{name: "Audio", fileType: ports.FileTypeMPD, size: 1024 * 1024, opts: ports.Options{"mp4-audio": "true"}, errSub: "mp4-audio"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := &SegmentedGenerator{fileType: tc.fileType}
+			path := filepath.Join(t.TempDir(), "stream."+string(tc.fileType))
+			paths, err := g.GenerateSetWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateSetWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateSetWithOptions() error = %v", err)
+			}
+			if paths[0] != path {
+				t.Fatalf("first path %s, want the playlist", paths[0])
+			}
+			if total := setSize(t, paths); total != tc.size {
+				t.Errorf("set holds %d bytes, want %d", total, tc.size)
+			}
+			segments := checkSegments(t, tc.fileType, paths)
+			if tc.segments > 0 && segments != tc.segments {
+				t.Errorf("%d segments, want %d", segments, tc.segments)
+			}
+		})
+	}
+}
+
+func TestSegmentedGenerator_Sizes(t *testing.T) {
+	// Every size from the smallest stream up reaches its target.
+	dir := t.TempDir()
+	opts := ports.Options{"width": "16", "height": "16", "mp4-fps": "2", "segment-duration": "1s"}
+	for _, tc := range []struct {
+		fileType ports.FileType
+		format   string
+	}{{ports.FileTypeM3U8, "ts"}, {ports.FileTypeM3U8, "fmp4"}, {ports.FileTypeMPD, "fmp4"}} {
+		g := &SegmentedGenerator{fileType: tc.fileType}
+		opts["segment-format"] = tc.format
+		o, _ := parseSegmentOptions(opts, tc.fileType)
+		p, _ := newPresentation(tc.fileType, "s."+string(tc.fileType), o)
+		p.frames = 1
+		smallest := p.mediaSize() + int64(len(p.playlist()))
+		for size := smallest; size < smallest+3000; size += 7 {
+			path := filepath.Join(dir, "s."+string(tc.fileType))
+			paths, err := g.GenerateSetWithOptions(path, size, opts)
+			if err != nil {
+				t.Fatalf("%s %s, %d bytes: %v", tc.fileType, tc.format, size, err)
+			}
+			if total := setSize(t, paths); total != size {
+				t.Fatalf("%s %s, %d bytes came out as %d", tc.fileType, tc.format, size, total)
+			}
+			checkSegments(t, tc.fileType, paths)
+			for _, p := range paths {
+				os.Remove(p)
+			}
+		}
+	}
+}
+
+func TestCRC32MPEG2(t *testing.T) {
+	// The CRC of a PAT with program 1 on PID 0x1000, as muxers write it.
+	pat := []byte{0x00, 0xB0, 0x0D, 0x00, 0x01, 0xC1, 0x00, 0x00, 0x00, 0x01, 0xF0, 0x00}
+	if got := crc32MPEG2(pat); got != 0x2AB104B2 {
+		t.Errorf("crc32MPEG2(PAT) = %#08x, want 0x2ab104b2", got)
+	}
+}
+
+// setSize returns the total size of the files at paths.
+func setSize(t *testing.T, paths []string) int64 {
+	t.Helper()
+	var total int64
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+// checkSegments checks the playlist at paths[0] lists the segments at the
+// other paths, and that each segment is a well-formed transport stream or
+// fMP4 fragment, and returns the number of media segments.
+func checkSegments(t *testing.T, fileType ports.FileType, paths []string) int {
+	t.Helper()
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist := string(data)
+	if fileType == ports.FileTypeMPD {
+		var mpd struct {
+			Template struct {
+				Init  string `xml:"initialization,attr"`
+				Media string `xml:"media,attr"`
+			} `xml:"Period>AdaptationSet>Representation>SegmentTemplate"`
+		}
+		if err := xml.Unmarshal(data, &mpd); err != nil {
+			t.Fatalf("manifest does not parse: %v", err)
+		}
+		if mpd.Template.Init != filepath.Base(paths[1]) {
+			t.Fatalf("manifest initialization %q, want %s", mpd.Template.Init, filepath.Base(paths[1]))
+		}
+		for i, p := range paths[2:] {
+			if want := strings.Replace(mpd.Template.Media, "$Number%05d$", fmt.Sprintf("%05d", i+1), 1); filepath.Base(p) != want {
+				t.Fatalf("segment %s, manifest template gives %s", filepath.Base(p), want)
+			}
+		}
+	} else {
+		if !strings.HasPrefix(playlist, "#EXTM3U\n") || !strings.Contains(playlist, "#EXT-X-ENDLIST\n") {
+			t.Fatalf("playlist lacks #EXTM3U or #EXT-X-ENDLIST:\n%s", playlist)
+		}
+		var listed []string
+		for _, line := range strings.Split(playlist, "\n") {
+			if uri, ok := strings.CutPrefix(line, "#EXT-X-MAP:URI="); ok {
+				listed = append(listed, strings.Trim(uri, `"`))
+			} else if line != "" && !strings.HasPrefix(line, "#") {
+				listed = append(listed, line)
+			}
+		}
+		if len(listed) != len(paths)-1 {
+			t.Fatalf("playlist lists %d files, set holds %d", len(listed), len(paths)-1)
+		}
+		for i, p := range paths[1:] {
+			if listed[i] != filepath.Base(p) {
+				t.Fatalf("playlist lists %v, want %s", listed, paths[1:])
+			}
+		}
+	}
+
+	segments := 0
+	var nextDecodeTime uint64
+	for _, p := range paths[1:] {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch filepath.Ext(p) {
+		case ".ts":
+			segments++
+			checkTS(t, data)
+		case ".mp4":
+			f, err := mp4.DecodeFile(bytes.NewReader(data))
+			if err != nil || f.Init == nil || f.Init.Moov.Mvex == nil {
+				t.Fatalf("%s is not an fMP4 init segment: %v", filepath.Base(p), err)
+			}
+		case ".m4s":
+			segments++
+			f, err := mp4.DecodeFile(bytes.NewReader(data))
+			if err != nil || len(f.Segments) != 1 {
+				t.Fatalf("%s is not an fMP4 media segment: %v", filepath.Base(p), err)
+			}
+			frag := f.Segments[0].Fragments[0]
+			if got := frag.Moof.Traf.Tfdt.BaseMediaDecodeTime(); got != nextDecodeTime {
+				t.Fatalf("%s starts at %d, want %d", filepath.Base(p), got, nextDecodeTime)
+			}
+			samples, err := frag.GetFullSamples(&mp4.TrexBox{TrackID: 1})
+			if err != nil || len(samples) == 0 {
+				t.Fatalf("%s samples: %d, %v", filepath.Base(p), len(samples), err)
+			}
+			for _, s := range samples {
+				if int(binary.BigEndian.Uint32(s.Data))+4 != len(s.Data) {
+					t.Fatalf("%s sample of %d bytes has a NAL unit of %d", filepath.Base(p), len(s.Data), binary.BigEndian.Uint32(s.Data))
+				}
+				nextDecodeTime += uint64(s.Dur)
+			}
+		default:
+			t.Fatalf("unexpected segment %s", p)
+		}
+	}
+	return segments
+}
+
+// checkTS checks data is whole transport stream packets starting with a
+// PAT and a PMT whose CRCs match, with continuous counters on every PID.
+func checkTS(t *testing.T, data []byte) {
+	t.Helper()
+	if len(data)%tsPacketLen != 0 || len(data) < 3*tsPacketLen {
+		t.Fatalf("transport stream of %d bytes", len(data))
+	}
+	cc := map[uint16]int{}
+	for off := 0; off < len(data); off += tsPacketLen {
+		pkt := data[off : off+tsPacketLen]
+		if pkt[0] != 0x47 {
+			t.Fatalf("packet at %d lacks the sync byte", off)
+		}
+		pid := binary.BigEndian.Uint16(pkt[1:]) & 0x1FFF
+		if last, ok := cc[pid]; ok && int(pkt[3]&0x0F) != (last+1)&0x0F {
+			t.Fatalf("PID %#x continuity counter jumps from %d to %d", pid, last, pkt[3]&0x0F)
+		}
+		cc[pid] = int(pkt[3] & 0x0F)
+		if pkt[3]&0x20 != 0 && 5+int(pkt[4]) > tsPacketLen {
+			t.Fatalf("adaptation field of %d bytes", pkt[4])
+		}
+	}
+	for i, pid := range []uint16{0, tsPMTPID} {
+		pkt := data[i*tsPacketLen:]
+		if got := binary.BigEndian.Uint16(pkt[1:]) & 0x1FFF; got != pid {
+			t.Fatalf("packet %d on PID %#x, want %#x", i, got, pid)
+		}
+		n := 3 + int(binary.BigEndian.Uint16(pkt[6:])&0x0FFF)
+		section := pkt[5 : 5+n]
+		if crc32MPEG2(section[:n-4]) != binary.BigEndian.Uint32(section[n-4:]) {
+			t.Fatalf("table on PID %#x has a bad CRC", pid)
+		}
+	}
+	if pkt := data[2*tsPacketLen:]; pkt[1]&0x40 == 0 || !bytes.HasPrefix(pkt[4+1+int(pkt[4]):], []byte{0, 0, 1, 0xE0}) {
+		t.Fatal("third packet does not start a video PES packet")
+	}
+}
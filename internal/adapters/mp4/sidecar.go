@@ -0,0 +1,173 @@
+package mp4
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+const (
+	// thumbnailBox bounds the size of a thumbnail, which keeps the video's
+	// aspect ratio.
+	thumbnailBox = 160
+	// spriteColumns is the number of thumbnails in each row of the sprite.
+	spriteColumns = 10
+	// maxThumbnails bounds the thumbnails of one video, keeping the sprite
+	// within JPEG's dimensions.
+	maxThumbnails = 1000
+)
+
+// sidecarGenerator is the generator Configure returns when the options ask
+// for a poster or thumbnails. It writes them next to each video, with its
+// base name, as a set: the poster as <base>.jpg and the thumbnail track as
+// <base>.vtt, whose cues point into the sprite <base>.thumbs.jpg.
+type sidecarGenerator struct {
+	*Mp4Generator
+}
+
+// WithMetadata returns a copy of the generator that writes m as iTunes-style
+// metadata items.
+func (g *sidecarGenerator) WithMetadata(m ports.Metadata) ports.FileGenerator {
+	c := *g.Mp4Generator
+	c.meta = m
+	return &sidecarGenerator{&c}
+}
+
+// WithOutputFS returns a copy of the generator that writes the video and
+// its sidecars on fsys.
+func (g *sidecarGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g.Mp4Generator
+	c.fs = fsys
+	return &sidecarGenerator{&c}
+}
+
+func (g *sidecarGenerator) Generate(path string, targetSize int64) error {
+	_, err := g.GenerateSetWithOptions(path, targetSize, nil)
+	return err
+}
+
+func (g *sidecarGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	_, err := g.GenerateSetWithOptions(path, targetSize, opts)
+	return err
+}
+
+func (g *sidecarGenerator) GenerateSet(path string, targetSize int64) ([]string, error) {
+	return g.GenerateSetWithOptions(path, targetSize, nil)
+}
+
+// GenerateSetWithOptions writes an MP4 of exactly targetSize bytes, as
+// GenerateWithOptions does, followed by the sidecar files the options ask
+// for, and returns the paths of all of them. The sidecars do not count
+// towards targetSize.
+func (g *sidecarGenerator) GenerateSetWithOptions(path string, targetSize int64, opts ports.Options) ([]string, error) {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	o.meta = g.meta
+	plan, err := generate(g.fs, path, targetSize, o)
+	if err != nil {
+		return []string{path}, err
+	}
+	duration := time.Duration(plan.videoFrames) * time.Second / time.Duration(o.fps)
+	sidecars, err := writeSidecars(g.fs, path, duration, o)
+	return append([]string{path}, sidecars...), err
+}
+
+// writeSidecars writes the sidecar files o asks for on fsys next to the
+// video at path, which plays for duration, and returns their paths.
+func writeSidecars(fsys ports.OutputFS, path string, duration time.Duration, o mp4Options) ([]string, error) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	var paths []string
+	if o.poster {
+		poster := base + ".jpg"
+		paths = append(paths, poster)
+		if err := writeBlackJPEG(fsys, poster, o.width, o.height); err != nil {
+			return paths, err
+		}
+	}
+	if o.thumbnails {
+		count := int((duration + o.thumbInterval - 1) / o.thumbInterval)
+		if count > maxThumbnails {
+			return paths, fmt.Errorf("%s of video needs %d thumbnails at %s intervals, more than %d; raise mp4-thumbnail-interval", duration, count, o.thumbInterval, maxThumbnails)
+		}
+		vtt, sprite := base+".vtt", base+".thumbs.jpg"
+		paths = append(paths, vtt, sprite)
+		tw, th := thumbnailSize(o.width, o.height)
+		if err := writeThumbnailTrack(fsys, vtt, filepath.Base(sprite), duration, o.thumbInterval, tw, th); err != nil {
+			return paths, err
+		}
+		cols := min(count, spriteColumns)
+		rows := (count + spriteColumns - 1) / spriteColumns
+		if err := writeBlackJPEG(fsys, sprite, cols*tw, rows*th); err != nil {
+			return paths, err
+		}
+	}
+	return paths, nil
+}
+
+// thumbnailSize returns the size of the thumbnail of a width x height
+// frame: the frame scaled down, if need be, to fit thumbnailBox.
+func thumbnailSize(width, height int) (int, int) {
+	if width <= thumbnailBox && height <= thumbnailBox {
+		return width, height
+	}
+	if width >= height {
+		return thumbnailBox, max(height*thumbnailBox/width, 1)
+	}
+	return max(width*thumbnailBox/height, 1), thumbnailBox
+}
+
+// writeThumbnailTrack writes a WebVTT track with a cue for every interval
+// of duration, each pointing at its tile, tw x th pixels, in the sprite:
+// row by row, spriteColumns to a row.
+func writeThumbnailTrack(fsys ports.OutputFS, path, sprite string, duration, interval time.Duration, tw, th int) error {
+	f, err := outputfs.Create(fsys, path)
+	if err != nil {
+		return fmt.Errorf("failed to create thumbnail track: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	w.WriteString("WEBVTT\n")
+	for i, start := 0, time.Duration(0); start < duration; i, start = i+1, start+interval {
+		end := min(start+interval, duration)
+		x, y := i%spriteColumns*tw, i/spriteColumns*th
+		fmt.Fprintf(w, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n", vttTime(start), vttTime(end), sprite, x, y, tw, th)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// vttTime formats d as a WebVTT timestamp, hh:mm:ss.ttt.
+func vttTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
+
+// writeBlackJPEG writes a black width x height JPEG, like the video's
+// frames.
+func writeBlackJPEG(fsys ports.OutputFS, path string, width, height int) error {
+	f, err := outputfs.Create(fsys, path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Base(path), err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := jpeg.Encode(w, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", filepath.Base(path), err)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,201 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// MPEG transport stream muxing of the blank H.264 frames, for HLS
+// segments: a PAT and PMT opening each segment, then one PES packet per
+// frame carrying an access unit in Annex B form.
+
+const (
+	tsPacketLen = 188
+	// tsPMTPID and tsVideoPID are the PIDs of the program map table and of
+	// the video stream, which also carries the PCR.
+	tsPMTPID   = 0x1000
+	tsVideoPID = 0x0100
+	// tsFirstPayload is what the first packet of a frame holds after its
+	// header and the adaptation field with the PCR.
+	tsFirstPayload = tsPacketLen - 4 - 8
+	// tsPayload is what any other packet holds after its header.
+	tsPayload = tsPacketLen - 4
+	// pesHeaderLen is a PES header with a PTS.
+	pesHeaderLen = 14
+	// tsDelay is how far each frame's PTS runs ahead of the PCR sent with
+	// it, in 90 kHz ticks.
+	tsDelay = 90000 / 10
+)
+
+// annexBFrame returns a frame as an access unit of start-code-prefixed NAL
+// units: an access unit delimiter, the SPS and PPS, so that every frame
+// can start a segment, and the slice.
+func annexBFrame(sps, slice []byte) []byte {
+	startCode := []byte{0, 0, 0, 1}
+	au := append([]byte{}, startCode...)
+	au = append(au, 0x09, 0xF0) // access unit delimiter: I slices
+	for _, nal := range [][]byte{sps, pps, slice} {
+		au = append(au, startCode...)
+		au = append(au, nal...)
+	}
+	return au
+}
+
+// tsFramePackets returns the number of packets a PES packet carrying an
+// access unit of auLen bytes takes.
+func tsFramePackets(auLen int) int64 {
+	n := int64(pesHeaderLen + auLen)
+	if n <= tsFirstPayload {
+		return 1
+	}
+	return 1 + (n-tsFirstPayload+tsPayload-1)/tsPayload
+}
+
+// tsSegmentSize returns the size of a segment of frames access units of
+// auLen bytes.
+func tsSegmentSize(frames int64, auLen int) int64 {
+	return tsPacketLen * (2 + frames*tsFramePackets(auLen))
+}
+
+// tsMuxer writes transport stream packets, keeping each PID's continuity
+// counter across the segments of a stream.
+type tsMuxer struct {
+	w   io.Writer
+	cc  map[uint16]byte
+	buf [tsPacketLen]byte
+}
+
+func newTSMuxer(w io.Writer) *tsMuxer {
+	return &tsMuxer{w: w, cc: map[uint16]byte{}}
+}
+
+// tables writes the PAT and the PMT of the single program, whose one
+// stream is H.264 video.
+func (m *tsMuxer) tables() error {
+	pat := []byte{
+		0x00,       // table_id: program association section
+		0xB0, 0x0D, // section_syntax_indicator, section_length 13
+		0x00, 0x01, // transport_stream_id
+		0xC1,       // version 0, current
+		0x00, 0x00, // section_number, last_section_number
+		0x00, 0x01, // program_number 1
+		0xE0 | tsPMTPID>>8, tsPMTPID & 0xFF,
+	}
+	if err := m.section(0, pat); err != nil {
+		return err
+	}
+	pmt := []byte{
+		0x02,       // table_id: program map section
+		0xB0, 0x12, // section_syntax_indicator, section_length 18
+		0x00, 0x01, // program_number
+		0xC1,       // version 0, current
+		0x00, 0x00, // section_number, last_section_number
+		0xE0 | tsVideoPID>>8, tsVideoPID & 0xFF, // PCR_PID
+		0xF0, 0x00, // program_info_length
+		0x1B, // stream_type: H.264
+		0xE0 | tsVideoPID>>8, tsVideoPID & 0xFF,
+		0xF0, 0x00, // ES_info_length
+	}
+	return m.section(tsPMTPID, pmt)
+}
+
+// section writes a table section, with its CRC, in one packet.
+func (m *tsMuxer) section(pid uint16, table []byte) error {
+	p := m.header(pid, true, false)
+	p = append(p, 0) // pointer_field
+	p = append(p, table...)
+	p = binary.BigEndian.AppendUint32(p, crc32MPEG2(table))
+	for len(p) < tsPacketLen {
+		p = append(p, 0xFF)
+	}
+	_, err := m.w.Write(p)
+	return err
+}
+
+// frame writes the PES packet of an access unit presented at pts, in 90
+// kHz ticks and at least tsDelay, with the PCR in its first packet.
+func (m *tsMuxer) frame(au []byte, pts uint64) error {
+	pes := make([]byte, 0, pesHeaderLen)
+	pes = append(pes, 0, 0, 1, 0xE0) // start code, video stream 0
+	if n := 8 + len(au); n <= 0xFFFF {
+		pes = binary.BigEndian.AppendUint16(pes, uint16(n))
+	} else {
+		pes = append(pes, 0, 0) // unbounded, as video streams allow
+	}
+	pes = append(pes, 0x80, 0x80, 5) // PTS only, 5 header bytes
+	pes = append(pes,
+		0x21|byte(pts>>29)&0x0E,
+		byte(pts>>22), 0x01|byte(pts>>14)&0xFE,
+		byte(pts>>7), 0x01|byte(pts<<1))
+	payload := append(pes, au...)
+
+	pcr := pts - tsDelay
+	for first := true; len(payload) > 0; first = false {
+		room := tsPayload
+		if first {
+			room = tsFirstPayload
+		}
+		n := min(len(payload), room)
+		// The adaptation field carries the PCR on the first packet and
+		// stuffs out the last.
+		adaptation := first || n < tsPayload
+		p := m.header(tsVideoPID, first, adaptation)
+		if adaptation {
+			fieldLen := tsPacketLen - len(p) - 1 - n
+			p = append(p, byte(fieldLen))
+			if fieldLen > 0 {
+				flags := byte(0)
+				if first {
+					flags = 0x50 // random_access_indicator, PCR_flag
+				}
+				p = append(p, flags)
+				if first {
+					p = append(p, byte(pcr>>25), byte(pcr>>17), byte(pcr>>9), byte(pcr>>1), byte(pcr<<7)|0x7E, 0)
+				}
+				for len(p) < tsPacketLen-n {
+					p = append(p, 0xFF)
+				}
+			}
+		}
+		p = append(p, payload[:n]...)
+		payload = payload[n:]
+		if _, err := m.w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// header returns the header of the next packet of pid, with an
+// adaptation field to follow if adaptation.
+func (m *tsMuxer) header(pid uint16, start, adaptation bool) []byte {
+	p := m.buf[:0]
+	b1 := byte(pid >> 8)
+	if start {
+		b1 |= 0x40 // payload_unit_start_indicator
+	}
+	control := byte(0x10) // payload only
+	if adaptation {
+		control = 0x30
+	}
+	cc := m.cc[pid]
+	m.cc[pid] = (cc + 1) & 0x0F
+	return append(p, 0x47, b1, byte(pid), control|cc)
+}
+
+// crc32MPEG2 returns the CRC of MPEG-2 table sections: polynomial
+// 0x04C11DB7, unreflected, starting from all ones.
+func crc32MPEG2(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
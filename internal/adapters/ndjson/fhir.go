@@ -0,0 +1,198 @@
+package ndjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// FHIR resource types accepted by the "fhir-resource" option.
+const (
+	ResourcePatient     = "Patient"
+	ResourceObservation = "Observation"
+)
+
+const (
+	// fhirReserve is more than any resource with an empty narrative takes,
+	// so the last resource can always be sized to what is left.
+	fhirReserve = 2048
+	// observationsPerPatient is how many observations refer to each
+	// patient, so an Observation file goes with a Patient file of a fifth
+	// as many resources.
+	observationsPerPatient = 5
+
+	divOpen  = `<div xmlns="http://www.w3.org/1999/xhtml">`
+	divClose = `</div>`
+)
+
+// fhirEpoch dates the first resource; each next one is a second later.
+var fhirEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type coding struct {
+	System  string `json:"system"`
+	Code    string `json:"code"`
+	Display string `json:"display,omitempty"`
+}
+
+type codeableConcept struct {
+	Coding []coding `json:"coding"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type quantity struct {
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit"`
+	System string  `json:"system"`
+	Code   string  `json:"code"`
+}
+
+type narrative struct {
+	Status string `json:"status"`
+	Div    string `json:"div"`
+}
+
+type meta struct {
+	LastUpdated string `json:"lastUpdated"`
+}
+
+type patient struct {
+	ResourceType string       `json:"resourceType"`
+	ID           string       `json:"id"`
+	Meta         meta         `json:"meta"`
+	Text         *narrative   `json:"text,omitempty"`
+	Identifier   []identifier `json:"identifier"`
+	Active       bool         `json:"active"`
+	Name         []humanName  `json:"name"`
+	Gender       string       `json:"gender"`
+	BirthDate    string       `json:"birthDate"`
+	Address      []address    `json:"address"`
+}
+
+type identifier struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+}
+
+type humanName struct {
+	Use    string   `json:"use"`
+	Family string   `json:"family"`
+	Given  []string `json:"given"`
+}
+
+type address struct {
+	Line       []string `json:"line"`
+	City       string   `json:"city"`
+	PostalCode string   `json:"postalCode"`
+	Country    string   `json:"country"`
+}
+
+type observation struct {
+	ResourceType      string            `json:"resourceType"`
+	ID                string            `json:"id"`
+	Meta              meta              `json:"meta"`
+	Text              *narrative        `json:"text,omitempty"`
+	Status            string            `json:"status"`
+	Category          []codeableConcept `json:"category"`
+	Code              codeableConcept   `json:"code"`
+	Subject           reference         `json:"subject"`
+	EffectiveDateTime string            `json:"effectiveDateTime"`
+	ValueQuantity     quantity          `json:"valueQuantity"`
+	ReferenceRange    []referenceRange  `json:"referenceRange"`
+}
+
+type reference struct {
+	Reference string `json:"reference"`
+}
+
+type referenceRange struct {
+	Low  quantity `json:"low"`
+	High quantity `json:"high"`
+}
+
+func (p *patient) setText(n *narrative)     { p.Text = n }
+func (o *observation) setText(n *narrative) { o.Text = n }
+
+// fhirResource is a resource that can carry a narrative.
+type fhirResource interface {
+	setText(n *narrative)
+}
+
+func patientID(n int64) string { return fmt.Sprintf("patient-%d", n) }
+
+// newResource returns resource number id of the given type with content
+// drawn from r.
+func newResource(r *utils.Rand, resourceType string, id int64) fhirResource {
+	updated := fhirEpoch.Add(time.Duration(id) * time.Second).Format(time.RFC3339)
+	if resourceType == ResourceObservation {
+		t := utils.RandLabTest(r)
+		ucum := func(v float64) quantity {
+			return quantity{Value: v, Unit: t.Unit, System: "http://unitsofmeasure.org", Code: t.Unit}
+		}
+		return &observation{
+			ResourceType: ResourceObservation,
+			ID:           fmt.Sprintf("observation-%d", id),
+			Meta:         meta{LastUpdated: updated},
+			Status:       "final",
+			Category: []codeableConcept{{Coding: []coding{{
+				System: "http://terminology.hl7.org/CodeSystem/observation-category", Code: "laboratory", Display: "Laboratory",
+			}}}},
+			Code:              codeableConcept{Coding: []coding{{System: "http://loinc.org", Code: t.Code, Display: t.Name}}, Text: t.Name},
+			Subject:           reference{Reference: "Patient/" + patientID(1+(id-1)/observationsPerPatient)},
+			EffectiveDateTime: fhirEpoch.Add(-time.Duration(r.IntN(365*24)) * time.Hour).Format(time.RFC3339),
+			ValueQuantity:     ucum(t.Value(r)),
+			ReferenceRange:    []referenceRange{{Low: ucum(t.Low), High: ucum(t.High)}},
+		}
+	}
+	born := fhirEpoch.AddDate(-18-r.IntN(72), 0, -r.IntN(365))
+	return &patient{
+		ResourceType: ResourcePatient,
+		ID:           patientID(id),
+		Meta:         meta{LastUpdated: updated},
+		Identifier:   []identifier{{System: "urn:genfile:mrn", Value: fmt.Sprintf("%08d", r.IntN(100_000_000))}},
+		Active:       true,
+		Name:         []humanName{{Use: "official", Family: name(r), Given: []string{name(r)}}},
+		Gender:       []string{"female", "male"}[r.IntN(2)],
+		BirthDate:    born.Format("2006-01-02"),
+		Address: []address{{
+			Line:       []string{fmt.Sprintf("%d %s Street", 1+r.IntN(9999), name(r))},
+			City:       name(r),
+			PostalCode: fmt.Sprintf("%05d", r.IntN(100_000)),
+			Country:    "US",
+		}},
+	}
+}
+
+// fhirRecord returns resource res as one line. With n >= 0 a narrative
+// generated from r makes the line exactly n bytes; ok is false if n leaves
+// no room for narrative text.
+func fhirRecord(r *utils.Rand, res fhirResource, n int64) (line string, ok bool) {
+	if n < 0 {
+		return marshal(res), true
+	}
+	res.setText(&narrative{Status: "generated", Div: divOpen + divClose})
+	base := int64(len(marshal(res)))
+	if n <= base {
+		return "", false
+	}
+	res.setText(&narrative{Status: "generated", Div: divOpen + message(r, int(n-base)) + divClose})
+	return marshal(res), true
+}
+
+// marshal returns r as JSON on one line, leaving the markup of narratives
+// unescaped.
+func marshal(r fhirResource) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(r) // the resource types always encode
+	return b.String()
+}
+
+func name(r *utils.Rand) string {
+	w := utils.Lorem.Word(r)
+	return strings.ToUpper(w[:1]) + w[1:]
+}
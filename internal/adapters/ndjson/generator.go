@@ -0,0 +1,270 @@
+package ndjson
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeNDJSON, New())
+}
+
+// minRecordLen is the shortest record line: "{}" and its newline.
+const minRecordLen = 3
+
+var levels = []string{"debug", "info", "info", "info", "warn", "error"}
+
+type NdjsonGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &NdjsonGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *NdjsonGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions("", opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *NdjsonGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// Values of the "ndjson-content" option.
+const (
+	ContentLog  = "log"
+	ContentFHIR = "fhir"
+)
+
+// ndjsonOptions holds the settings the NDJSON generator reads from
+// ports.Options.
+type ndjsonOptions struct {
+	fhir     bool
+	resource string // FHIR resource type
+	rand     *utils.Rand
+}
+
+// parseOptions reads opts for a file at path. A FHIR export file named for
+// its resource type, such as Observation.ndjson, holds that type unless
+// "fhir-resource" says otherwise.
+func parseOptions(path string, opts ports.Options) (ndjsonOptions, error) {
+	o := ndjsonOptions{resource: ResourcePatient}
+	switch c := strings.ToLower(opts.String("ndjson-content", ContentLog)); c {
+	case ContentLog:
+	case ContentFHIR:
+		o.fhir = true
+	default:
+		return o, fmt.Errorf("unknown ndjson content %q (want log or fhir)", c)
+	}
+	def := ResourcePatient
+	if strings.HasPrefix(strings.ToLower(filepath.Base(path)), "observation") {
+		def = ResourceObservation
+	}
+	switch r := opts.String("fhir-resource", def); strings.ToLower(r) {
+	case "patient":
+	case "observation":
+		o.resource = ResourceObservation
+	default:
+		return o, fmt.Errorf("unknown fhir resource %q (want Patient or Observation)", r)
+	}
+	var err error
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *NdjsonGenerator) Generate(path string, targetSize int64) error {
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions writes newline-delimited JSON records until
+// targetSize is reached. By default they are log records, the last one's
+// message lengthened or shortened to fit; with "ndjson-content" fhir they
+// are FHIR bulk export resources of the "fhir-resource" type, the last
+// one's narrative sized to fit.
+func (g *NdjsonGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(path, opts)
+	if err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	return o.writeTo(f, targetSize)
+}
+
+// GenerateTo writes the records GenerateWithOptions would to out.
+func (g *NdjsonGenerator) GenerateTo(out io.Writer, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions("", opts)
+	if err != nil {
+		return err
+	}
+	return o.writeTo(out, targetSize)
+}
+
+func (o ndjsonOptions) writeTo(out io.Writer, targetSize int64) error {
+	if targetSize < 0 {
+		targetSize = 0
+	}
+	if o.fhir {
+		if targetSize > 0 && targetSize < fhirReserve {
+			// The file is one resource.
+			rec, ok := fhirRecord(o.rand, newResource(o.rand, o.resource, 1), targetSize)
+			if !ok {
+				return fmt.Errorf("target %d too small for a FHIR %s resource", targetSize, o.resource)
+			}
+			return writeRecords(out, func(w *bufio.Writer) error {
+				_, err := w.WriteString(rec)
+				return err
+			})
+		}
+		return writeRecords(out, func(w *bufio.Writer) error {
+			for id := int64(1); targetSize > 0; id++ {
+				res := newResource(o.rand, o.resource, id)
+				rec, _ := fhirRecord(o.rand, res, -1)
+				if targetSize-int64(len(rec)) < fhirReserve {
+					// What is left always fits a narrative.
+					rec, _ = fhirRecord(o.rand, res, targetSize)
+				}
+				if _, err := w.WriteString(rec); err != nil {
+					return err
+				}
+				targetSize -= int64(len(rec))
+			}
+			return nil
+		})
+	}
+	if targetSize > 0 && targetSize < minRecordLen {
+		return fmt.Errorf("target %d too small for an NDJSON record; need at least %d", targetSize, minRecordLen)
+	}
+	return writeRecords(out, func(w *bufio.Writer) error {
+		for id := int64(1); targetSize > 0; id++ {
+			rec := record(o.rand, id, -1)
+			if remaining := targetSize - int64(len(rec)); remaining != 0 && remaining < minRecordLen {
+				rec = record(o.rand, id, targetSize)
+			}
+			if _, err := w.WriteString(rec); err != nil {
+				return err
+			}
+			targetSize -= int64(len(rec))
+		}
+		return nil
+	})
+}
+
+// GenerateLines writes exactly lines records. With a byte size as well, the
+// size is spread evenly over the records.
+func (g *NdjsonGenerator) GenerateLines(path string, targetSize, lines int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(path, opts)
+	if err != nil {
+		return err
+	}
+	if !o.fhir && targetSize != ports.AnySize && targetSize < lines*minRecordLen {
+		return fmt.Errorf("target %d too small for %d NDJSON records; need at least %d", targetSize, lines, lines*minRecordLen)
+	}
+	return g.writeFile(path, func(w *bufio.Writer) error {
+		for id := int64(1); id <= lines; id++ {
+			n := int64(-1)
+			if targetSize != ports.AnySize {
+				n = targetSize / lines
+				if id <= targetSize%lines {
+					n++
+				}
+			}
+			if !o.fhir {
+				if _, err := w.WriteString(record(o.rand, id, n)); err != nil {
+					return err
+				}
+				continue
+			}
+			rec, ok := fhirRecord(o.rand, newResource(o.rand, o.resource, id), n)
+			if !ok {
+				return fmt.Errorf("target %d too small for %d FHIR %s resources", targetSize, lines, o.resource)
+			}
+			if _, err := w.WriteString(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (g *NdjsonGenerator) writeFile(path string, fill func(w *bufio.Writer) error) error {
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	return writeRecords(f, fill)
+}
+
+func writeRecords(out io.Writer, fill func(w *bufio.Writer) error) error {
+	w := bufio.NewWriter(out)
+	if err := fill(w); err != nil {
+		return fmt.Errorf("failed to write NDJSON records: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write NDJSON records: %w", err)
+	}
+	return nil
+}
+
+// record returns log record id as one line. With n >= 0 the line is
+// exactly n bytes (at least minRecordLen): the message is cut or extended,
+// and records too short for the usual fields keep only id and message, or
+// become an empty object padded with spaces. Its content is drawn from r.
+func record(r *utils.Rand, id, n int64) string {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(id) * time.Second).Format(time.RFC3339)
+	full := fmt.Sprintf(`{"id":%d,"ts":"%s","level":"%s","user":"%s%d","msg":"%%s"}`+"\n",
+		id, ts, levels[r.IntN(len(levels))], utils.LoremWords[r.IntN(len(utils.LoremWords))], r.IntN(1000))
+	if n < 0 {
+		return fmt.Sprintf(full, utils.RandSentence(r, 4, 16))
+	}
+	short := fmt.Sprintf(`{"id":%d,"msg":"%%s"}`+"\n", id)
+	for _, format := range []string{full, short} {
+		if room := n - int64(len(format)-2); room >= 0 {
+			return fmt.Sprintf(format, message(r, int(room)))
+		}
+	}
+	return "{" + strings.Repeat(" ", int(n)-minRecordLen) + "}\n"
+}
+
+// message returns n bytes of lorem text from r, which needs no JSON
+// escaping.
+func message(r *utils.Rand, n int) string {
+	var b strings.Builder
+	for b.Len() < n {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(utils.RandSentence(r, 4, 16))
+	}
+	return b.String()[:n]
+}
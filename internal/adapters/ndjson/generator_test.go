@@ -0,0 +1,204 @@
+package ndjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// checkRecords verifies every line is a JSON object and returns the count.
+func checkRecords(t *testing.T, path string) int64 {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) == 0 {
+		return 0
+	}
+	if !strings.HasSuffix(string(content), "\n") {
+		t.Fatalf("content does not end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	for i, line := range lines {
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v\n%s", i+1, err, line)
+		}
+		if id, ok := obj["id"]; ok && id != float64(i+1) {
+			t.Fatalf("line %d has id %v", i+1, id)
+		}
+	}
+	return int64(len(lines))
+}
+
+func TestNdjsonGenerator_Generate(t *testing.T) {
+	generator := New()
+	tempDir := t.TempDir()
+
+	for _, size := range []int64{0, 3, 4, 20, 21, 150, 4096, 1 << 20} {
+		t.Run(fmt.Sprintf("Size%d", size), func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("%d.ndjson", size))
+			if err := generator.Generate(outPath, size); err != nil {
+				t.Fatalf("Generate returned unexpected error: %v", err)
+			}
+			info, err := os.Stat(outPath)
+			if err != nil || info.Size() != size {
+				t.Fatalf("size = %v (%v), want %d", info.Size(), err, size)
+			}
+			checkRecords(t, outPath)
+		})
+	}
+
+	t.Run("TooSmall", func(t *testing.T) {
+		err := generator.Generate(filepath.Join(tempDir, "small.ndjson"), 2)
+		if err == nil || !strings.Contains(err.Error(), "too small") {
+			t.Errorf("expected too small error, got %v", err)
+		}
+	})
+}
+
+func TestNdjsonGenerator_GenerateLines(t *testing.T) {
+	generator := &NdjsonGenerator{}
+	var _ ports.LineGenerator = generator
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name   string
+		size   int64
+		lines  int64
+		errSub string
+	}{
+		{"LinesOnly", ports.AnySize, 10000, ""},
+		{"LinesAndSize", 1 << 20, 1234, ""},
+		{"ShortRecords", 60, 20, ""},
+		{"MixedRecords", 150, 7, ""},
+		{"TooSmall", 59, 20, "too small"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, tc.name+".ndjson")
+			err := generator.GenerateLines(outPath, tc.size, tc.lines, nil)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("expected error containing %q, got %v", tc.errSub, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateLines returned unexpected error: %v", err)
+			}
+			if n := checkRecords(t, outPath); n != tc.lines {
+				t.Errorf("got %d records, want %d", n, tc.lines)
+			}
+			if info, _ := os.Stat(outPath); tc.size != ports.AnySize && info.Size() != tc.size {
+				t.Errorf("size = %d, want %d", info.Size(), tc.size)
+			}
+		})
+	}
+}
+
+func TestNdjsonGenerator_FHIR(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name     string
+		file     string
+		size     int64
+		opts     ports.Options
+		resource string // want
+		errSub   string
+	}{
+		{name: "Patients", file: "export.ndjson", size: 64 * 1024, resource: ResourcePatient},
+		{name: "OnePatient", file: "export.ndjson", size: 1000, resource: ResourcePatient},
+		{name: "ObservationsByName", file: "Observation.ndjson", size: 1024*1024 + 5, resource: ResourceObservation},
+		{name: "ObservationsByOption", file: "export.ndjson", size: 3000, opts: ports.Options{"fhir-resource": "observation"}, resource: ResourceObservation},
+		{name: "PatientsOverName", file: "Observation.ndjson", size: 5000, opts: ports.Options{"fhir-resource": "Patient"}, resource: ResourcePatient},
+		{name: "TooSmall", file: "export.ndjson", size: 100, errSub: "too small"},
+		{name: "UnknownResource", file: "export.ndjson", size: 4096, opts: ports.Options{"fhir-resource": "Encounter"}, errSub: "unknown fhir resource"},
+		{name: "UnknownContent", file: "export.ndjson", size: 4096, opts: ports.Options{"ndjson-content": "hl7"}, errSub: "unknown ndjson content"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := ports.Options{"ndjson-content": "fhir"}
+			for k, v := range tc.opts {
+				opts[k] = v
+			}
+			path := filepath.Join(t.TempDir(), tc.file)
+			err := generator.GenerateWithOptions(path, tc.size, opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			if info, _ := os.Stat(path); info.Size() != tc.size {
+				t.Fatalf("size = %d, want %d", info.Size(), tc.size)
+			}
+			checkResources(t, path, tc.resource)
+		})
+	}
+}
+
+func TestNdjsonGenerator_FHIRLines(t *testing.T) {
+	generator := New().(ports.LineGenerator)
+	opts := ports.Options{"ndjson-content": "fhir", "fhir-resource": "Observation"}
+	path := filepath.Join(t.TempDir(), "export.ndjson")
+	if err := generator.GenerateLines(path, 1<<20, 500, opts); err != nil {
+		t.Fatal(err)
+	}
+	if n := checkResources(t, path, ResourceObservation); n != 500 {
+		t.Errorf("got %d resources, want 500", n)
+	}
+	if info, _ := os.Stat(path); info.Size() != 1<<20 {
+		t.Errorf("size = %d, want %d", info.Size(), 1<<20)
+	}
+	if err := generator.GenerateLines(path, 5000, 500, opts); err == nil || !strings.Contains(err.Error(), "too small") {
+		t.Errorf("expected too small error, got %v", err)
+	}
+}
+
+// checkResources verifies every line is a FHIR resource of type
+// resourceType with sequential ids and returns the count.
+func checkResources(t *testing.T, path, resourceType string) int {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	for i, line := range lines {
+		var r struct {
+			ResourceType string `json:"resourceType"`
+			ID           string `json:"id"`
+			Text         *struct {
+				Div string `json:"div"`
+			} `json:"text"`
+			Subject struct {
+				Reference string `json:"reference"`
+			} `json:"subject"`
+		}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %d is not JSON: %v\n%s", i+1, err, line)
+		}
+		if r.ResourceType != resourceType || r.ID != fmt.Sprintf("%s-%d", strings.ToLower(resourceType), i+1) {
+			t.Fatalf("line %d is %s %q, want %s number %d", i+1, r.ResourceType, r.ID, resourceType, i+1)
+		}
+		if r.Text != nil && !strings.HasPrefix(r.Text.Div, divOpen) {
+			t.Fatalf("line %d narrative is not XHTML: %q", i+1, r.Text.Div)
+		}
+		if resourceType == ResourceObservation && r.Subject.Reference != "Patient/"+patientID(int64(1+i/observationsPerPatient)) {
+			t.Fatalf("line %d subject = %q", i+1, r.Subject.Reference)
+		}
+	}
+	return len(lines)
+}
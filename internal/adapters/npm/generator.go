@@ -0,0 +1,199 @@
+package npm
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeNPM, New())
+}
+
+// NpmGenerator writes npm package tarballs, as npm pack writes them: a
+// gzipped tarball of package/package.json and one file of random data that
+// pads the package.
+type NpmGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &NpmGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *NpmGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *NpmGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	blockSize = 512
+	// maxNameLen is the longest package name the registry accepts.
+	maxNameLen = 214
+
+	defaultName    = "genfile-fixture"
+	defaultVersion = "1.0.0"
+	payloadName    = "payload.bin"
+)
+
+var (
+	// nameRe matches package names, optionally scoped, as the registry
+	// accepts new ones.
+	nameRe = regexp.MustCompile(`^(?:@[a-z0-9~-][a-z0-9._~-]*/)?[a-z0-9~-][a-z0-9._~-]*$`)
+	// versionRe matches semantic versions.
+	versionRe = regexp.MustCompile(`^(?:0|[1-9][0-9]*)\.(?:0|[1-9][0-9]*)\.(?:0|[1-9][0-9]*)(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?$`)
+)
+
+// npmOptions holds the settings the npm generator reads from ports.Options.
+type npmOptions struct {
+	name, version string
+	modTime       time.Time    // zero for the time of generation
+	filler        utils.Filler // of the payload
+	rand          *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (npmOptions, error) {
+	o := npmOptions{
+		name:    opts.String("pkg-name", defaultName),
+		version: opts.String("pkg-version", defaultVersion),
+	}
+	if len(o.name) > maxNameLen || !nameRe.MatchString(o.name) {
+		return o, fmt.Errorf("invalid package name %q: use lowercase letters, digits, '-', '.', '_' and '~', optionally scoped as @scope/name", o.name)
+	}
+	if !versionRe.MatchString(o.version) {
+		return o, fmt.Errorf("invalid package version %q: use a semantic version such as %s", o.version, defaultVersion)
+	}
+	var err error
+	if o.modTime, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	if o.filler, err = utils.ParseFiller(o.rand, opts.String("entropy", ""), opts.String("shared-blocks", ""), opts.String("shared-pool", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *NpmGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes an npm package tarball of exactly size bytes.
+// The package is named "pkg-name" (genfile-fixture) at version
+// "pkg-version" (1.0.0), and ships package/payload.bin, random data that
+// makes up the size. The "mtime" option dates the files; "entropy" sets
+// the share of the payload that is random, the rest repeating a pattern,
+// and "shared-blocks" the share drawn from the "shared-pool" chunk pool.
+func (g *NpmGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.modTime.IsZero() {
+		o.modTime = time.Now()
+	}
+	o.modTime = o.modTime.UTC().Truncate(time.Second)
+
+	manifest, err := packageJSON(o)
+	if err != nil {
+		return err
+	}
+	// The tarball holds package.json and the payload, each a header and
+	// whole blocks, then the two blocks ending the archive.
+	base := blockSize + roundUp(int64(len(manifest))) + blockSize + 2*blockSize
+	n, extra, ok := utils.FitStoredGzip(size, base, blockSize)
+	if !ok {
+		return fmt.Errorf("target %d too small for an npm package; any size from %d bytes fits", size, utils.StoredGzipSize(base+4*blockSize, 0))
+	}
+	payload := n - base
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriterSize(f, 1<<20)
+	gz := utils.NewStoredGzip(bw, extra)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(header("package/package.json", int64(len(manifest)), o.modTime)); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return fmt.Errorf("failed to write package.json: %w", err)
+	}
+	if err := tw.WriteHeader(header("package/"+payloadName, payload, o.modTime)); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	if err := o.filler.Write(o.rand, tw, payload); err != nil {
+		return fmt.Errorf("failed to write %s: %w", payloadName, err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	return f.Sync()
+}
+
+// packageJSON returns the package's manifest, indented as npm writes it.
+func packageJSON(o npmOptions) ([]byte, error) {
+	manifest := struct {
+		Name        string   `json:"name"`
+		Version     string   `json:"version"`
+		Description string   `json:"description"`
+		License     string   `json:"license"`
+		Files       []string `json:"files"`
+	}{o.name, o.version, "Test fixture generated by genfile", "UNLICENSED", []string{payloadName}}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode package.json: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// header returns the tar header of a file. GNU headers take one block
+// whatever the size.
+func header(name string, size int64, modTime time.Time) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  modTime,
+		Format:   tar.FormatGNU,
+	}
+}
+
+func roundUp(n int64) int64 {
+	return (n + blockSize - 1) / blockSize * blockSize
+}
@@ -0,0 +1,91 @@
+package npm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestNpmGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name             string
+		size             int64
+		opts             ports.Options
+		pkgName, version string // want
+		errSub           string
+	}{
+		{name: "Default", size: 1 << 20, pkgName: "genfile-fixture", version: "1.0.0"},
+		{name: "Small", size: 5001, pkgName: "genfile-fixture", version: "1.0.0"},
+		{name: "Scoped", size: 77777, opts: ports.Options{"pkg-name": "@acme/shop", "pkg-version": "2.0.0-beta.1"}, pkgName: "@acme/shop", version: "2.0.0-beta.1"},
+		{name: "TooSmall", size: 2000, errSub: "too small"},
+		{name: "BadName", size: 10000, opts: ports.Options{"pkg-name": "Shop"}, errSub: "invalid package name"},
+		{name: "BadVersion", size: 10000, opts: ports.Options{"pkg-version": "1.0"}, errSub: "invalid package version"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixture.tgz")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("gzip.NewReader() error = %v", err)
+			}
+			files := map[string][]byte{}
+			var names []string
+			tr := tar.NewReader(zr)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("reading tarball: %v", err)
+				}
+				names = append(names, hdr.Name)
+				if files[hdr.Name], err = io.ReadAll(tr); err != nil {
+					t.Fatalf("reading %s: %v", hdr.Name, err)
+				}
+			}
+			// The gzip stream must end where the file does.
+			if _, err := io.Copy(io.Discard, zr); err != nil {
+				t.Fatalf("reading gzip stream: %v", err)
+			}
+			if want := []string{"package/package.json", "package/payload.bin"}; strings.Join(names, ",") != strings.Join(want, ",") {
+				t.Errorf("entries = %v, want %v", names, want)
+			}
+			var manifest struct{ Name, Version string }
+			if err := json.Unmarshal(files["package/package.json"], &manifest); err != nil {
+				t.Fatalf("package.json: %v", err)
+			}
+			if manifest.Name != tc.pkgName || manifest.Version != tc.version {
+				t.Errorf("package.json = %s@%s, want %s@%s", manifest.Name, manifest.Version, tc.pkgName, tc.version)
+			}
+		})
+	}
+}
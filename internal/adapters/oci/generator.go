@@ -0,0 +1,499 @@
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeOCI, New())
+}
+
+// OciGenerator writes container images as docker save does since Docker
+// 25: a tar archive that is both an OCI image layout and a Docker image
+// archive, so docker load, skopeo and image scanners all read it. Its
+// layers are gzipped tarballs of random data sized to the target.
+type OciGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &OciGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *OciGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *OciGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	// blockSize is the tar block; archives are made of whole blocks.
+	blockSize = 512
+	// maxLayers is the most layers Docker allows an image.
+	maxLayers = 127
+	// layerTarOverhead is a layer tarball's file header and end-of-archive
+	// blocks.
+	layerTarOverhead = 3 * blockSize
+	defaultRef       = "genfile:latest"
+
+	mediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeLayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+var (
+	// repositoryRe matches an image name: an optional registry host and
+	// lowercase path components.
+	repositoryRe = regexp.MustCompile(`^(?:[A-Za-z0-9.-]+(?::[0-9]+)?/)?[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagRe        = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// ociOptions holds the settings the OCI generator reads from ports.Options.
+type ociOptions struct {
+	layers     int
+	repository string
+	tag        string
+	created    time.Time   // zero for the time of generation
+	rand       *utils.Rand // seeds the layers' data
+}
+
+func parseOptions(opts ports.Options) (ociOptions, error) {
+	var o ociOptions
+	var err error
+	if o.layers, err = opts.Int("oci-layers", 1); err != nil {
+		return o, err
+	}
+	if o.layers < 1 || o.layers > maxLayers {
+		return o, fmt.Errorf("OCI layer count must be between 1 and %d, got %d", maxLayers, o.layers)
+	}
+	ref := opts.String("oci-ref", defaultRef)
+	o.repository, o.tag = ref, "latest"
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		o.repository, o.tag = ref[:i], ref[i+1:]
+	}
+	if !repositoryRe.MatchString(o.repository) || !tagRe.MatchString(o.tag) {
+		return o, fmt.Errorf("invalid image reference %q (want name[:tag], e.g. %s)", ref, defaultRef)
+	}
+	if o.created, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *OciGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes an image archive of exactly size bytes. The
+// image has "oci-layers" layers (one by default), each a gzipped tarball
+// holding one file of random data, sharing the size evenly, and is tagged
+// "oci-ref" (genfile:latest). The "mtime" option dates the image and its
+// files. Past the last whole 512-byte tar block, the archive ends in zeros
+// after its end-of-archive marker, as tar pads archives to its record size.
+func (g *OciGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.created.IsZero() {
+		o.created = time.Now()
+	}
+	o.created = o.created.UTC().Truncate(time.Second)
+	img, err := layout(o, size)
+	if err != nil {
+		return err
+	}
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriterSize(f, 1<<20)
+	tw := tar.NewWriter(bw)
+	for _, dir := range []string{"blobs/", "blobs/sha256/"} {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0o755, ModTime: o.created, Format: tar.FormatGNU}); err != nil {
+			return fmt.Errorf("failed to write image archive: %w", err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write image archive: %w", err)
+	}
+
+	// Blobs are named by digest: each layer is hashed as it is written,
+	// past the block its header takes, and the header is written once the
+	// digest is known.
+	at := int64(2 * blockSize)
+	for i := range img.layers {
+		l := &img.layers[i]
+		o.rand.Read(l.seed[:])
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("failed to write image archive: %w", err)
+		}
+		if _, err := f.Seek(at+blockSize, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to write image archive: %w", err)
+		}
+		blob, diff := sha256.New(), sha256.New()
+		cw := &countingWriter{w: io.MultiWriter(bw, blob)}
+		if err := l.write(cw, diff, i, o.created); err != nil {
+			return fmt.Errorf("failed to write layer %d: %w", i+1, err)
+		}
+		if cw.n != l.gzipSize() {
+			return fmt.Errorf("layer %d came out at %d bytes, want %d", i+1, cw.n, l.gzipSize())
+		}
+		if _, err := bw.Write(make([]byte, roundUp(cw.n)-cw.n)); err != nil {
+			return fmt.Errorf("failed to write layer %d: %w", i+1, err)
+		}
+		l.digest, l.diffID = digestOf(blob), digestOf(diff)
+		var head bytes.Buffer
+		if err := tar.NewWriter(&head).WriteHeader(fileHeader(blobPath(l.digest), l.gzipSize(), o.created)); err != nil {
+			return fmt.Errorf("failed to write image archive: %w", err)
+		}
+		if _, err := f.WriteAt(head.Bytes(), at); err != nil {
+			return fmt.Errorf("failed to write image archive: %w", err)
+		}
+		at += blockSize + roundUp(cw.n)
+	}
+	docs, err := img.documents()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := tw.WriteHeader(fileHeader(doc.name, int64(len(doc.data)), o.created)); err != nil {
+			return fmt.Errorf("failed to write image archive: %w", err)
+		}
+		if _, err := tw.Write(doc.data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", doc.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write image archive: %w", err)
+	}
+	if _, err := bw.Write(make([]byte, size%blockSize)); err != nil {
+		return fmt.Errorf("failed to write image archive: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write image archive: %w", err)
+	}
+	return f.Sync()
+}
+
+// Plan describes the image GenerateWithOptions would write for sizeBytes.
+func (g *OciGenerator) Plan(sizeBytes int64) (ports.GenerationPlan, error) {
+	o, err := parseOptions(g.opts)
+	if err != nil {
+		return ports.GenerationPlan{}, err
+	}
+	minimal := image{o: o, layers: make([]layer, o.layers)}
+	plan := ports.GenerationPlan{TargetSize: sizeBytes, MinSize: minimal.size()}
+	img, err := layout(o, sizeBytes)
+	if err != nil {
+		return plan, nil
+	}
+	plan.PaddingBytes = sizeBytes % blockSize
+	for _, l := range img.layers {
+		plan.PaddingBytes += l.data
+	}
+	plan.ContentBytes = sizeBytes - plan.PaddingBytes
+	plan.Structure = []ports.PlanItem{{Name: "layers", Count: int64(o.layers)}}
+	return plan, nil
+}
+
+// layer is one layer of an image: a gzipped tarball holding a file of
+// data bytes of seeded random data.
+type layer struct {
+	data   int64
+	extra  int // empty deflate blocks padding the gzip stream
+	seed   [32]byte
+	digest string // of the gzip blob
+	diffID string // of the tarball
+}
+
+func (l layer) tarSize() int64 {
+	return layerTarOverhead + roundUp(l.data)
+}
+
+func (l layer) gzipSize() int64 {
+	return utils.StoredGzipSize(l.tarSize(), l.extra)
+}
+
+// fit sizes l to take up exactly blocks tar blocks of the image archive,
+// or reports that it cannot.
+func (l *layer) fit(blocks int64) bool {
+	room := blocks * blockSize
+	// The largest tarball whose gzip stream fits the room; the deflate
+	// block headers depend on its length.
+	n := room - utils.StoredGzipSize(0, 0)
+	for i := 0; i < 3; i++ {
+		n = (room - utils.StoredGzipSize(n, 0) + n) / blockSize * blockSize
+	}
+	if n < layerTarOverhead {
+		return false
+	}
+	l.data, l.extra = n-layerTarOverhead, 0
+	// Pad the stream into the last block if it falls short of it.
+	for l.gzipSize() <= room-blockSize {
+		l.extra++
+	}
+	return l.gzipSize() <= room
+}
+
+// write writes the gzipped layer to w, and the tarball to diff if set.
+func (l layer) write(w io.Writer, diff io.Writer, index int, modTime time.Time) error {
+	gz := utils.NewStoredGzip(w, l.extra)
+	var tw *tar.Writer
+	if diff != nil {
+		tw = tar.NewWriter(io.MultiWriter(gz, diff))
+	} else {
+		tw = tar.NewWriter(gz)
+	}
+	if err := tw.WriteHeader(fileHeader(fmt.Sprintf("genfile/layer-%d.bin", index+1), l.data, modTime)); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(tw, rand.NewChaCha8(l.seed), l.data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// image is the layout of an image archive.
+type image struct {
+	o      ociOptions
+	layers []layer
+}
+
+// layout sizes the layers of an image archive of exactly size bytes
+// rounded down to whole tar blocks.
+func layout(o ociOptions, size int64) (image, error) {
+	img := image{o: o, layers: make([]layer, o.layers)}
+	if minimum := img.size(); size < minimum {
+		return img, fmt.Errorf("target %d too small for an image of %d layers; need at least %d bytes", size, o.layers, minimum)
+	}
+	size -= size % blockSize
+	// The documents list the layer sizes, so their own size can change
+	// as the layers are fitted; a few rounds settle it.
+	for i := 0; i < 8; i++ {
+		rest := size - img.size()
+		if rest == 0 {
+			return img, nil
+		}
+		var layerBlocks int64
+		for _, l := range img.layers {
+			layerBlocks += blocksOf(l.gzipSize())
+		}
+		total := layerBlocks + rest/blockSize
+		for j := range img.layers {
+			share := total / int64(len(img.layers))
+			if int64(j) < total%int64(len(img.layers)) {
+				share++
+			}
+			if !img.layers[j].fit(share) {
+				return img, fmt.Errorf("target %d too small for an image of %d layers", size, o.layers)
+			}
+		}
+	}
+	return img, fmt.Errorf("failed to converge on the layer sizes for target size %d", size)
+}
+
+// size returns the size of the image archive: two directories, the layer
+// blobs and the documents, and the end-of-archive blocks.
+func (img image) size() int64 {
+	n := int64(2*blockSize) + 2*blockSize
+	for _, l := range img.layers {
+		n += blockSize + blocksOf(l.gzipSize())*blockSize
+	}
+	docs, _ := img.documents()
+	for _, doc := range docs {
+		n += blockSize + blocksOf(int64(len(doc.data)))*blockSize
+	}
+	return n
+}
+
+// document is a JSON file of the image archive.
+type document struct {
+	name string
+	data []byte
+}
+
+// documents returns the config and manifest blobs, the OCI index and
+// layout marker and Docker's manifest.json and repositories, in that
+// order. Before the layers are hashed, their digests are zeros of the
+// same length.
+func (img image) documents() ([]document, error) {
+	type descriptor struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Size        int64             `json:"size"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+	created := img.o.created.Format(time.RFC3339)
+	var layers []descriptor
+	var diffIDs, layerPaths []string
+	var history []map[string]any
+	for i, l := range img.layers {
+		digest, diffID := l.digest, l.diffID
+		if digest == "" {
+			digest, diffID = zeroDigest, zeroDigest
+		}
+		layers = append(layers, descriptor{MediaType: mediaTypeLayer, Digest: digest, Size: l.gzipSize()})
+		diffIDs = append(diffIDs, diffID)
+		layerPaths = append(layerPaths, blobPath(digest))
+		history = append(history, map[string]any{"created": created, "created_by": fmt.Sprintf("genfile: layer %d", i+1)})
+	}
+	config, err := json.Marshal(map[string]any{
+		"architecture": "amd64",
+		"os":           "linux",
+		"created":      created,
+		"config":       map[string]any{"Env": []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"}},
+		"rootfs":       map[string]any{"type": "layers", "diff_ids": diffIDs},
+		"history":      history,
+	})
+	if err != nil {
+		return nil, err
+	}
+	configDigest := digestBytes(config)
+	manifest, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeManifest,
+		"config":        descriptor{MediaType: mediaTypeConfig, Digest: configDigest, Size: int64(len(config))},
+		"layers":        layers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifestDigest := digestBytes(manifest)
+	ref := img.o.repository + ":" + img.o.tag
+	index, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeIndex,
+		"manifests": []descriptor{{
+			MediaType: mediaTypeManifest,
+			Digest:    manifestDigest,
+			Size:      int64(len(manifest)),
+			Annotations: map[string]string{
+				"io.containerd.image.name":          fullName(img.o.repository) + ":" + img.o.tag,
+				"org.opencontainers.image.ref.name": img.o.tag,
+			},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	dockerManifest, err := json.Marshal([]map[string]any{{
+		"Config":   blobPath(configDigest),
+		"RepoTags": []string{ref},
+		"Layers":   layerPaths,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	repositories, err := json.Marshal(map[string]map[string]string{
+		img.o.repository: {img.o.tag: strings.TrimPrefix(configDigest, "sha256:")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []document{
+		{blobPath(configDigest), config},
+		{blobPath(manifestDigest), manifest},
+		{"index.json", index},
+		{"manifest.json", dockerManifest},
+		{"oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)},
+		{"repositories", repositories},
+	}, nil
+}
+
+// fullName returns the image name repository stands for, with Docker's
+// default registry and namespace when it names none.
+func fullName(repository string) string {
+	first, _, ok := strings.Cut(repository, "/")
+	switch {
+	case ok && (strings.ContainsAny(first, ".:") || first == "localhost"):
+		return repository
+	case ok:
+		return "docker.io/" + repository
+	default:
+		return "docker.io/library/" + repository
+	}
+}
+
+var zeroDigest = "sha256:" + strings.Repeat("0", 2*sha256.Size)
+
+func digestOf(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func digestBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// blobPath is where the blob with digest lives in an image layout.
+func blobPath(digest string) string {
+	return "blobs/sha256/" + strings.TrimPrefix(digest, "sha256:")
+}
+
+// fileHeader is the header of a regular file. The GNU format keeps every
+// header to one block whatever the size.
+func fileHeader(name string, size int64, modTime time.Time) *tar.Header {
+	return &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0o644, ModTime: modTime, Format: tar.FormatGNU}
+}
+
+func blocksOf(n int64) int64 {
+	return (n + blockSize - 1) / blockSize
+}
+
+func roundUp(n int64) int64 {
+	return blocksOf(n) * blockSize
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,161 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestOciGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name   string
+		size   int64
+		opts   ports.Options
+		layers int    // want
+		ref    string // want
+		errSub string
+	}{
+		{name: "Default", size: 1 << 20, layers: 1, ref: "genfile:latest"},
+		{name: "Unaligned", size: 1000003, layers: 1, ref: "genfile:latest"},
+		{name: "Layers", size: 3 << 20, opts: ports.Options{"oci-layers": "3", "oci-ref": "registry.local:5000/team/app:1.2"}, layers: 3, ref: "registry.local:5000/team/app:1.2"},
+		{name: "Smallest", size: 10752, layers: 1, ref: "genfile:latest"},
+		{name: "TooSmall", size: 10000, errSub: "too small"},
+		{name: "BadRef", size: 1 << 20, opts: ports.Options{"oci-ref": "Bad Name"}, errSub: "invalid image reference"},
+		{name: "BadLayers", size: 1 << 20, opts: ports.Options{"oci-layers": "200"}, errSub: "between 1 and"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image.tar")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			checkImage(t, data, tc.layers, tc.ref)
+		})
+	}
+}
+
+// checkImage reads the image archive in data and checks that its blobs
+// match their digests, that the manifests list layers layers whose
+// diff_ids match the tarballs, and that it is tagged ref.
+func checkImage(t *testing.T, data []byte, layers int, ref string) {
+	t.Helper()
+	files := map[string][]byte{}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading the archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if files[hdr.Name], err = io.ReadAll(tr); err != nil {
+			t.Fatalf("reading %s: %v", hdr.Name, err)
+		}
+	}
+	for name, content := range files {
+		if digest, ok := strings.CutPrefix(name, "blobs/sha256/"); ok {
+			if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != digest {
+				t.Errorf("blob %s does not match its digest", name)
+			}
+		}
+	}
+	if string(files["oci-layout"]) != `{"imageLayoutVersion":"1.0.0"}` {
+		t.Errorf("oci-layout = %q", files["oci-layout"])
+	}
+
+	var dockerManifest []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	if err := json.Unmarshal(files["manifest.json"], &dockerManifest); err != nil {
+		t.Fatalf("manifest.json: %v", err)
+	}
+	if len(dockerManifest) != 1 || len(dockerManifest[0].RepoTags) != 1 || dockerManifest[0].RepoTags[0] != ref {
+		t.Fatalf("manifest.json = %s, want the image tagged %s", files["manifest.json"], ref)
+	}
+	var config struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := json.Unmarshal(files[dockerManifest[0].Config], &config); err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	if len(dockerManifest[0].Layers) != layers || len(config.RootFS.DiffIDs) != layers {
+		t.Fatalf("image has %d layers and %d diff_ids, want %d", len(dockerManifest[0].Layers), len(config.RootFS.DiffIDs), layers)
+	}
+	for i, name := range dockerManifest[0].Layers {
+		zr, err := gzip.NewReader(bytes.NewReader(files[name]))
+		if err != nil {
+			t.Fatalf("layer %d: %v", i+1, err)
+		}
+		layerTar, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("layer %d: %v", i+1, err)
+		}
+		if sum := sha256.Sum256(layerTar); "sha256:"+hex.EncodeToString(sum[:]) != config.RootFS.DiffIDs[i] {
+			t.Errorf("layer %d does not match its diff_id", i+1)
+		}
+	}
+
+	var index struct {
+		Manifests []struct {
+			Digest      string
+			Annotations map[string]string
+		}
+	}
+	if err := json.Unmarshal(files["index.json"], &index); err != nil {
+		t.Fatalf("index.json: %v", err)
+	}
+	if len(index.Manifests) != 1 || files[blobPath(index.Manifests[0].Digest)] == nil {
+		t.Fatalf("index.json = %s, want one manifest in the blobs", files["index.json"])
+	}
+	if got, want := index.Manifests[0].Annotations["org.opencontainers.image.ref.name"], ref[strings.LastIndex(ref, ":")+1:]; got != want {
+		t.Errorf("ref.name annotation = %q, want %q", got, want)
+	}
+}
+
+func TestFullName(t *testing.T) {
+	tests := []struct{ repository, want string }{
+		{"genfile", "docker.io/library/genfile"},
+		{"team/app", "docker.io/team/app"},
+		{"registry.local:5000/app", "registry.local:5000/app"},
+		{"localhost/app", "localhost/app"},
+	}
+	for _, tc := range tests {
+		if got := fullName(tc.repository); got != tc.want {
+			t.Errorf("fullName(%q) = %q, want %q", tc.repository, got, tc.want)
+		}
+	}
+}
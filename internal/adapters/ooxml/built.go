@@ -0,0 +1,29 @@
+package ooxml
+
+import (
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// Built is a generator of one package built in advance, for documents
+// sized by their content rather than in bytes: it writes the package as it
+// is at its own size, padded at larger sizes. The options it was built
+// with are all it applies; those passed to GenerateWithOptions are
+// ignored.
+type Built struct {
+	Package []byte
+	FS      ports.OutputFS // the file system written to; OS if nil
+}
+
+func (b Built) Generate(path string, size int64) error {
+	if size == int64(len(b.Package)) {
+		return outputfs.WriteFile(b.FS, path, b.Package)
+	}
+	return WritePadded(b.FS, path, b.Package, size, time.Time{})
+}
+
+func (b Built) GenerateWithOptions(path string, size int64, _ ports.Options) error {
+	return b.Generate(path, size)
+}
@@ -0,0 +1,101 @@
+// Package ooxml writes Office Open XML packages: the zip container with its
+// content types and relationships, document properties parts, and the
+// padding, in an entry, the comment or extra fields, that brings a package
+// to an exact size.
+package ooxml
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Part is a package part and how the package refers to it.
+type Part struct {
+	Name        string // part name within the zip, without a leading slash
+	ContentType string // override content type; empty for the extension default
+	RelType     string // package relationship type; empty if the package does not refer to it
+	Body        string
+}
+
+// Package writes the parts of an OOXML package to a zip.
+type Package struct {
+	zw       *zip.Writer
+	modified time.Time
+	err      error
+}
+
+// NewPackage returns a Package writing to w whose parts are dated
+// modified, or undated if it is zero.
+func NewPackage(w io.Writer, modified time.Time) *Package {
+	return &Package{zw: zip.NewWriter(w), modified: modified}
+}
+
+// Add adds the part name holding body, deflated.
+func (p *Package) Add(name, body string) {
+	if p.err != nil {
+		return
+	}
+	w, err := p.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: p.modified})
+	if err != nil {
+		p.err = fmt.Errorf("failed to add part %s: %w", name, err)
+		return
+	}
+	if _, err := io.WriteString(w, body); err != nil {
+		p.err = fmt.Errorf("failed to write part %s: %w", name, err)
+	}
+}
+
+// AddParts adds each of parts.
+func (p *Package) AddParts(parts []Part) {
+	for _, part := range parts {
+		p.Add(part.Name, part.Body)
+	}
+}
+
+// AddContentTypes adds [Content_Types].xml, with defaults for the
+// relationship and XML extensions and an override for each of parts that
+// has a content type.
+func (p *Package) AddContentTypes(parts []Part) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+  <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+  <Default Extension="xml" ContentType="application/xml"/>
+`)
+	for _, part := range parts {
+		if part.ContentType != "" {
+			fmt.Fprintf(&b, "  <Override PartName=\"/%s\" ContentType=\"%s\"/>\n", part.Name, part.ContentType)
+		}
+	}
+	b.WriteString(`</Types>`)
+	p.Add("[Content_Types].xml", b.String())
+}
+
+// AddRelationships adds _rels/.rels relating the package to each of parts
+// that has a relationship type, numbered rId1 on in order.
+func (p *Package) AddRelationships(parts []Part) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+`)
+	id := 1
+	for _, part := range parts {
+		if part.RelType != "" {
+			fmt.Fprintf(&b, "  <Relationship Id=\"rId%d\"\n    Type=\"%s\"\n    Target=\"%s\"/>\n", id, part.RelType, part.Name)
+			id++
+		}
+	}
+	b.WriteString(`</Relationships>`)
+	p.Add("_rels/.rels", b.String())
+}
+
+// Close finishes the zip, returning the first error met writing it.
+func (p *Package) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+	return p.zw.Close()
+}
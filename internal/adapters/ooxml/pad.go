@@ -0,0 +1,293 @@
+package ooxml
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// padName names the stored entry of zero bytes that pads a package.
+const padName = "pad.bin"
+
+// Padding says where the bytes that bring a package to its size go.
+type Padding int
+
+const (
+	// PadEntry adds a stored entry, pad.bin, of zeros.
+	PadEntry Padding = iota
+	// PadComment writes the archive comment, of at most 65,535 bytes.
+	PadComment
+	// PadExtra adds an extra field to the headers of the parts, which
+	// take an even number of bytes of 8 or more, and writes what is left
+	// in the archive comment.
+	PadExtra
+)
+
+// ParsePadding returns the padding named s: entry, comment or extra.
+func ParsePadding(s string) (Padding, error) {
+	switch s {
+	case "entry":
+		return PadEntry, nil
+	case "comment":
+		return PadComment, nil
+	case "extra":
+		return PadExtra, nil
+	}
+	return 0, fmt.Errorf("unknown padding %q (want entry, comment or extra)", s)
+}
+
+// Overhead returns the bytes padding p adds to a package besides those
+// that make up the size: PadOverhead for an entry, none otherwise.
+func (p Padding) Overhead() int64 {
+	if p == PadEntry {
+		return PadOverhead()
+	}
+	return 0
+}
+
+// padExtraID is the header ID of the extra field PadExtra adds, which no
+// registered extra field uses.
+const padExtraID = 0x6766
+
+// probeCap bounds the padding the size probes of WritePaddedWith write.
+// Past 4 GiB every ZIP64 field is in, and the archive grows byte for byte
+// with its padding.
+const probeCap = 1 << 33
+
+// maxExtra is the most the extra fields of a header, or a comment, hold.
+const maxExtra = 0xFFFF
+
+// PadOverhead returns the bytes the padding entry adds to a package besides
+// its zeros: its local header and central directory record. Packages past
+// 4 GiB need ZIP64 fields on top, which WritePadded accounts for.
+func PadOverhead() int64 {
+	size := func(pad bool) int64 {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		if pad {
+			zw.CreateRaw(padHeader(0, time.Time{}))
+		}
+		zw.Close()
+		return int64(buf.Len())
+	}
+	return size(true) - size(false)
+}
+
+// WritePadded writes the package pkg to path on fsys, nil for the
+// operating system's file system, its parts copied as they are
+// and followed by a padding entry that brings the file to exactly size
+// bytes. A padding entry pkg already has is replaced. The padding entry is
+// dated modified, or undated if it is zero.
+func WritePadded(fsys ports.OutputFS, path string, pkg []byte, size int64, modified time.Time) error {
+	return WritePaddedWith(fsys, path, pkg, size, modified, PadEntry)
+}
+
+// WritePaddedWith is WritePadded with the padding put where how says.
+// Padding pkg already has, of any kind, is replaced; so is its comment,
+// unless padded with an entry.
+func WritePaddedWith(fsys ports.OutputFS, path string, pkg []byte, size int64, modified time.Time, how Padding) error {
+	zr, err := zip.NewReader(bytes.NewReader(pkg), int64(len(pkg)))
+	if err != nil {
+		return fmt.Errorf("failed to read package: %w", err)
+	}
+
+	// The headers grow once the padding needs ZIP64 fields; probe until the
+	// archive comes out at size.
+	var n int64
+	for i := range 4 {
+		cw := &countingWriter{}
+		probe := min(n, probeCap)
+		if err := writePadded(cw, zr, probe, modified, how); err != nil {
+			return err
+		}
+		cw.n += n - probe
+		if i == 0 && cw.n > size {
+			return fmt.Errorf("package of %d bytes does not fit in %d, minimum is %d", len(pkg), size, cw.n)
+		}
+		if cw.n == size {
+			break
+		}
+		n += size - cw.n
+	}
+
+	f, err := outputfs.Create(fsys, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if err := writePadded(f, zr, n, modified, how); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Resize writes the ZIP archive at srcPath to outPath on fsys, nil for
+// the operating system's file system, with its entries copied as they are
+// and its padding entry, added if it has none, sized so that the file is
+// exactly size bytes.
+func Resize(fsys ports.OutputFS, srcPath, outPath string, size int64) error {
+	pkg, err := os.ReadFile(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", srcPath, err)
+	}
+	return WritePadded(fsys, outPath, pkg, size, time.Time{})
+}
+
+// writePadded writes the parts of zr to w with n bytes of padding.
+func writePadded(w io.Writer, zr *zip.Reader, n int64, modified time.Time, how Padding) error {
+	zw := zip.NewWriter(w)
+	comment := zr.Comment
+	if how != PadEntry {
+		comment = ""
+	}
+	var parts []*zip.File
+	for _, f := range zr.File {
+		if f.Name != padName {
+			parts = append(parts, f)
+		}
+	}
+	var extras []int64
+	switch how {
+	case PadComment:
+		if n > maxExtra {
+			return fmt.Errorf("%d bytes of padding do not fit in a zip comment of at most %d", n, maxExtra)
+		}
+		comment = strings.Repeat(" ", int(n))
+	case PadExtra:
+		var rest int64
+		if extras, rest = spreadExtra(parts, n); rest > maxExtra {
+			return fmt.Errorf("%d bytes of padding do not fit in the extra fields of %d parts and the zip comment", n, len(parts))
+		}
+		comment = strings.Repeat(" ", int(rest))
+	}
+	if err := zw.SetComment(comment); err != nil {
+		return err
+	}
+	for i, f := range parts {
+		if how == PadEntry {
+			if err := zw.Copy(f); err != nil {
+				return fmt.Errorf("failed to copy part %s: %w", f.Name, err)
+			}
+			continue
+		}
+		var extra int64
+		if i < len(extras) {
+			extra = extras[i]
+		}
+		if err := copyWithExtra(zw, f, extra); err != nil {
+			return fmt.Errorf("failed to copy part %s: %w", f.Name, err)
+		}
+	}
+	if how != PadEntry {
+		return zw.Close()
+	}
+	pw, err := zw.CreateRaw(padHeader(n, modified))
+	if err != nil {
+		return fmt.Errorf("failed to add padding: %w", err)
+	}
+	if err := utils.WriteZeros(pw, n); err != nil {
+		return fmt.Errorf("failed to write padding: %w", err)
+	}
+	return zw.Close()
+}
+
+// padHeader returns the header of a padding entry of n zero bytes.
+func padHeader(n int64, modified time.Time) *zip.FileHeader {
+	hdr := &zip.FileHeader{
+		Name:               padName,
+		Method:             zip.Store,
+		CRC32:              utils.CRC32Zeros(n),
+		CompressedSize64:   uint64(n),
+		UncompressedSize64: uint64(n),
+	}
+	if !modified.IsZero() {
+		hdr.ModifiedDate = uint16(modified.Day() + int(modified.Month())<<5 + (modified.Year()-1980)<<9)
+		hdr.ModifiedTime = uint16(modified.Second()/2 + modified.Minute()<<5 + modified.Hour()<<11)
+	}
+	return hdr
+}
+
+// countingWriter discards what is written to it, counting the bytes.
+type countingWriter struct{ n int64 }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// spreadExtra shares n bytes of padding among the extra fields of parts,
+// each adding its field to both its local and central headers, so taking
+// an even number of bytes, and at least the 8 of the two field headers.
+// It returns the size of each part's field, in its local header, and the
+// bytes left over for the comment.
+func spreadExtra(parts []*zip.File, n int64) (extras []int64, rest int64) {
+	even := n &^ 1
+	if even < 8 {
+		return nil, n
+	}
+	rest = n - even
+	for _, f := range parts {
+		if even == 0 {
+			break
+		}
+		room := int64(maxExtra - len(stripPadExtra(f.Extra)))
+		k := min(even/2, room)
+		if left := even - 2*k; left > 0 && left < 8 {
+			// Leave the next field room for its header.
+			k -= 4
+		}
+		if k < 4 {
+			k = 0
+		}
+		extras = append(extras, k)
+		even -= 2 * k
+	}
+	return extras, rest + even
+}
+
+// copyWithExtra copies part f to zw with an extra field of size bytes,
+// header included, in place of any padding field it has.
+func copyWithExtra(zw *zip.Writer, f *zip.File, size int64) error {
+	hdr := f.FileHeader
+	hdr.Extra = stripPadExtra(f.Extra)
+	if size > 0 {
+		field := binary.LittleEndian.AppendUint16(nil, padExtraID)
+		field = binary.LittleEndian.AppendUint16(field, uint16(size-4))
+		hdr.Extra = append(append(hdr.Extra[:len(hdr.Extra):len(hdr.Extra)], field...), make([]byte, size-4)...)
+	}
+	r, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	w, err := zw.CreateRaw(&hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// stripPadExtra returns extra without the padding field of padExtraID.
+func stripPadExtra(extra []byte) []byte {
+	var out []byte
+	for len(extra) >= 4 {
+		n := 4 + int(binary.LittleEndian.Uint16(extra[2:]))
+		if n > len(extra) {
+			break
+		}
+		if binary.LittleEndian.Uint16(extra) != padExtraID {
+			out = append(out, extra[:n]...)
+		}
+		extra = extra[n:]
+	}
+	return append(out, extra...)
+}
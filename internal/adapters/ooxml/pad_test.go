@@ -0,0 +1,233 @@
+package ooxml
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// testPackage returns a package with a main part and properties parts.
+func testPackage(t *testing.T, modified time.Time) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	pkg := NewPackage(&buf, modified)
+	parts := append([]Part{{
+		Name:        "main.xml",
+		ContentType: "application/test+xml",
+		RelType:     "http://example.com/main",
+		Body:        "<main>" + strings.Repeat("x", 500) + "</main>",
+	}}, PropertiesParts(ports.Metadata{ports.MetaTitle: "A & B", "project": "genfile"}, modified)...)
+	pkg.AddContentTypes(parts)
+	pkg.AddRelationships(parts)
+	pkg.AddParts(parts)
+	if err := pkg.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWritePadded(t *testing.T) {
+	modified := time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+	pkg := testPackage(t, modified)
+	minSize := int64(len(pkg)) + PadOverhead()
+	dir := t.TempDir()
+
+	for _, size := range []int64{minSize, minSize + 1, minSize + 1000, 1 << 20} {
+		path := filepath.Join(dir, "padded.zip")
+		if err := WritePadded(nil, path, pkg, size, modified); err != nil {
+			t.Fatalf("WritePadded(%d): %v", size, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != size {
+			t.Errorf("WritePadded(%d) wrote %d bytes", size, info.Size())
+		}
+
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		want, _ := zip.NewReader(bytes.NewReader(pkg), int64(len(pkg)))
+		if len(zr.File) != len(want.File)+1 || zr.File[len(zr.File)-1].Name != padName {
+			t.Fatalf("size %d: got %d entries, want the %d parts and %s", size, len(zr.File), len(want.File), padName)
+		}
+		for i, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r) // checks the CRC
+			r.Close()
+			if err != nil {
+				t.Fatalf("size %d: reading %s: %v", size, f.Name, err)
+			}
+			if !f.Modified.Equal(modified) {
+				t.Errorf("size %d: %s dated %v, want %v", size, f.Name, f.Modified, modified)
+			}
+			if i == len(want.File) {
+				continue
+			}
+			wr, _ := want.File[i].Open()
+			wantBody, _ := io.ReadAll(wr)
+			if f.Name != want.File[i].Name || !bytes.Equal(got, wantBody) {
+				t.Errorf("size %d: part %d is %s, want %s as written", size, i, f.Name, want.File[i].Name)
+			}
+		}
+		zr.Close()
+	}
+
+	if err := WritePadded(nil, filepath.Join(dir, "small.zip"), pkg, minSize-1, modified); err == nil {
+		t.Error("WritePadded below the minimum size: expected an error")
+	}
+}
+
+func TestPropertiesParts(t *testing.T) {
+	if parts := PropertiesParts(nil, time.Time{}); parts != nil {
+		t.Errorf("PropertiesParts without metadata = %v, want none", parts)
+	}
+	parts := PropertiesParts(ports.Metadata{
+		ports.MetaTitle:   "A & B",
+		ports.MetaCreator: "genfile",
+		"project":         "x",
+	}, time.Time{})
+	names := map[string]string{}
+	for _, p := range parts {
+		names[p.Name] = p.Body
+	}
+	for name, want := range map[string]string{
+		"docProps/core.xml":   "<dc:title>A &amp; B</dc:title>",
+		"docProps/app.xml":    "<Application>genfile</Application>",
+		"docProps/custom.xml": `name="project"`,
+	} {
+		if !strings.Contains(names[name], want) {
+			t.Errorf("%s = %q, want it to contain %q", name, names[name], want)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	pkg := testPackage(t, time.Time{})
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.zip")
+	if err := os.WriteFile(src, pkg, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	minSize := int64(len(pkg)) + PadOverhead()
+
+	// Growing adds a padding entry; shrinking the result replaces it.
+	grown := filepath.Join(dir, "grown.zip")
+	shrunk := filepath.Join(dir, "shrunk.zip")
+	if err := Resize(nil, src, grown, 100000); err != nil {
+		t.Fatalf("Resize up: %v", err)
+	}
+	if err := Resize(nil, grown, shrunk, minSize+10); err != nil {
+		t.Fatalf("Resize down: %v", err)
+	}
+	for path, size := range map[string]int64{grown: 100000, shrunk: minSize + 10} {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		pads := 0
+		for _, f := range zr.File {
+			if f.Name == padName {
+				pads++
+			}
+		}
+		info, _ := os.Stat(path)
+		if info.Size() != size || pads != 1 {
+			t.Errorf("%s: %d bytes with %d padding entries, want %d bytes with 1", path, info.Size(), pads, size)
+		}
+		zr.Close()
+	}
+
+	if err := Resize(nil, src, filepath.Join(dir, "small.zip"), minSize-1); err == nil {
+		t.Error("Resize below the minimum size: expected an error")
+	}
+}
+
+func TestWritePaddedWith(t *testing.T) {
+	pkg := testPackage(t, time.Time{})
+	base := int64(len(pkg))
+	dir := t.TempDir()
+
+	tests := []struct {
+		name  string
+		how   Padding
+		sizes []int64
+		bad   []int64 // sizes it cannot reach
+	}{
+		{"Comment", PadComment, []int64{base, base + 1, base + 1000, base + maxExtra}, []int64{base - 1, base + maxExtra + 1}},
+		{"Extra", PadExtra, []int64{base, base + 1, base + 7, base + 8, base + 9, base + 15, base + 1000, base + 300001}, []int64{base - 1, base + 10<<20}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, size := range tc.sizes {
+				path := filepath.Join(dir, "padded.zip")
+				if err := WritePaddedWith(nil, path, pkg, size, time.Time{}, tc.how); err != nil {
+					t.Fatalf("WritePaddedWith(%d): %v", size, err)
+				}
+				// Padding again replaces the padding rather than adding to it.
+				padded, _ := os.ReadFile(path)
+				if err := WritePaddedWith(nil, path, padded, size, time.Time{}, tc.how); err != nil {
+					t.Fatalf("WritePaddedWith(%d) of its own output: %v", size, err)
+				}
+				if info, _ := os.Stat(path); info.Size() != size {
+					t.Errorf("WritePaddedWith(%d) wrote %d bytes", size, info.Size())
+				}
+
+				zr, err := zip.OpenReader(path)
+				if err != nil {
+					t.Fatalf("size %d: %v", size, err)
+				}
+				want, _ := zip.NewReader(bytes.NewReader(pkg), base)
+				if len(zr.File) != len(want.File) {
+					t.Fatalf("size %d: got %d entries, want the %d parts alone", size, len(zr.File), len(want.File))
+				}
+				var extra int64
+				for i, f := range zr.File {
+					r, err := f.Open()
+					if err != nil {
+						t.Fatal(err)
+					}
+					got, err := io.ReadAll(r) // checks the CRC
+					r.Close()
+					if err != nil {
+						t.Fatalf("size %d: reading %s: %v", size, f.Name, err)
+					}
+					wr, _ := want.File[i].Open()
+					wantBody, _ := io.ReadAll(wr)
+					if f.Name != want.File[i].Name || !bytes.Equal(got, wantBody) {
+						t.Errorf("size %d: part %d is %s, want %s as written", size, i, f.Name, want.File[i].Name)
+					}
+					extra += int64(len(f.Extra) - len(stripPadExtra(f.Extra)))
+				}
+				if got := 2*extra + int64(len(zr.Comment)); got != size-base {
+					t.Errorf("size %d: %d bytes in extra fields and comment, want %d", size, got, size-base)
+				}
+				if tc.how == PadComment && extra != 0 {
+					t.Errorf("size %d: %d bytes of extra fields padding a comment", size, extra)
+				}
+				zr.Close()
+			}
+			for _, size := range tc.bad {
+				if err := WritePaddedWith(nil, filepath.Join(dir, "bad.zip"), pkg, size, time.Time{}, tc.how); err == nil {
+					t.Errorf("WritePaddedWith(%d): expected an error", size)
+				}
+			}
+		})
+	}
+
+	if _, err := ParsePadding("trailer"); err == nil {
+		t.Error("ParsePadding(trailer): expected an error")
+	}
+}
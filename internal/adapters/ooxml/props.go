@@ -0,0 +1,79 @@
+package ooxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// coreProps maps well-known metadata keys to core properties elements.
+var coreProps = map[string]string{
+	ports.MetaTitle:    "dc:title",
+	ports.MetaAuthor:   "dc:creator",
+	ports.MetaSubject:  "dc:subject",
+	ports.MetaKeywords: "cp:keywords",
+	ports.MetaComment:  "dc:description",
+}
+
+// PropertiesParts returns the document properties parts that hold m: core properties for
+// the well-known keys and, unless modified is zero, the creation and
+// modification dates; the Application extended property for the creator;
+// and custom properties for everything else.
+func PropertiesParts(m ports.Metadata, modified time.Time) []Part {
+	if len(m) == 0 && modified.IsZero() {
+		return nil
+	}
+	var core, custom bytes.Buffer
+	var parts []Part
+	if !modified.IsZero() {
+		date := modified.UTC().Format(time.RFC3339)
+		fmt.Fprintf(&core, `<dcterms:created xsi:type="dcterms:W3CDTF">%s</dcterms:created><dcterms:modified xsi:type="dcterms:W3CDTF">%s</dcterms:modified>`, date, date)
+	}
+	pid := 2 // custom property ids start at 2
+	for _, k := range m.Keys() {
+		if el, ok := coreProps[k]; ok {
+			fmt.Fprintf(&core, "<%s>%s</%s>", el, escape(m[k]), el)
+		} else if k != ports.MetaCreator {
+			fmt.Fprintf(&custom, `<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="%d" name="%s"><vt:lpwstr>%s</vt:lpwstr></property>`, pid, k, escape(m[k]))
+			pid++
+		}
+	}
+	if core.Len() > 0 {
+		parts = append(parts, Part{
+			Name:        "docProps/core.xml",
+			ContentType: "application/vnd.openxmlformats-package.core-properties+xml",
+			RelType:     "http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties",
+			Body: `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` + core.String() + `</cp:coreProperties>`,
+		})
+	}
+	if app, ok := m[ports.MetaCreator]; ok {
+		parts = append(parts, Part{
+			Name:        "docProps/app.xml",
+			ContentType: "application/vnd.openxmlformats-officedocument.extended-properties+xml",
+			RelType:     "http://schemas.openxmlformats.org/officeDocument/2006/relationships/extended-properties",
+			Body: `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties"><Application>` + escape(app) + `</Application></Properties>`,
+		})
+	}
+	if custom.Len() > 0 {
+		parts = append(parts, Part{
+			Name:        "docProps/custom.xml",
+			ContentType: "application/vnd.openxmlformats-officedocument.custom-properties+xml",
+			RelType:     "http://schemas.openxmlformats.org/officeDocument/2006/relationships/custom-properties",
+			Body: `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/custom-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">` + custom.String() + `</Properties>`,
+		})
+	}
+	return parts
+}
+
+// escape returns s with XML special characters escaped.
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
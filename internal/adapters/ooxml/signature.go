@@ -0,0 +1,82 @@
+package ooxml
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SignatureOrigin is the digital signature origin part of a package
+// prepared for signing: empty and related from the package, as Office
+// writes it, for signing tools to relate the signature parts they add in
+// _xmlsignatures to.
+var SignatureOrigin = Part{
+	Name:        "_xmlsignatures/origin.sigs",
+	ContentType: "application/vnd.openxmlformats-package.digital-signature-origin",
+	RelType:     "http://schemas.openxmlformats.org/package/2006/relationships/digital-signature/origin",
+}
+
+// signatureOriginID is the relationship id AddSignatureOrigin gives the
+// origin part, which no numbered rIdN id clashes with.
+const signatureOriginID = "rIdSignatureOrigin"
+
+// AddSignatureOrigin returns the package pkg, written by another library,
+// with SignatureOrigin added: its parts are copied as they are but for
+// [Content_Types].xml and _rels/.rels, which gain its content type and
+// relationship, and the empty origin part follows them.
+func AddSignatureOrigin(pkg []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(pkg), int64(len(pkg)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package: %w", err)
+	}
+	edits := map[string]func(string) string{
+		"[Content_Types].xml": func(s string) string {
+			return strings.Replace(s, "</Types>", fmt.Sprintf(`<Override PartName="/%s" ContentType="%s"/></Types>`, SignatureOrigin.Name, SignatureOrigin.ContentType), 1)
+		},
+		"_rels/.rels": func(s string) string {
+			return strings.Replace(s, "</Relationships>", fmt.Sprintf(`<Relationship Id="%s" Type="%s" Target="%s"/></Relationships>`, signatureOriginID, SignatureOrigin.RelType, SignatureOrigin.Name), 1)
+		},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	found := 0
+	for _, f := range zr.File {
+		edit, ok := edits[f.Name]
+		if !ok {
+			if err := zw.Copy(f); err != nil {
+				return nil, fmt.Errorf("failed to copy part %s: %w", f.Name, err)
+			}
+			continue
+		}
+		found++
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read part %s: %w", f.Name, err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read part %s: %w", f.Name, err)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, ModifiedTime: f.ModifiedTime, ModifiedDate: f.ModifiedDate})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add part %s: %w", f.Name, err)
+		}
+		if _, err := io.WriteString(w, edit(string(body))); err != nil {
+			return nil, fmt.Errorf("failed to write part %s: %w", f.Name, err)
+		}
+	}
+	if found != len(edits) {
+		return nil, fmt.Errorf("package has no [Content_Types].xml or _rels/.rels")
+	}
+	if _, err := zw.CreateHeader(&zip.FileHeader{Name: SignatureOrigin.Name, Method: zip.Deflate, ModifiedTime: zr.File[0].ModifiedTime, ModifiedDate: zr.File[0].ModifiedDate}); err != nil {
+		return nil, fmt.Errorf("failed to add part %s: %w", SignatureOrigin.Name, err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write package: %w", err)
+	}
+	return buf.Bytes(), nil
+}
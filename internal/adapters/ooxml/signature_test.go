@@ -0,0 +1,48 @@
+package ooxml
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddSignatureOrigin(t *testing.T) {
+	pkg, err := AddSignatureOrigin(testPackage(t, time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)))
+	if err != nil {
+		t.Fatalf("AddSignatureOrigin() error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(pkg), int64(len(pkg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(body)
+	}
+	if body, ok := parts[SignatureOrigin.Name]; !ok || body != "" {
+		t.Errorf("origin part = %q, %v, want an empty part", body, ok)
+	}
+	if !strings.Contains(parts["[Content_Types].xml"], `<Override PartName="/_xmlsignatures/origin.sigs" ContentType="`+SignatureOrigin.ContentType+`"/></Types>`) {
+		t.Errorf("content types lack the origin part:\n%s", parts["[Content_Types].xml"])
+	}
+	rels := parts["_rels/.rels"]
+	if !strings.Contains(rels, `Type="`+SignatureOrigin.RelType+`" Target="_xmlsignatures/origin.sigs"`) || !strings.Contains(rels, `Target="main.xml"`) {
+		t.Errorf("package relationships lack the origin part or lost the others:\n%s", rels)
+	}
+	if !strings.HasPrefix(parts["main.xml"], "<main>") {
+		t.Errorf("main part not copied: %.20q", parts["main.xml"])
+	}
+
+	if _, err := AddSignatureOrigin([]byte("not a zip")); err == nil {
+		t.Error("AddSignatureOrigin() of a non-package succeeded")
+	}
+}
@@ -0,0 +1,222 @@
+package outputfs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// FaultKind is the failure a Fault injects.
+type FaultKind string
+
+const (
+	// FaultNoSpace fails writes past the offset with ENOSPC, as a full
+	// disk does.
+	FaultNoSpace FaultKind = "enospc"
+	// FaultAccess fails writes past the offset with EACCES, or creating
+	// the file at offset 0, as a lost permission does.
+	FaultAccess FaultKind = "eacces"
+	// FaultShort cuts the first write past the offset short at it with
+	// io.ErrShortWrite, once: writing the rest again goes through, as it
+	// would after a transient failure.
+	FaultShort FaultKind = "short"
+)
+
+// Fault is a failure injected at Offset bytes into every file created.
+type Fault struct {
+	Kind   FaultKind
+	Offset int64
+}
+
+// ParseFault parses a fault as KIND[@OFFSET], such as "enospc@10MB",
+// "eacces" or "short@4096"; the offset is a size, 0 if left out.
+func ParseFault(spec string) (Fault, error) {
+	kind, offset, hasOffset := strings.Cut(strings.TrimSpace(spec), "@")
+	f := Fault{Kind: FaultKind(strings.ToLower(kind))}
+	switch f.Kind {
+	case FaultNoSpace, FaultAccess, FaultShort:
+	default:
+		return f, fmt.Errorf("unknown fault '%s' (want enospc, eacces or short, with an optional @OFFSET)", kind)
+	}
+	if hasOffset {
+		var err error
+		if f.Offset, err = utils.ParseSize(offset); err != nil {
+			return f, fmt.Errorf("invalid fault offset '%s': %w", offset, err)
+		}
+	}
+	return f, nil
+}
+
+// Chaos is an output file system that injects Faults into the files
+// created on another one, for testing how generators, and the programs
+// that run them, handle failing writes.
+type Chaos struct {
+	FS     ports.OutputFS // the file system written to; OS if nil
+	Faults []Fault
+}
+
+// Create creates the file at path on c.FS, failing with EACCES if an
+// eacces fault is at offset 0, and returns it with c's faults.
+func (c *Chaos) Create(path string) (ports.OutputFile, error) {
+	return c.open(path, ports.OutputFS.Create)
+}
+
+// Open opens the file at path on c.FS as Create does, without truncating
+// it. The faults are at the same offsets from the start of the file.
+func (c *Chaos) Open(path string) (ports.OutputFile, error) {
+	return c.open(path, ports.OutputFS.Open)
+}
+
+// MkdirTemp creates a temporary directory on c.FS. The faults are
+// injected into the files created in it, not into the directory.
+func (c *Chaos) MkdirTemp(pattern string) (string, error) {
+	return MkdirTemp(c.FS, pattern)
+}
+
+// OpenRead opens the file at path on c.FS for reading, without faults.
+func (c *Chaos) OpenRead(path string) (io.ReadCloser, error) {
+	return OpenRead(c.FS, path)
+}
+
+// Stat describes the file at path on c.FS.
+func (c *Chaos) Stat(path string) (fs.FileInfo, error) {
+	return Stat(c.FS, path)
+}
+
+// Chtimes changes the times of the file at path on c.FS.
+func (c *Chaos) Chtimes(path string, atime, mtime time.Time) error {
+	return Chtimes(c.FS, path, atime, mtime)
+}
+
+// Chmod changes the mode of the file at path on c.FS.
+func (c *Chaos) Chmod(path string, mode fs.FileMode) error {
+	return Chmod(c.FS, path, mode)
+}
+
+// Chown changes the owner of the file at path on c.FS.
+func (c *Chaos) Chown(path string, uid, gid int) error {
+	return Chown(c.FS, path, uid, gid)
+}
+
+// MkdirTempIn creates a new directory in dir on c.FS. The faults are
+// injected into the files created in it, not into the directory.
+func (c *Chaos) MkdirTempIn(dir, pattern string) (string, error) {
+	return renameFS(c.FS).MkdirTempIn(dir, pattern)
+}
+
+// Lstat describes the file at path on c.FS, not following a symbolic link.
+func (c *Chaos) Lstat(path string) (fs.FileInfo, error) {
+	return renameFS(c.FS).Lstat(path)
+}
+
+// Rename moves the file at oldpath on c.FS to newpath.
+func (c *Chaos) Rename(oldpath, newpath string) error {
+	return renameFS(c.FS).Rename(oldpath, newpath)
+}
+
+// Remove removes the file at path on c.FS.
+func (c *Chaos) Remove(path string) error {
+	return renameFS(c.FS).Remove(path)
+}
+
+// RemoveAll removes path on c.FS and anything it holds.
+func (c *Chaos) RemoveAll(path string) error {
+	return RemoveAll(c.FS, path)
+}
+
+// open opens the file at path on c.FS with openFile, or fails as Create
+// describes.
+func (c *Chaos) open(path string, openFile func(ports.OutputFS, string) (ports.OutputFile, error)) (ports.OutputFile, error) {
+	for _, f := range c.Faults {
+		if f.Kind == FaultAccess && f.Offset == 0 {
+			return nil, &fs.PathError{Op: "open", Path: path, Err: syscall.EACCES}
+		}
+	}
+	fsys := c.FS
+	if fsys == nil {
+		fsys = OS{}
+	}
+	file, err := openFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	return &chaosFile{OutputFile: file, faults: c.Faults}, nil
+}
+
+// chaosFile is a file of a Chaos file system.
+type chaosFile struct {
+	ports.OutputFile
+	faults []Fault
+	pos    int64 // offset of the next Write
+	cut    bool  // whether a write has been cut short
+}
+
+func (f *chaosFile) Write(p []byte) (int, error) {
+	k, fault := f.allow(f.pos, len(p))
+	n, err := f.OutputFile.Write(p[:k])
+	f.pos += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, fault
+}
+
+func (f *chaosFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *chaosFile) WriteAt(p []byte, off int64) (int, error) {
+	k, fault := f.allow(off, len(p))
+	n, err := f.OutputFile.WriteAt(p[:k], off)
+	if err != nil {
+		return n, err
+	}
+	return n, fault
+}
+
+func (f *chaosFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.OutputFile.Seek(offset, whence)
+	if err == nil {
+		f.pos = pos
+	}
+	return pos, err
+}
+
+// allow returns how many bytes of a write of n at off go through before
+// the first fault they reach, and the error that fault returns.
+func (f *chaosFile) allow(off int64, n int) (int, error) {
+	end := off + int64(n)
+	k, fault := n, error(nil)
+	for _, ft := range f.faults {
+		if end <= ft.Offset {
+			continue
+		}
+		at := int(max(ft.Offset-off, 0))
+		switch ft.Kind {
+		case FaultNoSpace, FaultAccess:
+			if at <= k {
+				k, fault = at, &fs.PathError{Op: "write", Path: f.Name(), Err: errnos[ft.Kind]}
+			}
+		case FaultShort:
+			if !f.cut && off <= ft.Offset && at < k {
+				k, fault = at, io.ErrShortWrite
+			}
+		}
+	}
+	if fault == io.ErrShortWrite {
+		f.cut = true
+	}
+	return k, fault
+}
+
+// errnos are the errors the failing faults return.
+var errnos = map[FaultKind]error{
+	FaultNoSpace: syscall.ENOSPC,
+	FaultAccess:  syscall.EACCES,
+}
@@ -0,0 +1,120 @@
+package outputfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestParseFault(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Fault
+		wantErr bool
+	}{
+		{"enospc@10KiB", Fault{FaultNoSpace, 10 * 1024}, false},
+		{"EACCES", Fault{FaultAccess, 0}, false},
+		{"short@4096", Fault{FaultShort, 4096}, false},
+		{"eio@1", Fault{}, true},
+		{"enospc@lots", Fault{}, true},
+	}
+	for _, tc := range tests {
+		got, err := ParseFault(tc.spec)
+		if (err != nil) != tc.wantErr || !tc.wantErr && got != tc.want {
+			t.Errorf("ParseFault(%q) = %v, %v; want %v", tc.spec, got, err, tc.want)
+		}
+	}
+}
+
+func TestChaos(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 1000)
+
+	t.Run("No space", func(t *testing.T) {
+		c := &Chaos{Faults: []Fault{{FaultNoSpace, 1500}}}
+		path := filepath.Join(dir, "nospace")
+		f, err := c.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if n, err := f.Write(data); n != 1000 || err != nil {
+			t.Errorf("first Write() = %d, %v", n, err)
+		}
+		if n, err := f.Write(data); n != 500 || !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("second Write() = %d, %v; want 500 and ENOSPC", n, err)
+		}
+		if n, err := f.WriteAt(data, 0); n != 1000 || err != nil {
+			t.Errorf("WriteAt() before the fault = %d, %v", n, err)
+		}
+		if _, err := f.WriteAt(data, 1000); !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("WriteAt() past the fault error = %v, want ENOSPC", err)
+		}
+		if info, _ := os.Stat(path); info.Size() != 1500 {
+			t.Errorf("file is %d bytes, want 1500", info.Size())
+		}
+	})
+
+	t.Run("Short write once", func(t *testing.T) {
+		c := &Chaos{Faults: []Fault{{FaultShort, 1000}}}
+		f, err := c.Create(filepath.Join(dir, "short"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if n, err := f.Write(data[:600]); n != 600 || err != nil {
+			t.Errorf("first Write() = %d, %v", n, err)
+		}
+		if n, err := f.Write(data[:600]); n != 400 || err != io.ErrShortWrite {
+			t.Errorf("second Write() = %d, %v; want 400 and a short write", n, err)
+		}
+		if n, err := f.Write(data[400:600]); n != 200 || err != nil {
+			t.Errorf("retry Write() = %d, %v", n, err)
+		}
+	})
+
+	t.Run("Access denied", func(t *testing.T) {
+		c := &Chaos{Faults: []Fault{{FaultAccess, 0}}}
+		if _, err := c.Create(filepath.Join(dir, "denied")); !errors.Is(err, syscall.EACCES) {
+			t.Errorf("Create() error = %v, want EACCES", err)
+		}
+	})
+
+	t.Run("WriteFile", func(t *testing.T) {
+		err := WriteFile(&Chaos{Faults: []Fault{{FaultNoSpace, 10}}}, filepath.Join(dir, "chaos"), data)
+		if !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("WriteFile() error = %v, want ENOSPC", err)
+		}
+		if err := WriteFile(nil, filepath.Join(dir, "os"), data); err != nil {
+			t.Errorf("WriteFile() on the OS error = %v", err)
+		}
+	})
+}
+
+func TestChaos_Attrs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.bin")
+	if err := os.WriteFile(path, []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var fsys ports.OutputFS = &Chaos{Faults: []Fault{{Kind: FaultNoSpace}}}
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := Chtimes(fsys, path, mtime, mtime); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	if err := Chmod(fsys, path, 0o600); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	info, err := Stat(fsys, path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if !info.ModTime().Equal(mtime) || info.Mode().Perm() != 0o600 || info.Size() != 3 {
+		t.Errorf("Stat() = %v, %v, %d bytes; want %v, 0600, 3 bytes", info.ModTime(), info.Mode().Perm(), info.Size(), mtime)
+	}
+}
@@ -0,0 +1,195 @@
+// Package outputfs is the file system generators write to: the operating
+// system's by default, or any ports.OutputFS handed to them in its place,
+// such as a Chaos file system that injects write failures.
+package outputfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// OS is the operating system's file system.
+type OS struct{}
+
+// Create creates the file at path with os.Create.
+func (OS) Create(path string) (ports.OutputFile, error) {
+	return os.Create(path)
+}
+
+// Open opens the file at path for writing with os.OpenFile.
+func (OS) Open(path string) (ports.OutputFile, error) {
+	return os.OpenFile(path, os.O_WRONLY, 0)
+}
+
+// MkdirTemp creates a new temporary directory with os.MkdirTemp.
+func (OS) MkdirTemp(pattern string) (string, error) {
+	return os.MkdirTemp("", pattern)
+}
+
+// OpenRead opens the file at path for reading with os.Open.
+func (OS) OpenRead(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// Stat describes the file at path with os.Stat.
+func (OS) Stat(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+// RemoveAll removes path and anything it holds with os.RemoveAll.
+func (OS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+// MkdirTempIn creates a new directory in dir with os.MkdirTemp.
+func (OS) MkdirTempIn(dir, pattern string) (string, error) {
+	return os.MkdirTemp(dir, pattern)
+}
+
+// Lstat describes the file at path with os.Lstat.
+func (OS) Lstat(path string) (fs.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+// Rename moves the file at oldpath to newpath with os.Rename.
+func (OS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// Remove removes the file at path with os.Remove.
+func (OS) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// Chtimes changes the times of the file at path with os.Chtimes.
+func (OS) Chtimes(path string, atime, mtime time.Time) error {
+	return os.Chtimes(path, atime, mtime)
+}
+
+// Chmod changes the mode of the file at path with os.Chmod.
+func (OS) Chmod(path string, mode fs.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+// Chown changes the owner of the file at path with os.Chown.
+func (OS) Chown(path string, uid, gid int) error {
+	return os.Chown(path, uid, gid)
+}
+
+// Create creates or truncates the file at path for writing on fsys, or
+// on the operating system's file system if fsys is nil.
+func Create(fsys ports.OutputFS, path string) (ports.OutputFile, error) {
+	if fsys == nil {
+		return OS{}.Create(path)
+	}
+	return fsys.Create(path)
+}
+
+// Open opens the existing file at path for writing, without truncating
+// it, on fsys, or on the operating system's file system if fsys is nil.
+func Open(fsys ports.OutputFS, path string) (ports.OutputFile, error) {
+	if fsys == nil {
+		return OS{}.Open(path)
+	}
+	return fsys.Open(path)
+}
+
+// WriteFile writes data to the file at path on fsys, or on the operating
+// system's file system if fsys is nil, creating or truncating it, as
+// os.WriteFile does.
+func WriteFile(fsys ports.OutputFS, path string, data []byte) error {
+	f, err := Create(fsys, path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// tempFS returns fsys as the file system of temporary files, or the
+// operating system's if fsys is nil or holds none (ports.TempFS).
+func tempFS(fsys ports.OutputFS) ports.TempFS {
+	if t, ok := fsys.(ports.TempFS); ok {
+		return t
+	}
+	return OS{}
+}
+
+// MkdirTemp creates a new directory for temporary files on fsys, as
+// os.MkdirTemp("", pattern) does, or in the operating system's temporary
+// directory if fsys holds no temporary files.
+func MkdirTemp(fsys ports.OutputFS, pattern string) (string, error) {
+	return tempFS(fsys).MkdirTemp(pattern)
+}
+
+// OpenRead opens the temporary file at path on fsys for reading.
+func OpenRead(fsys ports.OutputFS, path string) (io.ReadCloser, error) {
+	return tempFS(fsys).OpenRead(path)
+}
+
+// ReadFile returns the contents of the temporary file at path on fsys.
+func ReadFile(fsys ports.OutputFS, path string) ([]byte, error) {
+	f, err := OpenRead(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Stat describes the file at path on fsys, or on the operating system's
+// file system if fsys cannot (ports.TempFS, ports.AttrFS).
+func Stat(fsys ports.OutputFS, path string) (fs.FileInfo, error) {
+	if s, ok := fsys.(interface {
+		Stat(path string) (fs.FileInfo, error)
+	}); ok {
+		return s.Stat(path)
+	}
+	return os.Stat(path)
+}
+
+// attrFS returns fsys as the file system setting file attributes, or the
+// operating system's if it is nil or sets none (ports.AttrFS).
+func attrFS(fsys ports.OutputFS) ports.AttrFS {
+	if a, ok := fsys.(ports.AttrFS); ok {
+		return a
+	}
+	return OS{}
+}
+
+// renameFS returns fsys as the file system files are renamed into place
+// on, or the operating system's if it is nil or renames none
+// (ports.RenameFS).
+func renameFS(fsys ports.OutputFS) ports.RenameFS {
+	if r, ok := fsys.(ports.RenameFS); ok {
+		return r
+	}
+	return OS{}
+}
+
+// Chtimes changes the times of the file at path on fsys.
+func Chtimes(fsys ports.OutputFS, path string, atime, mtime time.Time) error {
+	return attrFS(fsys).Chtimes(path, atime, mtime)
+}
+
+// Chmod changes the mode of the file at path on fsys.
+func Chmod(fsys ports.OutputFS, path string, mode fs.FileMode) error {
+	return attrFS(fsys).Chmod(path, mode)
+}
+
+// Chown changes the owner of the file at path on fsys.
+func Chown(fsys ports.OutputFS, path string, uid, gid int) error {
+	return attrFS(fsys).Chown(path, uid, gid)
+}
+
+// RemoveAll removes the temporary path on fsys and anything it holds.
+func RemoveAll(fsys ports.OutputFS, path string) error {
+	return tempFS(fsys).RemoveAll(path)
+}
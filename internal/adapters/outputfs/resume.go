@@ -0,0 +1,90 @@
+package outputfs
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// CheckpointInterval is how many bytes a Checkpointer lets through between
+// checkpoints.
+const CheckpointInterval = 64 << 20
+
+// Resume opens the file at path on fsys, nil for the operating system's,
+// to carry on writing it at offset: it is created afresh at offset 0, and
+// otherwise cut to offset, which must not be past its end, and positioned
+// there.
+func Resume(fsys ports.OutputFS, path string, offset int64) (ports.OutputFile, error) {
+	if offset == 0 {
+		return Create(fsys, path)
+	}
+	f, err := Open(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	end, err := f.Seek(0, io.SeekEnd)
+	if err == nil && end < offset {
+		err = fmt.Errorf("%s is %d bytes, cannot resume at %d", path, end, offset)
+	}
+	if err == nil {
+		err = f.Truncate(offset)
+	}
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Checkpointer writes to a file and, every Interval bytes, syncs it and
+// passes how far it got to a checkpoint function, so that a run that is
+// interrupted can resume there. It goes under any buffering, so that the
+// offsets it passes are of bytes that reached the file.
+type Checkpointer struct {
+	file       ports.OutputFile
+	checkpoint func(ports.ResumeState) error
+	// Phase is the part of the format being written, recorded with each
+	// checkpoint.
+	Phase    string
+	Interval int64
+	offset   int64 // offset of the next byte written
+	saved    int64 // offset of the last checkpoint
+}
+
+// NewCheckpointer returns a Checkpointer writing to f, which is at offset,
+// and calling checkpoint every CheckpointInterval bytes. A nil checkpoint
+// makes it a plain writer.
+func NewCheckpointer(f ports.OutputFile, offset int64, checkpoint func(ports.ResumeState) error) *Checkpointer {
+	return &Checkpointer{file: f, checkpoint: checkpoint, Interval: CheckpointInterval, offset: offset, saved: offset}
+}
+
+func (c *Checkpointer) Write(p []byte) (int, error) {
+	n, err := c.file.Write(p)
+	c.offset += int64(n)
+	if err != nil || c.checkpoint == nil || c.offset-c.saved < c.Interval {
+		return n, err
+	}
+	return n, c.Checkpoint()
+}
+
+// Offset returns the offset of the next byte written.
+func (c *Checkpointer) Offset() int64 {
+	return c.offset
+}
+
+// Checkpoint syncs the file and passes its phase and offset to the
+// checkpoint function.
+func (c *Checkpointer) Checkpoint() error {
+	if c.checkpoint == nil {
+		return nil
+	}
+	if err := c.file.Sync(); err != nil {
+		return err
+	}
+	c.saved = c.offset
+	return c.checkpoint(ports.ResumeState{Phase: c.Phase, Offset: c.offset})
+}
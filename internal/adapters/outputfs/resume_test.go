@@ -0,0 +1,65 @@
+package outputfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "partial")
+	if err := os.WriteFile(path, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Resume(nil, path, 4)
+	if err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	f.Write([]byte("ab"))
+	f.Close()
+	if got, _ := os.ReadFile(path); string(got) != "0123ab" {
+		t.Errorf("resumed file holds %q, want %q", got, "0123ab")
+	}
+
+	if _, err := Resume(nil, path, 100); err == nil {
+		t.Error("Resume() past the end of the file succeeded")
+	}
+
+	if f, err = Resume(&Chaos{Faults: []Fault{{FaultNoSpace, 8}}}, path, 6); err != nil {
+		t.Fatalf("Resume() on a Chaos file system error = %v", err)
+	}
+	defer f.Close()
+	if n, err := f.Write([]byte("cdef")); n != 2 || !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("Write() = %d, %v; want 2 and the fault at offset 8", n, err)
+	}
+}
+
+func TestCheckpointer(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "checkpointed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []ports.ResumeState
+	c := NewCheckpointer(f, 100, func(s ports.ResumeState) error {
+		got = append(got, s)
+		return nil
+	})
+	c.Interval = 10
+	c.Phase = "data"
+	for range 5 {
+		if _, err := c.Write(make([]byte, 6)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []ports.ResumeState{{Phase: "data", Offset: 112}, {Phase: "data", Offset: 124}}
+	if !reflect.DeepEqual(got, want) || c.Offset() != 130 {
+		t.Errorf("checkpoints %v at offset %d, want %v at 130", got, c.Offset(), want)
+	}
+}
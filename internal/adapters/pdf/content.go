@@ -0,0 +1,434 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/hailam/genfile/internal/adapters/embed"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// Content modes accepted by the "pdf-content" option.
+const (
+	ContentNone    = "none"
+	ContentText    = "text"
+	ContentDrawing = "drawing"
+	ContentScan    = "scan"
+)
+
+// pdfVersions lists the header versions accepted by the "pdf-version" option.
+var pdfVersions = []string{"1.3", "1.4", "1.5", "1.6", "1.7", "2.0"}
+
+// pdfOptions holds the settings the PDF generator reads from ports.Options.
+type pdfOptions struct {
+	pages         int
+	width, height int
+	content       string
+	paragraphs    int
+	shapes        int
+	dpi           int
+	version       string
+	xref          string // cross-reference form, from "pdf-xref"
+	eicar         bool
+	signature     bool           // prepared for signing, from "signature-placeholder"
+	needle        utils.Needle   // planted as lines of text content
+	attachments   []embed.Item   // files to attach, from "pdf-attachments"
+	files         []embed.File   // the attachments rendered; set from the generator
+	modified      time.Time      // CreationDate and ModDate; zero for none
+	meta          ports.Metadata // set from the generator, not from options
+	threads       int            // goroutines making the padding stream
+	rand          *utils.Rand    // of the content and the padding stream
+}
+
+func parseOptions(opts ports.Options) (pdfOptions, error) {
+	var o pdfOptions
+	var err error
+	if o.needle, err = utils.ParseNeedle(opts.String("embed-string", ""), opts.String("embed-count", "")); err != nil {
+		return o, err
+	}
+	// A planted string is shown as text, so it implies text content.
+	defaultContent := ContentNone
+	if o.needle.Count > 0 {
+		defaultContent = ContentText
+	}
+	o.content = strings.ToLower(opts.String("pdf-content", defaultContent))
+	o.version = opts.String("pdf-version", "1.7")
+	o.xref = strings.ToLower(opts.String("pdf-xref", XRefTable))
+
+	if o.pages, err = opts.Int("pdf-pages", 1); err != nil {
+		return o, err
+	}
+	if o.pages < 1 {
+		return o, fmt.Errorf("pdf-pages must be at least 1, got %d", o.pages)
+	}
+	if o.paragraphs, err = opts.Int("pdf-paragraphs", 5); err != nil {
+		return o, err
+	}
+	if o.shapes, err = opts.Int("pdf-shapes", 20); err != nil {
+		return o, err
+	}
+	if o.paragraphs < 0 || o.shapes < 0 {
+		return o, fmt.Errorf("pdf-paragraphs and pdf-shapes must not be negative")
+	}
+	if o.dpi, err = opts.Int("scan-dpi", 150); err != nil {
+		return o, err
+	}
+	if o.dpi < 1 {
+		return o, fmt.Errorf("scan-dpi must be positive, got %d", o.dpi)
+	}
+
+	size := strings.ToLower(opts.String("pdf-page-size", "a4"))
+	dims, ok := utils.PageSizes[size]
+	if !ok {
+		return o, fmt.Errorf("unknown pdf page size %q (want a3, a4, a5, letter or legal)", size)
+	}
+	o.width, o.height = dims[0], dims[1]
+
+	switch o.content {
+	case ContentNone, ContentText, ContentDrawing, ContentScan:
+	default:
+		return o, fmt.Errorf("unknown pdf content %q (want none, text, drawing or scan)", o.content)
+	}
+	if o.needle.Count > 0 {
+		if o.content != ContentText {
+			return o, fmt.Errorf("embed-string needs pdf-content text, not %s", o.content)
+		}
+		for _, r := range o.needle.Text {
+			if r >= 0x80 {
+				return o, fmt.Errorf("embed-string must be ASCII in a PDF, whose standard fonts have no other characters")
+			}
+		}
+		if _, lines := o.textArea(); (o.needle.Count+o.pages-1)/o.pages > lines {
+			return o, fmt.Errorf("embed-count %d needs more pages; a page holds %d lines", o.needle.Count, lines)
+		}
+	}
+
+	if o.modified, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.eicar, err = opts.Bool("eicar", false); err != nil {
+		return o, err
+	}
+	if o.signature, err = opts.Bool("signature-placeholder", false); err != nil {
+		return o, err
+	}
+	if o.attachments, err = embed.ParseItems("pdf-attachments", opts.String("pdf-attachments", "")); err != nil {
+		return o, err
+	}
+	if o.threads, err = utils.ParseThreads(opts.String("threads", "")); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+
+	known := false
+	for _, v := range pdfVersions {
+		known = known || v == o.version
+	}
+	if !known {
+		return o, fmt.Errorf("unsupported pdf version %q (want one of %s)", o.version, strings.Join(pdfVersions, ", "))
+	}
+	switch o.xref {
+	case XRefTable:
+	case XRefStream:
+		if o.version < "1.5" {
+			return o, fmt.Errorf("pdf-xref stream needs pdf-version 1.5 or later, got %s", o.version)
+		}
+	default:
+		return o, fmt.Errorf("unknown pdf xref %q (want table or stream)", o.xref)
+	}
+	return o, nil
+}
+
+// buildObjects returns the serialised document objects, numbered from 1:
+// the catalog, the page tree, the font (text content only), then each page
+// followed by its content stream when o asks for content. With scan content
+// every page also gets an image XObject holding the matching entry of scans.
+// Each of o.files follows as a file specification and an embedded file
+// holding it, listed in the catalog's EmbeddedFiles name tree, and with
+// o.eicar one more holding the EICAR test string, attached as eicar.com.
+// With o.signature the signature field and dictionary of signatureObjects
+// follow, listed in the catalog's AcroForm. With o.meta or o.modified the document information dictionary is the
+// very last object.
+func buildObjects(o pdfOptions, scans []utils.ScanImage) []string {
+	const catalogObj, pagesObj = 1, 2
+	next := 3
+
+	fontObj := 0
+	if o.content == ContentText {
+		fontObj = next
+		next++
+	}
+
+	// Each page takes one object, plus one for its content stream and
+	// another for its scanned image.
+	perPage := 1
+	switch o.content {
+	case ContentNone:
+	case ContentScan:
+		perPage = 3
+	default:
+		perPage = 2
+	}
+	kids := make([]string, o.pages)
+	for i := range kids {
+		kids[i] = fmt.Sprintf("%d 0 R", next+i*perPage)
+	}
+
+	// The name tree lists the attachments sorted by name, which the
+	// attachment_NNN names are, ahead of eicar.com.
+	attached := o.files
+	if o.eicar {
+		attached = append(attached[:len(attached):len(attached)], embed.File{Name: "eicar.com", Data: utils.EICAR()})
+	}
+	catalog := fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R", pagesObj)
+	attachObj := next + o.pages*perPage
+	if len(attached) > 0 {
+		names := make([]string, len(attached))
+		for i, f := range attached {
+			names[i] = fmt.Sprintf("(%s) %d 0 R", f.Name, attachObj+2*i)
+		}
+		catalog += fmt.Sprintf(" /Names << /EmbeddedFiles << /Names [%s] >> >>", strings.Join(names, " "))
+	}
+	sigObj := attachObj + 2*len(attached)
+	if o.signature {
+		catalog += fmt.Sprintf(" /AcroForm << /Fields [%d 0 R] /SigFlags 3 >>", sigObj)
+	}
+	objs := []string{
+		fmt.Sprintf("%d 0 obj\n%s >>\nendobj\n", catalogObj, catalog),
+		fmt.Sprintf("%d 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", pagesObj, strings.Join(kids, " "), o.pages),
+	}
+	if fontObj != 0 {
+		objs = append(objs, fmt.Sprintf("%d 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>\nendobj\n", fontObj))
+	}
+
+	for i := 0; i < o.pages; i++ {
+		pageObj := next + i*perPage
+		page := fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d]", pagesObj, o.width, o.height)
+		if o.signature && i == 0 {
+			page += fmt.Sprintf(" /Annots [%d 0 R]", sigObj)
+		}
+		if o.content == ContentNone {
+			objs = append(objs, fmt.Sprintf("%d 0 obj\n%s >>\nendobj\n", pageObj, page))
+			continue
+		}
+		if fontObj != 0 {
+			page += fmt.Sprintf(" /Resources << /Font << /F1 %d 0 R >> >>", fontObj)
+		}
+		if o.content == ContentScan {
+			page += fmt.Sprintf(" /Resources << /XObject << /Im1 %d 0 R >> >>", pageObj+2)
+		}
+		objs = append(objs, fmt.Sprintf("%d 0 obj\n%s /Contents %d 0 R >>\nendobj\n", pageObj, page, pageObj+1))
+
+		var stream string
+		switch o.content {
+		case ContentText:
+			stream = textStream(o, o.needle.Count*(i+1)/o.pages-o.needle.Count*i/o.pages)
+		case ContentScan:
+			stream = fmt.Sprintf("q\n%d 0 0 %d 0 0 cm\n/Im1 Do\nQ", o.width, o.height)
+		default:
+			stream = drawingStream(o)
+		}
+		objs = append(objs, fmt.Sprintf("%d 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", pageObj+1, len(stream), stream))
+
+		if o.content == ContentScan {
+			img := scans[i]
+			objs = append(objs, fmt.Sprintf("%d 0 obj\n<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n%s\nendstream\nendobj\n",
+				pageObj+2, img.Width, img.Height, len(img.JPEG), img.JPEG))
+		}
+	}
+
+	for i, f := range attached {
+		spec := attachObj + 2*i
+		objs = append(objs,
+			fmt.Sprintf("%d 0 obj\n<< /Type /Filespec /F (%s) /UF (%s) /EF << /F %d 0 R >> >>\nendobj\n", spec, f.Name, f.Name, spec+1),
+			fmt.Sprintf("%d 0 obj\n<< /Type /EmbeddedFile /Length %d /Params << /Size %d >> >>\nstream\n%s\nendstream\nendobj\n", spec+1, len(f.Data), len(f.Data), f.Data))
+	}
+	if o.signature {
+		field, sig := signatureObjects(o, sigObj, next)
+		objs = append(objs, field, sig)
+	}
+	if o.hasInfo() {
+		objs = append(objs, fmt.Sprintf("%d 0 obj\n%s\nendobj\n", len(objs)+1, infoDict(o.meta, o.modified)))
+	}
+	return objs
+}
+
+// infoKeys maps well-known metadata keys to document information
+// dictionary entries; other keys are used as entry names as they are.
+var infoKeys = map[string]string{
+	ports.MetaTitle:    "Title",
+	ports.MetaAuthor:   "Author",
+	ports.MetaSubject:  "Subject",
+	ports.MetaKeywords: "Keywords",
+	ports.MetaCreator:  "Creator",
+	ports.MetaComment:  "Comment",
+}
+
+// hasInfo reports whether the document gets an information dictionary.
+func (o pdfOptions) hasInfo() bool {
+	return len(o.meta) > 0 || !o.modified.IsZero()
+}
+
+// infoDict renders m as a document information dictionary, dated modified
+// unless it is zero.
+func infoDict(m ports.Metadata, modified time.Time) string {
+	var b strings.Builder
+	b.WriteString("<<")
+	if !modified.IsZero() {
+		date := modified.UTC().Format("D:20060102150405Z")
+		fmt.Fprintf(&b, " /CreationDate (%s) /ModDate (%s)", date, date)
+	}
+	for _, k := range m.Keys() {
+		name, ok := infoKeys[k]
+		if !ok {
+			name = k
+		}
+		fmt.Fprintf(&b, " /%s %s", name, pdfString(m[k]))
+	}
+	b.WriteString(" >>")
+	return b.String()
+}
+
+// pdfString encodes s as a PDF text string: a literal string for ASCII,
+// otherwise UTF-16BE with a byte order mark in hex.
+func pdfString(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		ascii = ascii && s[i] < 0x80
+	}
+	if ascii {
+		r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`, "\n", `\n`)
+		return "(" + r.Replace(s) + ")"
+	}
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// scanImages renders one scanned page image per page at o.dpi, sharing out
+// what is left of budget once the rest of the document is accounted for.
+// budget is the file size minus the header.
+func scanImages(o pdfOptions, budget int64) ([]utils.ScanImage, error) {
+	// Lay out the document with empty images of the widest plausible
+	// dimensions to measure everything but the JPEG data.
+	placeholders := make([]utils.ScanImage, o.pages)
+	for i := range placeholders {
+		placeholders[i] = utils.ScanImage{Width: 99999, Height: 99999}
+	}
+	skeleton := buildObjects(o, placeholders)
+	var structure int64
+	for _, obj := range skeleton {
+		structure += int64(len(obj))
+	}
+	// Room for the xref table, trailer, the padding stream's dictionary and
+	// the image /Length values.
+	structure += int64(20*(len(skeleton)+2)) + 160 + int64(10*o.pages)
+
+	perPage := (budget - structure) / int64(o.pages)
+	if perPage <= 0 {
+		return nil, fmt.Errorf("requested size is too small for %d scanned page(s)", o.pages)
+	}
+	scans := make([]utils.ScanImage, o.pages)
+	quality := 0
+	for i := range scans {
+		img, err := utils.RenderScanJPEG(o.rand, o.width, o.height, o.dpi, perPage, quality)
+		if err != nil {
+			return nil, fmt.Errorf("requested size is too small for %d scanned page(s): %w", o.pages, err)
+		}
+		scans[i], quality = img, img.Quality
+	}
+	return scans, nil
+}
+
+// Layout of text content: 11pt Helvetica on 14pt lines, an inch in from
+// the edges of the page.
+const textMargin, textFontSize, textLeading = 72, 11, 14
+
+// textArea returns how many characters fit on a line of text content, as
+// Helvetica averages roughly half an em per character, and how many lines
+// fit on a page.
+func (o pdfOptions) textArea() (width, lines int) {
+	return (o.width - 2*textMargin) * 2 / textFontSize, (o.height - 2*textMargin) / textLeading
+}
+
+// textStream lays out o.paragraphs paragraphs of lorem text, stopping at
+// the bottom margin, with lines showing o.needle spread evenly among them
+// needles times.
+func textStream(o pdfOptions, needles int) string {
+	width, maxLines := o.textArea()
+	var text []string // lines of the paragraphs; "" ends a paragraph
+	for p := 0; p < o.paragraphs && len(text) < maxLines-needles; p++ {
+		for _, line := range utils.WrapWords(utils.RandParagraph(o.rand, 3, 6), width) {
+			if len(text) == maxLines-needles {
+				break
+			}
+			text = append(text, line)
+		}
+		text = append(text, "")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", textFontSize, textLeading, textMargin, o.height-textMargin)
+	needle := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(o.needle.Text)
+	planted := 0
+	plant := func(through int) {
+		for ; planted < needles && (utils.Needle{Count: needles}).At(planted, int64(len(text))) <= int64(through); planted++ {
+			fmt.Fprintf(&b, "(%s) '\n", needle)
+		}
+	}
+	for i, line := range text {
+		if line == "" {
+			b.WriteString("T*\n")
+		} else {
+			fmt.Fprintf(&b, "(%s) '\n", line)
+		}
+		plant(i)
+	}
+	plant(len(text))
+	b.WriteString("ET")
+	return b.String()
+}
+
+// drawingStream draws o.shapes randomly placed rectangles, lines and
+// circles in random colours.
+func drawingStream(o pdfOptions) string {
+	var b strings.Builder
+	for i := 0; i < o.shapes; i++ {
+		fmt.Fprintf(&b, "%.3f %.3f %.3f RG %d w\n", o.rand.Float64(), o.rand.Float64(), o.rand.Float64(), 1+o.rand.IntN(4))
+		x, y := o.rand.IntN(o.width), o.rand.IntN(o.height)
+		switch o.rand.IntN(3) {
+		case 0:
+			fmt.Fprintf(&b, "%d %d %d %d re S\n", x, y, 10+o.rand.IntN(150), 10+o.rand.IntN(150))
+		case 1:
+			fmt.Fprintf(&b, "%d %d m %d %d l S\n", x, y, o.rand.IntN(o.width), o.rand.IntN(o.height))
+		default:
+			b.WriteString(circle(float64(x), float64(y), float64(5+o.rand.IntN(80))))
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// circle approximates a circle of radius r centred on (x, y) with four
+// Bézier curves.
+func circle(x, y, r float64) string {
+	k := 0.5523 * r
+	return fmt.Sprintf("%.1f %.1f m "+
+		"%.1f %.1f %.1f %.1f %.1f %.1f c "+
+		"%.1f %.1f %.1f %.1f %.1f %.1f c "+
+		"%.1f %.1f %.1f %.1f %.1f %.1f c "+
+		"%.1f %.1f %.1f %.1f %.1f %.1f c S\n",
+		x+r, y,
+		x+r, y+k, x+k, y+r, x, y+r,
+		x-k, y+r, x-r, y+k, x-r, y,
+		x-r, y-k, x-k, y-r, x, y-r,
+		x+k, y-r, x+r, y-k, x+r, y)
+}
@@ -1,15 +1,17 @@
 package pdf
 
 import (
-	"bytes"
-	cryptRand "crypto/rand"
 	_ "embed"
 	"fmt"
 	"io"
-	"os"
+	"strconv"
 
+	"github.com/hailam/genfile/internal/adapters/embed"
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/logging"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func init() {
@@ -20,183 +22,228 @@ func New() ports.FileGenerator {
 	return &PDFGenerator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *PDFGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *PDFGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// WithFactory returns a copy of the generator that makes the attachments
+// with the generators of f.
+func (g *PDFGenerator) WithFactory(f ports.GeneratorFactory) ports.FileGenerator {
+	c := *g
+	c.factory = f
+	return &c
+}
+
 // PDFGenerator implements FileGenerator to create minimal PDFs of a specific size.
-type PDFGenerator struct{}
+type PDFGenerator struct {
+	opts ports.Options // set by Configure
+	log  ports.Logger
+	meta ports.Metadata
+	fs   ports.OutputFS // set by WithOutputFS
+	// factory makes the attachments; set by WithFactory.
+	factory ports.GeneratorFactory
+}
+
+// WithLogger returns a copy of the generator that reports to l.
+func (g *PDFGenerator) WithLogger(l ports.Logger) ports.FileGenerator {
+	c := *g
+	c.log = l
+	return &c
+}
+
+// WithMetadata returns a copy of the generator that writes m into the
+// document information dictionary.
+func (g *PDFGenerator) WithMetadata(m ports.Metadata) ports.FileGenerator {
+	c := *g
+	c.meta = m
+	return &c
+}
+
+func (g *PDFGenerator) logger() ports.Logger {
+	if g.log == nil {
+		return logging.Nop
+	}
+	return g.log
+}
+
+// Templates of the padding stream and the trailer structure.
+const (
+	streamDictTemplateFmt = "%d 0 obj\n<< /Length %d >>\nstream\n" // Padding object dict
+	streamEndMarker       = "\nendstream\nendobj\n"                // After stream data
+	xrefEntryFmt          = "%010d 00000 n \n"                     // XRef entry format
+	xrefEntry0            = "0000000000 65535 f \n"                // XRef entry for object 0
+	startxrefTemplateFmt  = "startxref\n%d\n"                      // startxref line
+	eofMarker             = "%%EOF"                                // End Of File marker
+)
+
+// header returns the %PDF header line and the binary comment after it.
+func header(o pdfOptions) string {
+	// The binary comment is recommended for files with binary data
+	return "%PDF-" + o.version + "\n%âãÏÓ\n"
+}
+
+// ForCount returns a generator of a document of c.N pages, and the size of
+// the PDF holding it with an empty padding stream. The pages, with their
+// content and attachments, are built once with the options the generator
+// was configured with; larger sizes pad them.
+func (g *PDFGenerator) ForCount(c ports.Count) (ports.FileGenerator, int64, error) {
+	if c.Unit != ports.CountPages {
+		return nil, 0, fmt.Errorf("PDF documents are counted in pages, not %s", c.Unit)
+	}
+	opts := g.opts.With(ports.Options{"pdf-pages": strconv.FormatInt(c.N, 10)})
+	o, err := parseOptions(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if o.content == ContentScan {
+		return nil, 0, fmt.Errorf("scanned pages are sized to fill the file; choose another pdf-content")
+	}
+	o.meta = g.meta
+	if o.files, err = embed.Render(g.factory, g.fs, o.attachments, "attachment", embed.Options(opts, "pdf-")); err != nil {
+		return nil, 0, err
+	}
+	bodies := buildObjects(o, nil)
+	return &builtPDF{g, o, bodies}, newLayout(o, bodies).size(0), nil
+}
+
+// builtPDF is the generator ForCount returns: it writes the document
+// objects it holds, padded to the size asked for.
+type builtPDF struct {
+	g      *PDFGenerator
+	o      pdfOptions
+	bodies []string
+}
+
+func (b *builtPDF) Generate(outPath string, sizeBytes int64) error {
+	return b.g.write(outPath, sizeBytes, b.o, b.bodies)
+}
+
+// GenerateWithOptions is Generate; the document was built with the options
+// it has, and opts are ignored.
+func (b *builtPDF) GenerateWithOptions(outPath string, sizeBytes int64, _ ports.Options) error {
+	return b.Generate(outPath, sizeBytes)
+}
 
 // Generate creates a minimal PDF file at outPath with exactly sizeBytes length.
 // It embeds a stream of random (uncompressible) data to achieve the target size.
 func (g *PDFGenerator) Generate(outPath string, sizeBytes int64) error {
+	return g.GenerateWithOptions(outPath, sizeBytes, nil)
+}
+
+// GenerateWithOptions creates a PDF at outPath with exactly sizeBytes length.
+// opts select the page count, page size, per-page content and PDF version,
+// and may attach files rendered by other generators ("pdf-attachments",
+// such as "png:50KB,csv:20KB") and the EICAR test string; a trailing stream
+// of random data pads the file to the exact size. "embed-string" is shown
+// "embed-count" times, once if unset, as lines of the text content, which
+// it makes the default, shared out between the pages. Options not
+// starting with "pdf-" apply to the attachments, but for the EICAR and
+// planted strings. Metadata set with WithMetadata goes into
+// the document information dictionary, as do creation and modification
+// dates from the "mtime" option. "threads" makes the padding stream on
+// that many goroutines. "pdf-xref" stream cross-references the objects
+// with a cross-reference stream instead of a table, and packs those that
+// are not streams into a compressed object stream, as PDF 1.5 allows.
+// "signature-placeholder" prepares the document for signing with an
+// unsigned signature field and a /ByteRange placeholder.
+func (g *PDFGenerator) GenerateWithOptions(outPath string, sizeBytes int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	o.meta = g.meta
+	if o.files, err = embed.Render(g.factory, g.fs, o.attachments, "attachment", embed.Options(opts, "pdf-")); err != nil {
+		return err
+	}
+
 	// --- Basic Size Check ---
-	// Estimate minimum size needed for the PDF structure itself.
-	// This is approximate, but avoids calculations for impossibly small files.
-	// A safe lower bound is ~250-300 bytes.
+	// A safe lower bound for any PDF structure; the exact minimum for the
+	// requested layout is checked once the objects are built.
 	const minStructureSize = 300
 	if sizeBytes < minStructureSize {
 		return fmt.Errorf("requested size %d bytes is too small for a minimal PDF structure (minimum ~%d bytes)", sizeBytes, minStructureSize)
 	}
 
-	// --- Buffers for PDF Parts & Offset Tracking ---
-	var headerBuf bytes.Buffer  // %PDF header
-	var objectsBuf bytes.Buffer // Objects 1, 2, 3, and 4's dictionary part
-	var trailerBuf bytes.Buffer // XRef table, trailer dict, startxref, %%EOF
-
-	// Store the starting byte offset of each object (index matches object number)
-	offsets := make([]int64, 5) // 0: unused, 1: Catalog, 2: Pages, 3: Page, 4: Stream Object
-
-	// --- Build Header Part ---
-	headerBuf.WriteString("%PDF-1.7\n")
-	// Optional: Add binary comment often recommended for binary PDFs
-	headerBuf.WriteString("%âãÏÓ\n") // Use \n for line endings per convention
-
-	currentOffset := int64(headerBuf.Len())
-
-	// --- Build Core Objects (Object 1: Catalog) ---
-	offsets[1] = currentOffset
-	obj1Str := fmt.Sprintf("%d 0 obj\n<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", 1, 2)
-	objectsBuf.WriteString(obj1Str)
-	currentOffset += int64(len(obj1Str))
-
-	// --- Build Core Objects (Object 2: Pages Root) ---
-	offsets[2] = currentOffset
-	obj2Str := fmt.Sprintf("%d 0 obj\n<< /Type /Pages /Kids [%d 0 R] /Count 1 >>\nendobj\n", 2, 3)
-	objectsBuf.WriteString(obj2Str)
-	currentOffset += int64(len(obj2Str))
-
-	// --- Build Core Objects (Object 3: Minimal Page) ---
-	offsets[3] = currentOffset
-	// Using a tiny MediaBox; content is irrelevant for this generator.
-	obj3Str := fmt.Sprintf("%d 0 obj\n<< /Type /Page /Parent %d 0 R /MediaBox [0 0 10 10] >>\nendobj\n", 3, 2)
-	objectsBuf.WriteString(obj3Str)
-	currentOffset += int64(len(obj3Str))
-
-	// --- Calculate Stream Data Length (LLLL) ---
-	// This requires knowing the size of ALL OTHER parts, including the trailer
-	// which depends on offsets calculated LATER. This creates a dependency cycle.
-	// Strategy: Calculate size based on TEMPLATES for later parts, then adjust.
-
-	offsets[4] = currentOffset // Tentative offset for stream object start
-
-	// Templates for dynamic parts (placeholders for stream length LLLL and offsets)
-	streamDictTemplateFmt := "%d 0 obj\n<< /Length %d >>\nstream\n" // Object 4 dict
-	streamEndMarker := "\nendstream\nendobj\n"                      // After stream data
-	xrefHeader := "xref\n0 5\n"                                     // XRef table start
-	xrefEntryFmt := "%010d 00000 n \n"                              // XRef entry format
-	xrefEntry0 := "0000000000 65535 f \n"                           // XRef entry for object 0
-	trailerTemplate := "trailer\n<< /Size 5 /Root 1 0 R >>\n"       // Trailer dictionary
-	startxrefTemplateFmt := "startxref\n%d\n"                       // startxref line
-	eofMarker := "%%EOF"                                            // End Of File marker
-
-	// Function to calculate size of the trailer structure given offsets and LLLL
-	calculateTrailerSize := func(o []int64, startXRefOffset int64) int64 {
-		size := int64(len(xrefHeader))
-		size += int64(len(xrefEntry0))
-		size += int64(len(fmt.Sprintf(xrefEntryFmt, o[1])))
-		size += int64(len(fmt.Sprintf(xrefEntryFmt, o[2])))
-		size += int64(len(fmt.Sprintf(xrefEntryFmt, o[3])))
-		size += int64(len(fmt.Sprintf(xrefEntryFmt, o[4]))) // Offset of stream obj
-		size += int64(len(trailerTemplate))
-		size += int64(len(fmt.Sprintf(startxrefTemplateFmt, startXRefOffset)))
-		size += int64(len(eofMarker))
-		return size
-	}
-
-	// Initial estimation loop (usually 1-2 iterations needed)
-	var streamDataLen int64 = 0
-	//var finalTrailerSize int64 = 0
-	var finalStreamDictSize int64 = 0
-	var startXRefOffset int64 = 0 // Offset of the 'xref' keyword
-
-	for i := 0; i < 3; i++ { // Limit iterations to prevent infinite loops
-		// Calculate size of stream dictionary based on current streamDataLen estimate
-		streamDictStr := fmt.Sprintf(streamDictTemplateFmt, 4, streamDataLen)
-		finalStreamDictSize = int64(len(streamDictStr))
-
-		// Calculate size of fixed parts + stream dict + stream end marker
-		nonTrailerSize := int64(headerBuf.Len()) + int64(objectsBuf.Len()) + finalStreamDictSize + int64(len(streamEndMarker))
-
-		// Estimate startXRefOffset (position right after stream object's endobj)
-		startXRefOffset = nonTrailerSize + streamDataLen // Offset where 'xref' will start
-
-		// Estimate trailer size based on current offsets and estimated startXRefOffset
-		estimatedTrailerSize := calculateTrailerSize(offsets, startXRefOffset)
-
-		// Calculate required stream data length
-		newStreamDataLen := sizeBytes - nonTrailerSize - estimatedTrailerSize
+	// --- Build Document Objects ---
+	var scans []utils.ScanImage
+	if o.content == ContentScan {
+		if scans, err = scanImages(o, sizeBytes-int64(len(header(o)))); err != nil {
+			return err
+		}
+	}
+	return g.write(outPath, sizeBytes, o, buildObjects(o, scans))
+}
 
+// write writes a PDF of the document objects bodies, numbered from 1,
+// followed by a padding stream that brings it to exactly sizeBytes and the
+// cross-reference section.
+func (g *PDFGenerator) write(outPath string, sizeBytes int64, o pdfOptions, bodies []string) error {
+	l := newLayout(o, bodies)
+
+	// The padding stream's length shows in its dictionary and moves the
+	// cross-reference section, whose offset is written at the end of the
+	// file, so iterate until it converges (usually 1-2 iterations).
+	var streamDataLen int64
+	converged := false
+	for i := 0; i < 4; i++ { // Limit iterations to prevent infinite loops
+		newStreamDataLen := sizeBytes - (l.size(streamDataLen) - streamDataLen)
 		if newStreamDataLen < 0 {
-			// This can happen if the estimated trailer size grows due to larger offsets
-			// in the second iteration, making the target size impossible.
-			return fmt.Errorf("calculated negative stream data length (%d) for target size %d bytes after iteration %d. Target size is likely too small for structure overhead.", newStreamDataLen, sizeBytes, i+1)
+			minimum := sizeBytes - newStreamDataLen
+			return fmt.Errorf("requested size %d bytes is too small for a minimal PDF structure with %d page(s) (minimum %d bytes)", sizeBytes, o.pages, minimum)
 		}
-
-		// If length converges, break the loop
 		if newStreamDataLen == streamDataLen && i > 0 {
-			//finalTrailerSize = estimatedTrailerSize // Store the final calculated trailer size
+			converged = true
 			break
 		}
-
 		streamDataLen = newStreamDataLen
-		//finalTrailerSize = estimatedTrailerSize // Update for next iteration or final use
-
-		// Sanity check for the last iteration if size still not converged (unlikely)
-		if i == 2 && newStreamDataLen != streamDataLen {
-			return fmt.Errorf("failed to converge on stream data length calculation after %d iterations", i+1)
-		}
 	}
-
-	// --- Final Assembly Calculation ---
-	// Add the final stream dictionary to the objects buffer
-	finalStreamDictStr := fmt.Sprintf(streamDictTemplateFmt, 4, streamDataLen)
-	objectsBuf.WriteString(finalStreamDictStr)
-
-	// Calculate final startXRefOffset precisely
-	startXRefOffset = int64(headerBuf.Len()+objectsBuf.Len()) + streamDataLen + int64(len(streamEndMarker))
-
-	// --- Build Trailer Structure ---
-	trailerBuf.WriteString(xrefHeader)
-	trailerBuf.WriteString(xrefEntry0)
-	trailerBuf.WriteString(fmt.Sprintf(xrefEntryFmt, offsets[1]))
-	trailerBuf.WriteString(fmt.Sprintf(xrefEntryFmt, offsets[2]))
-	trailerBuf.WriteString(fmt.Sprintf(xrefEntryFmt, offsets[3]))
-	trailerBuf.WriteString(fmt.Sprintf(xrefEntryFmt, offsets[4])) // Use final calculated offset
-	trailerBuf.WriteString(trailerTemplate)
-	trailerBuf.WriteString(fmt.Sprintf(startxrefTemplateFmt, startXRefOffset))
-	trailerBuf.WriteString(eofMarker)
+	if !converged {
+		return fmt.Errorf("failed to converge on stream data length calculation for target size %d", sizeBytes)
+	}
+	l.fillByteRange(sizeBytes)
+	padDict := l.padDict(streamDataLen)
+	trailer := l.trailer(l.length + int64(len(padDict)) + streamDataLen + int64(len(streamEndMarker)))
 
 	// --- Size Verification (Crucial) ---
-	calculatedTotalSize := int64(headerBuf.Len()) + int64(objectsBuf.Len()) + streamDataLen + int64(len(streamEndMarker)) + int64(trailerBuf.Len())
-
+	calculatedTotalSize := l.length + int64(len(padDict)) + streamDataLen + int64(len(streamEndMarker)) + int64(len(trailer))
 	if calculatedTotalSize != sizeBytes {
 		// This *shouldn't* happen if the iterative calculation worked, but check anyway.
 		return fmt.Errorf("internal calculation error: final calculated size %d does not match target size %d", calculatedTotalSize, sizeBytes)
 	}
 
-	// --- Generate Random Stream Data ---
-	randomData := make([]byte, streamDataLen)
-	if streamDataLen > 0 { // Only read if length > 0
-		if _, err := io.ReadFull(cryptRand.Reader, randomData); err != nil {
-			return fmt.Errorf("failed to generate %d bytes of random data: %w", streamDataLen, err)
-		}
-	}
-
 	// --- Write to Output File ---
-	file, err := os.Create(outPath)
+	file, err := outputfs.Create(g.fs, outPath)
 	if err != nil {
 		return fmt.Errorf("failed to create output file '%s': %w", outPath, err)
 	}
 	defer file.Close() // Ensure file is closed on exit
 
 	// Write parts sequentially
-	if _, err := headerBuf.WriteTo(file); err != nil {
-		return fmt.Errorf("failed to write PDF header: %w", err)
-	}
-	if _, err := objectsBuf.WriteTo(file); err != nil {
-		return fmt.Errorf("failed to write PDF objects: %w", err)
+	for _, part := range append(l.parts, padDict) {
+		if _, err := io.WriteString(file, part); err != nil {
+			return fmt.Errorf("failed to write PDF objects: %w", err)
+		}
 	}
 
-	// Write the stream data directly
+	// Stream the random padding data directly
 	if streamDataLen > 0 {
-		if _, err := file.Write(randomData); err != nil {
+		if err := utils.WriteParallel(file, streamDataLen, o.threads, o.rand.FillAt); err != nil {
 			return fmt.Errorf("failed to write PDF stream data: %w", err)
 		}
 	}
@@ -207,7 +254,7 @@ func (g *PDFGenerator) Generate(outPath string, sizeBytes int64) error {
 	}
 
 	// Write the trailer structure
-	if _, err := trailerBuf.WriteTo(file); err != nil {
+	if _, err := io.WriteString(file, trailer); err != nil {
 		return fmt.Errorf("failed to write PDF trailer structure: %w", err)
 	}
 
@@ -217,10 +264,10 @@ func (g *PDFGenerator) Generate(outPath string, sizeBytes int64) error {
 	}
 
 	// Final check of actual file size on disk (optional but recommended)
-	info, err := os.Stat(outPath)
+	info, err := outputfs.Stat(g.fs, outPath)
 	if err != nil {
 		// Don't return error here, generation might have succeeded but stat failed
-		fmt.Fprintf(os.Stderr, "Warning: could not stat output file '%s': %v\n", outPath, err)
+		g.logger().Warnf("could not stat output file '%s': %v", outPath, err)
 	} else if info.Size() != sizeBytes {
 		// This indicates a flaw in calculation or writing
 		return fmt.Errorf("internal error: final file size on disk (%d) does not match target size (%d)", info.Size(), sizeBytes)
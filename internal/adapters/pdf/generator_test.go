@@ -1,10 +1,18 @@
 package pdf
 
 import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	_ "github.com/hailam/genfile/internal/adapters/csv"
+	_ "github.com/hailam/genfile/internal/adapters/png"
+	"github.com/hailam/genfile/internal/ports"
 	"github.com/stretchr/testify/require"
 )
 
@@ -108,3 +116,300 @@ func TestPDFGenerator_Generate(t *testing.T) {
 		require.ErrorIs(t, err, os.ErrNotExist, "Error should indicate path does not exist or cannot be created") // Or os.ErrPermission depending on path/OS
 	})
 }
+
+func TestPDFGenerator_GenerateWithOptions(t *testing.T) {
+	generator := &PDFGenerator{}
+
+	tests := []struct {
+		name      string
+		size      int64
+		opts      ports.Options
+		pages     int
+		mediaBox  string
+		version   string
+		contains  string
+		wantError string
+	}{
+		{name: "DefaultOptions", size: 4096, pages: 1, mediaBox: "[0 0 595 842]", version: "1.7"},
+		{name: "BlankPagesLetter", size: 8192, opts: ports.Options{"pdf-pages": "10", "pdf-page-size": "letter"}, pages: 10, mediaBox: "[0 0 612 792]", version: "1.7"},
+		{name: "TextContent", size: 256 * 1024, opts: ports.Options{"pdf-pages": "3", "pdf-content": "text", "pdf-version": "1.4"}, pages: 3, mediaBox: "[0 0 595 842]", version: "1.4", contains: "/BaseFont /Helvetica"},
+		{name: "DrawingContent", size: 128 * 1024, opts: ports.Options{"pdf-pages": "2", "pdf-content": "drawing", "pdf-page-size": "a3"}, pages: 2, mediaBox: "[0 0 842 1191]", version: "1.7", contains: " RG "},
+		{name: "ScanContent", size: 400 * 1024, opts: ports.Options{"pdf-pages": "3", "pdf-content": "scan", "scan-dpi": "100"}, pages: 3, mediaBox: "[0 0 595 842]", version: "1.7", contains: "/Filter /DCTDecode"},
+		{name: "EICARAttachment", size: 16 * 1024, opts: ports.Options{"eicar": "true", "pdf-pages": "2", "pdf-content": "text"}, pages: 2, mediaBox: "[0 0 595 842]", version: "1.7", contains: "/EmbeddedFiles << /Names [(eicar.com) "},
+		{name: "Attachments", size: 128 * 1024, opts: ports.Options{"pdf-attachments": "png:20KB, csv:10KB", "eicar": "true", "png-color": "gray"}, pages: 1, mediaBox: "[0 0 595 842]", version: "1.7", contains: "/EmbeddedFiles << /Names [(attachment_001.png) 4 0 R (attachment_002.csv) 6 0 R (eicar.com) 8 0 R] >>"},
+		{name: "MTime", size: 4096, opts: ports.Options{"mtime": "2020-01-01T01:00:00+01:00"}, pages: 1, mediaBox: "[0 0 595 842]", version: "1.7", contains: "<< /CreationDate (D:20200101000000Z) /ModDate (D:20200101000000Z) >>"},
+		{name: "EmbedString", size: 64 * 1024, opts: ports.Options{"embed-string": "NEEDLE-12345", "embed-count": "10", "pdf-pages": "3"}, pages: 3, mediaBox: "[0 0 595 842]", version: "1.7", contains: "(NEEDLE-12345) '"},
+		{name: "EmbedStringDrawing", size: 4096, opts: ports.Options{"embed-string": "NEEDLE-12345", "pdf-content": "drawing"}, wantError: "embed-string needs pdf-content text"},
+		{name: "EmbedStringNotASCII", size: 4096, opts: ports.Options{"embed-string": "naïve"}, wantError: "must be ASCII"},
+		{name: "EmbedCountPastPage", size: 4096, opts: ports.Options{"embed-string": "NEEDLE-12345", "embed-count": "1000"}, wantError: "needs more pages"},
+		{name: "BadMTime", size: 4096, opts: ports.Options{"mtime": "soon"}, wantError: "option mtime"},
+		{name: "TooSmallForScans", size: 1024, opts: ports.Options{"pdf-pages": "3", "pdf-content": "scan"}, wantError: "too small for 3 scanned page(s)"},
+		{name: "TooSmallForPages", size: 1024, opts: ports.Options{"pdf-pages": "50"}, wantError: "too small for a minimal PDF structure"},
+		{name: "TooSmallForAttachments", size: 16 * 1024, opts: ports.Options{"pdf-attachments": "csv:20KB"}, wantError: "too small for a minimal PDF structure"},
+		{name: "BadAttachment", size: 4096, opts: ports.Options{"pdf-attachments": "png"}, wantError: "not type:size"},
+		{name: "UnknownAttachmentType", size: 4096, opts: ports.Options{"pdf-attachments": "nope:1KB"}, wantError: "embedded file type"},
+		{name: "UnknownPageSize", size: 4096, opts: ports.Options{"pdf-page-size": "b5"}, wantError: "unknown pdf page size"},
+		{name: "UnknownContent", size: 4096, opts: ports.Options{"pdf-content": "video"}, wantError: "unknown pdf content"},
+		{name: "UnsupportedVersion", size: 4096, opts: ports.Options{"pdf-version": "3.0"}, wantError: "unsupported pdf version"},
+		{name: "ZeroPages", size: 4096, opts: ports.Options{"pdf-pages": "0"}, wantError: "pdf-pages must be at least 1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(t.TempDir(), "out.pdf")
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.wantError != "" {
+				require.ErrorContains(t, err, tc.wantError)
+				_, statErr := os.Stat(outPath)
+				require.ErrorIs(t, statErr, os.ErrNotExist, "File should not exist for failed generation")
+				return
+			}
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(outPath)
+			require.NoError(t, err)
+			require.Equal(t, tc.size, int64(len(data)), "Generated file size should match target size exactly")
+			require.True(t, bytes.HasPrefix(data, []byte("%PDF-"+tc.version+"\n")), "Header should carry the requested version")
+			require.True(t, bytes.HasSuffix(data, []byte("%%EOF")), "File should end with %%EOF")
+			require.Equal(t, tc.pages, bytes.Count(data, []byte("/Type /Page /Parent")), "Page object count")
+			require.Contains(t, string(data), fmt.Sprintf("/Count %d", tc.pages))
+			require.Contains(t, string(data), "/MediaBox "+tc.mediaBox)
+			if tc.contains != "" {
+				require.Contains(t, string(data), tc.contains)
+			}
+		})
+	}
+}
+
+func TestPDFGenerator_EmbedString(t *testing.T) {
+	// The string is shown as often as asked, escaped, and not again in the
+	// attachments.
+	outPath := filepath.Join(t.TempDir(), "needle.pdf")
+	opts := ports.Options{"embed-string": `NEEDLE (1)\`, "embed-count": "25", "pdf-pages": "4", "pdf-attachments": "csv:8KB"}
+	require.NoError(t, (&PDFGenerator{}).GenerateWithOptions(outPath, 64*1024, opts))
+	data, err := os.ReadFile(outPath)
+	require.NoError(t, err)
+	require.Equal(t, 25, bytes.Count(data, []byte(`(NEEDLE \(1\)\\) '`)))
+	require.Equal(t, 25, bytes.Count(data, []byte("NEEDLE")))
+}
+
+func TestPDFGenerator_ForCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		count     ports.Count
+		opts      ports.Options
+		wantError string
+	}{
+		{name: "BlankPages", count: ports.Count{Unit: ports.CountPages, N: 100}},
+		{name: "TextPages", count: ports.Count{Unit: ports.CountPages, N: 12}, opts: ports.Options{"pdf-content": "text", "pdf-pages": "3"}},
+		{name: "AttachmentsAndInfo", count: ports.Count{Unit: ports.CountPages, N: 2}, opts: ports.Options{"pdf-attachments": "csv:2KB", "mtime": "2020-01-01T00:00:00Z"}},
+		{name: "XRefStream", count: ports.Count{Unit: ports.CountPages, N: 40}, opts: ports.Options{"pdf-xref": "stream", "mtime": "2020-01-01T00:00:00Z"}},
+		{name: "Scans", count: ports.Count{Unit: ports.CountPages, N: 2}, opts: ports.Options{"pdf-content": "scan"}, wantError: "choose another pdf-content"},
+		{name: "Rows", count: ports.Count{Unit: ports.CountRows, N: 2}, wantError: "counted in pages"},
+		{name: "ZeroPages", count: ports.Count{Unit: ports.CountPages}, wantError: "pdf-pages must be at least 1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := (&PDFGenerator{}).Configure(tc.opts)
+			require.NoError(t, err)
+			sized, size, err := g.(ports.CountGenerator).ForCount(tc.count)
+			if tc.wantError != "" {
+				require.ErrorContains(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+
+			outPath := filepath.Join(t.TempDir(), "out.pdf")
+			require.NoError(t, sized.Generate(outPath, size))
+			data, err := os.ReadFile(outPath)
+			require.NoError(t, err)
+			require.Equal(t, size, int64(len(data)))
+			if tc.opts["pdf-xref"] == "stream" {
+				// The pages are compressed into the object stream.
+				require.Contains(t, string(data), "/Type /ObjStm")
+			} else {
+				require.Equal(t, int(tc.count.N), bytes.Count(data, []byte("/Type /Page /Parent")), "Page object count")
+			}
+			require.Contains(t, string(data), "<< /Length 0 >>\nstream\n\nendstream", "Padding stream should be empty")
+		})
+	}
+}
+
+func TestPDFGenerator_WithMetadata(t *testing.T) {
+	generator := New().(ports.MetadataCapable).WithMetadata(ports.Metadata{
+		ports.MetaTitle:  "Q3 (draft)",
+		ports.MetaAuthor: "Zoë",
+		"Department":     "Finance",
+	})
+	outPath := filepath.Join(t.TempDir(), "meta.pdf")
+	const size = 8 * 1024
+	require.NoError(t, generator.Generate(outPath, size))
+
+	data, err := os.ReadFile(outPath)
+	require.NoError(t, err)
+	require.Equal(t, int64(size), int64(len(data)), "Generated file size should match target size exactly")
+	require.Contains(t, string(data), `<< /Department (Finance) /Author <FEFF005A006F00EB> /Title (Q3 \(draft\)) >>`)
+	require.Regexp(t, `trailer\n<< /Size \d+ /Root 1 0 R /Info \d+ 0 R >>`, string(data))
+}
+
+func TestPDFGenerator_Resize(t *testing.T) {
+	generator := &PDFGenerator{}
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src.pdf")
+	require.NoError(t, generator.GenerateWithOptions(src, 5000, ports.Options{"pdf-pages": "2"}))
+
+	// Resizing twice chains two updates onto the original.
+	once := filepath.Join(tempDir, "once.pdf")
+	twice := filepath.Join(tempDir, "twice.pdf")
+	require.NoError(t, generator.Resize(src, once, 20000))
+	require.NoError(t, generator.Resize(once, twice, 1000000))
+
+	for path, size := range map[string]int{once: 20000, twice: 1000000} {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, size, len(data))
+		// The last startxref points at the new section, whose entry points
+		// at the new object and whose trailer links the one before.
+		trailer, err := readTrailer(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(data[trailer.startxref:], []byte("xref\n")), "startxref of %s", path)
+		var obj, offset, prev int
+		_, err = fmt.Sscanf(string(data[trailer.startxref:]), "xref\n%d 1\n%d 00000 n", &obj, &offset)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(data[offset:], []byte(fmt.Sprintf("%d 0 obj", obj))), "object offset of %s", path)
+		require.Equal(t, obj+1, trailer.size)
+		require.Contains(t, trailer.refs, "/Root 1 0 R")
+		_, err = fmt.Sscanf(string(data[bytes.LastIndex(data, []byte("/Prev")):]), "/Prev %d", &prev)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(data[prev:], []byte("xref\n")), "previous section of %s", path)
+	}
+
+	require.Error(t, generator.Resize(src, filepath.Join(tempDir, "small.pdf"), 4000))
+}
+
+func TestPDFGenerator_XRefStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int64
+		opts      ports.Options
+		wantError string
+	}{
+		{name: "BlankPages", size: 4096, opts: ports.Options{"pdf-pages": "5"}},
+		{name: "TextAttachmentsInfo", size: 96 * 1024, opts: ports.Options{"pdf-pages": "3", "pdf-content": "text", "pdf-attachments": "csv:8KB", "eicar": "true", "mtime": "2020-01-01T00:00:00Z"}},
+		{name: "Version20", size: 70000, opts: ports.Options{"pdf-content": "drawing", "pdf-version": "2.0"}},
+		{name: "OldVersion", size: 4096, opts: ports.Options{"pdf-version": "1.4"}, wantError: "needs pdf-version 1.5"},
+		{name: "UnknownForm", size: 4096, opts: ports.Options{"pdf-xref": "tree"}, wantError: "unknown pdf xref"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := ports.Options{"pdf-xref": "stream"}.With(tc.opts)
+			outPath := filepath.Join(t.TempDir(), "out.pdf")
+			err := (&PDFGenerator{}).GenerateWithOptions(outPath, tc.size, opts)
+			if tc.wantError != "" {
+				require.ErrorContains(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			data, err := os.ReadFile(outPath)
+			require.NoError(t, err)
+			require.Equal(t, tc.size, int64(len(data)))
+			require.NotContains(t, string(data), "\nxref\n", "No cross-reference table")
+
+			// Resolve every object through the cross-reference stream: in
+			// the file at its offset, or in the object stream.
+			trailer, err := readTrailer(bytes.NewReader(data), int64(len(data)))
+			require.NoError(t, err)
+			xref := data[trailer.startxref:]
+			var size, w2, w3, length int
+			_, err = fmt.Sscanf(string(xref), "%d 0 obj\n<< /Type /XRef /Size %d /W [1 %d %d]", new(int), &size, &w2, &w3)
+			require.NoError(t, err)
+			_, err = fmt.Sscanf(string(xref[bytes.Index(xref, []byte("/Length")):]), "/Length %d", &length)
+			require.NoError(t, err)
+			require.Equal(t, size, trailer.size)
+			rows := xref[bytes.Index(xref, []byte("stream\n"))+7:][:length]
+			require.Equal(t, size*(1+w2+w3), len(rows))
+			field := func(b []byte) (n int64) {
+				for _, c := range b {
+					n = n<<8 | int64(c)
+				}
+				return n
+			}
+			var packed []int
+			stm := 0
+			for obj := range size {
+				row := rows[obj*(1+w2+w3):]
+				switch row[0] {
+				case 0:
+					require.Zero(t, obj, "only object 0 is free")
+				case 1:
+					off := field(row[1 : 1+w2])
+					require.True(t, bytes.HasPrefix(data[off:], fmt.Appendf(nil, "%d 0 obj\n", obj)), "object %d at offset %d", obj, off)
+				case 2:
+					stm = int(field(row[1 : 1+w2]))
+					require.Equal(t, int64(len(packed)), field(row[1+w2:1+w2+w3]), "index of object %d", obj)
+					packed = append(packed, obj)
+				}
+			}
+			require.NotEmpty(t, packed)
+
+			off := field(rows[stm*(1+w2+w3)+1:][:w2])
+			objStm := data[off:]
+			var n, first int
+			_, err = fmt.Sscanf(string(objStm), fmt.Sprintf("%d 0 obj\n<< /Type /ObjStm /N %%d /First %%d /Filter /FlateDecode /Length %%d", stm), &n, &first, &length)
+			require.NoError(t, err)
+			require.Equal(t, len(packed), n)
+			zr, err := zlib.NewReader(bytes.NewReader(objStm[bytes.Index(objStm, []byte("stream\n"))+7:][:length]))
+			require.NoError(t, err)
+			inflated, err := io.ReadAll(zr)
+			require.NoError(t, err)
+			index := strings.Fields(string(inflated[:first]))
+			for i, obj := range packed {
+				require.Equal(t, fmt.Sprint(obj), index[2*i])
+			}
+			require.Contains(t, string(inflated), "/Type /Catalog")
+			require.Equal(t, 1, bytes.Count(inflated, []byte("/Type /Pages ")))
+		})
+	}
+}
+
+func TestPDFGenerator_SignaturePlaceholder(t *testing.T) {
+	for _, xref := range []string{XRefTable, XRefStream} {
+		t.Run(xref, func(t *testing.T) {
+			const size = 64 * 1024
+			opts := ports.Options{"signature-placeholder": "true", "pdf-xref": xref, "pdf-pages": "2", "pdf-content": "text", "eicar": "true"}
+			outPath := filepath.Join(t.TempDir(), "prepared.pdf")
+			require.NoError(t, (&PDFGenerator{}).GenerateWithOptions(outPath, size, opts))
+			data, err := os.ReadFile(outPath)
+			require.NoError(t, err)
+			require.Equal(t, size, len(data))
+
+			// The byte range covers the whole file but the /Contents
+			// string, which reserves room for the signature.
+			at := bytes.Index(data, []byte("/ByteRange ["))
+			require.GreaterOrEqual(t, at, 0)
+			var a, b, c, d int
+			_, err = fmt.Sscanf(string(data[at:]), "/ByteRange [%d %d %d %d]", &a, &b, &c, &d)
+			require.NoError(t, err)
+			require.Equal(t, 0, a)
+			require.Equal(t, size, c+d)
+			require.Equal(t, "<"+strings.Repeat("0", 2*sigContentsLen)+">", string(data[b:c]))
+			require.Contains(t, string(data[at-200:at]), "/Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached")
+			if xref == XRefTable {
+				require.Contains(t, string(data), "/AcroForm << /Fields [10 0 R] /SigFlags 3 >>")
+				require.Contains(t, string(data), "/Annots [10 0 R]")
+			}
+		})
+	}
+}
+
+func TestReadTrailer_XRefStream(t *testing.T) {
+	// A PDF 1.5 file whose last section is a cross-reference stream.
+	pdf := "%PDF-1.5\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+		"9 0 obj\n<< /Type /XRef /Size 10 /Root 1 0 R /ID [<0A1B> <0A1B>] /W [1 2 1] /Length 4 >>\nstream\nabcd\nendstream\nendobj\n"
+	offset := len("%PDF-1.5\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	pdf += fmt.Sprintf("startxref\n%d\n%%%%EOF\n", offset)
+
+	trailer, err := readTrailer(bytes.NewReader([]byte(pdf)), int64(len(pdf)))
+	require.NoError(t, err)
+	require.Equal(t, pdfTrailer{startxref: int64(offset), size: 10, refs: " /Root 1 0 R /ID [<0A1B> <0A1B>]"}, trailer)
+}
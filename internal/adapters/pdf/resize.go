@@ -0,0 +1,196 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// trailerTail is how much of the end of a PDF Resize searches for the
+// last startxref and trailer.
+const trailerTail = 64 * 1024
+
+var (
+	startxrefRe = regexp.MustCompile(`startxref\s+(\d+)`)
+	sizeRe      = regexp.MustCompile(`/Size\s+(\d+)`)
+	// trailerRefRes match the trailer entries an update carries over.
+	trailerRefRes = []*regexp.Regexp{
+		regexp.MustCompile(`/Root\s+\d+\s+\d+\s+R`),
+		regexp.MustCompile(`/Info\s+\d+\s+\d+\s+R`),
+		regexp.MustCompile(`/Encrypt\s+\d+\s+\d+\s+R`),
+		regexp.MustCompile(`/ID\s*\[\s*<[0-9A-Fa-f]*>\s*<[0-9A-Fa-f]*>\s*\]`),
+	}
+)
+
+// Resize writes the PDF at srcPath to outPath followed by an incremental
+// update, as an editor saving changes would append: a stream object of
+// random data and the cross-reference section and trailer that add it,
+// sized to bring the file to exactly sizeBytes. The document is otherwise
+// unchanged, so it can only grow.
+func (g *PDFGenerator) Resize(srcPath, outPath string, sizeBytes int64) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", srcPath, err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", srcPath, err)
+	}
+	srcSize := info.Size()
+	trailer, err := readTrailer(src, srcSize)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", srcPath, err)
+	}
+
+	update, streamLen, err := planUpdate(trailer, srcSize, sizeBytes)
+	if err != nil {
+		return err
+	}
+	r, err := utils.NewRand(g.opts.String("seed", ""))
+	if err != nil {
+		return err
+	}
+
+	out, err := outputfs.Create(g.fs, outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file '%s': %w", outPath, err)
+	}
+	defer out.Close()
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read %s: %w", srcPath, err)
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", srcPath, err)
+	}
+	if _, err := out.WriteString(update.head); err != nil {
+		return fmt.Errorf("failed to write PDF update: %w", err)
+	}
+	if err := r.WriteBytes(out, streamLen); err != nil {
+		return fmt.Errorf("failed to write PDF stream data: %w", err)
+	}
+	if _, err := out.WriteString(update.tail); err != nil {
+		return fmt.Errorf("failed to write PDF update: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to close output file '%s': %w", outPath, err)
+	}
+	return nil
+}
+
+// pdfTrailer holds what an incremental update needs from the last one.
+type pdfTrailer struct {
+	startxref int64  // offset of the last cross-reference section
+	size      int    // number of objects
+	refs      string // entries carried over: /Root, /Info, /Encrypt, /ID
+}
+
+// readTrailer finds the last cross-reference section of the size-byte PDF
+// r and reads its trailer dictionary, or the dictionary of its
+// cross-reference stream.
+func readTrailer(r io.ReaderAt, size int64) (pdfTrailer, error) {
+	var t pdfTrailer
+	head := make([]byte, min(size, 8))
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return t, err
+	}
+	if !bytes.HasPrefix(head, []byte("%PDF-")) {
+		return t, fmt.Errorf("not a PDF file")
+	}
+	start := max(0, size-trailerTail)
+	tail := make([]byte, size-start)
+	if _, err := r.ReadAt(tail, start); err != nil && err != io.EOF {
+		return t, err
+	}
+	m := startxrefRe.FindAllSubmatch(tail, -1)
+	if m == nil {
+		return t, fmt.Errorf("no startxref found")
+	}
+	last := m[len(m)-1]
+	t.startxref, _ = strconv.ParseInt(string(last[1]), 10, 64)
+	if t.startxref <= 0 || t.startxref >= size {
+		return t, fmt.Errorf("startxref %d is outside the file", t.startxref)
+	}
+
+	// A classic section ends with a trailer keyword before startxref; a
+	// cross-reference stream keeps its dictionary at startxref.
+	dict := tail[:bytes.LastIndex(tail, last[0])]
+	if i := bytes.LastIndex(dict, []byte("trailer")); i >= 0 {
+		dict = dict[i:]
+	} else {
+		buf := make([]byte, min(4096, size-t.startxref))
+		if _, err := r.ReadAt(buf, t.startxref); err != nil && err != io.EOF {
+			return t, err
+		}
+		if i := bytes.Index(buf, []byte("stream")); i >= 0 {
+			buf = buf[:i]
+		}
+		dict = buf
+	}
+	sm := sizeRe.FindSubmatch(dict)
+	if sm == nil {
+		return t, fmt.Errorf("trailer has no /Size")
+	}
+	t.size, _ = strconv.Atoi(string(sm[1]))
+	for _, re := range trailerRefRes {
+		if ref := re.Find(dict); ref != nil {
+			t.refs += " " + string(ref)
+		}
+	}
+	if !strings.Contains(t.refs, "/Root") {
+		return t, fmt.Errorf("trailer has no /Root")
+	}
+	return t, nil
+}
+
+// pdfUpdate is an incremental update around the data of its stream.
+type pdfUpdate struct {
+	head string // object header, up to the stream data
+	tail string // end of the object, cross-reference section and trailer
+}
+
+// buildUpdate returns the update adding a stream of streamLen bytes to a
+// srcSize-byte PDF, with gap newlines ahead of its cross-reference section.
+func buildUpdate(t pdfTrailer, srcSize, streamLen, gap int64) pdfUpdate {
+	obj := t.size
+	head := fmt.Sprintf("\n%d 0 obj\n<< /Length %d >>\nstream\n", obj, streamLen)
+	end := "\nendstream\nendobj\n" + strings.Repeat("\n", int(gap))
+	xref := srcSize + int64(len(head)) + streamLen + int64(len(end))
+	tail := end + fmt.Sprintf("xref\n%d 1\n%010d 00000 n \ntrailer\n<< /Size %d%s /Prev %d >>\nstartxref\n%d\n%%%%EOF\n",
+		obj, srcSize+1, obj+1, t.refs, t.startxref, xref)
+	return pdfUpdate{head: head, tail: tail}
+}
+
+// planUpdate sizes the update that brings a srcSize-byte PDF to exactly
+// size bytes. The length of the stream sets the size; where a number in
+// the update gains a digit and skips the size, blank lines make up the
+// difference.
+func planUpdate(t pdfTrailer, srcSize, size int64) (pdfUpdate, int64, error) {
+	total := func(streamLen, gap int64) int64 {
+		u := buildUpdate(t, srcSize, streamLen, gap)
+		return srcSize + int64(len(u.head)) + streamLen + int64(len(u.tail))
+	}
+	if minimum := total(0, 0); size < minimum {
+		return pdfUpdate{}, 0, fmt.Errorf("a %d-byte PDF can only grow, to at least %d bytes; %d requested", srcSize, minimum, size)
+	}
+	var streamLen, gap int64
+	for i := 0; i < 8; i++ {
+		d := size - total(streamLen, gap)
+		if d == 0 {
+			return buildUpdate(t, srcSize, streamLen, gap), streamLen, nil
+		}
+		if i < 4 || d < 0 {
+			streamLen = max(0, streamLen+d)
+		} else {
+			gap += d
+		}
+	}
+	return pdfUpdate{}, 0, fmt.Errorf("failed to converge on the update size for target size %d", size)
+}
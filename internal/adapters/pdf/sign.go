@@ -0,0 +1,58 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A document prepared for signing has an invisible signature field on its
+// first page whose value is a signature dictionary holding no signature
+// yet: /Contents reserves sigContentsLen zero bytes in hex for a detached
+// PKCS#7 signature, and /ByteRange covers the rest of the file, as signing
+// libraries write them before handing the ranges to a signing service.
+const (
+	sigContentsLen = 8192
+	// byteRangeLen is the length /ByteRange is written to, padded with
+	// spaces, so that it can be filled in once the file is laid out.
+	byteRangeLen = 80
+)
+
+// byteRangePlaceholder is /ByteRange before it is filled in.
+var byteRangePlaceholder = fmt.Sprintf("%-*s", byteRangeLen, "/ByteRange [0 0 0 0]")
+
+// signatureObjects returns the signature field fieldObj on page pageObj,
+// whose value is the signature dictionary fieldObj+1, and that dictionary.
+func signatureObjects(o pdfOptions, fieldObj, pageObj int) (field, sig string) {
+	field = fmt.Sprintf("%d 0 obj\n<< /Type /Annot /Subtype /Widget /FT /Sig /T (Signature1) /Rect [0 0 0 0] /F 132 /P %d 0 R /V %d 0 R >>\nendobj\n",
+		fieldObj, pageObj, fieldObj+1)
+	date := ""
+	if !o.modified.IsZero() {
+		date = fmt.Sprintf(" /M (%s)", o.modified.UTC().Format("D:20060102150405Z"))
+	}
+	sig = fmt.Sprintf("%d 0 obj\n<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached %s /Contents <%s>%s >>\nendobj\n",
+		fieldObj+1, byteRangePlaceholder, strings.Repeat("0", 2*sigContentsLen), date)
+	return field, sig
+}
+
+// isSignature reports whether body is a signature dictionary, which is
+// kept out of object streams so that its byte range can be signed.
+func isSignature(body string) bool {
+	return strings.Contains(body, byteRangePlaceholder)
+}
+
+// fillByteRange fills in the /ByteRange of the signature dictionary laid
+// out in l, if there is one, for a file of size bytes: all of it but the
+// /Contents string.
+func (l *layout) fillByteRange(size int64) {
+	var offset int64
+	for i, part := range l.parts {
+		if at := strings.Index(part, byteRangePlaceholder); at >= 0 {
+			start := offset + int64(strings.Index(part, "/Contents <")+len("/Contents "))
+			end := start + 2 + 2*sigContentsLen
+			br := fmt.Sprintf("%-*s", byteRangeLen, fmt.Sprintf("/ByteRange [0 %d %d %d]", start, end, size-end))
+			l.parts[i] = part[:at] + br + part[at+byteRangeLen:]
+			return
+		}
+		offset += int64(len(part))
+	}
+}
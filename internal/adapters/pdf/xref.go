@@ -0,0 +1,154 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Cross-reference forms accepted by the "pdf-xref" option: a classic
+// table, or, from PDF 1.5, a cross-reference stream with the objects that
+// are not streams packed into an object stream.
+const (
+	XRefTable  = "table"
+	XRefStream = "stream"
+)
+
+// xrefEntry locates an object: at offset in the file, or, with stm set,
+// as the offset-th object of object stream stm.
+type xrefEntry struct {
+	stm    int
+	offset int64
+}
+
+// layout is the document objects laid out ahead of the padding stream,
+// in the cross-reference form o asks for.
+type layout struct {
+	o       pdfOptions
+	parts   []string    // the header and the objects, in file order
+	length  int64       // length of parts
+	entries []xrefEntry // by object number, up to the padding stream's
+	infoObj int         // number of the information dictionary; 0 for none
+}
+
+// newLayout lays out the document objects bodies, numbered from 1. With
+// a cross-reference stream, those that are not streams or a signature go
+// into an object stream numbered after them, and the others are written
+// as they are.
+func newLayout(o pdfOptions, bodies []string) *layout {
+	l := &layout{o: o, entries: make([]xrefEntry, 1, len(bodies)+2)}
+	if o.hasInfo() {
+		l.infoObj = len(bodies) // the last document object
+	}
+	l.add(header(o))
+	if o.xref != XRefStream {
+		for _, body := range bodies {
+			l.entries = append(l.entries, xrefEntry{offset: l.length})
+			l.add(body)
+		}
+		return l
+	}
+
+	stm := len(bodies) + 1
+	var index, packed strings.Builder
+	count := 0
+	for i, body := range bodies {
+		n := i + 1
+		if strings.HasSuffix(body, "endstream\nendobj\n") || isSignature(body) {
+			l.entries = append(l.entries, xrefEntry{offset: l.length})
+			l.add(body)
+			continue
+		}
+		obj := strings.TrimSuffix(strings.TrimPrefix(body, fmt.Sprintf("%d 0 obj\n", n)), "\nendobj\n")
+		l.entries = append(l.entries, xrefEntry{stm: stm, offset: int64(count)})
+		fmt.Fprintf(&index, "%d %d ", n, packed.Len())
+		packed.WriteString(obj + "\n")
+		count++
+	}
+	var data bytes.Buffer
+	zw := zlib.NewWriter(&data)
+	zw.Write([]byte(index.String() + packed.String()))
+	zw.Close()
+	l.entries = append(l.entries, xrefEntry{offset: l.length})
+	l.add(fmt.Sprintf("%d 0 obj\n<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream\nendobj\n",
+		stm, count, index.Len(), data.Len(), data.Bytes()))
+	return l
+}
+
+func (l *layout) add(part string) {
+	l.parts = append(l.parts, part)
+	l.length += int64(len(part))
+}
+
+// padObj returns the number of the padding stream, which follows the
+// objects laid out.
+func (l *layout) padObj() int {
+	return len(l.entries)
+}
+
+// padDict returns the start of the padding stream of n bytes.
+func (l *layout) padDict(n int64) string {
+	return fmt.Sprintf(streamDictTemplateFmt, l.padObj(), n)
+}
+
+// size returns the size of the document with a padding stream of n bytes.
+func (l *layout) size(n int64) int64 {
+	end := l.length + int64(len(l.padDict(n))) + n + int64(len(streamEndMarker))
+	return end + int64(len(l.trailer(end)))
+}
+
+// trailer returns the cross-reference section, starting at start right
+// after the padding stream, through the end of the file.
+func (l *layout) trailer(start int64) string {
+	refs := " /Root 1 0 R"
+	if l.infoObj != 0 {
+		refs += fmt.Sprintf(" /Info %d 0 R", l.infoObj)
+	}
+	padOffset := l.length
+	var b strings.Builder
+	if l.o.xref != XRefStream {
+		fmt.Fprintf(&b, "xref\n0 %d\n%s", l.padObj()+1, xrefEntry0)
+		for _, e := range l.entries[1:] {
+			fmt.Fprintf(&b, xrefEntryFmt, e.offset)
+		}
+		fmt.Fprintf(&b, xrefEntryFmt, padOffset)
+		fmt.Fprintf(&b, "trailer\n<< /Size %d%s >>\n", l.padObj()+1, refs)
+	} else {
+		// Offsets take four bytes, or as many as the stream's own, the
+		// largest, needs past 4 GB, so that the padding seldom moves the
+		// stream across a width; the third field takes as few as the
+		// generation of object 0 or the largest index into the object
+		// stream.
+		obj := l.padObj() + 1
+		w2, w3 := max(4, byteWidth(start)), byteWidth(max(0xFFFF, int64(len(l.entries))))
+		row := func(typ byte, field2, field3 int64) []byte {
+			r := append([]byte{typ}, binary.BigEndian.AppendUint64(nil, uint64(field2))[8-w2:]...)
+			return append(r, binary.BigEndian.AppendUint64(nil, uint64(field3))[8-w3:]...)
+		}
+		data := row(0, 0, 0xFFFF)
+		for _, e := range l.entries[1:] {
+			if e.stm != 0 {
+				data = append(data, row(2, int64(e.stm), e.offset)...)
+			} else {
+				data = append(data, row(1, e.offset, 0)...)
+			}
+		}
+		data = append(data, row(1, padOffset, 0)...)
+		data = append(data, row(1, start, 0)...)
+		fmt.Fprintf(&b, "%d 0 obj\n<< /Type /XRef /Size %d /W [1 %d %d]%s /Length %d >>\nstream\n%s%s", obj, obj+1, w2, w3, refs, len(data), data, streamEndMarker)
+	}
+	fmt.Fprintf(&b, startxrefTemplateFmt, start)
+	b.WriteString(eofMarker)
+	return b.String()
+}
+
+// byteWidth returns how many bytes n takes, at least one.
+func byteWidth(n int64) int {
+	w := 1
+	for n>>(8*w) > 0 {
+		w++
+	}
+	return w
+}
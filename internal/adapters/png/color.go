@@ -0,0 +1,100 @@
+package png
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"math"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// iccpKeyword names the profile in the iCCP chunk.
+const iccpKeyword = "ICC profile"
+
+// maxStoredBlock is the most a stored deflate block holds.
+const maxStoredBlock = 0xFFFF
+
+// ihdrEnd is the offset just past the IHDR chunk, which always comes first.
+const ihdrEnd = len(pngSignature) + 12 + 13
+
+// colorChunks returns the chunks that follow IHDR for o: the iCCP chunk
+// with o's profile and the pHYs chunk with its resolution.
+func colorChunks(o pngOptions) []byte {
+	var out []byte
+	if o.icc != nil {
+		out = append(out, iccpChunk(o.icc, storedBlocks(len(o.icc)))...)
+	}
+	if o.dpi > 0 {
+		// Pixels per metre, in both directions.
+		ppm := uint32(math.Round(float64(o.dpi) / 0.0254))
+		phys := binary.BigEndian.AppendUint32(nil, ppm)
+		phys = binary.BigEndian.AppendUint32(phys, ppm)
+		out = append(out, chunk("pHYs", append(phys, 1))...)
+	}
+	return out
+}
+
+// iccpChunk returns an iCCP chunk holding profile in a zlib stream of
+// blocks stored deflate blocks, whose size, unlike a compressed one's, is
+// known in advance.
+func iccpChunk(profile []byte, blocks int) []byte {
+	data := make([]byte, 0, len(iccpKeyword)+2+6+5*blocks+len(profile))
+	data = append(data, iccpKeyword+"\x00\x00"...) // keyword, compression method deflate
+	return chunk("iCCP", storedZlib(data, profile, blocks))
+}
+
+// storedZlib appends to dst a zlib stream of data split evenly over
+// blocks stored deflate blocks: 6 bytes of header and checksum, and 5 a
+// block.
+func storedZlib(dst, data []byte, blocks int) []byte {
+	dst = append(dst, 0x78, 0x01) // zlib header, no compression
+	rest := data
+	for i := 0; i < blocks; i++ {
+		n := len(rest) / (blocks - i)
+		final := byte(0)
+		if i == blocks-1 {
+			final = 1
+		}
+		dst = append(dst, final)
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(n))
+		dst = binary.LittleEndian.AppendUint16(dst, ^uint16(n))
+		dst = append(dst, rest[:n]...)
+		rest = rest[n:]
+	}
+	return binary.BigEndian.AppendUint32(dst, adler32.Checksum(data))
+}
+
+// storedBlocks returns the fewest stored blocks n bytes fit in.
+func storedBlocks(n int) int {
+	return max((n+maxStoredBlock-1)/maxStoredBlock, 1)
+}
+
+// growICCP returns pngData, whose iCCP chunk directly follows IHDR, grown
+// by exactly needed bytes of padding in its ICC profile, or false if
+// needed is too little to pad the profile with.
+func growICCP(pngData []byte, o pngOptions, needed int64) ([]byte, bool, error) {
+	if !o.iccPad || needed < int64(utils.ICCPadMin(o.icc)) {
+		return nil, false, nil
+	}
+	old := ihdrEnd + 12 + int(binary.BigEndian.Uint32(pngData[ihdrEnd:]))
+	if string(pngData[ihdrEnd+4:ihdrEnd+8]) != "iCCP" {
+		return nil, false, fmt.Errorf("invalid PNG: iCCP chunk not found after IHDR")
+	}
+	// The new chunk's stored blocks and profile take x bytes between them;
+	// spreading them over as many blocks as x needs reaches every size.
+	x := int64(old-ihdrEnd) + needed - 12 - int64(len(iccpKeyword)+2) - 6
+	blocks := (x + maxStoredBlock + 4) / (maxStoredBlock + 5)
+	pad := x - 5*blocks - int64(len(o.icc))
+	if pad < int64(utils.ICCPadMin(o.icc)) || pad > math.MaxInt32 {
+		return nil, false, nil
+	}
+	profile, err := utils.PadICCProfile(o.rand, o.icc, int(pad))
+	if err != nil {
+		return nil, false, err
+	}
+	out := make([]byte, 0, int64(len(pngData))+needed)
+	out = append(out, pngData[:ihdrEnd]...)
+	out = append(out, iccpChunk(profile, int(blocks))...)
+	return append(out, pngData[old:]...), true, nil
+}
@@ -0,0 +1,122 @@
+package png
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// colorType describes a PNG colour type at 8 bits per sample.
+type colorType struct {
+	code     byte
+	channels int
+}
+
+// colorTypes maps the "png-color" names to PNG colour types.
+var colorTypes = map[string]colorType{
+	"gray":       {0, 1},
+	"rgb":        {2, 3},
+	"palette":    {3, 1},
+	"gray-alpha": {4, 2},
+	"rgba":       {6, 4},
+}
+
+// adam7 lists the x/y start offsets and steps of the seven Adam7 passes.
+var adam7 = [7][4]int{
+	{0, 0, 8, 8},
+	{4, 0, 8, 8},
+	{0, 4, 4, 8},
+	{2, 0, 4, 4},
+	{0, 2, 2, 4},
+	{1, 0, 2, 2},
+	{0, 1, 1, 2},
+}
+
+// pngSignature starts every PNG file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// idatChunkSize caps the payload of each IDAT chunk.
+const idatChunkSize = 1 << 20
+
+// encodeNoise returns a complete PNG of a w×h image of pixels from r in
+// colour type ct, optionally Adam7-interlaced. Palette images get a random
+// 256-entry palette. Scanlines use filter type None, as filtering cannot
+// help with noise.
+func encodeNoise(r *utils.Rand, w, h int, ct colorType, interlace bool) ([]byte, error) {
+	var raw bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&raw, zlib.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	writeRows := func(pw, ph int) error {
+		if pw == 0 || ph == 0 {
+			return nil
+		}
+		row := make([]byte, 1+pw*ct.channels) // leading 0 = filter None
+		for y := 0; y < ph; y++ {
+			r.Read(row[1:])
+			if _, err := zw.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if interlace {
+		for _, p := range adam7 {
+			pw := (w - p[0] + p[2] - 1) / p[2]
+			ph := (h - p[1] + p[3] - 1) / p[3]
+			if err := writeRows(max(pw, 0), max(ph, 0)); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := writeRows(w, h); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	out := &bytes.Buffer{}
+	out.WriteString(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(w))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(h))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = ct.code
+	if interlace {
+		ihdr[12] = 1
+	}
+	writeChunk(out, "IHDR", ihdr)
+
+	if ct.code == 3 {
+		plte := make([]byte, 256*3)
+		r.Read(plte)
+		writeChunk(out, "PLTE", plte)
+	}
+
+	idat := raw.Bytes()
+	for len(idat) > 0 {
+		n := min(len(idat), idatChunkSize)
+		writeChunk(out, "IDAT", idat[:n])
+		idat = idat[n:]
+	}
+	writeChunk(out, "IEND", nil)
+	return out.Bytes(), nil
+}
+
+// writeChunk appends a PNG chunk with its length and CRC to out.
+func writeChunk(out *bytes.Buffer, typ string, data []byte) {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[0:4], uint32(len(data)))
+	copy(hdr[4:], typ)
+	out.Write(hdr[:])
+	out.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+	binary.Write(out, binary.BigEndian, crc.Sum32())
+}
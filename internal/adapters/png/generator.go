@@ -1,126 +1,418 @@
 package png
 
 import (
-	"bytes"
-	cryptoRand "crypto/rand"
+	"bufio"
 	"encoding/binary"
 	"fmt"
 	"hash/crc32"
-	"image"
-	"image/png"
 	"math"
-	"math/rand/v2"
-	"os"
+	"strings"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func init() {
 	factory.RegisterGenerator(ports.FileTypePNG, New()) //
 }
 
-type PngGenerator struct{}
+type PngGenerator struct {
+	opts ports.Options // set by Configure
+	meta ports.Metadata
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &PngGenerator{}
 }
 
-func (g *PngGenerator) Generate(path string, targetSize int64) error {
-	// 1) Roughly estimate pixels needed. For random noise PNG, compressed size ≈ raw RGBA size,
-	//    so ~4 bytes/pixel. Compute side length of a square image.
-	pixelsNeeded := float64(targetSize) / 4.0
-	side := int(math.Sqrt(pixelsNeeded))
-	if side < 1 {
-		side = 1
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *PngGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
 	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *PngGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// padChunkMin is the smallest padding chunk: 12 bytes of chunk framing plus
+// the "Pad" keyword and its NUL separator.
+const padChunkMin = 12 + 4
+
+// maxTextPadding is the most a tEXt padding chunk carries: chunk data is at
+// most 2^31-1 bytes.
+const maxTextPadding = 12 + math.MaxInt32
 
-	// 2) Create noise image
-	img := image.NewNRGBA(image.Rect(0, 0, side, side))
-	for i := range img.Pix {
-		img.Pix[i] = byte(rand.IntN(256))
+// maxPixels bounds the image Generate sizes to the target, some 16 MB of
+// RGBA; a larger target is made up by the padding chunks rather than
+// encoded in memory.
+const maxPixels = 1 << 22
+
+// pngOptions holds the settings the PNG generator reads from ports.Options.
+// A zero width or height is derived from the target size.
+type pngOptions struct {
+	width, height int
+	color         colorType
+	interlace     bool
+	dpi           int    // resolution for a pHYs chunk; zero for none
+	icc           []byte // ICC profile for an iCCP chunk; nil for none
+	iccPad        bool   // pad the profile rather than add padding chunks
+	padChunk      string // type of the padding chunks: tEXt, zTXt or iTXt
+	rand          *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (pngOptions, error) {
+	var o pngOptions
+	var err error
+	if o.width, err = opts.Int("width", 0); err != nil {
+		return o, err
+	}
+	if o.height, err = opts.Int("height", 0); err != nil {
+		return o, err
+	}
+	if o.width < 0 || o.height < 0 {
+		return o, fmt.Errorf("image dimensions must be positive, got %dx%d", o.width, o.height)
+	}
+	name := strings.ToLower(opts.String("png-color", "rgba"))
+	ct, ok := colorTypes[name]
+	if !ok {
+		return o, fmt.Errorf("unknown png color type %q (want gray, gray-alpha, rgb, rgba or palette)", name)
 	}
+	o.color = ct
+	if o.interlace, err = opts.Bool("png-interlace", false); err != nil {
+		return o, err
+	}
+	if o.dpi, err = opts.Int("dpi", 0); err != nil {
+		return o, err
+	}
+	if o.dpi < 0 {
+		return o, fmt.Errorf("dpi must not be negative, got %d", o.dpi)
+	}
+	if opts.Has("icc") {
+		if o.icc, err = utils.ICCProfile(opts.String("icc", "")); err != nil {
+			return o, err
+		}
+		// Grayscale images take grayscale profiles, colour images RGB ones.
+		gray := ct.code == 0 || ct.code == 4
+		if space := utils.ICCColorSpace(o.icc); (space == "GRAY") != gray || (!gray && space != "RGB") {
+			return o, fmt.Errorf("a %s ICC profile does not suit a %s PNG", space, name)
+		}
+	}
+	if o.iccPad, err = opts.Bool("icc-pad", false); err != nil {
+		return o, err
+	}
+	if o.iccPad && o.icc == nil {
+		return o, fmt.Errorf("icc-pad needs an icc profile")
+	}
+	padding := strings.ToLower(opts.String("png-padding", PaddingText))
+	if o.padChunk, ok = padChunks[padding]; !ok {
+		return o, fmt.Errorf("unknown png padding %q (want text, ztxt or itxt)", padding)
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
 
-	// 3) Encode to PNG buffer
-	buf := &bytes.Buffer{}
-	if err := png.Encode(buf, img); err != nil {
+// WithMetadata returns a copy of the generator that writes m as text
+// chunks.
+func (g *PngGenerator) WithMetadata(m ports.Metadata) ports.FileGenerator {
+	c := *g
+	c.meta = m
+	return &c
+}
+
+func (g *PngGenerator) Generate(path string, targetSize int64) error {
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions writes a noise PNG of exactly targetSize bytes. opts
+// may pin the width and/or height, pick the colour type and enable Adam7
+// interlacing. With both dimensions pinned the image is encoded as is and
+// only the padding chunks adjust the size, so targets the image
+// overshoots, or undershoots by less than a padding chunk, are errors.
+// "png-padding" picks them: one tEXt chunk before IEND, or zTXt or iTXt
+// chunks of at most padChunkMax bytes before the image data. Metadata set
+// with WithMetadata is written as text chunks before IEND. "dpi" adds a
+// pHYs chunk and "icc" an iCCP chunk with a colour profile, which with
+// "icc-pad" carries the padding in place of the padding chunks whenever
+// there is room for it.
+func (g *PngGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
 		return err
 	}
-	data := buf.Bytes()
-	if int64(len(data)) > targetSize {
-		// If overshot, shrink image by aspect √(target/actual) and re-try once
-		factor := math.Sqrt(float64(targetSize) / float64(len(data)))
-		newSide := int(float64(side) * factor)
-		if newSide < 1 {
-			return fmt.Errorf("target %d too small for any PNG image", targetSize)
+
+	if o.width > 0 && o.height > 0 {
+		data, err := g.encode(o.width, o.height, o)
+		if err != nil {
+			return err
+		}
+		return writeEncoded(g.fs, path, data, targetSize, o.width, o.height, o)
+	}
+
+	if targetSize <= 0 {
+		return fmt.Errorf("target %d too small for any PNG image", targetSize)
+	}
+
+	// 1) Roughly estimate pixels needed. For random noise PNG, compressed size ≈ raw size,
+	//    so ~channels bytes/pixel. Derive the free dimension(s) from that.
+	budget := float64(targetSize)
+	if o.color.code == 3 {
+		budget -= 256*3 + 12 // PLTE chunk
+	}
+	w, h := dimensionsFor(min(budget/float64(o.color.channels), maxPixels), o)
+
+	// 2) Encode, shrinking the free dimension(s) when the image overshoots or
+	//    leaves less room than a padding chunk needs.
+	for attempt := 0; ; attempt++ {
+		data, err := g.encode(w, h, o)
+		if err != nil {
+			return err
 		}
-		return generatePNGWithSize(path, targetSize, newSide)
+		needed := targetSize - int64(len(data))
+		if needed == 0 || needed >= o.padMin() {
+			// 3) Pad with text chunks or in the ICC profile
+			return writePadded(g.fs, path, data, targetSize, o)
+		}
+		// Overshot → scale by √(target/actual), always losing at least a pixel
+		factor := math.Sqrt(max(float64(targetSize-o.padMin()), 0) / float64(len(data)))
+		if o.width > 0 || o.height > 0 {
+			factor *= factor
+		}
+		newW, newH := w, h
+		if o.width == 0 {
+			newW = min(int(float64(w)*factor), w-1)
+		}
+		if o.height == 0 {
+			newH = min(int(float64(h)*factor), h-1)
+		}
+		if newW < 1 || newH < 1 || attempt == 3 {
+			return fmt.Errorf("even %dx%d PNG is %d bytes > target %d", w, h, len(data), targetSize)
+		}
+		w, h = newW, newH
 	}
-	// 4) Pad with tEXt chunk
-	return padPNGToSize(path, data, targetSize)
 }
 
-// Helper to regenerate PNG at a specific side length
-func generatePNGWithSize(path string, targetSize int64, side int) error {
-	img := image.NewNRGBA(image.Rect(0, 0, side, side))
-	for i := range img.Pix {
-		img.Pix[i] = byte(rand.IntN(256))
+// ForResolution returns a generator of a width×height noise image and its
+// size. The image is encoded once, with the options and metadata the
+// generator was configured with; larger sizes pad it as Generate does.
+func (g *PngGenerator) ForResolution(width, height int) (ports.FileGenerator, int64, error) {
+	o, err := parseOptions(g.opts)
+	if err != nil {
+		return nil, 0, err
 	}
-	buf := &bytes.Buffer{}
-	if err := png.Encode(buf, img); err != nil {
-		return err
+	data, err := g.encode(width, height, o)
+	if err != nil {
+		return nil, 0, err
 	}
-	data := buf.Bytes()
-	if int64(len(data)) > targetSize {
-		return fmt.Errorf("even %dx%d PNG is %d bytes > target %d",
-			side, side, len(data), targetSize)
+	return &encodedPNG{data, width, height, o, g.fs}, int64(len(data)), nil
+}
+
+// encodedPNG is the generator ForResolution returns: it writes the image
+// it holds, padded to the size asked for.
+type encodedPNG struct {
+	data          []byte
+	width, height int
+	o             pngOptions
+	fs            ports.OutputFS
+}
+
+func (e *encodedPNG) Generate(path string, targetSize int64) error {
+	return writeEncoded(e.fs, path, e.data, targetSize, e.width, e.height, e.o)
+}
+
+// GenerateWithOptions is Generate; the image was encoded with the options
+// it has, and opts are ignored.
+func (e *encodedPNG) GenerateWithOptions(path string, targetSize int64, _ ports.Options) error {
+	return e.Generate(path, targetSize)
+}
+
+// writeEncoded writes data, a w×h PNG, to path on fsys padded to
+// targetSize, which must be its size or leave room for a padding chunk.
+func writeEncoded(fsys ports.OutputFS, path string, data []byte, targetSize int64, w, h int, o pngOptions) error {
+	if needed := targetSize - int64(len(data)); needed < 0 || (needed > 0 && needed < o.padMin()) {
+		return fmt.Errorf("a %dx%d PNG encodes to %d bytes; target %d must be equal or at least %d bytes larger",
+			w, h, len(data), targetSize, o.padMin())
 	}
-	return padPNGToSize(path, data, targetSize)
+	return writePadded(fsys, path, data, targetSize, o)
 }
 
-// Inject a single ancillary tEXt chunk to pad to exact size
-func padPNGToSize(path string, pngData []byte, targetSize int64) error {
-	needed := targetSize - int64(len(pngData))
+// encode encodes a w×h noise image with o's colour chunks after the
+// header and the generator's metadata chunks at the end.
+func (g *PngGenerator) encode(w, h int, o pngOptions) ([]byte, error) {
+	data, err := encodeNoise(o.rand, w, h, o.color, o.interlace)
+	if err != nil {
+		return nil, err
+	}
+	if color := colorChunks(o); len(color) > 0 {
+		data = append(data[:ihdrEnd:ihdrEnd], append(color, data[ihdrEnd:]...)...)
+	}
+	if len(g.meta) == 0 {
+		return data, nil
+	}
+	var chunks []byte
+	for _, k := range g.meta.Keys() {
+		chunks = append(chunks, textChunk(textKeyword(k), g.meta[k])...)
+	}
+	return insertBeforeIEND(data, chunks)
+}
+
+// textKeywords maps well-known metadata keys to the PNG's predefined text
+// keywords; other keys are used as keywords as they are.
+var textKeywords = map[string]string{
+	ports.MetaTitle:    "Title",
+	ports.MetaAuthor:   "Author",
+	ports.MetaSubject:  "Description",
+	ports.MetaKeywords: "Keywords",
+	ports.MetaComment:  "Comment",
+	ports.MetaCreator:  "Software",
+}
+
+func textKeyword(key string) string {
+	if kw, ok := textKeywords[key]; ok {
+		return kw
+	}
+	return key
+}
+
+// textChunk returns a tEXt chunk for keyword and text, or an uncompressed
+// iTXt chunk if text is not ASCII (tEXt text is Latin-1).
+func textChunk(keyword, text string) []byte {
+	for i := 0; i < len(text); i++ {
+		if text[i] >= 0x80 {
+			// keyword, compression flag and method, empty language tag and translated keyword
+			return chunk("iTXt", []byte(keyword+"\x00\x00\x00\x00\x00"+text))
+		}
+	}
+	return chunk("tEXt", []byte(keyword+"\x00"+text))
+}
+
+// chunk frames data as a PNG chunk of type typ: length, type, data, CRC.
+func chunk(typ string, data []byte) []byte {
+	out := make([]byte, 0, 12+len(data))
+	out = binary.BigEndian.AppendUint32(out, uint32(len(data)))
+	out = append(out, typ...)
+	out = append(out, data...)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	return binary.BigEndian.AppendUint32(out, crc.Sum32())
+}
+
+// insertBeforeIEND returns pngData with chunks placed before its final
+// IEND chunk.
+func insertBeforeIEND(pngData, chunks []byte) ([]byte, error) {
 	// Locate IEND (last 12 bytes)
 	n := len(pngData)
 	if n < 12 {
-		return fmt.Errorf("PNG data too short")
+		return nil, fmt.Errorf("PNG data too short")
 	}
 	iendStart := n - 12
 	if string(pngData[iendStart+4:iendStart+8]) != "IEND" {
+		return nil, fmt.Errorf("invalid PNG: IEND not found")
+	}
+	out := make([]byte, 0, n+len(chunks))
+	out = append(out, pngData[:iendStart]...)
+	out = append(out, chunks...)
+	return append(out, pngData[iendStart:]...), nil
+}
+
+// dimensionsFor picks image dimensions covering roughly pixels pixels,
+// keeping whichever of o's dimensions are pinned.
+func dimensionsFor(pixels float64, o pngOptions) (w, h int) {
+	switch {
+	case o.width > 0:
+		return o.width, max(int(pixels/float64(o.width)), 1)
+	case o.height > 0:
+		return max(int(pixels/float64(o.height)), 1), o.height
+	default:
+		side := max(int(math.Sqrt(pixels)), 1)
+		return side, side
+	}
+}
+
+// writePadded writes pngData to path on fsys padded to targetSize, in
+// its ICC profile if o asks for that and it can be, otherwise with o's
+// padding chunks.
+func writePadded(fsys ports.OutputFS, path string, pngData []byte, targetSize int64, o pngOptions) error {
+	needed := targetSize - int64(len(pngData))
+	out, ok, err := growICCP(pngData, o, needed)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return outputfs.WriteFile(fsys, path, out)
+	}
+	if o.padChunk != "tEXt" && needed > 0 {
+		return writeCompressedPadding(fsys, path, pngData, needed, o)
+	}
+	return padPNGToSize(fsys, path, pngData, targetSize, o.rand)
+}
+
+// Inject a single ancillary tEXt chunk of random data from r to pad to
+// exact size. The chunk is made as it is written, so the padding is never
+// held whole.
+func padPNGToSize(fsys ports.OutputFS, path string, pngData []byte, targetSize int64, r *utils.Rand) error {
+	needed := targetSize - int64(len(pngData))
+	if needed == 0 {
+		return outputfs.WriteFile(fsys, path, pngData)
+	}
+	if needed < padChunkMin {
+		return fmt.Errorf("cannot pad %d-byte PNG to %d bytes", len(pngData), targetSize)
+	}
+	if needed > maxTextPadding {
+		return fmt.Errorf("%d bytes of padding overflow a tEXt chunk; pad with zTXt or iTXt chunks instead", needed)
+	}
+	// Locate IEND (last 12 bytes)
+	iendStart := len(pngData) - 12
+	if iendStart < 0 || string(pngData[iendStart+4:iendStart+8]) != "IEND" {
 		return fmt.Errorf("invalid PNG: IEND not found")
 	}
-	body := pngData[:iendStart]
-	iend := pngData[iendStart:]
-
-	// Build tEXt chunk with keyword "Pad" + padding bytes
-	keyword := "Pad"
-	// Chunk data length = needed - 12 (chunk overhead) but ≥ len(keyword)+1
-	dataLen := needed - 12
-	minLen := int64(len(keyword) + 1)
-	if dataLen < minLen {
-		dataLen = minLen
-	}
-	padBytes := make([]byte, dataLen-int64(len(keyword))-1)
-	cryptoRand.Read(padBytes)
-	// Construct chunk
-	chunkType := []byte("tEXt")
-	chunkData := append([]byte(keyword+"\x00"), padBytes...)
-	length := make([]byte, 4)
-	binary.BigEndian.PutUint32(length, uint32(len(chunkData)))
+
+	f, err := outputfs.Create(fsys, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriterSize(f, 1<<16)
+	w.Write(pngData[:iendStart])
+
+	// tEXt chunk with keyword "Pad" + padding bytes; chunk data length =
+	// needed - 12 (chunk overhead)
+	head := binary.BigEndian.AppendUint32(nil, uint32(needed-12))
+	head = append(head, "tEXtPad\x00"...)
+	w.Write(head)
 	crc := crc32.NewIEEE()
-	crc.Write(chunkType)
-	crc.Write(chunkData)
-	crcBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(crcBytes, crc.Sum32())
-
-	out := &bytes.Buffer{}
-	out.Write(body)
-	out.Write(length)
-	out.Write(chunkType)
-	out.Write(chunkData)
-	out.Write(crcBytes)
-	out.Write(iend)
-
-	return os.WriteFile(path, out.Bytes(), 0666)
+	crc.Write(head[4:])
+	padBytes := make([]byte, 1<<16)
+	for rest := needed - int64(len(head)) - 4; rest > 0; {
+		n := min(rest, int64(len(padBytes)))
+		r.Read(padBytes[:n])
+		crc.Write(padBytes[:n])
+		if _, err := w.Write(padBytes[:n]); err != nil {
+			return err
+		}
+		rest -= n
+	}
+	w.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32()))
+
+	w.Write(pngData[iendStart:])
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
 }
@@ -1,14 +1,21 @@
 package png
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"image/png"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/hailam/genfile/internal/ports" //
+	"github.com/hailam/genfile/internal/utils"
 )
 
 // Estimate a reasonable minimum size. A minimal 1x1 NRGBA image encoded is usually a few hundred bytes, plus the tEXt chunk overhead.
@@ -163,3 +170,340 @@ func limitBytes(b []byte, maxLen int) []byte {
 	}
 	return b[:maxLen]
 }
+
+func TestPngGenerator_GenerateWithOptions(t *testing.T) {
+	generator := &PngGenerator{}
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name          string
+		size          int64
+		opts          ports.Options
+		width, height int // expected; 0 means unchecked
+		colorCode     byte
+		interlaced    bool
+		errSubstring  string
+	}{
+		{name: "FixedDimensionsPadded", size: 20 * 1024, opts: ports.Options{"width": "64", "height": "48"}, width: 64, height: 48, colorCode: 6},
+		{name: "FixedGrayInterlaced", size: 8 * 1024, opts: ports.Options{"width": "50", "height": "30", "png-color": "gray", "png-interlace": "true"}, width: 50, height: 30, colorCode: 0, interlaced: true},
+		{name: "PaletteAuto", size: 40 * 1024, opts: ports.Options{"png-color": "palette"}, colorCode: 3},
+		{name: "GrayAlphaAuto", size: 40 * 1024, opts: ports.Options{"png-color": "gray-alpha", "png-interlace": "true"}, colorCode: 4, interlaced: true},
+		{name: "RGBWidthPinned", size: 100 * 1024, opts: ports.Options{"png-color": "rgb", "width": "300"}, width: 300, colorCode: 2},
+		{name: "FixedDimensionsTooLarge", size: 1024, opts: ports.Options{"width": "640", "height": "480"}, errSubstring: "encodes to"},
+		{name: "UnknownColor", size: 1024, opts: ports.Options{"png-color": "cmyk"}, errSubstring: "unknown png color type"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("opts_%s.png", tc.name))
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.errSubstring != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSubstring) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSubstring, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, tc.size)
+			checkPngValidity(t, outPath)
+
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// IHDR data starts at byte 16: width, height, depth, color, compression, filter, interlace.
+			ihdr := data[16:29]
+			w := int(ihdr[0])<<24 | int(ihdr[1])<<16 | int(ihdr[2])<<8 | int(ihdr[3])
+			h := int(ihdr[4])<<24 | int(ihdr[5])<<16 | int(ihdr[6])<<8 | int(ihdr[7])
+			if tc.width != 0 && w != tc.width {
+				t.Errorf("width = %d, want %d", w, tc.width)
+			}
+			if tc.height != 0 && h != tc.height {
+				t.Errorf("height = %d, want %d", h, tc.height)
+			}
+			if ihdr[9] != tc.colorCode {
+				t.Errorf("color type = %d, want %d", ihdr[9], tc.colorCode)
+			}
+			if (ihdr[12] == 1) != tc.interlaced {
+				t.Errorf("interlace method = %d, want interlaced=%v", ihdr[12], tc.interlaced)
+			}
+		})
+	}
+}
+
+func TestPngGenerator_WithMetadata(t *testing.T) {
+	generator := New().(ports.MetadataCapable).WithMetadata(ports.Metadata{
+		ports.MetaTitle: "Noise",
+		"Camera":        "Ünïcode",
+	})
+	outPath := filepath.Join(t.TempDir(), "meta.png")
+	const size = 10 * 1024
+	if err := generator.Generate(outPath, size); err != nil {
+		t.Fatalf("Generate returned unexpected error: %v", err)
+	}
+	checkFileSize(t, outPath, size)
+	checkPngValidity(t, outPath)
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"tEXtTitle\x00Noise", "iTXtCamera\x00\x00\x00\x00\x00Ünïcode"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("PNG lacks chunk %q", want)
+		}
+	}
+}
+
+func TestPngGenerator_Resize(t *testing.T) {
+	generator := &PngGenerator{}
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src.png")
+	if err := generator.Generate(src, 50000); err != nil {
+		t.Fatalf("Generate returned unexpected error: %v", err)
+	}
+	data, _ := os.ReadFile(src)
+	image, err := stripPadding(data)
+	if err != nil {
+		t.Fatalf("stripPadding returned unexpected error: %v", err)
+	}
+	bare := int64(len(image))
+
+	for _, size := range []int64{bare, bare + padChunkMin, 50000, 200000} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("resized_%d.png", size))
+			if err := generator.Resize(src, outPath, size); err != nil {
+				t.Fatalf("Resize returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, size)
+			checkPngValidity(t, outPath)
+			// The padding is replaced, not added to.
+			out, _ := os.ReadFile(outPath)
+			if n := strings.Count(string(out), "tEXtPad\x00"); n > 1 {
+				t.Errorf("resized PNG has %d padding chunks, want at most 1", n)
+			}
+		})
+	}
+
+	for _, size := range []int64{bare - 1, bare + 1} {
+		if err := generator.Resize(src, filepath.Join(tempDir, "bad.png"), size); err == nil {
+			t.Errorf("Resize to %d bytes: expected an error", size)
+		}
+	}
+	if err := generator.Resize(src, src, 1); err == nil {
+		t.Error("Resize below the image size: expected an error")
+	}
+}
+
+func TestPngGenerator_ColorChunks(t *testing.T) {
+	generator := &PngGenerator{}
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name         string
+		size         int64
+		opts         ports.Options
+		wantPad      bool // the padding is a tEXt chunk
+		errSubstring string
+	}{
+		{name: "DPI", size: 20 * 1024, opts: ports.Options{"dpi": "300"}, wantPad: true},
+		{name: "SRGB", size: 20 * 1024, opts: ports.Options{"icc": "srgb", "dpi": "72"}, wantPad: true},
+		{name: "GrayPadded", size: 20 * 1024, opts: ports.Options{"icc": "gray", "icc-pad": "true", "png-color": "gray", "width": "32", "height": "32"}},
+		{name: "PaddedAcrossBlocks", size: 300 * 1024, opts: ports.Options{"icc": "srgb", "icc-pad": "true", "width": "16", "height": "16"}},
+		{name: "PaddedAuto", size: 64 * 1024, opts: ports.Options{"icc": "srgb", "icc-pad": "true"}},
+		{name: "GrayProfileForRGBA", size: 1024, opts: ports.Options{"icc": "gray"}, errSubstring: "does not suit"},
+		{name: "PadWithoutProfile", size: 1024, opts: ports.Options{"icc-pad": "true"}, errSubstring: "needs an icc profile"},
+		{name: "NegativeDPI", size: 1024, opts: ports.Options{"dpi": "-1"}, errSubstring: "dpi must not be negative"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, tc.name+".png")
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.errSubstring != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSubstring) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSubstring, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, tc.size)
+			checkPngValidity(t, outPath)
+
+			data, _ := os.ReadFile(outPath)
+			chunks := map[string][]byte{}
+			for off := len(pngSignature); off < len(data); {
+				n := int(binary.BigEndian.Uint32(data[off:]))
+				typ, body := string(data[off+4:off+8]), data[off+8:off+8+n]
+				if crc32.ChecksumIEEE(data[off+4:off+8+n]) != binary.BigEndian.Uint32(data[off+8+n:]) {
+					t.Errorf("%s chunk has a bad CRC", typ)
+				}
+				chunks[typ] = body
+				off += 12 + n
+			}
+			if _, ok := chunks["tEXt"]; ok != tc.wantPad {
+				t.Errorf("tEXt padding chunk present = %v, want %v", ok, tc.wantPad)
+			}
+			if dpi := tc.opts["dpi"]; dpi != "" {
+				ppm := binary.BigEndian.Uint32(chunks["pHYs"])
+				if got := fmt.Sprint(math.Round(float64(ppm) * 0.0254)); got != dpi || chunks["pHYs"][8] != 1 {
+					t.Errorf("pHYs = %x, want %s DPI", chunks["pHYs"], dpi)
+				}
+			}
+			if tc.opts["icc"] == "" {
+				return
+			}
+			iccp, ok := chunks["iCCP"]
+			if !ok || !bytes.HasPrefix(iccp, []byte(iccpKeyword+"\x00\x00")) {
+				t.Fatalf("iCCP chunk missing or malformed: %q", limitBytes(iccp, 20))
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(iccp[len(iccpKeyword)+2:]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			profile, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("iCCP profile does not inflate: %v", err)
+			}
+			if int(binary.BigEndian.Uint32(profile)) != len(profile) || string(profile[36:40]) != "acsp" {
+				t.Errorf("iCCP holds no valid profile")
+			}
+		})
+	}
+}
+
+func TestPngGenerator_ForResolution(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ports.Options
+	}{
+		{"RGBA", nil},
+		{"PaletteInterlaced", ports.Options{"png-color": "palette", "png-interlace": "true"}},
+		{"ICCPad", ports.Options{"icc": "srgb", "icc-pad": "true", "dpi": "300"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			configured, err := New().(*PngGenerator).Configure(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, size, err := configured.(*PngGenerator).ForResolution(320, 200)
+			if err != nil {
+				t.Fatalf("ForResolution() error = %v", err)
+			}
+			for _, target := range []int64{size, size + 5000} {
+				path := filepath.Join(t.TempDir(), "a.png")
+				if err := g.Generate(path, target); err != nil {
+					t.Fatalf("Generate(%d) error = %v", target, err)
+				}
+				checkFileSize(t, path, target)
+				data, _ := os.ReadFile(path)
+				cfg, err := png.DecodeConfig(bytes.NewReader(data))
+				if err != nil || cfg.Width != 320 || cfg.Height != 200 {
+					t.Fatalf("DecodeConfig() = %dx%d, %v; want 320x200", cfg.Width, cfg.Height, err)
+				}
+				checkPngValidity(t, path)
+			}
+			if err := g.Generate(filepath.Join(t.TempDir(), "a.png"), size+1); err == nil {
+				t.Error("Generate() one byte past the image succeeded")
+			}
+		})
+	}
+}
+
+func TestPngGenerator_Padding(t *testing.T) {
+	generator := &PngGenerator{}
+	bare, err := generator.encode(16, 16, pngOptions{color: colorTypes["rgba"], rand: utils.SeededRand(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name    string
+		padding string
+		chunk   string
+		size    int64
+	}{
+		{name: "TextSmallest", padding: "text", chunk: "tEXt", size: int64(len(bare)) + padChunkMin},
+		{name: "TextLarge", padding: "text", chunk: "tEXt", size: 3 << 20},
+		{name: "ZTXtSmallest", padding: "ztxt", chunk: "zTXt", size: int64(len(bare)) + 28},
+		{name: "ZTXtAcrossBlocks", padding: "ztxt", chunk: "zTXt", size: 200_001},
+		{name: "ZTXtLarge", padding: "ztxt", chunk: "zTXt", size: 3<<20 + 7},
+		{name: "ITXtSmallest", padding: "itxt", chunk: "iTXt", size: int64(len(bare)) + 31},
+		{name: "ITXtLeavingLittle", padding: "itxt", chunk: "iTXt", size: int64(len(bare)) + padChunkMax + 1},
+		{name: "ITXtLarge", padding: "itxt", chunk: "iTXt", size: 3 << 20},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(t.TempDir(), "padded.png")
+			opts := ports.Options{"width": "16", "height": "16", "png-padding": tc.padding}
+			if err := generator.GenerateWithOptions(outPath, tc.size, opts); err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, tc.size)
+			checkPngValidity(t, outPath)
+
+			data, _ := os.ReadFile(outPath)
+			var pads int
+			seenIDAT := false
+			for off := len(pngSignature); off < len(data); {
+				n := int(binary.BigEndian.Uint32(data[off:]))
+				typ, body := string(data[off+4:off+8]), data[off+8:off+8+n]
+				if crc32.ChecksumIEEE(data[off+4:off+8+n]) != binary.BigEndian.Uint32(data[off+8+n:]) {
+					t.Errorf("%s chunk has a bad CRC", typ)
+				}
+				off += 12 + n
+				seenIDAT = seenIDAT || typ == "IDAT"
+				if typ != tc.chunk {
+					continue
+				}
+				pads++
+				if tc.chunk == "tEXt" {
+					continue
+				}
+				if seenIDAT {
+					t.Errorf("%s padding chunk after IDAT", typ)
+				}
+				if 12+n > padChunkMax {
+					t.Errorf("%s padding chunk of %d bytes, want at most %d", typ, 12+n, padChunkMax)
+				}
+				prefix := padPrefix(typ)
+				if !bytes.HasPrefix(body, []byte(prefix)) {
+					t.Fatalf("%s chunk starts %q, want %q", typ, limitBytes(body, 10), prefix)
+				}
+				zr, err := zlib.NewReader(bytes.NewReader(body[len(prefix):]))
+				if err != nil {
+					t.Fatal(err)
+				}
+				text, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("%s padding does not inflate: %v", typ, err)
+				}
+				if strings.Trim(string(text), "abcdefghijklmnopqrstuvwxyz") != "" {
+					t.Errorf("%s padding is not letters", typ)
+				}
+			}
+			want := 1
+			if tc.chunk != "tEXt" {
+				want = int((tc.size - int64(len(bare)) + padChunkMax - 1) / padChunkMax)
+			}
+			if pads != want {
+				t.Errorf("%d %s padding chunks, want %d", pads, tc.chunk, want)
+			}
+
+			image, err := stripPadding(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(image[:len(pngSignature)+25], bare[:len(pngSignature)+25]) || len(image) != len(bare) {
+				t.Errorf("stripPadding left %d bytes, want the %d of the image", len(image), len(bare))
+			}
+		})
+	}
+
+	if _, err := generator.Configure(ports.Options{"png-padding": "exif"}); err == nil || !strings.Contains(err.Error(), "unknown png padding") {
+		t.Errorf("Configure(png-padding=exif) error = %v, want an unknown padding", err)
+	}
+}
@@ -0,0 +1,113 @@
+package png
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// Padding strategies, as "png-padding" takes them.
+const (
+	PaddingText = "text" // one tEXt chunk before IEND
+	PaddingZTXt = "ztxt" // zTXt chunks before the first IDAT
+	PaddingITXt = "itxt" // compressed iTXt chunks before the first IDAT
+)
+
+// padChunks maps the padding strategies to the chunk types they write.
+var padChunks = map[string]string{
+	PaddingText: "tEXt",
+	PaddingZTXt: "zTXt",
+	PaddingITXt: "iTXt",
+}
+
+// padChunkMax caps the zTXt and iTXt padding chunks, well under the 8 MB
+// libpng accepts for an ancillary chunk by default, so that any amount of
+// padding, past the 2 GiB a single chunk holds too, reads back.
+const padChunkMax = 1 << 20
+
+// padPrefix returns what precedes the zlib stream in a padding chunk of
+// type typ: the "Pad" keyword and, for iTXt, the compression flag and
+// method and an empty language tag and translated keyword.
+func padPrefix(typ string) string {
+	if typ == "iTXt" {
+		return "Pad\x00\x01\x00\x00\x00"
+	}
+	return "Pad\x00\x00"
+}
+
+// padMin returns the smallest padding chunk of o's strategy.
+func (o pngOptions) padMin() int64 {
+	if o.padChunk == "tEXt" {
+		return padChunkMin
+	}
+	// Framing, prefix, and a zlib stream of an empty stored block.
+	return int64(12 + len(padPrefix(o.padChunk)) + 6 + 5)
+}
+
+// compressedPadChunk returns a padding chunk of type typ, zTXt or iTXt,
+// of exactly size bytes, at least padMin: random letters in as many
+// stored deflate blocks as make up the size.
+func compressedPadChunk(typ string, size int64, r *utils.Rand) []byte {
+	prefix := padPrefix(typ)
+	stream := size - 12 - int64(len(prefix))
+	blocks := max((stream-6+maxStoredBlock+4)/(maxStoredBlock+5), 1)
+	text := make([]byte, stream-6-5*blocks)
+	r.Read(text)
+	for i, b := range text {
+		text[i] = 'a' + b%26
+	}
+	data := make([]byte, 0, size-12)
+	return chunk(typ, storedZlib(append(data, prefix...), text, int(blocks)))
+}
+
+// writeCompressedPadding writes pngData to path on fsys with needed bytes of o's
+// padding chunks, none over padChunkMax, ahead of its first IDAT chunk.
+// Each chunk is made as it is written, so the padding is never held whole.
+func writeCompressedPadding(fsys ports.OutputFS, path string, pngData []byte, needed int64, o pngOptions) error {
+	idat, err := firstIDAT(pngData)
+	if err != nil {
+		return err
+	}
+	f, err := outputfs.Create(fsys, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriterSize(f, 1<<16)
+	if _, err := w.Write(pngData[:idat]); err != nil {
+		return err
+	}
+	for needed > 0 {
+		n := min(needed, padChunkMax)
+		if rest := needed - n; rest > 0 && rest < o.padMin() {
+			// Leave the last chunk room for its framing.
+			n -= o.padMin()
+		}
+		if _, err := w.Write(compressedPadChunk(o.padChunk, n, o.rand)); err != nil {
+			return err
+		}
+		needed -= n
+	}
+	if _, err := w.Write(pngData[idat:]); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// firstIDAT returns the offset of the first IDAT chunk of pngData.
+func firstIDAT(pngData []byte) (int, error) {
+	for off := len(pngSignature); len(pngData)-off >= 12; {
+		if string(pngData[off+4:off+8]) == "IDAT" {
+			return off, nil
+		}
+		off += 12 + int(binary.BigEndian.Uint32(pngData[off:]))
+	}
+	return 0, fmt.Errorf("invalid PNG: IDAT not found")
+}
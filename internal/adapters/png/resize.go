@@ -0,0 +1,70 @@
+package png
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// Resize writes the image at srcPath to outPath with its chunks as they
+// are and a tEXt padding chunk that brings it to exactly targetSize. The
+// padding of an image written by genfile is replaced, so it can shrink
+// down to its size without padding; data after IEND is dropped.
+func (g *PngGenerator) Resize(srcPath, outPath string, targetSize int64) error {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", srcPath, err)
+	}
+	image, err := stripPadding(data)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", srcPath, err)
+	}
+	if needed := targetSize - int64(len(image)); needed < 0 || (needed > 0 && needed < padChunkMin) {
+		return fmt.Errorf("%d-byte PNG cannot be resized to %d bytes: it needs exactly %d, or at least %d", len(image), targetSize, len(image), int64(len(image))+padChunkMin)
+	}
+	r, err := utils.NewRand(g.opts.String("seed", ""))
+	if err != nil {
+		return err
+	}
+	return padPNGToSize(g.fs, outPath, image, targetSize, r)
+}
+
+// stripPadding returns the PNG in data up to its IEND chunk, without the
+// tEXt, zTXt and iTXt chunks keyed "Pad" that genfile pads with.
+func stripPadding(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+	out := append([]byte(nil), pngSignature...)
+	for off := len(pngSignature); ; {
+		if len(data)-off < 12 {
+			return nil, fmt.Errorf("truncated PNG: no IEND chunk")
+		}
+		n := int64(binary.BigEndian.Uint32(data[off:]))
+		if n > int64(len(data)-off-12) {
+			return nil, fmt.Errorf("truncated PNG: chunk at %d runs past the end", off)
+		}
+		end := off + 12 + int(n)
+		typ, body := string(data[off+4:off+8]), data[off+8:end-4]
+		if !isPadChunk(typ) || !bytes.HasPrefix(body, []byte("Pad\x00")) {
+			out = append(out, data[off:end]...)
+		}
+		if typ == "IEND" {
+			return out, nil
+		}
+		off = end
+	}
+}
+
+// isPadChunk reports whether typ is a type genfile pads with.
+func isPadChunk(typ string) bool {
+	for _, t := range padChunks {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
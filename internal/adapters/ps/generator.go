@@ -0,0 +1,257 @@
+package ps
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypePS, New())
+}
+
+// PsGenerator writes PostScript documents that follow the Document
+// Structuring Conventions, so that spoolers and print filters can find
+// their pages: each page draws random rectangles, lines, circles and text.
+type PsGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &PsGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *PsGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *PsGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	// lineLen is the longest comment line written, well within the 255
+	// characters the conventions allow.
+	lineLen  = 80
+	showpage = "showpage\n"
+	trailer  = "%%Trailer\n%%EOF\n"
+)
+
+// prolog defines F, which selects Helvetica at the size on the stack.
+const prolog = `%%BeginProlog
+/F { /Helvetica findfont exch scalefont setfont } bind def
+%%EndProlog
+`
+
+// psOptions holds the settings the PostScript generator reads from
+// ports.Options.
+type psOptions struct {
+	pages         int
+	width, height int // page size in points
+	at            time.Time
+	rand          *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (psOptions, error) {
+	var o psOptions
+	var err error
+	if o.pages, err = opts.Int("ps-pages", 1); err != nil {
+		return o, err
+	}
+	if o.pages < 1 {
+		return o, fmt.Errorf("ps-pages must be at least 1, got %d", o.pages)
+	}
+	size := strings.ToLower(opts.String("ps-page-size", "a4"))
+	dims, ok := utils.PageSizes[size]
+	if !ok {
+		return o, fmt.Errorf("unknown ps page size %q (want a3, a4, a5, letter or legal)", size)
+	}
+	o.width, o.height = dims[0], dims[1]
+	if o.at, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.at.IsZero() {
+		o.at = time.Now()
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *PsGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+func (g *PsGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := g.GenerateTo(f, size, opts); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// GenerateTo writes exactly size bytes of PostScript to w: the DSC header
+// and prolog, "ps-pages" pages (1) of "ps-page-size" (a4) sharing the
+// drawing evenly, and comment lines after the last page that make up the
+// size. The "mtime" option sets the creation date.
+func (g *PsGenerator) GenerateTo(w io.Writer, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	head := o.header() + prolog
+	// The pages' own lines and the trailer take fixed room; the drawing
+	// shares the rest.
+	fixed := int64(len(head) + len(trailer))
+	for p := 1; p <= o.pages; p++ {
+		fixed += int64(len(pageStart(p)) + len(showpage))
+	}
+	if size < fixed {
+		return fmt.Errorf("target %d too small for %d PostScript pages; need at least %d bytes", size, o.pages, fixed)
+	}
+
+	bw := bufio.NewWriter(w)
+	write := func(s string) error {
+		if _, err := bw.WriteString(s); err != nil {
+			return fmt.Errorf("failed to write PostScript: %w", err)
+		}
+		return nil
+	}
+	if err := write(head); err != nil {
+		return err
+	}
+	free := size - fixed
+	share := free / int64(o.pages)
+	var budget int64 // room left for the drawing on this page
+	for p := 1; p <= o.pages; p++ {
+		if err := write(pageStart(p)); err != nil {
+			return err
+		}
+		// What a page leaves undrawn passes to the next, and the comments
+		// take what the last one leaves.
+		budget += share
+		for {
+			op := o.operation()
+			if int64(len(op)) > budget {
+				break
+			}
+			if err := write(op); err != nil {
+				return err
+			}
+			budget -= int64(len(op))
+			free -= int64(len(op))
+		}
+		if err := write(showpage); err != nil {
+			return err
+		}
+	}
+	if err := write(comments(o.rand, int(free))); err != nil {
+		return err
+	}
+	if err := write(trailer); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write PostScript: %w", err)
+	}
+	return nil
+}
+
+// header returns the DSC header comments.
+func (o psOptions) header() string {
+	return fmt.Sprintf(`%%!PS-Adobe-3.0
+%%%%Title: genfile test document
+%%%%Creator: genfile
+%%%%CreationDate: %s
+%%%%BoundingBox: 0 0 %d %d
+%%%%DocumentData: Clean7Bit
+%%%%DocumentNeededResources: font Helvetica
+%%%%LanguageLevel: 2
+%%%%Pages: %d
+%%%%EndComments
+`, o.at.Format(time.ANSIC), o.width, o.height, o.pages)
+}
+
+// pageStart returns the comment that opens page p.
+func pageStart(p int) string {
+	return fmt.Sprintf("%%%%Page: %d %d\n", p, p)
+}
+
+// operation returns one randomly placed shape or line of text in a random
+// colour, on a line of its own.
+func (o psOptions) operation() string {
+	x, y := o.rand.IntN(o.width), o.rand.IntN(o.height)
+	color := fmt.Sprintf("%.3f %.3f %.3f setrgbcolor", o.rand.Float64(), o.rand.Float64(), o.rand.Float64())
+	switch o.rand.IntN(4) {
+	case 0:
+		return fmt.Sprintf("%s %d %d %d %d rectfill\n", color, x, y, 10+o.rand.IntN(150), 10+o.rand.IntN(150))
+	case 1:
+		return fmt.Sprintf("%s %d setlinewidth newpath %d %d moveto %d %d lineto stroke\n",
+			color, 1+o.rand.IntN(4), x, y, o.rand.IntN(o.width), o.rand.IntN(o.height))
+	case 2:
+		return fmt.Sprintf("%s %d setlinewidth newpath %d %d %d 0 360 arc stroke\n", color, 1+o.rand.IntN(4), x, y, 5+o.rand.IntN(80))
+	}
+	// Lorem text has no parentheses or backslashes to escape.
+	return fmt.Sprintf("%s %d F %d %d moveto (%s) show\n", color, 8+o.rand.IntN(17), x, y, utils.Lorem.Sentence(o.rand, 2, 8))
+}
+
+// comments returns exactly n bytes of comment lines, each at most lineLen
+// bytes; a single byte is a blank line.
+func comments(r *utils.Rand, n int) string {
+	var b strings.Builder
+	for n > 0 {
+		l := min(n, lineLen)
+		// The last line holds at least the percent sign.
+		if rest := n - l; rest == 1 {
+			l--
+		}
+		b.WriteString(comment(r, l))
+		n -= l
+	}
+	return b.String()
+}
+
+// comment returns a comment line of exactly n bytes, or a blank line for a
+// single byte. The percent sign is followed by a space, as %% and %!
+// start structuring comments.
+func comment(r *utils.Rand, n int) string {
+	if n < 2 {
+		return "\n"
+	}
+	room := n - 2
+	text := ""
+	if room > 0 {
+		// The text ends in a letter, as editors may trim trailing spaces.
+		text = strings.TrimRight(utils.Lorem.Text(r, room-1), " ")
+	}
+	return "%" + strings.Repeat(" ", room-len(text)) + text + "\n"
+}
@@ -0,0 +1,122 @@
+package ps
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestPsGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name   string
+		size   int64
+		opts   ports.Options
+		pages  int
+		errSub string
+	}{
+		{name: "OnePage", size: 64 * 1024, pages: 1},
+		{name: "Pages", size: 1<<20 + 7, opts: ports.Options{"ps-pages": "12", "ps-page-size": "letter"}, pages: 12},
+		{name: "MTime", size: 4096, opts: ports.Options{"mtime": "2020-03-04T05:06:07Z"}, pages: 1},
+		{name: "Smallest", size: 367, pages: 1},
+		{name: "TooSmall", size: 366, errSub: "too small"},
+		{name: "ZeroPages", size: 4096, opts: ports.Options{"ps-pages": "0"}, errSub: "ps-pages must be at least 1"},
+		{name: "BadPageSize", size: 4096, opts: ports.Options{"ps-page-size": "b4"}, errSub: "unknown ps page size"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "document.ps")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			checkDocument(t, string(data), tc.pages)
+			if tc.opts.Has("mtime") && !strings.Contains(string(data), "%%CreationDate: Wed Mar  4 05:06:07 2020\n") {
+				t.Error("document is not dated by mtime")
+			}
+		})
+	}
+}
+
+func TestPsGenerator_Sizes(t *testing.T) {
+	// Every size from the smallest document up reaches its target.
+	generator := New().(ports.OptionsGenerator)
+	dir := t.TempDir()
+	for size := int64(367); size < 2000; size++ {
+		path := filepath.Join(dir, "document.ps")
+		if err := generator.GenerateWithOptions(path, size, nil); err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		data, _ := os.ReadFile(path)
+		if int64(len(data)) != size {
+			t.Fatalf("%d bytes came out as %d", size, len(data))
+		}
+		checkDocument(t, string(data), 1)
+	}
+}
+
+func TestPsGenerator_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New().(ports.StreamGenerator).GenerateTo(&buf, 10000, ports.Options{"ps-pages": "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 10000 {
+		t.Fatalf("streamed %d bytes, want 10000", buf.Len())
+	}
+	checkDocument(t, buf.String(), 3)
+}
+
+// checkDocument checks data is a DSC-conforming PostScript document of
+// pages pages, each numbered in order and ended by showpage, with no line
+// longer than 255 characters.
+func checkDocument(t *testing.T, data string, pages int) {
+	t.Helper()
+	if !strings.HasPrefix(data, "%!PS-Adobe-3.0\n") || !strings.HasSuffix(data, "%%Trailer\n%%EOF\n") {
+		t.Fatal("document lacks the DSC header or trailer")
+	}
+	if !strings.Contains(data, fmt.Sprintf("\n%%%%Pages: %d\n", pages)) {
+		t.Errorf("header does not announce %d pages", pages)
+	}
+	page, shown := 0, 0
+	for i, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		if len(line) > 255 {
+			t.Fatalf("line %d is %d characters long", i, len(line))
+		}
+		switch {
+		case strings.HasPrefix(line, "%%Page:"):
+			if page != shown {
+				t.Fatalf("line %d: page %d starts before page %d is shown", i, page+1, page)
+			}
+			page++
+			if want := fmt.Sprintf("%%%%Page: %d %d", page, page); line != want {
+				t.Fatalf("line %d is %q, want %q", i, line, want)
+			}
+		case line == "showpage":
+			shown++
+		case strings.Count(line, "(") != strings.Count(line, ")"):
+			t.Fatalf("line %d has unbalanced parentheses: %q", i, line)
+		}
+	}
+	if page != pages || shown != pages {
+		t.Errorf("document has %d pages and %d showpages, want %d", page, shown, pages)
+	}
+}
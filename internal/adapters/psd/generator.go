@@ -0,0 +1,290 @@
+package psd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypePSD, New())
+}
+
+// PsdGenerator writes Photoshop documents: an RGB noise image whose size is
+// made up by whitespace padding in the XMP image resource.
+type PsdGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &PsdGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *PsdGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *PsdGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	channels = 3 // RGB
+	// maxDimension is the largest width or height a PSD may have.
+	maxDimension = 30000
+	// headerSize is the file header plus the empty color mode data and
+	// layer and mask sections, with the image resources length.
+	headerSize = 26 + 4 + 4 + 4
+	// resolutionSize is the ResolutionInfo resource.
+	resolutionSize = 12 + 16
+	// resourceHeaderSize is the signature, ID, empty name and length of
+	// an image resource.
+	resourceHeaderSize = 12
+	// packBitsRun is the longest literal run PackBits encodes.
+	packBitsRun = 128
+)
+
+// Image resource IDs.
+const (
+	resourceResolution = 0x03ED
+	resourceXMP        = 0x0424
+)
+
+// psdOptions holds the settings the PSD generator reads from ports.Options.
+type psdOptions struct {
+	width, height int       // zero to derive from the size
+	modified      time.Time // XMP dates; zero for none
+	rand          *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (psdOptions, error) {
+	var o psdOptions
+	var err error
+	if o.width, err = opts.Int("width", 0); err != nil {
+		return o, err
+	}
+	if o.height, err = opts.Int("height", 0); err != nil {
+		return o, err
+	}
+	if o.width < 0 || o.height < 0 || o.width > maxDimension || o.height > maxDimension {
+		return o, fmt.Errorf("PSD dimensions must be between 1 and %d, got %dx%d", maxDimension, o.width, o.height)
+	}
+	if o.modified, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *PsdGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes a PSD of exactly size bytes. The merged image
+// is RGB noise, PackBits compressed as Photoshop saves it, sized to about
+// half the file unless "width" and "height" pin it; the XMP packet in the
+// image resources is padded with whitespace to make up the rest.
+func (g *PsdGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	xmpHead, xmpTail := xmpPacket(o.modified)
+	fixed := int64(headerSize + resolutionSize + resourceHeaderSize + len(xmpHead) + len(xmpTail))
+
+	w, h := dimensionsFor(float64(size-fixed)/2/channels, o)
+	for imageDataSize(w, h) > size-fixed {
+		if (o.width > 0 || w == 1) && (o.height > 0 || h == 1) {
+			return fmt.Errorf("target %d too small for a %dx%d PSD; need at least %d bytes", size, w, h, fixed+imageDataSize(w, h))
+		}
+		if o.width == 0 {
+			w = max(w*3/4, 1)
+		}
+		if o.height == 0 {
+			h = max(h*3/4, 1)
+		}
+	}
+	// Resource data is padded to even lengths, so the image data makes up
+	// an odd remainder by splitting a literal run; that needs two pixels.
+	split := (size-fixed-imageDataSize(w, h))%2 != 0
+	if split && w < 2 {
+		if o.width > 0 {
+			return fmt.Errorf("target %d cannot be reached with a PSD 1 pixel wide; odd sizes need 2 pixels or more", size)
+		}
+		if need := fixed + imageDataSize(2, h) + 1; size < need {
+			return fmt.Errorf("target %d too small for a %dx%d PSD; need at least %d bytes", size, 2, h, need)
+		}
+		w = 2
+		split = (size-fixed-imageDataSize(w, h))%2 != 0
+	}
+	image := imageDataSize(w, h)
+	if split {
+		image++
+	}
+	padding := size - fixed - image
+	if padding > math.MaxUint32-resolutionSize-resourceHeaderSize-(fixed-headerSize) {
+		return fmt.Errorf("target %d exceeds what a %dx%d PSD's image resources can pad", size, w, h)
+	}
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+
+	// File header, for 8-bit RGB.
+	bw.WriteString("8BPS")
+	writeBE(bw, uint16(1), [6]byte{}, uint16(channels), uint32(h), uint32(w), uint16(8), uint16(3))
+	writeBE(bw, uint32(0)) // no color mode data
+
+	xmpLen := int64(len(xmpHead)+len(xmpTail)) + padding
+	writeBE(bw, uint32(resolutionSize+resourceHeaderSize+xmpLen))
+	writeResourceHeader(bw, resourceResolution, 16)
+	// 72 dpi, with pixels per inch and inches as the display units.
+	writeBE(bw, uint32(72<<16), uint16(1), uint16(1), uint32(72<<16), uint16(1), uint16(1))
+	writeResourceHeader(bw, resourceXMP, uint32(xmpLen))
+	bw.WriteString(xmpHead)
+	if err := writePadding(bw, padding); err != nil {
+		return fmt.Errorf("failed to write PSD padding: %w", err)
+	}
+	bw.WriteString(xmpTail)
+
+	writeBE(bw, uint32(0)) // no layers
+	if err := writeImage(o.rand, bw, w, h, split); err != nil {
+		return fmt.Errorf("failed to write PSD image data: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write PSD: %w", err)
+	}
+	return f.Sync()
+}
+
+// dimensionsFor picks image dimensions covering roughly pixels pixels,
+// keeping whichever of o's dimensions are pinned.
+func dimensionsFor(pixels float64, o psdOptions) (w, h int) {
+	pixels = max(pixels, 1)
+	switch {
+	case o.width > 0 && o.height > 0:
+		return o.width, o.height
+	case o.width > 0:
+		return o.width, min(max(int(pixels/float64(o.width)), 1), maxDimension)
+	case o.height > 0:
+		return min(max(int(pixels/float64(o.height)), 1), maxDimension), o.height
+	default:
+		side := min(max(int(math.Sqrt(pixels)), 1), maxDimension)
+		return side, side
+	}
+}
+
+// rowSize is the PackBits size of a row of w noise bytes, all literal runs.
+func rowSize(w int) int64 {
+	return int64(w + (w+packBitsRun-1)/packBitsRun)
+}
+
+// imageDataSize is the size of the merged image section: the compression
+// method, a byte count per row and channel, and the rows.
+func imageDataSize(w, h int) int64 {
+	rows := int64(h) * channels
+	return 2 + 2*rows + rows*rowSize(w)
+}
+
+// writeImage writes the merged image as PackBits rows of random bytes
+// from r, one channel after another. With split the first run is written
+// as two, one byte longer.
+func writeImage(r *utils.Rand, bw *bufio.Writer, w, h int, split bool) error {
+	writeBE(bw, uint16(1)) // PackBits
+	for i := 0; i < h*channels; i++ {
+		n := rowSize(w)
+		if i == 0 && split {
+			n++
+		}
+		writeBE(bw, uint16(n))
+	}
+	row := make([]byte, w)
+	for i := 0; i < h*channels; i++ {
+		r.Read(row)
+		rest := row
+		if i == 0 && split {
+			bw.Write([]byte{0, rest[0]})
+			rest = rest[1:]
+		}
+		for len(rest) > 0 {
+			n := min(len(rest), packBitsRun)
+			bw.WriteByte(byte(n - 1))
+			if _, err := bw.Write(rest[:n]); err != nil {
+				return err
+			}
+			rest = rest[n:]
+		}
+	}
+	return nil
+}
+
+func writeResourceHeader(bw *bufio.Writer, id uint16, length uint32) {
+	bw.WriteString("8BIM")
+	writeBE(bw, id, uint16(0), length) // the empty name is padded to two bytes
+}
+
+// writeBE writes each value big-endian.
+func writeBE(bw *bufio.Writer, values ...any) {
+	for _, v := range values {
+		binary.Write(bw, binary.BigEndian, v) // errors surface on Flush
+	}
+}
+
+// xmpPacket returns the XMP packet around its padding. The head and tail
+// together are of even length, as is the padding.
+func xmpPacket(modified time.Time) (head, tail string) {
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\xEF\xBB\xBF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`)
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/" photoshop:ColorMode="3" xmp:CreatorTool="genfile"`)
+	if !modified.IsZero() {
+		d := modified.Format(time.RFC3339)
+		b.WriteString(` xmp:CreateDate="` + d + `" xmp:ModifyDate="` + d + `"`)
+	}
+	b.WriteString("/></rdf:RDF></x:xmpmeta>\n")
+	tail = `<?xpacket end="w"?>`
+	if (b.Len()+len(tail))%2 != 0 {
+		tail = "\n" + tail
+	}
+	return b.String(), tail
+}
+
+// writePadding writes n bytes of XMP padding: spaces, with a line break
+// every 100 bytes.
+func writePadding(bw *bufio.Writer, n int64) error {
+	line := []byte(strings.Repeat(" ", 99) + "\n")
+	for n > 0 {
+		k := min(n, int64(len(line)))
+		if _, err := bw.Write(line[len(line)-int(k):]); err != nil {
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
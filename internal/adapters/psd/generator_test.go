@@ -0,0 +1,148 @@
+package psd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestPsdGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name         string
+		size         int64
+		opts         ports.Options
+		wantW, wantH int // zero to skip
+		errSub       string
+	}{
+		{name: "Small", size: 500},
+		{name: "SmallOdd", size: 501},
+		{name: "Medium", size: 10 * 1024},
+		{name: "MediumOdd", size: 10*1024 + 1},
+		{name: "Large", size: 2 * 1024 * 1024},
+		{name: "Pinned", size: 100 * 1024, opts: ports.Options{"width": "200", "height": "100"}, wantW: 200, wantH: 100},
+		{name: "PinnedOdd", size: 100*1024 + 1, opts: ports.Options{"width": "200", "height": "100"}, wantW: 200, wantH: 100},
+		{name: "PinnedWidth", size: 50 * 1024, opts: ports.Options{"width": "300"}, wantW: 300},
+		{name: "Dated", size: 5000, opts: ports.Options{"mtime": "2020-01-01T00:00:00Z"}},
+		{name: "TooSmall", size: 400, errSub: "too small"},
+		{name: "PinnedTooSmall", size: 10 * 1024, opts: ports.Options{"width": "200", "height": "100"}, errSub: "too small"},
+		{name: "BadDimension", size: 10 * 1024, opts: ports.Options{"width": "40000"}, errSub: "dimensions"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.psd")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			w, h := checkPSD(t, data)
+			if tc.wantW != 0 && w != tc.wantW || tc.wantH != 0 && h != tc.wantH {
+				t.Errorf("dimensions = %dx%d, want %dx%d", w, h, tc.wantW, tc.wantH)
+			}
+			if tc.opts.Has("mtime") && !bytes.Contains(data, []byte(`xmp:CreateDate="2020-01-01T00:00:00Z"`)) {
+				t.Error("XMP packet has no creation date")
+			}
+		})
+	}
+}
+
+// checkPSD walks the sections of a PSD, decodes the merged image and
+// returns its dimensions.
+func checkPSD(t *testing.T, data []byte) (w, h int) {
+	t.Helper()
+	if string(data[:4]) != "8BPS" || binary.BigEndian.Uint16(data[4:]) != 1 {
+		t.Fatalf("bad signature or version % x", data[:6])
+	}
+	chans := int(binary.BigEndian.Uint16(data[12:]))
+	h, w = int(binary.BigEndian.Uint32(data[14:])), int(binary.BigEndian.Uint32(data[18:]))
+	if chans != 3 || binary.BigEndian.Uint16(data[22:]) != 8 || binary.BigEndian.Uint16(data[24:]) != 3 {
+		t.Fatalf("want 8-bit RGB, header % x", data[12:26])
+	}
+	off := 26
+	section := func(name string) []byte {
+		n := int(binary.BigEndian.Uint32(data[off:]))
+		if off+4+n > len(data) {
+			t.Fatalf("%s section of %d bytes at %d overruns the file", name, n, off)
+		}
+		s := data[off+4 : off+4+n]
+		off += 4 + n
+		return s
+	}
+	if len(section("color mode")) != 0 {
+		t.Error("RGB image has color mode data")
+	}
+	res := section("image resources")
+	ids := map[uint16]bool{}
+	for len(res) > 0 {
+		if string(res[:4]) != "8BIM" {
+			t.Fatalf("bad resource signature %q", res[:4])
+		}
+		ids[binary.BigEndian.Uint16(res[4:])] = true
+		n := int(binary.BigEndian.Uint32(res[8:]))
+		data := res[12 : 12+n]
+		if binary.BigEndian.Uint16(res[4:]) == resourceXMP && (!bytes.HasPrefix(data, []byte("<?xpacket begin")) || !bytes.HasSuffix(data, []byte(`<?xpacket end="w"?>`))) {
+			t.Error("XMP resource is not a packet")
+		}
+		res = res[12+n+n%2:]
+	}
+	if !ids[resourceResolution] || !ids[resourceXMP] {
+		t.Errorf("image resources = %v, want ResolutionInfo and XMP", ids)
+	}
+	section("layer and mask")
+
+	if c := binary.BigEndian.Uint16(data[off:]); c != 1 {
+		t.Fatalf("compression = %d, want PackBits", c)
+	}
+	rows := h * chans
+	counts := data[off+2 : off+2+2*rows]
+	img := data[off+2+2*rows:]
+	for i := 0; i < rows; i++ {
+		n := int(binary.BigEndian.Uint16(counts[2*i:]))
+		if got := unpackBits(t, img[:n]); got != w {
+			t.Fatalf("row %d decodes to %d bytes, want %d", i, got, w)
+		}
+		img = img[n:]
+	}
+	if len(img) != 0 {
+		t.Errorf("%d bytes after the image data", len(img))
+	}
+	return w, h
+}
+
+// unpackBits returns the decoded length of a PackBits row.
+func unpackBits(t *testing.T, row []byte) int {
+	t.Helper()
+	n := 0
+	for len(row) > 0 {
+		switch c := int8(row[0]); {
+		case c >= 0:
+			n += int(c) + 1
+			row = row[1+int(c)+1:]
+		case c > -128:
+			n += 1 - int(c)
+			row = row[2:]
+		default:
+			row = row[1:]
+		}
+	}
+	return n
+}
@@ -0,0 +1,331 @@
+package reg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeREG, New())
+}
+
+// RegGenerator writes Windows Registry export files, as regedit writes
+// them: keys under HKEY_CURRENT_USER\Software\Genfile holding string,
+// DWORD, QWORD, binary, expandable and multi-string values.
+type RegGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &RegGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *RegGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *RegGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// SizeStep returns 2 for UTF-16 files and 1 for UTF-8 ones.
+func (g *RegGenerator) SizeStep() int64 {
+	if o, err := parseOptions(g.opts); err == nil && !o.utf16 {
+		return 1
+	}
+	return 2
+}
+
+const (
+	// header starts every file, followed by a blank line and the root key.
+	header  = "Windows Registry Editor Version 5.00"
+	rootKey = `HKEY_CURRENT_USER\Software\Genfile`
+	nl      = "\r\n"
+	// lineLen is the longest line written: regedit wraps hex values to fit
+	// 80 columns, and the comments that end the file are no longer.
+	lineLen      = 80
+	valuesPerKey = 8
+)
+
+// regOptions holds the settings the REG generator reads from
+// ports.Options.
+type regOptions struct {
+	utf16 bool // UTF-16LE with a byte order mark, rather than UTF-8
+	rand  *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (regOptions, error) {
+	var o regOptions
+	var err error
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	switch enc := strings.ToLower(opts.String("reg-encoding", "utf16")); enc {
+	case "utf16":
+		o.utf16 = true
+	case "utf8":
+	default:
+		return o, fmt.Errorf("unknown reg-encoding %q (want utf16 or utf8)", enc)
+	}
+	return o, nil
+}
+
+func (g *RegGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+func (g *RegGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := g.GenerateTo(f, size, opts); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// GenerateTo writes exactly size bytes of registry export to w: the
+// header, the root key and random subkeys with values, and comment lines
+// that make up the size. With "reg-encoding" utf16 (the default) the text
+// is UTF-16LE after a byte order mark, as regedit exports it, and the size
+// must be even; with utf8 it is plain ASCII. Lines end in CR LF.
+func (g *RegGenerator) GenerateTo(w io.Writer, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	// The text is ASCII, so chars counts its bytes in UTF-8 and its code
+	// units in UTF-16.
+	chars := size
+	if o.utf16 {
+		if size%2 != 0 {
+			return fmt.Errorf("REG size must be even in UTF-16, got %d; use reg-encoding utf8 for odd sizes", size)
+		}
+		chars = size/2 - 1
+	}
+	head := header + nl + nl + "[" + rootKey + "]" + nl
+	if need := int64(len(head) + len(nl)); chars < need {
+		if o.utf16 {
+			need = 2 + 2*need
+		}
+		return fmt.Errorf("target %d too small for a registry export; need at least %d bytes", size, need)
+	}
+
+	bw := bufio.NewWriter(w)
+	var out io.Writer = bw
+	if o.utf16 {
+		if _, err := bw.WriteString("\xff\xfe"); err != nil {
+			return fmt.Errorf("failed to write registry export: %w", err)
+		}
+		out = utf16Writer{bw}
+	}
+	write := func(s string) error {
+		if _, err := io.WriteString(out, s); err != nil {
+			return fmt.Errorf("failed to write registry export: %w", err)
+		}
+		return nil
+	}
+	if err := write(head); err != nil {
+		return err
+	}
+	remaining := chars - int64(len(head))
+	// Keys and values follow while a blank line still fits after them;
+	// comments take what they leave.
+	fits := func(s string) bool {
+		return remaining-int64(len(s)) >= int64(len(nl))
+	}
+	for key := 1; ; key++ {
+		line := nl + "[" + rootKey + `\` + title(o.rand) + `\` + fmt.Sprintf("%s%d", title(o.rand), key) + "]" + nl
+		if !fits(line) {
+			break
+		}
+		if err := write(line); err != nil {
+			return err
+		}
+		remaining -= int64(len(line))
+		names := map[string]bool{}
+		full := true
+		for range valuesPerKey {
+			v := value(o.rand, names)
+			if !fits(v) {
+				full = false
+				break
+			}
+			if err := write(v); err != nil {
+				return err
+			}
+			remaining -= int64(len(v))
+		}
+		if !full {
+			break
+		}
+	}
+	if err := write(comments(o.rand, int(remaining))); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write registry export: %w", err)
+	}
+	return nil
+}
+
+// value returns a random value line of the current key, named apart from
+// the names already taken, which it adds to.
+func value(r *utils.Rand, names map[string]bool) string {
+	name := ""
+	for name == "" || names[name] {
+		name = title(r) + title(r)
+	}
+	names[name] = true
+	if r.IntN(8) == 0 && !names["@"] {
+		names["@"] = true
+		name = "@" // the key's default value
+	} else {
+		name = `"` + name + `"`
+	}
+
+	switch r.IntN(7) {
+	case 0:
+		return name + "=" + quote(utils.Lorem.Sentence(r, 2, 8)) + nl
+	case 1:
+		return name + "=" + quote(`C:\Program Files\Genfile\`+utils.Lorem.Word(r)+".exe") + nl
+	case 2:
+		return fmt.Sprintf("%s=dword:%08x%s", name, r.Uint32(), nl)
+	case 3:
+		return hexValue(name, "hex(b)", binary.LittleEndian.AppendUint64(nil, r.Uint64()))
+	case 4:
+		data := make([]byte, 4+r.IntN(60))
+		for i := range data {
+			data[i] = byte(r.Uint32())
+		}
+		return hexValue(name, "hex", data)
+	case 5:
+		return hexValue(name, "hex(2)", utf16z(`%ProgramFiles%\Genfile\`+utils.Lorem.Word(r)))
+	default:
+		var data []byte
+		for range 1 + r.IntN(4) {
+			data = append(data, utf16z(utils.Lorem.Word(r))...)
+		}
+		return hexValue(name, "hex(7)", append(data, 0, 0))
+	}
+}
+
+// quote returns s as a REG_SZ value: quoted, with backslashes and quotes
+// escaped.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// hexValue returns a value line giving data as comma-separated hex bytes
+// of the given type, wrapped as regedit wraps them: each line but the last
+// ends in a backslash within 80 columns, and the next is indented by two
+// spaces.
+func hexValue(name, typ string, data []byte) string {
+	var b strings.Builder
+	b.WriteString(name + "=" + typ + ":")
+	col := b.Len()
+	for i, c := range data {
+		item := fmt.Sprintf("%02x", c)
+		if i < len(data)-1 {
+			item += ","
+		}
+		if col+len(item) > lineLen-1 {
+			b.WriteString(`\` + nl + "  ")
+			col = 2
+		}
+		b.WriteString(item)
+		col += len(item)
+	}
+	return b.String() + nl
+}
+
+// utf16z returns s in UTF-16LE with a terminating NUL, as REG_EXPAND_SZ
+// and REG_MULTI_SZ data hold strings.
+func utf16z(s string) []byte {
+	var data []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+	return append(data, 0, 0)
+}
+
+// comments returns exactly n bytes of comment lines, at least a blank
+// line's worth, each at most lineLen bytes.
+func comments(r *utils.Rand, n int) string {
+	var b strings.Builder
+	for n > 0 {
+		l := min(n, lineLen)
+		// The last line holds at least a semicolon.
+		if rest := n - l; rest > 0 && rest <= len(nl) {
+			l = n - len(nl) - 1
+		}
+		b.WriteString(comment(r, l))
+		n -= l
+	}
+	return b.String()
+}
+
+// comment returns a comment line of exactly n bytes, or a blank line when
+// n leaves no room for the semicolon.
+func comment(r *utils.Rand, n int) string {
+	room := n - len(nl) - 1
+	if room < 0 {
+		return nl
+	}
+	text := ""
+	if room > 0 {
+		// The text ends in a letter, as editors may trim trailing spaces.
+		text = strings.TrimRight(utils.Lorem.Text(r, room-1), " ")
+	}
+	return ";" + strings.Repeat(" ", room-len(text)) + text + nl
+}
+
+func title(r *utils.Rand) string {
+	w := utils.Lorem.Word(r)
+	return strings.ToUpper(w[:1]) + w[1:]
+}
+
+// utf16Writer writes the ASCII text written to it as UTF-16LE.
+type utf16Writer struct {
+	w *bufio.Writer
+}
+
+func (u utf16Writer) Write(p []byte) (int, error) {
+	for i, c := range p {
+		if err := u.w.WriteByte(c); err != nil {
+			return i, err
+		}
+		if err := u.w.WriteByte(0); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,151 @@
+package reg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestRegGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name   string
+		size   int64
+		opts   ports.Options
+		errSub string
+	}{
+		{name: "Smallest", size: 162},
+		{name: "UTF16", size: 64 * 1024},
+		{name: "UTF8", size: 64*1024 + 1, opts: ports.Options{"reg-encoding": "utf8"}},
+		{name: "SmallestUTF8", size: 80, opts: ports.Options{"reg-encoding": "UTF8"}},
+		{name: "Odd", size: 4097, errSub: "must be even"},
+		{name: "TooSmall", size: 160, errSub: "too small"},
+		{name: "TooSmallUTF8", size: 79, opts: ports.Options{"reg-encoding": "utf8"}, errSub: "too small"},
+		{name: "BadEncoding", size: 4096, opts: ports.Options{"reg-encoding": "ansi"}, errSub: "reg-encoding"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixture.reg")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			checkExport(t, decode(t, data, tc.opts["reg-encoding"] == ""))
+		})
+	}
+}
+
+func TestRegGenerator_Sizes(t *testing.T) {
+	// Every size from the smallest export up reaches its target.
+	generator := New().(ports.OptionsGenerator)
+	dir := t.TempDir()
+	for _, enc := range []string{"utf8", "utf16"} {
+		step := int64(1)
+		if enc == "utf16" {
+			step = 2
+		}
+		for size := int64(162); size < 2000; size += step {
+			path := filepath.Join(dir, "fixture.reg")
+			if err := generator.GenerateWithOptions(path, size, ports.Options{"reg-encoding": enc}); err != nil {
+				t.Fatalf("%s, %d bytes: %v", enc, size, err)
+			}
+			data, _ := os.ReadFile(path)
+			if int64(len(data)) != size {
+				t.Fatalf("%s, %d bytes came out as %d", enc, size, len(data))
+			}
+			checkExport(t, decode(t, data, enc == "utf16"))
+		}
+	}
+}
+
+// decode returns the text of an export, checking it is UTF-16LE after a
+// byte order mark if wide is set.
+func decode(t *testing.T, data []byte, wide bool) string {
+	t.Helper()
+	if !wide {
+		return string(data)
+	}
+	if !bytes.HasPrefix(data, []byte{0xff, 0xfe}) {
+		t.Fatalf("UTF-16 export starts with % x, want a byte order mark", data[:2])
+	}
+	units := make([]uint16, (len(data)-2)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2+2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+var (
+	keyRe   = regexp.MustCompile(`^\[HKEY_CURRENT_USER\\Software\\Genfile(\\[A-Za-z]+\\[A-Za-z]+[0-9]+)?\]$`)
+	valueRe = regexp.MustCompile(`^(@|"[A-Za-z]+")=("(?:[^"\\]|\\.)*"|dword:[0-9a-f]{8}|hex(?:\((?:2|7|b)\))?:((?:[0-9a-f]{2},)*[0-9a-f]{2}))$`)
+)
+
+// checkExport checks text is a registry export: the header, a blank line,
+// then keys, values and comments, with comments and hex values within 80
+// columns.
+func checkExport(t *testing.T, text string) {
+	t.Helper()
+	if !strings.HasPrefix(text, header+"\r\n\r\n[") {
+		t.Fatalf("export starts %q", text[:min(len(text), 60)])
+	}
+	if !strings.HasSuffix(text, "\r\n") {
+		t.Fatal("last line is not terminated")
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\r\n"), "\r\n")
+	for i := 2; i < len(lines); i++ {
+		line := lines[i]
+		if (strings.HasPrefix(line, ";") || strings.Contains(line, "=hex")) && len(line) > lineLen {
+			t.Fatalf("line %d is %d columns long", i, len(line))
+		}
+		// Join a hex value's continuation lines.
+		for strings.HasSuffix(line, `\`) && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "  ") {
+			i++
+			if len(lines[i]) > lineLen {
+				t.Fatalf("line %d is %d columns long", i, len(lines[i]))
+			}
+			line = strings.TrimSuffix(line, `\`) + strings.TrimPrefix(lines[i], "  ")
+		}
+		switch {
+		case line == "", strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "["):
+			if !keyRe.MatchString(line) {
+				t.Fatalf("line %d: bad key %q", i, line)
+			}
+		default:
+			m := valueRe.FindStringSubmatch(line)
+			if m == nil {
+				t.Fatalf("line %d: bad value %q", i, line)
+			}
+			if m[3] != "" {
+				if _, err := hex.DecodeString(strings.ReplaceAll(m[3], ",", "")); err != nil {
+					t.Fatalf("line %d: %v", i, err)
+				}
+			}
+		}
+	}
+	if lines[2] != "["+rootKey+"]" {
+		t.Errorf("first key is %q, want the root key", lines[2])
+	}
+}
@@ -0,0 +1,58 @@
+package remote
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// FTPSink uploads files over FTP, or FTPS with explicit TLS.
+type FTPSink struct {
+	conn *ftp.ServerConn
+}
+
+func dialFTP(t target, cfg Config) (*FTPSink, error) {
+	opts := []ftp.DialOption{ftp.DialWithTimeout(cfg.Timeout)}
+	if t.scheme == "ftps" {
+		opts = append(opts, ftp.DialWithExplicitTLS(&tls.Config{ServerName: t.host, InsecureSkipVerify: cfg.Insecure}))
+	}
+	conn, err := ftp.Dial(t.addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	user, password := t.user, t.password
+	if user == "" {
+		user, password = "anonymous", "anonymous"
+	}
+	if err := conn.Login(user, password); err != nil {
+		conn.Quit()
+		return nil, fmt.Errorf("login as %s failed: %w", user, err)
+	}
+	return &FTPSink{conn: conn}, nil
+}
+
+// Put writes r to path on the server.
+func (s *FTPSink) Put(path string, r io.Reader) error {
+	if err := s.conn.Stor(path, r); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", path, err)
+	}
+	return nil
+}
+
+// Remove deletes path from the server. Servers answer 550 for a missing
+// file, which is taken as removed.
+func (s *FTPSink) Remove(path string) error {
+	var reply *textproto.Error
+	if err := s.conn.Delete(path); err != nil && !(errors.As(err, &reply) && reply.Code == ftp.StatusFileUnavailable) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *FTPSink) Close() error {
+	return s.conn.Quit()
+}
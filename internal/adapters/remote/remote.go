@@ -0,0 +1,103 @@
+// Package remote provides ports.Sink implementations that upload generated
+// files over SFTP and FTP.
+package remote
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// Config holds the credentials and connection settings for a remote sink.
+// A user or password in the URI takes precedence over User and Password.
+type Config struct {
+	User     string
+	Password string
+	// KeyFile is an SSH private key used for SFTP authentication.
+	KeyFile string
+	// KnownHosts is the known_hosts file SFTP host keys are checked
+	// against; empty means ~/.ssh/known_hosts.
+	KnownHosts string
+	// Insecure skips SFTP host key checks and FTPS certificate checks.
+	Insecure bool
+	Timeout  time.Duration
+}
+
+// defaultTimeout bounds connecting and logging in when Config.Timeout is 0.
+const defaultTimeout = 30 * time.Second
+
+var defaultPorts = map[string]string{"sftp": "22", "ftp": "21", "ftps": "21"}
+
+// IsRemote reports whether output is a URI naming a remote destination
+// rather than a local path.
+func IsRemote(output string) bool {
+	scheme, _, ok := strings.Cut(output, "://")
+	_, known := defaultPorts[strings.ToLower(scheme)]
+	return ok && known
+}
+
+// target is a parsed remote destination.
+type target struct {
+	scheme   string
+	addr     string // host:port
+	host     string
+	user     string
+	password string
+	path     string
+}
+
+func parseTarget(rawURL string, cfg Config) (target, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return target{}, fmt.Errorf("invalid remote URI: %w", err)
+	}
+	t := target{scheme: strings.ToLower(u.Scheme), host: u.Hostname(), user: cfg.User, password: cfg.Password, path: u.Path}
+	port, ok := defaultPorts[t.scheme]
+	if !ok {
+		return t, fmt.Errorf("unsupported remote scheme %q (want sftp, ftp or ftps)", u.Scheme)
+	}
+	if t.host == "" {
+		return t, fmt.Errorf("remote URI %q has no host", rawURL)
+	}
+	if t.path == "" || strings.HasSuffix(t.path, "/") {
+		return t, fmt.Errorf("remote URI %q must end in a file name", rawURL)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	t.addr = net.JoinHostPort(t.host, port)
+	if u.User != nil {
+		t.user = u.User.Username()
+		if pw, ok := u.User.Password(); ok {
+			t.password = pw
+		}
+	}
+	return t, nil
+}
+
+// Open connects to the server named by rawURL (sftp://, ftp:// or ftps://)
+// and returns a sink on it together with the file path from the URI.
+func Open(rawURL string, cfg Config) (ports.Sink, string, error) {
+	t, err := parseTarget(rawURL, cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	var sink ports.Sink
+	switch t.scheme {
+	case "sftp":
+		sink, err = dialSFTP(t, cfg)
+	default:
+		sink, err = dialFTP(t, cfg)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to connect to %s: %w", t.addr, err)
+	}
+	return sink, t.path, nil
+}
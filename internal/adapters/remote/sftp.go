@@ -0,0 +1,101 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPSink uploads files over SFTP.
+type SFTPSink struct {
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+func dialSFTP(t target, cfg Config) (*SFTPSink, error) {
+	if t.user == "" {
+		return nil, fmt.Errorf("SFTP needs a user name")
+	}
+	var auth []ssh.AuthMethod
+	if cfg.KeyFile != "" {
+		key, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH key %s: %w", cfg.KeyFile, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if t.password != "" {
+		auth = append(auth, ssh.Password(t.password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("SFTP needs a password or an SSH key")
+	}
+
+	hostKeys := ssh.InsecureIgnoreHostKey()
+	if !cfg.Insecure {
+		path := cfg.KnownHosts
+		if path == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("cannot locate known_hosts: %w", err)
+			}
+			path = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		var err error
+		if hostKeys, err = knownhosts.New(path); err != nil {
+			return nil, fmt.Errorf("failed to load known hosts: %w", err)
+		}
+	}
+
+	conn, err := ssh.Dial("tcp", t.addr, &ssh.ClientConfig{
+		User:            t.user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         cfg.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SFTP: %w", err)
+	}
+	return &SFTPSink{conn: conn, client: client}, nil
+}
+
+// Put writes r to path on the server.
+func (s *SFTPSink) Put(path string, r io.Reader) error {
+	f, err := s.client.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := f.ReadFrom(r); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to upload %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Remove deletes path from the server.
+func (s *SFTPSink) Remove(path string) error {
+	if err := s.client.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *SFTPSink) Close() error {
+	s.client.Close()
+	return s.conn.Close()
+}
@@ -0,0 +1,213 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: genfilepb/genfile.proto
+
+package genfilepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Genfile_GenerateFile_FullMethodName   = "/genfile.v1.Genfile/GenerateFile"
+	Genfile_GenerateStream_FullMethodName = "/genfile.v1.Genfile/GenerateStream"
+	Genfile_ListTypes_FullMethodName      = "/genfile.v1.Genfile/ListTypes"
+)
+
+// GenfileClient is the client API for Genfile service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Genfile generates placeholder files of a given type and size.
+type GenfileClient interface {
+	// GenerateFile writes a file under the server's output directory.
+	GenerateFile(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (*GenerateFileResponse, error)
+	// GenerateStream sends the content of a file without writing it on the
+	// server.
+	GenerateStream(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Chunk], error)
+	// ListTypes lists the supported file types and their features.
+	ListTypes(ctx context.Context, in *ListTypesRequest, opts ...grpc.CallOption) (*ListTypesResponse, error)
+}
+
+type genfileClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGenfileClient(cc grpc.ClientConnInterface) GenfileClient {
+	return &genfileClient{cc}
+}
+
+func (c *genfileClient) GenerateFile(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (*GenerateFileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GenerateFileResponse)
+	err := c.cc.Invoke(ctx, Genfile_GenerateFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *genfileClient) GenerateStream(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Chunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Genfile_ServiceDesc.Streams[0], Genfile_GenerateStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GenerateRequest, Chunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Genfile_GenerateStreamClient = grpc.ServerStreamingClient[Chunk]
+
+func (c *genfileClient) ListTypes(ctx context.Context, in *ListTypesRequest, opts ...grpc.CallOption) (*ListTypesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTypesResponse)
+	err := c.cc.Invoke(ctx, Genfile_ListTypes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GenfileServer is the server API for Genfile service.
+// All implementations must embed UnimplementedGenfileServer
+// for forward compatibility.
+//
+// Genfile generates placeholder files of a given type and size.
+type GenfileServer interface {
+	// GenerateFile writes a file under the server's output directory.
+	GenerateFile(context.Context, *GenerateRequest) (*GenerateFileResponse, error)
+	// GenerateStream sends the content of a file without writing it on the
+	// server.
+	GenerateStream(*GenerateRequest, grpc.ServerStreamingServer[Chunk]) error
+	// ListTypes lists the supported file types and their features.
+	ListTypes(context.Context, *ListTypesRequest) (*ListTypesResponse, error)
+	mustEmbedUnimplementedGenfileServer()
+}
+
+// UnimplementedGenfileServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGenfileServer struct{}
+
+func (UnimplementedGenfileServer) GenerateFile(context.Context, *GenerateRequest) (*GenerateFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GenerateFile not implemented")
+}
+func (UnimplementedGenfileServer) GenerateStream(*GenerateRequest, grpc.ServerStreamingServer[Chunk]) error {
+	return status.Errorf(codes.Unimplemented, "method GenerateStream not implemented")
+}
+func (UnimplementedGenfileServer) ListTypes(context.Context, *ListTypesRequest) (*ListTypesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTypes not implemented")
+}
+func (UnimplementedGenfileServer) mustEmbedUnimplementedGenfileServer() {}
+func (UnimplementedGenfileServer) testEmbeddedByValue()                 {}
+
+// UnsafeGenfileServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GenfileServer will
+// result in compilation errors.
+type UnsafeGenfileServer interface {
+	mustEmbedUnimplementedGenfileServer()
+}
+
+func RegisterGenfileServer(s grpc.ServiceRegistrar, srv GenfileServer) {
+	// If the following call pancis, it indicates UnimplementedGenfileServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Genfile_ServiceDesc, srv)
+}
+
+func _Genfile_GenerateFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GenerateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GenfileServer).GenerateFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Genfile_GenerateFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GenfileServer).GenerateFile(ctx, req.(*GenerateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Genfile_GenerateStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GenerateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GenfileServer).GenerateStream(m, &grpc.GenericServerStream[GenerateRequest, Chunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Genfile_GenerateStreamServer = grpc.ServerStreamingServer[Chunk]
+
+func _Genfile_ListTypes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTypesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GenfileServer).ListTypes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Genfile_ListTypes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GenfileServer).ListTypes(ctx, req.(*ListTypesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Genfile_ServiceDesc is the grpc.ServiceDesc for Genfile service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Genfile_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "genfile.v1.Genfile",
+	HandlerType: (*GenfileServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GenerateFile",
+			Handler:    _Genfile_GenerateFile_Handler,
+		},
+		{
+			MethodName: "ListTypes",
+			Handler:    _Genfile_ListTypes_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GenerateStream",
+			Handler:       _Genfile_GenerateStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "genfilepb/genfile.proto",
+}
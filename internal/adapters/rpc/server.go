@@ -0,0 +1,250 @@
+// Package rpc serves the file service over gRPC, as defined in
+// genfilepb/genfile.proto.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative genfilepb/genfile.proto
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hailam/genfile/internal/adapters/rpc/genfilepb"
+	"github.com/hailam/genfile/internal/application"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// chunkSize is the largest Chunk GenerateStream sends, well below the 4MB
+// gRPC clients accept by default.
+const chunkSize = 256 * 1024
+
+// remoteOptions are the generator options clients may set: those shaping
+// what is generated. Left out are those naming files or directories on
+// the server to read ("corpus", "xml-schema") and "threads", which is the
+// server's to choose; "icc" is taken only with a built-in profile.
+var remoteOptions = []string{
+	"access-version", "bin-fill", "bin-repeat", "bin-seed",
+	"cert-cn", "cert-key", "cert-self-signed", "cfb-version", "content",
+	"csv-columns", "docx-image-size", "docx-images", "docx-spreadsheet",
+	"dpi", "dxf-entities", "dxf-format", "dxf-version", "edi-newline",
+	"edi-standard", "eicar", "embed-count", "embed-string", "entropy",
+	"fhir-resource", "frames", "fw-layout", "fw-newline",
+	"fw-record-length", "gif-delay", "height", "hl7-newline",
+	"html-content", "icc", "icc-pad", "ini-newline", "jpeg-exif",
+	"jpeg-progressive", "jpeg-quality", "lang", "mp4-audio",
+	"mp4-duration", "mp4-fps", "mp4-poster", "mp4-thumbnail-interval",
+	"mp4-thumbnails", "ndjson-content", "oci-layers", "oci-ref",
+	"pdf-attachments", "pdf-content", "pdf-page-size", "pdf-pages",
+	"pdf-paragraphs", "pdf-shapes", "pdf-version", "pdf-xref",
+	"pii-density", "pkg-arch", "pkg-name", "pkg-version", "png-color",
+	"png-interlace", "png-padding", "ps-page-size", "ps-pages",
+	"reg-encoding", "scan-dpi", "seed", "segment-duration",
+	"segment-format", "shared-blocks", "shared-pool", "shp-geometry",
+	"signature-placeholder", "tiff-page-size", "tiff-pages",
+	"txt-content", "txt-line-length", "wav-bits", "wav-channels",
+	"wav-content", "wav-frequency", "wav-sample-rate", "width",
+	"xlsx-padding", "xlsx-sheets", "xml-fields", "xml-record",
+	"xml-root", "xps-page-size", "xps-pages", "zip-compression",
+	"zip-descriptor", "zip-encryption", "zip-entries",
+	"zip-entry-distribution", "zip-entry-type", "zip-local-order",
+	"zip-name-length", "zip-nest-branching", "zip-nest-depth",
+	"zip-password", "zip-ratio", "zip-sfx", "zip-unicode-names",
+}
+
+// Server implements genfilepb.GenfileServer on top of a FileService.
+type Server struct {
+	genfilepb.UnimplementedGenfileServer
+	service *application.FileService
+	dir     string
+	types   []ports.FileType
+	maxSize int64
+}
+
+// NewServer returns a server that generates files with service, writes
+// those of GenerateFile under dir and lists types in ListTypes. If maxSize
+// is above 0, requests must ask for a size of at most maxSize bytes.
+func NewServer(service *application.FileService, dir string, types []ports.FileType, maxSize int64) *Server {
+	return &Server{service: service, dir: dir, types: types, maxSize: maxSize}
+}
+
+// Register adds the Genfile service to s.
+func (srv *Server) Register(s *grpc.Server) {
+	genfilepb.RegisterGenfileServer(s, srv)
+}
+
+// GenerateFile writes the requested file under the output directory. The
+// path must stay inside it; missing parent directories are created.
+func (srv *Server) GenerateFile(ctx context.Context, req *genfilepb.GenerateRequest) (*genfilepb.GenerateFileResponse, error) {
+	if req.GetPath() == "" || !filepath.IsLocal(req.GetPath()) {
+		return nil, status.Errorf(codes.InvalidArgument, "path %q must be relative and inside the output directory", req.GetPath())
+	}
+	path := filepath.Join(srv.dir, req.GetPath())
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create the directory of %s: %v", req.GetPath(), err)
+	}
+	fr, err := srv.fileRequest(path, req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	result, err := srv.service.Create(fr)
+	if err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	resp := &genfilepb.GenerateFileResponse{
+		Path:       srv.rel(result.Path),
+		Type:       string(result.Type),
+		Size:       result.Size,
+		TargetSize: result.TargetSize,
+		Lines:      result.Lines,
+	}
+	for _, c := range result.Companions {
+		resp.Companions = append(resp.Companions, srv.rel(c.Path))
+	}
+	return resp, nil
+}
+
+// GenerateStream sends the requested file in chunks of up to chunkSize
+// bytes; path, if set, only selects the format. Nothing is left on the
+// server, though formats that cannot be streamed directly pass through a
+// temporary file.
+func (srv *Server) GenerateStream(req *genfilepb.GenerateRequest, stream grpc.ServerStreamingServer[genfilepb.Chunk]) error {
+	path := req.GetPath()
+	if path == "" {
+		path = "stream"
+	}
+	fr, err := srv.fileRequest(path, req)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	w := bufio.NewWriterSize(&chunkWriter{stream: stream}, chunkSize)
+	if _, err := srv.service.Stream(w, fr); err != nil {
+		return status.Error(codes.Unknown, err.Error())
+	}
+	if err := w.Flush(); err != nil {
+		return status.Error(codes.Unknown, err.Error())
+	}
+	return nil
+}
+
+// ListTypes reports every type the server generates and its features.
+func (srv *Server) ListTypes(ctx context.Context, req *genfilepb.ListTypesRequest) (*genfilepb.ListTypesResponse, error) {
+	types := slices.Clone(srv.types)
+	slices.Sort(types)
+	resp := &genfilepb.ListTypesResponse{}
+	for _, t := range types {
+		c, err := srv.service.Capabilities(string(t))
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		resp.Types = append(resp.Types, &genfilepb.FileTypeInfo{
+			Type:     string(t),
+			Options:  c.Options,
+			Lines:    c.Lines,
+			Stream:   c.Stream,
+			Estimate: c.Plan,
+			Allocate: c.Allocate,
+			Metadata: c.Metadata,
+			Resize:   c.Resize,
+		})
+	}
+	return resp, nil
+}
+
+// rel returns path relative to the output directory.
+func (srv *Server) rel(path string) string {
+	if rel, err := filepath.Rel(srv.dir, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// fileRequest maps req onto a FileRequest for the file at path. Options
+// other than remoteOptions, sizes or tolerances of files on the server
+// ("@path") and sizes above the maximum are errors.
+func (srv *Server) fileRequest(path string, req *genfilepb.GenerateRequest) (application.FileRequest, error) {
+	fr := application.FileRequest{
+		Path:      path,
+		Type:      req.GetType(),
+		MIME:      req.GetMime(),
+		SizeSpec:  req.GetSize(),
+		Lines:     req.GetLines(),
+		Options:   ports.Options{},
+		Strict:    req.GetStrict(),
+		Tolerance: req.GetTolerance(),
+		MTime:     req.GetMtime(),
+	}
+	for name, spec := range map[string]string{"size": fr.SizeSpec, "tolerance": fr.Tolerance} {
+		if strings.HasPrefix(strings.TrimSpace(spec), "@") {
+			return fr, fmt.Errorf("%s %s names a file on the server, which is not allowed", name, spec)
+		}
+	}
+	for k, v := range req.GetOptions() {
+		if !slices.Contains(remoteOptions, k) {
+			return fr, fmt.Errorf("option %s is not allowed", k)
+		}
+		if k == "icc" && !builtinICC(v) {
+			return fr, fmt.Errorf("option %s names a file on the server, which is not allowed", k)
+		}
+		fr.Options[k] = v
+	}
+	if srv.maxSize > 0 {
+		if fr.SizeSpec == "" {
+			return fr, fmt.Errorf("a size of at most %d bytes is required", srv.maxSize)
+		}
+		size, err := utils.ParseSize(fr.SizeSpec)
+		if err != nil {
+			return fr, fmt.Errorf("invalid size '%s': %w", fr.SizeSpec, err)
+		}
+		if size > srv.maxSize {
+			return fr, fmt.Errorf("size %s is more than the maximum of %d bytes", fr.SizeSpec, srv.maxSize)
+		}
+	}
+	if len(req.GetMetadata()) > 0 {
+		var pairs []string
+		for k, v := range req.GetMetadata() {
+			pairs = append(pairs, k+"="+v)
+		}
+		var err error
+		if fr.Metadata, err = application.ParseMetadata(pairs); err != nil {
+			return fr, err
+		}
+	}
+	return fr, nil
+}
+
+// builtinICC reports whether the "icc" option value v names a built-in
+// profile rather than a file.
+func builtinICC(v string) bool {
+	switch strings.ToLower(v) {
+	case "srgb", "gray":
+		return true
+	}
+	return false
+}
+
+// chunkWriter sends what is written to it as Chunk messages.
+type chunkWriter struct {
+	stream grpc.ServerStreamingServer[genfilepb.Chunk]
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		m := min(len(p), chunkSize)
+		if err := w.stream.Send(&genfilepb.Chunk{Data: p[:m]}); err != nil {
+			return n, fmt.Errorf("failed to send chunk: %w", err)
+		}
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
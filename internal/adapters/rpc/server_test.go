@@ -0,0 +1,141 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/rpc/genfilepb"
+	_ "github.com/hailam/genfile/internal/adapters/txt"
+	adapterutils "github.com/hailam/genfile/internal/adapters/utils"
+	"github.com/hailam/genfile/internal/application"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// startServer serves a Server writing under dir, with the maximum size
+// maxSize, over an in-memory connection and returns a client for it.
+func startServer(t *testing.T, dir string, maxSize int64) genfilepb.GenfileClient {
+	t.Helper()
+	service := application.NewFileService(factory.NewGeneratorFactory(), adapterutils.NewUtilSizeParser())
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	NewServer(service, dir, []ports.FileType{ports.FileTypeTXT}, maxSize).Register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return genfilepb.NewGenfileClient(conn)
+}
+
+func TestServer_GenerateFile(t *testing.T) {
+	dir := t.TempDir()
+	client := startServer(t, dir, 0)
+	ctx := context.Background()
+
+	resp, err := client.GenerateFile(ctx, &genfilepb.GenerateRequest{Path: "fixtures/a.txt", Size: "10KB"})
+	require.NoError(t, err)
+	require.Equal(t, "fixtures/a.txt", resp.Path)
+	require.Equal(t, "txt", resp.Type)
+	require.Equal(t, int64(10000), resp.TargetSize)
+	info, err := os.Stat(filepath.Join(dir, "fixtures", "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, resp.Size, info.Size())
+
+	for _, path := range []string{"", "../a.txt", "/tmp/a.txt"} {
+		_, err := client.GenerateFile(ctx, &genfilepb.GenerateRequest{Path: path, Size: "1KB"})
+		require.Equal(t, codes.InvalidArgument, status.Code(err), "path %q", path)
+	}
+	_, err = client.GenerateFile(ctx, &genfilepb.GenerateRequest{Path: "b.txt", Size: "1KB", Metadata: map[string]string{"bad key": "x"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.GenerateFile(ctx, &genfilepb.GenerateRequest{Path: "c.txt", Size: "lots"})
+	require.Error(t, err)
+}
+
+func TestServer_GenerateStream(t *testing.T) {
+	dir := t.TempDir()
+	client := startServer(t, dir, 0)
+
+	// Larger than a chunk, so that it arrives in several.
+	stream, err := client.GenerateStream(context.Background(), &genfilepb.GenerateRequest{Type: "txt", Size: "1MB"})
+	require.NoError(t, err)
+	var size, chunks int
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(chunk.Data), chunkSize)
+		size += len(chunk.Data)
+		chunks++
+	}
+	require.Equal(t, 1000000, size)
+	require.Greater(t, chunks, 1)
+	entries, _ := os.ReadDir(dir)
+	require.Empty(t, entries, "GenerateStream left files in the output directory")
+
+	stream, err = client.GenerateStream(context.Background(), &genfilepb.GenerateRequest{Size: "1KB"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Error(t, err, "a stream without a type")
+}
+
+func TestServer_ListTypes(t *testing.T) {
+	client := startServer(t, t.TempDir(), 0)
+	resp, err := client.ListTypes(context.Background(), &genfilepb.ListTypesRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Types, 1)
+	require.Equal(t, "txt", resp.Types[0].Type)
+	require.True(t, resp.Types[0].Stream)
+}
+
+func TestServer_Refused(t *testing.T) {
+	dir := t.TempDir()
+	client := startServer(t, dir, 1024*1024)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		req  *genfilepb.GenerateRequest
+	}{
+		{"Corpus", &genfilepb.GenerateRequest{Path: "a.txt", Size: "1KB", Options: map[string]string{"corpus": "/etc/passwd"}}},
+		{"Schema", &genfilepb.GenerateRequest{Path: "a.xml", Size: "1KB", Options: map[string]string{"xml-schema": "/etc/passwd"}}},
+		{"ICC file", &genfilepb.GenerateRequest{Path: "a.png", Size: "1KB", Options: map[string]string{"icc": "/etc/passwd"}}},
+		{"Threads", &genfilepb.GenerateRequest{Path: "a.txt", Size: "1KB", Options: map[string]string{"threads": "10000"}}},
+		{"Unknown option", &genfilepb.GenerateRequest{Path: "a.txt", Size: "1KB", Options: map[string]string{"no-such-option": "1"}}},
+		{"Size of a file", &genfilepb.GenerateRequest{Path: "a.txt", Size: "@/etc/passwd"}},
+		{"Tolerance of a file", &genfilepb.GenerateRequest{Path: "a.txt", Size: "1KB", Tolerance: "@/etc/shadow"}},
+		{"Too large", &genfilepb.GenerateRequest{Path: "a.txt", Size: "2MB"}},
+		{"No size", &genfilepb.GenerateRequest{Path: "a.txt", Lines: 10}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.GenerateFile(ctx, tc.req)
+			require.Equal(t, codes.InvalidArgument, status.Code(err), "GenerateFile: %v", err)
+			stream, err := client.GenerateStream(ctx, tc.req)
+			require.NoError(t, err)
+			_, err = stream.Recv()
+			require.Equal(t, codes.InvalidArgument, status.Code(err), "GenerateStream: %v", err)
+		})
+	}
+	entries, _ := os.ReadDir(dir)
+	require.Empty(t, entries)
+
+	_, err := client.GenerateFile(ctx, &genfilepb.GenerateRequest{Path: "b.txt", Size: "1MB", Options: map[string]string{"icc": "sRGB", "seed": "7"}})
+	require.NoError(t, err, "a size at the maximum, a built-in profile and a seed")
+}
@@ -0,0 +1,408 @@
+package rpm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeRPM, New())
+}
+
+// RpmGenerator writes RPM binary packages: the lead, a signature header
+// with the header digests and sizes, the package header and a gzipped
+// cpio payload installing one file of random data that pads the package.
+type RpmGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &RpmGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *RpmGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *RpmGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	leadSize = 96
+	// maxSize is the largest package the 32-bit size tags describe.
+	maxSize     = 1<<32 - 1
+	cpioTrailer = "TRAILER!!!"
+
+	defaultName    = "genfile-fixture"
+	defaultVersion = "1.0.0-1"
+	defaultArch    = "x86_64"
+
+	// digestSHA256 is the PGP hash algorithm number rpm records digests
+	// by.
+	digestSHA256 = 8
+	// rpmlibDep is RPMSENSE_RPMLIB|RPMSENSE_LESS|RPMSENSE_EQUAL, the
+	// flags of a dependency on an rpm feature.
+	rpmlibDep  = 1<<24 | 2 | 8
+	senseEqual = 8
+)
+
+// Header tags.
+const (
+	tagHeaderSignatures = 62
+	tagHeaderImmutable  = 63
+	tagI18NTable        = 100
+
+	sigTagSHA1        = 269
+	sigTagSHA256      = 273
+	sigTagSize        = 1000
+	sigTagPayloadSize = 1007
+
+	tagName              = 1000
+	tagVersion           = 1001
+	tagRelease           = 1002
+	tagSummary           = 1004
+	tagDescription       = 1005
+	tagBuildTime         = 1006
+	tagBuildHost         = 1007
+	tagSize              = 1009
+	tagLicense           = 1014
+	tagGroup             = 1016
+	tagOS                = 1021
+	tagArch              = 1022
+	tagFileSizes         = 1028
+	tagFileModes         = 1030
+	tagFileRdevs         = 1033
+	tagFileMtimes        = 1034
+	tagFileDigests       = 1035
+	tagFileLinkTos       = 1036
+	tagFileFlags         = 1037
+	tagFileUserName      = 1039
+	tagFileGroupName     = 1040
+	tagSourceRPM         = 1044
+	tagFileVerifyFlags   = 1045
+	tagProvideName       = 1047
+	tagRequireFlags      = 1048
+	tagRequireName       = 1049
+	tagRequireVersion    = 1050
+	tagRPMVersion        = 1064
+	tagFileDevices       = 1095
+	tagFileInodes        = 1096
+	tagFileLangs         = 1097
+	tagProvideFlags      = 1112
+	tagProvideVersion    = 1113
+	tagDirIndexes        = 1116
+	tagBaseNames         = 1117
+	tagDirNames          = 1118
+	tagPayloadFormat     = 1124
+	tagPayloadCompressor = 1125
+	tagPayloadFlags      = 1126
+	tagFileDigestAlgo    = 5011
+	tagEncoding          = 5062
+	tagPayloadDigest     = 5092
+	tagPayloadDigestAlgo = 5093
+)
+
+var (
+	nameRe    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+._-]*$`)
+	versionRe = regexp.MustCompile(`^(?:[0-9]+:)?[A-Za-z0-9._+~^]+$`)
+	// archAliases maps the Debian names of architectures to RPM's.
+	archAliases = map[string]string{"amd64": "x86_64", "arm64": "aarch64", "all": "noarch"}
+	// leadArch holds the architecture numbers of the lead, which rpm
+	// no longer reads.
+	leadArch = map[string]uint16{"x86_64": 1, "i686": 1, "noarch": 1, "aarch64": 19}
+)
+
+// rpmOptions holds the settings the RPM generator reads from ports.Options.
+type rpmOptions struct {
+	name, version, release, arch string
+	modTime                      time.Time    // zero for the time of generation
+	filler                       utils.Filler // of the payload
+	rand                         *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (rpmOptions, error) {
+	o := rpmOptions{
+		name: opts.String("pkg-name", defaultName),
+		arch: opts.String("pkg-arch", defaultArch),
+	}
+	if !nameRe.MatchString(o.name) {
+		return o, fmt.Errorf("invalid package name %q: use letters, digits, '+', '-', '.' and '_'", o.name)
+	}
+	version := opts.String("pkg-version", defaultVersion)
+	o.version, o.release = version, "1"
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		o.version, o.release = version[:i], version[i+1:]
+	}
+	if !versionRe.MatchString(o.version) || !versionRe.MatchString(o.release) {
+		return o, fmt.Errorf("invalid package version %q: want version-release, e.g. %s", version, defaultVersion)
+	}
+	if alias, ok := archAliases[o.arch]; ok {
+		o.arch = alias
+	}
+	if !nameRe.MatchString(o.arch) {
+		return o, fmt.Errorf("invalid package architecture %q", o.arch)
+	}
+	var err error
+	if o.modTime, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	if o.filler, err = utils.ParseFiller(o.rand, opts.String("entropy", ""), opts.String("shared-blocks", ""), opts.String("shared-pool", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *RpmGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes an RPM package of exactly size bytes, up to
+// 4 GiB. The package is named "pkg-name" (genfile-fixture), at version
+// and release "pkg-version" (1.0.0-1) for architecture "pkg-arch"
+// (x86_64), and installs /usr/share/<name>/payload.bin. The signature
+// holds the SHA-1 and SHA-256 header digests rpm checks, and the header
+// the file and payload digests; the package is not signed. The "mtime"
+// option sets the build time and dates the file. "entropy" sets the share
+// of payload.bin that is random, the rest repeating a pattern;
+// "shared-blocks" copies a share of it from the "shared-pool" chunk pool.
+func (g *RpmGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.modTime.IsZero() {
+		o.modTime = time.Now()
+	}
+	o.modTime = o.modTime.UTC().Truncate(time.Second)
+	p, err := layout(o, size)
+	if err != nil {
+		return err
+	}
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	// The headers hold digests of the payload: it is written first, at
+	// its offset, and the headers before it once the digests are known.
+	payloadOffset := size - p.payloadSize
+	if _, err := f.Seek(payloadOffset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	bw := bufio.NewWriterSize(f, 1<<20)
+	payloadSum, fileSum := sha256.New(), sha256.New()
+	if err := p.writePayload(io.MultiWriter(bw, payloadSum), fileSum); err != nil {
+		return fmt.Errorf("failed to write payload: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	p.payloadDigest = hex.EncodeToString(payloadSum.Sum(nil))
+	p.fileDigest = hex.EncodeToString(fileSum.Sum(nil))
+
+	var head bytes.Buffer
+	head.Write(p.lead())
+	hdr := p.header()
+	head.Write(p.signature(hdr))
+	head.Write(hdr)
+	if int64(head.Len()) != payloadOffset {
+		return fmt.Errorf("package headers came out at %d bytes, want %d", head.Len(), payloadOffset)
+	}
+	if _, err := f.WriteAt(head.Bytes(), 0); err != nil {
+		return fmt.Errorf("failed to write package: %w", err)
+	}
+	return f.Sync()
+}
+
+// pkg is the layout of a package.
+type pkg struct {
+	o           rpmOptions
+	file        int64 // size of payload.bin
+	extra       int   // empty deflate blocks padding the payload
+	cpioSize    int64
+	payloadSize int64 // of the gzipped cpio archive
+	// Digests, zeros of the same length until they are known.
+	payloadDigest, fileDigest string
+}
+
+// layout sizes the payload of a package of exactly size bytes. The
+// headers have the same size whatever the payload.
+func layout(o rpmOptions, size int64) (pkg, error) {
+	p := pkg{o: o}
+	if size > maxSize {
+		return p, fmt.Errorf("target %d too large for an RPM package; the size tags hold up to %d bytes", size, int64(maxSize))
+	}
+	zero := strings.Repeat("0", 2*sha256.Size)
+	p.payloadDigest, p.fileDigest = zero, zero
+	hdr := p.header()
+	fixed := leadSize + int64(len(p.signature(hdr))) + int64(len(hdr))
+	base := int64(len(cpioHeader(p.fileName(), 0, 0, 0, 0, 0)) + len(cpioHeader(cpioTrailer, 0, 0, 0, 0, 1)))
+	var n int64
+	var extra int
+	ok := size >= fixed
+	if ok {
+		p.payloadSize = size - fixed
+		n, extra, ok = utils.FitStoredGzip(p.payloadSize, base, 4)
+	}
+	if !ok {
+		minimum := fixed + utils.StoredGzipSize(base+4*4, 0)
+		return p, fmt.Errorf("target %d too small for an RPM package; any size from %d bytes fits", size, minimum)
+	}
+	p.file, p.extra, p.cpioSize = n-base, extra, n
+	return p, nil
+}
+
+// fileName is the path of payload.bin in the cpio archive.
+func (p pkg) fileName() string {
+	return "./usr/share/" + p.o.name + "/payload.bin"
+}
+
+// writePayload writes the gzipped cpio archive to w, and payload.bin to
+// sum.
+func (p pkg) writePayload(w io.Writer, sum io.Writer) error {
+	gz := utils.NewStoredGzip(w, p.extra)
+	if _, err := gz.Write(cpioHeader(p.fileName(), 0o100644, uint32(p.file), p.o.modTime.Unix(), 1, 1)); err != nil {
+		return err
+	}
+	if err := p.o.filler.Write(p.o.rand, io.MultiWriter(gz, sum), p.file); err != nil {
+		return err
+	}
+	// The file is a whole number of 4-byte words, so needs no padding.
+	if _, err := gz.Write(cpioHeader(cpioTrailer, 0, 0, 0, 0, 1)); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// cpioHeader returns the newc cpio header of an entry, with its name,
+// padded to a 4-byte boundary.
+func cpioHeader(name string, mode, size uint32, mtime int64, ino, nlink uint32) []byte {
+	h := fmt.Sprintf("070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		ino, mode, 0, 0, nlink, uint32(mtime), size, 0, 0, 0, 0, len(name)+1, 0)
+	b := append([]byte(h+name), 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// nevr returns the package's name-version-release.
+func (p pkg) nevr() string {
+	return p.o.name + "-" + p.o.version + "-" + p.o.release
+}
+
+// lead returns the 96-byte lead of a binary package using header-style
+// signatures.
+func (p pkg) lead() []byte {
+	lead := make([]byte, leadSize)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+	binary.BigEndian.PutUint16(lead[6:], 0) // binary package
+	binary.BigEndian.PutUint16(lead[8:], leadArch[p.o.arch])
+	copy(lead[10:75], p.nevr())
+	binary.BigEndian.PutUint16(lead[76:], 1) // Linux
+	binary.BigEndian.PutUint16(lead[78:], 5) // header-style signature
+	return lead
+}
+
+// signature returns the signature header for hdr, padded to an 8-byte
+// boundary.
+func (p pkg) signature(hdr []byte) []byte {
+	var sig header
+	sum1, sum256 := sha1.Sum(hdr), sha256.Sum256(hdr)
+	sig.addString(sigTagSHA1, hex.EncodeToString(sum1[:]))
+	sig.addString(sigTagSHA256, hex.EncodeToString(sum256[:]))
+	sig.addInt32(sigTagSize, uint32(int64(len(hdr))+p.payloadSize))
+	sig.addInt32(sigTagPayloadSize, uint32(p.cpioSize))
+	b := sig.bytes(tagHeaderSignatures)
+	for len(b)%8 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// header returns the package header.
+func (p pkg) header() []byte {
+	var h header
+	o := p.o
+	evr := o.version + "-" + o.release
+	h.addStrings(tagI18NTable, "C")
+	h.addString(tagName, o.name)
+	h.addString(tagVersion, o.version)
+	h.addString(tagRelease, o.release)
+	h.addI18N(tagSummary, "Test fixture generated by genfile")
+	h.addI18N(tagDescription, "This package installs /usr/share/"+o.name+"/payload.bin,\na file of random data sized for load testing package repositories\nand tools.")
+	h.addInt32(tagBuildTime, uint32(o.modTime.Unix()))
+	h.addString(tagBuildHost, "genfile")
+	h.addInt32(tagSize, uint32(p.file))
+	h.addString(tagLicense, "MIT")
+	h.addI18N(tagGroup, "Unspecified")
+	h.addString(tagOS, "linux")
+	h.addString(tagArch, o.arch)
+	h.addString(tagSourceRPM, p.nevr()+".src.rpm")
+	h.addString(tagRPMVersion, "4.18.0")
+	h.addString(tagPayloadFormat, "cpio")
+	h.addString(tagPayloadCompressor, "gzip")
+	h.addString(tagPayloadFlags, "9")
+	h.addString(tagEncoding, "utf-8")
+	h.addStrings(tagPayloadDigest, p.payloadDigest)
+	h.addInt32(tagPayloadDigestAlgo, digestSHA256)
+
+	h.addStrings(tagProvideName, o.name)
+	h.addInt32(tagProvideFlags, senseEqual)
+	h.addStrings(tagProvideVersion, evr)
+	h.addStrings(tagRequireName, "rpmlib(CompressedFileNames)", "rpmlib(FileDigests)", "rpmlib(PayloadFilesHavePrefix)")
+	h.addInt32(tagRequireFlags, rpmlibDep, rpmlibDep, rpmlibDep)
+	h.addStrings(tagRequireVersion, "3.0.4-1", "4.6.0-1", "4.0-1")
+
+	h.addStrings(tagDirNames, "/usr/share/"+o.name+"/")
+	h.addInt32(tagDirIndexes, 0)
+	h.addStrings(tagBaseNames, "payload.bin")
+	h.addInt32(tagFileSizes, uint32(p.file))
+	h.addInt16(tagFileModes, 0o100644)
+	h.addInt16(tagFileRdevs, 0)
+	h.addInt32(tagFileMtimes, uint32(o.modTime.Unix()))
+	h.addStrings(tagFileDigests, p.fileDigest)
+	h.addInt32(tagFileDigestAlgo, digestSHA256)
+	h.addStrings(tagFileLinkTos, "")
+	h.addInt32(tagFileFlags, 0)
+	h.addStrings(tagFileUserName, "root")
+	h.addStrings(tagFileGroupName, "root")
+	h.addInt32(tagFileVerifyFlags, 0xffffffff)
+	h.addInt32(tagFileDevices, 1)
+	h.addInt32(tagFileInodes, 1)
+	h.addStrings(tagFileLangs, "")
+	return h.bytes(tagHeaderImmutable)
+}
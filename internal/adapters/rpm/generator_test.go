@@ -0,0 +1,181 @@
+package rpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestRpmGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name                            string
+		size                            int64
+		opts                            ports.Options
+		pkgName, version, release, arch string // want
+		errSub                          string
+	}{
+		{name: "Default", size: 1 << 20, pkgName: "genfile-fixture", version: "1.0.0", release: "1", arch: "x86_64"},
+		{name: "Odd", size: 100001, pkgName: "genfile-fixture", version: "1.0.0", release: "1", arch: "x86_64"},
+		{name: "Options", size: 50000, opts: ports.Options{"pkg-name": "Demo_pkg", "pkg-version": "3.1~rc1-4.el9", "pkg-arch": "arm64"}, pkgName: "Demo_pkg", version: "3.1~rc1", release: "4.el9", arch: "aarch64"},
+		{name: "TooSmall", size: 1000, errSub: "too small"},
+		{name: "TooLarge", size: 1 << 32, errSub: "too large"},
+		{name: "BadVersion", size: 10000, opts: ports.Options{"pkg-version": "1.0-"}, errSub: "invalid package version"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixture.rpm")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			if !bytes.HasPrefix(data, []byte{0xed, 0xab, 0xee, 0xdb}) {
+				t.Fatalf("missing lead magic: %x", data[:4])
+			}
+
+			sig, end := readHeader(t, data, leadSize)
+			start := end + (8-end%8)%8
+			hdr, end := readHeader(t, data, start)
+			sum := sha256.Sum256(data[start:end])
+			if got := sig.str(sigTagSHA256); got != hex.EncodeToString(sum[:]) {
+				t.Errorf("header SHA-256 = %s, want %x", got, sum)
+			}
+			if got := sig.int32(sigTagSize); int(got) != len(data)-start {
+				t.Errorf("signature size = %d, want %d", got, len(data)-start)
+			}
+			for tag, want := range map[uint32]string{tagName: tc.pkgName, tagVersion: tc.version, tagRelease: tc.release, tagArch: tc.arch} {
+				if got := hdr.str(tag); got != want {
+					t.Errorf("tag %d = %q, want %q", tag, got, want)
+				}
+			}
+
+			payload := data[end:]
+			sum = sha256.Sum256(payload)
+			if got := hdr.str(tagPayloadDigest); got != hex.EncodeToString(sum[:]) {
+				t.Errorf("payload digest = %s, want %x", got, sum)
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(payload))
+			if err != nil {
+				t.Fatalf("gzip.NewReader() error = %v", err)
+			}
+			cpio, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("decompressing payload: %v", err)
+			}
+			if got := sig.int32(sigTagPayloadSize); int(got) != len(cpio) {
+				t.Errorf("payload size = %d, want %d", got, len(cpio))
+			}
+			name, file := readCpio(t, cpio)
+			if want := "./usr/share/" + tc.pkgName + "/payload.bin"; name != want {
+				t.Errorf("cpio entry = %q, want %q", name, want)
+			}
+			sum = sha256.Sum256(file)
+			if got := hdr.str(tagFileDigests); got != hex.EncodeToString(sum[:]) {
+				t.Errorf("file digest = %s, want %x", got, sum)
+			}
+			if got := hdr.int32(tagFileSizes); int(got) != len(file) {
+				t.Errorf("file size = %d, want %d", got, len(file))
+			}
+		})
+	}
+}
+
+// parsedHeader is a header structure read back: its index and store.
+type parsedHeader struct {
+	t       *testing.T
+	entries map[uint32][3]uint32 // type, offset, count
+	store   []byte
+}
+
+// readHeader reads the header structure at off in data and returns it
+// with the offset of its end. It checks the region trailer.
+func readHeader(t *testing.T, data []byte, off int) (parsedHeader, int) {
+	t.Helper()
+	if !bytes.HasPrefix(data[off:], headerMagic) {
+		t.Fatalf("missing header magic at %d", off)
+	}
+	nindex := int(binary.BigEndian.Uint32(data[off+8:]))
+	size := int(binary.BigEndian.Uint32(data[off+12:]))
+	index := data[off+16 : off+16+16*nindex]
+	h := parsedHeader{t: t, entries: map[uint32][3]uint32{}, store: data[off+16+16*nindex : off+16+16*nindex+size]}
+	for i := 0; i < nindex; i++ {
+		e := index[16*i:]
+		h.entries[binary.BigEndian.Uint32(e)] = [3]uint32{binary.BigEndian.Uint32(e[4:]), binary.BigEndian.Uint32(e[8:]), binary.BigEndian.Uint32(e[12:])}
+	}
+	region := binary.BigEndian.Uint32(index)
+	trailer := h.store[binary.BigEndian.Uint32(index[8:]):]
+	if binary.BigEndian.Uint32(trailer) != region || int32(binary.BigEndian.Uint32(trailer[8:])) != int32(-16*nindex) {
+		t.Errorf("region %d trailer = %x, want it to span %d entries", region, trailer[:16], nindex)
+	}
+	return h, off + 16 + 16*nindex + size
+}
+
+// str returns the first string of a string or string array tag.
+func (h parsedHeader) str(tag uint32) string {
+	e, ok := h.entries[tag]
+	if !ok {
+		h.t.Errorf("missing tag %d", tag)
+		return ""
+	}
+	s := h.store[e[1]:]
+	return string(s[:bytes.IndexByte(s, 0)])
+}
+
+// int32 returns the first value of an INT32 tag.
+func (h parsedHeader) int32(tag uint32) uint32 {
+	e, ok := h.entries[tag]
+	if !ok || e[0] != typeInt32 || e[1]%4 != 0 {
+		h.t.Errorf("tag %d is not an aligned INT32: %v", tag, e)
+		return 0
+	}
+	return binary.BigEndian.Uint32(h.store[e[1]:])
+}
+
+// readCpio returns the first entry of the newc cpio archive in data, and
+// checks that the archive ends with the trailer.
+func readCpio(t *testing.T, data []byte) (string, []byte) {
+	t.Helper()
+	field := func(off, i int) int {
+		n, err := strconv.ParseUint(string(data[off+6+8*i:off+14+8*i]), 16, 32)
+		if err != nil {
+			t.Fatalf("bad cpio header field: %v", err)
+		}
+		return int(n)
+	}
+	if !bytes.HasPrefix(data, []byte("070701")) {
+		t.Fatalf("missing cpio magic: %q", data[:6])
+	}
+	size, nameSize := field(0, 6), field(0, 11)
+	name := string(data[110 : 110+nameSize-1])
+	off := (110 + nameSize + 3) &^ 3
+	file := data[off : off+size]
+	off = (off + size + 3) &^ 3
+	if got := string(data[off+110 : off+110+len(cpioTrailer)]); got != cpioTrailer {
+		t.Errorf("cpio trailer = %q", got)
+	}
+	return name, file
+}
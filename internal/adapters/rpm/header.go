@@ -0,0 +1,119 @@
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// Tag types of header entries.
+const (
+	typeInt16       = 3
+	typeInt32       = 4
+	typeString      = 6
+	typeBin         = 7
+	typeStringArray = 8
+	typeI18NString  = 9
+)
+
+// headerMagic starts every header structure: the magic number, the
+// version and four reserved bytes.
+var headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0}
+
+// entry is a tag of a header with its encoded value.
+type entry struct {
+	tag, typ, count uint32
+	data            []byte
+}
+
+// header builds an RPM header structure: an index of tags and the store
+// of their values.
+type header struct {
+	entries []entry
+}
+
+func (h *header) add(tag, typ, count uint32, data []byte) {
+	h.entries = append(h.entries, entry{tag: tag, typ: typ, count: count, data: data})
+}
+
+func (h *header) addString(tag uint32, s string) {
+	h.add(tag, typeString, 1, append([]byte(s), 0))
+}
+
+// addI18N adds a translatable string in the C locale only.
+func (h *header) addI18N(tag uint32, s string) {
+	h.add(tag, typeI18NString, 1, append([]byte(s), 0))
+}
+
+func (h *header) addStrings(tag uint32, ss ...string) {
+	var data []byte
+	for _, s := range ss {
+		data = append(append(data, s...), 0)
+	}
+	h.add(tag, typeStringArray, uint32(len(ss)), data)
+}
+
+func (h *header) addInt32(tag uint32, vs ...uint32) {
+	data := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(data[4*i:], v)
+	}
+	h.add(tag, typeInt32, uint32(len(vs)), data)
+}
+
+func (h *header) addInt16(tag uint32, vs ...uint16) {
+	data := make([]byte, 2*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint16(data[2*i:], v)
+	}
+	h.add(tag, typeInt16, uint32(len(vs)), data)
+}
+
+func (h *header) addBin(tag uint32, b []byte) {
+	h.add(tag, typeBin, uint32(len(b)), b)
+}
+
+// alignment returns the boundary values of type typ are stored on.
+func alignment(typ uint32) int {
+	switch typ {
+	case typeInt16:
+		return 2
+	case typeInt32:
+		return 4
+	}
+	return 1
+}
+
+// bytes encodes the header as one immutable region tagged region, as rpm
+// writes them: the region's entry comes first in the index and its
+// trailer, pointing back over the whole index, last in the store.
+func (h *header) bytes(region uint32) []byte {
+	entries := append([]entry(nil), h.entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	var index, store bytes.Buffer
+	writeEntry := func(tag, typ uint32, offset int32, count uint32) {
+		binary.Write(&index, binary.BigEndian, [4]uint32{tag, typ, uint32(offset), count})
+	}
+	nindex := len(entries) + 1
+	offsets := make([]int, len(entries))
+	for i, e := range entries {
+		for store.Len()%alignment(e.typ) != 0 {
+			store.WriteByte(0)
+		}
+		offsets[i] = store.Len()
+		store.Write(e.data)
+	}
+	writeEntry(region, typeBin, int32(store.Len()), 16)
+	for i, e := range entries {
+		writeEntry(e.tag, e.typ, int32(offsets[i]), e.count)
+	}
+	binary.Write(&store, binary.BigEndian, [4]uint32{region, typeBin, uint32(int32(-16 * nindex)), 16})
+
+	var out bytes.Buffer
+	out.Write(headerMagic)
+	binary.Write(&out, binary.BigEndian, [2]uint32{uint32(nindex), uint32(store.Len())})
+	out.Write(index.Bytes())
+	out.Write(store.Bytes())
+	return out.Bytes()
+}
@@ -0,0 +1,68 @@
+package shp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// dbfField describes one column of the dBASE III attribute table.
+type dbfField struct {
+	name     string
+	typ      byte // C character, N numeric, D date
+	length   int
+	decimals int
+}
+
+// dbfFields are the attribute columns, one row per shape.
+var dbfFields = []dbfField{
+	{"ID", 'N', 9, 0},
+	{"NAME", 'C', 24, 0},
+	{"VALUE", 'N', 12, 2},
+	{"CREATED", 'D', 8, 0},
+}
+
+const (
+	// dbfHeaderSize is the file header, the field descriptors and their
+	// terminator.
+	dbfHeaderSize = 32 + 32*4 + 1
+	// dbfRecordSize is the deletion flag plus the field widths.
+	dbfRecordSize = 1 + 9 + 24 + 12 + 8
+	dbfEOF        = 0x1A
+)
+
+// dbfHeader returns the table header for records rows, last updated on
+// modified.
+func dbfHeader(records int, modified time.Time) []byte {
+	h := make([]byte, 32, dbfHeaderSize)
+	h[0] = 0x03 // dBASE III without memo
+	h[1], h[2], h[3] = byte(modified.Year()-1900), byte(modified.Month()), byte(modified.Day())
+	binary.LittleEndian.PutUint32(h[4:], uint32(records))
+	binary.LittleEndian.PutUint16(h[8:], dbfHeaderSize)
+	binary.LittleEndian.PutUint16(h[10:], dbfRecordSize)
+	for _, f := range dbfFields {
+		d := make([]byte, 32)
+		copy(d, f.name) // NUL-padded to 11 bytes
+		d[11] = f.typ
+		d[16], d[17] = byte(f.length), byte(f.decimals)
+		h = append(h, d...)
+	}
+	return append(h, 0x0D)
+}
+
+// dbfRecord returns the attribute row of record number n, with values
+// drawn from r.
+func dbfRecord(r *utils.Rand, n int) []byte {
+	day := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, r.IntN(27*365))
+	name := utils.LoremWords[r.IntN(len(utils.LoremWords))]
+	values := []string{
+		fmt.Sprintf("%9d", n),
+		fmt.Sprintf("%-24s", strings.ToUpper(name[:1])+name[1:]+fmt.Sprintf(" %d", r.IntN(1000))),
+		fmt.Sprintf("%12.2f", r.Float64()*1e6),
+		day.Format("20060102"),
+	}
+	return []byte(" " + strings.Join(values, "")) // not deleted
+}
@@ -0,0 +1,402 @@
+package shp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeSHP, New())
+}
+
+// ShpGenerator writes ESRI shapefile sets: the .shp geometry file at the
+// requested size, plus its .shx index and .dbf attribute table.
+type ShpGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &ShpGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *ShpGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *ShpGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// SizeStep returns 2: shapefiles record their lengths in 16-bit words.
+func (g *ShpGenerator) SizeStep() int64 {
+	return 2
+}
+
+// Geometry kinds.
+const (
+	GeometryPoint    = "point"
+	GeometryPolyline = "polyline"
+	GeometryPolygon  = "polygon"
+)
+
+// Shape types as stored in the files.
+const (
+	shapeNull     int32 = 0
+	shapePoint    int32 = 1
+	shapePolyline int32 = 3
+	shapePolygon  int32 = 5
+)
+
+const (
+	// headerSize is the size of the .shp and .shx file headers.
+	headerSize = 100
+	// recordHeaderSize is the record number and content length that
+	// precede every record.
+	recordHeaderSize = 8
+	// nullRecordSize is a record holding a null shape.
+	nullRecordSize = recordHeaderSize + 4
+	// maxPoints is the most points in a random line or ring.
+	maxPoints = 32
+)
+
+// shpOptions holds the settings the SHP generator reads from ports.Options.
+type shpOptions struct {
+	shapeType int32
+	modified  time.Time   // .dbf last-update date; zero for today
+	rand      *utils.Rand // of the geometries and attributes
+}
+
+func parseOptions(opts ports.Options) (shpOptions, error) {
+	var o shpOptions
+	switch g := strings.ToLower(opts.String("shp-geometry", GeometryPolygon)); g {
+	case GeometryPoint:
+		o.shapeType = shapePoint
+	case GeometryPolyline:
+		o.shapeType = shapePolyline
+	case GeometryPolygon:
+		o.shapeType = shapePolygon
+	default:
+		return o, fmt.Errorf("unknown shp geometry %q (want point, polyline or polygon)", g)
+	}
+	var err error
+	if o.modified, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// minRecordSize returns the size of the smallest record of shape type t
+// that holds a real geometry.
+func minRecordSize(t int32) int {
+	switch t {
+	case shapePoint:
+		return recordHeaderSize + 20
+	case shapePolyline:
+		return recordHeaderSize + 48 + 16*2
+	default:
+		return recordHeaderSize + 48 + 16*4
+	}
+}
+
+// companions returns the .shx and .dbf paths that belong to the .shp at
+// path.
+func companions(path string) []string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return []string{base + ".shx", base + ".dbf"}
+}
+
+func (g *ShpGenerator) Generate(path string, size int64) error {
+	_, err := g.GenerateSetWithOptions(path, size, nil)
+	return err
+}
+
+func (g *ShpGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	_, err := g.GenerateSetWithOptions(path, size, opts)
+	return err
+}
+
+func (g *ShpGenerator) GenerateSet(path string, size int64) ([]string, error) {
+	return g.GenerateSetWithOptions(path, size, nil)
+}
+
+// GenerateSetWithOptions writes a .shp of exactly size bytes holding
+// random polygons, or the geometry chosen by "shp-geometry", around the
+// world. The .shx indexes every record and the .dbf holds one attribute
+// row per record, so both grow with the .shp. Shapefile lengths are
+// counted in 16-bit words, so size must be even; the last record takes up
+// the bytes left over, padded after its geometry if needed.
+func (g *ShpGenerator) GenerateSetWithOptions(path string, size int64, opts ports.Options) ([]string, error) {
+	opts = g.opts.With(opts)
+	paths := append([]string{path}, companions(path)...)
+	return paths, g.generate(paths, size, opts)
+}
+
+func (g *ShpGenerator) generate(paths []string, size int64, opts ports.Options) error {
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if size%2 != 0 {
+		return fmt.Errorf("shapefile size %d is not a whole number of 16-bit words", size)
+	}
+	if size/2 > math.MaxInt32 {
+		return fmt.Errorf("shapefile size %d exceeds the format's limit of %d bytes", size, int64(math.MaxInt32)*2)
+	}
+	if size < headerSize || size > headerSize && size < headerSize+nullRecordSize {
+		return fmt.Errorf("target %d too small for a shapefile; need %d bytes, or at least %d with a record", size, headerSize, headerSize+nullRecordSize)
+	}
+
+	files := make([]ports.OutputFile, 0, len(paths))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, p := range paths {
+		f, err := outputfs.Create(g.fs, p)
+		if err != nil {
+			return fmt.Errorf("failed to create file %s: %w", p, err)
+		}
+		files = append(files, f)
+	}
+	shp, shx, dbf := files[0], files[1], files[2]
+
+	// The headers hold totals known only at the end; they are written
+	// last, over these placeholders.
+	shpW, shxW, dbfW := bufio.NewWriter(shp), bufio.NewWriter(shx), bufio.NewWriter(dbf)
+	shpW.Write(make([]byte, headerSize))
+	shxW.Write(make([]byte, headerSize))
+	dbfW.Write(make([]byte, dbfHeaderSize))
+
+	b := newBounds()
+	records := 0
+	offset := int64(headerSize)
+	write := func(rec []byte) error {
+		records++
+		binary.BigEndian.PutUint32(rec[0:], uint32(records))
+		binary.BigEndian.PutUint32(rec[4:], uint32((len(rec)-recordHeaderSize)/2))
+		if _, err := shpW.Write(rec); err != nil {
+			return fmt.Errorf("failed to write shapefile record: %w", err)
+		}
+		var idx [8]byte
+		binary.BigEndian.PutUint32(idx[0:], uint32(offset/2))
+		binary.BigEndian.PutUint32(idx[4:], uint32((len(rec)-recordHeaderSize)/2))
+		if _, err := shxW.Write(idx[:]); err != nil {
+			return fmt.Errorf("failed to write shapefile index: %w", err)
+		}
+		if _, err := dbfW.Write(dbfRecord(o.rand, records)); err != nil {
+			return fmt.Errorf("failed to write shapefile attributes: %w", err)
+		}
+		offset += int64(len(rec))
+		return nil
+	}
+
+	// Random records are added while a real geometry still fits after
+	// them; the last record is sized to the remaining bytes.
+	minTail := int64(minRecordSize(o.shapeType))
+	for size-offset > 0 {
+		rec := randomRecord(o.rand, o.shapeType, b)
+		if size-offset-int64(len(rec)) < minTail {
+			break
+		}
+		if err := write(rec); err != nil {
+			return err
+		}
+	}
+	if rest := size - offset; rest > 0 {
+		if err := write(fitRecord(o.rand, o.shapeType, int(rest), b)); err != nil {
+			return err
+		}
+	}
+	dbfW.WriteByte(dbfEOF)
+
+	for _, w := range []*bufio.Writer{shpW, shxW, dbfW} {
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to write shapefile: %w", err)
+		}
+	}
+	if _, err := shp.WriteAt(fileHeader(size, o.shapeType, b), 0); err != nil {
+		return fmt.Errorf("failed to write shapefile header: %w", err)
+	}
+	if _, err := shx.WriteAt(fileHeader(headerSize+8*int64(records), o.shapeType, b), 0); err != nil {
+		return fmt.Errorf("failed to write shapefile index header: %w", err)
+	}
+	modified := o.modified
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	if _, err := dbf.WriteAt(dbfHeader(records, modified), 0); err != nil {
+		return fmt.Errorf("failed to write shapefile attribute header: %w", err)
+	}
+	for _, f := range files {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bounds is a bounding box grown point by point.
+type bounds struct {
+	minX, minY, maxX, maxY float64
+}
+
+func newBounds() *bounds {
+	return &bounds{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+}
+
+func (b *bounds) add(p [2]float64) {
+	b.minX, b.maxX = min(b.minX, p[0]), max(b.maxX, p[0])
+	b.minY, b.maxY = min(b.minY, p[1]), max(b.maxY, p[1])
+}
+
+// box returns Xmin, Ymin, Xmax, Ymax, all zero if nothing was added.
+func (b *bounds) box() [4]float64 {
+	if b.minX > b.maxX {
+		return [4]float64{}
+	}
+	return [4]float64{b.minX, b.minY, b.maxX, b.maxY}
+}
+
+// fileHeader returns the 100-byte header shared by .shp and .shx.
+func fileHeader(length int64, shapeType int32, b *bounds) []byte {
+	h := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(h[0:], 9994) // file code
+	binary.BigEndian.PutUint32(h[24:], uint32(length/2))
+	binary.LittleEndian.PutUint32(h[28:], 1000) // version
+	binary.LittleEndian.PutUint32(h[32:], uint32(shapeType))
+	for i, v := range b.box() {
+		binary.LittleEndian.PutUint64(h[36+8*i:], math.Float64bits(v))
+	}
+	return h // Z and M ranges stay zero
+}
+
+// randomRecord returns a record of shape type t with a geometry drawn
+// from r and a blank record header.
+func randomRecord(r *utils.Rand, t int32, b *bounds) []byte {
+	switch t {
+	case shapePoint:
+		return pointRecord(randomCenter(r), 0, b)
+	case shapePolyline:
+		return polyRecord(t, randomLine(r, 2+r.IntN(maxPoints-1)), 0, b)
+	default:
+		return polyRecord(t, randomRing(r, 4+r.IntN(maxPoints-3)), 0, b)
+	}
+}
+
+// fitRecord returns a record of exactly n bytes: the largest geometry of
+// shape type t that fits, or a null shape, padded with zeros.
+func fitRecord(r *utils.Rand, t int32, n int, b *bounds) []byte {
+	if n < minRecordSize(t) {
+		return append(nullRecord(), make([]byte, n-nullRecordSize)...)
+	}
+	if t == shapePoint {
+		return pointRecord(randomCenter(r), n-minRecordSize(t), b)
+	}
+	points := (n - recordHeaderSize - 48) / 16
+	pad := n - recordHeaderSize - 48 - 16*points
+	if t == shapePolyline {
+		return polyRecord(t, randomLine(r, points), pad, b)
+	}
+	return polyRecord(t, randomRing(r, points), pad, b)
+}
+
+func nullRecord() []byte {
+	rec := make([]byte, nullRecordSize)
+	binary.LittleEndian.PutUint32(rec[recordHeaderSize:], uint32(shapeNull))
+	return rec
+}
+
+func pointRecord(p [2]float64, pad int, b *bounds) []byte {
+	b.add(p)
+	rec := make([]byte, recordHeaderSize, recordHeaderSize+20+pad)
+	rec = binary.LittleEndian.AppendUint32(rec, uint32(shapePoint))
+	rec = binary.LittleEndian.AppendUint64(rec, math.Float64bits(p[0]))
+	rec = binary.LittleEndian.AppendUint64(rec, math.Float64bits(p[1]))
+	return append(rec, make([]byte, pad)...)
+}
+
+// polyRecord returns a single-part polyline or polygon record.
+func polyRecord(t int32, points [][2]float64, pad int, b *bounds) []byte {
+	own := newBounds()
+	for _, p := range points {
+		own.add(p)
+		b.add(p)
+	}
+	rec := make([]byte, recordHeaderSize, recordHeaderSize+48+16*len(points)+pad)
+	rec = binary.LittleEndian.AppendUint32(rec, uint32(t))
+	for _, v := range own.box() {
+		rec = binary.LittleEndian.AppendUint64(rec, math.Float64bits(v))
+	}
+	rec = binary.LittleEndian.AppendUint32(rec, 1) // parts
+	rec = binary.LittleEndian.AppendUint32(rec, uint32(len(points)))
+	rec = binary.LittleEndian.AppendUint32(rec, 0) // the part starts at point 0
+	for _, p := range points {
+		rec = binary.LittleEndian.AppendUint64(rec, math.Float64bits(p[0]))
+		rec = binary.LittleEndian.AppendUint64(rec, math.Float64bits(p[1]))
+	}
+	return append(rec, make([]byte, pad)...)
+}
+
+// randomCenter returns a longitude and latitude away from the poles.
+func randomCenter(r *utils.Rand) [2]float64 {
+	return [2]float64{r.Float64()*360 - 180, r.Float64()*160 - 80}
+}
+
+// randomLine returns a random walk of n points.
+func randomLine(r *utils.Rand, n int) [][2]float64 {
+	points := make([][2]float64, n)
+	points[0] = randomCenter(r)
+	for i := 1; i < n; i++ {
+		points[i] = [2]float64{
+			clamp(points[i-1][0]+r.Float64()*0.2-0.1, -180, 180),
+			clamp(points[i-1][1]+r.Float64()*0.2-0.1, -90, 90),
+		}
+	}
+	return points
+}
+
+// randomRing returns a closed ring of n points (the last repeats the
+// first) around a random center, in the clockwise order shapefiles use
+// for outer rings.
+func randomRing(r *utils.Rand, n int) [][2]float64 {
+	c := randomCenter(r)
+	points := make([][2]float64, n)
+	for i := 0; i < n-1; i++ {
+		a := -2 * math.Pi * float64(i) / float64(n-1)
+		rad := 0.05 + r.Float64()*0.2
+		points[i] = [2]float64{clamp(c[0]+rad*math.Cos(a), -180, 180), c[1] + rad*math.Sin(a)}
+	}
+	points[n-1] = points[0]
+	return points
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return min(max(v, lo), hi)
+}
@@ -0,0 +1,200 @@
+package shp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestShpGenerator_Generate(t *testing.T) {
+	generator := New()
+	var _ ports.SetOptionsGenerator = generator.(*ShpGenerator)
+
+	testCases := []struct {
+		name   string
+		size   int64
+		opts   ports.Options
+		errSub string
+	}{
+		{name: "HeaderOnly", size: 100},
+		{name: "NullRecord", size: 112},
+		{name: "PointTail", size: 128, opts: ports.Options{"shp-geometry": "point"}},
+		{name: "Points", size: 1000, opts: ports.Options{"shp-geometry": "point"}},
+		{name: "Polylines", size: 1000, opts: ports.Options{"shp-geometry": "polyline"}},
+		{name: "Polygons", size: 1000},
+		{name: "PolygonsLarge", size: 64 * 1024, opts: ports.Options{"shp-geometry": "Polygon"}},
+		{name: "PolylinesLarge", size: 1024 * 1024, opts: ports.Options{"shp-geometry": "polyline"}},
+		{name: "Odd", size: 1001, errSub: "16-bit words"},
+		{name: "TooSmall", size: 50, errSub: "too small"},
+		{name: "NoRoomForRecord", size: 104, errSub: "too small"},
+		{name: "UnknownGeometry", size: 1000, opts: ports.Options{"shp-geometry": "multipatch"}, errSub: "unknown shp geometry"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.shp")
+			paths, err := generator.(ports.SetOptionsGenerator).GenerateSetWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateSetWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateSetWithOptions() unexpected error = %v", err)
+			}
+			base := strings.TrimSuffix(path, ".shp")
+			if want := []string{path, base + ".shx", base + ".dbf"}; !slices.Equal(paths, want) {
+				t.Errorf("GenerateSetWithOptions() paths = %v, want %v", paths, want)
+			}
+			checkShapefile(t, path, tc.size)
+		})
+	}
+}
+
+func TestShpGenerator_MTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.shp")
+	opts := ports.Options{"mtime": "2020-03-04T00:00:00Z"}
+	if err := New().(ports.OptionsGenerator).GenerateWithOptions(path, 1000, opts); err != nil {
+		t.Fatal(err)
+	}
+	dbf, err := os.ReadFile(strings.TrimSuffix(path, ".shp") + ".dbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := [3]byte(dbf[1:4]); got != [3]byte{120, 3, 4} {
+		t.Errorf("dbf last update = %v, want 2020-03-04", got)
+	}
+}
+
+// checkShapefile walks the .shp records and checks the .shx index and
+// .dbf rows agree with them.
+func checkShapefile(t *testing.T, path string, size int64) {
+	t.Helper()
+	shp, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(shp)) != size {
+		t.Fatalf("shp size = %d, want %d", len(shp), size)
+	}
+	checkHeader(t, "shp", shp)
+
+	var offsets, lengths []int
+	for off := headerSize; off < len(shp); {
+		if off+nullRecordSize > len(shp) {
+			t.Fatalf("record %d at %d is truncated", len(offsets)+1, off)
+		}
+		if n := int(binary.BigEndian.Uint32(shp[off:])); n != len(offsets)+1 {
+			t.Fatalf("record at %d has number %d, want %d", off, n, len(offsets)+1)
+		}
+		length := 2 * int(binary.BigEndian.Uint32(shp[off+4:]))
+		rec := shp[off+recordHeaderSize : off+recordHeaderSize+length]
+		checkRecord(t, int32(binary.LittleEndian.Uint32(shp[32:])), rec)
+		offsets, lengths = append(offsets, off), append(lengths, length)
+		off += recordHeaderSize + length
+	}
+
+	base := strings.TrimSuffix(path, ".shp")
+	shx, err := os.ReadFile(base + ".shx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shx) != headerSize+8*len(offsets) {
+		t.Fatalf("shx size = %d, want %d for %d records", len(shx), headerSize+8*len(offsets), len(offsets))
+	}
+	checkHeader(t, "shx", shx)
+	if string(shx[32:100]) != string(shp[32:100]) {
+		t.Error("shx header shape type or bounds differ from the shp")
+	}
+	for i := range offsets {
+		off := 2 * int(binary.BigEndian.Uint32(shx[headerSize+8*i:]))
+		length := 2 * int(binary.BigEndian.Uint32(shx[headerSize+8*i+4:]))
+		if off != offsets[i] || length != lengths[i] {
+			t.Fatalf("shx entry %d = (%d, %d), want (%d, %d)", i, off, length, offsets[i], lengths[i])
+		}
+	}
+
+	dbf, err := os.ReadFile(base + ".dbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbf[0] != 0x03 {
+		t.Errorf("dbf version = %#x, want 0x03", dbf[0])
+	}
+	records := int(binary.LittleEndian.Uint32(dbf[4:]))
+	hdr, recSize := int(binary.LittleEndian.Uint16(dbf[8:])), int(binary.LittleEndian.Uint16(dbf[10:]))
+	if records != len(offsets) || hdr != dbfHeaderSize || recSize != dbfRecordSize {
+		t.Fatalf("dbf header: %d records of %d bytes after %d, want %d of %d after %d", records, recSize, hdr, len(offsets), dbfRecordSize, dbfHeaderSize)
+	}
+	if len(dbf) != hdr+records*recSize+1 || dbf[len(dbf)-1] != dbfEOF {
+		t.Fatalf("dbf size = %d, want %d ending in 0x1A", len(dbf), hdr+records*recSize+1)
+	}
+	if dbf[hdr-1] != 0x0D {
+		t.Error("dbf field descriptors are not terminated")
+	}
+	for i := 0; i < records; i++ {
+		row := string(dbf[hdr+i*recSize : hdr+(i+1)*recSize])
+		if id := strings.TrimSpace(row[1:10]); row[0] != ' ' || id != fmt.Sprint(i+1) {
+			t.Fatalf("dbf row %d = %q", i, row)
+		}
+		if _, err := time.Parse("20060102", row[recSize-8:]); err != nil {
+			t.Fatalf("dbf row %d date: %v", i, err)
+		}
+	}
+}
+
+func checkHeader(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if code := binary.BigEndian.Uint32(data); code != 9994 {
+		t.Errorf("%s file code = %d, want 9994", name, code)
+	}
+	if length := 2 * int(binary.BigEndian.Uint32(data[24:])); length != len(data) {
+		t.Errorf("%s header length = %d, want %d", name, length, len(data))
+	}
+	if v := binary.LittleEndian.Uint32(data[28:]); v != 1000 {
+		t.Errorf("%s version = %d, want 1000", name, v)
+	}
+	for i := 0; i < 4; i++ {
+		v := math.Float64frombits(binary.LittleEndian.Uint64(data[36+8*i:]))
+		if v < -180 || v > 180 {
+			t.Errorf("%s bounding box value %d = %v", name, i, v)
+		}
+	}
+}
+
+// checkRecord checks a record's content is a null shape or a geometry of
+// shape type want, with any padding after it.
+func checkRecord(t *testing.T, want int32, rec []byte) {
+	t.Helper()
+	got := int32(binary.LittleEndian.Uint32(rec))
+	switch {
+	case got == shapeNull:
+		return
+	case got != want:
+		t.Fatalf("record shape type = %d, want %d", got, want)
+	case got == shapePoint:
+		if len(rec) < 20 {
+			t.Fatalf("point record of %d bytes", len(rec))
+		}
+		return
+	}
+	parts := int(binary.LittleEndian.Uint32(rec[36:]))
+	points := int(binary.LittleEndian.Uint32(rec[40:]))
+	if parts != 1 || len(rec) < 44+4*parts+16*points {
+		t.Fatalf("record has %d parts and %d points in %d bytes", parts, points, len(rec))
+	}
+	if got == shapePolygon {
+		first, last := rec[48:64], rec[48+16*(points-1):48+16*points]
+		if points < 4 || string(first) != string(last) {
+			t.Fatalf("polygon ring of %d points is not closed", points)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	for _, t := range []ports.FileType{ports.FileTypeSRT, ports.FileTypeVTT} {
+		factory.RegisterGenerator(t, &SubtitleGenerator{fileType: t})
+	}
+}
+
+// SubtitleGenerator writes subtitle files of numbered, timed cues of
+// random text: SubRip (.srt) or WebVTT (.vtt).
+type SubtitleGenerator struct {
+	opts     ports.Options // set by Configure
+	fileType ports.FileType
+	fs       ports.OutputFS // set by WithOutputFS
+}
+
+// New returns a generator of SubRip files.
+func New() ports.FileGenerator {
+	return &SubtitleGenerator{fileType: ports.FileTypeSRT}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *SubtitleGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *SubtitleGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	// vttHeader opens every WebVTT file, followed by a blank line.
+	vttHeader = "WEBVTT\n\n"
+	// lineLen is the longest line of cue text, about what fits across a
+	// screen.
+	lineLen = 42
+)
+
+// subtitleOptions holds the settings the subtitle generator reads from
+// ports.Options.
+type subtitleOptions struct {
+	lang *utils.Language
+	rand *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (subtitleOptions, error) {
+	var o subtitleOptions
+	var err error
+	if o.lang, err = utils.TextLanguage(opts.String("lang", ""), opts.String("corpus", "")); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *SubtitleGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+func (g *SubtitleGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := g.GenerateTo(f, size, opts); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// GenerateTo writes exactly size bytes of subtitles to w: cues numbered
+// from 1, each shown for one to five seconds after a pause of up to one,
+// holding a line or two of random text, or of text in the language of the
+// "lang" option or from the "corpus" files. The last cue's text makes up the size, in as many lines
+// as it takes.
+func (g *SubtitleGenerator) GenerateTo(w io.Writer, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	header := ""
+	if g.fileType == ports.FileTypeVTT {
+		header = vttHeader
+	}
+	start, end := o.nextTiming(0)
+	head := g.cueHead(1, start, end)
+	if need := int64(len(header) + len(head) + 2); size < need {
+		return fmt.Errorf("target %d too small for a %s file; need at least %d bytes", size, strings.ToUpper(string(g.fileType)), need)
+	}
+
+	bw := bufio.NewWriter(w)
+	write := func(s string) error {
+		if _, err := bw.WriteString(s); err != nil {
+			return fmt.Errorf("failed to write subtitles: %w", err)
+		}
+		return nil
+	}
+	if err := write(header); err != nil {
+		return err
+	}
+	remaining := size - int64(len(header))
+	// A cue is written while the next one still fits after it with a
+	// character of text; that one takes what is left.
+	for n := 1; ; n++ {
+		cue := head + o.cueText() + "\n\n"
+		start, end = o.nextTiming(end)
+		next := g.cueHead(n+1, start, end)
+		if remaining-int64(len(cue)) < int64(len(next)+2) {
+			break
+		}
+		if err := write(cue); err != nil {
+			return err
+		}
+		remaining -= int64(len(cue))
+		head = next
+	}
+	if err := write(head + o.fill(int(remaining)-len(head)-1) + "\n"); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write subtitles: %w", err)
+	}
+	return nil
+}
+
+// nextTiming returns the start and end of a cue following one that ends
+// at prev.
+func (o subtitleOptions) nextTiming(prev time.Duration) (start, end time.Duration) {
+	start = prev + time.Duration(o.rand.IntN(1000))*time.Millisecond
+	return start, start + time.Duration(1000+o.rand.IntN(4000))*time.Millisecond
+}
+
+// cueHead returns the number and timing lines of cue n.
+func (g *SubtitleGenerator) cueHead(n int, start, end time.Duration) string {
+	return fmt.Sprintf("%d\n%s --> %s\n", n, g.timestamp(start), g.timestamp(end))
+}
+
+// timestamp formats d as hh:mm:ss,ttt for SubRip or hh:mm:ss.ttt for
+// WebVTT. Hours run past 99 with more digits.
+func (g *SubtitleGenerator) timestamp(d time.Duration) string {
+	sep := ","
+	if g.fileType == ports.FileTypeVTT {
+		sep = "."
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, sep, ms%1000)
+}
+
+// cueText returns one or two lines of text, without a final line end.
+func (o subtitleOptions) cueText() string {
+	lines := make([]string, 1+o.rand.IntN(2))
+	for i := range lines {
+		lines[i] = o.line(lineLen)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// line returns a sentence of at most n bytes.
+func (o subtitleOptions) line(n int) string {
+	if s := strings.TrimRight(utils.FitUTF8(o.lang.Sentence(o.rand, 2, 8), n), " "); s != "" {
+		return s
+	}
+	return strings.TrimRight(utils.FitUTF8(utils.Lorem.Sentence(o.rand, 2, 8), n), " ")
+}
+
+// fill returns exactly n bytes of text, n at least 1, in lines of at most
+// lineLen bytes, none of them empty, without a final line end.
+func (o subtitleOptions) fill(n int) string {
+	var b strings.Builder
+	for n > 0 {
+		l := min(n, lineLen)
+		// A line end must leave room for another character.
+		if rest := n - l; rest > 0 && rest < 2 {
+			l = n - 2
+		}
+		b.WriteString(o.text(l))
+		if n -= l; n > 0 {
+			b.WriteString("\n")
+			n--
+		}
+	}
+	return b.String()
+}
+
+// text returns n bytes of words for a line. A word of the language too
+// long for a short line would leave it blank, which ends a cue, so such a
+// line is lorem ipsum instead.
+func (o subtitleOptions) text(n int) string {
+	if s := o.lang.Text(o.rand, n); strings.TrimSpace(s) != "" {
+		return s
+	}
+	return utils.Lorem.Text(o.rand, n)
+}
@@ -0,0 +1,153 @@
+package subtitle
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestSubtitleGenerator_Generate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fileType ports.FileType
+		size     int64
+		opts     ports.Options
+		errSub   string
+	}{
+		{name: "SRT", fileType: ports.FileTypeSRT, size: 64 * 1024},
+		{name: "VTT", fileType: ports.FileTypeVTT, size: 64*1024 + 1},
+		{name: "SmallestSRT", fileType: ports.FileTypeSRT, size: 34},
+		{name: "SmallestVTT", fileType: ports.FileTypeVTT, size: 42},
+		{name: "Chinese", fileType: ports.FileTypeVTT, size: 10000, opts: ports.Options{"lang": "zh"}},
+		{name: "Emoji", fileType: ports.FileTypeSRT, size: 10000, opts: ports.Options{"lang": "emoji"}},
+		{name: "TooSmall", fileType: ports.FileTypeSRT, size: 33, errSub: "too small"},
+		{name: "BadLang", fileType: ports.FileTypeVTT, size: 4096, opts: ports.Options{"lang": "xx"}, errSub: "lang"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			generator := &SubtitleGenerator{fileType: tc.fileType}
+			path := filepath.Join(t.TempDir(), "subs."+string(tc.fileType))
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			checkSubtitles(t, string(data), tc.fileType)
+		})
+	}
+}
+
+func TestSubtitleGenerator_Sizes(t *testing.T) {
+	// Every size from the smallest file up reaches its target.
+	dir := t.TempDir()
+	for _, ft := range []ports.FileType{ports.FileTypeSRT, ports.FileTypeVTT} {
+		generator := &SubtitleGenerator{fileType: ft}
+		for size := int64(42); size < 2000; size++ {
+			path := filepath.Join(dir, "subs."+string(ft))
+			if err := generator.Generate(path, size); err != nil {
+				t.Fatalf("%s, %d bytes: %v", ft, size, err)
+			}
+			data, _ := os.ReadFile(path)
+			if int64(len(data)) != size {
+				t.Fatalf("%s, %d bytes came out as %d", ft, size, len(data))
+			}
+			checkSubtitles(t, string(data), ft)
+		}
+	}
+}
+
+func TestSubtitleGenerator_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New().(ports.StreamGenerator).GenerateTo(&buf, 10000, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 10000 {
+		t.Fatalf("streamed %d bytes, want 10000", buf.Len())
+	}
+	checkSubtitles(t, buf.String(), ports.FileTypeSRT)
+}
+
+func TestTimestamp(t *testing.T) {
+	d := 123*time.Hour + 4*time.Minute + 5*time.Second + 67*time.Millisecond
+	if got := (&SubtitleGenerator{fileType: ports.FileTypeSRT}).timestamp(d); got != "123:04:05,067" {
+		t.Errorf("SRT timestamp = %s", got)
+	}
+	if got := (&SubtitleGenerator{fileType: ports.FileTypeVTT}).timestamp(time.Second / 2); got != "00:00:00.500" {
+		t.Errorf("VTT timestamp = %s", got)
+	}
+}
+
+// checkSubtitles checks data is a subtitle file of cues numbered from 1,
+// each with a timing line that starts no earlier than the previous cue
+// ends and one or more lines of text, none longer than lineLen bytes.
+func checkSubtitles(t *testing.T, data string, ft ports.FileType) {
+	t.Helper()
+	if !utf8.ValidString(data) {
+		t.Fatal("subtitles are not valid UTF-8")
+	}
+	if ft == ports.FileTypeVTT {
+		if !strings.HasPrefix(data, vttHeader) {
+			t.Fatalf("file starts %q, want %q", data[:min(len(data), 10)], vttHeader)
+		}
+		data = data[len(vttHeader):]
+	}
+	if !strings.HasSuffix(data, "\n") || strings.HasSuffix(data, "\n\n") {
+		t.Fatal("last cue does not end in a single line end")
+	}
+	sep := ","
+	if ft == ports.FileTypeVTT {
+		sep = `\.`
+	}
+	timing := regexp.MustCompile(`^(\d{2,}):(\d{2}):(\d{2})` + sep + `(\d{3}) --> (\d{2,}):(\d{2}):(\d{2})` + sep + `(\d{3})$`)
+	ms := func(m []string) time.Duration {
+		var v [4]int
+		for i := range v {
+			v[i], _ = strconv.Atoi(m[i])
+		}
+		return time.Duration(v[0])*time.Hour + time.Duration(v[1])*time.Minute + time.Duration(v[2])*time.Second + time.Duration(v[3])*time.Millisecond
+	}
+	var last time.Duration
+	for i, cue := range strings.Split(strings.TrimSuffix(data, "\n"), "\n\n") {
+		lines := strings.Split(cue, "\n")
+		if len(lines) < 3 {
+			t.Fatalf("cue %d has %d lines: %q", i+1, len(lines), cue)
+		}
+		if lines[0] != strconv.Itoa(i+1) {
+			t.Fatalf("cue %d numbered %q", i+1, lines[0])
+		}
+		m := timing.FindStringSubmatch(lines[1])
+		if m == nil {
+			t.Fatalf("cue %d timing %q", i+1, lines[1])
+		}
+		start, end := ms(m[1:5]), ms(m[5:9])
+		if start < last || end <= start {
+			t.Fatalf("cue %d runs %s to %s after a cue ending at %s", i+1, start, end, last)
+		}
+		last = end
+		for _, line := range lines[2:] {
+			if strings.TrimSpace(line) == "" || len(line) > lineLen || strings.Contains(line, "-->") {
+				t.Fatalf("cue %d text line %q", i+1, line)
+			}
+		}
+	}
+}
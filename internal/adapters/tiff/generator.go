@@ -0,0 +1,353 @@
+package tiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeTIFF, New())
+}
+
+func New() ports.FileGenerator {
+	return &TIFFGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *TIFFGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *TIFFGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// TIFFGenerator writes multi-page TIFFs whose pages are JPEG-compressed
+// grayscale scans, the way document scanners commonly deliver them.
+type TIFFGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+// TIFF tag numbers and field types used by the generator.
+const (
+	tagNewSubfileType  = 254
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagPhotometric     = 262
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagXResolution     = 282
+	tagYResolution     = 283
+	tagResolutionUnit  = 296
+	tagPageNumber      = 297
+	// tagPadding is a private tag in the reusable range whose UNDEFINED
+	// payload pads the file to the requested size.
+	tagPadding = 65000
+
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+
+	compressionJPEG = 7
+	headerLen       = 8
+	// minPadding keeps the padding payload too large to be stored inline
+	// in its IFD entry, so it always occupies bytes of its own.
+	minPadding = 5
+)
+
+// ifdEntry is one 12-byte directory entry. value holds the inline value or
+// the offset of the out-of-line data.
+type ifdEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    uint32
+}
+
+// pageIFDEntries is the number of entries in every page's IFD; the last
+// page carries one more for the padding tag.
+const pageIFDEntries = 14
+
+// ifdLen returns the bytes taken by an IFD with n entries plus the two
+// resolution rationals stored right after it.
+func ifdLen(n int) int64 {
+	return int64(2+12*n+4) + 16
+}
+
+// tiffOptions holds the settings the TIFF generator reads from ports.Options.
+type tiffOptions struct {
+	pages         int
+	width, height int // points
+	dpi           int
+	rand          *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (tiffOptions, error) {
+	var o tiffOptions
+	var err error
+	if o.pages, err = opts.Int("tiff-pages", 1); err != nil {
+		return o, err
+	}
+	if o.pages < 1 {
+		return o, fmt.Errorf("tiff-pages must be at least 1, got %d", o.pages)
+	}
+	if o.dpi, err = opts.Int("scan-dpi", 150); err != nil {
+		return o, err
+	}
+	if o.dpi < 1 {
+		return o, fmt.Errorf("scan-dpi must be positive, got %d", o.dpi)
+	}
+	size := strings.ToLower(opts.String("tiff-page-size", "a4"))
+	dims, ok := utils.PageSizes[size]
+	if !ok {
+		return o, fmt.Errorf("unknown tiff page size %q (want a3, a4, a5, letter or legal)", size)
+	}
+	o.width, o.height = dims[0], dims[1]
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *TIFFGenerator) Generate(outPath string, sizeBytes int64) error {
+	return g.GenerateWithOptions(outPath, sizeBytes, nil)
+}
+
+// GenerateWithOptions writes a little-endian TIFF of exactly sizeBytes
+// holding opts' page count of scanned pages. Page images share the size
+// budget; a private tag on the last page absorbs the remainder.
+func (g *TIFFGenerator) GenerateWithOptions(outPath string, sizeBytes int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if sizeBytes > math.MaxUint32 {
+		return fmt.Errorf("requested size %d exceeds the 4 GiB limit of classic TIFF", sizeBytes)
+	}
+
+	// Everything except the JPEG strips: header, one IFD per page (each
+	// possibly preceded by an alignment byte) and the minimum padding.
+	structure := int64(headerLen) + int64(o.pages)*(ifdLen(pageIFDEntries)+1) + minPadding
+	if sizeBytes <= structure {
+		return fmt.Errorf("requested size %d too small for %d TIFF page(s), minimum is %d", sizeBytes, o.pages, structure+1)
+	}
+	perPage := (sizeBytes - structure) / int64(o.pages)
+	if perPage <= 0 {
+		return fmt.Errorf("requested size %d too small for %d TIFF page(s), minimum is %d", sizeBytes, o.pages, structure+1)
+	}
+
+	scans := make([]utils.ScanImage, o.pages)
+	quality := 0
+	for i := range scans {
+		img, err := utils.RenderScanJPEG(o.rand, o.width, o.height, o.dpi, perPage, quality)
+		if err != nil {
+			return fmt.Errorf("requested size %d too small for %d TIFF page(s): %w", sizeBytes, o.pages, err)
+		}
+		scans[i], quality = img, img.Quality
+	}
+
+	return writeFile(g.fs, outPath, scans, sizeBytes, o.rand)
+}
+
+// FreeTail reports the padding payload, which ends every TIFF, as free.
+func (g *TIFFGenerator) FreeTail(size int64, opts ports.Options) (int64, []byte) {
+	return minPadding, nil
+}
+
+// scanQuality is the JPEG quality of pages rendered at a resolution.
+const scanQuality = 85
+
+// ForResolution returns a generator of a TIFF whose pages, as many as
+// "tiff-pages" asks for, are scans of width×height pixels, and the size of
+// the TIFF with the least padding. The pages are rendered once; larger
+// sizes take more padding.
+func (g *TIFFGenerator) ForResolution(width, height int) (ports.FileGenerator, int64, error) {
+	o, err := parseOptions(g.opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	scans := make([]utils.ScanImage, o.pages)
+	for i := range scans {
+		if scans[i], err = utils.EncodeScanJPEG(o.rand, width, height, o.dpi, scanQuality); err != nil {
+			return nil, 0, err
+		}
+	}
+	_, _, end := layout(scans)
+	size := end + minPadding
+	if size > math.MaxUint32 {
+		return nil, 0, fmt.Errorf("%d pages of %dx%d come to %d bytes, past the 4 GiB limit of classic TIFF", o.pages, width, height, size)
+	}
+	return &scanned{scans, g.fs, o.rand}, size, nil
+}
+
+// scanned is the generator ForResolution returns: a TIFF of the pages it
+// holds, padded to the size asked for.
+type scanned struct {
+	scans []utils.ScanImage
+	fs    ports.OutputFS
+	rand  *utils.Rand // of the padding
+}
+
+func (s *scanned) Generate(outPath string, sizeBytes int64) error {
+	if _, _, end := layout(s.scans); sizeBytes < end+minPadding || sizeBytes > math.MaxUint32 {
+		return fmt.Errorf("requested size %d is not between %d and 4 GiB for these %d TIFF page(s)", sizeBytes, end+minPadding, len(s.scans))
+	}
+	return writeFile(s.fs, outPath, s.scans, sizeBytes, s.rand)
+}
+
+// GenerateWithOptions writes the pages as Generate does; opts came too
+// late to change them.
+func (s *scanned) GenerateWithOptions(outPath string, sizeBytes int64, _ ports.Options) error {
+	return s.Generate(outPath, sizeBytes)
+}
+
+// writeFile writes a TIFF of scans, padded to sizeBytes with random data
+// from r, to outPath on fsys.
+func writeFile(fsys ports.OutputFS, outPath string, scans []utils.ScanImage, sizeBytes int64, r *utils.Rand) error {
+	f, err := outputfs.Create(fsys, outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file '%s': %w", outPath, err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := writeTIFF(w, scans, sizeBytes, r); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// layout returns the offsets of each page's strip and IFD, and where the
+// padding payload starts.
+func layout(scans []utils.ScanImage) (stripOffsets, ifdOffsets []int64, end int64) {
+	offset := int64(headerLen)
+	stripOffsets = make([]int64, len(scans))
+	ifdOffsets = make([]int64, len(scans))
+	for i, s := range scans {
+		stripOffsets[i] = offset
+		offset += int64(len(s.JPEG))
+		offset += offset & 1 // IFDs start on a word boundary
+		ifdOffsets[i] = offset
+		n := pageIFDEntries
+		if i == len(scans)-1 {
+			n++
+		}
+		offset += ifdLen(n)
+	}
+	return stripOffsets, ifdOffsets, offset
+}
+
+// writeTIFF lays out each page as its JPEG strip followed by its IFD, and
+// ends the file with the padding payload, random data from r, referenced
+// from the last IFD.
+func writeTIFF(w *bufio.Writer, scans []utils.ScanImage, sizeBytes int64, r *utils.Rand) error {
+	le := binary.LittleEndian
+	put := func(v any) error { return binary.Write(w, le, v) }
+
+	// Work out every offset up front.
+	stripOffsets, ifdOffsets, offset := layout(scans)
+	padding := sizeBytes - offset
+	if padding < minPadding {
+		return fmt.Errorf("internal error: page images leave %d bytes for padding", padding)
+	}
+
+	if _, err := w.WriteString("II"); err != nil {
+		return err
+	}
+	if err := put(uint16(42)); err != nil {
+		return err
+	}
+	if err := put(uint32(ifdOffsets[0])); err != nil {
+		return err
+	}
+
+	for i, s := range scans {
+		if _, err := w.Write(s.JPEG); err != nil {
+			return fmt.Errorf("failed to write TIFF page %d: %w", i+1, err)
+		}
+		if (stripOffsets[i]+int64(len(s.JPEG)))&1 == 1 {
+			if err := w.WriteByte(0); err != nil {
+				return err
+			}
+		}
+
+		last := i == len(scans)-1
+		n := pageIFDEntries
+		if last {
+			n++
+		}
+		rational := uint32(ifdOffsets[i] + int64(2+12*n+4))
+		entries := []ifdEntry{
+			{tagNewSubfileType, typeLong, 1, 2}, // page of a multi-page image
+			{tagImageWidth, typeLong, 1, uint32(s.Width)},
+			{tagImageLength, typeLong, 1, uint32(s.Height)},
+			{tagBitsPerSample, typeShort, 1, 8},
+			{tagCompression, typeShort, 1, compressionJPEG},
+			{tagPhotometric, typeShort, 1, 1}, // BlackIsZero
+			{tagStripOffsets, typeLong, 1, uint32(stripOffsets[i])},
+			{tagSamplesPerPixel, typeShort, 1, 1},
+			{tagRowsPerStrip, typeLong, 1, uint32(s.Height)},
+			{tagStripByteCounts, typeLong, 1, uint32(len(s.JPEG))},
+			{tagXResolution, typeRational, 1, rational},
+			{tagYResolution, typeRational, 1, rational + 8},
+			{tagResolutionUnit, typeShort, 1, 2}, // inch
+			// PageNumber packs two SHORTs: this page and the page count.
+			{tagPageNumber, typeShort, 2, uint32(i) | uint32(len(scans))<<16},
+		}
+		if last {
+			entries = append(entries, ifdEntry{tagPadding, typeUndefined, uint32(padding), uint32(offset)})
+		}
+
+		next := uint32(0)
+		if !last {
+			next = uint32(ifdOffsets[i+1])
+		}
+		if err := put(uint16(len(entries))); err != nil {
+			return err
+		}
+		var buf [12]byte
+		for _, e := range entries {
+			le.PutUint16(buf[0:2], e.tag)
+			le.PutUint16(buf[2:4], e.typ)
+			le.PutUint32(buf[4:8], e.count)
+			le.PutUint32(buf[8:12], e.value)
+			if _, err := w.Write(buf[:]); err != nil {
+				return err
+			}
+		}
+		if err := put([]uint32{next, uint32(s.DPI), 1, uint32(s.DPI), 1}); err != nil {
+			return err
+		}
+	}
+
+	if err := r.WriteBytes(w, padding); err != nil {
+		return fmt.Errorf("failed to write TIFF padding: %w", err)
+	}
+	return nil
+}
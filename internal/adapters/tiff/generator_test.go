@@ -0,0 +1,141 @@
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// readPages walks the IFD chain of a little-endian TIFF and returns each
+// page's tag values (inline values and offsets alike).
+func readPages(t *testing.T, data []byte) []map[uint16]uint32 {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("II*\x00")) {
+		t.Fatalf("missing little-endian TIFF header: % x", data[:4])
+	}
+	le := binary.LittleEndian
+	var pages []map[uint16]uint32
+	for off := le.Uint32(data[4:]); off != 0; {
+		if off%2 != 0 {
+			t.Fatalf("IFD at odd offset %d", off)
+		}
+		n := int(le.Uint16(data[off:]))
+		tags := make(map[uint16]uint32, n)
+		for i := 0; i < n; i++ {
+			e := data[int(off)+2+12*i:]
+			tags[le.Uint16(e)] = le.Uint32(e[8:])
+		}
+		pages = append(pages, tags)
+		off = le.Uint32(data[int(off)+2+12*n:])
+	}
+	return pages
+}
+
+func TestTIFFGenerator_GenerateWithOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int64
+		opts      ports.Options
+		pages     int
+		wantError string
+	}{
+		{name: "DefaultSinglePage", size: 200 * 1024, pages: 1},
+		{name: "MultiPageLetter", size: 600 * 1024, opts: ports.Options{"tiff-pages": "4", "tiff-page-size": "letter"}, pages: 4},
+		{name: "LowResolutionBudget", size: 6 * 1024, opts: ports.Options{"tiff-pages": "3"}, pages: 3},
+		{name: "TooSmall", size: 100, wantError: "too small"},
+		{name: "UnknownPageSize", size: 100 * 1024, opts: ports.Options{"tiff-page-size": "b4"}, wantError: "unknown tiff page size"},
+		{name: "ZeroPages", size: 100 * 1024, opts: ports.Options{"tiff-pages": "0"}, wantError: "tiff-pages must be at least 1"},
+	}
+
+	g := &TIFFGenerator{}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(t.TempDir(), "scan.tiff")
+			err := g.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+
+			pages := readPages(t, data)
+			if len(pages) != tc.pages {
+				t.Fatalf("got %d pages, want %d", len(pages), tc.pages)
+			}
+			for i, tags := range pages {
+				if tags[tagCompression] != compressionJPEG {
+					t.Errorf("page %d: compression = %d, want JPEG", i+1, tags[tagCompression])
+				}
+				if got := tags[tagPageNumber]; got != uint32(i)|uint32(tc.pages)<<16 {
+					t.Errorf("page %d: PageNumber = %#x", i+1, got)
+				}
+				strip := data[tags[tagStripOffsets] : tags[tagStripOffsets]+tags[tagStripByteCounts]]
+				img, err := jpeg.Decode(bytes.NewReader(strip))
+				if err != nil {
+					t.Fatalf("page %d: strip is not a JPEG: %v", i+1, err)
+				}
+				if b := img.Bounds(); uint32(b.Dx()) != tags[tagImageWidth] || uint32(b.Dy()) != tags[tagImageLength] {
+					t.Errorf("page %d: JPEG is %v, tags say %dx%d", i+1, b, tags[tagImageWidth], tags[tagImageLength])
+				}
+			}
+			last := pages[len(pages)-1]
+			if _, ok := last[tagPadding]; !ok {
+				t.Error("last page has no padding tag")
+			}
+		})
+	}
+}
+
+func TestTIFFGenerator_ForResolution(t *testing.T) {
+	configured, err := New().(*TIFFGenerator).Configure(ports.Options{"tiff-pages": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, size, err := configured.(*TIFFGenerator).ForResolution(640, 480)
+	if err != nil {
+		t.Fatalf("ForResolution() error = %v", err)
+	}
+	for _, target := range []int64{size, size + 1000} {
+		outPath := filepath.Join(t.TempDir(), "scan.tiff")
+		if err := g.Generate(outPath, target); err != nil {
+			t.Fatalf("Generate(%d) error = %v", target, err)
+		}
+		data, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(data)) != target {
+			t.Fatalf("size = %d, want %d", len(data), target)
+		}
+		pages := readPages(t, data)
+		if len(pages) != 2 {
+			t.Fatalf("got %d pages, want 2", len(pages))
+		}
+		for i, tags := range pages {
+			if tags[tagImageWidth] != 640 || tags[tagImageLength] != 480 {
+				t.Errorf("page %d is %dx%d, want 640x480", i+1, tags[tagImageWidth], tags[tagImageLength])
+			}
+		}
+	}
+	if err := g.Generate(filepath.Join(t.TempDir(), "scan.tiff"), size-1); err == nil {
+		t.Error("Generate() a byte short of the pages succeeded")
+	}
+}
@@ -0,0 +1,364 @@
+package txt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// englishWords is the vocabulary of the words content mode.
+var englishWords = []string{
+	"able", "about", "account", "across", "action", "active", "address", "after", "again", "against",
+	"agree", "air", "allow", "almost", "along", "already", "always", "amount", "animal", "answer",
+	"apple", "area", "argue", "around", "arrive", "article", "attack", "autumn", "average", "away",
+	"baby", "back", "balance", "ball", "bank", "basket", "beach", "bear", "beauty", "because",
+	"bed", "before", "begin", "behind", "believe", "below", "best", "better", "between", "bird",
+	"black", "blue", "board", "boat", "body", "book", "border", "bottle", "bottom", "box",
+	"bread", "bridge", "bright", "bring", "brother", "brown", "build", "business", "butter", "buy",
+	"cable", "call", "camera", "candle", "capital", "card", "care", "carry", "castle", "cause",
+	"center", "chair", "chance", "change", "cheap", "check", "cheese", "child", "choice", "church",
+	"circle", "city", "class", "clean", "clear", "climb", "clock", "close", "cloud", "coast",
+	"coffee", "cold", "color", "common", "company", "copper", "corner", "cotton", "country", "course",
+	"cover", "cream", "credit", "cross", "crowd", "current", "cycle", "damage", "dance", "danger",
+	"dark", "daughter", "day", "dear", "decide", "deep", "degree", "design", "detail", "develop",
+	"different", "dinner", "direct", "distance", "doctor", "door", "double", "dream", "dress", "drink",
+	"drive", "early", "earth", "east", "easy", "edge", "effect", "engine", "enough", "evening",
+	"event", "every", "example", "family", "farm", "fast", "father", "feather", "field", "figure",
+	"final", "finger", "fire", "fish", "flower", "follow", "forest", "forward", "free", "friend",
+	"front", "fruit", "garden", "general", "gentle", "glass", "gold", "good", "grass", "great",
+	"green", "ground", "group", "guide", "hand", "happy", "harbor", "heart", "heavy", "history",
+	"holiday", "horse", "house", "human", "idea", "island", "journey", "kitchen", "knowledge", "language",
+	"large", "letter", "light", "little", "market", "meeting", "memory", "middle", "minute", "morning",
+	"mother", "mountain", "music", "narrow", "nature", "night", "north", "number", "ocean", "office",
+	"orange", "paper", "people", "picture", "place", "planet", "pocket", "power", "question", "quiet",
+	"rain", "reason", "record", "river", "road", "round", "school", "season", "second", "silver",
+	"simple", "small", "society", "south", "spring", "square", "station", "stone", "story", "street",
+	"strong", "summer", "system", "table", "teacher", "thought", "today", "together", "train", "travel",
+	"under", "valley", "village", "voice", "water", "weather", "west", "window", "winter", "world",
+	"yellow", "young",
+}
+
+// Words written in Latin with diacritics, Cyrillic and Greek for the utf8
+// content mode; CJK, kana and emoji are drawn from code point ranges.
+var accentedWords = []string{
+	"café", "naïve", "façade", "über", "mañana", "smörgåsbord", "crème", "jalapeño", "Zürich", "São",
+	"Ångström", "fiancée", "привет", "мир", "данные", "файл", "размер", "κόσμος", "δεδομένα", "αλφα",
+}
+
+// textSource produces the words of one content mode.
+type textSource struct {
+	content string
+	lang    *utils.Language
+	lorem   []string        // remaining words of the current lorem paragraph
+	pending string          // word that did not fit on the previous line
+	pii     float64         // share of words replaced with personal data
+	planted []utils.PIIItem // personal data returned but not yet located
+	rand    *utils.Rand
+}
+
+// word returns the next word.
+func (s *textSource) word() string {
+	if w := s.pending; w != "" {
+		s.pending = ""
+		return w
+	}
+	if s.pii > 0 && s.rand.Float64() < s.pii {
+		return s.plant()
+	}
+	switch {
+	case s.content == ContentLorem:
+		if len(s.lorem) == 0 {
+			s.lorem = strings.Fields(s.lang.Paragraph(s.rand, 3, 7))
+		}
+		w := s.lorem[0]
+		s.lorem = s.lorem[1:]
+		return w
+	case s.lang != utils.Lorem:
+		return s.lang.Word(s.rand)
+	case s.content == ContentUTF8:
+		return utf8Word(s.rand)
+	default:
+		return englishWords[s.rand.IntN(len(englishWords))]
+	}
+}
+
+// line returns the next line including its newline. With lineLength set,
+// the line holds exactly that many characters, filled with whole words
+// where possible and padded with spaces.
+func (s *textSource) line(lineLength int) string {
+	var b strings.Builder
+	if s.content == ContentRandom {
+		for i := 0; i < lineLength; i++ {
+			b.WriteByte(byte(0x20 + s.rand.IntN(0x7E-0x20+1)))
+		}
+		b.WriteByte('\n')
+		return b.String()
+	}
+
+	if lineLength == 0 {
+		switch s.content {
+		case ContentLorem:
+			return s.seed(s.lang.Paragraph(s.rand, 3, 7)) + "\n\n"
+		case ContentWords:
+			return s.joinWords(8+s.rand.IntN(9)) + "\n"
+		default:
+			return s.joinWords(6+s.rand.IntN(9)) + "\n"
+		}
+	}
+
+	chars := 0
+	for {
+		w := s.word()
+		n := utf8.RuneCountInString(w)
+		if chars > 0 {
+			n++ // separating space
+		}
+		if chars+n > lineLength {
+			if chars == 0 {
+				// A word longer than the whole line is cut.
+				w = string([]rune(w)[:lineLength])
+				b.WriteString(w)
+				chars = lineLength
+			} else {
+				s.pending = w
+			}
+			break
+		}
+		if chars > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(w)
+		chars += n
+	}
+	b.WriteString(strings.Repeat(" ", lineLength-chars))
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// plant returns a random piece of personal data, which is kept to be
+// located once it is written.
+func (s *textSource) plant() string {
+	item := utils.RandPII(s.rand)
+	s.planted = append(s.planted, item)
+	return item.Value
+}
+
+// seed replaces the share of the words of text personal data takes.
+func (s *textSource) seed(text string) string {
+	if s.pii == 0 {
+		return text
+	}
+	words := strings.Fields(text)
+	for i := range words {
+		if s.rand.Float64() < s.pii {
+			words[i] = s.plant()
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// locate appends to items the planted personal data found in text, which
+// starts offset bytes into the file on line line, with where each is. Data
+// not found, cut off the end of the file, stays unlocated.
+func (s *textSource) locate(items []utils.PIIItem, text string, offset, line int64) []utils.PIIItem {
+	from := 0
+	for len(s.planted) > 0 {
+		i := strings.Index(text[from:], s.planted[0].Value)
+		if i < 0 {
+			break
+		}
+		item := s.planted[0]
+		item.Offset = offset + int64(from+i)
+		item.Line = line + int64(strings.Count(text[:from+i], "\n"))
+		items = append(items, item)
+		from += i + len(item.Value)
+		s.planted = s.planted[1:]
+	}
+	return items
+}
+
+func (s *textSource) joinWords(n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = s.word()
+	}
+	return strings.Join(words, " ")
+}
+
+// utf8Word returns a word from r of two- to four-byte characters: CJK
+// ideographs, hiragana, an emoji, or a word with diacritics or in
+// Cyrillic or Greek.
+func utf8Word(r *utils.Rand) string {
+	var b strings.Builder
+	switch n := r.IntN(10); {
+	case n < 4:
+		for i := 1 + r.IntN(4); i > 0; i-- {
+			b.WriteRune(rune(0x4E00 + r.IntN(0x9FA5-0x4E00+1)))
+		}
+	case n < 6:
+		for i := 2 + r.IntN(4); i > 0; i-- {
+			b.WriteRune(rune(0x3041 + r.IntN(0x3093-0x3041+1)))
+		}
+	case n < 8:
+		b.WriteString(accentedWords[r.IntN(len(accentedWords))])
+	default:
+		b.WriteRune(rune(0x1F600 + r.IntN(0x1F64F-0x1F600+1)))
+	}
+	return b.String()
+}
+
+// writeLines writes size bytes of lines from o's content mode. The final
+// line is cut at a character boundary and padded with spaces, so the byte
+// count is exact and the file is valid UTF-8. o.needle's lines go in
+// between, each once the text written passes its share of size, and any
+// still due ahead of the final line. It returns the personal data planted
+// in the text, with where.
+func writeLines(w *bufio.Writer, size int64, o txtOptions) ([]utils.PIIItem, error) {
+	src := &textSource{content: o.content, lang: o.lang, pii: o.pii, rand: o.rand}
+	needle := o.needle.Text + "\n"
+	if o.lineLength > 0 {
+		needle = o.needle.Text + strings.Repeat(" ", o.lineLength-utf8.RuneCountInString(o.needle.Text)) + "\n"
+	}
+	total, planted, lineNo := size, 0, int64(1)
+	var items []utils.PIIItem
+	plant := func() error {
+		planted++
+		size -= int64(len(needle))
+		lineNo++
+		_, err := w.WriteString(needle)
+		return err
+	}
+	if reserved := int64(o.needle.Count * len(needle)); reserved > size {
+		return nil, fmt.Errorf("size %d too small to embed %q %d times (%d bytes)", size, o.needle.Text, o.needle.Count, reserved)
+	}
+	for size > 0 {
+		if planted < o.needle.Count && total-size >= o.needle.At(planted, total) {
+			if err := plant(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		line := src.line(o.lineLength)
+		if room := size - int64((o.needle.Count-planted)*len(needle)); int64(len(line)) > room {
+			for planted < o.needle.Count {
+				if err := plant(); err != nil {
+					return nil, err
+				}
+			}
+			n := int(room)
+			for n > 0 && !utf8.RuneStart(line[n]) {
+				n--
+			}
+			line = line[:n] + strings.Repeat(" ", int(room)-n)
+		}
+		if src.pii > 0 {
+			items = src.locate(items, line, total-size, lineNo)
+		}
+		if _, err := w.WriteString(line); err != nil {
+			return nil, err
+		}
+		size -= int64(len(line))
+		lineNo += int64(strings.Count(line, "\n"))
+	}
+	return items, nil
+}
+
+// randomNeedle returns the line n is planted on in random text, which has
+// no line breaks of its own.
+func randomNeedle(n utils.Needle) string {
+	return "\n" + n.Text + "\n"
+}
+
+// writeRandomNeedles writes size bytes of random printable ASCII from r
+// with n planted n.Count times, on lines of its own, splitting the random
+// text evenly.
+func writeRandomNeedles(r *utils.Rand, out io.Writer, size int64, n utils.Needle) error {
+	line := randomNeedle(n)
+	random := size - int64(n.Count*len(line))
+	if random < 0 {
+		return fmt.Errorf("size %d too small to embed %q %d times (%d bytes)", size, n.Text, n.Count, size-random)
+	}
+	var written int64
+	for i := 0; i < n.Count; i++ {
+		at := n.At(i, random)
+		if err := writeRandom(r, out, at-written); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(out, line); err != nil {
+			return err
+		}
+		written = at
+	}
+	return writeRandom(r, out, random-written)
+}
+
+// text returns one line of text without a line break.
+func (s *textSource) text() string {
+	switch s.content {
+	case ContentRandom:
+		b := make([]byte, 40+s.rand.IntN(81))
+		for i := range b {
+			b[i] = byte(0x20 + s.rand.IntN(0x7E-0x20+1))
+		}
+		return string(b)
+	case ContentLorem:
+		return s.lang.Paragraph(s.rand, 1, 3)
+	case ContentWords:
+		return s.joinWords(8 + s.rand.IntN(9))
+	default:
+		return s.joinWords(6 + s.rand.IntN(9))
+	}
+}
+
+// fit returns text of exactly n bytes: text extended with more words, or
+// cut at a character boundary and padded with spaces.
+func (s *textSource) fit(text string, n int) string {
+	if len(text) < n {
+		var b strings.Builder
+		b.Grow(n + 128)
+		b.WriteString(text)
+		for b.Len() < n {
+			if s.content == ContentRandom {
+				b.WriteString(s.text())
+			} else {
+				b.WriteString(" " + s.word())
+			}
+		}
+		text = b.String()
+	}
+	cut := n
+	for cut > 0 && cut < len(text) && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + strings.Repeat(" ", n-cut)
+}
+
+// writeLineCount writes exactly lines lines. Unless size is ports.AnySize,
+// the lines share size bytes as evenly as possible.
+func writeLineCount(w *bufio.Writer, size, lines int64, o txtOptions) error {
+	src := &textSource{content: o.content, lang: o.lang, rand: o.rand}
+	for i := int64(0); i < lines; i++ {
+		var line string
+		switch {
+		case size != ports.AnySize:
+			n := size / lines
+			if i < size%lines {
+				n++
+			}
+			line = src.fit(src.text(), int(n-1)) + "\n"
+		case o.lineLength > 0:
+			line = src.line(o.lineLength)
+		default:
+			line = src.text() + "\n"
+		}
+		if _, err := w.WriteString(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,11 +1,18 @@
 package txt
 
 import (
-	"math/rand/v2"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func init() {
@@ -15,20 +22,293 @@ func init() {
 	factory.RegisterGenerator(ports.FileTypeMD, gen)
 }
 
-type TxtGenerator struct{}
+type TxtGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &TxtGenerator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes. If opts select the pii content profile, the copy writes
+// the ground-truth manifest of each file next to it.
+func (g *TxtGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	if o.pii > 0 {
+		return &piiGenerator{&c}, nil
+	}
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *TxtGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// Text content modes.
+const (
+	ContentRandom = "random"
+	ContentLorem  = "lorem"
+	ContentWords  = "words"
+	ContentUTF8   = "utf8"
+)
+
+// txtOptions holds the settings the TXT generator reads from ports.Options.
+type txtOptions struct {
+	content    string
+	lineLength int // characters per line; 0 leaves line breaks to the content
+	eicar      bool
+	lang       *utils.Language // vocabulary of the lorem, words and utf8 modes
+	needle     utils.Needle    // planted on lines of its own
+	pii        float64         // share of words that are personal data; 0 for none
+	threads    int             // goroutines making random content
+	rand       *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (txtOptions, error) {
+	var o txtOptions
+	var err error
+	if o.lang, err = utils.TextLanguage(opts.String("lang", ""), opts.String("corpus", "")); err != nil {
+		return o, err
+	}
+	// Content profiles other than pii are for other formats.
+	if strings.ToLower(opts.String("content", "")) == utils.ContentPII {
+		if o.pii, err = utils.ParsePIIDensity(opts.String("pii-density", "")); err != nil {
+			return o, err
+		}
+	}
+	// A language implies prose, and personal data words, as random ASCII
+	// has neither.
+	defaultContent := ContentRandom
+	if o.lang != utils.Lorem {
+		defaultContent = ContentLorem
+	} else if o.pii > 0 {
+		defaultContent = ContentWords
+	}
+	o.content = strings.ToLower(opts.String("txt-content", defaultContent))
+	switch o.content {
+	case ContentRandom, ContentLorem, ContentWords, ContentUTF8:
+	default:
+		return o, fmt.Errorf("unknown txt content %q (want random, lorem, words or utf8)", o.content)
+	}
+	if o.content == ContentRandom && o.lang != utils.Lorem {
+		return o, fmt.Errorf("txt-content random cannot be combined with lang or corpus")
+	}
+	if o.content == ContentRandom && o.pii > 0 {
+		return o, fmt.Errorf("content pii needs txt-content lorem, words or utf8")
+	}
+	if o.lineLength, err = opts.Int("txt-line-length", 0); err != nil {
+		return o, err
+	}
+	if o.lineLength < 0 {
+		return o, fmt.Errorf("txt-line-length must not be negative, got %d", o.lineLength)
+	}
+	if o.pii > 0 && o.lineLength > 0 && o.lineLength < utils.MaxPIILen {
+		return o, fmt.Errorf("txt-line-length must be at least %d with content pii", utils.MaxPIILen)
+	}
+	if o.eicar, err = opts.Bool("eicar", false); err != nil {
+		return o, err
+	}
+	if o.needle, err = utils.ParseNeedle(opts.String("embed-string", ""), opts.String("embed-count", "")); err != nil {
+		return o, err
+	}
+	if o.lineLength > 0 && utf8.RuneCountInString(o.needle.Text) > o.lineLength {
+		return o, fmt.Errorf("embed-string is longer than txt-line-length %d", o.lineLength)
+	}
+	if o.threads, err = utils.ParseThreads(opts.String("threads", "")); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
 func (g *TxtGenerator) Generate(path string, size int64) error {
-	f, err := os.Create(path)
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes size bytes of text. The default is random
+// printable ASCII; the "txt-content" option selects lorem ipsum sentences,
+// English words or multibyte UTF-8 instead, and "txt-line-length" breaks
+// the text into lines of exactly that many characters. "lang" draws the
+// words from Arabic, Chinese, Russian, emoji or a mix of them, and
+// "corpus" the sentences and words from its files; either makes lorem the
+// default mode. With "eicar" the first line is the EICAR
+// anti-virus test string. "embed-string" is planted "embed-count" times,
+// once if unset, each time on a line of its own, spread evenly through
+// the text. "content" pii makes words the default mode and replaces
+// "pii-density" of the words, 5% if unset, with synthetic personal data.
+// "threads" makes random content on that many goroutines.
+func (g *TxtGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return err
+	}
+	f, err := outputfs.Create(g.fs, path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	if err := g.GenerateTo(f, size, opts); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// GenerateFrom writes the text GenerateWithOptions would. Random text is
+// carried on from where a run that stopped at from left it, and lines
+// from the start of the line it was writing. Text with an EICAR line,
+// planted strings or personal data, which are placed by where they fall
+// in the whole file, cannot be resumed.
+func (g *TxtGenerator) GenerateFrom(path string, size int64, opts ports.Options, from ports.ResumeState, checkpoint func(ports.ResumeState) error) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.eicar || o.needle.Count > 0 || o.pii > 0 {
+		return fmt.Errorf("text with eicar, embed-string or content pii cannot be resumed")
+	}
+	lines := o.content != ContentRandom || o.lineLength > 0
+	start := min(from.Offset, size)
+	if lines && start > 0 {
+		if start, err = lineStart(path, start); err != nil {
+			return err
+		}
+	}
+	f, err := outputfs.Resume(g.fs, path, start)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cw := outputfs.NewCheckpointer(f, start, checkpoint)
+	cw.Phase = "text"
+	switch {
+	case lines:
+		w := bufio.NewWriter(cw)
+		if _, err = writeLines(w, size-start, o); err == nil {
+			err = w.Flush()
+		}
+	default:
+		err = utils.WriteParallel(cw, size-start, o.threads, fillRandom(o.rand, start))
+	}
+	if err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// lineStart returns the offset of the start of the line the byte before
+// offset in the file at path is on.
+func lineStart(path string, offset int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	buf := make([]byte, 64*1024)
+	for end := offset; end > 0; end -= int64(len(buf)) {
+		start := max(end-int64(len(buf)), 0)
+		b := buf[:end-start]
+		if _, err := f.ReadAt(b, start); err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// allocatedHead is how much text GenerateAllocated writes before the zeros.
+const allocatedHead = 4096
+
+// GenerateAllocated writes the first 4KB of the text GenerateWithOptions
+// would and extends the file to size with mode, so that it starts like a
+// text file but the rest reads as NUL bytes.
+func (g *TxtGenerator) GenerateAllocated(path string, size int64, mode ports.Allocation, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.pii > 0 {
+		return fmt.Errorf("content pii cannot be combined with %s files", mode)
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := g.GenerateTo(f, min(size, allocatedHead), opts); err != nil {
+		return err
+	}
+	if err := utils.Extend(f, size, mode == ports.AllocatePreallocate); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// GenerateTo writes the text GenerateWithOptions would to w.
+func (g *TxtGenerator) GenerateTo(out io.Writer, size int64, opts ports.Options) error {
+	_, err := g.generateTo(out, size, opts)
+	return err
+}
+
+// generateTo writes the text GenerateWithOptions would to out, and returns
+// the personal data planted in it, with where.
+func (g *TxtGenerator) generateTo(out io.Writer, size int64, opts ports.Options) ([]utils.PIIItem, error) {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	var head int64
+	if o.eicar {
+		line := append(utils.EICAR(), '\n')
+		if size < int64(len(line)) {
+			return nil, fmt.Errorf("size %d too small for the EICAR test line (%d bytes)", size, len(line))
+		}
+		if _, err := out.Write(line); err != nil {
+			return nil, err
+		}
+		head = int64(len(line))
+		size -= head
+	}
+	if o.content != ContentRandom || o.lineLength > 0 {
+		w := bufio.NewWriter(out)
+		items, err := writeLines(w, size, o)
+		if err != nil {
+			return nil, err
+		}
+		for i := range items {
+			items[i].Offset += head
+			if head > 0 {
+				items[i].Line++
+			}
+		}
+		return items, w.Flush()
+	}
+	if o.needle.Count > 0 {
+		return nil, writeRandomNeedles(o.rand, out, size, o.needle)
+	}
+	return nil, utils.WriteParallel(out, size, o.threads, fillRandom(o.rand, 0))
+}
+
+// writeRandom writes size bytes of random printable ASCII from r to out.
+func writeRandom(r *utils.Rand, out io.Writer, size int64) error {
 	// We will generate random printable ASCII characters (space 0x20 to '~' 0x7E).
-	const printableStart, printableEnd = 0x20, 0x7E
 	bufSize := 8192
 	buf := make([]byte, bufSize)
 	var written int64
@@ -38,12 +318,93 @@ func (g *TxtGenerator) Generate(path string, size int64) error {
 			toWrite = int(size - written)
 		}
 		for i := 0; i < toWrite; i++ {
-			buf[i] = byte(printableStart + rand.IntN(printableEnd-printableStart+1))
+			buf[i] = printable[r.IntN(len(printable))]
 		}
-		if _, err := f.Write(buf[:toWrite]); err != nil {
+		if _, err := out.Write(buf[:toWrite]); err != nil {
 			return err
 		}
 		written += int64(toWrite)
 	}
+	return nil
+}
+
+// fillRandom returns a function filling b with random printable ASCII
+// from r, the same at offset from base on any goroutine.
+func fillRandom(r *utils.Rand, base int64) func(b []byte, offset int64) error {
+	return func(b []byte, offset int64) error {
+		r.FillAt(b, base+offset)
+		for i, c := range b {
+			b[i] = printable[int(c)*len(printable)>>8]
+		}
+		return nil
+	}
+}
+
+// printable lists the bytes of random content: printable ASCII, space to
+// tilde.
+var printable = func() []byte {
+	b := make([]byte, 0, 0x7E-0x20+1)
+	for c := byte(0x20); c <= 0x7E; c++ {
+		b = append(b, c)
+	}
+	return b
+}()
+
+// FreeTail reports the random printable ASCII after any EICAR line, or
+// after the last planted string, as free to take other printable
+// characters. Prose and fixed-length lines have no free bytes.
+func (g *TxtGenerator) FreeTail(size int64, opts ports.Options) (int64, []byte) {
+	o, err := parseOptions(g.opts.With(opts))
+	if err != nil || o.content != ContentRandom || o.lineLength > 0 {
+		return 0, nil
+	}
+	if o.eicar {
+		size -= int64(len(utils.EICAR()) + 1)
+	}
+	if o.needle.Count > 0 {
+		random := size - int64(o.needle.Count*len(randomNeedle(o.needle)))
+		size = random - o.needle.At(o.needle.Count-1, random)
+	}
+	return max(size, 0), printable
+}
+
+// GenerateLines writes exactly lines lines of text in the content mode
+// selected by opts. With a byte size as well, the size is spread evenly
+// over the lines and each line is filled or cut to its share.
+func (g *TxtGenerator) GenerateLines(path string, size, lines int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.eicar {
+		return fmt.Errorf("eicar cannot be combined with a line count")
+	}
+	if o.needle.Count > 0 {
+		return fmt.Errorf("embed-string cannot be combined with a line count")
+	}
+	if o.pii > 0 {
+		return fmt.Errorf("content pii cannot be combined with a line count")
+	}
+	if size != ports.AnySize {
+		if o.lineLength > 0 {
+			return fmt.Errorf("txt-line-length cannot be combined with both a size and a line count")
+		}
+		if size < lines {
+			return fmt.Errorf("target %d too small for %d lines; need at least %d", size, lines, lines)
+		}
+	}
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := writeLineCount(w, size, lines, o); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
 	return f.Sync()
 }
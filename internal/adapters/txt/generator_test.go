@@ -1,12 +1,17 @@
 package txt
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/hailam/genfile/internal/ports" //
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func TestTxtGenerator_Generate(t *testing.T) {
@@ -85,3 +90,333 @@ func TestTxtGenerator_Generate(t *testing.T) {
 		// but just checking for non-nil error is often sufficient for this type of test.
 	})
 }
+
+func TestTxtGenerator_GenerateWithOptions(t *testing.T) {
+	generator := &TxtGenerator{}
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name       string
+		opts       ports.Options
+		sizes      []int64
+		lineLength int
+	}{
+		{"Lorem", ports.Options{"txt-content": "lorem"}, []int64{1, 7, 1000, 100000}, 0},
+		{"Words", ports.Options{"txt-content": "words"}, []int64{3, 5000}, 0},
+		{"UTF8", ports.Options{"txt-content": "utf8"}, []int64{1, 2, 3, 5, 1001, 65537}, 0},
+		{"RandomFixedLines", ports.Options{"txt-line-length": "40"}, []int64{41, 4100, 5000}, 40},
+		{"LoremFixedLines", ports.Options{"txt-content": "lorem", "txt-line-length": "72"}, []int64{20000}, 72},
+		{"UTF8FixedLines", ports.Options{"txt-content": "utf8", "txt-line-length": "3"}, []int64{20000}, 3},
+		{"Arabic", ports.Options{"lang": "ar"}, []int64{1, 2, 3, 9999}, 0},
+		{"ChineseWords", ports.Options{"lang": "zh", "txt-content": "words"}, []int64{2, 4, 5000}, 0},
+		{"EmojiFixedLines", ports.Options{"lang": "emoji", "txt-line-length": "20"}, []int64{1, 3, 20000}, 20},
+		{"Mixed", ports.Options{"lang": "mixed"}, []int64{65537}, 0},
+	}
+
+	for _, tc := range testCases {
+		for _, size := range tc.sizes {
+			t.Run(fmt.Sprintf("%s_%d", tc.name, size), func(t *testing.T) {
+				outPath := filepath.Join(tempDir, fmt.Sprintf("%s_%d.txt", tc.name, size))
+				if err := generator.GenerateWithOptions(outPath, size, tc.opts); err != nil {
+					t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+				}
+				content, err := os.ReadFile(outPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if int64(len(content)) != size {
+					t.Fatalf("size = %d, want %d", len(content), size)
+				}
+				if !utf8.Valid(content) {
+					t.Fatal("content is not valid UTF-8")
+				}
+				if tc.name == "UTF8" && size > 1000 && utf8.RuneCount(content) > len(content)*3/4 {
+					t.Errorf("only %d of %d characters are multibyte", len(content)-utf8.RuneCount(content), utf8.RuneCount(content))
+				}
+				if tc.lineLength > 0 {
+					lines := strings.Split(string(content), "\n")
+					for i, line := range lines[:len(lines)-1] { // the last line is cut to fit
+						if n := utf8.RuneCountInString(line); n != tc.lineLength {
+							t.Fatalf("line %d has %d characters, want %d: %q", i, n, tc.lineLength, line)
+						}
+					}
+				}
+			})
+		}
+	}
+
+	t.Run("EICAR", func(t *testing.T) {
+		outPath := filepath.Join(tempDir, "eicar.txt")
+		if err := generator.GenerateWithOptions(outPath, 1000, ports.Options{"eicar": "true", "txt-content": "words"}); err != nil {
+			t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+		}
+		content, _ := os.ReadFile(outPath)
+		if len(content) != 1000 || !strings.HasPrefix(string(content), string(utils.EICAR())+"\n") {
+			t.Errorf("file of %d bytes does not start with the EICAR line", len(content))
+		}
+		err := generator.GenerateWithOptions(outPath, 10, ports.Options{"eicar": "true"})
+		if err == nil || !strings.Contains(err.Error(), "too small for the EICAR test line") {
+			t.Errorf("expected a too small error, got %v", err)
+		}
+	})
+
+	t.Run("EmbedString", func(t *testing.T) {
+		for _, opts := range []ports.Options{
+			{},
+			{"eicar": "true"},
+			{"txt-content": "lorem"},
+			{"txt-content": "utf8", "txt-line-length": "20"},
+			{"txt-content": "random", "txt-line-length": "15"},
+		} {
+			for _, size := range []int64{200, 201, 5000} {
+				outPath := filepath.Join(tempDir, "needle.txt")
+				opts := opts.With(ports.Options{"embed-string": "NEEDLE-12345", "embed-count": "7"})
+				if err := generator.GenerateWithOptions(outPath, size, opts); err != nil {
+					t.Fatalf("%v, %d bytes: %v", opts, size, err)
+				}
+				content, _ := os.ReadFile(outPath)
+				if int64(len(content)) != size || !utf8.Valid(content) {
+					t.Errorf("%v: %d bytes, want %d of valid UTF-8", opts, len(content), size)
+				}
+				lines := strings.Split(string(content), "\n")
+				needles := 0
+				for _, line := range lines {
+					if strings.TrimRight(line, " ") == "NEEDLE-12345" {
+						needles++
+					}
+				}
+				if needles != 7 || strings.Count(string(content), "NEEDLE-12345") != 7 {
+					t.Errorf("%v, %d bytes: %d lines of the string, %d in all; want 7", opts, size, needles, strings.Count(string(content), "NEEDLE-12345"))
+				}
+				if n, _ := opts.Int("txt-line-length", 0); n > 0 {
+					for _, line := range lines[:len(lines)-1] {
+						if utf8.RuneCountInString(line) != n {
+							t.Fatalf("%v: line %q is not %d characters", opts, line, n)
+						}
+					}
+				}
+			}
+		}
+		err := generator.GenerateWithOptions(filepath.Join(tempDir, "bad.txt"), 90, ports.Options{"embed-string": "NEEDLE-12345", "embed-count": "7"})
+		if err == nil || !strings.Contains(err.Error(), "too small to embed") {
+			t.Errorf("expected a too small error, got %v", err)
+		}
+	})
+
+	t.Run("RandomWithLang", func(t *testing.T) {
+		err := generator.GenerateWithOptions(filepath.Join(tempDir, "bad.txt"), 10, ports.Options{"txt-content": "random", "lang": "ru"})
+		if err == nil || !strings.Contains(err.Error(), "cannot be combined with lang") {
+			t.Errorf("expected a lang conflict error, got %v", err)
+		}
+	})
+
+	t.Run("UnknownContent", func(t *testing.T) {
+		err := generator.GenerateWithOptions(filepath.Join(tempDir, "bad.txt"), 10, ports.Options{"txt-content": "binary"})
+		if err == nil || !strings.Contains(err.Error(), "unknown txt content") {
+			t.Errorf("expected unknown content error, got %v", err)
+		}
+	})
+}
+
+func TestTxtGenerator_GenerateLines(t *testing.T) {
+	generator := &TxtGenerator{}
+	var _ ports.LineGenerator = generator
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name   string
+		opts   ports.Options
+		size   int64
+		lines  int64
+		errSub string
+	}{
+		{"Random", nil, ports.AnySize, 1000, ""},
+		{"Lorem", ports.Options{"txt-content": "lorem"}, ports.AnySize, 200, ""},
+		{"FixedLength", ports.Options{"txt-content": "words", "txt-line-length": "30"}, ports.AnySize, 100, ""},
+		{"RandomSized", nil, 10000, 99, ""},
+		{"UTF8Sized", ports.Options{"txt-content": "utf8"}, 4003, 10, ""},
+		{"EmptyLines", ports.Options{"txt-content": "utf8"}, 7, 7, ""},
+		{"RussianSized", ports.Options{"lang": "ru"}, 4003, 10, ""},
+		{"LongLines", ports.Options{"txt-content": "words"}, 100000, 3, ""},
+		{"TooSmall", nil, 9, 10, "too small"},
+		{"FixedLengthSized", ports.Options{"txt-line-length": "30"}, 1000, 10, "cannot be combined"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, tc.name+".txt")
+			err := generator.GenerateLines(outPath, tc.size, tc.lines, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("expected error containing %q, got %v", tc.errSub, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateLines returned unexpected error: %v", err)
+			}
+			content, _ := os.ReadFile(outPath)
+			if tc.size != ports.AnySize && int64(len(content)) != tc.size {
+				t.Errorf("size = %d, want %d", len(content), tc.size)
+			}
+			if n := int64(strings.Count(string(content), "\n")); n != tc.lines || !strings.HasSuffix(string(content), "\n") {
+				t.Errorf("got %d lines, want %d", n, tc.lines)
+			}
+			if !utf8.Valid(content) {
+				t.Error("content is not valid UTF-8")
+			}
+		})
+	}
+}
+
+func TestTxtGenerator_GenerateAllocated(t *testing.T) {
+	generator := &TxtGenerator{}
+	var _ ports.AllocatingGenerator = generator
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name string
+		mode ports.Allocation
+		size int64
+	}{
+		{"Sparse", ports.AllocateSparse, 1 << 20},
+		{"Preallocate", ports.AllocatePreallocate, 1 << 20},
+		{"SmallerThanHead", ports.AllocateSparse, 100},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, tc.name+".txt")
+			if err := generator.GenerateAllocated(outPath, tc.size, tc.mode, ports.Options{"txt-content": "lorem"}); err != nil {
+				t.Fatalf("GenerateAllocated returned unexpected error: %v", err)
+			}
+			content, _ := os.ReadFile(outPath)
+			if int64(len(content)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(content), tc.size)
+			}
+			head := min(tc.size, allocatedHead)
+			if strings.ContainsRune(string(content[:head]), 0) || !utf8.Valid(content[:head]) {
+				t.Errorf("head is not text: %q", content[:min(head, 40)])
+			}
+			if strings.Trim(string(content[head:]), "\x00") != "" {
+				t.Error("bytes after the head are not NUL")
+			}
+		})
+	}
+}
+
+// piiPattern matches the synthetic personal data of the pii profile.
+var piiPattern = regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b|\b\d{4} \d{4} \d{4} \d{4}\b|\b3[47]\d{13}\b|[a-z]+\.[a-z]+\d*@example\.(com|org|net)\b`)
+
+func TestTxtGenerator_PII(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, opts := range []ports.Options{
+		{"content": "pii"},
+		{"content": "pii", "pii-density": "0.5", "txt-content": "lorem"},
+		{"content": "pii", "pii-density": "1", "txt-content": "utf8", "txt-line-length": "40"},
+		{"content": "pii", "eicar": "true", "embed-string": "NEEDLE-12345", "embed-count": "3"},
+	} {
+		for _, size := range []int64{200, 4097, 100000} {
+			g, err := New().(*TxtGenerator).Configure(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outPath := filepath.Join(tempDir, "pii.txt")
+			paths, err := g.(ports.SetGenerator).GenerateSet(outPath, size)
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", opts, size, err)
+			}
+			if len(paths) != 2 || paths[1] != filepath.Join(tempDir, "pii.pii.json") {
+				t.Fatalf("GenerateSet() = %v, want the text and its manifest", paths)
+			}
+			content, _ := os.ReadFile(outPath)
+			if int64(len(content)) != size {
+				t.Fatalf("%v: size = %d, want %d", opts, len(content), size)
+			}
+			data, _ := os.ReadFile(paths[1])
+			var manifest struct {
+				Counts map[string]int
+				Items  []utils.PIIItem
+			}
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatalf("manifest does not parse: %v", err)
+			}
+			for _, item := range manifest.Items {
+				if got := string(content[item.Offset:min(item.Offset+int64(len(item.Value)), size)]); got != item.Value {
+					t.Fatalf("%v: %s at %d is %q, manifest says %q", opts, item.Type, item.Offset, got, item.Value)
+				}
+				if line := int64(strings.Count(string(content[:item.Offset]), "\n")) + 1; line != item.Line {
+					t.Fatalf("%v: %q is on line %d, manifest says %d", opts, item.Value, line, item.Line)
+				}
+			}
+			if found := len(piiPattern.FindAllIndex(content, -1)); found != len(manifest.Items) {
+				t.Errorf("%v, %d bytes: %d values in the text, %d in the manifest", opts, size, found, len(manifest.Items))
+			}
+			if size == 100000 && len(manifest.Items) == 0 {
+				t.Errorf("%v: nothing planted", opts)
+			}
+		}
+	}
+
+	for _, opts := range []ports.Options{
+		{"content": "pii", "txt-content": "random"},
+		{"content": "pii", "txt-line-length": "20"},
+		{"content": "pii", "pii-density": "2"},
+	} {
+		if _, err := New().(*TxtGenerator).Configure(opts); err == nil {
+			t.Errorf("Configure(%v) succeeded", opts)
+		}
+	}
+}
+
+func TestTxtGenerator_GenerateFrom(t *testing.T) {
+	g := New().(*TxtGenerator)
+	var _ ports.ResumableGenerator = g
+	const size, stop = 10000, 4321
+	dir := t.TempDir()
+
+	t.Run("Fixed-length lines", func(t *testing.T) {
+		opts := ports.Options{"txt-content": "words", "txt-line-length": "30"}
+		path := filepath.Join(dir, "lines.txt")
+		if err := g.GenerateWithOptions(path, size, opts); err != nil {
+			t.Fatal(err)
+		}
+		before, _ := os.ReadFile(path)
+		if err := g.GenerateFrom(path, size, opts, ports.ResumeState{Offset: stop}, nil); err != nil {
+			t.Fatalf("GenerateFrom returned unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(path)
+		if len(data) != size {
+			t.Fatalf("resumed file is %d bytes, want %d", len(data), size)
+		}
+		if kept := stop / 31 * 31; string(data[:kept]) != string(before[:kept]) {
+			t.Error("the lines before the one interrupted were not kept")
+		}
+		lines := strings.Split(string(data), "\n")
+		for i, line := range lines[:len(lines)-1] {
+			if n := utf8.RuneCountInString(line); n != 30 {
+				t.Fatalf("line %d has %d characters, want 30", i+1, n)
+			}
+		}
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		path := filepath.Join(dir, "random.txt")
+		if err := os.WriteFile(path, []byte(strings.Repeat("a", stop+10)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.GenerateFrom(path, size, nil, ports.ResumeState{Offset: stop}, nil); err != nil {
+			t.Fatalf("GenerateFrom returned unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(path)
+		if len(data) != size || strings.Count(string(data[:stop]), "a") != stop {
+			t.Errorf("resumed file is %d bytes, want %d with the first %d kept", len(data), size, stop)
+		}
+	})
+
+	t.Run("EICAR", func(t *testing.T) {
+		err := g.GenerateFrom(filepath.Join(dir, "eicar.txt"), size, ports.Options{"eicar": "true"}, ports.ResumeState{}, nil)
+		if err == nil || !strings.Contains(err.Error(), "cannot be resumed") {
+			t.Errorf("GenerateFrom() error = %v, want it refused", err)
+		}
+	})
+}
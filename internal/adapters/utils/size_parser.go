@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"fmt"
+	"os"
+	"strings"
+
 	"github.com/hailam/genfile/internal/ports"
 	"github.com/hailam/genfile/internal/utils"
 )
@@ -13,7 +17,23 @@ func NewUtilSizeParser() ports.SizeParser {
 	return &UtilSizeParser{}
 }
 
-// Parse uses the existing utility function to parse the size string.
+// Parse uses the existing utility function to parse the size string. A
+// spec of the form "@path" is instead the size of the file at path.
 func (p *UtilSizeParser) Parse(spec string) (int64, error) {
+	if path, ok := strings.CutPrefix(spec, "@"); ok {
+		return sizeOf(path)
+	}
 	return utils.ParseSize(spec) //
 }
+
+// sizeOf returns the size of the regular file at path.
+func sizeOf(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read the reference file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return 0, fmt.Errorf("reference %s is not a regular file", path)
+	}
+	return info.Size(), nil
+}
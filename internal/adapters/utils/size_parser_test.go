@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUtilSizeParser_Parse(t *testing.T) {
+	dir := t.TempDir()
+	ref := filepath.Join(dir, "ref.bin")
+	if err := os.WriteFile(ref, make([]byte, 12345), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	parser := NewUtilSizeParser()
+
+	testCases := []struct {
+		spec   string
+		want   int64
+		errSub string
+	}{
+		{spec: "10KiB", want: 10240},
+		{spec: "@" + ref, want: 12345},
+		{spec: "@" + filepath.Join(dir, "missing.bin"), errSub: "reference file"},
+		{spec: "@" + dir, errSub: "not a regular file"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			got, err := parser.Parse(tc.spec)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("Parse(%q) error = %v, want error containing %q", tc.spec, err, tc.errSub)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("Parse(%q) = %d, %v, want %d", tc.spec, got, err, tc.want)
+			}
+		})
+	}
+}
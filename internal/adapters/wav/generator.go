@@ -1,11 +1,16 @@
 package wav
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
-	"os"
+	"io"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
 	"github.com/hailam/genfile/internal/utils"
 )
@@ -14,91 +19,406 @@ func init() {
 	factory.RegisterGenerator(ports.FileTypeWAV, New()) //
 }
 
-type WavGenerator struct{}
+type WavGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &WavGenerator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *WavGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *WavGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// SizeStep returns 2: RIFF chunks are padded to even lengths.
+func (g *WavGenerator) SizeStep() int64 {
+	return 2
+}
+
+// Audio content modes for the data chunk.
+const (
+	ContentNoise   = "noise"
+	ContentSine    = "sine"
+	ContentSilence = "silence"
+)
+
+const (
+	// headerSize is the RIFF header, PCM fmt chunk and data chunk header.
+	headerSize = 44
+	// junkHeaderLen is the id and size of a JUNK chunk.
+	junkHeaderLen = 8
+	// maxSize is the largest file the 32-bit RIFF chunk size can describe.
+	maxSize = math.MaxUint32 + 8
+	// sineAmplitude scales the tone to half of full scale.
+	sineAmplitude = 0.5
+)
+
+// wavOptions holds the settings the WAV generator reads from ports.Options.
+type wavOptions struct {
+	sampleRate int
+	bits       int
+	channels   int
+	content    string
+	frequency  float64
+	threads    int         // goroutines making the samples
+	rand       *utils.Rand // of the noise
+}
+
+func parseOptions(opts ports.Options) (wavOptions, error) {
+	var o wavOptions
+	var err error
+	if o.sampleRate, err = opts.Int("wav-sample-rate", 44100); err != nil {
+		return o, err
+	}
+	if o.sampleRate < 1 || o.sampleRate > 768000 {
+		return o, fmt.Errorf("wav-sample-rate must be between 1 and 768000, got %d", o.sampleRate)
+	}
+	if o.bits, err = opts.Int("wav-bits", 8); err != nil {
+		return o, err
+	}
+	if o.bits != 8 && o.bits != 16 && o.bits != 24 {
+		return o, fmt.Errorf("wav-bits must be 8, 16 or 24, got %d", o.bits)
+	}
+	if o.channels, err = opts.Int("wav-channels", 1); err != nil {
+		return o, err
+	}
+	if o.channels < 1 || o.channels > 8 {
+		return o, fmt.Errorf("wav-channels must be between 1 and 8, got %d", o.channels)
+	}
+	o.content = strings.ToLower(opts.String("wav-content", ContentNoise))
+	switch o.content {
+	case ContentNoise, ContentSine, ContentSilence:
+	default:
+		return o, fmt.Errorf("unknown wav content %q (want noise, sine or silence)", o.content)
+	}
+	freq, err := opts.Int("wav-frequency", 440)
+	if err != nil {
+		return o, err
+	}
+	if freq < 1 || freq > o.sampleRate/2 {
+		return o, fmt.Errorf("wav-frequency must be between 1 and half the sample rate (%d), got %d", o.sampleRate/2, freq)
+	}
+	o.frequency = float64(freq)
+	if o.threads, err = utils.ParseThreads(opts.String("threads", "")); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// blockAlign returns the size of one sample frame (a sample per channel).
+func (o wavOptions) blockAlign() int64 {
+	return int64(o.channels * o.bits / 8)
+}
+
+// ForDuration returns the generator and the size of a WAV file holding d of
+// audio at the configured sample rate, rounded to the nearest sample frame,
+// and to an even number of them when frames are of odd length, so that the
+// data chunk is even.
+func (g *WavGenerator) ForDuration(d time.Duration) (ports.FileGenerator, int64, error) {
+	o, err := parseOptions(g.opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if d <= 0 {
+		return nil, 0, fmt.Errorf("duration must be positive, got %s", d)
+	}
+	frames := math.Round(d.Seconds() * float64(o.sampleRate))
+	if o.blockAlign()%2 == 1 {
+		frames = 2 * math.Round(frames/2)
+	}
+	size := headerSize + frames*float64(o.blockAlign())
+	if size > maxSize {
+		return nil, 0, fmt.Errorf("%s of WAV audio takes more than %d bytes (4GiB RIFF limit)", d, int64(maxSize))
+	}
+	return g, int64(size), nil
+}
+
 func (g *WavGenerator) Generate(path string, size int64) error {
-	// WAV header is 44 bytes for PCM 8-bit mono.
-	if size < 44 {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes a PCM WAV file of exactly size bytes. opts may
+// set the sample rate, bit depth, channel count and whether the samples are
+// white noise, a sine tone or silence. The data chunk holds whole sample
+// frames only; when the space after the header is not a multiple of the
+// frame size, a JUNK chunk after the data takes up the remainder. Every
+// chunk is of even length, as RIFF has them, so the size must be even.
+// "threads" makes the samples on that many goroutines.
+func (g *WavGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	return g.GenerateFrom(path, size, opts, ports.ResumeState{}, nil)
+}
+
+// GenerateFrom writes the file GenerateWithOptions would. A run that
+// stopped in the samples is carried on from the last whole frame it
+// wrote, one that stopped in the JUNK chunk has the chunk written again,
+// and one that stopped in the header starts over.
+func (g *WavGenerator) GenerateFrom(path string, size int64, opts ports.Options, from ports.ResumeState, checkpoint func(ports.ResumeState) error) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if size < headerSize {
 		return fmt.Errorf("WAV size must be at least 44 bytes for header")
 	}
-	f, err := os.Create(path)
+	if size > maxSize {
+		return fmt.Errorf("WAV size must be at most %d bytes (4GiB RIFF limit), got %d", int64(maxSize), size)
+	}
+	dataBytes, junkBytes, err := layout(size-headerSize, o.blockAlign())
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	dataBytes := size - 44
-	var buf [4]byte
+	frame := o.blockAlign()
+	var start int64
+	switch off := min(from.Offset, size); {
+	case off < headerSize:
+	case off < headerSize+dataBytes:
+		start = headerSize + (off-headerSize)/frame*frame
+	default:
+		start = headerSize + dataBytes
+	}
 
-	// RIFF header
-	// ChunkID "RIFF"
-	if _, err := f.Write([]byte("RIFF")); err != nil {
+	f, err := outputfs.Resume(g.fs, path, start)
+	if err != nil {
 		return err
 	}
-	// ChunkSize (4 bytes) = 36 + dataBytes (size-8 overall).
-	riffSize := uint32(size - 8)
-	binary.LittleEndian.PutUint32(buf[:4], riffSize)
-	if _, err := f.Write(buf[:4]); err != nil {
-		return err
+	defer f.Close()
+	cw := outputfs.NewCheckpointer(f, start, checkpoint)
+	bw := bufio.NewWriter(cw)
+	if start == 0 {
+		cw.Phase = "header"
+		writeHeader(bw, o, size, dataBytes)
 	}
-	// Format "WAVE"
-	if _, err := f.Write([]byte("WAVE")); err != nil {
-		return err
+	if start < headerSize+dataBytes {
+		cw.Phase = "data"
+		first := (max(start, headerSize) - headerSize) / frame
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		// Without checkpoints to save, the samples go straight to the
+		// file, to be written at their offsets.
+		out := io.Writer(cw)
+		if checkpoint == nil {
+			out = f
+		}
+		if err := utils.WriteParallel(out, dataBytes-first*frame, o.threads, sampleFill(o, first)); err != nil {
+			return err
+		}
 	}
-	// Subchunk1 ID "fmt "
-	if _, err := f.Write([]byte("fmt ")); err != nil {
-		return err
+	if junkBytes > 0 {
+		cw.Phase = "junk"
+		writeJunkHeader(bw, dataBytes, junkBytes)
+		bw.Write(make([]byte, junkBytes-junkHeaderLen))
 	}
-	// Subchunk1 size (PCM) = 16
-	binary.LittleEndian.PutUint32(buf[:4], 16)
-	if _, err := f.Write(buf[:4]); err != nil {
+
+	if err := bw.Flush(); err != nil {
 		return err
 	}
-	// Audio format (PCM=1), 2 bytes
-	binary.LittleEndian.PutUint16(buf[:2], 1)
-	if _, err := f.Write(buf[:2]); err != nil {
-		return err
+	return f.Sync()
+}
+
+// FreeTail reports what the file ends in as free: the body of the JUNK
+// chunk if it has one, and the samples otherwise.
+func (g *WavGenerator) FreeTail(size int64, opts ports.Options) (int64, []byte) {
+	o, err := parseOptions(g.opts.With(opts))
+	if err != nil || size < headerSize {
+		return 0, nil
 	}
-	// NumChannels = 1 (mono), 2 bytes
-	binary.LittleEndian.PutUint16(buf[:2], 1)
-	if _, err := f.Write(buf[:2]); err != nil {
+	dataBytes, junkBytes, err := layout(size-headerSize, o.blockAlign())
+	switch {
+	case err != nil:
+		return 0, nil
+	case junkBytes > 0:
+		return junkBytes - junkHeaderLen, nil
+	}
+	return dataBytes, nil
+}
+
+// GenerateAllocated writes the header GenerateWithOptions would and
+// extends the file to size with mode, leaving all samples zero (silence
+// at 16 and 24 bits). The wav-content option is ignored.
+func (g *WavGenerator) GenerateAllocated(path string, size int64, mode ports.Allocation, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
 		return err
 	}
-	// SampleRate = 44100, 4 bytes
-	binary.LittleEndian.PutUint32(buf[:4], 44100)
-	if _, err := f.Write(buf[:4]); err != nil {
+	if size < headerSize {
+		return fmt.Errorf("WAV size must be at least 44 bytes for header")
+	}
+	if size > maxSize {
+		return fmt.Errorf("WAV size must be at most %d bytes (4GiB RIFF limit), got %d", int64(maxSize), size)
+	}
+	dataBytes, junkBytes, err := layout(size-headerSize, o.blockAlign())
+	if err != nil {
 		return err
 	}
-	// ByteRate = SampleRate * NumChannels * BitsPerSample/8. For 8-bit mono: 44100 * 1 * 1 = 44100.
-	binary.LittleEndian.PutUint32(buf[:4], 44100)
-	if _, err := f.Write(buf[:4]); err != nil {
+	preallocate := mode == ports.AllocatePreallocate
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
 		return err
 	}
-	// BlockAlign = NumChannels * BitsPerSample/8 = 1*1 = 1 (1 byte per sample frame)
-	binary.LittleEndian.PutUint16(buf[:2], 1)
-	if _, err := f.Write(buf[:2]); err != nil {
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	writeHeader(bw, o, size, dataBytes)
+	if err := bw.Flush(); err != nil {
 		return err
 	}
-	// BitsPerSample = 8
-	binary.LittleEndian.PutUint16(buf[:2], 8)
-	if _, err := f.Write(buf[:2]); err != nil {
+	if err := utils.Extend(f, headerSize+dataBytes, preallocate); err != nil {
 		return err
 	}
-	// Subchunk2 ID "data"
-	if _, err := f.Write([]byte("data")); err != nil {
+	if junkBytes > 0 {
+		writeJunkHeader(bw, dataBytes, junkBytes)
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := utils.Extend(f, size, preallocate); err != nil {
 		return err
 	}
+	return f.Close()
+}
+
+// writeHeader writes the RIFF header, fmt chunk and data chunk header of a
+// size-byte file holding dataBytes of samples.
+func writeHeader(bw *bufio.Writer, o wavOptions, size, dataBytes int64) {
+	var buf [4]byte
+	// RIFF header
+	// ChunkID "RIFF"
+	bw.WriteString("RIFF")
+	// ChunkSize (4 bytes) = size-8 overall.
+	binary.LittleEndian.PutUint32(buf[:4], uint32(size-8))
+	bw.Write(buf[:4])
+	// Format "WAVE"
+	bw.WriteString("WAVE")
+	// Subchunk1 ID "fmt "
+	bw.WriteString("fmt ")
+	// Subchunk1 size (PCM) = 16
+	binary.LittleEndian.PutUint32(buf[:4], 16)
+	bw.Write(buf[:4])
+	// Audio format (PCM=1), 2 bytes
+	binary.LittleEndian.PutUint16(buf[:2], 1)
+	bw.Write(buf[:2])
+	// NumChannels, 2 bytes
+	binary.LittleEndian.PutUint16(buf[:2], uint16(o.channels))
+	bw.Write(buf[:2])
+	// SampleRate, 4 bytes
+	binary.LittleEndian.PutUint32(buf[:4], uint32(o.sampleRate))
+	bw.Write(buf[:4])
+	// ByteRate = SampleRate * NumChannels * BitsPerSample/8
+	binary.LittleEndian.PutUint32(buf[:4], uint32(int64(o.sampleRate)*o.blockAlign()))
+	bw.Write(buf[:4])
+	// BlockAlign = NumChannels * BitsPerSample/8 (bytes per sample frame)
+	binary.LittleEndian.PutUint16(buf[:2], uint16(o.blockAlign()))
+	bw.Write(buf[:2])
+	// BitsPerSample
+	binary.LittleEndian.PutUint16(buf[:2], uint16(o.bits))
+	bw.Write(buf[:2])
+
+	// Subchunk2 ID "data"
+	bw.WriteString("data")
 	// Subchunk2 size = dataBytes
 	binary.LittleEndian.PutUint32(buf[:4], uint32(dataBytes))
-	if _, err := f.Write(buf[:4]); err != nil {
-		return err
+	bw.Write(buf[:4])
+}
+
+// writeJunkHeader writes the pad byte an odd data chunk needs and the
+// header of the JUNK chunk absorbing the bytes that do not make a whole
+// frame. The caller supplies the junkBytes-junkHeaderLen bytes of its body.
+func writeJunkHeader(bw *bufio.Writer, dataBytes, junkBytes int64) {
+	var buf [4]byte
+	if dataBytes%2 == 1 {
+		bw.WriteByte(0)
 	}
-	// Now write dataBytes of random audio samples (8-bit each)
-	if err := utils.WriteRandomBytes(f, dataBytes); err != nil {
-		return err
+	bw.WriteString("JUNK")
+	binary.LittleEndian.PutUint32(buf[:4], uint32(junkBytes-junkHeaderLen))
+	bw.Write(buf[:4])
+}
+
+// layout splits the avail bytes after the header into a data chunk of whole
+// frames and a trailing JUNK chunk of at least junkHeaderLen bytes. An odd
+// data chunk followed by JUNK is followed by its pad byte; as avail must be
+// even, a data chunk that is last and the JUNK chunk are even and need none.
+func layout(avail, frame int64) (dataBytes, junkBytes int64, err error) {
+	if avail%2 != 0 {
+		return 0, 0, fmt.Errorf("target %d is odd; WAV files are made of even-length chunks", avail+headerSize)
+	}
+	for dataBytes = avail / frame * frame; dataBytes >= 0; dataBytes -= frame {
+		if dataBytes == avail {
+			return dataBytes, 0, nil
+		}
+		junkBytes = avail - dataBytes - dataBytes%2
+		if junkBytes >= junkHeaderLen {
+			return dataBytes, junkBytes, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("cannot lay out a %d-byte WAV with %d-byte sample frames; choose a slightly larger size", avail+headerSize, frame)
+}
+
+// sampleFill returns a function filling a buffer with the bytes of the
+// sample frames from frame first on at its offset, in any order.
+func sampleFill(o wavOptions, first int64) func([]byte, int64) error {
+	if o.content == ContentNoise {
+		return func(b []byte, offset int64) error {
+			return o.rand.FillAt(b, first*o.blockAlign()+offset)
+		}
+	}
+	return func(b []byte, offset int64) error {
+		frame := make([]byte, o.blockAlign())
+		for i := 0; i < len(b); {
+			at := offset + int64(i)
+			encodeFrame(frame, o, first+at/o.blockAlign())
+			i += copy(b[i:], frame[at%o.blockAlign():])
+		}
+		return nil
+	}
+}
+
+// encodeFrame stores frame i, the same sample on every channel, in dst.
+func encodeFrame(dst []byte, o wavOptions, i int64) {
+	v := 0.0
+	if o.content == ContentSine {
+		v = sineAmplitude * math.Sin(2*math.Pi*o.frequency*float64(i)/float64(o.sampleRate))
+	}
+	sampleBytes := o.bits / 8
+	encodeSample(dst[:sampleBytes], v)
+	for c := 1; c < o.channels; c++ {
+		copy(dst[c*sampleBytes:], dst[:sampleBytes])
+	}
+}
+
+// encodeSample stores v, in [-1, 1], as a little-endian PCM sample of
+// len(dst) bytes. 8-bit PCM is unsigned with silence at 128; wider samples
+// are signed.
+func encodeSample(dst []byte, v float64) {
+	if len(dst) == 1 {
+		dst[0] = byte(128 + int(math.Round(v*127)))
+		return
+	}
+	maxVal := float64(int64(1)<<(8*len(dst)-1) - 1)
+	s := int32(math.Round(v * maxVal))
+	for i := range dst {
+		dst[i] = byte(s >> (8 * i))
 	}
-	return f.Sync()
 }
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hailam/genfile/internal/ports" //
 )
@@ -215,3 +216,282 @@ func checkWavHeader(t *testing.T, path string, totalSize int64) {
 		t.Errorf("Header bytes 40-43 (Data Size): got %d, want %d", actualDataSize, expectedDataSize)
 	}
 }
+
+func TestWavGenerator_GenerateWithOptions(t *testing.T) {
+	generator := &WavGenerator{}
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name         string
+		size         int64
+		opts         ports.Options
+		channels     int
+		sampleRate   int
+		bits         int
+		errSubstring string
+	}{
+		{name: "Stereo16", size: 10*1024 + 2, opts: ports.Options{"wav-bits": "16", "wav-channels": "2"}, channels: 2, sampleRate: 44100, bits: 16},
+		{name: "Mono24Sine", size: 4000, opts: ports.Options{"wav-bits": "24", "wav-sample-rate": "48000", "wav-content": "sine"}, channels: 1, sampleRate: 48000, bits: 24},
+		{name: "Stereo24Silence", size: 5002, opts: ports.Options{"wav-bits": "24", "wav-channels": "2", "wav-content": "silence"}, channels: 2, sampleRate: 44100, bits: 24},
+		{name: "Mono8Silence", size: 102, opts: ports.Options{"wav-content": "silence"}, channels: 1, sampleRate: 44100, bits: 8},
+		{name: "HeaderOnly", size: wavHeaderSize, opts: ports.Options{"wav-bits": "16", "wav-channels": "2"}, channels: 2, sampleRate: 44100, bits: 16},
+		{name: "NoRoomForJunk", size: wavHeaderSize + 6, opts: ports.Options{"wav-bits": "16", "wav-channels": "2"}, errSubstring: "cannot lay out"},
+		{name: "OddSize", size: 5003, opts: ports.Options{"wav-bits": "24", "wav-channels": "2"}, errSubstring: "odd"},
+		{name: "BadBits", size: 1024, opts: ports.Options{"wav-bits": "12"}, errSubstring: "wav-bits"},
+		{name: "BadContent", size: 1024, opts: ports.Options{"wav-content": "music"}, errSubstring: "unknown wav content"},
+		{name: "FrequencyAboveNyquist", size: 1024, opts: ports.Options{"wav-sample-rate": "8000", "wav-frequency": "5000"}, errSubstring: "wav-frequency"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("opts_%s.wav", tc.name))
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.errSubstring != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSubstring) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSubstring, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, tc.size)
+
+			content, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks := readChunks(t, content)
+			fmtChunk, data := chunks["fmt "], chunks["data"]
+			if fmtChunk == nil || data == nil {
+				t.Fatalf("missing fmt or data chunk, got %v", chunks)
+			}
+			le := binary.LittleEndian
+			blockAlign := tc.channels * tc.bits / 8
+			if got := int(le.Uint16(fmtChunk[2:])); got != tc.channels {
+				t.Errorf("channels = %d, want %d", got, tc.channels)
+			}
+			if got := int(le.Uint32(fmtChunk[4:])); got != tc.sampleRate {
+				t.Errorf("sample rate = %d, want %d", got, tc.sampleRate)
+			}
+			if got := int(le.Uint32(fmtChunk[8:])); got != tc.sampleRate*blockAlign {
+				t.Errorf("byte rate = %d, want %d", got, tc.sampleRate*blockAlign)
+			}
+			if got := int(le.Uint16(fmtChunk[12:])); got != blockAlign {
+				t.Errorf("block align = %d, want %d", got, blockAlign)
+			}
+			if got := int(le.Uint16(fmtChunk[14:])); got != tc.bits {
+				t.Errorf("bits per sample = %d, want %d", got, tc.bits)
+			}
+			if len(data)%blockAlign != 0 {
+				t.Errorf("data chunk of %d bytes is not whole %d-byte frames", len(data), blockAlign)
+			}
+
+			switch tc.opts["wav-content"] {
+			case "silence":
+				silent := byte(0)
+				if tc.bits == 8 {
+					silent = 128
+				}
+				for i, b := range data {
+					if b != silent {
+						t.Fatalf("data byte %d = %d, want silence %d", i, b, silent)
+					}
+				}
+			case "sine":
+				// 24-bit samples: the first is zero, and the peak is half of full scale.
+				peak := int32(0)
+				for i := 0; i+3 <= len(data); i += 3 {
+					s := int32(uint32(data[i])<<8|uint32(data[i+1])<<16|uint32(data[i+2])<<24) >> 8
+					peak = max(peak, s)
+				}
+				if data[0] != 0 || data[1] != 0 || data[2] != 0 {
+					t.Errorf("first sine sample = % x, want zero", data[:3])
+				}
+				if want := int32(1 << 22); peak < want-64 || peak > want {
+					t.Errorf("sine peak = %d, want about %d", peak, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWavGenerator_ForDuration(t *testing.T) {
+	testCases := []struct {
+		name         string
+		duration     time.Duration
+		opts         ports.Options
+		frames       int64
+		errSubstring string
+	}{
+		{name: "Defaults", duration: 2 * time.Second, frames: 88200},
+		{name: "Stereo16", duration: 1500 * time.Millisecond, opts: ports.Options{"wav-bits": "16", "wav-channels": "2", "wav-sample-rate": "48000"}, frames: 72000},
+		{name: "RoundedToFrame", duration: time.Second / 3, opts: ports.Options{"wav-sample-rate": "16000", "wav-bits": "16"}, frames: 5333},
+		{name: "RoundedToEvenFrames", duration: time.Second / 3, opts: ports.Options{"wav-sample-rate": "8000"}, frames: 2668},
+		{name: "Zero", duration: 0, errSubstring: "must be positive"},
+		{name: "PastRIFFLimit", duration: 7 * time.Hour, opts: ports.Options{"wav-bits": "24", "wav-channels": "2", "wav-sample-rate": "48000"}, errSubstring: "4GiB"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := (&WavGenerator{}).Configure(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sized, size, err := g.(ports.DurationGenerator).ForDuration(tc.duration)
+			if tc.errSubstring != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSubstring) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSubstring, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ForDuration returned unexpected error: %v", err)
+			}
+			outPath := filepath.Join(t.TempDir(), "duration.wav")
+			if err := sized.Generate(outPath, size); err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks := readChunks(t, content)
+			blockAlign := int64(binary.LittleEndian.Uint16(chunks["fmt "][12:]))
+			if got := int64(len(chunks["data"])) / blockAlign; got != tc.frames || chunks["JUNK"] != nil {
+				t.Errorf("data chunk holds %d frames (JUNK chunk %v), want %d and no JUNK", got, chunks["JUNK"] != nil, tc.frames)
+			}
+		})
+	}
+}
+
+// readChunks returns the payload of each top-level RIFF chunk by id.
+func readChunks(t *testing.T, content []byte) map[string][]byte {
+	t.Helper()
+	if string(content[0:4]) != "RIFF" || string(content[8:12]) != "WAVE" {
+		t.Fatalf("not a RIFF WAVE file")
+	}
+	if got := int(binary.LittleEndian.Uint32(content[4:8])); got != len(content)-8 {
+		t.Errorf("RIFF size = %d, want %d", got, len(content)-8)
+	}
+	chunks := map[string][]byte{}
+	for off := 12; off < len(content); {
+		if off+8 > len(content) {
+			t.Fatalf("truncated chunk header at offset %d", off)
+		}
+		id, n := string(content[off:off+4]), int(binary.LittleEndian.Uint32(content[off+4:off+8]))
+		if off+8+n > len(content) {
+			t.Fatalf("chunk %q of %d bytes runs past the end of the file", id, n)
+		}
+		chunks[id] = content[off+8 : off+8+n]
+		off += 8 + n + n&1
+	}
+	return chunks
+}
+
+func TestWavGenerator_GenerateAllocated(t *testing.T) {
+	generator := &WavGenerator{}
+	var _ ports.AllocatingGenerator = generator
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name         string
+		mode         ports.Allocation
+		size         int64
+		opts         ports.Options
+		errSubstring string
+	}{
+		{name: "Sparse", mode: ports.AllocateSparse, size: 1 << 20},
+		{name: "PreallocateWithJunk", mode: ports.AllocatePreallocate, size: 10*1024 + 2, opts: ports.Options{"wav-bits": "16", "wav-channels": "2"}},
+		{name: "TooSmall", mode: ports.AllocateSparse, size: 10, errSubstring: "at least 44 bytes"},
+		{name: "TooLarge", mode: ports.AllocateSparse, size: 5 << 30, errSubstring: "4GiB"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, tc.name+".wav")
+			err := generator.GenerateAllocated(outPath, tc.size, tc.mode, tc.opts)
+			if tc.errSubstring != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSubstring) {
+					t.Fatalf("expected error containing %q, got %v", tc.errSubstring, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateAllocated returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, tc.size)
+			content, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks := readChunks(t, content)
+			data := chunks["data"]
+			if chunks["fmt "] == nil || data == nil {
+				t.Fatalf("missing fmt or data chunk, got %v", chunks)
+			}
+			for i, b := range data {
+				if b != 0 {
+					t.Fatalf("data byte %d = %d, want 0", i, b)
+				}
+			}
+		})
+	}
+}
+
+func TestWavGenerator_GenerateFrom(t *testing.T) {
+	g := New().(*WavGenerator)
+	var _ ports.ResumableGenerator = g
+	const size = headerSize + 4*10000 + 14
+	dir := t.TempDir()
+	for _, opts := range []ports.Options{
+		{"wav-content": "sine", "wav-bits": "16", "wav-channels": "2"},
+		{"wav-content": "noise", "wav-bits": "16", "wav-channels": "2", "seed": "7"},
+	} {
+		fresh := filepath.Join(dir, "fresh.wav")
+		if err := g.GenerateWithOptions(fresh, size, opts); err != nil {
+			t.Fatalf("GenerateWithOptions(%v) returned unexpected error: %v", opts, err)
+		}
+		want, _ := os.ReadFile(fresh)
+		for _, stop := range []int64{20, headerSize + 4*5000 + 3, size - 5} {
+			path := filepath.Join(dir, fmt.Sprintf("resumed%d.wav", stop))
+			if err := os.WriteFile(path, want[:stop], 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := g.GenerateFrom(path, size, opts, ports.ResumeState{Offset: stop}, nil); err != nil {
+				t.Fatalf("GenerateFrom(%v, %d) returned unexpected error: %v", opts, stop, err)
+			}
+			if got, _ := os.ReadFile(path); string(got) != string(want) {
+				t.Errorf("%v: resumed at %d, the file differs from one written in one go", opts, stop)
+			}
+		}
+	}
+}
+
+func TestWavGenerator_Threads(t *testing.T) {
+	g := New().(*WavGenerator)
+	dir := t.TempDir()
+	const size = 3<<20 + 6
+	for _, opts := range []ports.Options{
+		{"wav-content": "sine", "wav-bits": "24", "wav-channels": "2"},
+		{"wav-content": "silence", "wav-bits": "8"},
+	} {
+		serial, threaded := filepath.Join(dir, "serial.wav"), filepath.Join(dir, "threaded.wav")
+		if err := g.GenerateWithOptions(serial, size, opts); err != nil {
+			t.Fatalf("GenerateWithOptions(%v) returned unexpected error: %v", opts, err)
+		}
+		if err := g.GenerateWithOptions(threaded, size, ports.Options{"threads": "4"}.With(opts)); err != nil {
+			t.Fatalf("GenerateWithOptions(%v) with 4 threads returned unexpected error: %v", opts, err)
+		}
+		want, _ := os.ReadFile(serial)
+		if got, _ := os.ReadFile(threaded); string(got) != string(want) {
+			t.Errorf("%v: made on 4 threads, the file differs from one made on one", opts)
+		}
+	}
+
+	noise := filepath.Join(dir, "noise.wav")
+	if err := g.GenerateWithOptions(noise, size, ports.Options{"wav-content": "noise", "threads": "4"}); err != nil {
+		t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+	}
+	if info, err := os.Stat(noise); err != nil || info.Size() != size {
+		t.Errorf("noise on 4 threads: stat = %v, %v, want %d bytes", info, err, size)
+	}
+}
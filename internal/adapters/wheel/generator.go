@@ -0,0 +1,297 @@
+package wheel
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeWHL, New())
+}
+
+// WheelGenerator writes Python wheels: a zip of an import package holding
+// one file of random data that pads the wheel, and the .dist-info
+// directory with the wheel's metadata and its RECORD of file hashes.
+type WheelGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &WheelGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *WheelGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *WheelGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	defaultName    = "genfile-fixture"
+	defaultVersion = "1.0.0"
+	// maxSize keeps the archive clear of ZIP64, whose extra fields would
+	// change its layout.
+	maxSize = 1<<32 - 1
+)
+
+var (
+	// nameRe matches distribution names that also make an import package
+	// once normalized: they start with a letter.
+	nameRe = regexp.MustCompile(`^[A-Za-z](?:[A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+	// versionRe matches the public versions of PEP 440 in their normal
+	// form, with an optional local label.
+	versionRe = regexp.MustCompile(`^[0-9]+(?:\.[0-9]+)*(?:(?:a|b|rc)[0-9]+)?(?:\.post[0-9]+)?(?:\.dev[0-9]+)?(?:\+[a-z0-9]+(?:\.[a-z0-9]+)*)?$`)
+	// separatorRe matches the runs of separators a distribution name's
+	// normalized form replaces with an underscore.
+	separatorRe = regexp.MustCompile(`[-_.]+`)
+)
+
+// wheelOptions holds the settings the wheel generator reads from
+// ports.Options.
+type wheelOptions struct {
+	name, version string
+	modTime       time.Time    // zero for the time of generation
+	filler        utils.Filler // of the payload
+	rand          *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (wheelOptions, error) {
+	o := wheelOptions{
+		name:    opts.String("pkg-name", defaultName),
+		version: opts.String("pkg-version", defaultVersion),
+	}
+	if !nameRe.MatchString(o.name) {
+		return o, fmt.Errorf("invalid package name %q: use letters, digits, '-', '_' and '.', starting with a letter", o.name)
+	}
+	if !versionRe.MatchString(o.version) {
+		return o, fmt.Errorf("invalid package version %q: use a PEP 440 version such as %s", o.version, defaultVersion)
+	}
+	var err error
+	if o.modTime, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	if o.filler, err = utils.ParseFiller(o.rand, opts.String("entropy", ""), opts.String("shared-blocks", ""), opts.String("shared-pool", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *WheelGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes a pure-Python wheel of exactly size bytes,
+// at most 4 GiB. The distribution is named "pkg-name" (genfile-fixture)
+// at version "pkg-version" (1.0.0), and installs an import package of the
+// normalized name holding payload.bin, random data that makes up the
+// size. The "mtime" option dates the entries; "entropy" sets the share of
+// the payload that is random, the rest repeating a pattern, and
+// "shared-blocks" the share copied from the "shared-pool" chunk pool.
+func (g *WheelGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.modTime.IsZero() {
+		o.modTime = time.Now()
+	}
+	w, err := layout(o, size)
+	if err != nil {
+		return err
+	}
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriterSize(f, 1<<20)
+	if err := w.write(bw, true); err != nil {
+		return fmt.Errorf("failed to write wheel: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write wheel: %w", err)
+	}
+	return f.Sync()
+}
+
+// wheel is the layout of a wheel.
+type wheel struct {
+	o       wheelOptions
+	payload int64 // size of payload.bin
+	// blankLine ends __init__.py, which is stored, with a blank line for
+	// the sizes the payload alone cannot reach: those where its size in
+	// RECORD gains a digit.
+	blankLine bool
+}
+
+// layout sizes the payload of a wheel of exactly size bytes.
+func layout(o wheelOptions, size int64) (wheel, error) {
+	if size > maxSize {
+		return wheel{}, fmt.Errorf("target %d too large for a wheel; the limit is %d bytes", size, int64(maxSize))
+	}
+	for _, blankLine := range []bool{false, true} {
+		w := wheel{o: o, blankLine: blankLine}
+		for i := 0; i < 4; i++ {
+			overhead, err := w.overhead()
+			if err != nil {
+				return w, err
+			}
+			if w.payload+overhead == size {
+				return w, nil
+			}
+			if size < overhead {
+				return w, fmt.Errorf("target %d too small for a wheel; the smallest is %d bytes", size, overhead)
+			}
+			w.payload = size - overhead
+		}
+	}
+	return wheel{}, fmt.Errorf("failed to converge on the layout for target size %d", size)
+}
+
+// overhead returns the size of the wheel without the payload's data,
+// which the zip stores as it is.
+func (w wheel) overhead() (int64, error) {
+	cw := &countingWriter{}
+	if err := w.write(cw, false); err != nil {
+		return 0, err
+	}
+	return cw.n, nil
+}
+
+// names returns the import package and the .dist-info directory of the
+// wheel, both named after the normalized distribution name.
+func (w wheel) names() (pkg, distInfo string) {
+	pkg = strings.ToLower(separatorRe.ReplaceAllString(w.o.name, "_"))
+	return pkg, pkg + "-" + w.o.version + ".dist-info/"
+}
+
+// write writes the wheel to w. Unless fill is set, payload.bin is left
+// empty and RECORD gives it a digest of zeros, to measure the rest.
+func (w wheel) write(out io.Writer, fill bool) error {
+	pkg, distInfo := w.names()
+	zw := zip.NewWriter(out)
+	var record strings.Builder
+	add := func(name string, method uint16, write func(io.Writer) error) error {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: w.o.modTime})
+		if err != nil {
+			return err
+		}
+		h := &hashWriter{h: sha256.New()}
+		if err := write(io.MultiWriter(fw, h)); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		digest, size := h.h.Sum(nil), h.n
+		if name == pkg+"/payload.bin" && !fill {
+			digest, size = make([]byte, sha256.Size), w.payload
+		}
+		fmt.Fprintf(&record, "%s,sha256=%s,%d\n", name, base64.RawURLEncoding.EncodeToString(digest), size)
+		return nil
+	}
+	text := func(s string) func(io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, s)
+			return err
+		}
+	}
+
+	initPy := `"""Test fixture generated by genfile."""` + "\n"
+	if w.blankLine {
+		initPy += "\n"
+	}
+	if err := add(pkg+"/__init__.py", zip.Store, text(initPy)); err != nil {
+		return err
+	}
+	payload := func(out io.Writer) error {
+		if !fill {
+			return nil
+		}
+		return w.o.filler.Write(w.o.rand, out, w.payload)
+	}
+	if err := add(pkg+"/payload.bin", zip.Store, payload); err != nil {
+		return err
+	}
+	if err := add(distInfo+"METADATA", zip.Deflate, text(w.metadata())); err != nil {
+		return err
+	}
+	if err := add(distInfo+"WHEEL", zip.Deflate, text("Wheel-Version: 1.0\nGenerator: genfile\nRoot-Is-Purelib: true\nTag: py3-none-any\n")); err != nil {
+		return err
+	}
+	// RECORD lists itself without a digest, and is stored so that its
+	// size does not depend on the payload's digest.
+	fmt.Fprintf(&record, "%sRECORD,,\n", distInfo)
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: distInfo + "RECORD", Method: zip.Store, Modified: w.o.modTime})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, record.String()); err != nil {
+		return fmt.Errorf("failed to write RECORD: %w", err)
+	}
+	return zw.Close()
+}
+
+// metadata returns the METADATA file of the distribution.
+func (w wheel) metadata() string {
+	pkg, _ := w.names()
+	return fmt.Sprintf(`Metadata-Version: 2.1
+Name: %s
+Version: %s
+Summary: Test fixture generated by genfile
+Requires-Python: >=3
+
+This distribution installs %s/payload.bin, a file of random data sized
+for load testing package indexes and tools.
+`, w.o.name, w.o.version, pkg)
+}
+
+// hashWriter hashes what is written to it, counting the bytes.
+type hashWriter struct {
+	h hash.Hash
+	n int64
+}
+
+func (w *hashWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return w.h.Write(p)
+}
+
+// countingWriter discards what is written to it, counting the bytes.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
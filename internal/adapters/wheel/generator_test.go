@@ -0,0 +1,107 @@
+package wheel
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestWheelGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name     string
+		size     int64
+		opts     ports.Options
+		distInfo string // want
+		errSub   string
+	}{
+		{name: "Default", size: 1 << 20, distInfo: "genfile_fixture-1.0.0.dist-info/"},
+		// The payload's size in RECORD gains a digit here: 11611 bytes
+		// takes the blank line in __init__.py.
+		{name: "Digits", size: 11610, distInfo: "genfile_fixture-1.0.0.dist-info/"},
+		{name: "DigitsBlankLine", size: 11611, distInfo: "genfile_fixture-1.0.0.dist-info/"},
+		{name: "DigitsNext", size: 11612, distInfo: "genfile_fixture-1.0.0.dist-info/"},
+		{name: "Options", size: 55555, opts: ports.Options{"pkg-name": "Foo.Bar_baz", "pkg-version": "2.0rc1+local.7"}, distInfo: "foo_bar_baz-2.0rc1+local.7.dist-info/"},
+		{name: "TooSmall", size: 1000, errSub: "too small"},
+		{name: "TooLarge", size: 1 << 32, errSub: "too large"},
+		{name: "BadName", size: 10000, opts: ports.Options{"pkg-name": "1password"}, errSub: "invalid package name"},
+		{name: "BadVersion", size: 10000, opts: ports.Options{"pkg-version": "v1"}, errSub: "invalid package version"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixture.whl")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("zip.NewReader() error = %v", err)
+			}
+			files := map[string][]byte{}
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("opening %s: %v", f.Name, err)
+				}
+				if files[f.Name], err = io.ReadAll(rc); err != nil {
+					t.Fatalf("reading %s: %v", f.Name, err)
+				}
+				rc.Close()
+			}
+			if !bytes.Contains(files[tc.distInfo+"WHEEL"], []byte("Tag: py3-none-any\n")) {
+				t.Errorf("WHEEL = %q", files[tc.distInfo+"WHEEL"])
+			}
+
+			// RECORD lists every other file with its digest and size.
+			rows, err := csv.NewReader(bytes.NewReader(files[tc.distInfo+"RECORD"])).ReadAll()
+			if err != nil {
+				t.Fatalf("reading RECORD: %v", err)
+			}
+			if len(rows) != len(files) {
+				t.Errorf("RECORD has %d rows for %d files", len(rows), len(files))
+			}
+			for _, row := range rows {
+				content, ok := files[row[0]]
+				if !ok {
+					t.Errorf("RECORD lists missing file %s", row[0])
+					continue
+				}
+				if row[0] == tc.distInfo+"RECORD" {
+					continue
+				}
+				sum := sha256.Sum256(content)
+				if want := "sha256=" + base64.RawURLEncoding.EncodeToString(sum[:]); row[1] != want {
+					t.Errorf("%s digest = %s, want %s", row[0], row[1], want)
+				}
+				if row[2] != strconv.Itoa(len(content)) {
+					t.Errorf("%s size = %s, want %d", row[0], row[2], len(content))
+				}
+			}
+		})
+	}
+}
@@ -3,9 +3,12 @@ package xlsx
 import (
 	"bytes"
 	"fmt"
-	"os"
+	"strings"
+	"time"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/logging"
+	"github.com/hailam/genfile/internal/adapters/ooxml"
 	"github.com/hailam/genfile/internal/ports"
 	"github.com/hailam/genfile/internal/utils"
 	"github.com/xuri/excelize/v2"
@@ -15,29 +18,79 @@ func init() {
 	factory.RegisterGenerator(ports.FileTypeXLSX, New()) //
 }
 
-type XlsxGenerator struct{}
+type XlsxGenerator struct {
+	opts ports.Options // set by Configure
+	log  ports.Logger
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &XlsxGenerator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *XlsxGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *XlsxGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// WithLogger returns a copy of the generator that reports to l.
+func (g *XlsxGenerator) WithLogger(l ports.Logger) ports.FileGenerator {
+	c := *g
+	c.log = l
+	return &c
+}
+
+func (g *XlsxGenerator) logger() ports.Logger {
+	if g.log == nil {
+		return logging.Nop
+	}
+	return g.log
+}
+
 // Generate creates an XLSX file, attempting to match the target size by adding cells
 // and then padding. This version optimizes by checking size in memory.
 func (g *XlsxGenerator) Generate(path string, targetSize int64) error {
-	// 1) Compute overhead of pad.bin entry using the utility function
-	padOH := utils.ZipEntryOverhead() //
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions is like Generate; with the "lang" option the cells
+// hold short phrases in that language, or with "corpus" from its files,
+// instead of random characters, and
+// "content" csv-injection mixes in formula-injection payloads.
+// "xlsx-sheets" spreads the cells over that many worksheets, and
+// "xlsx-padding" comment or extra pads the package in its zip comment or
+// the extra fields of its parts instead of a pad.bin entry.
+// "signature-placeholder" prepares the workbook for signing with an empty
+// signature origin part.
+func (g *XlsxGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	// 1) Compute overhead of the padding
+	padOH := o.padding.Overhead()
 
 	// --- Calculate Minimal Size (In Memory) ---
-	bufMinimal := &bytes.Buffer{}
-	f0 := excelize.NewFile()
-	// Add minimal content to ensure basic structure exists
-	f0.SetCellValue("Sheet1", "A1", "X")
-	if err := f0.Write(bufMinimal); err != nil {
-		return fmt.Errorf("failed to write minimal xlsx to buffer: %w", err)
+	minimal, err := minimalSize(o)
+	if err != nil {
+		return err
 	}
-	minimal := int64(bufMinimal.Len())
-	bufMinimal = nil // Release buffer memory
-	f0 = nil         // Release excelize object memory
 
 	// Check if target size is feasible
 	if minimal+padOH > targetSize {
@@ -48,26 +101,242 @@ func (g *XlsxGenerator) Generate(path string, targetSize int64) error {
 	}
 	if targetSize == minimal+padOH {
 		// If target size is exactly minimal + padding, generate minimal and pad
-		fMin := excelize.NewFile()
-		fMin.SetCellValue("Sheet1", "A1", "X")
-		if err := fMin.SaveAs(path); err != nil {
-			return fmt.Errorf("failed to save minimal xlsx file: %w", err)
+		bufMin := &bytes.Buffer{}
+		fMin, err := newWorkbook(o.sheets)
+		if err != nil {
+			return err
+		}
+		if err := writeWorkbook(fMin, bufMin, o); err != nil {
+			return fmt.Errorf("failed to write minimal xlsx to buffer: %w", err)
+		}
+		return ooxml.WritePaddedWith(g.fs, path, bufMin.Bytes(), targetSize, time.Time{}, o.padding)
+	}
+
+	finalCount, finalFileBuffer, err := g.fitCells(targetSize, minimal, padOH, o)
+	if err != nil {
+		return err
+	}
+
+	// --- Single Disk Write, with padding ---
+	g.logger().Debugf("XLSX: Writing final file content (derived from count %d) to %s, padded to %d", finalCount, path, targetSize)
+	return ooxml.WritePaddedWith(g.fs, path, finalFileBuffer.Bytes(), targetSize, time.Time{}, o.padding)
+}
+
+// Plan reports the workbook Generate would write for targetSize: the
+// number of cells, the size of the workbook and the padding that brings
+// it to the target.
+func (g *XlsxGenerator) Plan(targetSize int64) (ports.GenerationPlan, error) {
+	o, err := parseOptions(g.opts)
+	if err != nil {
+		return ports.GenerationPlan{}, err
+	}
+	padOH := o.padding.Overhead()
+	minimal, err := minimalSize(o)
+	if err != nil {
+		return ports.GenerationPlan{}, err
+	}
+	plan := ports.GenerationPlan{TargetSize: targetSize, MinSize: minimal + padOH}
+	if !plan.Feasible() {
+		return plan, nil
+	}
+	count, content := 0, minimal
+	if targetSize > minimal+padOH {
+		var buf *bytes.Buffer
+		po := o
+		po.cell = randomCell(o.rand)
+		if count, buf, err = g.fitCells(targetSize, minimal, padOH, po); err != nil {
+			return plan, err
 		}
-		return utils.PadZipExtend(path, targetSize) //
+		content = int64(buf.Len())
+	}
+	plan.ContentBytes = content
+	plan.PaddingBytes = targetSize - content
+	plan.Structure = []ports.PlanItem{{Name: "sheets", Count: int64(o.sheets)}, {Name: "cells", Count: int64(count) + 1}}
+	return plan, nil
+}
+
+// ForCount returns a generator of a workbook of c.N rows, and its size.
+// The rows, A1 and the cells beyond it, go round the sheets as they do for
+// Generate. The workbook is built in memory with the options the
+// generator was configured with, and written without a padding entry at
+// that size.
+func (g *XlsxGenerator) ForCount(c ports.Count) (ports.FileGenerator, int64, error) {
+	if c.Unit != ports.CountRows {
+		return nil, 0, fmt.Errorf("XLSX workbooks are counted in rows, not %s", c.Unit)
 	}
+	o, err := parseOptions(g.opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if most := int64(o.sheets) * (excelize.TotalRows - 1); c.N < 1 || c.N > most {
+		return nil, 0, fmt.Errorf("rows must be between 1 and %d for %d sheet(s), got %d", most, o.sheets, c.N)
+	}
+	f, err := newWorkbook(o.sheets)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := 0; i < int(c.N)-1; i++ {
+		setCell(f, o.sheets, i, o.cell())
+	}
+	var buf bytes.Buffer
+	if err := writeWorkbook(f, &buf, o); err != nil {
+		return nil, 0, fmt.Errorf("failed to write xlsx to buffer: %w", err)
+	}
+	return ooxml.Built{Package: buf.Bytes(), FS: g.fs}, int64(buf.Len()), nil
+}
+
+// Resize writes the workbook at srcPath to outPath with its parts as they
+// are and its padding entry sized to bring it to exactly targetSize.
+func (g *XlsxGenerator) Resize(srcPath, outPath string, targetSize int64) error {
+	return ooxml.Resize(g.fs, srcPath, outPath, targetSize)
+}
+
+// randomCell returns a function making the default cell content from r.
+func randomCell(r *utils.Rand) func() string {
+	return func() string { return r.String(20) }
+}
 
+// xlsxOptions holds the settings the XLSX generator reads from
+// ports.Options.
+type xlsxOptions struct {
+	cell    func() string // fills a cell
+	sheets  int           // worksheets the cells are spread over
+	padding ooxml.Padding // where the bytes past the workbook go
+	// signature adds an empty signature origin part, prepared for signing.
+	signature bool
+	rand      *utils.Rand
+}
+
+// parseOptions reads the cell content, the number of sheets and the
+// padding. Cells hold random characters, or a phrase in the language of
+// the "lang" option or from the "corpus" files. With "content" csv-injection about half the cells
+// hold formula-injection payloads, stored as text.
+func parseOptions(opts ports.Options) (xlsxOptions, error) {
+	var o xlsxOptions
+	var err error
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	o.cell = randomCell(o.rand)
+	if o.sheets, err = opts.Int("xlsx-sheets", 1); err != nil {
+		return o, err
+	}
+	if o.sheets < 1 || o.sheets > maxSheets {
+		return o, fmt.Errorf("xlsx-sheets must be between 1 and %d, got %d", maxSheets, o.sheets)
+	}
+	if o.padding, err = ooxml.ParsePadding(strings.ToLower(opts.String("xlsx-padding", "entry"))); err != nil {
+		return o, fmt.Errorf("xlsx-padding: %w", err)
+	}
+	if o.signature, err = opts.Bool("signature-placeholder", false); err != nil {
+		return o, err
+	}
+	text := o.cell
+	if opts.Has("lang") || opts.Has("corpus") {
+		lang, err := utils.TextLanguage(opts.String("lang", ""), opts.String("corpus", ""))
+		if err != nil {
+			return o, err
+		}
+		text = func() string { return lang.Phrase(o.rand, 2, 4) }
+	}
+	switch content := strings.ToLower(opts.String("content", "")); content {
+	case "":
+		o.cell = text
+	case utils.ContentCSVInjection:
+		o.cell = func() string {
+			if o.rand.IntN(2) == 0 {
+				return utils.InjectionPayload(o.rand)
+			}
+			return text()
+		}
+	default:
+		return o, fmt.Errorf("unknown content profile %q (want %s)", content, utils.ContentCSVInjection)
+	}
+	return o, nil
+}
+
+// writeWorkbook writes f to buf, with the signature origin part added if
+// o asks for it.
+func writeWorkbook(f *excelize.File, buf *bytes.Buffer, o xlsxOptions) error {
+	if err := f.Write(buf); err != nil {
+		return err
+	}
+	if !o.signature {
+		return nil
+	}
+	pkg, err := ooxml.AddSignatureOrigin(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	buf.Reset()
+	buf.Write(pkg)
+	return nil
+}
+
+// maxSheets bounds the "xlsx-sheets" option; each sheet adds about half
+// a kilobyte to the smallest workbook.
+const maxSheets = 1000
+
+// newWorkbook returns a workbook of sheets worksheets, Sheet1 to SheetN,
+// holding only the cell A1.
+func newWorkbook(sheets int) (*excelize.File, error) {
+	f := excelize.NewFile()
+	for i := 2; i <= sheets; i++ {
+		if _, err := f.NewSheet(fmt.Sprintf("Sheet%d", i)); err != nil {
+			return nil, fmt.Errorf("failed to add sheet %d: %w", i, err)
+		}
+	}
+	// Add minimal content to ensure basic structure exists
+	f.SetCellValue("Sheet1", "A1", "X")
+	return f, nil
+}
+
+// setCell fills the i-th cell beyond A1, counting from 0: the cells go
+// round the sheets, down column A from row 2.
+func setCell(f *excelize.File, sheets, i int, value string) {
+	cell, _ := excelize.CoordinatesToCellName(1, i/sheets+2)
+	f.SetCellValue(fmt.Sprintf("Sheet%d", i%sheets+1), cell, value)
+}
+
+// minimalSize returns the size of a workbook of o.sheets worksheets
+// holding only the cell A1.
+func minimalSize(o xlsxOptions) (int64, error) {
+	bufMinimal := &bytes.Buffer{}
+	f0, err := newWorkbook(o.sheets)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeWorkbook(f0, bufMinimal, o); err != nil {
+		return 0, fmt.Errorf("failed to write minimal xlsx to buffer: %w", err)
+	}
+	return int64(bufMinimal.Len()), nil
+}
+
+// maxCells bounds the cells of a workbook sized by Generate, some 2 MB of
+// them; a larger target is made up by the padding rather than built in
+// memory.
+const maxCells = 1 << 16
+
+// fitCells builds, in memory, the workbook with the most cells beyond A1
+// that still fits targetSize once the padding entry is added, up to
+// maxCells. It returns the number of extra cells, filled by o.cell across
+// o.sheets, and the workbook bytes. The count is tried at an estimate,
+// then searched for by halves below it.
+func (g *XlsxGenerator) fitCells(targetSize, minimal, padOH int64, o xlsxOptions) (int, *bytes.Buffer, error) {
 	// --- Estimate Average Bytes Per Cell (In Memory) ---
 	bufAvg := &bytes.Buffer{}
-	fAvg := excelize.NewFile()
-	const avgCellCount = 10
-	const avgCellContent = "XXXXXXXXXXXXXXXXXXXX" // 20 chars
-	for i := 1; i <= avgCellCount; i++ {
-		cell, _ := excelize.CoordinatesToCellName(1, i)
-		fAvg.SetCellValue("Sheet1", cell, avgCellContent)
-	}
-	if err := fAvg.Write(bufAvg); err != nil {
+	fAvg, err := newWorkbook(o.sheets)
+	if err != nil {
+		return 0, nil, err
+	}
+	// Sample the same random content the search writes, so that
+	// compression does not skew the estimate.
+	const avgCellCount = 100
+	for i := 0; i < avgCellCount; i++ {
+		setCell(fAvg, o.sheets, i, o.cell())
+	}
+	if err := writeWorkbook(fAvg, bufAvg, o); err != nil {
 		// Non-fatal? Log warning and use a default avgCell value.
-		fmt.Fprintf(os.Stderr, "Warning: failed to write avg xlsx to buffer: %v. Using default avgCell.\n", err)
+		g.logger().Warnf("failed to write avg xlsx to buffer: %v. Using default avgCell.", err)
 		avgCell := int64(50) // Default fallback average cell size
 		_ = avgCell          // Assign to avoid unused variable error if calculation below fails
 	}
@@ -92,33 +361,36 @@ func (g *XlsxGenerator) Generate(path string, targetSize int64) error {
 		// However, our minimal already includes A1, so start checking from 1.
 		estCount = 1
 	}
-	// Ensure estCount isn't excessively large if avgCell estimate was tiny
-	// Add a reasonable upper bound if needed, e.g., max 1 million cells?
+	estCount = min(estCount, maxCells)
 
 	var finalCount int = 0            // Use 0 to indicate not found yet
 	var finalFileBuffer *bytes.Buffer // Buffer to hold the data of the best-fitting file
 
-	fmt.Printf("XLSX: Target=%d, Minimal=%d, PadOH=%d, AvgCell=%d, EstCount=%d\n", targetSize, minimal, padOH, avgCell, estCount)
+	g.logger().Debugf("XLSX: Target=%d, Minimal=%d, PadOH=%d, AvgCell=%d, EstCount=%d", targetSize, minimal, padOH, avgCell, estCount)
 
-	// Iterate downwards from estimate to find the largest count that fits
-	for cnt := estCount; cnt >= 1; cnt-- {
+	// Try the estimate, then search below it for the largest count that fits
+	for lo, hi := int64(1), estCount; lo <= hi; {
+		cnt := lo + (hi-lo)/2
+		if hi == estCount {
+			cnt = hi
+		}
 		currentBuf := &bytes.Buffer{} // Create in-memory buffer for this iteration
-		f := excelize.NewFile()
 		// Always add the base cell A1 included in 'minimal' calculation
-		f.SetCellValue("Sheet1", "A1", "X")
+		f, err := newWorkbook(o.sheets)
+		if err != nil {
+			return 0, nil, err
+		}
 		// Add additional cells up to cnt
-		for r := 2; r <= int(cnt)+1; r++ { // Start from row 2, add 'cnt' more cells
-			cell, _ := excelize.CoordinatesToCellName(1, r)
-			// Use RandString or a fixed string for cell content
-			f.SetCellValue("Sheet1", cell, utils.RandString(20)) //
+		for i := 0; i < int(cnt); i++ {
+			setCell(f, o.sheets, i, o.cell())
 		}
 
 		// Write to buffer instead of disk
-		if err := f.Write(currentBuf); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Error writing xlsx (count %d) to buffer: %v\n", cnt, err)
+		if err := writeWorkbook(f, currentBuf, o); err != nil {
+			g.logger().Warnf("Error writing xlsx (count %d) to buffer: %v", cnt, err)
 			// Decide whether to continue or fail. Continuing might lead to wrong size.
 			// Let's return error here, as failing to write means we can't judge size.
-			return fmt.Errorf("error writing xlsx buffer for count %d: %w", cnt, err)
+			return 0, nil, fmt.Errorf("error writing xlsx buffer for count %d: %w", cnt, err)
 		}
 		f = nil // Release excelize object memory for this iteration
 
@@ -129,12 +401,11 @@ func (g *XlsxGenerator) Generate(path string, targetSize int64) error {
 			// This count fits. Store it and its buffer.
 			finalCount = int(cnt)
 			finalFileBuffer = currentBuf // Keep this buffer's content
-			fmt.Printf("XLSX: Found fit with Count=%d, Size=%d (Total with PadOH: %d)\n", finalCount, currentSize, currentSize+padOH)
-			break // Found the largest count that fits
+			g.logger().Debugf("XLSX: Found fit with Count=%d, Size=%d (Total with PadOH: %d)", finalCount, currentSize, currentSize+padOH)
+			lo = cnt + 1 // Look for a larger count that fits
 		} else {
-			// This count (cnt) is too large. Loop will try cnt-1.
-			// Release memory for the buffer that was too large.
-			currentBuf = nil
+			// This count (cnt) is too large. Look below it.
+			hi = cnt - 1
 		}
 	} // End of search loop
 
@@ -142,36 +413,18 @@ func (g *XlsxGenerator) Generate(path string, targetSize int64) error {
 	if finalCount == 0 {
 		// This means even cnt=1 was too large (or loop start estCount was < 1)
 		// We already checked targetSize > minimal+padOH, so cnt=0 (minimal file) should fit.
-		fmt.Println("XLSX: No count >= 1 fits. Generating minimal file.")
+		g.logger().Debugf("XLSX: No count >= 1 fits. Generating minimal file.")
 		// Generate the minimal file content again into finalFileBuffer
 		finalFileBuffer = &bytes.Buffer{}
-		fMinFinal := excelize.NewFile()
-		fMinFinal.SetCellValue("Sheet1", "A1", "X")
-		if err := fMinFinal.Write(finalFileBuffer); err != nil {
-			return fmt.Errorf("failed to write final minimal xlsx to buffer: %w", err)
+		fMinFinal, err := newWorkbook(o.sheets)
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := writeWorkbook(fMinFinal, finalFileBuffer, o); err != nil {
+			return 0, nil, fmt.Errorf("failed to write final minimal xlsx to buffer: %w", err)
 		}
 		// finalCount remains 0, indicating minimal file content was used.
 	}
 
-	// --- Single Disk Write ---
-	fmt.Printf("XLSX: Writing final file content (derived from count %d) to %s\n", finalCount, path)
-	outFile, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("failed to create final output file %s: %w", path, err)
-	}
-	defer outFile.Close() // Ensure file is closed eventually
-
-	_, err = outFile.Write(finalFileBuffer.Bytes())
-	if err != nil {
-		// Close is deferred, but return the write error
-		return fmt.Errorf("failed to write final buffer to file %s: %w", path, err)
-	}
-	// Explicitly close before padding to ensure all data is flushed
-	if err := outFile.Close(); err != nil {
-		return fmt.Errorf("failed to close final file before padding %s: %w", path, err)
-	}
-
-	// --- Padding ---
-	fmt.Printf("XLSX: Padding file %s to target size %d\n", path, targetSize)
-	return utils.PadZipExtend(path, targetSize) //
+	return finalCount, finalFileBuffer, nil
 }
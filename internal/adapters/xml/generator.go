@@ -3,12 +3,13 @@ package xml
 
 import (
 	"fmt"
-	"math/rand/v2"
-	"os"
 	"strings"
 
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/logging"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
 )
 
 func init() {
@@ -24,14 +25,111 @@ const (
 	commentOverhead = int64(len(commentOpen) + len(commentClose))
 )
 
-type XmlGenerator struct{}
+type XmlGenerator struct {
+	opts ports.Options // set by Configure
+	log  ports.Logger
+	fs   ports.OutputFS // set by WithOutputFS
+}
 
 func New() ports.FileGenerator {
 	return &XmlGenerator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *XmlGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *XmlGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// WithLogger returns a copy of the generator that reports to l.
+func (g *XmlGenerator) WithLogger(l ports.Logger) ports.FileGenerator {
+	c := *g
+	c.log = l
+	return &c
+}
+
+func (g *XmlGenerator) logger() ports.Logger {
+	if g.log == nil {
+		return logging.Nop
+	}
+	return g.log
+}
+
+// xmlOptions holds the settings the XML generator reads from ports.Options.
+// Setting any of them switches from comment padding to record generation.
+type xmlOptions struct {
+	schemaPath string
+	root       string
+	record     string
+	fields     []string
+	lang       *utils.Language // language of text values and comments
+	rand       *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (xmlOptions, error) {
+	o := xmlOptions{
+		schemaPath: opts.String("xml-schema", ""),
+		root:       opts.String("xml-root", ""),
+		record:     opts.String("xml-record", ""),
+	}
+	for _, f := range strings.Split(opts.String("xml-fields", ""), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			o.fields = append(o.fields, f)
+		}
+	}
+	if o.schemaPath != "" && len(o.fields) > 0 {
+		return o, fmt.Errorf("xml-fields cannot be combined with xml-schema")
+	}
+	var err error
+	if o.lang, err = utils.TextLanguage(opts.String("lang", ""), opts.String("corpus", "")); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// records reports whether the options ask for a schema-driven document.
+func (o xmlOptions) records() bool {
+	return o.schemaPath != "" || o.root != "" || o.record != "" || len(o.fields) > 0
+}
+
 // Generate creates an XML file with a root element and pads using comments.
 func (g *XmlGenerator) Generate(path string, targetSize int64) error {
+	return g.GenerateWithOptions(path, targetSize, nil)
+}
+
+// GenerateWithOptions creates an XML file of exactly targetSize bytes. By
+// default an empty root element is padded with comments. With "xml-schema"
+// (an XSD) or an element template ("xml-root", "xml-record", "xml-fields")
+// the document holds repeated records instead, padded with comments after
+// the root element (see generateRecords). The "lang" option writes text
+// values and comments in another language, and "corpus" draws them from
+// its files.
+func (g *XmlGenerator) GenerateWithOptions(path string, targetSize int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.records() {
+		return g.generateRecords(path, targetSize, o)
+	}
+
 	baseContent := xmlDeclaration + "\n" + rootTagOpen + rootTagClose
 	baseSize := int64(len(baseContent))
 
@@ -41,11 +139,11 @@ func (g *XmlGenerator) Generate(path string, targetSize int64) error {
 
 	if targetSize < baseSize {
 		// Write truncated content if target is smaller than minimal structure
-		fmt.Printf("Warning: Target size %d smaller than minimal XML %d. Truncating.\n", targetSize, baseSize)
-		return os.WriteFile(path, []byte(baseContent[:targetSize]), 0666)
+		g.logger().Warnf("Target size %d smaller than minimal XML %d. Truncating.", targetSize, baseSize)
+		return outputfs.WriteFile(g.fs, path, []byte(baseContent[:targetSize]))
 	}
 
-	f, err := os.Create(path)
+	f, err := outputfs.Create(g.fs, path)
 	if err != nil {
 		return fmt.Errorf("failed to create file %s: %w", path, err)
 	}
@@ -82,7 +180,7 @@ func (g *XmlGenerator) Generate(path string, targetSize int64) error {
 		if maxContentSize <= 0 {
 			// Not enough space for a comment, pad with whitespace/newlines directly
 			// (ensure valid placement if strict validation matters)
-			paddingChars := generateXmlSafePaddingString(int(remainingTotalPadding))
+			paddingChars := o.text(int(remainingTotalPadding))
 			n, writeErr := f.WriteString(paddingChars)
 			if writeErr != nil {
 				return fmt.Errorf("failed to write final raw XML padding: %w", writeErr)
@@ -98,7 +196,7 @@ func (g *XmlGenerator) Generate(path string, targetSize int64) error {
 			contentSize = maxContentSize
 		}
 
-		commentContent := generateXmlSafePaddingString(int(contentSize))
+		commentContent := o.text(int(contentSize))
 
 		// Build the comment string
 		builder.WriteString(commentOpen)
@@ -114,7 +212,7 @@ func (g *XmlGenerator) Generate(path string, targetSize int64) error {
 		bytesWritten += int64(n)
 
 		if int64(n) < int64(len(commentString)) {
-			fmt.Printf("Warning: Partial write during XML comment padding (%d < %d)\n", n, len(commentString))
+			g.logger().Warnf("Partial write during XML comment padding (%d < %d)", n, len(commentString))
 			break
 		}
 	}
@@ -128,34 +226,43 @@ func (g *XmlGenerator) Generate(path string, targetSize int64) error {
 
 	// Final Size Verification (optional but good practice)
 	if syncErr := f.Sync(); syncErr != nil {
-		fmt.Printf("Warning: Failed to sync file %s: %v\n", path, syncErr)
+		g.logger().Warnf("Failed to sync file %s: %v", path, syncErr)
 	}
-	info, statErr := os.Stat(path)
+	info, statErr := outputfs.Stat(g.fs, path)
 	if statErr == nil {
 		finalSize := info.Size()
 		if finalSize != targetSize {
-			fmt.Printf("Warning: Final XML size %d does not match target %d. Difference: %d\n", finalSize, targetSize, targetSize-finalSize)
+			g.logger().Warnf("Final XML size %d does not match target %d. Difference: %d", finalSize, targetSize, targetSize-finalSize)
 			// Potential truncation if over, but risky:
 			// if finalSize > targetSize {
 			// 	if err := f.Truncate(targetSize); err != nil { ... }
 			// }
 		}
 	} else {
-		fmt.Printf("Warning: Could not stat final file %s: %v\n", path, statErr)
+		g.logger().Warnf("Could not stat final file %s: %v", path, statErr)
 	}
 
 	return nil
 }
 
+// text returns n bytes of comment content: random safe characters, or
+// words in o's language if one was chosen.
+func (o xmlOptions) text(n int) string {
+	if o.lang == utils.Lorem {
+		return generateXmlSafePaddingString(o.rand, n)
+	}
+	return o.lang.Text(o.rand, n)
+}
+
 // generateXmlSafePaddingString generates a random string safe for XML comments or content.
 // Avoids '<', '>', '&' and the sequence '--'.
-func generateXmlSafePaddingString(n int) string {
+func generateXmlSafePaddingString(r *utils.Rand, n int) string {
 	// Basic printable ASCII, excluding <, >, &, and '-' to avoid '--' conflicts easily
 	const safeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 \n\t.,;:!?()[]{}#@*+=/\\|~`^%$"
 	var builder strings.Builder
 	builder.Grow(n)
 	for i := 0; i < n; i++ {
-		char := safeChars[rand.IntN(len(safeChars))]
+		char := safeChars[r.IntN(len(safeChars))]
 		builder.WriteByte(char)
 	}
 	return builder.String()
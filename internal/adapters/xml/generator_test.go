@@ -243,3 +243,155 @@ func limitString(s string, maxLen int) string {
 	}
 	return s[:maxLen] + "..."
 }
+
+const testOrderSchema = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" targetNamespace="urn:example:orders" elementFormDefault="qualified">
+  <xs:simpleType name="status">
+    <xs:restriction base="xs:string">
+      <xs:enumeration value="open"/>
+      <xs:enumeration value="shipped &amp; paid"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:element name="orders">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="generated" type="xs:dateTime"/>
+        <xs:element name="batch">
+          <xs:complexType>
+            <xs:sequence>
+              <xs:element name="order" minOccurs="2" maxOccurs="unbounded">
+                <xs:complexType>
+                  <xs:sequence>
+                    <xs:element name="id" type="xs:int"/>
+                    <xs:element name="status" type="status"/>
+                    <xs:element name="note" type="xs:string" minOccurs="0"/>
+                  </xs:sequence>
+                  <xs:attribute name="paid" type="xs:boolean"/>
+                </xs:complexType>
+              </xs:element>
+            </xs:sequence>
+          </xs:complexType>
+        </xs:element>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`
+
+func TestXmlGenerator_GenerateWithOptions(t *testing.T) {
+	generator := &XmlGenerator{}
+	tempDir := t.TempDir()
+	schemaPath := filepath.Join(tempDir, "orders.xsd")
+	if err := os.WriteFile(schemaPath, []byte(testOrderSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name       string
+		opts       ports.Options
+		size       int64
+		root       string
+		record     string
+		minRecords int
+	}{
+		{"Template", ports.Options{"xml-root": "order", "xml-record": "item", "xml-fields": "id,name,price"}, 20000, "order", "item", 50},
+		{"TemplateTypedFields", ports.Options{"xml-fields": "sku:token,qty:int,shipped:date,rush:boolean"}, 4096, defaultRoot, defaultRecord, 10},
+		{"TemplateExactFit", ports.Options{"xml-fields": "id"}, 130, defaultRoot, defaultRecord, 1},
+		{"Schema", ports.Options{"xml-schema": schemaPath}, 50000, "orders", "order", 100},
+		{"SchemaNamedRecord", ports.Options{"xml-schema": schemaPath, "xml-root": "orders", "xml-record": "order"}, 1000, "orders", "order", 2},
+		{"TemplateArabic", ports.Options{"xml-fields": "id,name,note", "lang": "ar"}, 20000, defaultRoot, defaultRecord, 20},
+		{"SchemaMixed", ports.Options{"xml-schema": schemaPath, "lang": "mixed"}, 50000, "orders", "order", 20},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, tc.name+".xml")
+			if err := generator.GenerateWithOptions(outPath, tc.size, tc.opts); err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, tc.size)
+			content, _ := os.ReadFile(outPath)
+
+			// Records are numbered from 1 and everything after the root
+			// element is comments or whitespace.
+			decoder := xml.NewDecoder(strings.NewReader(string(content)))
+			var depth, records int
+			var ids []string
+			var inID bool
+			for {
+				tok, err := decoder.Token()
+				if err != nil {
+					if err.Error() != "EOF" {
+						t.Fatalf("invalid XML: %v", err)
+					}
+					break
+				}
+				switch tok := tok.(type) {
+				case xml.StartElement:
+					if depth == 0 && tok.Name.Local != tc.root {
+						t.Errorf("root element = %s, want %s", tok.Name.Local, tc.root)
+					}
+					if tok.Name.Local == tc.record {
+						records++
+					}
+					inID = tok.Name.Local == "id"
+					depth++
+				case xml.EndElement:
+					depth--
+					inID = false
+				case xml.CharData:
+					if inID {
+						ids = append(ids, string(tok))
+					}
+					if depth == 0 && strings.TrimSpace(string(tok)) != "" {
+						t.Errorf("text %q outside the root element", tok)
+					}
+				}
+			}
+			if records < tc.minRecords {
+				t.Errorf("got %d %s records, want at least %d", records, tc.record, tc.minRecords)
+			}
+			for i, id := range ids {
+				if id != fmt.Sprint(i+1) {
+					t.Fatalf("record %d has id %s", i+1, id)
+				}
+			}
+		})
+	}
+
+	errorCases := []struct {
+		name   string
+		opts   ports.Options
+		size   int64
+		errSub string
+	}{
+		{"FieldsWithSchema", ports.Options{"xml-schema": schemaPath, "xml-fields": "id"}, 1000, "cannot be combined"},
+		{"UnknownFieldType", ports.Options{"xml-fields": "id:uuid"}, 1000, "unknown xml field type"},
+		{"InvalidFieldName", ports.Options{"xml-fields": "1st"}, 1000, "invalid xml field name"},
+		{"TooSmall", ports.Options{"xml-schema": schemaPath}, 200, "too small"},
+		{"MissingRoot", ports.Options{"xml-schema": schemaPath, "xml-root": "invoice"}, 1000, "no global element"},
+		{"MissingRecord", ports.Options{"xml-schema": schemaPath, "xml-record": "line"}, 1000, "no element \"line\""},
+		{"MissingSchema", ports.Options{"xml-schema": filepath.Join(tempDir, "missing.xsd")}, 1000, "failed to read xml schema"},
+		{"UnknownLang", ports.Options{"lang": "xx"}, 1000, "unknown lang"},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := generator.GenerateWithOptions(filepath.Join(tempDir, "err.xml"), tc.size, tc.opts)
+			if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+				t.Errorf("expected error containing %q, got %v", tc.errSub, err)
+			}
+		})
+	}
+	t.Run("PaddingLang", func(t *testing.T) {
+		for _, size := range []int64{100, 4099, 100000} {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("zh_%d.xml", size))
+			if err := generator.GenerateWithOptions(outPath, size, ports.Options{"lang": "zh"}); err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			checkFileSize(t, outPath, size)
+			content, _ := os.ReadFile(outPath)
+			if err := xml.Unmarshal(content, new(struct{})); err != nil {
+				t.Errorf("invalid XML at %d bytes: %v", size, err)
+			}
+		}
+	})
+}
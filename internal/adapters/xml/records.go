@@ -0,0 +1,267 @@
+package xml
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// recordMark stands in for the repeated records while the rest of the
+// document is rendered; it cannot occur in generated content.
+const recordMark = "\x00"
+
+// builtinKinds maps the XML Schema built-in types to the kind of value
+// generated for them.
+var builtinKinds = map[string]string{
+	"string": "text", "normalizedString": "text",
+	"token": "token", "Name": "token", "NCName": "token", "NMTOKEN": "token", "ID": "id", "IDREF": "token",
+	"language": "language", "anyURI": "uri",
+	"int": "int", "integer": "int", "long": "int", "short": "int",
+	"nonNegativeInteger": "int", "positiveInteger": "int",
+	"unsignedInt": "int", "unsignedLong": "int", "unsignedShort": "int",
+	"negativeInteger": "negative", "nonPositiveInteger": "negative",
+	"byte": "byte", "unsignedByte": "byte",
+	"decimal": "decimal", "float": "decimal", "double": "decimal",
+	"boolean": "boolean",
+	"date":    "date", "dateTime": "dateTime", "time": "time", "gYear": "year",
+}
+
+// renderer writes elements of a schema tree with random values. seq numbers
+// the records; id fields of integer type take its value.
+type renderer struct {
+	record       *schemaNode
+	path         map[*schemaNode]bool // the record's ancestors
+	recordIndent int
+	seq          int
+	uid          int
+	lang         *utils.Language
+	rand         *utils.Rand
+}
+
+// generateRecords writes a document whose root element holds as many
+// records as fit in targetSize. The bytes left over go into comments after
+// the root element, so the element content itself stays schema-valid.
+func (g *XmlGenerator) generateRecords(path string, targetSize int64, o xmlOptions) error {
+	var root, record *schemaNode
+	var err error
+	if o.schemaPath != "" {
+		root, record, err = loadXSD(o.schemaPath, o.root, o.record)
+	} else {
+		root, record, err = templateSchema(o)
+	}
+	if err != nil {
+		return err
+	}
+
+	r := &renderer{record: record, path: map[*schemaNode]bool{}, lang: o.lang, rand: o.rand}
+	onPath(root, record, r.path)
+	var doc strings.Builder
+	doc.WriteString(xmlDeclaration + "\n")
+	r.element(&doc, root, 0)
+	prefix, suffix, _ := strings.Cut(doc.String(), recordMark)
+
+	// The schema's minimum number of records (at least one) must fit.
+	budget := targetSize - int64(len(prefix)+len(suffix))
+	var required []string
+	var requiredLen int64
+	for len(required) < max(record.min, 1) {
+		rec := r.nextRecord()
+		required = append(required, rec)
+		requiredLen += int64(len(rec))
+	}
+	if requiredLen > budget {
+		return fmt.Errorf("target %d too small for a %s document with %d %s records; need at least %d",
+			targetSize, root.name, len(required), record.name, int64(len(prefix)+len(suffix))+requiredLen)
+	}
+
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	if _, err := w.WriteString(prefix + strings.Join(required, "")); err != nil {
+		return fmt.Errorf("failed to write XML start: %w", err)
+	}
+	budget -= requiredLen
+	for record.max < 0 || r.seq < record.max {
+		rec := r.nextRecord()
+		if int64(len(rec)) > budget {
+			break
+		}
+		if _, err := w.WriteString(rec); err != nil {
+			return fmt.Errorf("failed to write XML record: %w", err)
+		}
+		budget -= int64(len(rec))
+	}
+	if _, err := w.WriteString(suffix); err != nil {
+		return fmt.Errorf("failed to write XML end: %w", err)
+	}
+	if err := writeTrailingComments(w, budget, o); err != nil {
+		return fmt.Errorf("failed to write XML comment padding: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write XML file: %w", err)
+	}
+	return nil
+}
+
+// writeTrailingComments writes n bytes of comments, one per line, after
+// the root element. Gaps too small for a comment become newlines.
+func writeTrailingComments(w *bufio.Writer, n int64, o xmlOptions) error {
+	const perComment = commentOverhead + 1 // trailing newline
+	for n > 0 {
+		if n < perComment {
+			_, err := w.WriteString(strings.Repeat("\n", int(n)))
+			return err
+		}
+		content := min(n-perComment, 4096)
+		if _, err := w.WriteString(commentOpen + o.text(int(content)) + commentClose + "\n"); err != nil {
+			return err
+		}
+		n -= content + perComment
+	}
+	return nil
+}
+
+// nextRecord renders the next record element.
+func (r *renderer) nextRecord() string {
+	r.seq++
+	var b strings.Builder
+	r.element(&b, r.record, r.recordIndent)
+	return b.String()
+}
+
+// element writes n at the given indent level. The record element is
+// replaced by recordMark wherever it occurs below another element.
+func (r *renderer) element(b *strings.Builder, n *schemaNode, indent int) {
+	pad := strings.Repeat("  ", indent)
+	b.WriteString(pad + "<" + n.name)
+	if n.xmlns != "" {
+		b.WriteString(" " + n.xmlns)
+	}
+	for _, a := range n.attrs {
+		fmt.Fprintf(b, ` %s="%s"`, a.name, r.value(a.name, a.typ, a.enum))
+	}
+	switch {
+	case n.simple():
+		fmt.Fprintf(b, ">%s</%s>\n", r.value(n.name, n.typ, n.enum), n.name)
+		return
+	case len(n.children) == 0:
+		b.WriteString("/>\n")
+		return
+	}
+	b.WriteString(">\n")
+
+	children := n.children
+	if n.choice {
+		pick := children[r.rand.IntN(len(children))]
+		for _, c := range children {
+			if r.path[c] || c == r.record {
+				pick = c
+			}
+		}
+		children = []*schemaNode{pick}
+	}
+	for _, c := range children {
+		if c == r.record {
+			r.recordIndent = indent + 1
+			b.WriteString(recordMark)
+			continue
+		}
+		count := r.occurrences(c)
+		if r.path[c] {
+			count = 1 // the records' ancestors appear exactly once
+		}
+		for i := count; i > 0; i-- {
+			r.element(b, c, indent+1)
+		}
+	}
+	b.WriteString(pad + "</" + n.name + ">\n")
+}
+
+// onPath marks the elements between root and target in path, reporting
+// whether target is below n.
+func onPath(n, target *schemaNode, path map[*schemaNode]bool) bool {
+	for _, c := range n.children {
+		if c == target || onPath(c, target, path) {
+			path[c] = c != target
+			return true
+		}
+	}
+	return false
+}
+
+// occurrences picks how often a non-record element appears: at least its
+// minimum and at most two more.
+func (r *renderer) occurrences(n *schemaNode) int {
+	hi := n.max
+	if hi < 0 || hi > n.min+2 {
+		hi = n.min + 2
+	}
+	return n.min + r.rand.IntN(hi-n.min+1)
+}
+
+// value returns a random value of the given built-in type, or one of enum
+// if the type is restricted to it.
+func (r *renderer) value(name, typ string, enum []string) string {
+	if len(enum) > 0 {
+		return escape(enum[r.rand.IntN(len(enum))])
+	}
+	kind := builtinKinds[typ]
+	if kind == "int" && strings.EqualFold(localName(name), "id") {
+		return strconv.Itoa(r.seq)
+	}
+	day := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(r.rand.Int64N(int64(27 * 365 * 24 * time.Hour))))
+	switch kind {
+	case "int":
+		return strconv.Itoa(1 + r.rand.IntN(9999))
+	case "negative":
+		return strconv.Itoa(-1 - r.rand.IntN(9999))
+	case "byte":
+		return strconv.Itoa(1 + r.rand.IntN(127))
+	case "decimal":
+		return strconv.FormatFloat(float64(r.rand.IntN(100000))/100, 'f', 2, 64)
+	case "boolean":
+		return strconv.FormatBool(r.rand.IntN(2) == 0)
+	case "date":
+		return day.Format(time.DateOnly)
+	case "dateTime":
+		return day.Format(time.RFC3339)
+	case "time":
+		return day.Format(time.TimeOnly)
+	case "year":
+		return strconv.Itoa(day.Year())
+	case "uri":
+		return "https://example.com/" + r.randWord()
+	case "language":
+		return r.lang.Code
+	case "token":
+		return r.randWord()
+	case "id":
+		r.uid++
+		return fmt.Sprintf("%s%d", r.randWord(), r.uid)
+	}
+	if strings.Contains(strings.ToLower(name), "email") {
+		return r.randWord() + "." + r.randWord() + "@example.com"
+	}
+	return r.lang.Phrase(r.rand, 1, 4)
+}
+
+func (r *renderer) randWord() string {
+	return utils.LoremWords[r.rand.IntN(len(utils.LoremWords))]
+}
+
+// escape returns s with XML special characters replaced by entities.
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s)) // writing to a strings.Builder cannot fail
+	return b.String()
+}
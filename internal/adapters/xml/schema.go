@@ -0,0 +1,358 @@
+package xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Defaults for the element template when only some of its options are set.
+const (
+	defaultRoot   = "records"
+	defaultRecord = "record"
+	defaultFields = "id,name,value"
+)
+
+// maxSchemaDepth bounds element nesting so recursive schema types terminate.
+const maxSchemaDepth = 16
+
+// schemaNode describes one element of a schema-driven document.
+type schemaNode struct {
+	name     string
+	typ      string   // built-in simple type (e.g. "int"); empty for complex elements
+	enum     []string // allowed values, if restricted
+	attrs    []schemaAttr
+	xmlns    string // namespace declaration written on the root element
+	children []*schemaNode
+	choice   bool // children are alternatives rather than a sequence
+	min, max int  // occurrence bounds; max < 0 means unbounded
+}
+
+type schemaAttr struct {
+	name string
+	typ  string
+	enum []string
+}
+
+// simple reports whether the element holds text rather than child elements.
+func (n *schemaNode) simple() bool {
+	return n.typ != ""
+}
+
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9._-]*$`)
+
+// templateSchema builds the document described by the template options: a
+// root element holding repeated record elements with one child per field.
+// Fields are written as name or name:type; without a type it is guessed
+// from the name (see inferFieldType).
+func templateSchema(o xmlOptions) (root, record *schemaNode, err error) {
+	rootName, recordName := o.root, o.record
+	if rootName == "" {
+		rootName = defaultRoot
+	}
+	if recordName == "" {
+		recordName = defaultRecord
+	}
+	fields := o.fields
+	if len(fields) == 0 {
+		fields = strings.Split(defaultFields, ",")
+	}
+	for _, name := range []string{rootName, recordName} {
+		if !xmlNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid xml element name %q", name)
+		}
+	}
+
+	record = &schemaNode{name: recordName, min: 1, max: -1}
+	for _, f := range fields {
+		name, typ, typed := strings.Cut(f, ":")
+		if !xmlNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid xml field name %q", name)
+		}
+		if !typed {
+			typ = inferFieldType(name)
+		} else if _, ok := builtinKinds[typ]; !ok {
+			return nil, nil, fmt.Errorf("unknown xml field type %q for %s", typ, name)
+		}
+		record.children = append(record.children, &schemaNode{name: name, typ: typ, min: 1, max: 1})
+	}
+	root = &schemaNode{name: rootName, min: 1, max: 1, children: []*schemaNode{record}}
+	return root, record, nil
+}
+
+// inferFieldType guesses a template field's type from its name.
+func inferFieldType(name string) string {
+	n := strings.ToLower(name)
+	switch {
+	case n == "id", n == "age", strings.HasSuffix(n, "_id"), strings.Contains(n, "count"), strings.HasPrefix(n, "qty"), strings.HasPrefix(n, "quantity"):
+		return "int"
+	case strings.Contains(n, "price"), strings.Contains(n, "amount"), strings.Contains(n, "total"), strings.Contains(n, "cost"), strings.Contains(n, "balance"):
+		return "decimal"
+	case strings.Contains(n, "timestamp"), strings.HasSuffix(n, "_at"), strings.HasSuffix(n, "time"):
+		return "dateTime"
+	case strings.Contains(n, "date"), n == "dob", n == "birthday":
+		return "date"
+	case strings.HasPrefix(n, "is_"), strings.HasPrefix(n, "has_"), n == "active", n == "enabled":
+		return "boolean"
+	case strings.Contains(n, "url"), strings.Contains(n, "link"):
+		return "anyURI"
+	}
+	return "string"
+}
+
+// The subset of XML Schema read by loadXSD: global and local element
+// declarations, named and anonymous complex types with sequence, all or
+// choice content and attributes, and simple types restricting a built-in
+// type, optionally to an enumeration.
+type xsdSchema struct {
+	TargetNamespace    string           `xml:"targetNamespace,attr"`
+	ElementFormDefault string           `xml:"elementFormDefault,attr"`
+	Elements           []xsdElement     `xml:"element"`
+	ComplexTypes       []xsdComplexType `xml:"complexType"`
+	SimpleTypes        []xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdElement struct {
+	Name        string          `xml:"name,attr"`
+	Type        string          `xml:"type,attr"`
+	Ref         string          `xml:"ref,attr"`
+	MinOccurs   string          `xml:"minOccurs,attr"`
+	MaxOccurs   string          `xml:"maxOccurs,attr"`
+	ComplexType *xsdComplexType `xml:"complexType"`
+	SimpleType  *xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdComplexType struct {
+	Name       string         `xml:"name,attr"`
+	Sequence   *xsdGroup      `xml:"sequence"`
+	All        *xsdGroup      `xml:"all"`
+	Choice     *xsdGroup      `xml:"choice"`
+	Attributes []xsdAttribute `xml:"attribute"`
+}
+
+type xsdGroup struct {
+	Elements []xsdElement `xml:"element"`
+}
+
+type xsdSimpleType struct {
+	Name        string `xml:"name,attr"`
+	Restriction struct {
+		Base         string `xml:"base,attr"`
+		Enumerations []struct {
+			Value string `xml:"value,attr"`
+		} `xml:"enumeration"`
+	} `xml:"restriction"`
+}
+
+type xsdAttribute struct {
+	Name       string         `xml:"name,attr"`
+	Type       string         `xml:"type,attr"`
+	Use        string         `xml:"use,attr"`
+	SimpleType *xsdSimpleType `xml:"simpleType"`
+}
+
+// xsdResolver turns xsd declarations into schemaNodes, looking up named
+// types and referenced elements among the schema's global declarations.
+type xsdResolver struct {
+	elements map[string]*xsdElement
+	complex  map[string]*xsdComplexType
+	simple   map[string]*xsdSimpleType
+	// prefix is prepended to global element names when the schema has a
+	// target namespace but leaves local elements unqualified.
+	prefix string
+}
+
+// loadXSD reads the schema at path and returns the tree of its root element
+// (the global element named root, or the first one) and the element to
+// repeat: the one named record, or the first that may occur more than once.
+func loadXSD(path, root, record string) (*schemaNode, *schemaNode, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read xml schema: %w", err)
+	}
+	var s xsdSchema
+	if err := xml.Unmarshal(data, &s); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse xml schema %s: %w", path, err)
+	}
+	if len(s.Elements) == 0 {
+		return nil, nil, fmt.Errorf("xml schema %s declares no global elements", path)
+	}
+
+	r := &xsdResolver{
+		elements: map[string]*xsdElement{},
+		complex:  map[string]*xsdComplexType{},
+		simple:   map[string]*xsdSimpleType{},
+	}
+	for i := range s.Elements {
+		r.elements[s.Elements[i].Name] = &s.Elements[i]
+	}
+	for i := range s.ComplexTypes {
+		r.complex[s.ComplexTypes[i].Name] = &s.ComplexTypes[i]
+	}
+	for i := range s.SimpleTypes {
+		r.simple[s.SimpleTypes[i].Name] = &s.SimpleTypes[i]
+	}
+	qualified := s.ElementFormDefault == "qualified"
+	if s.TargetNamespace != "" && !qualified {
+		r.prefix = "tns:"
+	}
+
+	decl := &s.Elements[0]
+	if root != "" {
+		if decl = r.elements[root]; decl == nil {
+			return nil, nil, fmt.Errorf("xml schema %s has no global element %q", path, root)
+		}
+	}
+	rootNode, err := r.node(&xsdElement{Ref: decl.Name}, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	rootNode.min, rootNode.max = 1, 1
+	switch {
+	case s.TargetNamespace != "" && qualified:
+		rootNode.xmlns = fmt.Sprintf(`xmlns="%s"`, escape(s.TargetNamespace))
+	case s.TargetNamespace != "":
+		rootNode.xmlns = fmt.Sprintf(`xmlns:tns="%s"`, escape(s.TargetNamespace))
+	}
+
+	recordNode := findRecord(rootNode, record)
+	if recordNode == nil {
+		if record != "" {
+			return nil, nil, fmt.Errorf("xml schema %s has no element %q under %s", path, record, rootNode.name)
+		}
+		return nil, nil, fmt.Errorf("xml schema %s has no repeating element under %s; set xml-record", path, rootNode.name)
+	}
+	return rootNode, recordNode, nil
+}
+
+func (r *xsdResolver) node(e *xsdElement, depth int) (*schemaNode, error) {
+	if depth > maxSchemaDepth {
+		return nil, fmt.Errorf("xml schema nests deeper than %d elements at %s", maxSchemaDepth, e.Name+e.Ref)
+	}
+	minOccurs, maxOccurs, err := occurs(e)
+	if err != nil {
+		return nil, err
+	}
+	name := e.Name
+	if e.Ref != "" {
+		ref := r.elements[localName(e.Ref)]
+		if ref == nil {
+			return nil, fmt.Errorf("xml schema references undeclared element %q", e.Ref)
+		}
+		e, name = ref, r.prefix+ref.Name
+	}
+	n := &schemaNode{name: name, min: minOccurs, max: maxOccurs}
+
+	typ := localName(e.Type)
+	switch {
+	case e.ComplexType != nil:
+		err = r.complexContent(n, e.ComplexType, depth)
+	case e.SimpleType != nil:
+		n.typ, n.enum = r.simpleType(e.SimpleType)
+	case r.complex[typ] != nil:
+		err = r.complexContent(n, r.complex[typ], depth)
+	case r.simple[typ] != nil:
+		n.typ, n.enum = r.simpleType(r.simple[typ])
+	case typ == "":
+		n.typ = "string"
+	default:
+		n.typ = typ
+	}
+	return n, err
+}
+
+func (r *xsdResolver) complexContent(n *schemaNode, ct *xsdComplexType, depth int) error {
+	group := ct.Sequence
+	switch {
+	case ct.All != nil:
+		group = ct.All
+	case ct.Choice != nil:
+		group, n.choice = ct.Choice, true
+	}
+	if group != nil {
+		for i := range group.Elements {
+			child, err := r.node(&group.Elements[i], depth+1)
+			if err != nil {
+				return err
+			}
+			n.children = append(n.children, child)
+		}
+	}
+	for _, a := range ct.Attributes {
+		if a.Use == "prohibited" || a.Name == "" {
+			continue
+		}
+		attr := schemaAttr{name: a.Name, typ: "string"}
+		switch {
+		case a.SimpleType != nil:
+			attr.typ, attr.enum = r.simpleType(a.SimpleType)
+		case r.simple[localName(a.Type)] != nil:
+			attr.typ, attr.enum = r.simpleType(r.simple[localName(a.Type)])
+		case a.Type != "":
+			attr.typ = localName(a.Type)
+		}
+		n.attrs = append(n.attrs, attr)
+	}
+	return nil
+}
+
+// simpleType follows a restriction chain down to its built-in base type.
+func (r *xsdResolver) simpleType(st *xsdSimpleType) (string, []string) {
+	var enum []string
+	for _, v := range st.Restriction.Enumerations {
+		enum = append(enum, v.Value)
+	}
+	base := localName(st.Restriction.Base)
+	for i := 0; r.simple[base] != nil && i < maxSchemaDepth; i++ {
+		base = localName(r.simple[base].Restriction.Base)
+	}
+	if base == "" {
+		base = "string"
+	}
+	return base, enum
+}
+
+func occurs(e *xsdElement) (minOccurs, maxOccurs int, err error) {
+	minOccurs, maxOccurs = 1, 1
+	if e.MinOccurs != "" {
+		if minOccurs, err = strconv.Atoi(e.MinOccurs); err != nil || minOccurs < 0 {
+			return 0, 0, fmt.Errorf("xml schema element %s: invalid minOccurs %q", e.Name+e.Ref, e.MinOccurs)
+		}
+	}
+	switch e.MaxOccurs {
+	case "":
+		maxOccurs = max(minOccurs, 1)
+	case "unbounded":
+		maxOccurs = -1
+	default:
+		if maxOccurs, err = strconv.Atoi(e.MaxOccurs); err != nil || maxOccurs < minOccurs {
+			return 0, 0, fmt.Errorf("xml schema element %s: invalid maxOccurs %q", e.Name+e.Ref, e.MaxOccurs)
+		}
+	}
+	return minOccurs, maxOccurs, nil
+}
+
+// findRecord returns the first descendant of root named name or, if name is
+// empty, the first that may occur more than once.
+func findRecord(root *schemaNode, name string) *schemaNode {
+	for _, c := range root.children {
+		if (name != "" && localName(c.name) == name) || (name == "" && (c.max < 0 || c.max > 1)) {
+			return c
+		}
+		if found := findRecord(c, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// localName strips a namespace prefix such as "xs:".
+func localName(qname string) string {
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		return qname[i+1:]
+	}
+	return qname
+}
@@ -0,0 +1,177 @@
+package xps
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/ooxml"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+func init() {
+	factory.RegisterGenerator(ports.FileTypeXPS, New())
+}
+
+// XpsGenerator writes XPS documents: an OPC package whose fixed document
+// sequence holds one fixed document of pages drawing random rectangles,
+// lines and circles. A padding entry brings it to its size.
+type XpsGenerator struct {
+	opts ports.Options  // set by Configure
+	fs   ports.OutputFS // set by WithOutputFS
+}
+
+func New() ports.FileGenerator {
+	return &XpsGenerator{}
+}
+
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *XpsGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *XpsGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+const (
+	xpsNS = "http://schemas.microsoft.com/xps/2005/06"
+	// shapesPerPage is the number of paths each page draws.
+	shapesPerPage = 20
+)
+
+// xpsOptions holds the settings the XPS generator reads from ports.Options.
+type xpsOptions struct {
+	pages         int
+	width, height int // page size in points
+	modTime       time.Time
+	rand          *utils.Rand
+}
+
+func parseOptions(opts ports.Options) (xpsOptions, error) {
+	var o xpsOptions
+	var err error
+	if o.pages, err = opts.Int("xps-pages", 1); err != nil {
+		return o, err
+	}
+	if o.pages < 1 {
+		return o, fmt.Errorf("xps-pages must be at least 1, got %d", o.pages)
+	}
+	size := strings.ToLower(opts.String("xps-page-size", "a4"))
+	dims, ok := utils.PageSizes[size]
+	if !ok {
+		return o, fmt.Errorf("unknown xps page size %q (want a3, a4, a5, letter or legal)", size)
+	}
+	o.width, o.height = dims[0], dims[1]
+	if o.modTime, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (g *XpsGenerator) Generate(path string, size int64) error {
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes an XPS document of exactly size bytes with
+// "xps-pages" pages (1) of "xps-page-size" (a4). The "mtime" option dates
+// the parts and the core properties.
+func (g *XpsGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.modTime.IsZero() {
+		o.modTime = time.Now()
+	}
+	var buf bytes.Buffer
+	if err := o.write(&buf); err != nil {
+		return err
+	}
+	return ooxml.WritePadded(g.fs, path, buf.Bytes(), size, o.modTime)
+}
+
+// Resize writes the document at srcPath to outPath with its parts as they
+// are and its padding entry sized to bring it to exactly targetSize.
+func (g *XpsGenerator) Resize(srcPath, outPath string, targetSize int64) error {
+	return ooxml.Resize(g.fs, srcPath, outPath, targetSize)
+}
+
+// write writes the package without padding: the fixed document sequence
+// the package relates to, its document and the document's pages.
+func (o xpsOptions) write(w *bytes.Buffer) error {
+	parts := []ooxml.Part{{
+		Name:        "FixedDocumentSequence.fdseq",
+		ContentType: "application/vnd.ms-package.xps-fixeddocumentsequence+xml",
+		RelType:     "http://schemas.microsoft.com/xps/2005/06/fixedrepresentation",
+		Body:        `<FixedDocumentSequence xmlns="` + xpsNS + `"><DocumentReference Source="/Documents/1/FixedDocument.fdoc"/></FixedDocumentSequence>`,
+	}}
+	var doc strings.Builder
+	doc.WriteString(`<FixedDocument xmlns="` + xpsNS + `">`)
+	for p := 1; p <= o.pages; p++ {
+		fmt.Fprintf(&doc, `<PageContent Source="Pages/%d.fpage"/>`, p)
+	}
+	doc.WriteString(`</FixedDocument>`)
+	parts = append(parts, ooxml.Part{
+		Name:        "Documents/1/FixedDocument.fdoc",
+		ContentType: "application/vnd.ms-package.xps-fixeddocument+xml",
+		Body:        doc.String(),
+	})
+	for p := 1; p <= o.pages; p++ {
+		parts = append(parts, ooxml.Part{
+			Name:        fmt.Sprintf("Documents/1/Pages/%d.fpage", p),
+			ContentType: "application/vnd.ms-package.xps-fixedpage+xml",
+			Body:        o.page(),
+		})
+	}
+	parts = append(parts, ooxml.PropertiesParts(nil, o.modTime)...)
+
+	pkg := ooxml.NewPackage(w, o.modTime)
+	// The padding entry is a part too, and every part needs a content type.
+	pkg.AddContentTypes(append(parts, ooxml.Part{Name: "pad.bin", ContentType: "application/octet-stream"}))
+	pkg.AddRelationships(parts)
+	pkg.AddParts(parts)
+	return pkg.Close()
+}
+
+// page returns a fixed page drawing shapesPerPage randomly placed shapes
+// in random colours. XPS measures pages in 1/96 inch.
+func (o xpsOptions) page() string {
+	width, height := o.width*96/72, o.height*96/72
+	var b strings.Builder
+	fmt.Fprintf(&b, `<FixedPage xmlns="%s" Width="%d" Height="%d" xml:lang="en-US">`, xpsNS, width, height)
+	for range shapesPerPage {
+		x, y := o.rand.IntN(width), o.rand.IntN(height)
+		color := fmt.Sprintf("#%06X", o.rand.IntN(1<<24))
+		switch o.rand.IntN(3) {
+		case 0:
+			w, h := 10+o.rand.IntN(200), 10+o.rand.IntN(200)
+			fmt.Fprintf(&b, `<Path Data="M %d,%d L %d,%d %d,%d %d,%d Z" Fill="%s"/>`, x, y, x+w, y, x+w, y+h, x, y+h, color)
+		case 1:
+			fmt.Fprintf(&b, `<Path Data="M %d,%d L %d,%d" Stroke="%s" StrokeThickness="%d"/>`, x, y, o.rand.IntN(width), o.rand.IntN(height), color, 1+o.rand.IntN(5))
+		default:
+			r := 5 + o.rand.IntN(100)
+			fmt.Fprintf(&b, `<Path Data="M %d,%d A %d,%d 0 1 1 %d,%d A %d,%d 0 1 1 %d,%d Z" Stroke="%s" StrokeThickness="%d"/>`,
+				x-r, y, r, r, x+r, y, r, r, x-r, y, color, 1+o.rand.IntN(5))
+		}
+	}
+	b.WriteString(`</FixedPage>`)
+	return b.String()
+}
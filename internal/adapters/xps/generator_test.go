@@ -0,0 +1,114 @@
+package xps
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestXpsGenerator_Generate(t *testing.T) {
+	generator := New().(ports.OptionsGenerator)
+
+	testCases := []struct {
+		name   string
+		size   int64
+		opts   ports.Options
+		pages  int
+		errSub string
+	}{
+		{name: "OnePage", size: 64 * 1024, pages: 1},
+		{name: "Pages", size: 1 << 20, opts: ports.Options{"xps-pages": "5", "xps-page-size": "letter"}, pages: 5},
+		{name: "TooSmall", size: 1000, errSub: "does not fit"},
+		{name: "ZeroPages", size: 64 * 1024, opts: ports.Options{"xps-pages": "0"}, errSub: "xps-pages must be at least 1"},
+		{name: "BadPageSize", size: 64 * 1024, opts: ports.Options{"xps-page-size": "b4"}, errSub: "unknown xps page size"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "document.xps")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Errorf("size = %d, want %d", len(data), tc.size)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("zip.NewReader() error = %v", err)
+			}
+			parts := map[string][]byte{}
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("opening %s: %v", f.Name, err)
+				}
+				if parts[f.Name], err = io.ReadAll(rc); err != nil {
+					t.Fatalf("reading %s: %v", f.Name, err)
+				}
+				rc.Close()
+			}
+
+			// The package relates to the sequence, which refers to the
+			// document, which lists the pages.
+			if !bytes.Contains(parts["_rels/.rels"], []byte(`Type="http://schemas.microsoft.com/xps/2005/06/fixedrepresentation"`)) {
+				t.Errorf("package relationships lack the fixed representation: %s", parts["_rels/.rels"])
+			}
+			var seq struct {
+				References []struct {
+					Source string `xml:",attr"`
+				} `xml:"DocumentReference"`
+			}
+			if err := xml.Unmarshal(parts["FixedDocumentSequence.fdseq"], &seq); err != nil || len(seq.References) != 1 {
+				t.Fatalf("fixed document sequence: %v, %+v", err, seq)
+			}
+			var doc struct {
+				Pages []struct {
+					Source string `xml:",attr"`
+				} `xml:"PageContent"`
+			}
+			docName := strings.TrimPrefix(seq.References[0].Source, "/")
+			if err := xml.Unmarshal(parts[docName], &doc); err != nil {
+				t.Fatalf("fixed document: %v", err)
+			}
+			if len(doc.Pages) != tc.pages {
+				t.Fatalf("document has %d pages, want %d", len(doc.Pages), tc.pages)
+			}
+			for _, p := range doc.Pages {
+				name := filepath.Dir(docName) + "/" + p.Source
+				var page struct {
+					XMLName xml.Name
+					Width   int `xml:",attr"`
+					Paths   []struct {
+						Data string `xml:",attr"`
+					} `xml:"Path"`
+				}
+				if err := xml.Unmarshal(parts[name], &page); err != nil {
+					t.Fatalf("page %s: %v", name, err)
+				}
+				if page.XMLName.Space != xpsNS || page.XMLName.Local != "FixedPage" || page.Width == 0 || len(page.Paths) != shapesPerPage {
+					t.Errorf("page %s: %s with width %d and %d paths", name, page.XMLName.Local, page.Width, len(page.Paths))
+				}
+				if !bytes.Contains(parts["[Content_Types].xml"], []byte(`PartName="/`+name+`" ContentType="application/vnd.ms-package.xps-fixedpage+xml"`)) {
+					t.Errorf("page %s has no content type", name)
+				}
+			}
+		})
+	}
+}
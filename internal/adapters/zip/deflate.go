@@ -0,0 +1,137 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+)
+
+const (
+	// deflateBlockSize is the granularity at which mixed payloads alternate
+	// between text and random bytes.
+	deflateBlockSize = 4096
+	// deflateMaxIterations bounds the search for the payload length.
+	deflateMaxIterations = 60
+	// deflateCommentAim is the most the archive comment pads a deflated
+	// archive by: the payload is resized until the rest of the archive
+	// comes within this many bytes of the target.
+	deflateCommentAim = 512
+)
+
+// mixedWords is the vocabulary for the compressible half of mixed payloads.
+var mixedWords = []string{
+	"lorem", "ipsum", "dolor", "sit", "amet", "invoice", "customer", "order",
+	"total", "status", "pending", "shipped", "report", "quarter", "revenue",
+	"north", "south", "east", "west", "alpha", "beta", "gamma", "delta",
+}
+
+// mixedFill returns a fill function writing n bytes that alternate between
+// blocks of word text and blocks of random bytes, so the payload compresses
+// roughly like a real-world archive. The output is fully determined by seed,
+// which lets the search below re-measure the same content.
+func mixedFill(n int64, seed uint64) func(io.Writer) error {
+	return func(w io.Writer) error {
+		r := rand.New(rand.NewPCG(seed, seed^0x9E3779B97F4A7C15))
+		buf := make([]byte, deflateBlockSize)
+		for block := 0; n > 0; block++ {
+			chunk := min(int64(len(buf)), n)
+			b := buf[:chunk]
+			if block%2 == 0 {
+				for i := 0; i < len(b); {
+					word := mixedWords[r.IntN(len(mixedWords))]
+					i += copy(b[i:], word)
+					if i < len(b) {
+						b[i] = ' '
+						i++
+					}
+				}
+			} else {
+				for i := range b {
+					b[i] = byte(r.Uint32())
+				}
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+			n -= chunk
+		}
+		return nil
+	}
+}
+
+// countingWriter discards writes while counting their length.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// planDeflatedEntries searches for the total uncompressed payload whose
+// deflated archive lands at most deflateCommentAim bytes below size, and
+// returns the entries together with the comment length that closes the gap.
+// It steps by the observed compression ratio, and bisects between the
+// payloads known to be too small and too large when a step overshoots.
+func planDeflatedEntries(names []string, size int64, o zipOptions) ([]entry, int64, error) {
+	seed := o.rand.Uint64()
+	build := func(total int64) []entry {
+		// Re-seed the distribution so every measurement splits identically.
+		sizes := distributeSizes(total, len(names), o.distribution, rand.New(rand.NewPCG(seed, seed)))
+		entries := make([]entry, len(names))
+		for i, name := range names {
+			entries[i] = entry{name: name, size: sizes[i], fill: mixedFill(sizes[i], seed+uint64(i))}
+		}
+		return entries
+	}
+	measure := func(total int64) (int64, error) {
+		cw := &countingWriter{}
+		err := writeArchive(cw, build(total), 0, o)
+		return cw.n, err
+	}
+
+	base, err := measure(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if size < base {
+		return nil, 0, fmt.Errorf("requested size %d too small, minimum is %d", size, base)
+	}
+
+	// Start by assuming a 1:1 ratio, then step by the observed ratio
+	// towards the middle of the accepted gaps.
+	aim := min(int64(deflateCommentAim), o.commentRoom())
+	lo, hi := int64(-1), int64(-1) // the largest total too small, the smallest too large
+	total := max(size-base-aim/2, 0)
+	for i := 0; i < deflateMaxIterations; i++ {
+		got, err := measure(total)
+		if err != nil {
+			return nil, 0, err
+		}
+		gap := size - got
+		if gap >= 0 && gap <= aim {
+			return build(total), gap, nil
+		}
+		if gap > aim {
+			lo = max(lo, total)
+		} else if hi < 0 || total < hi {
+			hi = total
+		}
+		if lo >= 0 && hi >= 0 && hi-lo <= 1 {
+			break
+		}
+		ratio := 1.0
+		if total > 0 && got > base {
+			ratio = float64(got-base) / float64(total)
+		}
+		next := total + int64(float64(gap-aim/2)/ratio)
+		if hi >= 0 && (next <= lo || next >= hi) {
+			next = lo + (hi-lo)/2
+		} else if next == total {
+			next = total + 1
+		}
+		total = max(next, 0)
+	}
+	return nil, 0, fmt.Errorf("could not converge on a deflated payload for target size %d", size)
+}
@@ -0,0 +1,197 @@
+package zip
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// --- Traditional PKWARE encryption (ZipCrypto) ---
+
+// zipCryptoHeaderLen is the size of the encryption header that precedes
+// every ZipCrypto-encrypted entry.
+const zipCryptoHeaderLen = 12
+
+// zipCryptoKeys holds the three rolling keys of the PKWARE stream cipher.
+type zipCryptoKeys struct {
+	k0, k1, k2 uint32
+}
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	k := &zipCryptoKeys{k0: 0x12345678, k1: 0x23456789, k2: 0x34567890}
+	for i := 0; i < len(password); i++ {
+		k.update(password[i])
+	}
+	return k
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ (crc >> 8)
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k.k0 = crc32Update(k.k0, b)
+	k.k1 = (k.k1+(k.k0&0xff))*134775813 + 1
+	k.k2 = crc32Update(k.k2, byte(k.k1>>24))
+}
+
+func (k *zipCryptoKeys) streamByte() byte {
+	t := uint16(k.k2 | 2)
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+// encrypt encrypts p in place.
+func (k *zipCryptoKeys) encrypt(p []byte) {
+	for i, b := range p {
+		p[i] = b ^ k.streamByte()
+		k.update(b)
+	}
+}
+
+// zipCryptoWriter encrypts everything written to it and tracks the CRC-32
+// of the plaintext, which is only known once the entry is complete.
+type zipCryptoWriter struct {
+	w    io.Writer
+	keys *zipCryptoKeys
+	crc  hash.Hash32
+	buf  []byte
+}
+
+// newZipCryptoWriter writes the 12-byte encryption header, random bytes
+// from r, to w. Because entries are streamed with a data descriptor, the
+// header's check byte is the high byte of the DOS modification time
+// rather than of the CRC.
+func newZipCryptoWriter(r *utils.Rand, w io.Writer, password string, modTime uint16) (*zipCryptoWriter, error) {
+	zw := &zipCryptoWriter{
+		w:    w,
+		keys: newZipCryptoKeys(password),
+		crc:  crc32.NewIEEE(),
+	}
+	hdr := make([]byte, zipCryptoHeaderLen)
+	r.Read(hdr[:zipCryptoHeaderLen-1])
+	hdr[zipCryptoHeaderLen-1] = byte(modTime >> 8)
+	zw.keys.encrypt(hdr)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return zw, nil
+}
+
+func (z *zipCryptoWriter) Write(p []byte) (int, error) {
+	z.crc.Write(p)
+	if cap(z.buf) < len(p) {
+		z.buf = make([]byte, len(p))
+	}
+	buf := z.buf[:len(p)]
+	copy(buf, p)
+	z.keys.encrypt(buf)
+	return z.w.Write(buf)
+}
+
+// --- WinZip AES-256 encryption (AE-2) ---
+
+const (
+	aesMethod        = 99     // compression method marker for WinZip AES
+	aesExtraID       = 0x9901 // WinZip AES extra field header ID
+	aesSaltLen       = 16     // salt length for AES-256
+	aesVerifierLen   = 2
+	aesAuthCodeLen   = 10
+	aesKeyLen        = 32
+	aesKDFIterations = 1000
+	// aesOverhead is the number of bytes AES-256 adds around the payload.
+	aesOverhead = aesSaltLen + aesVerifierLen + aesAuthCodeLen
+)
+
+// aesExtraField returns the 0x9901 extra field describing an AE-2,
+// AES-256 entry whose actual compression method is method.
+func aesExtraField(method uint16) []byte {
+	b := make([]byte, 11)
+	binary.LittleEndian.PutUint16(b[0:2], aesExtraID)
+	binary.LittleEndian.PutUint16(b[2:4], 7) // data size
+	binary.LittleEndian.PutUint16(b[4:6], 2) // vendor version AE-2
+	copy(b[6:8], "AE")
+	b[8] = 3 // key strength: AES-256
+	binary.LittleEndian.PutUint16(b[9:11], method)
+	return b
+}
+
+// aesWriter encrypts with AES-256 in WinZip's little-endian CTR mode and
+// authenticates the ciphertext with HMAC-SHA1.
+type aesWriter struct {
+	w       io.Writer
+	block   cipher.Block
+	mac     hash.Hash
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+	buf     []byte
+}
+
+// newAESWriter derives the keys from password and a salt drawn from r and
+// writes the salt and password verifier to w.
+func newAESWriter(r *utils.Rand, w io.Writer, password string) (*aesWriter, error) {
+	salt := make([]byte, aesSaltLen)
+	r.Read(salt)
+	key, err := pbkdf2.Key(sha1.New, password, salt, aesKDFIterations, 2*aesKeyLen+aesVerifierLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key[:aesKeyLen])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(key[2*aesKeyLen:]); err != nil {
+		return nil, err
+	}
+	return &aesWriter{
+		w:     w,
+		block: block,
+		mac:   hmac.New(sha1.New, key[aesKeyLen:2*aesKeyLen]),
+		pos:   aes.BlockSize,
+	}, nil
+}
+
+func (a *aesWriter) Write(p []byte) (int, error) {
+	if cap(a.buf) < len(p) {
+		a.buf = make([]byte, len(p))
+	}
+	buf := a.buf[:len(p)]
+	for i, b := range p {
+		if a.pos == aes.BlockSize {
+			a.nextBlock()
+		}
+		buf[i] = b ^ a.stream[a.pos]
+		a.pos++
+	}
+	a.mac.Write(buf)
+	return a.w.Write(buf)
+}
+
+// nextBlock increments the little-endian counter and encrypts it.
+func (a *aesWriter) nextBlock() {
+	for i := range a.counter {
+		a.counter[i]++
+		if a.counter[i] != 0 {
+			break
+		}
+	}
+	a.block.Encrypt(a.stream[:], a.counter[:])
+	a.pos = 0
+}
+
+// Close writes the authentication code.
+func (a *aesWriter) Close() error {
+	_, err := a.w.Write(a.mac.Sum(nil)[:aesAuthCodeLen])
+	return err
+}
@@ -0,0 +1,207 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"path/filepath"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// maxCommentLen is the largest archive comment the EOCD record can hold.
+const maxCommentLen = 0xFFFF
+
+// eicarEntryName names the entry added by the "eicar" option.
+const eicarEntryName = "eicar.com"
+
+// entry describes one archive member: its name, payload size and the
+// function that writes its payload. An entry with a compressed size has
+// a payload already deflated, with its CRC known in advance.
+type entry struct {
+	name       string
+	size       int64
+	fill       func(io.Writer) error
+	compressed int64
+	crc        uint32
+}
+
+// entryNames returns the member names for the archive described by o.
+// Without inner types a single entry keeps the historical "dummy.bin" name.
+// Stress options lengthen the names or make them Unicode.
+func entryNames(o zipOptions) []string {
+	names := []string{"dummy.bin"}
+	if len(o.entryTypes) > 0 || o.entries > 1 {
+		names = make([]string, o.entries)
+		for i := range names {
+			ext := "bin"
+			if len(o.entryTypes) > 0 {
+				ext = string(o.entryTypes[i%len(o.entryTypes)])
+			}
+			names[i] = fmt.Sprintf("entry_%03d.%s", i+1, ext)
+		}
+	}
+	if o.stress.nameLength > 0 || o.stress.unicode {
+		for i, name := range names {
+			names[i] = stressName(name, i, o.stress)
+		}
+	}
+	return names
+}
+
+// planEntries splits dataBytes across the named entries and prepares their
+// payloads. Entries backed by other generators, those of o.factory or the
+// default registry's, are rendered to temporary files on o.fs first; the
+// returned cleanup removes them.
+func planEntries(names []string, dataBytes int64, o zipOptions) ([]entry, func(), error) {
+	sizes := distributeSizes(dataBytes, len(names), o.distribution, o.rand.Rand)
+	entries := make([]entry, len(names))
+	noop := func() {}
+
+	if len(o.entryTypes) == 0 {
+		for i, name := range names {
+			entries[i] = entry{name: name, size: sizes[i], fill: randomFill(o.rand.Split(), sizes[i], o.filler, o.threads)}
+		}
+		return entries, noop, nil
+	}
+
+	tmpDir, err := outputfs.MkdirTemp(o.fs, "genfile-zip-*")
+	if err != nil {
+		return nil, noop, fmt.Errorf("failed to create temp dir for zip entries: %w", err)
+	}
+	cleanup := func() { outputfs.RemoveAll(o.fs, tmpDir) }
+
+	f := o.factory
+	if f == nil {
+		f = factory.NewGeneratorFactory()
+	}
+	for i, name := range names {
+		t := o.entryTypes[i%len(o.entryTypes)]
+		gen, err := f.For(t)
+		if _, ok := ports.As[ports.ConfigurableGenerator](gen); ok && len(o.entryOptions) > 0 {
+			// Format options such as "png-color" apply to the entries.
+			gen, err = f.ForOptions(t, o.entryOptions)
+		}
+		if err != nil {
+			cleanup()
+			return nil, noop, fmt.Errorf("zip entry type: %w", err)
+		}
+		// Stress names can be too long for a file name.
+		tmpPath := filepath.Join(tmpDir, fmt.Sprintf("%d.%s", i, t))
+		if err := gen.Generate(tmpPath, sizes[i]); err != nil {
+			cleanup()
+			return nil, noop, fmt.Errorf("failed to generate zip entry %s: %w", name, err)
+		}
+		info, err := outputfs.Stat(o.fs, tmpPath)
+		if err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+		entries[i] = entry{name: name, size: info.Size(), fill: fileFill(o.fs, tmpPath)}
+	}
+	return entries, cleanup, nil
+}
+
+// bytesEntry returns an entry holding data.
+func bytesEntry(name string, data []byte) entry {
+	return entry{name: name, size: int64(len(data)), fill: func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}}
+}
+
+// fileFill returns a fill function copying the temporary file at path on
+// fsys.
+func fileFill(fsys ports.OutputFS, path string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		src, err := outputfs.OpenRead(fsys, path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(w, src)
+		return err
+	}
+}
+
+// distributeSizes splits total into n sizes. "equal" gives every entry the
+// same share (the last takes the remainder); "random" weights each entry
+// by a factor between 0.5 and 1.5 drawn from r.
+func distributeSizes(total int64, n int, distribution string, r *rand.Rand) []int64 {
+	sizes := make([]int64, n)
+	if distribution == DistributionRandom {
+		weights := make([]float64, n)
+		var sum float64
+		for i := range weights {
+			weights[i] = 0.5 + r.Float64()
+			sum += weights[i]
+		}
+		var assigned int64
+		for i := 0; i < n-1; i++ {
+			sizes[i] = int64(float64(total) * weights[i] / sum)
+			assigned += sizes[i]
+		}
+		sizes[n-1] = total - assigned
+		return sizes
+	}
+	share := total / int64(n)
+	for i := range sizes {
+		sizes[i] = share
+	}
+	sizes[n-1] += total - share*int64(n)
+	return sizes
+}
+
+// nestLevels returns the options for an archive wrapping nested ones,
+// which holds o.nestBranching stored archives and keeps o's encryption,
+// comment and prefix, and for the archives it holds, one level down.
+func nestLevels(o zipOptions) (wrap, inner zipOptions) {
+	wrap = o
+	wrap.entries, wrap.entryTypes, wrap.fixed = o.nestBranching, nil, nil
+	wrap.compression = CompressionStore
+	inner = o
+	inner.nestDepth--
+	inner.comment, inner.prefix = "", ""
+	return wrap, inner
+}
+
+// nestedNames names the archives an archive wrapping nested ones holds.
+func nestedNames(o zipOptions) []string {
+	names := make([]string, o.nestBranching)
+	for i := range names {
+		names[i] = fmt.Sprintf("nested_%03d.zip", i+1)
+	}
+	return names
+}
+
+// planNested splits the payload of a size-byte archive wrapping nested
+// ones equally across them, each written when its entry is. It returns
+// the entries and the options to write them with.
+func planNested(size int64, o zipOptions) ([]entry, zipOptions) {
+	wrap, inner := nestLevels(o)
+	names := nestedNames(o)
+	sizes := distributeSizes(size-archiveOverhead(names, wrap), len(names), DistributionEqual, nil)
+	entries := make([]entry, len(names))
+	for i, name := range names {
+		entries[i] = entry{name: name, size: sizes[i], fill: func(w io.Writer) error {
+			return writeSized(w, sizes[i], inner)
+		}}
+	}
+	return entries, wrap
+}
+
+// nestedMinSize returns the smallest archive o describes: every level's
+// headers over the innermost archives' minimum.
+func nestedMinSize(o zipOptions) int64 {
+	if o.nestDepth == 0 && o.ratio > 0 {
+		names := entryNames(o)
+		return headersSize(nil, names, o) + int64(len(names))*minRatioStream
+	}
+	if o.nestDepth == 0 {
+		return archiveOverhead(entryNames(o), o)
+	}
+	wrap, inner := nestLevels(o)
+	return archiveOverhead(nestedNames(o), wrap) + int64(o.nestBranching)*nestedMinSize(inner)
+}
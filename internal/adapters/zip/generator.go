@@ -4,10 +4,16 @@ import (
 	"archive/zip"
 	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strings"
 	"time" // Ensure time is imported
 
+	"github.com/hailam/genfile/internal/adapters/embed"
 	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/ooxml"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
 	"github.com/hailam/genfile/internal/ports"
 	"github.com/hailam/genfile/internal/utils"
 )
@@ -16,95 +22,617 @@ func init() {
 	factory.RegisterGenerator(ports.FileTypeZIP, New()) //
 }
 
-type ZipGenerator struct{}
+type ZipGenerator struct {
+	opts  ports.Options // set by Configure
+	meta  ports.Metadata
+	stats ports.Stats
+	fs    ports.OutputFS // set by WithOutputFS
+	// factory makes the zip-entry-type entries; set by WithFactory.
+	factory ports.GeneratorFactory
+}
 
 func New() ports.FileGenerator {
 	return &ZipGenerator{}
 }
 
+// Configure returns a copy of the generator that applies opts to every
+// file it writes.
+func (g *ZipGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	opts = g.opts.With(opts)
+	if _, err := parseOptions(opts); err != nil {
+		return nil, err
+	}
+	c := *g
+	c.opts = opts
+	return &c, nil
+}
+
+// WithOutputFS returns a copy of the generator that writes on fsys.
+func (g *ZipGenerator) WithOutputFS(fsys ports.OutputFS) ports.FileGenerator {
+	c := *g
+	c.fs = fsys
+	return &c
+}
+
+// WithFactory returns a copy of the generator that makes the
+// zip-entry-type entries with the generators of f.
+func (g *ZipGenerator) WithFactory(f ports.GeneratorFactory) ports.FileGenerator {
+	c := *g
+	c.factory = f
+	return &c
+}
+
+// Encryption modes accepted by the "zip-encryption" option.
+const (
+	EncryptionNone      = "none"
+	EncryptionZipCrypto = "zipcrypto"
+	EncryptionAES256    = "aes256"
+)
+
+// Compression methods accepted by the "zip-compression" option.
+const (
+	CompressionStore   = "store"
+	CompressionDeflate = "deflate"
+)
+
+// Size distributions accepted by the "zip-entry-distribution" option.
+const (
+	DistributionEqual  = "equal"
+	DistributionRandom = "random"
+)
+
+// Limits on nested archives: how deep they go and how many archives the
+// whole tree may hold, so a fixture stays bounded however it is asked for.
+const (
+	maxNestDepth      = 64
+	maxNestedArchives = 100000
+)
+
+// sfxStub starts a self-extracting archive. Unzip tools skip it, and
+// running the file as a shell script extracts it.
+const sfxStub = "#!/bin/sh\n# Self-extracting archive created by genfile\nexec unzip -o \"$0\" \"$@\"\n"
+
+// zipOptions holds the settings the ZIP generator reads from ports.Options.
+type zipOptions struct {
+	encryption   string
+	password     string
+	compression  string
+	entries      int
+	entryTypes   []ports.FileType
+	distribution string
+	// fixed entries are written first, ahead of the planned ones, and
+	// count towards the archive overhead.
+	fixed []entry
+	// comment starts the archive comment; padding spaces follow it.
+	comment string
+	// modified is the entries' modification time; zero means now.
+	modified time.Time
+	// nestDepth levels of archives wrap the innermost one, each holding
+	// nestBranching archives of the level below.
+	nestDepth     int
+	nestBranching int
+	// prefix comes ahead of the archive, with its offsets adjusted to suit.
+	prefix string
+	// ratio, if set, makes the entries deflate streams of zeros expanding
+	// about that many times.
+	ratio int
+	// entryOptions configure the generators of zip-entry-type entries:
+	// the options not meant for the archive itself.
+	entryOptions ports.Options
+	// factory makes those entries, in temporary files on fs; both are
+	// set from the generator, not from options.
+	factory ports.GeneratorFactory
+	fs      ports.OutputFS
+	// filler is the stored entries' data, made on threads goroutines.
+	filler  utils.Filler
+	threads int
+	// rand makes every random choice and byte of the archive.
+	rand *utils.Rand
+	// stress lays the archive out to exercise extraction libraries.
+	stress stressOptions
+}
+
+// modTime returns the modification time to record for the entries.
+func (o zipOptions) modTime() time.Time {
+	if o.modified.IsZero() {
+		return time.Now()
+	}
+	return o.modified
+}
+
+// commentRoom returns how many padding bytes the archive comment can take
+// after o.comment.
+func (o zipOptions) commentRoom() int64 {
+	return maxCommentLen - int64(len(o.comment))
+}
+
+func parseOptions(opts ports.Options) (zipOptions, error) {
+	o := zipOptions{
+		encryption:   strings.ToLower(opts.String("zip-encryption", EncryptionNone)),
+		password:     opts.String("zip-password", ""),
+		compression:  strings.ToLower(opts.String("zip-compression", CompressionStore)),
+		distribution: strings.ToLower(opts.String("zip-entry-distribution", DistributionEqual)),
+	}
+	switch o.encryption {
+	case EncryptionNone:
+	case EncryptionZipCrypto, EncryptionAES256:
+		if o.password == "" {
+			return o, fmt.Errorf("zip encryption %q requires a password", o.encryption)
+		}
+	default:
+		return o, fmt.Errorf("unknown zip encryption %q (want none, zipcrypto or aes256)", o.encryption)
+	}
+
+	n, err := opts.Int("zip-entries", 1)
+	if err != nil {
+		return o, err
+	}
+	if n < 1 {
+		return o, fmt.Errorf("zip-entries must be at least 1, got %d", n)
+	}
+	o.entries = n
+
+	for _, t := range strings.Split(opts.String("zip-entry-type", ""), ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			o.entryTypes = append(o.entryTypes, ports.FileType(t))
+		}
+	}
+	o.entryOptions = embed.Options(opts, "zip-")
+
+	switch o.compression {
+	case CompressionStore:
+	case CompressionDeflate:
+		if o.encryption != EncryptionNone {
+			return o, fmt.Errorf("zip-compression deflate cannot be combined with encryption")
+		}
+		if len(o.entryTypes) > 0 {
+			return o, fmt.Errorf("zip-compression deflate cannot be combined with zip-entry-type")
+		}
+	default:
+		return o, fmt.Errorf("unknown zip compression %q (want store or deflate)", o.compression)
+	}
+
+	switch o.distribution {
+	case DistributionEqual, DistributionRandom:
+	default:
+		return o, fmt.Errorf("unknown zip entry distribution %q (want equal or random)", o.distribution)
+	}
+
+	if o.modified, err = opts.Time("mtime", time.Time{}); err != nil {
+		return o, err
+	}
+
+	if o.nestDepth, err = opts.Int("zip-nest-depth", 0); err != nil {
+		return o, err
+	}
+	if o.nestBranching, err = opts.Int("zip-nest-branching", 1); err != nil {
+		return o, err
+	}
+	if o.nestDepth < 0 || o.nestDepth > maxNestDepth {
+		return o, fmt.Errorf("zip-nest-depth must be between 0 and %d, got %d", maxNestDepth, o.nestDepth)
+	}
+	if o.nestBranching < 1 {
+		return o, fmt.Errorf("zip-nest-branching must be at least 1, got %d", o.nestBranching)
+	}
+	archives, level := 1, 1
+	for range o.nestDepth {
+		level *= o.nestBranching
+		archives += level
+		if archives > maxNestedArchives {
+			return o, fmt.Errorf("%d levels of %d nested archives exceed the limit of %d archives", o.nestDepth, o.nestBranching, maxNestedArchives)
+		}
+	}
+	if o.ratio, err = opts.Int("zip-ratio", 0); err != nil {
+		return o, err
+	}
+	switch {
+	case o.ratio == 0:
+	case o.ratio < 1 || o.ratio > maxRatio:
+		return o, fmt.Errorf("zip-ratio must be between 1 and %d, the most deflate expands, got %d", maxRatio, o.ratio)
+	case o.encryption != EncryptionNone:
+		return o, fmt.Errorf("zip-ratio cannot be combined with encryption")
+	case len(o.entryTypes) > 0:
+		return o, fmt.Errorf("zip-ratio cannot be combined with zip-entry-type")
+	}
+	sfx, err := opts.Bool("zip-sfx", false)
+	if err != nil {
+		return o, err
+	}
+	if sfx {
+		o.prefix = sfxStub
+	}
+
+	if o.rand, err = utils.NewRand(opts.String("seed", "")); err != nil {
+		return o, err
+	}
+	if o.filler, err = utils.ParseFiller(o.rand, opts.String("entropy", ""), opts.String("shared-blocks", ""), opts.String("shared-pool", "")); err != nil {
+		return o, err
+	}
+	if o.filler.Entropy < 1 && (o.compression == CompressionDeflate || o.ratio > 0) {
+		return o, fmt.Errorf("entropy cannot be combined with zip-compression deflate or zip-ratio")
+	}
+	if o.threads, err = utils.ParseThreads(opts.String("threads", "")); err != nil {
+		return o, err
+	}
+
+	eicar, err := opts.Bool("eicar", false)
+	if err != nil {
+		return o, err
+	}
+	if eicar {
+		o.fixed = append(o.fixed, bytesEntry(eicarEntryName, utils.EICAR()))
+	}
+	if o.stress, err = parseStress(opts, o); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// WithMetadata returns a copy of the generator that writes m into the
+// archive comment.
+func (g *ZipGenerator) WithMetadata(m ports.Metadata) ports.FileGenerator {
+	c := *g
+	c.meta = m
+	return &c
+}
+
+// WithStats returns a copy of the generator that records the total
+// uncompressed size of the entries of each "zip-ratio" archive in s as
+// "uncompressed_size". Other archives expand to about their own size, so
+// it is left out for them.
+func (g *ZipGenerator) WithStats(s ports.Stats) ports.FileGenerator {
+	c := *g
+	c.stats = s
+	return &c
+}
+
+// metadataComment renders m as "key: value" lines.
+func metadataComment(m ports.Metadata) string {
+	var b strings.Builder
+	for _, k := range m.Keys() {
+		fmt.Fprintf(&b, "%s: %s\n", k, m[k])
+	}
+	return b.String()
+}
+
 func (g *ZipGenerator) Generate(path string, size int64) error {
-	const entryName = "dummy.bin"
+	return g.GenerateWithOptions(path, size, nil)
+}
+
+// GenerateWithOptions writes a ZIP of exactly size bytes. By default it holds
+// a single stored entry of random data; opts can request several entries,
+// entries produced by other registered generators, Deflate compression,
+// ZipCrypto/AES-256 encryption and a leading eicar.com entry holding the
+// EICAR anti-virus test string. The "mtime" option fixes the entries'
+// modification time. Metadata set with WithMetadata starts the
+// archive comment as "key: value" lines.
+//
+// With "zip-nest-depth", the archive holds "zip-nest-branching" archives,
+// each holding as many again, that many levels down to archives with the
+// entries above, for testing extraction safeguards. "zip-sfx" puts a shell
+// stub ahead of the archive that extracts it, as self-extracting archives
+// carry an executable. "zip-ratio" makes the entries compression-ratio
+// fixtures: deflated runs of zeros sized to the archive that expand about
+// that many times, up to the 1032:1 deflate allows. "entropy" below 1
+// leaves only that share of the stored entries' data random and repeats a
+// pattern in the rest, so the archive compresses to about that share.
+// "shared-blocks" draws that share of the data from the chunk pool seeded
+// by "shared-pool", which other archives of the pool have in common.
+// "threads" makes the stored entries' data on that many goroutines.
+//
+// "zip-name-length", "zip-unicode-names", "zip-descriptor" and
+// "zip-local-order" make the archive pathological but valid, for
+// exercising extraction libraries: see writeStressArchive.
+func (g *ZipGenerator) GenerateWithOptions(path string, size int64, opts ports.Options) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	o.comment = metadataComment(g.meta)
+	if int64(len(o.comment)) > maxCommentLen {
+		return fmt.Errorf("metadata needs %d bytes, more than a zip comment holds (%d)", len(o.comment), maxCommentLen)
+	}
+	o.factory, o.fs = g.factory, g.fs
+	if o.nestDepth > 0 {
+		if min := nestedMinSize(o); size < min {
+			return fmt.Errorf("requested size %d too small for %d levels of nested archives, minimum is %d", size, o.nestDepth, min)
+		}
+	}
+	entries, slack, wo, cleanup, err := planArchive(size, o)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if g.stats != nil && o.ratio > 0 {
+		var expanded int64
+		for _, e := range append(slices.Clip(wo.fixed), entries...) {
+			expanded += e.size
+		}
+		g.stats["uncompressed_size"] = expanded
+	}
+
+	// 3. Open file and write the archive - THIS MUST MATCH THE OVERHEAD CALCULATION
+	f, err := outputfs.Create(g.fs, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // Ensure file is closed eventually
+	if err := writeArchive(f, entries, slack, wo); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeSized writes an archive of exactly size bytes described by o to w.
+func writeSized(w io.Writer, size int64, o zipOptions) error {
+	entries, slack, wo, cleanup, err := planArchive(size, o)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return writeArchive(w, entries, slack, wo)
+}
 
-	// 1. Compute overhead: size of a ZIP with dummy.bin but zero payload.
+// planArchive plans a size-byte archive described by o: its entries, the
+// comment padding that absorbs any slack and the options to write them
+// with. The returned cleanup removes any temporary files behind the
+// entries.
+func planArchive(size int64, o zipOptions) (entries []entry, slack int64, wo zipOptions, cleanup func(), err error) {
+	cleanup = func() {}
+	if o.nestDepth > 0 {
+		entries, wo = planNested(size, o)
+		return entries, 0, wo, cleanup, nil
+	}
+	names := entryNames(o)
+	if o.ratio > 0 {
+		entries, err = planRatioEntries(names, size, o)
+		return entries, 0, o, cleanup, err
+	}
+
+	if o.stress.enabled() && size > maxStressSize {
+		return nil, 0, o, cleanup, fmt.Errorf("requested size %d too large for zip stress options, maximum is %d", size, int64(maxStressSize))
+	}
+
+	// 1. Compute overhead: size of a ZIP with all entries but zero payload.
 	//    Use the internal helper which MUST match the header creation below.
-	overhead := zipEntryOverhead(entryName) // Use the updated helper below
+	overhead := archiveOverhead(names, o)
 	if overhead <= 0 {
 		// Basic sanity check
-		return fmt.Errorf("internal error: calculated zip overhead is %d", overhead)
+		return nil, 0, o, cleanup, fmt.Errorf("internal error: calculated zip overhead is %d", overhead)
 	}
 	if size < overhead { // Check if size is less than the *correct* overhead
-		return fmt.Errorf("requested size %d too small, minimum is %d", size, overhead)
+		return nil, 0, o, cleanup, fmt.Errorf("requested size %d too small, minimum is %d", size, overhead)
 	}
 
-	// 2. Payload bytes to write
-	dataBytes := size - overhead
+	// 2. Plan the entries and the archive comment that absorbs any slack
+	if o.compression == CompressionDeflate {
+		entries, slack, err = planDeflatedEntries(names, size, o)
+		if err != nil {
+			return nil, 0, o, cleanup, err
+		}
+	} else {
+		// Payload bytes to write, split across the entries
+		dataBytes := size - overhead
+		entries, cleanup, err = planEntries(names, dataBytes, o)
+		if err != nil {
+			return nil, 0, o, cleanup, err
+		}
+
+		// Inner generators may land a few bytes short; the archive comment
+		// absorbs the difference so the outer size stays exact.
+		var used int64
+		for _, e := range entries {
+			used += e.size
+		}
+		slack = dataBytes - used
+		if slack < 0 || slack > o.commentRoom() {
+			cleanup()
+			return nil, 0, o, func() {}, fmt.Errorf("inner entries total %d bytes, cannot pad to %d via archive comment", used, dataBytes)
+		}
+	}
+	return entries, slack, o, cleanup, nil
+}
 
-	// 3. Open file and ZIP writer
-	f, err := os.Create(path)
+// Plan reports the archive Generate would write for size: one stored entry
+// of random data filling everything beyond the ZIP headers.
+func (g *ZipGenerator) Plan(size int64) (ports.GenerationPlan, error) {
+	o, err := parseOptions(nil)
 	if err != nil {
-		return err
+		return ports.GenerationPlan{}, err
 	}
-	defer f.Close() // Ensure file is closed eventually
-	zw := zip.NewWriter(f)
-	defer zw.Close() // Ensure zip writer is closed eventually
+	overhead := archiveOverhead(entryNames(o), o)
+	plan := ports.GenerationPlan{TargetSize: size, MinSize: overhead}
+	if plan.Feasible() {
+		plan.ContentBytes = size
+		plan.Structure = []ports.PlanItem{{Name: "entries", Count: int64(o.entries)}}
+	}
+	return plan, nil
+}
 
-	// 4. Create uncompressed entry - THIS MUST MATCH THE OVERHEAD CALCULATION
-	hdr := &zip.FileHeader{
-		Name:     entryName,
-		Method:   zip.Store,
-		Modified: time.Now(), // Include modification time here
+// Resize writes the archive at srcPath to outPath with its entries as they
+// are, plus a stored entry of zero bytes that brings it to exactly size.
+// An archive resized before has that entry replaced. Data ahead of the
+// archive, such as a self-extracting stub, is not kept.
+func (g *ZipGenerator) Resize(srcPath, outPath string, size int64) error {
+	return ooxml.Resize(g.fs, srcPath, outPath, size)
+}
+
+// writeArchive writes a complete ZIP holding entries to w, followed by an
+// archive comment of o.comment and commentLen bytes of padding.
+func writeArchive(w io.Writer, entries []entry, commentLen int64, o zipOptions) error {
+	if o.stress.enabled() {
+		return writeStressArchive(w, entries, commentLen, o)
 	}
-	w, err := zw.CreateHeader(hdr)
-	if err != nil {
-		// No need to close zw/f explicitly due to defer
-		return fmt.Errorf("failed to create zip header: %w", err)
+	if o.prefix != "" {
+		if _, err := io.WriteString(w, o.prefix); err != nil {
+			return fmt.Errorf("failed to write zip prefix: %w", err)
+		}
+	}
+	zw := zip.NewWriter(w)
+	zw.SetOffset(int64(len(o.prefix)))
+	for _, e := range append(slices.Clip(o.fixed), entries...) {
+		if e.compressed > 0 {
+			if err := writeCompressedEntry(zw, e, o); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeEntry(zw, e.name, e.size, e.fill, o); err != nil {
+			return err
+		}
+	}
+	if comment := o.comment + strings.Repeat(" ", int(commentLen)); comment != "" {
+		if err := zw.SetComment(comment); err != nil {
+			return fmt.Errorf("failed to set zip comment: %w", err)
+		}
 	}
+	// Close ZIP (writes central directory + EOCD)
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to close zip writer: %w", err)
+	}
+	return nil
+}
 
-	// 5. Fill with random data
-	if dataBytes > 0 { // Only write if there's data to write
-		if err := utils.WriteRandomBytes(w, dataBytes); err != nil {
-			// No need to close zw/f explicitly due to defer
-			return fmt.Errorf("failed to write zip data: %w", err)
+// writeEntry adds an entry named name holding n bytes produced by fill,
+// compressed and encrypted according to o. Encrypted entries use the raw
+// writer because archive/zip has no encryption support of its own.
+func writeEntry(zw *zip.Writer, name string, n int64, fill func(io.Writer) error, o zipOptions) error {
+	if o.encryption == EncryptionNone {
+		method := zip.Store
+		if o.compression == CompressionDeflate {
+			method = zip.Deflate
 		}
+		hdr := &zip.FileHeader{
+			Name:     name,
+			Method:   method,
+			Modified: o.modTime(), // Include modification time here
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("failed to create zip header: %w", err)
+		}
+		// Flushing the header tells the writer below where the data
+		// starts, for a resumed archive to read it back.
+		if err := zw.Flush(); err != nil {
+			return fmt.Errorf("failed to write zip header: %w", err)
+		}
+		if n > 0 {
+			if err := fill(w); err != nil {
+				return fmt.Errorf("failed to write zip data: %w", err)
+			}
+		}
+		return nil
 	}
 
-	// 6. Close ZIP (writes central directory + EOCD) - Handled by defer zw.Close()
-	// 7. Close File - Handled by defer f.Close()
+	hdr := &zip.FileHeader{
+		Name:           name,
+		CreatorVersion: 20,
+		ReaderVersion:  20,
+		Flags:          0x1, // encrypted
+		Method:         zip.Store,
+	}
+	hdr.ModifiedDate, hdr.ModifiedTime = msDosTime(o.modTime())
 
-	// Explicitly check errors from deferred Close calls
-	if err := zw.Close(); err != nil {
-		// f.Close() will still run due to its defer
-		return fmt.Errorf("failed to close zip writer: %w", err)
+	switch o.encryption {
+	case EncryptionZipCrypto:
+		// The CRC is only known after streaming, so use a data descriptor.
+		hdr.Flags |= 0x8
+		w, err := zw.CreateRaw(hdr)
+		if err != nil {
+			return fmt.Errorf("failed to create zip header: %w", err)
+		}
+		cw, err := newZipCryptoWriter(o.rand, w, o.password, hdr.ModifiedTime)
+		if err != nil {
+			return fmt.Errorf("failed to write zipcrypto header: %w", err)
+		}
+		if n > 0 {
+			if err := fill(cw); err != nil {
+				return fmt.Errorf("failed to write zip data: %w", err)
+			}
+		}
+		hdr.CRC32 = cw.crc.Sum32()
+		hdr.UncompressedSize64 = uint64(n)
+		hdr.CompressedSize64 = uint64(n) + zipCryptoHeaderLen
+		hdr.UncompressedSize = uint32(min(hdr.UncompressedSize64, 0xFFFFFFFF))
+		hdr.CompressedSize = uint32(min(hdr.CompressedSize64, 0xFFFFFFFF))
+
+	case EncryptionAES256:
+		// AE-2 stores no CRC, so sizes are known up front.
+		hdr.ReaderVersion = 51
+		hdr.Method = aesMethod
+		hdr.Extra = aesExtraField(zip.Store)
+		hdr.UncompressedSize64 = uint64(n)
+		hdr.CompressedSize64 = uint64(n) + aesOverhead
+		w, err := zw.CreateRaw(hdr)
+		if err != nil {
+			return fmt.Errorf("failed to create zip header: %w", err)
+		}
+		aw, err := newAESWriter(o.rand, w, o.password)
+		if err != nil {
+			return fmt.Errorf("failed to initialise aes encryption: %w", err)
+		}
+		if n > 0 {
+			if err := fill(aw); err != nil {
+				return fmt.Errorf("failed to write zip data: %w", err)
+			}
+		}
+		if err := aw.Close(); err != nil {
+			return fmt.Errorf("failed to write aes authentication code: %w", err)
+		}
 	}
-	// f.Close() error is implicitly handled by returning from the function
+	return nil
+}
 
-	return nil // Success
+// randomFill returns a fill function writing n bytes of filler from r,
+// random unless the options set it otherwise, made on threads goroutines.
+// The bytes are the same on any number of them.
+func randomFill(r *utils.Rand, n int64, filler utils.Filler, threads int) func(io.Writer) error {
+	return func(w io.Writer) error {
+		return utils.WriteParallel(w, n, threads, func(b []byte, offset int64) error {
+			return filler.Fill(r, b, offset)
+		})
+	}
 }
 
-// zipEntryOverhead returns the byte-length of a ZIP containing
-// exactly one STORE-method entry named `name` with zero payload.
-// THIS MUST MATCH THE HEADER FIELDS USED IN Generate!
-func zipEntryOverhead(name string) int64 {
-	buf := &bytes.Buffer{}
+// archiveOverhead returns the byte-length of a ZIP holding the named entries
+// with zero payload, written exactly as writeEntry would write them.
+// THIS MUST MATCH THE HEADER FIELDS USED IN writeEntry!
+func archiveOverhead(names []string, o zipOptions) int64 {
+	if o.stress.enabled() {
+		return stressOverhead(names, o)
+	}
+	buf := bytes.NewBufferString(o.prefix)
 	zw := zip.NewWriter(buf)
-	// Create a STORE entry with no data, matching Generate's header settings
-	hdr := &zip.FileHeader{
-		Name:     name,
-		Method:   zip.Store,
-		Modified: time.Now(), // Include modification time here too!
+	zw.SetOffset(int64(len(o.prefix)))
+	for _, e := range o.fixed {
+		if err := writeEntry(zw, e.name, e.size, e.fill, o); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: archiveOverhead internal write failed: %v\n", err)
+			return -1
+		}
 	}
-	// We don't actually need the writer, just create the header effects
-	_, err := zw.CreateHeader(hdr)
-	if err != nil {
-		// Should not happen in this controlled scenario
-		fmt.Fprintf(os.Stderr, "Warning: zipEntryOverhead internal CreateHeader failed: %v\n", err)
-		return -1 // Indicate error
+	for _, name := range names {
+		if err := writeEntry(zw, name, 0, randomFill(o.rand, 0, utils.RandomFiller, 1), o); err != nil {
+			// Should not happen in this controlled scenario
+			fmt.Fprintf(os.Stderr, "Warning: archiveOverhead internal write failed: %v\n", err)
+			return -1 // Indicate error
+		}
+	}
+	if err := zw.SetComment(o.comment); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: archiveOverhead internal SetComment failed: %v\n", err)
+		return -1
 	}
 	// Close the writer to finalize the structure (central directory etc.)
-	err = zw.Close()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: zipEntryOverhead internal Close failed: %v\n", err)
+	if err := zw.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: archiveOverhead internal Close failed: %v\n", err)
 		return -1 // Indicate error
 	}
 	return int64(buf.Len())
 }
+
+// msDosTime converts t to the MS-DOS date and time fields used in ZIP headers.
+func msDosTime(t time.Time) (date, tm uint16) {
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	tm = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, tm
+}
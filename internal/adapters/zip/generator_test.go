@@ -3,14 +3,26 @@ package zip
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 	"time" // Import time package
 
+	_ "github.com/hailam/genfile/internal/adapters/csv"
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	_ "github.com/hailam/genfile/internal/adapters/png"
 	"github.com/hailam/genfile/internal/ports" //
+	"github.com/hailam/genfile/internal/utils"
 )
 
 // Helper function directly within the test to calculate expected overhead
@@ -154,3 +166,547 @@ func TestZipGenerator_Generate(t *testing.T) {
 		}
 	})
 }
+
+func TestZipGenerator_GenerateEncrypted(t *testing.T) {
+	generator := New().(*ZipGenerator)
+	tempDir := t.TempDir()
+	const password = "s3cret"
+
+	for _, mode := range []string{EncryptionZipCrypto, EncryptionAES256} {
+		for _, extra := range []int64{0, 1, 70000} {
+			t.Run(fmt.Sprintf("%s_%d", mode, extra), func(t *testing.T) {
+				opts := ports.Options{"zip-encryption": mode, "zip-password": password}
+				o, err := parseOptions(opts)
+				if err != nil {
+					t.Fatalf("parseOptions: %v", err)
+				}
+				size := archiveOverhead([]string{"dummy.bin"}, o) + extra
+				outPath := filepath.Join(tempDir, fmt.Sprintf("enc_%s_%d.zip", mode, extra))
+
+				if err := generator.GenerateWithOptions(outPath, size, opts); err != nil {
+					t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+				}
+				info, err := os.Stat(outPath)
+				if err != nil {
+					t.Fatalf("stat: %v", err)
+				}
+				if info.Size() != size {
+					t.Errorf("Generated file size = %d, want %d", info.Size(), size)
+				}
+
+				zr, err := zip.OpenReader(outPath)
+				if err != nil {
+					t.Fatalf("Failed to open generated zip: %v", err)
+				}
+				defer zr.Close()
+				if len(zr.File) != 1 {
+					t.Fatalf("zip contains %d files, want 1", len(zr.File))
+				}
+				entry := zr.File[0]
+				if entry.Flags&0x1 == 0 {
+					t.Errorf("entry is not flagged as encrypted")
+				}
+				if entry.UncompressedSize64 != uint64(extra) {
+					t.Errorf("UncompressedSize64 = %d, want %d", entry.UncompressedSize64, extra)
+				}
+				rc, err := entry.OpenRaw()
+				if err != nil {
+					t.Fatalf("OpenRaw: %v", err)
+				}
+				raw, err := io.ReadAll(rc)
+				if err != nil {
+					t.Fatalf("read raw entry: %v", err)
+				}
+
+				switch mode {
+				case EncryptionZipCrypto:
+					keys := newZipCryptoKeys(password)
+					plain := make([]byte, len(raw))
+					for i, c := range raw {
+						p := c ^ keys.streamByte()
+						keys.update(p)
+						plain[i] = p
+					}
+					if plain[zipCryptoHeaderLen-1] != byte(entry.ModifiedTime>>8) {
+						t.Errorf("zipcrypto check byte mismatch: wrong password derivation")
+					}
+					if got := crc32.ChecksumIEEE(plain[zipCryptoHeaderLen:]); got != entry.CRC32 {
+						t.Errorf("decrypted CRC = %08x, want %08x", got, entry.CRC32)
+					}
+				case EncryptionAES256:
+					if entry.Method != aesMethod {
+						t.Errorf("entry method = %d, want %d", entry.Method, aesMethod)
+					}
+					salt := raw[:aesSaltLen]
+					key, err := pbkdf2.Key(sha1.New, password, salt, aesKDFIterations, 2*aesKeyLen+aesVerifierLen)
+					if err != nil {
+						t.Fatalf("pbkdf2: %v", err)
+					}
+					if !bytes.Equal(raw[aesSaltLen:aesSaltLen+aesVerifierLen], key[2*aesKeyLen:]) {
+						t.Errorf("password verifier mismatch")
+					}
+					mac := hmac.New(sha1.New, key[aesKeyLen:2*aesKeyLen])
+					mac.Write(raw[aesSaltLen+aesVerifierLen : len(raw)-aesAuthCodeLen])
+					if !bytes.Equal(mac.Sum(nil)[:aesAuthCodeLen], raw[len(raw)-aesAuthCodeLen:]) {
+						t.Errorf("authentication code mismatch")
+					}
+				}
+			})
+		}
+	}
+
+	t.Run("MissingPassword", func(t *testing.T) {
+		err := generator.GenerateWithOptions(filepath.Join(tempDir, "nopw.zip"), 1000, ports.Options{"zip-encryption": EncryptionAES256})
+		if err == nil {
+			t.Errorf("expected an error when no password is given")
+		}
+	})
+	t.Run("UnknownMode", func(t *testing.T) {
+		err := generator.GenerateWithOptions(filepath.Join(tempDir, "bad.zip"), 1000, ports.Options{"zip-encryption": "rot13", "zip-password": "x"})
+		if err == nil {
+			t.Errorf("expected an error for an unknown encryption mode")
+		}
+	})
+}
+
+func TestZipGenerator_GenerateMultiEntry(t *testing.T) {
+	generator := New().(*ZipGenerator)
+	tempDir := t.TempDir()
+
+	testCases := []struct {
+		name      string
+		opts      ports.Options
+		size      int64
+		wantNames []string
+	}{
+		{
+			name:      "RandomEntries",
+			opts:      ports.Options{"zip-entries": "5"},
+			size:      20000,
+			wantNames: []string{"entry_001.bin", "entry_002.bin", "entry_003.bin", "entry_004.bin", "entry_005.bin"},
+		},
+		{
+			name:      "RandomDistribution",
+			opts:      ports.Options{"zip-entries": "3", "zip-entry-distribution": "random"},
+			size:      20000,
+			wantNames: []string{"entry_001.bin", "entry_002.bin", "entry_003.bin"},
+		},
+		{
+			name:      "MixedInnerTypes",
+			opts:      ports.Options{"zip-entries": "4", "zip-entry-type": "png,csv"},
+			size:      200000,
+			wantNames: []string{"entry_001.png", "entry_002.csv", "entry_003.png", "entry_004.csv"},
+		},
+		{
+			name:      "EncryptedInnerTypes",
+			opts:      ports.Options{"zip-entries": "2", "zip-entry-type": "csv", "zip-encryption": "zipcrypto", "zip-password": "pw"},
+			size:      10000,
+			wantNames: []string{"entry_001.csv", "entry_002.csv"},
+		},
+		{
+			name:      "EICAR",
+			opts:      ports.Options{"eicar": "true"},
+			size:      5000,
+			wantNames: []string{"eicar.com", "dummy.bin"},
+		},
+		{
+			name:      "EICARDeflated",
+			opts:      ports.Options{"eicar": "true", "zip-entries": "2", "zip-compression": "deflate"},
+			size:      50000,
+			wantNames: []string{"eicar.com", "entry_001.bin", "entry_002.bin"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(tempDir, tc.name+".zip")
+			if err := generator.GenerateWithOptions(outPath, tc.size, tc.opts); err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			info, err := os.Stat(outPath)
+			if err != nil {
+				t.Fatalf("stat: %v", err)
+			}
+			if info.Size() != tc.size {
+				t.Errorf("Generated file size = %d, want %d", info.Size(), tc.size)
+			}
+			zr, err := zip.OpenReader(outPath)
+			if err != nil {
+				t.Fatalf("Failed to open generated zip: %v", err)
+			}
+			defer zr.Close()
+			if len(zr.File) != len(tc.wantNames) {
+				t.Fatalf("zip contains %d files, want %d", len(zr.File), len(tc.wantNames))
+			}
+			for i, f := range zr.File {
+				if f.Name != tc.wantNames[i] {
+					t.Errorf("entry %d name = %q, want %q", i, f.Name, tc.wantNames[i])
+				}
+				if f.Name == eicarEntryName {
+					rc, err := f.Open()
+					if err != nil {
+						t.Fatalf("open %s: %v", f.Name, err)
+					}
+					data, _ := io.ReadAll(rc)
+					rc.Close()
+					if !bytes.Equal(data, utils.EICAR()) {
+						t.Errorf("%s holds %q, want the EICAR test string", f.Name, data)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("InnerOptions", func(t *testing.T) {
+		outPath := filepath.Join(tempDir, "gray.zip")
+		if err := generator.GenerateWithOptions(outPath, 50000, ports.Options{"zip-entry-type": "png", "png-color": "gray"}); err != nil {
+			t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+		}
+		zr, err := zip.OpenReader(outPath)
+		if err != nil {
+			t.Fatalf("Failed to open generated zip: %v", err)
+		}
+		defer zr.Close()
+		rc, err := zr.File[0].Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", zr.File[0].Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		// The IHDR color type follows the signature, chunk header,
+		// dimensions and bit depth.
+		if len(data) < 26 || data[25] != 0 {
+			t.Errorf("%s is not a grayscale PNG; png-color did not reach the entry", zr.File[0].Name)
+		}
+	})
+
+	t.Run("ParentFactory", func(t *testing.T) {
+		// The entries come from the factory the archive's generator was
+		// handed out by, and are rendered on its file system.
+		opts := ports.Options{"zip-entries": "2", "zip-entry-type": "csv"}
+		empty := generator.WithFactory(factory.NewRegistryFactory(factory.NewRegistry(), nil, nil)).(*ZipGenerator)
+		if err := empty.GenerateWithOptions(filepath.Join(tempDir, "empty.zip"), 10000, opts); err == nil {
+			t.Error("expected an error for a type the factory lacks")
+		}
+		chaos := &outputfs.Chaos{Faults: []outputfs.Fault{{Kind: outputfs.FaultAccess}}}
+		denied, err := factory.NewRegistryFactory(factory.DefaultRegistry(), nil, chaos).For(ports.FileTypeZIP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ports.Generate(denied, filepath.Join(tempDir, "denied.zip"), 10000, ports.WithOption("zip-entry-type", "csv"))
+		if !errors.Is(err, syscall.EACCES) || !strings.Contains(err.Error(), "zip entry") {
+			t.Errorf("error on a read-only file system = %v, want the entry refused", err)
+		}
+	})
+
+	t.Run("UnknownInnerType", func(t *testing.T) {
+		err := generator.GenerateWithOptions(filepath.Join(tempDir, "bad.zip"), 10000, ports.Options{"zip-entry-type": "nope"})
+		if err == nil {
+			t.Errorf("expected an error for an unregistered inner type")
+		}
+	})
+}
+
+func TestZipGenerator_Configure(t *testing.T) {
+	configured, err := New().(*ZipGenerator).Configure(ports.Options{"zip-entries": "3"})
+	if err != nil {
+		t.Fatalf("Configure returned unexpected error: %v", err)
+	}
+	outPath := filepath.Join(t.TempDir(), "configured.zip")
+	if err := configured.Generate(outPath, 10000); err != nil {
+		t.Fatalf("Generate returned unexpected error: %v", err)
+	}
+	zr, err := zip.OpenReader(outPath)
+	if err != nil {
+		t.Fatalf("Failed to open generated zip: %v", err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 3 {
+		t.Errorf("configured generator wrote %d entries, want 3", len(zr.File))
+	}
+
+	if _, err := New().(*ZipGenerator).Configure(ports.Options{"zip-encryption": "aes256"}); err == nil {
+		t.Error("Configure without a password: expected an error")
+	}
+}
+
+func TestZipGenerator_GenerateDeflate(t *testing.T) {
+	generator := New().(*ZipGenerator)
+	tempDir := t.TempDir()
+
+	for _, size := range []int64{300, 10000, 70000, 100000, 1 << 20} {
+		t.Run(fmt.Sprintf("Size_%d", size), func(t *testing.T) {
+			outPath := filepath.Join(tempDir, fmt.Sprintf("deflate_%d.zip", size))
+			opts := ports.Options{"zip-compression": "deflate", "zip-entries": "2"}
+			if err := generator.GenerateWithOptions(outPath, size, opts); err != nil {
+				t.Fatalf("GenerateWithOptions returned unexpected error: %v", err)
+			}
+			info, err := os.Stat(outPath)
+			if err != nil {
+				t.Fatalf("stat: %v", err)
+			}
+			if info.Size() != size {
+				t.Errorf("Generated file size = %d, want %d", info.Size(), size)
+			}
+			zr, err := zip.OpenReader(outPath)
+			if err != nil {
+				t.Fatalf("Failed to open generated zip: %v", err)
+			}
+			defer zr.Close()
+			var compressed, uncompressed uint64
+			for _, f := range zr.File {
+				if f.Method != zip.Deflate {
+					t.Errorf("entry %s method = %d, want Deflate", f.Name, f.Method)
+				}
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("open entry: %v", err)
+				}
+				if _, err := io.Copy(io.Discard, rc); err != nil {
+					t.Errorf("entry %s failed to inflate: %v", f.Name, err)
+				}
+				rc.Close()
+				compressed += f.CompressedSize64
+				uncompressed += f.UncompressedSize64
+			}
+			if len(zr.Comment) > deflateCommentAim {
+				t.Errorf("comment pads the archive by %d bytes, want at most %d", len(zr.Comment), deflateCommentAim)
+			}
+			if size >= 1<<20 && uncompressed <= compressed {
+				t.Errorf("payload did not compress: %d uncompressed vs %d compressed", uncompressed, compressed)
+			}
+		})
+	}
+
+	t.Run("RejectsEncryption", func(t *testing.T) {
+		opts := ports.Options{"zip-compression": "deflate", "zip-encryption": "aes256", "zip-password": "x"}
+		if err := generator.GenerateWithOptions(filepath.Join(tempDir, "bad.zip"), 10000, opts); err == nil {
+			t.Errorf("expected an error combining deflate with encryption")
+		}
+	})
+}
+
+func TestZipGenerator_Plan(t *testing.T) {
+	g := New().(*ZipGenerator)
+	minSize := calculateTestOverhead("dummy.bin")
+
+	tests := []struct {
+		name         string
+		size         int64
+		wantFeasible bool
+	}{
+		{"Below minimum", minSize - 1, false},
+		{"Minimum", minSize, true},
+		{"Large", 1 << 20, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := g.Plan(tc.size)
+			if err != nil {
+				t.Fatalf("Plan(%d) error = %v", tc.size, err)
+			}
+			if plan.MinSize != minSize || plan.Feasible() != tc.wantFeasible {
+				t.Errorf("Plan(%d) = %+v, want MinSize %d, feasible %v", tc.size, plan, minSize, tc.wantFeasible)
+			}
+			if tc.wantFeasible && plan.ContentBytes+plan.PaddingBytes != tc.size {
+				t.Errorf("Plan(%d) content %d + padding %d does not add up", tc.size, plan.ContentBytes, plan.PaddingBytes)
+			}
+		})
+	}
+}
+
+func TestZipGenerator_WithMetadata(t *testing.T) {
+	generator := New().(ports.MetadataCapable).WithMetadata(ports.Metadata{
+		ports.MetaAuthor: "QA",
+		ports.MetaTitle:  "Fixtures",
+	})
+	const want = "author: QA\ntitle: Fixtures\n"
+	for _, opts := range []ports.Options{nil, {"zip-compression": "deflate", "zip-entries": "3"}} {
+		outPath := filepath.Join(t.TempDir(), "meta.zip")
+		const size = 20000
+		if err := generator.(ports.OptionsGenerator).GenerateWithOptions(outPath, size, opts); err != nil {
+			t.Fatalf("GenerateWithOptions(%v) returned unexpected error: %v", opts, err)
+		}
+		info, err := os.Stat(outPath)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if info.Size() != size {
+			t.Errorf("Generated file size = %d, want %d", info.Size(), size)
+		}
+		zr, err := zip.OpenReader(outPath)
+		if err != nil {
+			t.Fatalf("Failed to open generated zip: %v", err)
+		}
+		if !strings.HasPrefix(zr.Comment, want) {
+			t.Errorf("archive comment starts %q, want %q", zr.Comment[:min(len(zr.Comment), len(want))], want)
+		}
+		zr.Close()
+	}
+}
+
+func TestZipGenerator_MTime(t *testing.T) {
+	want := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, opts := range []ports.Options{
+		{"mtime": "2020-01-01T00:00:00Z", "zip-entries": "2"},
+		{"mtime": "2020-01-01T00:00:00Z", "zip-encryption": "zipcrypto", "zip-password": "pw"},
+	} {
+		outPath := filepath.Join(t.TempDir(), "mtime.zip")
+		if err := New().(ports.OptionsGenerator).GenerateWithOptions(outPath, 10000, opts); err != nil {
+			t.Fatalf("GenerateWithOptions(%v) returned unexpected error: %v", opts, err)
+		}
+		zr, err := zip.OpenReader(outPath)
+		if err != nil {
+			t.Fatalf("Failed to open generated zip: %v", err)
+		}
+		for _, f := range zr.File {
+			if !f.Modified.Equal(want) {
+				t.Errorf("%v: entry %s modified %v, want %v", opts, f.Name, f.Modified, want)
+			}
+		}
+		zr.Close()
+	}
+
+	err := New().(ports.OptionsGenerator).GenerateWithOptions(filepath.Join(t.TempDir(), "bad.zip"), 10000, ports.Options{"mtime": "soon"})
+	if err == nil || !strings.Contains(err.Error(), "option mtime") {
+		t.Errorf("expected an invalid mtime error, got %v", err)
+	}
+}
+
+func TestZipGenerator_Nested(t *testing.T) {
+	generator := New().(*ZipGenerator)
+
+	testCases := []struct {
+		name      string
+		opts      ports.Options
+		size      int64
+		leaves    int    // innermost archives
+		leafEntry string // first entry of each innermost archive
+		errSub    string
+	}{
+		{name: "Chain", opts: ports.Options{"zip-nest-depth": "5"}, size: 10000, leaves: 1, leafEntry: "dummy.bin"},
+		{name: "Tree", opts: ports.Options{"zip-nest-depth": "3", "zip-nest-branching": "3"}, size: 100001, leaves: 27, leafEntry: "dummy.bin"},
+		{name: "InnerEntries", opts: ports.Options{"zip-nest-depth": "2", "zip-nest-branching": "2", "zip-entries": "3", "zip-entry-type": "csv"}, size: 50000, leaves: 4, leafEntry: "entry_001.csv"},
+		{name: "Encrypted", opts: ports.Options{"zip-nest-depth": "2", "zip-encryption": "aes256", "zip-password": "pw"}, size: 5000, leaves: 1},
+		{name: "SFX", opts: ports.Options{"zip-nest-depth": "1", "zip-sfx": "true", "eicar": "true"}, size: 4000, leaves: 1, leafEntry: eicarEntryName},
+		{name: "TooSmall", opts: ports.Options{"zip-nest-depth": "4", "zip-nest-branching": "4"}, size: 5000, errSub: "too small"},
+		{name: "TooMany", opts: ports.Options{"zip-nest-depth": "10", "zip-nest-branching": "10"}, size: 1 << 30, errSub: "exceed the limit"},
+		{name: "TooDeep", opts: ports.Options{"zip-nest-depth": "65"}, size: 1 << 20, errSub: "zip-nest-depth"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(t.TempDir(), "nested.zip")
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			if sfx := tc.opts["zip-sfx"] == "true"; sfx != strings.HasPrefix(string(data), "#!/bin/sh\n") {
+				t.Errorf("file starts with %.10q, want the shell stub: %v", data, sfx)
+			}
+			if tc.opts.Has("zip-encryption") {
+				// The nested archives are encrypted and cannot be opened
+				// without the password; check the outer one only.
+				zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+				if err != nil || len(zr.File) != 1 || zr.File[0].Name != "nested_001.zip" {
+					t.Fatalf("outer archive unreadable or wrong: %v", err)
+				}
+				return
+			}
+			depth, _ := tc.opts.Int("zip-nest-depth", 0)
+			leaves := 0
+			walkNested(t, data, depth, tc.leafEntry, &leaves)
+			if leaves != tc.leaves {
+				t.Errorf("found %d innermost archives, want %d", leaves, tc.leaves)
+			}
+		})
+	}
+}
+
+// walkNested opens the archive in data and, depth levels down, counts the
+// innermost archives, checking their first entry is named leafEntry.
+func walkNested(t *testing.T, data []byte, depth int, leafEntry string, leaves *int) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open nested archive: %v", err)
+	}
+	if depth == 0 {
+		*leaves++
+		if zr.File[0].Name != leafEntry {
+			t.Errorf("innermost archive starts with %q, want %q", zr.File[0].Name, leafEntry)
+		}
+		return
+	}
+	for i, f := range zr.File {
+		if want := fmt.Sprintf("nested_%03d.zip", i+1); f.Name != want {
+			t.Fatalf("entry %d = %q, want %q", i, f.Name, want)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		inner, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		walkNested(t, inner, depth-1, leafEntry, leaves)
+	}
+}
+
+func TestZipGenerator_GenerateFrom(t *testing.T) {
+	g := New().(*ZipGenerator)
+	var _ ports.ResumableGenerator = g
+	opts := ports.Options{"mtime": "2020-01-01T00:00:00Z", "zip-entries": "3", "zip-sfx": "true", "eicar": "true"}
+	const size, stop = 200000, 120000
+	dir := t.TempDir()
+
+	// The run resumed stopped part way into the second entry's data.
+	path := filepath.Join(dir, "resumed.zip")
+	if err := g.GenerateFrom(path, size, opts, ports.ResumeState{}, nil); err != nil {
+		t.Fatalf("GenerateFrom returned unexpected error: %v", err)
+	}
+	if err := os.Truncate(path, stop); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.GenerateFrom(path, size, opts, ports.ResumeState{Offset: stop}, nil); err != nil {
+		t.Fatalf("resumed GenerateFrom returned unexpected error: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Size() != size {
+		t.Errorf("resumed archive is %d bytes, want %d", info.Size(), size)
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("Failed to open resumed zip: %v", err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, rc); err != nil {
+			t.Errorf("entry %s: %v", f.Name, err)
+		}
+		rc.Close()
+	}
+
+	for _, bad := range []ports.Options{{"zip-compression": "deflate"}, {"zip-entries": "1"}} {
+		if err := g.GenerateFrom(filepath.Join(dir, "bad.zip"), size, bad, ports.ResumeState{Offset: 1000}, nil); err == nil {
+			t.Errorf("GenerateFrom(%v) resumed, want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package zip
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand/v2"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// The "zip-ratio" option writes deflate streams built by hand rather than
+// by compress/flate: a dynamic Huffman block of back-references that each
+// repeat 258 zero bytes in two bits, then stored blocks of zero bytes that
+// bring the stream to its exact compressed size. Writing them costs only
+// the compressed bytes, however far they expand.
+const (
+	// maxMatch is the longest back-reference deflate encodes.
+	maxMatch = 258
+	// maxRatio is the expansion a run of two-bit back-references reaches.
+	maxRatio = maxMatch * 8 / 2
+	// maxStoredBlock is the most a stored block holds.
+	maxStoredBlock = 0xFFFF
+	// storedBlockOverhead is a stored block's header byte and its LEN and
+	// NLEN fields.
+	storedBlockOverhead = 5
+)
+
+// headerBits is the length of the dynamic block header written by
+// writeDynamicHeader.
+var headerBits = func() int64 {
+	bw := newBitWriter(io.Discard)
+	writeDynamicHeader(bw)
+	return bw.written
+}()
+
+// ratioStream describes one entry's deflate stream: a dynamic block with
+// a literal zero and copies back-references, then blocks stored blocks
+// holding stored zero bytes between them, the last one final.
+type ratioStream struct {
+	copies int64
+	stored int64
+	blocks int64
+}
+
+// size returns the number of bytes the stream inflates to.
+func (s ratioStream) size() int64 {
+	return 1 + maxMatch*s.copies + s.stored
+}
+
+// compressedSize returns the length of the stream.
+func (s ratioStream) compressedSize() int64 {
+	// The first stored block's 3 header bits share a byte with the end
+	// of the dynamic block.
+	dynamic := (headerBits + 2 + 2*s.copies + 2 + 3 + 7) / 8
+	return dynamic + storedBlockOverhead - 1 + s.stored + storedBlockOverhead*(s.blocks-1)
+}
+
+// minRatioStream is the shortest stream planRatioStream produces.
+var minRatioStream = ratioStream{blocks: 1}.compressedSize()
+
+// planRatioStream returns a stream of exactly size bytes inflating to
+// about ratio times as much.
+func planRatioStream(size int64, ratio int) (ratioStream, error) {
+	if size < minRatioStream {
+		return ratioStream{}, fmt.Errorf("entry of %d bytes too small for a deflate stream; need at least %d", size, minRatioStream)
+	}
+	// Each back-reference adds 258 bytes for a quarter byte, each stored
+	// byte one for one.
+	s := ratioStream{copies: max(0, int64(float64(size)*float64(ratio-1)/(maxMatch-0.25)))}
+	for {
+		rest := size - ratioStream{copies: s.copies, blocks: 1}.compressedSize()
+		if rest >= 0 {
+			// rest covers stored bytes and the headers of any blocks past
+			// the first; blocks may be short, even empty.
+			s.blocks = 1 + (rest+storedBlockOverhead-1)/(maxStoredBlock+storedBlockOverhead)
+			s.stored = rest - storedBlockOverhead*(s.blocks-1)
+			return s, nil
+		}
+		s.copies = max(0, s.copies+4*rest)
+	}
+}
+
+// write writes the stream to w.
+func (s ratioStream) write(w io.Writer) error {
+	buf := bufio.NewWriterSize(w, 64*1024)
+	bw := newBitWriter(buf)
+	writeDynamicHeader(bw)
+	bw.code(0b10, 2) // literal 0
+	// Length 258 (symbol 285) and distance 1 both have the code 0.
+	bw.zeros(2 * s.copies)
+	bw.code(0b11, 2) // end of block
+	left := s.stored
+	for i := int64(0); i < s.blocks; i++ {
+		n := min(left, maxStoredBlock)
+		final := uint64(0)
+		if i == s.blocks-1 {
+			final = 1
+		}
+		bw.bits(final, 1)
+		bw.bits(0, 2) // stored
+		bw.align()
+		bw.bits(uint64(n), 16)
+		bw.bits(uint64(^uint16(n)), 16)
+		bw.zeros(8 * n)
+		left -= n
+	}
+	if bw.err != nil {
+		return bw.err
+	}
+	return buf.Flush()
+}
+
+// writeDynamicHeader writes the header of a non-final dynamic Huffman
+// block whose literal/length code holds literal 0 and end-of-block in two
+// bits and length 258 in one, and whose distance code holds distance 1 in
+// one bit.
+func writeDynamicHeader(bw *bitWriter) {
+	bw.bits(0, 1) // not final
+	bw.bits(2, 2) // dynamic Huffman codes
+	bw.bits(286-257, 5)
+	bw.bits(1-1, 5)
+	bw.bits(18-4, 4)
+	// Code length code lengths in their transmission order: symbol 18
+	// (runs of zeros) in one bit, lengths 1 and 2 in two.
+	order := []int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1}
+	lengths := map[int]uint64{18: 1, 1: 2, 2: 2}
+	for _, sym := range order {
+		bw.bits(lengths[sym], 3)
+	}
+	// Canonical codes: 18 is 0, length 1 is 10 and length 2 is 11.
+	zeroRun := func(n uint64) {
+		bw.code(0, 1)
+		bw.bits(n-11, 7)
+	}
+	// Literal/length code lengths: 0 and 256 get 2, 285 gets 1.
+	bw.code(0b11, 2)
+	zeroRun(138)
+	zeroRun(117)
+	bw.code(0b11, 2)
+	zeroRun(28)
+	bw.code(0b10, 2)
+	// Distance code lengths: distance code 0 gets 1.
+	bw.code(0b10, 2)
+}
+
+// bitWriter writes a deflate bit stream: fields least significant bit
+// first, Huffman codes most significant bit first.
+type bitWriter struct {
+	w       io.Writer
+	acc     uint64
+	n       uint
+	written int64 // bits so far
+	err     error
+	zero    []byte
+}
+
+func newBitWriter(w io.Writer) *bitWriter {
+	return &bitWriter{w: w}
+}
+
+// bits writes the n low bits of v.
+func (b *bitWriter) bits(v uint64, n uint) {
+	b.acc |= v << b.n
+	b.n += n
+	b.written += int64(n)
+	for b.n >= 8 {
+		b.put([]byte{byte(b.acc)})
+		b.acc >>= 8
+		b.n -= 8
+	}
+}
+
+// code writes the n-bit Huffman code c.
+func (b *bitWriter) code(c uint64, n uint) {
+	var r uint64
+	for i := uint(0); i < n; i++ {
+		r = r<<1 | c>>i&1
+	}
+	b.bits(r, n)
+}
+
+// zeros writes n zero bits, whole bytes of them at once.
+func (b *bitWriter) zeros(n int64) {
+	for n > 0 && b.n != 0 {
+		b.bits(0, 1)
+		n--
+	}
+	if whole := n / 8; whole > 0 {
+		if b.zero == nil {
+			b.zero = make([]byte, 32*1024)
+		}
+		b.written += whole * 8
+		for whole > 0 {
+			k := min(whole, int64(len(b.zero)))
+			b.put(b.zero[:k])
+			whole -= k
+		}
+		n %= 8
+	}
+	b.bits(0, uint(n))
+}
+
+// align pads with zero bits to a byte boundary.
+func (b *bitWriter) align() {
+	if b.n > 0 {
+		b.bits(0, 8-b.n)
+	}
+}
+
+func (b *bitWriter) put(p []byte) {
+	if b.err == nil {
+		_, b.err = b.w.Write(p)
+	}
+}
+
+// ratioEntry returns an entry holding stream, to be written as is.
+func ratioEntry(name string, stream ratioStream) entry {
+	return entry{
+		name:       name,
+		size:       stream.size(),
+		compressed: stream.compressedSize(),
+		crc:        utils.CRC32Zeros(stream.size()),
+		fill:       stream.write,
+	}
+}
+
+// planRatioEntries splits size, less the archive headers, across the
+// named entries as deflate streams expanding about o.ratio times.
+func planRatioEntries(names []string, size int64, o zipOptions) ([]entry, error) {
+	seed := o.rand.Uint64()
+	plan := func(overhead int64) ([]entry, error) {
+		// Re-seed the distribution so every plan splits alike.
+		sizes := distributeSizes(size-overhead, len(names), o.distribution, rand.New(rand.NewPCG(seed, seed)))
+		entries := make([]entry, len(names))
+		for i, name := range names {
+			stream, err := planRatioStream(sizes[i], o.ratio)
+			if err != nil {
+				return nil, fmt.Errorf("requested size %d too small: %w", size, err)
+			}
+			entries[i] = ratioEntry(name, stream)
+		}
+		return entries, nil
+	}
+
+	// Headers grow once sizes need ZIP64 fields; replan until they settle.
+	overhead := headersSize(nil, names, o)
+	for range 3 {
+		if size < overhead+int64(len(names))*minRatioStream {
+			return nil, fmt.Errorf("requested size %d too small, minimum is %d", size, overhead+int64(len(names))*minRatioStream)
+		}
+		entries, err := plan(overhead)
+		if err != nil {
+			return nil, err
+		}
+		next := headersSize(entries, names, o)
+		if next == overhead {
+			return entries, nil
+		}
+		overhead = next
+	}
+	return nil, fmt.Errorf("could not settle the headers of a %d-byte archive", size)
+}
+
+// headersSize returns the length of the archive o describes with its
+// pre-compressed entries, or empty ones named names, left out.
+func headersSize(entries []entry, names []string, o zipOptions) int64 {
+	if entries == nil {
+		for _, name := range names {
+			entries = append(entries, ratioEntry(name, ratioStream{blocks: 1}))
+		}
+	}
+	bare := make([]entry, len(entries))
+	for i, e := range entries {
+		bare[i] = e
+		bare[i].fill = nil
+	}
+	cw := &countingWriter{}
+	if err := writeArchive(cw, bare, 0, o); err != nil {
+		return -1
+	}
+	return cw.n
+}
+
+// writeCompressedEntry adds e, whose payload is already deflated, as is.
+func writeCompressedEntry(zw *zip.Writer, e entry, o zipOptions) error {
+	hdr := &zip.FileHeader{
+		Name:               e.name,
+		CreatorVersion:     20,
+		ReaderVersion:      20,
+		Method:             zip.Deflate,
+		CRC32:              e.crc,
+		CompressedSize64:   uint64(e.compressed),
+		UncompressedSize64: uint64(e.size),
+	}
+	hdr.ModifiedDate, hdr.ModifiedTime = msDosTime(o.modTime())
+	w, err := zw.CreateRaw(hdr)
+	if err != nil {
+		return fmt.Errorf("failed to create zip header: %w", err)
+	}
+	if e.fill == nil {
+		return nil
+	}
+	if err := e.fill(w); err != nil {
+		return fmt.Errorf("failed to write zip data: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package zip
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestRatioStream(t *testing.T) {
+	// Every stream has its planned length and inflates to its planned
+	// number of zeros.
+	for _, ratio := range []int{1, 10, maxRatio} {
+		for _, size := range []int64{minRatioStream, 20, 21, 100, 1000, 70000, 200003} {
+			s, err := planRatioStream(size, ratio)
+			if err != nil {
+				t.Fatalf("planRatioStream(%d, %d) error = %v", size, ratio, err)
+			}
+			var buf bytes.Buffer
+			if err := s.write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if int64(buf.Len()) != size || s.compressedSize() != size {
+				t.Fatalf("ratio %d: stream of %d bytes planned as %d, want %d", ratio, buf.Len(), s.compressedSize(), size)
+			}
+			n, err := io.Copy(io.Discard, flate.NewReader(&buf))
+			if err != nil {
+				t.Fatalf("ratio %d, %d bytes: inflate: %v", ratio, size, err)
+			}
+			if n != s.size() {
+				t.Fatalf("ratio %d, %d bytes: inflated to %d, want %d", ratio, size, n, s.size())
+			}
+			if size >= 1000 {
+				if got := float64(n) / float64(size); got < 0.9*float64(ratio) || got > 1.1*float64(ratio) {
+					t.Errorf("ratio %d, %d bytes: expands %.1f times", ratio, size, got)
+				}
+			}
+		}
+	}
+	if _, err := planRatioStream(minRatioStream-1, 10); err == nil {
+		t.Error("planRatioStream() below the minimum succeeded")
+	}
+}
+
+func TestZipGenerator_Ratio(t *testing.T) {
+	testCases := []struct {
+		name   string
+		opts   ports.Options
+		size   int64
+		read   bool // inflate every entry
+		errSub string
+	}{
+		{name: "Default", opts: ports.Options{"zip-ratio": "1000"}, size: 20000, read: true},
+		{name: "Entries", opts: ports.Options{"zip-ratio": "100", "zip-entries": "3", "zip-entry-distribution": "random"}, size: 50001, read: true},
+		{name: "EICAR", opts: ports.Options{"zip-ratio": "50", "eicar": "true"}, size: 3000, read: true},
+		{name: "Nested", opts: ports.Options{"zip-ratio": "500", "zip-nest-depth": "1", "zip-nest-branching": "2"}, size: 10000},
+		{name: "Zip64", opts: ports.Options{"zip-ratio": "1000"}, size: 5 << 20},
+		{name: "NoRatio", opts: ports.Options{"zip-entries": "3"}, size: 20000, read: true},
+		{name: "TooHigh", opts: ports.Options{"zip-ratio": "2000"}, size: 20000, errSub: "between 1 and"},
+		{name: "Encrypted", opts: ports.Options{"zip-ratio": "10", "zip-encryption": "aes256", "zip-password": "pw"}, size: 20000, errSub: "encryption"},
+		{name: "TooSmall", opts: ports.Options{"zip-ratio": "10", "zip-entries": "10"}, size: 300, errSub: "too small"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := ports.Stats{}
+			generator := New().(*ZipGenerator).WithStats(stats).(ports.OptionsGenerator)
+			path := filepath.Join(t.TempDir(), "ratio.zip")
+			err := generator.GenerateWithOptions(path, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			if info, _ := os.Stat(path); info.Size() != tc.size {
+				t.Fatalf("size = %d, want %d", info.Size(), tc.size)
+			}
+			zr, err := zip.OpenReader(path)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer zr.Close()
+			var expanded int64
+			for _, f := range zr.File {
+				expanded += int64(f.UncompressedSize64)
+				if !tc.read {
+					continue
+				}
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Reading to the end checks the CRC and the length.
+				if _, err := io.Copy(io.Discard, rc); err != nil {
+					t.Fatalf("read %s: %v", f.Name, err)
+				}
+				rc.Close()
+			}
+			ratio, _ := tc.opts.Int("zip-ratio", 0)
+			if ratio == 0 {
+				if n, ok := stats["uncompressed_size"]; ok {
+					t.Errorf("stats report %d bytes uncompressed without zip-ratio", n)
+				}
+				return
+			}
+			if stats["uncompressed_size"] != expanded {
+				t.Errorf("stats report %d bytes uncompressed, entries hold %d", stats["uncompressed_size"], expanded)
+			}
+			if !tc.opts.Has("zip-nest-depth") && expanded < tc.size*int64(ratio)/2 {
+				t.Errorf("%d bytes expand to only %d at ratio %d", tc.size, expanded, ratio)
+			}
+		})
+	}
+}
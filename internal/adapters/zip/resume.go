@@ -0,0 +1,102 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// GenerateFrom writes the archive GenerateWithOptions would, for archives
+// of stored, unencrypted random entries. The entry data a run that
+// stopped at from wrote is kept, and read back for the entries' CRCs, and
+// the rest of the archive is written after it. The "mtime" option must
+// fix the entries' modification time, so that the headers written after
+// resuming agree with those written before.
+func (g *ZipGenerator) GenerateFrom(path string, size int64, opts ports.Options, from ports.ResumeState, checkpoint func(ports.ResumeState) error) error {
+	opts = g.opts.With(opts)
+	o, err := parseOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.encryption != EncryptionNone || o.compression != CompressionStore || len(o.entryTypes) > 0 || o.nestDepth > 0 || o.ratio > 0 || o.stress.enabled() ||
+		o.distribution == DistributionRandom && o.entries > 1 {
+		return fmt.Errorf("only archives of stored, unencrypted random entries of equal sizes can be resumed")
+	}
+	start := min(from.Offset, size)
+	if start > 0 && o.modified.IsZero() {
+		return fmt.Errorf("resuming an archive needs the mtime it was begun with")
+	}
+	o.comment = metadataComment(g.meta)
+	if int64(len(o.comment)) > maxCommentLen {
+		return fmt.Errorf("metadata needs %d bytes, more than a zip comment holds (%d)", len(o.comment), maxCommentLen)
+	}
+	entries, slack, wo, cleanup, err := planArchive(size, o)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var src *os.File
+	if start > 0 {
+		if src, err = os.Open(path); err != nil {
+			return err
+		}
+		defer src.Close()
+	}
+	f, err := outputfs.Resume(g.fs, path, start)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cw := outputfs.NewCheckpointer(f, start, checkpoint)
+	rw := &replayWriter{w: cw, skip: start}
+	for i, e := range entries {
+		entries[i].fill = replayedFill(o.rand.Split(), e.size, o.filler, o.threads, rw, src, cw)
+	}
+	cw.Phase = "headers"
+	if err := writeArchive(rw, entries, slack, wo); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// replayWriter passes on what is written to it from offset skip on, and
+// drops the bytes before, which the run being resumed wrote already.
+type replayWriter struct {
+	w    io.Writer
+	skip int64
+	pos  int64 // offset of the next byte written
+}
+
+func (r *replayWriter) Write(p []byte) (int, error) {
+	k := int(min(max(r.skip-r.pos, 0), int64(len(p))))
+	n, err := r.w.Write(p[k:])
+	r.pos += int64(k + n)
+	return k + n, err
+}
+
+// replayedFill returns the fill function of randomFill, drawing on r,
+// except that the bytes ahead of rw.skip are copied from src, where the
+// run being resumed wrote them, so that the entry's CRC covers what is on
+// disk. It relies on the archive writer being flushed ahead of each
+// entry's data.
+func replayedFill(r *utils.Rand, n int64, filler utils.Filler, threads int, rw *replayWriter, src io.ReaderAt, cw *outputfs.Checkpointer) func(io.Writer) error {
+	return func(w io.Writer) error {
+		cw.Phase = "data"
+		kept := min(n, max(rw.skip-rw.pos, 0))
+		if kept > 0 {
+			if _, err := io.Copy(w, io.NewSectionReader(src, rw.pos, kept)); err != nil {
+				return fmt.Errorf("failed to read back the data written: %w", err)
+			}
+		}
+		if err := randomFill(r, n-kept, filler, threads)(w); err != nil {
+			return err
+		}
+		cw.Phase = "headers"
+		return nil
+	}
+}
@@ -0,0 +1,312 @@
+package zip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// Orders accepted by the "zip-local-order" option: how the local headers
+// and data are laid out against the central directory, which lists the
+// entries in order.
+const (
+	OrderSame    = "same"
+	OrderReverse = "reverse"
+	OrderShuffle = "shuffle"
+)
+
+// Data descriptor forms accepted by the "zip-descriptor" option. Signed
+// descriptors are what archive/zip writes after every entry; the
+// signature is optional in the specification, and unsigned descriptors
+// leave it out.
+const (
+	DescriptorSigned   = "signed"
+	DescriptorUnsigned = "unsigned"
+)
+
+// Lengths of the records a stress archive is made of, which carry no
+// extra fields and no Zip64 extensions, so that it holds at most
+// maxStressEntries entries and maxStressSize bytes.
+const (
+	localHeaderLen   = 30
+	centralHeaderLen = 46
+	endRecordLen     = 22
+	descriptorLen    = 12 // CRC and sizes, after the optional signature
+	maxNameLen       = 0xFFFF
+	maxStressEntries = 0xFFFF
+	maxStressSize    = 0xFFFFFFFF
+)
+
+// Record signatures and general purpose flags of a stress archive.
+const (
+	localHeaderSig   = 0x04034b50
+	centralHeaderSig = 0x02014b50
+	endRecordSig     = 0x06054b50
+	descriptorSig    = 0x08074b50
+	flagDescriptor   = 0x8
+	flagUTF8         = 0x800
+)
+
+// unicodeStems start the entry names with "zip-unicode-names", in scripts
+// that cover two-, three- and four-byte UTF-8, right-to-left text and
+// combining marks.
+var unicodeStems = []string{"données", "данные", "数据", "ファイル", "ملف", "αρχείο", "데이터", "फ़ाइल", "Straße", "📦"}
+
+// stressOptions holds the settings that make an archive pathological but
+// valid, for exercising extraction libraries. Any of them has the archive
+// written by writeStressArchive rather than archive/zip.
+type stressOptions struct {
+	// nameLength pads every entry name to that many bytes.
+	nameLength int
+	// unicode gives the entries non-ASCII names, flagged as UTF-8.
+	unicode    bool
+	descriptor string
+	order      string
+}
+
+// enabled reports whether s asks for a stress archive.
+func (s stressOptions) enabled() bool {
+	return s.nameLength > 0 || s.unicode || s.descriptor != DescriptorSigned || s.order != OrderSame
+}
+
+// parseStress reads the stress options and checks them against the rest
+// of o, which must be parsed already.
+func parseStress(opts ports.Options, o zipOptions) (stressOptions, error) {
+	s := stressOptions{
+		descriptor: strings.ToLower(opts.String("zip-descriptor", DescriptorSigned)),
+		order:      strings.ToLower(opts.String("zip-local-order", OrderSame)),
+	}
+	var err error
+	if s.nameLength, err = opts.Int("zip-name-length", 0); err != nil {
+		return s, err
+	}
+	if s.nameLength < 0 || s.nameLength > maxNameLen {
+		return s, fmt.Errorf("zip-name-length must be between 0 and %d, got %d", maxNameLen, s.nameLength)
+	}
+	if s.unicode, err = opts.Bool("zip-unicode-names", false); err != nil {
+		return s, err
+	}
+	switch s.descriptor {
+	case DescriptorSigned, DescriptorUnsigned:
+	default:
+		return s, fmt.Errorf("unknown zip descriptor %q (want signed or unsigned)", s.descriptor)
+	}
+	switch s.order {
+	case OrderSame, OrderReverse, OrderShuffle:
+	default:
+		return s, fmt.Errorf("unknown zip local order %q (want same, reverse or shuffle)", s.order)
+	}
+	if !s.enabled() {
+		return s, nil
+	}
+
+	switch {
+	case o.encryption != EncryptionNone:
+		return s, fmt.Errorf("zip stress options cannot be combined with encryption")
+	case o.compression != CompressionStore:
+		return s, fmt.Errorf("zip stress options cannot be combined with zip-compression deflate")
+	case o.ratio > 0:
+		return s, fmt.Errorf("zip stress options cannot be combined with zip-ratio")
+	case o.nestDepth > 0:
+		return s, fmt.Errorf("zip stress options cannot be combined with zip-nest-depth")
+	case o.entries+len(o.fixed) > maxStressEntries:
+		return s, fmt.Errorf("zip stress archives hold at most %d entries, got %d", maxStressEntries, o.entries+len(o.fixed))
+	}
+	if s.nameLength > 0 {
+		o.stress = s
+		for _, name := range entryNames(o) {
+			if len(name) != s.nameLength {
+				return s, fmt.Errorf("zip-name-length %d is shorter than the entry name %q", s.nameLength, name)
+			}
+		}
+	}
+	return s, nil
+}
+
+// stressName returns the i-th entry's name with the stem and padding s
+// asks for. The padding goes ahead of the extension, in "é" for unicode
+// names and "x" otherwise; a name already longer is left as it is.
+func stressName(name string, i int, s stressOptions) string {
+	stem, ext, _ := strings.Cut(name, ".")
+	if s.unicode {
+		stem = unicodeStems[i%len(unicodeStems)] + "_" + stem
+	}
+	pad := s.nameLength - len(stem) - len(ext) - 1
+	if pad <= 0 {
+		return stem + "." + ext
+	}
+	fill := strings.Repeat("x", pad)
+	if s.unicode {
+		fill = strings.Repeat("é", pad/2) + strings.Repeat("x", pad%2)
+	}
+	return stem + fill + "." + ext
+}
+
+// stressOverhead returns the byte-length of the stress archive holding
+// the named entries with zero payload, as writeStressArchive writes it.
+func stressOverhead(names []string, o zipOptions) int64 {
+	n := int64(len(o.prefix)) + endRecordLen + int64(len(o.comment))
+	for _, e := range o.fixed {
+		n += entryRecordsLen(e.name, o.stress) + e.size
+	}
+	for _, name := range names {
+		n += entryRecordsLen(name, o.stress)
+	}
+	return n
+}
+
+// entryRecordsLen returns the bytes an entry named name takes besides its
+// data: its local header, data descriptor and central directory header.
+func entryRecordsLen(name string, s stressOptions) int64 {
+	n := int64(localHeaderLen + centralHeaderLen + descriptorLen + 2*len(name))
+	if s.descriptor == DescriptorSigned {
+		n += 4
+	}
+	return n
+}
+
+// centralRecord is what the central directory records of an entry once
+// its data is written.
+type centralRecord struct {
+	name   string
+	flags  uint16
+	crc    uint32
+	size   uint32
+	offset uint32
+}
+
+// writeStressArchive writes the archive writeArchive would, with stored
+// entries each followed by a data descriptor, as o.stress lays them out:
+// local headers in the order it asks for, while the central directory
+// lists the entries in order, and descriptors with or without their
+// signature. Names that are not ASCII are flagged as UTF-8.
+func writeStressArchive(w io.Writer, entries []entry, commentLen int64, o zipOptions) error {
+	all := append(slices.Clip(o.fixed), entries...)
+	cw := &countWriter{w: w}
+	if _, err := io.WriteString(cw, o.prefix); err != nil {
+		return fmt.Errorf("failed to write zip prefix: %w", err)
+	}
+	date, tm := msDosTime(o.modTime())
+	dir := make([]centralRecord, len(all))
+	for _, i := range localOrder(o.rand, len(all), o.stress.order) {
+		e := all[i]
+		r := centralRecord{name: e.name, flags: flagDescriptor, offset: uint32(cw.n)}
+		if !isASCII(e.name) {
+			r.flags |= flagUTF8
+		}
+		b := binary.LittleEndian.AppendUint32(nil, localHeaderSig)
+		b = appendUint16s(b, 20, r.flags, 0, tm, date)
+		b = appendUint32s(b, 0, 0, 0) // CRC and sizes follow the data
+		b = appendUint16s(b, uint16(len(e.name)), 0)
+		b = append(b, e.name...)
+		if _, err := cw.Write(b); err != nil {
+			return fmt.Errorf("failed to write zip header: %w", err)
+		}
+
+		crc := crc32.NewIEEE()
+		dw := &countWriter{w: io.MultiWriter(cw, crc)}
+		if e.size > 0 {
+			if err := e.fill(dw); err != nil {
+				return fmt.Errorf("failed to write zip data: %w", err)
+			}
+		}
+		r.crc, r.size = crc.Sum32(), uint32(dw.n)
+
+		b = b[:0]
+		if o.stress.descriptor == DescriptorSigned {
+			b = binary.LittleEndian.AppendUint32(b, descriptorSig)
+		}
+		b = appendUint32s(b, r.crc, r.size, r.size)
+		if _, err := cw.Write(b); err != nil {
+			return fmt.Errorf("failed to write zip data descriptor: %w", err)
+		}
+		dir[i] = r
+	}
+
+	start := cw.n
+	for _, r := range dir {
+		b := binary.LittleEndian.AppendUint32(nil, centralHeaderSig)
+		b = appendUint16s(b, 20, 20, r.flags, 0, tm, date)
+		b = appendUint32s(b, r.crc, r.size, r.size)
+		b = appendUint16s(b, uint16(len(r.name)), 0, 0, 0, 0)
+		b = appendUint32s(b, 0, r.offset)
+		b = append(b, r.name...)
+		if _, err := cw.Write(b); err != nil {
+			return fmt.Errorf("failed to write zip central directory: %w", err)
+		}
+	}
+	comment := o.comment + strings.Repeat(" ", int(commentLen))
+	b := binary.LittleEndian.AppendUint32(nil, endRecordSig)
+	b = appendUint16s(b, 0, 0, uint16(len(dir)), uint16(len(dir)))
+	b = appendUint32s(b, uint32(cw.n-start), uint32(start))
+	b = appendUint16s(b, uint16(len(comment)))
+	b = append(b, comment...)
+	if _, err := cw.Write(b); err != nil {
+		return fmt.Errorf("failed to write zip end of central directory: %w", err)
+	}
+	return nil
+}
+
+// localOrder returns the order in which n entries' local headers are
+// written, shuffled by r if order asks for that.
+func localOrder(r *utils.Rand, n int, order string) []int {
+	switch order {
+	case OrderShuffle:
+		return r.Perm(n)
+	case OrderReverse:
+		idx := make([]int, n)
+		for i := range idx {
+			idx[i] = n - 1 - i
+		}
+		return idx
+	}
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+// countWriter counts the bytes written through it, as the offset of the
+// next.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func appendUint16s(b []byte, vs ...uint16) []byte {
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint16(b, v)
+	}
+	return b
+}
+
+func appendUint32s(b []byte, vs ...uint32) []byte {
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// isASCII reports whether s is all ASCII, which needs no UTF-8 flag.
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package zip
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestZipGenerator_Stress(t *testing.T) {
+	generator := New().(*ZipGenerator)
+
+	testCases := []struct {
+		name    string
+		opts    ports.Options
+		size    int64
+		entries int
+		errSub  string
+	}{
+		{name: "TinyEntries", opts: ports.Options{"zip-entries": "3000", "zip-local-order": "shuffle"}, size: 400000, entries: 3000},
+		{name: "LongNames", opts: ports.Options{"zip-entries": "3", "zip-name-length": "60000"}, size: 400000, entries: 3},
+		{name: "UnicodeNames", opts: ports.Options{"zip-entries": "12", "zip-unicode-names": "true", "zip-name-length": "101"}, size: 20000, entries: 12},
+		{name: "Unsigned", opts: ports.Options{"zip-entries": "4", "zip-descriptor": "unsigned", "zip-local-order": "reverse"}, size: 10001, entries: 4},
+		{name: "Extras", opts: ports.Options{"zip-entries": "2", "zip-entry-type": "csv", "zip-unicode-names": "true", "zip-sfx": "true", "eicar": "true"}, size: 30000, entries: 3},
+		{name: "ShortLength", opts: ports.Options{"zip-entries": "2", "zip-name-length": "8"}, size: 10000, errSub: "shorter than the entry name"},
+		{name: "Encrypted", opts: ports.Options{"zip-local-order": "reverse", "zip-encryption": "aes256", "zip-password": "pw"}, size: 10000, errSub: "cannot be combined with encryption"},
+		{name: "TooMany", opts: ports.Options{"zip-entries": "70000", "zip-descriptor": "unsigned"}, size: 1 << 30, errSub: "at most 65535 entries"},
+		{name: "UnknownOrder", opts: ports.Options{"zip-local-order": "sideways"}, size: 10000, errSub: "unknown zip local order"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outPath := filepath.Join(t.TempDir(), "stress.zip")
+			err := generator.GenerateWithOptions(outPath, tc.size, tc.opts)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("GenerateWithOptions() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateWithOptions() unexpected error = %v", err)
+			}
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tc.size {
+				t.Fatalf("size = %d, want %d", len(data), tc.size)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("open archive: %v", err)
+			}
+			if len(zr.File) != tc.entries {
+				t.Fatalf("archive holds %d entries, want %d", len(zr.File), tc.entries)
+			}
+
+			length, _ := tc.opts.Int("zip-name-length", 0)
+			unicode := tc.opts["zip-unicode-names"] == "true"
+			var offsets []int64
+			for _, f := range zr.File {
+				// Reading the entry checks its CRC against the descriptor.
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("open %.40q: %v", f.Name, err)
+				}
+				n, err := io.Copy(io.Discard, rc)
+				rc.Close()
+				if err != nil || uint64(n) != f.UncompressedSize64 {
+					t.Fatalf("read %.40q: %d bytes, %v", f.Name, n, err)
+				}
+				if f.Flags&flagDescriptor == 0 {
+					t.Errorf("%.40q has no data descriptor", f.Name)
+				}
+				if length > 0 && len(f.Name) != length {
+					t.Errorf("name is %d bytes, want %d", len(f.Name), length)
+				}
+				if unicode && f.Name != eicarEntryName && (isASCII(f.Name) || f.NonUTF8 || f.Flags&flagUTF8 == 0 || !utf8.ValidString(f.Name)) {
+					t.Errorf("%.40q is not a UTF-8 flagged name", f.Name)
+				}
+				off, _ := f.DataOffset()
+				offsets = append(offsets, off)
+				end := off + int64(f.CompressedSize64)
+				signed := binary.LittleEndian.Uint32(data[end:]) == descriptorSig
+				if want := tc.opts["zip-descriptor"] != "unsigned"; signed != want {
+					t.Errorf("%.40q descriptor signed = %v, want %v", f.Name, signed, want)
+				}
+			}
+			switch tc.opts["zip-local-order"] {
+			case "reverse":
+				if !slices.IsSortedFunc(offsets, func(a, b int64) int { return int(b - a) }) {
+					t.Errorf("local headers not in reverse order: %v", offsets)
+				}
+			case "shuffle":
+				if slices.IsSorted(offsets) {
+					t.Errorf("local headers in central directory order")
+				}
+			default:
+				if !slices.IsSorted(offsets) {
+					t.Errorf("local headers out of order: %v", offsets)
+				}
+			}
+		})
+	}
+}
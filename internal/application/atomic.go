@@ -0,0 +1,109 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// output is where Create has a file generated: a temporary directory next
+// to its path, from which it is renamed over the path once it is complete,
+// so that readers never see a partial file and a failure leaves nothing
+// behind. The file keeps its name within the directory, so companions
+// that refer to each other by name, such as a video's thumbnail track,
+// refer to the names they end up with. Files written in place, or over
+// something other than a regular file, such as a device or a symbolic
+// link, go straight to the path instead; a failure then removes what the
+// generator wrote, unless the file was there before and left untouched.
+type output struct {
+	fs    fileRenames // where the file is moved into place
+	final string      // the path asked for
+	path  string      // the path generators write to
+	dir   string      // the temporary directory path is in; empty if in place
+	// before is the file at final before generation, for files written in
+	// place; nil if there was none.
+	before os.FileInfo
+}
+
+// newOutput prepares the writing of the file at path on fsys.
+func newOutput(fsys fileRenames, path string, inPlace bool) (*output, error) {
+	o := &output{fs: fsys, final: path, path: path}
+	info, err := fsys.Lstat(path)
+	if err == nil {
+		o.before = info
+	}
+	if inPlace || (err == nil && !info.Mode().IsRegular()) {
+		return o, nil
+	}
+
+	dir, err := fsys.MkdirTempIn(filepath.Dir(path), ".genfile-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a temporary directory for %s: %w", path, err)
+	}
+	// MkdirTemp keeps a leading "./", which Join cleans away; dir is
+	// cleaned too so that finalPath recognises the paths in it.
+	dir = filepath.Clean(dir)
+	o.dir, o.path, o.before = dir, filepath.Join(dir, filepath.Base(path)), nil
+	return o, nil
+}
+
+// temporary reports whether the file is written to a temporary path.
+func (o *output) temporary() bool {
+	return o.dir != ""
+}
+
+// finalPath returns the path that the file a generator wrote at p, the
+// output's path or a companion next to it, ends up at.
+func (o *output) finalPath(p string) string {
+	if !o.temporary() || filepath.Dir(filepath.Clean(p)) != o.dir {
+		return p
+	}
+	return filepath.Join(filepath.Dir(o.final), filepath.Base(p))
+}
+
+// commit moves the generated file and its companions, at paths, to their
+// final paths. Paths the generator did not write are passed over; the
+// file itself, if written, must end up at its final path, or removing the
+// temporary directory would take it along.
+func (o *output) commit(paths []string) error {
+	if !o.temporary() {
+		return nil
+	}
+	defer o.fs.RemoveAll(o.dir)
+	written := false
+	for _, p := range paths {
+		if _, err := o.fs.Lstat(p); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		written = written || p == o.path
+		if err := o.fs.Rename(p, o.finalPath(p)); err != nil {
+			return fmt.Errorf("failed to move %s into place: %w", o.finalPath(p), err)
+		}
+	}
+	if _, err := o.fs.Lstat(o.final); written && err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", o.final, err)
+	}
+	return nil
+}
+
+// discard removes a failed file: the temporary directory with the file
+// and its companions, or the file written in place along with the
+// companions in paths.
+func (o *output) discard(paths []string) {
+	if o.temporary() {
+		o.fs.RemoveAll(o.dir)
+		return
+	}
+	info, err := o.fs.Lstat(o.path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	if o.before != nil && info.ModTime().Equal(o.before.ModTime()) && info.Size() == o.before.Size() {
+		return // not written to
+	}
+	for _, p := range append([]string{o.path}, paths...) {
+		o.fs.Remove(p)
+	}
+}
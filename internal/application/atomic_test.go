@@ -0,0 +1,124 @@
+package application
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestFileService_CreateAtomic(t *testing.T) {
+	writeFile := func(outPath string, sizeBytes int64) error {
+		return os.WriteFile(outPath, make([]byte, sizeBytes), 0o644)
+	}
+	// failing writes half the file before failing.
+	failing := &MockFileGenerator{GenerateFunc: func(path string, size int64) error {
+		os.WriteFile(path, make([]byte, size/2), 0o644)
+		return errors.New("disk on fire")
+	}}
+	writing := &MockFileGenerator{GenerateFunc: writeFile}
+	// fixed writes 10 KB whatever it is asked for.
+	fixed := &MockFileGenerator{GenerateFunc: func(path string, _ int64) error { return writeFile(path, 10*1024) }}
+
+	tests := []struct {
+		name     string
+		gen      ports.FileGenerator
+		req      FileRequest
+		existing bool // a file is at the path beforehand
+		wantErr  bool
+		want     []string // the files left in the directory
+	}{
+		{name: "Success", gen: writing, req: FileRequest{SizeSpec: "10KB"}, want: []string{"a.txt"}},
+		{name: "Replaces", gen: writing, req: FileRequest{SizeSpec: "10KB"}, existing: true, want: []string{"a.txt"}},
+		{name: "Companions", gen: &MockSetGenerator{}, req: FileRequest{SizeSpec: "10KB"}, want: []string{"a.idx", "a.txt"}},
+		{name: "Failure", gen: failing, req: FileRequest{SizeSpec: "10KB"}, wantErr: true},
+		{name: "Failure keeps the old file", gen: failing, req: FileRequest{SizeSpec: "10KB"}, existing: true, wantErr: true, want: []string{"a.txt"}},
+		{name: "Wrong size", gen: fixed, req: FileRequest{SizeSpec: "1KB", Strict: true}, wantErr: true},
+		{name: "In place", gen: writing, req: FileRequest{SizeSpec: "10KB", InPlace: true}, want: []string{"a.txt"}},
+		{name: "In place failure", gen: failing, req: FileRequest{SizeSpec: "10KB", InPlace: true}, wantErr: true},
+		{name: "In place failure overwriting", gen: failing, req: FileRequest{SizeSpec: "10KB", InPlace: true}, existing: true, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+			dir := t.TempDir()
+			tc.req.Path = filepath.Join(dir, "a.txt")
+			if tc.existing {
+				if err := os.WriteFile(tc.req.Path, []byte("old"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := service.Create(tc.req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Create() error = %v, want error %v", err, tc.wantErr)
+			}
+			entries, _ := os.ReadDir(dir)
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if strings.Join(names, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("directory holds %v, want %v", names, tc.want)
+			}
+			if tc.existing && tc.wantErr && len(tc.want) > 0 {
+				if data, _ := os.ReadFile(tc.req.Path); string(data) != "old" {
+					t.Errorf("old file holds %q", data)
+				}
+			}
+		})
+	}
+}
+
+func TestFileService_CreateThroughSymlink(t *testing.T) {
+	// A symbolic link is written through rather than replaced.
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	link := filepath.Join(dir, "link.txt")
+	if err := os.WriteFile(target, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("cannot create symbolic links: %v", err)
+	}
+	gen := &MockFileGenerator{GenerateFunc: func(path string, size int64) error {
+		return os.WriteFile(path, make([]byte, size), 0o644)
+	}}
+	service := NewFileService(&MockGeneratorFactory{MockGenerator: gen}, &MockSizeParser{})
+	if _, err := service.Create(FileRequest{Path: link, SizeSpec: "10KB"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("link replaced: %v, %v", info, err)
+	}
+	if info, err := os.Stat(target); err != nil || info.Size() != 10*1024 {
+		t.Errorf("target not written: %v, %v", info, err)
+	}
+}
+
+func TestFileService_CreateInWorkingDirectory(t *testing.T) {
+	// MkdirTemp names the temporary directory "./.genfile-N", which the
+	// generated path drops the "./" of; the file must still be moved out
+	// of it rather than removed with it.
+	t.Chdir(t.TempDir())
+	gen := &MockFileGenerator{GenerateFunc: func(path string, size int64) error {
+		return os.WriteFile(path, make([]byte, size), 0o644)
+	}}
+	service := NewFileService(&MockGeneratorFactory{MockGenerator: gen}, &MockSizeParser{})
+	for _, path := range []string{"n.txt", "./m.txt"} {
+		if _, err := service.Create(FileRequest{Path: path, SizeSpec: "10KB"}); err != nil {
+			t.Fatalf("Create(%q) error = %v", path, err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() != 10*1024 {
+			t.Errorf("%s after Create: %v, %v", path, info, err)
+		}
+	}
+	entries, _ := os.ReadDir(".")
+	if len(entries) != 2 {
+		t.Errorf("working directory holds %d entries, want the 2 files", len(entries))
+	}
+}
@@ -0,0 +1,193 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// BatchResult reports what CreateBatch produced.
+type BatchResult struct {
+	Files     []FileResult // one per file created, in order
+	TotalSize int64        // sum of the files' actual sizes, companions included
+	// Skipped are the files a path profile named in ways this system
+	// cannot create.
+	Skipped []SkippedPath
+}
+
+// SkippedPath is a file of a batch left out because of its path.
+type SkippedPath struct {
+	Path   string
+	Reason string
+}
+
+// hostOS is the operating system whose path rules CheckPath applies to a
+// batch.
+var hostOS = runtime.GOOS
+
+// maxNameAttempts bounds how often a name with random parts is redrawn when
+// it repeats an earlier one.
+const maxNameAttempts = 100
+
+// CreateBatch creates count files in dir, created if missing, each as described by req with its
+// Path replaced by a name from name. It stops at the first failure and
+// returns the files created until then. When name has a path profile,
+// files whose paths the system cannot create are skipped instead, and
+// listed in the result. With the "shared-blocks" option the files draw
+// that share of their filler from one pool of chunks, which a
+// "shared-pool" seed fixes across batches.
+func (s *FileService) CreateBatch(req FileRequest, dir string, count int, name NameTemplate) (BatchResult, error) {
+	return s.createBatch(req, dir, count, name, nil)
+}
+
+// CreateBudgetBatch is CreateBatch with the files sized by PlanBudget so
+// that together they come to budget.Total. With a mix of types each file
+// gets its type, and name needs {ext} to tell them apart. A "seed" option
+// draws the same sizes again.
+func (s *FileService) CreateBudgetBatch(req FileRequest, dir string, count int, name NameTemplate, budget Budget) (BatchResult, error) {
+	if req.SizeSpec != "" || req.Lines > 0 || req.sizedByExtent() {
+		return BatchResult{}, fmt.Errorf("a budget sets each file's size; it cannot be combined with a size, a line count, a duration, a count or a resolution")
+	}
+	total, err := s.parser.Parse(budget.Total)
+	if err != nil {
+		return BatchResult{}, fmt.Errorf("invalid total size '%s': %w", budget.Total, err)
+	}
+	r, err := utils.NewRand(req.Options.String("seed", ""))
+	if err != nil {
+		return BatchResult{}, err
+	}
+	plan, err := PlanBudget(total, count, budget.Mix, budget.Distribution, r.Rand)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	if len(budget.Mix) > 1 && !name.HasExt() {
+		return BatchResult{}, fmt.Errorf("name template needs {ext} to mix %d file types", len(budget.Mix))
+	}
+	return s.createBatch(req, dir, count, name, func(seq int, fileReq *FileRequest) {
+		f := plan[seq-1]
+		if f.Type != "" {
+			fileReq.Type = f.Type
+		}
+		fileReq.SizeSpec = strconv.FormatInt(f.Size, 10)
+	})
+}
+
+// createBatch creates the files of a batch, letting adjust change each
+// file's request before it is named and created.
+func (s *FileService) createBatch(req FileRequest, dir string, count int, name NameTemplate, adjust func(seq int, fileReq *FileRequest)) (BatchResult, error) {
+	var batch BatchResult
+	if count < 1 {
+		return batch, fmt.Errorf("count must be at least 1, got %d", count)
+	}
+	if count > 1 && !name.Unique() {
+		return batch, fmt.Errorf("name template needs {seq} or {rand} to create %d files", count)
+	}
+
+	req, err := resolveMIME(req)
+	if err != nil {
+		return batch, err
+	}
+	// The files draw their shared filler chunks from one pool, so that
+	// they have them in common.
+	// A seeded batch gives its files the seeds counting up from it, so
+	// that they differ from each other but come out the same again, and
+	// makes its pool and the {rand} parts of its names from it too.
+	seed, seeded := int64(0), req.Options.String("seed", "") != ""
+	if seeded {
+		if seed, err = strconv.ParseInt(strings.TrimSpace(req.Options.String("seed", "")), 10, 64); err != nil {
+			return batch, fmt.Errorf("seed must be a whole number, got %q", req.Options.String("seed", ""))
+		}
+		name = name.withRand(utils.SeededRand(seed))
+	}
+	shared, _ := strconv.ParseFloat(req.Options.String("shared-blocks", ""), 64)
+	if shared > 0 && !req.Options.Has("shared-pool") {
+		pool := rand.Uint64()
+		if seeded {
+			pool = uint64(seed)
+		}
+		req.Options = req.Options.With(ports.Options{"shared-pool": strconv.FormatUint(pool, 10)})
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return batch, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	used := make(map[string]bool, count)
+	for seq := 1; seq <= count; seq++ {
+		fileReq := req
+		if seeded {
+			fileReq.Options = req.Options.With(ports.Options{"seed": strconv.FormatInt(seed+int64(seq-1), 10)})
+		}
+		if adjust != nil {
+			adjust(seq, &fileReq)
+		}
+		if name.HasExt() && fileReq.Type == "" {
+			return batch, fmt.Errorf("name template uses {ext} but no file type is set")
+		}
+		fileName := name.ExpandType(seq, fileReq.Type)
+		for attempt := 1; used[fileName]; attempt++ {
+			if attempt == maxNameAttempts {
+				return batch, fmt.Errorf("name template keeps repeating %q; use {seq} or a wider {rand}", fileName)
+			}
+			fileName = name.ExpandType(seq, fileReq.Type)
+		}
+		used[fileName] = true
+
+		fileReq.Path = filepath.Join(dir, filepath.FromSlash(fileName))
+		if name.profile != "" {
+			if err := CheckPath(fileName, hostOS); err != nil {
+				batch.Skipped = append(batch.Skipped, SkippedPath{Path: fileReq.Path, Reason: err.Error()})
+				continue
+			}
+		}
+		if sub := filepath.Dir(fileReq.Path); sub != filepath.Clean(dir) {
+			if err := os.MkdirAll(sub, 0o755); err != nil {
+				if skip(&batch, name, fileReq.Path, err) {
+					continue
+				}
+				return batch, fmt.Errorf("failed to create directory %s: %w", sub, err)
+			}
+		}
+		result, err := s.Create(fileReq)
+		if err != nil {
+			if skip(&batch, name, fileReq.Path, err) {
+				continue
+			}
+			return batch, err
+		}
+		batch.Files = append(batch.Files, result)
+		for _, f := range append([]FileResult{result}, result.Companions...) {
+			if f.Size > 0 {
+				batch.TotalSize += f.Size
+			}
+		}
+	}
+	return batch, nil
+}
+
+// skip records the file at path as skipped if name has a path profile and
+// err is the file system refusing to create it or its directory, as it
+// may refuse names that CheckPath passes. Missing permissions and the
+// like still fail the batch.
+func skip(batch *BatchResult, name NameTemplate, path string, err error) bool {
+	var pathErr *fs.PathError
+	if name.profile == "" || !errors.As(err, &pathErr) || (pathErr.Op != "open" && pathErr.Op != "mkdir") {
+		return false
+	}
+	if pathErr.Path != path && !strings.HasPrefix(path, pathErr.Path+string(filepath.Separator)) {
+		return false
+	}
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrExist) || errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	batch.Skipped = append(batch.Skipped, SkippedPath{Path: path, Reason: pathErr.Err.Error()})
+	return true
+}
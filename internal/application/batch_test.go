@@ -0,0 +1,399 @@
+package application
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestNameTemplate(t *testing.T) {
+	now := time.Date(2024, 3, 9, 14, 5, 7, 0, time.UTC)
+	tests := []struct {
+		pattern     string
+		seq         int
+		want        string // regular expression the name must match
+		wantErrText string
+	}{
+		{pattern: "invoice_{seq:04}.pdf", seq: 7, want: `^invoice_0007\.pdf$`},
+		{pattern: "{seq}.txt", seq: 12, want: `^12\.txt$`},
+		{pattern: "doc_{rand:6}.docx", seq: 1, want: `^doc_[a-z0-9]{6}\.docx$`},
+		{pattern: "{rand}.bin", seq: 1, want: `^[a-z0-9]{8}\.bin$`},
+		{pattern: "log_{date}_{time}_{unix}.log", seq: 1, want: `^log_2024-03-09_140507_1709993107\.log$`},
+		{pattern: "plain.csv", seq: 3, want: `^plain\.csv$`},
+		{pattern: "a_{seq:0}.txt", wantErrText: "invalid width"},
+		{pattern: "a_{date:4}.txt", wantErrText: "takes no width"},
+		{pattern: "a_{id}.txt", wantErrText: "unknown placeholder {id}"},
+		{pattern: "a_{seq.txt", wantErrText: "unclosed placeholder"},
+		{pattern: "", wantErrText: "empty"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.pattern, func(t *testing.T) {
+			tmpl, err := ParseNameTemplate(tc.pattern)
+			if tc.wantErrText != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrText) {
+					t.Errorf("ParseNameTemplate(%q) error = %v, want %q", tc.pattern, err, tc.wantErrText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNameTemplate(%q) unexpected error = %v", tc.pattern, err)
+			}
+			tmpl.now = func() time.Time { return now }
+			if got := tmpl.Expand(tc.seq); !regexp.MustCompile(tc.want).MatchString(got) {
+				t.Errorf("Expand(%d) = %q, want match for %s", tc.seq, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFileService_CreateBatch(t *testing.T) {
+	dir := t.TempDir()
+	gen := &MockFileGenerator{GenerateFunc: func(outPath string, sizeBytes int64) error {
+		return os.WriteFile(outPath, make([]byte, sizeBytes), 0o644)
+	}}
+	service := NewFileService(&MockGeneratorFactory{MockGenerator: gen}, &MockSizeParser{})
+	req := FileRequest{SizeSpec: "10KB"}
+
+	t.Run("Sequence", func(t *testing.T) {
+		name, _ := ParseNameTemplate("invoice_{seq:03}.txt")
+		batch, err := service.CreateBatch(req, dir, 3, name)
+		if err != nil {
+			t.Fatalf("CreateBatch() unexpected error = %v", err)
+		}
+		if len(batch.Files) != 3 || batch.TotalSize != 3*10*1024 {
+			t.Errorf("CreateBatch() = %d files, %d bytes", len(batch.Files), batch.TotalSize)
+		}
+		for _, f := range []string{"invoice_001.txt", "invoice_002.txt", "invoice_003.txt"} {
+			if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+				t.Errorf("expected %s: %v", f, err)
+			}
+		}
+	})
+
+	t.Run("Random names stay distinct", func(t *testing.T) {
+		name, _ := ParseNameTemplate("r_{rand:2}.txt")
+		batch, err := service.CreateBatch(req, filepath.Join(dir, "new", "dir"), 50, name)
+		if err != nil {
+			t.Fatalf("CreateBatch() unexpected error = %v", err)
+		}
+		seen := map[string]bool{}
+		for _, f := range batch.Files {
+			if seen[f.Path] {
+				t.Errorf("name %s used twice", f.Path)
+			}
+			seen[f.Path] = true
+		}
+	})
+
+	t.Run("Fixed name rejected for several files", func(t *testing.T) {
+		name, _ := ParseNameTemplate("same.txt")
+		if _, err := service.CreateBatch(req, dir, 2, name); err == nil || !strings.Contains(err.Error(), "needs {seq} or {rand}") {
+			t.Errorf("CreateBatch() error = %v, want a uniqueness error", err)
+		}
+	})
+
+	t.Run("Stops at the first failure", func(t *testing.T) {
+		name, _ := ParseNameTemplate("f_{seq}.unknown")
+		batch, err := service.CreateBatch(req, dir, 3, name)
+		if err == nil || len(batch.Files) != 0 {
+			t.Errorf("CreateBatch() = %d files, error %v; want an error and no files", len(batch.Files), err)
+		}
+	})
+
+	t.Run("Shared pool", func(t *testing.T) {
+		gen := &MockConfigurableGenerator{}
+		var pools []string
+		gen.GenerateFunc = func(string, int64) error {
+			pools = append(pools, gen.Configured["shared-pool"])
+			return nil
+		}
+		factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return gen, nil }}
+		service := NewFileService(factory, &MockSizeParser{})
+		name, _ := ParseNameTemplate("s_{seq}.bin")
+		shared := FileRequest{SizeSpec: "10KB", Options: ports.Options{"shared-blocks": "0.5"}}
+		if _, err := service.CreateBatch(shared, dir, 3, name); err != nil {
+			t.Fatalf("CreateBatch() unexpected error = %v", err)
+		}
+		if len(pools) != 3 || pools[0] == "" || pools[1] != pools[0] || pools[2] != pools[0] {
+			t.Errorf("files drew on pools %q, want one", pools)
+		}
+		pools = nil
+		shared.Options = shared.Options.With(ports.Options{"shared-pool": "7"})
+		if _, err := service.CreateBatch(shared, dir, 2, name); err != nil {
+			t.Fatalf("CreateBatch() unexpected error = %v", err)
+		}
+		if len(pools) != 2 || pools[0] != "7" || pools[1] != "7" {
+			t.Errorf("files drew on pools %q, want the given 7", pools)
+		}
+	})
+
+	t.Run("Seeds", func(t *testing.T) {
+		gen := &MockConfigurableGenerator{}
+		var seeds, pools []string
+		gen.GenerateFunc = func(string, int64) error {
+			seeds = append(seeds, gen.Configured["seed"])
+			pools = append(pools, gen.Configured["shared-pool"])
+			return nil
+		}
+		factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return gen, nil }}
+		service := NewFileService(factory, &MockSizeParser{})
+		name, _ := ParseNameTemplate("k_{seq}.bin")
+		seeded := FileRequest{SizeSpec: "10KB", Options: ports.Options{"seed": "41", "shared-blocks": "0.5"}}
+		if _, err := service.CreateBatch(seeded, dir, 3, name); err != nil {
+			t.Fatalf("CreateBatch() unexpected error = %v", err)
+		}
+		if !slices.Equal(seeds, []string{"41", "42", "43"}) {
+			t.Errorf("files were seeded %q, want 41, 42 and 43", seeds)
+		}
+		if !slices.Equal(pools, []string{"41", "41", "41"}) {
+			t.Errorf("files drew on pools %q, want the seed's", pools)
+		}
+		if seeded.Options["seed"] != "41" {
+			t.Errorf("request options were modified: %v", seeded.Options)
+		}
+		seeded.Options = ports.Options{"seed": "many"}
+		if _, err := service.CreateBatch(seeded, dir, 2, name); err == nil || !strings.Contains(err.Error(), "seed must be a whole number") {
+			t.Errorf("CreateBatch() error = %v, want a seed error", err)
+		}
+	})
+
+	t.Run("Path profile", func(t *testing.T) {
+		name, _ := ParseNameTemplate("p_{seq}.txt")
+		profile, _ := ParsePathProfile("long")
+		batch, err := service.CreateBatch(req, filepath.Join(dir, "long"), 3, name.WithProfile(profile))
+		if err != nil {
+			t.Fatalf("CreateBatch() unexpected error = %v", err)
+		}
+		// The 255-character name of accented letters is too long in bytes
+		// for Linux, not in code units for Windows and macOS.
+		if hostOS != "windows" && hostOS != "darwin" {
+			if len(batch.Files) != 2 || len(batch.Skipped) != 1 || !strings.Contains(batch.Skipped[0].Reason, "bytes long") {
+				t.Errorf("CreateBatch() = %d files, skipped %v", len(batch.Files), batch.Skipped)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "long", "level-01", "level-02")); err != nil {
+			t.Errorf("nested directories not created: %v", err)
+		}
+	})
+
+	t.Run("Path profile on Windows", func(t *testing.T) {
+		defer func(goos string) { hostOS = goos }(hostOS)
+		hostOS = "windows"
+		name, _ := ParseNameTemplate("w_{seq}.txt")
+		batch, err := service.CreateBatch(req, filepath.Join(dir, "reserved"), 9, name.WithProfile(PathReserved))
+		if err != nil {
+			t.Fatalf("CreateBatch() unexpected error = %v", err)
+		}
+		// Only the leading dash and the shell syntax are left.
+		if len(batch.Files) != 2 || len(batch.Skipped) != 7 {
+			t.Errorf("CreateBatch() = %d files and %d skipped, want 2 and 7", len(batch.Files), len(batch.Skipped))
+		}
+	})
+}
+
+func TestPathProfile(t *testing.T) {
+	if _, err := ParsePathProfile("emoji"); err == nil || !strings.Contains(err.Error(), "unknown path profile") {
+		t.Errorf("ParsePathProfile(emoji) error = %v", err)
+	}
+	for _, p := range []PathProfile{PathUnicode, PathLong, PathSpaces, PathReserved} {
+		seen := map[string]bool{}
+		for seq := 1; seq <= 2*len(variants[p]); seq++ {
+			name := p.Apply(seq, "sub/f_"+strconv.Itoa(seq)+".pdf")
+			if !strings.HasPrefix(name, "sub/") || !strings.HasSuffix(name, ".pdf") || seen[name] {
+				t.Errorf("%s.Apply(%d) = %q, want a distinct name in sub/ ending in .pdf", p, seq, name)
+			}
+			seen[name] = true
+		}
+	}
+
+	tests := []struct {
+		path, goos string
+		errSub     string
+	}{
+		{path: strings.Repeat("x", 255), goos: "linux"},
+		{path: strings.Repeat("x", 256), goos: "linux", errSub: "256 bytes long"},
+		{path: strings.Repeat("é", 200), goos: "linux", errSub: "400 bytes long"},
+		{path: strings.Repeat("é", 200), goos: "darwin"},
+		{path: "a/" + strings.Repeat("x", 300) + "/b", goos: "windows", errSub: "directory"},
+		{path: "CON.f.txt", goos: "linux"},
+		{path: "CON.f.txt", goos: "windows", errSub: "device CON"},
+		{path: "com1 .txt", goos: "windows", errSub: "device COM1"},
+		{path: "CONSOLE.txt", goos: "windows"},
+		{path: "a:b.txt", goos: "windows", errSub: "':'"},
+		{path: "dot./f.txt", goos: "windows", errSub: "ends in a space or a dot"},
+		{path: "dot./f.txt", goos: "darwin"},
+	}
+	for _, tc := range tests {
+		err := CheckPath(tc.path, tc.goos)
+		if tc.errSub == "" && err != nil || tc.errSub != "" && (err == nil || !strings.Contains(err.Error(), tc.errSub)) {
+			t.Errorf("CheckPath(%.20q, %s) = %v, want %q", tc.path, tc.goos, err, tc.errSub)
+		}
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	testCases := []struct {
+		spec   string
+		want   []TypeShare
+		errSub string
+	}{
+		{spec: "pdf:60,png:40", want: []TypeShare{{"pdf", 60}, {"png", 40}}},
+		{spec: " .TXT:1.5 , csv:50% ", want: []TypeShare{{"txt", 1.5}, {"csv", 50}}},
+		{spec: "pdf", errSub: "type:weight"},
+		{spec: "pdf:0", errSub: "positive"},
+		{spec: "pdf:many", errSub: "positive"},
+		{spec: "nope:10", errSub: "nope"},
+		{spec: "pdf:1,pdf:2", errSub: "twice"},
+	}
+	for _, tc := range testCases {
+		got, err := ParseMix(tc.spec)
+		if tc.errSub != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+				t.Errorf("ParseMix(%q) error = %v, want error containing %q", tc.spec, err, tc.errSub)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseMix(%q) = %v, %v; want %v", tc.spec, got, err, tc.want)
+		}
+	}
+}
+
+func TestPlanBudget(t *testing.T) {
+	mix := []TypeShare{{"pdf", 60}, {"png", 30}, {"txt", 10}}
+	testCases := []struct {
+		name   string
+		total  int64
+		count  int
+		mix    []TypeShare
+		dist   string
+		counts map[string]int // files per type
+		bytes  map[string]int64
+		errSub string
+	}{
+		{name: "Uniform", total: 1000, count: 3, counts: map[string]int{"": 3}, bytes: map[string]int64{"": 1000}},
+		{name: "Lognormal", total: 10 << 30, count: 100, dist: DistLognormal, counts: map[string]int{"": 100}},
+		{name: "Zipf", total: 123457, count: 10, dist: DistZipf, counts: map[string]int{"": 10}},
+		{name: "Mix", total: 1000000, count: 13, mix: mix,
+			counts: map[string]int{"pdf": 7, "png": 4, "txt": 2},
+			bytes:  map[string]int64{"pdf": 600000, "png": 300000, "txt": 100000}},
+		{name: "MixOneEach", total: 10, count: 3, mix: mix, dist: DistZipf,
+			counts: map[string]int{"pdf": 1, "png": 1, "txt": 1}},
+		{name: "TooFewFiles", total: 1000, count: 2, mix: mix, errSub: "cannot cover"},
+		{name: "NoFiles", total: 1000, count: 0, errSub: "at least 1"},
+		{name: "BadDistribution", total: 1000, count: 2, dist: "pareto", errSub: "unknown size distribution"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := PlanBudget(tc.total, tc.count, tc.mix, tc.dist, rand.New(rand.NewPCG(1, 2)))
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("PlanBudget() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PlanBudget() unexpected error = %v", err)
+			}
+			if len(plan) != tc.count {
+				t.Fatalf("PlanBudget() planned %d files, want %d", len(plan), tc.count)
+			}
+			var sum int64
+			counts, bytes := map[string]int{}, map[string]int64{}
+			for _, f := range plan {
+				if f.Size < 0 {
+					t.Fatalf("negative size %d", f.Size)
+				}
+				sum += f.Size
+				counts[f.Type]++
+				bytes[f.Type] += f.Size
+			}
+			if sum != tc.total {
+				t.Errorf("sizes add up to %d, want %d", sum, tc.total)
+			}
+			if !reflect.DeepEqual(counts, tc.counts) {
+				t.Errorf("files per type = %v, want %v", counts, tc.counts)
+			}
+			if tc.bytes != nil && !reflect.DeepEqual(bytes, tc.bytes) {
+				t.Errorf("bytes per type = %v, want %v", bytes, tc.bytes)
+			}
+		})
+	}
+}
+
+func TestFileService_CreateBudgetBatch(t *testing.T) {
+	gen := &MockFileGenerator{GenerateFunc: func(outPath string, sizeBytes int64) error {
+		return os.WriteFile(outPath, make([]byte, sizeBytes), 0o644)
+	}}
+	parser := &MockSizeParser{ParseFunc: func(spec string) (int64, error) {
+		return strconv.ParseInt(spec, 10, 64)
+	}}
+	service := NewFileService(&MockGeneratorFactory{MockGenerator: gen}, parser)
+
+	t.Run("Mix", func(t *testing.T) {
+		dir := t.TempDir()
+		name, _ := ParseNameTemplate("f_{seq}.{ext}")
+		budget := Budget{Total: "100000", Mix: []TypeShare{{"txt", 3}, {"png", 1}}, Distribution: DistLognormal}
+		batch, err := service.CreateBudgetBatch(FileRequest{}, dir, 8, name, budget)
+		if err != nil {
+			t.Fatalf("CreateBudgetBatch() unexpected error = %v", err)
+		}
+		if len(batch.Files) != 8 || batch.TotalSize != 100000 {
+			t.Errorf("CreateBudgetBatch() = %d files, %d bytes", len(batch.Files), batch.TotalSize)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "f_1.txt")); err != nil {
+			t.Error(err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "f_8.png")); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Seeded", func(t *testing.T) {
+		name, _ := ParseNameTemplate("f_{rand}.txt")
+		budget := Budget{Total: "100000", Distribution: DistLognormal}
+		req := FileRequest{Options: ports.Options{"seed": "3"}}
+		seeded := &MockConfigurableGenerator{}
+		seeded.GenerateFunc = gen.GenerateFunc
+		service := NewFileService(&MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return seeded, nil }}, parser)
+		run := func() []string {
+			batch, err := service.CreateBudgetBatch(req, t.TempDir(), 6, name, budget)
+			if err != nil {
+				t.Fatalf("CreateBudgetBatch() unexpected error = %v", err)
+			}
+			var files []string
+			for _, f := range batch.Files {
+				files = append(files, filepath.Base(f.Path)+":"+strconv.FormatInt(f.Size, 10))
+			}
+			return files
+		}
+		if first, second := run(), run(); !slices.Equal(first, second) {
+			t.Errorf("two batches of seed 3 made %v and %v", first, second)
+		}
+	})
+
+	t.Run("Mix needs {ext}", func(t *testing.T) {
+		name, _ := ParseNameTemplate("f_{seq}.txt")
+		budget := Budget{Total: "100000", Mix: []TypeShare{{"txt", 3}, {"png", 1}}}
+		if _, err := service.CreateBudgetBatch(FileRequest{}, t.TempDir(), 4, name, budget); err == nil || !strings.Contains(err.Error(), "{ext}") {
+			t.Errorf("CreateBudgetBatch() error = %v, want an {ext} error", err)
+		}
+	})
+
+	t.Run("Size conflicts", func(t *testing.T) {
+		name, _ := ParseNameTemplate("f_{seq}.txt")
+		req := FileRequest{SizeSpec: "10"}
+		if _, err := service.CreateBudgetBatch(req, t.TempDir(), 4, name, Budget{Total: "100"}); err == nil {
+			t.Error("CreateBudgetBatch() with a size succeeded, want an error")
+		}
+	})
+}
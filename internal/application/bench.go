@@ -0,0 +1,60 @@
+package application
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// BenchResult reports how one generator performed in Bench.
+type BenchResult struct {
+	Type       string
+	Size       int64         // bytes generated per run
+	Runs       int           // number of files generated
+	Wall       time.Duration // total wall time over all runs
+	Allocs     uint64        // heap allocations over all runs
+	AllocBytes uint64        // bytes allocated over all runs
+}
+
+// MBPerSec returns the throughput in megabytes (2^20 bytes) per second.
+func (r BenchResult) MBPerSec() float64 {
+	if r.Wall <= 0 {
+		return 0
+	}
+	return float64(r.Size) * float64(r.Runs) / (1 << 20) / r.Wall.Seconds()
+}
+
+// Bench generates runs files of sizeSpec in the format named by fileType
+// (an extension such as "png") in a temporary directory, measuring wall
+// time and heap allocations. The files are removed afterwards.
+func (s *FileService) Bench(fileType, sizeSpec string, runs int) (BenchResult, error) {
+	result := BenchResult{Type: fileType, Runs: runs}
+	if runs < 1 {
+		return result, fmt.Errorf("runs must be at least 1, got %d", runs)
+	}
+	dir, err := os.MkdirTemp("", "genfile-bench-")
+	if err != nil {
+		return result, err
+	}
+	defer os.RemoveAll(dir)
+	req := FileRequest{Path: filepath.Join(dir, "bench"), Type: fileType, SizeSpec: sizeSpec}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < runs; i++ {
+		created, err := s.Create(req)
+		if err != nil {
+			return result, err
+		}
+		result.Size = created.Size
+	}
+	result.Wall = time.Since(start)
+	runtime.ReadMemStats(&after)
+	result.Allocs = after.Mallocs - before.Mallocs
+	result.AllocBytes = after.TotalAlloc - before.TotalAlloc
+	return result, nil
+}
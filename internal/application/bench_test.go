@@ -0,0 +1,43 @@
+package application
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileService_Bench(t *testing.T) {
+	gen := &MockFileGenerator{GenerateFunc: func(outPath string, sizeBytes int64) error {
+		return os.WriteFile(outPath, make([]byte, sizeBytes), 0o644)
+	}}
+	service := NewFileService(&MockGeneratorFactory{MockGenerator: gen}, &MockSizeParser{})
+
+	result, err := service.Bench("txt", "1MB", 3)
+	if err != nil {
+		t.Fatalf("Bench() unexpected error = %v", err)
+	}
+	if result.Type != "txt" || result.Runs != 3 || result.Size != 1024*1024 || result.Wall <= 0 {
+		t.Errorf("Bench() = %+v", result)
+	}
+	if result.Allocs == 0 || result.AllocBytes < 1024*1024 {
+		t.Errorf("Bench() allocations = %d (%d bytes), expected the generator's buffer", result.Allocs, result.AllocBytes)
+	}
+
+	if _, err := service.Bench("unknown", "1MB", 1); err == nil || !strings.Contains(err.Error(), "unsupported file extension") {
+		t.Errorf("Bench(unknown) error = %v", err)
+	}
+	if _, err := service.Bench("txt", "1MB", 0); err == nil {
+		t.Error("Bench() with 0 runs should fail")
+	}
+}
+
+func TestBenchResult_MBPerSec(t *testing.T) {
+	r := BenchResult{Size: 10 << 20, Runs: 2, Wall: 4 * time.Second}
+	if got := r.MBPerSec(); got != 5 {
+		t.Errorf("MBPerSec() = %v, want 5", got)
+	}
+	if got := (BenchResult{}).MBPerSec(); got != 0 {
+		t.Errorf("MBPerSec() without wall time = %v, want 0", got)
+	}
+}
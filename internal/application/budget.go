@@ -0,0 +1,148 @@
+package application
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// Size distributions for the files of a budget batch.
+const (
+	DistUniform   = "uniform"   // every file the same size
+	DistLognormal = "lognormal" // mostly mid-sized files with a long tail of large ones
+	DistZipf      = "zipf"      // the k-th largest file 1/k the size of the largest
+)
+
+// TypeShare is one file type's share of a budget batch.
+type TypeShare struct {
+	Type   string  // format as a file extension (e.g. "pdf")
+	Weight float64 // relative share of the bytes and the files
+}
+
+// Budget describes a batch sized as a whole rather than per file.
+type Budget struct {
+	Total        string      // human-readable size of all files together (e.g. "10GB")
+	Mix          []TypeShare // file types and their shares; empty for the request's type
+	Distribution string      // how sizes vary between files; empty for DistUniform
+}
+
+// BudgetFile is one file of a planned budget batch.
+type BudgetFile struct {
+	Type string // empty for the request's type
+	Size int64
+}
+
+// ParseMix parses a list of file types with percentage weights, such as
+// "pdf:60,png:30,txt:10". Weights are relative and need not add up to 100.
+func ParseMix(spec string) ([]TypeShare, error) {
+	var mix []TypeShare
+	seen := map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		ext, weight, ok := strings.Cut(strings.TrimSpace(item), ":")
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if !ok || ext == "" {
+			return nil, fmt.Errorf("invalid mix entry %q; want type:weight", item)
+		}
+		if _, err := mapExtensionToFileType(ext); err != nil {
+			return nil, err
+		}
+		w, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(weight), "%"), 64)
+		if err != nil || w <= 0 || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("invalid weight %q for %s; want a positive number", weight, ext)
+		}
+		if seen[ext] {
+			return nil, fmt.Errorf("type %s appears twice in the mix", ext)
+		}
+		seen[ext] = true
+		mix = append(mix, TypeShare{Type: ext, Weight: w})
+	}
+	return mix, nil
+}
+
+// PlanBudget splits total bytes over count files. With a mix, each type
+// gets its share of the bytes and, at least one each, of the files, listed
+// type by type; within a type, sizes follow dist, drawn from r. The sizes
+// add up to exactly total.
+func PlanBudget(total int64, count int, mix []TypeShare, dist string, r *rand.Rand) ([]BudgetFile, error) {
+	if total < 0 {
+		return nil, fmt.Errorf("invalid total size %d", total)
+	}
+	if count < 1 {
+		return nil, fmt.Errorf("count must be at least 1, got %d", count)
+	}
+	switch dist {
+	case "":
+		dist = DistUniform
+	case DistUniform, DistLognormal, DistZipf:
+	default:
+		return nil, fmt.Errorf("unknown size distribution %q (want uniform, lognormal or zipf)", dist)
+	}
+	if len(mix) == 0 {
+		mix = []TypeShare{{Weight: 1}}
+	}
+	if count < len(mix) {
+		return nil, fmt.Errorf("%d files cannot cover %d file types", count, len(mix))
+	}
+
+	weights := make([]float64, len(mix))
+	for i, share := range mix {
+		weights[i] = share.Weight
+	}
+	typeBytes := apportion(total, weights)
+	// One file per type first, so a small share is not left without any.
+	typeFiles := apportion(int64(count-len(mix)), weights)
+
+	plan := make([]BudgetFile, 0, count)
+	for i, share := range mix {
+		sizes := apportion(typeBytes[i], sizeWeights(int(typeFiles[i])+1, dist, r))
+		for _, size := range sizes {
+			plan = append(plan, BudgetFile{Type: share.Type, Size: size})
+		}
+	}
+	return plan, nil
+}
+
+// sizeWeights returns n relative file sizes drawn from dist with r.
+func sizeWeights(n int, dist string, r *rand.Rand) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		switch dist {
+		case DistLognormal:
+			w[i] = math.Exp(r.NormFloat64())
+		case DistZipf:
+			w[i] = 1 / float64(i+1)
+		default:
+			w[i] = 1
+		}
+	}
+	if dist == DistZipf {
+		// Ranks in random order, so the largest file is not always first.
+		r.Shuffle(n, func(i, j int) { w[i], w[j] = w[j], w[i] })
+	}
+	return w
+}
+
+// apportion splits n into parts proportional to weights. Rounding the
+// running total keeps every part within one of its exact share and makes
+// the parts add up to n.
+func apportion(n int64, weights []float64) []int64 {
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	parts := make([]int64, len(weights))
+	var acc float64
+	var prev int64
+	for i, w := range weights {
+		acc += w
+		cum := n
+		if i < len(weights)-1 {
+			cum = min(n, int64(math.Round(float64(n)*(acc/sum))))
+		}
+		parts[i] = max(0, cum-prev)
+		prev = max(prev, cum)
+	}
+	return parts
+}
@@ -0,0 +1,72 @@
+package application
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// checksumAlgorithms maps the names accepted by Checksum to their hashes.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// CheckChecksumAlgorithm reports whether Checksum accepts algorithm, so
+// that a mistyped one is refused before the file is generated.
+func CheckChecksumAlgorithm(algorithm string) error {
+	if _, ok := checksumAlgorithms[strings.ToLower(algorithm)]; !ok {
+		return fmt.Errorf("unknown checksum algorithm %q (want md5, sha1 or sha256)", algorithm)
+	}
+	return nil
+}
+
+// Checksum returns the hex digest of the file at path using algorithm
+// (md5, sha1 or sha256).
+func Checksum(path, algorithm string) (string, error) {
+	if err := CheckChecksumAlgorithm(algorithm); err != nil {
+		return "", err
+	}
+	newHash := checksumAlgorithms[strings.ToLower(algorithm)]
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s for checksum: %w", path, err)
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s for checksum: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksums returns the hex digests of the file at path with every
+// algorithm Checksum accepts, read in one pass.
+func checksums(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s for checksum: %w", path, err)
+	}
+	defer f.Close()
+	hashes := make(map[string]hash.Hash, len(checksumAlgorithms))
+	writers := make([]io.Writer, 0, len(checksumAlgorithms))
+	for name, newHash := range checksumAlgorithms {
+		hashes[name] = newHash()
+		writers = append(writers, hashes[name])
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, fmt.Errorf("failed to read %s for checksum: %w", path, err)
+	}
+	sums := make(map[string]string, len(hashes))
+	for name, h := range hashes {
+		sums[name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, nil
+}
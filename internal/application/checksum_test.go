@@ -0,0 +1,44 @@
+package application
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "abc.txt")
+	if err := os.WriteFile(path, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		algorithm string
+		want      string
+		errSub    string
+	}{
+		{"md5", "900150983cd24fb0d6963f7d28e17f72", ""},
+		{"sha1", "a9993e364706816aba3e25717850c26c9cd0d89d", ""},
+		{"SHA256", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", ""},
+		{"crc32", "", "unknown checksum algorithm"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			got, err := Checksum(path, tc.algorithm)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("Checksum() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("Checksum() = %q, %v; want %q", got, err, tc.want)
+			}
+		})
+	}
+
+	if _, err := Checksum(filepath.Join(t.TempDir(), "missing"), "md5"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
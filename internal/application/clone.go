@@ -0,0 +1,178 @@
+package application
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// Structure describes the shape of an existing file: its format and the
+// generator options that give a new file the same shape.
+type Structure struct {
+	Type    ports.FileType
+	Size    int64
+	Options ports.Options
+}
+
+// Inspect identifies the file at path and reads the structural
+// characteristics genfile can reproduce: the number of sheets of an XLSX,
+// the dimensions of a PNG, JPEG or GIF, the page count of a PDF and the
+// column count of a CSV. Other formats give their type alone.
+func (s *FileService) Inspect(path string) (Structure, error) {
+	f, size, err := openRegular(path)
+	if err != nil {
+		return Structure{}, err
+	}
+	defer f.Close()
+
+	st := Structure{Size: size, Options: ports.Options{}}
+	if st.Type, _, err = detectType(f, path, size); err != nil {
+		return st, err
+	}
+	if st.Type == "" {
+		return st, fmt.Errorf("cannot identify the format of %s", path)
+	}
+
+	r := io.NewSectionReader(f, 0, size)
+	switch st.Type {
+	case ports.FileTypeXLSX:
+		err = inspectXLSX(r, size, st.Options)
+	case ports.FileTypePNG, ports.FileTypeJPEG, ports.FileTypeGIF:
+		err = inspectImage(r, st.Options)
+	case ports.FileTypePDF:
+		err = inspectPDF(r, st.Options)
+	case ports.FileTypeCSV:
+		err = inspectCSV(r, st.Options)
+	}
+	if err != nil {
+		return st, fmt.Errorf("failed to inspect %s: %w", path, err)
+	}
+	return st, nil
+}
+
+// Clone generates req.Path in the format of the file at from, with its
+// structure, and random content at req.SizeSpec (the size of from if
+// empty). Options in req override those read from from.
+func (s *FileService) Clone(from string, req FileRequest) (FileResult, Structure, error) {
+	st, err := s.Inspect(from)
+	if err != nil {
+		return FileResult{}, st, err
+	}
+	if req.Type != "" || req.MIME != "" {
+		return FileResult{}, st, fmt.Errorf("a clone takes the type of %s; it cannot be set", from)
+	}
+	req.Type = string(st.Type)
+	req.Options = st.Options.With(req.Options)
+	if req.SizeSpec == "" && req.Lines == 0 {
+		req.SizeSpec = strconv.FormatInt(st.Size, 10)
+	}
+	result, err := s.Create(req)
+	return result, st, err
+}
+
+// inspectXLSX counts the worksheets of a workbook.
+func inspectXLSX(r io.ReaderAt, size int64, opts ports.Options) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	sheets := 0
+	for _, f := range zr.File {
+		name, ok := strings.CutPrefix(f.Name, "xl/worksheets/")
+		if ok && !strings.Contains(name, "/") && strings.HasSuffix(name, ".xml") {
+			sheets++
+		}
+	}
+	if sheets > 0 {
+		opts["xlsx-sheets"] = strconv.Itoa(sheets)
+	}
+	return nil
+}
+
+// inspectImage reads the dimensions of an image.
+func inspectImage(r io.Reader, opts ports.Options) error {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return err
+	}
+	opts["width"] = strconv.Itoa(cfg.Width)
+	opts["height"] = strconv.Itoa(cfg.Height)
+	return nil
+}
+
+var (
+	// pdfPage matches the dictionary type of a page object.
+	pdfPage = regexp.MustCompile(`/Type\s*/Page\b`)
+	// pdfCount matches the page count of a page tree node.
+	pdfCount = regexp.MustCompile(`/Type\s*/Pages\b[^>]*?/Count\s+(\d+)|/Count\s+(\d+)[^>]*?/Type\s*/Pages\b`)
+)
+
+// inspectPDF counts the pages of a PDF. Page objects are counted where
+// they can be read; otherwise, as when they are compressed into object
+// streams, the largest page tree count is taken. The file is read in
+// chunks, each searched with the end of the one before.
+func inspectPDF(r io.Reader, opts ports.Options) error {
+	const chunkSize, overlap = 1 << 20, 256
+	pages, count := 0, 0
+	buf := make([]byte, 0, chunkSize+overlap)
+	chunk := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		tail := len(buf)
+		buf = append(buf, chunk[:n]...)
+		for _, loc := range pdfPage.FindAllIndex(buf, -1) {
+			// Matches ending in the tail were counted with the last chunk.
+			if loc[1] > tail {
+				pages++
+			}
+		}
+		for _, m := range pdfCount.FindAllSubmatch(buf, -1) {
+			c, _ := strconv.Atoi(string(bytes.Join(m[1:], nil)))
+			count = max(count, c)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		buf = append(buf[:0], buf[max(0, len(buf)-overlap):]...)
+	}
+	if pages == 0 {
+		pages = count
+	}
+	if pages > 0 {
+		opts["pdf-pages"] = strconv.Itoa(pages)
+	}
+	return nil
+}
+
+// inspectCSV reads the column count of a CSV's first record.
+func inspectCSV(r io.Reader, opts ports.Options) error {
+	cr := csv.NewReader(bufio.NewReader(r))
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	record, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if n := len(record); n > 0 && !(n == 1 && strings.TrimSpace(record[0]) == "") {
+		opts["csv-columns"] = strconv.Itoa(n)
+	}
+	return nil
+}
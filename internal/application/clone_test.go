@@ -0,0 +1,103 @@
+package application
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestFileService_Inspect(t *testing.T) {
+	tempDir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 12, 34))); err != nil {
+		t.Fatal(err)
+	}
+	// Page objects straddle the 1MB chunks inspectPDF reads.
+	bigPDF := "%PDF-1.7\n" + strings.Repeat("x", 1<<20-14) + "<< /Type /Page >>\n<< /Type /Page >>\n"
+
+	service := NewFileService(&MockGeneratorFactory{}, &MockSizeParser{})
+	tests := []struct {
+		name     string
+		path     string
+		wantType ports.FileType
+		want     ports.Options
+	}{
+		{"XLSX sheets", write("a.xlsx", zipWith(t, "xl/workbook.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml", "xl/worksheets/_rels/sheet1.xml.rels")),
+			ports.FileTypeXLSX, ports.Options{"xlsx-sheets": "2"}},
+		{"PNG dimensions", write("a.png", img.String()), ports.FileTypePNG, ports.Options{"width": "12", "height": "34"}},
+		{"PDF pages", write("a.pdf", "%PDF-1.7\n1 0 obj << /Type /Pages /Kids [2 0 R 3 0 R] /Count 2 >>\n2 0 obj << /Type /Page >>\n3 0 obj <</Type/Page>>\n"),
+			ports.FileTypePDF, ports.Options{"pdf-pages": "2"}},
+		{"PDF page tree count", write("b.pdf", "%PDF-1.7\n1 0 obj << /Count 7 /Type /Pages >>\n"), ports.FileTypePDF, ports.Options{"pdf-pages": "7"}},
+		{"PDF across chunks", write("c.pdf", bigPDF), ports.FileTypePDF, ports.Options{"pdf-pages": "2"}},
+		{"CSV columns", write("a.csv", "id,name,\"a,b\",price\n1,x,y,2\n"), ports.FileTypeCSV, ports.Options{"csv-columns": "4"}},
+		{"Type only", write("a.gif.bin", "RIFF\x24\x08\x00\x00WAVEfmt "), ports.FileTypeWAV, ports.Options{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			st, err := service.Inspect(tc.path)
+			if err != nil {
+				t.Fatalf("Inspect() unexpected error = %v", err)
+			}
+			if st.Type != tc.wantType || len(st.Options) != len(tc.want) {
+				t.Fatalf("Inspect() = %+v, want type %q with %v", st, tc.wantType, tc.want)
+			}
+			for k, v := range tc.want {
+				if st.Options[k] != v {
+					t.Errorf("Inspect() option %s = %q, want %q", k, st.Options[k], v)
+				}
+			}
+		})
+	}
+
+	if _, err := service.Inspect(write("blob", "\x01\x02\x00\xff")); err == nil || !strings.Contains(err.Error(), "cannot identify") {
+		t.Errorf("Inspect() of unknown content error = %v, want 'cannot identify'", err)
+	}
+}
+
+func TestFileService_Clone(t *testing.T) {
+	tempDir := t.TempDir()
+	from := filepath.Join(tempDir, "real.csv")
+	if err := os.WriteFile(from, []byte("a,b,c\n1,2,3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mockGen := &MockConfigurableGenerator{}
+	var gotType ports.FileType
+	factory := &MockGeneratorFactory{ForFunc: func(t ports.FileType) (ports.FileGenerator, error) {
+		gotType = t
+		return mockGen, nil
+	}}
+	parser := &MockSizeParser{ParseFunc: func(spec string) (int64, error) { return strconv.ParseInt(spec, 10, 64) }}
+	service := NewFileService(factory, parser)
+
+	_, st, err := service.Clone(from, FileRequest{Path: filepath.Join(tempDir, "out.dat"), Options: ports.Options{"lang": "zh"}})
+	if err != nil {
+		t.Fatalf("Clone() unexpected error = %v", err)
+	}
+	if st.Type != ports.FileTypeCSV || gotType != ports.FileTypeCSV {
+		t.Errorf("Clone() inspected %q and generated %q, want csv", st.Type, gotType)
+	}
+	if mockGen.Configured["csv-columns"] != "3" || mockGen.Configured["lang"] != "zh" {
+		t.Errorf("generator configured with %v, want csv-columns 3 and lang zh", mockGen.Configured)
+	}
+	if mockGen.CalledWithSize != 12 {
+		t.Errorf("generator called with size %d, want the source's 12", mockGen.CalledWithSize)
+	}
+
+	if _, _, err := service.Clone(from, FileRequest{Path: filepath.Join(tempDir, "b.csv"), SizeSpec: "1024", Type: "png"}); err == nil {
+		t.Error("Clone() with a type set: expected an error")
+	}
+}
@@ -0,0 +1,50 @@
+package application
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// Deliver generates the file described by req and stores it on sink at
+// remotePath. req.Path only names the output (e.g. the remote URI) and,
+// without req.Type, selects the format by its extension. req.Throttle paces
+// the upload.
+func (s *FileService) Deliver(sink ports.Sink, remotePath string, req FileRequest) (FileResult, error) {
+	req, err := resolveMIME(req)
+	if err != nil {
+		return FileResult{Path: req.Path, Size: ports.AnySize, TargetSize: ports.AnySize}, err
+	}
+	fileType, generator, err := s.generatorFor(req.Path, req.Type)
+	if err != nil {
+		return FileResult{Path: req.Path, Size: ports.AnySize, TargetSize: ports.AnySize}, err
+	}
+	if _, ok := ports.As[ports.SetGenerator](generator); ok {
+		return FileResult{Path: req.Path, Type: fileType, Size: ports.AnySize, TargetSize: ports.AnySize}, fmt.Errorf("%s files come with companion files and cannot be delivered to a remote output", fileType)
+	}
+	result, path, cleanup, err := s.createTemp(req, fileType)
+	defer cleanup()
+	if err != nil {
+		return result, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return result, fmt.Errorf("failed to read generated %s: %w", req.Path, err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if req.Throttle != "" {
+		rate, err := s.parseRate(req.Throttle)
+		if err != nil {
+			return result, err
+		}
+		r = utils.NewThrottledReader(f, rate)
+	}
+	if err := sink.Put(remotePath, r); err != nil {
+		return result, fmt.Errorf("failed to deliver %s: %w", req.Path, err)
+	}
+	return result, nil
+}
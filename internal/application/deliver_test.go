@@ -0,0 +1,67 @@
+package application
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// MockSink is a mock for ports.Sink
+type MockSink struct {
+	Files  map[string][]byte
+	PutErr error
+}
+
+func (m *MockSink) Put(path string, r io.Reader) error {
+	if m.PutErr != nil {
+		return m.PutErr
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.Files[path] = data
+	return nil
+}
+
+func (m *MockSink) Remove(path string) error {
+	delete(m.Files, path)
+	return nil
+}
+
+func (m *MockSink) Close() error { return nil }
+
+func TestFileService_Deliver(t *testing.T) {
+	gen := &MockFileGenerator{GenerateFunc: func(outPath string, sizeBytes int64) error {
+		return os.WriteFile(outPath, bytes.Repeat([]byte("d"), int(sizeBytes)), 0o644)
+	}}
+	service := NewFileService(&MockGeneratorFactory{MockGenerator: gen}, &MockSizeParser{})
+	req := FileRequest{Path: "sftp://qa@appliance/in/fixture.txt", SizeSpec: "10KB"}
+
+	t.Run("Uploaded", func(t *testing.T) {
+		sink := &MockSink{Files: map[string][]byte{}}
+		result, err := service.Deliver(sink, "/in/fixture.txt", req)
+		if err != nil {
+			t.Fatalf("Deliver() unexpected error = %v", err)
+		}
+		if got := len(sink.Files["/in/fixture.txt"]); got != 10*1024 {
+			t.Errorf("sink received %d bytes, want %d", got, 10*1024)
+		}
+		if result.Path != req.Path || result.Type != ports.FileTypeTXT || result.Size != 10*1024 {
+			t.Errorf("Deliver() result = %+v", result)
+		}
+	})
+
+	t.Run("Upload fails", func(t *testing.T) {
+		sink := &MockSink{PutErr: errors.New("permission denied")}
+		_, err := service.Deliver(sink, "/in/fixture.txt", req)
+		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+			t.Errorf("Deliver() error = %v, want the upload error", err)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package application
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// TypeInfo describes a file type's generator, for listings that front
+// ends build on.
+type TypeInfo struct {
+	Type       ports.FileType
+	Extensions []string // the extensions it is generated for, the usual one first
+	MIMETypes  []string // the MIME types that select it, sorted
+	// MinSize is the smallest file it writes, or 0 if the generator does
+	// not plan its output.
+	MinSize int64
+	// SizeStep is what every size it writes is a multiple of: 1 for
+	// formats written at any exact size from MinSize.
+	SizeStep     int64
+	Capabilities ports.Capabilities
+}
+
+// Describe returns what is known of the generator for fileType without
+// generating anything: its extensions and MIME types, from this package's
+// tables, and its minimum size, size step and optional ports, from the
+// generator.
+func (s *FileService) Describe(fileType string) (TypeInfo, error) {
+	t, generator, err := s.generatorFor("", fileType)
+	if err != nil {
+		return TypeInfo{}, err
+	}
+	info := TypeInfo{
+		Type:         t,
+		Extensions:   fileTypeExtensions[t],
+		SizeStep:     1,
+		Capabilities: ports.CapabilitiesOf(generator),
+	}
+	for _, m := range slices.Sorted(maps.Keys(mimeTypes)) {
+		if slices.Contains(info.Extensions, mimeTypes[m]) {
+			info.MIMETypes = append(info.MIMETypes, m)
+		}
+	}
+	if planner, ok := ports.As[ports.Planner](generator); ok {
+		if plan, err := planner.Plan(0); err == nil {
+			info.MinSize = plan.MinSize
+		}
+	}
+	if stepper, ok := ports.As[ports.SizeStepper](generator); ok {
+		info.SizeStep = stepper.SizeStep()
+	}
+	return info, nil
+}
@@ -0,0 +1,77 @@
+package application
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// MockSizeStepper is a mock for ports.SizeStepper
+type MockSizeStepper struct {
+	MockFileGenerator
+	Step int64 // 4096 if zero
+}
+
+func (m *MockSizeStepper) SizeStep() int64 {
+	if m.Step == 0 {
+		return 4096
+	}
+	return m.Step
+}
+
+func TestFileService_Describe(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileType string
+		gen      ports.FileGenerator
+		want     TypeInfo
+	}{
+		{
+			name:     "Plain generator",
+			fileType: "txt",
+			gen:      &MockFileGenerator{},
+			want:     TypeInfo{Type: ports.FileTypeTXT, Extensions: []string{"txt", "text"}, MIMETypes: []string{"text/plain"}, SizeStep: 1},
+		},
+		{
+			name:     "Planner by extension",
+			fileType: ".JPEG",
+			gen:      &MockPlanner{},
+			want: TypeInfo{Type: ports.FileTypeJPEG, Extensions: []string{"jpg", "jpeg"}, MIMETypes: []string{"image/jpeg", "image/jpg"},
+				MinSize: 100, SizeStep: 1, Capabilities: ports.Capabilities{Plan: true}},
+		},
+		{
+			name:     "Size step",
+			fileType: "mdb",
+			gen:      &MockSizeStepper{},
+			want:     TypeInfo{Type: ports.FileTypeMDB, Extensions: []string{"mdb"}, MIMETypes: []string{"application/vnd.ms-access", "application/x-msaccess"}, SizeStep: 4096},
+		},
+		{
+			name:     "No MIME type",
+			fileType: "fwf",
+			gen:      &MockFileGenerator{},
+			want:     TypeInfo{Type: ports.FileTypeFWF, Extensions: []string{"fwf"}, SizeStep: 1},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+			got, err := service.Describe(tc.fileType)
+			if err != nil {
+				t.Fatalf("Describe() unexpected error = %v", err)
+			}
+			if got.Type != tc.want.Type || !slices.Equal(got.Extensions, tc.want.Extensions) || !slices.Equal(got.MIMETypes, tc.want.MIMETypes) ||
+				got.MinSize != tc.want.MinSize || got.SizeStep != tc.want.SizeStep || got.Capabilities != tc.want.Capabilities {
+				t.Errorf("Describe() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Unknown type", func(t *testing.T) {
+		service := NewFileService(&MockGeneratorFactory{}, &MockSizeParser{})
+		if _, err := service.Describe("nope"); err == nil {
+			t.Error("Describe() of an unknown type succeeded")
+		}
+	})
+}
@@ -0,0 +1,571 @@
+package application
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// EnvSpec declares a fixture environment: the files and trees of files a
+// test dataset is made of, the shared-block pools they draw on and the
+// remote servers some of them are uploaded to. ApplyEnv stands it up and
+// DestroyEnv tears it down, both recording what exists in an EnvState.
+type EnvSpec struct {
+	// Dir is where relative paths are created. LoadEnvSpec resolves it
+	// against the spec's directory, which it defaults to, and makes it
+	// absolute, so that the state records the same paths wherever apply
+	// and destroy run.
+	Dir string `json:"dir,omitempty"`
+	// MTime is the modification time of every file that sets none.
+	MTime   string             `json:"mtime,omitempty"`
+	Pools   map[string]EnvPool `json:"pools,omitempty"`
+	Remotes map[string]string  `json:"remotes,omitempty"` // base URIs, such as sftp://qa@appliance/upload
+	Files   []EnvFile          `json:"files,omitempty"`
+	Trees   []EnvTree          `json:"trees,omitempty"`
+}
+
+// EnvPool is a pool of shared filler chunks (see the "shared-blocks"
+// option) that the files and trees naming it draw on.
+type EnvPool struct {
+	Seed  uint64  `json:"seed,omitempty"` // if 0, one made from the pool's name
+	Share float64 `json:"share"`          // share of the filler drawn from the pool
+}
+
+// EnvFile is one file of an environment, created locally or, with
+// Remote, uploaded to Path under that remote's base URI.
+type EnvFile struct {
+	Path    string        `json:"path"`
+	Remote  string        `json:"remote,omitempty"`
+	Type    string        `json:"type,omitempty"`
+	Size    string        `json:"size,omitempty"`
+	Lines   int64         `json:"lines,omitempty"`
+	Options ports.Options `json:"options,omitempty"`
+	Pool    string        `json:"pool,omitempty"`
+	MTime   string        `json:"mtime,omitempty"`
+	Mode    string        `json:"mode,omitempty"`
+}
+
+// EnvTree is a batch of files in a directory, named by a NameTemplate
+// pattern and sized each by Size or together by Total, as CreateBatch and
+// CreateBudgetBatch make them.
+type EnvTree struct {
+	Dir          string        `json:"dir"`
+	Count        int           `json:"count"`
+	Name         string        `json:"name,omitempty"`    // defaultTreeName if empty
+	Profile      string        `json:"profile,omitempty"` // a PathProfile
+	Type         string        `json:"type,omitempty"`
+	Size         string        `json:"size,omitempty"`
+	Lines        int64         `json:"lines,omitempty"`
+	Total        string        `json:"total,omitempty"`
+	Mix          string        `json:"mix,omitempty"` // as ParseMix takes it
+	Distribution string        `json:"distribution,omitempty"`
+	Options      ports.Options `json:"options,omitempty"`
+	Pool         string        `json:"pool,omitempty"`
+	MTime        string        `json:"mtime,omitempty"`
+	Mode         string        `json:"mode,omitempty"`
+}
+
+// defaultTreeName names the files of a tree without a name pattern.
+const defaultTreeName = "file_{seq:4}.{ext}"
+
+// EnvState records the resources of an environment that exist, so that
+// ApplyEnv only changes what the spec changed and DestroyEnv knows what
+// to remove.
+type EnvState struct {
+	Resources []EnvResource `json:"resources"`
+}
+
+// EnvResource is a file or tree of an environment as it was created.
+type EnvResource struct {
+	Address string `json:"address"` // "file:PATH", "file:REMOTE:PATH" or "tree:DIR"
+	// Digest identifies the declaration the resource was created from; it
+	// is empty for one that failed part way.
+	Digest string   `json:"digest"`
+	Paths  []string `json:"paths"` // absolute local paths, or the URIs of uploads
+	Size   int64    `json:"size"`  // of all the paths together
+}
+
+// Environment changes, as PlanEnv lists them.
+const (
+	EnvCreate  = "create"
+	EnvReplace = "replace"
+	EnvDestroy = "destroy"
+	EnvKeep    = "keep"
+)
+
+// EnvChange is what applying an environment does to one resource.
+type EnvChange struct {
+	Action  string
+	Address string
+}
+
+// SinkOpener connects to the remote server named by uri and returns a
+// sink on it together with the file path from the URI.
+type SinkOpener func(uri string) (ports.Sink, string, error)
+
+// envResource is a resource of a spec, resolved for creating it.
+type envResource struct {
+	address string
+	digest  string
+	file    *EnvFile
+	tree    *EnvTree
+	path    string // local path, or remote URI
+	remote  bool
+	opts    ports.Options
+	mtime   string
+}
+
+// LoadEnvSpec reads the JSON environment spec at path.
+func LoadEnvSpec(path string) (EnvSpec, error) {
+	var spec EnvSpec
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return spec, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&spec); err != nil {
+		return spec, fmt.Errorf("invalid environment spec %s: %w", path, err)
+	}
+	if !filepath.IsAbs(spec.Dir) {
+		spec.Dir = filepath.Join(filepath.Dir(path), spec.Dir)
+	}
+	if spec.Dir, err = filepath.Abs(spec.Dir); err != nil {
+		return spec, fmt.Errorf("failed to resolve the directory of %s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// LoadEnvState reads the state file at path; an empty state if there is
+// none.
+func LoadEnvState(path string) (EnvState, error) {
+	var state EnvState
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("invalid environment state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// SaveEnvState writes state to the state file at path, replacing it whole
+// so that a crash leaves either the old state or the new. An empty state
+// removes the file.
+func SaveEnvState(path string, state EnvState) error {
+	if len(state.Resources) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove the environment state %s: %w", path, err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o666); err != nil {
+		return fmt.Errorf("failed to save the environment state %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save the environment state %s: %w", path, err)
+	}
+	return nil
+}
+
+// PlanEnv lists what ApplyEnv would do to bring state to spec: destroy
+// the resources spec no longer declares, then create those it declares
+// anew, replace those whose declaration changed or whose files are
+// missing, and keep the rest. A resource to create whose file, or whose
+// tree's directory with files in it, already exists is an error, as the
+// state does not own it and destroy would remove it.
+func PlanEnv(spec EnvSpec, state EnvState) ([]EnvChange, error) {
+	resources, err := resolveEnv(spec)
+	if err != nil {
+		return nil, err
+	}
+	declared := make(map[string]bool, len(resources))
+	for _, r := range resources {
+		declared[r.address] = true
+	}
+	var changes []EnvChange
+	for _, old := range state.Resources {
+		if !declared[old.Address] {
+			changes = append(changes, EnvChange{EnvDestroy, old.Address})
+		}
+	}
+	for _, r := range resources {
+		action := planResource(r, state)
+		if action == EnvCreate && !r.remote {
+			if err := checkUnowned(r); err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, EnvChange{action, r.address})
+	}
+	return changes, nil
+}
+
+// planResource returns the change applying r makes, given state.
+func planResource(r envResource, state EnvState) string {
+	old, ok := state.find(r.address)
+	switch {
+	case !ok:
+		return EnvCreate
+	case old.Digest != r.digest:
+		return EnvReplace
+	}
+	if !r.remote {
+		for _, p := range old.Paths {
+			if _, err := os.Stat(p); err != nil {
+				return EnvReplace
+			}
+		}
+	}
+	return EnvKeep
+}
+
+// checkUnowned returns an error if the local resource r, which the state
+// does not record, would be created over files already there.
+func checkUnowned(r envResource) error {
+	if r.file != nil {
+		if _, err := os.Lstat(r.path); err == nil {
+			return fmt.Errorf("%s: %s already exists and is not in the state; remove it or change the path", r.address, r.path)
+		}
+		return nil
+	}
+	if entries, err := os.ReadDir(r.path); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s: %s already exists with files in it and is not in the state; remove it or change the dir", r.address, r.path)
+	}
+	return nil
+}
+
+// ApplyEnv brings the environment recorded in state to spec, as PlanEnv
+// plans it, opening remote sinks with open. It returns the new state and
+// the changes made; after a failure the state records what was done until
+// then, so that applying again carries on and destroying removes it.
+func (s *FileService) ApplyEnv(spec EnvSpec, state EnvState, open SinkOpener) (EnvState, []EnvChange, error) {
+	resources, err := resolveEnv(spec)
+	if err != nil {
+		return state, nil, err
+	}
+	changes, err := PlanEnv(spec, state)
+	if err != nil {
+		return state, nil, err
+	}
+	var done []EnvChange
+	for _, c := range changes {
+		if c.Action != EnvDestroy {
+			continue
+		}
+		old, _ := state.find(c.Address)
+		if err := destroyResource(old, spec.Dir, open); err != nil {
+			return state, done, err
+		}
+		state = state.without(c.Address)
+		done = append(done, c)
+	}
+
+	next := EnvState{}
+	for i, r := range resources {
+		c := changes[len(changes)-len(resources)+i]
+		old, ok := state.find(r.address)
+		if c.Action == EnvKeep {
+			next.Resources = append(next.Resources, old)
+			done = append(done, c)
+			continue
+		}
+		if ok {
+			if err := destroyResource(old, spec.Dir, open); err != nil {
+				return next.merge(state), done, err
+			}
+			state = state.without(r.address)
+		}
+		created, err := s.createResource(r, spec.Dir, open)
+		next.Resources = append(next.Resources, created)
+		if err != nil {
+			return next.merge(state), done, err
+		}
+		done = append(done, c)
+	}
+	return next, done, nil
+}
+
+// DestroyEnv removes every resource recorded in state, opening remote
+// sinks with open, and the directories left empty under dir. It returns
+// what remains of the state, empty unless a removal failed, and the
+// changes made.
+func DestroyEnv(state EnvState, dir string, open SinkOpener) (EnvState, []EnvChange, error) {
+	var done []EnvChange
+	for len(state.Resources) > 0 {
+		r := state.Resources[len(state.Resources)-1]
+		if err := destroyResource(r, dir, open); err != nil {
+			return state, done, err
+		}
+		state = state.without(r.Address)
+		done = append(done, EnvChange{EnvDestroy, r.Address})
+	}
+	return state, done, nil
+}
+
+// resolveEnv checks spec and resolves its resources, files first, in
+// the order declared.
+func resolveEnv(spec EnvSpec) ([]envResource, error) {
+	var resources []envResource
+	seen := map[string]bool{}
+	add := func(r envResource, decl any) error {
+		if seen[r.address] {
+			return fmt.Errorf("%s is declared twice", r.address)
+		}
+		seen[r.address] = true
+		// The digest covers what the declaration resolves to, so that a
+		// changed pool, remote or default mtime replaces its users too.
+		data, err := json.Marshal(struct {
+			Decl  any
+			Path  string
+			Opts  ports.Options
+			MTime string
+		}{decl, r.path, r.opts, r.mtime})
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		r.digest = hex.EncodeToString(sum[:])
+		resources = append(resources, r)
+		return nil
+	}
+
+	for i := range spec.Files {
+		f := &spec.Files[i]
+		if f.Path == "" {
+			return nil, fmt.Errorf("file %d has no path", i+1)
+		}
+		r := envResource{file: f, address: "file:" + f.Path, mtime: cmp.Or(f.MTime, spec.MTime)}
+		if f.Remote != "" {
+			base, ok := spec.Remotes[f.Remote]
+			if !ok {
+				return nil, fmt.Errorf("file %s names an undeclared remote %q", f.Path, f.Remote)
+			}
+			r.address = "file:" + f.Remote + ":" + f.Path
+			r.path = strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(f.Path, "/")
+			r.remote = true
+		} else {
+			r.path = envPath(spec.Dir, f.Path)
+		}
+		var err error
+		if r.opts, err = envOptions(spec, f.Options, f.Pool); err != nil {
+			return nil, fmt.Errorf("file %s: %w", f.Path, err)
+		}
+		if err := add(r, *f); err != nil {
+			return nil, err
+		}
+	}
+	for i := range spec.Trees {
+		t := &spec.Trees[i]
+		if t.Dir == "" {
+			return nil, fmt.Errorf("tree %d has no dir", i+1)
+		}
+		r := envResource{tree: t, address: "tree:" + t.Dir, path: envPath(spec.Dir, t.Dir), mtime: cmp.Or(t.MTime, spec.MTime)}
+		var err error
+		if r.opts, err = envOptions(spec, t.Options, t.Pool); err != nil {
+			return nil, fmt.Errorf("tree %s: %w", t.Dir, err)
+		}
+		if err := add(r, *t); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// envPath returns path resolved against dir.
+func envPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, filepath.FromSlash(path))
+}
+
+// envOptions returns opts with the shared-block options of the pool named
+// pool, if any.
+func envOptions(spec EnvSpec, opts ports.Options, pool string) (ports.Options, error) {
+	if pool == "" {
+		return opts, nil
+	}
+	p, ok := spec.Pools[pool]
+	if !ok {
+		return nil, fmt.Errorf("undeclared pool %q", pool)
+	}
+	if p.Share <= 0 || p.Share > 1 {
+		return nil, fmt.Errorf("pool %q needs a share above 0 and at most 1, got %g", pool, p.Share)
+	}
+	if p.Seed == 0 {
+		h := fnv.New64a()
+		h.Write([]byte(pool))
+		p.Seed = h.Sum64()
+	}
+	return opts.With(ports.Options{
+		"shared-blocks": strconv.FormatFloat(p.Share, 'g', -1, 64),
+		"shared-pool":   strconv.FormatUint(p.Seed, 10),
+	}), nil
+}
+
+// createResource creates r, returning its record: with no digest if it
+// failed, listing the files made until then.
+func (s *FileService) createResource(r envResource, dir string, open SinkOpener) (EnvResource, error) {
+	created := EnvResource{Address: r.address}
+	if f := r.file; f != nil {
+		req := FileRequest{Path: r.path, Type: f.Type, SizeSpec: f.Size, Lines: f.Lines, Options: r.opts, MTime: r.mtime, Mode: f.Mode}
+		var result FileResult
+		var err error
+		if r.remote {
+			result, err = s.deliverEnvFile(req, open)
+		} else {
+			err = os.MkdirAll(filepath.Dir(r.path), 0o755)
+			if err == nil {
+				result, err = s.Create(req)
+			}
+		}
+		if err != nil {
+			return created, fmt.Errorf("%s: %w", r.address, err)
+		}
+		created.Paths = result.Paths()
+		for _, c := range append([]FileResult{result}, result.Companions...) {
+			created.Size += max(c.Size, 0)
+		}
+		created.Digest = r.digest
+		return created, nil
+	}
+
+	t := r.tree
+	name, err := ParseNameTemplate(cmp.Or(t.Name, defaultTreeName))
+	if err != nil {
+		return created, fmt.Errorf("%s: %w", r.address, err)
+	}
+	if t.Profile != "" {
+		profile, err := ParsePathProfile(t.Profile)
+		if err != nil {
+			return created, fmt.Errorf("%s: %w", r.address, err)
+		}
+		name = name.WithProfile(profile)
+	}
+	req := FileRequest{Type: t.Type, SizeSpec: t.Size, Lines: t.Lines, Options: r.opts, MTime: r.mtime, Mode: t.Mode}
+	var batch BatchResult
+	if t.Total != "" {
+		budget := Budget{Total: t.Total, Distribution: t.Distribution}
+		if t.Mix != "" {
+			if budget.Mix, err = ParseMix(t.Mix); err != nil {
+				return created, fmt.Errorf("%s: %w", r.address, err)
+			}
+		}
+		batch, err = s.CreateBudgetBatch(req, r.path, t.Count, name, budget)
+	} else {
+		batch, err = s.CreateBatch(req, r.path, t.Count, name)
+	}
+	for _, f := range batch.Files {
+		created.Paths = append(created.Paths, f.Paths()...)
+	}
+	created.Size = batch.TotalSize
+	if err != nil {
+		return created, fmt.Errorf("%s: %w", r.address, err)
+	}
+	created.Digest = r.digest
+	return created, nil
+}
+
+// deliverEnvFile generates req and uploads it to the URI in its Path.
+func (s *FileService) deliverEnvFile(req FileRequest, open SinkOpener) (FileResult, error) {
+	sink, remotePath, err := open(req.Path)
+	if err != nil {
+		return FileResult{Path: req.Path, Size: ports.AnySize, TargetSize: ports.AnySize}, err
+	}
+	defer sink.Close()
+	return s.Deliver(sink, remotePath, req)
+}
+
+// destroyResource removes the files of r, and the directories under dir
+// they leave empty.
+func destroyResource(r EnvResource, dir string, open SinkOpener) error {
+	for _, p := range r.Paths {
+		if strings.Contains(p, "://") {
+			sink, remotePath, err := open(p)
+			if err != nil {
+				return fmt.Errorf("%s: %w", r.Address, err)
+			}
+			err = sink.Remove(remotePath)
+			sink.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", r.Address, err)
+			}
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			// States written before paths were recorded absolute are
+			// relative to wherever apply ran, which is not known here.
+			return fmt.Errorf("%s: recorded path %s is relative; remove it by hand", r.Address, p)
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s: %w", r.Address, err)
+		}
+		removeEmptyDirs(filepath.Dir(p), dir)
+	}
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents while they are empty, up
+// to but not including root.
+func removeEmptyDirs(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root; dir = filepath.Dir(dir) {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || !filepath.IsLocal(rel) || os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// find returns the resource of s at address.
+func (s EnvState) find(address string) (EnvResource, bool) {
+	for _, r := range s.Resources {
+		if r.Address == address {
+			return r, true
+		}
+	}
+	return EnvResource{}, false
+}
+
+// without returns s without the resource at address.
+func (s EnvState) without(address string) EnvState {
+	var out EnvState
+	for _, r := range s.Resources {
+		if r.Address != address {
+			out.Resources = append(out.Resources, r)
+		}
+	}
+	return out
+}
+
+// merge returns s followed by the resources of other it lacks.
+func (s EnvState) merge(other EnvState) EnvState {
+	for _, r := range other.Resources {
+		if _, ok := s.find(r.Address); !ok {
+			s.Resources = append(s.Resources, r)
+		}
+	}
+	return s
+}
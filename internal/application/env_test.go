@@ -0,0 +1,189 @@
+package application
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestFileService_ApplyEnv(t *testing.T) {
+	gen := &MockFileGenerator{GenerateFunc: func(outPath string, sizeBytes int64) error {
+		return os.WriteFile(outPath, bytes.Repeat([]byte("d"), int(sizeBytes)), 0o644)
+	}}
+	service := NewFileService(&MockGeneratorFactory{MockGenerator: gen}, &MockSizeParser{})
+	sink := &MockSink{Files: map[string][]byte{}}
+	open := func(uri string) (ports.Sink, string, error) {
+		_, path, _ := strings.Cut(strings.TrimPrefix(uri, "sftp://"), "/")
+		return sink, "/" + path, nil
+	}
+	dir := t.TempDir()
+	spec := EnvSpec{
+		Dir:     dir,
+		Remotes: map[string]string{"appliance": "sftp://qa@appliance/in/"},
+		Files: []EnvFile{
+			{Path: "docs/a.txt", Size: "10KB"},
+			{Path: "b.txt", Remote: "appliance", Size: "10KB"},
+		},
+		Trees: []EnvTree{{Dir: "images/set", Count: 3, Type: "png", Size: "10KB"}},
+	}
+	apply := func(spec EnvSpec, state EnvState, want ...string) EnvState {
+		t.Helper()
+		next, changes, err := service.ApplyEnv(spec, state, open)
+		if err != nil {
+			t.Fatalf("ApplyEnv() unexpected error = %v", err)
+		}
+		var got []string
+		for _, c := range changes {
+			got = append(got, c.Action+" "+c.Address)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("ApplyEnv() changes = %q, want %q", got, want)
+		}
+		return next
+	}
+
+	state := apply(spec, EnvState{}, "create file:docs/a.txt", "create file:appliance:b.txt", "create tree:images/set")
+	if len(state.Resources) != 3 || len(state.Resources[2].Paths) != 3 || state.Resources[2].Size != 3*10*1024 {
+		t.Fatalf("state = %+v", state)
+	}
+	if got := len(sink.Files["/in/b.txt"]); got != 10*1024 {
+		t.Errorf("uploaded %d bytes, want %d", got, 10*1024)
+	}
+	state = apply(spec, state, "keep file:docs/a.txt", "keep file:appliance:b.txt", "keep tree:images/set")
+
+	// A missing file is made again, and a changed declaration replaces
+	// its files.
+	os.Remove(filepath.Join(dir, "docs", "a.txt"))
+	spec.Trees[0].Size = "1MB"
+	state = apply(spec, state, "replace file:docs/a.txt", "keep file:appliance:b.txt", "replace tree:images/set")
+	if info, err := os.Stat(state.Resources[2].Paths[0]); err != nil || info.Size() != 1024*1024 {
+		t.Errorf("replaced tree file = %v, %v", info, err)
+	}
+
+	// Resources no longer declared are destroyed, with the directories
+	// they leave empty.
+	spec.Trees = nil
+	state = apply(spec, state, "destroy tree:images/set", "keep file:docs/a.txt", "keep file:appliance:b.txt")
+	if _, err := os.Stat(filepath.Join(dir, "images")); !os.IsNotExist(err) {
+		t.Errorf("tree directory left behind: %v", err)
+	}
+
+	state, changes, err := DestroyEnv(state, dir, open)
+	if err != nil || len(changes) != 2 || len(state.Resources) != 0 {
+		t.Fatalf("DestroyEnv() = %+v, %+v, %v", state, changes, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 || len(sink.Files) != 0 {
+		t.Errorf("left behind %v locally and %v remotely", entries, sink.Files)
+	}
+
+	t.Run("Failure", func(t *testing.T) {
+		failing := &MockFileGenerator{GenerateFunc: func(outPath string, sizeBytes int64) error {
+			if strings.HasSuffix(outPath, "2.txt") {
+				return errors.New("disk full")
+			}
+			return os.WriteFile(outPath, []byte("d"), 0o644)
+		}}
+		service := NewFileService(&MockGeneratorFactory{MockGenerator: failing}, &MockSizeParser{})
+		spec := EnvSpec{Dir: t.TempDir(), Trees: []EnvTree{{Dir: "t", Count: 3, Name: "{seq}.txt", Size: "10KB"}}}
+		state, _, err := service.ApplyEnv(spec, EnvState{}, open)
+		if err == nil || !strings.Contains(err.Error(), "disk full") {
+			t.Fatalf("ApplyEnv() error = %v, want the generator's", err)
+		}
+		// The state keeps the files made, so that they can be removed.
+		if len(state.Resources) != 1 || state.Resources[0].Digest != "" || len(state.Resources[0].Paths) != 1 {
+			t.Errorf("state = %+v, want the tree's first file without a digest", state)
+		}
+	})
+}
+
+func TestPlanEnv_Errors(t *testing.T) {
+	// Files the state does not record are not created over.
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "t"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", filepath.Join("t", "b.txt")} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("mine"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		spec   EnvSpec
+		errSub string
+	}{
+		{"No path", EnvSpec{Files: []EnvFile{{Size: "1MB"}}}, "has no path"},
+		{"Twice", EnvSpec{Files: []EnvFile{{Path: "a.txt"}, {Path: "a.txt"}}}, "declared twice"},
+		{"Unknown remote", EnvSpec{Files: []EnvFile{{Path: "a.txt", Remote: "nas"}}}, "undeclared remote"},
+		{"Unknown pool", EnvSpec{Trees: []EnvTree{{Dir: "t", Pool: "p"}}}, "undeclared pool"},
+		{"Bad share", EnvSpec{Pools: map[string]EnvPool{"p": {Share: 2}}, Files: []EnvFile{{Path: "a.txt", Pool: "p"}}}, "share above 0"},
+		{"Untracked file", EnvSpec{Dir: dir, Files: []EnvFile{{Path: "a.txt"}}}, "already exists"},
+		{"Untracked tree", EnvSpec{Dir: dir, Trees: []EnvTree{{Dir: "t", Count: 1}}}, "already exists"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := PlanEnv(tc.spec, EnvState{}); err == nil || !strings.Contains(err.Error(), tc.errSub) {
+				t.Errorf("PlanEnv() error = %v, want error containing %q", err, tc.errSub)
+			}
+		})
+	}
+}
+
+func TestLoadEnvSpec_RelativePath(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.Mkdir("qa", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("qa", "env.json"), []byte(`{"dir": "out"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := LoadEnvSpec(filepath.Join("qa", "env.json"))
+	if err != nil {
+		t.Fatalf("LoadEnvSpec() error = %v", err)
+	}
+	if want := filepath.Join(dir, "qa", "out"); spec.Dir != want {
+		t.Errorf("LoadEnvSpec() dir = %q, want %q", spec.Dir, want)
+	}
+
+	// A relative path recorded by an older state is not removed from
+	// wherever destroy happens to run.
+	if err := os.WriteFile("a.txt", []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	state := EnvState{Resources: []EnvResource{{Address: "file:a.txt", Paths: []string{"a.txt"}}}}
+	if _, _, err := DestroyEnv(state, spec.Dir, nil); err == nil || !strings.Contains(err.Error(), "relative") {
+		t.Errorf("DestroyEnv() error = %v, want a relative path error", err)
+	}
+	if _, err := os.Stat("a.txt"); err != nil {
+		t.Errorf("DestroyEnv() removed an unrelated file: %v", err)
+	}
+}
+
+func TestEnvState_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.json.genfile-state")
+	state := EnvState{Resources: []EnvResource{{Address: "file:a.txt", Digest: "d", Paths: []string{"a.txt"}, Size: 3}}}
+	if err := SaveEnvState(path, state); err != nil {
+		t.Fatalf("SaveEnvState() error = %v", err)
+	}
+	got, err := LoadEnvState(path)
+	if err != nil || len(got.Resources) != 1 || got.Resources[0].Address != "file:a.txt" {
+		t.Errorf("LoadEnvState() = %+v, %v", got, err)
+	}
+	if err := SaveEnvState(path, EnvState{}); err != nil {
+		t.Fatalf("SaveEnvState() of an empty state error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("empty state left a file: %v", err)
+	}
+	if got, err := LoadEnvState(path); err != nil || len(got.Resources) != 0 {
+		t.Errorf("LoadEnvState() of a missing file = %+v, %v", got, err)
+	}
+}
@@ -2,8 +2,13 @@ package application
 
 import (
 	"fmt"
+	"io/fs"
+	"maps"
+	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/hailam/genfile/internal/ports"
 )
@@ -13,6 +18,7 @@ import (
 type FileService struct {
 	factory ports.GeneratorFactory
 	parser  ports.SizeParser
+	fs      ports.OutputFS
 }
 
 // NewFileService constructs a FileService with the given factory and parser.
@@ -20,78 +26,733 @@ func NewFileService(factory ports.GeneratorFactory, parser ports.SizeParser) *Fi
 	return &FileService{factory: factory, parser: parser}
 }
 
+// WithOutputFS returns a copy of the service writing the files it writes
+// itself, such as throttled files and split parts, on fsys. Generators
+// write on the file system their factory hands them out with.
+func (s *FileService) WithOutputFS(fsys ports.OutputFS) *FileService {
+	c := *s
+	c.fs = fsys
+	return &c
+}
+
+// create creates or truncates the file at path on the service's file
+// system, the operating system's unless WithOutputFS set another.
+func (s *FileService) create(path string) (ports.OutputFile, error) {
+	if s.fs == nil {
+		return os.Create(path)
+	}
+	return s.fs.Create(path)
+}
+
+// attrs returns what reports and sets the attributes of the files the
+// service writes: its file system if it can (ports.AttrFS), the operating
+// system otherwise.
+func (s *FileService) attrs() fileAttrs {
+	if a, ok := s.fs.(ports.AttrFS); ok {
+		return a
+	}
+	return osAttrs{}
+}
+
+// fileAttrs reports and sets the attributes of files, as ports.AttrFS
+// does.
+type fileAttrs interface {
+	Stat(path string) (fs.FileInfo, error)
+	Chtimes(path string, atime, mtime time.Time) error
+	Chmod(path string, mode fs.FileMode) error
+	Chown(path string, uid, gid int) error
+}
+
+// osAttrs are the attributes of files on the operating system's file
+// system.
+type osAttrs struct{}
+
+func (osAttrs) Stat(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (osAttrs) Chtimes(path string, atime, mtime time.Time) error {
+	return os.Chtimes(path, atime, mtime)
+}
+
+func (osAttrs) Chmod(path string, mode fs.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+func (osAttrs) Chown(path string, uid, gid int) error {
+	return os.Chown(path, uid, gid)
+}
+
+// renames returns what the service writes files through on their way into
+// place: its file system if it can (ports.RenameFS), the operating system
+// otherwise.
+func (s *FileService) renames() fileRenames {
+	if r, ok := s.fs.(ports.RenameFS); ok {
+		return r
+	}
+	return osRenames{}
+}
+
+// fileRenames makes temporary directories and moves and removes files,
+// as ports.RenameFS does.
+type fileRenames interface {
+	MkdirTempIn(dir, pattern string) (string, error)
+	Lstat(path string) (fs.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	Remove(path string) error
+	RemoveAll(path string) error
+}
+
+// osRenames are the renames of files on the operating system's file
+// system.
+type osRenames struct{}
+
+func (osRenames) MkdirTempIn(dir, pattern string) (string, error) {
+	return os.MkdirTemp(dir, pattern)
+}
+
+func (osRenames) Lstat(path string) (fs.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+func (osRenames) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osRenames) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (osRenames) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
 // CreateFile generates a file at outPath of size sizeSpec (e.g., "10MB").
 // It parses the size, infers the file type from the extension, looks up the
 // appropriate generator, and runs it.
 func (s *FileService) CreateFile(outPath, sizeSpec string) error {
-	// 1. Parse human-readable size into bytes
-	sizeBytes, err := s.parser.Parse(sizeSpec)
+	return s.CreateFileWithOptions(outPath, sizeSpec, nil)
+}
+
+// CreateFileWithOptions is like CreateFile but forwards generator-specific
+// options. Options are rejected for generators that do not accept them.
+func (s *FileService) CreateFileWithOptions(outPath, sizeSpec string, opts ports.Options) error {
+	_, err := s.Create(FileRequest{Path: outPath, SizeSpec: sizeSpec, Options: opts})
+	return err
+}
+
+// FileRequest describes a file to generate and the targets it must meet.
+// At least one of SizeSpec, Lines, Duration, Count and Resolution is
+// required; when both SizeSpec and Lines are set the file has exactly that
+// many lines and bytes. Duration, Count and Resolution replace SizeSpec,
+// the size following from them, bounded by MaxSize if set.
+type FileRequest struct {
+	Path     string
+	Type     string // format as a file extension (e.g. "csv"); overrides the extension of Path
+	MIME     string // format as a MIME type (e.g. "text/csv"), instead of Type
+	SizeSpec string // human-readable size (e.g. "10MB"); empty for no byte target
+	Lines    int64  // number of lines (rows, records); 0 for no line target
+	Options  ports.Options
+
+	// Duration is the playback length of an audio or video file (e.g.
+	// "30s"), instead of SizeSpec: the size follows from the codec
+	// parameters. Only generators implementing ports.DurationGenerator
+	// support it.
+	Duration string
+	// Count is the number of pages, rows or slides of a document, instead
+	// of SizeSpec: the size follows from the content. Only generators
+	// implementing ports.CountGenerator support it.
+	Count ports.Count
+	// Resolution is the pixel dimensions of an image as WIDTHxHEIGHT (e.g.
+	// "4000x3000"), instead of SizeSpec: the size follows from the
+	// encoding. Only generators implementing ports.ResolutionGenerator
+	// support it.
+	Resolution string
+	// MaxSize bounds the size a Duration, Count or Resolution comes to
+	// (e.g. "20MB"); a file that would be larger is an error.
+	MaxSize string
+	// TargetChecksum makes the file's checksum a given value, as
+	// ALGORITHM:HEX (e.g. "crc32:deadbeef"; crc32, crc32c or crc32k), by
+	// rewriting the free bytes it ends in. Only generators implementing
+	// ports.FreeTailGenerator support it.
+	TargetChecksum string
+
+	// Strict makes any difference between the generated and the requested
+	// size an error. Without Strict or Tolerance the size is not checked.
+	Strict bool
+	// Tolerance is the largest accepted size difference (e.g. "16B"). If
+	// the generator cannot produce the exact size, nearby sizes within the
+	// tolerance are tried.
+	Tolerance string
+	// Throttle limits how fast the file is written (e.g. "10MB/s"), to
+	// simulate a slow producer. Empty means no limit.
+	Throttle string
+	// Allocation, unless ports.AllocateWrite, creates the file with its
+	// payload left as a sparse hole or preallocated but unwritten. Only
+	// generators implementing ports.AllocatingGenerator support it.
+	Allocation ports.Allocation
+	// Metadata is written into the file's native properties (PDF Info,
+	// PNG text chunks, ...). Only generators implementing
+	// ports.MetadataCapable support it.
+	Metadata ports.Metadata
+	// MTime, if set, is the file's modification time (e.g.
+	// "2020-01-01T00:00:00Z"). Generators that accept options also get it
+	// as the "mtime" option for the timestamps inside the file.
+	MTime string
+	// InPlace has the file written straight to Path. Otherwise it is
+	// written to a temporary file next to Path and renamed over it once
+	// complete, so that Path never holds a partial file. Either way a
+	// failed file is removed.
+	InPlace bool
+	// Mode, if set, is the file's permissions in octal (e.g. "0600").
+	Mode string
+	// Owner and Group, if set, own the file, by name or numeric ID.
+	// Changing them takes privileges, and is not supported on Windows.
+	Owner string
+	Group string
+	// Resume writes the file as Path plus ".genfile-partial", keeping its
+	// progress in Path plus ".genfile-resume", and renames it into place
+	// once complete. A failed file is kept, and a later request for the
+	// same file carries on from where it stopped. It needs a size, and
+	// only generators implementing ports.ResumableGenerator support it.
+	Resume bool
+	// Sidecar writes a JSON descriptor of the file next to it once it is
+	// created, at SidecarPath(Path): its type, sizes, options, checksums
+	// and the ground truth planted in it.
+	Sidecar bool
+}
+
+// FileResult reports what Create produced.
+type FileResult struct {
+	Path       string
+	Type       ports.FileType
+	Size       int64 // actual size in bytes; ports.AnySize if the file could not be inspected
+	TargetSize int64 // requested size in bytes, or ports.AnySize
+	Lines      int64
+	// Companions are the other files of a multi-file format (see
+	// ports.SetGenerator), with their actual sizes.
+	Companions []FileResult
+	// WholeSet is set when the target size applies to the file and its
+	// companions together (see ports.WholeSetGenerator).
+	WholeSet bool
+	// Stats are the figures the generator reported, if it implements
+	// ports.StatsGenerator.
+	Stats ports.Stats
+	// Sidecar is the path of the JSON descriptor written for
+	// FileRequest.Sidecar, if any.
+	Sidecar string
+}
+
+// Paths returns the path of the file and of its companions.
+func (r FileResult) Paths() []string {
+	paths := []string{r.Path}
+	for _, c := range r.Companions {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+// Deviation returns how many bytes the file, with its companions for a
+// whole set, is larger (positive) or smaller (negative) than requested; 0
+// without a size target.
+func (r FileResult) Deviation() int64 {
+	if r.TargetSize == ports.AnySize || r.Size == ports.AnySize {
+		return 0
+	}
+	size := r.Size
+	if r.WholeSet {
+		for _, c := range r.Companions {
+			if c.Size == ports.AnySize {
+				return 0
+			}
+			size += c.Size
+		}
+	}
+	return size - r.TargetSize
+}
+
+// Create generates the file described by req. Line targets are only
+// accepted by generators implementing ports.LineGenerator.
+func (s *FileService) Create(req FileRequest) (FileResult, error) {
+	req, err := resolveMIME(req)
 	if err != nil {
-		return fmt.Errorf("invalid size '%s': %w", sizeSpec, err)
+		return FileResult{Path: req.Path, Size: ports.AnySize, TargetSize: ports.AnySize, Lines: req.Lines}, err
+	}
+	if req.Sidecar {
+		return s.createWithSidecar(req)
+	}
+	if req.Resume {
+		return s.createResumable(req)
+	}
+	if req.Allocation != ports.AllocateWrite {
+		if err := checkAllocation(req); err != nil {
+			return FileResult{Path: req.Path, Size: ports.AnySize, TargetSize: ports.AnySize, Lines: req.Lines}, err
+		}
+	}
+	if req.Throttle != "" {
+		return s.createThrottled(req)
+	}
+	result := FileResult{Path: req.Path, Size: ports.AnySize, TargetSize: ports.AnySize, Lines: req.Lines}
+	if err := checkTargets(req); err != nil {
+		return result, err
+	}
+	if req.Lines < 0 {
+		return result, fmt.Errorf("invalid line count %d", req.Lines)
+	}
+	if req.Strict && req.Tolerance != "" {
+		return result, fmt.Errorf("strict and tolerance cannot be combined")
 	}
 
-	// 2. Determine file type from extension
-	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(outPath), "."))
-	fileType, err := mapExtensionToFileType(ext)
+	// 1. Parse human-readable size and tolerance into bytes
+	if req.SizeSpec != "" {
+		var err error
+		if result.TargetSize, err = s.parser.Parse(req.SizeSpec); err != nil {
+			return result, fmt.Errorf("invalid size '%s': %w", req.SizeSpec, err)
+		}
+	}
+	var maxSize int64
+	if req.MaxSize != "" {
+		var err error
+		if maxSize, err = s.parser.Parse(req.MaxSize); err != nil {
+			return result, fmt.Errorf("invalid maximum size '%s': %w", req.MaxSize, err)
+		}
+	}
+	var crcTarget checksumTarget
+	if req.TargetChecksum != "" {
+		if req.Lines > 0 {
+			return result, fmt.Errorf("a checksum target cannot be combined with a line count")
+		}
+		var err error
+		if crcTarget, err = parseChecksumTarget(req.TargetChecksum); err != nil {
+			return result, err
+		}
+	}
+	checkSize := req.Strict
+	var tolerance int64
+	if req.Tolerance != "" {
+		var err error
+		if tolerance, err = s.parser.Parse(req.Tolerance); err != nil {
+			return result, fmt.Errorf("invalid tolerance '%s': %w", req.Tolerance, err)
+		}
+		if tolerance < 0 {
+			return result, fmt.Errorf("tolerance must not be negative, got %d", tolerance)
+		}
+		checkSize = true
+	}
+	mtime, err := parseMTime(req.MTime)
+	if err != nil {
+		return result, err
+	}
+	perms, err := parsePermissions(req)
+	if err != nil {
+		return result, err
+	}
+
+	// 2. Determine file type from extension and retrieve its generator
+	fileType, generator, err := s.generatorFor(req.Path, req.Type)
+	result.Type = fileType
+	if err != nil {
+		return result, err
+	}
+	if generator, err = withMetadata(fileType, generator, req.Metadata); err != nil {
+		return result, err
+	}
+	if generator, err = withOptions(fileType, generator, req.Options); err != nil {
+		return result, err
+	}
+	if req.sizedByExtent() {
+		// Extents are resolved with the options the generator holds, so the
+		// modification time goes in among them.
+		if generator, err = withOptions(fileType, generator, withModTime(generator, nil, mtime)); err != nil {
+			return result, err
+		}
+		if generator, result.TargetSize, err = forTarget(fileType, generator, req); err != nil {
+			return result, err
+		}
+		if req.MaxSize != "" && result.TargetSize > maxSize {
+			return result, fmt.Errorf("the %s would be %d bytes, more than the maximum of %d", fileType, result.TargetSize, maxSize)
+		}
+	}
+	var tailer ports.FreeTailGenerator
+	if req.TargetChecksum != "" {
+		var ok bool
+		if tailer, ok = ports.As[ports.FreeTailGenerator](generator); !ok {
+			return result, fmt.Errorf("generator for type '%s' does not support checksum targets", fileType)
+		}
+	}
+	if sg, ok := ports.As[ports.StatsGenerator](generator); ok {
+		result.Stats = ports.Stats{}
+		generator = sg.WithStats(result.Stats)
+	}
+	opts := withModTime(generator, req.Options, mtime)
+
+	// 3. Invoke the generator, falling back to sizes within the tolerance
+	out, err := newOutput(s.renames(), req.Path, req.InPlace)
+	if err != nil {
+		return result, err
+	}
+	var set []string // files written by a ports.SetGenerator
+	generate := func(sizeBytes int64) (err error) {
+		sg, isSet := ports.As[ports.SetGenerator](generator)
+		switch {
+		case req.Allocation != ports.AllocateWrite:
+			ag, ok := ports.As[ports.AllocatingGenerator](generator)
+			if !ok {
+				return fmt.Errorf("generator for type '%s' does not support %s files", fileType, req.Allocation)
+			}
+			return ag.GenerateAllocated(out.path, sizeBytes, req.Allocation, opts)
+		case req.Lines > 0:
+			lg, ok := ports.As[ports.LineGenerator](generator)
+			if !ok {
+				return fmt.Errorf("generator for type '%s' does not support line counts", fileType)
+			}
+			return lg.GenerateLines(out.path, sizeBytes, req.Lines, opts)
+		case isSet && len(opts) > 0:
+			sog, ok := ports.As[ports.SetOptionsGenerator](generator)
+			if !ok {
+				return fmt.Errorf("generator for type '%s' does not accept options", fileType)
+			}
+			set, err = sog.GenerateSetWithOptions(out.path, sizeBytes, opts)
+			return err
+		case isSet:
+			set, err = sg.GenerateSet(out.path, sizeBytes)
+			return err
+		case len(opts) > 0:
+			og, ok := ports.As[ports.OptionsGenerator](generator)
+			if !ok {
+				return fmt.Errorf("generator for type '%s' does not accept options", fileType)
+			}
+			return og.GenerateWithOptions(out.path, sizeBytes, opts)
+		default:
+			return generator.Generate(out.path, sizeBytes)
+		}
+	}
+	err = generate(result.TargetSize)
+	if err != nil && tolerance > 0 && result.TargetSize != ports.AnySize {
+		for _, d := range toleranceOffsets(tolerance) {
+			if size := result.TargetSize + d; size >= 0 && generate(size) == nil {
+				err = nil
+				break
+			}
+		}
+	}
+	if err != nil {
+		out.discard(set)
+		return result, fmt.Errorf("failed to generate %s: %w", req.Path, err)
+	}
+	if tailer != nil {
+		info, err := s.attrs().Stat(out.path)
+		if err == nil {
+			n, alphabet := tailer.FreeTail(info.Size(), opts)
+			err = forceChecksum(out.path, crcTarget, n, alphabet)
+		}
+		if err != nil {
+			out.discard(set)
+			return result, fmt.Errorf("cannot give %s checksum %s: %w", req.Path, req.TargetChecksum, err)
+		}
+	}
+	var companions []string
+	for _, path := range set {
+		if path != out.path {
+			companions = append(companions, path)
+		}
+	}
+	if !mtime.IsZero() {
+		for _, path := range append([]string{out.path}, companions...) {
+			if err := s.attrs().Chtimes(path, mtime, mtime); err != nil {
+				out.discard(companions)
+				return result, fmt.Errorf("failed to set the modification time of %s: %w", out.finalPath(path), err)
+			}
+		}
+	}
+	for _, path := range append([]string{out.path}, companions...) {
+		if err := perms.apply(s.attrs(), path, out.finalPath(path)); err != nil {
+			out.discard(companions)
+			return result, err
+		}
+	}
+	for _, path := range companions {
+		c := FileResult{Path: out.finalPath(path), Type: fileType, Size: ports.AnySize, TargetSize: ports.AnySize}
+		if info, err := s.attrs().Stat(path); err == nil {
+			c.Size = info.Size()
+		}
+		result.Companions = append(result.Companions, c)
+	}
+
+	if wg, ok := ports.As[ports.WholeSetGenerator](generator); ok {
+		result.WholeSet = wg.SizesWholeSet()
+	}
+
+	// 4. Report the actual size and hold it to the requested bound
+	info, statErr := s.attrs().Stat(out.path)
+	if statErr == nil {
+		result.Size = info.Size()
+	}
+	if err := checkResultSize(result, req, checkSize, tolerance, statErr); err != nil {
+		out.discard(companions)
+		return result, err
+	}
+	return result, out.commit(append([]string{out.path}, companions...))
+}
+
+// checkResultSize holds the size of the generated file to the requested
+// bound, if checkSize.
+func checkResultSize(result FileResult, req FileRequest, checkSize bool, tolerance int64, statErr error) error {
+	if !checkSize || result.TargetSize == ports.AnySize {
+		return nil
+	}
+	if statErr != nil {
+		return fmt.Errorf("failed to check size of %s: %w", req.Path, statErr)
+	}
+	if d := result.Deviation(); d < -tolerance || d > tolerance {
+		if req.Strict {
+			return fmt.Errorf("generated %s is %d bytes, want exactly %d", req.Path, result.TargetSize+d, result.TargetSize)
+		}
+		return fmt.Errorf("generated %s is %d bytes, more than %d bytes from the target %d", req.Path, result.TargetSize+d, tolerance, result.TargetSize)
+	}
+	return nil
+}
+
+// Plan describes the file CreateFile would write at outPath for sizeSpec,
+// without writing it. Only generators implementing ports.Planner can be
+// planned.
+func (s *FileService) Plan(outPath, sizeSpec string) (ports.GenerationPlan, error) {
+	size, err := s.parser.Parse(sizeSpec)
+	if err != nil {
+		return ports.GenerationPlan{}, fmt.Errorf("invalid size '%s': %w", sizeSpec, err)
+	}
+	fileType, generator, err := s.generatorFor(outPath, "")
+	if err != nil {
+		return ports.GenerationPlan{}, err
+	}
+	planner, ok := ports.As[ports.Planner](generator)
+	if !ok {
+		return ports.GenerationPlan{}, fmt.Errorf("generator for type '%s' cannot estimate its output", fileType)
+	}
+	plan, err := planner.Plan(size)
 	if err != nil {
-		return err
+		return plan, fmt.Errorf("failed to plan %s: %w", outPath, err)
 	}
+	return plan, nil
+}
 
-	// 3. Retrieve the generator for this type
+// generatorFor infers the file type from ext, or from the extension of
+// path if ext is empty, and looks up its generator.
+func (s *FileService) generatorFor(path, ext string) (ports.FileType, ports.FileGenerator, error) {
+	if ext == "" {
+		ext = filepath.Ext(path)
+	}
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	fileType, err := mapExtensionToFileType(ext)
+	if err != nil {
+		return "", nil, err
+	}
 	generator, err := s.factory.For(fileType)
 	if err != nil {
-		return fmt.Errorf("no generator for type '%s': %w", fileType, err)
+		return fileType, nil, fmt.Errorf("no generator for type '%s': %w", fileType, err)
 	}
+	return fileType, generator, nil
+}
 
-	// 4. Invoke the generator
-	if err := generator.Generate(outPath, sizeBytes); err != nil {
-		return fmt.Errorf("failed to generate %s: %w", outPath, err)
+// createThrottled writes req.Path through Stream, which paces the output.
+func (s *FileService) createThrottled(req FileRequest) (FileResult, error) {
+	result := FileResult{Path: req.Path, Size: ports.AnySize, TargetSize: ports.AnySize}
+	if _, err := s.parseRate(req.Throttle); err != nil {
+		return result, err
+	}
+	perms, err := parsePermissions(req)
+	if err != nil {
+		return result, err
+	}
+	out, err := newOutput(s.renames(), req.Path, req.InPlace)
+	if err != nil {
+		return result, err
+	}
+	f, err := s.create(out.path)
+	if err != nil {
+		return result, fmt.Errorf("failed to create %s: %w", req.Path, err)
+	}
+	result, err = s.Stream(f, req)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write %s: %w", req.Path, closeErr)
+	}
+	if mtime, _ := parseMTime(req.MTime); err == nil && !mtime.IsZero() {
+		if err = s.attrs().Chtimes(out.path, mtime, mtime); err != nil {
+			err = fmt.Errorf("failed to set the modification time of %s: %w", req.Path, err)
+		}
+	}
+	if err == nil {
+		err = perms.apply(s.attrs(), out.path, req.Path)
+	}
+	if err != nil {
+		out.discard(nil)
+		return result, err
+	}
+	return result, out.commit([]string{out.path})
+}
+
+// parseMTime parses a FileRequest.MTime; the zero time means unset.
+func parseMTime(spec string) (time.Time, error) {
+	if spec == "" {
+		return time.Time{}, nil
+	}
+	t, err := ports.ParseTime(spec)
+	if err != nil {
+		return t, fmt.Errorf("invalid mtime '%s': %w", spec, err)
+	}
+	return t, nil
+}
+
+// withOptions returns generator configured with opts, so that invalid
+// options are reported before anything is written. Generators that accept
+// options but cannot be configured get them with each call instead.
+func withOptions(fileType ports.FileType, generator ports.FileGenerator, opts ports.Options) (ports.FileGenerator, error) {
+	if len(opts) == 0 {
+		return generator, nil
+	}
+	if cg, ok := ports.As[ports.ConfigurableGenerator](generator); ok {
+		configured, err := cg.Configure(opts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid options for type '%s': %w", fileType, err)
+		}
+		return configured, nil
+	}
+	if _, ok := ports.As[ports.OptionsGenerator](generator); !ok {
+		return nil, fmt.Errorf("generator for type '%s' does not accept options", fileType)
+	}
+	return generator, nil
+}
+
+// withModTime returns opts plus the "mtime" option set to t, if t is set
+// and generator accepts options; opts itself is not modified.
+func withModTime(generator ports.FileGenerator, opts ports.Options, t time.Time) ports.Options {
+	if _, ok := ports.As[ports.OptionsGenerator](generator); !ok || t.IsZero() {
+		return opts
+	}
+	out := maps.Clone(opts)
+	if out == nil {
+		out = ports.Options{}
+	}
+	out["mtime"] = t.Format(time.RFC3339Nano)
+	return out
+}
+
+// checkAllocation rejects requests that cannot be combined with a sparse
+// or preallocated file.
+func checkAllocation(req FileRequest) error {
+	switch req.Allocation {
+	case ports.AllocateSparse, ports.AllocatePreallocate:
+	default:
+		return fmt.Errorf("unknown allocation mode '%s' (want sparse or preallocate)", req.Allocation)
+	}
+	if req.SizeSpec == "" || req.Lines > 0 {
+		return fmt.Errorf("%s files need a size and no line count", req.Allocation)
+	}
+	if req.Throttle != "" {
+		return fmt.Errorf("%s files cannot be throttled", req.Allocation)
 	}
 	return nil
 }
 
+// Capabilities reports the optional features of the generator for
+// fileType.
+func (s *FileService) Capabilities(fileType string) (ports.Capabilities, error) {
+	_, generator, err := s.generatorFor("", fileType)
+	if err != nil {
+		return ports.Capabilities{}, err
+	}
+	return ports.CapabilitiesOf(generator), nil
+}
+
+// parseRate parses a throughput such as "10MB/s" (the "/s" is optional)
+// into bytes per second.
+func (s *FileService) parseRate(spec string) (int64, error) {
+	size := strings.TrimSuffix(strings.TrimSuffix(spec, "/s"), "/S")
+	rate, err := s.parser.Parse(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid throttle '%s': %w", spec, err)
+	}
+	if rate <= 0 {
+		return 0, fmt.Errorf("throttle must be positive, got '%s'", spec)
+	}
+	return rate, nil
+}
+
+// toleranceOffsets lists the size adjustments tried when the exact size
+// fails, nearest first: ±1, ±2, ±4, ... and finally ±tolerance.
+func toleranceOffsets(tolerance int64) []int64 {
+	var offsets []int64
+	step := int64(1)
+	for ; step < tolerance; step *= 2 {
+		offsets = append(offsets, step, -step)
+	}
+	return append(offsets, tolerance, -tolerance)
+}
+
+// fileTypeExtensions lists the extensions each FileType is generated
+// for, the usual one first.
+var fileTypeExtensions = map[ports.FileType][]string{
+	ports.FileTypeTXT:    {"txt", "text"},
+	ports.FileTypePNG:    {"png"},
+	ports.FileTypeJPEG:   {"jpg", "jpeg"},
+	ports.FileTypeMP4:    {"mp4"},
+	ports.FileTypeM4V:    {"m4v"},
+	ports.FileTypeWAV:    {"wav"},
+	ports.FileTypeDWG:    {"dwg"},
+	ports.FileTypeDXF:    {"dxf"},
+	ports.FileTypeZIP:    {"zip"},
+	ports.FileTypeXLSX:   {"xlsx"},
+	ports.FileTypeDOCX:   {"docx"},
+	ports.FileTypePDF:    {"pdf"},
+	ports.FileTypeCSV:    {"csv"},
+	ports.FileTypeJSON:   {"json"},
+	ports.FileTypeHTML:   {"html"},
+	ports.FileTypeMD:     {"md"},
+	ports.FileTypeLog:    {"log"},
+	ports.FileTypeXML:    {"xml"},
+	ports.FileTypeGIF:    {"gif"},
+	ports.FileTypeTIFF:   {"tif", "tiff"},
+	ports.FileTypeNDJSON: {"ndjson", "jsonl"},
+	ports.FileTypeBIN:    {"bin", "dat", "img"},
+	ports.FileTypeSHP:    {"shp"},
+	ports.FileTypePSD:    {"psd"},
+	ports.FileTypeAI:     {"ai"},
+	ports.FileTypeFWF:    {"fwf"},
+	ports.FileTypeEDI:    {"edi", "x12", "edifact"},
+	ports.FileTypeHL7:    {"hl7"},
+	ports.FileTypeJP2:    {"jp2"},
+	ports.FileTypeDJVU:   {"djvu", "djv"},
+	ports.FileTypeOCI:    {"oci"},
+	ports.FileTypeDEB:    {"deb"},
+	ports.FileTypeRPM:    {"rpm"},
+	ports.FileTypeJAR:    {"jar"},
+	ports.FileTypeWAR:    {"war"},
+	ports.FileTypeAPK:    {"apk"},
+	ports.FileTypeNPM:    {"tgz", "npm"},
+	ports.FileTypeWHL:    {"whl"},
+	ports.FileTypePEM:    {"pem"},
+	ports.FileTypeCRT:    {"crt"},
+	ports.FileTypeKEY:    {"key"},
+	ports.FileTypeDER:    {"der", "cer"},
+	ports.FileTypeREG:    {"reg"},
+	ports.FileTypeINI:    {"ini"},
+	ports.FileTypePS:     {"ps"},
+	ports.FileTypeXPS:    {"xps"},
+	ports.FileTypeMDB:    {"mdb"},
+	ports.FileTypeACCDB:  {"accdb"},
+	ports.FileTypeCFB:    {"cfb"},
+	ports.FileTypeSRT:    {"srt"},
+	ports.FileTypeVTT:    {"vtt"},
+	ports.FileTypeM3U8:   {"m3u8"},
+	ports.FileTypeMPD:    {"mpd"},
+}
+
 // mapExtensionToFileType maps file extensions to FileType constants.
 func mapExtensionToFileType(ext string) (ports.FileType, error) {
-	switch ext {
-	case "txt", "text":
-		return ports.FileTypeTXT, nil
-	case "png":
-		return ports.FileTypePNG, nil
-	case "jpg", "jpeg":
-		return ports.FileTypeJPEG, nil
-	case "mp4":
-		return ports.FileTypeMP4, nil
-	case "m4v":
-		return ports.FileTypeM4V, nil
-	case "wav":
-		return ports.FileTypeWAV, nil
-	case "dwg":
-		return ports.FileTypeDWG, nil
-	case "dxf":
-		return ports.FileTypeDXF, nil
-	case "zip":
-		return ports.FileTypeZIP, nil
-	case "xlsx":
-		return ports.FileTypeXLSX, nil
-	case "docx":
-		return ports.FileTypeDOCX, nil
-	case "pdf":
-		return ports.FileTypePDF, nil
-	case "csv":
-		return ports.FileTypeCSV, nil
-	case "json":
-		return ports.FileTypeJSON, nil
-	case "html":
-		return ports.FileTypeHTML, nil
-	case "md":
-		return ports.FileTypeMD, nil
-	case "log":
-		return ports.FileTypeLog, nil
-	case "xml":
-		return ports.FileTypeXML, nil
-	case "gif":
-		return ports.FileTypeGIF, nil
-	default:
-		return "", fmt.Errorf("unsupported file extension: %s", ext)
+	for t, exts := range fileTypeExtensions {
+		if slices.Contains(exts, ext) {
+			return t, nil
+		}
 	}
+	return "", fmt.Errorf("unsupported file extension: %s", ext)
 }
@@ -3,10 +3,16 @@ package application
 import (
 	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hailam/genfile/internal/ports" //
 )
@@ -76,6 +82,17 @@ func (m *MockGeneratorFactory) For(t ports.FileType) (ports.FileGenerator, error
 	}
 }
 
+func (m *MockGeneratorFactory) ForOptions(t ports.FileType, opts ports.Options) (ports.FileGenerator, error) {
+	gen, err := m.For(t)
+	if err != nil || len(opts) == 0 {
+		return gen, err
+	}
+	if cg, ok := gen.(ports.ConfigurableGenerator); ok {
+		return cg.Configure(opts)
+	}
+	return nil, fmt.Errorf("mock factory error: type %s does not accept options", t)
+}
+
 // --- Test Cases ---
 
 func TestFileService_CreateFile(t *testing.T) {
@@ -110,8 +127,9 @@ func TestFileService_CreateFile(t *testing.T) {
 				if mg.CalledWithSize != 10*1024 {
 					t.Errorf("Generate called with size %d, want %d", mg.CalledWithSize, 10*1024)
 				}
-				if mg.CalledWithPath != filepath.Join(tempDir, "test.txt") {
-					t.Errorf("Generate called with path %q, want %q", mg.CalledWithPath, filepath.Join(tempDir, "test.txt"))
+				// The file is generated next to its path, then renamed.
+				if p := mg.CalledWithPath; filepath.Dir(filepath.Dir(p)) != tempDir || filepath.Base(p) != "test.txt" || p == filepath.Join(tempDir, "test.txt") {
+					t.Errorf("Generate called with path %q, want test.txt in a temporary directory in %q", p, tempDir)
 				}
 			},
 		},
@@ -311,3 +329,809 @@ func contains(s, substr string) bool {
 	return len(s) >= len(substr) && s[len(s)-len(substr):] == substr || // Check suffix first for common errors
 		strings.Contains(s, substr) // Fallback to general contains
 }
+
+// MockOptionsGenerator is a mock for ports.OptionsGenerator
+type MockOptionsGenerator struct {
+	MockFileGenerator
+	CalledWithOptions ports.Options
+}
+
+func (m *MockOptionsGenerator) GenerateWithOptions(outPath string, sizeBytes int64, opts ports.Options) error {
+	m.CalledWithOptions = opts
+	return m.Generate(outPath, sizeBytes)
+}
+
+func TestFileService_CreateFileWithOptions(t *testing.T) {
+	tempDir := t.TempDir()
+	opts := ports.Options{"zip-password": "secret"}
+
+	t.Run("Options forwarded", func(t *testing.T) {
+		mockGen := &MockOptionsGenerator{}
+		factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return mockGen, nil }}
+		service := NewFileService(factory, &MockSizeParser{})
+
+		if err := service.CreateFileWithOptions(filepath.Join(tempDir, "a.zip"), "10KB", opts); err != nil {
+			t.Fatalf("CreateFileWithOptions() unexpected error = %v", err)
+		}
+		if mockGen.CalledWithOptions["zip-password"] != "secret" {
+			t.Errorf("options not forwarded, got %v", mockGen.CalledWithOptions)
+		}
+	})
+
+	t.Run("Options rejected by plain generator", func(t *testing.T) {
+		mockGen := &MockFileGenerator{}
+		factory := &MockGeneratorFactory{MockGenerator: mockGen}
+		service := NewFileService(factory, &MockSizeParser{})
+
+		err := service.CreateFileWithOptions(filepath.Join(tempDir, "a.txt"), "10KB", opts)
+		if err == nil || !strings.Contains(err.Error(), "does not accept options") {
+			t.Errorf("CreateFileWithOptions() error = %v, want 'does not accept options'", err)
+		}
+		if mockGen.GenerateCalled {
+			t.Errorf("Expected Generate NOT to be called when options are rejected")
+		}
+	})
+}
+
+// MockConfigurableGenerator is a mock for ports.ConfigurableGenerator that
+// rejects the option "bad".
+type MockConfigurableGenerator struct {
+	MockOptionsGenerator
+	Configured ports.Options
+}
+
+func (m *MockConfigurableGenerator) Configure(opts ports.Options) (ports.FileGenerator, error) {
+	if opts.Has("bad") {
+		return nil, fmt.Errorf("bad option")
+	}
+	m.Configured = opts
+	return m, nil
+}
+
+func TestFileService_CreateConfigured(t *testing.T) {
+	tempDir := t.TempDir()
+	mockGen := &MockConfigurableGenerator{}
+	factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return mockGen, nil }}
+	service := NewFileService(factory, &MockSizeParser{})
+
+	if _, err := service.Create(FileRequest{Path: filepath.Join(tempDir, "a.png"), SizeSpec: "10KB", Options: ports.Options{"width": "10"}}); err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+	if mockGen.Configured["width"] != "10" {
+		t.Errorf("generator configured with %v, want width 10", mockGen.Configured)
+	}
+
+	mockGen.GenerateCalled = false
+	_, err := service.Create(FileRequest{Path: filepath.Join(tempDir, "b.png"), SizeSpec: "10KB", Options: ports.Options{"bad": "1"}})
+	if err == nil || !strings.Contains(err.Error(), "invalid options for type 'png'") {
+		t.Errorf("Create() with a bad option error = %v, want invalid options", err)
+	}
+	if mockGen.GenerateCalled {
+		t.Error("Expected Generate NOT to be called when the options are invalid")
+	}
+}
+
+// MockLineGenerator is a mock for ports.LineGenerator
+type MockLineGenerator struct {
+	MockFileGenerator
+	CalledWithLines int64
+}
+
+func (m *MockLineGenerator) GenerateLines(outPath string, sizeBytes, lines int64, opts ports.Options) error {
+	m.CalledWithLines = lines
+	return m.Generate(outPath, sizeBytes)
+}
+
+func TestFileService_Create(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		req       FileRequest
+		wantSize  int64
+		wantLines int64
+		errSub    string
+	}{
+		{"Lines only", FileRequest{Path: filepath.Join(tempDir, "a.txt"), Lines: 1000}, ports.AnySize, 1000, ""},
+		{"Lines and size", FileRequest{Path: filepath.Join(tempDir, "a.txt"), SizeSpec: "10KB", Lines: 10}, 10 * 1024, 10, ""},
+		{"Size only", FileRequest{Path: filepath.Join(tempDir, "a.txt"), SizeSpec: "1MB"}, 1024 * 1024, 0, ""},
+		{"No target", FileRequest{Path: filepath.Join(tempDir, "a.txt")}, 0, 0, "a size, a line count, a duration, a count of pages, rows or slides, or a resolution is required"},
+		{"Negative lines", FileRequest{Path: filepath.Join(tempDir, "a.txt"), Lines: -1}, 0, 0, "invalid line count"},
+		{"Bad size with lines", FileRequest{Path: filepath.Join(tempDir, "a.txt"), SizeSpec: "badsize", Lines: 1}, 0, 0, "invalid size"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockGen := &MockLineGenerator{}
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return mockGen, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+
+			_, err := service.Create(tc.req)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("Create() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			if mockGen.CalledWithSize != tc.wantSize || mockGen.CalledWithLines != tc.wantLines {
+				t.Errorf("generator called with size %d, lines %d; want %d, %d",
+					mockGen.CalledWithSize, mockGen.CalledWithLines, tc.wantSize, tc.wantLines)
+			}
+		})
+	}
+
+	t.Run("Lines rejected by plain generator", func(t *testing.T) {
+		mockGen := &MockFileGenerator{}
+		service := NewFileService(&MockGeneratorFactory{MockGenerator: mockGen}, &MockSizeParser{})
+
+		_, err := service.Create(FileRequest{Path: filepath.Join(tempDir, "a.png"), Lines: 5})
+		if err == nil || !strings.Contains(err.Error(), "does not support line counts") {
+			t.Errorf("Create() error = %v, want 'does not support line counts'", err)
+		}
+		if mockGen.GenerateCalled {
+			t.Errorf("Expected Generate NOT to be called when lines are rejected")
+		}
+	})
+}
+
+// MockAllocatingGenerator is a mock for ports.AllocatingGenerator
+type MockAllocatingGenerator struct {
+	MockFileGenerator
+	CalledWithMode ports.Allocation
+}
+
+func (m *MockAllocatingGenerator) GenerateAllocated(outPath string, sizeBytes int64, mode ports.Allocation, opts ports.Options) error {
+	m.CalledWithMode = mode
+	return m.Generate(outPath, sizeBytes)
+}
+
+func TestFileService_CreateAllocated(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "a.wav")
+
+	tests := []struct {
+		name   string
+		gen    ports.FileGenerator
+		req    FileRequest
+		errSub string
+	}{
+		{"Sparse", &MockAllocatingGenerator{}, FileRequest{Path: path, SizeSpec: "1MB", Allocation: ports.AllocateSparse}, ""},
+		{"Preallocate", &MockAllocatingGenerator{}, FileRequest{Path: path, SizeSpec: "1MB", Allocation: ports.AllocatePreallocate}, ""},
+		{"Unsupported generator", &MockFileGenerator{}, FileRequest{Path: path, SizeSpec: "1MB", Allocation: ports.AllocateSparse}, "does not support sparse files"},
+		{"Unknown mode", &MockAllocatingGenerator{}, FileRequest{Path: path, SizeSpec: "1MB", Allocation: "holes"}, "unknown allocation mode"},
+		{"With lines", &MockAllocatingGenerator{}, FileRequest{Path: path, SizeSpec: "1MB", Lines: 3, Allocation: ports.AllocateSparse}, "need a size and no line count"},
+		{"Throttled", &MockAllocatingGenerator{}, FileRequest{Path: path, SizeSpec: "1MB", Throttle: "1MB/s", Allocation: ports.AllocatePreallocate}, "cannot be throttled"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+
+			_, err := service.Create(tc.req)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("Create() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			mockGen := tc.gen.(*MockAllocatingGenerator)
+			if mockGen.CalledWithMode != tc.req.Allocation || mockGen.CalledWithSize != 1024*1024 {
+				t.Errorf("generator called with mode %q, size %d; want %q, %d",
+					mockGen.CalledWithMode, mockGen.CalledWithSize, tc.req.Allocation, 1024*1024)
+			}
+		})
+	}
+
+	t.Run("Capabilities", func(t *testing.T) {
+		factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return &MockAllocatingGenerator{}, nil }}
+		service := NewFileService(factory, &MockSizeParser{})
+		got, err := service.Capabilities("wav")
+		if err != nil {
+			t.Fatalf("Capabilities() unexpected error = %v", err)
+		}
+		if want := (ports.Capabilities{Allocate: true}); got != want {
+			t.Errorf("Capabilities() = %+v, want %+v", got, want)
+		}
+		if _, err := service.Capabilities("nope"); err == nil {
+			t.Error("Capabilities() of an unknown type succeeded")
+		}
+	})
+}
+
+func TestFileService_CreateMTime(t *testing.T) {
+	writeFile := func(outPath string, sizeBytes int64) error {
+		return os.WriteFile(outPath, make([]byte, sizeBytes), 0o644)
+	}
+	want := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		gen      ports.FileGenerator
+		req      FileRequest
+		wantOpts ports.Options // for MockOptionsGenerator
+		errSub   string
+	}{
+		{name: "Plain generator", gen: &MockFileGenerator{GenerateFunc: writeFile}, req: FileRequest{SizeSpec: "10KB", MTime: "2020-01-01T00:00:00Z"}},
+		{name: "Date only", gen: &MockFileGenerator{GenerateFunc: writeFile}, req: FileRequest{SizeSpec: "10KB", MTime: "2020-01-01"}},
+		{
+			name:     "Forwarded as an option",
+			gen:      &MockOptionsGenerator{MockFileGenerator: MockFileGenerator{GenerateFunc: writeFile}},
+			req:      FileRequest{SizeSpec: "10KB", MTime: "2020-01-01T01:00:00+01:00", Options: ports.Options{"width": "10"}},
+			wantOpts: ports.Options{"width": "10", "mtime": "2020-01-01T01:00:00+01:00"},
+		},
+		{name: "Throttled", gen: &MockStreamGenerator{}, req: FileRequest{SizeSpec: "10KB", MTime: "2020-01-01T00:00:00Z", Throttle: "1MB/s"}},
+		{name: "Invalid", gen: &MockFileGenerator{GenerateFunc: writeFile}, req: FileRequest{SizeSpec: "10KB", MTime: "yesterday"}, errSub: "invalid mtime 'yesterday'"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+			tc.req.Path = filepath.Join(t.TempDir(), "a.txt")
+
+			_, err := service.Create(tc.req)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("Create() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			info, err := os.Stat(tc.req.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(want) {
+				t.Errorf("modification time = %v, want %v", info.ModTime(), want)
+			}
+			if og, ok := tc.gen.(*MockOptionsGenerator); ok && !maps.Equal(og.CalledWithOptions, tc.wantOpts) {
+				t.Errorf("options = %v, want %v", og.CalledWithOptions, tc.wantOpts)
+			}
+			if tc.req.Options != nil && tc.req.Options.Has("mtime") {
+				t.Errorf("request options were modified: %v", tc.req.Options)
+			}
+		})
+	}
+}
+
+func TestFileService_CreateTolerance(t *testing.T) {
+	tempDir := t.TempDir()
+	// writeSize returns a GenerateFunc that writes files off by skew bytes
+	// and fails for the sizes in reject.
+	writeSize := func(skew int64, reject ...int64) func(string, int64) error {
+		return func(path string, size int64) error {
+			for _, r := range reject {
+				if size == r {
+					return fmt.Errorf("cannot pad to %d", size)
+				}
+			}
+			return os.WriteFile(path, make([]byte, size+skew), 0644)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		req      FileRequest
+		generate func(string, int64) error
+		wantSize int64
+		errSub   string
+	}{
+		{"Unchecked deviation", FileRequest{SizeSpec: "10KB"}, writeSize(-3), 10*1024 - 3, ""},
+		{"Strict exact", FileRequest{SizeSpec: "10KB", Strict: true}, writeSize(0), 10 * 1024, ""},
+		{"Strict deviation", FileRequest{SizeSpec: "10KB", Strict: true}, writeSize(1), 0, "want exactly 10240"},
+		{"Within tolerance", FileRequest{SizeSpec: "10KB", Tolerance: "16B"}, writeSize(-16), 10*1024 - 16, ""},
+		{"Outside tolerance", FileRequest{SizeSpec: "10KB", Tolerance: "16B"}, writeSize(17), 0, "more than 16 bytes"},
+		{"Retry nearby size", FileRequest{SizeSpec: "10KB", Tolerance: "16B"}, writeSize(0, 10240, 10241), 10*1024 - 1, ""},
+		{"Retry at tolerance bound", FileRequest{SizeSpec: "10KB", Tolerance: "16B"},
+			writeSize(0, 10240, 10241, 10239, 10242, 10238, 10244, 10236, 10248, 10232), 10*1024 + 16, ""},
+		{"Strict no retry", FileRequest{SizeSpec: "10KB", Strict: true}, writeSize(0, 10240), 0, "cannot pad"},
+		{"Strict and tolerance", FileRequest{SizeSpec: "10KB", Strict: true, Tolerance: "16B"}, writeSize(0), 0, "cannot be combined"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockGen := &MockFileGenerator{GenerateFunc: tc.generate}
+			parser := &MockSizeParser{ParseFunc: func(spec string) (int64, error) {
+				if spec == "16B" {
+					return 16, nil
+				}
+				return (&MockSizeParser{}).Parse(spec)
+			}}
+			service := NewFileService(&MockGeneratorFactory{MockGenerator: mockGen}, parser)
+
+			tc.req.Path = filepath.Join(tempDir, "t.txt")
+			result, err := service.Create(tc.req)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("Create() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			if result.Size != tc.wantSize || result.Deviation() != tc.wantSize-10*1024 {
+				t.Errorf("result size %d (deviation %d), want %d", result.Size, result.Deviation(), tc.wantSize)
+			}
+		})
+	}
+}
+
+// MockPlanner is a mock for ports.Planner
+type MockPlanner struct {
+	MockFileGenerator
+	CalledWithPlanSize int64
+}
+
+func (m *MockPlanner) Plan(sizeBytes int64) (ports.GenerationPlan, error) {
+	m.CalledWithPlanSize = sizeBytes
+	return ports.GenerationPlan{TargetSize: sizeBytes, MinSize: 100, ContentBytes: sizeBytes}, nil
+}
+
+func TestFileService_Plan(t *testing.T) {
+	t.Run("Plan from planner", func(t *testing.T) {
+		mockGen := &MockPlanner{}
+		factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return mockGen, nil }}
+		service := NewFileService(factory, &MockSizeParser{})
+
+		plan, err := service.Plan("out.xlsx", "10KB")
+		if err != nil {
+			t.Fatalf("Plan() unexpected error = %v", err)
+		}
+		if mockGen.CalledWithPlanSize != 10*1024 || plan.TargetSize != 10*1024 || !plan.Feasible() {
+			t.Errorf("Plan() = %+v, planner called with %d", plan, mockGen.CalledWithPlanSize)
+		}
+		if mockGen.GenerateCalled {
+			t.Errorf("Expected Generate NOT to be called when planning")
+		}
+	})
+
+	tests := []struct {
+		name        string
+		path        string
+		sizeSpec    string
+		wantErrText string
+	}{
+		{"Generator without Plan", "out.txt", "10KB", "cannot estimate its output"},
+		{"Invalid size", "out.txt", "badsize", "invalid size 'badsize'"},
+		{"Unsupported extension", "out.unknown", "10KB", "unsupported file extension: unknown"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			service := NewFileService(&MockGeneratorFactory{MockGenerator: &MockFileGenerator{}}, &MockSizeParser{})
+			if _, err := service.Plan(tc.path, tc.sizeSpec); err == nil || !strings.Contains(err.Error(), tc.wantErrText) {
+				t.Errorf("Plan() error = %v, want %q", err, tc.wantErrText)
+			}
+		})
+	}
+}
+
+// MockSetGenerator is a mock for ports.SetGenerator that writes a .idx
+// file of half the size next to the main file.
+type MockSetGenerator struct {
+	MockFileGenerator
+}
+
+func (m *MockSetGenerator) GenerateSet(basePath string, sizeBytes int64) ([]string, error) {
+	idx := strings.TrimSuffix(basePath, filepath.Ext(basePath)) + ".idx"
+	if err := os.WriteFile(basePath, make([]byte, sizeBytes), 0o644); err != nil {
+		return nil, err
+	}
+	return []string{basePath, idx}, os.WriteFile(idx, make([]byte, sizeBytes/2), 0o644)
+}
+
+// MockWholeSetGenerator is a MockSetGenerator whose size covers the .idx
+// file too.
+type MockWholeSetGenerator struct {
+	MockSetGenerator
+}
+
+func (m *MockWholeSetGenerator) GenerateSet(basePath string, sizeBytes int64) ([]string, error) {
+	return m.MockSetGenerator.GenerateSet(basePath, sizeBytes*2/3)
+}
+
+func (m *MockWholeSetGenerator) SizesWholeSet() bool { return true }
+
+func TestFileService_CreateWholeSet(t *testing.T) {
+	factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return &MockWholeSetGenerator{}, nil }}
+	parser := &MockSizeParser{ParseFunc: func(spec string) (int64, error) { return strconv.ParseInt(spec, 10, 64) }}
+	service := NewFileService(factory, parser)
+	path := filepath.Join(t.TempDir(), "a.txt")
+
+	result, err := service.Create(FileRequest{Path: path, SizeSpec: "3072", Strict: true})
+	if err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+	if !result.WholeSet || result.Size != 2*1024 || result.Deviation() != 0 {
+		t.Errorf("Create() whole set %v, size %d, deviation %d; want a whole set of 2048 bytes, deviation 0", result.WholeSet, result.Size, result.Deviation())
+	}
+	if _, err := service.Create(FileRequest{Path: path, SizeSpec: "3073", Strict: true}); err == nil || !strings.Contains(err.Error(), "is 3072 bytes, want exactly 3073") {
+		t.Errorf("Create() error = %v, want the set's size in it", err)
+	}
+}
+
+// MockDurationGenerator is a MockFileGenerator writing a byte per
+// millisecond of playback.
+type MockDurationGenerator struct {
+	MockFileGenerator
+}
+
+func (m *MockDurationGenerator) ForDuration(d time.Duration) (ports.FileGenerator, int64, error) {
+	if d > time.Hour {
+		return nil, 0, fmt.Errorf("too long")
+	}
+	return m, d.Milliseconds(), nil
+}
+
+func TestFileService_CreateDuration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.wav")
+	tests := []struct {
+		name     string
+		gen      ports.FileGenerator
+		req      FileRequest
+		wantSize int64
+		errSub   string
+	}{
+		{"Duration", &MockDurationGenerator{}, FileRequest{Path: path, Duration: "2.5s"}, 2500, ""},
+		{"With size", &MockDurationGenerator{}, FileRequest{Path: path, Duration: "2s", SizeSpec: "1KB"}, 0, "cannot be combined"},
+		{"With lines", &MockDurationGenerator{}, FileRequest{Path: path, Duration: "2s", Lines: 3}, 0, "cannot be combined"},
+		{"Bad duration", &MockDurationGenerator{}, FileRequest{Path: path, Duration: "2 fortnights"}, 0, "invalid duration"},
+		{"Too long", &MockDurationGenerator{}, FileRequest{Path: path, Duration: "2h"}, 0, "too long"},
+		{"Unsupported", &MockFileGenerator{}, FileRequest{Path: path, Duration: "2s"}, 0, "does not support durations"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+			result, err := service.Create(tc.req)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("Create() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			if got := tc.gen.(*MockDurationGenerator).CalledWithSize; got != tc.wantSize || result.TargetSize != tc.wantSize {
+				t.Errorf("generator called with size %d, target %d; want %d", got, result.TargetSize, tc.wantSize)
+			}
+		})
+	}
+}
+
+// MockCountGenerator is a MockFileGenerator writing 100 bytes a page.
+type MockCountGenerator struct {
+	MockFileGenerator
+}
+
+func (m *MockCountGenerator) ForCount(c ports.Count) (ports.FileGenerator, int64, error) {
+	if c.Unit != ports.CountPages {
+		return nil, 0, fmt.Errorf("counted in pages, not %s", c.Unit)
+	}
+	return m, 100 * c.N, nil
+}
+
+func TestFileService_CreateCount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.pdf")
+	pages := ports.Count{Unit: ports.CountPages, N: 12}
+	tests := []struct {
+		name     string
+		gen      ports.FileGenerator
+		req      FileRequest
+		wantSize int64
+		errSub   string
+	}{
+		{"Pages", &MockCountGenerator{}, FileRequest{Path: path, Count: pages}, 1200, ""},
+		{"Rows", &MockCountGenerator{}, FileRequest{Path: path, Count: ports.Count{Unit: ports.CountRows, N: 5}}, 0, "not rows"},
+		{"With size", &MockCountGenerator{}, FileRequest{Path: path, Count: pages, SizeSpec: "1KB"}, 0, "cannot be combined"},
+		{"With duration", &MockCountGenerator{}, FileRequest{Path: path, Count: pages, Duration: "2s"}, 0, "cannot be combined"},
+		{"Bad unit", &MockCountGenerator{}, FileRequest{Path: path, Count: ports.Count{Unit: "chapters", N: 5}}, 0, "unknown count unit"},
+		{"Zero", &MockCountGenerator{}, FileRequest{Path: path, Count: ports.Count{Unit: ports.CountPages}}, 0, "at least 1"},
+		{"Unsupported", &MockFileGenerator{}, FileRequest{Path: path, Count: pages}, 0, "does not support a count of pages"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+			result, err := service.Create(tc.req)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("Create() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			if got := tc.gen.(*MockCountGenerator).CalledWithSize; got != tc.wantSize || result.TargetSize != tc.wantSize {
+				t.Errorf("generator called with size %d, target %d; want %d", got, result.TargetSize, tc.wantSize)
+			}
+		})
+	}
+}
+
+// MockResolutionGenerator is a MockFileGenerator writing a byte a pixel.
+type MockResolutionGenerator struct {
+	MockFileGenerator
+}
+
+func (m *MockResolutionGenerator) ForResolution(width, height int) (ports.FileGenerator, int64, error) {
+	return m, int64(width) * int64(height), nil
+}
+
+func TestFileService_CreateResolution(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.png")
+	tests := []struct {
+		name     string
+		gen      ports.FileGenerator
+		req      FileRequest
+		wantSize int64
+		errSub   string
+	}{
+		{"Resolution", &MockResolutionGenerator{}, FileRequest{Path: path, Resolution: "40x30"}, 1200, ""},
+		{"Upper case", &MockResolutionGenerator{}, FileRequest{Path: path, Resolution: "40X30"}, 1200, ""},
+		{"Within maximum", &MockResolutionGenerator{}, FileRequest{Path: path, Resolution: "40x30", MaxSize: "1MB"}, 1200, ""},
+		{"Over maximum", &MockResolutionGenerator{}, FileRequest{Path: path, Resolution: "200x100", MaxSize: "10KB"}, 0, "more than the maximum of 10240"},
+		{"Maximum alone", &MockResolutionGenerator{}, FileRequest{Path: path, SizeSpec: "10KB", MaxSize: "1MB"}, 0, "give a size instead"},
+		{"With size", &MockResolutionGenerator{}, FileRequest{Path: path, Resolution: "40x30", SizeSpec: "1KB"}, 0, "cannot be combined"},
+		{"With count", &MockResolutionGenerator{}, FileRequest{Path: path, Resolution: "40x30", Count: ports.Count{Unit: ports.CountPages, N: 2}}, 0, "cannot be combined"},
+		{"Bad resolution", &MockResolutionGenerator{}, FileRequest{Path: path, Resolution: "40"}, 0, "invalid resolution"},
+		{"Zero width", &MockResolutionGenerator{}, FileRequest{Path: path, Resolution: "0x30"}, 0, "invalid resolution"},
+		{"Too many pixels", &MockResolutionGenerator{}, FileRequest{Path: path, Resolution: "20000x20000"}, 0, "megapixel limit"},
+		{"Unsupported", &MockFileGenerator{}, FileRequest{Path: path, Resolution: "40x30"}, 0, "does not support resolutions"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+			result, err := service.Create(tc.req)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("Create() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			if got := tc.gen.(*MockResolutionGenerator).CalledWithSize; got != tc.wantSize || result.TargetSize != tc.wantSize {
+				t.Errorf("generator called with size %d, target %d; want %d", got, result.TargetSize, tc.wantSize)
+			}
+		})
+	}
+}
+
+func TestFileService_CreateCompanions(t *testing.T) {
+	factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return &MockSetGenerator{}, nil }}
+	service := NewFileService(factory, &MockSizeParser{})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+
+	result, err := service.Create(FileRequest{Path: path, SizeSpec: "10KB", Strict: true, MTime: "2020-01-01"})
+	if err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+	companion := strings.TrimSuffix(path, ".txt") + ".idx"
+	want := []FileResult{{Path: companion, Type: ports.FileTypeTXT, Size: 5 * 1024, TargetSize: ports.AnySize}}
+	if !reflect.DeepEqual(result.Companions, want) {
+		t.Errorf("Create() companions = %+v, want %+v", result.Companions, want)
+	}
+	if paths := result.Paths(); !reflect.DeepEqual(paths, []string{path, companion}) {
+		t.Errorf("Paths() = %v", paths)
+	}
+	info, err := os.Stat(companion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC); !info.ModTime().Equal(mtime) {
+		t.Errorf("companion modification time = %v, want %v", info.ModTime(), mtime)
+	}
+
+	if _, err := service.Create(FileRequest{Path: path, SizeSpec: "10KB", Options: ports.Options{"width": "1"}}); err == nil || !strings.Contains(err.Error(), "does not accept options") {
+		t.Errorf("Create() with options error = %v, want error containing %q", err, "does not accept options")
+	}
+
+	name, _ := ParseNameTemplate("b{seq}.txt")
+	batch, err := service.CreateBatch(FileRequest{SizeSpec: "10KB"}, dir, 2, name)
+	if err != nil {
+		t.Fatalf("CreateBatch() unexpected error = %v", err)
+	}
+	if batch.TotalSize != 2*(10+5)*1024 {
+		t.Errorf("CreateBatch() total size = %d, want %d", batch.TotalSize, 2*(10+5)*1024)
+	}
+}
+
+// MockOutputFS is a mock for ports.OutputFS that fails to create any file.
+type MockOutputFS struct {
+	Created []string
+}
+
+var errNoSpace = errors.New("no space left on device")
+
+func (m *MockOutputFS) Create(path string) (ports.OutputFile, error) {
+	m.Created = append(m.Created, filepath.Base(path))
+	return nil, errNoSpace
+}
+
+func (m *MockOutputFS) Open(path string) (ports.OutputFile, error) {
+	return m.Create(path)
+}
+
+func TestFileService_WithOutputFS(t *testing.T) {
+	writeABC := &MockFileGenerator{GenerateFunc: func(path string, _ int64) error {
+		return os.WriteFile(path, []byte("abc"), 0o644)
+	}}
+	tests := []struct {
+		name string
+		gen  ports.FileGenerator
+		run  func(s *FileService, path string) error
+	}{
+		{"Throttled", &MockStreamGenerator{}, func(s *FileService, path string) error {
+			_, err := s.Create(FileRequest{Path: path, SizeSpec: "10KB", Throttle: "1MB/s"})
+			return err
+		}},
+		{"Sidecar", writeABC, func(s *FileService, path string) error {
+			_, err := s.Create(FileRequest{Path: path, SizeSpec: "10KB", Sidecar: true})
+			return err
+		}},
+		{"Split", writeABC, func(s *FileService, path string) error {
+			if _, err := s.Create(FileRequest{Path: path, SizeSpec: "10KB"}); err != nil {
+				return err
+			}
+			_, err := s.SplitFile(path, "10KB")
+			return err
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}
+			fsys := &MockOutputFS{}
+			service := NewFileService(factory, &MockSizeParser{}).WithOutputFS(fsys)
+
+			if err := tc.run(service, filepath.Join(t.TempDir(), "a.txt")); !errors.Is(err, errNoSpace) {
+				t.Errorf("error = %v, want the file system's", err)
+			}
+			if len(fsys.Created) == 0 {
+				t.Error("the service wrote nothing on its file system")
+			}
+		})
+	}
+}
+
+// MockAttrFS is the operating system's file system recording the
+// attributes set through it, as a ports.AttrFS.
+type MockAttrFS struct {
+	Calls []string
+}
+
+func (m *MockAttrFS) Create(path string) (ports.OutputFile, error) {
+	return os.Create(path)
+}
+
+func (m *MockAttrFS) Open(path string) (ports.OutputFile, error) {
+	return os.OpenFile(path, os.O_WRONLY, 0)
+}
+
+func (m *MockAttrFS) Stat(path string) (fs.FileInfo, error) {
+	m.Calls = append(m.Calls, "stat "+filepath.Base(path))
+	return os.Stat(path)
+}
+
+func (m *MockAttrFS) Chtimes(path string, atime, mtime time.Time) error {
+	m.Calls = append(m.Calls, "chtimes "+filepath.Base(path))
+	return os.Chtimes(path, atime, mtime)
+}
+
+func (m *MockAttrFS) Chmod(path string, mode fs.FileMode) error {
+	m.Calls = append(m.Calls, "chmod "+filepath.Base(path))
+	return os.Chmod(path, mode)
+}
+
+func (m *MockAttrFS) Chown(path string, uid, gid int) error {
+	m.Calls = append(m.Calls, "chown "+filepath.Base(path))
+	return os.Chown(path, uid, gid)
+}
+
+func TestFileService_AttrFS(t *testing.T) {
+	writeABC := &MockFileGenerator{GenerateFunc: func(path string, _ int64) error {
+		return os.WriteFile(path, []byte("abc"), 0o644)
+	}}
+	factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return writeABC, nil }}
+	fsys := &MockAttrFS{}
+	service := NewFileService(factory, &MockSizeParser{}).WithOutputFS(fsys)
+	path := filepath.Join(t.TempDir(), "a.txt")
+
+	result, err := service.Create(FileRequest{Path: path, SizeSpec: "10KB", MTime: "2020-01-01", Mode: "0600"})
+	if err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+	if result.Size != 3 {
+		t.Errorf("Create() size = %d, want 3", result.Size)
+	}
+	for _, want := range []string{"chtimes", "chmod", "stat"} {
+		if !slices.ContainsFunc(fsys.Calls, func(c string) bool { return strings.HasPrefix(c, want+" ") }) {
+			t.Errorf("the service did not %s through its file system: %v", want, fsys.Calls)
+		}
+	}
+}
+
+// MockRenameFS is the operating system's file system recording the
+// renames made through it, as a ports.RenameFS.
+type MockRenameFS struct {
+	Calls []string
+}
+
+func (m *MockRenameFS) Create(path string) (ports.OutputFile, error) {
+	return os.Create(path)
+}
+
+func (m *MockRenameFS) Open(path string) (ports.OutputFile, error) {
+	return os.OpenFile(path, os.O_WRONLY, 0)
+}
+
+func (m *MockRenameFS) MkdirTempIn(dir, pattern string) (string, error) {
+	m.Calls = append(m.Calls, "mkdirtemp")
+	return os.MkdirTemp(dir, pattern)
+}
+
+func (m *MockRenameFS) Lstat(path string) (fs.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+func (m *MockRenameFS) Rename(oldpath, newpath string) error {
+	m.Calls = append(m.Calls, "rename "+filepath.Base(newpath))
+	return os.Rename(oldpath, newpath)
+}
+
+func (m *MockRenameFS) Remove(path string) error {
+	m.Calls = append(m.Calls, "remove "+filepath.Base(path))
+	return os.Remove(path)
+}
+
+func (m *MockRenameFS) RemoveAll(path string) error {
+	m.Calls = append(m.Calls, "removeall")
+	return os.RemoveAll(path)
+}
+
+func TestFileService_RenameFS(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		want  []string
+		files int // left in the directory
+	}{
+		{"Complete", nil, []string{"mkdirtemp", "rename a.txt", "removeall"}, 1},
+		{"Failed", errors.New("disk on fire"), []string{"mkdirtemp", "removeall"}, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			writeABC := &MockFileGenerator{GenerateFunc: func(path string, _ int64) error {
+				if err := os.WriteFile(path, []byte("abc"), 0o644); err != nil {
+					return err
+				}
+				return tc.err
+			}}
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return writeABC, nil }}
+			fsys := &MockRenameFS{}
+			service := NewFileService(factory, &MockSizeParser{}).WithOutputFS(fsys)
+			path := filepath.Join(t.TempDir(), "a.txt")
+
+			_, err := service.Create(FileRequest{Path: path, SizeSpec: "10KB"})
+			if (err != nil) != (tc.err != nil) {
+				t.Fatalf("Create() error = %v, want %v", err, tc.err)
+			}
+			if !slices.Equal(fsys.Calls, tc.want) {
+				t.Errorf("calls through the file system = %v, want %v", fsys.Calls, tc.want)
+			}
+			if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != tc.files {
+				t.Errorf("the directory holds %d files, want %d", len(entries), tc.files)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package application
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// checksumTargets maps the names of the checksums a file can be made to
+// have to their tables. All are CRCs, which are linear over GF(2), so the
+// bytes giving a checksum are solved for rather than searched.
+var checksumTargets = map[string]*crc32.Table{
+	"crc32":  crc32.IEEETable,
+	"crc32c": crc32.MakeTable(crc32.Castagnoli),
+	"crc32k": crc32.MakeTable(crc32.Koopman),
+}
+
+// checksumTarget is a parsed FileRequest.TargetChecksum.
+type checksumTarget struct {
+	table *crc32.Table
+	want  uint32
+}
+
+// parseChecksumTarget parses ALGORITHM:HEX, such as "crc32:deadbeef".
+func parseChecksumTarget(spec string) (checksumTarget, error) {
+	name, value, ok := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	table, known := checksumTargets[name]
+	if !ok || !known {
+		return checksumTarget{}, fmt.Errorf("invalid checksum target '%s' (want crc32, crc32c or crc32k, a colon and 8 hex digits)", spec)
+	}
+	want, err := strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 32)
+	if err != nil {
+		return checksumTarget{}, fmt.Errorf("invalid checksum target '%s': %w", spec, err)
+	}
+	return checksumTarget{table, uint32(want)}, nil
+}
+
+// tailLen returns how many tail bytes drawn from an alphabet of n bytes
+// reach a given checksum, with sixteen ways to on average; 4 bytes do for
+// an alphabet of all 256.
+func tailLen(n int) int {
+	if n >= 256 {
+		return 4
+	}
+	return int(math.Ceil(36 / math.Log2(float64(n))))
+}
+
+// forceChecksum rewrites the last bytes of the file at path, at most free
+// of them, with bytes from alphabet (nil for any) so that the file's
+// checksum is t.want.
+func forceChecksum(path string, t checksumTarget, free int64, alphabet []byte) error {
+	if alphabet != nil && len(alphabet) < 2 {
+		return fmt.Errorf("cannot reach a checksum with %d byte values", len(alphabet))
+	}
+	k := 4
+	if alphabet != nil {
+		k = tailLen(len(alphabet))
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if free = min(free, info.Size()); free == 0 {
+		return fmt.Errorf("the file does not end in free bytes")
+	} else if free < int64(k) {
+		return fmt.Errorf("the file ends in %d free bytes; reaching a checksum takes %d", free, k)
+	}
+	h := crc32.New(t.table)
+	if _, err := io.CopyN(h, f, info.Size()-int64(k)); err != nil {
+		return err
+	}
+	prefix := h.Sum32()
+	crc := func(tail []byte) uint32 { return crc32.Update(prefix, t.table, tail) }
+
+	var tail []byte
+	if alphabet == nil {
+		tail, err = solveTail(crc, t.want)
+	} else {
+		tail, err = searchTail(crc, t.want, k, alphabet)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(tail, info.Size()-int64(k)); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// solveTail returns the 4 bytes that crc, the CRC of the file with them
+// as its tail, takes to want. crc is affine, so each of the 32 bits of the
+// tail flips a fixed set of bits of it, and the tail is the solution of a
+// linear system over GF(2).
+func solveTail(crc func([]byte) uint32, want uint32) ([]byte, error) {
+	var zero [4]byte
+	base := crc(zero[:])
+	// basis[b] is a combination of tail bits, given by combo[b], that
+	// flips bit b of the CRC and no higher one.
+	var basis, combo [32]uint32
+	for i := 0; i < 32; i++ {
+		var tail [4]byte
+		tail[i/8] = 1 << (i % 8)
+		v, m := crc(tail[:])^base, uint32(1)<<i
+		for b := 31; b >= 0 && v != 0; b-- {
+			if v>>b&1 == 0 {
+				continue
+			}
+			if basis[b] == 0 {
+				basis[b], combo[b] = v, m
+				break
+			}
+			v, m = v^basis[b], m^combo[b]
+		}
+	}
+	var x uint32
+	for v, b := want^base, 31; b >= 0; b-- {
+		if v>>b&1 == 0 {
+			continue
+		}
+		if basis[b] == 0 {
+			return nil, fmt.Errorf("no tail reaches checksum %08x", want)
+		}
+		v, x = v^basis[b], x^combo[b]
+	}
+	tail := make([]byte, 4)
+	for i := 0; i < 32; i++ {
+		tail[i/8] |= byte(x>>i&1) << (i % 8)
+	}
+	return tail, nil
+}
+
+// searchTail returns k bytes from alphabet that crc, the CRC of the file
+// with them as its tail, takes to want. The CRC each byte value adds at
+// each position is independent of the others, so the search meets in the
+// middle: the CRCs of every front half go in a table, and each back half
+// looks up the front half that completes it.
+func searchTail(crc func([]byte) uint32, want uint32, k int, alphabet []byte) ([]byte, error) {
+	zero := make([]byte, k)
+	base := crc(zero)
+	// flips[p][i] is how alphabet[i] at position p changes the CRC.
+	flips := make([][]uint32, k)
+	for p := range flips {
+		flips[p] = make([]uint32, len(alphabet))
+		for i, c := range alphabet {
+			zero[p] = c
+			flips[p][i] = crc(zero) ^ base
+			zero[p] = 0
+		}
+	}
+	// each calls f with every string of n letters from position p on, as
+	// alphabet indices, and the CRC change they make.
+	each := func(p, n int, f func(idx []int, v uint32) bool) {
+		idx := make([]int, n)
+		for {
+			var v uint32
+			for j, i := range idx {
+				v ^= flips[p+j][i]
+			}
+			if !f(idx, v) {
+				return
+			}
+			j := n - 1
+			for ; j >= 0 && idx[j] == len(alphabet)-1; j-- {
+				idx[j] = 0
+			}
+			if j < 0 {
+				return
+			}
+			idx[j]++
+		}
+	}
+	front := k / 2
+	table := make(map[uint32]int, int(math.Pow(float64(len(alphabet)), float64(front))))
+	each(0, front, func(idx []int, v uint32) bool {
+		n := 0
+		for _, i := range idx {
+			n = n*len(alphabet) + i
+		}
+		table[v] = n
+		return true
+	})
+	var tail []byte
+	each(front, k-front, func(idx []int, v uint32) bool {
+		n, ok := table[want^base^v]
+		if !ok {
+			return true
+		}
+		tail = make([]byte, k)
+		for j := front - 1; j >= 0; j-- {
+			tail[j] = alphabet[n%len(alphabet)]
+			n /= len(alphabet)
+		}
+		for j, i := range idx {
+			tail[front+j] = alphabet[i]
+		}
+		return false
+	})
+	if tail == nil {
+		return nil, fmt.Errorf("no %d-byte tail reaches checksum %08x", k, want)
+	}
+	return tail, nil
+}
@@ -0,0 +1,138 @@
+package application
+
+import (
+	"bytes"
+	"crypto/rand"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestForceChecksum(t *testing.T) {
+	digits := []byte("0123456789")
+	tests := []struct {
+		name     string
+		target   string
+		size     int
+		free     int64
+		alphabet []byte
+		errSub   string
+	}{
+		{name: "CRC32", target: "crc32:deadbeef", size: 1000, free: 1000},
+		{name: "CRC32C", target: "crc32c:0x00000000", size: 1000, free: 4},
+		{name: "CRC32K", target: "CRC32K:FFFFFFFF", size: 4, free: 4},
+		{name: "Printable", target: "crc32:12345678", size: 1000, free: 1000, alphabet: printable()},
+		{name: "Digits", target: "crc32:cafebabe", size: 1000, free: 1000, alphabet: digits},
+		{name: "TooFewFree", target: "crc32:deadbeef", size: 1000, free: 3, errSub: "3 free bytes"},
+		{name: "TooFewForAlphabet", target: "crc32:deadbeef", size: 1000, free: 5, alphabet: printable(), errSub: "takes 6"},
+		{name: "BadAlgorithm", target: "md5:deadbeef", errSub: "invalid checksum target"},
+		{name: "BadValue", target: "crc32:deadbeefcafe", errSub: "invalid checksum target"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := parseChecksumTarget(tc.target)
+			if err == nil {
+				path := filepath.Join(t.TempDir(), "a.bin")
+				data := make([]byte, tc.size)
+				rand.Read(data)
+				if err := os.WriteFile(path, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err = forceChecksum(path, target, tc.free, tc.alphabet); err == nil {
+					got, _ := os.ReadFile(path)
+					if crc32.Checksum(got, target.table) != target.want {
+						t.Errorf("checksum %08x, want %08x", crc32.Checksum(got, target.table), target.want)
+					}
+					k := len(got) - 4
+					if tc.alphabet != nil {
+						k = len(got) - tailLen(len(tc.alphabet))
+						for _, c := range got[k:] {
+							if bytes.IndexByte(tc.alphabet, c) < 0 {
+								t.Fatalf("tail %q strays from the alphabet", got[k:])
+							}
+						}
+					}
+					if !bytes.Equal(got[:k], data[:k]) {
+						t.Error("bytes before the tail changed")
+					}
+				}
+			}
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Fatalf("error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// printable returns the printable ASCII characters.
+func printable() []byte {
+	var b []byte
+	for c := byte(' '); c <= '~'; c++ {
+		b = append(b, c)
+	}
+	return b
+}
+
+// MockTailGenerator is a MockFileGenerator writing size random bytes, all
+// of them free.
+type MockTailGenerator struct {
+	MockFileGenerator
+}
+
+func (m *MockTailGenerator) Generate(outPath string, sizeBytes int64) error {
+	m.MockFileGenerator.Generate(outPath, sizeBytes)
+	data := make([]byte, sizeBytes)
+	rand.Read(data)
+	return os.WriteFile(outPath, data, 0644)
+}
+
+func (m *MockTailGenerator) FreeTail(size int64, opts ports.Options) (int64, []byte) {
+	return size, nil
+}
+
+func TestFileService_CreateTargetChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.bin")
+	tests := []struct {
+		name   string
+		gen    ports.FileGenerator
+		req    FileRequest
+		errSub string
+	}{
+		{"Target", &MockTailGenerator{}, FileRequest{Path: path, SizeSpec: "10KB", TargetChecksum: "crc32:01020304"}, ""},
+		{"Strict", &MockTailGenerator{}, FileRequest{Path: path, SizeSpec: "10KB", Strict: true, TargetChecksum: "crc32c:01020304"}, ""},
+		{"With lines", &MockTailGenerator{}, FileRequest{Path: path, SizeSpec: "10KB", Lines: 3, TargetChecksum: "crc32:01020304"}, "line count"},
+		{"Bad target", &MockTailGenerator{}, FileRequest{Path: path, SizeSpec: "10KB", TargetChecksum: "crc32"}, "invalid checksum target"},
+		{"Unsupported", &MockFileGenerator{}, FileRequest{Path: path, SizeSpec: "10KB", TargetChecksum: "crc32:01020304"}, "does not support checksum targets"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+			_, err := service.Create(tc.req)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("Create() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			target, _ := parseChecksumTarget(tc.req.TargetChecksum)
+			data, _ := os.ReadFile(path)
+			if len(data) != 10*1024 || crc32.Checksum(data, target.table) != 0x01020304 {
+				t.Errorf("file of %d bytes with checksum %08x", len(data), crc32.Checksum(data, target.table))
+			}
+		})
+	}
+}
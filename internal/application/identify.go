@@ -0,0 +1,145 @@
+package application
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// Identification reports what Identify found out about a file.
+type Identification struct {
+	Path string
+	Size int64
+	// Type is the file's format, or "" if it was not recognised.
+	Type ports.FileType
+	// Source is how Type was found: "magic" for the file's magic numbers,
+	// "extension" for a text file whose extension names a text format,
+	// "content" for other text, which is plain text, and "unknown" when
+	// the format was not recognised.
+	Source string
+	// Regenerable reports whether genfile can write a file of Type and
+	// Size; Reason says why not when it cannot.
+	Regenerable bool
+	Reason      string
+	// MinSize is the smallest file of Type genfile writes, if its
+	// generator can tell.
+	MinSize int64
+}
+
+// Identify recognises the format of the file at path by its content and
+// reports whether genfile could write a placeholder of that format and
+// size. Text files whose content names no format are identified by their
+// extension, or as plain text if it names no text format.
+func (s *FileService) Identify(path string) (Identification, error) {
+	id := Identification{Path: path}
+	f, size, err := openRegular(path)
+	if err != nil {
+		return id, err
+	}
+	defer f.Close()
+	id.Size = size
+
+	if id.Type, id.Source, err = detectType(f, path, size); err != nil {
+		return id, err
+	}
+	if id.Type == "" {
+		id.Reason = "unrecognised format"
+		return id, nil
+	}
+	s.checkRegenerable(&id)
+	return id, nil
+}
+
+// openRegular opens the regular file at path and returns its size.
+func openRegular(path string) (*os.File, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, 0, fmt.Errorf("%s is not a regular file", path)
+	}
+	return f, info.Size(), nil
+}
+
+// detectType returns the type of the file f at path, of size bytes, and
+// how it was found: "magic" or, for text, "extension" or "content". It
+// returns "" and "unknown" for binary content it does not recognise.
+func detectType(f *os.File, path string, size int64) (ports.FileType, string, error) {
+	fileType, err := Sniff(f, size)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to identify %s: %w", path, err)
+	}
+	if fileType == ports.FileTypeMP4 && extensionType(path) == ports.FileTypeM4V {
+		// M4V files often carry the same brands as MP4 ones.
+		fileType = ports.FileTypeM4V
+	}
+	if fileType != "" {
+		return fileType, "magic", nil
+	}
+	header := make([]byte, min(size, sniffLen))
+	if _, err := f.ReadAt(header, 0); err != nil && err != io.EOF {
+		return "", "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if !isText(header) {
+		return "", "unknown", nil
+	}
+	fileType, source := textType(path)
+	return fileType, source, nil
+}
+
+// extensionType returns the file type the extension of path names, or ""
+// if it names none.
+func extensionType(path string) ports.FileType {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	fileType, err := mapExtensionToFileType(ext)
+	if err != nil {
+		return ""
+	}
+	return fileType
+}
+
+// textType returns the text format named by the extension of path and
+// "extension", or plain text and "content" if the extension is missing or
+// names no text format.
+func textType(path string) (ports.FileType, string) {
+	switch fileType := extensionType(path); fileType {
+	case ports.FileTypeTXT, ports.FileTypeCSV, ports.FileTypeMD, ports.FileTypeLog, ports.FileTypeFWF:
+		return fileType, "extension"
+	}
+	return ports.FileTypeTXT, "content"
+}
+
+// checkRegenerable fills in whether a file of id's type and size can be
+// generated.
+func (s *FileService) checkRegenerable(id *Identification) {
+	generator, err := s.factory.For(id.Type)
+	if err != nil {
+		id.Reason = fmt.Sprintf("no generator for type '%s'", id.Type)
+		return
+	}
+	id.Regenerable = true
+	planner, ok := ports.As[ports.Planner](generator)
+	if !ok {
+		return
+	}
+	plan, err := planner.Plan(id.Size)
+	if err != nil {
+		id.Regenerable, id.Reason = false, err.Error()
+		return
+	}
+	id.MinSize = plan.MinSize
+	if !plan.Feasible() {
+		id.Regenerable, id.Reason = false, fmt.Sprintf("below the minimum size of %d bytes", plan.MinSize)
+	}
+}
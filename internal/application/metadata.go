@@ -0,0 +1,56 @@
+package application
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// maxMetadataKeyLen bounds metadata keys well below the shortest limit of
+// the formats that store them (79 bytes for a PNG text keyword).
+const maxMetadataKeyLen = 64
+
+// ParseMetadata parses key=value pairs such as "title=Q3 report". The
+// well-known keys (ports.MetaTitle and so on) are matched
+// case-insensitively; other keys must be letters, digits, '-' or '_' so
+// that every format can use them as a property name.
+func ParseMetadata(pairs []string) (ports.Metadata, error) {
+	m := ports.Metadata{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid metadata %q: want key=value", pair)
+		}
+		key = strings.TrimSpace(key)
+		switch lower := strings.ToLower(key); lower {
+		case ports.MetaTitle, ports.MetaAuthor, ports.MetaSubject, ports.MetaKeywords, ports.MetaComment, ports.MetaCreator:
+			key = lower
+		}
+		if key == "" || strings.IndexFunc(key, invalidKeyRune) >= 0 {
+			return nil, fmt.Errorf("invalid metadata key %q: use letters, digits, '-' or '_'", key)
+		}
+		if len(key) > maxMetadataKeyLen {
+			return nil, fmt.Errorf("metadata key %q is longer than %d characters", key, maxMetadataKeyLen)
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func invalidKeyRune(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+}
+
+// withMetadata returns generator set up to write m, or generator itself
+// when m is empty.
+func withMetadata(fileType ports.FileType, generator ports.FileGenerator, m ports.Metadata) (ports.FileGenerator, error) {
+	if len(m) == 0 {
+		return generator, nil
+	}
+	mc, ok := ports.As[ports.MetadataCapable](generator)
+	if !ok {
+		return nil, fmt.Errorf("generator for type '%s' does not support metadata", fileType)
+	}
+	return mc.WithMetadata(m), nil
+}
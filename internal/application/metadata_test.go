@@ -0,0 +1,88 @@
+package application
+
+import (
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// MockMetadataGenerator is a mock for ports.MetadataCapable
+type MockMetadataGenerator struct {
+	MockFileGenerator
+	Meta ports.Metadata
+}
+
+func (m *MockMetadataGenerator) WithMetadata(meta ports.Metadata) ports.FileGenerator {
+	m.Meta = meta
+	return m
+}
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		pairs   []string
+		want    ports.Metadata
+		wantErr string
+	}{
+		{name: "None", want: ports.Metadata{}},
+		{name: "Well-known keys are lowercased", pairs: []string{"Title=Q3 report", "AUTHOR=Ana"}, want: ports.Metadata{"title": "Q3 report", "author": "Ana"}},
+		{name: "Custom keys keep their case", pairs: []string{"Project-ID=42"}, want: ports.Metadata{"Project-ID": "42"}},
+		{name: "Value may contain =", pairs: []string{"comment=a=b"}, want: ports.Metadata{"comment": "a=b"}},
+		{name: "Empty value", pairs: []string{"subject="}, want: ports.Metadata{"subject": ""}},
+		{name: "Later pair wins", pairs: []string{"title=a", "title=b"}, want: ports.Metadata{"title": "b"}},
+		{name: "Missing =", pairs: []string{"title"}, wantErr: "want key=value"},
+		{name: "Empty key", pairs: []string{"=x"}, wantErr: "invalid metadata key"},
+		{name: "Bad key characters", pairs: []string{"my key=x"}, wantErr: "invalid metadata key"},
+		{name: "Key too long", pairs: []string{strings.Repeat("k", 65) + "=x"}, wantErr: "longer than 64"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseMetadata(tc.pairs)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("ParseMetadata() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMetadata() unexpected error = %v", err)
+			}
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("ParseMetadata() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFileService_CreateWithMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.pdf")
+	meta := ports.Metadata{ports.MetaTitle: "Report"}
+
+	t.Run("Supported", func(t *testing.T) {
+		gen := &MockMetadataGenerator{}
+		factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return gen, nil }}
+		service := NewFileService(factory, &MockSizeParser{})
+		if _, err := service.Create(FileRequest{Path: path, SizeSpec: "10KB", Metadata: meta}); err != nil {
+			t.Fatalf("Create() unexpected error = %v", err)
+		}
+		if !gen.GenerateCalled || !maps.Equal(gen.Meta, meta) {
+			t.Errorf("generator called = %v with metadata %v, want %v", gen.GenerateCalled, gen.Meta, meta)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		gen := &MockFileGenerator{}
+		factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return gen, nil }}
+		service := NewFileService(factory, &MockSizeParser{})
+		_, err := service.Create(FileRequest{Path: path, SizeSpec: "10KB", Metadata: meta})
+		if err == nil || !strings.Contains(err.Error(), "does not support metadata") {
+			t.Errorf("Create() error = %v, want an unsupported metadata error", err)
+		}
+		if gen.GenerateCalled {
+			t.Errorf("generator should not be called")
+		}
+	})
+}
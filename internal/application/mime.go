@@ -0,0 +1,108 @@
+package application
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// mimeTypes maps MIME types to the extension of the format generated for
+// them. Where a format goes by several MIME types, all of them are listed.
+var mimeTypes = map[string]string{
+	// Text and data
+	"text/plain":               "txt",
+	"text/markdown":            "md",
+	"text/x-log":               "log",
+	"text/csv":                 "csv",
+	"text/html":                "html",
+	"application/xml":          "xml",
+	"text/xml":                 "xml",
+	"application/json":         "json",
+	"application/x-ndjson":     "ndjson",
+	"application/jsonl":        "ndjson",
+	"application/octet-stream": "bin",
+	"application/edi-x12":      "x12",
+	"application/edifact":      "edifact",
+	"x-application/hl7-v2+er7": "hl7",
+	"text/x-ms-regedit":        "reg",
+	"application/x-subrip":     "srt",
+	"text/vtt":                 "vtt",
+
+	// Images
+	"image/png":                 "png",
+	"image/jpeg":                "jpg",
+	"image/jpg":                 "jpg",
+	"image/gif":                 "gif",
+	"image/tiff":                "tiff",
+	"image/jp2":                 "jp2",
+	"image/vnd.djvu":            "djvu",
+	"image/vnd.adobe.photoshop": "psd",
+
+	// Documents and archives
+	"application/pdf":                         "pdf",
+	"application/illustrator":                 "ai",
+	"application/postscript":                  "ps",
+	"application/x-msaccess":                  "mdb",
+	"application/vnd.ms-access":               "mdb",
+	"application/x-ole-storage":               "cfb",
+	"application/vnd.ms-xpsdocument":          "xps",
+	"application/zip":                         "zip",
+	"application/x-zip-compressed":            "zip",
+	"application/vnd.debian.binary-package":   "deb",
+	"application/x-rpm":                       "rpm",
+	"application/java-archive":                "jar",
+	"application/vnd.android.package-archive": "apk",
+	"application/x-pem-file":                  "pem",
+	"application/pkix-cert":                   "der",
+	"application/x-x509-ca-cert":              "crt",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       "xlsx",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx",
+
+	// Audio and video
+	"audio/wav":                     "wav",
+	"audio/x-wav":                   "wav",
+	"audio/vnd.wave":                "wav",
+	"video/mp4":                     "mp4",
+	"video/x-m4v":                   "m4v",
+	"application/vnd.apple.mpegurl": "m3u8",
+	"application/x-mpegurl":         "m3u8",
+	"application/dash+xml":          "mpd",
+
+	// CAD and GIS
+	"image/vnd.dwg":            "dwg",
+	"image/vnd.dxf":            "dxf",
+	"application/dxf":          "dxf",
+	"application/x-esri-shape": "shp",
+}
+
+// ExtensionForMIME returns the extension of the format generated for the
+// MIME type m (e.g. "png" for "image/png"). Parameters such as a charset
+// are ignored.
+func ExtensionForMIME(m string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(m)
+	if err != nil {
+		return "", fmt.Errorf("invalid MIME type %q: %w", m, err)
+	}
+	ext, ok := mimeTypes[strings.ToLower(mediaType)]
+	if !ok {
+		return "", fmt.Errorf("unsupported MIME type: %s", mediaType)
+	}
+	return ext, nil
+}
+
+// resolveMIME returns req with its Type set from its MIME type, if it has
+// one.
+func resolveMIME(req FileRequest) (FileRequest, error) {
+	if req.MIME == "" {
+		return req, nil
+	}
+	if req.Type != "" {
+		return req, fmt.Errorf("a file type and a MIME type cannot be combined")
+	}
+	ext, err := ExtensionForMIME(req.MIME)
+	if err != nil {
+		return req, err
+	}
+	req.Type, req.MIME = ext, ""
+	return req, nil
+}
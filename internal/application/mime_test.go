@@ -0,0 +1,65 @@
+package application
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestExtensionForMIME(t *testing.T) {
+	tests := []struct {
+		mime   string
+		want   string
+		errSub string
+	}{
+		{"image/png", "png", ""},
+		{"text/csv; charset=utf-8", "csv", ""},
+		{"Image/JPEG", "jpg", ""},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "docx", ""},
+		{"audio/x-wav", "wav", ""},
+		{"image/webp", "", "unsupported MIME type: image/webp"},
+		{"not a type", "", "invalid MIME type"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.mime, func(t *testing.T) {
+			got, err := ExtensionForMIME(tc.mime)
+			if tc.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+					t.Errorf("ExtensionForMIME() error = %v, want error containing %q", err, tc.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtensionForMIME() unexpected error = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("ExtensionForMIME() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFileService_CreateMIME(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var gotType ports.FileType
+	factory := &MockGeneratorFactory{ForFunc: func(t ports.FileType) (ports.FileGenerator, error) {
+		gotType = t
+		return &MockFileGenerator{}, nil
+	}}
+	service := NewFileService(factory, &MockSizeParser{})
+
+	if _, err := service.Create(FileRequest{Path: filepath.Join(tempDir, "a.dat"), SizeSpec: "10KB", MIME: "image/png"}); err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+	if gotType != ports.FileType("png") {
+		t.Errorf("Create() used type %q, want png", gotType)
+	}
+
+	_, err := service.Create(FileRequest{Path: filepath.Join(tempDir, "b.dat"), SizeSpec: "10KB", Type: "csv", MIME: "image/png"})
+	if err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("Create() with a type and a MIME type error = %v, want 'cannot be combined'", err)
+	}
+}
@@ -0,0 +1,163 @@
+package application
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// NameTemplate produces file names from a pattern with placeholders:
+//
+//	{seq}, {seq:N}    the file's sequence number from 1, zero-padded to N digits
+//	{rand}, {rand:N}  N random lowercase letters and digits (default 8)
+//	{date}            the current date as 2006-01-02
+//	{time}            the current time as 150405
+//	{unix}            the current Unix time in seconds
+//	{ext}             the file type's extension, for batches mixing types
+//
+// A path profile turns the names into edge cases (see PathProfile).
+type NameTemplate struct {
+	parts   []namePart
+	now     func() time.Time
+	profile PathProfile
+	rng     *utils.Rand // draws {rand}; the global source if nil
+}
+
+// namePart is literal text (kind "") or a placeholder with its width.
+type namePart struct {
+	kind  string
+	text  string
+	width int
+}
+
+const randNameChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// ParseNameTemplate checks pattern and prepares it for Expand.
+func ParseNameTemplate(pattern string) (NameTemplate, error) {
+	t := NameTemplate{now: time.Now}
+	rest := pattern
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, namePart{text: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, namePart{text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return t, fmt.Errorf("unclosed placeholder in name %q", pattern)
+		}
+		p, err := parsePlaceholder(rest[open+1 : open+end])
+		if err != nil {
+			return t, fmt.Errorf("invalid name %q: %w", pattern, err)
+		}
+		t.parts = append(t.parts, p)
+		rest = rest[open+end+1:]
+	}
+	if len(t.parts) == 0 {
+		return t, fmt.Errorf("name template is empty")
+	}
+	return t, nil
+}
+
+func parsePlaceholder(s string) (namePart, error) {
+	kind, arg, hasArg := strings.Cut(s, ":")
+	p := namePart{kind: kind}
+	switch kind {
+	case "seq":
+	case "rand":
+		p.width = 8
+	case "date", "time", "unix", "ext":
+		if hasArg {
+			return p, fmt.Errorf("{%s} takes no width", kind)
+		}
+		return p, nil
+	default:
+		return p, fmt.Errorf("unknown placeholder {%s} (want seq, rand, date, time, unix or ext)", s)
+	}
+	if hasArg {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > 64 {
+			return p, fmt.Errorf("invalid width %q in {%s}; want 1 to 64", arg, s)
+		}
+		p.width = n
+	}
+	return p, nil
+}
+
+// Unique reports whether the template yields a different name for each
+// sequence number, that is, whether it holds {seq} or {rand}.
+func (t NameTemplate) Unique() bool {
+	for _, p := range t.parts {
+		if p.kind == "seq" || p.kind == "rand" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasExt reports whether the template holds {ext}.
+func (t NameTemplate) HasExt() bool {
+	for _, p := range t.parts {
+		if p.kind == "ext" {
+			return true
+		}
+	}
+	return false
+}
+
+// WithProfile returns a copy of the template whose names profile turns
+// into edge cases, possibly in subdirectories.
+func (t NameTemplate) WithProfile(profile PathProfile) NameTemplate {
+	t.profile = profile
+	return t
+}
+
+// withRand returns a copy of the template that draws {rand} from r.
+func (t NameTemplate) withRand(r *utils.Rand) NameTemplate {
+	t.rng = r
+	return t
+}
+
+// Expand returns the name for sequence number seq.
+func (t NameTemplate) Expand(seq int) string {
+	return t.ExpandType(seq, "")
+}
+
+// ExpandType returns the name for sequence number seq of a file of type
+// ext, which {ext} stands for.
+func (t NameTemplate) ExpandType(seq int, ext string) string {
+	now := t.now()
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.kind {
+		case "":
+			b.WriteString(p.text)
+		case "seq":
+			fmt.Fprintf(&b, "%0*d", p.width, seq)
+		case "rand":
+			intN := rand.IntN
+			if t.rng != nil {
+				intN = t.rng.IntN
+			}
+			for i := 0; i < p.width; i++ {
+				b.WriteByte(randNameChars[intN(len(randNameChars))])
+			}
+		case "date":
+			b.WriteString(now.Format("2006-01-02"))
+		case "time":
+			b.WriteString(now.Format("150405"))
+		case "unix":
+			b.WriteString(strconv.FormatInt(now.Unix(), 10))
+		case "ext":
+			b.WriteString(ext)
+		}
+	}
+	return t.profile.Apply(seq, b.String())
+}
@@ -0,0 +1,166 @@
+package application
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf16"
+)
+
+// PathProfile names a set of edge cases that batch file names are turned
+// into, for testing how software copes with unusual paths.
+type PathProfile string
+
+const (
+	// PathUnicode adds emoji, CJK and right-to-left scripts, decomposed
+	// accents, invisible characters and homoglyphs to names.
+	PathUnicode PathProfile = "unicode"
+	// PathLong pads names to 255 bytes or characters, or nests them in
+	// directories past the 260 characters of the Windows MAX_PATH.
+	PathLong PathProfile = "long"
+	// PathSpaces adds leading, doubled and trailing spaces to names and
+	// directories.
+	PathSpaces PathProfile = "spaces"
+	// PathReserved uses the device names and characters Windows reserves,
+	// and names that shells and tools misread.
+	PathReserved PathProfile = "reserved"
+)
+
+// ParsePathProfile checks a --path-profile value.
+func ParsePathProfile(s string) (PathProfile, error) {
+	switch p := PathProfile(strings.ToLower(s)); p {
+	case PathUnicode, PathLong, PathSpaces, PathReserved:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown path profile %q (want unicode, long, spaces or reserved)", s)
+}
+
+// maxNameLen is the longest file name most file systems allow: 255 bytes
+// on Linux and the BSDs, 255 UTF-16 code units on Windows and macOS.
+const maxNameLen = 255
+
+// nestDepth is how many directories PathLong nests a name in.
+const nestDepth = 40
+
+// variants holds each profile's edge cases, applied in turn to the stem
+// of the name (before its extension) and its extension. They keep the
+// name, so names stay distinct, and its extension, so the file type
+// still follows from it.
+var variants = map[PathProfile][]func(stem, ext string) string{
+	PathUnicode: {
+		func(stem, ext string) string { return "📄🚀-" + stem + ext },
+		func(stem, ext string) string { return "文件-" + stem + ext },
+		func(stem, ext string) string { return "ملف-" + stem + ext },
+		// "café" with the accent as a combining character, which macOS
+		// normalises and other systems keep.
+		func(stem, ext string) string { return "cafe\u0301-" + stem + ext },
+		// A zero-width space and joiner.
+		func(stem, ext string) string { return stem + "\u200b\u200d" + ext },
+		// A Cyrillic і in place of the Latin i.
+		func(stem, ext string) string { return "fіle-" + stem + ext },
+		func(stem, ext string) string { return "𝔘𝔫𝔦𝔠𝔬𝔡𝔢-" + stem + ext },
+	},
+	PathLong: {
+		func(stem, ext string) string { return pad(stem, ext, "x", maxNameLen) },
+		func(stem, ext string) string {
+			dirs := make([]string, nestDepth)
+			for i := range dirs {
+				dirs[i] = fmt.Sprintf("level-%02d", i+1)
+			}
+			return path.Join(append(dirs, stem+ext)...)
+		},
+		// 255 characters, which is twice as many bytes.
+		func(stem, ext string) string { return pad(stem, ext, "é", maxNameLen) },
+	},
+	PathSpaces: {
+		func(stem, ext string) string { return "  " + stem + ext },
+		func(stem, ext string) string { return "a  b  " + stem + ext },
+		func(stem, ext string) string { return stem + " " + ext },
+		func(stem, ext string) string { return "trailing space /" + stem + ext },
+		// A no-break space, which looks like any other.
+		func(stem, ext string) string { return "no\u00a0break-" + stem + ext },
+	},
+	PathReserved: {
+		func(stem, ext string) string { return "CON." + stem + ext },
+		func(stem, ext string) string { return "nul." + stem + ext },
+		func(stem, ext string) string { return "COM1." + stem + ext },
+		func(stem, ext string) string { return "LPT9." + stem + ext },
+		func(stem, ext string) string { return stem + `<a>b:c"d|e?f*` + ext },
+		func(stem, ext string) string { return `back\slash-` + stem + ext },
+		func(stem, ext string) string { return "trailing dot./" + stem + ext },
+		func(stem, ext string) string { return "-" + stem + ext },
+		func(stem, ext string) string { return "$(echo " + stem + ")" + ext },
+	},
+}
+
+// pad pads stem with fill until stem and ext are n characters long.
+func pad(stem, ext, fill string, n int) string {
+	var b strings.Builder
+	b.WriteString(stem)
+	for w := utf16Len(stem + ext); w < n; w++ {
+		b.WriteString(fill)
+	}
+	return b.String() + ext
+}
+
+// Apply returns the slash-separated path the profile makes of the name
+// of the seq-th file.
+func (p PathProfile) Apply(seq int, name string) string {
+	vs := variants[p]
+	if len(vs) == 0 {
+		return name
+	}
+	dir, file := path.Split(name)
+	ext := path.Ext(file)
+	return dir + vs[(seq-1)%len(vs)](strings.TrimSuffix(file, ext), ext)
+}
+
+// windowsDevices are the names Windows reserves for devices, with or
+// without an extension.
+var windowsDevices = map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true}
+
+func init() {
+	for i := '0'; i <= '9'; i++ {
+		windowsDevices["COM"+string(i)] = true
+		windowsDevices["LPT"+string(i)] = true
+	}
+}
+
+// CheckPath reports why the operating system goos cannot create the
+// slash-separated relative path rel, or returns nil if it can.
+func CheckPath(rel, goos string) error {
+	elems := strings.Split(rel, "/")
+	for i, elem := range elems {
+		what := "the name"
+		if i < len(elems)-1 {
+			what = fmt.Sprintf("directory %q", elem)
+		}
+		if goos == "windows" || goos == "darwin" {
+			if n := utf16Len(elem); n > maxNameLen {
+				return fmt.Errorf("%s is %d UTF-16 code units long; %s allows %d", what, n, goos, maxNameLen)
+			}
+		} else if len(elem) > maxNameLen {
+			return fmt.Errorf("%s is %d bytes long; %s allows %d", what, len(elem), goos, maxNameLen)
+		}
+		if goos != "windows" {
+			continue
+		}
+		base, _, _ := strings.Cut(elem, ".")
+		if windowsDevices[strings.ToUpper(strings.TrimRight(base, " "))] {
+			return fmt.Errorf("%s is the device %s, which Windows reserves", what, strings.ToUpper(base))
+		}
+		for _, r := range elem {
+			if r < 0x20 || strings.ContainsRune(`<>:"|?*\`, r) {
+				return fmt.Errorf("%s holds %q, which Windows does not allow", what, r)
+			}
+		}
+		if strings.HasSuffix(elem, " ") || strings.HasSuffix(elem, ".") {
+			return fmt.Errorf("%s ends in a space or a dot, which Windows strips", what)
+		}
+	}
+	return nil
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
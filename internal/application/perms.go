@@ -0,0 +1,98 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// permissions are the mode and ownership a FileRequest asks for.
+type permissions struct {
+	mode     fs.FileMode
+	setMode  bool
+	uid, gid int // -1 leaves them unchanged
+}
+
+// parsePermissions parses the Mode, Owner and Group of req.
+func parsePermissions(req FileRequest) (permissions, error) {
+	p := permissions{uid: -1, gid: -1}
+	if req.Mode != "" {
+		bits, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(req.Mode), "0o"), 8, 32)
+		if err != nil || bits > 0o777 {
+			return p, fmt.Errorf("invalid mode '%s': want octal permissions such as 0644, at most 0777", req.Mode)
+		}
+		p.mode, p.setMode = fs.FileMode(bits), true
+	}
+	if req.Owner == "" && req.Group == "" {
+		return p, nil
+	}
+	if runtime.GOOS == "windows" {
+		return p, fmt.Errorf("file ownership cannot be set on Windows")
+	}
+	if req.Owner != "" {
+		id, err := lookupID(req.Owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return p, fmt.Errorf("invalid owner '%s': %w", req.Owner, err)
+		}
+		p.uid = id
+	}
+	if req.Group != "" {
+		id, err := lookupID(req.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return p, fmt.Errorf("invalid group '%s': %w", req.Group, err)
+		}
+		p.gid = id
+	}
+	return p, nil
+}
+
+// lookupID returns the numeric ID spec gives, or that lookup finds for
+// the name spec gives.
+func lookupID(spec string, lookup func(string) (string, error)) (int, error) {
+	id := spec
+	if _, err := strconv.Atoi(spec); err != nil {
+		if id, err = lookup(spec); err != nil {
+			return 0, err
+		}
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("not a numeric ID: %s", id)
+	}
+	return n, nil
+}
+
+// apply gives the file at path, to be reported as name, the mode and
+// ownership asked for through attrs.
+func (p permissions) apply(attrs fileAttrs, path, name string) error {
+	if p.uid >= 0 || p.gid >= 0 {
+		if err := attrs.Chown(path, p.uid, p.gid); err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				return fmt.Errorf("failed to set the owner of %s: %w (changing it takes root or CAP_CHOWN)", name, err)
+			}
+			return fmt.Errorf("failed to set the owner of %s: %w", name, err)
+		}
+	}
+	if p.setMode {
+		if err := attrs.Chmod(path, p.mode); err != nil {
+			return fmt.Errorf("failed to set the mode of %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package application
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParsePermissions(t *testing.T) {
+	tests := []struct {
+		req         FileRequest
+		want        permissions
+		wantErrText string
+	}{
+		{req: FileRequest{}, want: permissions{uid: -1, gid: -1}},
+		{req: FileRequest{Mode: "0600"}, want: permissions{mode: 0o600, setMode: true, uid: -1, gid: -1}},
+		{req: FileRequest{Mode: "755"}, want: permissions{mode: 0o755, setMode: true, uid: -1, gid: -1}},
+		{req: FileRequest{Mode: "0o000"}, want: permissions{setMode: true, uid: -1, gid: -1}},
+		{req: FileRequest{Mode: "0644", Owner: "1000", Group: "100"}, want: permissions{mode: 0o644, setMode: true, uid: 1000, gid: 100}},
+		{req: FileRequest{Mode: "0888"}, wantErrText: "invalid mode"},
+		{req: FileRequest{Mode: "4755"}, wantErrText: "at most 0777"},
+		{req: FileRequest{Mode: "rw-r--r--"}, wantErrText: "invalid mode"},
+		{req: FileRequest{Owner: "no-such-user-genfile"}, wantErrText: "invalid owner"},
+		{req: FileRequest{Group: "no-such-group-genfile"}, wantErrText: "invalid group"},
+	}
+	for _, tc := range tests {
+		got, err := parsePermissions(tc.req)
+		if runtime.GOOS == "windows" && (tc.req.Owner != "" || tc.req.Group != "") {
+			if err == nil || !strings.Contains(err.Error(), "Windows") {
+				t.Errorf("parsePermissions(%+v) error = %v, want unsupported on Windows", tc.req, err)
+			}
+			continue
+		}
+		if tc.wantErrText != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErrText) {
+				t.Errorf("parsePermissions(%+v) error = %v, want %q", tc.req, err, tc.wantErrText)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parsePermissions(%+v) = %+v, %v; want %+v", tc.req, got, err, tc.want)
+		}
+	}
+}
+
+func TestFileService_CreatePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permissions or ownership")
+	}
+	gen := &MockFileGenerator{GenerateFunc: func(path string, size int64) error {
+		return os.WriteFile(path, make([]byte, size), 0o666)
+	}}
+	service := NewFileService(&MockGeneratorFactory{MockGenerator: gen}, &MockSizeParser{})
+	me, err := user.Current()
+	if err != nil {
+		t.Skipf("no current user: %v", err)
+	}
+	dir := t.TempDir()
+
+	for _, inPlace := range []bool{false, true} {
+		path := filepath.Join(dir, "secret"+strconv.FormatBool(inPlace)+".txt")
+		// Anyone may give a file to themselves.
+		req := FileRequest{Path: path, SizeSpec: "10KB", Mode: "0640", Owner: me.Username, Group: me.Gid, InPlace: inPlace}
+		if _, err := service.Create(req); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o640 {
+			t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+		}
+	}
+
+	req := FileRequest{Path: filepath.Join(dir, "bad.txt"), SizeSpec: "10KB", Mode: "999"}
+	if _, err := service.Create(req); err == nil || !strings.Contains(err.Error(), "invalid mode") {
+		t.Errorf("Create() error = %v, want an invalid mode", err)
+	}
+	if _, err := os.Stat(req.Path); !os.IsNotExist(err) {
+		t.Errorf("file written despite the invalid mode: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package application
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// Resize writes the file at from to outPath at the size sizeSpec, keeping
+// its content and format valid: the generator for its type, identified by
+// its content (or a .bin extension), replaces or adds padding. Only generators implementing
+// ports.Resizer support it, and from must not be outPath.
+func (s *FileService) Resize(from, outPath, sizeSpec string) (FileResult, error) {
+	result := FileResult{Path: outPath, Size: ports.AnySize, TargetSize: ports.AnySize}
+	size, err := s.parser.Parse(sizeSpec)
+	if err != nil {
+		return result, fmt.Errorf("invalid size '%s': %w", sizeSpec, err)
+	}
+	result.TargetSize = size
+
+	f, srcSize, err := openRegular(from)
+	if err != nil {
+		return result, err
+	}
+	fileType, _, err := detectType(f, from, srcSize)
+	f.Close()
+	if err != nil {
+		return result, err
+	}
+	if fileType == "" && extensionType(from) == ports.FileTypeBIN {
+		// Raw binary has no signature to recognise it by.
+		fileType = ports.FileTypeBIN
+	}
+	if fileType == "" {
+		return result, fmt.Errorf("cannot identify the format of %s", from)
+	}
+	if same, err := sameFile(from, outPath); err != nil {
+		return result, err
+	} else if same {
+		return result, fmt.Errorf("cannot resize %s onto itself; choose another output", from)
+	}
+
+	generator, err := s.factory.For(fileType)
+	if err != nil {
+		return result, fmt.Errorf("no generator for type '%s': %w", fileType, err)
+	}
+	resizer, ok := ports.As[ports.Resizer](generator)
+	if !ok {
+		return result, fmt.Errorf("generator for type '%s' cannot resize files", fileType)
+	}
+	if err := resizer.Resize(from, outPath, size); err != nil {
+		return result, fmt.Errorf("failed to resize %s: %w", from, err)
+	}
+	if info, err := s.attrs().Stat(outPath); err == nil {
+		result.Size = info.Size()
+	}
+	return result, nil
+}
+
+// sameFile reports whether a and b name the same existing file.
+func sameFile(a, b string) (bool, error) {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", a, err)
+	}
+	bi, err := os.Stat(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", b, err)
+	}
+	return os.SameFile(ai, bi), nil
+}
@@ -0,0 +1,70 @@
+package application
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// MockResizer is a mock for ports.Resizer
+type MockResizer struct {
+	MockFileGenerator
+	ResizedFrom string
+}
+
+func (m *MockResizer) Resize(srcPath, outPath string, sizeBytes int64) error {
+	m.ResizedFrom = srcPath
+	return os.WriteFile(outPath, make([]byte, sizeBytes), 0o644)
+}
+
+func TestFileService_Resize(t *testing.T) {
+	tempDir := t.TempDir()
+	from := filepath.Join(tempDir, "real.pdf")
+	if err := os.WriteFile(from, []byte("%PDF-1.7\n%%EOF\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	parser := &MockSizeParser{ParseFunc: func(spec string) (int64, error) { return strconv.ParseInt(spec, 10, 64) }}
+
+	resizer := &MockResizer{}
+	var gotType ports.FileType
+	factory := &MockGeneratorFactory{ForFunc: func(t ports.FileType) (ports.FileGenerator, error) {
+		gotType = t
+		return resizer, nil
+	}}
+	service := NewFileService(factory, parser)
+	outPath := filepath.Join(tempDir, "out.pdf")
+	result, err := service.Resize(from, outPath, "2048")
+	if err != nil {
+		t.Fatalf("Resize() unexpected error = %v", err)
+	}
+	if gotType != ports.FileTypePDF || resizer.ResizedFrom != from {
+		t.Errorf("Resize() used the %q generator on %q, want pdf on %q", gotType, resizer.ResizedFrom, from)
+	}
+	if result.Path != outPath || result.Size != 2048 || result.TargetSize != 2048 {
+		t.Errorf("Resize() = %+v, want %s at 2048 bytes", result, outPath)
+	}
+
+	tests := []struct {
+		name    string
+		factory *MockGeneratorFactory
+		out     string
+		wantErr string
+	}{
+		{"Onto itself", factory, from, "onto itself"},
+		{"Generator cannot resize", &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) {
+			return &MockFileGenerator{}, nil
+		}}, outPath, "cannot resize files"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewFileService(tc.factory, parser).Resize(from, tc.out, "4096")
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Resize() error = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
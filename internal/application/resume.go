@@ -0,0 +1,178 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// Suffixes of the files a resumable generation keeps next to its path
+// until the file is complete: the file written so far, and the state to
+// resume it from.
+const (
+	partialSuffix = ".genfile-partial"
+	stateSuffix   = ".genfile-resume"
+)
+
+// resumeState is what the state file of a resumable generation holds:
+// the file asked for, so that a resume asking for another is refused, and
+// how far it got.
+type resumeState struct {
+	Type    ports.FileType `json:"type"`
+	Size    int64          `json:"size"`
+	Options ports.Options  `json:"options,omitempty"`
+	ports.ResumeState
+}
+
+// checkResume rejects requests that cannot be combined with resuming.
+func checkResume(req FileRequest) error {
+	switch {
+	case req.SizeSpec == "" || req.Lines > 0 || req.sizedByExtent():
+		return fmt.Errorf("resumable files need a size and no other target")
+	case req.Allocation != ports.AllocateWrite:
+		return fmt.Errorf("resumable files cannot be %s", req.Allocation)
+	case req.Throttle != "":
+		return fmt.Errorf("resumable files cannot be throttled")
+	case req.Tolerance != "" || req.TargetChecksum != "":
+		return fmt.Errorf("resumable files cannot have a tolerance or a checksum target")
+	case req.InPlace:
+		return fmt.Errorf("resumable files are renamed into place and cannot be written in place")
+	}
+	return nil
+}
+
+// createResumable writes req.Path as a partial file next to it, saving
+// the generator's progress in a state file as it goes, and renames it into
+// place once complete. If the state file is there, it carries on from
+// where the run that wrote it stopped. A failed file is kept, with its
+// state, for the next run to resume.
+func (s *FileService) createResumable(req FileRequest) (FileResult, error) {
+	result := FileResult{Path: req.Path, Size: ports.AnySize, TargetSize: ports.AnySize}
+	if err := checkResume(req); err != nil {
+		return result, err
+	}
+	var err error
+	if result.TargetSize, err = s.parser.Parse(req.SizeSpec); err != nil {
+		return result, fmt.Errorf("invalid size '%s': %w", req.SizeSpec, err)
+	}
+	mtime, err := parseMTime(req.MTime)
+	if err != nil {
+		return result, err
+	}
+	perms, err := parsePermissions(req)
+	if err != nil {
+		return result, err
+	}
+	fileType, generator, err := s.generatorFor(req.Path, req.Type)
+	result.Type = fileType
+	if err != nil {
+		return result, err
+	}
+	if generator, err = withMetadata(fileType, generator, req.Metadata); err != nil {
+		return result, err
+	}
+	if generator, err = withOptions(fileType, generator, req.Options); err != nil {
+		return result, err
+	}
+	rg, ok := ports.As[ports.ResumableGenerator](generator)
+	if !ok {
+		return result, fmt.Errorf("generator for type '%s' cannot resume", fileType)
+	}
+
+	partial, statePath := req.Path+partialSuffix, req.Path+stateSuffix
+	// A run that is resumed must write what the first one would have, down
+	// to the timestamps inside the file, so one is fixed if none is given.
+	state := resumeState{Type: fileType, Size: result.TargetSize, Options: withModTime(generator, req.Options, mtime)}
+	if mtime.IsZero() {
+		state.Options = withModTime(generator, req.Options, time.Now())
+	}
+	saved, err := loadResumeState(statePath)
+	switch {
+	case err != nil:
+		return result, err
+	case saved == nil:
+	case saved.Type != state.Type || saved.Size != state.Size:
+		return result, fmt.Errorf("%s is resuming a %d-byte %s, not a %d-byte %s", statePath, saved.Size, saved.Type, state.Size, state.Type)
+	default:
+		opts := maps.Clone(saved.Options)
+		if mtime.IsZero() {
+			delete(opts, "mtime")
+		}
+		if !maps.Equal(opts, withModTime(generator, req.Options, mtime)) {
+			return result, fmt.Errorf("%s is resuming a file with other options", statePath)
+		}
+		if _, err := os.Stat(partial); err == nil {
+			state = *saved
+		}
+	}
+
+	save := func(rs ports.ResumeState) error {
+		state.ResumeState = rs
+		return saveResumeState(statePath, state)
+	}
+	if err := save(state.ResumeState); err != nil {
+		return result, err
+	}
+	if err := rg.GenerateFrom(partial, result.TargetSize, state.Options, state.ResumeState, save); err != nil {
+		return result, fmt.Errorf("failed to generate %s, %s is kept to resume from: %w", req.Path, partial, err)
+	}
+	if !mtime.IsZero() {
+		if err := s.attrs().Chtimes(partial, mtime, mtime); err != nil {
+			return result, fmt.Errorf("failed to set the modification time of %s: %w", req.Path, err)
+		}
+	}
+	if err := perms.apply(s.attrs(), partial, req.Path); err != nil {
+		return result, err
+	}
+	info, statErr := s.attrs().Stat(partial)
+	if statErr == nil {
+		result.Size = info.Size()
+	}
+	if err := checkResultSize(result, req, req.Strict, 0, statErr); err != nil {
+		return result, err
+	}
+	if err := os.Rename(partial, req.Path); err != nil {
+		return result, fmt.Errorf("failed to move %s into place: %w", req.Path, err)
+	}
+	os.Remove(statePath)
+	return result, nil
+}
+
+// loadResumeState reads the state file at path; nil if there is none.
+func loadResumeState(path string) (*resumeState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var state resumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid resume state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// saveResumeState writes state to the state file at path, replacing it
+// whole so that a crash leaves either the old state or the new.
+func saveResumeState(path string, state resumeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o666); err != nil {
+		return fmt.Errorf("failed to save the resume state %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save the resume state %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package application
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// MockResumableGenerator is a mock for ports.ResumableGenerator. It
+// writes zeros from where it is resumed and, if FailAt is set, stops
+// there with a checkpoint.
+type MockResumableGenerator struct {
+	MockOptionsGenerator
+	FailAt int64
+	From   ports.ResumeState
+}
+
+func (m *MockResumableGenerator) GenerateFrom(path string, size int64, opts ports.Options, from ports.ResumeState, checkpoint func(ports.ResumeState) error) error {
+	m.From, m.CalledWithOptions = from, opts
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	end := size
+	if m.FailAt > 0 {
+		end = m.FailAt
+	}
+	if _, err := f.WriteAt(make([]byte, end-from.Offset), from.Offset); err != nil {
+		return err
+	}
+	if m.FailAt > 0 {
+		if err := checkpoint(ports.ResumeState{Phase: "data", Offset: m.FailAt}); err != nil {
+			return err
+		}
+		return errors.New("interrupted")
+	}
+	return nil
+}
+
+func TestFileService_CreateResumable(t *testing.T) {
+	tempDir := t.TempDir()
+	parser := &MockSizeParser{ParseFunc: func(spec string) (int64, error) { return strconv.ParseInt(spec, 10, 64) }}
+	gen := &MockResumableGenerator{FailAt: 1000}
+	service := NewFileService(&MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return gen, nil }}, parser)
+	path := filepath.Join(tempDir, "big.bin")
+	req := FileRequest{Path: path, SizeSpec: "4096", Resume: true}
+
+	if _, err := service.Create(req); err == nil || !strings.Contains(err.Error(), "kept to resume from") {
+		t.Fatalf("interrupted Create() error = %v", err)
+	}
+	state, err := loadResumeState(path + stateSuffix)
+	if err != nil || state == nil || state.Offset != 1000 || state.Options["mtime"] == "" {
+		t.Fatalf("state after the interruption = %+v, %v; want offset 1000 and an mtime", state, err)
+	}
+
+	gen.FailAt = 0
+	result, err := service.Create(req)
+	if err != nil {
+		t.Fatalf("resumed Create() error = %v", err)
+	}
+	if gen.From.Offset != 1000 || gen.CalledWithOptions["mtime"] != state.Options["mtime"] {
+		t.Errorf("resumed from %+v with %v, want offset 1000 and the saved options", gen.From, gen.CalledWithOptions)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 4096 || result.Size != 4096 {
+		t.Errorf("resumed file is %v, %v; want 4096 bytes", info, err)
+	}
+	for _, leftover := range []string{path + partialSuffix, path + stateSuffix} {
+		if _, err := os.Stat(leftover); err == nil {
+			t.Errorf("%s left behind", leftover)
+		}
+	}
+
+	if err := saveResumeState(path+stateSuffix, resumeState{Type: ports.FileTypeBIN, Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		gen     ports.FileGenerator
+		req     FileRequest
+		wantErr string
+	}{
+		{"Other file", gen, req, "is resuming a 1-byte bin"},
+		{"Not resumable", &MockFileGenerator{}, FileRequest{Path: filepath.Join(tempDir, "a.bin"), SizeSpec: "10", Resume: true}, "cannot resume"},
+		{"Line count", gen, FileRequest{Path: filepath.Join(tempDir, "a.bin"), SizeSpec: "10", Lines: 5, Resume: true}, "need a size and no other target"},
+		{"In place", gen, FileRequest{Path: filepath.Join(tempDir, "a.bin"), SizeSpec: "10", InPlace: true, Resume: true}, "in place"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			service := NewFileService(&MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}, parser)
+			if _, err := service.Create(tc.req); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Create() error = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
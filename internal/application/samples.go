@@ -0,0 +1,45 @@
+package application
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// sampleSize is the size of the samples of formats that do not plan their
+// smallest file: small, yet above the minimum of every format. It is
+// rounded up to the generator's size step, such as the 81-byte records of
+// fixed-width files.
+const sampleSize = 64 * 1024
+
+// CreateSample creates a small valid file of the format named by fileType
+// (an extension such as "png") in dir, created if missing, as
+// sample.<fileType>. It is the smallest file the generator can write when
+// it plans its output, and sampleSize bytes otherwise, rounded up to a
+// whole number of the generator's size steps.
+func (s *FileService) CreateSample(fileType, dir string) (FileResult, error) {
+	path := filepath.Join(dir, "sample."+fileType)
+	result := FileResult{Path: path, Size: ports.AnySize, TargetSize: ports.AnySize}
+	_, generator, err := s.generatorFor(path, fileType)
+	if err != nil {
+		return result, err
+	}
+	size := int64(sampleSize)
+	if planner, ok := ports.As[ports.Planner](generator); ok {
+		if plan, err := planner.Plan(0); err == nil && plan.MinSize > 0 {
+			size = plan.MinSize
+		}
+	}
+	if stepper, ok := ports.As[ports.SizeStepper](generator); ok {
+		if step := stepper.SizeStep(); step > 1 {
+			size = (size + step - 1) / step * step
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return result, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	return s.Create(FileRequest{Path: path, Type: fileType, SizeSpec: strconv.FormatInt(size, 10)})
+}
@@ -0,0 +1,64 @@
+package application
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+func TestFileService_CreateSample(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "pack")
+	write := func(outPath string, sizeBytes int64) error {
+		return os.WriteFile(outPath, make([]byte, sizeBytes), 0o644)
+	}
+	parser := &MockSizeParser{ParseFunc: func(spec string) (int64, error) { return strconv.ParseInt(spec, 10, 64) }}
+
+	t.Run("Preset size", func(t *testing.T) {
+		gen := &MockFileGenerator{GenerateFunc: write}
+		service := NewFileService(&MockGeneratorFactory{MockGenerator: gen}, parser)
+		result, err := service.CreateSample("txt", dir)
+		if err != nil {
+			t.Fatalf("CreateSample() unexpected error = %v", err)
+		}
+		if result.Path != filepath.Join(dir, "sample.txt") || result.Size != sampleSize {
+			t.Errorf("CreateSample() = %s of %d bytes", result.Path, result.Size)
+		}
+	})
+
+	t.Run("Planned minimum", func(t *testing.T) {
+		gen := &MockPlanner{MockFileGenerator: MockFileGenerator{GenerateFunc: write}}
+		factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return gen, nil }}
+		service := NewFileService(factory, parser)
+		result, err := service.CreateSample("xlsx", dir)
+		if err != nil {
+			t.Fatalf("CreateSample() unexpected error = %v", err)
+		}
+		if result.Size != 100 {
+			t.Errorf("CreateSample() = %d bytes, want the planned minimum of 100", result.Size)
+		}
+	})
+
+	t.Run("Size step", func(t *testing.T) {
+		gen := &MockSizeStepper{MockFileGenerator: MockFileGenerator{GenerateFunc: write}, Step: 81}
+		factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return gen, nil }}
+		service := NewFileService(factory, parser)
+		result, err := service.CreateSample("fwf", dir)
+		if err != nil {
+			t.Fatalf("CreateSample() unexpected error = %v", err)
+		}
+		if result.Size != 810*81 {
+			t.Errorf("CreateSample() = %d bytes, want %d rounded up to 81-byte records", result.Size, sampleSize)
+		}
+	})
+
+	t.Run("Unknown type", func(t *testing.T) {
+		service := NewFileService(&MockGeneratorFactory{MockGenerator: &MockFileGenerator{}}, parser)
+		if _, err := service.CreateSample("unknown", dir); err == nil || !strings.Contains(err.Error(), "unsupported file extension") {
+			t.Errorf("CreateSample(unknown) error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// Sidecar is the JSON descriptor written next to a generated file with
+// FileRequest.Sidecar, for test suites to assert against without knowing
+// how the file was made.
+type Sidecar struct {
+	File       string            `json:"file"` // name of the file, next to the sidecar
+	Type       ports.FileType    `json:"type"`
+	Size       int64             `json:"size"`
+	TargetSize *int64            `json:"target_size,omitempty"`
+	Lines      int64             `json:"lines,omitempty"`
+	Seed       *int64            `json:"seed,omitempty"` // the seed of a seeded fill, which gives the same bytes again
+	Options    ports.Options     `json:"options,omitempty"`
+	Metadata   ports.Metadata    `json:"metadata,omitempty"`
+	Checksums  map[string]string `json:"checksums"`
+	Tokens     []SidecarToken    `json:"tokens,omitempty"`
+	Companions []SidecarFile     `json:"companions,omitempty"`
+	Stats      ports.Stats       `json:"stats,omitempty"`
+}
+
+// SidecarFile describes a companion of the file a Sidecar describes.
+type SidecarFile struct {
+	File      string            `json:"file"`
+	Size      int64             `json:"size"`
+	Checksums map[string]string `json:"checksums"`
+}
+
+// SidecarToken is ground truth planted in the file: a string and how many
+// times it appears, or the manifest listing the items planted.
+type SidecarToken struct {
+	Kind     string `json:"kind"` // embed-string, eicar or pii
+	Text     string `json:"text,omitempty"`
+	Count    int    `json:"count"`
+	Manifest string `json:"manifest,omitempty"`
+}
+
+// secretOptions are left out of a sidecar's options.
+var secretOptions = []string{"zip-password"}
+
+// tokenTypes lists the formats that plant the tokens of the
+// "embed-string" and "eicar" options; the others ignore them.
+var tokenTypes = map[string][]ports.FileType{
+	"embed-string": {ports.FileTypeTXT, ports.FileTypeLog, ports.FileTypeMD, ports.FileTypeCSV, ports.FileTypePDF, ports.FileTypeDOCX},
+	"eicar":        {ports.FileTypeTXT, ports.FileTypeLog, ports.FileTypeMD, ports.FileTypeZIP, ports.FileTypePDF, ports.FileTypeDOCX},
+}
+
+// SidecarPath returns the path of the sidecar of the file at path: its
+// name with .json appended, so that files differing in extension only do
+// not share one.
+func SidecarPath(path string) string {
+	return path + ".json"
+}
+
+// createWithSidecar creates the file req describes, then its sidecar.
+func (s *FileService) createWithSidecar(req FileRequest) (FileResult, error) {
+	req.Sidecar = false
+	result, err := s.Create(req)
+	if err != nil {
+		return result, err
+	}
+	result.Sidecar, err = s.writeSidecar(result, req)
+	return result, err
+}
+
+// writeSidecar writes the sidecar of the file result reports, created
+// for req, and returns its path.
+func (s *FileService) writeSidecar(result FileResult, req FileRequest) (string, error) {
+	path := SidecarPath(result.Path)
+	sc := Sidecar{
+		File:     filepath.Base(result.Path),
+		Type:     result.Type,
+		Size:     result.Size,
+		Lines:    result.Lines,
+		Options:  maps.Clone(req.Options),
+		Metadata: req.Metadata,
+		Stats:    result.Stats,
+	}
+	for _, key := range secretOptions {
+		delete(sc.Options, key)
+	}
+	if len(sc.Options) == 0 {
+		sc.Options = nil
+	}
+	if len(sc.Metadata) == 0 {
+		sc.Metadata = nil
+	}
+	if len(sc.Stats) == 0 {
+		sc.Stats = nil
+	}
+	if result.TargetSize != ports.AnySize {
+		sc.TargetSize = &result.TargetSize
+	}
+	if v := req.Options.String("seed", ""); v != "" {
+		seed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return path, fmt.Errorf("seed must be a whole number, got %q", v)
+		}
+		sc.Seed = &seed
+	} else if req.Options.String("bin-fill", "") == "seeded" {
+		seed, err := req.Options.Int("bin-seed", 1)
+		if err != nil {
+			return path, err
+		}
+		seed64 := int64(seed)
+		sc.Seed = &seed64
+	}
+
+	var err error
+	if sc.Checksums, err = checksums(result.Path); err != nil {
+		return path, err
+	}
+	for _, c := range result.Companions {
+		f := SidecarFile{File: filepath.Base(c.Path), Size: c.Size}
+		if f.Checksums, err = checksums(c.Path); err != nil {
+			return path, err
+		}
+		sc.Companions = append(sc.Companions, f)
+	}
+	if sc.Tokens, err = sidecarTokens(result, req.Options); err != nil {
+		return path, err
+	}
+
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return path, err
+	}
+	f, err := s.create(path)
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return path, fmt.Errorf("failed to write sidecar %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// sidecarTokens returns the ground truth the options planted in the file
+// result reports: the "embed-string" needle, the EICAR string and the
+// personal data of the pii content profile, counted from its manifest.
+func sidecarTokens(result FileResult, opts ports.Options) ([]SidecarToken, error) {
+	var tokens []SidecarToken
+	needle, err := utils.ParseNeedle(opts.String("embed-string", ""), opts.String("embed-count", ""))
+	if err != nil {
+		return nil, err
+	}
+	if needle.Count > 0 && slices.Contains(tokenTypes["embed-string"], result.Type) {
+		tokens = append(tokens, SidecarToken{Kind: "embed-string", Text: needle.Text, Count: needle.Count})
+	}
+	if eicar, _ := opts.Bool("eicar", false); eicar && slices.Contains(tokenTypes["eicar"], result.Type) {
+		tokens = append(tokens, SidecarToken{Kind: "eicar", Text: string(utils.EICAR()), Count: 1})
+	}
+	manifest := utils.PIIManifestPath(result.Path)
+	for _, c := range result.Companions {
+		if c.Path != manifest {
+			continue
+		}
+		data, err := os.ReadFile(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the PII manifest: %w", err)
+		}
+		var m struct {
+			Counts map[string]int `json:"counts"`
+		}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("failed to read the PII manifest: %w", err)
+		}
+		token := SidecarToken{Kind: "pii", Manifest: filepath.Base(manifest)}
+		for _, n := range m.Counts {
+			token.Count += n
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
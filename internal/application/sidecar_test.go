@@ -0,0 +1,118 @@
+package application
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// MockPIIGenerator is a mock for ports.SetGenerator that writes "abc" and
+// a PII manifest of two items.
+type MockPIIGenerator struct {
+	MockFileGenerator
+}
+
+func (m *MockPIIGenerator) GenerateSet(basePath string, sizeBytes int64) ([]string, error) {
+	if err := os.WriteFile(basePath, []byte("abc"), 0o644); err != nil {
+		return nil, err
+	}
+	manifest, err := utils.WritePIIManifest(basePath, []utils.PIIItem{{Type: utils.PIISSN}, {Type: utils.PIIEmail}}, func(path string, data []byte) error {
+		return os.WriteFile(path, data, 0o644)
+	})
+	return []string{basePath, manifest}, err
+}
+
+func TestFileService_CreateSidecar(t *testing.T) {
+	const sha256ABC = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	writeABC := &MockOptionsGenerator{MockFileGenerator: MockFileGenerator{GenerateFunc: func(path string, _ int64) error {
+		return os.WriteFile(path, []byte("abc"), 0o644)
+	}}}
+	seed := int64(7)
+	target := int64(10 * 1024)
+
+	testCases := []struct {
+		name      string
+		generator ports.FileGenerator
+		file      string
+		opts      ports.Options
+		want      Sidecar
+	}{
+		{
+			name:      "Tokens",
+			generator: writeABC,
+			file:      "a.txt",
+			opts:      ports.Options{"embed-string": "NEEDLE", "embed-count": "3", "eicar": "true", "zip-password": "secret", "bin-fill": "seeded", "bin-seed": "7"},
+			want: Sidecar{
+				File: "a.txt", Type: ports.FileTypeTXT, Size: 3, TargetSize: &target, Seed: &seed,
+				Options: ports.Options{"embed-string": "NEEDLE", "embed-count": "3", "eicar": "true", "bin-fill": "seeded", "bin-seed": "7"},
+				Tokens: []SidecarToken{
+					{Kind: "embed-string", Text: "NEEDLE", Count: 3},
+					{Kind: "eicar", Text: string(utils.EICAR()), Count: 1},
+				},
+			},
+		},
+		{
+			name:      "Seed",
+			generator: writeABC,
+			file:      "a.txt",
+			opts:      ports.Options{"seed": "7"},
+			want:      Sidecar{File: "a.txt", Type: ports.FileTypeTXT, Size: 3, TargetSize: &target, Seed: &seed, Options: ports.Options{"seed": "7"}},
+		},
+		{
+			name:      "IgnoredTokens",
+			generator: writeABC,
+			file:      "a.png",
+			opts:      ports.Options{"eicar": "true"},
+			want:      Sidecar{File: "a.png", Type: ports.FileTypePNG, Size: 3, TargetSize: &target, Options: ports.Options{"eicar": "true"}},
+		},
+		{
+			name:      "PIIManifest",
+			generator: &MockPIIGenerator{},
+			file:      "a.txt",
+			want: Sidecar{
+				File: "a.txt", Type: ports.FileTypeTXT, Size: 3, TargetSize: &target,
+				Tokens: []SidecarToken{{Kind: "pii", Count: 2, Manifest: "a.pii.json"}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.generator, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+			path := filepath.Join(t.TempDir(), tc.file)
+
+			result, err := service.Create(FileRequest{Path: path, SizeSpec: "10KB", Options: tc.opts, Sidecar: true})
+			if err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			if result.Sidecar != path+".json" {
+				t.Errorf("Create() sidecar = %q, want %q", result.Sidecar, path+".json")
+			}
+			data, err := os.ReadFile(result.Sidecar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Sidecar
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("sidecar is not JSON: %v", err)
+			}
+			if got.Checksums["sha256"] != sha256ABC || len(got.Checksums) != 3 {
+				t.Errorf("sidecar checksums = %v, want md5, sha1 and sha256 of abc", got.Checksums)
+			}
+			for _, c := range got.Companions {
+				if c.Size <= 0 || len(c.Checksums) != 3 {
+					t.Errorf("companion %+v has no size or checksums", c)
+				}
+			}
+			got.Checksums, got.Companions = nil, nil
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("sidecar = %+v\nwant %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package application
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// sniffLen is how much of the start of a file Sniff looks at.
+const sniffLen = 64 * 1024
+
+// signature is a magic number: the bytes a format starts with, or holds
+// at a fixed offset.
+type signature struct {
+	fileType ports.FileType
+	offset   int
+	magic    string
+}
+
+// signatures lists the magic numbers of the binary formats, most specific
+// first where one is a prefix of another.
+var signatures = []signature{
+	{ports.FileTypePNG, 0, "\x89PNG\r\n\x1a\n"},
+	{ports.FileTypeJPEG, 0, "\xff\xd8\xff"},
+	{ports.FileTypeGIF, 0, "GIF87a"},
+	{ports.FileTypeGIF, 0, "GIF89a"},
+	{ports.FileTypeTIFF, 0, "II*\x00"},
+	{ports.FileTypeTIFF, 0, "MM\x00*"},
+	{ports.FileTypeTIFF, 0, "II+\x00"},
+	{ports.FileTypeTIFF, 0, "MM\x00+"},
+	{ports.FileTypeJP2, 0, "\x00\x00\x00\x0cjP  \r\n\x87\n"},
+	{ports.FileTypeDJVU, 0, "AT&TFORM"},
+	{ports.FileTypePSD, 0, "8BPS"},
+	{ports.FileTypeWAV, 8, "WAVE"},
+	{ports.FileTypeMP4, 4, "ftyp"},
+	{ports.FileTypeDWG, 0, "AC10"},
+	{ports.FileTypeDXF, 0, "AutoCAD Binary DXF\r\n\x1a\x00"},
+	{ports.FileTypeSHP, 0, "\x00\x00\x27\x0a"},
+	{ports.FileTypePDF, 0, "%PDF-"},
+	{ports.FileTypeMDB, 4, "Standard Jet DB\x00"},
+	{ports.FileTypeACCDB, 4, "Standard ACE DB\x00"},
+	{ports.FileTypeCFB, 0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"},
+	{ports.FileTypeDEB, 0, "!<arch>\ndebian-binary"},
+	{ports.FileTypeRPM, 0, "\xed\xab\xee\xdb"},
+	{ports.FileTypeZIP, 0, "PK\x03\x04"},
+	{ports.FileTypeZIP, 0, "PK\x05\x06"},
+	{ports.FileTypeOCI, 257, "ustar"},
+	{ports.FileTypeNPM, 0, "\x1f\x8b"},
+	// A registry export in UTF-16LE, after its byte order mark.
+	{ports.FileTypeREG, 0, "\xff\xfeW\x00i\x00n\x00d\x00o\x00w\x00s\x00 \x00R\x00e\x00g\x00"},
+}
+
+// Sniff returns the type of the size-byte file r holds, recognised by its
+// magic numbers or, for text formats, by how it starts. It returns "" for
+// plain text and for content it does not recognise.
+func Sniff(r io.ReaderAt, size int64) (ports.FileType, error) {
+	header := make([]byte, min(size, sniffLen))
+	if _, err := r.ReadAt(header, 0); err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read file header: %w", err)
+	}
+	for _, sig := range signatures {
+		if !bytes.HasPrefix(header[min(sig.offset, len(header)):], []byte(sig.magic)) {
+			continue
+		}
+		switch sig.fileType {
+		case ports.FileTypeWAV:
+			if !bytes.HasPrefix(header, []byte("RIFF")) {
+				continue
+			}
+		case ports.FileTypeMP4:
+			return sniffISOBrand(header), nil
+		case ports.FileTypePDF:
+			return sniffPDF(header), nil
+		case ports.FileTypeZIP:
+			return sniffZIP(r, size), nil
+		case ports.FileTypeOCI:
+			return sniffTar(r, size), nil
+		case ports.FileTypeNPM:
+			return sniffGzip(r, size), nil
+		}
+		return sig.fileType, nil
+	}
+	if !isText(header) {
+		return "", nil
+	}
+	return sniffText(header), nil
+}
+
+// sniffISOBrand tells M4V from MP4 by the major brand of an ISO media
+// file's ftyp box.
+func sniffISOBrand(header []byte) ports.FileType {
+	if len(header) >= 12 && string(header[8:12]) == "M4V " {
+		return ports.FileTypeM4V
+	}
+	return ports.FileTypeMP4
+}
+
+// sniffPDF tells Illustrator documents, which are PDFs carrying
+// Illustrator private data, from other PDFs.
+func sniffPDF(header []byte) ports.FileType {
+	if bytes.Contains(header, []byte("/Illustrator")) || bytes.Contains(header, []byte("%AI")) {
+		return ports.FileTypeAI
+	}
+	return ports.FileTypePDF
+}
+
+// sniffZIP tells the OOXML, XPS, Java and Android formats from other ZIP
+// archives by the parts they hold. APKs and WARs may carry a JAR manifest,
+// so a manifest alone makes a JAR only once the whole archive is read.
+func sniffZIP(r io.ReaderAt, size int64) ports.FileType {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return ports.FileTypeZIP
+	}
+	fileType := ports.FileTypeZIP
+	for _, f := range zr.File {
+		switch f.Name {
+		case "word/document.xml":
+			return ports.FileTypeDOCX
+		case "xl/workbook.xml":
+			return ports.FileTypeXLSX
+		case "AndroidManifest.xml":
+			return ports.FileTypeAPK
+		case "WEB-INF/web.xml":
+			return ports.FileTypeWAR
+		case "META-INF/MANIFEST.MF":
+			fileType = ports.FileTypeJAR
+		}
+		if strings.HasSuffix(f.Name, ".dist-info/WHEEL") {
+			return ports.FileTypeWHL
+		}
+		if strings.HasSuffix(f.Name, ".fdseq") {
+			return ports.FileTypeXPS
+		}
+	}
+	return fileType
+}
+
+// sniffTar recognises image archives, OCI layouts and docker save
+// tarballs, among tar archives by the entries they hold. It returns "" for
+// other tar archives.
+func sniffTar(r io.ReaderAt, size int64) ports.FileType {
+	tr := tar.NewReader(io.NewSectionReader(r, 0, size))
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return ""
+		}
+		switch hdr.Name {
+		case "oci-layout", "index.json", "manifest.json":
+			return ports.FileTypeOCI
+		}
+	}
+}
+
+// sniffGzip recognises npm package tarballs, whose first entry is
+// package/package.json, among gzipped files. It returns "" for others.
+func sniffGzip(r io.ReaderAt, size int64) ports.FileType {
+	zr, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return ""
+	}
+	hdr, err := tar.NewReader(zr).Next()
+	if err != nil || hdr.Name != "package/package.json" {
+		return ""
+	}
+	return ports.FileTypeNPM
+}
+
+// sniffText recognises the text formats that announce themselves in their
+// first bytes.
+func sniffText(header []byte) ports.FileType {
+	s := strings.TrimPrefix(string(header), "\ufeff")
+	trimmed := strings.TrimLeft(s, " \t\r\n")
+	lower := strings.ToLower(trimmed[:min(len(trimmed), 512)])
+	switch {
+	case strings.HasPrefix(s, "MSH|"):
+		return ports.FileTypeHL7
+	case strings.HasPrefix(s, "Windows Registry Editor Version 5.00"), strings.HasPrefix(s, "REGEDIT4"):
+		return ports.FileTypeREG
+	case strings.HasPrefix(s, "%!PS"):
+		return ports.FileTypePS
+	case strings.HasPrefix(s, "WEBVTT") && (len(s) == 6 || strings.ContainsRune(" \t\r\n", rune(s[6]))):
+		return ports.FileTypeVTT
+	case isSRT(trimmed):
+		return ports.FileTypeSRT
+	case strings.HasPrefix(s, "#EXTM3U"):
+		return ports.FileTypeM3U8
+	case strings.HasPrefix(s, "ISA"), strings.HasPrefix(s, "UNA"), strings.HasPrefix(s, "UNB+"):
+		return ports.FileTypeEDI
+	case strings.HasPrefix(lower, "<!doctype html"), strings.HasPrefix(lower, "<html"):
+		return ports.FileTypeHTML
+	case strings.HasPrefix(lower, "<?xml"):
+		if strings.Contains(lower, "<html") {
+			return ports.FileTypeHTML
+		}
+		if strings.Contains(lower, "<mpd") {
+			return ports.FileTypeMPD
+		}
+		return ports.FileTypeXML
+	case strings.HasPrefix(trimmed, "-----BEGIN "):
+		return sniffPEM(trimmed)
+	case isDXF(trimmed):
+		return ports.FileTypeDXF
+	case isINI(trimmed):
+		return ports.FileTypeINI
+	case isJSON(trimmed):
+		if first, rest, ok := strings.Cut(trimmed, "\n"); ok && strings.HasSuffix(strings.TrimSpace(first), "}") && isJSON(rest) {
+			return ports.FileTypeNDJSON
+		}
+		return ports.FileTypeJSON
+	}
+	return ""
+}
+
+// sniffPEM tells certificates, private keys and bundles of both apart by
+// the PEM blocks they hold. It returns "" for other PEM files.
+func sniffPEM(s string) ports.FileType {
+	cert := strings.Contains(s, "-----BEGIN CERTIFICATE-----")
+	key := strings.Contains(s, "PRIVATE KEY-----")
+	switch {
+	case cert && key:
+		return ports.FileTypePEM
+	case cert:
+		return ports.FileTypeCRT
+	case key:
+		return ports.FileTypeKEY
+	}
+	return ""
+}
+
+// isJSON reports whether s starts like a JSON object or array: a brace
+// or bracket, after any whitespace, followed by what may open its first
+// member.
+func isJSON(s string) bool {
+	s = strings.TrimLeft(s, " \t\r\n")
+	if s == "" || (s[0] != '{' && s[0] != '[') {
+		return false
+	}
+	next := strings.TrimLeft(s[1:], " \t\r\n")
+	if next == "" {
+		return false
+	}
+	if s[0] == '{' {
+		return next[0] == '"' || next[0] == '}'
+	}
+	return strings.IndexByte(`{["-0123456789tfn]`, next[0]) >= 0
+}
+
+// isINI reports whether s starts like an INI file: a [section] header,
+// after any comment lines, followed by a key=value setting or another
+// section.
+func isINI(s string) bool {
+	var lines []string
+	for _, line := range strings.SplitN(s, "\n", 32) {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if lines = append(lines, line); len(lines) == 2 {
+			break
+		}
+	}
+	if len(lines) < 2 {
+		return false
+	}
+	section := lines[0]
+	if len(section) < 3 || section[0] != '[' || section[len(section)-1] != ']' || strings.ContainsAny(section[1:len(section)-1], "[]\"=,") {
+		return false
+	}
+	next := lines[1]
+	return next[0] == '[' || (strings.IndexByte(next, '=') > 0 && next[0] != '"' && next[0] != '{')
+}
+
+// isSRT reports whether s starts with a SubRip cue: a number, then a
+// timing line such as "00:00:01,000 --> 00:00:04,000".
+func isSRT(s string) bool {
+	num, rest, ok := strings.Cut(s, "\n")
+	if _, err := strconv.Atoi(strings.TrimSpace(num)); !ok || err != nil {
+		return false
+	}
+	timing, _, _ := strings.Cut(rest, "\n")
+	start, end, ok := strings.Cut(strings.TrimSpace(timing), " --> ")
+	return ok && strings.Count(start, ":") == 2 && strings.Contains(start, ",") && strings.Count(end, ":") == 2
+}
+
+// isDXF reports whether s starts with a DXF group code 0 opening a
+// SECTION, as every DXF file does.
+func isDXF(s string) bool {
+	code, rest, ok := strings.Cut(s, "\n")
+	if !ok || strings.TrimSpace(code) != "0" {
+		return false
+	}
+	value, _, _ := strings.Cut(rest, "\n")
+	return strings.TrimSpace(value) == "SECTION"
+}
+
+// isText reports whether header looks like text: UTF-8 without NUL bytes.
+// A rune cut off at the end of the header is allowed.
+func isText(header []byte) bool {
+	if bytes.IndexByte(header, 0) >= 0 {
+		return false
+	}
+	for i := 0; i < len(header); {
+		r, n := utf8.DecodeRune(header[i:])
+		if r == utf8.RuneError && n == 1 && len(header)-i >= utf8.UTFMax {
+			return false
+		}
+		i += n
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SplitFile cuts the file at path into consecutive parts of at most partSpec
+// bytes (e.g., "100MB"), named path.001, path.002, ... in the plain-chunk
+// layout understood by 7-Zip and `cat`. The original file is removed once
+// all parts are written. It returns the part paths in order.
+func (s *FileService) SplitFile(path, partSpec string) ([]string, error) {
+	partSize, err := s.parser.Parse(partSpec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid split size '%s': %w", partSpec, err)
+	}
+	if partSize <= 0 {
+		return nil, fmt.Errorf("split size must be positive, got %d", partSize)
+	}
+	parts, err := s.splitFile(path, partSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split %s: %w", path, err)
+	}
+	return parts, nil
+}
+
+// splitFile does the work for SplitFile. On failure it removes any parts it
+// already wrote and leaves the original untouched.
+func (s *FileService) splitFile(path string, partSize int64) (parts []string, err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	count := (info.Size() + partSize - 1) / partSize
+	if count == 0 {
+		count = 1 // an empty file still yields one (empty) part
+	}
+	width := max(len(fmt.Sprint(count)), 3)
+
+	defer func() {
+		if err != nil {
+			for _, p := range parts {
+				os.Remove(p)
+			}
+			parts = nil
+		}
+	}()
+
+	for i := int64(1); i <= count; i++ {
+		partPath := fmt.Sprintf("%s.%0*d", path, width, i)
+		dst, err := s.create(partPath)
+		if err != nil {
+			return parts, err
+		}
+		parts = append(parts, partPath)
+		_, copyErr := io.CopyN(dst, src, partSize)
+		closeErr := dst.Close()
+		if copyErr != nil && !errors.Is(copyErr, io.EOF) {
+			return parts, copyErr
+		}
+		if closeErr != nil {
+			return parts, closeErr
+		}
+	}
+
+	src.Close()
+	if err := os.Remove(path); err != nil {
+		return parts, err
+	}
+	return parts, nil
+}
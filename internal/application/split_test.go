@@ -0,0 +1,82 @@
+package application
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileService_SplitFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		size      int
+		partSpec  string
+		wantParts []string
+		wantErr   bool
+	}{
+		{"Even split", 3 * 1024, "1KB", []string{"f.bin.001", "f.bin.002", "f.bin.003"}, false},
+		{"Uneven split", 2500, "1KB", []string{"f.bin.001", "f.bin.002", "f.bin.003"}, false},
+		{"Single part", 100, "1KB", []string{"f.bin.001"}, false},
+		{"Empty file", 0, "1KB", []string{"f.bin.001"}, false},
+		{"Bad spec", 100, "badsize", nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := filepath.Join(tempDir, tc.name)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "f.bin")
+			data := bytes.Repeat([]byte("0123456789"), tc.size/10+1)[:tc.size]
+			if err := os.WriteFile(path, data, 0o666); err != nil {
+				t.Fatal(err)
+			}
+
+			parser := &MockSizeParser{ParseFunc: func(spec string) (int64, error) {
+				if spec == "1KB" {
+					return 1024, nil
+				}
+				return (&MockSizeParser{}).Parse(spec)
+			}}
+			service := NewFileService(&MockGeneratorFactory{}, parser)
+			parts, err := service.SplitFile(path, tc.partSpec)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("SplitFile() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				if _, statErr := os.Stat(path); statErr != nil {
+					t.Errorf("original file should be kept on error: %v", statErr)
+				}
+				return
+			}
+
+			if len(parts) != len(tc.wantParts) {
+				t.Fatalf("SplitFile() returned %d parts, want %d", len(parts), len(tc.wantParts))
+			}
+			var joined []byte
+			for i, p := range parts {
+				if filepath.Base(p) != tc.wantParts[i] {
+					t.Errorf("part %d = %q, want %q", i, filepath.Base(p), tc.wantParts[i])
+				}
+				b, err := os.ReadFile(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(b) > 1024 {
+					t.Errorf("part %s is %d bytes, larger than the split size", p, len(b))
+				}
+				joined = append(joined, b...)
+			}
+			if !bytes.Equal(joined, data) {
+				t.Errorf("rejoined parts do not match the original content")
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("original file should be removed after splitting")
+			}
+		})
+	}
+}
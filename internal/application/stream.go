@@ -0,0 +1,122 @@
+package application
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hailam/genfile/internal/ports"
+	"github.com/hailam/genfile/internal/utils"
+)
+
+// Stream writes the file described by req to w rather than to disk; req.Path
+// only names the output and, without req.Type, selects the format.
+// Generators implementing ports.StreamGenerator write straight to w. Other
+// generators, and requests with a line count, a duration, a count, a
+// resolution, a tolerance or a checksum target, generate into a temporary
+// file that is then copied to w.
+// req.Throttle paces the writes to w.
+func (s *FileService) Stream(w io.Writer, req FileRequest) (FileResult, error) {
+	req, err := resolveMIME(req)
+	if err != nil {
+		return FileResult{Path: req.Path, Size: ports.AnySize, TargetSize: ports.AnySize}, err
+	}
+	fileType, generator, err := s.generatorFor(req.Path, req.Type)
+	if err != nil {
+		return FileResult{Path: req.Path, Size: ports.AnySize, TargetSize: ports.AnySize}, err
+	}
+	if generator, err = withMetadata(fileType, generator, req.Metadata); err != nil {
+		return FileResult{Path: req.Path, Type: fileType, Size: ports.AnySize, TargetSize: ports.AnySize}, err
+	}
+	if generator, err = withOptions(fileType, generator, req.Options); err != nil {
+		return FileResult{Path: req.Path, Type: fileType, Size: ports.AnySize, TargetSize: ports.AnySize}, err
+	}
+	if req.Allocation != ports.AllocateWrite {
+		return FileResult{Path: req.Path, Type: fileType, Size: ports.AnySize, TargetSize: ports.AnySize}, fmt.Errorf("%s files cannot be streamed", req.Allocation)
+	}
+	if _, ok := ports.As[ports.SetGenerator](generator); ok {
+		return FileResult{Path: req.Path, Type: fileType, Size: ports.AnySize, TargetSize: ports.AnySize}, fmt.Errorf("%s files come with companion files and cannot be streamed", fileType)
+	}
+	mtime, err := parseMTime(req.MTime)
+	if err != nil {
+		return FileResult{Path: req.Path, Type: fileType, Size: ports.AnySize, TargetSize: ports.AnySize}, err
+	}
+	if req.Throttle != "" {
+		rate, err := s.parseRate(req.Throttle)
+		if err != nil {
+			return FileResult{Path: req.Path, Type: fileType, Size: ports.AnySize, TargetSize: ports.AnySize}, err
+		}
+		w = utils.NewThrottledWriter(w, rate)
+		req.Throttle = ""
+	}
+	sg, ok := ports.As[ports.StreamGenerator](generator)
+	if !ok || req.SizeSpec == "" || req.Lines > 0 || req.sizedByExtent() || req.Tolerance != "" || req.TargetChecksum != "" {
+		return s.streamViaFile(w, req, fileType)
+	}
+
+	result := FileResult{Path: req.Path, Type: fileType, Size: ports.AnySize}
+	if result.TargetSize, err = s.parser.Parse(req.SizeSpec); err != nil {
+		return result, fmt.Errorf("invalid size '%s': %w", req.SizeSpec, err)
+	}
+	cw := &countingWriter{w: w}
+	err = sg.GenerateTo(cw, result.TargetSize, withModTime(generator, req.Options, mtime))
+	result.Size = cw.n
+	if err != nil {
+		return result, fmt.Errorf("failed to generate %s: %w", req.Path, err)
+	}
+	if req.Strict && result.Deviation() != 0 {
+		return result, fmt.Errorf("generated %s is %d bytes, want exactly %d", req.Path, result.Size, result.TargetSize)
+	}
+	return result, nil
+}
+
+// streamViaFile generates req into a temporary file and copies it to w.
+func (s *FileService) streamViaFile(w io.Writer, req FileRequest, fileType ports.FileType) (FileResult, error) {
+	result, path, cleanup, err := s.createTemp(req, fileType)
+	defer cleanup()
+	if err != nil {
+		return result, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return result, fmt.Errorf("failed to read generated %s: %w", req.Path, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return result, fmt.Errorf("failed to write %s: %w", req.Path, err)
+	}
+	return result, nil
+}
+
+// createTemp generates req with Create into a new temporary directory,
+// which cleanup removes again.
+func (s *FileService) createTemp(req FileRequest, fileType ports.FileType) (result FileResult, path string, cleanup func(), err error) {
+	cleanup = func() {}
+	dir, err := os.MkdirTemp("", "genfile-")
+	if err != nil {
+		return FileResult{Path: req.Path, Type: fileType, Size: ports.AnySize, TargetSize: ports.AnySize}, "", cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	tmp := req
+	tmp.Path = filepath.Join(dir, "out")
+	tmp.Throttle = ""
+	tmp.InPlace = true // the directory is private
+	tmp.Type = string(fileType)
+	result, err = s.Create(tmp)
+	result.Path = req.Path
+	return result, tmp.Path, cleanup, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,113 @@
+package application
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// MockStreamGenerator is a mock for ports.StreamGenerator
+type MockStreamGenerator struct {
+	MockFileGenerator
+	Extra int64 // bytes written beyond the requested size
+}
+
+func (m *MockStreamGenerator) GenerateTo(w io.Writer, sizeBytes int64, opts ports.Options) error {
+	_, err := w.Write(bytes.Repeat([]byte("s"), int(sizeBytes+m.Extra)))
+	return err
+}
+
+func TestFileService_Stream(t *testing.T) {
+	writeFile := func(outPath string, sizeBytes int64) error {
+		return os.WriteFile(outPath, bytes.Repeat([]byte("f"), int(sizeBytes)), 0o644)
+	}
+
+	tests := []struct {
+		name        string
+		gen         ports.FileGenerator
+		req         FileRequest
+		want        string
+		wantType    ports.FileType
+		wantErrText string
+	}{
+		{
+			name:     "Stream generator writes directly",
+			gen:      &MockStreamGenerator{},
+			req:      FileRequest{Path: "-", Type: "csv", SizeSpec: "10KB"},
+			want:     strings.Repeat("s", 10*1024),
+			wantType: ports.FileTypeCSV,
+		},
+		{
+			name:     "Plain generator goes through a file",
+			gen:      &MockFileGenerator{GenerateFunc: writeFile},
+			req:      FileRequest{Path: "-", Type: "png", SizeSpec: "10KB"},
+			want:     strings.Repeat("f", 10*1024),
+			wantType: ports.FileTypePNG,
+		},
+		{
+			name:     "Type from the path extension",
+			gen:      &MockStreamGenerator{},
+			req:      FileRequest{Path: "out.txt", SizeSpec: "10KB"},
+			want:     strings.Repeat("s", 10*1024),
+			wantType: ports.FileTypeTXT,
+		},
+		{
+			name:        "Strict size mismatch",
+			gen:         &MockStreamGenerator{Extra: 1},
+			req:         FileRequest{Path: "-", Type: "csv", SizeSpec: "10KB", Strict: true},
+			wantErrText: "want exactly 10240",
+		},
+		{
+			name:     "Throttled",
+			gen:      &MockStreamGenerator{},
+			req:      FileRequest{Path: "-", Type: "csv", SizeSpec: "10KB", Throttle: "1MB/s"},
+			want:     strings.Repeat("s", 10*1024),
+			wantType: ports.FileTypeCSV,
+		},
+		{
+			name:        "Invalid throttle",
+			gen:         &MockStreamGenerator{},
+			req:         FileRequest{Path: "-", Type: "csv", SizeSpec: "10KB", Throttle: "badsize/s"},
+			wantErrText: "invalid throttle 'badsize/s'",
+		},
+		{
+			name:        "Companion files",
+			gen:         &MockSetGenerator{},
+			req:         FileRequest{Path: "-", Type: "csv", SizeSpec: "10KB"},
+			wantErrText: "cannot be streamed",
+		},
+		{
+			name:        "No type",
+			gen:         &MockStreamGenerator{},
+			req:         FileRequest{Path: "-", SizeSpec: "10KB"},
+			wantErrText: "unsupported file extension",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &MockGeneratorFactory{ForFunc: func(ports.FileType) (ports.FileGenerator, error) { return tc.gen, nil }}
+			service := NewFileService(factory, &MockSizeParser{})
+			var buf bytes.Buffer
+			result, err := service.Stream(&buf, tc.req)
+			if tc.wantErrText != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrText) {
+					t.Errorf("Stream() error = %v, want %q", err, tc.wantErrText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Stream() unexpected error = %v", err)
+			}
+			if buf.String() != tc.want {
+				t.Errorf("Stream() wrote %d bytes, want %d", buf.Len(), len(tc.want))
+			}
+			if result.Type != tc.wantType || result.Size != int64(len(tc.want)) || result.Path != tc.req.Path {
+				t.Errorf("Stream() result = %+v", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package application
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// sizedByExtent reports whether req is sized by a duration, a count or a
+// resolution rather than in bytes.
+func (req FileRequest) sizedByExtent() bool {
+	return req.Duration != "" || req.Count != (ports.Count{}) || req.Resolution != ""
+}
+
+// checkTargets checks req sets a size, a line count, a duration, a count
+// or a resolution, that a duration, a count or a resolution, which set the
+// size themselves, comes alone, and that only they come with a maximum
+// size.
+func checkTargets(req FileRequest) error {
+	var extents []string
+	if req.Duration != "" {
+		extents = append(extents, "a duration")
+	}
+	if req.Count != (ports.Count{}) {
+		extents = append(extents, "a count of "+string(req.Count.Unit))
+	}
+	if req.Resolution != "" {
+		extents = append(extents, "a resolution")
+	}
+	switch {
+	case len(extents) == 0 && req.SizeSpec == "" && req.Lines == 0:
+		return fmt.Errorf("a size, a line count, a duration, a count of pages, rows or slides, or a resolution is required")
+	case len(extents) == 0 && req.MaxSize != "":
+		return fmt.Errorf("a maximum size bounds a duration, a count or a resolution; give a size instead")
+	case len(extents) > 1:
+		return fmt.Errorf("%s cannot be combined", strings.Join(extents, " and "))
+	case len(extents) == 1 && (req.SizeSpec != "" || req.Lines > 0):
+		return fmt.Errorf("%s sets the size; it cannot be combined with a size or a line count", extents[0])
+	}
+	return nil
+}
+
+// forTarget returns generator set to write the file req's duration,
+// count or resolution describes, and the size of that file.
+func forTarget(fileType ports.FileType, generator ports.FileGenerator, req FileRequest) (ports.FileGenerator, int64, error) {
+	switch {
+	case req.Duration != "":
+		return forDuration(fileType, generator, req.Duration)
+	case req.Resolution != "":
+		return forResolution(fileType, generator, req.Resolution)
+	}
+	return forCount(fileType, generator, req.Count)
+}
+
+// forDuration returns generator set to write media playing for duration,
+// such as "30s", and the size of the file it writes.
+func forDuration(fileType ports.FileType, generator ports.FileGenerator, duration string) (ports.FileGenerator, int64, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(duration))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid duration '%s': %w", duration, err)
+	}
+	dg, ok := ports.As[ports.DurationGenerator](generator)
+	if !ok {
+		return nil, 0, fmt.Errorf("generator for type '%s' does not support durations", fileType)
+	}
+	generator, size, err := dg.ForDuration(d)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot size %s of %s: %w", d, fileType, err)
+	}
+	return generator, size, nil
+}
+
+// forCount returns generator set to write a document of c pages, rows or
+// slides, and the size of the file it writes.
+func forCount(fileType ports.FileType, generator ports.FileGenerator, c ports.Count) (ports.FileGenerator, int64, error) {
+	switch c.Unit {
+	case ports.CountPages, ports.CountRows, ports.CountSlides:
+	default:
+		return nil, 0, fmt.Errorf("unknown count unit '%s' (want pages, rows or slides)", c.Unit)
+	}
+	if c.N < 1 {
+		return nil, 0, fmt.Errorf("%s must be at least 1, got %d", c.Unit, c.N)
+	}
+	cg, ok := ports.As[ports.CountGenerator](generator)
+	if !ok {
+		return nil, 0, fmt.Errorf("generator for type '%s' does not support a count of %s", fileType, c.Unit)
+	}
+	generator, size, err := cg.ForCount(c)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot write %d %s of %s: %w", c.N, c.Unit, fileType, err)
+	}
+	return generator, size, nil
+}
+
+// forResolution returns generator set to write an image of resolution,
+// such as "4000x3000", and the size of the file it writes.
+func forResolution(fileType ports.FileType, generator ports.FileGenerator, resolution string) (ports.FileGenerator, int64, error) {
+	w, h, err := parseResolution(resolution)
+	if err != nil {
+		return nil, 0, err
+	}
+	rg, ok := ports.As[ports.ResolutionGenerator](generator)
+	if !ok {
+		return nil, 0, fmt.Errorf("generator for type '%s' does not support resolutions", fileType)
+	}
+	generator, size, err := rg.ForResolution(w, h)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot write a %dx%d %s: %w", w, h, fileType, err)
+	}
+	return generator, size, nil
+}
+
+// maxPixels bounds the images a resolution asks for, which are encoded in
+// memory: 100 megapixels.
+const maxPixels = 100_000_000
+
+// parseResolution parses WIDTHxHEIGHT, such as "4000x3000", into positive
+// pixel dimensions.
+func parseResolution(s string) (w, h int, err error) {
+	ws, hs, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "x")
+	if ok {
+		w, err = strconv.Atoi(ws)
+		if err == nil {
+			h, err = strconv.Atoi(hs)
+		}
+	}
+	if !ok || err != nil || w < 1 || h < 1 {
+		return 0, 0, fmt.Errorf("invalid resolution '%s' (want WIDTHxHEIGHT, e.g. 4000x3000)", s)
+	}
+	if int64(w)*int64(h) > maxPixels {
+		return 0, 0, fmt.Errorf("resolution %dx%d is over the %d-megapixel limit", w, h, maxPixels/1_000_000)
+	}
+	return w, h, nil
+}
@@ -0,0 +1,36 @@
+package ports
+
+// Capabilities lists the optional ports a generator implements, so that
+// help text and listings can show what each format supports.
+type Capabilities struct {
+	Options    bool // OptionsGenerator
+	Lines      bool // LineGenerator
+	Stream     bool // StreamGenerator
+	Plan       bool // Planner
+	Allocate   bool // AllocatingGenerator: sparse and preallocated output
+	Metadata   bool // MetadataCapable
+	Resize     bool // Resizer
+	Duration   bool // DurationGenerator
+	Count      bool // CountGenerator: pages, rows or slides
+	Resolution bool // ResolutionGenerator
+	Checksum   bool // FreeTailGenerator: checksum targets
+	Resume     bool // ResumableGenerator
+}
+
+// CapabilitiesOf reports which optional ports g implements.
+func CapabilitiesOf(g FileGenerator) Capabilities {
+	var c Capabilities
+	_, c.Options = As[OptionsGenerator](g)
+	_, c.Lines = As[LineGenerator](g)
+	_, c.Stream = As[StreamGenerator](g)
+	_, c.Plan = As[Planner](g)
+	_, c.Allocate = As[AllocatingGenerator](g)
+	_, c.Metadata = As[MetadataCapable](g)
+	_, c.Resize = As[Resizer](g)
+	_, c.Duration = As[DurationGenerator](g)
+	_, c.Count = As[CountGenerator](g)
+	_, c.Resolution = As[ResolutionGenerator](g)
+	_, c.Checksum = As[FreeTailGenerator](g)
+	_, c.Resume = As[ResumableGenerator](g)
+	return c
+}
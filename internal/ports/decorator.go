@@ -0,0 +1,33 @@
+package ports
+
+// Decorator is implemented by generators that wrap another one to add
+// behaviour around it, such as instrumentation. A decorator implements
+// every optional port and forwards to the generator it wraps, so the ports
+// it supports are those of the innermost generator: check them with As,
+// not with a type assertion.
+type Decorator interface {
+	FileGenerator
+	// Unwrap returns the generator the decorator wraps.
+	Unwrap() FileGenerator
+}
+
+// As reports whether g supports the port T and, if so, returns g as a T.
+// For a Decorator, support is that of the generator it wraps, looking
+// through any number of decorators, while the result is still g so that
+// calls go through the decorators.
+func As[T FileGenerator](g FileGenerator) (T, bool) {
+	var zero T
+	inner := g
+	for {
+		d, ok := inner.(Decorator)
+		if !ok {
+			break
+		}
+		inner = d.Unwrap()
+	}
+	if _, ok := inner.(T); !ok {
+		return zero, false
+	}
+	t, ok := g.(T)
+	return t, ok
+}
@@ -1,7 +1,180 @@
 package ports
 
+import (
+	"io"
+	"time"
+)
+
 // FileGenerator is the port for anything that can produce a file.
 type FileGenerator interface {
 	// Generate writes a file at outPath exactly sizeBytes long.
 	Generate(outPath string, sizeBytes int64) error
 }
+
+// OptionsGenerator is implemented by generators that accept per-call options.
+type OptionsGenerator interface {
+	FileGenerator
+	// GenerateWithOptions behaves like Generate, applying opts on top of the
+	// generator's defaults.
+	GenerateWithOptions(outPath string, sizeBytes int64, opts Options) error
+}
+
+// ConfigurableGenerator is implemented by generators whose options can be
+// set once, when the generator is looked up, instead of on every call.
+type ConfigurableGenerator interface {
+	OptionsGenerator
+	// Configure returns a copy of the generator that applies opts, on top
+	// of any it was configured with before, to every file it writes.
+	// Options passed to a call take precedence. An invalid option is an
+	// error.
+	Configure(opts Options) (FileGenerator, error)
+}
+
+// AnySize is passed as sizeBytes to LineGenerator.GenerateLines when only
+// the line count is fixed.
+const AnySize int64 = -1
+
+// LineGenerator is implemented by line-oriented generators (text, CSV,
+// NDJSON) that can produce an exact number of lines.
+type LineGenerator interface {
+	FileGenerator
+	// GenerateLines writes exactly lines newline-terminated lines (rows,
+	// records) to outPath. Unless sizeBytes is AnySize the file is also
+	// exactly sizeBytes long; an error is returned if the two targets
+	// cannot both be met.
+	GenerateLines(outPath string, sizeBytes, lines int64, opts Options) error
+}
+
+// StreamGenerator is implemented by generators that write their output in a
+// single forward pass and so can target non-seekable writers such as
+// stdout or a pipe.
+type StreamGenerator interface {
+	FileGenerator
+	// GenerateTo writes exactly sizeBytes bytes of the format to w,
+	// applying opts as GenerateWithOptions would.
+	GenerateTo(w io.Writer, sizeBytes int64, opts Options) error
+}
+
+// Allocation selects how the bulk of a large file is put on disk.
+type Allocation string
+
+const (
+	// AllocateWrite writes every byte of the file; it is the default.
+	AllocateWrite Allocation = ""
+	// AllocateSparse leaves the payload as a hole: the file has its full
+	// length but takes almost no disk space.
+	AllocateSparse Allocation = "sparse"
+	// AllocatePreallocate reserves disk blocks for the payload without
+	// writing them, so the file takes its full size on disk.
+	AllocatePreallocate Allocation = "preallocate"
+)
+
+// AllocatingGenerator is implemented by generators whose payload may be
+// all zero bytes, so that multi-gigabyte files can be created in about the
+// time it takes to write their headers.
+type AllocatingGenerator interface {
+	FileGenerator
+	// GenerateAllocated writes the format's leading structure to outPath
+	// and extends the file to exactly sizeBytes using mode, which is never
+	// AllocateWrite. The bytes that are not written read as zeros.
+	GenerateAllocated(outPath string, sizeBytes int64, mode Allocation, opts Options) error
+}
+
+// SetGenerator is implemented by formats that are a set of files sharing
+// a base name, such as a shapefile's .shp, .shx and .dbf. The size applies
+// to the main file at basePath; the other files follow from it.
+type SetGenerator interface {
+	FileGenerator
+	// GenerateSet writes the set and returns the paths of all the files it
+	// created, the main file at basePath first.
+	GenerateSet(basePath string, sizeBytes int64) ([]string, error)
+}
+
+// WholeSetGenerator is implemented by set generators whose size applies
+// to all the files of the set together, such as a streaming playlist and
+// its segments, rather than to the main file.
+type WholeSetGenerator interface {
+	SetGenerator
+	// SizesWholeSet reports whether the size applies to the whole set.
+	SizesWholeSet() bool
+}
+
+// SetOptionsGenerator is implemented by set generators that also accept
+// format-specific options.
+type SetOptionsGenerator interface {
+	SetGenerator
+	GenerateSetWithOptions(basePath string, sizeBytes int64, opts Options) ([]string, error)
+}
+
+// Resizer is implemented by generators that can bring an existing file of
+// their format to a new size while keeping it valid, for example by
+// replacing its padding.
+type Resizer interface {
+	FileGenerator
+	// Resize writes the file at srcPath to outPath, exactly sizeBytes
+	// long. srcPath is left as it is; the two paths must differ. Formats
+	// that can only add to a file return an error for sizes below the
+	// smallest they can reach.
+	Resize(srcPath, outPath string, sizeBytes int64) error
+}
+
+// DurationGenerator is implemented by audio and video generators that can
+// size a file by its playback length instead of in bytes.
+type DurationGenerator interface {
+	FileGenerator
+	// ForDuration returns a generator writing media that plays for d with
+	// the codec parameters (sample rate, frame rate, bitrate) it is
+	// configured with, and the size in bytes of the file it writes. d is
+	// rounded to the nearest whole sample or frame.
+	ForDuration(d time.Duration) (FileGenerator, int64, error)
+}
+
+// CountUnit is what a document is counted in when it is sized by its
+// content instead of in bytes.
+type CountUnit string
+
+const (
+	CountPages  CountUnit = "pages"
+	CountRows   CountUnit = "rows"
+	CountSlides CountUnit = "slides"
+)
+
+// Count is a target of N pages, rows or slides.
+type Count struct {
+	Unit CountUnit
+	N    int64
+}
+
+// CountGenerator is implemented by document generators that can size a
+// file by its pages, rows or slides, the size in bytes following from the
+// content.
+type CountGenerator interface {
+	FileGenerator
+	// ForCount returns a generator writing a document of exactly c.N of
+	// c.Unit, and the size in bytes of the file it writes. A unit the
+	// format is not counted in is an error.
+	ForCount(c Count) (FileGenerator, int64, error)
+}
+
+// ResolutionGenerator is implemented by image generators that can size a
+// file by its pixel dimensions, the size in bytes following from the
+// encoding.
+type ResolutionGenerator interface {
+	FileGenerator
+	// ForResolution returns a generator writing an image of width×height
+	// pixels, and the size in bytes of the file it writes. Larger sizes
+	// are padded; smaller ones are errors.
+	ForResolution(width, height int) (FileGenerator, int64, error)
+}
+
+// FreeTailGenerator is implemented by generators whose files end in bytes
+// no reader gives a meaning to, such as random fill, noise samples or a
+// padding payload, so that they can be rewritten without spoiling the
+// file.
+type FreeTailGenerator interface {
+	FileGenerator
+	// FreeTail returns how many of the last bytes of a file of size bytes
+	// written with opts, at least, are free, and the bytes they may take;
+	// nil for any.
+	FreeTail(size int64, opts Options) (n int64, alphabet []byte)
+}
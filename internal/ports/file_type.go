@@ -4,23 +4,57 @@ package ports
 type FileType string
 
 const (
-	FileTypeTXT  FileType = "txt"
-	FileTypePNG  FileType = "png"
-	FileTypeJPEG FileType = "jpeg"
-	FileTypeMP4  FileType = "mp4"
-	FileTypeM4V  FileType = "m4v"
-	FileTypeWAV  FileType = "wav"
-	FileTypeDWG  FileType = "dwg"
-	FileTypeDXF  FileType = "dxf"
-	FileTypeZIP  FileType = "zip"
-	FileTypeXLSX FileType = "xlsx"
-	FileTypeDOCX FileType = "docx"
-	FileTypePDF  FileType = "pdf"
-	FileTypeCSV  FileType = "csv"
-	FileTypeJSON FileType = "json"
-	FileTypeHTML FileType = "html"
-	FileTypeXML  FileType = "xml"
-	FileTypeGIF  FileType = "gif"
-	FileTypeLog  FileType = "log"
-	FileTypeMD   FileType = "md"
+	FileTypeTXT    FileType = "txt"
+	FileTypePNG    FileType = "png"
+	FileTypeJPEG   FileType = "jpeg"
+	FileTypeMP4    FileType = "mp4"
+	FileTypeM4V    FileType = "m4v"
+	FileTypeWAV    FileType = "wav"
+	FileTypeDWG    FileType = "dwg"
+	FileTypeDXF    FileType = "dxf"
+	FileTypeZIP    FileType = "zip"
+	FileTypeXLSX   FileType = "xlsx"
+	FileTypeDOCX   FileType = "docx"
+	FileTypePDF    FileType = "pdf"
+	FileTypeCSV    FileType = "csv"
+	FileTypeJSON   FileType = "json"
+	FileTypeHTML   FileType = "html"
+	FileTypeXML    FileType = "xml"
+	FileTypeGIF    FileType = "gif"
+	FileTypeLog    FileType = "log"
+	FileTypeMD     FileType = "md"
+	FileTypeTIFF   FileType = "tiff"
+	FileTypeNDJSON FileType = "ndjson"
+	FileTypeBIN    FileType = "bin"
+	FileTypeSHP    FileType = "shp"
+	FileTypePSD    FileType = "psd"
+	FileTypeAI     FileType = "ai"
+	FileTypeFWF    FileType = "fwf"
+	FileTypeEDI    FileType = "edi"
+	FileTypeHL7    FileType = "hl7"
+	FileTypeJP2    FileType = "jp2"
+	FileTypeDJVU   FileType = "djvu"
+	FileTypeOCI    FileType = "oci"
+	FileTypeDEB    FileType = "deb"
+	FileTypeRPM    FileType = "rpm"
+	FileTypeJAR    FileType = "jar"
+	FileTypeWAR    FileType = "war"
+	FileTypeAPK    FileType = "apk"
+	FileTypeNPM    FileType = "npm"
+	FileTypeWHL    FileType = "whl"
+	FileTypePEM    FileType = "pem"
+	FileTypeCRT    FileType = "crt"
+	FileTypeKEY    FileType = "key"
+	FileTypeDER    FileType = "der"
+	FileTypeREG    FileType = "reg"
+	FileTypeINI    FileType = "ini"
+	FileTypePS     FileType = "ps"
+	FileTypeXPS    FileType = "xps"
+	FileTypeMDB    FileType = "mdb"
+	FileTypeACCDB  FileType = "accdb"
+	FileTypeCFB    FileType = "cfb"
+	FileTypeSRT    FileType = "srt"
+	FileTypeVTT    FileType = "vtt"
+	FileTypeM3U8   FileType = "m3u8"
+	FileTypeMPD    FileType = "mpd"
 )
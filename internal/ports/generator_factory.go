@@ -4,4 +4,20 @@ package ports
 type GeneratorFactory interface {
 	// For returns a FileGenerator for the given FileType, or an error if unsupported.
 	For(t FileType) (FileGenerator, error)
+	// ForOptions is like For, but the generator applies opts to every file
+	// it writes (see ConfigurableGenerator). Invalid options are an error
+	// here rather than when a file is generated.
+	ForOptions(t FileType, opts Options) (FileGenerator, error)
+}
+
+// NestingGenerator is implemented by generators that generate files of
+// other types to put inside their own, such as the entries of a ZIP or the
+// attachments of a PDF. The factory hands them out with itself, so that
+// those files come from the same registry, logger and file system as the
+// file around them.
+type NestingGenerator interface {
+	FileGenerator
+	// WithFactory returns a copy of the generator that looks up the
+	// generators of the files inside in f.
+	WithFactory(f GeneratorFactory) FileGenerator
 }
@@ -0,0 +1,29 @@
+package ports
+
+// LogLevel orders log messages by importance.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	// LevelSilent is above every message level; a logger set to it drops
+	// everything.
+	LevelSilent
+)
+
+// Logger receives diagnostics from generators: debug traces of how a size
+// was reached, and warnings such as a size that could only be approximated.
+// Failures are returned as errors, not logged.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+}
+
+// LoggingGenerator is implemented by generators that report diagnostics.
+type LoggingGenerator interface {
+	FileGenerator
+	// WithLogger returns a copy of the generator that logs to l.
+	WithLogger(l Logger) FileGenerator
+}
@@ -0,0 +1,38 @@
+package ports
+
+import "slices"
+
+// Well-known metadata keys. Generators map them to the format's own fields
+// (e.g. /Title in a PDF, dc:title in a DOCX) and store any other key as a
+// custom property where the format has them.
+const (
+	MetaTitle    = "title"
+	MetaAuthor   = "author"
+	MetaSubject  = "subject"
+	MetaKeywords = "keywords"
+	MetaComment  = "comment"
+	MetaCreator  = "creator" // the application that made the document
+)
+
+// Metadata holds document properties as key/value pairs.
+type Metadata map[string]string
+
+// Keys returns the keys of m in sorted order, so that generators lay out
+// the same properties the same way on every run.
+func (m Metadata) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// MetadataCapable is implemented by generators that can write
+// format-native metadata such as document properties or text chunks.
+type MetadataCapable interface {
+	FileGenerator
+	// WithMetadata returns a copy of the generator that writes m into
+	// every file it generates.
+	WithMetadata(m Metadata) FileGenerator
+}
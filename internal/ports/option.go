@@ -0,0 +1,71 @@
+package ports
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Option sets a format option. Options are the typed way to build the
+// Options a generator is called with: each helper writes the key and value
+// the matching CLI flag would.
+type Option func(Options)
+
+// NewOptions returns the Options set by opts, nil if there are none.
+func NewOptions(opts ...Option) Options {
+	if len(opts) == 0 {
+		return nil
+	}
+	o := Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithOption sets key to value, for options without a helper of their own.
+func WithOption(key, value string) Option {
+	return func(o Options) { o[key] = value }
+}
+
+// WithSeed makes the output reproducible: the same seed, size and options
+// give the same bytes. Timestamps inside the file come from the "mtime"
+// option, which should be set as well.
+func WithSeed(seed int64) Option {
+	return WithOption("seed", strconv.FormatInt(seed, 10))
+}
+
+// WithQuality sets the JPEG quality, from 1 to 100.
+func WithQuality(quality int) Option {
+	return WithOption("jpeg-quality", strconv.Itoa(quality))
+}
+
+// WithDimensions sets the width and height in pixels of image and video
+// formats.
+func WithDimensions(width, height int) Option {
+	return func(o Options) {
+		o["width"] = strconv.Itoa(width)
+		o["height"] = strconv.Itoa(height)
+	}
+}
+
+// WithContentProfile selects a content profile, such as "csv-injection".
+func WithContentProfile(profile string) Option {
+	return WithOption("content", profile)
+}
+
+// Generate writes a file at path exactly size bytes long with g, applying
+// opts. Without options it is g.Generate; with them g must accept options.
+// It is a function rather than a method because Go has no overloading:
+// FileGenerator keeps its two-argument Generate, which every generator and
+// caller already uses.
+func Generate(g FileGenerator, path string, size int64, opts ...Option) error {
+	o := NewOptions(opts...)
+	if len(o) == 0 {
+		return g.Generate(path, size)
+	}
+	og, ok := As[OptionsGenerator](g)
+	if !ok {
+		return fmt.Errorf("generator %T does not accept options", g)
+	}
+	return og.GenerateWithOptions(path, size, o)
+}
@@ -0,0 +1,112 @@
+package ports
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options carries generator-specific settings as string key/value pairs.
+// Keys match the CLI flag names (e.g. "zip-password"); generators read the
+// keys they understand and ignore the rest.
+type Options map[string]string
+
+// Has reports whether key was explicitly set.
+func (o Options) Has(key string) bool {
+	_, ok := o[key]
+	return ok
+}
+
+// With returns a copy of o with the values of over added, replacing those
+// of the same keys. It returns o itself if over is empty.
+func (o Options) With(over Options) Options {
+	if len(over) == 0 {
+		return o
+	}
+	out := make(Options, len(o)+len(over))
+	for k, v := range o {
+		out[k] = v
+	}
+	for k, v := range over {
+		out[k] = v
+	}
+	return out
+}
+
+// String returns the value for key, or def if it is unset or empty.
+func (o Options) String(key, def string) string {
+	if v, ok := o[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// Int returns the value for key parsed as an integer, or def if unset.
+func (o Options) Int(key string, def int) (int, error) {
+	v, ok := o[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("option %s: invalid integer %q", key, v)
+	}
+	return n, nil
+}
+
+// Bool returns the value for key parsed as a boolean, or def if unset.
+func (o Options) Bool(key string, def bool) (bool, error) {
+	v, ok := o[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return false, fmt.Errorf("option %s: invalid boolean %q", key, v)
+	}
+	return b, nil
+}
+
+// Duration returns the value for key parsed as a time.Duration (e.g. "90s"
+// or "1m30s"), or def if unset.
+func (o Options) Duration(key string, def time.Duration) (time.Duration, error) {
+	v, ok := o[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("option %s: invalid duration %q", key, v)
+	}
+	return d, nil
+}
+
+// Time returns the value for key parsed with ParseTime, or def if unset.
+func (o Options) Time(key string, def time.Time) (time.Time, error) {
+	v, ok := o[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	t, err := ParseTime(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("option %s: %w", key, err)
+	}
+	return t, nil
+}
+
+// timeLayouts lists the layouts ParseTime accepts, most precise first.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+// ParseTime parses an RFC 3339 timestamp such as "2020-01-01T00:00:00Z".
+// The offset, or the whole time of day, may be left out; such times are
+// taken as UTC.
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want RFC 3339, e.g. 2020-01-01T00:00:00Z)", s)
+}
@@ -0,0 +1,97 @@
+package ports
+
+import (
+	"io"
+	"io/fs"
+	"time"
+)
+
+// OutputFile is a file a generator writes. *os.File implements it.
+type OutputFile interface {
+	io.Writer
+	io.StringWriter
+	io.WriterAt
+	io.Seeker
+	io.Closer
+	Name() string
+	Sync() error
+	// Truncate changes the size of the file, as os.File.Truncate does.
+	Truncate(size int64) error
+}
+
+// OutputFS is the file system generators create their files on. The
+// default is the operating system's; others can stand in for it, such as
+// one that injects write failures to test how generators and the programs
+// around them handle a full disk.
+type OutputFS interface {
+	// Create creates or truncates the file at path for writing, as
+	// os.Create does.
+	Create(path string) (OutputFile, error)
+	// Open opens the existing file at path for writing without truncating
+	// it, as os.OpenFile with os.O_WRONLY does.
+	Open(path string) (OutputFile, error)
+}
+
+// TempFS is implemented by output file systems that also hold the
+// temporary files generators write on the way to their output, such as
+// the entries of an archive rendered before they are copied into it. On
+// other file systems those go to the operating system's temporary
+// directory.
+type TempFS interface {
+	OutputFS
+	// MkdirTemp creates a new directory for temporary files, as
+	// os.MkdirTemp("", pattern) does, and returns its path.
+	MkdirTemp(pattern string) (string, error)
+	// OpenRead opens the file at path for reading.
+	OpenRead(path string) (io.ReadCloser, error)
+	// Stat describes the file at path, as os.Stat does.
+	Stat(path string) (fs.FileInfo, error)
+	// RemoveAll removes path and anything it holds, as os.RemoveAll does.
+	RemoveAll(path string) error
+}
+
+// AttrFS is implemented by output file systems that also report and set
+// the attributes of the files on them, as the service does once a file is
+// generated: its size, modification time, mode and owner. On other file
+// systems those of the operating system are used.
+type AttrFS interface {
+	OutputFS
+	// Stat describes the file at path, as os.Stat does.
+	Stat(path string) (fs.FileInfo, error)
+	// Chtimes changes the access and modification times of the file at
+	// path, as os.Chtimes does.
+	Chtimes(path string, atime, mtime time.Time) error
+	// Chmod changes the mode of the file at path, as os.Chmod does.
+	Chmod(path string, mode fs.FileMode) error
+	// Chown changes the owner of the file at path, as os.Chown does.
+	Chown(path string, uid, gid int) error
+}
+
+// RenameFS is implemented by output file systems on which the service
+// writes a file into a temporary directory next to its path and renames
+// it into place once complete, so that readers never see a partial file.
+// On other file systems those of the operating system are used.
+type RenameFS interface {
+	OutputFS
+	// MkdirTempIn creates a new directory in dir, as os.MkdirTemp does,
+	// and returns its path.
+	MkdirTempIn(dir, pattern string) (string, error)
+	// Lstat describes the file at path without following a symbolic
+	// link, as os.Lstat does.
+	Lstat(path string) (fs.FileInfo, error)
+	// Rename moves the file at oldpath to newpath, as os.Rename does.
+	Rename(oldpath, newpath string) error
+	// Remove removes the file at path, as os.Remove does.
+	Remove(path string) error
+	// RemoveAll removes path and anything it holds, as os.RemoveAll does.
+	RemoveAll(path string) error
+}
+
+// OutputFSGenerator is implemented by generators that write their files
+// on an OutputFS other than the operating system's when given one. The
+// factory hands them out with the file system it was made with.
+type OutputFSGenerator interface {
+	FileGenerator
+	// WithOutputFS returns a copy of the generator writing on fsys.
+	WithOutputFS(fsys OutputFS) FileGenerator
+}
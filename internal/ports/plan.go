@@ -0,0 +1,41 @@
+package ports
+
+// PlanItem counts one kind of structural element in a GenerationPlan, such
+// as "cells" or "paragraphs".
+type PlanItem struct {
+	Name  string
+	Count int64
+}
+
+// GenerationPlan describes the file a generator would write for a target
+// size, without writing it.
+type GenerationPlan struct {
+	TargetSize   int64
+	MinSize      int64      // smallest file the generator can produce
+	ContentBytes int64      // bytes of structure and real content
+	PaddingBytes int64      // bytes of filler added to reach TargetSize
+	Structure    []PlanItem // element counts, in the generator's order
+}
+
+// Feasible reports whether the target size can be generated.
+func (p GenerationPlan) Feasible() bool {
+	return p.TargetSize >= p.MinSize
+}
+
+// Planner is implemented by generators that can describe their output for a
+// size in advance. When the target is below MinSize, Plan returns a plan
+// that is not Feasible rather than an error.
+type Planner interface {
+	FileGenerator
+	Plan(sizeBytes int64) (GenerationPlan, error)
+}
+
+// SizeStepper is implemented by generators that write only sizes that are
+// a multiple of a step, such as whole pages or 16-bit words. Other
+// generators write any size from their minimum.
+type SizeStepper interface {
+	FileGenerator
+	// SizeStep returns the step for the options the generator was
+	// configured with.
+	SizeStep() int64
+}
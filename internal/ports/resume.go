@@ -0,0 +1,22 @@
+package ports
+
+// ResumeState is how far a resumable generation got: the phase of the
+// format it was writing and how many bytes of the file are safely on disk.
+// The zero value starts a file afresh.
+type ResumeState struct {
+	Phase  string `json:"phase,omitempty"`
+	Offset int64  `json:"offset"`
+}
+
+// ResumableGenerator is implemented by generators that write their files
+// front to back and can carry on from where an interrupted run stopped,
+// for multi-gigabyte files that would be costly to start again.
+type ResumableGenerator interface {
+	FileGenerator
+	// GenerateFrom writes the file GenerateWithOptions would at path,
+	// keeping what an earlier run wrote before from and writing the rest.
+	// As it goes it calls checkpoint, if not nil, with the state to resume
+	// from should it be interrupted; a checkpoint error stops it. Resuming
+	// with other opts or another size gives an invalid file.
+	GenerateFrom(path string, size int64, opts Options, from ResumeState, checkpoint func(ResumeState) error) error
+}
@@ -0,0 +1,16 @@
+package ports
+
+import "io"
+
+// Sink stores generated files somewhere other than the local file system,
+// such as a remote server.
+type Sink interface {
+	// Put writes the contents of r to path on the sink, replacing any
+	// existing file.
+	Put(path string, r io.Reader) error
+	// Remove deletes path from the sink. A file that is already gone is
+	// not an error.
+	Remove(path string) error
+	// Close releases the sink's connection.
+	Close() error
+}
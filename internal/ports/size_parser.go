@@ -1,6 +1,7 @@
 package ports
 
-// SizeParser parses human-readable size specs (like "10MB") into bytes.
+// SizeParser parses human-readable size specs (like "10MB") into bytes. A
+// spec of "@path" stands for the size of an existing file.
 type SizeParser interface {
 	Parse(spec string) (int64, error)
 }
@@ -0,0 +1,13 @@
+package ports
+
+// Stats holds figures a generator reports about a file it wrote beyond its
+// size, keyed by snake_case names such as "uncompressed_size".
+type Stats map[string]int64
+
+// StatsGenerator is implemented by generators that report Stats.
+type StatsGenerator interface {
+	FileGenerator
+	// WithStats returns a copy of the generator that records the figures
+	// of every file it generates into s.
+	WithStats(s Stats) FileGenerator
+}
@@ -0,0 +1,300 @@
+// Package conformance is a test suite every registered generator is run
+// through: files come out at the size asked for, sizes too small are an
+// error rather than a wrong file, the files are of the format generated,
+// a file generated again comes out the same, and unwritable paths fail
+// cleanly.
+//
+// Generators are covered as soon as they register; a Profile is only
+// needed for formats the defaults do not suit.
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hailam/genfile/internal/application"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// DefaultSize is the size files are generated at unless a Profile says
+// otherwise: big enough for every format's fixed structure, small enough
+// to keep the suite quick.
+const DefaultSize = 64 * 1024
+
+// DefaultSeed are the options the Repeat check generates its files with
+// unless a Profile says otherwise: a seed and a modification time, which
+// fix everything a generator draws or dates.
+var DefaultSeed = ports.Options{"seed": "42", "mtime": "2020-01-01T00:00:00Z"}
+
+// Profile describes how a format sizes and identifies its files, where
+// that differs from the defaults.
+type Profile struct {
+	// Size is the size files are generated at; DefaultSize if 0.
+	Size int64
+	// Multiple is the granularity of the sizes the format reaches (whole
+	// pages, whole sectors, UTF-16 code units); 1 if 0. Size must be one.
+	Multiple int64
+	// Tolerance is how many bytes the file may be off its size.
+	Tolerance int64
+	// Options are applied to every file.
+	Options ports.Options
+	// Seed are the options that make the output reproducible byte for
+	// byte; DefaultSeed if nil.
+	Seed ports.Options
+	// Validate checks a generated file is of the format; Sniffs(t) for type
+	// t if nil.
+	Validate func(path string) error
+	// Skip, if set, is why the format is not run through the suite.
+	Skip string
+	// SkipChecks maps the names of checks the format is known to fail
+	// (Size, TooSmall, Repeat, BadPath, Stream) to why.
+	SkipChecks map[string]string
+}
+
+// Sniffs returns a validator that checks application.Sniff identifies a
+// file as want; "" for formats it does not recognise.
+func Sniffs(want ports.FileType) func(path string) error {
+	return func(path string) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		got, err := application.Sniff(f, info.Size())
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("sniffed as %q, want %q", got, want)
+		}
+		return nil
+	}
+}
+
+// Run runs the generator f returns for each of types through the suite,
+// each in a subtest of its own, with the profile profiles holds for it.
+func Run(t *testing.T, f ports.GeneratorFactory, types []ports.FileType, profiles map[ports.FileType]Profile) {
+	for _, ft := range types {
+		p := profiles[ft]
+		t.Run(string(ft), func(t *testing.T) {
+			if p.Skip != "" {
+				t.Skip(p.Skip)
+			}
+			t.Parallel()
+			g, err := f.ForOptions(ft, p.Options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			RunGenerator(t, ft, g, p)
+		})
+	}
+}
+
+// RunGenerator runs g, a generator of ft files, through the suite.
+func RunGenerator(t *testing.T, ft ports.FileType, g ports.FileGenerator, p Profile) {
+	if p.Size == 0 {
+		p.Size = DefaultSize
+	}
+	if p.Multiple == 0 {
+		p.Multiple = 1
+	}
+	if p.Validate == nil {
+		p.Validate = Sniffs(ft)
+	}
+	check := func(name string, f func(t *testing.T)) {
+		t.Run(name, func(t *testing.T) {
+			if why := p.SkipChecks[name]; why != "" {
+				t.Skip(why)
+			}
+			f(t)
+		})
+	}
+	check("Size", func(t *testing.T) { checkSizes(t, ft, g, p) })
+	check("TooSmall", func(t *testing.T) { checkTooSmall(t, ft, g) })
+	check("Repeat", func(t *testing.T) { checkRepeat(t, ft, g, p) })
+	check("BadPath", func(t *testing.T) { checkBadPath(t, ft, g, p) })
+	if sg, ok := ports.As[ports.StreamGenerator](g); ok {
+		check("Stream", func(t *testing.T) { checkStream(t, sg, p) })
+	}
+}
+
+// checkSizes generates files at the profile's size and a few multiples
+// past it, and checks each comes out at its size and validates.
+func checkSizes(t *testing.T, ft ports.FileType, g ports.FileGenerator, p Profile) {
+	for _, size := range []int64{p.Size, p.Size + p.Multiple, p.Size + 3*p.Multiple} {
+		path := filepath.Join(t.TempDir(), "file."+string(ft))
+		if err := g.Generate(path, size); err != nil {
+			t.Fatalf("Generate(%d) error = %v", size, err)
+		}
+		got := generatedSize(t, g, path)
+		if d := got - size; d < -p.Tolerance || d > p.Tolerance {
+			t.Errorf("Generate(%d) wrote %d bytes, more than %d off", size, got, p.Tolerance)
+		}
+		if err := p.Validate(path); err != nil {
+			t.Errorf("Generate(%d) wrote an invalid file: %v", size, err)
+		}
+	}
+}
+
+// CheckSize generates a file of size, which may be anything from negative
+// to past what the format reaches, and checks the generator neither
+// panics nor writes a file of another size: it must fail or come out at
+// size, or empty for a negative size, which some writers take as zero. A
+// format excused from the TooSmall check is held to its size from its
+// profile's size up.
+func CheckSize(t *testing.T, ft ports.FileType, g ports.FileGenerator, p Profile, size int64) {
+	t.Helper()
+	if p.Size == 0 {
+		p.Size = DefaultSize
+	}
+	path := filepath.Join(t.TempDir(), "file."+string(ft))
+	err := g.Generate(path, size)
+	if err != nil || p.SkipChecks["Size"] != "" || (p.SkipChecks["TooSmall"] != "" && size < p.Size) {
+		return
+	}
+	got := generatedSize(t, g, path)
+	if size < 0 {
+		if got != 0 {
+			t.Fatalf("Generate(%d) succeeded with %d bytes", size, got)
+		}
+		return
+	}
+	if got < size-p.Tolerance || got > size+p.Tolerance {
+		t.Fatalf("Generate(%d) succeeded with %d bytes", size, got)
+	}
+}
+
+// CheckTooLarge generates a file of size with g on a file system that is
+// full once limit bytes, fewer than size, are written to it, and checks
+// the generator fails cleanly: with an error, rather than a panic or
+// holding the whole file in memory.
+func CheckTooLarge(t *testing.T, ft ports.FileType, g ports.FileGenerator, size, limit int64) {
+	t.Helper()
+	og, ok := ports.As[ports.OutputFSGenerator](g)
+	if !ok {
+		t.Fatalf("%T cannot write on another file system", g)
+	}
+	g = og.WithOutputFS(&fullFS{limit: limit})
+	path := filepath.Join(t.TempDir(), "file."+string(ft))
+	if err := g.Generate(path, size); err == nil {
+		t.Fatalf("Generate(%d) succeeded on a file system full at %d bytes", size, limit)
+	}
+}
+
+// checkTooSmall checks that a size below the format's smallest file is an
+// error, not a file of another size.
+func checkTooSmall(t *testing.T, ft ports.FileType, g ports.FileGenerator) {
+	for _, size := range []int64{1, 7} {
+		path := filepath.Join(t.TempDir(), "file."+string(ft))
+		if err := g.Generate(path, size); err != nil {
+			continue
+		}
+		if got := generatedSize(t, g, path); got != size {
+			t.Errorf("Generate(%d) succeeded with %d bytes; want an error or exactly %d", size, got, size)
+		}
+	}
+}
+
+// checkRepeat generates two files at the profile's size with its seed
+// options, and checks they come out valid and the same byte for byte.
+func checkRepeat(t *testing.T, ft ports.FileType, g ports.FileGenerator, p Profile) {
+	og, ok := ports.As[ports.OptionsGenerator](g)
+	if !ok {
+		t.Fatal("the generator takes no options, so no seed")
+	}
+	seed := p.Seed
+	if seed == nil {
+		seed = DefaultSeed
+	}
+	var files [2][]byte
+	var sizes [2]int64
+	for i := range files {
+		path := filepath.Join(t.TempDir(), "file."+string(ft))
+		if err := og.GenerateWithOptions(path, p.Size, seed); err != nil {
+			t.Fatalf("Generate(%d) error = %v", p.Size, err)
+		}
+		if err := p.Validate(path); err != nil {
+			t.Errorf("Generate(%d) wrote an invalid file: %v", p.Size, err)
+		}
+		sizes[i] = generatedSize(t, g, path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[i] = data
+	}
+	if sizes[0] != sizes[1] {
+		t.Errorf("Generate(%d) wrote %d bytes, then %d", p.Size, sizes[0], sizes[1])
+	}
+	if !bytes.Equal(files[0], files[1]) {
+		t.Error("the same seed gave different files")
+	}
+}
+
+// checkBadPath checks that generating into a missing directory, or onto
+// a directory, fails without creating anything.
+func checkBadPath(t *testing.T, ft ports.FileType, g ports.FileGenerator, p Profile) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing", "file."+string(ft))
+	if err := g.Generate(missing, p.Size); err == nil {
+		t.Error("Generate() into a missing directory succeeded")
+	}
+	if _, err := os.Stat(filepath.Dir(missing)); !os.IsNotExist(err) {
+		t.Errorf("Generate() into a missing directory created it: %v", err)
+	}
+	if err := g.Generate(dir, p.Size); err == nil {
+		t.Error("Generate() onto a directory succeeded")
+	}
+}
+
+// checkStream checks that a streamed file comes out at its size.
+func checkStream(t *testing.T, g ports.StreamGenerator, p Profile) {
+	var n countingWriter
+	if err := g.GenerateTo(&n, p.Size, nil); err != nil {
+		t.Fatalf("GenerateTo() error = %v", err)
+	}
+	if d := int64(n) - p.Size; d < -p.Tolerance || d > p.Tolerance {
+		t.Errorf("GenerateTo(%d) wrote %d bytes, more than %d off", p.Size, n, p.Tolerance)
+	}
+}
+
+// generatedSize returns the size of the file g wrote at path, with the
+// other files of the set for a generator sizing the whole set.
+func generatedSize(t *testing.T, g ports.FileGenerator, path string) int64 {
+	t.Helper()
+	paths := []string{path}
+	if wg, ok := ports.As[ports.WholeSetGenerator](g); ok && wg.SizesWholeSet() {
+		entries, err := os.ReadDir(filepath.Dir(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = paths[:0]
+		for _, e := range entries {
+			paths = append(paths, filepath.Join(filepath.Dir(path), e.Name()))
+		}
+	}
+	var total int64
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
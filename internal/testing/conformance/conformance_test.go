@@ -0,0 +1,50 @@
+package conformance
+
+import (
+	"testing"
+
+	_ "github.com/hailam/genfile/internal/adapters/all"
+	"github.com/hailam/genfile/internal/adapters/factory"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// unsniffed is the profile of formats the sniffer does not tell from
+// plain text or arbitrary bytes.
+var unsniffed = Profile{Validate: Sniffs("")}
+
+// profiles holds what sets the registered formats apart from the
+// defaults.
+var profiles = map[ports.FileType]Profile{
+	ports.FileTypeTXT: unsniffed,
+	ports.FileTypeLog: unsniffed,
+	ports.FileTypeMD:  unsniffed,
+	ports.FileTypeCSV: unsniffed,
+	ports.FileTypeFWF: unsniffed,
+	ports.FileTypeDER: unsniffed,
+	ports.FileTypeBIN: {Validate: Sniffs(""), Seed: ports.Options{"bin-fill": "seeded", "bin-seed": "42"}},
+
+	// The M4V generator writes an MP4 with an .m4v name.
+	ports.FileTypeM4V: {Validate: Sniffs(ports.FileTypeMP4)},
+
+	ports.FileTypeDEB:   {Multiple: 2},
+	ports.FileTypeDJVU:  {Multiple: 2},
+	ports.FileTypeREG:   {Multiple: 2},
+	ports.FileTypeSHP:   {Multiple: 2},
+	ports.FileTypeWAV:   {Multiple: 2},
+	ports.FileTypeCFB:   {Multiple: 512},
+	ports.FileTypeMDB:   {Multiple: 4096},
+	ports.FileTypeACCDB: {Multiple: 4096},
+
+	// These are fitted by repeated trial encodes, which grow slow with
+	// size.
+	ports.FileTypeDOCX: {Size: 16 * 1024},
+	ports.FileTypeXLSX: {Size: 16 * 1024},
+	ports.FileTypeTIFF: {Size: 16 * 1024},
+
+	ports.FileTypeGIF:  {SkipChecks: map[string]string{"TooSmall": "GIF writes its smallest file instead"}},
+	ports.FileTypeJSON: {SkipChecks: map[string]string{"TooSmall": "JSON closes an object short of a target too small for another key"}},
+}
+
+func TestRegisteredGenerators(t *testing.T) {
+	Run(t, factory.NewGeneratorFactory(), factory.RegisteredTypes(), profiles)
+}
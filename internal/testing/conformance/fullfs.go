@@ -0,0 +1,64 @@
+package conformance
+
+import (
+	"io/fs"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/hailam/genfile/internal/adapters/outputfs"
+	"github.com/hailam/genfile/internal/ports"
+)
+
+// fullFS is the operating system's file system with room for limit bytes
+// only: writes past them, to any of its files, fail with ENOSPC.
+type fullFS struct {
+	limit   int64
+	written atomic.Int64
+}
+
+func (f *fullFS) Create(path string) (ports.OutputFile, error) {
+	return f.wrap(outputfs.OS{}.Create(path))
+}
+
+func (f *fullFS) Open(path string) (ports.OutputFile, error) {
+	return f.wrap(outputfs.OS{}.Open(path))
+}
+
+func (f *fullFS) wrap(file ports.OutputFile, err error) (ports.OutputFile, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &fullFile{OutputFile: file, fs: f}, nil
+}
+
+// fullFile is a file of a fullFS.
+type fullFile struct {
+	ports.OutputFile
+	fs *fullFS
+}
+
+// take reserves room for n bytes, or fails if there is none.
+func (f *fullFile) take(n int) error {
+	if f.fs.written.Add(int64(n)) > f.fs.limit {
+		return &fs.PathError{Op: "write", Path: f.Name(), Err: syscall.ENOSPC}
+	}
+	return nil
+}
+
+func (f *fullFile) Write(p []byte) (int, error) {
+	if err := f.take(len(p)); err != nil {
+		return 0, err
+	}
+	return f.OutputFile.Write(p)
+}
+
+func (f *fullFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *fullFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.take(len(p)); err != nil {
+		return 0, err
+	}
+	return f.OutputFile.WriteAt(p, off)
+}
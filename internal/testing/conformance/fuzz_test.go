@@ -0,0 +1,56 @@
+package conformance
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/hailam/genfile/internal/adapters/factory"
+)
+
+// fuzzLimit is the largest size fuzzed files are generated at. Past it
+// generators write on a file system that runs out of space at fuzzLimit
+// bytes, and must fail cleanly instead.
+const fuzzLimit = 1 << 20
+
+// boundarySizes are the sizes every format is fuzzed from: around zero,
+// the words, sectors and pages formats round to, and the extremes.
+var boundarySizes = []int64{
+	math.MinInt64, -1, 0, 1, 2, 3, 7, 8, 9, 15, 16, 17,
+	63, 64, 65, 255, 256, 257, 511, 512, 513, 4095, 4096, 4097,
+	65535, 65536, 65537, fuzzLimit, fuzzLimit + 1, math.MaxInt32, math.MaxInt64,
+}
+
+// FuzzGenerators feeds sizes to the registered generators, picked by
+// their index in the sorted list of types, and checks each fails or
+// writes a file of the size asked for, without panicking. Sizes past
+// fuzzLimit must fail: the file system is full before they are reached.
+func FuzzGenerators(f *testing.F) {
+	types := factory.RegisteredTypes()
+	slices.Sort(types)
+	for i := range types {
+		for _, size := range boundarySizes {
+			f.Add(uint8(i), size)
+		}
+	}
+	gf := factory.NewGeneratorFactory()
+	f.Fuzz(func(t *testing.T, i uint8, size int64) {
+		if int(i) >= len(types) {
+			t.Skip()
+		}
+		ft := types[i]
+		p := profiles[ft]
+		if p.Skip != "" {
+			t.Skip(p.Skip)
+		}
+		g, err := gf.ForOptions(ft, p.Options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size > fuzzLimit {
+			CheckTooLarge(t, ft, g, size, fuzzLimit)
+			return
+		}
+		CheckSize(t, ft, g, p, size)
+	})
+}
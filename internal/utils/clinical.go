@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"math"
+)
+
+// LabTest is a laboratory observation with its LOINC code, UCUM unit and
+// reference range.
+type LabTest struct {
+	Code     string // LOINC
+	Name     string
+	Unit     string // UCUM
+	Low      float64
+	High     float64
+	Decimals int
+}
+
+// LabTests are common chemistry, hematology and vital-sign observations.
+var LabTests = []LabTest{
+	{"2093-3", "Cholesterol [Mass/volume] in Serum or Plasma", "mg/dL", 125, 200, 0},
+	{"2571-8", "Triglyceride [Mass/volume] in Serum or Plasma", "mg/dL", 40, 150, 0},
+	{"2345-7", "Glucose [Mass/volume] in Serum or Plasma", "mg/dL", 70, 99, 0},
+	{"2160-0", "Creatinine [Mass/volume] in Serum or Plasma", "mg/dL", 0.6, 1.3, 2},
+	{"2951-2", "Sodium [Moles/volume] in Serum or Plasma", "mmol/L", 135, 145, 0},
+	{"2823-3", "Potassium [Moles/volume] in Serum or Plasma", "mmol/L", 3.5, 5.1, 1},
+	{"718-7", "Hemoglobin [Mass/volume] in Blood", "g/dL", 12, 17.5, 1},
+	{"6690-2", "Leukocytes [#/volume] in Blood by Automated count", "10*3/uL", 4.5, 11, 1},
+	{"4548-4", "Hemoglobin A1c/Hemoglobin.total in Blood", "%", 4, 5.6, 1},
+	{"8867-4", "Heart rate", "/min", 60, 100, 0},
+	{"8310-5", "Body temperature", "Cel", 36.1, 37.2, 1},
+	{"29463-7", "Body weight", "kg", 50, 110, 1},
+}
+
+// RandLabTest returns a random entry of LabTests.
+func RandLabTest(r *Rand) LabTest {
+	return LabTests[r.IntN(len(LabTests))]
+}
+
+// Value returns a random result rounded to the test's decimals, mostly
+// within the reference range and sometimes a little outside it.
+func (t LabTest) Value(r *Rand) float64 {
+	span := t.High - t.Low
+	v := t.Low - span/5 + r.Float64()*span*1.4
+	scale := math.Pow(10, float64(t.Decimals))
+	return math.Round(max(v, 0)*scale) / scale
+}
+
+// Flag returns the HL7 abnormal flag of v: L, H or N.
+func (t LabTest) Flag(v float64) string {
+	switch {
+	case v < t.Low:
+		return "L"
+	case v > t.High:
+		return "H"
+	}
+	return "N"
+}
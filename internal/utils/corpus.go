@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// maxCorpus bounds the text read from a corpus, which is held in memory.
+const maxCorpus = 64 << 20
+
+// corpusUnsafe are the characters made spaces in corpus text, along with
+// control characters, so that it needs no escaping in CSV, JSON, HTML or
+// XML, as the built-in vocabularies need none. Hyphens go too, as "--"
+// cannot appear in an XML comment; apostrophes become U+2019 instead.
+const corpusUnsafe = "\"&<>\\,;|-"
+
+// corpora caches the corpora loaded, by path, as every file of a batch
+// loads its own.
+var corpora sync.Map
+
+// TextLanguage returns the vocabulary the "lang" and "corpus" options ask
+// for: a corpus loaded by LoadCorpus, a language by ParseLanguage, or
+// Lorem for neither.
+func TextLanguage(lang, corpus string) (*Language, error) {
+	if corpus == "" {
+		return ParseLanguage(lang)
+	}
+	if lang != "" {
+		return nil, fmt.Errorf("corpus and lang cannot be combined")
+	}
+	return LoadCorpus(corpus)
+}
+
+// LoadCorpus returns a vocabulary of the sentences in the text files at
+// path, a file or a directory of them (not searched recursively). Each
+// line is split into sentences at ".", "!" and "?", so prose gives
+// sentences and data files their rows, cleaned by cleanCorpusText.
+func LoadCorpus(path string) (*Language, error) {
+	if l, ok := corpora.Load(path); ok {
+		return l.(*Language), nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("corpus: %w", err)
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("corpus: %w", err)
+		}
+		files = files[:0]
+		for _, e := range entries {
+			if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+
+	l := &Language{Code: "und", sep: " ", stop: "."}
+	var total int64
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("corpus: %w", err)
+		}
+		if total += int64(len(data)); total > maxCorpus {
+			return nil, fmt.Errorf("corpus %s is larger than %d MiB", path, maxCorpus>>20)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			for _, s := range strings.FieldsFunc(line, func(r rune) bool { return r == '.' || r == '!' || r == '?' }) {
+				if s = cleanCorpusText(s); s != "" {
+					l.sentences = append(l.sentences, s)
+					l.words = append(l.words, strings.Fields(s)...)
+				}
+			}
+		}
+	}
+	if len(l.sentences) == 0 {
+		return nil, fmt.Errorf("corpus %s holds no text", path)
+	}
+	actual, _ := corpora.LoadOrStore(path, l)
+	return actual.(*Language), nil
+}
+
+// cleanCorpusText returns s without invalid UTF-8 and noncharacters, with
+// its apostrophes typographic, the characters in corpusUnsafe and control
+// characters made spaces, and runs of spaces made one.
+func cleanCorpusText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\'':
+			return '’'
+		case unicode.IsControl(r), strings.ContainsRune(corpusUnsafe, r):
+			return ' '
+		case r == unicode.ReplacementChar, r&0xFFFE == 0xFFFE, r >= 0xFDD0 && r <= 0xFDEF:
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(s, ""))
+	return strings.Join(strings.Fields(s), " ")
+}
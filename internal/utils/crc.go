@@ -0,0 +1,47 @@
+package utils
+
+// CRC32Zeros returns the IEEE CRC-32 of n zero bytes without reading them,
+// by squaring the matrix that runs the CRC register over one zero bit, as
+// zlib's crc32_combine does.
+func CRC32Zeros(n int64) uint32 {
+	var odd, even [32]uint32
+	odd[0] = 0xEDB88320 // the polynomial, reflected
+	for i := 1; i < 32; i++ {
+		odd[i] = 1 << (i - 1)
+	}
+	square(&even, &odd) // two zero bits
+	square(&odd, &even) // four
+	reg := uint32(0xFFFFFFFF)
+	for n > 0 {
+		square(&even, &odd) // a byte's worth, then doubling
+		if n&1 != 0 {
+			reg = times(&even, reg)
+		}
+		n >>= 1
+		if n == 0 {
+			break
+		}
+		square(&odd, &even)
+		if n&1 != 0 {
+			reg = times(&odd, reg)
+		}
+		n >>= 1
+	}
+	return ^reg
+}
+
+func times(mat *[32]uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func square(dst, mat *[32]uint32) {
+	for i := range dst {
+		dst[i] = times(mat, mat[i])
+	}
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FillerBlock is the granularity at which filler mixes random and
+	// repeated bytes: small enough for a compressor's window, large enough
+	// that a random block does not compress.
+	FillerBlock = 4096
+	// FillerChunk is the granularity at which filler is drawn from a shared
+	// pool: as large as the chunks deduplicating storage looks for.
+	FillerChunk = 64 * 1024
+	// poolChunks is the number of distinct chunks in a shared pool.
+	poolChunks = 1024
+)
+
+// Filler describes the filler data that pads a file: how much of it
+// compresses, and how much is drawn from a pool of chunks shared with the
+// other files of a batch, which deduplicates across them.
+type Filler struct {
+	Entropy float64 // share of the blocks that is random rather than repeated
+	Shared  float64 // share of the chunks copied from the pool
+	Pool    uint64  // seed of the pool; files with the same seed share chunks
+}
+
+// RandomFiller is filler that is all random, as Rand.WriteBytes writes.
+var RandomFiller = Filler{Entropy: 1}
+
+// ParseFiller parses the values of the "entropy", "shared-blocks" and
+// "shared-pool" options: the share of filler bytes that are random, 1 if
+// empty; the share of filler chunks drawn from the shared pool, 0 if
+// empty; and the pool's seed, one drawn from r if empty.
+func ParseFiller(r *Rand, entropy, shared, pool string) (Filler, error) {
+	f := RandomFiller
+	var err error
+	if f.Entropy, err = parseShare("entropy", entropy, 1); err != nil {
+		return f, err
+	}
+	if f.Shared, err = parseShare("shared-blocks", shared, 0); err != nil {
+		return f, err
+	}
+	switch {
+	case pool != "" && f.Shared == 0:
+		return f, fmt.Errorf("shared-pool needs shared-blocks")
+	case pool != "":
+		if f.Pool, err = strconv.ParseUint(strings.TrimSpace(pool), 10, 64); err != nil {
+			return f, fmt.Errorf("shared-pool must be a whole number, got %q", pool)
+		}
+	case f.Shared > 0:
+		f.Pool = r.Uint64()
+	}
+	return f, nil
+}
+
+// parseShare parses the value s of option name, a number from 0 to 1;
+// def if s is empty.
+func parseShare(name, s string, def float64) (float64, error) {
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || v < 0 || v > 1 {
+		return 0, fmt.Errorf("%s must be between 0 and 1, got %q", name, s)
+	}
+	return v, nil
+}
+
+// fillerPattern is what the repeated blocks of filler repeat, and
+// fillerBlock a block of it.
+var (
+	fillerPattern = []byte("genfile filler: repeated to compress, between random blocks. ")
+	fillerBlock   = bytes.Repeat(fillerPattern, FillerBlock/len(fillerPattern)+1)[:FillerBlock]
+)
+
+// Write writes n bytes of filler, drawing its random bytes from r, to w.
+// Random filler is r.WriteBytes.
+func (f Filler) Write(r *Rand, w io.Writer, n int64) error {
+	if f == RandomFiller {
+		return r.WriteBytes(w, n)
+	}
+	buf := make([]byte, FillerChunk)
+	for offset := int64(0); offset < n; offset += FillerChunk {
+		k := min(n-offset, FillerChunk)
+		r.Read(buf[:k])
+		f.Mix(buf[:k], offset)
+		if _, err := w.Write(buf[:k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fill fills b, which is the filler from offset on, a multiple of
+// FillerChunk, with f's filler, its random bytes from r.FillAt. With
+// WriteParallel it writes filler like Write's on several goroutines.
+func (f Filler) Fill(r *Rand, b []byte, offset int64) error {
+	r.FillAt(b, offset)
+	if f != RandomFiller {
+		f.Mix(b, offset)
+	}
+	return nil
+}
+
+// Mix turns random bytes b, which are the filler from offset on, a
+// multiple of FillerChunk, into f's filler. A share f.Shared of the chunks
+// is replaced with chunks of the pool, the same at the same offset of
+// every file drawing on it, and a share 1-f.Entropy of the blocks of the
+// rest with a repeated pattern. Both are spread evenly, so a compressor
+// shrinks any stretch of filler to about the share that stays random.
+func (f Filler) Mix(b []byte, offset int64) {
+	for off := 0; off < len(b); off += FillerChunk {
+		chunk := b[off:min(off+FillerChunk, len(b))]
+		c := (offset + int64(off)) / FillerChunk
+		if spread(c, f.Shared) {
+			poolChunk(chunk, f.Pool, c)
+			continue
+		}
+		if f.Entropy == 1 {
+			continue
+		}
+		for bo := 0; bo < len(chunk); bo += FillerBlock {
+			if !spread((offset+int64(off+bo))/FillerBlock, f.Entropy) {
+				copy(chunk[bo:min(bo+FillerBlock, len(chunk))], fillerBlock)
+			}
+		}
+	}
+}
+
+// spread reports whether the i-th of a run of places is one of a share of
+// them spread evenly: it is when the share of the places so far passes a
+// whole place.
+func spread(i int64, share float64) bool {
+	return int64(float64(i+1)*share) > int64(float64(i)*share)
+}
+
+// poolChunk fills b with the start of the chunk of the pool seeded with
+// pool that goes at chunk c of a file.
+func poolChunk(b []byte, pool uint64, c int64) {
+	pick := rand.New(rand.NewPCG(^pool, uint64(c)))
+	src := rand.NewPCG(pool, pick.Uint64N(poolChunks))
+	var word [8]byte
+	for i := 0; i < len(b); i += 8 {
+		binary.LittleEndian.PutUint64(word[:], src.Uint64())
+		copy(b[i:], word[:])
+	}
+}
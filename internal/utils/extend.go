@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+)
+
+// ExtendableFile is the part of an *os.File that Extend needs.
+type ExtendableFile interface {
+	io.WriterAt
+	io.Seeker
+	Name() string
+	Truncate(size int64) error
+}
+
+// Extend grows f from its current offset to size bytes without writing
+// the new bytes, which read as zeros. With preallocate the disk blocks are
+// reserved for them; otherwise they are left as a sparse hole. The offset
+// of f is left at size.
+func Extend(f ExtendableFile, size int64, preallocate bool) error {
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to find offset in %s: %w", f.Name(), err)
+	}
+	if size < off {
+		return fmt.Errorf("cannot extend %s to %d bytes: already %d", f.Name(), size, off)
+	}
+	if preallocate && size > off {
+		if err := allocate(f, off, size-off); err != nil {
+			return fmt.Errorf("failed to preallocate %s: %w", f.Name(), err)
+		}
+	}
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("failed to extend %s: %w", f.Name(), err)
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek in %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// writeZeros allocates n bytes at off the portable way, by writing them.
+func writeZeros(f io.WriterAt, off, n int64) error {
+	buf := make([]byte, min(n, 1<<20))
+	for n > 0 {
+		k := min(n, int64(len(buf)))
+		if _, err := f.WriteAt(buf[:k], off); err != nil {
+			return err
+		}
+		off += k
+		n -= k
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// allocate reserves n bytes at off with fallocate(2), falling back to
+// writing zeros on file systems that do not support it and for files
+// other than *os.File.
+func allocate(f ExtendableFile, off, n int64) error {
+	osFile, ok := f.(*os.File)
+	if !ok {
+		return writeZeros(f, off, n)
+	}
+	err := syscall.Fallocate(int(osFile.Fd()), 0, off, n)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return writeZeros(f, off, n)
+	}
+	return err
+}
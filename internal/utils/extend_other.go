@@ -0,0 +1,8 @@
+//go:build !linux
+
+package utils
+
+// allocate reserves n bytes at off by writing zeros.
+func allocate(f ExtendableFile, off, n int64) error {
+	return writeZeros(f, off, n)
+}
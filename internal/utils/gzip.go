@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// gzipOverhead is a gzip member's header, without name or comment,
+	// and its trailer.
+	gzipOverhead = 10 + 8
+	// storedHeader is the header of a stored deflate block written on a
+	// byte boundary: the block type byte, LEN and NLEN.
+	storedHeader = 5
+	// maxStored is the most data a stored deflate block holds.
+	maxStored = 65535
+)
+
+// StoredGzipSize returns the length of the stream NewStoredGzip writes
+// for n bytes with extra empty blocks.
+func StoredGzipSize(n int64, extra int) int64 {
+	blocks := max(1, (n+maxStored-1)/maxStored) + int64(extra)
+	return gzipOverhead + storedHeader*blocks + n
+}
+
+// storedGzip writes a gzip stream whose deflate data is stored blocks,
+// as a compressor falls back to for random data, so that its length is
+// known in advance. Empty blocks before the final one pad it by
+// storedHeader bytes each.
+type storedGzip struct {
+	w       io.Writer
+	extra   int    // empty blocks still to write before the final one
+	buf     []byte // data of the block being filled
+	crc     uint32
+	n       uint32 // input length, modulo 2^32 as gzip records it
+	started bool
+	err     error
+}
+
+// NewStoredGzip returns a writer that gzips what is written to it into w
+// as stored deflate blocks, followed by extra empty ones. Its output is
+// StoredGzipSize bytes long, whatever the data.
+func NewStoredGzip(w io.Writer, extra int) io.WriteCloser {
+	return &storedGzip{w: w, extra: extra, buf: make([]byte, 0, maxStored)}
+}
+
+func (z *storedGzip) Write(p []byte) (int, error) {
+	if !z.started {
+		// Deflate, no flags, no modification time, unknown OS.
+		z.write([]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff})
+		z.started = true
+	}
+	n := len(p)
+	for len(p) > 0 && z.err == nil {
+		// A full block is written once more data follows it, so that
+		// the last one can be marked final on Close.
+		if len(z.buf) == maxStored {
+			z.block(z.buf, false)
+			z.buf = z.buf[:0]
+		}
+		m := min(len(p), maxStored-len(z.buf))
+		z.buf = append(z.buf, p[:m]...)
+		z.crc = crc32.Update(z.crc, crc32.IEEETable, p[:m])
+		z.n += uint32(m)
+		p = p[m:]
+	}
+	return n, z.err
+}
+
+// Close writes the last data block, the empty padding blocks and the
+// gzip trailer.
+func (z *storedGzip) Close() error {
+	if !z.started {
+		z.Write(nil)
+	}
+	z.block(z.buf, z.extra == 0)
+	for i := z.extra; i > 0; i-- {
+		z.block(nil, i == 1)
+	}
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], z.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], z.n)
+	z.write(trailer[:])
+	return z.err
+}
+
+func (z *storedGzip) block(data []byte, final bool) {
+	var h [storedHeader]byte
+	if final {
+		h[0] = 1 // BFINAL, BTYPE 00
+	}
+	binary.LittleEndian.PutUint16(h[1:], uint16(len(data)))
+	binary.LittleEndian.PutUint16(h[3:], ^uint16(len(data)))
+	z.write(h[:])
+	z.write(data)
+}
+
+func (z *storedGzip) write(p []byte) {
+	if z.err == nil {
+		_, z.err = z.w.Write(p)
+	}
+}
+
+// FitStoredGzip returns the largest length n of the form base+k*step,
+// for k >= 0, and the number of empty blocks extra for which
+// StoredGzipSize(n, extra) is exactly size. It reports false if there is
+// none. The empty blocks take up 5 bytes each, so with a step that is not
+// a multiple of 5 every size from StoredGzipSize(base+4*step, 0) on fits.
+func FitStoredGzip(size, base, step int64) (n int64, extra int, ok bool) {
+	if size < StoredGzipSize(base, 0) {
+		return 0, 0, false
+	}
+	k := (size - StoredGzipSize(base, 0)) / step
+	for k >= 0 && StoredGzipSize(base+k*step, 0) > size {
+		k--
+	}
+	for i := 0; i < storedHeader && k >= 0; i, k = i+1, k-1 {
+		n = base + k*step
+		if d := size - StoredGzipSize(n, 0); d%storedHeader == 0 {
+			return n, int(d / storedHeader), true
+		}
+	}
+	return 0, 0, false
+}
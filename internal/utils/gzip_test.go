@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestStoredGzip(t *testing.T) {
+	for _, n := range []int{0, 1, maxStored, maxStored + 1, 3*maxStored + 7} {
+		for _, extra := range []int{0, 2} {
+			data := bytes.Repeat([]byte{'x'}, n)
+			var buf bytes.Buffer
+			z := NewStoredGzip(&buf, extra)
+			if _, err := z.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := z.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := int64(buf.Len()), StoredGzipSize(int64(n), extra); got != want {
+				t.Errorf("n=%d extra=%d: stream is %d bytes, StoredGzipSize() = %d", n, extra, got, want)
+			}
+			zr, err := gzip.NewReader(&buf)
+			if err != nil {
+				t.Fatalf("n=%d extra=%d: gzip.NewReader() error = %v", n, extra, err)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("n=%d extra=%d: decompressing error = %v", n, extra, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("n=%d extra=%d: decompressed %d bytes, want %d", n, extra, len(got), n)
+			}
+		}
+	}
+}
+
+func TestFitStoredGzip(t *testing.T) {
+	for _, size := range []int64{3607, 3608, 3609, 3610, 3611, 70000, 1 << 20, 10000019} {
+		n, extra, ok := FitStoredGzip(size, 1536, 512)
+		if !ok {
+			t.Errorf("FitStoredGzip(%d) found no length", size)
+			continue
+		}
+		if got := StoredGzipSize(n, extra); got != size || (n-1536)%512 != 0 {
+			t.Errorf("FitStoredGzip(%d) = %d, %d: stream of %d bytes", size, n, extra, got)
+		}
+		// A step larger still would not fit.
+		if StoredGzipSize(n+5*512, 0) <= size {
+			t.Errorf("FitStoredGzip(%d) = %d, not the largest length", size, n)
+		}
+	}
+	// Near the smallest stream, not every size fits.
+	if _, _, ok := FitStoredGzip(2000, 1536, 512); ok {
+		t.Error("FitStoredGzip(2000) fitted a length, want none")
+	}
+	if _, _, ok := FitStoredGzip(100, 1536, 512); ok {
+		t.Error("FitStoredGzip() fitted a length into a stream too small for it")
+	}
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// iccHeaderLen is the size of an ICC profile header; the tag count and
+// table follow it.
+const iccHeaderLen = 128
+
+// ICCPadOverhead is the least a profile grows by when padded: a tag table
+// entry and the header of the data element holding the padding. Up to
+// three more bytes align the element.
+const ICCPadOverhead = 12 + 12
+
+// ICCProfile returns the colour profile spec names: "srgb" or "gray" for a
+// built-in profile, otherwise the path of an ICC profile file.
+func ICCProfile(spec string) ([]byte, error) {
+	switch strings.ToLower(spec) {
+	case "srgb":
+		return builtinProfile("RGB ", "genfile sRGB (gamma 2.2)"), nil
+	case "gray":
+		return builtinProfile("GRAY", "genfile Gray (gamma 2.2)"), nil
+	}
+	data, err := os.ReadFile(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ICC profile: %w", err)
+	}
+	if len(data) < iccHeaderLen+4 || string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("%s is not an ICC profile", spec)
+	}
+	if size := binary.BigEndian.Uint32(data); int(size) != len(data) {
+		return nil, fmt.Errorf("ICC profile %s declares %d bytes but holds %d", spec, size, len(data))
+	}
+	return data, nil
+}
+
+// ICCColorSpace returns the data colour space of profile, such as "RGB",
+// "GRAY" or "CMYK".
+func ICCColorSpace(profile []byte) string {
+	return strings.TrimSpace(string(profile[16:20]))
+}
+
+// builtinProfile builds a version 2.1 display profile in the colour space
+// space ("RGB " or "GRAY") with a gamma 2.2 tone curve and, for RGB, the
+// sRGB primaries adapted to D50.
+func builtinProfile(space, desc string) []byte {
+	be := binary.BigEndian
+	s15 := func(b []byte, vs ...float64) []byte {
+		for _, v := range vs {
+			b = be.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+		}
+		return b
+	}
+	xyz := func(x, y, z float64) []byte { return s15([]byte("XYZ \x00\x00\x00\x00"), x, y, z) }
+
+	descTag := []byte("desc\x00\x00\x00\x00")
+	descTag = be.AppendUint32(descTag, uint32(len(desc)+1))
+	descTag = append(descTag, desc+"\x00"...)
+	descTag = append(descTag, make([]byte, 4+4+2+1+67)...) // no Unicode or ScriptCode description
+	cprt := []byte("text\x00\x00\x00\x00No copyright, use freely\x00")
+	// A single gamma of 2.2 as u8Fixed8Number.
+	trc := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01\x02\x33")
+
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	tags := []tag{{"desc", descTag}, {"cprt", cprt}, {"wtpt", xyz(0.9642, 1, 0.8249)}}
+	if space == "GRAY" {
+		tags = append(tags, tag{"kTRC", trc})
+	} else {
+		tags = append(tags,
+			tag{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+			tag{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+			tag{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+			tag{"rTRC", trc}, tag{"gTRC", trc}, tag{"bTRC", trc})
+	}
+
+	var table, elements bytes.Buffer
+	start := iccHeaderLen + 4 + 12*len(tags)
+	offsets := map[string]int{} // identical elements, such as the tone curves, are stored once
+	for _, t := range tags {
+		off, ok := offsets[string(t.data)]
+		if !ok {
+			off = start + elements.Len()
+			offsets[string(t.data)] = off
+			elements.Write(t.data)
+			for elements.Len()%4 != 0 {
+				elements.WriteByte(0)
+			}
+		}
+		table.WriteString(t.sig)
+		binary.Write(&table, be, uint32(off))
+		binary.Write(&table, be, uint32(len(t.data)))
+	}
+
+	header := make([]byte, iccHeaderLen)
+	be.PutUint32(header[0:], uint32(start+elements.Len()))
+	be.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntr")
+	copy(header[16:], space)
+	copy(header[20:], "XYZ ")
+	for i, v := range []uint16{2026, 1, 1} { // creation date and time
+		be.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	s15(header[68:68], 0.9642, 1, 0.8249) // D50 illuminant
+	copy(header[80:], "gnfl")
+
+	out := append(header, be.AppendUint32(nil, uint32(len(tags)))...)
+	out = append(out, table.Bytes()...)
+	return append(out, elements.Bytes()...)
+}
+
+// PadICCProfile returns profile grown by exactly n bytes, n at least
+// ICCPadMin(profile), with a private tag holding random data from r. The tag
+// ends the profile unpadded, as version 2 profiles allow; any profile ID
+// is cleared, since it no longer matches.
+func PadICCProfile(r *Rand, profile []byte, n int) ([]byte, error) {
+	be := binary.BigEndian
+	if len(profile) < iccHeaderLen+4 {
+		return nil, fmt.Errorf("ICC profile too short")
+	}
+	minPad := ICCPadMin(profile)
+	if n < minPad {
+		return nil, fmt.Errorf("cannot pad an ICC profile by %d bytes; the minimum is %d", n, minPad)
+	}
+	count := int(be.Uint32(profile[iccHeaderLen:]))
+	tableEnd := iccHeaderLen + 4 + 12*count
+	if tableEnd > len(profile) {
+		return nil, fmt.Errorf("ICC profile tag table overruns the profile")
+	}
+
+	out := make([]byte, 0, len(profile)+n)
+	out = append(out, profile[:iccHeaderLen]...)
+	out = be.AppendUint32(out, uint32(count+1))
+	// Existing elements move down by the new table entry.
+	for i := 0; i < count; i++ {
+		e := profile[iccHeaderLen+4+12*i:]
+		out = append(out, e[:4]...)
+		out = be.AppendUint32(out, be.Uint32(e[4:])+12)
+		out = append(out, e[8:12]...)
+	}
+	align := minPad - ICCPadOverhead
+	padOff := len(profile) + 12 + align
+	dataLen := n - ICCPadOverhead - align
+	out = append(out, "gfpd"...)
+	out = be.AppendUint32(out, uint32(padOff))
+	out = be.AppendUint32(out, uint32(12+dataLen))
+	out = append(out, profile[tableEnd:]...)
+	out = append(out, make([]byte, align)...)
+	out = append(out, "data\x00\x00\x00\x00\x00\x00\x00\x01"...) // binary data
+	fill := make([]byte, dataLen)
+	r.Read(fill)
+	out = append(out, fill...)
+
+	be.PutUint32(out[0:], uint32(len(out)))
+	clear(out[84:100]) // profile ID
+	return out, nil
+}
+
+// ICCPadMin returns the least PadICCProfile can grow profile by.
+func ICCPadMin(profile []byte) int {
+	return ICCPadOverhead + (4-(len(profile)+12)%4)%4
+}
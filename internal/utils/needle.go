@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Needle is a string planted a known number of times in the text of a
+// generated file, as ground truth for search and indexing tests.
+type Needle struct {
+	Text  string
+	Count int // 0 plants nothing
+}
+
+// ParseNeedle parses the values of the "embed-string" and "embed-count"
+// options: printable text, and how many times it is planted, once if
+// count is empty. An empty text is the zero Needle.
+func ParseNeedle(text, count string) (Needle, error) {
+	if text == "" {
+		if count != "" {
+			return Needle{}, fmt.Errorf("embed-count needs embed-string")
+		}
+		return Needle{}, nil
+	}
+	if !utf8.ValidString(text) || strings.ContainsFunc(text, unicode.IsControl) {
+		return Needle{}, fmt.Errorf("embed-string must be printable text on one line, got %q", text)
+	}
+	n := Needle{Text: text, Count: 1}
+	if count != "" {
+		var err error
+		if n.Count, err = strconv.Atoi(strings.TrimSpace(count)); err != nil || n.Count < 1 {
+			return Needle{}, fmt.Errorf("embed-count must be a whole number of at least 1, got %q", count)
+		}
+	}
+	return n, nil
+}
+
+// At returns where the i-th copy, counting from 0, goes among places
+// places (bytes, lines, paragraphs): the copies split them evenly, each
+// after the first At(i, places) of them. It is below places for
+// places > 0.
+func (n Needle) At(i int, places int64) int64 {
+	return places * int64(i+1) / int64(n.Count+1)
+}
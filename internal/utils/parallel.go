@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ParallelChunk is how many bytes each goroutine of WriteParallel fills
+// at a time: a whole number of FillerChunks, so that filler mixed chunk by
+// chunk comes out as it would in one go.
+const ParallelChunk = 16 * FillerChunk
+
+// ParseThreads parses the value of the "threads" option: how many
+// goroutines fill a file's payload, 1 if empty, and as many as there are
+// CPUs if 0.
+func ParseThreads(s string) (int, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("threads must be a whole number, 0 for one per CPU, got %q", s)
+	}
+	if n == 0 {
+		n = runtime.NumCPU()
+	}
+	return n, nil
+}
+
+// WriteParallel writes n bytes to w, filled in ParallelChunk pieces by
+// fill on threads goroutines at once. fill gets each piece with its offset
+// from the first byte, and must not depend on the order the pieces are
+// filled in. A file, or anything else that can be written at an offset
+// and seeked, is written by the goroutines themselves with positional
+// writes, and left positioned after the n bytes; anything else, such as an
+// archive entry whose checksum runs over its bytes in order, gets the
+// pieces in order. One thread fills and writes the pieces in turn.
+func WriteParallel(w io.Writer, n int64, threads int, fill func(b []byte, offset int64) error) error {
+	if threads <= 1 || n <= ParallelChunk {
+		return writeSerial(w, n, fill)
+	}
+	if f, ok := w.(interface {
+		io.WriterAt
+		io.Seeker
+	}); ok {
+		return writeAtParallel(f, n, threads, fill)
+	}
+	return writeOrdered(w, n, threads, fill)
+}
+
+// writeSerial is WriteParallel on one thread. It writes nothing for n of
+// zero or less.
+func writeSerial(w io.Writer, n int64, fill func([]byte, int64) error) error {
+	if n <= 0 {
+		return nil
+	}
+	buf := make([]byte, min(n, ParallelChunk))
+	for offset := int64(0); offset < n; offset += ParallelChunk {
+		b := buf[:min(n-offset, ParallelChunk)]
+		if err := fill(b, offset); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAtParallel is WriteParallel to a file: each goroutine takes the
+// next piece, fills it and writes it at its place.
+func writeAtParallel(f interface {
+	io.WriterAt
+	io.Seeker
+}, n int64, threads int, fill func([]byte, int64) error) error {
+	base, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	var next atomic.Int64 // offset of the next piece to take
+	var failed atomic.Bool
+	errs := make([]error, threads)
+	var wg sync.WaitGroup
+	for t := range threads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, ParallelChunk)
+			for !failed.Load() {
+				offset := next.Add(ParallelChunk) - ParallelChunk
+				if offset >= n {
+					return
+				}
+				b := buf[:min(n-offset, ParallelChunk)]
+				err := fill(b, offset)
+				if err == nil {
+					_, err = f.WriteAt(b, base+offset)
+				}
+				if err != nil {
+					errs[t] = err
+					failed.Store(true)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	_, err = f.Seek(base+n, io.SeekStart)
+	return err
+}
+
+// filled is a piece of writeOrdered, or the error filling it.
+type filled struct {
+	b   []byte
+	err error
+}
+
+// writeOrdered is WriteParallel to a stream: pieces are filled on threads
+// goroutines, up to threads of them ahead of the one being written, and
+// written in order.
+func writeOrdered(w io.Writer, n int64, threads int, fill func([]byte, int64) error) error {
+	pending := make(chan chan filled, threads)
+	done := make(chan struct{})
+	defer close(done)
+	free := make(chan []byte, threads+1)
+	go func() {
+		defer close(pending)
+		for offset := int64(0); offset < n; offset += ParallelChunk {
+			var buf []byte
+			select {
+			case buf = <-free:
+			default:
+				buf = make([]byte, ParallelChunk)
+			}
+			piece := make(chan filled, 1)
+			select {
+			case pending <- piece:
+			case <-done:
+				return
+			}
+			go func(b []byte, offset int64) {
+				piece <- filled{b, fill(b, offset)}
+			}(buf[:min(n-offset, ParallelChunk)], offset)
+		}
+	}()
+	for piece := range pending {
+		p := <-piece
+		if p.err != nil {
+			return p.err
+		}
+		if _, err := w.Write(p.b); err != nil {
+			return err
+		}
+		select {
+		case free <- p.b[:cap(p.b)]:
+		default:
+		}
+	}
+	return nil
+}
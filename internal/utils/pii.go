@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ContentPII is the content profile that seeds text with synthetic
+// personal data, for evaluating data loss prevention detectors.
+const ContentPII = "pii"
+
+// Kinds of personal data the pii content profile plants.
+const (
+	PIISSN        = "ssn"
+	PIICreditCard = "credit-card"
+	PIIEmail      = "email"
+)
+
+// MaxPIILen bounds the length of a planted value, so that text broken
+// into lines can be kept to lines at least that long.
+const MaxPIILen = 32
+
+// PIIItem is a piece of synthetic personal data planted in a file, as
+// its ground-truth manifest lists it.
+type PIIItem struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Offset int64  `json:"offset"`           // in bytes from the start of the file
+	Line   int64  `json:"line,omitempty"`   // of a text file, from 1
+	Row    int64  `json:"row,omitempty"`    // of a CSV file, from 1
+	Column int    `json:"column,omitempty"` // of a CSV file, from 1
+}
+
+// ParsePIIDensity parses the "pii-density" option value: the share of
+// words or cells that are personal data, above 0 and at most 1; 0.05 if
+// empty.
+func ParsePIIDensity(s string) (float64, error) {
+	if s == "" {
+		return 0.05, nil
+	}
+	d, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || d <= 0 || d > 1 {
+		return 0, fmt.Errorf("pii-density must be above 0 and at most 1, got %q", s)
+	}
+	return d, nil
+}
+
+// RandPII returns a random piece of synthetic personal data: a US social
+// security number, a credit card number passing the Luhn check, or an
+// email address at a reserved example domain.
+func RandPII(r *Rand) PIIItem {
+	switch r.IntN(3) {
+	case 0:
+		return PIIItem{Type: PIISSN, Value: randSSN(r)}
+	case 1:
+		return PIIItem{Type: PIICreditCard, Value: randCardNumber(r)}
+	default:
+		return PIIItem{Type: PIIEmail, Value: randEmail(r)}
+	}
+}
+
+// randSSN returns a social security number in the AAA-GG-SSSS form, with
+// an area number the SSA could issue (not 000, 666 or 900 and up) and a
+// nonzero group and serial.
+func randSSN(r *Rand) string {
+	area := 1 + r.IntN(898)
+	if area >= 666 {
+		area++
+	}
+	return fmt.Sprintf("%03d-%02d-%04d", area, 1+r.IntN(99), 1+r.IntN(9999))
+}
+
+// cardPrefixes are the issuer prefixes of Visa, Mastercard and American
+// Express, with the lengths of their numbers.
+var cardPrefixes = []struct {
+	prefix string
+	length int
+}{{"4", 16}, {"51", 16}, {"52", 16}, {"53", 16}, {"54", 16}, {"55", 16}, {"34", 15}, {"37", 15}}
+
+// randCardNumber returns a card number of a major issuer ending in its
+// Luhn check digit, as 16-digit cards print it in groups of four or, for
+// 15 digits, as one run.
+func randCardNumber(r *Rand) string {
+	p := cardPrefixes[r.IntN(len(cardPrefixes))]
+	digits := []byte(p.prefix)
+	for len(digits) < p.length-1 {
+		digits = append(digits, byte('0'+r.IntN(10)))
+	}
+	digits = append(digits, LuhnDigit(string(digits)))
+	if p.length != 16 {
+		return string(digits)
+	}
+	return fmt.Sprintf("%s %s %s %s", digits[:4], digits[4:8], digits[8:12], digits[12:])
+}
+
+// LuhnDigit returns the check digit that makes the decimal digits of
+// number, followed by it, pass the Luhn check.
+func LuhnDigit(number string) byte {
+	sum := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if (len(number)-i)%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// Names and domains of the synthetic email addresses; the domains are
+// reserved for examples, so no mail can reach them.
+var (
+	piiFirstNames = []string{"james", "mary", "robert", "patricia", "john", "jennifer", "michael", "linda", "david", "susan", "maria", "ahmed", "wei", "olga", "priya", "kenji"}
+	piiLastNames  = []string{"smith", "johnson", "williams", "brown", "jones", "garcia", "miller", "davis", "rodriguez", "martinez", "nguyen", "khan", "chen", "ivanova", "patel", "sato"}
+	piiDomains    = []string{"example.com", "example.org", "example.net"}
+)
+
+// randEmail returns an address such as mary.chen42@example.org.
+func randEmail(r *Rand) string {
+	return fmt.Sprintf("%s.%s%d@%s",
+		piiFirstNames[r.IntN(len(piiFirstNames))],
+		piiLastNames[r.IntN(len(piiLastNames))],
+		r.IntN(100),
+		piiDomains[r.IntN(len(piiDomains))])
+}
+
+// PIIManifestPath returns the path of the manifest of the file at path:
+// its name with the extension replaced by .pii.json.
+func PIIManifestPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".pii.json"
+}
+
+// WritePIIManifest writes the ground truth of the file at path, the
+// personal data items planted in it in the order they appear, as JSON to
+// its manifest path with writeFile, and returns that path. writeFile
+// creates or truncates a file holding data, as os.WriteFile does.
+func WritePIIManifest(path string, items []PIIItem, writeFile func(path string, data []byte) error) (string, error) {
+	manifest := struct {
+		Counts map[string]int `json:"counts"`
+		Items  []PIIItem      `json:"items"`
+	}{Counts: map[string]int{PIISSN: 0, PIICreditCard: 0, PIIEmail: 0}, Items: items}
+	if manifest.Items == nil {
+		manifest.Items = []PIIItem{}
+	}
+	for _, item := range items {
+		manifest.Counts[item.Type]++
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	out := PIIManifestPath(path)
+	if err := writeFile(out, append(data, '\n')); err != nil {
+		return out, fmt.Errorf("failed to write the PII manifest: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// randomChunk is how many bytes WriteBytes draws and writes at a time.
+const randomChunk = 64 * 1024
+
+// fillAtBlock is the length of the runs of bytes FillAt draws from one
+// stream, keyed by the run's place in the file.
+const fillAtBlock = 64 * 1024
+
+// Rand is the randomness one file is made from: the choices its generator
+// makes, through the methods of rand.Rand, and its random payload bytes,
+// from a ChaCha8 stream fast enough to fill gigabytes but not for keys.
+// Seeded, it makes the same choices and bytes every time, so that the
+// same seed, size and options give the same file. A Rand is used for one
+// file at a time and is not safe for concurrent use, except for FillAt.
+type Rand struct {
+	*rand.Rand
+	stream *rand.ChaCha8
+	seed   [32]byte
+}
+
+// NewRand returns the Rand of a file, seeded from seed, the value of the
+// "seed" option, or at random if it is empty.
+func NewRand(seed string) (*Rand, error) {
+	if seed = strings.TrimSpace(seed); seed == "" {
+		var s [32]byte
+		for i := 0; i < len(s); i += 8 {
+			binary.LittleEndian.PutUint64(s[i:], rand.Uint64())
+		}
+		return newRand(s), nil
+	}
+	n, err := strconv.ParseInt(seed, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("seed must be a whole number, got %q", seed)
+	}
+	return SeededRand(n), nil
+}
+
+// SeededRand returns the Rand seeded from seed.
+func SeededRand(seed int64) *Rand {
+	var s [32]byte
+	copy(s[:], "genfile seed")
+	binary.LittleEndian.PutUint64(s[24:], uint64(seed))
+	return newRand(s)
+}
+
+func newRand(seed [32]byte) *Rand {
+	stream := rand.NewChaCha8(seed)
+	return &Rand{Rand: rand.New(stream), stream: stream, seed: seed}
+}
+
+// Split returns a Rand seeded from the next bytes of r, for a part of the
+// file made apart from the rest, such as an entry filled on goroutines of
+// its own.
+func (r *Rand) Split() *Rand {
+	var s [32]byte
+	r.stream.Read(s[:])
+	return newRand(s)
+}
+
+// Read fills b with random bytes. It never fails.
+func (r *Rand) Read(b []byte) (int, error) {
+	return r.stream.Read(b)
+}
+
+// WriteBytes writes n random bytes to w.
+func (r *Rand) WriteBytes(w io.Writer, n int64) error {
+	buf := make([]byte, min(n, randomChunk))
+	for n > 0 {
+		b := buf[:min(n, int64(len(buf)))]
+		r.stream.Read(b)
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		n -= int64(len(b))
+	}
+	return nil
+}
+
+// FillAt fills b, the bytes from offset on of a run of random bytes, with
+// bytes that depend on r's seed and offset alone, not on what r has drawn
+// so far nor on how the run is cut into calls, so that WriteParallel
+// writes them the same on any number of goroutines and a resumed run
+// carries them on. It is safe for concurrent use.
+func (r *Rand) FillAt(b []byte, offset int64) error {
+	var skip [4096]byte
+	for len(b) > 0 {
+		block, in := offset/fillAtBlock, offset%fillAtBlock
+		seed := r.seed
+		binary.LittleEndian.PutUint64(seed[16:], binary.LittleEndian.Uint64(seed[16:])^(uint64(block)+1))
+		stream := rand.NewChaCha8(seed)
+		for n := in; n > 0; n -= min(n, int64(len(skip))) {
+			stream.Read(skip[:min(n, int64(len(skip)))])
+		}
+		n := min(int64(len(b)), fillAtBlock-in)
+		stream.Read(b[:n])
+		b, offset = b[n:], offset+n
+	}
+	return nil
+}
+
+// String returns n random uppercase letters.
+func (r *Rand) String(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('A' + r.IntN(26))
+	}
+	return string(b)
+}
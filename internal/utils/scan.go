@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+)
+
+// PageSizes maps paper size names to their dimensions in PostScript points
+// (1/72 inch).
+var PageSizes = map[string][2]int{
+	"a3":     {842, 1191},
+	"a4":     {595, 842},
+	"a5":     {420, 595},
+	"letter": {612, 792},
+	"legal":  {612, 1008},
+}
+
+// minScanDPI is the lowest resolution RenderScanJPEG drops to when
+// shrinking a page to fit its byte budget.
+const minScanDPI = 12
+
+// ScanImage is a JPEG-encoded scanned page.
+type ScanImage struct {
+	JPEG          []byte
+	Width, Height int // pixels
+	DPI           int
+	Quality       int
+}
+
+// RenderScanJPEG renders a grayscale scanned page of widthPt×heightPt
+// points at dpi and encodes it as a JPEG of at most budget bytes. When even
+// the lowest quality overshoots, the resolution is reduced until it fits.
+// hint is passed on to fitJPEG; pass the previous page's Quality.
+func RenderScanJPEG(r *Rand, widthPt, heightPt, dpi int, budget int64, hint int) (ScanImage, error) {
+	for {
+		w, h := max(widthPt*dpi/72, 1), max(heightPt*dpi/72, 1)
+		data, q, err := fitJPEG(renderScanPage(r, w, h), budget, hint)
+		if err == nil {
+			return ScanImage{JPEG: data, Width: w, Height: h, DPI: dpi, Quality: q}, nil
+		}
+		if dpi <= minScanDPI {
+			return ScanImage{}, err
+		}
+		dpi = max(dpi*7/10, minScanDPI)
+		hint = 0
+	}
+}
+
+// EncodeScanJPEG renders a grayscale scanned page of w×h pixels and
+// encodes it as a JPEG at quality, stating dpi as its resolution.
+func EncodeScanJPEG(r *Rand, w, h, dpi, quality int) (ScanImage, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, renderScanPage(r, w, h), &jpeg.Options{Quality: quality}); err != nil {
+		return ScanImage{}, err
+	}
+	return ScanImage{JPEG: buf.Bytes(), Width: w, Height: h, DPI: dpi, Quality: quality}, nil
+}
+
+// renderScanPage returns a w×h grayscale image resembling a scanned page:
+// an off-white, slightly noisy background with ragged lines of dark "words"
+// inside one-inch-ish margins, plus scattered dust specks.
+func renderScanPage(r *Rand, w, h int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	paper := byte(232 + r.IntN(16))
+	for i := range img.Pix {
+		img.Pix[i] = paper - byte(r.IntN(14))
+	}
+
+	margin := max(w/12, 1)
+	lineHeight := max(h/60, 3)
+	glyphHeight := max(lineHeight*3/5, 1)
+	for y := margin; y+glyphHeight < h-margin; y += lineHeight {
+		// Leave the odd blank line to suggest paragraphs.
+		if r.IntN(8) == 0 {
+			continue
+		}
+		end := w - margin - r.IntN(max(w/4, 1))
+		for x := margin; x < end; {
+			word := lineHeight/2 + r.IntN(lineHeight*3)
+			for yy := y; yy < y+glyphHeight; yy++ {
+				row := img.Pix[yy*img.Stride:]
+				for xx := x; xx < min(x+word, end); xx++ {
+					if r.IntN(4) != 0 {
+						row[xx] = byte(20 + r.IntN(70))
+					}
+				}
+			}
+			x += word + lineHeight/2
+		}
+	}
+
+	for i := (w * h) / 2000; i > 0; i-- {
+		img.Pix[r.IntN(len(img.Pix))] = byte(r.IntN(60))
+	}
+	return img
+}
+
+// fitJPEG encodes img as the highest-quality JPEG no larger than budget
+// bytes and returns it with the quality used. hint, when between 1 and
+// 100, is tried first and accepted if it lands within 15% of the budget,
+// which saves a search when encoding a run of similar images.
+func fitJPEG(img image.Image, budget int64, hint int) ([]byte, int, error) {
+	encode := func(q int) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: q}); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	if hint >= 1 && hint <= 100 {
+		data, err := encode(hint)
+		if err != nil {
+			return nil, 0, err
+		}
+		if n := int64(len(data)); n <= budget && n >= budget*85/100 {
+			return data, hint, nil
+		}
+	}
+
+	var best []byte
+	bestQ := 0
+	lo, hi := 1, 95
+	for lo <= hi {
+		q := (lo + hi) / 2
+		data, err := encode(q)
+		if err != nil {
+			return nil, 0, err
+		}
+		if int64(len(data)) <= budget {
+			best, bestQ = data, q
+			lo = q + 1
+		} else {
+			hi = q - 1
+		}
+	}
+	if best == nil {
+		return nil, 0, fmt.Errorf("cannot encode %dx%d image within %d bytes", img.Bounds().Dx(), img.Bounds().Dy(), budget)
+	}
+	return best, bestQ, nil
+}
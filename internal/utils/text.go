@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"strings"
+)
+
+// LoremWords is the vocabulary used for placeholder prose.
+var LoremWords = []string{
+	"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit",
+	"sed", "do", "eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore",
+	"magna", "aliqua", "enim", "ad", "minim", "veniam", "quis", "nostrud",
+	"exercitation", "ullamco", "laboris", "nisi", "aliquip", "ex", "ea", "commodo",
+	"consequat", "duis", "aute", "irure", "in", "reprehenderit", "voluptate",
+	"velit", "esse", "cillum", "fugiat", "nulla", "pariatur", "excepteur", "sint",
+	"occaecat", "cupidatat", "non", "proident", "sunt", "culpa", "qui", "officia",
+	"deserunt", "mollit", "anim", "id", "est", "laborum",
+}
+
+// RandSentence returns a capitalised sentence of between minWords and
+// maxWords lorem words, ending with a full stop.
+func RandSentence(r *Rand, minWords, maxWords int) string {
+	return Lorem.Sentence(r, minWords, maxWords)
+}
+
+// RandParagraph returns between minSentences and maxSentences sentences
+// joined by single spaces.
+func RandParagraph(r *Rand, minSentences, maxSentences int) string {
+	return Lorem.Paragraph(r, minSentences, maxSentences)
+}
+
+// WrapWords splits text into lines of at most width bytes, breaking at
+// spaces. Words longer than width get a line of their own.
+func WrapWords(text string, width int) []string {
+	var lines []string
+	var line strings.Builder
+	for _, w := range strings.Fields(text) {
+		if line.Len() > 0 && line.Len()+1+len(w) > width {
+			lines = append(lines, line.String())
+			line.Reset()
+		}
+		if line.Len() > 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(w)
+	}
+	if line.Len() > 0 {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
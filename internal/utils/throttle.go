@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"io"
+	"time"
+)
+
+// rateLimiter paces a byte stream to a fixed number of bytes per second.
+type rateLimiter struct {
+	rate  int64
+	start time.Time
+	done  int64
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{rate: bytesPerSec, now: time.Now, sleep: time.Sleep}
+}
+
+// chunk is the most bytes passed on at once, a tenth of a second's worth,
+// so the stream moves steadily rather than in bursts.
+func (l *rateLimiter) chunk() int {
+	return int(max(l.rate/10, 1))
+}
+
+// wait records n bytes and sleeps until the stream is back on schedule.
+func (l *rateLimiter) wait(n int) {
+	if l.start.IsZero() {
+		l.start = l.now()
+	}
+	l.done += int64(n)
+	due := l.start.Add(time.Duration(float64(l.done) / float64(l.rate) * float64(time.Second)))
+	if d := due.Sub(l.now()); d > 0 {
+		l.sleep(d)
+	}
+}
+
+type throttledWriter struct {
+	w io.Writer
+	l *rateLimiter
+}
+
+// NewThrottledWriter returns a writer that passes writes on to w at no more
+// than bytesPerSec bytes per second, to simulate a slow producer.
+func NewThrottledWriter(w io.Writer, bytesPerSec int64) io.Writer {
+	return &throttledWriter{w: w, l: newRateLimiter(bytesPerSec)}
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), t.l.chunk())
+		m, err := t.w.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		t.l.wait(m)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+type throttledReader struct {
+	r io.Reader
+	l *rateLimiter
+}
+
+// NewThrottledReader returns a reader that delivers r's bytes at no more
+// than bytesPerSec bytes per second.
+func NewThrottledReader(r io.Reader, bytesPerSec int64) io.Reader {
+	return &throttledReader{r: r, l: newRateLimiter(bytesPerSec)}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.l.chunk() {
+		p = p[:t.l.chunk()]
+	}
+	n, err := t.r.Read(p)
+	t.l.wait(n)
+	return n, err
+}
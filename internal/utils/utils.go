@@ -1,165 +1,87 @@
 package utils
 
 import (
-	"archive/zip"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
-	"os"
+	"math"
+	"math/big"
 	"strings"
-	"time"
 )
 
-// parseSize parses strings like "500", "10K", "4MB", "1G" into a number of bytes.
+// sizeUnits maps the upper-cased unit suffixes ParseSize accepts to
+// bytes. As with dd, KB, MB, GB and TB are decimal and the bare letters
+// binary, like KiB, MiB, GiB and TiB.
+var sizeUnits = map[string]int64{
+	"":  1,
+	"B": 1,
+	"K": 1 << 10, "KIB": 1 << 10, "KB": 1e3,
+	"M": 1 << 20, "MIB": 1 << 20, "MB": 1e6,
+	"G": 1 << 30, "GIB": 1 << 30, "GB": 1e9,
+	"T": 1 << 40, "TIB": 1 << 40, "TB": 1e12,
+}
+
+// ParseSize parses strings like "500", "10K", "4MB", "1.5GiB" or
+// "1GB+512B" into a number of bytes. Terms joined by + are added up; each
+// is a whole or decimal number and an optional unit. Fractions of a byte
+// are dropped.
 func ParseSize(sizeStr string) (int64, error) {
+	sizeStr = strings.TrimSpace(sizeStr)
 	if sizeStr == "" {
 		return 0, errors.New("size string is empty")
 	}
-
-	// if negative number, return error
-	if sizeStr[0] == '-' {
-		return 0, fmt.Errorf("negative size '%s' not allowed", sizeStr)
-	}
-
-	// Suffix multipliers
-	suffixes := map[string]int64{
-		"B": 1,
-		"K": 1024, "KB": 1024,
-		"M": 1024 * 1024, "MB": 1024 * 1024,
-		"G": 1024 * 1024 * 1024, "GB": 1024 * 1024 * 1024,
-	}
-	sizeStr = strings.TrimSpace(sizeStr)
-	sizeStr = strings.ToUpper(sizeStr)
-	// Find numeric part and suffix part
-	var numPart string
-	var suffix string
-	for i, r := range sizeStr {
-		if r < '0' || r > '9' {
-			numPart = sizeStr[:i]
-			suffix = strings.TrimSpace(sizeStr[i:])
-			break
+	var total int64
+	for _, term := range strings.Split(sizeStr, "+") {
+		n, err := parseSizeTerm(strings.TrimSpace(term))
+		if err != nil {
+			return 0, err
 		}
-	}
-	if numPart == "" {
-		// No explicit suffix, entire string is number or with suffix at end
-		// e.g., "1024" or "1024MB"
-		// Try to separate digits and letters
-		numPart = sizeStr
-		suffix = ""
-		for len(suffix) < len(sizeStr) && suffixes[numPart] == 0 {
-			// if the whole string isn't a known suffix key (unlikely), just break
-			break
+		if total > math.MaxInt64-n {
+			return 0, fmt.Errorf("size '%s' is too large", sizeStr)
 		}
+		total += n
 	}
-	// Parse numeric part
-	var baseVal int64
-	_, err := fmt.Sscanf(numPart, "%d", &baseVal)
-	if err != nil {
-		return 0, fmt.Errorf("invalid size number: %v", err)
-	}
-	if suffix == "" || suffix == "B" {
-		return baseVal, nil
-	}
-	mult, ok := suffixes[suffix]
-	if !ok {
-		return 0, fmt.Errorf("unknown size suffix '%s'", suffix)
-	}
-	return baseVal * mult, nil
+	return total, nil
 }
 
-// writeRandomBytes writes n random bytes to w. It uses a fixed seed for reproducibility (optional).
-func WriteRandomBytes(w io.Writer, n int64) error {
-	bufSize := 64 * 1024
-	buf := make([]byte, bufSize)
-	// Use math/rand for speed (cryptographic quality not needed for noise)
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	var written int64 = 0
-	for written < n {
-		toWrite := bufSize
-		if n-written < int64(bufSize) {
-			toWrite = int(n - written)
-		}
-		// Fill buffer with random bytes
-		for i := 0; i < toWrite; i++ {
-			buf[i] = byte(r.Intn(256))
-		}
-		_, err := w.Write(buf[:toWrite])
-		if err != nil {
-			return err
-		}
-		written += int64(toWrite)
+// parseSizeTerm parses one term of a size, a number and an optional unit.
+func parseSizeTerm(term string) (int64, error) {
+	if term == "" {
+		return 0, errors.New("size has an empty term")
 	}
-	return nil
-}
-
-// padZipFile adds a zip comment or dummy entry to reach the exact size.
-func PadZipExtend(inPath string, targetSize int64) error {
-	info, err := os.Stat(inPath)
-	if err != nil {
-		return err
+	if term[0] == '-' {
+		return 0, fmt.Errorf("negative size '%s' not allowed", term)
 	}
-	orig := info.Size()
-	if orig > targetSize {
-		return fmt.Errorf("file is %d > target %d", orig, targetSize)
+	end := strings.IndexFunc(term, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end < 0 {
+		end = len(term)
 	}
-	// compute overhead of empty pad.bin entry
-	padOH := ZipEntryOverhead()
-	needed := targetSize - orig - padOH
-
-	// open original
-	zr, err := zip.OpenReader(inPath)
-	if err != nil {
-		return err
+	num, unit := term[:end], strings.ToUpper(strings.TrimSpace(term[end:]))
+	value, ok := new(big.Rat).SetString(num)
+	if num == "" || !ok || strings.Count(num, ".") > 1 {
+		return 0, fmt.Errorf("invalid size number '%s'", term)
 	}
-	defer zr.Close()
-
-	tmp := inPath + ".tmp"
-	outF, _ := os.Create(tmp)
-	zw := zip.NewWriter(outF)
-
-	// copy entries
-	for _, f := range zr.File {
-		hdr := f.FileHeader
-		w, _ := zw.CreateHeader(&hdr)
-		r, _ := f.Open()
-		io.Copy(w, r)
-		r.Close()
+	mult, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown size suffix '%s'", term[end:])
 	}
-	// create pad.bin uncompressed
-	padHdr := &zip.FileHeader{Name: "pad.bin", Method: zip.Store}
-	w, _ := zw.CreateHeader(padHdr)
-	zero := make([]byte, 64*1024)
-	for needed > 0 {
-		chunk := int64(len(zero))
-		if chunk > needed {
-			chunk = needed
-		}
-		w.Write(zero[:chunk])
-		needed -= chunk
+	r := value.Mul(value, new(big.Rat).SetInt64(mult))
+	n := new(big.Int).Quo(r.Num(), r.Denom())
+	if !n.IsInt64() {
+		return 0, fmt.Errorf("size '%s' is too large", term)
 	}
-	zw.Close()
-	outF.Close()
-	os.Rename(tmp, inPath)
-	return nil
-}
-
-// zipEntryOverhead returns the byte-length of an empty 'pad.bin' entry in a new ZIP.
-func ZipEntryOverhead() int64 {
-	buf := &bytes.Buffer{}
-	zw := zip.NewWriter(buf)
-	hdr := &zip.FileHeader{Name: "pad.bin", Method: zip.Store}
-	zw.CreateHeader(hdr)
-	zw.Close()
-	return int64(buf.Len())
+	return n.Int64(), nil
 }
 
-// randString returns a random A–Z string of length n.
-func RandString(n int) string {
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = byte('A' + rand.Intn(26))
+// WriteZeros writes n zero bytes to w.
+func WriteZeros(w io.Writer, n int64) error {
+	buf := make([]byte, min(n, 64*1024))
+	for n > 0 {
+		k := min(n, int64(len(buf)))
+		if _, err := w.Write(buf[:k]); err != nil {
+			return err
+		}
+		n -= k
 	}
-	return string(b)
+	return nil
 }
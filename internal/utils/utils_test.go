@@ -1,8 +1,21 @@
 package utils
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func TestParseSize(t *testing.T) {
@@ -16,28 +29,52 @@ func TestParseSize(t *testing.T) {
 		{"500B", 500, false},
 		{"10k", 10 * 1024, false},
 		{"10K", 10 * 1024, false},
-		{"10kb", 10 * 1024, false},
-		{"10KB", 10 * 1024, false},
+		{"10kb", 10 * 1000, false},
+		{"10KB", 10 * 1000, false},
+		{"10KiB", 10 * 1024, false},
+		{"10kib", 10 * 1024, false},
 		{"4m", 4 * 1024 * 1024, false},
 		{"4M", 4 * 1024 * 1024, false},
-		{"4MB", 4 * 1024 * 1024, false},
+		{"4MB", 4 * 1000 * 1000, false},
+		{"4MiB", 4 * 1024 * 1024, false},
 		{"1g", 1 * 1024 * 1024 * 1024, false},
 		{"1G", 1 * 1024 * 1024 * 1024, false},
-		{"1GB", 1 * 1024 * 1024 * 1024, false},
+		{"1GB", 1 * 1000 * 1000 * 1000, false},
+		{"1GiB", 1 * 1024 * 1024 * 1024, false},
+		{"2T", 2 << 40, false},
+		{"2TB", 2e12, false},
 		{"1024", 1024, false},
 		{"0", 0, false},
 		{"0B", 0, false},
 		{"0KB", 0, false},
+		{" 10 MB ", 10e6, false},
+		{"1.5GB", 1.5e9, false},
+		{"1.5GiB", 3 << 29, false},
+		{"0.5M", 512 * 1024, false},
+		{"10.5K", 10752, false},
+		{".5K", 512, false},
+		{"1.1K", 1126, false}, // fractions of a byte are dropped
+		{"0.3B", 0, false},    // likewise
+		{"1GB+512B", 1e9 + 512, false},
+		{"1MiB + 1KiB + 1", 1<<20 + 1<<10 + 1, false},
 
 		// Invalid cases
-		{"", 0, true},        // Empty string
-		{"-100", 0, true},    // Negative number (Sscanf might parse but logic could enforce non-negative) - current impl allows
-		{"10P", 0, true},     // Unknown suffix
-		{"KB", 0, true},      // No number
-		{"10.5K", 0, true},   // Non-integer number part
-		{"abc", 0, true},     // Non-numeric
-		{"10 M B", 0, true},  // Space in suffix
-		{"1 0 K B", 0, true}, // Space in number
+		{"", 0, true},                           // Empty string
+		{"-100", 0, true},                       // Negative number
+		{" -100", 0, true},                      // Negative number after a space
+		{"1GB+-5B", 0, true},                    // Negative term
+		{"1GB+", 0, true},                       // Empty term
+		{"+1GB", 0, true},                       // Empty term
+		{"10P", 0, true},                        // Unknown suffix
+		{"8E", 0, true},                         // Unknown suffix
+		{"9000000T", 0, true},                   // Overflow
+		{"4000000T+4000000T+1000000T", 0, true}, // Overflowing sum
+		{"KB", 0, true},                         // No number
+		{"1.2.3K", 0, true},                     // Two decimal points
+		{".", 0, true},                          // No digits
+		{"abc", 0, true},                        // Non-numeric
+		{"10 M B", 0, true},                     // Space in suffix
+		{"1 0 K B", 0, true},                    // Space in number
 	}
 
 	for _, tc := range tests {
@@ -55,21 +92,577 @@ func TestParseSize(t *testing.T) {
 	}
 }
 
-// Add tests for WriteRandomBytes, PadZipExtend, ZipEntryOverhead, RandString if needed
+func TestCRC32Zeros(t *testing.T) {
+	for _, n := range []int64{0, 1, 7, 1000, 65539, 1 << 20} {
+		if got, want := CRC32Zeros(n), crc32.ChecksumIEEE(make([]byte, n)); got != want {
+			t.Errorf("CRC32Zeros(%d) = %#x, want %#x", n, got, want)
+		}
+	}
+}
+
 func TestRandString(t *testing.T) {
 	lengths := []int{0, 1, 10, 100}
 	for _, length := range lengths {
 		t.Run(fmt.Sprintf("Length_%d", length), func(t *testing.T) {
-			s := RandString(length) //
+			s := testRand(t).String(length)
 			if len(s) != length {
-				t.Errorf("RandString(%d) returned string of length %d, want %d", length, len(s), length)
+				t.Errorf("String(%d) returned string of length %d, want %d", length, len(s), length)
 			}
-			// Optionally check character set if needed
 			for _, r := range s {
 				if r < 'A' || r > 'Z' {
-					t.Errorf("RandString(%d) returned char '%c' outside expected A-Z range", length, r)
+					t.Errorf("String(%d) returned char '%c' outside expected A-Z range", length, r)
+				}
+			}
+		})
+	}
+}
+
+func TestRandSentence(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		s := RandSentence(testRand(t), 3, 8)
+		words := strings.Fields(s)
+		if len(words) < 3 || len(words) > 8 {
+			t.Fatalf("RandSentence(3, 8) = %q has %d words", s, len(words))
+		}
+		if !strings.HasSuffix(s, ".") || s[0] < 'A' || s[0] > 'Z' {
+			t.Fatalf("RandSentence(3, 8) = %q is not a capitalised sentence", s)
+		}
+	}
+}
+
+func TestWrapWords(t *testing.T) {
+	text := RandParagraph(testRand(t), 5, 5)
+	lines := WrapWords(text, 40)
+	if strings.Join(lines, " ") != strings.Join(strings.Fields(text), " ") {
+		t.Errorf("WrapWords lost or reordered words")
+	}
+	for _, l := range lines {
+		if len(l) > 40 && strings.Contains(l, " ") {
+			t.Errorf("line %q exceeds width 40", l)
+		}
+	}
+}
+
+func TestRenderScanJPEG(t *testing.T) {
+	const budget = 20 * 1024
+	img, err := RenderScanJPEG(testRand(t), 595, 842, 150, budget, 0)
+	if err != nil {
+		t.Fatalf("RenderScanJPEG failed: %v", err)
+	}
+	if n := len(img.JPEG); n == 0 || n > budget {
+		t.Fatalf("JPEG is %d bytes, want 1..%d", n, budget)
+	}
+	if img.DPI > 150 || img.Width != 595*img.DPI/72 || img.Height != 842*img.DPI/72 {
+		t.Errorf("unexpected geometry %dx%d at %d dpi", img.Width, img.Height, img.DPI)
+	}
+
+	if _, err := RenderScanJPEG(testRand(t), 595, 842, 150, 100, 0); err == nil {
+		t.Error("expected an error for a budget no JPEG can meet")
+	}
+}
+
+// fakeClock stands in for time.Now and time.Sleep in rate limiter tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time        { return c.t }
+func (c *fakeClock) sleep(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestThrottle(t *testing.T) {
+	const rate = 1000 // bytes per second
+	data := bytes.Repeat([]byte("x"), 2500)
+
+	newLimiter := func(clock *fakeClock) *rateLimiter {
+		l := newRateLimiter(rate)
+		l.now, l.sleep = clock.now, clock.sleep
+		return l
+	}
+
+	t.Run("Writer", func(t *testing.T) {
+		clock := &fakeClock{t: time.Unix(0, 0)}
+		var out bytes.Buffer
+		w := &throttledWriter{w: &out, l: newLimiter(clock)}
+		if n, err := w.Write(data); n != len(data) || err != nil {
+			t.Fatalf("Write() = %d, %v", n, err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Error("written data differs")
+		}
+		if got := clock.t.Sub(time.Unix(0, 0)); got != 2500*time.Millisecond {
+			t.Errorf("writing took %v, want 2.5s", got)
+		}
+	})
+
+	t.Run("Reader", func(t *testing.T) {
+		clock := &fakeClock{t: time.Unix(0, 0)}
+		r := &throttledReader{r: bytes.NewReader(data), l: newLimiter(clock)}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("ReadAll() = %d bytes, %v", len(got), err)
+		}
+		if got := clock.t.Sub(time.Unix(0, 0)); got != 2500*time.Millisecond {
+			t.Errorf("reading took %v, want 2.5s", got)
+		}
+	})
+
+	t.Run("Slow sink is not penalised", func(t *testing.T) {
+		clock := &fakeClock{t: time.Unix(0, 0)}
+		l := newLimiter(clock)
+		l.wait(100)                        // due at 0.1s
+		clock.t = clock.t.Add(time.Second) // the sink itself took a second
+		l.wait(100)                        // due at 0.2s, already past
+		if got := clock.t.Sub(time.Unix(0, 0)); got != 1100*time.Millisecond {
+			t.Errorf("clock at %v, want 1.1s", got)
+		}
+	})
+}
+
+func TestExtend(t *testing.T) {
+	for _, preallocate := range []bool{false, true} {
+		t.Run(fmt.Sprintf("preallocate=%v", preallocate), func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			f.WriteString("head")
+			if err := Extend(f, 1<<20, preallocate); err != nil {
+				t.Fatalf("Extend() error = %v", err)
+			}
+			f.WriteString("tail")
+			if err := Extend(f, 10, preallocate); err == nil {
+				t.Error("Extend() below the offset succeeded")
+			}
+
+			data, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != 1<<20+4 {
+				t.Fatalf("file is %d bytes, want %d", len(data), 1<<20+4)
+			}
+			if string(data[:4]) != "head" || string(data[1<<20:]) != "tail" {
+				t.Errorf("head/tail = %q/%q", data[:4], data[1<<20:])
+			}
+			if !bytes.Equal(data[4:1<<20], make([]byte, 1<<20-4)) {
+				t.Error("extended bytes are not zero")
+			}
+		})
+	}
+}
+
+func TestEICAR(t *testing.T) {
+	// The published MD5 of the EICAR test file.
+	if got := fmt.Sprintf("%x", md5.Sum(EICAR())); got != "44d88612fea8a8f36de82e1278abb02f" {
+		t.Errorf("EICAR() md5 = %s", got)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	for _, name := range []string{"", "ar", "zh", "ru", "emoji", "mixed"} {
+		t.Run(name, func(t *testing.T) {
+			l, err := ParseLanguage(name)
+			if err != nil {
+				t.Fatalf("ParseLanguage(%q) unexpected error = %v", name, err)
+			}
+			for _, n := range []int{0, 1, 2, 3, 7, 64, 1000} {
+				s := l.Text(testRand(t), n)
+				if len(s) != n || !utf8.ValidString(s) {
+					t.Errorf("Text(%d) = %q (%d bytes), want %d bytes of valid UTF-8", n, s, len(s), n)
+				}
+			}
+			if p := l.Paragraph(testRand(t), 2, 4); !utf8.ValidString(p) || strings.ContainsAny(p, ",\"\\<>&") {
+				t.Errorf("Paragraph() = %q contains characters that need escaping", p)
+			}
+		})
+	}
+	if _, err := ParseLanguage("klingon"); err == nil || !strings.Contains(err.Error(), "unknown lang") {
+		t.Errorf("ParseLanguage(klingon) error = %v, want unknown lang", err)
+	}
+}
+
+func TestLoadCorpus(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("The cat sat. It's \"late\" -- isn't it?\nid,name\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, ".hidden"), []byte("Never read."), 0o644)
+	l, err := TextLanguage("", dir)
+	if err != nil {
+		t.Fatalf("TextLanguage() unexpected error = %v", err)
+	}
+	want := []string{"The cat sat", "It’s late isn’t it", "id name"}
+	if strings.Join(l.sentences, "|") != strings.Join(want, "|") {
+		t.Errorf("sentences = %q, want %q", l.sentences, want)
+	}
+	for _, n := range []int{0, 1, 3, 64, 1000} {
+		if s := l.Text(testRand(t), n); len(s) != n || !utf8.ValidString(s) {
+			t.Errorf("Text(%d) = %q (%d bytes), want %d bytes of valid UTF-8", n, s, len(s), n)
+		}
+	}
+	if p := l.Paragraph(testRand(t), 2, 4); strings.ContainsAny(p, ",\"\\<>&-") {
+		t.Errorf("Paragraph() = %q contains characters that need escaping", p)
+	}
+
+	if _, err := TextLanguage("ar", dir); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("TextLanguage(ar, corpus) error = %v, want cannot be combined", err)
+	}
+	empty := filepath.Join(dir, "empty")
+	os.Mkdir(empty, 0o755)
+	if _, err := LoadCorpus(empty); err == nil || !strings.Contains(err.Error(), "holds no text") {
+		t.Errorf("LoadCorpus(empty) error = %v, want holds no text", err)
+	}
+}
+
+func TestParseNeedle(t *testing.T) {
+	tests := []struct {
+		text, count string
+		want        Needle
+		wantErr     string
+	}{
+		{text: "", count: "", want: Needle{}},
+		{text: "NEEDLE-12345", count: "", want: Needle{Text: "NEEDLE-12345", Count: 1}},
+		{text: "café (x)", count: " 10", want: Needle{Text: "café (x)", Count: 10}},
+		{text: "", count: "3", wantErr: "needs embed-string"},
+		{text: "two\nlines", count: "", wantErr: "printable"},
+		{text: "x", count: "0", wantErr: "at least 1"},
+		{text: "x", count: "many", wantErr: "at least 1"},
+	}
+	for _, tc := range tests {
+		got, err := ParseNeedle(tc.text, tc.count)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ParseNeedle(%q, %q) error = %v, want %q", tc.text, tc.count, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseNeedle(%q, %q) = %+v, %v; want %+v", tc.text, tc.count, got, err, tc.want)
+		}
+	}
+
+	// The copies split the places evenly and all fall inside them.
+	n := Needle{Text: "x", Count: 3}
+	for i, want := range []int64{25, 50, 75} {
+		if got := n.At(i, 100); got != want {
+			t.Errorf("At(%d, 100) = %d, want %d", i, got, want)
+		}
+	}
+	if got := n.At(2, 2); got != 1 {
+		t.Errorf("At(2, 2) = %d, want 1", got)
+	}
+}
+
+func TestRandPII(t *testing.T) {
+	if got := LuhnDigit("7992739871"); got != '3' {
+		t.Errorf("LuhnDigit(7992739871) = %c, want 3", got)
+	}
+	for i := 0; i < 1000; i++ {
+		item := RandPII(testRand(t))
+		if len(item.Value) > MaxPIILen {
+			t.Fatalf("%s %q is longer than %d", item.Type, item.Value, MaxPIILen)
+		}
+		switch item.Type {
+		case PIISSN:
+			area, _ := strconv.Atoi(item.Value[:3])
+			if len(item.Value) != 11 || area == 0 || area == 666 || area >= 900 || item.Value[4:6] == "00" || item.Value[7:] == "0000" {
+				t.Fatalf("invalid SSN %q", item.Value)
+			}
+		case PIICreditCard:
+			digits := strings.ReplaceAll(item.Value, " ", "")
+			if len(digits) != 15 && len(digits) != 16 || LuhnDigit(digits[:len(digits)-1]) != digits[len(digits)-1] {
+				t.Fatalf("card number %q fails the Luhn check", item.Value)
+			}
+		case PIIEmail:
+			if !strings.Contains(item.Value, "@example.") {
+				t.Fatalf("email %q is not at an example domain", item.Value)
+			}
+		default:
+			t.Fatalf("unknown type %q", item.Type)
+		}
+	}
+
+	for _, s := range []string{"", "0.5", "1"} {
+		if _, err := ParsePIIDensity(s); err != nil {
+			t.Errorf("ParsePIIDensity(%q) error = %v", s, err)
+		}
+	}
+	for _, s := range []string{"0", "1.5", "-0.1", "half"} {
+		if _, err := ParsePIIDensity(s); err == nil {
+			t.Errorf("ParsePIIDensity(%q) succeeded", s)
+		}
+	}
+}
+
+func TestFiller(t *testing.T) {
+	for _, entropy := range []float64{0, 0.1, 0.5, 0.9, 1} {
+		r := testRand(t)
+		f, err := ParseFiller(r, fmt.Sprint(entropy), "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf, gz bytes.Buffer
+		if err := f.Write(r, &buf, 1<<20+3); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != 1<<20+3 {
+			t.Fatalf("entropy %g: wrote %d bytes", entropy, buf.Len())
+		}
+		// Faster levels give up looking for matches in long random runs.
+		zw, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+		zw.Write(buf.Bytes())
+		zw.Close()
+		if ratio := float64(gz.Len()) / float64(buf.Len()); ratio < entropy-0.02 || ratio > entropy+0.03 {
+			t.Errorf("entropy %g compresses to %.3f of the size", entropy, ratio)
+		}
+	}
+
+	t.Run("Shared pool", func(t *testing.T) {
+		write := func(pool string) []byte {
+			r := testRand(t)
+			f, err := ParseFiller(r, "", "0.5", pool)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := f.Write(r, &buf, 16*FillerChunk); err != nil {
+				t.Fatal(err)
+			}
+			return buf.Bytes()
+		}
+		a, b, other := write("42"), write("42"), write("43")
+		shared := 0
+		for c := 0; c < 16; c++ {
+			chunk := func(data []byte) []byte { return data[c*FillerChunk : (c+1)*FillerChunk] }
+			same := bytes.Equal(chunk(a), chunk(b))
+			if same != spread(int64(c), 0.5) {
+				t.Errorf("chunk %d: same in both files = %v", c, same)
+			}
+			if same {
+				shared++
+				if bytes.Equal(chunk(a), chunk(other)) {
+					t.Errorf("chunk %d is the same with another pool", c)
 				}
 			}
+		}
+		if shared != 8 {
+			t.Errorf("%d of 16 chunks shared, want 8", shared)
+		}
+	})
+
+	for _, args := range [][3]string{{"-0.1", "", ""}, {"1.5", "", ""}, {"high", "", ""}, {"", "2", ""}, {"", "", "7"}, {"", "0.5", "seed"}} {
+		if _, err := ParseFiller(testRand(t), args[0], args[1], args[2]); err == nil {
+			t.Errorf("ParseFiller(%q) succeeded", args)
+		}
+	}
+}
+
+func TestParseThreads(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"", 1, false},
+		{"1", 1, false},
+		{" 8 ", 8, false},
+		{"0", runtime.NumCPU(), false},
+		{"-1", 0, true},
+		{"1.5", 0, true},
+		{"all", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseThreads(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseThreads(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestWriteParallel(t *testing.T) {
+	// Each byte depends on its offset only, so any order of filling gives
+	// the same bytes.
+	fill := func(b []byte, offset int64) error {
+		for i := range b {
+			n := offset + int64(i)
+			b[i] = byte(n ^ n>>8 ^ n>>16)
+		}
+		return nil
+	}
+	const n = 5*ParallelChunk + 12345
+	var want bytes.Buffer
+	if err := WriteParallel(&want, n, 1, fill); err != nil {
+		t.Fatal(err)
+	}
+	if want.Len() != n {
+		t.Fatalf("serial: wrote %d bytes", want.Len())
+	}
+
+	for _, threads := range []int{2, 4, 16} {
+		t.Run(fmt.Sprintf("Stream %d", threads), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteParallel(&buf, n, threads, fill); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+				t.Error("bytes differ from the serial ones")
+			}
+		})
+		t.Run(fmt.Sprintf("File %d", threads), func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			f.WriteString("head")
+			if err := WriteParallel(f, n, threads, fill); err != nil {
+				t.Fatal(err)
+			}
+			f.WriteString("tail")
+			got, _ := os.ReadFile(f.Name())
+			if string(got[:4]) != "head" || string(got[len(got)-4:]) != "tail" || !bytes.Equal(got[4:len(got)-4], want.Bytes()) {
+				t.Error("bytes differ from the serial ones")
+			}
+		})
+	}
+
+	failing := func(b []byte, offset int64) error {
+		if offset >= 2*ParallelChunk {
+			return fmt.Errorf("fill failed at %d", offset)
+		}
+		return fill(b, offset)
+	}
+	if err := WriteParallel(io.Discard, n, 4, failing); err == nil {
+		t.Error("stream: fill error not returned")
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := WriteParallel(f, n, 4, failing); err == nil {
+		t.Error("file: fill error not returned")
+	}
+}
+
+// testRand returns a Rand seeded at random.
+func testRand(t testing.TB) *Rand {
+	t.Helper()
+	r, err := NewRand("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRandWriteBytes(t *testing.T) {
+	for _, n := range []int64{0, 1, 7, randomChunk + 13} {
+		var a, b bytes.Buffer
+		if err := testRand(t).WriteBytes(&a, n); err != nil {
+			t.Fatal(err)
+		}
+		testRand(t).WriteBytes(&b, n)
+		if int64(a.Len()) != n {
+			t.Errorf("WriteBytes(%d) wrote %d bytes", n, a.Len())
+		}
+		if n > 1 && bytes.Equal(a.Bytes(), b.Bytes()) {
+			t.Errorf("WriteBytes(%d) wrote the same bytes twice", n)
+		}
+	}
+
+	var buf, gz bytes.Buffer
+	testRand(t).WriteBytes(&buf, 1<<20)
+	zw := gzip.NewWriter(&gz)
+	zw.Write(buf.Bytes())
+	zw.Close()
+	if gz.Len() < buf.Len() {
+		t.Errorf("random bytes compress to %d of %d bytes", gz.Len(), buf.Len())
+	}
+
+	// FillAt is safe to call on several goroutines.
+	r := testRand(t)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := make([]byte, 4096)
+			for i := range 100 {
+				r.FillAt(b, int64(i)*4096)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSeededRand(t *testing.T) {
+	draw := func(seed string) []byte {
+		r, err := NewRand(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		fmt.Fprint(&buf, r.IntN(1000), r.String(8))
+		r.WriteBytes(&buf, 1000)
+		b := make([]byte, 1000)
+		r.FillAt(b, 3*ParallelChunk)
+		return append(buf.Bytes(), b...)
+	}
+	if a, b := draw("7"), draw("7"); !bytes.Equal(a, b) {
+		t.Error("the same seed drew different choices and bytes")
+	}
+	if a, b := draw("7"), draw("8"); bytes.Equal(a, b) {
+		t.Error("different seeds drew the same choices and bytes")
+	}
+
+	// FillAt depends on the offset alone, not on what was drawn before.
+	a, b := SeededRand(7), SeededRand(7)
+	a.IntN(10)
+	x, y := make([]byte, 64), make([]byte, 64)
+	a.FillAt(x, 100)
+	b.FillAt(y, 100)
+	if !bytes.Equal(x, y) {
+		t.Error("FillAt depends on what was drawn before")
+	}
+	if b.FillAt(y, 200); bytes.Equal(x, y) {
+		t.Error("FillAt gave the same bytes at another offset")
+	}
+	// Nor on how the run is cut into calls.
+	whole, pieces := make([]byte, 3*fillAtBlock), make([]byte, 3*fillAtBlock)
+	a.FillAt(whole, 1000)
+	for off := 0; off < len(pieces); off += 10007 {
+		b.FillAt(pieces[off:min(off+10007, len(pieces))], int64(1000+off))
+	}
+	if !bytes.Equal(whole, pieces) {
+		t.Error("FillAt depends on how the run is cut into calls")
+	}
+
+	if _, err := NewRand("seven"); err == nil {
+		t.Error(`NewRand("seven") succeeded`)
+	}
+}
+
+func BenchmarkRandWriteBytes(b *testing.B) {
+	r := testRand(b)
+	b.SetBytes(64 << 20)
+	for b.Loop() {
+		r.WriteBytes(io.Discard, 64<<20)
+	}
+}
+
+func BenchmarkFillerWrite(b *testing.B) {
+	f, r := Filler{Entropy: 0.5}, testRand(b)
+	b.SetBytes(64 << 20)
+	for b.Loop() {
+		f.Write(r, io.Discard, 64<<20)
+	}
+}
+
+func BenchmarkWriteParallel(b *testing.B) {
+	for _, threads := range []int{1, 4} {
+		b.Run(fmt.Sprintf("Threads%d", threads), func(b *testing.B) {
+			r := testRand(b)
+			b.SetBytes(64 << 20)
+			for b.Loop() {
+				WriteParallel(io.Discard, 64<<20, threads, r.FillAt)
+			}
 		})
 	}
 }